@@ -2,15 +2,19 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/ceyewan/gochat/im-infra/coord"
+	"github.com/ceyewan/gochat/im-infra/coord/config"
 	"github.com/spf13/cobra"
 )
 
@@ -37,6 +41,8 @@ func main() {
 
 	// 添加子命令
 	rootCmd.AddCommand(syncCmd())
+	rootCmd.AddCommand(setCmd())
+	rootCmd.AddCommand(schemaCmd())
 
 	if err := rootCmd.Execute(); err != nil {
 		log.Fatal(err)
@@ -46,13 +52,13 @@ func main() {
 // createCoordinator 创建协调器实例
 func createCoordinator(ctx context.Context) (coord.Provider, error) {
 	config := coord.CoordinatorConfig{
-		Endpoints: endpoints,
-		Username:  username,
-		Password:  password,
-		Timeout:   timeout,
+		Endpoints:   endpoints,
+		Username:    username,
+		Password:    password,
+		DialTimeout: timeout,
 	}
 
-	return coord.New(ctx, config)
+	return coord.New(ctx, &config)
 }
 
 // syncCmd 同步配置命令 - 核心功能
@@ -66,6 +72,7 @@ func syncCmd() *cobra.Command {
 		Short: "将 JSON 配置文件同步到 etcd 配置中心",
 		Long: `将本地 JSON 配置文件原子地写入 etcd 配置中心。
 支持同步所有配置或指定环境的配置。
+写入前会按配置中心注册的 Schema 校验所有配置，任何一个未通过时不写入任何配置。
 
 示例:
 		config-cli sync          # 同步所有环境的配置
@@ -92,6 +99,21 @@ func syncCmd() *cobra.Command {
 			// 显示配置摘要
 			printConfigSummary(configs)
 
+			// 创建协调器连接
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			coordinator, err := createCoordinator(ctx)
+			if err != nil {
+				return fmt.Errorf("创建协调器失败: %w", err)
+			}
+			defer coordinator.Close()
+
+			// 按 Schema 校验所有配置，避免只写入一部分
+			if invalid := validateConfigs(ctx, coordinator, configs); invalid > 0 {
+				return fmt.Errorf("有 %d 个配置未通过 Schema 校验，未写入任何配置", invalid)
+			}
+
 			if dryRun {
 				fmt.Println("\n🔍 干运行模式：不会实际写入配置中心")
 				return nil
@@ -108,7 +130,53 @@ func syncCmd() *cobra.Command {
 				}
 			}
 
-			// 创建协调器连接
+			// 批量写入配置
+			return writeConfigs(ctx, coordinator, configs)
+		},
+	}
+
+	cmd.Flags().StringVarP(&configPath, "config-path", "c", "..", "配置文件根目录路径")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "干运行模式，只显示将要执行的操作并校验 Schema")
+	cmd.Flags().BoolVar(&force, "force", false, "强制执行，不询问确认")
+
+	return cmd
+}
+
+// setCmd 写入单个配置键的命令
+func setCmd() *cobra.Command {
+	var file string
+	var preview bool
+	var force bool
+
+	cmd := &cobra.Command{
+		Use:   "set <key> [value]",
+		Short: "写入单个配置键，写入前展示变更差异和受影响的监听者",
+		Long: `写入单个配置键。写入前按 Schema 校验新值，展示与当前值的逐字段差异，
+以及集群中所有监听该键（或其前缀）、写入后会收到变更事件的服务实例。
+确认后以预览时读到的版本做 CAS 写入，预览之后该键被他人修改时拒绝写入。
+
+示例:
+		config-cli set dev/im-logic/limits '{"maxConn": 2000}' --preview   # 只预览，不写入
+		config-cli set dev/im-logic/limits -f ./limits.json                  # 预览并确认后写入`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			key := args[0]
+			var value []byte
+			switch {
+			case file != "" && len(args) == 2:
+				return errors.New("不能同时指定 value 和 --file")
+			case file != "":
+				data, err := os.ReadFile(file)
+				if err != nil {
+					return fmt.Errorf("读取配置文件失败: %w", err)
+				}
+				value = data
+			case len(args) == 2:
+				value = []byte(args[1])
+			default:
+				return errors.New("需要指定 value 或 --file")
+			}
+
 			ctx, cancel := context.WithTimeout(context.Background(), timeout)
 			defer cancel()
 
@@ -118,18 +186,102 @@ func syncCmd() *cobra.Command {
 			}
 			defer coordinator.Close()
 
-			// 批量写入配置
-			return writeConfigs(ctx, coordinator, configs)
+			configCenter := coordinator.Config()
+			p, err := configCenter.Preview(ctx, key, value)
+			if err != nil {
+				fmt.Printf("❌ %s 未通过校验\n", key)
+				printViolations(err)
+				return err
+			}
+			printPreview(p)
+
+			if preview {
+				fmt.Println("\n🔍 预览模式：不会实际写入配置中心")
+				return nil
+			}
+			if p.Unchanged() {
+				fmt.Println("\n新值与当前值相同，无需写入")
+				return nil
+			}
+
+			if !force {
+				fmt.Printf("\n❓ 确定要写入 %s 吗？(y/N): ", p.Key)
+				var response string
+				fmt.Scanln(&response)
+				if strings.ToLower(response) != "y" && strings.ToLower(response) != "yes" {
+					fmt.Println("操作已取消")
+					return nil
+				}
+			}
+
+			// 键已存在时按预览时的版本写入，保证写入的正是预览过的变更
+			if p.Exists {
+				err = configCenter.CompareAndSet(ctx, key, value, p.Version)
+			} else {
+				err = configCenter.Set(ctx, key, value)
+			}
+			if err != nil {
+				return fmt.Errorf("写入 %s 失败: %w", p.Key, err)
+			}
+			fmt.Printf("✅ 已写入 %s\n", p.Key)
+			return nil
 		},
 	}
 
-	cmd.Flags().StringVarP(&configPath, "config-path", "c", "..", "配置文件根目录路径")
-	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "干运行模式，只显示将要执行的操作")
+	cmd.Flags().StringVarP(&file, "file", "f", "", "从文件读取新值")
+	cmd.Flags().BoolVar(&preview, "preview", false, "预览模式，只展示变更差异和受影响的监听者")
 	cmd.Flags().BoolVar(&force, "force", false, "强制执行，不询问确认")
 
 	return cmd
 }
 
+// printPreview 打印变更预览：逐字段差异和受影响的监听者
+func printPreview(p *config.ChangePreview) {
+	if p.Exists {
+		fmt.Printf("📝 %s (当前版本 %d)\n", p.Key, p.Version)
+	} else {
+		fmt.Printf("📝 %s (新建)\n", p.Key)
+	}
+
+	if p.Unchanged() {
+		fmt.Println("\n  无变化")
+	} else {
+		fmt.Printf("\n  变更 %d 处:\n", len(p.Changes))
+		for _, c := range p.Changes {
+			switch c.Type {
+			case config.ChangeAdded:
+				fmt.Printf("  + %s: %s\n", c.Path, formatValue(c.New))
+			case config.ChangeRemoved:
+				fmt.Printf("  - %s: %s\n", c.Path, formatValue(c.Old))
+			default:
+				fmt.Printf("  ~ %s: %s -> %s\n", c.Path, formatValue(c.Old), formatValue(c.New))
+			}
+		}
+	}
+
+	if len(p.Watchers) == 0 {
+		fmt.Println("\n  👂 没有监听者会收到此变更")
+		return
+	}
+	fmt.Printf("\n  👂 %d 个监听者会收到此变更:\n", len(p.Watchers))
+	for _, w := range p.Watchers {
+		kind := "key"
+		if w.Prefix {
+			kind = "prefix"
+		}
+		fmt.Printf("    - %s (%s %s，自 %s)\n", w.Instance, kind, w.Key, w.Since.Format(time.RFC3339))
+	}
+}
+
+// formatValue 将差异中的值格式化为紧凑的 JSON
+func formatValue(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
 // ConfigInfo 配置信息结构
 type ConfigInfo struct {
 	Env       string `json:"env"`
@@ -254,6 +406,7 @@ func writeConfigs(ctx context.Context, coordinator coord.Provider, configs []Con
 		// 原子地写入配置（覆盖模式）
 		if err := configCenter.Set(ctx, config.Key, config.Config); err != nil {
 			fmt.Printf("❌ 失败: %v\n", err)
+			printViolations(err)
 			errorCount++
 			continue
 		}
@@ -270,3 +423,119 @@ func writeConfigs(ctx context.Context, coordinator coord.Provider, configs []Con
 
 	return nil
 }
+
+// validateConfigs 按配置中心注册的 Schema 校验所有配置，返回未通过的数量
+func validateConfigs(ctx context.Context, coordinator coord.Provider, configs []ConfigInfo) int {
+	fmt.Println("🔎 校验配置 Schema...")
+	schemas := coordinator.ConfigSchemas()
+	invalid := 0
+	for _, cfg := range configs {
+		if err := schemas.Validate(ctx, cfg.Key, cfg.Config); err != nil {
+			fmt.Printf("  ❌ %s (%s)\n", cfg.Key, cfg.FilePath)
+			if !printViolations(err) {
+				fmt.Printf("     %v\n", err)
+			}
+			invalid++
+			continue
+		}
+		fmt.Printf("  ✅ %s\n", cfg.Key)
+	}
+	return invalid
+}
+
+// printViolations 打印 Schema 校验失败的每一处位置，err 不是校验错误时返回 false
+func printViolations(err error) bool {
+	var verr *config.ValidationError
+	if !errors.As(err, &verr) {
+		return false
+	}
+	fmt.Printf("     Schema 前缀: %s\n", verr.Prefix)
+	for _, v := range verr.Violations {
+		fmt.Printf("     - %s: %s\n", v.Path, v.Message)
+	}
+	return true
+}
+
+// schemaCmd 管理配置 Schema 的命令
+func schemaCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "schema",
+		Short: "管理配置中心的 JSON Schema",
+		Long: `管理按键前缀注册的 JSON Schema，写入匹配前缀的配置时会按 Schema 校验。
+
+示例:
+		config-cli schema push config/dev/im-logic/ ./schemas/im-logic.json
+		config-cli schema list
+		config-cli schema remove config/dev/im-logic/`,
+	}
+
+	withCoordinator := func(fn func(ctx context.Context, schemas config.SchemaRegistry) error) error {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		coordinator, err := createCoordinator(ctx)
+		if err != nil {
+			return fmt.Errorf("创建协调器失败: %w", err)
+		}
+		defer coordinator.Close()
+		return fn(ctx, coordinator.ConfigSchemas())
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "push <prefix> <schema.json>",
+		Short: "注册或覆盖前缀的 JSON Schema",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := os.ReadFile(args[1])
+			if err != nil {
+				return fmt.Errorf("读取 Schema 文件失败: %w", err)
+			}
+			return withCoordinator(func(ctx context.Context, schemas config.SchemaRegistry) error {
+				if err := schemas.RegisterSchema(ctx, args[0], data); err != nil {
+					return err
+				}
+				fmt.Printf("✅ 已注册 %s 的 Schema\n", args[0])
+				return nil
+			})
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "列出已注册 Schema 的前缀",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withCoordinator(func(ctx context.Context, schemas config.SchemaRegistry) error {
+				all, err := schemas.Schemas(ctx)
+				if err != nil {
+					return err
+				}
+				prefixes := make([]string, 0, len(all))
+				for prefix := range all {
+					prefixes = append(prefixes, prefix)
+				}
+				sort.Strings(prefixes)
+				for _, prefix := range prefixes {
+					fmt.Printf("📐 %s (%d 字节)\n", prefix, len(all[prefix]))
+				}
+				return nil
+			})
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "remove <prefix>",
+		Short: "删除前缀的 JSON Schema",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withCoordinator(func(ctx context.Context, schemas config.SchemaRegistry) error {
+				if err := schemas.RemoveSchema(ctx, args[0]); err != nil {
+					return err
+				}
+				fmt.Printf("🗑️  已删除 %s 的 Schema\n", args[0])
+				return nil
+			})
+		},
+	})
+
+	return cmd
+}
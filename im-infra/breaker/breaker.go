@@ -16,6 +16,17 @@ type Policy struct {
 	FailureThreshold int           `json:"failureThreshold"`
 	SuccessThreshold int           `json:"successThreshold"`
 	OpenStateTimeout time.Duration `json:"openStateTimeout"`
+	// Timeout 单次调用的超时时间，超时计为失败，0 表示不限制
+	Timeout time.Duration `json:"timeout"`
+	// HedgeEnabled 是否对幂等调用启用对冲请求
+	HedgeEnabled bool `json:"hedgeEnabled"`
+	// HedgeDelay 发出对冲请求前的最短等待时间，延迟样本不足时直接使用该值，否则取其与 P95 延迟的较大值
+	HedgeDelay time.Duration `json:"hedgeDelay"`
+	// ProbeInterval 通过 WithHalfOpenProbe 注册了合成探测时，两次探测之间的间隔
+	ProbeInterval time.Duration `json:"probeInterval"`
+	// Extends 继承的策略组名称，策略组存储在 PoliciesPath 下的 "_groups/<name>.json"
+	// 未设置（零值）的字段从策略组继承，策略组也可以继续继承其他策略组
+	Extends string `json:"extends,omitempty"`
 }
 
 // Config 是 breaker 组件的配置结构体
@@ -26,12 +37,25 @@ type Config struct {
 
 // Breaker 是熔断器的主接口
 type Breaker interface {
+	// Do 执行受熔断器保护的操作。策略设置了 Timeout 时，超时后 Do 立即返回 ErrTimeout，
+	// 但 op 无法感知超时，会在后台运行到自行返回为止；需要超时控制的操作应使用 DoWithContext。
 	Do(ctx context.Context, op func() error) error
+	// DoWithContext 与 Do 相同，但 op 会收到受超时控制的上下文，并支持通过 Idempotent() 启用对冲。
+	// op 必须响应 ctx 的取消：超时或对冲胜出后调用立即返回，忽略 ctx 的 op 会继续在后台运行，直到自行返回。
+	DoWithContext(ctx context.Context, op func(ctx context.Context) error, opts ...CallOption) error
 }
 
 // Provider 是熔断器组件的提供者，负责创建和管理多个熔断器实例
 type Provider interface {
 	GetBreaker(name string) Breaker
+	// ForceOpen 强制打开熔断器，name 支持 "*" 通配，调用直接返回 ErrBreakerOpen
+	ForceOpen(name string) error
+	// ForceClose 强制关闭熔断器，name 支持 "*" 通配，调用直接放行且不计入失败
+	ForceClose(name string) error
+	// Reset 清除人工干预，并将匹配的熔断器重置为关闭状态
+	Reset(name string) error
+	// Snapshot 返回所有熔断器的状态、最近 1 分钟的错误率和最近一次状态变更时间，可通过 Handler 以 HTTP 暴露
+	Snapshot() Snapshot
 	Close() error
 }
 
@@ -40,8 +64,10 @@ type Option func(*providerOptions)
 
 // providerOptions 是 Provider 的内部选项结构
 type providerOptions struct {
-	logger        Logger
-	coordProvider CoordProvider
+	logger           Logger
+	coordProvider    CoordProvider
+	instanceReporter InstanceReporter
+	probes           []patternProbe
 }
 
 // Logger 直接使用 clog.Logger，保持完全兼容
@@ -60,6 +86,15 @@ type CoordProvider interface {
 	List(ctx context.Context, prefix string) ([]string, error)
 }
 
+// InstanceReporter 接收实例级熔断器的状态变化，coord 的 registry.ServiceRegistry 直接实现了该接口。
+// 方法在熔断器状态变更时同步调用，实现不应阻塞。
+type InstanceReporter interface {
+	// DeprioritizeInstance 实例的熔断器打开，负载均衡应在 ttl 内避开该实例
+	DeprioritizeInstance(serviceName, address string, ttl time.Duration)
+	// RestoreInstance 实例的熔断器恢复关闭，负载均衡应重新按权重选择该实例
+	RestoreInstance(serviceName, address string)
+}
+
 // Watcher 是用于监听配置变更的接口
 type Watcher[T any] interface {
 	Chan() <-chan ConfigEvent[T]
@@ -2,8 +2,13 @@ package breaker
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -13,8 +18,9 @@ import (
 	"go.uber.org/zap"
 )
 
-// mockLogger 是一个用于测试的日志器实现
+// mockLogger 是一个用于测试的日志器实现，配置监听协程和调用方会并发写日志，需要加锁
 type mockLogger struct {
+	mu            sync.Mutex
 	debugMessages []string
 	infoMessages  []string
 	warnMessages  []string
@@ -23,22 +29,32 @@ type mockLogger struct {
 }
 
 func (m *mockLogger) Debug(msg string, fields ...Field) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.debugMessages = append(m.debugMessages, msg)
 }
 
 func (m *mockLogger) Info(msg string, fields ...Field) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.infoMessages = append(m.infoMessages, msg)
 }
 
 func (m *mockLogger) Warn(msg string, fields ...Field) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.warnMessages = append(m.warnMessages, msg)
 }
 
 func (m *mockLogger) Error(msg string, fields ...Field) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.errorMessages = append(m.errorMessages, msg)
 }
 
 func (m *mockLogger) Fatal(msg string, fields ...Field) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.fatalMessages = append(m.fatalMessages, msg)
 }
 
@@ -61,7 +77,10 @@ type mockCoordProvider struct {
 }
 
 func (m *mockCoordProvider) Get(ctx context.Context, key string, v interface{}) error {
-	if _, exists := m.configs[key]; exists {
+	if data, exists := m.configs[key]; exists {
+		if len(data) > 0 {
+			return json.Unmarshal(data, v)
+		}
 		// 简化处理，直接赋值
 		if policy, ok := v.(*Policy); ok {
 			*policy = Policy{
@@ -319,3 +338,466 @@ func TestBreakerStateChanges(t *testing.T) {
 		time.Sleep(10 * time.Millisecond)
 	}
 }
+
+func TestBreakerTimeout(t *testing.T) {
+	p := &provider{logger: &mockLogger{}}
+	policy := GetDefaultPolicy()
+	policy.FailureThreshold = 2
+	policy.Timeout = 20 * time.Millisecond
+	breaker := p.newGobreakerAdapter("timeout-breaker", policy)
+
+	// 超时调用返回 ErrTimeout，即使 op 不响应上下文取消
+	for i := 0; i < 2; i++ {
+		err := breaker.Do(context.Background(), func() error {
+			time.Sleep(100 * time.Millisecond)
+			return nil
+		})
+		assert.ErrorIs(t, err, ErrTimeout)
+	}
+
+	// 超时计入失败次数，熔断器打开
+	err := breaker.Do(context.Background(), func() error {
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrBreakerOpen)
+}
+
+func TestBreakerHedging(t *testing.T) {
+	p := &provider{logger: &mockLogger{}}
+	policy := GetDefaultPolicy()
+	policy.HedgeEnabled = true
+	policy.HedgeDelay = 10 * time.Millisecond
+	breaker := p.newGobreakerAdapter("hedge-breaker", policy)
+
+	// 第一次尝试卡住，对冲请求成功后第一次尝试被取消
+	var calls int32
+	loserCanceled := make(chan struct{})
+	op := func(ctx context.Context) error {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			<-ctx.Done()
+			close(loserCanceled)
+			return ctx.Err()
+		}
+		return nil
+	}
+
+	start := time.Now()
+	err := breaker.DoWithContext(context.Background(), op, Idempotent())
+	assert.NoError(t, err)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	select {
+	case <-loserCanceled:
+	case <-time.After(time.Second):
+		t.Fatal("losing attempt was not canceled")
+	}
+
+	// 未标记幂等的调用不会对冲
+	atomic.StoreInt32(&calls, 0)
+	err = breaker.DoWithContext(context.Background(), func(ctx context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(30 * time.Millisecond)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestPolicyTableResolve(t *testing.T) {
+	defaults := GetDefaultPolicy()
+	table := newPolicyTable()
+	table.set("_groups/internal", Policy{FailureThreshold: 10, Timeout: time.Second, HedgeEnabled: true})
+	table.set("_groups/slow", Policy{Timeout: 5 * time.Second, Extends: "internal"})
+	table.set("grpc:user-service/*", Policy{FailureThreshold: 3, Extends: "internal"})
+	table.set("grpc:user-service/Batch*", Policy{Extends: "slow"})
+	table.set("grpc:*", Policy{SuccessThreshold: 4})
+	table.set("grpc:user-service/GetUser", Policy{FailureThreshold: 1})
+
+	tests := []struct {
+		name     string
+		source   string
+		expected Policy
+	}{
+		{
+			name:     "grpc:user-service/GetUser",
+			source:   "grpc:user-service/GetUser",
+			expected: Policy{FailureThreshold: 1, SuccessThreshold: 2, OpenStateTimeout: time.Minute, HedgeDelay: 100 * time.Millisecond, ProbeInterval: time.Second},
+		},
+		{
+			name:     "grpc:user-service/ListFriends",
+			source:   "grpc:user-service/*",
+			expected: Policy{FailureThreshold: 3, SuccessThreshold: 2, OpenStateTimeout: time.Minute, Timeout: time.Second, HedgeEnabled: true, HedgeDelay: 100 * time.Millisecond, ProbeInterval: time.Second},
+		},
+		{
+			name:     "grpc:user-service/BatchGetUsers",
+			source:   "grpc:user-service/Batch*",
+			expected: Policy{FailureThreshold: 10, SuccessThreshold: 2, OpenStateTimeout: time.Minute, Timeout: 5 * time.Second, HedgeEnabled: true, HedgeDelay: 100 * time.Millisecond, ProbeInterval: time.Second},
+		},
+		{
+			name:     "grpc:order-service/Create",
+			source:   "grpc:*",
+			expected: Policy{FailureThreshold: 5, SuccessThreshold: 4, OpenStateTimeout: time.Minute, HedgeDelay: 100 * time.Millisecond, ProbeInterval: time.Second},
+		},
+		{
+			name:     "http:payment-api",
+			source:   defaultPolicyName,
+			expected: *defaults,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, source, err := table.resolve(tt.name, defaults)
+			require.NoError(t, err)
+			assert.Equal(t, tt.source, source)
+			assert.Equal(t, tt.expected, *policy)
+		})
+	}
+
+	// 删除精确策略后回退到通配策略
+	table.remove("grpc:user-service/GetUser")
+	_, source, err := table.resolve("grpc:user-service/GetUser", defaults)
+	require.NoError(t, err)
+	assert.Equal(t, "grpc:user-service/*", source)
+
+	// 循环继承和未知策略组应返回错误
+	table.set("_groups/a", Policy{Extends: "b"})
+	table.set("_groups/b", Policy{Extends: "a"})
+	table.set("cyclic", Policy{Extends: "a"})
+	table.set("missing", Policy{Extends: "unknown"})
+	_, _, err = table.resolve("cyclic", defaults)
+	assert.Error(t, err)
+	_, _, err = table.resolve("missing", defaults)
+	assert.Error(t, err)
+}
+
+func TestMatchPattern(t *testing.T) {
+	assert.True(t, matchPattern("grpc:user-service/*", "grpc:user-service/GetUser"))
+	assert.True(t, matchPattern("grpc:user-service/*", "grpc:user-service//user.v1.UserService/GetUser"))
+	assert.True(t, matchPattern("grpc:*/Get*", "grpc:user-service/GetUser"))
+	assert.True(t, matchPattern("*", "anything"))
+	assert.False(t, matchPattern("grpc:user-service/*", "grpc:order-service/GetUser"))
+	assert.False(t, matchPattern("grpc:*/Get*", "grpc:user-service/ListUsers"))
+	assert.False(t, matchPattern("ab*ba", "aba"))
+}
+
+func TestBreakerWildcardPolicyUpdate(t *testing.T) {
+	config := GetDefaultConfig("test-service", "development")
+	path := config.PoliciesPath
+
+	mockCoord := &mockCoordProvider{
+		configs: map[string][]byte{
+			path + "_groups/user-service.json":   []byte(`{"failureThreshold": 2, "timeout": 1000000000}`),
+			path + "grpc:user-service/*.json":    []byte(`{"extends": "user-service"}`),
+			path + "grpc:user-service/Ping.json": []byte(`{"failureThreshold": 7}`),
+		},
+		watcher: make(chan ConfigEvent[any], 1),
+	}
+
+	p, err := New(context.Background(), config, WithLogger(&mockLogger{}), WithCoordProvider(mockCoord))
+	require.NoError(t, err)
+	defer p.Close()
+
+	getUser := p.GetBreaker("grpc:user-service/GetUser").(*gobreakerAdapter)
+	assert.Equal(t, 2, getUser.policy.FailureThreshold)
+	assert.Equal(t, time.Second, getUser.policy.Timeout)
+
+	ping := p.GetBreaker("grpc:user-service/Ping").(*gobreakerAdapter)
+	assert.Equal(t, 7, ping.policy.FailureThreshold)
+	assert.Equal(t, time.Duration(0), ping.policy.Timeout)
+
+	// 更新策略组后，继承该组的熔断器会被重建，其他熔断器保持不变
+	mockCoord.watcher <- ConfigEvent[any]{
+		Type:  EventTypePut,
+		Key:   path + "_groups/user-service.json",
+		Value: Policy{FailureThreshold: 4},
+	}
+	assert.Eventually(t, func() bool {
+		b := p.GetBreaker("grpc:user-service/GetUser").(*gobreakerAdapter)
+		return b.policy.FailureThreshold == 4
+	}, time.Second, 10*time.Millisecond)
+	assert.Same(t, ping, p.GetBreaker("grpc:user-service/Ping"))
+}
+
+func TestBreakerManualControl(t *testing.T) {
+	config := GetDefaultConfig("test-service", "development")
+	p, err := New(context.Background(), config, WithLogger(&mockLogger{}))
+	require.NoError(t, err)
+	defer p.Close()
+
+	b := p.GetBreaker("grpc:user-service/GetUser")
+	ok := func() error { return nil }
+	fail := func() error { return errors.New("failure") }
+
+	// 强制打开：调用不会执行，直接返回 ErrBreakerOpen
+	require.NoError(t, p.ForceOpen("grpc:user-service/*"))
+	called := false
+	err = b.Do(context.Background(), func() error { called = true; return nil })
+	assert.ErrorIs(t, err, ErrBreakerOpen)
+	assert.False(t, called)
+
+	// 精确名称的干预优先于通配干预
+	require.NoError(t, p.ForceClose("grpc:user-service/GetUser"))
+	for i := 0; i < 10; i++ {
+		assert.EqualError(t, b.Do(context.Background(), fail), "failure")
+	}
+
+	// 强制关闭期间的失败不计入统计，清除干预后熔断器仍为关闭状态
+	require.NoError(t, p.Reset("grpc:user-service/GetUser"))
+	require.NoError(t, p.Reset("grpc:user-service/*"))
+	assert.NoError(t, b.Do(context.Background(), ok))
+
+	// 正常熔断后，Reset 会将已持有的熔断器恢复为关闭状态
+	for i := 0; i < 5; i++ {
+		_ = b.Do(context.Background(), fail)
+	}
+	assert.ErrorIs(t, b.Do(context.Background(), ok), ErrBreakerOpen)
+	require.NoError(t, p.Reset("grpc:user-service/GetUser"))
+	assert.NoError(t, b.Do(context.Background(), ok))
+
+	assert.Error(t, p.ForceOpen(""))
+	require.NoError(t, p.Close())
+	assert.ErrorIs(t, p.ForceOpen("grpc:user-service/GetUser"), ErrProviderClosed)
+	assert.ErrorIs(t, p.Reset("grpc:user-service/GetUser"), ErrProviderClosed)
+}
+
+func TestBreakerConfigOverride(t *testing.T) {
+	config := GetDefaultConfig("test-service", "development")
+	path := config.PoliciesPath
+
+	mockCoord := &mockCoordProvider{
+		configs: map[string][]byte{
+			path + "_overrides/grpc:order-service/*.json": []byte(`{"state": "open", "reason": "maintenance"}`),
+		},
+		watcher: make(chan ConfigEvent[any], 1),
+	}
+
+	p, err := New(context.Background(), config, WithLogger(&mockLogger{}), WithCoordProvider(mockCoord))
+	require.NoError(t, err)
+	defer p.Close()
+
+	b := p.GetBreaker("grpc:order-service/Create")
+	err = b.Do(context.Background(), func() error { return nil })
+	assert.ErrorIs(t, err, ErrBreakerOpen)
+	assert.Contains(t, err.Error(), "maintenance")
+
+	// 干预键不会被当作策略加载
+	assert.Equal(t, GetDefaultPolicy().FailureThreshold, b.(*gobreakerAdapter).policy.FailureThreshold)
+
+	// 删除配置后干预解除
+	mockCoord.watcher <- ConfigEvent[any]{
+		Type: EventTypeDelete,
+		Key:  path + "_overrides/grpc:order-service/*.json",
+	}
+	assert.Eventually(t, func() bool {
+		return b.Do(context.Background(), func() error { return nil }) == nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestProviderSnapshot(t *testing.T) {
+	config := GetDefaultConfig("test-service", "development")
+	p, err := New(context.Background(), config, WithLogger(&mockLogger{}))
+	require.NoError(t, err)
+	defer p.Close()
+
+	ok := func() error { return nil }
+	fail := func() error { return errors.New("failure") }
+
+	healthy := p.GetBreaker("grpc:user-service/GetUser")
+	for i := 0; i < 3; i++ {
+		require.NoError(t, healthy.Do(context.Background(), ok))
+	}
+	require.Error(t, healthy.Do(context.Background(), fail))
+
+	tripped := p.GetBreaker("grpc:order-service/Create")
+	for i := 0; i < 6; i++ {
+		_ = tripped.Do(context.Background(), fail)
+	}
+
+	snapshot := p.Snapshot()
+	require.Len(t, snapshot.Breakers, 2)
+	assert.Equal(t, "test-service", snapshot.Service)
+	assert.False(t, snapshot.Healthy())
+	assert.Equal(t, []string{"grpc:order-service/Create"}, snapshot.Unhealthy)
+
+	// 按名称排序
+	open, closed := snapshot.Breakers[0], snapshot.Breakers[1]
+	assert.Equal(t, StateOpen, open.State)
+	assert.Equal(t, int64(5), open.Failures)
+	assert.Equal(t, int64(1), open.Rejected)
+	assert.Equal(t, 1.0, open.ErrorRate)
+	assert.False(t, open.LastTransition.IsZero())
+
+	assert.Equal(t, StateClosed, closed.State)
+	assert.Equal(t, int64(4), closed.Requests)
+	assert.InDelta(t, 0.25, closed.ErrorRate, 1e-9)
+	assert.Equal(t, 5, closed.Policy.FailureThreshold)
+
+	// 人工干预反映在快照中
+	require.NoError(t, p.ForceOpen("grpc:user-service/*"))
+	snapshot = p.Snapshot()
+	require.NotNil(t, snapshot.Breakers[1].Override)
+	assert.Equal(t, StateOpen, snapshot.Breakers[1].State)
+	assert.Len(t, snapshot.Unhealthy, 2)
+	require.NoError(t, p.Reset("grpc:user-service/*"))
+	require.NoError(t, p.Reset("grpc:order-service/*"))
+	assert.True(t, p.Snapshot().Healthy())
+
+	// HTTP 处理器：默认返回 200，readiness 模式下存在打开的熔断器时返回 503
+	for i := 0; i < 5; i++ {
+		_ = tripped.Do(context.Background(), fail)
+	}
+	handler := Handler(p)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/breakers", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var decoded Snapshot
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &decoded))
+	assert.Len(t, decoded.Breakers, 2)
+	assert.Equal(t, []string{"grpc:order-service/Create"}, decoded.Unhealthy)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/breakers?readiness=true", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/breakers?readiness=true&name=grpc:user-service/*", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/debug/breakers", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestErrorWindow(t *testing.T) {
+	var w errorWindow
+	start := time.Unix(1700000000, 0)
+
+	w.add(start, 10, 2, 0)
+	w.add(start.Add(30*time.Second), 10, 8, 3)
+	requests, failures, rejected := w.counts(start.Add(50 * time.Second))
+	assert.Equal(t, int64(20), requests)
+	assert.Equal(t, int64(10), failures)
+	assert.Equal(t, int64(3), rejected)
+
+	// 超过 1 分钟的桶不再计入
+	requests, failures, _ = w.counts(start.Add(75 * time.Second))
+	assert.Equal(t, int64(10), requests)
+	assert.Equal(t, int64(8), failures)
+
+	// 复用过期的桶时先清零
+	w.add(start.Add(60*time.Second), 1, 0, 0)
+	requests, _, _ = w.counts(start.Add(60 * time.Second))
+	assert.Equal(t, int64(11), requests)
+}
+
+// mockInstanceReporter 记录实例的降级和恢复事件
+type mockInstanceReporter struct {
+	events []string
+}
+
+func (m *mockInstanceReporter) DeprioritizeInstance(serviceName, address string, ttl time.Duration) {
+	m.events = append(m.events, fmt.Sprintf("deprioritize %s %s %s", serviceName, address, ttl))
+}
+
+func (m *mockInstanceReporter) RestoreInstance(serviceName, address string) {
+	m.events = append(m.events, fmt.Sprintf("restore %s %s", serviceName, address))
+}
+
+func TestInstanceReporter(t *testing.T) {
+	name := InstanceBreakerName("user-service", "10.0.0.1:8080")
+	assert.Equal(t, "grpc:user-service@10.0.0.1:8080", name)
+	serviceName, address, ok := parseInstanceBreakerName(name)
+	assert.True(t, ok)
+	assert.Equal(t, "user-service", serviceName)
+	assert.Equal(t, "10.0.0.1:8080", address)
+	_, _, ok = parseInstanceBreakerName("grpc:user-service/GetUser")
+	assert.False(t, ok)
+
+	reporter := &mockInstanceReporter{}
+	p := &provider{logger: &mockLogger{}, reporter: reporter, overrides: newOverrideTable()}
+	policy := GetDefaultPolicy()
+	policy.FailureThreshold = 2
+	policy.OpenStateTimeout = 50 * time.Millisecond
+	breaker := p.newGobreakerAdapter(name, policy)
+	fail := func() error { return errors.New("unavailable") }
+
+	// 熔断器打开时降级实例，降级时长与打开状态的持续时间一致
+	for i := 0; i < 2; i++ {
+		assert.Error(t, breaker.Do(context.Background(), fail))
+	}
+	assert.Equal(t, []string{"deprioritize user-service 10.0.0.1:8080 50ms"}, reporter.events)
+
+	// 半开探测失败，重新打开并再次降级
+	time.Sleep(60 * time.Millisecond)
+	assert.Error(t, breaker.Do(context.Background(), fail))
+	assert.Len(t, reporter.events, 2)
+
+	// 半开探测成功，熔断器关闭并恢复实例
+	time.Sleep(60 * time.Millisecond)
+	assert.NoError(t, breaker.Do(context.Background(), func() error { return nil }))
+	assert.Equal(t, "restore user-service 10.0.0.1:8080", reporter.events[2])
+
+	// 重置已关闭的熔断器不会重复恢复
+	breaker.reset()
+	assert.Len(t, reporter.events, 3)
+
+	// 非实例级熔断器不上报
+	other := p.newGobreakerAdapter("grpc:user-service/GetUser", policy)
+	for i := 0; i < 2; i++ {
+		assert.Error(t, other.Do(context.Background(), fail))
+	}
+	assert.Len(t, reporter.events, 3)
+}
+
+func TestHalfOpenProbe(t *testing.T) {
+	var healthy atomic.Bool
+	var probes atomic.Int32
+	p := &provider{logger: &mockLogger{}, overrides: newOverrideTable()}
+	opts := &providerOptions{}
+	WithHalfOpenProbe("grpc:*", func(ctx context.Context) error { return nil })(opts)
+	WithHalfOpenProbe("grpc:user-service*", func(ctx context.Context) error {
+		probes.Add(1)
+		if !healthy.Load() {
+			return errors.New("health check failed")
+		}
+		return nil
+	})(opts)
+	p.probes = opts.probes
+	assert.Equal(t, "grpc:user-service*", p.probes[0].pattern)
+
+	policy := GetDefaultPolicy()
+	policy.FailureThreshold = 2
+	policy.SuccessThreshold = 3
+	policy.OpenStateTimeout = 30 * time.Millisecond
+	policy.ProbeInterval = 10 * time.Millisecond
+	breaker := p.newGobreakerAdapter("grpc:user-service/GetUser", policy)
+	defer breaker.shadow.stop()
+
+	var calls atomic.Int32
+	op := func() error {
+		calls.Add(1)
+		return errors.New("unavailable")
+	}
+	for i := 0; i < 2; i++ {
+		assert.Error(t, breaker.Do(context.Background(), op))
+	}
+
+	// 打开时间到期后真实请求仍被拒绝，由合成探测验证下游
+	time.Sleep(80 * time.Millisecond)
+	err := breaker.Do(context.Background(), op)
+	assert.ErrorIs(t, err, ErrBreakerOpen)
+	assert.Equal(t, int32(2), calls.Load())
+	assert.Positive(t, probes.Load())
+	assert.True(t, breaker.status(time.Now()).Verifying)
+
+	// 下游恢复后探测连续成功 SuccessThreshold 次，熔断器关闭并放行真实请求
+	healthy.Store(true)
+	assert.Eventually(t, func() bool {
+		return !breaker.shadow.active()
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, StateClosed, breaker.status(time.Now()).State)
+	assert.NoError(t, breaker.Do(context.Background(), func() error { return nil }))
+}
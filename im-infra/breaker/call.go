@@ -0,0 +1,208 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/sony/gobreaker"
+)
+
+// ErrTimeout 表示调用超过了策略中配置的超时时间，该错误会计入熔断器失败次数
+var ErrTimeout = errors.New("circuit breaker call timed out")
+
+const (
+	// latencyWindow 用于估算 P95 延迟的样本窗口大小
+	latencyWindow = 128
+	// minHedgeSamples 使用 P95 作为对冲延迟所需的最少样本数，样本不足时使用 Policy.HedgeDelay
+	minHedgeSamples = 20
+)
+
+// CallOption 是单次调用的选项
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	idempotent bool
+}
+
+// Idempotent 标记本次调用是幂等的，允许在策略开启对冲时发出第二次尝试
+func Idempotent() CallOption {
+	return func(o *callOptions) {
+		o.idempotent = true
+	}
+}
+
+// latencyTracker 记录最近成功调用的延迟，用于计算对冲延迟
+type latencyTracker struct {
+	mu      sync.Mutex
+	samples [latencyWindow]time.Duration
+	next    int
+	count   int
+}
+
+// record 记录一次延迟样本
+func (l *latencyTracker) record(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.samples[l.next] = d
+	l.next = (l.next + 1) % latencyWindow
+	if l.count < latencyWindow {
+		l.count++
+	}
+}
+
+// p95 返回窗口内的 P95 延迟，样本不足时返回 false
+func (l *latencyTracker) p95() (time.Duration, bool) {
+	l.mu.Lock()
+	if l.count < minHedgeSamples {
+		l.mu.Unlock()
+		return 0, false
+	}
+	sorted := make([]time.Duration, l.count)
+	copy(sorted, l.samples[:l.count])
+	l.mu.Unlock()
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[(len(sorted)*95)/100], true
+}
+
+// DoWithContext 执行受熔断器保护的操作，op 会收到带有超时控制的上下文。
+// 超时和对冲均由熔断器策略决定：
+//   - Policy.Timeout > 0 时，超时的调用返回 ErrTimeout 并计入失败
+//   - Policy.HedgeEnabled 且调用通过 Idempotent() 标记为幂等时，
+//     若首次尝试在 P95 延迟内未返回，会发出第二次尝试，先成功者胜出，另一者的上下文被取消
+func (b *gobreakerAdapter) DoWithContext(ctx context.Context, op func(ctx context.Context) error, opts ...CallOption) error {
+	var co callOptions
+	for _, opt := range opts {
+		opt(&co)
+	}
+
+	// 人工干预优先于熔断器自身的状态
+	if override, ok := b.overrides.lookup(b.name); ok {
+		if override.State == OverrideOpen {
+			b.recordResult(gobreaker.ErrOpenState)
+			return fmt.Errorf("%w: %s (forced: %s)", ErrBreakerOpen, b.name, override.Reason)
+		}
+		// 强制关闭时绕过 gobreaker，调用结果不计入熔断判断，但仍计入滚动错误率
+		err := b.call(ctx, op, co.idempotent)
+		b.recordResult(err)
+		return err
+	}
+
+	// 合成探测验证期间真实请求不作为半开探测，直接拒绝
+	if b.shadow.active() {
+		b.recordResult(gobreaker.ErrOpenState)
+		return fmt.Errorf("%w: %s (verifying with probes)", ErrBreakerOpen, b.name)
+	}
+
+	_, err := b.breaker.Load().Execute(func() (interface{}, error) {
+		err := b.call(ctx, op, co.idempotent)
+		if err != nil {
+			b.logger.Debug("operation failed",
+				clog.String("breaker", b.name),
+				clog.Err(err))
+		}
+		return nil, err
+	})
+	b.recordResult(err)
+
+	return b.translateError(err)
+}
+
+// call 在超时控制下执行一次（可能对冲的）调用
+func (b *gobreakerAdapter) call(ctx context.Context, op func(ctx context.Context) error, idempotent bool) error {
+	if b.policy.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.policy.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	var err error
+	switch {
+	case idempotent && b.policy.HedgeEnabled:
+		err = b.hedged(ctx, op)
+	case b.policy.Timeout > 0:
+		err = attempt(ctx, op)
+	default:
+		err = op(ctx)
+	}
+
+	if err == nil {
+		b.latency.record(time.Since(start))
+		return nil
+	}
+	if b.policy.Timeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %s after %s", ErrTimeout, b.name, b.policy.Timeout)
+	}
+	return err
+}
+
+// hedged 先发出一次尝试，若在对冲延迟内未返回则再发出一次，返回先成功的结果。
+// 任一尝试失败时会等待另一次尝试的结果；函数返回时取消仍在进行的尝试。
+func (b *gobreakerAdapter) hedged(ctx context.Context, op func(ctx context.Context) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan error, 2)
+	run := func() {
+		results <- op(ctx)
+	}
+
+	go run()
+	inflight := 1
+
+	timer := time.NewTimer(b.hedgeDelay())
+	defer timer.Stop()
+
+	for {
+		select {
+		case err := <-results:
+			inflight--
+			if err == nil || inflight == 0 {
+				return err
+			}
+		case <-timer.C:
+			b.logger.Debug("hedging request", clog.String("breaker", b.name))
+			inflight++
+			go run()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// hedgeDelay 返回发出对冲请求前的等待时间，取观测到的 P95 延迟与 Policy.HedgeDelay 中的较大值
+func (b *gobreakerAdapter) hedgeDelay() time.Duration {
+	delay := b.policy.HedgeDelay
+	if p95, ok := b.latency.p95(); ok && p95 > delay {
+		delay = p95
+	}
+	return delay
+}
+
+// attempt 执行一次调用，上下文结束时立即返回 ctx.Err()，不等待 op 返回。
+// op 在单独的 goroutine 中执行，该 goroutine 直到 op 返回才会退出，
+// 因此 op 必须响应 ctx 的取消；忽略 ctx 的 op 会在超时后继续占用 goroutine 和下游资源，直到自行返回。
+func attempt(ctx context.Context, op func(ctx context.Context) error) error {
+	if ctx.Done() == nil {
+		return op(ctx)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- op(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
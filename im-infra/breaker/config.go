@@ -29,5 +29,30 @@ func GetDefaultPolicy() *Policy {
 		FailureThreshold: 5,
 		SuccessThreshold: 2,
 		OpenStateTimeout: time.Minute,
+		HedgeDelay:       100 * time.Millisecond,
+		ProbeInterval:    time.Second,
+	}
+}
+
+// normalizePolicy 为策略中未设置或非法的字段填充默认值
+func normalizePolicy(policy *Policy) {
+	defaults := GetDefaultPolicy()
+	if policy.FailureThreshold <= 0 {
+		policy.FailureThreshold = defaults.FailureThreshold
+	}
+	if policy.SuccessThreshold <= 0 {
+		policy.SuccessThreshold = defaults.SuccessThreshold
+	}
+	if policy.OpenStateTimeout <= 0 {
+		policy.OpenStateTimeout = defaults.OpenStateTimeout
+	}
+	if policy.Timeout < 0 {
+		policy.Timeout = 0
+	}
+	if policy.HedgeDelay <= 0 {
+		policy.HedgeDelay = defaults.HedgeDelay
+	}
+	if policy.ProbeInterval <= 0 {
+		policy.ProbeInterval = defaults.ProbeInterval
 	}
 }
\ No newline at end of file
@@ -0,0 +1,94 @@
+package breaker
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/sony/gobreaker"
+)
+
+const (
+	// instancePrefix 实例级熔断器名称的前缀
+	instancePrefix = "grpc:"
+	// instanceSeparator 分隔实例级熔断器名称中的服务名与实例地址
+	instanceSeparator = "@"
+)
+
+// InstanceBreakerName 返回保护单个服务实例的熔断器名称，格式为 "grpc:<serviceName>@<address>"，
+// address 与注册中心中的 "host:port" 一致。配置了 WithInstanceReporter 时，
+// 该熔断器的打开和关闭会上报给注册表；策略可以用 "grpc:<serviceName>@*" 统一配置。
+func InstanceBreakerName(serviceName, address string) string {
+	return instancePrefix + serviceName + instanceSeparator + address
+}
+
+// parseInstanceBreakerName 从实例级熔断器名称中解析服务名和实例地址
+func parseInstanceBreakerName(name string) (serviceName, address string, ok bool) {
+	rest, ok := strings.CutPrefix(name, instancePrefix)
+	if !ok {
+		return "", "", false
+	}
+	serviceName, address, ok = strings.Cut(rest, instanceSeparator)
+	if !ok || serviceName == "" || address == "" {
+		return "", "", false
+	}
+	return serviceName, address, true
+}
+
+// instanceLink 将实例级熔断器的状态变化上报给 InstanceReporter，非实例级熔断器为 nil，所有方法对 nil 安全
+type instanceLink struct {
+	reporter    InstanceReporter
+	serviceName string
+	address     string
+	// demoted 是否已上报降级，避免重复恢复
+	demoted atomic.Bool
+	logger  Logger
+}
+
+// newInstanceLink 为名称符合 InstanceBreakerName 格式的熔断器创建上报链路，未配置 reporter 时返回 nil
+func newInstanceLink(reporter InstanceReporter, name string, logger Logger) *instanceLink {
+	if reporter == nil {
+		return nil
+	}
+	serviceName, address, ok := parseInstanceBreakerName(name)
+	if !ok {
+		return nil
+	}
+	return &instanceLink{
+		reporter:    reporter,
+		serviceName: serviceName,
+		address:     address,
+		logger:      logger,
+	}
+}
+
+// onStateChange 熔断器打开时降级实例，降级时长与打开状态的持续时间一致，到期后半开探测请求才能到达该实例；
+// 半开探测成功、熔断器回到关闭状态时恢复实例。半开探测失败会再次打开熔断器并重新降级。
+func (l *instanceLink) onStateChange(to gobreaker.State, openTimeout time.Duration) {
+	if l == nil {
+		return
+	}
+	switch to {
+	case gobreaker.StateOpen:
+		l.demoted.Store(true)
+		l.reporter.DeprioritizeInstance(l.serviceName, l.address, openTimeout)
+		l.logger.Info("instance deprioritized by circuit breaker",
+			clog.String("service", l.serviceName),
+			clog.String("address", l.address),
+			clog.Duration("ttl", openTimeout))
+	case gobreaker.StateClosed:
+		l.restore()
+	}
+}
+
+// restore 熔断器被重置或重建时恢复已降级的实例
+func (l *instanceLink) restore() {
+	if l == nil || !l.demoted.Swap(false) {
+		return
+	}
+	l.reporter.RestoreInstance(l.serviceName, l.address)
+	l.logger.Info("instance restored by circuit breaker",
+		clog.String("service", l.serviceName),
+		clog.String("address", l.address))
+}
@@ -13,4 +13,12 @@ func WithCoordProvider(coordProvider CoordProvider) Option {
 	return func(opts *providerOptions) {
 		opts.coordProvider = coordProvider
 	}
-}
\ No newline at end of file
+}
+
+// WithInstanceReporter 将实例级熔断器（名称由 InstanceBreakerName 生成）的打开和关闭上报给 reporter，
+// 通常传入 coord 的服务注册表，使 gRPC 负载均衡在熔断期间避开该实例、半开探测成功后重新启用
+func WithInstanceReporter(reporter InstanceReporter) Option {
+	return func(opts *providerOptions) {
+		opts.instanceReporter = reporter
+	}
+}
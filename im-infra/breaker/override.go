@@ -0,0 +1,228 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+)
+
+const (
+	// overridePrefix 是人工干预状态在配置中心中的名称前缀，如 "_overrides/grpc:user-service/*.json"
+	overridePrefix = "_overrides/"
+
+	// OverrideOpen 强制打开：所有调用直接返回 ErrBreakerOpen，用于下游维护时主动切断流量
+	OverrideOpen = "open"
+	// OverrideClosed 强制关闭：所有调用直接放行且不计入失败，用于确认下游正常后忽略熔断
+	OverrideClosed = "closed"
+)
+
+// ErrProviderClosed 表示 Provider 已关闭，无法再执行管理操作
+var ErrProviderClosed = errors.New("breaker provider is closed")
+
+// Override 描述熔断器的人工干预状态。
+// 在配置中心中以 "<PoliciesPath>_overrides/<name>.json" 保存，name 同样支持 "*" 通配，例如：
+//
+//	{"state": "open", "reason": "user-service 计划维护 02:00-03:00"}
+type Override struct {
+	State  string `json:"state"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// validate 检查干预状态是否合法
+func (o Override) validate() error {
+	switch o.State {
+	case OverrideOpen, OverrideClosed:
+		return nil
+	default:
+		return fmt.Errorf("unknown override state %q", o.State)
+	}
+}
+
+// overrideTable 保存人工干预状态，解析顺序与策略相同：精确名称 > 最具体的通配名称。
+// 通过 ForceOpen/ForceClose 和配置中心设置的干预共用同一张表，后写入者生效。
+type overrideTable struct {
+	mu       sync.RWMutex
+	exact    map[string]Override
+	patterns []string
+	wildcard map[string]Override
+}
+
+// newOverrideTable 创建空的干预表
+func newOverrideTable() *overrideTable {
+	return &overrideTable{
+		exact:    make(map[string]Override),
+		wildcard: make(map[string]Override),
+	}
+}
+
+// set 保存一条干预状态
+func (t *overrideTable) set(name string, override Override) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !strings.Contains(name, "*") {
+		t.exact[name] = override
+		return
+	}
+	if _, exists := t.wildcard[name]; !exists {
+		t.patterns = append(t.patterns, name)
+		sort.SliceStable(t.patterns, func(i, j int) bool {
+			return morePrecise(t.patterns[i], t.patterns[j])
+		})
+	}
+	t.wildcard[name] = override
+}
+
+// remove 删除一条干预状态，返回是否存在
+func (t *overrideTable) remove(name string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.exact[name]; ok {
+		delete(t.exact, name)
+		return true
+	}
+	if _, ok := t.wildcard[name]; !ok {
+		return false
+	}
+	delete(t.wildcard, name)
+	for i, pattern := range t.patterns {
+		if pattern == name {
+			t.patterns = append(t.patterns[:i], t.patterns[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// lookup 返回熔断器当前生效的干预状态，nil 表（未启用干预）时始终返回 false
+func (t *overrideTable) lookup(name string) (Override, bool) {
+	if t == nil {
+		return Override{}, false
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if override, ok := t.exact[name]; ok {
+		return override, true
+	}
+	for _, pattern := range t.patterns {
+		if matchPattern(pattern, name) {
+			return t.wildcard[pattern], true
+		}
+	}
+	return Override{}, false
+}
+
+// ForceOpen 强制打开熔断器，name 支持 "*" 通配，如 "grpc:user-service/*"。
+// 适用于下游计划维护时提前切断流量，而不必等待失败累积。干预只在本实例内存中生效，
+// 需要整个集群生效时应写入配置中心的 "_overrides/" 路径。
+func (p *provider) ForceOpen(name string) error {
+	return p.setOverride(name, Override{State: OverrideOpen, Reason: "ForceOpen"})
+}
+
+// ForceClose 强制关闭熔断器，调用直接放行且不计入失败统计，name 支持 "*" 通配
+func (p *provider) ForceClose(name string) error {
+	return p.setOverride(name, Override{State: OverrideClosed, Reason: "ForceClose"})
+}
+
+// Reset 清除熔断器的人工干预，并将匹配的熔断器重置为关闭状态、清空失败计数，name 支持 "*" 通配
+func (p *provider) Reset(name string) error {
+	if name == "" {
+		return errors.New("breaker name cannot be empty")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return ErrProviderClosed
+	}
+
+	p.overrides.remove(name)
+
+	reset := 0
+	for breakerName, b := range p.breakers {
+		adapter, ok := b.(*gobreakerAdapter)
+		if !ok || !matchPattern(name, breakerName) {
+			continue
+		}
+		adapter.reset()
+		reset++
+	}
+
+	p.logger.Info("circuit breaker reset",
+		clog.String("name", name),
+		clog.Int("count", reset))
+	return nil
+}
+
+// setOverride 设置人工干预状态
+func (p *provider) setOverride(name string, override Override) error {
+	if name == "" {
+		return errors.New("breaker name cannot be empty")
+	}
+
+	p.mu.RLock()
+	closed := p.closed
+	p.mu.RUnlock()
+	if closed {
+		return ErrProviderClosed
+	}
+
+	p.overrides.set(name, override)
+	p.logger.Warn("circuit breaker overridden",
+		clog.String("name", name),
+		clog.String("state", override.State),
+		clog.String("reason", override.Reason))
+	return nil
+}
+
+// isOverrideKey 判断配置键是否为人工干预，如 "<PoliciesPath>_overrides/grpc:user-service.json"
+func (p *provider) isOverrideKey(key string) bool {
+	return strings.HasPrefix(p.policyName(key), overridePrefix)
+}
+
+// overrideName 将干预配置键转换为熔断器名称
+func (p *provider) overrideName(key string) string {
+	return strings.TrimPrefix(p.policyName(key), overridePrefix)
+}
+
+// loadOverride 从配置中心加载单个人工干预
+func (p *provider) loadOverride(ctx context.Context, key string) error {
+	var override Override
+	if err := p.coordProvider.Get(ctx, key, &override); err != nil {
+		return err
+	}
+	if err := override.validate(); err != nil {
+		return err
+	}
+
+	name := p.overrideName(key)
+	p.overrides.set(name, override)
+	p.logger.Warn("circuit breaker overridden by config",
+		clog.String("name", name),
+		clog.String("state", override.State),
+		clog.String("reason", override.Reason))
+	return nil
+}
+
+// handleOverrideEvent 处理人工干预的变更事件
+func (p *provider) handleOverrideEvent(ctx context.Context, event ConfigEvent[any]) {
+	switch event.Type {
+	case EventTypePut:
+		if err := p.loadOverride(ctx, event.Key); err != nil {
+			p.logger.Error("failed to load override", clog.String("key", event.Key), clog.Err(err))
+		}
+	case EventTypeDelete:
+		name := p.overrideName(event.Key)
+		if p.overrides.remove(name) {
+			p.logger.Info("circuit breaker override removed", clog.String("name", name))
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package breaker
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// defaultPolicyName 是默认策略在配置中心中的名称
+	defaultPolicyName = "default"
+	// policyGroupPrefix 是策略组在配置中心中的名称前缀，如 "_groups/grpc-internal"
+	policyGroupPrefix = "_groups/"
+	// maxExtendsDepth 策略继承链的最大深度，防止配置错误导致循环继承
+	maxExtendsDepth = 8
+)
+
+// patternPolicy 是带通配符的策略
+type patternPolicy struct {
+	pattern string
+	policy  Policy
+}
+
+// policyTable 保存从配置中心加载的原始策略，并负责为熔断器名称解析最终生效的策略。
+//
+// 配置中心中的策略按名称分为三类：
+//   - 精确策略：如 "grpc:user-service.json"，只作用于同名熔断器
+//   - 通配策略：名称中包含 "*"，如 "grpc:user-service/*.json"，"*" 匹配任意字符（包括 "/"）
+//   - 策略组：位于 "_groups/" 下，如 "_groups/grpc-internal.json"，只能通过 Extends 引用
+//
+// 解析顺序为：精确策略 > 最具体的通配策略 > 默认策略。
+// 选中的策略再沿 Extends 链继承策略组中的字段，最后由默认策略补全。
+type policyTable struct {
+	exact    map[string]Policy
+	patterns []patternPolicy
+	groups   map[string]Policy
+}
+
+// newPolicyTable 创建空的策略表
+func newPolicyTable() *policyTable {
+	return &policyTable{
+		exact:  make(map[string]Policy),
+		groups: make(map[string]Policy),
+	}
+}
+
+// set 保存或更新一条策略，name 为去除 PoliciesPath 和 ".json" 后的名称
+func (t *policyTable) set(name string, policy Policy) {
+	switch {
+	case strings.HasPrefix(name, policyGroupPrefix):
+		t.groups[strings.TrimPrefix(name, policyGroupPrefix)] = policy
+	case strings.Contains(name, "*"):
+		for i := range t.patterns {
+			if t.patterns[i].pattern == name {
+				t.patterns[i].policy = policy
+				return
+			}
+		}
+		t.patterns = append(t.patterns, patternPolicy{pattern: name, policy: policy})
+		// 按具体程度从高到低排序，解析时取第一个匹配项
+		sort.SliceStable(t.patterns, func(i, j int) bool {
+			return morePrecise(t.patterns[i].pattern, t.patterns[j].pattern)
+		})
+	default:
+		t.exact[name] = policy
+	}
+}
+
+// remove 删除一条策略
+func (t *policyTable) remove(name string) {
+	switch {
+	case strings.HasPrefix(name, policyGroupPrefix):
+		delete(t.groups, strings.TrimPrefix(name, policyGroupPrefix))
+	case strings.Contains(name, "*"):
+		for i := range t.patterns {
+			if t.patterns[i].pattern == name {
+				t.patterns = append(t.patterns[:i], t.patterns[i+1:]...)
+				return
+			}
+		}
+	default:
+		delete(t.exact, name)
+	}
+}
+
+// resolve 解析熔断器最终生效的策略，同时返回命中的策略名称，便于排查配置
+func (t *policyTable) resolve(name string, defaults *Policy) (*Policy, string, error) {
+	policy, source, found := t.lookup(name)
+	if !found {
+		return copyPolicy(defaults), defaultPolicyName, nil
+	}
+
+	// 沿 Extends 链继承策略组中的字段
+	visited := map[string]bool{}
+	for group := policy.Extends; group != ""; {
+		if visited[group] || len(visited) >= maxExtendsDepth {
+			return nil, source, fmt.Errorf("policy %s: extends chain too deep or cyclic at group %q", source, group)
+		}
+		visited[group] = true
+
+		parent, ok := t.groups[group]
+		if !ok {
+			return nil, source, fmt.Errorf("policy %s: extends unknown group %q", source, group)
+		}
+		inheritPolicy(&policy, &parent)
+		group = parent.Extends
+	}
+
+	inheritPolicy(&policy, defaults)
+	policy.Extends = ""
+	normalizePolicy(&policy)
+	return &policy, source, nil
+}
+
+// lookup 查找精确策略或最具体的通配策略
+func (t *policyTable) lookup(name string) (Policy, string, bool) {
+	if policy, ok := t.exact[name]; ok {
+		return policy, name, true
+	}
+	for _, p := range t.patterns {
+		if matchPattern(p.pattern, name) {
+			return p.policy, p.pattern, true
+		}
+	}
+	return Policy{}, "", false
+}
+
+// inheritPolicy 将 parent 中的字段填充到 child 中未设置（零值）的字段
+// HedgeEnabled 为布尔值，无法区分未设置和显式关闭，因此只能继承开启状态
+func inheritPolicy(child, parent *Policy) {
+	if child.FailureThreshold == 0 {
+		child.FailureThreshold = parent.FailureThreshold
+	}
+	if child.SuccessThreshold == 0 {
+		child.SuccessThreshold = parent.SuccessThreshold
+	}
+	if child.OpenStateTimeout == 0 {
+		child.OpenStateTimeout = parent.OpenStateTimeout
+	}
+	if child.Timeout == 0 {
+		child.Timeout = parent.Timeout
+	}
+	if !child.HedgeEnabled {
+		child.HedgeEnabled = parent.HedgeEnabled
+	}
+	if child.HedgeDelay == 0 {
+		child.HedgeDelay = parent.HedgeDelay
+	}
+	if child.ProbeInterval == 0 {
+		child.ProbeInterval = parent.ProbeInterval
+	}
+}
+
+// copyPolicy 返回策略的副本，避免多个熔断器共享同一个策略对象
+func copyPolicy(policy *Policy) *Policy {
+	cp := *policy
+	return &cp
+}
+
+// matchPattern 判断 name 是否匹配通配模式，"*" 匹配任意长度的任意字符
+func matchPattern(pattern, name string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == name
+	}
+	if !strings.HasPrefix(name, parts[0]) {
+		return false
+	}
+	name = name[len(parts[0]):]
+
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		idx := strings.Index(name, part)
+		if idx < 0 {
+			return false
+		}
+		name = name[idx+len(part):]
+	}
+	return len(name) >= len(last) && strings.HasSuffix(name, last)
+}
+
+// morePrecise 判断模式 a 是否比 b 更具体：字面字符更多者优先，相同时按字典序保证结果稳定
+func morePrecise(a, b string) bool {
+	la := len(a) - strings.Count(a, "*")
+	lb := len(b) - strings.Count(b, "*")
+	if la != lb {
+		return la > lb
+	}
+	return a < b
+}
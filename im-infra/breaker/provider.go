@@ -4,7 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ceyewan/gochat/im-infra/clog"
@@ -14,18 +16,34 @@ import (
 
 // gobreakerAdapter 是 sony/gobreaker 库的适配器
 type gobreakerAdapter struct {
-	breaker *gobreaker.CircuitBreaker
-	name    string
-	logger  Logger
+	// breaker 使用原子指针保存，Reset 时整体替换为新实例，已持有适配器的调用方同样生效
+	breaker   atomic.Pointer[gobreaker.CircuitBreaker]
+	name      string
+	policy    *Policy
+	latency   *latencyTracker
+	errors    *errorWindow
+	overrides *overrideTable
+	// lastTransition 最近一次状态变更的时间（UnixNano），创建和 Reset 也视为变更
+	lastTransition atomic.Int64
+	// instance 实例级熔断器的状态上报链路，其他熔断器为 nil
+	instance *instanceLink
+	// shadow 合成探测验证器，未注册 HalfOpenProbe 的熔断器为 nil
+	shadow *shadowVerifier
+	logger Logger
+	newCB  func() *gobreaker.CircuitBreaker
 }
 
 // provider 是 Provider 接口的具体实现
 type provider struct {
 	config        *Config
 	breakers      map[string]Breaker
+	policies      *policyTable
+	overrides     *overrideTable
 	defaultPolicy *Policy
 	logger        Logger
 	coordProvider CoordProvider
+	reporter      InstanceReporter
+	probes        []patternProbe
 	cancelFunc    context.CancelFunc
 	wg            sync.WaitGroup
 	mu            sync.RWMutex
@@ -67,9 +85,13 @@ func New(ctx context.Context, config *Config, opts ...Option) (Provider, error)
 	p := &provider{
 		config:        config,
 		breakers:      make(map[string]Breaker),
+		policies:      newPolicyTable(),
+		overrides:     newOverrideTable(),
 		defaultPolicy: policy,
 		logger:        options.logger,
 		coordProvider: options.coordProvider,
+		reporter:      options.instanceReporter,
+		probes:        options.probes,
 		cancelFunc:    cancel,
 		closed:        false,
 	}
@@ -93,8 +115,8 @@ func New(ctx context.Context, config *Config, opts ...Option) (Provider, error)
 }
 
 // GetBreaker 获取或创建一个指定名称的熔断器实例
-// name 是被保护资源的唯一标识，例如 "grpc:user-service" 或 "http:payment-api"
-// 如果配置中心没有该名称的策略，会使用默认策略
+// name 是被保护资源的唯一标识，例如 "grpc:user-service" 或 "grpc:user-service/GetUser"
+// 策略按 精确策略 > 最具体的通配策略 > 默认策略 的顺序解析
 func (p *provider) GetBreaker(name string) Breaker {
 	fmt.Printf("DEBUG: GetBreaker called with name: %s\n", name)
 
@@ -108,27 +130,35 @@ func (p *provider) GetBreaker(name string) Breaker {
 	}
 
 	fmt.Printf("DEBUG: About to call getOrCreateBreaker\n")
-	return p.getOrCreateBreaker(name, p.defaultPolicy)
+	return p.getOrCreateBreaker(name)
 }
 
 // Close 关闭 Provider，停止所有后台任务
 func (p *provider) Close() error {
 	p.mu.Lock()
-	defer p.mu.Unlock()
-
 	if p.closed {
+		p.mu.Unlock()
 		return nil
 	}
+	p.mu.Unlock()
 
 	p.logger.Info("closing breaker provider")
 
-	// 停止配置监听
+	// 停止配置监听并等待后台任务完成
+	// 需要在释放锁的情况下等待，因为监听协程处理事件时会获取锁
 	p.cancelFunc()
-
-	// 等待所有后台任务完成
 	p.wg.Wait()
 
-	// 清理所有熔断器
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// 清理所有熔断器，已降级的实例交还给负载均衡
+	for _, b := range p.breakers {
+		if adapter, ok := b.(*gobreakerAdapter); ok {
+			adapter.shadow.stop()
+			adapter.instance.restore()
+		}
+	}
 	p.breakers = make(map[string]Breaker)
 
 	p.closed = true
@@ -165,8 +195,11 @@ func (p *provider) startConfigWatcher(ctx context.Context) error {
 			select {
 			case <-ctx.Done():
 				return
-			case event := <-watcher.Chan():
-				p.handleConfigEvent(event)
+			case event, ok := <-watcher.Chan():
+				if !ok {
+					return
+				}
+				p.handleConfigEvent(ctx, event)
 			}
 		}
 	}()
@@ -187,6 +220,12 @@ func (p *provider) loadAllPolicies(ctx context.Context) error {
 
 	// 加载每个策略文件
 	for _, key := range keys {
+		if p.isOverrideKey(key) {
+			if err := p.loadOverride(ctx, key); err != nil {
+				p.logger.Error("failed to load override", clog.String("key", key), clog.Err(err))
+			}
+			continue
+		}
 		if err := p.loadPolicy(ctx, key); err != nil {
 			p.logger.Error("failed to load policy", clog.String("key", key), clog.Err(err))
 			// 继续加载其他策略，不因为单个策略失败而中断
@@ -203,215 +242,213 @@ func (p *provider) loadPolicy(ctx context.Context, key string) error {
 		return err
 	}
 
-	// 验证策略
-	if policy.FailureThreshold <= 0 {
-		policy.FailureThreshold = GetDefaultPolicy().FailureThreshold
-	}
-	if policy.SuccessThreshold <= 0 {
-		policy.SuccessThreshold = GetDefaultPolicy().SuccessThreshold
-	}
-	if policy.OpenStateTimeout <= 0 {
-		policy.OpenStateTimeout = GetDefaultPolicy().OpenStateTimeout
-	}
-
 	p.logger.Info("policy loaded",
 		clog.String("key", key),
 		clog.Int("failure_threshold", policy.FailureThreshold),
 		clog.Int("success_threshold", policy.SuccessThreshold),
-		clog.Duration("open_state_timeout", policy.OpenStateTimeout))
+		clog.Duration("open_state_timeout", policy.OpenStateTimeout),
+		clog.Duration("timeout", policy.Timeout),
+		clog.Bool("hedge_enabled", policy.HedgeEnabled),
+		clog.String("extends", policy.Extends))
 
-	// 如果是默认策略文件，更新默认策略
-	if key == p.config.PoliciesPath+"default.json" {
-		p.defaultPolicy = &policy
-	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.setPolicy(key, policy)
 
 	return nil
 }
 
+// policyName 将配置键转换为策略名称，如 "<PoliciesPath>grpc:user-service/*.json" -> "grpc:user-service/*"
+func (p *provider) policyName(key string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(key, p.config.PoliciesPath), ".json")
+}
+
+// setPolicy 保存策略到策略表，默认策略同时更新 defaultPolicy
+// 调用此方法时必须已经持有写锁
+func (p *provider) setPolicy(key string, policy Policy) {
+	name := p.policyName(key)
+	if name == defaultPolicyName {
+		normalizePolicy(&policy)
+		p.defaultPolicy = &policy
+		return
+	}
+	p.policies.set(name, policy)
+}
+
 // handleConfigEvent 处理配置变更事件
-func (p *provider) handleConfigEvent(event ConfigEvent[any]) {
+func (p *provider) handleConfigEvent(ctx context.Context, event ConfigEvent[any]) {
+	// 人工干预与策略共用同一前缀，监听器按 Policy 解码，因此干预需要重新读取
+	if p.isOverrideKey(event.Key) {
+		p.handleOverrideEvent(ctx, event)
+		return
+	}
+
 	switch event.Type {
 	case EventTypePut:
-		if policy, ok := event.Value.(*Policy); ok {
+		switch policy := event.Value.(type) {
+		case Policy:
+			p.handlePolicyUpdate(&policy, event.Key)
+		case *Policy:
 			p.handlePolicyUpdate(policy, event.Key)
-		} else {
+		default:
 			p.logger.Warn("received non-policy config event", clog.String("key", event.Key))
 		}
 	case EventTypeDelete:
 		p.logger.Info("policy deleted", clog.String("key", event.Key))
-		// 可以在这里处理策略删除的逻辑
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if name := p.policyName(event.Key); name == defaultPolicyName {
+			p.defaultPolicy = GetDefaultPolicy()
+		} else {
+			p.policies.remove(name)
+		}
+		p.refreshBreakers()
 	}
 }
 
 // handlePolicyUpdate 处理策略更新
 func (p *provider) handlePolicyUpdate(policy *Policy, key string) {
-	// 验证策略
-	if policy.FailureThreshold <= 0 {
-		policy.FailureThreshold = GetDefaultPolicy().FailureThreshold
-	}
-	if policy.SuccessThreshold <= 0 {
-		policy.SuccessThreshold = GetDefaultPolicy().SuccessThreshold
-	}
-	if policy.OpenStateTimeout <= 0 {
-		policy.OpenStateTimeout = GetDefaultPolicy().OpenStateTimeout
-	}
-
 	p.logger.Info("policy updated",
 		clog.String("key", key),
 		clog.Int("failure_threshold", policy.FailureThreshold),
 		clog.Int("success_threshold", policy.SuccessThreshold),
-		clog.Duration("open_state_timeout", policy.OpenStateTimeout))
+		clog.Duration("open_state_timeout", policy.OpenStateTimeout),
+		clog.Duration("timeout", policy.Timeout),
+		clog.Bool("hedge_enabled", policy.HedgeEnabled),
+		clog.String("extends", policy.Extends))
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// 通配策略、策略组和默认策略都可能影响多个熔断器，统一重新解析
+	p.setPolicy(key, *policy)
+	p.refreshBreakers()
+}
 
-	// 如果是默认策略文件，更新默认策略
-	if key == p.config.PoliciesPath+"default.json" {
-		p.defaultPolicy = policy
-		// 重新创建所有熔断器实例
-		p.recreateAllBreakers()
+// resolvePolicy 解析熔断器最终生效的策略，配置有误时回退到默认策略
+// 调用此方法时必须已经持有锁
+func (p *provider) resolvePolicy(name string) *Policy {
+	policy, source, err := p.policies.resolve(name, p.defaultPolicy)
+	if err != nil {
+		p.logger.Error("failed to resolve breaker policy, falling back to default",
+			clog.String("name", name),
+			clog.String("policy", source),
+			clog.Err(err))
+		return copyPolicy(p.defaultPolicy)
 	}
+
+	p.logger.Debug("breaker policy resolved",
+		clog.String("name", name),
+		clog.String("policy", source))
+	return policy
 }
 
 // getOrCreateBreaker 获取或创建一个熔断器实例
 // 调用此方法时必须已经持有写锁
-func (p *provider) getOrCreateBreaker(name string, policy *Policy) Breaker {
-	fmt.Printf("DEBUG: getOrCreateBreaker called with name: %s\n", name)
-
+func (p *provider) getOrCreateBreaker(name string) Breaker {
 	// 检查是否已存在
 	if breaker, exists := p.breakers[name]; exists {
-		fmt.Printf("DEBUG: Found existing breaker\n")
 		return breaker
 	}
 
-	fmt.Printf("DEBUG: About to load breaker policy\n")
-	// 尝试从配置中心加载该熔断器的特定策略
-	breakerPolicy := p.loadBreakerPolicy(name)
-	if breakerPolicy == nil {
-		fmt.Printf("DEBUG: Using default policy\n")
-		breakerPolicy = policy
-	}
-
-	fmt.Printf("DEBUG: About to create new breaker adapter\n")
-	// 创建新的熔断器实例
-	adapter := p.newGobreakerAdapter(name, breakerPolicy)
+	adapter := p.newGobreakerAdapter(name, p.resolvePolicy(name))
 	p.breakers[name] = adapter
-
-	// Temporarily disable logging
-	// p.logger.Info("circuit breaker created",
-	// 	clog.String("name", name),
-	// 	clog.Int("failure_threshold", breakerPolicy.FailureThreshold),
-	// 	clog.Int("success_threshold", breakerPolicy.SuccessThreshold),
-	// 	clog.Duration("open_state_timeout", breakerPolicy.OpenStateTimeout))
-
-	fmt.Printf("DEBUG: Breaker created successfully\n")
 	return adapter
 }
 
-// loadBreakerPolicy 加载特定熔断器的策略
-func (p *provider) loadBreakerPolicy(name string) *Policy {
-	fmt.Printf("DEBUG: loadBreakerPolicy called with name: %s\n", name)
-	if p.coordProvider == nil {
-		fmt.Printf("DEBUG: No coord provider, returning nil\n")
-		return nil
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	key := p.config.PoliciesPath + name + ".json"
-	var policy Policy
-	if err := p.coordProvider.Get(ctx, key, &policy); err != nil {
-		p.logger.Debug("failed to load specific policy for breaker",
-			clog.String("name", name),
-			clog.String("key", key),
-			clog.Err(err))
-		return nil
-	}
-
-	// 验证策略
-	if policy.FailureThreshold <= 0 {
-		policy.FailureThreshold = GetDefaultPolicy().FailureThreshold
-	}
-	if policy.SuccessThreshold <= 0 {
-		policy.SuccessThreshold = GetDefaultPolicy().SuccessThreshold
-	}
-	if policy.OpenStateTimeout <= 0 {
-		policy.OpenStateTimeout = GetDefaultPolicy().OpenStateTimeout
-	}
-
-	return &policy
-}
-
 // newGobreakerAdapter 创建一个新的 gobreaker 适配器
 func (p *provider) newGobreakerAdapter(name string, policy *Policy) *gobreakerAdapter {
 	if p.logger == nil {
 		p.logger = &noopLogger{}
 	}
 
-	cb := gobreaker.NewCircuitBreaker(gobreaker.Settings{
-		Name:        name,
-		MaxRequests: 1,           // 半开状态只允许一个请求通过
-		Interval:    time.Minute, // 使用计数器重置
-		ReadyToTrip: func(counts gobreaker.Counts) bool {
-			return counts.ConsecutiveFailures >= uint32(policy.FailureThreshold)
-		},
-		OnStateChange: func(name string, from, to gobreaker.State) {
-			p.logger.Info("circuit breaker state changed",
-				clog.String("name", name),
-				clog.String("from", from.String()),
-				clog.String("to", to.String()))
-		},
-		Timeout: policy.OpenStateTimeout,
-	})
-
-	return &gobreakerAdapter{
-		breaker: cb,
-		name:    name,
-		logger:  p.logger,
-	}
+	logger := p.logger
+	adapter := &gobreakerAdapter{
+		name:      name,
+		policy:    policy,
+		latency:   &latencyTracker{},
+		errors:    &errorWindow{},
+		overrides: p.overrides,
+		instance:  newInstanceLink(p.reporter, name, logger),
+		shadow:    newShadowVerifier(lookupProbe(p.probes, name)),
+		logger:    logger,
+	}
+	adapter.newCB = func() *gobreaker.CircuitBreaker {
+		return gobreaker.NewCircuitBreaker(gobreaker.Settings{
+			Name:        name,
+			MaxRequests: 1,           // 半开状态只允许一个请求通过
+			Interval:    time.Minute, // 使用计数器重置
+			ReadyToTrip: func(counts gobreaker.Counts) bool {
+				return counts.ConsecutiveFailures >= uint32(policy.FailureThreshold)
+			},
+			OnStateChange: func(name string, from, to gobreaker.State) {
+				adapter.markTransition()
+				logger.Info("circuit breaker state changed",
+					clog.String("name", name),
+					clog.String("from", from.String()),
+					clog.String("to", to.String()))
+				adapter.instance.onStateChange(to, policy.OpenStateTimeout)
+				if to == gobreaker.StateOpen {
+					adapter.shadow.start(adapter)
+				}
+			},
+			Timeout: policy.OpenStateTimeout,
+		})
+	}
+	adapter.breaker.Store(adapter.newCB())
+	adapter.markTransition()
+	return adapter
 }
 
-// recreateAllBreakers 重新创建所有熔断器实例
-func (p *provider) recreateAllBreakers() {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-
-	p.logger.Info("recreating all circuit breakers with new policy")
+// reset 用新的 gobreaker 实例替换当前实例，状态回到关闭并清空计数，停止进行中的合成探测验证
+func (b *gobreakerAdapter) reset() {
+	b.shadow.stop()
+	b.breaker.Store(b.newCB())
+	b.markTransition()
+	b.instance.restore()
+}
 
-	// 保存旧的名称
-	names := make([]string, 0, len(p.breakers))
-	for name := range p.breakers {
-		names = append(names, name)
+// refreshBreakers 重新解析所有熔断器的策略，只重建策略发生变化的熔断器
+// 调用此方法时必须已经持有写锁
+func (p *provider) refreshBreakers() {
+	recreated := 0
+	for name, b := range p.breakers {
+		adapter, ok := b.(*gobreakerAdapter)
+		if !ok {
+			continue
+		}
+		policy := p.resolvePolicy(name)
+		if *policy == *adapter.policy {
+			continue
+		}
+		// 滚动错误率与策略无关，沿用原有统计；新熔断器处于关闭状态，已降级的实例随之恢复
+		adapter.shadow.stop()
+		adapter.instance.restore()
+		next := p.newGobreakerAdapter(name, policy)
+		next.errors = adapter.errors
+		p.breakers[name] = next
+		recreated++
 	}
 
-	// 清空旧的熔断器
-	p.breakers = make(map[string]Breaker)
-
-	// 重新创建所有熔断器
-	for _, name := range names {
-		adapter := p.newGobreakerAdapter(name, p.defaultPolicy)
-		p.breakers[name] = adapter
+	if recreated > 0 {
+		p.logger.Info("circuit breakers recreated with new policy", clog.Int("count", recreated))
 	}
 }
 
-// Do 执行受熔断器保护的操作
+// Do 执行受熔断器保护的操作，受策略中的超时控制，不进行对冲
 func (b *gobreakerAdapter) Do(ctx context.Context, op func() error) error {
-	_, err := b.breaker.Execute(func() (interface{}, error) {
-		err := op()
-		if err != nil {
-			b.logger.Debug("operation failed",
-				clog.String("breaker", b.name),
-				clog.Err(err))
-		}
-		return nil, err
+	return b.DoWithContext(ctx, func(context.Context) error {
+		return op()
 	})
+}
 
-	if err != nil {
-		if err == gobreaker.ErrOpenState {
-			return fmt.Errorf("%w: %s", ErrBreakerOpen, b.name)
-		}
-		return err
+// translateError 将 gobreaker 的错误转换为组件错误
+func (b *gobreakerAdapter) translateError(err error) error {
+	if err == gobreaker.ErrOpenState {
+		return fmt.Errorf("%w: %s", ErrBreakerOpen, b.name)
 	}
-
-	return nil
+	return err
 }
 
 // noopBreaker 是一个空的熔断器实现，用于在 provider 关闭后返回
@@ -421,6 +458,10 @@ func (n *noopBreaker) Do(ctx context.Context, op func() error) error {
 	return op() // 直接执行操作，不进行熔断保护
 }
 
+func (n *noopBreaker) DoWithContext(ctx context.Context, op func(ctx context.Context) error, opts ...CallOption) error {
+	return op(ctx)
+}
+
 // noopLogger 是一个空的日志器实现
 type noopLogger struct{}
 
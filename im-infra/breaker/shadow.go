@@ -0,0 +1,147 @@
+package breaker
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+)
+
+// HalfOpenProbe 是半开验证使用的合成探测请求，如调用下游的健康检查接口或轻量方法，返回 nil 表示探测成功
+type HalfOpenProbe func(ctx context.Context) error
+
+// patternProbe 是按名称模式注册的合成探测
+type patternProbe struct {
+	pattern string
+	probe   HalfOpenProbe
+}
+
+// WithHalfOpenProbe 为名称匹配 pattern（支持 "*" 通配）的熔断器注册合成探测，可多次调用，
+// 多个模式匹配同一熔断器时取最具体的一个。
+//
+// 注册后熔断器打开期间不再让真实请求作为半开探测：OpenStateTimeout 到期后按 Policy.ProbeInterval
+// 周期执行 probe，连续成功 Policy.SuccessThreshold 次才关闭熔断器，在此之前真实请求一律返回 ErrBreakerOpen。
+func WithHalfOpenProbe(pattern string, probe HalfOpenProbe) Option {
+	return func(opts *providerOptions) {
+		opts.probes = append(opts.probes, patternProbe{pattern: pattern, probe: probe})
+		sort.SliceStable(opts.probes, func(i, j int) bool {
+			return morePrecise(opts.probes[i].pattern, opts.probes[j].pattern)
+		})
+	}
+}
+
+// lookupProbe 返回熔断器名称对应的合成探测，probes 已按具体程度排序
+func lookupProbe(probes []patternProbe, name string) HalfOpenProbe {
+	for _, p := range probes {
+		if matchPattern(p.pattern, name) {
+			return p.probe
+		}
+	}
+	return nil
+}
+
+// shadowVerifier 在熔断器打开后用合成探测代替真实请求验证下游是否恢复，未注册探测的熔断器为 nil，所有方法对 nil 安全
+type shadowVerifier struct {
+	probe HalfOpenProbe
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	// verifying 为 true 时真实请求被拒绝
+	verifying atomic.Bool
+	// successes 当前连续成功的探测次数
+	successes atomic.Int64
+}
+
+// newShadowVerifier 创建合成探测验证器，probe 为 nil 时返回 nil
+func newShadowVerifier(probe HalfOpenProbe) *shadowVerifier {
+	if probe == nil {
+		return nil
+	}
+	return &shadowVerifier{probe: probe}
+}
+
+// active 返回是否正在用合成探测验证，此时真实请求应被拒绝
+func (s *shadowVerifier) active() bool {
+	return s != nil && s.verifying.Load()
+}
+
+// start 熔断器打开时开始验证，已在验证中时不重复启动
+func (s *shadowVerifier) start(b *gobreakerAdapter) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.successes.Store(0)
+	s.verifying.Store(true)
+	go s.run(ctx, b)
+}
+
+// stop 停止验证并放行真实请求，熔断器被重置、重建或 Provider 关闭时调用
+func (s *shadowVerifier) stop() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		s.cancel()
+		s.cancel = nil
+	}
+	s.verifying.Store(false)
+}
+
+// run 等待 OpenStateTimeout 后周期执行探测，连续成功 SuccessThreshold 次后关闭熔断器
+func (s *shadowVerifier) run(ctx context.Context, b *gobreakerAdapter) {
+	policy := b.policy
+	timer := time.NewTimer(policy.OpenStateTimeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		err := s.check(ctx, policy)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			s.successes.Store(0)
+			b.logger.Debug("half-open probe failed",
+				clog.String("breaker", b.name),
+				clog.Err(err))
+		} else if s.successes.Add(1) >= int64(policy.SuccessThreshold) {
+			b.logger.Info("half-open probes passed, closing circuit breaker",
+				clog.String("breaker", b.name),
+				clog.Int("successes", policy.SuccessThreshold))
+			// reset 会调用 stop 取消本协程的 ctx
+			b.reset()
+			return
+		}
+		timer.Reset(policy.ProbeInterval)
+	}
+}
+
+// check 执行一次探测，超时时间为 Policy.Timeout，未设置时为 ProbeInterval
+func (s *shadowVerifier) check(ctx context.Context, policy *Policy) error {
+	timeout := policy.Timeout
+	if timeout <= 0 {
+		timeout = policy.ProbeInterval
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return attempt(ctx, func(ctx context.Context) error {
+		return s.probe(ctx)
+	})
+}
@@ -0,0 +1,253 @@
+package breaker
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sony/gobreaker"
+)
+
+// 快照中熔断器的状态
+const (
+	StateClosed   = "closed"
+	StateOpen     = "open"
+	StateHalfOpen = "half-open"
+)
+
+const (
+	// errorBucketSpan 滚动窗口中单个桶覆盖的时长
+	errorBucketSpan = 10 * time.Second
+	// errorBuckets 滚动窗口的桶数，窗口总长为 errorBucketSpan * errorBuckets（1 分钟）
+	errorBuckets = 6
+)
+
+// BreakerStatus 单个熔断器在某一时刻的状态
+type BreakerStatus struct {
+	Name string `json:"name"`
+	// State 当前生效的状态：closed、open、half-open，存在人工干预时为干预后的状态
+	State string `json:"state"`
+	// Override 生效中的人工干预，nil 表示没有干预
+	Override *Override `json:"override,omitempty"`
+	// Requests 最近 1 分钟内实际执行的调用数
+	Requests int64 `json:"requests"`
+	// Failures 最近 1 分钟内失败（含超时）的调用数
+	Failures int64 `json:"failures"`
+	// Rejected 最近 1 分钟内因熔断器打开而被拒绝的调用数
+	Rejected int64 `json:"rejected"`
+	// ErrorRate 最近 1 分钟内的失败率 Failures / Requests，没有调用时为 0
+	ErrorRate float64 `json:"errorRate"`
+	// LatencyP95 最近成功调用的 P95 延迟，样本不足时为 0
+	LatencyP95 time.Duration `json:"latencyP95"`
+	// Verifying 是否正在用合成探测验证下游恢复，此时真实请求被拒绝
+	Verifying bool `json:"verifying,omitempty"`
+	// LastTransition 最近一次状态变更（或创建、重置）的时间
+	LastTransition time.Time `json:"lastTransition"`
+	// Policy 当前生效的策略
+	Policy Policy `json:"policy"`
+}
+
+// Healthy 返回下游是否可以正常接收流量，打开和半开状态都视为不健康
+func (s BreakerStatus) Healthy() bool {
+	return s.State == StateClosed
+}
+
+// Snapshot 是 Provider 中所有熔断器的状态快照，可直接用于看板和就绪探针
+type Snapshot struct {
+	Service string `json:"service"`
+	// Breakers 按名称排序的熔断器状态
+	Breakers []BreakerStatus `json:"breakers"`
+	// Unhealthy 处于打开或半开状态的熔断器名称
+	Unhealthy []string  `json:"unhealthy"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// Healthy 返回是否所有下游都处于关闭状态
+func (s Snapshot) Healthy() bool {
+	return len(s.Unhealthy) == 0
+}
+
+// Snapshot 返回所有熔断器的状态、最近 1 分钟的错误率和最近一次状态变更时间，
+// 回答"当前哪些下游不健康"。Provider 关闭后返回空快照。
+func (p *provider) Snapshot() Snapshot {
+	p.mu.RLock()
+	adapters := make([]*gobreakerAdapter, 0, len(p.breakers))
+	for _, b := range p.breakers {
+		if adapter, ok := b.(*gobreakerAdapter); ok {
+			adapters = append(adapters, adapter)
+		}
+	}
+	p.mu.RUnlock()
+
+	now := time.Now()
+	snapshot := Snapshot{
+		Service:   p.config.ServiceName,
+		Breakers:  make([]BreakerStatus, 0, len(adapters)),
+		Unhealthy: []string{},
+		CheckedAt: now,
+	}
+	for _, adapter := range adapters {
+		snapshot.Breakers = append(snapshot.Breakers, adapter.status(now))
+	}
+
+	sort.Slice(snapshot.Breakers, func(i, j int) bool {
+		return snapshot.Breakers[i].Name < snapshot.Breakers[j].Name
+	})
+	for _, status := range snapshot.Breakers {
+		if !status.Healthy() {
+			snapshot.Unhealthy = append(snapshot.Unhealthy, status.Name)
+		}
+	}
+	return snapshot
+}
+
+// status 返回熔断器在 now 时刻的状态
+func (b *gobreakerAdapter) status(now time.Time) BreakerStatus {
+	requests, failures, rejected := b.errors.counts(now)
+	status := BreakerStatus{
+		Name:           b.name,
+		State:          b.breaker.Load().State().String(),
+		Requests:       requests,
+		Failures:       failures,
+		Rejected:       rejected,
+		Verifying:      b.shadow.active(),
+		LastTransition: time.Unix(0, b.lastTransition.Load()),
+		Policy:         *b.policy,
+	}
+	if requests > 0 {
+		status.ErrorRate = float64(failures) / float64(requests)
+	}
+	if p95, ok := b.latency.p95(); ok {
+		status.LatencyP95 = p95
+	}
+	if override, ok := b.overrides.lookup(b.name); ok {
+		status.Override = &override
+		status.State = override.State
+	}
+	return status
+}
+
+// markTransition 记录一次状态变更的时间
+func (b *gobreakerAdapter) markTransition() {
+	b.lastTransition.Store(time.Now().UnixNano())
+}
+
+// recordResult 将一次调用结果计入滚动窗口
+func (b *gobreakerAdapter) recordResult(err error) {
+	switch err {
+	case nil:
+		b.errors.add(time.Now(), 1, 0, 0)
+	case gobreaker.ErrOpenState, gobreaker.ErrTooManyRequests:
+		b.errors.add(time.Now(), 0, 0, 1)
+	default:
+		b.errors.add(time.Now(), 1, 1, 0)
+	}
+}
+
+// errorBucket 滚动窗口中的一个桶，slot 为桶对应的时间片序号
+type errorBucket struct {
+	slot     int64
+	requests int64
+	failures int64
+	rejected int64
+}
+
+// errorWindow 按时间分桶统计最近 1 分钟的调用结果。
+// gobreaker 自身的计数在 Interval 到期时整体清零，无法反映滚动错误率，因此单独统计。
+type errorWindow struct {
+	mu      sync.Mutex
+	buckets [errorBuckets]errorBucket
+}
+
+// add 将调用结果计入 now 所在的桶，桶已过期时先清零
+func (w *errorWindow) add(now time.Time, requests, failures, rejected int64) {
+	slot := now.UnixNano() / int64(errorBucketSpan)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	bucket := &w.buckets[slot%errorBuckets]
+	if bucket.slot != slot {
+		*bucket = errorBucket{slot: slot}
+	}
+	bucket.requests += requests
+	bucket.failures += failures
+	bucket.rejected += rejected
+}
+
+// counts 汇总窗口内未过期的桶
+func (w *errorWindow) counts(now time.Time) (requests, failures, rejected int64) {
+	slot := now.UnixNano() / int64(errorBucketSpan)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, bucket := range w.buckets {
+		if slot-bucket.slot >= errorBuckets {
+			continue
+		}
+		requests += bucket.requests
+		failures += bucket.failures
+		rejected += bucket.rejected
+	}
+	return requests, failures, rejected
+}
+
+// Handler 返回以 JSON 输出熔断器快照的 HTTP 处理器，用于看板和就绪探针：
+//   - 默认始终返回 200，快照中的 unhealthy 列出不健康的下游
+//   - ?readiness=true 时存在打开或半开的熔断器则返回 503，可直接作为就绪探针
+//   - ?name=grpc:user-service/* 只输出匹配的熔断器，支持 "*" 通配
+//
+// 示例：
+//
+//	mux.Handle("/debug/breakers", breaker.Handler(provider))
+func Handler(p Provider) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		snapshot := p.Snapshot()
+		if pattern := r.URL.Query().Get("name"); pattern != "" {
+			snapshot = snapshot.filter(pattern)
+		}
+
+		code := http.StatusOK
+		if readiness, _ := strconv.ParseBool(r.URL.Query().Get("readiness")); readiness && !snapshot.Healthy() {
+			code = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(code)
+		if r.Method == http.MethodHead {
+			return
+		}
+		// 写入失败通常是探针已断开连接，无需处理
+		_ = json.NewEncoder(w).Encode(snapshot)
+	})
+}
+
+// filter 返回只包含名称与 pattern 匹配的熔断器的快照
+func (s Snapshot) filter(pattern string) Snapshot {
+	filtered := Snapshot{
+		Service:   s.Service,
+		Breakers:  []BreakerStatus{},
+		Unhealthy: []string{},
+		CheckedAt: s.CheckedAt,
+	}
+	for _, status := range s.Breakers {
+		if !matchPattern(pattern, status.Name) {
+			continue
+		}
+		filtered.Breakers = append(filtered.Breakers, status)
+		if !status.Healthy() {
+			filtered.Unhealthy = append(filtered.Unhealthy, status.Name)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,279 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+)
+
+// ErrNotFound 表示数据源中不存在该记录。
+// Loader 返回此错误时，CacheBinding 会按 NegativeTTL 写入负缓存，避免不存在的 ID 反复穿透到数据库。
+var ErrNotFound = errors.New("cache: record not found")
+
+// 写入策略，决定 CacheBinding.Set 写入数据库之后如何处理缓存
+const (
+	// WritePolicyInvalidate 写入数据库后删除缓存，下次读取时重新加载（默认，最不容易出现脏数据）
+	WritePolicyInvalidate = "invalidate"
+	// WritePolicyWriteThrough 写入数据库后用新值更新缓存，适合写后立即读的场景
+	WritePolicyWriteThrough = "write_through"
+)
+
+// negativeMarker 负缓存的占位值，以 NUL 开头，不会与任何 JSON 编码结果冲突
+const negativeMarker = "\x00nil"
+
+// BindingConfig 定义了 CacheBinding 的缓存策略
+type BindingConfig struct {
+	// Namespace 缓存键的命名空间，最终键为 "{Namespace}:{id}"（仍会叠加 Config.KeyPrefix）
+	Namespace string `json:"namespace" yaml:"namespace"`
+
+	// TTL 缓存的过期时间，与 TTLPolicy 二选一
+	TTL time.Duration `json:"ttl" yaml:"ttl"`
+
+	// TTLPolicy 命名过期策略，如 cache.TTLMedium，设置后优先于 TTL
+	TTLPolicy string `json:"ttlPolicy" yaml:"ttlPolicy"`
+
+	// NegativeTTL 记录不存在时负缓存的过期时间，0 表示不缓存不存在的记录
+	NegativeTTL time.Duration `json:"negativeTTL" yaml:"negativeTTL"`
+
+	// WritePolicy 写入策略：WritePolicyInvalidate（默认）或 WritePolicyWriteThrough
+	WritePolicy string `json:"writePolicy" yaml:"writePolicy"`
+}
+
+// Validate 验证绑定配置的有效性
+func (c *BindingConfig) Validate() error {
+	if c.Namespace == "" {
+		return fmt.Errorf("binding namespace cannot be empty")
+	}
+	if c.TTL < 0 {
+		return fmt.Errorf("binding ttl cannot be negative, got: %v", c.TTL)
+	}
+	if c.TTL == 0 && c.TTLPolicy == "" {
+		return fmt.Errorf("binding %s requires ttl or ttlPolicy", c.Namespace)
+	}
+	if c.NegativeTTL < 0 {
+		return fmt.Errorf("binding negative ttl cannot be negative, got: %v", c.NegativeTTL)
+	}
+	switch c.WritePolicy {
+	case "", WritePolicyInvalidate, WritePolicyWriteThrough:
+	default:
+		return fmt.Errorf("unknown binding write policy: %s", c.WritePolicy)
+	}
+	return nil
+}
+
+// Loader 从数据源（通常是 db）加载记录，记录不存在时应返回 cache.ErrNotFound
+type Loader[T any] func(ctx context.Context, id string) (T, error)
+
+// Writer 将记录写入数据源
+type Writer[T any] func(ctx context.Context, id string, value T) error
+
+// Deleter 从数据源删除记录
+type Deleter func(ctx context.Context, id string) error
+
+// BindingOption 定义了 NewBinding 的可选配置
+type BindingOption[T any] func(*CacheBinding[T])
+
+// WithWriter 设置写入数据源的函数，未设置时 Set 返回错误
+func WithWriter[T any](writer Writer[T]) BindingOption[T] {
+	return func(b *CacheBinding[T]) {
+		b.writer = writer
+	}
+}
+
+// WithDeleter 设置从数据源删除记录的函数，未设置时 Delete 返回错误
+func WithDeleter[T any](deleter Deleter) BindingOption[T] {
+	return func(b *CacheBinding[T]) {
+		b.deleter = deleter
+	}
+}
+
+// WithCodec 设置缓存值的编解码函数，默认使用 JSON
+func WithCodec[T any](marshal func(T) ([]byte, error), unmarshal func([]byte) (T, error)) BindingOption[T] {
+	return func(b *CacheBinding[T]) {
+		b.marshal = marshal
+		b.unmarshal = unmarshal
+	}
+}
+
+// CacheBinding 将一个缓存命名空间与数据源的加载/写入函数绑定，统一实现 cache-aside 模式：
+//   - Get：缓存 → 数据源 → 回填缓存，不存在的记录按 NegativeTTL 负缓存
+//   - Set：先写数据源，再按 WritePolicy 删除或更新缓存
+//   - Delete：先删数据源，再删除缓存
+//
+// 缓存读写失败不会影响数据源操作的结果，只记录日志；数据源的错误原样返回。
+type CacheBinding[T any] struct {
+	provider  Provider
+	config    BindingConfig
+	ttl       time.Duration
+	loader    Loader[T]
+	writer    Writer[T]
+	deleter   Deleter
+	marshal   func(T) ([]byte, error)
+	unmarshal func([]byte) (T, error)
+	logger    clog.Logger
+}
+
+// NewBinding 创建一个缓存绑定。
+//
+// 示例：
+//
+//	users, err := cache.NewBinding(provider, cache.BindingConfig{
+//	    Namespace:   "user",
+//	    TTLPolicy:   cache.TTLMedium,
+//	    NegativeTTL: time.Minute,
+//	}, userRepo.Load, cache.WithWriter(userRepo.Save))
+func NewBinding[T any](provider Provider, cfg BindingConfig, loader Loader[T], opts ...BindingOption[T]) (*CacheBinding[T], error) {
+	if provider == nil {
+		return nil, fmt.Errorf("cache provider cannot be nil")
+	}
+	if loader == nil {
+		return nil, fmt.Errorf("binding loader cannot be nil")
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	ttl := cfg.TTL
+	if cfg.TTLPolicy != "" {
+		policyTTL, err := provider.TTLPolicy(cfg.TTLPolicy)
+		if err != nil {
+			return nil, fmt.Errorf("binding %s: %w", cfg.Namespace, err)
+		}
+		ttl = policyTTL
+	}
+	if cfg.WritePolicy == "" {
+		cfg.WritePolicy = WritePolicyInvalidate
+	}
+
+	b := &CacheBinding[T]{
+		provider: provider,
+		config:   cfg,
+		ttl:      ttl,
+		loader:   loader,
+		marshal: func(v T) ([]byte, error) {
+			return json.Marshal(v)
+		},
+		unmarshal: func(data []byte) (T, error) {
+			var v T
+			err := json.Unmarshal(data, &v)
+			return v, err
+		},
+		logger: clog.Namespace("cache.binding").With(clog.String("binding", cfg.Namespace)),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b, nil
+}
+
+// Get 读取记录：优先从缓存读取，未命中时从数据源加载并回填缓存。
+// 记录不存在（包括命中负缓存）时返回 cache.ErrNotFound。
+func (b *CacheBinding[T]) Get(ctx context.Context, id string) (T, error) {
+	var zero T
+	key := b.key(id)
+
+	cached, err := b.provider.String().Get(ctx, key)
+	switch {
+	case err == nil:
+		if cached == negativeMarker {
+			return zero, ErrNotFound
+		}
+		value, err := b.unmarshal([]byte(cached))
+		if err == nil {
+			return value, nil
+		}
+		// 缓存中的数据无法解码（如结构体变更），视为未命中并重新加载
+		b.logger.Warn("缓存值解码失败，重新加载", clog.String("key", key), clog.Err(err))
+	case errors.Is(err, ErrCacheMiss):
+	default:
+		// 缓存不可用时降级为直接读取数据源
+		b.logger.Warn("读取缓存失败，降级读取数据源", clog.String("key", key), clog.Err(err))
+	}
+
+	value, err := b.loader(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		if b.config.NegativeTTL > 0 {
+			if err := b.provider.String().Set(ctx, key, negativeMarker, b.config.NegativeTTL); err != nil {
+				b.logger.Warn("写入负缓存失败", clog.String("key", key), clog.Err(err))
+			}
+		}
+		return zero, ErrNotFound
+	}
+	if err != nil {
+		return zero, err
+	}
+
+	b.populate(ctx, key, value)
+	return value, nil
+}
+
+// Set 先将记录写入数据源，成功后按 WritePolicy 删除或更新缓存
+func (b *CacheBinding[T]) Set(ctx context.Context, id string, value T) error {
+	if b.writer == nil {
+		return fmt.Errorf("binding %s has no writer", b.config.Namespace)
+	}
+	if err := b.writer(ctx, id, value); err != nil {
+		return err
+	}
+
+	key := b.key(id)
+	if b.config.WritePolicy == WritePolicyWriteThrough {
+		b.populate(ctx, key, value)
+		return nil
+	}
+	b.invalidate(ctx, key)
+	return nil
+}
+
+// Delete 先从数据源删除记录，成功后删除缓存
+func (b *CacheBinding[T]) Delete(ctx context.Context, id string) error {
+	if b.deleter == nil {
+		return fmt.Errorf("binding %s has no deleter", b.config.Namespace)
+	}
+	if err := b.deleter(ctx, id); err != nil {
+		return err
+	}
+	b.invalidate(ctx, b.key(id))
+	return nil
+}
+
+// Invalidate 删除缓存中的记录（包括负缓存），不修改数据源。
+// 适用于数据源被其他途径修改（如后台任务、其他服务）后主动清理缓存。
+func (b *CacheBinding[T]) Invalidate(ctx context.Context, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = b.key(id)
+	}
+	return b.provider.String().Del(ctx, keys...)
+}
+
+// key 返回记录在缓存中的键
+func (b *CacheBinding[T]) key(id string) string {
+	return b.config.Namespace + ":" + id
+}
+
+// populate 将记录写入缓存，失败时只记录日志
+func (b *CacheBinding[T]) populate(ctx context.Context, key string, value T) {
+	data, err := b.marshal(value)
+	if err != nil {
+		b.logger.Warn("缓存值编码失败", clog.String("key", key), clog.Err(err))
+		return
+	}
+	if err := b.provider.String().Set(ctx, key, data, b.ttl); err != nil {
+		b.logger.Warn("回填缓存失败", clog.String("key", key), clog.Err(err))
+	}
+}
+
+// invalidate 删除缓存中的记录，失败时只记录日志，旧值将在过期后自然失效
+func (b *CacheBinding[T]) invalidate(ctx context.Context, key string) {
+	if err := b.provider.String().Del(ctx, key); err != nil {
+		b.logger.Warn("删除缓存失败", clog.String("key", key), clog.Err(err))
+	}
+}
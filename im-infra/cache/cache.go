@@ -42,6 +42,34 @@ func (p *providerWrapper) Script() ScriptingOperations {
 	return p.client.Script()
 }
 
+func (p *providerWrapper) Keys() KeyOperations {
+	return p.client.Keys()
+}
+
+func (p *providerWrapper) PubSub() PubSubOperations {
+	return p.client.PubSub()
+}
+
+func (p *providerWrapper) TTLPolicy(name string) (time.Duration, error) {
+	return p.client.TTLPolicy(name)
+}
+
+func (p *providerWrapper) Stats() PoolStats {
+	return p.client.Stats()
+}
+
+func (p *providerWrapper) EnableKeyspaceNotifications(ctx context.Context, classes string) error {
+	return p.client.EnableKeyspaceNotifications(ctx, classes)
+}
+
+func (p *providerWrapper) SubscribeKeyspace(ctx context.Context, pattern string, handler KeyspaceHandler) (KeyspaceSubscription, error) {
+	return p.client.SubscribeKeyspace(ctx, pattern, handler)
+}
+
+func (p *providerWrapper) SubscribeExpired(ctx context.Context, pattern string, handler func(key string)) (KeyspaceSubscription, error) {
+	return p.client.SubscribeExpired(ctx, pattern, handler)
+}
+
 func (p *providerWrapper) Ping(ctx context.Context) error {
 	return p.client.Ping(ctx)
 }
@@ -75,6 +103,18 @@ func (s *stringOperationsWrapper) Decr(ctx context.Context, key string) (int64,
 	return s.ops.Decr(ctx, key)
 }
 
+func (s *stringOperationsWrapper) IncrWithMax(ctx context.Context, key string, delta, max int64) (int64, bool, error) {
+	return s.ops.IncrWithMax(ctx, key, delta, max)
+}
+
+func (s *stringOperationsWrapper) DecrWithMin(ctx context.Context, key string, delta, min int64) (int64, bool, error) {
+	return s.ops.DecrWithMin(ctx, key, delta, min)
+}
+
+func (s *stringOperationsWrapper) IncrByBatch(ctx context.Context, deltas map[string]int64, expiration time.Duration) error {
+	return s.ops.IncrByBatch(ctx, deltas, expiration)
+}
+
 func (s *stringOperationsWrapper) Exists(ctx context.Context, keys ...string) (int64, error) {
 	return s.ops.Exists(ctx, keys...)
 }
@@ -129,6 +169,30 @@ func (l *lockOperationsWrapper) Acquire(ctx context.Context, key string, expirat
 	return &lockerWrapper{locker: internalLocker}, nil
 }
 
+func (l *lockOperationsWrapper) TryLock(ctx context.Context, key string, expiration time.Duration) (Locker, bool, error) {
+	internalLocker, ok, err := l.ops.TryLock(ctx, key, expiration)
+	if err != nil || !ok {
+		return nil, ok, err
+	}
+	return &lockerWrapper{locker: internalLocker}, true, nil
+}
+
+func (l *lockOperationsWrapper) Lock(ctx context.Context, key string, expiration time.Duration) (Locker, error) {
+	internalLocker, err := l.ops.Lock(ctx, key, expiration)
+	if err != nil {
+		return nil, err
+	}
+	return &lockerWrapper{locker: internalLocker}, nil
+}
+
+func (l *lockOperationsWrapper) LockWithOptions(ctx context.Context, key string, expiration time.Duration, opts LockOptions) (Locker, error) {
+	internalLocker, err := l.ops.LockWithOptions(ctx, key, expiration, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &lockerWrapper{locker: internalLocker}, nil
+}
+
 // lockerWrapper 包装内部 Locker
 type lockerWrapper struct {
 	locker internal.Locker
@@ -291,6 +355,10 @@ func New(ctx context.Context, config *Config, opts ...Option) (Provider, error)
 		MinRetryBackoff: config.MinRetryBackoff,
 		MaxRetryBackoff: config.MaxRetryBackoff,
 		KeyPrefix:       config.KeyPrefix,
+		TTLJitter:       config.TTLJitter,
+		TTLPolicies:     config.TTLPolicies,
+		Health:          config.Health,
+		HealthHandlers:  options.healthHandlers,
 	}
 
 	// 创建 cache 实例
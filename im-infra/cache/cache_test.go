@@ -87,6 +87,45 @@ func TestCacheIntegration(t *testing.T) {
 		val, err = testClient.String().Incr(ctx, incrKey)
 		require.NoError(t, err)
 		assert.Equal(t, int64(2), val)
+
+		// 测试带边界的计数器
+		boundedKey := "string:bounded"
+		val, hit, err := testClient.String().IncrWithMax(ctx, boundedKey, 3, 5)
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), val)
+		assert.False(t, hit)
+		val, hit, err = testClient.String().IncrWithMax(ctx, boundedKey, 3, 5)
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), val)
+		assert.True(t, hit)
+		val, hit, err = testClient.String().DecrWithMin(ctx, boundedKey, 4, 0)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), val)
+		assert.False(t, hit)
+		val, hit, err = testClient.String().DecrWithMin(ctx, boundedKey, 4, 0)
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), val)
+		assert.True(t, hit)
+
+		// 值不变时不创建不存在的键
+		missingKey := "string:bounded:missing"
+		val, hit, err = testClient.String().DecrWithMin(ctx, missingKey, 1, 0)
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), val)
+		assert.True(t, hit)
+		count, err := testClient.String().Exists(ctx, missingKey)
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), count)
+
+		// 值变化时保留原有的 TTL
+		ttlKey := "string:bounded:ttl"
+		require.NoError(t, testClient.String().Set(ctx, ttlKey, 1, time.Minute))
+		val, _, err = testClient.String().IncrWithMax(ctx, ttlKey, 1, 5)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), val)
+		ttl, err := testClient.Keys().TTL(ctx, ttlKey)
+		require.NoError(t, err)
+		assert.Greater(t, ttl, time.Duration(0))
 	})
 
 	// --- 哈希操作 ---
@@ -123,9 +162,38 @@ func TestCacheIntegration(t *testing.T) {
 
 		// 尝试再次获取锁（应该失败）
 		sameLock, err := testClient.Lock().Acquire(ctx, key, 10*time.Second)
-		assert.Error(t, err, "第二次获取同一个锁应该返回错误")
+		assert.ErrorIs(t, err, cache.ErrLockNotAcquired, "第二次获取同一个锁应该返回 ErrLockNotAcquired")
 		assert.Nil(t, sameLock, "第二次获取同一个锁应该返回 nil")
 
+		// TryLock 在锁被占用时返回 false 而不是错误
+		tryLock, ok, err := testClient.Lock().TryLock(ctx, key, 10*time.Second)
+		require.NoError(t, err)
+		assert.False(t, ok)
+		assert.Nil(t, tryLock)
+
+		// LockWithOptions 超过最长等待时间后返回 ErrLockNotAcquired
+		_, err = testClient.Lock().LockWithOptions(ctx, key, 10*time.Second, cache.LockOptions{
+			RetryInterval: 10 * time.Millisecond,
+			MaxWait:       100 * time.Millisecond,
+		})
+		assert.ErrorIs(t, err, cache.ErrLockNotAcquired)
+
+		// Lock 在 ctx 结束时返回 ctx.Err()
+		waitCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		_, err = testClient.Lock().Lock(waitCtx, key, 10*time.Second)
+		cancel()
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		// 持有者释放后，阻塞等待的 Lock 能够获取到锁
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			lock.Unlock(ctx)
+		}()
+		waitedLock, err := testClient.Lock().Lock(ctx, key, 10*time.Second)
+		require.NoError(t, err)
+		require.NotNil(t, waitedLock)
+		lock = waitedLock
+
 		// 释放锁
 		err = lock.Unlock(ctx)
 		require.NoError(t, err)
@@ -334,6 +402,154 @@ func TestCacheIntegration(t *testing.T) {
 		require.NoError(t, err)
 	})
 
+	// --- 键空间扫描与批量删除 ---
+	t.Run("KeyOperations", func(t *testing.T) {
+		for i := 0; i < 25; i++ {
+			err := testClient.String().Set(ctx, fmt.Sprintf("tenant:42:key:%d", i), "v", time.Minute)
+			require.NoError(t, err)
+		}
+		require.NoError(t, testClient.String().Set(ctx, "tenant:43:key:0", "v", time.Minute))
+
+		// ScanKeys 返回的键已去除 KeyPrefix
+		seen := make(map[string]bool)
+		it := testClient.Keys().ScanKeys(ctx, "tenant:42:*", 10)
+		for it.Next(ctx) {
+			seen[it.Val()] = true
+		}
+		require.NoError(t, it.Err())
+		assert.Len(t, seen, 25)
+		assert.True(t, seen["tenant:42:key:0"])
+
+		// DryRun 只统计不删除
+		var last cache.DeleteProgress
+		deleted, err := testClient.Keys().DeleteByPrefix(ctx, "tenant:42:", cache.DeleteOptions{
+			BatchSize:  10,
+			DryRun:     true,
+			OnProgress: func(p cache.DeleteProgress) { last = p },
+		})
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), deleted)
+		assert.Equal(t, int64(25), last.Matched)
+
+		calls := 0
+		deleted, err = testClient.Keys().DeleteByPrefix(ctx, "tenant:42:", cache.DeleteOptions{
+			BatchSize:  10,
+			RateLimit:  1000,
+			OnProgress: func(p cache.DeleteProgress) { calls++ },
+		})
+		require.NoError(t, err)
+		assert.Equal(t, int64(25), deleted)
+		assert.GreaterOrEqual(t, calls, 3)
+
+		// 其他租户的键不受影响
+		_, err = testClient.String().Get(ctx, "tenant:43:key:0")
+		assert.NoError(t, err)
+
+		_, err = testClient.Keys().DeleteByPattern(ctx, "", cache.DeleteOptions{})
+		assert.ErrorIs(t, err, cache.ErrEmptyPattern)
+	})
+
+	// --- 过期时间管理 ---
+	t.Run("TTLManagement", func(t *testing.T) {
+		require.NoError(t, testClient.String().Set(ctx, "ttl:session:1", "v", time.Minute))
+		require.NoError(t, testClient.String().Set(ctx, "ttl:session:2", "v", time.Minute))
+		require.NoError(t, testClient.String().Set(ctx, "ttl:session:config", "v", 0))
+
+		ttl, err := testClient.Keys().TTL(ctx, "ttl:session:1")
+		require.NoError(t, err)
+		assert.InDelta(t, float64(time.Minute), float64(ttl), float64(6*time.Second))
+
+		ttl, err = testClient.Keys().TTL(ctx, "ttl:session:config")
+		require.NoError(t, err)
+		assert.Equal(t, cache.NoExpiration, ttl)
+
+		_, err = testClient.Keys().TTL(ctx, "ttl:missing")
+		assert.ErrorIs(t, err, cache.ErrCacheMiss)
+
+		// 在当前过期时间上延长，未设置过期时间的键保持不过期
+		updated, err := testClient.Keys().UpdateTTLByPrefix(ctx, "ttl:session:", cache.TTLUpdateOptions{
+			Extend:    time.Hour,
+			BatchSize: 1,
+			RateLimit: 1000,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), updated)
+		ttl, err = testClient.Keys().TTL(ctx, "ttl:session:2")
+		require.NoError(t, err)
+		assert.Greater(t, ttl, time.Hour)
+		ttl, err = testClient.Keys().TTL(ctx, "ttl:session:config")
+		require.NoError(t, err)
+		assert.Equal(t, cache.NoExpiration, ttl)
+
+		// 设置 TTL 时默认跳过常驻键，DryRun 只统计
+		var last cache.TTLUpdateProgress
+		updated, err = testClient.Keys().UpdateTTLByPattern(ctx, "ttl:session:*", cache.TTLUpdateOptions{
+			TTL:        10 * time.Minute,
+			DryRun:     true,
+			OnProgress: func(p cache.TTLUpdateProgress) { last = p },
+		})
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), updated)
+		assert.Equal(t, int64(3), last.Matched)
+
+		updated, err = testClient.Keys().UpdateTTLByPattern(ctx, "ttl:session:*", cache.TTLUpdateOptions{TTL: 10 * time.Minute})
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), updated)
+
+		ok, err := testClient.Keys().Persist(ctx, "ttl:session:1")
+		require.NoError(t, err)
+		assert.True(t, ok)
+		ok, err = testClient.Keys().Persist(ctx, "ttl:session:1")
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		ok, err = testClient.Keys().ExpireAt(ctx, "ttl:session:1", time.Now().Add(30*time.Second))
+		require.NoError(t, err)
+		assert.True(t, ok)
+		ttl, err = testClient.Keys().TTL(ctx, "ttl:session:1")
+		require.NoError(t, err)
+		assert.LessOrEqual(t, ttl, 30*time.Second)
+
+		ok, err = testClient.Keys().ExpireAt(ctx, "ttl:missing", time.Now().Add(time.Minute))
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		_, err = testClient.Keys().UpdateTTLByPattern(ctx, "ttl:*", cache.TTLUpdateOptions{TTL: time.Minute, Persist: true})
+		assert.ErrorIs(t, err, cache.ErrInvalidTTLUpdate)
+
+		_, err = testClient.Keys().DeleteByPrefix(ctx, "ttl:", cache.DeleteOptions{})
+		require.NoError(t, err)
+	})
+
+	// --- 命名过期策略测试 ---
+	t.Run("TTLPolicy", func(t *testing.T) {
+		ttl, err := testClient.TTLPolicy(cache.TTLShort)
+		require.NoError(t, err)
+		assert.Equal(t, 5*time.Minute, ttl)
+
+		ttl, err = testClient.TTLPolicy(cache.TTLLong)
+		require.NoError(t, err)
+		assert.Equal(t, 24*time.Hour, ttl)
+
+		_, err = testClient.TTLPolicy("not-exist")
+		assert.ErrorIs(t, err, cache.ErrUnknownTTLPolicy)
+	})
+
+	// --- 过期策略配置校验 ---
+	t.Run("TTLConfigValidate", func(t *testing.T) {
+		cfg := cache.GetDefaultConfig("development")
+		cfg.TTLJitter = 0.2
+		cfg.TTLPolicies = map[string]time.Duration{cache.TTLShort: time.Minute}
+		assert.NoError(t, cfg.Validate())
+
+		cfg.TTLJitter = 1
+		assert.Error(t, cfg.Validate())
+
+		cfg.TTLJitter = 0.2
+		cfg.TTLPolicies["broken"] = 0
+		assert.Error(t, cfg.Validate())
+	})
+
 	// --- GetDefaultConfig 函数测试 ---
 	t.Run("GetDefaultConfig", func(t *testing.T) {
 		// 测试开发环境配置
@@ -347,6 +563,7 @@ func TestCacheIntegration(t *testing.T) {
 		assert.Equal(t, "redis:6379", prodConfig.Addr)
 		assert.Equal(t, 100, prodConfig.PoolSize)
 		assert.Equal(t, "gochat:", prodConfig.KeyPrefix)
+		assert.Zero(t, prodConfig.TTLJitter, "TTLJitter must be opted into explicitly")
 
 		// 测试未知环境（默认为开发环境）
 		unknownConfig := cache.GetDefaultConfig("unknown")
@@ -354,3 +571,490 @@ func TestCacheIntegration(t *testing.T) {
 		assert.Equal(t, devConfig.PoolSize, unknownConfig.PoolSize)
 	})
 }
+
+// TestCacheBinding 测试缓存与数据源的绑定
+func TestCacheBinding(t *testing.T) {
+	type user struct {
+		Name string `json:"name"`
+	}
+
+	store := map[string]user{"1": {Name: "alice"}}
+	loads := 0
+	loader := func(ctx context.Context, id string) (user, error) {
+		loads++
+		u, ok := store[id]
+		if !ok {
+			return user{}, cache.ErrNotFound
+		}
+		return u, nil
+	}
+	writer := func(ctx context.Context, id string, u user) error {
+		store[id] = u
+		return nil
+	}
+
+	binding, err := cache.NewBinding(testClient, cache.BindingConfig{
+		Namespace:   "binding:user",
+		TTL:         time.Minute,
+		NegativeTTL: time.Minute,
+	}, loader, cache.WithWriter(writer))
+	require.NoError(t, err)
+
+	// 首次读取从数据源加载，再次读取命中缓存
+	u, err := binding.Get(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", u.Name)
+	_, err = binding.Get(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, loads)
+
+	// 不存在的记录写入负缓存
+	_, err = binding.Get(ctx, "404")
+	assert.ErrorIs(t, err, cache.ErrNotFound)
+	_, err = binding.Get(ctx, "404")
+	assert.ErrorIs(t, err, cache.ErrNotFound)
+	assert.Equal(t, 2, loads)
+
+	// 写入后缓存失效，下次读取重新加载
+	require.NoError(t, binding.Set(ctx, "1", user{Name: "bob"}))
+	u, err = binding.Get(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, "bob", u.Name)
+	assert.Equal(t, 3, loads)
+
+	// 配置校验
+	_, err = cache.NewBinding(testClient, cache.BindingConfig{Namespace: "binding:bad"}, loader)
+	assert.Error(t, err)
+	_, err = cache.NewBinding(testClient, cache.BindingConfig{Namespace: "binding:bad", TTL: time.Minute, WritePolicy: "write_behind"}, loader)
+	assert.Error(t, err)
+}
+
+func TestCounter(t *testing.T) {
+	require.NoError(t, testClient.String().Del(ctx, "counter:unread:a", "counter:unread:b"))
+
+	// 阈值和周期足够大，确保测试期间不会自动刷新
+	counter, err := cache.NewCounter(testClient, cache.CounterConfig{
+		Namespace:      "counter:unread",
+		FlushInterval:  time.Hour,
+		FlushThreshold: 1000,
+		TTL:            time.Minute,
+	})
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, counter.Incr("a"))
+	}
+	require.NoError(t, counter.Add("b", 5))
+
+	// 刷新前读取合并本地缓冲，Redis 中尚无数据
+	val, err := counter.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), val)
+	_, err = testClient.String().Get(ctx, "counter:unread:a")
+	assert.ErrorIs(t, err, cache.ErrCacheMiss)
+
+	// 刷新后每个键只写入一次
+	require.NoError(t, counter.Flush(ctx))
+	raw, err := testClient.String().Get(ctx, "counter:unread:a")
+	require.NoError(t, err)
+	assert.Equal(t, "10", raw)
+	stats := counter.Stats()
+	assert.Equal(t, int64(11), stats.Adds)
+	assert.Equal(t, int64(2), stats.FlushedKeys)
+	assert.Equal(t, 0, stats.PendingKeys)
+
+	require.NoError(t, counter.Add("b", -2))
+	val, err = counter.Get(ctx, "b")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), val)
+
+	require.NoError(t, counter.Reset(ctx, "b"))
+	val, err = counter.Get(ctx, "b")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), val)
+
+	// 关闭时刷新剩余增量，之后拒绝新的增量
+	require.NoError(t, counter.Incr("a"))
+	require.NoError(t, counter.Close(ctx))
+	raw, err = testClient.String().Get(ctx, "counter:unread:a")
+	require.NoError(t, err)
+	assert.Equal(t, "11", raw)
+	assert.ErrorIs(t, counter.Incr("a"), cache.ErrCounterClosed)
+
+	_, err = cache.NewCounter(testClient, cache.CounterConfig{})
+	assert.Error(t, err)
+}
+
+func TestCounterPartialFlush(t *testing.T) {
+	require.NoError(t, testClient.String().Del(ctx, "counter:partial:ok"))
+	require.NoError(t, testClient.String().Set(ctx, "counter:partial:bad", "not-a-number", time.Minute))
+
+	counter, err := cache.NewCounter(testClient, cache.CounterConfig{
+		Namespace:      "counter:partial",
+		FlushInterval:  time.Hour,
+		FlushThreshold: 1000,
+	})
+	require.NoError(t, err)
+	defer counter.Close(ctx)
+
+	// 一个键的命令错误不影响其他键，失败的键直接丢弃而不是重复写入
+	require.NoError(t, counter.Add("ok", 3))
+	require.NoError(t, counter.Add("bad", 1))
+	err = counter.Flush(ctx)
+	var batchErr *cache.BatchError
+	require.ErrorAs(t, err, &batchErr)
+	assert.Len(t, batchErr.Failed, 1)
+	assert.Contains(t, batchErr.Failed, "counter:partial:bad")
+
+	stats := counter.Stats()
+	assert.Equal(t, int64(1), stats.DroppedKeys)
+	assert.Equal(t, 0, stats.PendingKeys)
+	require.NoError(t, counter.Flush(ctx))
+	raw, err := testClient.String().Get(ctx, "counter:partial:ok")
+	require.NoError(t, err)
+	assert.Equal(t, "3", raw)
+}
+
+func TestWarmer(t *testing.T) {
+	keys := []string{"warm:g1", "warm:g2", "warm:g3"}
+	require.NoError(t, testClient.String().Del(ctx, keys...))
+	_, err := testClient.Keys().DeleteByPrefix(ctx, "warmer_test:", cache.DeleteOptions{})
+	require.NoError(t, err)
+
+	var limited int
+	newWarmer := func() *cache.Warmer {
+		w, err := cache.NewWarmer(testClient, cache.WarmerConfig{Namespace: "warmer_test", Ranges: 2},
+			cache.WithWarmRateLimit(func(ctx context.Context, key string) (bool, error) {
+				// 每个键第一次申请时被拒绝
+				limited++
+				return limited%2 == 0, nil
+			}))
+		require.NoError(t, err)
+		require.NoError(t, w.Register(cache.WarmTask{
+			Pattern: "warm:*",
+			Keys: func(ctx context.Context) ([]string, error) {
+				return keys, nil
+			},
+			Load: func(ctx context.Context, key string) error {
+				return testClient.String().Set(ctx, key, "loaded", time.Minute)
+			},
+			MinInterval: time.Minute,
+		}))
+		return w
+	}
+
+	warmer := newWarmer()
+	require.NoError(t, warmer.WarmNow(ctx, "warm:*"))
+	for _, key := range keys {
+		val, err := testClient.String().Get(ctx, key)
+		require.NoError(t, err)
+		assert.Equal(t, "loaded", val)
+	}
+	stats := warmer.Stats()
+	assert.Equal(t, int64(3), stats.KeysLoaded)
+	assert.Equal(t, int64(3), stats.Throttled)
+	assert.ErrorIs(t, warmer.WarmNow(ctx, "unknown"), cache.ErrWarmTaskNotFound)
+
+	// 另一个实例在 MinInterval 内跳过已预热的分段
+	other := newWarmer()
+	require.NoError(t, other.Start(ctx))
+	other.Close()
+	stats = other.Stats()
+	assert.Equal(t, int64(0), stats.KeysLoaded)
+	assert.Equal(t, int64(0), stats.Runs)
+	assert.Positive(t, stats.RangesSkipped)
+	assert.ErrorIs(t, other.Register(cache.WarmTask{Pattern: "late"}), cache.ErrWarmerStarted)
+}
+
+func TestPubSub(t *testing.T) {
+	type event struct {
+		UserID string `json:"user_id"`
+		Online bool   `json:"online"`
+	}
+
+	presence, err := cache.NewChannel[event](testClient, "pubsub:presence")
+	require.NoError(t, err)
+
+	received := make(chan event, 4)
+	sub, err := presence.Subscribe(ctx, func(ctx context.Context, e event) error {
+		received <- e
+		return nil
+	})
+	require.NoError(t, err)
+
+	// 同一频道的第二个回调复用订阅
+	second := make(chan event, 4)
+	sub2, err := presence.Subscribe(ctx, func(ctx context.Context, e event) error {
+		second <- e
+		return nil
+	})
+	require.NoError(t, err)
+
+	receivers, err := presence.Publish(ctx, event{UserID: "u1", Online: true})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), receivers)
+
+	for _, ch := range []chan event{received, second} {
+		select {
+		case e := <-ch:
+			assert.Equal(t, event{UserID: "u1", Online: true}, e)
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for message")
+		}
+	}
+
+	// 无法解码的消息计为回调失败
+	_, err = testClient.PubSub().Publish(ctx, "pubsub:presence", "not json")
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return testClient.PubSub().Stats().HandlerErrors >= 2
+	}, 2*time.Second, 20*time.Millisecond)
+
+	stats := testClient.PubSub().Stats()
+	assert.Equal(t, 2, stats.Handlers)
+	assert.GreaterOrEqual(t, stats.Delivered, int64(2))
+
+	// 所有回调注销后取消订阅
+	require.NoError(t, sub.Close())
+	require.NoError(t, sub2.Close())
+	receivers, err = presence.Publish(ctx, event{UserID: "u1"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), receivers)
+
+	_, err = cache.NewChannel[event](testClient, "")
+	assert.Error(t, err)
+}
+
+func TestSessionStore(t *testing.T) {
+	// 会话脚本不叠加 KeyPrefix，命名空间带上测试前缀以便 cleanup 清理
+	sessions, err := cache.NewSessionStore(testClient, cache.SessionConfig{
+		Namespace:  "gochat_test:session",
+		TTL:        time.Minute,
+		MaxDevices: 2,
+	})
+	require.NoError(t, err)
+	_, err = sessions.InvalidateUser(ctx, "1001")
+	require.NoError(t, err)
+
+	ios, removed, err := sessions.Create(ctx, cache.SessionSpec{
+		UserID: "1001", DeviceID: "ios", GatewayID: "gw-1",
+		Metadata: map[string]string{"version": "1.2.0"},
+	})
+	require.NoError(t, err)
+	assert.Empty(t, removed)
+
+	got, err := sessions.Get(ctx, "1001", "ios")
+	require.NoError(t, err)
+	assert.Equal(t, ios.ID, got.ID)
+	assert.Equal(t, "gw-1", got.GatewayID)
+	assert.Equal(t, "1.2.0", got.Metadata["version"])
+
+	// 同一设备重新登录替换旧会话，旧会话无法续期
+	iosNew, removed, err := sessions.Create(ctx, cache.SessionSpec{UserID: "1001", DeviceID: "ios", GatewayID: "gw-2"})
+	require.NoError(t, err)
+	require.Len(t, removed, 1)
+	assert.Equal(t, ios.ID, removed[0].ID)
+	ok, err := sessions.Touch(ctx, ios)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = sessions.Invalidate(ctx, ios)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// 续期后过期时间推后，成为最后被踢出的设备
+	time.Sleep(10 * time.Millisecond)
+	_, _, err = sessions.Create(ctx, cache.SessionSpec{UserID: "1001", DeviceID: "web", GatewayID: "gw-1"})
+	require.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+	ok, err = sessions.Touch(ctx, iosNew)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// 超过 MaxDevices 时踢出最久未活跃的设备
+	_, removed, err = sessions.Create(ctx, cache.SessionSpec{UserID: "1001", DeviceID: "android", GatewayID: "gw-2"})
+	require.NoError(t, err)
+	require.Len(t, removed, 1)
+	assert.Equal(t, "web", removed[0].DeviceID)
+
+	all, err := sessions.ListByUser(ctx, "1001")
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+	assert.Equal(t, "ios", all[0].DeviceID)
+	assert.Equal(t, "android", all[1].DeviceID)
+
+	// 网关宕机只清理仍由其持有的会话
+	removed, err = sessions.InvalidateGateway(ctx, "gw-2")
+	require.NoError(t, err)
+	assert.Len(t, removed, 2)
+	_, err = sessions.Get(ctx, "1001", "ios")
+	assert.ErrorIs(t, err, cache.ErrSessionNotFound)
+
+	_, _, err = sessions.Create(ctx, cache.SessionSpec{UserID: "bad:id", DeviceID: "ios", GatewayID: "gw-1"})
+	assert.Error(t, err)
+	_, err = cache.NewSessionStore(testClient, cache.SessionConfig{})
+	assert.Error(t, err)
+}
+
+func TestLeaderboard(t *testing.T) {
+	// 排行榜脚本不叠加 KeyPrefix，命名空间带上测试前缀以便 cleanup 清理
+	lb, err := cache.NewLeaderboard(testClient, cache.LeaderboardConfig{
+		Namespace:    "gochat_test:leaderboard",
+		Periods:      []cache.LeaderboardPeriod{cache.LeaderboardDaily, cache.LeaderboardAllTime},
+		MaxSize:      3,
+		TrimInterval: time.Hour,
+	})
+	require.NoError(t, err)
+	defer lb.Close()
+
+	board := fmt.Sprintf("group:%d", time.Now().UnixNano())
+	for _, m := range []string{"a", "b", "c", "d"} {
+		_, err := lb.AddScore(ctx, board, m, 10)
+		require.NoError(t, err)
+		time.Sleep(2 * time.Millisecond)
+	}
+	scores, err := lb.AddScore(ctx, board, "b", 5)
+	require.NoError(t, err)
+	assert.Equal(t, 15.0, scores[cache.LeaderboardDaily])
+	assert.Equal(t, 15.0, scores[cache.LeaderboardAllTime])
+
+	// 同分时先达到该分数的成员排在前面
+	all := lb.Board(board, cache.LeaderboardAllTime)
+	top, err := all.Range(ctx, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, top, 4)
+	assert.Equal(t, []string{"b", "a", "c", "d"}, []string{top[0].Member, top[1].Member, top[2].Member, top[3].Member})
+	assert.Equal(t, int64(4), top[3].Rank)
+
+	// c 追平 b，但比 b 晚达到 15 分
+	_, err = lb.AddScore(ctx, board, "c", 5)
+	require.NoError(t, err)
+	rank, err := all.Rank(ctx, "c")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), rank.Rank)
+	assert.Equal(t, 15.0, rank.Score)
+
+	around, err := all.Around(ctx, "a", 1)
+	require.NoError(t, err)
+	require.Len(t, around, 3)
+	assert.Equal(t, []string{"c", "a", "d"}, []string{around[0].Member, around[1].Member, around[2].Member})
+
+	page, err := all.Range(ctx, 2, 2)
+	require.NoError(t, err)
+	require.Len(t, page, 2)
+	assert.Equal(t, int64(3), page[0].Rank)
+
+	// 裁剪掉最后一名
+	require.NoError(t, lb.Trim(ctx))
+	count, err := all.Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), count)
+	_, err = all.Rank(ctx, "d")
+	assert.ErrorIs(t, err, cache.ErrMemberNotRanked)
+
+	require.NoError(t, lb.Remove(ctx, board, "b"))
+	_, err = lb.Board(board, cache.LeaderboardDaily).Rank(ctx, "b")
+	assert.ErrorIs(t, err, cache.ErrMemberNotRanked)
+
+	// 昨天的日榜不受影响
+	count, err = lb.BoardAt(board, cache.LeaderboardDaily, time.Now().AddDate(0, 0, -1)).Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), count)
+
+	_, err = lb.AddScore(ctx, "bad{board}", "a", 1)
+	assert.Error(t, err)
+	_, err = cache.NewLeaderboard(testClient, cache.LeaderboardConfig{Namespace: "x", Periods: []cache.LeaderboardPeriod{"yearly"}})
+	assert.Error(t, err)
+}
+
+func TestCacheHealth(t *testing.T) {
+	require.NoError(t, testClient.Ping(ctx))
+
+	stats := testClient.Stats()
+	assert.True(t, stats.Healthy)
+	assert.GreaterOrEqual(t, stats.Dials, uint64(1))
+	assert.GreaterOrEqual(t, stats.TotalConns, uint32(1))
+
+	// 看门狗的 Ping 超时必须小于检查间隔
+	cfg := cache.GetDefaultConfig("development")
+	cfg.Health = &cache.HealthConfig{WatchdogInterval: time.Second, PingTimeout: 2 * time.Second}
+	assert.Error(t, cfg.Validate())
+	cfg.Health.PingTimeout = 500 * time.Millisecond
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestShardedCache(t *testing.T) {
+	redisAddr := os.Getenv("REDIS_ADDR")
+	if redisAddr == "" {
+		redisAddr = "localhost:6379"
+	}
+
+	// 用同一个 Redis 的不同 DB 模拟多个实例
+	base := cache.GetDefaultConfig("development")
+	base.KeyPrefix = "gochat_shard_test"
+	cfg := &cache.ShardedConfig{
+		Base: *base,
+		Shards: []cache.ShardConfig{
+			{Name: "s1", Addr: redisAddr, DB: 1},
+			{Name: "s2", Addr: redisAddr, DB: 2},
+		},
+	}
+	assert.Error(t, (&cache.ShardedConfig{Base: *base}).Validate())
+	assert.Error(t, (&cache.ShardedConfig{Base: *base, Shards: cfg.Shards, LockShard: "s9"}).Validate())
+
+	provider, err := cache.NewSharded(ctx, cfg)
+	require.NoError(t, err)
+	defer provider.Close()
+	defer provider.Keys().DeleteByPattern(ctx, "*", cache.DeleteOptions{})
+
+	// 键分布到两个分片，hash tag 相同的键落在同一分片
+	used := make(map[string]int)
+	for i := 0; i < 200; i++ {
+		key := fmt.Sprintf("user:%d", i)
+		used[provider.ShardFor(key)]++
+		require.NoError(t, provider.String().Set(ctx, key, i, time.Minute))
+	}
+	assert.Len(t, used, 2)
+	assert.Equal(t, provider.ShardFor("{conv_42}:members"), provider.ShardFor("{conv_42}:messages"))
+
+	n, err := provider.String().Exists(ctx, "user:1", "user:2", "user:3")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+
+	// 加入分片后部分键路由到新分片，Rebalance 后仍能读到
+	require.NoError(t, provider.AddShard(ctx, cache.ShardConfig{Name: "s3", Addr: redisAddr, DB: 3}))
+	moved, err := provider.Rebalance(ctx, cache.RebalanceOptions{})
+	require.NoError(t, err)
+	assert.Greater(t, moved, int64(0))
+	for i := 0; i < 200; i++ {
+		val, err := provider.String().Get(ctx, fmt.Sprintf("user:%d", i))
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprint(i), val)
+	}
+
+	// 移除分片时迁移其上的键
+	require.NoError(t, provider.RemoveShard(ctx, "s2"))
+	assert.Len(t, provider.Shards(), 2)
+	val, err := provider.String().Get(ctx, "user:7")
+	require.NoError(t, err)
+	assert.Equal(t, "7", val)
+
+	// 锁固定在 LockShard，不能移除
+	lock, ok, err := provider.Lock().TryLock(ctx, "job", time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.NoError(t, lock.Unlock(ctx))
+	assert.Error(t, provider.RemoveShard(ctx, "s1"))
+
+	// 跨分片的脚本调用
+	sha, err := provider.Script().ScriptLoad(ctx, "return 1")
+	require.NoError(t, err)
+	var keys []string
+	for i := 0; len(keys) < 2; i++ {
+		key := fmt.Sprintf("k%d", i)
+		if len(keys) == 0 || provider.ShardFor(key) != provider.ShardFor(keys[0]) {
+			keys = append(keys, key)
+		}
+	}
+	_, err = provider.Script().EvalSha(ctx, sha, keys)
+	assert.ErrorIs(t, err, cache.ErrCrossShard)
+}
@@ -54,6 +54,16 @@ type Config struct {
 
 	// KeyPrefix 键名前缀，用于命名空间隔离
 	KeyPrefix string `json:"keyPrefix" yaml:"keyPrefix"`
+
+	// TTLJitter 过期时间随机抖动比例，取值范围 [0, 1)。
+	// 例如 0.1 表示在 Set 时将过期时间在 ±10% 范围内随机调整，0 表示禁用。
+	TTLJitter float64 `json:"ttlJitter" yaml:"ttlJitter"`
+
+	// TTLPolicies 命名过期策略，用于集中覆盖内置的 short/medium/long 策略或新增自定义策略
+	TTLPolicies map[string]time.Duration `json:"ttlPolicies" yaml:"ttlPolicies"`
+
+	// Health 连接健康监控配置，为 nil 时不启动看门狗，但仍统计拨号和命令超时
+	Health *HealthConfig `json:"health" yaml:"health"`
 }
 
 // Validate 验证配置的有效性
@@ -114,5 +124,29 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("max retry backoff (%v) cannot be less than min retry backoff (%v)", c.MaxRetryBackoff, c.MinRetryBackoff)
 	}
 
+	// 验证过期策略配置
+	if c.TTLJitter < 0 || c.TTLJitter >= 1 {
+		return fmt.Errorf("ttl jitter must be in range [0, 1), got: %v", c.TTLJitter)
+	}
+
+	for name, ttl := range c.TTLPolicies {
+		if ttl <= 0 {
+			return fmt.Errorf("ttl policy %q must be positive, got: %v", name, ttl)
+		}
+	}
+
+	// 验证健康监控配置
+	if h := c.Health; h != nil {
+		if h.WatchdogInterval < 0 || h.PingTimeout < 0 {
+			return fmt.Errorf("health watchdog interval and ping timeout cannot be negative")
+		}
+		if h.FailureThreshold < 0 {
+			return fmt.Errorf("health failure threshold cannot be negative, got: %d", h.FailureThreshold)
+		}
+		if h.WatchdogInterval > 0 && h.PingTimeout >= h.WatchdogInterval {
+			return fmt.Errorf("health ping timeout (%v) must be less than watchdog interval (%v)", h.PingTimeout, h.WatchdogInterval)
+		}
+	}
+
 	return nil
 }
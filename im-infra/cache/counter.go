@@ -0,0 +1,321 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/cache/internal"
+	"github.com/ceyewan/gochat/im-infra/clog"
+)
+
+// ErrCounterClosed 表示计数器已关闭，不再接受新的增量
+var ErrCounterClosed = errors.New("cache: counter is closed")
+
+// counterFlushTimeout 后台刷新单次写入 Redis 的超时时间
+const counterFlushTimeout = 5 * time.Second
+
+// CounterConfig 定义了 Counter 的本地聚合策略
+type CounterConfig struct {
+	// Namespace 计数器键的命名空间，最终键为 "{Namespace}:{key}"（仍会叠加 Config.KeyPrefix）
+	Namespace string `json:"namespace" yaml:"namespace"`
+
+	// FlushInterval 本地缓冲刷新到 Redis 的周期，默认 100ms。
+	// 也是其他实例读取时可能看不到本实例增量的最长时间。
+	FlushInterval time.Duration `json:"flushInterval" yaml:"flushInterval"`
+
+	// FlushThreshold 缓冲的增量次数达到该值时立即刷新，不等待 FlushInterval，默认 1000
+	FlushThreshold int `json:"flushThreshold" yaml:"flushThreshold"`
+
+	// TTL 每次刷新时为写入的键重置的过期时间，0 表示不过期
+	TTL time.Duration `json:"ttl" yaml:"ttl"`
+}
+
+// Validate 验证计数器配置的有效性
+func (c *CounterConfig) Validate() error {
+	if c.Namespace == "" {
+		return fmt.Errorf("counter namespace cannot be empty")
+	}
+	if c.FlushInterval < 0 {
+		return fmt.Errorf("counter flush interval cannot be negative, got: %v", c.FlushInterval)
+	}
+	if c.FlushThreshold < 0 {
+		return fmt.Errorf("counter flush threshold cannot be negative, got: %d", c.FlushThreshold)
+	}
+	if c.TTL < 0 {
+		return fmt.Errorf("counter ttl cannot be negative, got: %v", c.TTL)
+	}
+	return nil
+}
+
+// CounterStats 计数器的累计统计，Adds 与 FlushedKeys 之比即 Redis 写入的削减倍数
+type CounterStats struct {
+	Adds        int64 // 调用 Add/Incr 的次数
+	Flushes     int64 // 成功刷新的次数
+	FlushedKeys int64 // 刷新时写入 Redis 的键数（即 INCRBY 命令数）
+	FlushErrors int64 // 刷新失败的次数，失败的增量会合并回缓冲等待下次刷新
+	DroppedKeys int64 // 因命令错误（如键类型不是整数）被丢弃、不再重试的键数
+	PendingKeys int   // 当前缓冲中尚未刷新的键数
+}
+
+// Counter 是在本地聚合增量、批量写入 Redis 的分布式计数器，适用于未读数等高频递增的场景。
+//   - Add/Incr：只修改本实例的内存缓冲，不访问 Redis
+//   - 后台每隔 FlushInterval 或缓冲的增量次数达到 FlushThreshold 时，通过一次 pipeline 将所有键的增量 INCRBY 到 Redis
+//   - Get：读取 Redis 中的值并合并本实例尚未刷新的增量
+//
+// 其他实例缓冲中的增量在其刷新前不可见，因此跨实例读取最多滞后 FlushInterval；
+// 实例异常退出时未刷新的增量会丢失，正常退出前应调用 Close。
+type Counter struct {
+	provider Provider
+	config   CounterConfig
+	logger   clog.Logger
+
+	// flushMu 保证 Get 与刷新互斥：刷新期间增量已从缓冲取出但可能尚未写入 Redis，
+	// 此时读取会漏算或重复计算这部分增量
+	flushMu sync.RWMutex
+
+	mu          sync.Mutex
+	pending     map[string]int64
+	pendingAdds int
+	closed      bool
+
+	trigger   chan struct{}
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+
+	adds        atomic.Int64
+	flushes     atomic.Int64
+	flushedKeys atomic.Int64
+	flushErrors atomic.Int64
+	droppedKeys atomic.Int64
+}
+
+// NewCounter 创建一个本地聚合的计数器并启动后台刷新。
+//
+// 示例：
+//
+//	unread, err := cache.NewCounter(provider, cache.CounterConfig{
+//	    Namespace:     "unread",
+//	    FlushInterval: 100 * time.Millisecond,
+//	    TTL:           7 * 24 * time.Hour,
+//	})
+//	defer unread.Close(ctx)
+//
+//	_ = unread.Incr("1001:conv_42")
+//	count, err := unread.Get(ctx, "1001:conv_42")
+func NewCounter(provider Provider, cfg CounterConfig) (*Counter, error) {
+	if provider == nil {
+		return nil, fmt.Errorf("cache provider cannot be nil")
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.FlushInterval == 0 {
+		cfg.FlushInterval = 100 * time.Millisecond
+	}
+	if cfg.FlushThreshold == 0 {
+		cfg.FlushThreshold = 1000
+	}
+
+	c := &Counter{
+		provider: provider,
+		config:   cfg,
+		logger:   clog.Namespace("cache.counter").With(clog.String("counter", cfg.Namespace)),
+		pending:  make(map[string]int64),
+		trigger:  make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go c.loop()
+	return c, nil
+}
+
+// Incr 将计数器加 1，等价于 Add(key, 1)
+func (c *Counter) Incr(key string) error {
+	return c.Add(key, 1)
+}
+
+// Add 将 delta 累加到本地缓冲，delta 可以为负数。计数器关闭后返回 ErrCounterClosed。
+func (c *Counter) Add(key string, delta int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return ErrCounterClosed
+	}
+	c.adds.Add(1)
+	if delta == 0 {
+		return nil
+	}
+	c.pending[key] += delta
+	c.pendingAdds++
+	if c.pendingAdds >= c.config.FlushThreshold {
+		select {
+		case c.trigger <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Get 返回 Redis 中的值与本实例尚未刷新的增量之和，键不存在时视为 0
+func (c *Counter) Get(ctx context.Context, key string) (int64, error) {
+	c.flushMu.RLock()
+	defer c.flushMu.RUnlock()
+
+	var value int64
+	raw, err := c.provider.String().Get(ctx, c.key(key))
+	switch {
+	case err == nil:
+		value, err = strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("counter %s: value of %s is not an integer: %w", c.config.Namespace, key, err)
+		}
+	case errors.Is(err, ErrCacheMiss):
+	default:
+		return 0, err
+	}
+
+	c.mu.Lock()
+	value += c.pending[key]
+	c.mu.Unlock()
+	return value, nil
+}
+
+// Reset 丢弃本实例缓冲中该键的增量并删除 Redis 中的值，例如用户已读后清零未读数。
+// 其他实例缓冲中的增量不受影响，会在其下次刷新时重新累加。
+func (c *Counter) Reset(ctx context.Context, key string) error {
+	c.flushMu.Lock()
+	defer c.flushMu.Unlock()
+
+	c.mu.Lock()
+	delete(c.pending, key)
+	c.mu.Unlock()
+	return c.provider.String().Del(ctx, c.key(key))
+}
+
+// Flush 立即将本地缓冲写入 Redis，失败时增量合并回缓冲等待下次刷新
+func (c *Counter) Flush(ctx context.Context) error {
+	c.flushMu.Lock()
+	defer c.flushMu.Unlock()
+
+	c.mu.Lock()
+	pending := c.pending
+	c.pending = make(map[string]int64, len(pending))
+	c.pendingAdds = 0
+	c.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	deltas := make(map[string]int64, len(pending))
+	keys := make(map[string]string, len(pending))
+	for key, delta := range pending {
+		if delta != 0 {
+			deltas[c.key(key)] = delta
+			keys[c.key(key)] = key
+		}
+	}
+	err := c.provider.String().IncrByBatch(ctx, deltas, c.config.TTL)
+	if err == nil {
+		c.flushes.Add(1)
+		c.flushedKeys.Add(int64(len(deltas)))
+		return nil
+	}
+	c.flushErrors.Add(1)
+
+	// pipeline 中各键独立执行，只有失败的键需要处理，已成功的键重试会被重复计数。
+	// 命令错误重试同样会失败，直接丢弃；网络错误时命令可能已执行，重新合并回缓冲，
+	// 因此增量至少写入一次，极端情况下（已执行但未收到回复）会重复计数。
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		batchErr = &BatchError{Failed: make(map[string]error, len(deltas))}
+		for redisKey := range deltas {
+			batchErr.Failed[redisKey] = err
+		}
+	}
+	var dropped int64
+	c.mu.Lock()
+	for redisKey, keyErr := range batchErr.Failed {
+		key, ok := keys[redisKey]
+		if !ok {
+			continue
+		}
+		if internal.IsCommandError(keyErr) {
+			dropped++
+			c.logger.Error("计数器键写入失败，丢弃增量",
+				clog.String("key", key),
+				clog.Int64("delta", deltas[redisKey]),
+				clog.Err(keyErr))
+			continue
+		}
+		c.pending[key] += deltas[redisKey]
+		c.pendingAdds++
+	}
+	c.mu.Unlock()
+	c.droppedKeys.Add(dropped)
+	c.flushedKeys.Add(int64(len(deltas) - len(batchErr.Failed)))
+	return fmt.Errorf("counter %s: flush %d of %d keys failed: %w", c.config.Namespace, len(batchErr.Failed), len(deltas), err)
+}
+
+// Stats 返回计数器的累计统计
+func (c *Counter) Stats() CounterStats {
+	c.mu.Lock()
+	pendingKeys := len(c.pending)
+	c.mu.Unlock()
+
+	return CounterStats{
+		Adds:        c.adds.Load(),
+		Flushes:     c.flushes.Load(),
+		FlushedKeys: c.flushedKeys.Load(),
+		FlushErrors: c.flushErrors.Load(),
+		DroppedKeys: c.droppedKeys.Load(),
+		PendingKeys: pendingKeys,
+	}
+}
+
+// Close 停止后台刷新并将剩余的增量写入 Redis，之后的 Add 返回 ErrCounterClosed
+func (c *Counter) Close(ctx context.Context) error {
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		c.closed = true
+		c.mu.Unlock()
+		close(c.stop)
+	})
+	<-c.done
+	return c.Flush(ctx)
+}
+
+// loop 按 FlushInterval 周期或缓冲达到阈值时刷新
+func (c *Counter) loop() {
+	defer close(c.done)
+
+	ticker := time.NewTicker(c.config.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+		case <-c.trigger:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), counterFlushTimeout)
+		if err := c.Flush(ctx); err != nil {
+			c.logger.Warn("刷新计数器失败，增量保留在本地缓冲", clog.Int("pending_keys", c.Stats().PendingKeys), clog.Err(err))
+		}
+		cancel()
+	}
+}
+
+// key 返回计数器在缓存中的键
+func (c *Counter) key(key string) string {
+	return c.config.Namespace + ":" + key
+}
@@ -33,12 +33,12 @@ func main() {
 	// 协程 1: 获取锁并执行任务
 	go func() {
 		defer wg.Done()
-		lock, err := cacheClient.Lock().Acquire(ctx, lockKey, 10*time.Second)
+		lock, ok, err := cacheClient.Lock().TryLock(ctx, lockKey, 10*time.Second)
 		if err != nil {
 			log.Printf("协程 1: 获取锁失败: %v", err)
 			return
 		}
-		if lock == nil {
+		if !ok {
 			log.Printf("协程 1: 锁已被占用")
 			return
 		}
@@ -54,12 +54,12 @@ func main() {
 		defer wg.Done()
 		time.Sleep(500 * time.Millisecond) // 确保协程1先获取锁
 		log.Println("协程 2: 尝试获取锁...")
-		lock, err := cacheClient.Lock().Acquire(ctx, lockKey, 10*time.Second)
+		lock, ok, err := cacheClient.Lock().TryLock(ctx, lockKey, 10*time.Second)
 		if err != nil {
 			log.Printf("协程 2: 获取锁时发生错误: %v", err)
 			return
 		}
-		if lock == nil {
+		if !ok {
 			log.Println("协程 2: 获取锁失败，锁已被其他协程占用")
 		} else {
 			log.Println("协程 2: 意外地获取了锁！")
@@ -218,13 +218,13 @@ func demoLockOperations(ctx context.Context, client cache.Provider) {
 	lockKey := "demo:lock:resource"
 
 	// 获取锁
-	lock, err := lockOps.Acquire(ctx, lockKey, 10*time.Second)
+	lock, ok, err := lockOps.TryLock(ctx, lockKey, 10*time.Second)
 	if err != nil {
 		log.Printf("获取锁失败: %v", err)
 		return
 	}
 
-	if lock == nil {
+	if !ok {
 		log.Printf("锁已被占用")
 		return
 	}
@@ -243,17 +243,18 @@ func demoLockOperations(ctx context.Context, client cache.Provider) {
 
 	log.Printf("Lock - 锁已释放")
 
-	// 尝试再次获取锁
-	lock, err = lockOps.Acquire(ctx, lockKey, 5*time.Second)
+	// 阻塞等待获取锁，最多等待 3 秒
+	lock, err = lockOps.LockWithOptions(ctx, lockKey, 5*time.Second, cache.LockOptions{
+		RetryInterval: 100 * time.Millisecond,
+		MaxWait:       3 * time.Second,
+	})
 	if err != nil {
 		log.Printf("再次获取锁失败: %v", err)
 		return
 	}
 
-	if lock != nil {
-		log.Printf("Lock - 成功重新获取锁")
-		lock.Unlock(ctx)
-	}
+	log.Printf("Lock - 成功重新获取锁")
+	lock.Unlock(ctx)
 }
 
 func demoBloomOperations(ctx context.Context, client cache.Provider) {
@@ -11,6 +11,102 @@ import (
 // 所有 Get 操作在缓存未命中时，都应返回此错误。
 var ErrCacheMiss = internal.ErrCacheMiss
 
+// ErrUnknownTTLPolicy 表示请求的命名过期策略不存在。
+var ErrUnknownTTLPolicy = internal.ErrUnknownTTLPolicy
+
+// ErrLockNotAcquired 表示锁已被其他持有者占用，或在最长等待时间内未能获取锁。
+var ErrLockNotAcquired = internal.ErrLockNotAcquired
+
+// LockOptions 控制阻塞加锁的重试行为。
+type LockOptions = internal.LockOptions
+
+// ErrEmptyPattern 表示批量删除时传入了空的模式或前缀，防止误删整个键空间。
+var ErrEmptyPattern = internal.ErrEmptyPattern
+
+// BatchError 表示批量命令中部分键执行失败，Failed 中未列出的键已执行成功
+type BatchError = internal.BatchError
+
+// DeleteOptions 控制批量删除的批大小、限速、DryRun 和进度回调。
+type DeleteOptions = internal.DeleteOptions
+
+// DeleteProgress 批量删除的进度。
+type DeleteProgress = internal.DeleteProgress
+
+// NoExpiration 是 Keys().TTL 对未设置过期时间的键返回的值。
+const NoExpiration = internal.NoExpiration
+
+// ErrInvalidTTLUpdate 表示批量调整过期时间时 TTL、Extend、Persist 没有恰好设置一个。
+var ErrInvalidTTLUpdate = internal.ErrInvalidTTLUpdate
+
+// TTLUpdateOptions 控制批量调整过期时间的方式、批大小、限速、DryRun 和进度回调。
+type TTLUpdateOptions = internal.TTLUpdateOptions
+
+// TTLUpdateProgress 批量调整过期时间的进度。
+type TTLUpdateProgress = internal.TTLUpdateProgress
+
+// KeyIterator 逐个返回 SCAN 匹配到的键。
+type KeyIterator = internal.KeyIterator
+
+// 内置的命名过期策略，可通过 Config.TTLPolicies 集中覆盖。
+const (
+	TTLShort  = internal.TTLPolicyShort  // 默认 5 分钟
+	TTLMedium = internal.TTLPolicyMedium // 默认 1 小时
+	TTLLong   = internal.TTLPolicyLong   // 默认 24 小时
+)
+
+// HealthConfig 连接健康监控配置。
+type HealthConfig = internal.HealthConfig
+
+// HealthEvent 连接生命周期事件（连接中断、恢复、主从切换、命令超时）。
+type HealthEvent = internal.HealthEvent
+
+// HealthHandler 连接生命周期事件回调。
+type HealthHandler = internal.HealthHandler
+
+// PoolStats 连接池统计与健康状态。
+type PoolStats = internal.PoolStats
+
+// 连接生命周期事件类型。
+const (
+	EventConnectionLost   = internal.EventConnectionLost
+	EventReconnected      = internal.EventReconnected
+	EventFailoverDetected = internal.EventFailoverDetected
+	EventCommandTimeout   = internal.EventCommandTimeout
+)
+
+// KeyspaceHandler 键空间通知回调，key 为发生事件的键，event 为事件名，如 "expired"、"del"。
+type KeyspaceHandler = internal.KeyspaceHandler
+
+// KeyspaceSubscription 一个键空间通知订阅，Close 取消订阅并等待回调全部返回。
+type KeyspaceSubscription = internal.KeyspaceSubscription
+
+// KeyspaceNotifier 由支持 Redis 键空间通知的 Provider 实现（cache.New 返回的 Provider），
+// 分片 Provider 不支持。使用前通过类型断言判断：
+//
+//	notifier, ok := provider.(cache.KeyspaceNotifier)
+type KeyspaceNotifier interface {
+	// EnableKeyspaceNotifications 将 classes（如 "Kx" 表示键空间通知的过期事件）合并到 notify-keyspace-events 配置中。
+	// 托管 Redis 通常禁用 CONFIG 命令，此时返回错误，需要在控制台开启。
+	EnableKeyspaceNotifications(ctx context.Context, classes string) error
+	// SubscribeKeyspace 订阅键名匹配 glob 模式 pattern 的键空间通知。
+	// pattern 不叠加 Config.KeyPrefix；handler 在同一个 goroutine 中依次执行，不应阻塞。
+	// 通知基于 Pub/Sub，连接断开期间的事件会丢失。
+	SubscribeKeyspace(ctx context.Context, pattern string, handler KeyspaceHandler) (KeyspaceSubscription, error)
+	// SubscribeExpired 订阅键名匹配 pattern 的过期事件，需要先开启 "Kx"（见 EnableKeyspaceNotifications）。
+	// 与 KeyOperations 一致，pattern 相对于 Config.KeyPrefix，handler 收到的键已去除 KeyPrefix。
+	// Redis 在访问过期键或后台采样时才删除并发出事件，事件可能比过期时间晚数秒；DEL 等主动删除不会触发。
+	SubscribeExpired(ctx context.Context, pattern string, handler func(key string)) (KeyspaceSubscription, error)
+}
+
+// PubSubHandler 频道消息回调，channel 为不含 Config.KeyPrefix 的频道名。返回的错误只记录日志和计数，消息不会重新投递。
+type PubSubHandler = internal.PubSubHandler
+
+// PubSubSubscription 一个频道回调的注册，Close 注销回调，频道上没有其他回调时取消订阅。
+type PubSubSubscription = internal.PubSubSubscription
+
+// PubSubStats 发布订阅的投递统计。
+type PubSubStats = internal.PubSubStats
+
 // Provider 定义了 cache 组件提供的所有能力。
 type Provider interface {
 	String() StringOperations
@@ -20,6 +116,15 @@ type Provider interface {
 	Lock() LockOperations
 	Bloom() BloomFilterOperations
 	Script() ScriptingOperations
+	Keys() KeyOperations
+	PubSub() PubSubOperations
+
+	// TTLPolicy 返回指定名称的过期策略时长。策略不存在时返回 cache.ErrUnknownTTLPolicy。
+	// 返回的时长在 Set 时仍会按 Config.TTLJitter 施加随机抖动。
+	TTLPolicy(name string) (time.Duration, error)
+
+	// Stats 返回连接池统计（命中、等待超时、连接数）以及拨号、命令超时、重连、主从切换计数。
+	Stats() PoolStats
 
 	// Ping 检查与 Redis 服务器的连接。
 	Ping(ctx context.Context) error
@@ -31,14 +136,25 @@ type Provider interface {
 type StringOperations interface {
 	// Get 获取一个 key。如果 key 不存在，将返回 cache.ErrCacheMiss 错误。
 	Get(ctx context.Context, key string) (string, error)
-	// Set 存入一个 key-value 对。
+	// Set 存入一个 key-value 对。若配置了 TTLJitter，expiration 会被随机抖动。
 	// 注意：value (interface{}) 参数需要调用者自行序列化为字符串或字节数组。
 	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error
 	Del(ctx context.Context, keys ...string) error
 	Incr(ctx context.Context, key string) (int64, error)
 	Decr(ctx context.Context, key string) (int64, error)
+	// IncrWithMax 原子地将计数器增加 delta，结果不超过 max，返回调整后的值以及是否触及上限。
+	// 适用于群组席位、未读数封顶等需要避免 Get-then-Set 竞态的场景。键不存在时视为 0，
+	// 值发生变化时保留键原有的 TTL；值不变时不会创建不存在的键，新建的键没有过期时间。
+	IncrWithMax(ctx context.Context, key string, delta, max int64) (int64, bool, error)
+	// DecrWithMin 原子地将计数器减少 delta，结果不低于 min，返回调整后的值以及是否触及下限。
+	DecrWithMin(ctx context.Context, key string, delta, min int64) (int64, bool, error)
+	// IncrByBatch 通过一次 pipeline 将每个键增加对应的 delta，键不存在时视为 0。
+	// expiration 大于 0 时同时刷新这些键的过期时间（按 TTLJitter 抖动），适用于批量落盘本地聚合的计数。
+	// 各键独立执行，部分键失败时返回 *BatchError，其中未列出的键已成功写入，调用方只应重试失败的键。
+	IncrByBatch(ctx context.Context, deltas map[string]int64, expiration time.Duration) error
 	Exists(ctx context.Context, keys ...string) (int64, error)
 	// SetNX (Set if Not Exists) 存入一个 key-value 对，仅当 key 不存在时。
+	// SetNX 常用于锁和幂等标记，expiration 不受 TTLJitter 影响。
 	// 注意：value (interface{}) 参数需要调用者自行序列化。
 	SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error)
 	// GetSet 设置新值并返回旧值。如果 key 不存在，返回 cache.ErrCacheMiss。
@@ -100,8 +216,17 @@ type ZMember struct {
 
 // LockOperations 定义了分布式锁的操作。
 type LockOperations interface {
-	// Acquire 尝试获取一个锁。如果成功，返回一个 Locker 对象；否则返回错误。
+	// Acquire 尝试获取一个锁。如果成功，返回一个 Locker 对象；锁被占用时返回 nil 和 cache.ErrLockNotAcquired。
+	//
+	// Deprecated: 返回值无法直观区分"锁被占用"和"Redis 出错"，
+	// 请使用 TryLock（非阻塞）、Lock 或 LockWithOptions（阻塞重试）代替。
 	Acquire(ctx context.Context, key string, expiration time.Duration) (Locker, error)
+	// TryLock 尝试获取一个锁，不等待。锁被占用时返回 nil、false 和 nil 错误，只有 Redis 出错时才返回错误。
+	TryLock(ctx context.Context, key string, expiration time.Duration) (Locker, bool, error)
+	// Lock 阻塞获取一个锁，按指数退避重试直到成功或 ctx 结束（返回 ctx.Err()）。
+	Lock(ctx context.Context, key string, expiration time.Duration) (Locker, error)
+	// LockWithOptions 阻塞获取一个锁，按 opts 指定的重试间隔重试；超过 MaxWait 时返回 cache.ErrLockNotAcquired。
+	LockWithOptions(ctx context.Context, key string, expiration time.Duration, opts LockOptions) (Locker, error)
 }
 
 // Locker 定义了锁对象的接口。
@@ -119,6 +244,51 @@ type BloomFilterOperations interface {
 	BFReserve(ctx context.Context, key string, errorRate float64, capacity uint64) error
 }
 
+// KeyOperations 定义了键空间扫描、批量删除和过期时间管理操作，用于租户下线后清理命名空间、
+// 故障期间批量延长会话有效期等运维场景。
+// 所有操作都基于 SCAN 分批进行，不会使用阻塞 Redis 的 KEYS 命令。
+// pattern 和 prefix 都相对于 Config.KeyPrefix，返回的键也已去除 KeyPrefix。
+type KeyOperations interface {
+	// ScanKeys 返回匹配 pattern 的键迭代器，batch 为每次 SCAN 的 COUNT 提示值（<= 0 时默认 500）。
+	// 迭代期间新增或删除的键可能被返回也可能不被返回，同一个键也可能被返回多次。
+	ScanKeys(ctx context.Context, pattern string, batch int64) KeyIterator
+	// DeleteByPattern 分批扫描并使用 UNLINK 删除匹配 pattern 的键，返回删除的键数。
+	// 出错时返回已删除的键数和错误。pattern 为空时返回 cache.ErrEmptyPattern。
+	DeleteByPattern(ctx context.Context, pattern string, opts DeleteOptions) (int64, error)
+	// DeleteByPrefix 删除以 prefix 开头的所有键，prefix 中的 glob 特殊字符会被转义。
+	DeleteByPrefix(ctx context.Context, prefix string, opts DeleteOptions) (int64, error)
+
+	// TTL 返回键的剩余过期时间（毫秒精度），未设置过期时间时返回 cache.NoExpiration，键不存在时返回 cache.ErrCacheMiss。
+	TTL(ctx context.Context, key string) (time.Duration, error)
+	// Persist 移除键的过期时间，键不存在或本来就未设置过期时间时返回 false。
+	Persist(ctx context.Context, key string) (bool, error)
+	// ExpireAt 设置键在 at 时刻过期，at 已过去时键会被立即删除。键不存在时返回 false。
+	ExpireAt(ctx context.Context, key string, at time.Time) (bool, error)
+	// UpdateTTLByPattern 分批扫描匹配 pattern 的键并调整过期时间，返回过期时间被修改的键数。
+	// 按 opts 设置新的过期时间、在当前过期时间上延长或移除过期时间，可通过 RateLimit 限速、DryRun 预估影响范围。
+	// 出错时返回已修改的键数和错误。pattern 为空时返回 cache.ErrEmptyPattern，选项不合法时返回 cache.ErrInvalidTTLUpdate。
+	UpdateTTLByPattern(ctx context.Context, pattern string, opts TTLUpdateOptions) (int64, error)
+	// UpdateTTLByPrefix 调整以 prefix 开头的所有键的过期时间，prefix 中的 glob 特殊字符会被转义。
+	UpdateTTLByPrefix(ctx context.Context, prefix string, opts TTLUpdateOptions) (int64, error)
+}
+
+// PubSubOperations 定义了 Redis 频道的发布订阅操作，通常通过类型化的 cache.Channel 使用。
+// 所有频道复用一条订阅连接，连接断开后自动重新连接并重新订阅所有频道。
+// 频道名与键一样叠加 Config.KeyPrefix，不同环境共用一个 Redis 时互不干扰。
+type PubSubOperations interface {
+	// Publish 向频道发布一条消息，返回收到消息的订阅者数（跨实例统计的是订阅连接数）。
+	// 注意：message (interface{}) 参数需要调用者自行序列化。
+	Publish(ctx context.Context, channel string, message interface{}) (int64, error)
+	// Subscribe 为频道注册回调，同一频道可以注册多个回调。频道第一次被订阅时等待 Redis 确认后返回，
+	// 返回之后发布的消息不会遗漏。所有回调在同一个 goroutine 中依次执行，不应阻塞。
+	Subscribe(ctx context.Context, channel string, handler PubSubHandler) (PubSubSubscription, error)
+	// OnResubscribe 注册订阅连接断开后重新订阅成功的回调，参数为重新订阅的频道。
+	// Pub/Sub 不保存消息，断开期间发布的消息已经丢失，回调可用于从权威数据源补齐状态。
+	OnResubscribe(handler func(channels []string))
+	// Stats 返回发布、接收、投递、回调失败和重新订阅的计数。
+	Stats() PubSubStats
+}
+
 // ScriptingOperations 定义了与 Redis Lua 脚本相关的操作。
 type ScriptingOperations interface {
 	EvalSha(ctx context.Context, sha1 string, keys []string, args ...interface{}) (interface{}, error)
@@ -24,6 +24,10 @@ type client struct {
 	lockOps        *lockOperations
 	bloomOps       *bloomFilterOperations
 	scriptingOps   *scriptingOperations
+	keyOps         *keyOperations
+	pubsubOps      *pubsubOperations
+	ttl            *ttlManager
+	health         *healthMonitor
 }
 
 // Config 配置结构体（内部使用）
@@ -44,6 +48,10 @@ type Config struct {
 	MinRetryBackoff time.Duration
 	MaxRetryBackoff time.Duration
 	KeyPrefix       string
+	TTLJitter       float64
+	TTLPolicies     map[string]time.Duration
+	Health          *HealthConfig
+	HealthHandlers  []HealthHandler
 }
 
 // Client 定义内部客户端的接口
@@ -51,6 +59,16 @@ type Client interface {
 	Provider
 	Ping(ctx context.Context) error
 	Close() error
+	// TTLPolicy 返回指定名称的过期策略时长
+	TTLPolicy(name string) (time.Duration, error)
+	// Stats 返回连接池统计与健康状态
+	Stats() PoolStats
+	// EnableKeyspaceNotifications 开启指定类别的键空间通知
+	EnableKeyspaceNotifications(ctx context.Context, classes string) error
+	// SubscribeKeyspace 订阅键名匹配 pattern 的键空间通知
+	SubscribeKeyspace(ctx context.Context, pattern string, handler KeyspaceHandler) (KeyspaceSubscription, error)
+	// SubscribeExpired 订阅键名匹配 pattern（相对于 KeyPrefix）的过期事件
+	SubscribeExpired(ctx context.Context, pattern string, handler func(key string)) (KeyspaceSubscription, error)
 }
 
 // NewCache 根据提供的配置创建一个新的 Cache 实例。
@@ -75,8 +93,10 @@ func NewCache(ctx context.Context, cfg Config, logger clog.Logger) (Client, erro
 		MaxRetryBackoff: cfg.MaxRetryBackoff,
 	}
 
-	// 创建 Redis 客户端
+	// 健康监控的统计写入选项后再创建客户端
+	health := newHealthMonitor(redisOpts, cfg.Health, cfg.HealthHandlers, logger)
 	redisCache := redis.NewClient(redisOpts)
+	health.attach(redisCache)
 
 	// 测试连接
 	if err := redisCache.Ping(ctx).Err(); err != nil {
@@ -85,19 +105,26 @@ func NewCache(ctx context.Context, cfg Config, logger clog.Logger) (Client, erro
 		return nil, fmt.Errorf("redis connection failed: %w", err)
 	}
 
+	ttl := newTTLManager(cfg.TTLJitter, cfg.TTLPolicies)
+
 	// 创建客户端实例
 	c := &client{
 		redisClient:     redisCache,
 		logger:          logger,
 		config:          cfg,
-		stringOps:       newStringOperations(redisCache, logger, cfg.KeyPrefix),
+		stringOps:       newStringOperations(redisCache, logger, cfg.KeyPrefix, ttl),
 		hashOps:         newHashOperations(redisCache, logger, cfg.KeyPrefix),
 		setOps:          newSetOperations(redisCache, logger, cfg.KeyPrefix),
-		zsetOps:         newZSetOperations(redisCache, logger, cfg.KeyPrefix),
+		zsetOps:         newZSetOperations(redisCache, logger, cfg.KeyPrefix, ttl),
 		lockOps:         newLockOperations(redisCache, logger, cfg.KeyPrefix),
 		bloomOps:        newBloomFilterOperations(redisCache, logger, cfg.KeyPrefix),
 		scriptingOps:    newScriptingOperations(redisCache, logger),
+		keyOps:          newKeyOperations(redisCache, logger, cfg.KeyPrefix, ttl),
+		pubsubOps:       newPubSubOperations(redisCache, logger, cfg.KeyPrefix),
+		ttl:             ttl,
+		health:          health,
 	}
+	health.start()
 
 	logger.Info("Cache 实例创建成功")
 	return c, nil
@@ -132,6 +159,24 @@ func (c *client) Script() ScriptingOperations {
 	return c.scriptingOps
 }
 
+func (c *client) Keys() KeyOperations {
+	return c.keyOps
+}
+
+func (c *client) PubSub() PubSubOperations {
+	return c.pubsubOps
+}
+
+// TTLPolicy 返回指定名称的过期策略时长
+func (c *client) TTLPolicy(name string) (time.Duration, error) {
+	return c.ttl.policy(name)
+}
+
+// Stats 返回连接池统计与健康状态
+func (c *client) Stats() PoolStats {
+	return c.health.stats()
+}
+
 // Ping 检查 Redis 连接是否正常
 func (c *client) Ping(ctx context.Context) error {
 	start := time.Now()
@@ -155,6 +200,8 @@ func (c *client) Ping(ctx context.Context) error {
 // Close 关闭 Redis 连接
 func (c *client) Close() error {
 	c.logger.Info("closing redis connection")
+	c.health.close()
+	c.pubsubOps.close()
 	err := c.redisClient.Close()
 	if err != nil {
 		c.logger.Error("failed to close redis connection", clog.Err(err))
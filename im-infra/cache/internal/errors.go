@@ -1,6 +1,11 @@
 package internal
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
 
 var (
 	// ErrBloomFilterNotSupported 表示 Redis 服务器不支持布隆过滤器命令。
@@ -8,4 +13,30 @@ var (
 	// ErrCacheMiss 表示在缓存中未找到指定的 key。
 	// 所有 Get 操作在缓存未命中时，都应返回此错误。
 	ErrCacheMiss = errors.New("cache: key not found")
+	// ErrUnknownTTLPolicy 表示请求的命名过期策略不存在。
+	ErrUnknownTTLPolicy = errors.New("cache: unknown ttl policy")
+	// ErrLockNotAcquired 表示锁已被其他持有者占用，或在最长等待时间内未能获取锁。
+	ErrLockNotAcquired = errors.New("cache: lock not acquired")
+	// ErrEmptyPattern 表示批量删除时传入了空的模式或前缀，防止误删整个键空间。
+	ErrEmptyPattern = errors.New("cache: pattern cannot be empty")
 )
+
+// BatchError 表示批量命令中部分键执行失败。
+// Failed 记录失败的键（调用方传入的键，不含前缀）及其错误，未列出的键已执行成功。
+type BatchError struct {
+	Failed map[string]error
+}
+
+func (e *BatchError) Error() string {
+	for key, err := range e.Failed {
+		return fmt.Sprintf("cache: %d keys failed in batch, e.g. %s: %v", len(e.Failed), key, err)
+	}
+	return "cache: batch failed"
+}
+
+// IsCommandError 判断错误是否为 Redis 返回的命令错误（如 WRONGTYPE），这类错误重试同样会失败。
+// 网络错误、超时和 context 取消不属于命令错误，命令可能未执行，也可能已执行但未收到回复。
+func IsCommandError(err error) bool {
+	var redisErr redis.Error
+	return errors.As(err, &redisErr) && !errors.Is(err, redis.Nil)
+}
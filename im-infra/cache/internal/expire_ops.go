@@ -0,0 +1,240 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/redis/go-redis/v9"
+)
+
+// NoExpiration 是 TTL 对未设置过期时间的键返回的值
+const NoExpiration time.Duration = -1
+
+// ErrInvalidTTLUpdate 表示批量调整过期时间的选项中 TTL、Extend、Persist 没有恰好设置一个
+var ErrInvalidTTLUpdate = errors.New("cache: exactly one of TTL, Extend and Persist must be set")
+
+// TTLUpdateOptions 控制批量调整过期时间的行为，TTL、Extend、Persist 必须恰好设置一个。
+type TTLUpdateOptions struct {
+	// TTL 将匹配键的剩余过期时间设为该值，按 Config.TTLJitter 抖动，避免调整后的键集中过期。
+	TTL time.Duration
+	// Extend 在匹配键当前的剩余过期时间上增加该值，负数表示缩短（至少保留 1 毫秒）。
+	// 未设置过期时间的键保持不过期。
+	Extend time.Duration
+	// Persist 移除匹配键的过期时间。
+	Persist bool
+	// IncludePersistent 设置 TTL 时也为未设置过期时间的键加上过期时间。
+	// 默认跳过这些键，避免常驻的配置类键被意外设置过期。
+	IncludePersistent bool
+	// BatchSize 每次 SCAN 的 COUNT 提示值，以及每次脚本调整的最大键数，默认 500。
+	BatchSize int64
+	// RateLimit 每秒最多调整的键数，0 表示不限速。
+	RateLimit int
+	// DryRun 只扫描并统计匹配的键数，不修改过期时间。
+	DryRun bool
+	// OnProgress 进度回调，每调整（或 DryRun 时每扫描）一批后调用。
+	OnProgress func(TTLUpdateProgress)
+}
+
+// TTLUpdateProgress 批量调整过期时间的进度。
+type TTLUpdateProgress struct {
+	// Matched 已扫描到的匹配键数
+	Matched int64
+	// Updated 过期时间被修改的键数（DryRun 时为 0）
+	Updated int64
+	// Elapsed 已耗时
+	Elapsed time.Duration
+}
+
+// mode 返回调整方式，选项不合法时返回 ErrInvalidTTLUpdate
+func (o TTLUpdateOptions) mode() (string, error) {
+	if o.TTL < 0 {
+		return "", ErrInvalidTTLUpdate
+	}
+	var modes []string
+	if o.TTL > 0 {
+		modes = append(modes, "set")
+	}
+	if o.Extend != 0 {
+		modes = append(modes, "extend")
+	}
+	if o.Persist {
+		modes = append(modes, "persist")
+	}
+	if len(modes) != 1 {
+		return "", ErrInvalidTTLUpdate
+	}
+	return modes[0], nil
+}
+
+// updateTTLScript 原子地调整一批键的过期时间，已不存在的键跳过。
+// KEYS - 要调整的键
+// Args:
+// 1. ARGV[1] - 调整方式 ("set"、"extend" 或 "persist")
+// 2. ARGV[2] - set 时是否也调整未设置过期时间的键 ("1" 或 "0")
+// 3. ARGV[2+i] - 第 i 个键的毫秒数（set 为新的过期时间，extend 为增量）
+// Returns:
+// 1. 过期时间被修改的键数
+var updateTTLScript = redis.NewScript(`
+local updated = 0
+for i, key in ipairs(KEYS) do
+    local pttl = redis.call('pttl', key)
+    local ms = tonumber(ARGV[i + 2])
+    if ARGV[1] == 'persist' then
+        if pttl >= 0 then
+            updated = updated + redis.call('persist', key)
+        end
+    elseif ARGV[1] == 'extend' then
+        if pttl >= 0 then
+            updated = updated + redis.call('pexpire', key, math.max(pttl + ms, 1))
+        end
+    elseif pttl >= 0 or (pttl == -1 and ARGV[2] == '1') then
+        updated = updated + redis.call('pexpire', key, ms)
+    end
+end
+return updated
+`)
+
+// TTL 返回键的剩余过期时间，未设置过期时间时返回 NoExpiration，键不存在时返回 ErrCacheMiss
+func (k *keyOperations) TTL(ctx context.Context, key string) (time.Duration, error) {
+	formatted := k.formatKey(key)
+	ttl, err := k.client.PTTL(ctx, formatted).Result()
+	if err != nil {
+		k.logger.Error("Failed to TTL", clog.String("key", formatted), clog.Err(err))
+		return 0, err
+	}
+	// PTTL 对不存在的键返回 -2，对未设置过期时间的键返回 -1
+	switch ttl {
+	case -2:
+		return 0, ErrCacheMiss
+	case -1:
+		return NoExpiration, nil
+	}
+	return ttl, nil
+}
+
+// Persist 移除键的过期时间，键不存在或未设置过期时间时返回 false
+func (k *keyOperations) Persist(ctx context.Context, key string) (bool, error) {
+	formatted := k.formatKey(key)
+	ok, err := k.client.Persist(ctx, formatted).Result()
+	if err != nil {
+		k.logger.Error("Failed to Persist", clog.String("key", formatted), clog.Err(err))
+		return false, err
+	}
+	return ok, nil
+}
+
+// ExpireAt 设置键在 at 时刻过期，at 已过去时键会被立即删除。键不存在时返回 false
+func (k *keyOperations) ExpireAt(ctx context.Context, key string, at time.Time) (bool, error) {
+	formatted := k.formatKey(key)
+	ok, err := k.client.PExpireAt(ctx, formatted, at).Result()
+	if err != nil {
+		k.logger.Error("Failed to ExpireAt", clog.String("key", formatted), clog.Time("at", at), clog.Err(err))
+		return false, err
+	}
+	return ok, nil
+}
+
+// UpdateTTLByPattern 扫描匹配 pattern 的键并批量调整过期时间，返回过期时间被修改的键数。
+// 每批键在一个脚本中调整，读取剩余时间和修改之间不会被其他命令插入。
+func (k *keyOperations) UpdateTTLByPattern(ctx context.Context, pattern string, opts TTLUpdateOptions) (int64, error) {
+	if pattern == "" {
+		return 0, ErrEmptyPattern
+	}
+	mode, err := opts.mode()
+	if err != nil {
+		return 0, err
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultScanBatch
+	}
+	includePersistent := "0"
+	if opts.IncludePersistent {
+		includePersistent = "1"
+	}
+
+	formatted := k.formatPattern(pattern)
+	start := time.Now()
+	var progress TTLUpdateProgress
+	it := k.client.Scan(ctx, 0, formatted, opts.BatchSize).Iterator()
+	batch := make([]string, 0, opts.BatchSize)
+	lastLogged := int64(0)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		progress.Matched += int64(len(batch))
+		if !opts.DryRun {
+			if err := k.throttle(ctx, start, progress.Matched-int64(len(batch)), len(batch), opts.RateLimit); err != nil {
+				return err
+			}
+			args := make([]interface{}, 0, len(batch)+2)
+			args = append(args, mode, includePersistent)
+			for range batch {
+				ms := opts.Extend.Milliseconds()
+				if mode == "set" {
+					ms = k.ttl.apply(opts.TTL).Milliseconds()
+				}
+				args = append(args, ms)
+			}
+			n, err := updateTTLScript.Run(ctx, k.client, batch, args...).Int64()
+			if err != nil {
+				return err
+			}
+			progress.Updated += n
+		}
+		batch = batch[:0]
+		progress.Elapsed = time.Since(start)
+		if opts.OnProgress != nil {
+			opts.OnProgress(progress)
+		}
+
+		if progress.Matched-lastLogged >= defaultProgressEvery {
+			lastLogged = progress.Matched
+			k.logger.Info("批量调整过期时间进行中",
+				clog.String("pattern", formatted),
+				clog.Int64("matched", progress.Matched),
+				clog.Int64("updated", progress.Updated),
+			)
+		}
+		return nil
+	}
+
+	for it.Next(ctx) {
+		batch = append(batch, it.Val())
+		if int64(len(batch)) >= opts.BatchSize {
+			if err := flush(); err != nil {
+				k.logger.Error("批量调整过期时间失败", clog.String("pattern", formatted), clog.Err(err))
+				return progress.Updated, err
+			}
+		}
+	}
+	if err := it.Err(); err != nil {
+		k.logger.Error("扫描键失败", clog.String("pattern", formatted), clog.Err(err))
+		return progress.Updated, err
+	}
+	if err := flush(); err != nil {
+		k.logger.Error("批量调整过期时间失败", clog.String("pattern", formatted), clog.Err(err))
+		return progress.Updated, err
+	}
+
+	k.logger.Info("批量调整过期时间完成",
+		clog.String("pattern", formatted),
+		clog.String("mode", mode),
+		clog.Int64("matched", progress.Matched),
+		clog.Int64("updated", progress.Updated),
+		clog.Bool("dryRun", opts.DryRun),
+		clog.Duration("elapsed", time.Since(start)),
+	)
+	return progress.Updated, nil
+}
+
+// UpdateTTLByPrefix 调整以 prefix 开头的所有键的过期时间，prefix 中的通配符会被转义。
+func (k *keyOperations) UpdateTTLByPrefix(ctx context.Context, prefix string, opts TTLUpdateOptions) (int64, error) {
+	if prefix == "" {
+		return 0, ErrEmptyPattern
+	}
+	return k.UpdateTTLByPattern(ctx, escapeGlob(prefix)+"*", opts)
+}
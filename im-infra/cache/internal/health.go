@@ -0,0 +1,340 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/redis/go-redis/v9"
+)
+
+// 连接生命周期事件类型
+const (
+	// EventConnectionLost 看门狗连续 Ping 失败达到阈值，判定与 Redis 的连接中断
+	EventConnectionLost = "connection_lost"
+	// EventReconnected 连接中断后看门狗 Ping 重新成功
+	EventReconnected = "reconnected"
+	// EventFailoverDetected Redis 实例的 run_id 发生变化，说明发生了主从切换或实例重启
+	EventFailoverDetected = "failover_detected"
+	// EventCommandTimeout 命令因网络读写超时失败
+	EventCommandTimeout = "command_timeout"
+)
+
+// HealthConfig 连接健康监控配置
+type HealthConfig struct {
+	// WatchdogInterval 看门狗 Ping 间隔，<= 0 时不启动看门狗，仅统计命令超时和拨号次数
+	WatchdogInterval time.Duration `json:"watchdogInterval" yaml:"watchdogInterval"`
+
+	// PingTimeout 单次 Ping 的超时时间，默认 1 秒
+	PingTimeout time.Duration `json:"pingTimeout" yaml:"pingTimeout"`
+
+	// FailureThreshold 连续失败多少次判定连接中断，默认 2
+	FailureThreshold int `json:"failureThreshold" yaml:"failureThreshold"`
+}
+
+// HealthEvent 连接生命周期事件
+type HealthEvent struct {
+	// Type 事件类型，见 Event* 常量
+	Type string
+	// Addr Redis 地址
+	Addr string
+	// Err 触发事件的错误
+	Err error
+	// Downtime 连接中断的时长，仅 EventReconnected 有值
+	Downtime time.Duration
+	// At 事件发生时间
+	At time.Time
+}
+
+// HealthHandler 连接生命周期事件回调，在触发事件的 goroutine 中同步执行，不应阻塞
+type HealthHandler func(event HealthEvent)
+
+// PoolStats 连接池统计与健康状态
+type PoolStats struct {
+	// Hits 从连接池中取到空闲连接的次数
+	Hits uint32
+	// Misses 连接池中没有空闲连接、需要新建连接的次数
+	Misses uint32
+	// Timeouts 等待连接池超时的次数
+	Timeouts uint32
+	// TotalConns 连接池中的连接总数
+	TotalConns uint32
+	// IdleConns 连接池中的空闲连接数
+	IdleConns uint32
+	// StaleConns 因过期或失效被移除的连接数
+	StaleConns uint32
+
+	// Dials 拨号次数
+	Dials uint64
+	// DialErrors 拨号失败次数
+	DialErrors uint64
+	// CommandTimeouts 命令网络超时次数
+	CommandTimeouts uint64
+	// Reconnects 连接中断后恢复的次数
+	Reconnects uint64
+	// Failovers 检测到主从切换或实例重启的次数
+	Failovers uint64
+
+	// Healthy 看门狗最近一次判定的连接状态，未启动看门狗时恒为 true
+	Healthy bool
+	// LastPingLatency 看门狗最近一次成功 Ping 的耗时
+	LastPingLatency time.Duration
+}
+
+// healthMonitor 通过 redis.Options 中的 Dialer 和 Limiter 统计拨号和命令超时，并运行基于 Ping 的看门狗。
+// 统计逻辑必须在 redis.NewClient 之前写入选项：MinIdleConns > 0 时 NewClient 内部会立即
+// 在后台协程中拨号，之后再调用 AddHook 会与这些协程并发读写 Hook 链。
+// 网络分区期间看门狗的 Ping 会让连接池及早剔除失效的连接，
+// 分区恢复后业务请求拿到的是重新拨号的新连接，而不是卡在半开连接上等待读超时。
+type healthMonitor struct {
+	client   *redis.Client
+	addr     string
+	cfg      HealthConfig
+	handlers []HealthHandler
+	logger   clog.Logger
+
+	dials           atomic.Uint64
+	dialErrors      atomic.Uint64
+	commandTimeouts atomic.Uint64
+	reconnects      atomic.Uint64
+	failovers       atomic.Uint64
+	lastPingLatency atomic.Int64
+
+	mu        sync.Mutex
+	healthy   bool
+	failures  int
+	downSince time.Time
+	runID     string
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// newHealthMonitor 创建健康监控并将拨号、命令结果的统计写入 opts，需要在 redis.NewClient 之前调用，
+// 创建客户端后通过 attach 关联
+func newHealthMonitor(opts *redis.Options, cfg *HealthConfig, handlers []HealthHandler, logger clog.Logger) *healthMonitor {
+	m := &healthMonitor{
+		addr:     opts.Addr,
+		handlers: handlers,
+		logger:   logger,
+		healthy:  true,
+		stop:     make(chan struct{}),
+	}
+	if cfg != nil {
+		m.cfg = *cfg
+	}
+	if m.cfg.PingTimeout <= 0 {
+		m.cfg.PingTimeout = time.Second
+	}
+	if m.cfg.FailureThreshold <= 0 {
+		m.cfg.FailureThreshold = 2
+	}
+	dial := opts.Dialer
+	if dial == nil {
+		dial = redis.NewDialer(opts)
+	}
+	opts.Dialer = m.dialer(dial)
+	opts.Limiter = m
+	return m
+}
+
+// attach 关联看门狗使用的 Redis 客户端，需要在 start 之前调用
+func (m *healthMonitor) attach(client *redis.Client) {
+	m.client = client
+}
+
+// start 启动看门狗，未配置间隔时不启动
+func (m *healthMonitor) start() {
+	if m.cfg.WatchdogInterval <= 0 {
+		return
+	}
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ticker := time.NewTicker(m.cfg.WatchdogInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-m.stop:
+				return
+			case <-ticker.C:
+				m.check()
+			}
+		}
+	}()
+	m.logger.Info("Redis 连接看门狗已启动",
+		clog.Duration("interval", m.cfg.WatchdogInterval),
+		clog.Int("failure_threshold", m.cfg.FailureThreshold))
+}
+
+// close 停止看门狗
+func (m *healthMonitor) close() {
+	close(m.stop)
+	m.wg.Wait()
+}
+
+// check 执行一次 Ping 和 run_id 检查
+func (m *healthMonitor) check() {
+	ctx, cancel := context.WithTimeout(context.Background(), m.cfg.PingTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := m.client.Ping(ctx).Err()
+	latency := time.Since(start)
+	if err != nil {
+		m.recordFailure(err)
+		return
+	}
+
+	runID := ""
+	if info, err := m.client.Info(ctx, "server").Result(); err == nil {
+		runID = parseInfoField(info, "run_id")
+	}
+	m.recordSuccess(latency, runID)
+}
+
+// recordFailure 记录一次 Ping 失败，连续失败达到阈值时触发 connection_lost
+func (m *healthMonitor) recordFailure(err error) {
+	m.mu.Lock()
+	m.failures++
+	lost := m.healthy && m.failures >= m.cfg.FailureThreshold
+	if lost {
+		m.healthy = false
+		m.downSince = time.Now()
+	}
+	m.mu.Unlock()
+
+	if lost {
+		m.logger.Error("Redis 连接中断", clog.String("addr", m.addr), clog.Err(err))
+		m.emit(HealthEvent{Type: EventConnectionLost, Err: err})
+	} else {
+		m.logger.Warn("Redis 看门狗 Ping 失败", clog.String("addr", m.addr), clog.Err(err))
+	}
+}
+
+// recordSuccess 记录一次 Ping 成功，必要时触发 reconnected 和 failover_detected
+func (m *healthMonitor) recordSuccess(latency time.Duration, runID string) {
+	m.lastPingLatency.Store(int64(latency))
+
+	m.mu.Lock()
+	m.failures = 0
+	var downtime time.Duration
+	recovered := !m.healthy
+	if recovered {
+		m.healthy = true
+		downtime = time.Since(m.downSince)
+	}
+	failover := runID != "" && m.runID != "" && runID != m.runID
+	if runID != "" {
+		m.runID = runID
+	}
+	m.mu.Unlock()
+
+	if recovered {
+		m.reconnects.Add(1)
+		m.logger.Info("Redis 连接已恢复", clog.String("addr", m.addr), clog.Duration("downtime", downtime))
+		m.emit(HealthEvent{Type: EventReconnected, Downtime: downtime})
+	}
+	if failover {
+		m.failovers.Add(1)
+		m.logger.Warn("检测到 Redis 主从切换或实例重启", clog.String("addr", m.addr), clog.String("run_id", runID))
+		m.emit(HealthEvent{Type: EventFailoverDetected})
+	}
+}
+
+// emit 依次调用事件回调，回调 panic 不影响其他回调
+func (m *healthMonitor) emit(event HealthEvent) {
+	event.Addr = m.addr
+	event.At = time.Now()
+	for _, h := range m.handlers {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					m.logger.Error("连接事件回调发生panic", clog.Any("recover", r))
+				}
+			}()
+			h(event)
+		}()
+	}
+}
+
+// stats 返回连接池统计与健康状态
+func (m *healthMonitor) stats() PoolStats {
+	pool := m.client.PoolStats()
+
+	m.mu.Lock()
+	healthy := m.healthy
+	m.mu.Unlock()
+
+	return PoolStats{
+		Hits:            pool.Hits,
+		Misses:          pool.Misses,
+		Timeouts:        pool.Timeouts,
+		TotalConns:      pool.TotalConns,
+		IdleConns:       pool.IdleConns,
+		StaleConns:      pool.StaleConns,
+		Dials:           m.dials.Load(),
+		DialErrors:      m.dialErrors.Load(),
+		CommandTimeouts: m.commandTimeouts.Load(),
+		Reconnects:      m.reconnects.Load(),
+		Failovers:       m.failovers.Load(),
+		Healthy:         healthy,
+		LastPingLatency: time.Duration(m.lastPingLatency.Load()),
+	}
+}
+
+// dialer 包装拨号函数，统计拨号次数和失败次数
+func (m *healthMonitor) dialer(next func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := next(ctx, network, addr)
+		m.dials.Add(1)
+		if err != nil {
+			m.dialErrors.Add(1)
+		}
+		return conn, err
+	}
+}
+
+// Allow 实现 redis.Limiter，只用于接收命令结果，从不限流
+func (m *healthMonitor) Allow() error {
+	return nil
+}
+
+// ReportResult 实现 redis.Limiter，统计命令网络超时。
+// 每次使用连接后都会回调，重试的每次尝试分别计入
+func (m *healthMonitor) ReportResult(err error) {
+	if isNetworkTimeout(err) {
+		m.commandTimeout(err)
+	}
+}
+
+// commandTimeout 记录一次命令超时
+func (m *healthMonitor) commandTimeout(err error) {
+	m.commandTimeouts.Add(1)
+	m.emit(HealthEvent{Type: EventCommandTimeout, Err: err})
+}
+
+// isNetworkTimeout 判断错误是否为网络读写超时，调用方 context 取消不计入
+func isNetworkTimeout(err error) bool {
+	var netErr net.Error
+	return err != nil && errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// parseInfoField 从 INFO 命令的输出中读取字段值
+func parseInfoField(info, field string) string {
+	scanner := bufio.NewScanner(strings.NewReader(info))
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), field+":"); ok {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
@@ -15,6 +15,16 @@ type StringOperations interface {
 	Del(ctx context.Context, keys ...string) error
 	Incr(ctx context.Context, key string) (int64, error)
 	Decr(ctx context.Context, key string) (int64, error)
+	// IncrWithMax 原子地将计数器增加 delta，结果不超过 max，返回调整后的值以及是否触及上限。
+	// 适用于群组席位、未读数封顶等需要避免 Get-then-Set 竞态的场景。键不存在时视为 0，
+	// 值发生变化时保留键原有的 TTL；值不变时不会创建不存在的键，新建的键没有过期时间。
+	IncrWithMax(ctx context.Context, key string, delta, max int64) (int64, bool, error)
+	// DecrWithMin 原子地将计数器减少 delta，结果不低于 min，返回调整后的值以及是否触及下限。
+	DecrWithMin(ctx context.Context, key string, delta, min int64) (int64, bool, error)
+	// IncrByBatch 通过一次 pipeline 将每个键增加对应的 delta，键不存在时视为 0。
+	// expiration 大于 0 时同时刷新这些键的过期时间（按 TTLJitter 抖动），适用于批量落盘本地聚合的计数。
+	// 各键独立执行，部分键失败时返回 *BatchError，其中未列出的键已成功写入，调用方只应重试失败的键。
+	IncrByBatch(ctx context.Context, deltas map[string]int64, expiration time.Duration) error
 	Exists(ctx context.Context, keys ...string) (int64, error)
 	// SetNX (Set if Not Exists) 存入一个 key-value 对，仅当 key 不存在时。
 	// 注意：value (interface{}) 参数需要调用者自行序列化。
@@ -78,8 +88,17 @@ type ZMember struct {
 
 // LockOperations 定义了分布式锁的操作。
 type LockOperations interface {
-	// Acquire 尝试获取一个锁。如果成功，返回一个 Locker 对象；否则返回错误。
+	// Acquire 尝试获取一个锁。如果成功，返回一个 Locker 对象；锁被占用时返回 nil 和 ErrLockNotAcquired。
+	//
+	// Deprecated: 返回值无法直观区分"锁被占用"和"Redis 出错"，
+	// 请使用 TryLock（非阻塞）、Lock 或 LockWithOptions（阻塞重试）代替。
 	Acquire(ctx context.Context, key string, expiration time.Duration) (Locker, error)
+	// TryLock 尝试获取一个锁，不等待。锁被占用时返回 nil、false 和 nil 错误，只有 Redis 出错时才返回错误。
+	TryLock(ctx context.Context, key string, expiration time.Duration) (Locker, bool, error)
+	// Lock 阻塞获取一个锁，按指数退避重试直到成功或 ctx 结束（返回 ctx.Err()）。
+	Lock(ctx context.Context, key string, expiration time.Duration) (Locker, error)
+	// LockWithOptions 阻塞获取一个锁，按 opts 指定的重试间隔重试；超过 MaxWait 时返回 ErrLockNotAcquired。
+	LockWithOptions(ctx context.Context, key string, expiration time.Duration, opts LockOptions) (Locker, error)
 }
 
 // Locker 定义了锁对象的接口。
@@ -104,6 +123,35 @@ type ScriptingOperations interface {
 	ScriptExists(ctx context.Context, sha1 ...string) ([]bool, error)
 }
 
+// KeyOperations 定义了键空间扫描和批量删除操作，用于运维清理。
+type KeyOperations interface {
+	ScanKeys(ctx context.Context, pattern string, batch int64) KeyIterator
+	DeleteByPattern(ctx context.Context, pattern string, opts DeleteOptions) (int64, error)
+	DeleteByPrefix(ctx context.Context, prefix string, opts DeleteOptions) (int64, error)
+	// Dump 返回键的序列化值和剩余过期时间（未设置过期时为 0），用于跨实例迁移键。
+	Dump(ctx context.Context, key string) (string, time.Duration, error)
+	// Restore 用 Dump 的结果创建键，键已存在时不覆盖并返回 false。
+	Restore(ctx context.Context, key, value string, ttl time.Duration) (bool, error)
+	TTL(ctx context.Context, key string) (time.Duration, error)
+	Persist(ctx context.Context, key string) (bool, error)
+	ExpireAt(ctx context.Context, key string, at time.Time) (bool, error)
+	UpdateTTLByPattern(ctx context.Context, pattern string, opts TTLUpdateOptions) (int64, error)
+	UpdateTTLByPrefix(ctx context.Context, prefix string, opts TTLUpdateOptions) (int64, error)
+}
+
+// PubSubOperations 定义了频道发布订阅操作。
+type PubSubOperations interface {
+	// Publish 向频道发布一条消息，返回收到消息的订阅者数。
+	// 注意：message (interface{}) 参数需要调用者自行序列化。
+	Publish(ctx context.Context, channel string, message interface{}) (int64, error)
+	// Subscribe 为频道注册回调，同一频道可以注册多个回调。
+	Subscribe(ctx context.Context, channel string, handler PubSubHandler) (PubSubSubscription, error)
+	// OnResubscribe 注册订阅连接断开后重新订阅成功的回调。
+	OnResubscribe(handler func(channels []string))
+	// Stats 返回发布订阅的投递统计。
+	Stats() PubSubStats
+}
+
 // Provider 定义了 cache 组件提供的所有能力。
 type Provider interface {
 	String() StringOperations
@@ -113,6 +161,8 @@ type Provider interface {
 	Lock() LockOperations
 	Bloom() BloomFilterOperations
 	Script() ScriptingOperations
+	Keys() KeyOperations
+	PubSub() PubSubOperations
 
 	// Ping 检查与 Redis 服务器的连接。
 	Ping(ctx context.Context) error
@@ -0,0 +1,282 @@
+package internal
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/redis/go-redis/v9"
+)
+
+// 批量扫描删除的默认参数
+const (
+	defaultScanBatch      = 500
+	defaultProgressEvery  = 10000
+	globSpecialCharacters = `*?[]\`
+)
+
+// DeleteOptions 控制批量删除的行为。
+type DeleteOptions struct {
+	// BatchSize 每次 SCAN 的 COUNT 提示值，以及每次 UNLINK 的最大键数，默认 500。
+	BatchSize int64
+	// RateLimit 每秒最多删除的键数，0 表示不限速。
+	// 大规模清理时建议设置，避免 UNLINK 集中回收内存影响线上请求。
+	RateLimit int
+	// DryRun 只扫描并统计匹配的键数，不执行删除。
+	DryRun bool
+	// OnProgress 进度回调，每删除（或 DryRun 时每扫描）一批后调用。
+	OnProgress func(DeleteProgress)
+}
+
+// DeleteProgress 批量删除的进度。
+type DeleteProgress struct {
+	// Matched 已扫描到的匹配键数
+	Matched int64
+	// Deleted 已删除的键数（DryRun 时为 0）
+	Deleted int64
+	// Elapsed 已耗时
+	Elapsed time.Duration
+}
+
+// KeyIterator 逐个返回 SCAN 匹配到的键。
+type KeyIterator interface {
+	// Next 前进到下一个键，没有更多键或出错时返回 false。
+	Next(ctx context.Context) bool
+	// Val 返回当前键（已去除 KeyPrefix）。
+	Val() string
+	// Err 返回迭代过程中发生的错误。
+	Err() error
+}
+
+// keyOperations 实现键空间扫描和批量删除的结构体
+type keyOperations struct {
+	client    *redis.Client
+	logger    clog.Logger
+	keyPrefix string
+	ttl       *ttlManager
+}
+
+// newKeyOperations 创建键空间操作实例
+func newKeyOperations(client *redis.Client, logger clog.Logger, keyPrefix string, ttl *ttlManager) *keyOperations {
+	return &keyOperations{
+		client:    client,
+		logger:    logger,
+		keyPrefix: keyPrefix,
+		ttl:       ttl,
+	}
+}
+
+// formatKey 格式化键名，添加前缀
+func (k *keyOperations) formatKey(key string) string {
+	if k.keyPrefix == "" {
+		return key
+	}
+	// 如果前缀已经以冒号结尾，直接拼接
+	if k.keyPrefix[len(k.keyPrefix)-1] == ':' {
+		return k.keyPrefix + key
+	}
+	return k.keyPrefix + ":" + key
+}
+
+// formatPattern 为 glob 模式添加前缀，前缀中的通配符会被转义
+func (k *keyOperations) formatPattern(pattern string) string {
+	return escapeGlob(k.formatKey("")) + pattern
+}
+
+// trimKey 去除键名中的前缀
+func (k *keyOperations) trimKey(key string) string {
+	return strings.TrimPrefix(key, k.formatKey(""))
+}
+
+// ScanKeys 使用 SCAN 迭代匹配 pattern 的键，不会像 KEYS 一样阻塞 Redis。
+// 迭代期间新增或删除的键可能被返回也可能不被返回，同一个键也可能被返回多次。
+func (k *keyOperations) ScanKeys(ctx context.Context, pattern string, batch int64) KeyIterator {
+	if batch <= 0 {
+		batch = defaultScanBatch
+	}
+	it := k.client.Scan(ctx, 0, k.formatPattern(pattern), batch).Iterator()
+	return &keyIterator{it: it, ops: k}
+}
+
+// DeleteByPattern 扫描并删除匹配 pattern 的键，返回删除的键数。
+// 使用 SCAN 分批扫描、UNLINK 异步回收内存，并按 RateLimit 限速。
+func (k *keyOperations) DeleteByPattern(ctx context.Context, pattern string, opts DeleteOptions) (int64, error) {
+	if pattern == "" {
+		return 0, ErrEmptyPattern
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultScanBatch
+	}
+
+	formatted := k.formatPattern(pattern)
+	start := time.Now()
+	var progress DeleteProgress
+	report := func() {
+		progress.Elapsed = time.Since(start)
+		if opts.OnProgress != nil {
+			opts.OnProgress(progress)
+		}
+	}
+
+	it := k.client.Scan(ctx, 0, formatted, opts.BatchSize).Iterator()
+	batch := make([]string, 0, opts.BatchSize)
+	lastLogged := int64(0)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		progress.Matched += int64(len(batch))
+		if !opts.DryRun {
+			if err := k.throttle(ctx, start, progress.Deleted, len(batch), opts.RateLimit); err != nil {
+				return err
+			}
+			n, err := k.client.Unlink(ctx, batch...).Result()
+			if err != nil {
+				return err
+			}
+			progress.Deleted += n
+		}
+		batch = batch[:0]
+		report()
+
+		if progress.Matched-lastLogged >= defaultProgressEvery {
+			lastLogged = progress.Matched
+			k.logger.Info("批量删除进行中",
+				clog.String("pattern", formatted),
+				clog.Int64("matched", progress.Matched),
+				clog.Int64("deleted", progress.Deleted),
+			)
+		}
+		return nil
+	}
+
+	for it.Next(ctx) {
+		batch = append(batch, it.Val())
+		if int64(len(batch)) >= opts.BatchSize {
+			if err := flush(); err != nil {
+				k.logger.Error("批量删除失败", clog.String("pattern", formatted), clog.Err(err))
+				return progress.Deleted, err
+			}
+		}
+	}
+	if err := it.Err(); err != nil {
+		k.logger.Error("扫描键失败", clog.String("pattern", formatted), clog.Err(err))
+		return progress.Deleted, err
+	}
+	if err := flush(); err != nil {
+		k.logger.Error("批量删除失败", clog.String("pattern", formatted), clog.Err(err))
+		return progress.Deleted, err
+	}
+
+	k.logger.Info("批量删除完成",
+		clog.String("pattern", formatted),
+		clog.Int64("matched", progress.Matched),
+		clog.Int64("deleted", progress.Deleted),
+		clog.Bool("dryRun", opts.DryRun),
+		clog.Duration("elapsed", time.Since(start)),
+	)
+	return progress.Deleted, nil
+}
+
+// DeleteByPrefix 删除以 prefix 开头的所有键，prefix 中的通配符会被转义。
+func (k *keyOperations) DeleteByPrefix(ctx context.Context, prefix string, opts DeleteOptions) (int64, error) {
+	if prefix == "" {
+		return 0, ErrEmptyPattern
+	}
+	return k.DeleteByPattern(ctx, escapeGlob(prefix)+"*", opts)
+}
+
+// Dump 返回键的序列化值和剩余过期时间（未设置过期时为 0），键不存在时返回 ErrCacheMiss。
+func (k *keyOperations) Dump(ctx context.Context, key string) (string, time.Duration, error) {
+	formatted := k.formatKey(key)
+	pipe := k.client.Pipeline()
+	dump := pipe.Dump(ctx, formatted)
+	pttl := pipe.PTTL(ctx, formatted)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		k.logger.Error("导出键失败", clog.String("key", formatted), clog.Err(err))
+		return "", 0, err
+	}
+
+	value, err := dump.Result()
+	if err == redis.Nil {
+		return "", 0, ErrCacheMiss
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	// PTTL 对未设置过期的键返回 -1，Restore 中 0 表示不过期
+	ttl := pttl.Val()
+	if ttl < 0 {
+		ttl = 0
+	}
+	return value, ttl, nil
+}
+
+// Restore 用 Dump 的结果创建键，ttl 为 0 表示不过期。
+// 键已存在时不覆盖并返回 false：迁移期间目标实例上的值是路由切换后新写入的，比源实例上的值更新。
+func (k *keyOperations) Restore(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	formatted := k.formatKey(key)
+	err := k.client.Restore(ctx, formatted, ttl, value).Err()
+	if err != nil && strings.HasPrefix(err.Error(), "BUSYKEY") {
+		return false, nil
+	}
+	if err != nil {
+		k.logger.Error("导入键失败", clog.String("key", formatted), clog.Err(err))
+		return false, err
+	}
+	return true, nil
+}
+
+// throttle 按 RateLimit 限速：删除 next 个键前，保证平均速率不超过 rate 个/秒
+func (k *keyOperations) throttle(ctx context.Context, start time.Time, deleted int64, next, rate int) error {
+	if rate <= 0 {
+		return nil
+	}
+	target := time.Duration(float64(deleted+int64(next)) / float64(rate) * float64(time.Second))
+	wait := target - time.Since(start)
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// escapeGlob 转义 Redis glob 模式中的特殊字符
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(globSpecialCharacters, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// keyIterator 包装 redis.ScanIterator，返回去除前缀后的键
+type keyIterator struct {
+	it  *redis.ScanIterator
+	ops *keyOperations
+}
+
+func (i *keyIterator) Next(ctx context.Context) bool {
+	return i.it.Next(ctx)
+}
+
+func (i *keyIterator) Val() string {
+	return i.ops.trimKey(i.it.Val())
+}
+
+func (i *keyIterator) Err() error {
+	return i.it.Err()
+}
@@ -0,0 +1,97 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/redis/go-redis/v9"
+)
+
+// KeyspaceHandler 键空间通知回调，key 为发生事件的键（不含 KeyPrefix 处理），event 为事件名，如 "expired"、"del"
+type KeyspaceHandler func(key, event string)
+
+// KeyspaceSubscription 一个键空间通知订阅
+type KeyspaceSubscription interface {
+	// Close 取消订阅并等待回调全部返回
+	Close() error
+}
+
+// keyspaceSubscription 基于 PSUBSCRIBE 的键空间通知订阅，go-redis 会在连接断开后自动重新订阅
+type keyspaceSubscription struct {
+	pubsub    *redis.PubSub
+	done      chan struct{}
+	closeOnce sync.Once
+	err       error
+}
+
+// EnableKeyspaceNotifications 将 classes 中的事件类别合并到 notify-keyspace-events 配置中，已开启的类别保持不变。
+// 托管 Redis 通常禁用 CONFIG 命令，此时需要在控制台开启，调用返回错误
+func (c *client) EnableKeyspaceNotifications(ctx context.Context, classes string) error {
+	current, err := c.redisClient.ConfigGet(ctx, "notify-keyspace-events").Result()
+	if err != nil {
+		return fmt.Errorf("failed to get notify-keyspace-events: %w", err)
+	}
+	merged := current["notify-keyspace-events"]
+	for _, class := range classes {
+		if !strings.ContainsRune(merged, class) {
+			merged += string(class)
+		}
+	}
+	if merged == current["notify-keyspace-events"] {
+		return nil
+	}
+	if err := c.redisClient.ConfigSet(ctx, "notify-keyspace-events", merged).Err(); err != nil {
+		return fmt.Errorf("failed to set notify-keyspace-events: %w", err)
+	}
+	c.logger.Info("已开启键空间通知", clog.String("notify-keyspace-events", merged))
+	return nil
+}
+
+// SubscribeKeyspace 订阅键名匹配 pattern 的键空间通知，需要 notify-keyspace-events 包含 K 和对应的事件类别。
+// 脚本操作的键不叠加 KeyPrefix，pattern 也不叠加；handler 在同一个 goroutine 中依次执行，不应阻塞
+func (c *client) SubscribeKeyspace(ctx context.Context, pattern string, handler KeyspaceHandler) (KeyspaceSubscription, error) {
+	channelPrefix := "__keyspace@" + strconv.Itoa(c.config.DB) + "__:"
+	pubsub := c.redisClient.PSubscribe(ctx, channelPrefix+pattern)
+	// 等待订阅确认，确保返回后不会遗漏事件
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, fmt.Errorf("failed to subscribe keyspace notifications: %w", err)
+	}
+
+	s := &keyspaceSubscription{
+		pubsub: pubsub,
+		done:   make(chan struct{}),
+	}
+	go func() {
+		defer close(s.done)
+		for msg := range pubsub.Channel() {
+			handler(strings.TrimPrefix(msg.Channel, channelPrefix), msg.Payload)
+		}
+	}()
+
+	c.logger.Info("已订阅键空间通知", clog.String("pattern", pattern))
+	return s, nil
+}
+
+// SubscribeExpired 订阅键名匹配 pattern 的过期事件，需要 notify-keyspace-events 包含 "Kx"。
+// 与 KeyOperations 一致，pattern 相对于 KeyPrefix，handler 收到的键已去除 KeyPrefix
+func (c *client) SubscribeExpired(ctx context.Context, pattern string, handler func(key string)) (KeyspaceSubscription, error) {
+	return c.SubscribeKeyspace(ctx, c.keyOps.formatPattern(pattern), func(key, event string) {
+		if event == "expired" {
+			handler(c.keyOps.trimKey(key))
+		}
+	})
+}
+
+// Close 取消订阅并等待回调全部返回
+func (s *keyspaceSubscription) Close() error {
+	s.closeOnce.Do(func() {
+		s.err = s.pubsub.Close()
+		<-s.done
+	})
+	return s.err
+}
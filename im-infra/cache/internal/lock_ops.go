@@ -4,7 +4,7 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
-	"fmt"
+	mathrand "math/rand"
 	"time"
 
 	"github.com/ceyewan/gochat/im-infra/clog"
@@ -53,8 +53,42 @@ type Lock interface {
 	Value() string
 }
 
-// Acquire 获取分布式锁
+// 阻塞加锁的默认重试参数
+const (
+	defaultLockRetryInterval    = 50 * time.Millisecond
+	defaultLockMaxRetryInterval = time.Second
+)
+
+// LockOptions 控制阻塞加锁的重试行为
+type LockOptions struct {
+	// RetryInterval 首次重试的等待时间，之后按指数退避增长
+	// 默认: 50ms
+	RetryInterval time.Duration
+	// MaxRetryInterval 重试等待时间的上限
+	// 默认: 1s
+	MaxRetryInterval time.Duration
+	// MaxWait 最长等待时间，超过后返回 ErrLockNotAcquired；0 表示一直等待直到 ctx 结束
+	MaxWait time.Duration
+}
+
+// Acquire 获取分布式锁。
+// 锁被占用时返回 nil 和 ErrLockNotAcquired。
+//
+// Deprecated: 使用 TryLock（非阻塞）、Lock 或 LockWithOptions（阻塞重试）代替。
 func (l *lockOperations) Acquire(ctx context.Context, key string, expiration time.Duration) (Locker, error) {
+	lock, ok, err := l.TryLock(ctx, key, expiration)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrLockNotAcquired
+	}
+	return lock, nil
+}
+
+// TryLock 尝试获取分布式锁，不等待。
+// 获取成功时返回锁和 true；锁被占用时返回 nil、false 和 nil 错误；只有 Redis 出错时才返回错误。
+func (l *lockOperations) TryLock(ctx context.Context, key string, expiration time.Duration) (Locker, bool, error) {
 	formattedKey := l.formatKey(key)
 	value := generateUniqueValue()
 
@@ -62,10 +96,10 @@ func (l *lockOperations) Acquire(ctx context.Context, key string, expiration tim
 	set, err := l.client.SetNX(ctx, formattedKey, value, expiration).Result()
 	if err != nil {
 		l.logger.Error("Failed to acquire lock", clog.String("key", formattedKey), clog.Err(err))
-		return nil, err
+		return nil, false, err
 	}
 	if !set {
-		return nil, fmt.Errorf("lock already acquired") // 锁已被占用
+		return nil, false, nil // 锁已被占用
 	}
 
 	return &distributedLock{
@@ -73,7 +107,71 @@ func (l *lockOperations) Acquire(ctx context.Context, key string, expiration tim
 		value:  value,
 		client: l.client,
 		logger: l.logger,
-	}, nil
+	}, true, nil
+}
+
+// Lock 阻塞获取分布式锁，按默认的指数退避重试，直到成功或 ctx 结束
+func (l *lockOperations) Lock(ctx context.Context, key string, expiration time.Duration) (Locker, error) {
+	return l.LockWithOptions(ctx, key, expiration, LockOptions{})
+}
+
+// LockWithOptions 阻塞获取分布式锁，按 opts 指定的重试间隔和最长等待时间重试。
+// 超过 MaxWait 时返回 ErrLockNotAcquired；ctx 结束时返回 ctx.Err()。
+func (l *lockOperations) LockWithOptions(ctx context.Context, key string, expiration time.Duration, opts LockOptions) (Locker, error) {
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = defaultLockRetryInterval
+	}
+	if opts.MaxRetryInterval < opts.RetryInterval {
+		opts.MaxRetryInterval = defaultLockMaxRetryInterval
+		if opts.MaxRetryInterval < opts.RetryInterval {
+			opts.MaxRetryInterval = opts.RetryInterval
+		}
+	}
+
+	var deadline <-chan time.Time
+	if opts.MaxWait > 0 {
+		timer := time.NewTimer(opts.MaxWait)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	interval := opts.RetryInterval
+	for attempt := 1; ; attempt++ {
+		lock, ok, err := l.TryLock(ctx, key, expiration)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			if attempt > 1 {
+				l.logger.Debug("Lock acquired after retry",
+					clog.String("key", l.formatKey(key)),
+					clog.Int("attempts", attempt))
+			}
+			return lock, nil
+		}
+
+		// 加入随机抖动，避免多个等待者同时重试
+		wait := interval/2 + time.Duration(mathrand.Int63n(int64(interval/2)+1))
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-deadline:
+			timer.Stop()
+			l.logger.Debug("Lock wait timed out",
+				clog.String("key", l.formatKey(key)),
+				clog.Duration("maxWait", opts.MaxWait),
+				clog.Int("attempts", attempt))
+			return nil, ErrLockNotAcquired
+		case <-timer.C:
+		}
+
+		interval *= 2
+		if interval > opts.MaxRetryInterval {
+			interval = opts.MaxRetryInterval
+		}
+	}
 }
 
 // distributedLock 分布式锁的实现
@@ -0,0 +1,395 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/redis/go-redis/v9"
+)
+
+// pubsubPingInterval 订阅连接空闲多久后发送一次 PING，用于发现半开连接
+const pubsubPingInterval = 30 * time.Second
+
+// pubsubRetryBackoff 订阅连接出错后重新接收前的等待时间
+const pubsubRetryBackoff = 500 * time.Millisecond
+
+// PubSubHandler 频道消息回调，channel 为不含 KeyPrefix 的频道名。
+// 返回的错误只记录日志和计数，消息不会重新投递
+type PubSubHandler func(ctx context.Context, channel, payload string) error
+
+// PubSubSubscription 一个频道回调的注册
+type PubSubSubscription interface {
+	// Close 注销回调，频道上没有其他回调时取消订阅。正在执行的回调不会被打断
+	Close() error
+}
+
+// PubSubStats 发布订阅的投递统计
+type PubSubStats struct {
+	// Channels 当前订阅的频道数
+	Channels int
+	// Handlers 当前注册的回调数
+	Handlers int
+	// Published 发布成功的消息数
+	Published int64
+	// PublishErrors 发布失败的次数
+	PublishErrors int64
+	// Received 从订阅连接收到的消息数
+	Received int64
+	// Delivered 回调成功处理的次数，一条消息有多个回调时计多次
+	Delivered int64
+	// HandlerErrors 回调返回错误或 panic 的次数
+	HandlerErrors int64
+	// Reconnects 订阅连接断开后重新订阅成功的次数
+	Reconnects int64
+}
+
+// pubsubOperations 基于一条共享订阅连接的发布订阅实现。
+// 所有频道复用同一个 redis.PubSub，连接断开时 go-redis 重新建立连接并重新订阅所有频道
+type pubsubOperations struct {
+	client    *redis.Client
+	logger    clog.Logger
+	keyPrefix string
+
+	mu         sync.Mutex
+	pubsub     *redis.PubSub
+	handlers   map[string]map[uint64]PubSubHandler // 带前缀的频道名 -> 回调
+	pending    map[string][]chan struct{}          // 等待订阅确认的频道
+	resubbers  []func(channels []string)
+	nextID     uint64
+	lost       bool
+	closed     bool
+	loopCancel context.CancelFunc
+	loopDone   chan struct{}
+
+	published     atomic.Int64
+	publishErrors atomic.Int64
+	received      atomic.Int64
+	delivered     atomic.Int64
+	handlerErrors atomic.Int64
+	reconnects    atomic.Int64
+}
+
+// newPubSubOperations 创建发布订阅实例，订阅连接在第一次 Subscribe 时建立
+func newPubSubOperations(client *redis.Client, logger clog.Logger, keyPrefix string) *pubsubOperations {
+	return &pubsubOperations{
+		client:    client,
+		logger:    logger,
+		keyPrefix: keyPrefix,
+		handlers:  make(map[string]map[uint64]PubSubHandler),
+		pending:   make(map[string][]chan struct{}),
+	}
+}
+
+// formatChannel 格式化频道名，添加前缀
+func (p *pubsubOperations) formatChannel(channel string) string {
+	if p.keyPrefix == "" {
+		return channel
+	}
+	if p.keyPrefix[len(p.keyPrefix)-1] == ':' {
+		return p.keyPrefix + channel
+	}
+	return p.keyPrefix + ":" + channel
+}
+
+// trimChannel 去掉频道名中的前缀
+func (p *pubsubOperations) trimChannel(channel string) string {
+	prefixed := p.formatChannel("")
+	if len(channel) >= len(prefixed) && channel[:len(prefixed)] == prefixed {
+		return channel[len(prefixed):]
+	}
+	return channel
+}
+
+// Publish 向频道发布一条消息，返回收到消息的订阅者数
+func (p *pubsubOperations) Publish(ctx context.Context, channel string, message interface{}) (int64, error) {
+	formatted := p.formatChannel(channel)
+	receivers, err := p.client.Publish(ctx, formatted, message).Result()
+	if err != nil {
+		p.publishErrors.Add(1)
+		p.logger.Error("Failed to publish", clog.String("channel", formatted), clog.Err(err))
+		return 0, err
+	}
+	p.published.Add(1)
+	return receivers, nil
+}
+
+// Subscribe 为频道注册回调，频道第一次被订阅时等待 Redis 确认后返回，确保返回后发布的消息不会遗漏
+func (p *pubsubOperations) Subscribe(ctx context.Context, channel string, handler PubSubHandler) (PubSubSubscription, error) {
+	if channel == "" {
+		return nil, fmt.Errorf("pubsub channel cannot be empty")
+	}
+	if handler == nil {
+		return nil, fmt.Errorf("pubsub handler cannot be nil")
+	}
+	formatted := p.formatChannel(channel)
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, redis.ErrClosed
+	}
+	p.nextID++
+	id := p.nextID
+	sub := &pubsubSubscription{ops: p, channel: formatted, id: id}
+	if handlers, ok := p.handlers[formatted]; ok {
+		handlers[id] = handler
+		if len(p.pending[formatted]) == 0 {
+			p.mu.Unlock()
+			return sub, nil
+		}
+		// 频道的订阅还在等待确认，和第一个订阅者一起等待
+		confirmed := make(chan struct{})
+		p.pending[formatted] = append(p.pending[formatted], confirmed)
+		p.mu.Unlock()
+		return p.awaitConfirm(ctx, sub, confirmed)
+	}
+
+	p.handlers[formatted] = map[uint64]PubSubHandler{id: handler}
+	confirmed := make(chan struct{})
+	p.pending[formatted] = append(p.pending[formatted], confirmed)
+	if p.pubsub == nil {
+		p.pubsub = p.client.Subscribe(context.Background())
+		loopCtx, cancel := context.WithCancel(context.Background())
+		p.loopCancel = cancel
+		p.loopDone = make(chan struct{})
+		go p.receiveLoop(loopCtx, p.pubsub, p.loopDone)
+	}
+	pubsub := p.pubsub
+	p.mu.Unlock()
+
+	if err := pubsub.Subscribe(ctx, formatted); err != nil {
+		_ = sub.Close()
+		p.logger.Error("Failed to subscribe", clog.String("channel", formatted), clog.Err(err))
+		return nil, fmt.Errorf("failed to subscribe channel %s: %w", channel, err)
+	}
+	if _, err := p.awaitConfirm(ctx, sub, confirmed); err != nil {
+		return nil, err
+	}
+
+	p.logger.Info("已订阅频道", clog.String("channel", formatted))
+	return sub, nil
+}
+
+// awaitConfirm 等待频道的订阅确认，ctx 结束时注销回调
+func (p *pubsubOperations) awaitConfirm(ctx context.Context, sub *pubsubSubscription, confirmed chan struct{}) (PubSubSubscription, error) {
+	select {
+	case <-confirmed:
+		return sub, nil
+	case <-ctx.Done():
+		_ = sub.Close()
+		return nil, ctx.Err()
+	}
+}
+
+// OnResubscribe 注册订阅连接断开后重新订阅成功的回调，参数为重新订阅的频道（不含 KeyPrefix）。
+// 断开期间发布的消息已经丢失，回调可用于从权威数据源补齐状态
+func (p *pubsubOperations) OnResubscribe(handler func(channels []string)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.resubbers = append(p.resubbers, handler)
+}
+
+// Stats 返回发布订阅的投递统计
+func (p *pubsubOperations) Stats() PubSubStats {
+	p.mu.Lock()
+	channels := len(p.handlers)
+	handlers := 0
+	for _, hs := range p.handlers {
+		handlers += len(hs)
+	}
+	p.mu.Unlock()
+
+	return PubSubStats{
+		Channels:      channels,
+		Handlers:      handlers,
+		Published:     p.published.Load(),
+		PublishErrors: p.publishErrors.Load(),
+		Received:      p.received.Load(),
+		Delivered:     p.delivered.Load(),
+		HandlerErrors: p.handlerErrors.Load(),
+		Reconnects:    p.reconnects.Load(),
+	}
+}
+
+// unregister 注销一个回调，频道上没有回调时取消订阅
+func (p *pubsubOperations) unregister(channel string, id uint64) error {
+	p.mu.Lock()
+	handlers, ok := p.handlers[channel]
+	if !ok {
+		p.mu.Unlock()
+		return nil
+	}
+	delete(handlers, id)
+	if len(handlers) > 0 || p.pubsub == nil {
+		p.mu.Unlock()
+		return nil
+	}
+	delete(p.handlers, channel)
+	delete(p.pending, channel)
+	pubsub := p.pubsub
+	p.mu.Unlock()
+
+	if err := pubsub.Unsubscribe(context.Background(), channel); err != nil && !errors.Is(err, redis.ErrClosed) {
+		p.logger.Warn("Failed to unsubscribe", clog.String("channel", channel), clog.Err(err))
+		return err
+	}
+	p.logger.Info("已取消订阅频道", clog.String("channel", channel))
+	return nil
+}
+
+// receiveLoop 接收订阅连接上的消息并分发给回调。
+// 读取出错时 go-redis 会关闭连接，下一次读取时重新连接并重新订阅所有频道；
+// 空闲超过 pubsubPingInterval 时发送 PING，使半开连接尽快暴露为读取错误
+func (p *pubsubOperations) receiveLoop(ctx context.Context, pubsub *redis.PubSub, done chan struct{}) {
+	defer close(done)
+	for {
+		msg, err := pubsub.ReceiveTimeout(ctx, pubsubPingInterval)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, redis.ErrClosed) {
+				return
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				if pingErr := pubsub.Ping(ctx); pingErr == nil {
+					continue
+				}
+			}
+			p.markLost(err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(pubsubRetryBackoff):
+			}
+			continue
+		}
+
+		switch m := msg.(type) {
+		case *redis.Subscription:
+			if m.Kind == "subscribe" {
+				p.confirm(m.Channel)
+			}
+		case *redis.Message:
+			p.received.Add(1)
+			p.dispatch(ctx, m)
+		}
+	}
+}
+
+// markLost 记录订阅连接断开
+func (p *pubsubOperations) markLost(err error) {
+	p.mu.Lock()
+	// 没有订阅频道时不会收到重新订阅的确认，无需等待恢复
+	first := !p.lost && len(p.handlers) > 0
+	if first {
+		p.lost = true
+	}
+	p.mu.Unlock()
+	if first {
+		p.logger.Warn("订阅连接断开，等待重新订阅", clog.Err(err))
+	}
+}
+
+// confirm 处理订阅确认：唤醒等待该频道的 Subscribe，连接断开后收到的第一个确认视为重新订阅成功
+func (p *pubsubOperations) confirm(channel string) {
+	p.mu.Lock()
+	waiters := p.pending[channel]
+	delete(p.pending, channel)
+	recovered := p.lost
+	p.lost = false
+	var channels []string
+	var resubbers []func([]string)
+	if recovered {
+		for ch := range p.handlers {
+			channels = append(channels, p.trimChannel(ch))
+		}
+		resubbers = append(resubbers, p.resubbers...)
+	}
+	p.mu.Unlock()
+
+	for _, w := range waiters {
+		close(w)
+	}
+	if !recovered {
+		return
+	}
+
+	p.reconnects.Add(1)
+	p.logger.Info("订阅连接已恢复，已重新订阅频道", clog.Strings("channels", channels))
+	for _, handler := range resubbers {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					p.logger.Error("重新订阅回调 panic", clog.Any("panic", r))
+				}
+			}()
+			handler(channels)
+		}()
+	}
+}
+
+// dispatch 将消息依次交给频道上的回调
+func (p *pubsubOperations) dispatch(ctx context.Context, msg *redis.Message) {
+	p.mu.Lock()
+	handlers := make([]PubSubHandler, 0, len(p.handlers[msg.Channel]))
+	for _, handler := range p.handlers[msg.Channel] {
+		handlers = append(handlers, handler)
+	}
+	p.mu.Unlock()
+
+	channel := p.trimChannel(msg.Channel)
+	for _, handler := range handlers {
+		if err := p.invoke(ctx, handler, channel, msg.Payload); err != nil {
+			p.handlerErrors.Add(1)
+			p.logger.Warn("频道消息处理失败", clog.String("channel", msg.Channel), clog.Err(err))
+			continue
+		}
+		p.delivered.Add(1)
+	}
+}
+
+// invoke 执行单个回调，回调 panic 转换为错误，不影响后续消息
+func (p *pubsubOperations) invoke(ctx context.Context, handler PubSubHandler, channel, payload string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panicked: %v", r)
+		}
+	}()
+	return handler(ctx, channel, payload)
+}
+
+// close 关闭订阅连接并等待接收循环退出
+func (p *pubsubOperations) close() {
+	p.mu.Lock()
+	p.closed = true
+	pubsub, cancel, done := p.pubsub, p.loopCancel, p.loopDone
+	p.mu.Unlock()
+	if pubsub == nil {
+		return
+	}
+	cancel()
+	_ = pubsub.Close()
+	<-done
+}
+
+// pubsubSubscription 一个回调的注册
+type pubsubSubscription struct {
+	ops       *pubsubOperations
+	channel   string
+	id        uint64
+	closeOnce sync.Once
+	err       error
+}
+
+// Close 注销回调，频道上没有其他回调时取消订阅
+func (s *pubsubSubscription) Close() error {
+	s.closeOnce.Do(func() {
+		s.err = s.ops.unregister(s.channel, s.id)
+	})
+	return s.err
+}
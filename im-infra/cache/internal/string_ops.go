@@ -13,14 +13,16 @@ type stringOperations struct {
 	client    *redis.Client
 	logger    clog.Logger
 	keyPrefix string
+	ttl       *ttlManager
 }
 
 // newStringOperations 创建字符串操作实例
-func newStringOperations(client *redis.Client, logger clog.Logger, keyPrefix string) *stringOperations {
+func newStringOperations(client *redis.Client, logger clog.Logger, keyPrefix string, ttl *ttlManager) *stringOperations {
 	return &stringOperations{
 		client:    client,
 		logger:    logger,
 		keyPrefix: keyPrefix,
+		ttl:       ttl,
 	}
 }
 
@@ -53,6 +55,7 @@ func (s *stringOperations) Get(ctx context.Context, key string) (string, error)
 // Set 设置字符串值
 func (s *stringOperations) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
 	formattedKey := s.formatKey(key)
+	expiration = s.ttl.apply(expiration)
 	err := s.client.Set(ctx, formattedKey, value, expiration).Err()
 	if err != nil {
 		s.logger.Error("Failed to Set", clog.String("key", formattedKey), clog.Any("value", value), clog.Duration("expiration", expiration), clog.Err(err))
@@ -61,7 +64,8 @@ func (s *stringOperations) Set(ctx context.Context, key string, value interface{
 	return nil
 }
 
-// SetNX 当键不存在时设置字符串值
+// SetNX 当键不存在时设置字符串值。
+// SetNX 常用于锁和幂等标记，过期时间决定持有时长，因此不施加 TTLJitter 抖动。
 func (s *stringOperations) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error) {
 	formattedKey := s.formatKey(key)
 	result, err := s.client.SetNX(ctx, formattedKey, value, expiration).Result()
@@ -94,6 +98,103 @@ func (s *stringOperations) Decr(ctx context.Context, key string) (int64, error)
 	return result, nil
 }
 
+// IncrByBatch 通过一次 pipeline 对多个键执行 INCRBY，部分键失败时返回 *BatchError。
+// pipeline 不是事务，失败的键不影响其他键的执行结果。
+func (s *stringOperations) IncrByBatch(ctx context.Context, deltas map[string]int64, expiration time.Duration) error {
+	if len(deltas) == 0 {
+		return nil
+	}
+	pipe := s.client.Pipeline()
+	incrs := make(map[string]*redis.IntCmd, len(deltas))
+	for key, delta := range deltas {
+		formattedKey := s.formatKey(key)
+		incrs[key] = pipe.IncrBy(ctx, formattedKey, delta)
+		if expiration > 0 {
+			pipe.Expire(ctx, formattedKey, s.ttl.apply(expiration))
+		}
+	}
+	_, err := pipe.Exec(ctx)
+	if err == nil {
+		return nil
+	}
+
+	failed := make(map[string]error)
+	for key, cmd := range incrs {
+		if cmdErr := cmd.Err(); cmdErr != nil {
+			failed[key] = cmdErr
+		}
+	}
+	if len(failed) == 0 {
+		// 所有 INCRBY 均已成功，只有 EXPIRE 失败，不能让调用方重试增量
+		s.logger.Warn("IncrByBatch 刷新过期时间失败", clog.Int("keys", len(deltas)), clog.Duration("expiration", expiration), clog.Err(err))
+		return nil
+	}
+	s.logger.Error("Failed to IncrByBatch", clog.Int("keys", len(deltas)), clog.Int("failed", len(failed)), clog.Duration("expiration", expiration), clog.Err(err))
+	return &BatchError{Failed: failed}
+}
+
+// boundedIncrScript 原子地按 delta 调整计数器并限制在上限/下限内。
+// 用 GET 读取当前值，键不存在时视为 0；只有值发生变化时才通过 INCRBY 写入，以保留键原有的 TTL，
+// 值不变（如 delta 为 0 或已处于边界）时不会创建不存在的键。值不是整数时返回错误。
+// 越界时值被截断到边界，但不会朝 delta 的反方向移动（例如已超过上限的值在递增时保持不变）。
+// Keys:
+// 1. KEYS[1] - 计数器的 key
+// Args:
+// 1. ARGV[1] - 增量
+// 2. ARGV[2] - 边界值
+// 3. ARGV[3] - 边界类型 ("max" 或 "min")
+// Returns:
+// 1. 调整后的值
+// 2. 是否触及边界 (1=是, 0=否)
+var boundedIncrScript = redis.NewScript(`
+local raw = redis.call('get', KEYS[1])
+local current = 0
+if raw then
+    current = tonumber(raw)
+    if current == nil or current ~= math.floor(current) then
+        return redis.error_reply('ERR value is not an integer or out of range')
+    end
+end
+local delta = tonumber(ARGV[1])
+local bound = tonumber(ARGV[2])
+local target = current + delta
+local hit = 0
+
+if ARGV[3] == 'max' and target > bound then
+    hit = 1
+    target = math.max(current, bound)
+elseif ARGV[3] == 'min' and target < bound then
+    hit = 1
+    target = math.min(current, bound)
+end
+
+if target ~= current then
+    redis.call('incrby', KEYS[1], target - current)
+end
+return {target, hit}
+`)
+
+// IncrWithMax 原子地将计数器增加 delta，结果不超过 max，返回调整后的值以及是否触及上限
+func (s *stringOperations) IncrWithMax(ctx context.Context, key string, delta, max int64) (int64, bool, error) {
+	return s.incrWithBound(ctx, "IncrWithMax", key, delta, max, "max")
+}
+
+// DecrWithMin 原子地将计数器减少 delta，结果不低于 min，返回调整后的值以及是否触及下限
+func (s *stringOperations) DecrWithMin(ctx context.Context, key string, delta, min int64) (int64, bool, error) {
+	return s.incrWithBound(ctx, "DecrWithMin", key, -delta, min, "min")
+}
+
+// incrWithBound 执行带边界的计数器脚本
+func (s *stringOperations) incrWithBound(ctx context.Context, op, key string, delta, bound int64, boundType string) (int64, bool, error) {
+	formattedKey := s.formatKey(key)
+	result, err := boundedIncrScript.Run(ctx, s.client, []string{formattedKey}, delta, bound, boundType).Int64Slice()
+	if err != nil {
+		s.logger.Error("Failed to "+op, clog.String("key", formattedKey), clog.Int64("delta", delta), clog.Int64("bound", bound), clog.Err(err))
+		return 0, false, err
+	}
+	return result[0], result[1] == 1, nil
+}
+
 // Expire 设置键的过期时间
 func (s *stringOperations) Expire(ctx context.Context, key string, expiration time.Duration) error {
 	formattedKey := s.formatKey(key)
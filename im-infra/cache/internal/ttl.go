@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// 内置的命名过期策略
+const (
+	TTLPolicyShort  = "short"
+	TTLPolicyMedium = "medium"
+	TTLPolicyLong   = "long"
+)
+
+// defaultTTLPolicies 返回内置的命名过期策略，可被配置中的 TTLPolicies 覆盖
+func defaultTTLPolicies() map[string]time.Duration {
+	return map[string]time.Duration{
+		TTLPolicyShort:  5 * time.Minute,
+		TTLPolicyMedium: 1 * time.Hour,
+		TTLPolicyLong:   24 * time.Hour,
+	}
+}
+
+// ttlManager 负责命名过期策略的查找以及过期时间的随机抖动，
+// 用于避免大量 key 在同一时刻集中过期导致请求穿透到数据库。
+type ttlManager struct {
+	jitter   float64
+	policies map[string]time.Duration
+}
+
+// newTTLManager 创建过期时间管理器，overrides 中的策略会覆盖同名的内置策略
+func newTTLManager(jitter float64, overrides map[string]time.Duration) *ttlManager {
+	policies := defaultTTLPolicies()
+	for name, ttl := range overrides {
+		policies[name] = ttl
+	}
+	return &ttlManager{
+		jitter:   jitter,
+		policies: policies,
+	}
+}
+
+// apply 对过期时间施加 ±jitter 比例的随机抖动。
+// 非正数的过期时间（永不过期或 KeepTTL）保持不变。
+func (t *ttlManager) apply(expiration time.Duration) time.Duration {
+	if t == nil || t.jitter <= 0 || expiration <= 0 {
+		return expiration
+	}
+	delta := float64(expiration) * t.jitter * (2*rand.Float64() - 1)
+	jittered := expiration + time.Duration(delta)
+	if jittered < time.Millisecond {
+		return time.Millisecond
+	}
+	return jittered
+}
+
+// policy 返回指定名称的过期策略时长
+func (t *ttlManager) policy(name string) (time.Duration, error) {
+	ttl, ok := t.policies[name]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownTTLPolicy, name)
+	}
+	return ttl, nil
+}
@@ -14,14 +14,16 @@ type zsetOperations struct {
 	client   *redis.Client
 	logger   clog.Logger
 	keyPrefix string
+	ttl       *ttlManager
 }
 
 // newZSetOperations 创建一个新的 ZSetOperations 实例
-func newZSetOperations(client *redis.Client, logger clog.Logger, keyPrefix string) *zsetOperations {
+func newZSetOperations(client *redis.Client, logger clog.Logger, keyPrefix string, ttl *ttlManager) *zsetOperations {
 	return &zsetOperations{
 		client:    client,
 		logger:    logger,
 		keyPrefix: keyPrefix,
+		ttl:       ttl,
 	}
 }
 
@@ -216,6 +218,7 @@ func (z *zsetOperations) ZScore(ctx context.Context, key string, member string)
 // ZSetExpire 为有序集合设置过期时间
 func (z *zsetOperations) ZSetExpire(ctx context.Context, key string, expiration time.Duration) error {
 	formattedKey := z.formatKey(key)
+	expiration = z.ttl.apply(expiration)
 
 	err := z.client.Expire(ctx, formattedKey, expiration).Err()
 	if err != nil {
@@ -0,0 +1,539 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+)
+
+// ErrMemberNotRanked 表示成员不在榜单上（从未加分、已被移除或已被裁剪）
+var ErrMemberNotRanked = errors.New("cache: member not on leaderboard")
+
+// leaderboardTrimTimeout 后台裁剪单次执行的超时时间
+const leaderboardTrimTimeout = 10 * time.Second
+
+// leaderboardStampLen 成员编码中时间戳前缀的长度，编码为 "{13 位时间戳}:{成员}"
+const leaderboardStampLen = 13
+
+// leaderboardStampMax 时间戳前缀的上限，前缀为 leaderboardStampMax 减去毫秒时间戳，
+// 使同分时越早达到该分数的成员在降序中越靠前
+const leaderboardStampMax = 9999999999999
+
+// LeaderboardPeriod 榜单的统计周期
+type LeaderboardPeriod string
+
+const (
+	// LeaderboardAllTime 总榜，不过期
+	LeaderboardAllTime LeaderboardPeriod = "all"
+	// LeaderboardDaily 日榜，按 Location 的自然日切换
+	LeaderboardDaily LeaderboardPeriod = "daily"
+	// LeaderboardWeekly 周榜，周一 00:00 切换
+	LeaderboardWeekly LeaderboardPeriod = "weekly"
+	// LeaderboardMonthly 月榜，每月 1 日 00:00 切换
+	LeaderboardMonthly LeaderboardPeriod = "monthly"
+)
+
+// LeaderboardConfig 定义了排行榜的周期和容量
+type LeaderboardConfig struct {
+	// Namespace 排行榜键的命名空间，不能为空。
+	// 排行榜的读写都通过 Lua 脚本完成，脚本不叠加 Config.KeyPrefix，需要隔离时将前缀写进 Namespace
+	Namespace string `json:"namespace" yaml:"namespace"`
+
+	// Periods 每次 AddScore 同时累加的周期榜，默认只有总榜
+	Periods []LeaderboardPeriod `json:"periods" yaml:"periods"`
+
+	// Retention 周期榜在所属周期结束后保留的周期数，默认 1，即可以查询上一期的日榜、周榜、月榜
+	Retention int `json:"retention" yaml:"retention"`
+
+	// MaxSize 每个榜单保留的最大成员数，超出的低分成员由后台定期裁剪，0 表示不裁剪
+	MaxSize int64 `json:"maxSize" yaml:"maxSize"`
+
+	// TrimInterval 后台裁剪的周期，默认 1 分钟，只在 MaxSize > 0 时生效
+	TrimInterval time.Duration `json:"trimInterval" yaml:"trimInterval"`
+
+	// Location 划分自然日、周、月使用的时区，默认 time.Local
+	Location *time.Location `json:"-" yaml:"-"`
+}
+
+// Validate 验证排行榜配置的有效性
+func (c *LeaderboardConfig) Validate() error {
+	if c.Namespace == "" {
+		return fmt.Errorf("leaderboard namespace cannot be empty")
+	}
+	if strings.ContainsAny(c.Namespace, "{}") {
+		return fmt.Errorf("leaderboard namespace cannot contain '{' or '}', got: %q", c.Namespace)
+	}
+	seen := make(map[LeaderboardPeriod]bool, len(c.Periods))
+	for _, p := range c.Periods {
+		switch p {
+		case LeaderboardAllTime, LeaderboardDaily, LeaderboardWeekly, LeaderboardMonthly:
+		default:
+			return fmt.Errorf("unsupported leaderboard period: %q", p)
+		}
+		if seen[p] {
+			return fmt.Errorf("duplicate leaderboard period: %q", p)
+		}
+		seen[p] = true
+	}
+	if c.Retention < 0 {
+		return fmt.Errorf("leaderboard retention cannot be negative, got: %d", c.Retention)
+	}
+	if c.MaxSize < 0 {
+		return fmt.Errorf("leaderboard max size cannot be negative, got: %d", c.MaxSize)
+	}
+	if c.TrimInterval < 0 {
+		return fmt.Errorf("leaderboard trim interval cannot be negative, got: %v", c.TrimInterval)
+	}
+	return nil
+}
+
+// LeaderboardEntry 榜单上的一个成员
+type LeaderboardEntry struct {
+	Member string
+	Score  float64
+	Rank   int64 // 名次，从 1 开始
+}
+
+// Leaderboard 是基于 ZSet 的排行榜，一个 Leaderboard 管理同一命名空间下的多个榜单（如每个群一个榜单）。
+//   - 同分时先达到该分数的成员排在前面：ZSet 成员编码为 "{反转的毫秒时间戳}:{成员}"，
+//     Redis 对同分成员按字典序排列，反转后越早的时间戳在降序中越靠前
+//   - AddScore 在一个 Lua 脚本中同时累加配置的所有周期榜（日榜、周榜、月榜、总榜），周期榜按 Retention 自动过期
+//   - 配置 MaxSize 后，后台定期将本实例写过的榜单裁剪到 MaxSize 名以内
+//
+// 榜单键为 "{Namespace}:{board}:{周期}"，同一榜单的所有周期使用相同的 hash tag，可以在集群模式下原子更新。
+type Leaderboard struct {
+	provider Provider
+	config   LeaderboardConfig
+	logger   clog.Logger
+
+	addScript    *sessionScript
+	rankScript   *sessionScript
+	rangeScript  *sessionScript
+	countScript  *sessionScript
+	removeScript *sessionScript
+	trimScript   *sessionScript
+
+	// touched 记录上次裁剪以来本实例写过的榜单键
+	mu      sync.Mutex
+	touched map[string]struct{}
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewLeaderboard 创建排行榜，MaxSize > 0 时启动后台裁剪。
+//
+// 示例：
+//
+//	activity, err := cache.NewLeaderboard(provider, cache.LeaderboardConfig{
+//	    Namespace: "im:group_activity",
+//	    Periods:   []cache.LeaderboardPeriod{cache.LeaderboardDaily, cache.LeaderboardWeekly, cache.LeaderboardAllTime},
+//	    MaxSize:   1000,
+//	})
+//	defer activity.Close()
+//
+//	_, err = activity.AddScore(ctx, "group:42", "1001", 1)
+//	top, err := activity.Board("group:42", cache.LeaderboardWeekly).Range(ctx, 0, 10)
+func NewLeaderboard(provider Provider, cfg LeaderboardConfig) (*Leaderboard, error) {
+	if provider == nil {
+		return nil, fmt.Errorf("cache provider cannot be nil")
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if len(cfg.Periods) == 0 {
+		cfg.Periods = []LeaderboardPeriod{LeaderboardAllTime}
+	}
+	if cfg.Retention == 0 {
+		cfg.Retention = 1
+	}
+	if cfg.TrimInterval == 0 {
+		cfg.TrimInterval = time.Minute
+	}
+	if cfg.Location == nil {
+		cfg.Location = time.Local
+	}
+
+	l := &Leaderboard{
+		provider:     provider,
+		config:       cfg,
+		logger:       clog.Namespace("cache.leaderboard").With(clog.String("namespace", cfg.Namespace)),
+		addScript:    &sessionScript{source: leaderboardAddScript},
+		rankScript:   &sessionScript{source: leaderboardRankScript},
+		rangeScript:  &sessionScript{source: leaderboardRangeScript},
+		countScript:  &sessionScript{source: leaderboardCountScript},
+		removeScript: &sessionScript{source: leaderboardRemoveScript},
+		trimScript:   &sessionScript{source: leaderboardTrimScript},
+		touched:      make(map[string]struct{}),
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	if cfg.MaxSize > 0 {
+		go l.loop()
+	} else {
+		close(l.done)
+	}
+	return l, nil
+}
+
+// AddScore 将 delta 累加到成员在所有周期榜上的分数，delta 可以为负数，返回各周期榜上的最新分数。
+// 每次加分都会刷新成员的时间戳，同分时排在更早达到该分数的成员之后。
+func (l *Leaderboard) AddScore(ctx context.Context, board, member string, delta float64) (map[LeaderboardPeriod]float64, error) {
+	if err := validateLeaderboardArgs(board, member); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	keys := make([]string, 0, 2*len(l.config.Periods))
+	args := []interface{}{member, strconv.FormatFloat(delta, 'f', -1, 64), leaderboardStamp(now)}
+	for _, period := range l.config.Periods {
+		key, expireAt := l.periodKey(board, period, now)
+		keys = append(keys, key, key+":m")
+		args = append(args, expireAt)
+	}
+
+	result, err := l.addScript.eval(ctx, l.provider, keys, args...)
+	if err != nil {
+		return nil, fmt.Errorf("leaderboard %s: add score: %w", l.config.Namespace, err)
+	}
+	raw, ok := result.([]interface{})
+	if !ok || len(raw) != len(l.config.Periods) {
+		return nil, fmt.Errorf("unexpected add score script result: %v", result)
+	}
+	scores := make(map[LeaderboardPeriod]float64, len(raw))
+	for i, period := range l.config.Periods {
+		score, err := parseLeaderboardScore(raw[i])
+		if err != nil {
+			return nil, err
+		}
+		scores[period] = score
+	}
+
+	if l.config.MaxSize > 0 {
+		l.mu.Lock()
+		for i := 0; i < len(keys); i += 2 {
+			l.touched[keys[i]] = struct{}{}
+		}
+		l.mu.Unlock()
+	}
+	return scores, nil
+}
+
+// Remove 将成员从所有当前周期榜上移除，例如用户退群
+func (l *Leaderboard) Remove(ctx context.Context, board, member string) error {
+	if err := validateLeaderboardArgs(board, member); err != nil {
+		return err
+	}
+	now := time.Now()
+	keys := make([]string, 0, 2*len(l.config.Periods))
+	for _, period := range l.config.Periods {
+		key, _ := l.periodKey(board, period, now)
+		keys = append(keys, key, key+":m")
+	}
+	if _, err := l.removeScript.eval(ctx, l.provider, keys, member); err != nil {
+		return fmt.Errorf("leaderboard %s: remove member: %w", l.config.Namespace, err)
+	}
+	return nil
+}
+
+// Board 返回榜单当前周期的只读视图
+func (l *Leaderboard) Board(board string, period LeaderboardPeriod) *LeaderboardView {
+	return l.BoardAt(board, period, time.Now())
+}
+
+// BoardAt 返回榜单在 t 所属周期的只读视图，例如昨天的日榜；超出 Retention 的周期榜已过期，视图为空
+func (l *Leaderboard) BoardAt(board string, period LeaderboardPeriod, t time.Time) *LeaderboardView {
+	key, _ := l.periodKey(board, period, t)
+	return &LeaderboardView{lb: l, board: board, key: key}
+}
+
+// Trim 立即将上次裁剪以来本实例写过的榜单裁剪到 MaxSize 名以内，MaxSize 为 0 时不做任何事
+func (l *Leaderboard) Trim(ctx context.Context) error {
+	if l.config.MaxSize <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	touched := l.touched
+	l.touched = make(map[string]struct{})
+	l.mu.Unlock()
+
+	var errs []error
+	for key := range touched {
+		if _, err := l.trimScript.eval(ctx, l.provider, []string{key, key + ":m"}, l.config.MaxSize); err != nil {
+			errs = append(errs, fmt.Errorf("trim %s: %w", key, err))
+			l.mu.Lock()
+			l.touched[key] = struct{}{}
+			l.mu.Unlock()
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close 停止后台裁剪
+func (l *Leaderboard) Close() {
+	l.closeOnce.Do(func() {
+		if l.config.MaxSize > 0 {
+			close(l.stop)
+		}
+	})
+	<-l.done
+}
+
+// loop 按 TrimInterval 周期裁剪
+func (l *Leaderboard) loop() {
+	defer close(l.done)
+
+	ticker := time.NewTicker(l.config.TrimInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), leaderboardTrimTimeout)
+		if err := l.Trim(ctx); err != nil {
+			l.logger.Warn("裁剪排行榜失败，下个周期重试", clog.Err(err))
+		}
+		cancel()
+	}
+}
+
+// periodKey 返回榜单在 t 所属周期的键，以及该键的过期时间（Unix 秒，0 表示不过期）
+func (l *Leaderboard) periodKey(board string, period LeaderboardPeriod, t time.Time) (string, int64) {
+	prefix := l.config.Namespace + ":{" + board + "}:"
+	t = t.In(l.config.Location)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, l.config.Location)
+	keep := l.config.Retention + 1
+
+	switch period {
+	case LeaderboardDaily:
+		return prefix + day.Format("20060102"), day.AddDate(0, 0, keep).Unix()
+	case LeaderboardWeekly:
+		start := day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+		year, week := t.ISOWeek()
+		return prefix + fmt.Sprintf("%dW%02d", year, week), start.AddDate(0, 0, 7*keep).Unix()
+	case LeaderboardMonthly:
+		start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, l.config.Location)
+		return prefix + start.Format("200601"), start.AddDate(0, keep, 0).Unix()
+	default:
+		return prefix + string(LeaderboardAllTime), 0
+	}
+}
+
+// LeaderboardView 是某个榜单某一周期的只读视图，由 Leaderboard.Board 或 BoardAt 创建
+type LeaderboardView struct {
+	lb    *Leaderboard
+	board string
+	key   string
+}
+
+// Rank 返回成员的名次和分数，不在榜单上时返回 ErrMemberNotRanked
+func (v *LeaderboardView) Rank(ctx context.Context, member string) (*LeaderboardEntry, error) {
+	entries, err := v.Around(ctx, member, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &entries[0], nil
+}
+
+// Around 返回成员及其前后各 n 名，用于展示"我的排名"附近的榜单；成员不在榜单上时返回 ErrMemberNotRanked
+func (v *LeaderboardView) Around(ctx context.Context, member string, n int) ([]LeaderboardEntry, error) {
+	if err := validateLeaderboardArgs(v.board, member); err != nil {
+		return nil, err
+	}
+	if n < 0 {
+		return nil, fmt.Errorf("leaderboard around count cannot be negative, got: %d", n)
+	}
+	result, err := v.lb.rankScript.eval(ctx, v.lb.provider, []string{v.key, v.key + ":m"}, member, n)
+	if err != nil {
+		return nil, fmt.Errorf("leaderboard %s: rank member: %w", v.lb.config.Namespace, err)
+	}
+	raw, ok := result.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected rank script result: %v", result)
+	}
+	if len(raw) == 0 {
+		return nil, ErrMemberNotRanked
+	}
+	start, ok := raw[0].(int64)
+	if !ok || len(raw) != 2 {
+		return nil, fmt.Errorf("unexpected rank script result: %v", result)
+	}
+	return decodeLeaderboardEntries(raw[1], start)
+}
+
+// Range 按名次返回一页成员，offset 从 0 开始，适用于分页浏览榜单
+func (v *LeaderboardView) Range(ctx context.Context, offset, limit int64) ([]LeaderboardEntry, error) {
+	if offset < 0 || limit <= 0 {
+		return nil, fmt.Errorf("invalid leaderboard range: offset %d, limit %d", offset, limit)
+	}
+	result, err := v.lb.rangeScript.eval(ctx, v.lb.provider, []string{v.key}, offset, offset+limit-1)
+	if err != nil {
+		return nil, fmt.Errorf("leaderboard %s: range: %w", v.lb.config.Namespace, err)
+	}
+	return decodeLeaderboardEntries(result, offset)
+}
+
+// Count 返回榜单上的成员数
+func (v *LeaderboardView) Count(ctx context.Context) (int64, error) {
+	result, err := v.lb.countScript.eval(ctx, v.lb.provider, []string{v.key})
+	if err != nil {
+		return 0, fmt.Errorf("leaderboard %s: count: %w", v.lb.config.Namespace, err)
+	}
+	count, ok := result.(int64)
+	if !ok {
+		return 0, fmt.Errorf("unexpected count script result: %v", result)
+	}
+	return count, nil
+}
+
+// validateLeaderboardArgs 榜单名会作为 hash tag 的一部分，不能包含 '{' 或 '}'
+func validateLeaderboardArgs(board, member string) error {
+	if board == "" {
+		return fmt.Errorf("leaderboard board cannot be empty")
+	}
+	if strings.ContainsAny(board, "{}") {
+		return fmt.Errorf("leaderboard board cannot contain '{' or '}', got: %q", board)
+	}
+	if member == "" {
+		return fmt.Errorf("leaderboard member cannot be empty")
+	}
+	return nil
+}
+
+// leaderboardStamp 返回成员编码的时间戳前缀
+func leaderboardStamp(t time.Time) string {
+	return fmt.Sprintf("%0*d", leaderboardStampLen, leaderboardStampMax-t.UnixMilli())
+}
+
+// parseLeaderboardScore 解析脚本返回的分数
+func parseLeaderboardScore(v interface{}) (float64, error) {
+	s, ok := v.(string)
+	if !ok {
+		return 0, fmt.Errorf("unexpected leaderboard score: %v", v)
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// decodeLeaderboardEntries 解析 ZREVRANGE WITHSCORES 的结果，start 为第一项的 0 基名次
+func decodeLeaderboardEntries(result interface{}, start int64) ([]LeaderboardEntry, error) {
+	raw, ok := result.([]interface{})
+	if !ok || len(raw)%2 != 0 {
+		return nil, fmt.Errorf("unexpected leaderboard range result: %v", result)
+	}
+	entries := make([]LeaderboardEntry, 0, len(raw)/2)
+	for i := 0; i < len(raw); i += 2 {
+		encoded, ok := raw[i].(string)
+		if !ok || len(encoded) <= leaderboardStampLen {
+			return nil, fmt.Errorf("unexpected leaderboard member: %v", raw[i])
+		}
+		score, err := parseLeaderboardScore(raw[i+1])
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, LeaderboardEntry{
+			Member: encoded[leaderboardStampLen+1:],
+			Score:  score,
+			Rank:   start + int64(i/2) + 1,
+		})
+	}
+	return entries, nil
+}
+
+// leaderboardAddScript KEYS 为成对的 (榜单 ZSet, 成员索引 Hash)；
+// ARGV[1] 成员，ARGV[2] 增量，ARGV[3] 时间戳前缀，ARGV[4..] 每个榜单的过期时间（Unix 秒，0 表示不过期）。
+// 成员索引记录成员当前在 ZSet 中的编码，加分时替换为带新时间戳的编码。返回每个榜单上的最新分数
+const leaderboardAddScript = `
+local member = ARGV[1]
+local encoded = ARGV[3] .. ':' .. member
+local scores = {}
+for i = 1, #KEYS, 2 do
+  local zkey, hkey = KEYS[i], KEYS[i + 1]
+  local old = redis.call('HGET', hkey, member)
+  if old and old ~= encoded then
+    -- 分数以字符串原样搬到新编码上再 ZINCRBY，避免经过 Lua 数字转换丢失精度
+    local current = redis.call('ZSCORE', zkey, old)
+    redis.call('ZREM', zkey, old)
+    if current then
+      redis.call('ZADD', zkey, current, encoded)
+    end
+  end
+  table.insert(scores, redis.call('ZINCRBY', zkey, ARGV[2], encoded))
+  redis.call('HSET', hkey, member, encoded)
+  local expireAt = tonumber(ARGV[3 + (i + 1) / 2])
+  if expireAt > 0 then
+    redis.call('EXPIREAT', zkey, expireAt)
+    redis.call('EXPIREAT', hkey, expireAt)
+  end
+end
+return scores
+`
+
+// leaderboardRankScript KEYS[1] 榜单，KEYS[2] 成员索引；ARGV[1] 成员，ARGV[2] 前后各取的名数。
+// 返回 {起始名次, ZREVRANGE WITHSCORES 结果}，成员不在榜单上时返回空表
+const leaderboardRankScript = `
+local encoded = redis.call('HGET', KEYS[2], ARGV[1])
+if not encoded then
+  return {}
+end
+local rank = redis.call('ZREVRANK', KEYS[1], encoded)
+if not rank then
+  return {}
+end
+local n = tonumber(ARGV[2])
+local start = rank - n
+if start < 0 then
+  start = 0
+end
+return {start, redis.call('ZREVRANGE', KEYS[1], start, rank + n, 'WITHSCORES')}
+`
+
+// leaderboardRangeScript KEYS[1] 榜单；ARGV[1] 起始名次，ARGV[2] 结束名次（均为 0 基，包含）
+const leaderboardRangeScript = `
+return redis.call('ZREVRANGE', KEYS[1], ARGV[1], ARGV[2], 'WITHSCORES')
+`
+
+// leaderboardCountScript KEYS[1] 榜单
+const leaderboardCountScript = `
+return redis.call('ZCARD', KEYS[1])
+`
+
+// leaderboardRemoveScript KEYS 为成对的 (榜单 ZSet, 成员索引 Hash)；ARGV[1] 成员
+const leaderboardRemoveScript = `
+for i = 1, #KEYS, 2 do
+  local encoded = redis.call('HGET', KEYS[i + 1], ARGV[1])
+  if encoded then
+    redis.call('ZREM', KEYS[i], encoded)
+    redis.call('HDEL', KEYS[i + 1], ARGV[1])
+  end
+end
+return 1
+`
+
+// leaderboardTrimScript KEYS[1] 榜单，KEYS[2] 成员索引；ARGV[1] 保留的名数。
+// 同分时最晚达到该分数的成员编码字典序最小，最先被裁剪；成员从编码的第 15 个字符开始（13 位时间戳和 ':'）。
+// 返回裁剪的成员数
+const leaderboardTrimScript = `
+local excess = redis.call('ZCARD', KEYS[1]) - tonumber(ARGV[1])
+if excess <= 0 then
+  return 0
+end
+for _, encoded in ipairs(redis.call('ZRANGE', KEYS[1], 0, excess - 1)) do
+  local member = string.sub(encoded, 15)
+  if redis.call('HGET', KEYS[2], member) == encoded then
+    redis.call('HDEL', KEYS[2], member)
+  end
+end
+redis.call('ZREMRANGEBYRANK', KEYS[1], 0, excess - 1)
+return excess
+`
@@ -12,6 +12,15 @@ func WithLogger(logger clog.Logger) Option {
 	}
 }
 
+// WithHealthHandler 注册连接生命周期事件回调，可多次调用注册多个回调。
+// 回调在触发事件的 goroutine 中同步执行（命令超时事件在业务请求的 goroutine 中），不应阻塞。
+func WithHealthHandler(handler HealthHandler) Option {
+	return func(o *options) {
+		o.healthHandlers = append(o.healthHandlers, handler)
+	}
+}
+
 type options struct {
-	logger clog.Logger
+	logger         clog.Logger
+	healthHandlers []HealthHandler
 }
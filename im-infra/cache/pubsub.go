@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// MessageHandler 类型化频道的消息回调，返回的错误只记录日志和计数
+type MessageHandler[T any] func(ctx context.Context, msg T) error
+
+// ChannelOption 定义了 NewChannel 的可选配置
+type ChannelOption[T any] func(*Channel[T])
+
+// WithChannelCodec 设置频道消息的编解码函数，默认使用 JSON
+func WithChannelCodec[T any](marshal func(T) ([]byte, error), unmarshal func([]byte) (T, error)) ChannelOption[T] {
+	return func(c *Channel[T]) {
+		c.marshal = marshal
+		c.unmarshal = unmarshal
+	}
+}
+
+// Channel 是消息类型为 T 的 Redis 频道，发布时编码、订阅时解码，
+// 使业务代码不需要直接使用 go-redis 的 PubSub。
+//
+// Pub/Sub 是"至多一次"的：没有订阅者或订阅连接断开期间发布的消息会丢失，
+// 需要可靠投递的场景请使用 mq。
+type Channel[T any] struct {
+	ops       PubSubOperations
+	name      string
+	marshal   func(T) ([]byte, error)
+	unmarshal func([]byte) (T, error)
+}
+
+// NewChannel 创建一个类型化频道。
+//
+// 示例：
+//
+//	presence, err := cache.NewChannel[PresenceEvent](provider, "presence")
+//	sub, err := presence.Subscribe(ctx, func(ctx context.Context, e PresenceEvent) error {
+//	    return hub.Broadcast(e)
+//	})
+//	defer sub.Close()
+//	_, err = presence.Publish(ctx, PresenceEvent{UserID: "u1", Online: true})
+func NewChannel[T any](provider Provider, name string, opts ...ChannelOption[T]) (*Channel[T], error) {
+	if provider == nil {
+		return nil, fmt.Errorf("cache provider cannot be nil")
+	}
+	if name == "" {
+		return nil, fmt.Errorf("pubsub channel cannot be empty")
+	}
+
+	c := &Channel[T]{
+		ops:  provider.PubSub(),
+		name: name,
+		marshal: func(v T) ([]byte, error) {
+			return json.Marshal(v)
+		},
+		unmarshal: func(data []byte) (T, error) {
+			var v T
+			err := json.Unmarshal(data, &v)
+			return v, err
+		},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// Name 返回频道名
+func (c *Channel[T]) Name() string {
+	return c.name
+}
+
+// Publish 编码并发布一条消息，返回收到消息的订阅者数
+func (c *Channel[T]) Publish(ctx context.Context, msg T) (int64, error) {
+	data, err := c.marshal(msg)
+	if err != nil {
+		return 0, fmt.Errorf("channel %s: failed to encode message: %w", c.name, err)
+	}
+	return c.ops.Publish(ctx, c.name, data)
+}
+
+// Subscribe 注册消息回调。无法解码的消息不会交给 handler，计为回调失败
+func (c *Channel[T]) Subscribe(ctx context.Context, handler MessageHandler[T]) (PubSubSubscription, error) {
+	if handler == nil {
+		return nil, fmt.Errorf("pubsub handler cannot be nil")
+	}
+	return c.ops.Subscribe(ctx, c.name, func(ctx context.Context, _ string, payload string) error {
+		msg, err := c.unmarshal([]byte(payload))
+		if err != nil {
+			return fmt.Errorf("failed to decode message: %w", err)
+		}
+		return handler(ctx, msg)
+	})
+}
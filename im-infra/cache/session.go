@@ -0,0 +1,727 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+)
+
+// ErrSessionNotFound 表示会话不存在、已过期或已被替换
+var ErrSessionNotFound = errors.New("cache: session not found")
+
+// sessionCleanupTimeout 处理过期事件时清理索引的超时时间
+const sessionCleanupTimeout = 3 * time.Second
+
+// SessionConfig 定义了会话存储的键空间和过期策略
+type SessionConfig struct {
+	// Namespace 会话键的命名空间，不能为空。
+	// 会话的所有读写都通过 Lua 脚本完成，脚本不叠加 Config.KeyPrefix，需要隔离时将前缀写进 Namespace
+	Namespace string `json:"namespace" yaml:"namespace"`
+
+	// TTL 会话的滑动过期时间，每次 Touch 重新计时，默认 2 分钟，通常为网关心跳间隔的 2~3 倍
+	TTL time.Duration `json:"ttl" yaml:"ttl"`
+
+	// MaxDevices 单个用户同时在线的最大设备数，0 表示不限制。
+	// 超出时踢掉最久未活跃（最早过期）的设备，被踢的会话由 Create 返回
+	MaxDevices int `json:"maxDevices" yaml:"maxDevices"`
+
+	// ConfigureNotifications 为 true 时 SubscribeExpired 会尝试通过 CONFIG SET 开启过期事件的键空间通知（"Kx"），
+	// 托管 Redis 通常禁用 CONFIG 命令，此时需要在控制台开启并保持为 false
+	ConfigureNotifications bool `json:"configureNotifications" yaml:"configureNotifications"`
+}
+
+// Validate 验证会话配置的有效性
+func (c *SessionConfig) Validate() error {
+	if c.Namespace == "" {
+		return fmt.Errorf("session namespace cannot be empty")
+	}
+	if strings.ContainsAny(c.Namespace, "{}") {
+		return fmt.Errorf("session namespace cannot contain '{' or '}', got: %q", c.Namespace)
+	}
+	if c.TTL < 0 {
+		return fmt.Errorf("session ttl cannot be negative, got: %v", c.TTL)
+	}
+	if c.TTL > 0 && c.TTL < time.Millisecond {
+		return fmt.Errorf("session ttl must be at least 1ms, got: %v", c.TTL)
+	}
+	if c.MaxDevices < 0 {
+		return fmt.Errorf("session max devices cannot be negative, got: %d", c.MaxDevices)
+	}
+	return nil
+}
+
+// SessionSpec 描述要创建的会话
+type SessionSpec struct {
+	UserID    string // 不能包含 ':'、'{'、'}'
+	DeviceID  string // 设备标识，同一用户同一设备只保留最新的会话
+	GatewayID string // 持有该连接的网关实例
+	Metadata  map[string]string
+}
+
+// Session 是一个用户设备在某个网关实例上的连接会话
+type Session struct {
+	ID        string // 创建时随机生成，用于区分同一设备的新旧会话
+	UserID    string
+	DeviceID  string
+	GatewayID string
+	CreatedAt time.Time
+	ExpiresAt time.Time // 最近一次创建或 Touch 时计算的过期时间
+	Metadata  map[string]string
+}
+
+// SessionEvent 是会话过期事件
+type SessionEvent struct {
+	UserID   string
+	DeviceID string
+}
+
+// SessionStore 是 IM 网关的会话存储，维护 用户 → 设备 → 网关实例 的映射：
+//   - 会话：Hash "{Namespace}:{{UserID}}:s:{DeviceID}"，带滑动过期时间
+//   - 用户索引：ZSET "{Namespace}:{{UserID}}:devices"，成员为设备，分数为过期时间（毫秒）
+//   - 网关索引：ZSET "{Namespace}:gw:{GatewayID}"，成员为 "{UserID}:{DeviceID}"，分数为过期时间（毫秒）
+//
+// 同一用户的会话和用户索引带有相同的 hash tag，在单个 Lua 脚本中原子地修改，也可用于分片 Provider；
+// 网关索引在用户脚本执行后单独更新，只作为 InvalidateGateway 的线索，过期成员按分数清理。
+type SessionStore struct {
+	provider Provider
+	config   SessionConfig
+	logger   clog.Logger
+	ttlMs    int64
+
+	createScript         *sessionScript
+	touchScript          *sessionScript
+	getScript            *sessionScript
+	invalidateScript     *sessionScript
+	invalidateUserScript *sessionScript
+	listScript           *sessionScript
+	pruneScript          *sessionScript
+	gatewayAddScript     *sessionScript
+	gatewayRemoveScript  *sessionScript
+	gatewayListScript    *sessionScript
+}
+
+// NewSessionStore 创建会话存储。
+//
+// 示例：
+//
+//	sessions, err := cache.NewSessionStore(provider, cache.SessionConfig{
+//	    Namespace:  "im:session",
+//	    TTL:        90 * time.Second,
+//	    MaxDevices: 3,
+//	})
+//	session, kicked, err := sessions.Create(ctx, cache.SessionSpec{UserID: "1001", DeviceID: "ios", GatewayID: "gw-1"})
+//	ok, err := sessions.Touch(ctx, session) // 每次心跳续期
+func NewSessionStore(provider Provider, cfg SessionConfig) (*SessionStore, error) {
+	if provider == nil {
+		return nil, fmt.Errorf("cache provider cannot be nil")
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.TTL == 0 {
+		cfg.TTL = 2 * time.Minute
+	}
+
+	return &SessionStore{
+		provider:             provider,
+		config:               cfg,
+		logger:               clog.Namespace("cache.session").With(clog.String("namespace", cfg.Namespace)),
+		ttlMs:                cfg.TTL.Milliseconds(),
+		createScript:         &sessionScript{source: createSessionScript},
+		touchScript:          &sessionScript{source: touchSessionScript},
+		getScript:            &sessionScript{source: getSessionScript},
+		invalidateScript:     &sessionScript{source: invalidateSessionScript},
+		invalidateUserScript: &sessionScript{source: invalidateUserSessionsScript},
+		listScript:           &sessionScript{source: listSessionsScript},
+		pruneScript:          &sessionScript{source: pruneSessionScript},
+		gatewayAddScript:     &sessionScript{source: gatewayAddScript},
+		gatewayRemoveScript:  &sessionScript{source: gatewayRemoveScript},
+		gatewayListScript:    &sessionScript{source: gatewayListScript},
+	}, nil
+}
+
+// Create 为设备创建新会话，返回新会话以及被替换或踢出的旧会话：
+// 同一设备上已有的会话被替换，设备数超过 MaxDevices 时最久未活跃的设备被踢出。
+// 调用方应通知旧会话所在的网关断开连接。
+func (s *SessionStore) Create(ctx context.Context, spec SessionSpec) (*Session, []*Session, error) {
+	if err := validateSessionUser(spec.UserID); err != nil {
+		return nil, nil, err
+	}
+	if spec.DeviceID == "" {
+		return nil, nil, fmt.Errorf("session device id cannot be empty")
+	}
+	if spec.GatewayID == "" {
+		return nil, nil, fmt.Errorf("session gateway id cannot be empty")
+	}
+
+	id, err := newSessionID()
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	nowMs := now.UnixMilli()
+	session := &Session{
+		ID:        id,
+		UserID:    spec.UserID,
+		DeviceID:  spec.DeviceID,
+		GatewayID: spec.GatewayID,
+		CreatedAt: time.UnixMilli(nowMs),
+		ExpiresAt: time.UnixMilli(nowMs + s.ttlMs),
+		Metadata:  spec.Metadata,
+	}
+
+	args := []interface{}{s.sessionKeyPrefix(spec.UserID), spec.DeviceID, nowMs, s.ttlMs, s.config.MaxDevices}
+	args = append(args, encodeSession(session)...)
+	result, err := s.createScript.eval(ctx, s.provider,
+		[]string{s.sessionKey(spec.UserID, spec.DeviceID), s.userKey(spec.UserID)}, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create session: %w", err)
+	}
+	removed, err := decodeSessions(result)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 网关索引在用户脚本之后更新：先移除旧会话，避免同一网关上的同一设备被误删
+	for _, old := range removed {
+		s.removeFromGateway(ctx, old)
+	}
+	if err := s.addToGateway(ctx, session); err != nil {
+		s.logger.Warn("更新网关索引失败", clog.String("gateway", session.GatewayID), clog.Err(err))
+	}
+
+	s.logger.Debug("会话已创建",
+		clog.String("user", session.UserID),
+		clog.String("device", session.DeviceID),
+		clog.String("gateway", session.GatewayID),
+		clog.Int("removed", len(removed)))
+	return session, removed, nil
+}
+
+// Touch 续期会话并更新 session.ExpiresAt，会话已过期或已被同一设备上的新会话替换时返回 false，
+// 此时网关应断开对应的连接
+func (s *SessionStore) Touch(ctx context.Context, session *Session) (bool, error) {
+	if err := validateSessionUser(session.UserID); err != nil {
+		return false, err
+	}
+	nowMs := time.Now().UnixMilli()
+	result, err := s.touchScript.eval(ctx, s.provider,
+		[]string{s.sessionKey(session.UserID, session.DeviceID), s.userKey(session.UserID)},
+		session.DeviceID, nowMs, s.ttlMs, session.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to touch session: %w", err)
+	}
+	if n, ok := result.(int64); ok && n == 0 {
+		return false, nil
+	}
+	session.ExpiresAt = time.UnixMilli(nowMs + s.ttlMs)
+	if err := s.addToGateway(ctx, session); err != nil {
+		s.logger.Warn("更新网关索引失败", clog.String("gateway", session.GatewayID), clog.Err(err))
+	}
+	return true, nil
+}
+
+// Get 返回设备当前的会话，不存在或已过期时返回 ErrSessionNotFound
+func (s *SessionStore) Get(ctx context.Context, userID, deviceID string) (*Session, error) {
+	if err := validateSessionUser(userID); err != nil {
+		return nil, err
+	}
+	result, err := s.getScript.eval(ctx, s.provider, []string{s.sessionKey(userID, deviceID)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+	fields, ok := result.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected get script result: %v", result)
+	}
+	if len(fields) == 0 {
+		return nil, ErrSessionNotFound
+	}
+	return parseSessionFields(fields)
+}
+
+// ListByUser 返回用户在所有设备上的会话，顺序为过期时间从早到晚，并顺带清理用户索引中已过期的设备
+func (s *SessionStore) ListByUser(ctx context.Context, userID string) ([]*Session, error) {
+	if err := validateSessionUser(userID); err != nil {
+		return nil, err
+	}
+	result, err := s.listScript.eval(ctx, s.provider, []string{s.userKey(userID)},
+		s.sessionKeyPrefix(userID), time.Now().UnixMilli())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	return decodeSessions(result)
+}
+
+// Invalidate 使会话失效。只有设备当前的会话 ID 与 session.ID 一致时才删除，
+// 避免网关处理旧连接断开时误删同一设备上的新会话。会话已不存在时返回 false
+func (s *SessionStore) Invalidate(ctx context.Context, session *Session) (bool, error) {
+	removed, err := s.invalidate(ctx, session.UserID, session.DeviceID, session.ID, "")
+	return removed != nil, err
+}
+
+// InvalidateDevice 无条件地使设备当前的会话失效（如用户主动登出、后台踢人），返回被删除的会话，会话不存在时返回 ErrSessionNotFound
+func (s *SessionStore) InvalidateDevice(ctx context.Context, userID, deviceID string) (*Session, error) {
+	removed, err := s.invalidate(ctx, userID, deviceID, "", "")
+	if err != nil {
+		return nil, err
+	}
+	if removed == nil {
+		return nil, ErrSessionNotFound
+	}
+	return removed, nil
+}
+
+// InvalidateUser 使用户在所有设备上的会话失效，返回被删除的会话
+func (s *SessionStore) InvalidateUser(ctx context.Context, userID string) ([]*Session, error) {
+	if err := validateSessionUser(userID); err != nil {
+		return nil, err
+	}
+	result, err := s.invalidateUserScript.eval(ctx, s.provider, []string{s.userKey(userID)}, s.sessionKeyPrefix(userID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to invalidate user sessions: %w", err)
+	}
+	removed, err := decodeSessions(result)
+	if err != nil {
+		return nil, err
+	}
+	for _, session := range removed {
+		s.removeFromGateway(ctx, session)
+	}
+	return removed, nil
+}
+
+// InvalidateGateway 使仍由该网关实例持有的所有会话失效，用于网关宕机后的清理，返回被删除的会话。
+// 已迁移到其他网关的会话不受影响
+func (s *SessionStore) InvalidateGateway(ctx context.Context, gatewayID string) ([]*Session, error) {
+	if gatewayID == "" {
+		return nil, fmt.Errorf("session gateway id cannot be empty")
+	}
+	result, err := s.gatewayListScript.eval(ctx, s.provider, []string{s.gatewayKey(gatewayID)}, time.Now().UnixMilli())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list gateway sessions: %w", err)
+	}
+	members, ok := result.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected gateway script result: %v", result)
+	}
+
+	var removed []*Session
+	for _, member := range members {
+		userID, deviceID, ok := strings.Cut(fmt.Sprint(member), ":")
+		if !ok {
+			continue
+		}
+		session, err := s.invalidate(ctx, userID, deviceID, "", gatewayID)
+		if err != nil {
+			return removed, err
+		}
+		if session != nil {
+			removed = append(removed, session)
+		}
+	}
+
+	s.logger.Info("网关会话已清理", clog.String("gateway", gatewayID), clog.Int("sessions", len(removed)))
+	return removed, nil
+}
+
+// SubscribeExpired 订阅会话过期事件，用于维护在线状态，需要 Provider 实现 KeyspaceNotifier 且
+// notify-keyspace-events 包含 "Kx"（见 ConfigureNotifications）。
+//
+// 注意：
+//   - Redis 在访问过期键或后台采样时才删除并发出事件，事件可能比 ExpiresAt 晚数秒
+//   - 通知基于 Pub/Sub，每个订阅者都会收到全部事件，连接断开期间的事件会丢失；通常只在在线状态服务中订阅
+//   - Invalidate 等主动删除不会触发该事件
+//   - 收到事件时同一设备可能已经创建了新会话，需要时用 Get 确认
+func (s *SessionStore) SubscribeExpired(ctx context.Context, handler func(SessionEvent)) (KeyspaceSubscription, error) {
+	notifier, ok := s.provider.(KeyspaceNotifier)
+	if !ok {
+		return nil, fmt.Errorf("cache provider does not support keyspace notifications")
+	}
+	if s.config.ConfigureNotifications {
+		if err := notifier.EnableKeyspaceNotifications(ctx, "Kx"); err != nil {
+			return nil, err
+		}
+	}
+
+	prefix := s.config.Namespace + ":{"
+	return notifier.SubscribeKeyspace(ctx, prefix+"*}:s:*", func(key, event string) {
+		if event != "expired" {
+			return
+		}
+		userID, deviceID, ok := strings.Cut(strings.TrimPrefix(key, prefix), "}:s:")
+		if !ok {
+			return
+		}
+
+		// 从用户索引中移除已过期的设备，设备上已有新会话时保留
+		cleanupCtx, cancel := context.WithTimeout(context.Background(), sessionCleanupTimeout)
+		_, err := s.pruneScript.eval(cleanupCtx, s.provider,
+			[]string{s.sessionKey(userID, deviceID), s.userKey(userID)}, deviceID)
+		cancel()
+		if err != nil {
+			s.logger.Warn("清理过期会话索引失败", clog.String("user", userID), clog.String("device", deviceID), clog.Err(err))
+		}
+
+		handler(SessionEvent{UserID: userID, DeviceID: deviceID})
+	})
+}
+
+// invalidate 删除设备当前的会话，sessionID 或 gatewayID 非空时只在匹配时删除，返回被删除的会话
+func (s *SessionStore) invalidate(ctx context.Context, userID, deviceID, sessionID, gatewayID string) (*Session, error) {
+	if err := validateSessionUser(userID); err != nil {
+		return nil, err
+	}
+	result, err := s.invalidateScript.eval(ctx, s.provider,
+		[]string{s.sessionKey(userID, deviceID), s.userKey(userID)}, deviceID, sessionID, gatewayID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to invalidate session: %w", err)
+	}
+	fields, ok := result.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected invalidate script result: %v", result)
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	session, err := parseSessionFields(fields)
+	if err != nil {
+		return nil, err
+	}
+	s.removeFromGateway(ctx, session)
+	return session, nil
+}
+
+// addToGateway 将会话加入其网关索引，分数为过期时间
+func (s *SessionStore) addToGateway(ctx context.Context, session *Session) error {
+	_, err := s.gatewayAddScript.eval(ctx, s.provider, []string{s.gatewayKey(session.GatewayID)},
+		session.UserID+":"+session.DeviceID, session.ExpiresAt.UnixMilli(), time.Now().UnixMilli())
+	return err
+}
+
+// removeFromGateway 将会话从其网关索引中移除，失败时只记录日志，残留的成员会在过期后按分数清理
+func (s *SessionStore) removeFromGateway(ctx context.Context, session *Session) {
+	_, err := s.gatewayRemoveScript.eval(ctx, s.provider, []string{s.gatewayKey(session.GatewayID)},
+		session.UserID+":"+session.DeviceID, session.ExpiresAt.UnixMilli())
+	if err != nil {
+		s.logger.Warn("更新网关索引失败", clog.String("gateway", session.GatewayID), clog.Err(err))
+	}
+}
+
+func (s *SessionStore) sessionKeyPrefix(userID string) string {
+	return s.config.Namespace + ":{" + userID + "}:s:"
+}
+
+func (s *SessionStore) sessionKey(userID, deviceID string) string {
+	return s.sessionKeyPrefix(userID) + deviceID
+}
+
+func (s *SessionStore) userKey(userID string) string {
+	return s.config.Namespace + ":{" + userID + "}:devices"
+}
+
+func (s *SessionStore) gatewayKey(gatewayID string) string {
+	return s.config.Namespace + ":gw:" + gatewayID
+}
+
+// validateSessionUser 用户 ID 会作为 hash tag 和网关索引成员的一部分，不能包含分隔符
+func validateSessionUser(userID string) error {
+	if userID == "" {
+		return fmt.Errorf("session user id cannot be empty")
+	}
+	if strings.ContainsAny(userID, ":{}") {
+		return fmt.Errorf("session user id cannot contain ':', '{' or '}', got: %q", userID)
+	}
+	return nil
+}
+
+func newSessionID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate session id: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// sessionMetadataPrefix 元数据在 Hash 中的字段前缀
+const sessionMetadataPrefix = "m:"
+
+// encodeSession 将会话编码为 HSET 的字段和值
+func encodeSession(session *Session) []interface{} {
+	fields := []interface{}{
+		"id", session.ID,
+		"user", session.UserID,
+		"device", session.DeviceID,
+		"gateway", session.GatewayID,
+		"created", session.CreatedAt.UnixMilli(),
+		"expires", session.ExpiresAt.UnixMilli(),
+	}
+	for k, v := range session.Metadata {
+		fields = append(fields, sessionMetadataPrefix+k, v)
+	}
+	return fields
+}
+
+// parseSession 从 Hash 的字段解析会话
+func parseSession(fields map[string]string) (*Session, error) {
+	session := &Session{
+		ID:        fields["id"],
+		UserID:    fields["user"],
+		DeviceID:  fields["device"],
+		GatewayID: fields["gateway"],
+	}
+	created, err := strconv.ParseInt(fields["created"], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid session created time %q: %w", fields["created"], err)
+	}
+	expires, err := strconv.ParseInt(fields["expires"], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid session expire time %q: %w", fields["expires"], err)
+	}
+	session.CreatedAt = time.UnixMilli(created)
+	session.ExpiresAt = time.UnixMilli(expires)
+	for k, v := range fields {
+		if name, ok := strings.CutPrefix(k, sessionMetadataPrefix); ok {
+			if session.Metadata == nil {
+				session.Metadata = make(map[string]string)
+			}
+			session.Metadata[name] = v
+		}
+	}
+	return session, nil
+}
+
+// parseSessionFields 解析脚本返回的 HGETALL 结果
+func parseSessionFields(raw []interface{}) (*Session, error) {
+	fields := make(map[string]string, len(raw)/2)
+	for i := 0; i+1 < len(raw); i += 2 {
+		fields[fmt.Sprint(raw[i])] = fmt.Sprint(raw[i+1])
+	}
+	return parseSession(fields)
+}
+
+// decodeSessions 解析脚本返回的多个 HGETALL 结果
+func decodeSessions(result interface{}) ([]*Session, error) {
+	list, ok := result.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected session script result: %v", result)
+	}
+	sessions := make([]*Session, 0, len(list))
+	for _, item := range list {
+		raw, ok := item.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unexpected session script result: %v", item)
+		}
+		session, err := parseSessionFields(raw)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+// sessionScript 缓存已加载脚本的 SHA，Redis 重启或执行 SCRIPT FLUSH 后自动重新加载
+type sessionScript struct {
+	source string
+	mu     sync.Mutex
+	sha    string
+}
+
+func (sc *sessionScript) eval(ctx context.Context, provider Provider, keys []string, args ...interface{}) (interface{}, error) {
+	sha, err := sc.load(ctx, provider, false)
+	if err != nil {
+		return nil, err
+	}
+	result, err := provider.Script().EvalSha(ctx, sha, keys, args...)
+	if err != nil && strings.Contains(err.Error(), "NOSCRIPT") {
+		if sha, err = sc.load(ctx, provider, true); err != nil {
+			return nil, err
+		}
+		result, err = provider.Script().EvalSha(ctx, sha, keys, args...)
+	}
+	return result, err
+}
+
+func (sc *sessionScript) load(ctx context.Context, provider Provider, reload bool) (string, error) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.sha != "" && !reload {
+		return sc.sha, nil
+	}
+	sha, err := provider.Script().ScriptLoad(ctx, sc.source)
+	if err != nil {
+		return "", err
+	}
+	sc.sha = sha
+	return sha, nil
+}
+
+// refreshIndexExpiry 将索引的过期时间设为最晚过期成员的分数，索引为空时删除
+const refreshIndexExpiry = `
+local function refresh(key)
+  local last = redis.call('ZRANGE', key, -1, -1, 'WITHSCORES')
+  if #last == 0 then
+    redis.call('DEL', key)
+  else
+    redis.call('PEXPIREAT', key, math.floor(tonumber(last[2])))
+  end
+end
+`
+
+// createSessionScript KEYS[1] 会话键，KEYS[2] 用户索引；
+// ARGV[1] 会话键前缀，ARGV[2] 设备，ARGV[3] 当前毫秒，ARGV[4] TTL 毫秒，ARGV[5] 设备上限，ARGV[6..] 会话字段。
+// 返回被替换和被踢出的会话
+const createSessionScript = refreshIndexExpiry + `
+local now = tonumber(ARGV[3])
+local ttl = tonumber(ARGV[4])
+local max = tonumber(ARGV[5])
+redis.call('ZREMRANGEBYSCORE', KEYS[2], '-inf', now)
+local removed = {}
+local old = redis.call('HGETALL', KEYS[1])
+if #old > 0 then
+  table.insert(removed, old)
+  redis.call('DEL', KEYS[1])
+end
+redis.call('ZREM', KEYS[2], ARGV[2])
+if max > 0 then
+  local excess = redis.call('ZCARD', KEYS[2]) - max + 1
+  if excess > 0 then
+    for _, device in ipairs(redis.call('ZRANGE', KEYS[2], 0, excess - 1)) do
+      local key = ARGV[1] .. device
+      local fields = redis.call('HGETALL', key)
+      if #fields > 0 then
+        table.insert(removed, fields)
+        redis.call('DEL', key)
+      end
+      redis.call('ZREM', KEYS[2], device)
+    end
+  end
+end
+local fields = {}
+for i = 6, #ARGV do
+  table.insert(fields, ARGV[i])
+end
+redis.call('HSET', KEYS[1], unpack(fields))
+redis.call('PEXPIRE', KEYS[1], ttl)
+redis.call('ZADD', KEYS[2], now + ttl, ARGV[2])
+refresh(KEYS[2])
+return removed
+`
+
+// touchSessionScript KEYS[1] 会话键，KEYS[2] 用户索引；ARGV[1] 设备，ARGV[2] 当前毫秒，ARGV[3] TTL 毫秒，ARGV[4] 会话 ID。
+// 会话不存在或 ID 不一致时返回 0
+const touchSessionScript = refreshIndexExpiry + `
+local id = redis.call('HGET', KEYS[1], 'id')
+if not id then
+  redis.call('ZREM', KEYS[2], ARGV[1])
+  refresh(KEYS[2])
+  return 0
+end
+if id ~= ARGV[4] then
+  return 0
+end
+local expires = tonumber(ARGV[2]) + tonumber(ARGV[3])
+redis.call('HSET', KEYS[1], 'expires', expires)
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+redis.call('ZADD', KEYS[2], expires, ARGV[1])
+refresh(KEYS[2])
+return 1
+`
+
+// getSessionScript KEYS[1] 会话键。与其他脚本一样不叠加 KeyPrefix
+const getSessionScript = `return redis.call('HGETALL', KEYS[1])`
+
+// invalidateSessionScript KEYS[1] 会话键，KEYS[2] 用户索引；ARGV[1] 设备，ARGV[2] 会话 ID，ARGV[3] 网关，为空表示不校验。
+// 返回被删除会话的字段，未删除时返回空数组
+const invalidateSessionScript = refreshIndexExpiry + `
+local fields = redis.call('HGETALL', KEYS[1])
+if #fields == 0 then
+  redis.call('ZREM', KEYS[2], ARGV[1])
+  refresh(KEYS[2])
+  return {}
+end
+local session = {}
+for i = 1, #fields, 2 do
+  session[fields[i]] = fields[i + 1]
+end
+if (ARGV[2] ~= '' and session['id'] ~= ARGV[2]) or (ARGV[3] ~= '' and session['gateway'] ~= ARGV[3]) then
+  return {}
+end
+redis.call('DEL', KEYS[1])
+redis.call('ZREM', KEYS[2], ARGV[1])
+refresh(KEYS[2])
+return fields
+`
+
+// invalidateUserSessionsScript KEYS[1] 用户索引；ARGV[1] 会话键前缀。返回被删除的会话
+const invalidateUserSessionsScript = `
+local removed = {}
+for _, device in ipairs(redis.call('ZRANGE', KEYS[1], 0, -1)) do
+  local key = ARGV[1] .. device
+  local fields = redis.call('HGETALL', key)
+  if #fields > 0 then
+    table.insert(removed, fields)
+    redis.call('DEL', key)
+  end
+end
+redis.call('DEL', KEYS[1])
+return removed
+`
+
+// listSessionsScript KEYS[1] 用户索引；ARGV[1] 会话键前缀，ARGV[2] 当前毫秒。返回用户的所有会话
+const listSessionsScript = `
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[2])
+local result = {}
+for _, device in ipairs(redis.call('ZRANGE', KEYS[1], 0, -1)) do
+  local fields = redis.call('HGETALL', ARGV[1] .. device)
+  if #fields == 0 then
+    redis.call('ZREM', KEYS[1], device)
+  else
+    table.insert(result, fields)
+  end
+end
+return result
+`
+
+// pruneSessionScript KEYS[1] 会话键，KEYS[2] 用户索引；ARGV[1] 设备。会话已不存在时从用户索引中移除设备
+const pruneSessionScript = refreshIndexExpiry + `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+  redis.call('ZREM', KEYS[2], ARGV[1])
+  refresh(KEYS[2])
+end
+return 0
+`
+
+// gatewayAddScript KEYS[1] 网关索引；ARGV[1] 成员，ARGV[2] 过期毫秒，ARGV[3] 当前毫秒
+const gatewayAddScript = refreshIndexExpiry + `
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[3])
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+refresh(KEYS[1])
+return 0
+`
+
+// gatewayRemoveScript KEYS[1] 网关索引；ARGV[1] 成员，ARGV[2] 会话的过期毫秒。
+// 只移除分数不晚于该会话的成员，避免误删同一设备在同一网关上的新会话
+const gatewayRemoveScript = refreshIndexExpiry + `
+local score = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if score and tonumber(score) <= tonumber(ARGV[2]) then
+  redis.call('ZREM', KEYS[1], ARGV[1])
+  refresh(KEYS[1])
+end
+return 0
+`
+
+// gatewayListScript KEYS[1] 网关索引；ARGV[1] 当前毫秒。清理过期成员后返回所有成员
+const gatewayListScript = `
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[1])
+return redis.call('ZRANGE', KEYS[1], 0, -1)
+`
@@ -0,0 +1,744 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/cache/internal"
+	"github.com/ceyewan/gochat/im-infra/clog"
+)
+
+var (
+	// ErrShardUnavailable 表示键所在的分片已被健康检查判定为不可用。
+	// 未开启 EjectUnhealthy 时，访问这些键直接返回该错误，而不是等待读写超时。
+	ErrShardUnavailable = errors.New("cache: shard unavailable")
+	// ErrNoShardAvailable 表示哈希环上没有可用的分片。
+	ErrNoShardAvailable = errors.New("cache: no shard available")
+	// ErrCrossShard 表示一次 Lua 脚本调用中的键分布在多个分片上，可以用 hash tag 让它们落在同一分片。
+	ErrCrossShard = errors.New("cache: keys span multiple shards")
+)
+
+// 客户端分片的默认参数
+const (
+	defaultVirtualNodes          = 160
+	defaultShardCheckInterval    = 5 * time.Second
+	defaultShardCheckTimeout     = time.Second
+	defaultShardFailureThreshold = 3
+
+	// lockKeyPrefix 锁键去除 KeyPrefix 后的前缀，迁移时跳过这些键
+	lockKeyPrefix = "lock:"
+)
+
+// ShardConfig 定义一个 Redis 分片。
+type ShardConfig struct {
+	// Name 分片名，参与一致性哈希。更换实例地址时保持 Name 不变，键的分布就不会变化。为空时使用 Addr
+	Name string `json:"name" yaml:"name"`
+	// Addr Redis 实例地址，格式为 "host:port"
+	Addr string `json:"addr" yaml:"addr"`
+	// Password Redis 密码，为空时使用 ShardedConfig.Base.Password
+	Password string `json:"password" yaml:"password"`
+	// DB Redis 数据库编号
+	DB int `json:"db" yaml:"db"`
+	// Weight 权重，虚拟节点数按权重倍增，默认 1。内存更大的实例可以设置更高的权重
+	Weight int `json:"weight" yaml:"weight"`
+}
+
+// ShardedConfig 是客户端分片的配置。
+type ShardedConfig struct {
+	// Base 所有分片共用的连接池、超时、KeyPrefix 和过期策略配置，其中的 Addr 和 DB 被忽略
+	Base Config `json:"base" yaml:"base"`
+
+	// Shards 分片列表，至少一个
+	Shards []ShardConfig `json:"shards" yaml:"shards"`
+
+	// VirtualNodes 每个权重单位在哈希环上的虚拟节点数，默认 160
+	VirtualNodes int `json:"virtualNodes" yaml:"virtualNodes"`
+
+	// LockShard 分布式锁固定使用的分片名，默认第一个分片。
+	// 锁不参与哈希路由、健康剔除和迁移，避免分片变化时同一把锁在两个实例上同时被持有
+	LockShard string `json:"lockShard" yaml:"lockShard"`
+
+	// HealthCheckInterval 分片健康检查的周期，默认 5s
+	HealthCheckInterval time.Duration `json:"healthCheckInterval" yaml:"healthCheckInterval"`
+
+	// HealthCheckTimeout 单次健康检查 Ping 的超时时间，默认 1s
+	HealthCheckTimeout time.Duration `json:"healthCheckTimeout" yaml:"healthCheckTimeout"`
+
+	// FailureThreshold 连续失败多少次后判定分片不可用，默认 3；一次成功即恢复
+	FailureThreshold int `json:"failureThreshold" yaml:"failureThreshold"`
+
+	// EjectUnhealthy 为 true 时不可用的分片从哈希环上摘除，其上的键临时路由到相邻分片（表现为缓存未命中）；
+	// 为 false 时访问不可用分片上的键直接返回 ErrShardUnavailable
+	EjectUnhealthy bool `json:"ejectUnhealthy" yaml:"ejectUnhealthy"`
+}
+
+// Validate 验证分片配置的有效性，各分片的连接配置在创建时按 Config.Validate 校验
+func (c *ShardedConfig) Validate() error {
+	if len(c.Shards) == 0 {
+		return fmt.Errorf("sharded cache requires at least one shard")
+	}
+	names := make(map[string]bool, len(c.Shards))
+	for _, shard := range c.Shards {
+		if err := shard.validate(); err != nil {
+			return err
+		}
+		name := shard.withDefaults().Name
+		if names[name] {
+			return fmt.Errorf("duplicate shard name: %s", name)
+		}
+		names[name] = true
+	}
+	if c.LockShard != "" && !names[c.LockShard] {
+		return fmt.Errorf("lock shard %q is not in the shard list", c.LockShard)
+	}
+	if c.VirtualNodes < 0 {
+		return fmt.Errorf("virtual nodes cannot be negative, got: %d", c.VirtualNodes)
+	}
+	if c.HealthCheckInterval < 0 || c.HealthCheckTimeout < 0 {
+		return fmt.Errorf("health check interval and timeout cannot be negative")
+	}
+	if c.FailureThreshold < 0 {
+		return fmt.Errorf("failure threshold cannot be negative, got: %d", c.FailureThreshold)
+	}
+	return nil
+}
+
+func (s ShardConfig) validate() error {
+	if s.Addr == "" {
+		return fmt.Errorf("shard %q address cannot be empty", s.Name)
+	}
+	if s.Weight < 0 {
+		return fmt.Errorf("shard %q weight cannot be negative, got: %d", s.Name, s.Weight)
+	}
+	return nil
+}
+
+func (s ShardConfig) withDefaults() ShardConfig {
+	if s.Name == "" {
+		s.Name = s.Addr
+	}
+	if s.Weight == 0 {
+		s.Weight = 1
+	}
+	return s
+}
+
+// ShardStatus 描述一个分片的当前状态。
+type ShardStatus struct {
+	Name   string
+	Addr   string
+	Weight int
+	// Healthy 健康检查最近的判定结果
+	Healthy bool
+	// InRing 是否参与路由，开启 EjectUnhealthy 时不可用的分片不参与
+	InRing bool
+	// LastError 最近一次健康检查失败的错误
+	LastError string
+	// Stats 该分片的连接池统计
+	Stats PoolStats
+}
+
+// RebalanceOptions 控制键迁移的行为。
+type RebalanceOptions struct {
+	// BatchSize 每次 SCAN 的 COUNT 提示值，默认 500
+	BatchSize int64
+	// DryRun 只统计需要迁移的键数，不执行迁移
+	DryRun bool
+}
+
+// ShardedProvider 是基于一致性哈希的客户端分片 Provider，适用于单个 Redis 容量不够、又不值得引入 Cluster 的场景。
+//
+// 除锁以外，所有操作按键（或键中的 hash tag "{...}"）路由到分片：
+//   - 多键操作（Del、Exists、IncrByBatch）按分片拆分后分别执行，不保证跨分片的原子性
+//   - Lua 脚本的所有键必须落在同一分片，否则返回 ErrCrossShard；ScriptLoad 会在所有分片（包括之后加入的）上加载
+//   - Keys() 的扫描和批量删除作用于所有分片
+//   - Lock() 和 PubSub() 固定使用 LockShard
+type ShardedProvider interface {
+	Provider
+
+	// ShardFor 返回 key 当前路由到的分片名，没有可用分片时返回空字符串
+	ShardFor(key string) string
+	// Shards 返回所有分片的状态
+	Shards() []ShardStatus
+	// AddShard 加入一个分片。加入后约 Weight/总权重 的键会路由到新分片，
+	// 这些键在原分片上的值在 Rebalance 之前表现为未命中
+	AddShard(ctx context.Context, shard ShardConfig) error
+	// RemoveShard 移除一个分片，将其上的键迁移到新的所属分片后关闭连接。不能移除 LockShard
+	RemoveShard(ctx context.Context, name string) error
+	// Rebalance 扫描所有分片，将不属于当前分片的键迁移到所属分片，返回迁移的键数。
+	// 目标分片上已存在的键不会被覆盖，因为路由切换后写入的值比迁移的值更新
+	Rebalance(ctx context.Context, opts RebalanceOptions) (int64, error)
+}
+
+// shard 是哈希环上的一个分片
+type shard struct {
+	name     string
+	addr     string
+	weight   int
+	provider Provider
+	keys     internal.KeyOperations
+
+	healthy  atomic.Bool
+	lastErr  atomic.Value // string
+	failures int          // 连续失败次数，只在健康检查 goroutine 中访问
+}
+
+// hashRing 是按哈希值排序的虚拟节点，创建后只读
+type hashRing struct {
+	hashes []uint64
+	shards []*shard
+}
+
+func newHashRing(shards []*shard, virtualNodes int) *hashRing {
+	type node struct {
+		hash  uint64
+		shard *shard
+	}
+	var nodes []node
+	for _, s := range shards {
+		for i := 0; i < virtualNodes*s.weight; i++ {
+			nodes = append(nodes, node{hash: hashKey(s.name + "#" + strconv.Itoa(i)), shard: s})
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].hash < nodes[j].hash })
+
+	r := &hashRing{
+		hashes: make([]uint64, len(nodes)),
+		shards: make([]*shard, len(nodes)),
+	}
+	for i, n := range nodes {
+		r.hashes[i] = n.hash
+		r.shards[i] = n.shard
+	}
+	return r
+}
+
+// lookup 返回 key 顺时针方向的第一个虚拟节点所属的分片，环为空时返回 nil
+func (r *hashRing) lookup(key string) *shard {
+	if len(r.hashes) == 0 {
+		return nil
+	}
+	h := hashKey(hashTag(key))
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.shards[i]
+}
+
+// hashKey 使用 FNV-1a 加 fmix64 终结函数，改善相似键（如 user:1、user:2）在环上的分布
+func hashKey(s string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// hashTag 与 Redis Cluster 的规则一致：键中包含非空的 "{...}" 时只用第一对花括号内的部分计算哈希，
+// 使 "{conv_42}:members" 和 "{conv_42}:messages" 这样相关的键落在同一分片
+func hashTag(key string) string {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			return key[start+1 : start+1+end]
+		}
+	}
+	return key
+}
+
+// shardedProvider 是 ShardedProvider 的实现
+type shardedProvider struct {
+	config  ShardedConfig
+	options []Option
+	logger  clog.Logger
+
+	// mu 保护分片列表和已加载的脚本，路由只读取原子指针中的哈希环，不需要加锁
+	mu      sync.RWMutex
+	list    []*shard
+	byName  map[string]*shard
+	lock    *shard
+	scripts map[string]string // sha1 -> 脚本内容，分片加入时补加载
+
+	full   atomic.Pointer[hashRing] // 所有分片，用于迁移
+	active atomic.Pointer[hashRing] // 参与路由的分片
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewSharded 创建一个客户端分片的 cache Provider，每个分片按 Base 配置独立建立连接池。
+// opts 对每个分片生效，WithHealthHandler 注册的回调会收到所有分片的连接事件（通过 HealthEvent.Addr 区分）。
+func NewSharded(ctx context.Context, config *ShardedConfig, opts ...Option) (ShardedProvider, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	options := &options{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	logger := options.logger
+	if logger == nil {
+		logger = clog.Namespace("cache")
+	}
+
+	cfg := *config
+	if cfg.VirtualNodes == 0 {
+		cfg.VirtualNodes = defaultVirtualNodes
+	}
+	if cfg.HealthCheckInterval == 0 {
+		cfg.HealthCheckInterval = defaultShardCheckInterval
+	}
+	if cfg.HealthCheckTimeout == 0 {
+		cfg.HealthCheckTimeout = defaultShardCheckTimeout
+	}
+	if cfg.FailureThreshold == 0 {
+		cfg.FailureThreshold = defaultShardFailureThreshold
+	}
+
+	p := &shardedProvider{
+		config:  cfg,
+		options: opts,
+		logger:  logger,
+		byName:  make(map[string]*shard, len(cfg.Shards)),
+		scripts: make(map[string]string),
+	}
+	for _, sc := range cfg.Shards {
+		s, err := p.newShard(ctx, sc.withDefaults())
+		if err != nil {
+			for _, created := range p.list {
+				_ = created.provider.Close()
+			}
+			return nil, err
+		}
+		p.list = append(p.list, s)
+		p.byName[s.name] = s
+	}
+
+	p.lock = p.list[0]
+	if cfg.LockShard != "" {
+		p.lock = p.byName[cfg.LockShard]
+	}
+	p.rebuildRingsLocked()
+
+	checkCtx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		p.healthLoop(checkCtx)
+	}()
+
+	logger.Info("创建分片 cache 实例",
+		clog.Strings("shards", p.names()),
+		clog.String("lockShard", p.lock.name),
+		clog.Int("virtualNodes", cfg.VirtualNodes),
+		clog.Bool("ejectUnhealthy", cfg.EjectUnhealthy))
+	return p, nil
+}
+
+// newShard 按 Base 配置创建分片的连接
+func (p *shardedProvider) newShard(ctx context.Context, sc ShardConfig) (*shard, error) {
+	cfg := p.config.Base
+	cfg.Addr = sc.Addr
+	cfg.DB = sc.DB
+	if sc.Password != "" {
+		cfg.Password = sc.Password
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("shard %s: %w", sc.Name, err)
+	}
+
+	opts := append(append([]Option{}, p.options...), WithLogger(p.logger.With(clog.String("shard", sc.Name))))
+	provider, err := New(ctx, &cfg, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("shard %s: %w", sc.Name, err)
+	}
+
+	s := &shard{
+		name:     sc.Name,
+		addr:     sc.Addr,
+		weight:   sc.Weight,
+		provider: provider,
+		keys:     provider.(*providerWrapper).client.Keys(),
+	}
+	s.healthy.Store(true)
+	return s, nil
+}
+
+// rebuildRingsLocked 按当前分片列表和健康状态重建哈希环，调用方需持有 mu
+func (p *shardedProvider) rebuildRingsLocked() {
+	active := p.list
+	if p.config.EjectUnhealthy {
+		active = make([]*shard, 0, len(p.list))
+		for _, s := range p.list {
+			if s.healthy.Load() {
+				active = append(active, s)
+			}
+		}
+	}
+	p.full.Store(newHashRing(p.list, p.config.VirtualNodes))
+	p.active.Store(newHashRing(active, p.config.VirtualNodes))
+}
+
+// snapshot 返回当前分片列表的副本
+func (p *shardedProvider) snapshot() []*shard {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return append([]*shard(nil), p.list...)
+}
+
+func (p *shardedProvider) names() []string {
+	names := make([]string, 0, len(p.list))
+	for _, s := range p.list {
+		names = append(names, s.name)
+	}
+	return names
+}
+
+// route 返回 key 所属的分片
+func (p *shardedProvider) route(key string) (*shard, error) {
+	s := p.active.Load().lookup(key)
+	if s == nil {
+		return nil, ErrNoShardAvailable
+	}
+	if !s.healthy.Load() {
+		return nil, fmt.Errorf("%w: %s", ErrShardUnavailable, s.name)
+	}
+	return s, nil
+}
+
+// group 按所属分片对键分组
+func (p *shardedProvider) group(keys []string) (map[*shard][]string, error) {
+	groups := make(map[*shard][]string)
+	for _, key := range keys {
+		s, err := p.route(key)
+		if err != nil {
+			return nil, err
+		}
+		groups[s] = append(groups[s], key)
+	}
+	return groups, nil
+}
+
+// healthLoop 周期性地检查所有分片
+func (p *shardedProvider) healthLoop(ctx context.Context) {
+	ticker := time.NewTicker(p.config.HealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.checkShards(ctx)
+		}
+	}
+}
+
+// checkShards Ping 每个分片，健康状态变化且开启 EjectUnhealthy 时重建哈希环
+func (p *shardedProvider) checkShards(ctx context.Context) {
+	changed := false
+	for _, s := range p.snapshot() {
+		pingCtx, cancel := context.WithTimeout(ctx, p.config.HealthCheckTimeout)
+		err := s.provider.Ping(pingCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		if p.recordCheck(s, err) {
+			changed = true
+		}
+	}
+	if changed && p.config.EjectUnhealthy {
+		p.mu.Lock()
+		p.rebuildRingsLocked()
+		p.mu.Unlock()
+	}
+}
+
+// recordCheck 记录一次健康检查的结果，返回健康状态是否发生变化
+func (p *shardedProvider) recordCheck(s *shard, err error) bool {
+	if err == nil {
+		s.failures = 0
+		if s.healthy.CompareAndSwap(false, true) {
+			p.logger.Info("分片恢复可用", clog.String("shard", s.name), clog.String("addr", s.addr))
+			return true
+		}
+		return false
+	}
+
+	s.lastErr.Store(err.Error())
+	s.failures++
+	if s.failures >= p.config.FailureThreshold && s.healthy.CompareAndSwap(true, false) {
+		p.logger.Warn("分片不可用",
+			clog.String("shard", s.name),
+			clog.String("addr", s.addr),
+			clog.Int("failures", s.failures),
+			clog.Bool("ejected", p.config.EjectUnhealthy),
+			clog.Err(err))
+		return true
+	}
+	return false
+}
+
+// ShardFor 返回 key 当前路由到的分片名
+func (p *shardedProvider) ShardFor(key string) string {
+	if s := p.active.Load().lookup(key); s != nil {
+		return s.name
+	}
+	return ""
+}
+
+// Shards 返回所有分片的状态
+func (p *shardedProvider) Shards() []ShardStatus {
+	active := p.active.Load()
+	inRing := make(map[*shard]bool, len(active.shards))
+	for _, s := range active.shards {
+		inRing[s] = true
+	}
+
+	shards := p.snapshot()
+	statuses := make([]ShardStatus, 0, len(shards))
+	for _, s := range shards {
+		lastErr, _ := s.lastErr.Load().(string)
+		statuses = append(statuses, ShardStatus{
+			Name:      s.name,
+			Addr:      s.addr,
+			Weight:    s.weight,
+			Healthy:   s.healthy.Load(),
+			InRing:    inRing[s],
+			LastError: lastErr,
+			Stats:     s.provider.Stats(),
+		})
+	}
+	return statuses
+}
+
+// AddShard 加入一个分片，并加载之前通过 ScriptLoad 加载过的脚本
+func (p *shardedProvider) AddShard(ctx context.Context, sc ShardConfig) error {
+	if err := sc.validate(); err != nil {
+		return err
+	}
+	sc = sc.withDefaults()
+
+	p.mu.RLock()
+	_, exists := p.byName[sc.Name]
+	p.mu.RUnlock()
+	if exists {
+		return fmt.Errorf("duplicate shard name: %s", sc.Name)
+	}
+
+	s, err := p.newShard(ctx, sc)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, exists := p.byName[sc.Name]; exists {
+		_ = s.provider.Close()
+		return fmt.Errorf("duplicate shard name: %s", sc.Name)
+	}
+	for _, script := range p.scripts {
+		if _, err := s.provider.Script().ScriptLoad(ctx, script); err != nil {
+			_ = s.provider.Close()
+			return fmt.Errorf("shard %s: %w", sc.Name, err)
+		}
+	}
+
+	p.list = append(p.list, s)
+	p.byName[s.name] = s
+	p.rebuildRingsLocked()
+
+	p.logger.Info("加入分片", clog.String("shard", s.name), clog.String("addr", s.addr), clog.Int("weight", s.weight))
+	return nil
+}
+
+// RemoveShard 移除一个分片，迁移其上的键后关闭连接。迁移失败时分片仍会被移除，未迁移的键视为丢失的缓存
+func (p *shardedProvider) RemoveShard(ctx context.Context, name string) error {
+	p.mu.Lock()
+	s, ok := p.byName[name]
+	switch {
+	case !ok:
+		p.mu.Unlock()
+		return fmt.Errorf("shard not found: %s", name)
+	case s == p.lock:
+		p.mu.Unlock()
+		return fmt.Errorf("cannot remove lock shard: %s", name)
+	}
+	delete(p.byName, name)
+	for i, item := range p.list {
+		if item == s {
+			p.list = append(p.list[:i:i], p.list[i+1:]...)
+			break
+		}
+	}
+	p.rebuildRingsLocked()
+	p.mu.Unlock()
+
+	moved, err := p.migrate(ctx, s, p.full.Load(), RebalanceOptions{})
+	if err != nil {
+		p.logger.Error("迁移待移除分片上的键失败", clog.String("shard", name), clog.Int64("moved", moved), clog.Err(err))
+	} else {
+		p.logger.Info("移除分片", clog.String("shard", name), clog.Int64("moved", moved))
+	}
+	return errors.Join(err, s.provider.Close())
+}
+
+// Rebalance 将所有分片上不属于该分片的键迁移到所属分片
+func (p *shardedProvider) Rebalance(ctx context.Context, opts RebalanceOptions) (int64, error) {
+	ring := p.full.Load()
+	var moved int64
+	for _, s := range p.snapshot() {
+		n, err := p.migrate(ctx, s, ring, opts)
+		moved += n
+		if err != nil {
+			p.logger.Error("迁移键失败", clog.String("shard", s.name), clog.Int64("moved", moved), clog.Err(err))
+			return moved, fmt.Errorf("shard %s: %w", s.name, err)
+		}
+	}
+	p.logger.Info("分片迁移完成", clog.Int64("moved", moved), clog.Bool("dryRun", opts.DryRun))
+	return moved, nil
+}
+
+// migrate 将 src 上按 ring 不属于它的键通过 DUMP/RESTORE 迁移到所属分片，锁键不迁移
+func (p *shardedProvider) migrate(ctx context.Context, src *shard, ring *hashRing, opts RebalanceOptions) (int64, error) {
+	var moved int64
+	it := src.keys.ScanKeys(ctx, "*", opts.BatchSize)
+	for it.Next(ctx) {
+		key := it.Val()
+		if strings.HasPrefix(key, lockKeyPrefix) {
+			continue
+		}
+		dst := ring.lookup(key)
+		if dst == nil || dst == src {
+			continue
+		}
+		if opts.DryRun {
+			moved++
+			continue
+		}
+
+		value, ttl, err := src.keys.Dump(ctx, key)
+		if errors.Is(err, ErrCacheMiss) {
+			// 扫描之后已过期或被删除
+			continue
+		}
+		if err != nil {
+			return moved, err
+		}
+		if _, err := dst.keys.Restore(ctx, key, value, ttl); err != nil {
+			return moved, err
+		}
+		if err := src.provider.String().Del(ctx, key); err != nil {
+			return moved, err
+		}
+		moved++
+	}
+	return moved, it.Err()
+}
+
+// Provider 接口实现
+func (p *shardedProvider) String() StringOperations {
+	return &shardedStringOperations{p: p}
+}
+
+func (p *shardedProvider) Hash() HashOperations {
+	return &shardedHashOperations{p: p}
+}
+
+func (p *shardedProvider) Set() SetOperations {
+	return &shardedSetOperations{p: p}
+}
+
+func (p *shardedProvider) ZSet() ZSetOperations {
+	return &shardedZSetOperations{p: p}
+}
+
+// Lock 固定使用 LockShard，不随分片变化和健康剔除而改变
+func (p *shardedProvider) Lock() LockOperations {
+	return p.lock.provider.Lock()
+}
+
+// PubSub 频道不属于任何键，发布和订阅都固定在 LockShard 上，保证双方使用同一个实例
+func (p *shardedProvider) PubSub() PubSubOperations {
+	return p.lock.provider.PubSub()
+}
+
+func (p *shardedProvider) Bloom() BloomFilterOperations {
+	return &shardedBloomOperations{p: p}
+}
+
+func (p *shardedProvider) Script() ScriptingOperations {
+	return &shardedScriptingOperations{p: p}
+}
+
+func (p *shardedProvider) Keys() KeyOperations {
+	return &shardedKeyOperations{p: p}
+}
+
+// TTLPolicy 所有分片共用 Base 中的过期策略
+func (p *shardedProvider) TTLPolicy(name string) (time.Duration, error) {
+	return p.lock.provider.TTLPolicy(name)
+}
+
+// Stats 汇总所有分片的连接池统计，任一分片不可用时 Healthy 为 false，LastPingLatency 取最大值
+func (p *shardedProvider) Stats() PoolStats {
+	total := PoolStats{Healthy: true}
+	for _, s := range p.snapshot() {
+		stats := s.provider.Stats()
+		total.Hits += stats.Hits
+		total.Misses += stats.Misses
+		total.Timeouts += stats.Timeouts
+		total.TotalConns += stats.TotalConns
+		total.IdleConns += stats.IdleConns
+		total.StaleConns += stats.StaleConns
+		total.Dials += stats.Dials
+		total.DialErrors += stats.DialErrors
+		total.CommandTimeouts += stats.CommandTimeouts
+		total.Reconnects += stats.Reconnects
+		total.Failovers += stats.Failovers
+		total.Healthy = total.Healthy && stats.Healthy && s.healthy.Load()
+		if stats.LastPingLatency > total.LastPingLatency {
+			total.LastPingLatency = stats.LastPingLatency
+		}
+	}
+	return total
+}
+
+// Ping 检查所有分片的连接
+func (p *shardedProvider) Ping(ctx context.Context) error {
+	var errs []error
+	for _, s := range p.snapshot() {
+		if err := s.provider.Ping(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("shard %s: %w", s.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close 停止健康检查并关闭所有分片的连接
+func (p *shardedProvider) Close() error {
+	p.cancel()
+	p.wg.Wait()
+
+	var errs []error
+	for _, s := range p.snapshot() {
+		if err := s.provider.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("shard %s: %w", s.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,551 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// shardedStringOperations 按键路由字符串操作，多键操作按分片拆分
+type shardedStringOperations struct {
+	p *shardedProvider
+}
+
+func (s *shardedStringOperations) Get(ctx context.Context, key string) (string, error) {
+	sh, err := s.p.route(key)
+	if err != nil {
+		return "", err
+	}
+	return sh.provider.String().Get(ctx, key)
+}
+
+func (s *shardedStringOperations) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	sh, err := s.p.route(key)
+	if err != nil {
+		return err
+	}
+	return sh.provider.String().Set(ctx, key, value, expiration)
+}
+
+func (s *shardedStringOperations) Del(ctx context.Context, keys ...string) error {
+	groups, err := s.p.group(keys)
+	if err != nil {
+		return err
+	}
+	for sh, shardKeys := range groups {
+		if err := sh.provider.String().Del(ctx, shardKeys...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *shardedStringOperations) Incr(ctx context.Context, key string) (int64, error) {
+	sh, err := s.p.route(key)
+	if err != nil {
+		return 0, err
+	}
+	return sh.provider.String().Incr(ctx, key)
+}
+
+func (s *shardedStringOperations) Decr(ctx context.Context, key string) (int64, error) {
+	sh, err := s.p.route(key)
+	if err != nil {
+		return 0, err
+	}
+	return sh.provider.String().Decr(ctx, key)
+}
+
+func (s *shardedStringOperations) IncrWithMax(ctx context.Context, key string, delta, max int64) (int64, bool, error) {
+	sh, err := s.p.route(key)
+	if err != nil {
+		return 0, false, err
+	}
+	return sh.provider.String().IncrWithMax(ctx, key, delta, max)
+}
+
+func (s *shardedStringOperations) DecrWithMin(ctx context.Context, key string, delta, min int64) (int64, bool, error) {
+	sh, err := s.p.route(key)
+	if err != nil {
+		return 0, false, err
+	}
+	return sh.provider.String().DecrWithMin(ctx, key, delta, min)
+}
+
+func (s *shardedStringOperations) IncrByBatch(ctx context.Context, deltas map[string]int64, expiration time.Duration) error {
+	groups := make(map[*shard]map[string]int64)
+	for key, delta := range deltas {
+		sh, err := s.p.route(key)
+		if err != nil {
+			return err
+		}
+		if groups[sh] == nil {
+			groups[sh] = make(map[string]int64)
+		}
+		groups[sh][key] = delta
+	}
+	// 各分片独立执行，一个分片失败不影响其他分片，失败的键合并到同一个 BatchError 中
+	failed := make(map[string]error)
+	for sh, shardDeltas := range groups {
+		err := sh.provider.String().IncrByBatch(ctx, shardDeltas, expiration)
+		var batchErr *BatchError
+		switch {
+		case err == nil:
+		case errors.As(err, &batchErr):
+			for key, keyErr := range batchErr.Failed {
+				failed[key] = keyErr
+			}
+		default:
+			for key := range shardDeltas {
+				failed[key] = err
+			}
+		}
+	}
+	if len(failed) > 0 {
+		return &BatchError{Failed: failed}
+	}
+	return nil
+}
+
+func (s *shardedStringOperations) Exists(ctx context.Context, keys ...string) (int64, error) {
+	groups, err := s.p.group(keys)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for sh, shardKeys := range groups {
+		n, err := sh.provider.String().Exists(ctx, shardKeys...)
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+func (s *shardedStringOperations) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error) {
+	sh, err := s.p.route(key)
+	if err != nil {
+		return false, err
+	}
+	return sh.provider.String().SetNX(ctx, key, value, expiration)
+}
+
+func (s *shardedStringOperations) GetSet(ctx context.Context, key string, value interface{}) (string, error) {
+	sh, err := s.p.route(key)
+	if err != nil {
+		return "", err
+	}
+	return sh.provider.String().GetSet(ctx, key, value)
+}
+
+// shardedHashOperations 按键路由哈希操作
+type shardedHashOperations struct {
+	p *shardedProvider
+}
+
+func (h *shardedHashOperations) HGet(ctx context.Context, key, field string) (string, error) {
+	sh, err := h.p.route(key)
+	if err != nil {
+		return "", err
+	}
+	return sh.provider.Hash().HGet(ctx, key, field)
+}
+
+func (h *shardedHashOperations) HSet(ctx context.Context, key, field string, value interface{}) error {
+	sh, err := h.p.route(key)
+	if err != nil {
+		return err
+	}
+	return sh.provider.Hash().HSet(ctx, key, field, value)
+}
+
+func (h *shardedHashOperations) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	sh, err := h.p.route(key)
+	if err != nil {
+		return nil, err
+	}
+	return sh.provider.Hash().HGetAll(ctx, key)
+}
+
+func (h *shardedHashOperations) HDel(ctx context.Context, key string, fields ...string) error {
+	sh, err := h.p.route(key)
+	if err != nil {
+		return err
+	}
+	return sh.provider.Hash().HDel(ctx, key, fields...)
+}
+
+func (h *shardedHashOperations) HExists(ctx context.Context, key, field string) (bool, error) {
+	sh, err := h.p.route(key)
+	if err != nil {
+		return false, err
+	}
+	return sh.provider.Hash().HExists(ctx, key, field)
+}
+
+func (h *shardedHashOperations) HLen(ctx context.Context, key string) (int64, error) {
+	sh, err := h.p.route(key)
+	if err != nil {
+		return 0, err
+	}
+	return sh.provider.Hash().HLen(ctx, key)
+}
+
+// shardedSetOperations 按键路由集合操作
+type shardedSetOperations struct {
+	p *shardedProvider
+}
+
+func (s *shardedSetOperations) SAdd(ctx context.Context, key string, members ...interface{}) error {
+	sh, err := s.p.route(key)
+	if err != nil {
+		return err
+	}
+	return sh.provider.Set().SAdd(ctx, key, members...)
+}
+
+func (s *shardedSetOperations) SRem(ctx context.Context, key string, members ...interface{}) error {
+	sh, err := s.p.route(key)
+	if err != nil {
+		return err
+	}
+	return sh.provider.Set().SRem(ctx, key, members...)
+}
+
+func (s *shardedSetOperations) SMembers(ctx context.Context, key string) ([]string, error) {
+	sh, err := s.p.route(key)
+	if err != nil {
+		return nil, err
+	}
+	return sh.provider.Set().SMembers(ctx, key)
+}
+
+func (s *shardedSetOperations) SIsMember(ctx context.Context, key string, member interface{}) (bool, error) {
+	sh, err := s.p.route(key)
+	if err != nil {
+		return false, err
+	}
+	return sh.provider.Set().SIsMember(ctx, key, member)
+}
+
+func (s *shardedSetOperations) SCard(ctx context.Context, key string) (int64, error) {
+	sh, err := s.p.route(key)
+	if err != nil {
+		return 0, err
+	}
+	return sh.provider.Set().SCard(ctx, key)
+}
+
+// shardedZSetOperations 按键路由有序集合操作
+type shardedZSetOperations struct {
+	p *shardedProvider
+}
+
+func (z *shardedZSetOperations) ZAdd(ctx context.Context, key string, members ...*ZMember) error {
+	sh, err := z.p.route(key)
+	if err != nil {
+		return err
+	}
+	return sh.provider.ZSet().ZAdd(ctx, key, members...)
+}
+
+func (z *shardedZSetOperations) ZRange(ctx context.Context, key string, start, stop int64) ([]*ZMember, error) {
+	sh, err := z.p.route(key)
+	if err != nil {
+		return nil, err
+	}
+	return sh.provider.ZSet().ZRange(ctx, key, start, stop)
+}
+
+func (z *shardedZSetOperations) ZRevRange(ctx context.Context, key string, start, stop int64) ([]*ZMember, error) {
+	sh, err := z.p.route(key)
+	if err != nil {
+		return nil, err
+	}
+	return sh.provider.ZSet().ZRevRange(ctx, key, start, stop)
+}
+
+func (z *shardedZSetOperations) ZRangeByScore(ctx context.Context, key string, min, max float64) ([]*ZMember, error) {
+	sh, err := z.p.route(key)
+	if err != nil {
+		return nil, err
+	}
+	return sh.provider.ZSet().ZRangeByScore(ctx, key, min, max)
+}
+
+func (z *shardedZSetOperations) ZRem(ctx context.Context, key string, members ...interface{}) error {
+	sh, err := z.p.route(key)
+	if err != nil {
+		return err
+	}
+	return sh.provider.ZSet().ZRem(ctx, key, members...)
+}
+
+func (z *shardedZSetOperations) ZRemRangeByRank(ctx context.Context, key string, start, stop int64) error {
+	sh, err := z.p.route(key)
+	if err != nil {
+		return err
+	}
+	return sh.provider.ZSet().ZRemRangeByRank(ctx, key, start, stop)
+}
+
+func (z *shardedZSetOperations) ZCard(ctx context.Context, key string) (int64, error) {
+	sh, err := z.p.route(key)
+	if err != nil {
+		return 0, err
+	}
+	return sh.provider.ZSet().ZCard(ctx, key)
+}
+
+func (z *shardedZSetOperations) ZCount(ctx context.Context, key string, min, max float64) (int64, error) {
+	sh, err := z.p.route(key)
+	if err != nil {
+		return 0, err
+	}
+	return sh.provider.ZSet().ZCount(ctx, key, min, max)
+}
+
+func (z *shardedZSetOperations) ZScore(ctx context.Context, key string, member string) (float64, error) {
+	sh, err := z.p.route(key)
+	if err != nil {
+		return 0, err
+	}
+	return sh.provider.ZSet().ZScore(ctx, key, member)
+}
+
+func (z *shardedZSetOperations) ZSetExpire(ctx context.Context, key string, expiration time.Duration) error {
+	sh, err := z.p.route(key)
+	if err != nil {
+		return err
+	}
+	return sh.provider.ZSet().ZSetExpire(ctx, key, expiration)
+}
+
+// shardedBloomOperations 按键路由布隆过滤器操作
+type shardedBloomOperations struct {
+	p *shardedProvider
+}
+
+func (b *shardedBloomOperations) BFAdd(ctx context.Context, key string, item string) error {
+	sh, err := b.p.route(key)
+	if err != nil {
+		return err
+	}
+	return sh.provider.Bloom().BFAdd(ctx, key, item)
+}
+
+func (b *shardedBloomOperations) BFExists(ctx context.Context, key string, item string) (bool, error) {
+	sh, err := b.p.route(key)
+	if err != nil {
+		return false, err
+	}
+	return sh.provider.Bloom().BFExists(ctx, key, item)
+}
+
+func (b *shardedBloomOperations) BFReserve(ctx context.Context, key string, errorRate float64, capacity uint64) error {
+	sh, err := b.p.route(key)
+	if err != nil {
+		return err
+	}
+	return sh.provider.Bloom().BFReserve(ctx, key, errorRate, capacity)
+}
+
+// shardedScriptingOperations 按脚本的键路由，脚本在所有分片上加载
+type shardedScriptingOperations struct {
+	p *shardedProvider
+}
+
+// EvalSha 在键所属的分片上执行脚本，键分布在多个分片时返回 ErrCrossShard，没有键时在 LockShard 上执行。
+// 注意：与 Provider 一致，脚本中的键不会自动添加 KeyPrefix。
+func (s *shardedScriptingOperations) EvalSha(ctx context.Context, sha1 string, keys []string, args ...interface{}) (interface{}, error) {
+	target := s.p.lock
+	if len(keys) > 0 {
+		groups, err := s.p.group(keys)
+		if err != nil {
+			return nil, err
+		}
+		if len(groups) > 1 {
+			return nil, ErrCrossShard
+		}
+		for sh := range groups {
+			target = sh
+		}
+	}
+	return target.provider.Script().EvalSha(ctx, sha1, keys, args...)
+}
+
+// ScriptLoad 在所有分片上加载脚本，并记录下来供之后加入的分片加载
+func (s *shardedScriptingOperations) ScriptLoad(ctx context.Context, script string) (string, error) {
+	s.p.mu.Lock()
+	defer s.p.mu.Unlock()
+
+	var sha string
+	for _, sh := range s.p.list {
+		loaded, err := sh.provider.Script().ScriptLoad(ctx, script)
+		if err != nil {
+			return "", err
+		}
+		sha = loaded
+	}
+	s.p.scripts[sha] = script
+	return sha, nil
+}
+
+// ScriptExists 只有在所有分片上都存在的脚本才返回 true
+func (s *shardedScriptingOperations) ScriptExists(ctx context.Context, sha1 ...string) ([]bool, error) {
+	result := make([]bool, len(sha1))
+	for i := range result {
+		result[i] = true
+	}
+	for _, sh := range s.p.snapshot() {
+		exists, err := sh.provider.Script().ScriptExists(ctx, sha1...)
+		if err != nil {
+			return nil, err
+		}
+		for i, ok := range exists {
+			result[i] = result[i] && ok
+		}
+	}
+	return result, nil
+}
+
+// shardedKeyOperations 在所有分片上扫描和批量删除
+type shardedKeyOperations struct {
+	p *shardedProvider
+}
+
+// ScanKeys 依次扫描每个分片
+func (k *shardedKeyOperations) ScanKeys(ctx context.Context, pattern string, batch int64) KeyIterator {
+	return &shardedKeyIterator{shards: k.p.snapshot(), pattern: pattern, batch: batch}
+}
+
+// DeleteByPattern 在每个分片上删除匹配 pattern 的键，返回删除的总键数。OnProgress 按分片分别回调
+func (k *shardedKeyOperations) DeleteByPattern(ctx context.Context, pattern string, opts DeleteOptions) (int64, error) {
+	if pattern == "" {
+		return 0, ErrEmptyPattern
+	}
+	var total int64
+	for _, sh := range k.p.snapshot() {
+		n, err := sh.provider.Keys().DeleteByPattern(ctx, pattern, opts)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// DeleteByPrefix 在每个分片上删除以 prefix 开头的键，返回删除的总键数
+func (k *shardedKeyOperations) DeleteByPrefix(ctx context.Context, prefix string, opts DeleteOptions) (int64, error) {
+	if prefix == "" {
+		return 0, ErrEmptyPattern
+	}
+	var total int64
+	for _, sh := range k.p.snapshot() {
+		n, err := sh.provider.Keys().DeleteByPrefix(ctx, prefix, opts)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// TTL 返回键的剩余过期时间
+func (k *shardedKeyOperations) TTL(ctx context.Context, key string) (time.Duration, error) {
+	sh, err := k.p.route(key)
+	if err != nil {
+		return 0, err
+	}
+	return sh.provider.Keys().TTL(ctx, key)
+}
+
+// Persist 移除键的过期时间
+func (k *shardedKeyOperations) Persist(ctx context.Context, key string) (bool, error) {
+	sh, err := k.p.route(key)
+	if err != nil {
+		return false, err
+	}
+	return sh.provider.Keys().Persist(ctx, key)
+}
+
+// ExpireAt 设置键在 at 时刻过期
+func (k *shardedKeyOperations) ExpireAt(ctx context.Context, key string, at time.Time) (bool, error) {
+	sh, err := k.p.route(key)
+	if err != nil {
+		return false, err
+	}
+	return sh.provider.Keys().ExpireAt(ctx, key, at)
+}
+
+// UpdateTTLByPattern 在每个分片上调整匹配 pattern 的键的过期时间，返回修改的总键数。OnProgress 按分片分别回调
+func (k *shardedKeyOperations) UpdateTTLByPattern(ctx context.Context, pattern string, opts TTLUpdateOptions) (int64, error) {
+	if pattern == "" {
+		return 0, ErrEmptyPattern
+	}
+	var total int64
+	for _, sh := range k.p.snapshot() {
+		n, err := sh.provider.Keys().UpdateTTLByPattern(ctx, pattern, opts)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// UpdateTTLByPrefix 在每个分片上调整以 prefix 开头的键的过期时间，返回修改的总键数
+func (k *shardedKeyOperations) UpdateTTLByPrefix(ctx context.Context, prefix string, opts TTLUpdateOptions) (int64, error) {
+	if prefix == "" {
+		return 0, ErrEmptyPattern
+	}
+	var total int64
+	for _, sh := range k.p.snapshot() {
+		n, err := sh.provider.Keys().UpdateTTLByPrefix(ctx, prefix, opts)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// shardedKeyIterator 依次迭代每个分片的 SCAN 结果，某个分片出错时停止
+type shardedKeyIterator struct {
+	shards  []*shard
+	pattern string
+	batch   int64
+
+	current KeyIterator
+	err     error
+}
+
+func (i *shardedKeyIterator) Next(ctx context.Context) bool {
+	for i.err == nil {
+		if i.current == nil {
+			if len(i.shards) == 0 {
+				return false
+			}
+			i.current = i.shards[0].provider.Keys().ScanKeys(ctx, i.pattern, i.batch)
+			i.shards = i.shards[1:]
+		}
+		if i.current.Next(ctx) {
+			return true
+		}
+		i.err = i.current.Err()
+		i.current = nil
+	}
+	return false
+}
+
+func (i *shardedKeyIterator) Val() string {
+	if i.current == nil {
+		return ""
+	}
+	return i.current.Val()
+}
+
+func (i *shardedKeyIterator) Err() error {
+	return i.err
+}
@@ -0,0 +1,435 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/ceyewan/gochat/im-infra/coord/lock"
+)
+
+var (
+	// ErrWarmerStarted 表示预热器已启动，不能再注册任务或重复启动
+	ErrWarmerStarted = errors.New("cache: warmer already started")
+
+	// ErrWarmTaskNotFound 表示指定模式的预热任务未注册
+	ErrWarmTaskNotFound = errors.New("cache: warm task not found")
+)
+
+const (
+	// warmOnceMinInterval 只预热一次的任务默认的跨实例去重窗口，覆盖滚动发布期间各实例先后启动的时间
+	warmOnceMinInterval = 5 * time.Minute
+	// warmLimitRetry 限流拒绝后重新申请的间隔
+	warmLimitRetry = 50 * time.Millisecond
+)
+
+// WarmKeysFunc 返回需要预热的键，如热门群组的成员列表键
+type WarmKeysFunc func(ctx context.Context) ([]string, error)
+
+// WarmLoader 从数据源加载一个键并写入缓存，写入的数据结构和过期时间由加载函数决定
+type WarmLoader func(ctx context.Context, key string) error
+
+// WarmLimitFunc 在加载每个键之前调用，返回 false 时等待后重试，用于限制预热对数据源的压力。
+// ratelimit 组件依赖 cache，因此以函数的形式接入：
+//
+//	cache.WithWarmRateLimit(func(ctx context.Context, key string) (bool, error) {
+//	    return limiter.Allow(ctx, "cache.warmer", "warmup")
+//	})
+type WarmLimitFunc func(ctx context.Context, key string) (bool, error)
+
+// WarmTask 是一个预热任务
+type WarmTask struct {
+	// Pattern 任务的唯一标识，通常为预热的键模式，如 "group:members:*"
+	Pattern string
+	// Keys 返回需要预热的键
+	Keys WarmKeysFunc
+	// Load 加载单个键
+	Load WarmLoader
+	// RefreshInterval 周期刷新的间隔，0 表示只在 Start 时预热一次
+	RefreshInterval time.Duration
+	// MinInterval 同一分段两次预热的最小间隔，跨实例生效。
+	// 默认为 RefreshInterval 的 90%，只预热一次的任务默认 5 分钟，使滚动发布时只有第一个启动的实例执行预热
+	MinInterval time.Duration
+}
+
+// WarmerConfig 定义了预热器的分段和加锁策略
+type WarmerConfig struct {
+	// Namespace 分段锁和预热标记的命名空间，默认 "warmer"
+	Namespace string `json:"namespace" yaml:"namespace"`
+
+	// Ranges 每个任务的键按哈希划分的分段数，每个分段同一时间只由一个实例预热，默认 16
+	Ranges int `json:"ranges" yaml:"ranges"`
+
+	// LockTTL 分段锁的过期时间，实例在预热中途崩溃时锁最多保留该时长，默认 30s
+	LockTTL time.Duration `json:"lockTTL" yaml:"lockTTL"`
+
+	// LoadTimeout 加载单个键的超时时间，0 表示只受 ctx 控制
+	LoadTimeout time.Duration `json:"loadTimeout" yaml:"loadTimeout"`
+}
+
+// Validate 验证预热器配置的有效性
+func (c *WarmerConfig) Validate() error {
+	if c.Ranges < 0 {
+		return fmt.Errorf("warmer ranges cannot be negative, got: %d", c.Ranges)
+	}
+	if c.LockTTL < 0 {
+		return fmt.Errorf("warmer lock ttl cannot be negative, got: %v", c.LockTTL)
+	}
+	if c.LoadTimeout < 0 {
+		return fmt.Errorf("warmer load timeout cannot be negative, got: %v", c.LoadTimeout)
+	}
+	return nil
+}
+
+// WarmerOption 定制预热器的函数
+type WarmerOption func(*Warmer)
+
+// WithWarmLock 使用 coord 分布式锁协调各实例的分段，未设置时使用 cache 自身的 Redis 锁
+func WithWarmLock(locker lock.DistributedLock) WarmerOption {
+	return func(w *Warmer) {
+		w.locker = locker
+	}
+}
+
+// WithWarmRateLimit 设置加载每个键之前的限流函数
+func WithWarmRateLimit(limit WarmLimitFunc) WarmerOption {
+	return func(w *Warmer) {
+		w.limit = limit
+	}
+}
+
+// WarmerStats 预热器的累计统计
+type WarmerStats struct {
+	Runs          int64 // 执行预热的分段数
+	KeysLoaded    int64 // 加载成功的键数
+	LoadErrors    int64 // 加载失败的键数
+	RangesSkipped int64 // 因其他实例持有锁或刚预热过而跳过的分段数
+	Throttled     int64 // 被限流拒绝的次数
+}
+
+// Warmer 在启动时和周期性地预热缓存，避免发布后热点数据全部未命中击穿数据源。
+//   - 每个任务的键按哈希划分为 Ranges 个分段，实例对分段加锁后才预热，多个实例并行分担而不重复
+//   - 分段预热成功后写入标记，MinInterval 内其他实例跳过该分段
+//   - 每个键加载前经过限流函数，控制对数据源的压力
+type Warmer struct {
+	provider Provider
+	config   WarmerConfig
+	logger   clog.Logger
+	locker   lock.DistributedLock
+	limit    WarmLimitFunc
+
+	mu      sync.Mutex
+	tasks   map[string]*WarmTask
+	started bool
+
+	stop      chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+
+	runs          atomic.Int64
+	keysLoaded    atomic.Int64
+	loadErrors    atomic.Int64
+	rangesSkipped atomic.Int64
+	throttled     atomic.Int64
+}
+
+// NewWarmer 创建一个缓存预热器。
+//
+// 示例：
+//
+//	warmer, err := cache.NewWarmer(provider, cache.WarmerConfig{Ranges: 16},
+//	    cache.WithWarmLock(coordinator.Lock()),
+//	    cache.WithWarmRateLimit(limitFunc))
+//	_ = warmer.Register(cache.WarmTask{
+//	    Pattern:         "group:members:*",
+//	    Keys:            hotGroupMemberKeys,
+//	    Load:            loadGroupMembers,
+//	    RefreshInterval: 10 * time.Minute,
+//	})
+//	_ = warmer.Start(ctx)
+//	defer warmer.Close()
+func NewWarmer(provider Provider, cfg WarmerConfig, opts ...WarmerOption) (*Warmer, error) {
+	if provider == nil {
+		return nil, fmt.Errorf("cache provider cannot be nil")
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Namespace == "" {
+		cfg.Namespace = "warmer"
+	}
+	if cfg.Ranges == 0 {
+		cfg.Ranges = 16
+	}
+	if cfg.LockTTL == 0 {
+		cfg.LockTTL = 30 * time.Second
+	}
+
+	w := &Warmer{
+		provider: provider,
+		config:   cfg,
+		logger:   clog.Namespace("cache.warmer"),
+		tasks:    make(map[string]*WarmTask),
+		stop:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w, nil
+}
+
+// Register 注册一个预热任务，必须在 Start 之前调用
+func (w *Warmer) Register(task WarmTask) error {
+	if task.Pattern == "" {
+		return fmt.Errorf("warm task pattern cannot be empty")
+	}
+	if task.Keys == nil || task.Load == nil {
+		return fmt.Errorf("warm task %s must set both Keys and Load", task.Pattern)
+	}
+	if task.RefreshInterval < 0 || task.MinInterval < 0 {
+		return fmt.Errorf("warm task %s intervals cannot be negative", task.Pattern)
+	}
+	if task.MinInterval == 0 {
+		if task.RefreshInterval > 0 {
+			task.MinInterval = task.RefreshInterval * 9 / 10
+		} else {
+			task.MinInterval = warmOnceMinInterval
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.started {
+		return ErrWarmerStarted
+	}
+	if _, ok := w.tasks[task.Pattern]; ok {
+		return fmt.Errorf("warm task %s already registered", task.Pattern)
+	}
+	w.tasks[task.Pattern] = &task
+	return nil
+}
+
+// Start 在后台立即预热所有任务，之后按各任务的 RefreshInterval 周期刷新。ctx 结束或 Close 时停止
+func (w *Warmer) Start(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.started {
+		return ErrWarmerStarted
+	}
+	w.started = true
+
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-w.stop:
+		case <-ctx.Done():
+		}
+		cancel()
+	}()
+	for _, task := range w.tasks {
+		w.wg.Add(1)
+		go w.loop(ctx, task)
+	}
+	return nil
+}
+
+// WarmNow 立即同步预热指定任务，如在发布脚本中调用。返回第一个分段错误，单个键的加载失败只计数不返回
+func (w *Warmer) WarmNow(ctx context.Context, pattern string) error {
+	w.mu.Lock()
+	task, ok := w.tasks[pattern]
+	w.mu.Unlock()
+	if !ok {
+		return ErrWarmTaskNotFound
+	}
+	return w.warm(ctx, task)
+}
+
+// Stats 返回预热器的累计统计
+func (w *Warmer) Stats() WarmerStats {
+	return WarmerStats{
+		Runs:          w.runs.Load(),
+		KeysLoaded:    w.keysLoaded.Load(),
+		LoadErrors:    w.loadErrors.Load(),
+		RangesSkipped: w.rangesSkipped.Load(),
+		Throttled:     w.throttled.Load(),
+	}
+}
+
+// Close 停止周期刷新并等待正在进行的预热返回
+func (w *Warmer) Close() {
+	w.closeOnce.Do(func() {
+		close(w.stop)
+	})
+	w.wg.Wait()
+}
+
+// loop 执行一个任务的启动预热和周期刷新
+func (w *Warmer) loop(ctx context.Context, task *WarmTask) {
+	defer w.wg.Done()
+
+	if err := w.warm(ctx, task); err != nil && ctx.Err() == nil {
+		w.logger.Warn("启动预热失败", clog.String("pattern", task.Pattern), clog.Err(err))
+	}
+	if task.RefreshInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(task.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := w.warm(ctx, task); err != nil && ctx.Err() == nil {
+				w.logger.Warn("周期预热失败", clog.String("pattern", task.Pattern), clog.Err(err))
+			}
+		}
+	}
+}
+
+// warm 列出任务的键并按分段依次预热
+func (w *Warmer) warm(ctx context.Context, task *WarmTask) error {
+	keys, err := task.Keys(ctx)
+	if err != nil {
+		return fmt.Errorf("list warm keys for %s: %w", task.Pattern, err)
+	}
+
+	ranges := make([][]string, w.config.Ranges)
+	for _, key := range keys {
+		r := keyRange(key, w.config.Ranges)
+		ranges[r] = append(ranges[r], key)
+	}
+
+	var firstErr error
+	for r, rangeKeys := range ranges {
+		if len(rangeKeys) == 0 {
+			continue
+		}
+		if err := w.warmRange(ctx, task, r, rangeKeys); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// warmRange 加锁后预热一个分段，其他实例持有锁或标记未过期时跳过
+func (w *Warmer) warmRange(ctx context.Context, task *WarmTask, r int, keys []string) error {
+	name := task.Pattern + ":" + strconv.Itoa(r)
+	unlock, ok := w.tryLock(ctx, name)
+	if !ok {
+		w.rangesSkipped.Add(1)
+		return nil
+	}
+	defer unlock()
+
+	marker := w.config.Namespace + ":warmed:" + name
+	if n, err := w.provider.String().Exists(ctx, marker); err != nil {
+		return fmt.Errorf("check warm marker %s: %w", name, err)
+	} else if n > 0 {
+		w.rangesSkipped.Add(1)
+		return nil
+	}
+
+	w.runs.Add(1)
+	start := time.Now()
+	var failed int
+	for _, key := range keys {
+		if err := w.acquire(ctx, key); err != nil {
+			return err
+		}
+		if err := w.load(ctx, task, key); err != nil {
+			failed++
+			w.loadErrors.Add(1)
+			w.logger.Debug("预热键失败", clog.String("pattern", task.Pattern), clog.String("key", key), clog.Err(err))
+			continue
+		}
+		w.keysLoaded.Add(1)
+	}
+
+	w.logger.Info("分段预热完成",
+		clog.String("pattern", task.Pattern),
+		clog.Int("range", r),
+		clog.Int("keys", len(keys)),
+		clog.Int("failed", failed),
+		clog.Duration("duration", time.Since(start)))
+
+	// 有键加载失败时不写入标记，其他实例或下个周期可以重试
+	if failed > 0 {
+		return fmt.Errorf("warm range %s: %d of %d keys failed", name, failed, len(keys))
+	}
+	return w.provider.String().Set(ctx, marker, start.Unix(), task.MinInterval)
+}
+
+// tryLock 非阻塞地获取分段锁，返回释放函数。锁被占用或加锁失败都视为由其他实例负责
+func (w *Warmer) tryLock(ctx context.Context, name string) (func(), bool) {
+	key := w.config.Namespace + ":lock:" + name
+	if w.locker != nil {
+		l, err := w.locker.TryAcquire(ctx, "cache/"+key, w.config.LockTTL)
+		if err != nil {
+			w.logger.Debug("分段锁未获取", clog.String("range", name), clog.Err(err))
+			return nil, false
+		}
+		return func() { _ = l.Unlock(context.WithoutCancel(ctx)) }, true
+	}
+
+	l, ok, err := w.provider.Lock().TryLock(ctx, key, w.config.LockTTL)
+	if err != nil || !ok {
+		if err != nil {
+			w.logger.Debug("分段锁未获取", clog.String("range", name), clog.Err(err))
+		}
+		return nil, false
+	}
+	return func() { _ = l.Unlock(context.WithoutCancel(ctx)) }, true
+}
+
+// acquire 按限流函数等待加载 key 的许可，限流出错时放行，避免限流组件故障导致预热停止
+func (w *Warmer) acquire(ctx context.Context, key string) error {
+	if w.limit == nil {
+		return nil
+	}
+	for {
+		allowed, err := w.limit(ctx, key)
+		if err != nil {
+			w.logger.Debug("预热限流出错，直接放行", clog.String("key", key), clog.Err(err))
+			return nil
+		}
+		if allowed {
+			return nil
+		}
+		w.throttled.Add(1)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(warmLimitRetry):
+		}
+	}
+}
+
+// load 按 LoadTimeout 加载单个键
+func (w *Warmer) load(ctx context.Context, task *WarmTask, key string) error {
+	if w.config.LoadTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.config.LoadTimeout)
+		defer cancel()
+	}
+	return task.Load(ctx, key)
+}
+
+// keyRange 返回 key 所属的分段
+func keyRange(key string, ranges int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum32() % uint32(ranges))
+}
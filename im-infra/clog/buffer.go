@@ -0,0 +1,82 @@
+package clog
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog/internal"
+)
+
+// 默认的请求日志缓冲条数
+const defaultBufferSize = 256
+
+// requestBufferKey 请求日志缓冲区上下文键的类型安全封装
+type requestBufferKey struct{}
+
+// BufferConfig 请求级日志缓冲配置
+type BufferConfig struct {
+	// Size 最多缓冲的日志条数，超出后覆盖最早的日志，默认 256
+	Size int
+	// LatencyThreshold 请求耗时超过该值时即使成功也刷出日志，0 表示不按耗时刷出
+	LatencyThreshold time.Duration
+}
+
+// RequestBuffer 请求级日志缓冲区
+// 请求处理期间 Debug/Info 日志暂存在环形缓冲中，请求以错误结束或耗时超过阈值时刷出，
+// 否则直接丢弃，大幅降低正常流量的日志量，同时在出错时保留完整上下文。
+// Warn 及以上级别的日志总是立即输出，Error 及以上会先刷出已缓冲的日志。
+type RequestBuffer struct {
+	buf       *internal.RequestBuffer
+	start     time.Time
+	threshold time.Duration
+	once      sync.Once
+}
+
+// WithBuffer 为请求开启日志缓冲，返回携带缓冲区的 context
+// 之后通过 WithContext(ctx) / C(ctx) 获取的 Logger 都会写入该缓冲区，
+// 请求结束时必须调用 Finish 决定刷出还是丢弃
+//
+// 使用示例：
+//
+//	ctx, buf := clog.WithBuffer(ctx, clog.BufferConfig{LatencyThreshold: time.Second})
+//	err := handle(ctx)
+//	buf.Finish(err)
+func WithBuffer(ctx context.Context, cfg BufferConfig) (context.Context, *RequestBuffer) {
+	size := cfg.Size
+	if size <= 0 {
+		size = defaultBufferSize
+	}
+	b := &RequestBuffer{
+		buf:       internal.NewRequestBuffer(size),
+		start:     time.Now(),
+		threshold: cfg.LatencyThreshold,
+	}
+	return context.WithValue(ctx, requestBufferKey{}, b), b
+}
+
+// Finish 结束请求：err 非空或耗时超过阈值时刷出缓冲的日志，否则丢弃
+// 之后通过该 context 记录的日志不再缓冲，多次调用只有第一次生效
+func (b *RequestBuffer) Finish(err error) {
+	b.once.Do(func() {
+		if err != nil || (b.threshold > 0 && time.Since(b.start) > b.threshold) {
+			b.buf.Flush()
+		} else {
+			b.buf.Discard()
+		}
+		b.buf.Close()
+	})
+}
+
+// Flush 立即刷出已缓冲的日志，缓冲区仍继续生效
+func (b *RequestBuffer) Flush() {
+	b.buf.Flush()
+}
+
+// bufferFromContext 从 context 中获取请求日志缓冲区
+func bufferFromContext(ctx context.Context) *RequestBuffer {
+	if b, ok := ctx.Value(requestBufferKey{}).(*RequestBuffer); ok {
+		return b
+	}
+	return nil
+}
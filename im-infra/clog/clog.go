@@ -42,11 +42,19 @@ func WithTraceID(ctx context.Context, traceID string) context.Context {
 
 // WithContext 从 context 中获取一个 Logger 实例
 // 如果 ctx 中包含 trace_id，返回的 Logger 会自动在每条日志中添加 "trace_id" 字段
+// 如果 ctx 通过 WithBuffer 开启了日志缓冲，返回的 Logger 会写入请求缓冲区
 // 这是在处理请求的函数中进行日志记录的【首选方式】
 func WithContext(ctx context.Context) Logger {
-	logger := getDefaultLogger()
+	return WithContextFrom(ctx, getDefaultLogger())
+}
 
+// WithContextFrom 与 WithContext 相同，但以指定的 logger 而不是全局 logger 为基础，
+// 用于组件在保留自身命名空间（及其路由和级别）的同时附加请求的 trace_id 和日志缓冲
+func WithContextFrom(ctx context.Context, logger Logger) Logger {
 	if ctx != nil {
+		if buf := bufferFromContext(ctx); buf != nil {
+			logger = logger.WithOptions(buf.buf.Option())
+		}
 		if traceID := ctx.Value(traceIDKey); traceID != nil {
 			if id, ok := traceID.(string); ok && id != "" {
 				return logger.With(zap.String("trace_id", id))
@@ -111,7 +119,8 @@ func Init(ctx context.Context, config *Config, opts ...Option) error {
 		// 返回错误，但不替换现有 logger，保持系统可用性
 		return err
 	}
-	// 原子替换全局 logger
+	// 原子替换全局 logger，并消耗掉默认初始化，避免之后被开发环境默认 logger 覆盖
+	defaultLoggerOnce.Do(func() {})
 	defaultLogger.Store(logger)
 	return nil
 }
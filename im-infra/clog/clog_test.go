@@ -8,8 +8,11 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog/internal"
 )
 
 // TestCoreFeatures tests core clog functionality: config, levels, fields, namespace, traceid, caller, rotation
@@ -21,6 +24,7 @@ func TestCoreFeatures(t *testing.T) {
 	t.Run("Context TraceID", testTraceID)
 	t.Run("Caller Info", testCaller)
 	t.Run("File Rotation", testRotation)
+	t.Run("Time Rotation", testTimeRotation)
 }
 
 // testEnvDefaults verifies GetDefaultConfig
@@ -306,7 +310,628 @@ func testRotation(t *testing.T) {
 	}
 }
 
+// testTimeRotation verifies daily file naming and interval validation
+func testTimeRotation(t *testing.T) {
+	dir, err := os.MkdirTemp("", "clog-test-time-rotation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := &Config{
+		Level:  "info",
+		Format: "json",
+		Output: filepath.Join(dir, "app.log"),
+		Rotation: &RotationConfig{
+			MaxSize:    100,
+			MaxBackups: 7,
+			Interval:   RotateDaily,
+			OnRotate:   func(path string) {},
+		},
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := Init(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	Info("daily rotation log")
+
+	// Current file is named by period, e.g. app-2024-07-01.log
+	dated := filepath.Join(dir, "app-"+time.Now().Format("2006-01-02")+".log")
+	content, err := os.ReadFile(dated)
+	if err != nil {
+		t.Fatalf("Expected dated log file %s: %v", dated, err)
+	}
+	if !bytes.Contains(content, []byte("daily rotation log")) {
+		t.Errorf("Invalid log content")
+	}
+
+	config.Rotation.Interval = "weekly"
+	if err := config.Validate(); err == nil {
+		t.Errorf("Expected invalid interval error")
+	}
+}
+
+// TestFieldProfile verifies ECS / OTel field naming
+func TestFieldProfile(t *testing.T) {
+	cases := []struct {
+		profile string
+		want    []string
+	}{
+		{FieldProfileECS, []string{"@timestamp", "log.level", "message", "trace.id", "log.logger", "error.message", "ecs.version"}},
+		{FieldProfileOTel, []string{"timestamp", "severity_text", "body", "trace_id", "scope.name", "exception.message"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.profile, func(t *testing.T) {
+			logFile := filepath.Join(t.TempDir(), "app.log")
+			config := &Config{Level: "info", Format: "json", Output: logFile, FieldProfile: tc.profile}
+			logger, err := New(context.Background(), config, WithNamespace("im-logic"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			logger.With(String("trace_id", "abc123")).Error("profile log", Err(errors.New("boom")))
+			_ = logger.(interface{ Sync() error }).Sync()
+
+			content, err := os.ReadFile(logFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var entry map[string]interface{}
+			if err := json.Unmarshal(bytes.TrimSpace(content), &entry); err != nil {
+				t.Fatalf("invalid json log %q: %v", content, err)
+			}
+			for _, key := range tc.want {
+				if _, ok := entry[key]; !ok {
+					t.Errorf("expected field %q in %s", key, content)
+				}
+			}
+		})
+	}
+
+	if err := (&Config{Level: "info", Format: "json", Output: "stdout", FieldProfile: "gelf"}).Validate(); err == nil {
+		t.Errorf("Expected invalid field profile error")
+	}
+}
+
 // Helper: contains for byte slices
 func contains(s string, substr string) bool {
 	return bytes.Contains([]byte(s), []byte(substr))
 }
+
+// TestRequestBuffer verifies buffered logs are dropped on success and flushed on error
+func TestRequestBuffer(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "app.log")
+	if err := Init(context.Background(), &Config{Level: "debug", Format: "json", Output: logFile}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, buf := WithBuffer(WithTraceID(context.Background(), "ok-req"), BufferConfig{Size: 2})
+	C(ctx).Info("happy path")
+	C(ctx).Warn("slow downstream")
+	buf.Finish(nil)
+
+	ctx, buf = WithBuffer(WithTraceID(context.Background(), "failed-req"), BufferConfig{Size: 2})
+	C(ctx).Debug("step 1")
+	C(ctx).Debug("step 2")
+	C(ctx).Info("step 3")
+	buf.Finish(errors.New("boom"))
+	C(ctx).Info("after finish")
+
+	content, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var messages []string
+	for _, line := range bytes.Split(bytes.TrimSpace(content), []byte("\n")) {
+		var entry map[string]interface{}
+		if err := json.Unmarshal(line, &entry); err != nil {
+			t.Fatalf("invalid json log %q: %v", line, err)
+		}
+		messages = append(messages, fmt.Sprint(entry["msg"]))
+	}
+
+	want := []string{
+		"slow downstream",
+		"clog: request log buffer overflowed, earliest entries dropped",
+		"step 2",
+		"step 3",
+		"after finish",
+	}
+	if fmt.Sprint(messages) != fmt.Sprint(want) {
+		t.Errorf("unexpected logs: got %v, want %v", messages, want)
+	}
+}
+
+// TestNamespaceRoutes verifies logs are routed to per-namespace outputs with independent sampling
+func TestNamespaceRoutes(t *testing.T) {
+	dir := t.TempDir()
+	appLog := filepath.Join(dir, "app.log")
+	accessLog := filepath.Join(dir, "access.log")
+	auditLog := filepath.Join(dir, "audit", "audit.log")
+
+	config := &Config{
+		Level:    "info",
+		Format:   "json",
+		Output:   appLog,
+		Sampling: &SamplingConfig{Initial: 1, Thereafter: 1000, Tick: time.Minute},
+		Routes: []RouteConfig{
+			{Namespace: "*.access", Output: accessLog, Level: "warn"},
+			{Namespace: "audit", Output: auditLog, Rotation: &RotationConfig{MaxAge: 180}},
+		},
+	}
+	logger, err := New(context.Background(), config, WithNamespace("im-gateway"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	audit := logger.Namespace("audit").With(String("actor", "admin"))
+	for i := 0; i < 5; i++ {
+		logger.Info("app log")
+		audit.Namespace("login").Info("audit log")
+	}
+	access := logger.Namespace("http").Namespace("access")
+	access.Info("access info dropped by level")
+	access.Warn("access warn")
+
+	for _, l := range []Logger{logger, audit, access} {
+		_ = l.(interface{ Sync() error }).Sync()
+	}
+
+	readLines := func(path string) []string {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Split(strings.TrimSpace(string(content)), "\n")
+	}
+
+	// Output 开启了采样，同一消息只输出第一条
+	if lines := readLines(appLog); len(lines) != 1 || !contains(lines[0], "app log") {
+		t.Errorf("expected 1 sampled app log, got %v", lines)
+	}
+	// audit 路由不采样，子命名空间和 With 字段保留
+	lines := readLines(auditLog)
+	if len(lines) != 5 {
+		t.Fatalf("expected 5 audit logs, got %v", lines)
+	}
+	if !contains(lines[0], `"namespace":"im-gateway.audit.login"`) || !contains(lines[0], `"actor":"admin"`) {
+		t.Errorf("unexpected audit log: %s", lines[0])
+	}
+	// access 路由使用自己的级别
+	if lines := readLines(accessLog); len(lines) != 1 || !contains(lines[0], "access warn") {
+		t.Errorf("expected only warn access log, got %v", lines)
+	}
+
+	invalid := []*Config{
+		{Level: "info", Format: "json", Output: "stdout", Routes: []RouteConfig{{Output: accessLog}}},
+		{Level: "info", Format: "json", Output: "stdout", Routes: []RouteConfig{{Namespace: "audit"}}},
+		{Level: "info", Format: "json", Output: "stdout", Routes: []RouteConfig{{Namespace: "audit", Output: auditLog}, {Namespace: "audit", Output: accessLog}}},
+		{Level: "info", Format: "json", Output: "stdout", Routes: []RouteConfig{{Namespace: "audit", Output: auditLog, Level: "trace"}}},
+		{Level: "info", Format: "json", Output: "stdout", Sampling: &SamplingConfig{Initial: -1}},
+	}
+	for i, c := range invalid {
+		if err := c.Validate(); err == nil {
+			t.Errorf("case %d: expected validation error", i)
+		}
+	}
+}
+
+// fakeTB 记录断言失败，用于验证 TestLogger 的失败报告
+type fakeTB struct {
+	errors   []string
+	cleanups []func()
+}
+
+func (f *fakeTB) Helper() {}
+
+func (f *fakeTB) Errorf(format string, args ...interface{}) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+func (f *fakeTB) Cleanup(fn func()) { f.cleanups = append(f.cleanups, fn) }
+
+// TestTestLogger verifies log capture through the global logger and assertion helpers
+func TestTestLogger(t *testing.T) {
+	logs := NewTestLogger(t)
+
+	ctx := WithTraceID(context.Background(), "trace-1")
+	Namespace("user").Info("user created", String("user", "alice"), Int("age", 30))
+	C(ctx).Warn("slow query", Duration("cost", 2*time.Second))
+	Error("send failed", Err(errors.New("timeout")))
+
+	logs.AssertLogged("info", "created", String("user", "alice"), Int("age", 30), String("namespace", "user"))
+	logs.AssertLogged("warn", "slow", String("trace_id", "trace-1"), Duration("cost", 2*time.Second))
+	logs.AssertLogged("", "send failed", Err(errors.New("timeout")))
+	logs.AssertNotLogged("error", "created")
+	if got := len(logs.Entries()); got != 3 {
+		t.Errorf("expected 3 entries, got %d", got)
+	}
+
+	// 失败时报告条件与已捕获的日志
+	fake := &fakeTB{}
+	inner := NewTestLogger(fake)
+	Info("hello", String("k", "v"))
+	if inner.AssertLogged("info", "hello", String("k", "other")) {
+		t.Error("expected assertion with mismatched field to fail")
+	}
+	if inner.AssertNotLogged("info", "hello") {
+		t.Error("expected negative assertion to fail")
+	}
+	if len(fake.errors) != 2 || !strings.Contains(fake.errors[0], "[info] hello") {
+		t.Errorf("unexpected failure reports: %v", fake.errors)
+	}
+
+	// Cleanup 恢复外层的 TestLogger
+	for _, fn := range fake.cleanups {
+		fn()
+	}
+	logs.Reset()
+	Info("after cleanup")
+	logs.AssertLogged("info", "after cleanup")
+	if len(inner.Find("", "after cleanup")) != 0 {
+		t.Error("inner test logger should be detached after cleanup")
+	}
+}
+
+// TestCrashBundle verifies fatal hooks and crash bundles with recent log entries
+func TestCrashBundle(t *testing.T) {
+	internal.ResetCrashReporter()
+	t.Cleanup(internal.ResetCrashReporter)
+	originalExit := exitFunc
+	exitCodes := 0
+	SetExitFunc(func(code int) { exitCodes++ })
+	t.Cleanup(func() { SetExitFunc(originalExit) })
+
+	dir := t.TempDir()
+	var uploaded []byte
+	config := &Config{
+		Level:  "info",
+		Format: "json",
+		Output: filepath.Join(dir, "app.log"),
+		Crash: &CrashConfig{
+			RecentEntries: 3,
+			Dir:           dir,
+			Upload: func(name string, data []byte) error {
+				uploaded = data
+				return nil
+			},
+		},
+	}
+	logger, err := New(context.Background(), config, WithNamespace("im-logic"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var hooked []LogEntry
+	RegisterFatalHook(func(entry LogEntry) { hooked = append(hooked, entry) })
+
+	for i := 0; i < 5; i++ {
+		logger.With(Int("seq", i)).Info("recent log")
+	}
+	logger.Fatal("out of memory", String("reason", "oom"))
+
+	if exitCodes == 0 {
+		t.Error("Fatal did not call exit function")
+	}
+	if len(hooked) != 1 || hooked[0].Message != "out of memory" || hooked[0].Fields["reason"] != "oom" {
+		t.Fatalf("unexpected fatal hook calls: %v", hooked)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "crash-*.json"))
+	if len(files) != 1 {
+		t.Fatalf("expected 1 crash bundle, got %v", files)
+	}
+	content, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(content, uploaded) {
+		t.Error("uploaded bundle differs from written bundle")
+	}
+	var bundle internal.CrashBundle
+	if err := json.Unmarshal(content, &bundle); err != nil {
+		t.Fatal(err)
+	}
+	// 环形缓冲保留最近 3 条：seq 3、seq 4 和 fatal 日志本身
+	if len(bundle.Recent) != 3 || bundle.Dropped != 3 {
+		t.Fatalf("expected 3 recent entries and 3 dropped, got %d and %d", len(bundle.Recent), bundle.Dropped)
+	}
+	if bundle.Recent[0].Fields["seq"] != float64(3) || bundle.Recent[2].Message != "out of memory" {
+		t.Errorf("unexpected recent entries: %+v", bundle.Recent)
+	}
+	if bundle.Reason.Message != "out of memory" || !contains(bundle.Goroutines, "goroutine") {
+		t.Errorf("unexpected crash bundle: reason=%+v", bundle.Reason)
+	}
+
+	// 只有第一次崩溃生成崩溃包
+	logger.Fatal("second fatal")
+	if len(hooked) != 1 {
+		t.Errorf("fatal hooks ran again: %v", hooked)
+	}
+
+	invalid := &Config{Level: "info", Format: "json", Output: "stdout", Crash: &CrashConfig{RecentEntries: -1}}
+	if err := invalid.Validate(); err == nil {
+		t.Error("expected validation error for negative recentEntries")
+	}
+}
+
+// TestBindContext verifies that recovered panics carry the fields bound to the worker goroutine
+func TestBindContext(t *testing.T) {
+	logs := NewTestLogger(t)
+	ctx := WithTraceID(context.Background(), "trace-123")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		unbindWorker := BindContext(nil, String("worker", "w1"))
+		defer unbindWorker()
+
+		Recoverer(ctx, func(ctx context.Context) {
+			panic("boom")
+		}, String("msg_id", "m-1"))()
+
+		// 解绑后只保留外层绑定
+		if fields := BoundFields(); len(fields) != 1 || fields[0].Key != "worker" {
+			t.Errorf("unexpected bound fields after unbind: %v", fields)
+		}
+	}()
+	<-done
+
+	logs.AssertLogged("error", "panic recovered",
+		String("trace_id", "trace-123"),
+		String("worker", "w1"),
+		String("msg_id", "m-1"),
+		String("panic", "boom"))
+
+	// 其他 goroutine 的绑定不会泄漏到当前 goroutine
+	if fields := BoundFields(); len(fields) != 0 {
+		t.Errorf("unexpected bound fields on test goroutine: %v", fields)
+	}
+
+	logs.Reset()
+	func() {
+		unbind := BindContext(ctx)
+		defer unbind()
+		defer Recover()
+		panic("again")
+	}()
+	logs.AssertLogged("error", "panic recovered", String("trace_id", "trace-123"), String("panic", "again"))
+}
+
+// TestMessageCodes 测试消息码字段、注册表导出和强制规则
+func TestMessageCodes(t *testing.T) {
+	codeLogin := RegisterCode("TEST_USER_LOGIN_FAILED", "用户登录失败")
+	if RegisterCode(codeLogin, "用户登录失败") != codeLogin {
+		t.Error("以相同说明重复注册应返回消息码")
+	}
+	for _, bad := range [][2]string{{"user_login", "小写"}, {codeLogin, "不同的说明"}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("RegisterCode(%q, %q) 应该 panic", bad[0], bad[1])
+				}
+			}()
+			RegisterCode(bad[0], bad[1])
+		}()
+	}
+
+	output := filepath.Join(t.TempDir(), "app.log")
+	config := &Config{
+		Level:  "info",
+		Format: "json",
+		Output: output,
+		MessageCodes: &MessageCodeConfig{
+			RequireRegistered: true,
+			ExemptNamespaces:  []string{"*.mq"},
+		},
+	}
+	logger, err := New(context.Background(), config, WithNamespace("im-logic"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("info 不需要消息码")
+	logger.Warn("缺少消息码")
+	logger.Warn("未注册的消息码", MessageCode("TEST_NOT_REGISTERED"))
+	logger.Warn("用户登录失败", MessageCode(codeLogin))
+	logger.With(MessageCode(codeLogin)).Namespace("auth").Error("通过 With 添加消息码")
+	logger.Namespace("mq").Warn("豁免的命名空间")
+	_ = logger.(interface{ Sync() error }).Sync()
+
+	content, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 6 {
+		t.Fatalf("expected 6 log lines, got %d", len(lines))
+	}
+	expect := []struct{ code, violation string }{
+		{"", ""},
+		{UncodedMessageCode, "missing"},
+		{"TEST_NOT_REGISTERED", "unregistered"},
+		{codeLogin, ""},
+		{codeLogin, ""},
+		{"", ""},
+	}
+	for i, line := range lines {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("invalid json log: %s", line)
+		}
+		code, _ := entry["message_code"].(string)
+		violation, _ := entry["message_code_violation"].(string)
+		if code != expect[i].code || violation != expect[i].violation {
+			t.Errorf("line %d: expected code=%q violation=%q, got %s", i, expect[i].code, expect[i].violation, line)
+		}
+	}
+
+	// 注册表包含注册过和出现过的消息码，未注册的 Registered 为 false
+	var buf bytes.Buffer
+	if err := ExportMessageCodes(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var infos []MessageCodeInfo
+	if err := json.Unmarshal(buf.Bytes(), &infos); err != nil {
+		t.Fatalf("invalid export: %v", err)
+	}
+	found := map[string]MessageCodeInfo{}
+	for _, info := range infos {
+		found[info.Code] = info
+	}
+	if info := found[codeLogin]; !info.Registered || info.Count != 2 || info.MaxLevel != "error" || info.Description != "用户登录失败" {
+		t.Errorf("unexpected registered code info: %+v", info)
+	}
+	if info, ok := found["TEST_NOT_REGISTERED"]; !ok || info.Registered || info.Count != 1 {
+		t.Errorf("unexpected unregistered code info: %+v", info)
+	}
+	if _, ok := found[UncodedMessageCode]; ok {
+		t.Error("补上的 UNCODED 不应记入注册表")
+	}
+
+	// panic 模式在违规时 panic
+	strict, err := New(context.Background(), &Config{Level: "info", Format: "json", Output: output,
+		MessageCodes: &MessageCodeConfig{Enforce: MessageCodePanic, MinLevel: "error"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	strict.Warn("低于 MinLevel 的日志不检查")
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("缺少消息码的 error 日志应该 panic")
+			}
+		}()
+		strict.Error("缺少消息码")
+	}()
+
+	invalid := []*Config{
+		{Level: "info", Format: "json", Output: "stdout", MessageCodes: &MessageCodeConfig{Enforce: "reject"}},
+		{Level: "info", Format: "json", Output: "stdout", MessageCodes: &MessageCodeConfig{MinLevel: "fatal"}},
+	}
+	for i, c := range invalid {
+		if err := c.Validate(); err == nil {
+			t.Errorf("case %d: expected validation error", i)
+		}
+	}
+}
+
+// TestConsoleTheme verifies themed console output and the dev formatter
+func TestConsoleTheme(t *testing.T) {
+	render := func(t *testing.T, config *Config, log func(Logger)) string {
+		t.Helper()
+		config.Level = "info"
+		config.Output = filepath.Join(t.TempDir(), "app.log")
+		logger, err := New(context.Background(), config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		log(logger)
+		_ = logger.(interface{ Sync() error }).Sync()
+		content, err := os.ReadFile(config.Output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(content)
+	}
+
+	t.Run("compact", func(t *testing.T) {
+		out := render(t, &Config{
+			Format:      "console",
+			EnableColor: true,
+			Theme: &ThemeConfig{
+				Levels:           map[string]string{"info": "bold-green"},
+				HumanizeDuration: true,
+				SizeKeys:         []string{"bytes"},
+			},
+		}, func(l Logger) {
+			l.Info("upload done", String("file", "a b.txt"), Duration("took", 1500*time.Millisecond), Int64("body_bytes", 3<<20))
+		})
+		for _, want := range []string{"\x1b[1;32mINFO\x1b[0m", "\x1b[90mfile=\x1b[0m\"a b.txt\"", "took=\x1b[0m1.5s", "body_bytes=\x1b[0m3MiB"} {
+			if !strings.Contains(out, want) {
+				t.Errorf("expected %q in %q", want, out)
+			}
+		}
+		if strings.Count(strings.TrimSpace(out), "\n") != 0 {
+			t.Errorf("compact layout should stay on one line: %q", out)
+		}
+	})
+
+	t.Run("dev", func(t *testing.T) {
+		out := render(t, &Config{Format: "dev"}, func(l Logger) {
+			l.Info("request", Int("a", 1), Int("b", 2), Int("c", 3), Int("d", 4), Int("e", 5),
+				Any("user", map[string]interface{}{"id": 7, "tags": []string{"vip"}}))
+		})
+		for _, want := range []string{"\n    a=1\n", "\n    user={\n      \"id\": 7,"} {
+			if !strings.Contains(out, want) {
+				t.Errorf("expected %q in %q", want, out)
+			}
+		}
+		if strings.Contains(out, "\x1b[") {
+			t.Errorf("colors should be disabled without EnableColor: %q", out)
+		}
+	})
+
+	if err := (&Config{Level: "info", Format: "dev", Output: "stdout", Theme: &ThemeConfig{KeyColor: "pink"}}).Validate(); err == nil {
+		t.Errorf("Expected invalid theme color error")
+	}
+	if err := (&Config{Level: "info", Format: "console", Output: "stdout", Theme: &ThemeConfig{Layout: "table"}}).Validate(); err == nil {
+		t.Errorf("Expected invalid theme layout error")
+	}
+}
+
+// TestRotationPrune verifies pruning only removes files named like rotated backups
+func TestRotationPrune(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-48 * time.Hour)
+	siblings := []string{"app-audit.log", "app-2020-01-01-audit.log", "app.log.bak"}
+	for _, name := range append(siblings, "app-2020-01-01.log", "app-2020-01-01.1.log.gz") {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("old\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config := &Config{
+		Level:  "info",
+		Format: "json",
+		Output: filepath.Join(dir, "app.log"),
+		Rotation: &RotationConfig{
+			MaxSize:    1,
+			MaxBackups: 1,
+			Interval:   RotateDaily,
+			OnRotate:   func(path string) {},
+		},
+	}
+	if err := Init(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	// 每条约 300KB，写满两个 1MB 的文件触发两次按大小轮转
+	payload := strings.Repeat("x", 300*1024)
+	for i := 0; i < 8; i++ {
+		Info("rotation prune log", String("payload", payload))
+	}
+
+	for _, name := range siblings {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("Unrelated file %s should survive pruning: %v", name, err)
+		}
+	}
+	for _, name := range []string{"app-2020-01-01.log", "app-2020-01-01.1.log.gz"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("Old backup %s should be pruned", name)
+		}
+	}
+	today := "app-" + time.Now().Format("2006-01-02")
+	if _, err := os.Stat(filepath.Join(dir, today+".2.log")); err != nil {
+		t.Errorf("Newest backup should be kept: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, today+".1.log")); !os.IsNotExist(err) {
+		t.Errorf("Backups beyond MaxBackups should be pruned")
+	}
+}
@@ -1,13 +1,19 @@
 package clog
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog/internal"
+)
 
 // Config 是 clog 组件的配置结构体
 type Config struct {
 	// Level 日志级别: "debug", "info", "warn", "error", "fatal"
 	Level string `json:"level" yaml:"level"`
 	
-	// Format 输出格式: "json" (生产环境推荐) 或 "console" (开发环境推荐)
+	// Format 输出格式: "json" (生产环境推荐)、"console" (开发环境推荐) 或 "dev"
+	// （本地调试：按主题着色、字段较多时逐行输出、展开嵌套字段并以可读形式输出时长）
 	Format string `json:"format" yaml:"format"`
 	
 	// Output 输出目标: "stdout", "stderr", 或文件路径
@@ -16,24 +22,158 @@ type Config struct {
 	// AddSource 控制日志是否包含源码文件名和行号
 	AddSource bool `json:"addSource" yaml:"addSource"`
 	
-	// EnableColor 是否启用颜色（仅 console 格式）
+	// EnableColor 是否启用颜色（仅 console 和 dev 格式）
 	EnableColor bool `json:"enableColor" yaml:"enableColor"`
 	
+	// Theme 控制台主题（console 和 dev 格式），nil 时 console 格式使用 zap 默认的控制台输出，dev 格式使用默认主题
+	Theme *ThemeConfig `json:"theme,omitempty" yaml:"theme,omitempty"`
+	
 	// RootPath 项目根目录，用于控制文件路径显示
 	RootPath string `json:"rootPath,omitempty" yaml:"rootPath,omitempty"`
 	
+	// FieldProfile 标准字段的命名规范（主要用于 json 格式）: 为空时使用默认字段名，
+	// "ecs" 输出 Elastic Common Schema 字段（@timestamp、log.level、message、trace.id），
+	// "otel" 输出 OpenTelemetry 日志数据模型字段（timestamp、severity_text、body、trace_id）
+	FieldProfile string `json:"fieldProfile,omitempty" yaml:"fieldProfile,omitempty"`
+	
 	// Rotation 日志轮转配置（仅文件输出）
 	Rotation *RotationConfig `json:"rotation,omitempty" yaml:"rotation,omitempty"`
+
+	// Sampling 日志采样配置（仅作用于 Output），nil 表示不采样
+	Sampling *SamplingConfig `json:"sampling,omitempty" yaml:"sampling,omitempty"`
+
+	// Routes 按命名空间将日志路由到不同的输出，按顺序匹配，第一个匹配的路由生效；
+	// 未匹配任何路由的日志写入 Output
+	Routes []RouteConfig `json:"routes,omitempty" yaml:"routes,omitempty"`
+
+	// Crash 崩溃包配置，开启后记录最近的日志，Fatal 或 HandlePanic 捕获到 panic 时
+	// 将最近日志和所有 goroutine 堆栈写入 Dir 或交给 Upload，nil 表示不生成崩溃包
+	Crash *CrashConfig `json:"crash,omitempty" yaml:"crash,omitempty"`
+
+	// MessageCodes 消息码强制规则，开启后 MinLevel 及以上级别的日志必须通过 MessageCode 携带稳定的消息码，
+	// 告警和日志分析按消息码而不是可能被修改的日志文本匹配；nil 表示不强制，但仍会记录出现过的消息码
+	MessageCodes *MessageCodeConfig `json:"messageCodes,omitempty" yaml:"messageCodes,omitempty"`
+}
+
+// ThemeConfig 定义控制台主题，颜色在 EnableColor 为 true 时生效
+type ThemeConfig struct {
+	// Levels 各级别的颜色，键为级别名（"debug"、"info"、"warn"、"error"、"fatal" 等），
+	// 值为颜色名: "black", "red", "green", "yellow", "blue", "magenta", "cyan", "white", "gray"，
+	// 可加 "bold-" 前缀加粗，"none" 表示不着色；未设置的级别沿用默认配色
+	Levels map[string]string `json:"levels,omitempty" yaml:"levels,omitempty"`
+
+	// KeyColor 字段名的颜色，默认 "gray" 以弱化字段名、突出字段值，"none" 表示不着色
+	KeyColor string `json:"keyColor,omitempty" yaml:"keyColor,omitempty"`
+
+	// Layout 字段布局: "compact"（console 格式默认）所有字段与消息在同一行；
+	// "multiline"（dev 格式默认）字段数超过 MultilineThreshold 时每个字段单独一行
+	Layout string `json:"layout,omitempty" yaml:"layout,omitempty"`
+
+	// MultilineThreshold multiline 布局下换行输出的字段数阈值，默认 4
+	MultilineThreshold int `json:"multilineThreshold,omitempty" yaml:"multilineThreshold,omitempty"`
+
+	// HumanizeDuration 将时长字段输出为 "1.5s"、"250ms" 的形式而不是秒数，dev 格式总是开启
+	HumanizeDuration bool `json:"humanizeDuration,omitempty" yaml:"humanizeDuration,omitempty"`
+
+	// SizeKeys 字段名以其中某一项结尾（如 "bytes"、"_size"）时，整数值按字节数输出为 "1.5MiB" 的形式
+	SizeKeys []string `json:"sizeKeys,omitempty" yaml:"sizeKeys,omitempty"`
+}
+
+// 主题的字段布局
+const (
+	ThemeLayoutCompact   = internal.ThemeLayoutCompact
+	ThemeLayoutMultiline = internal.ThemeLayoutMultiline
+)
+
+// MessageCodeConfig 定义消息码强制规则
+type MessageCodeConfig struct {
+	// Enforce 违规时的处理方式: "annotate"（默认）照常输出并补上 message_code=UNCODED 和 message_code_violation 字段，
+	// "panic" 直接 panic，适合在开发环境和测试中尽早发现遗漏
+	Enforce string `json:"enforce,omitempty" yaml:"enforce,omitempty"`
+
+	// MinLevel 需要消息码的最低级别: "debug", "info", "warn", "error"，默认 "warn"
+	MinLevel string `json:"minLevel,omitempty" yaml:"minLevel,omitempty"`
+
+	// RequireRegistered 为 true 时消息码还必须通过 RegisterCode 注册，未注册的视为违规
+	RequireRegistered bool `json:"requireRegistered,omitempty" yaml:"requireRegistered,omitempty"`
+
+	// ExemptNamespaces 不检查消息码的命名空间，写法与 RouteConfig.Namespace 相同但按完整命名空间匹配，
+	// 如 "*.mq" 豁免所有服务下 mq 组件的日志
+	ExemptNamespaces []string `json:"exemptNamespaces,omitempty" yaml:"exemptNamespaces,omitempty"`
+}
+
+// CrashConfig 定义崩溃包设置
+type CrashConfig struct {
+	// RecentEntries 崩溃包中保留的最近日志条数，默认 200
+	RecentEntries int `json:"recentEntries,omitempty" yaml:"recentEntries,omitempty"`
+
+	// Dir 崩溃包写入的目录，文件名为 crash-<时间>-<pid>.json，为空时不写文件
+	Dir string `json:"dir,omitempty" yaml:"dir,omitempty"`
+
+	// Upload 崩溃包上传钩子，参数为文件名和 JSON 内容，可用于上传到对象存储
+	Upload func(name string, data []byte) error `json:"-" yaml:"-"`
+
+	// UploadTimeout 等待上传完成的最长时间，超时后放弃上传继续退出，默认 5 秒
+	UploadTimeout time.Duration `json:"uploadTimeout,omitempty" yaml:"uploadTimeout,omitempty"`
+}
+
+// RouteConfig 定义一个命名空间路由，如将 audit 命名空间写入单独的文件并保留更久
+type RouteConfig struct {
+	// Namespace 命名空间模式："audit" 匹配 audit 及其子命名空间（如 audit.login）；
+	// 包含 "*" 时按通配匹配，如 "*.access"。模式可以省略 WithNamespace 设置的根命名空间
+	Namespace string `json:"namespace" yaml:"namespace"`
+
+	// Output 输出目标: "stdout", "stderr", 或文件路径
+	Output string `json:"output" yaml:"output"`
+
+	// Level 日志级别，为空时沿用 Config.Level
+	Level string `json:"level,omitempty" yaml:"level,omitempty"`
+
+	// Format 输出格式，为空时沿用 Config.Format；console 和 dev 格式使用 Config.Theme
+	Format string `json:"format,omitempty" yaml:"format,omitempty"`
+
+	// Rotation 日志轮转配置（仅文件输出），不继承 Config.Rotation
+	Rotation *RotationConfig `json:"rotation,omitempty" yaml:"rotation,omitempty"`
+
+	// Sampling 日志采样配置，不继承 Config.Sampling，nil 表示不采样
+	Sampling *SamplingConfig `json:"sampling,omitempty" yaml:"sampling,omitempty"`
+}
+
+// SamplingConfig 定义日志采样：每个 Tick 周期内，相同级别和消息的日志先输出 Initial 条，之后每 Thereafter 条输出一条
+type SamplingConfig struct {
+	Initial    int           `json:"initial" yaml:"initial"`       // 每周期内全部输出的条数，默认 100
+	Thereafter int           `json:"thereafter" yaml:"thereafter"` // 超出后每多少条输出一条，默认 100
+	Tick       time.Duration `json:"tick" yaml:"tick"`             // 采样周期，默认 1 秒
 }
 
 // RotationConfig 定义日志文件轮转设置
 type RotationConfig struct {
-	MaxSize    int  `json:"maxSize"`    // 单个日志文件最大尺寸(MB)
+	MaxSize    int  `json:"maxSize"`    // 单个日志文件最大尺寸(MB)，0 表示不按大小轮转（仅时间轮转时）
 	MaxBackups int  `json:"maxBackups"` // 最多保留文件个数
 	MaxAge     int  `json:"maxAge"`     // 日志保留天数
 	Compress   bool `json:"compress"`   // 是否压缩轮转文件
+
+	// Interval 按时间轮转的周期: "daily" 或 "hourly"，为空时仅按大小轮转。
+	// 开启后当前文件以周期命名，如 app-2024-07-01.log，周期内超过 MaxSize 仍会按大小轮转。
+	Interval string `json:"interval,omitempty"`
+
+	// OnRotate 轮转完成后的回调，参数为轮转出的文件路径（开启压缩时为 .gz 文件），
+	// 在独立的 goroutine 中执行，可用于上传到对象存储等日志投递场景
+	OnRotate func(path string) `json:"-" yaml:"-"`
 }
 
+// 按时间轮转的周期
+const (
+	RotateDaily  = "daily"
+	RotateHourly = "hourly"
+)
+
+// 字段命名规范
+const (
+	FieldProfileECS  = "ecs"
+	FieldProfileOTel = "otel"
+)
+
 // GetDefaultConfig 返回默认的日志配置
 // 开发环境：console 格式，debug 级别，带颜色
 // 生产环境：json 格式，info 级别，无颜色
@@ -80,28 +220,163 @@ func (c *Config) Validate() error {
 	}
 
 	// 验证日志格式
-	if c.Format != "json" && c.Format != "console" {
+	if !validFormat(c.Format) {
 		return fmt.Errorf("invalid log format: %s", c.Format)
 	}
 
+	// 验证主题配置
+	if err := c.Theme.validate(); err != nil {
+		return err
+	}
+
+	// 验证字段命名规范
+	if c.FieldProfile != "" && c.FieldProfile != FieldProfileECS && c.FieldProfile != FieldProfileOTel {
+		return fmt.Errorf("invalid field profile: %s", c.FieldProfile)
+	}
+
 	// 验证输出目标
 	if c.Output == "" {
 		return fmt.Errorf("log output cannot be empty")
 	}
 
 	// 验证轮转配置
-	if c.Rotation != nil {
-		if c.Rotation.MaxSize < 0 {
-			return fmt.Errorf("rotation maxSize cannot be negative")
+	if err := c.Rotation.validate(); err != nil {
+		return err
+	}
+
+	// 验证采样配置
+	if err := c.Sampling.validate(); err != nil {
+		return err
+	}
+
+	// 验证崩溃包配置
+	if err := c.Crash.validate(); err != nil {
+		return err
+	}
+
+	// 验证消息码配置
+	if err := c.MessageCodes.validate(); err != nil {
+		return err
+	}
+
+	// 验证路由配置
+	seen := make(map[string]bool, len(c.Routes))
+	for _, route := range c.Routes {
+		if route.Namespace == "" {
+			return fmt.Errorf("route namespace cannot be empty")
+		}
+		if seen[route.Namespace] {
+			return fmt.Errorf("duplicate route namespace: %s", route.Namespace)
 		}
-		if c.Rotation.MaxBackups < 0 {
-			return fmt.Errorf("rotation maxBackups cannot be negative")
+		seen[route.Namespace] = true
+		if route.Output == "" {
+			return fmt.Errorf("route %s: output cannot be empty", route.Namespace)
 		}
-		if c.Rotation.MaxAge < 0 {
-			return fmt.Errorf("rotation maxAge cannot be negative")
+		if route.Level != "" && !validLevels[route.Level] {
+			return fmt.Errorf("route %s: invalid log level: %s", route.Namespace, route.Level)
+		}
+		if route.Format != "" && !validFormat(route.Format) {
+			return fmt.Errorf("route %s: invalid log format: %s", route.Namespace, route.Format)
+		}
+		if err := route.Rotation.validate(); err != nil {
+			return fmt.Errorf("route %s: %w", route.Namespace, err)
+		}
+		if err := route.Sampling.validate(); err != nil {
+			return fmt.Errorf("route %s: %w", route.Namespace, err)
 		}
 	}
 
 	return nil
 }
 
+// validFormat 返回输出格式是否有效
+func validFormat(format string) bool {
+	return format == "json" || format == "console" || format == "dev"
+}
+
+// validate 验证主题配置，nil 表示使用默认输出
+func (t *ThemeConfig) validate() error {
+	if t == nil {
+		return nil
+	}
+	for level, color := range t.Levels {
+		if !internal.ValidThemeLevel(level) {
+			return fmt.Errorf("invalid theme level: %s", level)
+		}
+		if !internal.ValidThemeColor(color) {
+			return fmt.Errorf("invalid theme color for %s: %s", level, color)
+		}
+	}
+	if t.KeyColor != "" && !internal.ValidThemeColor(t.KeyColor) {
+		return fmt.Errorf("invalid theme key color: %s", t.KeyColor)
+	}
+	if t.Layout != "" && t.Layout != ThemeLayoutCompact && t.Layout != ThemeLayoutMultiline {
+		return fmt.Errorf("invalid theme layout: %s", t.Layout)
+	}
+	if t.MultilineThreshold < 0 {
+		return fmt.Errorf("theme multilineThreshold cannot be negative")
+	}
+	return nil
+}
+
+// validate 验证轮转配置，nil 表示不轮转
+func (r *RotationConfig) validate() error {
+	if r == nil {
+		return nil
+	}
+	if r.MaxSize < 0 {
+		return fmt.Errorf("rotation maxSize cannot be negative")
+	}
+	if r.MaxBackups < 0 {
+		return fmt.Errorf("rotation maxBackups cannot be negative")
+	}
+	if r.MaxAge < 0 {
+		return fmt.Errorf("rotation maxAge cannot be negative")
+	}
+	if r.Interval != "" && r.Interval != RotateDaily && r.Interval != RotateHourly {
+		return fmt.Errorf("invalid rotation interval: %s", r.Interval)
+	}
+	return nil
+}
+
+// validate 验证采样配置，nil 表示不采样
+func (s *SamplingConfig) validate() error {
+	if s == nil {
+		return nil
+	}
+	if s.Initial < 0 || s.Thereafter < 0 || s.Tick < 0 {
+		return fmt.Errorf("sampling parameters cannot be negative")
+	}
+	return nil
+}
+
+
+// validate 验证崩溃包配置，nil 表示不生成崩溃包
+func (c *CrashConfig) validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.RecentEntries < 0 {
+		return fmt.Errorf("crash recentEntries cannot be negative")
+	}
+	if c.UploadTimeout < 0 {
+		return fmt.Errorf("crash uploadTimeout cannot be negative")
+	}
+	return nil
+}
+
+// validate 验证消息码配置，nil 表示不强制
+func (m *MessageCodeConfig) validate() error {
+	if m == nil {
+		return nil
+	}
+	if m.Enforce != "" && m.Enforce != MessageCodeAnnotate && m.Enforce != MessageCodePanic {
+		return fmt.Errorf("invalid message code enforce mode: %s", m.Enforce)
+	}
+	switch m.MinLevel {
+	case "", "debug", "info", "warn", "error":
+	default:
+		return fmt.Errorf("invalid message code minLevel: %s", m.MinLevel)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package clog
+
+import (
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog/internal"
+	"go.uber.org/zap"
+)
+
+// RegisterFatalHook 注册在进程因 Fatal 或 panic 退出前执行的钩子，按注册顺序执行
+// 钩子参数为触发退出的日志，可用于刷出缓冲、上报监控或关闭连接；
+// 钩子中的 panic 会被忽略，钩子应尽快返回，否则会推迟进程退出
+//
+// 使用示例：
+//
+//	clog.RegisterFatalHook(func(entry clog.LogEntry) {
+//		producer.Flush(time.Second)
+//	})
+func RegisterFatalHook(hook func(LogEntry)) {
+	internal.RegisterFatalHook(func(entry internal.CrashEntry) {
+		hook(LogEntry{
+			Level:   entry.Level,
+			Message: entry.Message,
+			Time:    entry.Time,
+			Fields:  entry.Fields,
+			Caller:  entry.Caller,
+			Stack:   entry.Stack,
+		})
+	})
+}
+
+// HandlePanic 捕获当前 goroutine 的 panic：记录 Error 日志（包含 BindContext 绑定的字段）、
+// 执行 fatal 钩子并生成崩溃包，然后重新 panic，不改变原有的崩溃行为。需要在 goroutine 入口处 defer 调用：
+//
+//	go func() {
+//		defer clog.HandlePanic()
+//		...
+//	}()
+func HandlePanic() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	msg := fmt.Sprint(r)
+	stack := string(debug.Stack())
+	bound := BoundFields()
+	fields := append([]Field{}, bound...)
+	fields = append(fields, MessageCode(codePanicRecovered), String("panic", msg), String("stack", stack))
+	getDefaultLogger().WithOptions(zap.AddCallerSkip(1)).Error("panic recovered", fields...)
+	internal.ReportCrash(internal.CrashEntry{
+		Level:   "panic",
+		Message: msg,
+		Time:    time.Now(),
+		Stack:   stack,
+		Fields:  encodeFields(bound),
+	})
+	panic(r)
+}
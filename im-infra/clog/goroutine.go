@@ -0,0 +1,95 @@
+package clog
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/ceyewan/gochat/im-infra/clog/internal"
+	"go.uber.org/zap"
+)
+
+// BindContext 将 ctx 中的 trace_id 和 fields 绑定到当前 goroutine，返回解绑函数
+// 之后在该 goroutine 中由 Recover、HandlePanic 记录的 panic 日志会自动带上这些字段，
+// 使工作池中崩溃的 goroutine 可以追溯到正在处理的请求或消息。
+// 嵌套绑定时字段在外层绑定的基础上追加，解绑后恢复外层绑定。
+//
+// 使用示例：
+//
+//	for msg := range jobs {
+//		unbind := clog.BindContext(ctx, clog.String("msg_id", msg.ID))
+//		process(msg)
+//		unbind()
+//	}
+func BindContext(ctx context.Context, fields ...Field) (unbind func()) {
+	id := internal.GoroutineID()
+	previous := internal.GoroutineFields(id)
+
+	bound := make([]Field, 0, len(previous)+len(fields)+1)
+	bound = append(bound, previous...)
+	if ctx != nil {
+		if traceID, ok := ctx.Value(traceIDKey).(string); ok && traceID != "" {
+			bound = append(bound, zap.String("trace_id", traceID))
+		}
+	}
+	bound = append(bound, fields...)
+
+	previous, hadPrevious := internal.BindGoroutineFields(id, bound)
+	return func() {
+		internal.RestoreGoroutineFields(id, previous, hadPrevious)
+	}
+}
+
+// BoundFields 返回当前 goroutine 通过 BindContext 绑定的字段
+func BoundFields() []Field {
+	return internal.GoroutineFields(internal.GoroutineID())
+}
+
+// Recover 捕获当前 goroutine 的 panic 并记录 Error 日志，日志包含绑定的字段和堆栈，panic 不再向上传播。
+// 与 HandlePanic 不同，它不执行 fatal 钩子也不生成崩溃包，适用于需要继续运行的工作池：
+//
+//	go func() {
+//		for job := range jobs {
+//			func() {
+//				unbind := clog.BindContext(job.Ctx, clog.String("job_id", job.ID))
+//				defer unbind()
+//				defer clog.Recover()
+//				job.Run()
+//			}()
+//		}
+//	}()
+//
+// 注意 defer 按后进先出执行：Recover 必须在 unbind 之后注册，记录日志时字段才仍然绑定。
+func Recover() {
+	if r := recover(); r != nil {
+		logRecovered(r, 1)
+	}
+}
+
+// Recoverer 包装工作池任务：执行 fn 前将 ctx 和 fields 绑定到执行任务的 goroutine，
+// 结束后解绑；fn 中的 panic 被恢复并连同绑定的字段记录，不会导致工作协程退出。
+//
+// 使用示例：
+//
+//	pool.Submit(clog.Recoverer(ctx, func(ctx context.Context) {
+//		handle(ctx, msg)
+//	}, clog.String("msg_id", msg.ID)))
+func Recoverer(ctx context.Context, fn func(ctx context.Context), fields ...Field) func() {
+	return func() {
+		unbind := BindContext(ctx, fields...)
+		defer unbind()
+		defer func() {
+			if r := recover(); r != nil {
+				logRecovered(r, 1)
+			}
+		}()
+		fn(ctx)
+	}
+}
+
+// logRecovered 以 Error 级别记录恢复的 panic 及当前 goroutine 绑定的字段
+func logRecovered(r interface{}, callerSkip int) {
+	fields := append([]Field{}, BoundFields()...)
+	fields = append(fields, MessageCode(codePanicRecovered), String("panic", fmt.Sprint(r)), String("stack", string(debug.Stack())))
+	getDefaultLogger().WithOptions(zap.AddCallerSkip(callerSkip+1)).Error("panic recovered", fields...)
+}
@@ -0,0 +1,150 @@
+package internal
+
+import (
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// bufferedEntry 缓冲中的一条日志，记录写入时的核心以保留 With 添加的字段
+type bufferedEntry struct {
+	core   zapcore.Core
+	entry  zapcore.Entry
+	fields []zapcore.Field
+}
+
+// RequestBuffer 请求级日志环形缓冲区
+// Warn 以下的日志先暂存，Flush 时按原始顺序写出，Discard 时直接丢弃；
+// Warn 及以上级别的日志总是立即写出，Error 及以上会先刷出已缓冲的上下文
+type RequestBuffer struct {
+	mu      sync.Mutex
+	entries []bufferedEntry
+	head    int // 最早一条日志的位置
+	count   int
+	dropped int // 缓冲区满后被覆盖的日志条数
+	closed  bool
+}
+
+// NewRequestBuffer 创建容量为 size 的请求级日志缓冲区
+func NewRequestBuffer(size int) *RequestBuffer {
+	if size <= 0 {
+		size = 1
+	}
+	return &RequestBuffer{entries: make([]bufferedEntry, size)}
+}
+
+// Option 返回将日志写入该缓冲区的 zap 选项
+func (b *RequestBuffer) Option() zap.Option {
+	return zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return &bufferCore{Core: core, buf: b}
+	})
+}
+
+// add 暂存一条日志，缓冲区已关闭时返回 false，由调用方直接写出
+func (b *RequestBuffer) add(e bufferedEntry) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return false
+	}
+	size := len(b.entries)
+	if b.count == size {
+		// 覆盖最早的一条
+		b.entries[b.head] = e
+		b.head = (b.head + 1) % size
+		b.dropped++
+		return true
+	}
+	b.entries[(b.head+b.count)%size] = e
+	b.count++
+	return true
+}
+
+// drain 取出所有已缓冲的日志并清空缓冲区
+func (b *RequestBuffer) drain() ([]bufferedEntry, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	out := make([]bufferedEntry, 0, b.count)
+	for i := 0; i < b.count; i++ {
+		idx := (b.head + i) % len(b.entries)
+		out = append(out, b.entries[idx])
+		b.entries[idx] = bufferedEntry{}
+	}
+	dropped := b.dropped
+	b.head, b.count, b.dropped = 0, 0, 0
+	return out, dropped
+}
+
+// Flush 按原始顺序写出所有已缓冲的日志，缓冲区仍可继续使用
+func (b *RequestBuffer) Flush() {
+	entries, dropped := b.drain()
+	if len(entries) == 0 {
+		return
+	}
+	if dropped > 0 {
+		// 提示最早的日志因缓冲区已满被覆盖
+		first := entries[0]
+		ent := first.entry
+		ent.Level = zapcore.WarnLevel
+		ent.Message = "clog: request log buffer overflowed, earliest entries dropped"
+		ent.Stack = ""
+		_ = first.core.Write(ent, []zapcore.Field{zap.Int("dropped", dropped)})
+	}
+	for _, e := range entries {
+		_ = e.core.Write(e.entry, e.fields)
+	}
+}
+
+// Discard 丢弃所有已缓冲的日志
+func (b *RequestBuffer) Discard() {
+	b.drain()
+}
+
+// Close 关闭缓冲区，之后的日志不再缓冲而是直接写出
+func (b *RequestBuffer) Close() {
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+}
+
+// bufferCore 将低级别日志转入 RequestBuffer 的 zapcore.Core
+type bufferCore struct {
+	zapcore.Core
+	buf *RequestBuffer
+}
+
+// With 添加字段，返回的核心仍写入同一个缓冲区
+func (c *bufferCore) With(fields []zapcore.Field) zapcore.Core {
+	return &bufferCore{Core: c.Core.With(fields), buf: c.buf}
+}
+
+// routeNamespace 为命名空间重新选择输出，返回的核心仍写入同一个缓冲区
+func (c *bufferCore) routeNamespace(namespace string) zapcore.Core {
+	return &bufferCore{Core: routeNamespace(c.Core, namespace), buf: c.buf}
+}
+
+// Check 级别满足时将自身加入 CheckedEntry，使 Write 经过缓冲区
+func (c *bufferCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+// Write 暂存 Warn 以下的日志，Error 及以上先刷出缓冲的上下文再写出
+func (c *bufferCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if ent.Level < zapcore.WarnLevel {
+		// fields 在 Write 返回后可能被复用，需要拷贝
+		copied := append([]zapcore.Field(nil), fields...)
+		if c.buf.add(bufferedEntry{core: c.Core, entry: ent, fields: copied}) {
+			return nil
+		}
+	}
+	if ent.Level >= zapcore.ErrorLevel {
+		c.buf.Flush()
+	}
+	return c.Core.Write(ent, fields)
+}
@@ -0,0 +1,352 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// maxGoroutineDump goroutine 堆栈转储的最大字节数
+const maxGoroutineDump = 64 << 20
+
+// CrashEntry 崩溃时记录的一条日志
+type CrashEntry struct {
+	Level   string                 `json:"level"`
+	Message string                 `json:"message"`
+	Time    time.Time              `json:"time"`
+	Caller  string                 `json:"caller,omitempty"`
+	Stack   string                 `json:"stack,omitempty"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+}
+
+// CrashBundle 写入磁盘或交给上传钩子的崩溃包
+type CrashBundle struct {
+	Time       time.Time    `json:"time"`
+	PID        int          `json:"pid"`
+	Hostname   string       `json:"hostname"`
+	Reason     CrashEntry   `json:"reason"`
+	Recent     []CrashEntry `json:"recent"`
+	Dropped    int          `json:"dropped"`
+	Goroutines string       `json:"goroutines"`
+}
+
+// crashConfig 崩溃包配置
+type crashConfig struct {
+	RecentEntries int
+	Dir           string
+	Upload        func(name string, data []byte) error
+	UploadTimeout time.Duration
+}
+
+// crashReporter 保存 fatal 钩子和最近一次配置了崩溃包的 logger 的环形缓冲
+type crashReporter struct {
+	mu       sync.RWMutex
+	hooks    []func(CrashEntry)
+	ring     *entryRing
+	cfg      *crashConfig
+	crashing atomic.Bool
+}
+
+var reporter = &crashReporter{}
+
+// RegisterFatalHook 注册在 Fatal 或 panic 退出前执行的钩子，按注册顺序执行
+func RegisterFatalHook(hook func(CrashEntry)) {
+	reporter.mu.Lock()
+	defer reporter.mu.Unlock()
+	reporter.hooks = append(reporter.hooks, hook)
+}
+
+// ReportCrash 依次执行 fatal 钩子并生成崩溃包，只有第一次调用生效，
+// 避免钩子中再次 Fatal 导致递归
+func ReportCrash(reason CrashEntry) {
+	if !reporter.crashing.CompareAndSwap(false, true) {
+		return
+	}
+
+	reporter.mu.RLock()
+	hooks := append([]func(CrashEntry){}, reporter.hooks...)
+	ring, cfg := reporter.ring, reporter.cfg
+	reporter.mu.RUnlock()
+
+	for _, hook := range hooks {
+		runFatalHook(hook, reason)
+	}
+	if cfg == nil {
+		return
+	}
+
+	bundle := CrashBundle{
+		Time:       time.Now(),
+		PID:        os.Getpid(),
+		Reason:     reason,
+		Goroutines: goroutineDump(),
+	}
+	bundle.Hostname, _ = os.Hostname()
+	if ring != nil {
+		bundle.Recent, bundle.Dropped = ring.snapshot()
+	}
+	data, err := json.Marshal(bundle)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "clog: failed to encode crash bundle: %v\n", err)
+		return
+	}
+	name := fmt.Sprintf("crash-%s-%d.json", bundle.Time.Format("20060102-150405"), bundle.PID)
+
+	if cfg.Dir != "" {
+		path := filepath.Join(cfg.Dir, name)
+		if err := writeCrashBundle(path, data); err != nil {
+			fmt.Fprintf(os.Stderr, "clog: failed to write crash bundle %s: %v\n", path, err)
+		} else {
+			fmt.Fprintf(os.Stderr, "clog: crash bundle written to %s\n", path)
+		}
+	}
+	if cfg.Upload != nil {
+		uploadCrashBundle(cfg, name, data)
+	}
+}
+
+// ResetCrashReporter 清空钩子和崩溃状态，仅用于测试
+func ResetCrashReporter() {
+	reporter.mu.Lock()
+	defer reporter.mu.Unlock()
+	reporter.hooks = nil
+	reporter.ring = nil
+	reporter.cfg = nil
+	reporter.crashing.Store(false)
+}
+
+// runFatalHook 执行单个钩子，钩子 panic 不影响后续钩子和崩溃包
+func runFatalHook(hook func(CrashEntry), reason CrashEntry) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintf(os.Stderr, "clog: fatal hook panicked: %v\n", r)
+		}
+	}()
+	hook(reason)
+}
+
+// uploadCrashBundle 在超时时间内等待上传完成，超时后放弃，不阻塞进程退出
+func uploadCrashBundle(cfg *crashConfig, name string, data []byte) {
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("upload panicked: %v", r)
+			}
+		}()
+		done <- cfg.Upload(name, data)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "clog: failed to upload crash bundle %s: %v\n", name, err)
+		}
+	case <-time.After(cfg.UploadTimeout):
+		fmt.Fprintf(os.Stderr, "clog: crash bundle upload timed out after %v\n", cfg.UploadTimeout)
+	}
+}
+
+func writeCrashBundle(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// goroutineDump 返回所有 goroutine 的堆栈
+func goroutineDump() string {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) || len(buf) >= maxGoroutineDump {
+			return string(buf[:n])
+		}
+		buf = make([]byte, len(buf)*2)
+	}
+}
+
+// parseCrash 解析崩溃包配置，未配置时返回 nil
+func parseCrash(crashField interface{}) *crashConfig {
+	if crashField == nil {
+		return nil
+	}
+	if v := reflect.ValueOf(crashField); v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil
+	}
+
+	crash := &crashConfig{
+		RecentEntries: getIntField(crashField, "RecentEntries", 0),
+		Dir:           getStringField(crashField, "Dir", ""),
+	}
+	if upload, ok := getField(crashField, "Upload").(func(string, []byte) error); ok {
+		crash.Upload = upload
+	}
+	if timeout, ok := getField(crashField, "UploadTimeout").(time.Duration); ok {
+		crash.UploadTimeout = timeout
+	}
+	if crash.RecentEntries <= 0 {
+		crash.RecentEntries = 200
+	}
+	if crash.UploadTimeout <= 0 {
+		crash.UploadTimeout = 5 * time.Second
+	}
+	return crash
+}
+
+// crashOptions 返回 logger 的崩溃处理选项：Fatal 日志写出后执行钩子再退出；
+// 配置了崩溃包时，同时将日志记录到环形缓冲并设为全局的崩溃包来源
+func crashOptions(config *config) []zap.Option {
+	opts := []zap.Option{zap.WithFatalHook(fatalHook{})}
+	if config.Crash == nil {
+		return opts
+	}
+
+	ring := newEntryRing(config.Crash.RecentEntries)
+	reporter.mu.Lock()
+	reporter.ring = ring
+	reporter.cfg = config.Crash
+	reporter.mu.Unlock()
+
+	recorder := &ringRecorder{LevelEnabler: parseLevel(config.Level), ring: ring}
+	return append(opts, zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return &crashCore{Core: core, recorder: recorder}
+	}))
+}
+
+// fatalHook 在 Fatal 日志写出后执行钩子、生成崩溃包，然后退出进程
+type fatalHook struct{}
+
+func (fatalHook) OnWrite(ce *zapcore.CheckedEntry, fields []zapcore.Field) {
+	ReportCrash(newCrashEntry(ce.Entry, fields))
+	ExitFunc(1)
+}
+
+// newCrashEntry 将 zap 日志转换为 CrashEntry，字段在转换时编码，避免之后被修改
+func newCrashEntry(ent zapcore.Entry, fields []zapcore.Field) CrashEntry {
+	entry := CrashEntry{
+		Level:   ent.Level.String(),
+		Message: ent.Message,
+		Time:    ent.Time,
+		Stack:   ent.Stack,
+	}
+	if ent.Caller.Defined {
+		entry.Caller = ent.Caller.TrimmedPath()
+	}
+	if len(fields) > 0 {
+		enc := zapcore.NewMapObjectEncoder()
+		for _, f := range fields {
+			f.AddTo(enc)
+		}
+		entry.Fields = enc.Fields
+	}
+	return entry
+}
+
+// entryRing 保存最近 N 条日志的环形缓冲
+type entryRing struct {
+	mu      sync.Mutex
+	entries []CrashEntry
+	head    int
+	count   int
+	dropped int
+}
+
+func newEntryRing(size int) *entryRing {
+	return &entryRing{entries: make([]CrashEntry, size)}
+}
+
+func (r *entryRing) add(entry CrashEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	size := len(r.entries)
+	if r.count == size {
+		r.entries[r.head] = entry
+		r.head = (r.head + 1) % size
+		r.dropped++
+		return
+	}
+	r.entries[(r.head+r.count)%size] = entry
+	r.count++
+}
+
+// snapshot 按记录顺序返回缓冲中的日志以及被覆盖的条数
+func (r *entryRing) snapshot() ([]CrashEntry, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]CrashEntry, 0, r.count)
+	for i := 0; i < r.count; i++ {
+		out = append(out, r.entries[(r.head+i)%len(r.entries)])
+	}
+	return out, r.dropped
+}
+
+// ringRecorder 将日志写入环形缓冲的 zapcore.Core，With 添加的字段随核心一起保存
+type ringRecorder struct {
+	zapcore.LevelEnabler
+	ring   *entryRing
+	fields []zapcore.Field
+}
+
+func (r *ringRecorder) With(fields []zapcore.Field) zapcore.Core {
+	return &ringRecorder{
+		LevelEnabler: r.LevelEnabler,
+		ring:         r.ring,
+		fields:       append(append([]zapcore.Field(nil), r.fields...), fields...),
+	}
+}
+
+func (r *ringRecorder) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if r.Enabled(ent.Level) {
+		return ce.AddCore(ent, r)
+	}
+	return ce
+}
+
+func (r *ringRecorder) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	all := fields
+	if len(r.fields) > 0 {
+		all = append(append([]zapcore.Field(nil), r.fields...), fields...)
+	}
+	r.ring.add(newCrashEntry(ent, all))
+	return nil
+}
+
+func (r *ringRecorder) Sync() error { return nil }
+
+// crashCore 在原有核心之外将日志同时记录到环形缓冲，支持命名空间路由
+type crashCore struct {
+	zapcore.Core
+	recorder *ringRecorder
+}
+
+func (c *crashCore) Enabled(level zapcore.Level) bool {
+	return c.Core.Enabled(level) || c.recorder.Enabled(level)
+}
+
+func (c *crashCore) With(fields []zapcore.Field) zapcore.Core {
+	return &crashCore{Core: c.Core.With(fields), recorder: c.recorder.With(fields).(*ringRecorder)}
+}
+
+// routeNamespace 为命名空间重新选择输出，返回的核心仍记录到同一个环形缓冲
+func (c *crashCore) routeNamespace(namespace string) zapcore.Core {
+	return &crashCore{Core: routeNamespace(c.Core, namespace), recorder: c.recorder}
+}
+
+func (c *crashCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	ce = c.Core.Check(ent, ce)
+	return c.recorder.Check(ent, ce)
+}
+
+func (c *crashCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	_ = c.recorder.Write(ent, fields)
+	return c.Core.Write(ent, fields)
+}
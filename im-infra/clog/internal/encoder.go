@@ -84,8 +84,11 @@ func customCallerEncoder(rootPath string) zapcore.CallerEncoder {
 	}
 }
 
-// createEncoder 根据格式创建编码器
-func createEncoder(format string, config zapcore.EncoderConfig) zapcore.Encoder {
+// createEncoder 根据格式创建编码器，console 格式配置了主题时和 dev 格式使用 themedEncoder
+func createEncoder(format string, config zapcore.EncoderConfig, theme *themeConfig, enableColor bool) zapcore.Encoder {
+	if resolved := resolveTheme(format, theme, enableColor); resolved != nil {
+		return newThemedEncoder(config, resolved)
+	}
 	switch format {
 	case "json":
 		return zapcore.NewJSONEncoder(config)
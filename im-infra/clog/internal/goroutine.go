@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// goroutineFields 保存各 goroutine 绑定的诊断字段，键为 goroutine ID
+var goroutineFields = struct {
+	sync.RWMutex
+	m map[uint64][]zap.Field
+}{m: make(map[uint64][]zap.Field)}
+
+// GoroutineID 返回当前 goroutine 的 ID，解析失败时返回 0。
+// Go 没有公开 goroutine ID，这里从 runtime.Stack 的首行 "goroutine 123 [running]:" 中解析，
+// 只应在绑定和查询诊断字段时使用，不要用于业务逻辑。
+func GoroutineID() uint64 {
+	var buf [64]byte
+	n := runtime.Stack(buf[:], false)
+	line := bytes.TrimPrefix(buf[:n], []byte("goroutine "))
+	if i := bytes.IndexByte(line, ' '); i > 0 {
+		line = line[:i]
+	}
+	id, err := strconv.ParseUint(string(line), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return id
+}
+
+// BindGoroutineFields 将 fields 绑定到 goroutine id，返回之前绑定的字段
+func BindGoroutineFields(id uint64, fields []zap.Field) (previous []zap.Field, hadPrevious bool) {
+	goroutineFields.Lock()
+	defer goroutineFields.Unlock()
+	previous, hadPrevious = goroutineFields.m[id]
+	goroutineFields.m[id] = fields
+	return previous, hadPrevious
+}
+
+// RestoreGoroutineFields 恢复 goroutine id 之前绑定的字段，没有之前的绑定时删除记录
+func RestoreGoroutineFields(id uint64, previous []zap.Field, hadPrevious bool) {
+	goroutineFields.Lock()
+	defer goroutineFields.Unlock()
+	if hadPrevious {
+		goroutineFields.m[id] = previous
+	} else {
+		delete(goroutineFields.m, id)
+	}
+}
+
+// GoroutineFields 返回 goroutine id 绑定的字段
+func GoroutineFields(id uint64) []zap.Field {
+	goroutineFields.RLock()
+	defer goroutineFields.RUnlock()
+	return goroutineFields.m[id]
+}
@@ -9,7 +9,6 @@ import (
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
-	"gopkg.in/natefinch/lumberjack.v2"
 )
 
 // ExitFunc allows mocking os.Exit in tests
@@ -40,6 +39,9 @@ type Logger interface {
 type zapLogger struct {
 	*zap.Logger
 	namespace string
+	routed    bool        // 配置了命名空间路由，切换命名空间时需要重新选择输出
+	codes     *codePolicy // 消息码强制规则，nil 表示不强制
+	code      string      // With 添加的消息码
 }
 
 // addNamespaceToFields 动态添加 namespace 字段到日志字段中
@@ -67,6 +69,8 @@ type rotationConfig struct {
 	MaxBackups int
 	MaxAge     int
 	Compress   bool
+	Interval   string
+	OnRotate   func(path string)
 }
 
 // config 内部配置结构，避免循环依赖
@@ -78,6 +82,12 @@ type config struct {
 	EnableColor bool
 	RootPath    string
 	Rotation    *rotationConfig
+	Profile     string // 字段命名规范，见 applyFieldProfile
+	Sampling    *samplingConfig
+	Routes      []routeConfig
+	Crash       *crashConfig
+	Codes       *codePolicy
+	Theme       *themeConfig
 }
 
 // NewLogger 创建新的 logger
@@ -85,13 +95,25 @@ func NewLogger(cfg interface{}, namespace string) (Logger, error) {
 	// 类型断言获取配置
 	config := parseConfig(cfg)
 
+	// 配置了命名空间路由时，每个路由使用独立的核心
+	if len(config.Routes) > 0 {
+		return buildRoutedLogger(config, namespace)
+	}
+
+	// 主题和 dev 格式使用自定义编码器，zap.Config 只能使用注册的编码器，因此直接构建核心
+	if resolveTheme(config.Format, config.Theme, config.EnableColor) != nil {
+		return buildThemedLogger(config, namespace)
+	}
+
 	// 创建 zap 配置
+	encoderConfig := buildEncoderConfig(config.Format, config.EnableColor, config.RootPath, config.AddSource)
+	applyFieldProfile(&encoderConfig, config.Profile)
 	zapConfig := zap.Config{
 		Level:            zap.NewAtomicLevelAt(parseLevel(config.Level)),
 		Encoding:         config.Format,
 		OutputPaths:      []string{config.Output},
 		ErrorOutputPaths: []string{"stderr"},
-		EncoderConfig:    buildEncoderConfig(config.Format, config.EnableColor, config.RootPath, config.AddSource),
+		EncoderConfig:    encoderConfig,
 	}
 
 	// 处理文件输出
@@ -115,6 +137,15 @@ func NewLogger(cfg interface{}, namespace string) (Logger, error) {
 		// 只添加 AddCaller，不设置固定的 CallerSkip
 		buildOptions = append(buildOptions, zap.AddCaller())
 	}
+	if opt := fieldProfileOption(config.Profile); opt != nil {
+		buildOptions = append(buildOptions, opt)
+	}
+	if config.Sampling != nil {
+		buildOptions = append(buildOptions, zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+			return wrapSampling(core, config.Sampling)
+		}))
+	}
+	buildOptions = append(buildOptions, crashOptions(config)...)
 
 	baseLogger, err := zapConfig.Build(buildOptions...)
 	if err != nil {
@@ -125,6 +156,7 @@ func NewLogger(cfg interface{}, namespace string) (Logger, error) {
 	return &zapLogger{
 		Logger:    baseLogger,
 		namespace: namespace,
+		codes:     config.Codes,
 	}, nil
 }
 
@@ -134,6 +166,11 @@ func NewFallbackLogger() Logger {
 	return &zapLogger{Logger: logger}
 }
 
+// NewCoreLogger 创建直接写入指定核心的 logger，不经过配置解析，用于测试中捕获日志
+func NewCoreLogger(core zapcore.Core, opts ...zap.Option) Logger {
+	return &zapLogger{Logger: zap.New(core, opts...)}
+}
+
 // With 添加字段
 func (l *zapLogger) With(fields ...zap.Field) Logger {
 	// 过滤掉 namespace 字段，避免重复
@@ -143,10 +180,17 @@ func (l *zapLogger) With(fields ...zap.Field) Logger {
 			filteredFields = append(filteredFields, field)
 		}
 	}
+	code := l.code
+	if c := messageCode(filteredFields); c != "" {
+		code = c
+	}
 
 	return &zapLogger{
 		Logger:    l.Logger.With(filteredFields...),
 		namespace: l.namespace,
+		routed:    l.routed,
+		codes:     l.codes,
+		code:      code,
 	}
 }
 
@@ -158,11 +202,15 @@ func (l *zapLogger) WithOptions(opts ...zap.Option) Logger {
 	return &zapLogger{
 		Logger:    newLogger,
 		namespace: l.namespace,
+		routed:    l.routed,
+		codes:     l.codes,
+		code:      l.code,
 	}
 }
 
 // Debug 记录 Debug 级别的日志
 func (l *zapLogger) Debug(msg string, fields ...zap.Field) {
+	fields = l.applyCode(zapcore.DebugLevel, msg, fields)
 	logger := l.Logger.WithOptions(zap.AddCallerSkip(1))
 	if l.namespace != "" {
 		allFields := make([]zap.Field, len(fields)+1)
@@ -176,6 +224,7 @@ func (l *zapLogger) Debug(msg string, fields ...zap.Field) {
 
 // Info 记录 Info 级别的日志
 func (l *zapLogger) Info(msg string, fields ...zap.Field) {
+	fields = l.applyCode(zapcore.InfoLevel, msg, fields)
 	logger := l.Logger.WithOptions(zap.AddCallerSkip(1))
 	if l.namespace != "" {
 		allFields := make([]zap.Field, len(fields)+1)
@@ -189,6 +238,7 @@ func (l *zapLogger) Info(msg string, fields ...zap.Field) {
 
 // Warn 记录 Warn 级别的日志
 func (l *zapLogger) Warn(msg string, fields ...zap.Field) {
+	fields = l.applyCode(zapcore.WarnLevel, msg, fields)
 	logger := l.Logger.WithOptions(zap.AddCallerSkip(1))
 	if l.namespace != "" {
 		allFields := make([]zap.Field, len(fields)+1)
@@ -202,6 +252,7 @@ func (l *zapLogger) Warn(msg string, fields ...zap.Field) {
 
 // Error 记录 Error 级别的日志
 func (l *zapLogger) Error(msg string, fields ...zap.Field) {
+	fields = l.applyCode(zapcore.ErrorLevel, msg, fields)
 	logger := l.Logger.WithOptions(zap.AddCallerSkip(1))
 	if l.namespace != "" {
 		allFields := make([]zap.Field, len(fields)+1)
@@ -215,6 +266,7 @@ func (l *zapLogger) Error(msg string, fields ...zap.Field) {
 
 // Fatal 记录 Fatal 级别的日志并退出程序
 func (l *zapLogger) Fatal(msg string, fields ...zap.Field) {
+	fields = l.applyCode(zapcore.FatalLevel, msg, fields)
 	logger := l.Logger.WithOptions(zap.AddCallerSkip(1))
 	if l.namespace != "" {
 		allFields := make([]zap.Field, len(fields)+1)
@@ -240,11 +292,24 @@ func (l *zapLogger) Namespace(name string) Logger {
 	// 不再在 logger 实例中添加 namespace 字段，避免重复
 	// namespace 字段会在日志记录时动态添加
 	return &zapLogger{
-		Logger:    l.Logger,
+		Logger:    l.routeLogger(fullNamespace),
 		namespace: fullNamespace,
+		routed:    l.routed,
+		codes:     l.codes,
+		code:      l.code,
 	}
 }
 
+// routeLogger 返回为命名空间选择了输出的 zap.Logger，未配置路由时原样返回
+func (l *zapLogger) routeLogger(namespace string) *zap.Logger {
+	if !l.routed {
+		return l.Logger
+	}
+	return l.Logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return routeNamespace(core, namespace)
+	}))
+}
+
 // parseConfig 解析配置
 func parseConfig(cfg interface{}) *config {
 	// 使用反射来解析配置，避免循环依赖
@@ -260,21 +325,38 @@ func parseConfig(cfg interface{}) *config {
 		AddSource:   getBoolField(cfg, "AddSource", true),
 		EnableColor: getBoolField(cfg, "EnableColor", false),
 		RootPath:    getStringField(cfg, "RootPath", ""),
+		Profile:     getStringField(cfg, "FieldProfile", ""),
 	}
 
-	// 处理轮转配置
-	if rotationField := getField(cfg, "Rotation"); rotationField != nil {
-		config.Rotation = &rotationConfig{
-			MaxSize:    getIntField(rotationField, "MaxSize", 100),
-			MaxBackups: getIntField(rotationField, "MaxBackups", 3),
-			MaxAge:     getIntField(rotationField, "MaxAge", 7),
-			Compress:   getBoolField(rotationField, "Compress", false),
-		}
-	}
+	// 处理轮转、采样和路由配置
+	config.Rotation = parseRotation(getField(cfg, "Rotation"))
+	config.Sampling = parseSampling(getField(cfg, "Sampling"))
+	config.Routes = parseRoutes(getField(cfg, "Routes"), config)
+	config.Crash = parseCrash(getField(cfg, "Crash"))
+	config.Codes = parseMessageCodes(getField(cfg, "MessageCodes"))
+	config.Theme = parseTheme(getField(cfg, "Theme"), config.EnableColor)
 
 	return config
 }
 
+// parseRotation 解析轮转配置，未找到该字段时返回 nil
+func parseRotation(rotationField interface{}) *rotationConfig {
+	if rotationField == nil {
+		return nil
+	}
+	rotation := &rotationConfig{
+		MaxSize:    getIntField(rotationField, "MaxSize", 100),
+		MaxBackups: getIntField(rotationField, "MaxBackups", 3),
+		MaxAge:     getIntField(rotationField, "MaxAge", 7),
+		Compress:   getBoolField(rotationField, "Compress", false),
+		Interval:   getStringField(rotationField, "Interval", ""),
+	}
+	if onRotate, ok := getField(rotationField, "OnRotate").(func(string)); ok {
+		rotation.OnRotate = onRotate
+	}
+	return rotation
+}
+
 // getDefaultConfig 返回默认配置
 func getDefaultConfig() *config {
 	return &config{
@@ -307,24 +389,18 @@ func parseLevel(level string) zapcore.Level {
 func buildLoggerWithRotation(config *config, namespace string) (Logger, error) {
 	// 创建编码器
 	encoderConfig := buildEncoderConfig(config.Format, config.EnableColor, config.RootPath, config.AddSource)
-	encoder := createEncoder(config.Format, encoderConfig)
+	applyFieldProfile(&encoderConfig, config.Profile)
+	encoder := createEncoder(config.Format, encoderConfig, config.Theme, config.EnableColor)
 
 	// 创建轮转写入器
-	rotatingWriter := &lumberjack.Logger{
-		Filename:   config.Output,
-		MaxSize:    config.Rotation.MaxSize,
-		MaxBackups: config.Rotation.MaxBackups,
-		MaxAge:     config.Rotation.MaxAge,
-		Compress:   config.Rotation.Compress,
-		LocalTime:  true,
-	}
+	rotatingWriter := newRotatingWriter(config.Output, config.Rotation)
 
 	// 创建核心
-	core := zapcore.NewCore(
+	core := wrapSampling(zapcore.NewCore(
 		encoder,
 		zapcore.AddSync(rotatingWriter),
 		parseLevel(config.Level),
-	)
+	), config.Sampling)
 
 	// 构建选项
 	opts := []zap.Option{
@@ -335,6 +411,10 @@ func buildLoggerWithRotation(config *config, namespace string) (Logger, error) {
 		// 只添加 AddCaller，不设置固定的 CallerSkip
 		opts = append(opts, zap.AddCaller())
 	}
+	if opt := fieldProfileOption(config.Profile); opt != nil {
+		opts = append(opts, opt)
+	}
+	opts = append(opts, crashOptions(config)...)
 
 	// 创建 logger
 	logger := zap.New(core, opts...)
@@ -343,6 +423,29 @@ func buildLoggerWithRotation(config *config, namespace string) (Logger, error) {
 	return &zapLogger{
 		Logger:    logger,
 		namespace: namespace,
+		codes:     config.Codes,
+	}, nil
+}
+
+// buildThemedLogger 构建使用 themedEncoder 的日志器，输出、轮转和采样的处理与路由中的单个输出相同
+func buildThemedLogger(config *config, namespace string) (Logger, error) {
+	core, err := buildOutputCore(config, config.Output, config.Level, config.Format, config.Rotation, config.Sampling)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []zap.Option{
+		zap.AddStacktrace(zapcore.ErrorLevel),
+	}
+	if config.AddSource {
+		opts = append(opts, zap.AddCaller())
+	}
+	opts = append(opts, crashOptions(config)...)
+
+	return &zapLogger{
+		Logger:    zap.New(core, opts...),
+		namespace: namespace,
+		codes:     config.Codes,
 	}, nil
 }
 
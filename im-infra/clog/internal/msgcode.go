@@ -0,0 +1,223 @@
+package internal
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// 消息码相关的字段名
+const (
+	// MessageCodeKey 消息码字段名
+	MessageCodeKey = "message_code"
+	// messageCodeViolationKey 违反消息码规则时附加的字段，取值为 "missing" 或 "unregistered"
+	messageCodeViolationKey = "message_code_violation"
+	// UncodedMessageCode 缺少消息码的日志在 annotate 模式下补上的消息码
+	UncodedMessageCode = "UNCODED"
+)
+
+// 消息码的强制模式
+const (
+	// CodeEnforceAnnotate 违规日志照常输出，并补上 message_code=UNCODED 和 message_code_violation 字段
+	CodeEnforceAnnotate = "annotate"
+	// CodeEnforcePanic 违规时 panic，用于开发环境和测试中尽早发现遗漏
+	CodeEnforcePanic = "panic"
+)
+
+// messageCodePattern 消息码格式：大写字母开头，由大写字母、数字和下划线组成
+var messageCodePattern = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+
+// ValidMessageCode 判断消息码格式是否合法，如 "USER_LOGIN_FAILED"
+func ValidMessageCode(code string) bool {
+	return messageCodePattern.MatchString(code)
+}
+
+// MessageCodeInfo 是注册表中的一个消息码
+type MessageCodeInfo struct {
+	// Code 消息码
+	Code string `json:"code"`
+	// Description 注册时的说明，未注册的消息码为空
+	Description string `json:"description,omitempty"`
+	// Registered 是否通过 RegisterCode 注册
+	Registered bool `json:"registered"`
+	// Count 进程启动以来使用该消息码的日志条数
+	Count uint64 `json:"count"`
+	// MaxLevel 使用该消息码的日志中最高的级别，未使用过时为空
+	MaxLevel string `json:"maxLevel,omitempty"`
+}
+
+// codeRegistry 记录注册的消息码以及运行中实际出现的消息码
+type codeRegistry struct {
+	mu    sync.RWMutex
+	codes map[string]*codeEntry
+}
+
+type codeEntry struct {
+	description string
+	registered  bool
+	count       uint64
+	maxLevel    zapcore.Level
+}
+
+var registry = &codeRegistry{codes: make(map[string]*codeEntry)}
+
+// RegisterMessageCode 注册消息码，格式不合法或同一消息码以不同说明重复注册时返回错误
+func RegisterMessageCode(code, description string) error {
+	if !ValidMessageCode(code) {
+		return fmt.Errorf("invalid message code: %q", code)
+	}
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	entry, ok := registry.codes[code]
+	if !ok {
+		registry.codes[code] = &codeEntry{description: description, registered: true, maxLevel: zapcore.InvalidLevel}
+		return nil
+	}
+	if entry.registered && entry.description != description {
+		return fmt.Errorf("message code %s already registered with description %q", code, entry.description)
+	}
+	entry.description = description
+	entry.registered = true
+	return nil
+}
+
+// MessageCodes 返回注册过或在日志中出现过的所有消息码，按消息码排序
+func MessageCodes() []MessageCodeInfo {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	infos := make([]MessageCodeInfo, 0, len(registry.codes))
+	for code, entry := range registry.codes {
+		info := MessageCodeInfo{
+			Code:        code,
+			Description: entry.description,
+			Registered:  entry.registered,
+			Count:       entry.count,
+		}
+		if entry.count > 0 {
+			info.MaxLevel = entry.maxLevel.String()
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Code < infos[j].Code })
+	return infos
+}
+
+// registered 判断消息码是否已注册
+func (r *codeRegistry) registered(code string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	entry, ok := r.codes[code]
+	return ok && entry.registered
+}
+
+// observe 记录一次消息码的使用
+func (r *codeRegistry) observe(code string, level zapcore.Level) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, ok := r.codes[code]
+	if !ok {
+		entry = &codeEntry{maxLevel: zapcore.InvalidLevel}
+		r.codes[code] = entry
+	}
+	entry.count++
+	if entry.maxLevel == zapcore.InvalidLevel || level > entry.maxLevel {
+		entry.maxLevel = level
+	}
+}
+
+// codePolicy 消息码的强制规则
+type codePolicy struct {
+	enforce           string
+	minLevel          zapcore.Level
+	requireRegistered bool
+	exempt            []string
+}
+
+// parseMessageCodes 解析消息码配置，未配置时返回 nil，即只记录出现的消息码、不做强制
+func parseMessageCodes(field interface{}) *codePolicy {
+	if field == nil {
+		return nil
+	}
+	if v := reflect.ValueOf(field); v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil
+	}
+
+	policy := &codePolicy{
+		enforce:           getStringField(field, "Enforce", ""),
+		minLevel:          parseLevel(getStringField(field, "MinLevel", "")),
+		requireRegistered: getBoolField(field, "RequireRegistered", false),
+	}
+	if policy.enforce == "" {
+		policy.enforce = CodeEnforceAnnotate
+	}
+	if getStringField(field, "MinLevel", "") == "" {
+		policy.minLevel = zapcore.WarnLevel
+	}
+	if exempt, ok := getField(field, "ExemptNamespaces").([]string); ok {
+		policy.exempt = exempt
+	}
+	return policy
+}
+
+// messageCode 返回字段中的消息码
+func messageCode(fields []zap.Field) string {
+	for i := len(fields) - 1; i >= 0; i-- {
+		if fields[i].Key == MessageCodeKey && fields[i].Type == zapcore.StringType {
+			return fields[i].String
+		}
+	}
+	return ""
+}
+
+// applyCode 记录日志使用的消息码，并按强制规则处理缺少或未注册消息码的日志，返回实际写入的字段
+func (l *zapLogger) applyCode(level zapcore.Level, msg string, fields []zap.Field) []zap.Field {
+	if !l.Logger.Core().Enabled(level) {
+		return fields
+	}
+	code := messageCode(fields)
+	if code == "" {
+		code = l.code
+	}
+	if code != "" {
+		registry.observe(code, level)
+	}
+
+	p := l.codes
+	if p == nil || level < p.minLevel || p.exempted(l.namespace) {
+		return fields
+	}
+	violation := ""
+	switch {
+	case code == "":
+		violation = "missing"
+	case p.requireRegistered && !registry.registered(code):
+		violation = "unregistered"
+	default:
+		return fields
+	}
+
+	if p.enforce == CodeEnforcePanic {
+		panic(fmt.Sprintf("clog: %s log %q in namespace %q: message code %s", level.String(), msg, l.namespace, violation))
+	}
+	annotated := make([]zap.Field, len(fields), len(fields)+2)
+	copy(annotated, fields)
+	if code == "" {
+		annotated = append(annotated, zap.String(MessageCodeKey, UncodedMessageCode))
+	}
+	return append(annotated, zap.String(messageCodeViolationKey, violation))
+}
+
+// exempted 判断命名空间是否豁免消息码检查，模式按完整命名空间匹配，写法与命名空间路由相同
+func (p *codePolicy) exempted(namespace string) bool {
+	for _, pattern := range p.exempt {
+		if matchNamespace(pattern, namespace) {
+			return true
+		}
+	}
+	return false
+}
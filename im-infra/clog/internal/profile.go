@@ -0,0 +1,131 @@
+package internal
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// 字段命名规范
+const (
+	// profileECS Elastic Common Schema，日志可直接导入 Elasticsearch/OpenSearch
+	profileECS = "ecs"
+	// profileOTel OpenTelemetry 日志数据模型
+	profileOTel = "otel"
+
+	// ecsVersion 输出的 ECS 版本号，Elastic 据此识别日志格式
+	ecsVersion = "1.6.0"
+)
+
+// applyFieldProfile 按字段命名规范修改编码器的标准字段名
+func applyFieldProfile(config *zapcore.EncoderConfig, profile string) {
+	switch profile {
+	case profileECS:
+		config.TimeKey = "@timestamp"
+		config.LevelKey = "log.level"
+		config.MessageKey = "message"
+		config.NameKey = "log.logger"
+		config.StacktraceKey = "error.stack_trace"
+		if config.CallerKey != zapcore.OmitKey {
+			config.CallerKey = "log.origin.file.name"
+		}
+		config.EncodeTime = zapcore.ISO8601TimeEncoder
+	case profileOTel:
+		config.TimeKey = "timestamp"
+		config.LevelKey = "severity_text"
+		config.MessageKey = "body"
+		config.NameKey = "scope.name"
+		config.StacktraceKey = "exception.stacktrace"
+		if config.CallerKey != zapcore.OmitKey {
+			config.CallerKey = "code.filepath"
+		}
+		config.EncodeTime = zapcore.TimeEncoderOfLayout(time.RFC3339Nano)
+		config.EncodeLevel = zapcore.CapitalLevelEncoder
+	}
+}
+
+// profileFieldRenames 返回字段命名规范下需要改名的业务字段，如 clog.WithContext 注入的 trace_id
+func profileFieldRenames(profile string) map[string]string {
+	switch profile {
+	case profileECS:
+		return map[string]string{
+			"trace_id":  "trace.id",
+			"span_id":   "span.id",
+			"namespace": "log.logger",
+			"error":     "error.message",
+		}
+	case profileOTel:
+		return map[string]string{
+			"namespace": "scope.name",
+			"error":     "exception.message",
+		}
+	}
+	return nil
+}
+
+// fieldProfileOption 返回重命名业务字段的 zap 选项，未设置命名规范时返回 nil
+func fieldProfileOption(profile string) zap.Option {
+	if profileFieldRenames(profile) == nil {
+		return nil
+	}
+	return zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return wrapFieldProfile(core, profile)
+	})
+}
+
+// wrapFieldProfile 为核心加上业务字段重命名，未设置命名规范时原样返回
+func wrapFieldProfile(core zapcore.Core, profile string) zapcore.Core {
+	renames := profileFieldRenames(profile)
+	if renames == nil {
+		return core
+	}
+	if profile == profileECS {
+		core = core.With([]zapcore.Field{zap.String("ecs.version", ecsVersion)})
+	}
+	return &renameCore{Core: core, renames: renames}
+}
+
+// renameCore 在写入前按映射表重命名字段
+type renameCore struct {
+	zapcore.Core
+	renames map[string]string
+}
+
+// With 实现 zapcore.Core
+func (c *renameCore) With(fields []zapcore.Field) zapcore.Core {
+	return &renameCore{Core: c.Core.With(c.rename(fields)), renames: c.renames}
+}
+
+// Check 实现 zapcore.Core，需要将自身加入 CheckedEntry 以保证 Write 经过重命名
+func (c *renameCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+// Write 实现 zapcore.Core
+func (c *renameCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	return c.Core.Write(ent, c.rename(fields))
+}
+
+// rename 返回重命名后的字段副本，没有需要重命名的字段时返回原切片
+func (c *renameCore) rename(fields []zapcore.Field) []zapcore.Field {
+	var renamed []zapcore.Field
+	for i, field := range fields {
+		key, ok := c.renames[field.Key]
+		if !ok {
+			continue
+		}
+		if renamed == nil {
+			renamed = make([]zapcore.Field, len(fields))
+			copy(renamed, fields)
+		}
+		renamed[i].Key = key
+	}
+	if renamed == nil {
+		return fields
+	}
+	return renamed
+}
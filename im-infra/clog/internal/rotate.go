@@ -0,0 +1,344 @@
+package internal
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// 时间轮转周期
+const (
+	IntervalDaily  = "daily"
+	IntervalHourly = "hourly"
+)
+
+const megabyte = 1024 * 1024
+
+// currentTime 返回当前时间，测试中可替换
+var currentTime = time.Now
+
+// newRotatingWriter 根据轮转配置创建写入器。
+// 仅按大小轮转且没有轮转钩子时沿用 lumberjack，否则使用支持时间+大小组合触发的 timeRotatingWriter。
+func newRotatingWriter(filename string, rotation *rotationConfig) io.Writer {
+	if rotation.Interval == "" && rotation.OnRotate == nil {
+		return &lumberjack.Logger{
+			Filename:   filename,
+			MaxSize:    rotation.MaxSize,
+			MaxBackups: rotation.MaxBackups,
+			MaxAge:     rotation.MaxAge,
+			Compress:   rotation.Compress,
+			LocalTime:  true,
+		}
+	}
+	return newTimeRotatingWriter(filename, rotation)
+}
+
+// timeRotatingWriter 同时支持按时间和按大小轮转的文件写入器。
+//
+// 按时间轮转时，当前文件以周期命名，如 app-2024-07-01.log（daily）或 app-2024-07-01-15.log（hourly）；
+// 周期内超过 MaxSize 时，当前文件被重命名为 app-2024-07-01.1.log、app-2024-07-01.2.log 等。
+// 每次轮转后会清理超出 MaxBackups/MaxAge 的旧文件，并在独立的 goroutine 中对轮转出的文件
+// 依次执行压缩（如果开启）和 OnRotate 钩子。
+type timeRotatingWriter struct {
+	base     string // 不含扩展名的文件路径
+	ext      string
+	rotation *rotationConfig
+
+	mu       sync.Mutex
+	file     *os.File
+	filename string
+	period   string
+	size     int64
+}
+
+// newTimeRotatingWriter 创建时间轮转写入器，文件在第一次写入时打开
+func newTimeRotatingWriter(filename string, rotation *rotationConfig) *timeRotatingWriter {
+	ext := filepath.Ext(filename)
+	return &timeRotatingWriter{
+		base:     strings.TrimSuffix(filename, ext),
+		ext:      ext,
+		rotation: rotation,
+	}
+}
+
+// Write 实现 io.Writer，在写入前检查时间和大小触发条件
+func (w *timeRotatingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	period := w.periodOf(currentTime())
+	if w.file == nil {
+		if err := w.open(period); err != nil {
+			return 0, err
+		}
+	} else if period != w.period {
+		if err := w.rotateByTime(period); err != nil {
+			return 0, err
+		}
+	} else if w.maxSize() > 0 && w.size+int64(len(p)) > w.maxSize() && w.size > 0 {
+		if err := w.rotateBySize(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Sync 将缓冲数据刷到磁盘
+func (w *timeRotatingWriter) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	return w.file.Sync()
+}
+
+// Close 关闭当前文件
+func (w *timeRotatingWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// periodLayout 返回周期文件名后缀的时间格式，未开启时间轮转时返回空字符串
+func (w *timeRotatingWriter) periodLayout() string {
+	switch w.rotation.Interval {
+	case IntervalDaily:
+		return "2006-01-02"
+	case IntervalHourly:
+		return "2006-01-02-15"
+	default:
+		return ""
+	}
+}
+
+// periodOf 返回时间所属周期的文件名后缀，未开启时间轮转时返回空字符串
+func (w *timeRotatingWriter) periodOf(t time.Time) string {
+	if layout := w.periodLayout(); layout != "" {
+		return t.Format(layout)
+	}
+	return ""
+}
+
+// filenameFor 返回指定周期的当前文件名
+func (w *timeRotatingWriter) filenameFor(period string) string {
+	if period == "" {
+		return w.base + w.ext
+	}
+	return w.base + "-" + period + w.ext
+}
+
+func (w *timeRotatingWriter) maxSize() int64 {
+	return int64(w.rotation.MaxSize) * megabyte
+}
+
+// open 以追加模式打开指定周期的文件
+func (w *timeRotatingWriter) open(period string) error {
+	filename := w.filenameFor(period)
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("open log file failed: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("stat log file failed: %w", err)
+	}
+
+	w.file = file
+	w.filename = filename
+	w.period = period
+	w.size = info.Size()
+	return nil
+}
+
+// rotateByTime 进入新周期：关闭旧周期的文件并打开新文件
+func (w *timeRotatingWriter) rotateByTime(period string) error {
+	rotated := w.filename
+	if err := w.file.Close(); err != nil {
+		return fmt.Errorf("close log file failed: %w", err)
+	}
+	w.file = nil
+
+	if err := w.open(period); err != nil {
+		return err
+	}
+	w.afterRotate(rotated)
+	return nil
+}
+
+// rotateBySize 将当前文件重命名为带序号的备份并重新打开
+func (w *timeRotatingWriter) rotateBySize() error {
+	if err := w.file.Close(); err != nil {
+		return fmt.Errorf("close log file failed: %w", err)
+	}
+	w.file = nil
+
+	current := strings.TrimSuffix(w.filename, w.ext)
+	var backup string
+	for seq := 1; ; seq++ {
+		backup = fmt.Sprintf("%s.%d%s", current, seq, w.ext)
+		if _, err := os.Stat(backup); os.IsNotExist(err) {
+			if _, err := os.Stat(backup + ".gz"); os.IsNotExist(err) {
+				break
+			}
+		}
+	}
+	if err := os.Rename(w.filename, backup); err != nil {
+		return fmt.Errorf("rename log file failed: %w", err)
+	}
+
+	if err := w.open(w.period); err != nil {
+		return err
+	}
+	w.afterRotate(backup)
+	return nil
+}
+
+// afterRotate 清理旧文件，并异步执行压缩和轮转钩子
+func (w *timeRotatingWriter) afterRotate(rotated string) {
+	w.prune()
+
+	if !w.rotation.Compress && w.rotation.OnRotate == nil {
+		return
+	}
+	go func() {
+		path := rotated
+		if w.rotation.Compress {
+			compressed, err := compressFile(rotated)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "clog: compress rotated log %s failed: %v\n", rotated, err)
+			} else {
+				path = compressed
+			}
+		}
+		if w.rotation.OnRotate != nil {
+			w.rotation.OnRotate(path)
+		}
+	}()
+}
+
+// prune 按 MaxBackups 和 MaxAge 删除旧的日志文件，当前文件不会被删除
+func (w *timeRotatingWriter) prune() {
+	if w.rotation.MaxBackups <= 0 && w.rotation.MaxAge <= 0 {
+		return
+	}
+
+	matches, err := filepath.Glob(w.base + "*")
+	if err != nil {
+		return
+	}
+
+	type logFile struct {
+		path    string
+		modTime time.Time
+	}
+	var files []logFile
+	for _, path := range matches {
+		if path == w.filename || !w.isBackup(path) {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		files = append(files, logFile{path: path, modTime: info.ModTime()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.After(files[j].modTime) })
+
+	cutoff := currentTime().Add(-time.Duration(w.rotation.MaxAge) * 24 * time.Hour)
+	for i, f := range files {
+		expired := w.rotation.MaxAge > 0 && f.modTime.Before(cutoff)
+		overflow := w.rotation.MaxBackups > 0 && i >= w.rotation.MaxBackups
+		if expired || overflow {
+			os.Remove(f.path)
+		}
+	}
+}
+
+// isBackup 判断文件是否为本写入器轮转出的文件：<base>[-<周期>][.<序号>]<ext>[.gz]，周期和序号至少有一个。
+// 只匹配完整的命名格式，同目录下前缀相同的其他日志（如 app.log 旁的 app-audit.log）不会被清理
+func (w *timeRotatingWriter) isBackup(path string) bool {
+	rest, ok := strings.CutPrefix(path, w.base)
+	if !ok {
+		return false
+	}
+	rest = strings.TrimSuffix(rest, ".gz")
+	if rest, ok = strings.CutSuffix(rest, w.ext); !ok {
+		return false
+	}
+
+	dated := false
+	if layout := w.periodLayout(); layout != "" && strings.HasPrefix(rest, "-") && len(rest) > len(layout) {
+		if _, err := time.Parse(layout, rest[1:len(layout)+1]); err == nil {
+			rest = rest[len(layout)+1:]
+			dated = true
+		}
+	}
+	if rest == "" {
+		return dated
+	}
+
+	seq, ok := strings.CutPrefix(rest, ".")
+	if !ok || seq == "" {
+		return false
+	}
+	for _, c := range seq {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// compressFile 将文件压缩为 .gz 并删除原文件，返回压缩后的路径
+func compressFile(path string) (string, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	dst := path + ".gz"
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return "", err
+	}
+
+	gz := gzip.NewWriter(out)
+	if _, err := io.Copy(gz, src); err != nil {
+		gz.Close()
+		out.Close()
+		os.Remove(dst)
+		return "", err
+	}
+	if err := gz.Close(); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return "", err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return "", err
+	}
+
+	return dst, os.Remove(path)
+}
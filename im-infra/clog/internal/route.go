@@ -0,0 +1,264 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// samplingConfig 日志采样配置
+type samplingConfig struct {
+	Initial    int
+	Thereafter int
+	Tick       time.Duration
+}
+
+// routeConfig 命名空间路由配置，Level 和 Format 已按顶层配置补全
+type routeConfig struct {
+	Namespace string
+	Output    string
+	Level     string
+	Format    string
+	Rotation  *rotationConfig
+	Sampling  *samplingConfig
+}
+
+// parseSampling 解析采样配置，未配置时返回 nil，未设置的参数使用默认值
+func parseSampling(samplingField interface{}) *samplingConfig {
+	if samplingField == nil {
+		return nil
+	}
+	if v := reflect.ValueOf(samplingField); v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil
+	}
+
+	sampling := &samplingConfig{
+		Initial:    getIntField(samplingField, "Initial", 0),
+		Thereafter: getIntField(samplingField, "Thereafter", 0),
+	}
+	if tick, ok := getField(samplingField, "Tick").(time.Duration); ok {
+		sampling.Tick = tick
+	}
+	if sampling.Initial <= 0 {
+		sampling.Initial = 100
+	}
+	if sampling.Thereafter <= 0 {
+		sampling.Thereafter = 100
+	}
+	if sampling.Tick <= 0 {
+		sampling.Tick = time.Second
+	}
+	return sampling
+}
+
+// parseRoutes 解析路由表，未设置的级别和格式沿用顶层配置
+func parseRoutes(routesField interface{}, parent *config) []routeConfig {
+	if routesField == nil {
+		return nil
+	}
+	v := reflect.ValueOf(routesField)
+	if v.Kind() != reflect.Slice {
+		return nil
+	}
+
+	routes := make([]routeConfig, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		item := v.Index(i).Interface()
+		route := routeConfig{
+			Namespace: getStringField(item, "Namespace", ""),
+			Output:    getStringField(item, "Output", "stdout"),
+			Level:     getStringField(item, "Level", ""),
+			Format:    getStringField(item, "Format", ""),
+			Rotation:  parseRotation(getField(item, "Rotation")),
+			Sampling:  parseSampling(getField(item, "Sampling")),
+		}
+		if route.Level == "" {
+			route.Level = parent.Level
+		}
+		if route.Format == "" {
+			route.Format = parent.Format
+		}
+		routes = append(routes, route)
+	}
+	return routes
+}
+
+// wrapSampling 为核心加上采样，未配置采样时原样返回
+func wrapSampling(core zapcore.Core, sampling *samplingConfig) zapcore.Core {
+	if sampling == nil {
+		return core
+	}
+	return zapcore.NewSamplerWithOptions(core, sampling.Tick, sampling.Initial, sampling.Thereafter)
+}
+
+// buildRoutedLogger 构建按命名空间路由的日志器：Output 和每个路由各自拥有独立的编码器、写入器、级别和采样
+func buildRoutedLogger(config *config, namespace string) (Logger, error) {
+	fallback, err := buildOutputCore(config, config.Output, config.Level, config.Format, config.Rotation, config.Sampling)
+	if err != nil {
+		return nil, err
+	}
+
+	core := &routeCore{fallback: fallback, root: namespace, active: -1}
+	for _, route := range config.Routes {
+		routeCore, err := buildOutputCore(config, route.Output, route.Level, route.Format, route.Rotation, route.Sampling)
+		if err != nil {
+			return nil, fmt.Errorf("build route %s failed: %w", route.Namespace, err)
+		}
+		core.routes = append(core.routes, namespaceRoute{pattern: route.Namespace, core: routeCore})
+	}
+
+	opts := []zap.Option{
+		zap.AddStacktrace(zapcore.ErrorLevel),
+	}
+	if config.AddSource {
+		opts = append(opts, zap.AddCaller())
+	}
+	opts = append(opts, crashOptions(config)...)
+
+	return &zapLogger{
+		Logger:    zap.New(core.routeNamespace(namespace), opts...),
+		namespace: namespace,
+		routed:    true,
+		codes:     config.Codes,
+	}, nil
+}
+
+// buildOutputCore 创建写入单个输出目标的核心，字段命名规范在核心内部应用
+func buildOutputCore(config *config, output, level, format string, rotation *rotationConfig, sampling *samplingConfig) (zapcore.Core, error) {
+	encoderConfig := buildEncoderConfig(format, config.EnableColor, config.RootPath, config.AddSource)
+	applyFieldProfile(&encoderConfig, config.Profile)
+	encoder := createEncoder(format, encoderConfig, config.Theme, config.EnableColor)
+
+	var writer zapcore.WriteSyncer
+	switch output {
+	case "stdout":
+		writer = zapcore.Lock(os.Stdout)
+	case "stderr":
+		writer = zapcore.Lock(os.Stderr)
+	default:
+		var err error
+		writer, err = buildFileWriteSyncer(outputConfig{Type: "file", Format: format, Filename: output, Rotation: rotation})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	core := zapcore.NewCore(encoder, writer, parseLevel(level))
+	core = wrapFieldProfile(core, config.Profile)
+	return wrapSampling(core, sampling), nil
+}
+
+// namespaceRoute 路由表中的一项
+type namespaceRoute struct {
+	pattern string
+	core    zapcore.Core
+}
+
+// namespaceRouter 由能够按命名空间切换输出的核心实现
+type namespaceRouter interface {
+	routeNamespace(namespace string) zapcore.Core
+}
+
+// routeNamespace 为命名空间选择输出，核心不支持路由时原样返回
+func routeNamespace(core zapcore.Core, namespace string) zapcore.Core {
+	if router, ok := core.(namespaceRouter); ok {
+		return router.routeNamespace(namespace)
+	}
+	return core
+}
+
+// routeCore 按命名空间将日志写入不同输出的 zapcore.Core。
+// 命名空间在创建 Logger 时就已确定，因此路由在 Namespace() 时完成，写日志时只访问选中的核心；
+// With 添加的字段会同时作用于所有路由，切换命名空间后不会丢失。
+type routeCore struct {
+	routes   []namespaceRoute
+	fallback zapcore.Core
+	root     string // WithNamespace 设置的根命名空间，路由模式可以省略它
+	active   int    // 选中的路由下标，-1 表示未匹配任何路由
+}
+
+// routeNamespace 返回为 namespace 选中输出的核心副本
+func (c *routeCore) routeNamespace(namespace string) zapcore.Core {
+	clone := *c
+	clone.active = c.match(namespace)
+	return &clone
+}
+
+// match 返回第一个匹配 namespace 的路由下标
+func (c *routeCore) match(namespace string) int {
+	relative := ""
+	if c.root != "" && strings.HasPrefix(namespace, c.root+".") {
+		relative = namespace[len(c.root)+1:]
+	}
+	for i, route := range c.routes {
+		if matchNamespace(route.pattern, namespace) || (relative != "" && matchNamespace(route.pattern, relative)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// matchNamespace 判断命名空间是否匹配模式：不含 "*" 时匹配自身及其子命名空间，含 "*" 时按通配匹配
+func matchNamespace(pattern, namespace string) bool {
+	if !strings.Contains(pattern, "*") {
+		return namespace == pattern || strings.HasPrefix(namespace, pattern+".")
+	}
+	if ok, _ := path.Match(pattern, namespace); ok {
+		return true
+	}
+	ok, _ := path.Match(pattern+".*", namespace)
+	return ok
+}
+
+// current 返回当前选中的核心
+func (c *routeCore) current() zapcore.Core {
+	if c.active < 0 {
+		return c.fallback
+	}
+	return c.routes[c.active].core
+}
+
+// Enabled 实现 zapcore.Core
+func (c *routeCore) Enabled(level zapcore.Level) bool {
+	return c.current().Enabled(level)
+}
+
+// With 实现 zapcore.Core，字段同时添加到所有路由
+func (c *routeCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := &routeCore{
+		routes:   make([]namespaceRoute, len(c.routes)),
+		fallback: c.fallback.With(fields),
+		root:     c.root,
+		active:   c.active,
+	}
+	for i, route := range c.routes {
+		clone.routes[i] = namespaceRoute{pattern: route.pattern, core: route.core.With(fields)}
+	}
+	return clone
+}
+
+// Check 实现 zapcore.Core，交给选中的核心判断，采样也在其中完成
+func (c *routeCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	return c.current().Check(ent, ce)
+}
+
+// Write 实现 zapcore.Core
+func (c *routeCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	return c.current().Write(ent, fields)
+}
+
+// Sync 实现 zapcore.Core，同步所有输出
+func (c *routeCore) Sync() error {
+	errs := []error{c.fallback.Sync()}
+	for _, route := range c.routes {
+		errs = append(errs, route.core.Sync())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,485 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+// 主题的字段布局
+const (
+	ThemeLayoutCompact   = "compact"
+	ThemeLayoutMultiline = "multiline"
+)
+
+// defaultMultilineThreshold multiline 布局下字段数超过该值时换行输出
+const defaultMultilineThreshold = 4
+
+// themeColors 主题可用的颜色名及其 ANSI 颜色码
+var themeColors = map[string]string{
+	"black":   "30",
+	"red":     "31",
+	"green":   "32",
+	"yellow":  "33",
+	"blue":    "34",
+	"magenta": "35",
+	"cyan":    "36",
+	"white":   "37",
+	"gray":    "90",
+}
+
+// defaultLevelColors 与 zap 的 CapitalColorLevelEncoder 保持一致
+var defaultLevelColors = map[zapcore.Level]string{
+	zapcore.DebugLevel:  "35",
+	zapcore.InfoLevel:   "34",
+	zapcore.WarnLevel:   "33",
+	zapcore.ErrorLevel:  "31",
+	zapcore.DPanicLevel: "31",
+	zapcore.PanicLevel:  "31",
+	zapcore.FatalLevel:  "31",
+}
+
+// ValidThemeColor 返回颜色名是否有效：themeColors 中的颜色，可加 "bold-" 前缀；"none" 表示不着色
+func ValidThemeColor(name string) bool {
+	if name == "none" {
+		return true
+	}
+	_, ok := themeColors[strings.TrimPrefix(name, "bold-")]
+	return ok
+}
+
+// ValidThemeLevel 返回级别名是否可以在主题中配置颜色
+func ValidThemeLevel(name string) bool {
+	var level zapcore.Level
+	return level.UnmarshalText([]byte(name)) == nil
+}
+
+// colorCode 将颜色名转换为 ANSI 颜色码，"none" 和无效的颜色名返回空串
+func colorCode(name string) string {
+	code, ok := themeColors[strings.TrimPrefix(name, "bold-")]
+	if !ok {
+		return ""
+	}
+	if strings.HasPrefix(name, "bold-") {
+		return "1;" + code
+	}
+	return code
+}
+
+// themeConfig 控制台主题配置，颜色已转换为 ANSI 颜色码
+type themeConfig struct {
+	Levels             map[zapcore.Level]string
+	KeyColor           string
+	Layout             string
+	MultilineThreshold int
+	HumanizeDuration   bool
+	SizeKeys           []string
+
+	// pretty 展开嵌套字段，仅 dev 格式
+	pretty bool
+	// color 是否着色，来自 Config.EnableColor
+	color bool
+}
+
+// parseTheme 解析主题配置，未配置时返回 nil
+func parseTheme(themeField interface{}, enableColor bool) *themeConfig {
+	if themeField == nil {
+		return nil
+	}
+	if v := reflect.ValueOf(themeField); v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil
+	}
+
+	theme := &themeConfig{
+		KeyColor:           getStringField(themeField, "KeyColor", ""),
+		Layout:             getStringField(themeField, "Layout", ""),
+		MultilineThreshold: getIntField(themeField, "MultilineThreshold", 0),
+		HumanizeDuration:   getBoolField(themeField, "HumanizeDuration", false),
+		color:              enableColor,
+	}
+	if levels, ok := getField(themeField, "Levels").(map[string]string); ok {
+		theme.Levels = make(map[zapcore.Level]string, len(levels))
+		for name, color := range levels {
+			var level zapcore.Level
+			if level.UnmarshalText([]byte(name)) == nil {
+				theme.Levels[level] = colorCode(color)
+			}
+		}
+	}
+	if sizeKeys, ok := getField(themeField, "SizeKeys").([]string); ok {
+		theme.SizeKeys = sizeKeys
+	}
+	return theme
+}
+
+// resolveTheme 返回某个格式实际使用的主题：console 格式只在配置了主题时使用，
+// dev 格式总是使用主题，并展开嵌套字段、以可读形式输出时长，默认按 multiline 布局输出
+func resolveTheme(format string, theme *themeConfig, enableColor bool) *themeConfig {
+	switch format {
+	case "console":
+		return theme
+	case "dev":
+		resolved := themeConfig{color: enableColor}
+		if theme != nil {
+			resolved = *theme
+		}
+		resolved.pretty = true
+		resolved.HumanizeDuration = true
+		if resolved.Layout == "" {
+			resolved.Layout = ThemeLayoutMultiline
+		}
+		return &resolved
+	default:
+		return nil
+	}
+}
+
+// levelColor 返回级别的 ANSI 颜色码
+func (t *themeConfig) levelColor(level zapcore.Level) string {
+	if code, ok := t.Levels[level]; ok {
+		return code
+	}
+	return defaultLevelColors[level]
+}
+
+// keyColor 返回字段名的 ANSI 颜色码，默认以灰色弱化字段名
+func (t *themeConfig) keyColor() string {
+	if t.KeyColor == "" {
+		return themeColors["gray"]
+	}
+	return colorCode(t.KeyColor)
+}
+
+// multiline 返回 n 个字段时是否每个字段单独一行
+func (t *themeConfig) multiline(n int) bool {
+	if t.Layout != ThemeLayoutMultiline {
+		return false
+	}
+	threshold := t.MultilineThreshold
+	if threshold <= 0 {
+		threshold = defaultMultilineThreshold
+	}
+	return n > threshold
+}
+
+// isSizeKey 返回字段是否按字节数输出：字段名等于 SizeKeys 中的某一项或以其结尾
+func (t *themeConfig) isSizeKey(key string) bool {
+	for _, suffix := range t.SizeKeys {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+var themePool = buffer.NewPool()
+
+// themeField 编码器收集的一个字段，值保留原始类型，输出时再按主题格式化
+type themeField struct {
+	key   string
+	value interface{}
+}
+
+// themedEncoder 按主题输出的控制台编码器：级别和字段名着色，字段以 key=value 输出，
+// 可按字段数换行，并以可读形式输出时长和字节数；dev 格式下嵌套字段展开为缩进的 JSON
+type themedEncoder struct {
+	cfg    zapcore.EncoderConfig
+	theme  *themeConfig
+	fields []themeField
+	prefix string // OpenNamespace 打开的命名空间，作为后续字段名的前缀
+}
+
+// newThemedEncoder 创建按主题输出的编码器
+func newThemedEncoder(cfg zapcore.EncoderConfig, theme *themeConfig) zapcore.Encoder {
+	return &themedEncoder{cfg: cfg, theme: theme}
+}
+
+func (e *themedEncoder) add(key string, value interface{}) {
+	e.fields = append(e.fields, themeField{key: e.prefix + key, value: value})
+}
+
+func (e *themedEncoder) AddArray(key string, arr zapcore.ArrayMarshaler) error {
+	m := zapcore.NewMapObjectEncoder()
+	err := m.AddArray(key, arr)
+	e.add(key, m.Fields[key])
+	return err
+}
+
+func (e *themedEncoder) AddObject(key string, obj zapcore.ObjectMarshaler) error {
+	m := zapcore.NewMapObjectEncoder()
+	err := m.AddObject(key, obj)
+	e.add(key, m.Fields[key])
+	return err
+}
+
+func (e *themedEncoder) AddBinary(key string, value []byte) {
+	e.add(key, base64.StdEncoding.EncodeToString(value))
+}
+
+func (e *themedEncoder) AddByteString(key string, value []byte)      { e.add(key, string(value)) }
+func (e *themedEncoder) AddBool(key string, value bool)              { e.add(key, value) }
+func (e *themedEncoder) AddComplex128(key string, value complex128)  { e.add(key, value) }
+func (e *themedEncoder) AddComplex64(key string, value complex64)    { e.add(key, complex128(value)) }
+func (e *themedEncoder) AddDuration(key string, value time.Duration) { e.add(key, value) }
+func (e *themedEncoder) AddFloat64(key string, value float64)        { e.add(key, value) }
+func (e *themedEncoder) AddFloat32(key string, value float32)        { e.add(key, float64(value)) }
+func (e *themedEncoder) AddInt(key string, value int)                { e.add(key, int64(value)) }
+func (e *themedEncoder) AddInt64(key string, value int64)            { e.add(key, value) }
+func (e *themedEncoder) AddInt32(key string, value int32)            { e.add(key, int64(value)) }
+func (e *themedEncoder) AddInt16(key string, value int16)            { e.add(key, int64(value)) }
+func (e *themedEncoder) AddInt8(key string, value int8)              { e.add(key, int64(value)) }
+func (e *themedEncoder) AddString(key, value string)                 { e.add(key, value) }
+func (e *themedEncoder) AddTime(key string, value time.Time)         { e.add(key, value) }
+func (e *themedEncoder) AddUint(key string, value uint)              { e.add(key, uint64(value)) }
+func (e *themedEncoder) AddUint64(key string, value uint64)          { e.add(key, value) }
+func (e *themedEncoder) AddUint32(key string, value uint32)          { e.add(key, uint64(value)) }
+func (e *themedEncoder) AddUint16(key string, value uint16)          { e.add(key, uint64(value)) }
+func (e *themedEncoder) AddUint8(key string, value uint8)            { e.add(key, uint64(value)) }
+func (e *themedEncoder) AddUintptr(key string, value uintptr)        { e.add(key, uint64(value)) }
+
+// AddReflected 在添加时就序列化，避免 With 保存的对象之后被修改
+func (e *themedEncoder) AddReflected(key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	e.add(key, json.RawMessage(data))
+	return nil
+}
+
+func (e *themedEncoder) OpenNamespace(key string) {
+	e.prefix += key + "."
+}
+
+// Clone 实现 zapcore.Encoder
+func (e *themedEncoder) Clone() zapcore.Encoder {
+	return &themedEncoder{
+		cfg:    e.cfg,
+		theme:  e.theme,
+		fields: append([]themeField(nil), e.fields...),
+		prefix: e.prefix,
+	}
+}
+
+// EncodeEntry 实现 zapcore.Encoder，输出格式为：时间 级别 名称 调用位置 消息 字段
+func (e *themedEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	enc := e.Clone().(*themedEncoder)
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+
+	buf := themePool.Get()
+	sep := func() {
+		if buf.Len() > 0 {
+			buf.AppendByte('\t')
+		}
+	}
+	if e.cfg.TimeKey != zapcore.OmitKey && e.cfg.EncodeTime != nil {
+		sep()
+		buf.AppendString(encodePrimitive(func(pe zapcore.PrimitiveArrayEncoder) { e.cfg.EncodeTime(ent.Time, pe) }))
+	}
+	if e.cfg.LevelKey != zapcore.OmitKey {
+		sep()
+		e.colorize(buf, e.theme.levelColor(ent.Level), ent.Level.CapitalString())
+	}
+	if ent.LoggerName != "" && e.cfg.NameKey != zapcore.OmitKey {
+		sep()
+		buf.AppendString(ent.LoggerName)
+	}
+	if ent.Caller.Defined && e.cfg.CallerKey != zapcore.OmitKey && e.cfg.EncodeCaller != nil {
+		sep()
+		buf.AppendString(encodePrimitive(func(pe zapcore.PrimitiveArrayEncoder) { e.cfg.EncodeCaller(ent.Caller, pe) }))
+	}
+	if e.cfg.MessageKey != zapcore.OmitKey {
+		sep()
+		buf.AppendString(ent.Message)
+	}
+
+	// 展开的嵌套字段总是单独成行；其余字段按布局在消息后同一行输出或逐行输出
+	multiline := e.theme.multiline(len(enc.fields))
+	inline := true
+	var blocks []themeField
+	for _, f := range enc.fields {
+		if e.theme.pretty && isNested(f.value) {
+			blocks = append(blocks, f)
+			continue
+		}
+		if multiline {
+			buf.AppendString("\n    ")
+		} else if inline {
+			buf.AppendByte('\t')
+			inline = false
+		} else {
+			buf.AppendByte(' ')
+		}
+		e.appendKey(buf, f.key)
+		buf.AppendString(e.formatValue(f.key, f.value))
+	}
+	for _, f := range blocks {
+		buf.AppendString("\n    ")
+		e.appendKey(buf, f.key)
+		buf.AppendString(strings.ReplaceAll(e.formatValue(f.key, f.value), "\n", "\n    "))
+	}
+
+	if ent.Stack != "" && e.cfg.StacktraceKey != zapcore.OmitKey {
+		buf.AppendByte('\n')
+		buf.AppendString(ent.Stack)
+	}
+	if e.cfg.LineEnding != "" {
+		buf.AppendString(e.cfg.LineEnding)
+	} else {
+		buf.AppendString(zapcore.DefaultLineEnding)
+	}
+	return buf, nil
+}
+
+// colorize 输出着色的文本，未启用颜色或颜色码为空时原样输出
+func (e *themedEncoder) colorize(buf *buffer.Buffer, code, text string) {
+	if !e.theme.color || code == "" {
+		buf.AppendString(text)
+		return
+	}
+	buf.AppendString("\x1b[" + code + "m")
+	buf.AppendString(text)
+	buf.AppendString("\x1b[0m")
+}
+
+// appendKey 输出 "key="
+func (e *themedEncoder) appendKey(buf *buffer.Buffer, key string) {
+	e.colorize(buf, e.theme.keyColor(), key+"=")
+}
+
+// formatValue 按主题格式化字段值
+func (e *themedEncoder) formatValue(key string, value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return quoteIfNeeded(v)
+	case time.Duration:
+		if e.theme.HumanizeDuration || e.cfg.EncodeDuration == nil {
+			return v.String()
+		}
+		return encodePrimitive(func(pe zapcore.PrimitiveArrayEncoder) { e.cfg.EncodeDuration(v, pe) })
+	case time.Time:
+		if e.cfg.EncodeTime == nil {
+			return v.Format(time.RFC3339Nano)
+		}
+		return encodePrimitive(func(pe zapcore.PrimitiveArrayEncoder) { e.cfg.EncodeTime(v, pe) })
+	case int64:
+		if v >= 0 && e.theme.isSizeKey(key) {
+			return humanizeBytes(uint64(v))
+		}
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		if e.theme.isSizeKey(key) {
+			return humanizeBytes(v)
+		}
+		return strconv.FormatUint(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case json.RawMessage:
+		return e.formatJSON(v)
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return e.formatJSON(data)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// formatJSON dev 格式下缩进输出 JSON，否则紧凑输出
+func (e *themedEncoder) formatJSON(data []byte) string {
+	if !e.theme.pretty {
+		return string(data)
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, data, "", "  "); err != nil {
+		return string(data)
+	}
+	return indented.String()
+}
+
+// isNested 返回值是否为需要展开的对象或数组
+func isNested(value interface{}) bool {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return len(v) > 0
+	case []interface{}:
+		return len(v) > 0
+	case json.RawMessage:
+		return len(v) > 2 && (v[0] == '{' || v[0] == '[')
+	}
+	return false
+}
+
+// quoteIfNeeded 字符串为空或包含空白、引号、等号和控制字符时加引号，保证 key=value 可以被无歧义地解析
+func quoteIfNeeded(s string) string {
+	if s == "" {
+		return `""`
+	}
+	for _, r := range s {
+		if r == '"' || r == '=' || unicode.IsSpace(r) || unicode.IsControl(r) {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
+
+// humanizeBytes 将字节数输出为 "512B"、"1.5KiB" 等形式
+func humanizeBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return strconv.FormatUint(n, 10) + "B"
+	}
+	value, exp := float64(n), 0
+	for value >= unit && exp < 5 {
+		value /= unit
+		exp++
+	}
+	value = math.Round(value*10) / 10
+	return strings.TrimSuffix(strconv.FormatFloat(value, 'f', 1, 64), ".0") + string("KMGTP"[exp-1]) + "iB"
+}
+
+// encodePrimitive 调用 zap 的时间、调用位置等编码函数并取得输出的字符串
+func encodePrimitive(encode func(zapcore.PrimitiveArrayEncoder)) string {
+	var pe primitiveCollector
+	encode(&pe)
+	return strings.Join(pe, " ")
+}
+
+// primitiveCollector 收集编码函数输出的值
+type primitiveCollector []string
+
+func (c *primitiveCollector) append(v interface{})          { *c = append(*c, fmt.Sprint(v)) }
+func (c *primitiveCollector) AppendBool(v bool)             { c.append(v) }
+func (c *primitiveCollector) AppendByteString(v []byte)     { c.append(string(v)) }
+func (c *primitiveCollector) AppendComplex128(v complex128) { c.append(v) }
+func (c *primitiveCollector) AppendComplex64(v complex64)   { c.append(v) }
+func (c *primitiveCollector) AppendFloat64(v float64)       { c.append(v) }
+func (c *primitiveCollector) AppendFloat32(v float32)       { c.append(v) }
+func (c *primitiveCollector) AppendInt(v int)               { c.append(v) }
+func (c *primitiveCollector) AppendInt64(v int64)           { c.append(v) }
+func (c *primitiveCollector) AppendInt32(v int32)           { c.append(v) }
+func (c *primitiveCollector) AppendInt16(v int16)           { c.append(v) }
+func (c *primitiveCollector) AppendInt8(v int8)             { c.append(v) }
+func (c *primitiveCollector) AppendString(v string)         { c.append(v) }
+func (c *primitiveCollector) AppendUint(v uint)             { c.append(v) }
+func (c *primitiveCollector) AppendUint64(v uint64)         { c.append(v) }
+func (c *primitiveCollector) AppendUint32(v uint32)         { c.append(v) }
+func (c *primitiveCollector) AppendUint16(v uint16)         { c.append(v) }
+func (c *primitiveCollector) AppendUint8(v uint8)           { c.append(v) }
+func (c *primitiveCollector) AppendUintptr(v uintptr)       { c.append(v) }
@@ -6,7 +6,6 @@ import (
 	"path/filepath"
 
 	"go.uber.org/zap/zapcore"
-	"gopkg.in/natefinch/lumberjack.v2"
 )
 
 // outputConfig 输出配置
@@ -51,15 +50,6 @@ func buildFileWriteSyncer(output outputConfig) (zapcore.WriteSyncer, error) {
 		return zapcore.AddSync(file), nil
 	}
 
-	// 使用 lumberjack 进行日志轮转
-	logger := &lumberjack.Logger{
-		Filename:   output.Filename,
-		MaxSize:    output.Rotation.MaxSize,
-		MaxBackups: output.Rotation.MaxBackups,
-		MaxAge:     output.Rotation.MaxAge,
-		Compress:   output.Rotation.Compress,
-		LocalTime:  true,
-	}
-
-	return zapcore.AddSync(logger), nil
+	// 按大小和/或时间进行日志轮转
+	return zapcore.AddSync(newRotatingWriter(output.Filename, output.Rotation)), nil
 }
@@ -0,0 +1,64 @@
+package clog
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/ceyewan/gochat/im-infra/clog/internal"
+	"go.uber.org/zap"
+)
+
+// 消息码强制模式，用于 MessageCodeConfig.Enforce
+const (
+	MessageCodeAnnotate = internal.CodeEnforceAnnotate
+	MessageCodePanic    = internal.CodeEnforcePanic
+)
+
+// UncodedMessageCode 缺少消息码的日志在 annotate 模式下补上的消息码
+const UncodedMessageCode = internal.UncodedMessageCode
+
+// codePanicRecovered 是 Recover、HandlePanic 记录的 panic 日志的消息码
+var codePanicRecovered = RegisterCode("PANIC_RECOVERED", "goroutine 发生 panic 并被 clog 捕获")
+
+// MessageCodeInfo 是消息码注册表中的一项，包含注册信息和进程内的使用次数
+type MessageCodeInfo = internal.MessageCodeInfo
+
+// MessageCode 创建消息码字段，消息码是不随日志文本变化的稳定标识，如 "USER_LOGIN_FAILED"。
+// 告警规则和日志分析应按 message_code 字段匹配，日志文本可以随时修改或翻译。
+// 也可以通过 With 添加，之后该 Logger 的所有日志都带有这个消息码：
+//
+//	clog.Warn("用户登录失败", clog.MessageCode("USER_LOGIN_FAILED"), clog.String("user_id", uid))
+//	logger := clog.Namespace("payment").With(clog.MessageCode("PAYMENT_CALLBACK"))
+func MessageCode(code string) Field {
+	return zap.String(internal.MessageCodeKey, code)
+}
+
+// RegisterCode 注册消息码及其说明并返回消息码，通常在包级变量中调用。
+// 消息码必须由大写字母、数字和下划线组成且以字母开头；
+// 格式不合法，或同一消息码以不同说明重复注册时 panic，以便在启动时发现冲突。
+//
+// 使用示例：
+//
+//	var codeLoginFailed = clog.RegisterCode("USER_LOGIN_FAILED", "用户登录失败，密码错误或账号被锁定")
+//
+//	clog.Warn("用户登录失败", clog.MessageCode(codeLoginFailed))
+func RegisterCode(code, description string) string {
+	if err := internal.RegisterMessageCode(code, description); err != nil {
+		panic("clog: " + err.Error())
+	}
+	return code
+}
+
+// MessageCodes 返回注册过或在日志中出现过的所有消息码，按消息码排序。
+// 未注册但出现过的消息码 Registered 为 false，可据此补全注册或发现拼写错误。
+func MessageCodes() []MessageCodeInfo {
+	return internal.MessageCodes()
+}
+
+// ExportMessageCodes 将消息码注册表以 JSON 数组写入 w，可在构建或启动时导出，
+// 供告警规则和日志分析平台同步消息码及其说明
+func ExportMessageCodes(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(MessageCodes())
+}
@@ -0,0 +1,194 @@
+package clog
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog/internal"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// TB 是 testing.TB 的子集，NewTestLogger 只依赖这些方法，避免业务代码引入 testing 包
+type TB interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+	Cleanup(func())
+}
+
+// LogEntry 捕获到的一条日志
+type LogEntry struct {
+	// Level 日志级别："debug"、"info"、"warn"、"error"、"fatal"
+	Level string
+	// Message 日志消息
+	Message string
+	// Time 记录时间
+	Time time.Time
+	// Fields 日志字段，包括 With 添加的字段以及 namespace、trace_id
+	Fields map[string]interface{}
+	// Caller 调用位置，未开启 AddSource 时为空
+	Caller string
+	// Stack 堆栈，仅 panic 或开启了堆栈记录的日志非空
+	Stack string
+}
+
+// TestLogger 将日志捕获到内存中的 Logger，用于在单元测试中断言日志行为
+// 创建后在测试期间替换全局 logger，clog.Info、clog.Namespace、clog.C(ctx) 等写出的日志都会被捕获，
+// 测试结束时自动恢复原来的全局 logger。
+// 由于替换的是全局 logger，使用 TestLogger 的测试不能调用 t.Parallel()。
+type TestLogger struct {
+	Logger
+	t    TB
+	logs *observer.ObservedLogs
+}
+
+// NewTestLogger 创建捕获所有级别日志的 TestLogger 并挂载为全局 logger
+// Fatal 日志只会被记录，不会经由 zap 退出进程，但仍会调用 SetExitFunc 设置的退出函数。
+//
+// 使用示例：
+//
+//	func TestCreateUser(t *testing.T) {
+//	    logs := clog.NewTestLogger(t)
+//	    svc.CreateUser(ctx, "alice")
+//	    logs.AssertLogged("info", "用户创建成功", clog.String("user", "alice"))
+//	}
+func NewTestLogger(t TB) *TestLogger {
+	core, logs := observer.New(zapcore.DebugLevel)
+	tl := &TestLogger{
+		Logger: internal.NewCoreLogger(core, zap.WithFatalHook(noopFatalHook{})),
+		t:      t,
+		logs:   logs,
+	}
+
+	previous := getDefaultLogger()
+	defaultLogger.Store(tl.Logger)
+	t.Cleanup(func() {
+		defaultLogger.Store(previous)
+	})
+	return tl
+}
+
+// Entries 返回目前捕获到的所有日志，按记录顺序排列
+func (l *TestLogger) Entries() []LogEntry {
+	observed := l.logs.All()
+	entries := make([]LogEntry, 0, len(observed))
+	for _, e := range observed {
+		entry := LogEntry{
+			Level:   e.Level.String(),
+			Message: e.Message,
+			Time:    e.Time,
+			Fields:  e.ContextMap(),
+			Stack:   e.Stack,
+		}
+		if e.Caller.Defined {
+			entry.Caller = e.Caller.TrimmedPath()
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// Reset 清空已捕获的日志，便于在同一个测试中分阶段断言
+func (l *TestLogger) Reset() {
+	l.logs.TakeAll()
+}
+
+// Find 返回级别为 level、消息包含 msgContains 且带有所有 fields 的日志
+// level 为空时匹配任意级别，msgContains 为空时匹配任意消息
+func (l *TestLogger) Find(level, msgContains string, fields ...Field) []LogEntry {
+	expected := encodeFields(fields)
+	var matched []LogEntry
+	for _, entry := range l.Entries() {
+		if entry.matches(level, msgContains, expected) {
+			matched = append(matched, entry)
+		}
+	}
+	return matched
+}
+
+// AssertLogged 断言至少有一条日志满足 Find 的条件，失败时报告所有已捕获的日志
+func (l *TestLogger) AssertLogged(level, msgContains string, fields ...Field) bool {
+	l.t.Helper()
+	if len(l.Find(level, msgContains, fields...)) > 0 {
+		return true
+	}
+	l.t.Errorf("clog: expected a log entry matching %s, got:\n%s",
+		describeMatch(level, msgContains, fields), l.dump())
+	return false
+}
+
+// AssertNotLogged 断言没有任何日志满足 Find 的条件，失败时报告匹配到的日志
+func (l *TestLogger) AssertNotLogged(level, msgContains string, fields ...Field) bool {
+	l.t.Helper()
+	matched := l.Find(level, msgContains, fields...)
+	if len(matched) == 0 {
+		return true
+	}
+	lines := make([]string, 0, len(matched))
+	for _, entry := range matched {
+		lines = append(lines, entry.String())
+	}
+	l.t.Errorf("clog: expected no log entry matching %s, got:\n%s",
+		describeMatch(level, msgContains, fields), strings.Join(lines, "\n"))
+	return false
+}
+
+// String 以 "[level] message {fields}" 的形式输出日志，用于断言失败时的报告
+func (e LogEntry) String() string {
+	return fmt.Sprintf("[%s] %s %v", e.Level, e.Message, e.Fields)
+}
+
+// matches 判断日志是否满足级别、消息和字段条件，expected 为已编码的期望字段
+func (e LogEntry) matches(level, msgContains string, expected map[string]interface{}) bool {
+	if level != "" && !strings.EqualFold(e.Level, level) {
+		return false
+	}
+	if !strings.Contains(e.Message, msgContains) {
+		return false
+	}
+	for key, want := range expected {
+		got, ok := e.Fields[key]
+		if !ok || !reflect.DeepEqual(got, want) {
+			return false
+		}
+	}
+	return true
+}
+
+// dump 列出所有已捕获的日志
+func (l *TestLogger) dump() string {
+	entries := l.Entries()
+	if len(entries) == 0 {
+		return "  (no entries)"
+	}
+	lines := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		lines = append(lines, "  "+entry.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// encodeFields 按日志编码时的方式编码期望字段，使 clog.Int 等构造函数与捕获结果的类型一致
+func encodeFields(fields []Field) map[string]interface{} {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	return enc.Fields
+}
+
+// describeMatch 描述断言条件
+func describeMatch(level, msgContains string, fields []Field) string {
+	if level == "" {
+		level = "any"
+	}
+	return fmt.Sprintf("level=%s msg~%q fields=%v", level, msgContains, encodeFields(fields))
+}
+
+// noopFatalHook 让 Fatal 日志只被记录，不退出测试进程
+type noopFatalHook struct{}
+
+func (noopFatalHook) OnWrite(*zapcore.CheckedEntry, []zapcore.Field) {}
@@ -24,6 +24,66 @@ type Config struct {
 	
 	// TLS 相关配置，可选
 	TLS *TLSConfig `json:"tls,omitempty"`
+
+	// DC 是本实例所在的数据中心，注册的服务实例会带上该标签，并作为 PreferLocalDC 的本地数据中心，可选
+	DC string `json:"dc,omitempty"`
+
+	// RequireEndpoint 为 true 时，注册的服务实例必须声明完整的端点信息（协议、版本、可用区和权重），可选
+	RequireEndpoint bool `json:"requireEndpoint,omitempty"`
+
+	// Mirror 是灾备 etcd 集群的配置，设置后服务注册会同时镜像到该集群，可选
+	Mirror *MirrorConfig `json:"mirror,omitempty"`
+
+	// RegistryCache 是本地注册表缓存的配置，设置后 Discover 优先从 watch 维护的内存缓存返回，
+	// etcd 不可达时继续使用缓存中的旧数据，可选
+	RegistryCache *RegistryCacheConfig `json:"registryCache,omitempty"`
+
+	// ConfigAccess 是配置中心的访问控制配置，设置后 Config() 只能访问令牌授权的键前缀，
+	// 所有配置变更都会追加到 /audit/config/ 下的审计流，可选
+	ConfigAccess *ConfigAccessConfig `json:"configAccess,omitempty"`
+}
+
+// ConfigAccessConfig 定义了配置中心的访问令牌
+type ConfigAccessConfig struct {
+	// Token 是由 ConfigAccess().IssueToken 签发的令牌，决定可以读写的键前缀
+	Token string `json:"token,omitempty"`
+
+	// Principal 是不使用令牌时审计记录中的主体，用于运维工具等需要完整访问权限、但变更仍需留痕的场景。
+	// 设置了 Token 时使用令牌授权中的主体
+	Principal string `json:"principal,omitempty"`
+}
+
+// RegistryCacheConfig 定义了本地注册表缓存的快照和新鲜度策略
+type RegistryCacheConfig struct {
+	// SnapshotPath 是快照文件路径，重启后首次同步完成前先使用快照中的数据，为空表示不持久化
+	SnapshotPath string `json:"snapshotPath,omitempty"`
+
+	// SnapshotInterval 是缓存有变更时写快照的周期，默认 30 秒
+	SnapshotInterval time.Duration `json:"snapshotInterval,omitempty"`
+
+	// ProbeInterval 是探测 watch 是否仍与 etcd 连通的周期，超过 3 个周期没有响应即视为失去同步，默认 5 秒
+	ProbeInterval time.Duration `json:"probeInterval,omitempty"`
+
+	// QueryTimeout 是缓存失去同步时直接查询 etcd 的超时时间，超时后回退到缓存，默认 3 秒
+	QueryTimeout time.Duration `json:"queryTimeout,omitempty"`
+
+	// MaxStaleness 是失去同步的缓存最多可以使用多久，超过后 Discover 返回错误，0 表示不限制
+	MaxStaleness time.Duration `json:"maxStaleness,omitempty"`
+}
+
+// MirrorConfig 定义了用于注册镜像的灾备 etcd 集群
+type MirrorConfig struct {
+	// Endpoints 是灾备 etcd 集群的地址列表
+	Endpoints []string `json:"endpoints"`
+
+	// DialTimeout 是连接灾备集群的超时时间，为 0 时使用 Config.DialTimeout
+	DialTimeout time.Duration `json:"dialTimeout,omitempty"`
+
+	// Username 是认证用户名，可选
+	Username string `json:"username,omitempty"`
+
+	// Password 是认证密码，可选
+	Password string `json:"password,omitempty"`
 }
 
 // TLSConfig 定义了 TLS 连接配置
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"context"
+	"time"
+)
+
+// AccessGrant 描述一个令牌可以访问的配置范围。
+// 前缀相对于配置中心根路径（与 Get/Set 的 key 相同），按字符串前缀匹配，
+// 应以 "/" 结尾避免 "im-logic" 同时匹配 "im-logic-admin"；"*" 表示所有键。
+type AccessGrant struct {
+	// Principal 令牌所属的主体，通常是服务或团队名，会记录在审计日志中
+	Principal string `json:"principal"`
+	// Read 可以读取和监听的键前缀，按路径成分匹配，"team-a" 与 "team-a/" 等价且不覆盖 "team-ab/"
+	Read []string `json:"read,omitempty"`
+	// Write 可以写入、删除和整树导入的键前缀，写权限隐含读权限
+	Write []string `json:"write,omitempty"`
+}
+
+// 审计记录的操作类型
+const (
+	AuditOpSet           = "set"
+	AuditOpDelete        = "delete"
+	AuditOpCompareAndSet = "cas"
+	AuditOpImportTree    = "import"
+)
+
+// AuditRecord 是一次配置变更的审计记录，写入后不再修改。
+// 只记录值的 SHA-256 摘要，不记录明文，避免审计流泄露凭据。
+type AuditRecord struct {
+	// Principal 执行变更的主体
+	Principal string `json:"principal"`
+	// Op 操作类型：AuditOpSet、AuditOpDelete、AuditOpCompareAndSet 或 AuditOpImportTree
+	Op string `json:"op"`
+	// Key 变更的键，整树导入时为导入的前缀
+	Key string `json:"key"`
+	// OldHash 变更前的值的摘要，键不存在时为空
+	OldHash string `json:"oldHash,omitempty"`
+	// NewHash 变更后的值的摘要，删除时为空；整树导入时为整棵树的摘要
+	NewHash string `json:"newHash,omitempty"`
+	// Revision 整树导入生成的修订版本名
+	Revision string `json:"revision,omitempty"`
+	// Time 变更时间
+	Time time.Time `json:"time"`
+}
+
+// AccessAdmin 管理配置访问令牌并读取审计流。
+// 令牌和审计记录分别保存在 etcd 的 /acl/config/ 和 /audit/config/ 下，
+// 应通过 etcd 用户权限限制只有运维账号可以写入 /acl/，业务服务的账号对 /audit/ 只能追加。
+type AccessAdmin interface {
+	// IssueToken 为 grant 签发一个新令牌，令牌只在返回时可见，etcd 中只保存其摘要
+	IssueToken(ctx context.Context, grant AccessGrant) (token string, err error)
+	// RevokeToken 吊销令牌，使用该令牌的实例随后的所有配置操作都会被拒绝
+	RevokeToken(ctx context.Context, token string) error
+	// Audit 按时间顺序返回键以 keyPrefix 开头的最近 limit 条审计记录，limit <= 0 表示不限制
+	Audit(ctx context.Context, keyPrefix string, limit int) ([]AuditRecord, error)
+}
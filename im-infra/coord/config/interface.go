@@ -25,12 +25,27 @@ type Watcher[T any] interface {
 	Close()
 }
 
+// AtomicSwap 控制 ImportTree 的整树切换行为。
+type AtomicSwap struct {
+	// Revision 新修订版本的目录名，为空时按当前时间自动生成
+	Revision string
+	// ExpectedRevision 期望的当前修订版本，非空时只有指针仍指向该版本才会切换，
+	// 用于防止两次并发导入互相覆盖；传入 "-" 表示要求该前缀下尚无任何版本
+	ExpectedRevision string
+	// KeepRevisions 切换成功后保留的历史版本数（不含当前版本），<= 0 表示不清理
+	KeepRevisions int
+}
+
 // ConfigCenter 是键值配置存储的接口。
 type ConfigCenter interface {
 	// Get 获取配置值并反序列化到提供的类型中。
 	Get(ctx context.Context, key string, v interface{}) error
 	// Set 序列化并存储配置值。
 	Set(ctx context.Context, key string, value interface{}) error
+	// Preview 预览 Set(ctx, key, value) 的效果而不写入：按 Schema 校验新值，
+	// 返回与当前值的逐字段差异，以及集群中写入后会收到事件的所有监听器。
+	// 新值未通过 Schema 校验时返回与 Set 相同的 *ValidationError。
+	Preview(ctx context.Context, key string, value interface{}) (*ChangePreview, error)
 	// Delete 删除配置键。
 	Delete(ctx context.Context, key string) error
 	// Watch 监听单个键的变更，并尝试反序列化为给定类型。
@@ -50,4 +65,15 @@ type ConfigCenter interface {
 	// 只有当远程配置的版本号与期望版本号匹配时，才会更新配置
 	// 这确保了配置更新的原子性，避免并发修改导致的数据丢失
 	CompareAndSet(ctx context.Context, key string, value interface{}, expectedVersion int64) error
+
+	// ===== 整树导入导出 =====
+
+	// ImportTree 将整棵配置树写入 prefix 下的新修订版本目录，全部写入成功后
+	// 再通过一次事务原子地切换指针键，读取方要么看到完整的旧版本，要么看到完整的新版本。
+	// tree 的键为相对 prefix 的路径，值为原始字节。返回新修订版本名。
+	ImportTree(ctx context.Context, prefix string, tree map[string][]byte, swap AtomicSwap) (revision string, err error)
+
+	// ExportTree 导出 prefix 下指针当前指向的整棵配置树。
+	// 如果该前缀尚未通过 ImportTree 导入过，则按普通键导出，revision 为空。
+	ExportTree(ctx context.Context, prefix string) (tree map[string][]byte, revision string, err error)
 }
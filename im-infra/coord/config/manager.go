@@ -2,7 +2,6 @@ package config
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"sync"
 	"sync/atomic"
@@ -376,24 +375,7 @@ func (m *Manager[T]) watchLoop() {
 
 // parseConfig 解析配置
 func (m *Manager[T]) parseConfig(value any) (*T, error) {
-	// 如果已经是目标类型，直接返回
-	if config, ok := value.(*T); ok {
-		return config, nil
-	}
-
-	// 尝试通过 JSON 序列化/反序列化转换
-	data, err := json.Marshal(value)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal config value: %w", err)
-	}
-
-	var config T
-	err = json.Unmarshal(data, &config)
-	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
-	}
-
-	return &config, nil
+	return decodeValue[T](value)
 }
 
 // ===== 便捷工厂函数 =====
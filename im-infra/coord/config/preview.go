@@ -0,0 +1,183 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 字段变更的类型
+const (
+	ChangeAdded    = "added"
+	ChangeRemoved  = "removed"
+	ChangeModified = "modified"
+)
+
+// FieldChange 是新旧配置值之间的一处差异
+type FieldChange struct {
+	// Path 变化的位置，与 Violation.Path 格式相同，如 "$.servers[0].port"，"$" 表示整个值
+	Path string `json:"path"`
+	// Type 变更类型：ChangeAdded、ChangeRemoved 或 ChangeModified
+	Type string `json:"type"`
+	// Old 变更前的值，新增时为空
+	Old interface{} `json:"old,omitempty"`
+	// New 变更后的值，删除时为空
+	New interface{} `json:"new,omitempty"`
+}
+
+// WatcherInfo 描述一个监听配置变更的 Watch 或 WatchPrefix 调用
+type WatcherInfo struct {
+	// Key 监听的 etcd 键或前缀，包含配置中心的前缀，如 "/config/prod/im-logic"
+	Key string `json:"key"`
+	// Prefix 为 true 时通过 WatchPrefix 监听前缀
+	Prefix bool `json:"prefix"`
+	// Instance 发起监听的进程，格式为 "<hostname>/<pid>"
+	Instance string `json:"instance"`
+	// Since 开始监听的时间
+	Since time.Time `json:"since"`
+}
+
+// Matches 判断写入 etcd 键 key 时该监听器是否会收到事件，前缀按字符串匹配，与 etcd 的前缀监听一致
+func (w WatcherInfo) Matches(key string) bool {
+	if w.Prefix {
+		return strings.HasPrefix(key, w.Key)
+	}
+	return w.Key == key
+}
+
+// ChangePreview 是 Preview 返回的变更预览，描述一次 Set 将产生的差异和影响范围
+type ChangePreview struct {
+	// Key 预览的配置键
+	Key string `json:"key"`
+	// Exists 键当前是否存在，不存在时 Set 会新建该键
+	Exists bool `json:"exists"`
+	// Version 当前值的版本，可以传给 CompareAndSet，保证写入的正是预览过的变更
+	Version int64 `json:"version,omitempty"`
+	// OldValue 和 NewValue 为当前值和将要写入的值的原始字节
+	OldValue []byte `json:"oldValue,omitempty"`
+	NewValue []byte `json:"newValue"`
+	// Changes 所有差异的位置，按路径排序；新旧值不是 JSON 时整体比较，路径为 "$"
+	Changes []FieldChange `json:"changes,omitempty"`
+	// Watchers 写入后会收到事件的监听器，来自集群中所有连接同一 etcd 的进程
+	Watchers []WatcherInfo `json:"watchers,omitempty"`
+}
+
+// Unchanged 新值与当前值完全相同时返回 true，此时 Set 仍会写入并通知监听器
+func (p *ChangePreview) Unchanged() bool {
+	return p.Exists && len(p.Changes) == 0
+}
+
+// Diff 比较两个配置值，返回按路径排序的差异。
+// 两个值都是 JSON 时逐字段比较，数字按数值比较；否则作为字符串整体比较。oldData 为 nil 表示键不存在。
+func Diff(oldData, newData []byte) []FieldChange {
+	if oldData == nil {
+		return []FieldChange{{Path: "$", Type: ChangeAdded, New: diffValue(newData)}}
+	}
+	oldValue, oldErr := decodeJSON(oldData)
+	newValue, newErr := decodeJSON(newData)
+	if oldErr != nil || newErr != nil {
+		if string(oldData) == string(newData) {
+			return nil
+		}
+		return []FieldChange{{Path: "$", Type: ChangeModified, Old: diffValue(oldData), New: diffValue(newData)}}
+	}
+
+	var changes []FieldChange
+	diffNode(oldValue, newValue, "$", &changes)
+	sort.SliceStable(changes, func(i, j int) bool { return pathLess(changes[i].Path, changes[j].Path) })
+	return changes
+}
+
+// pathLess 逐段比较两个路径，数组下标按数值比较，使 "$[2]" 排在 "$[10]" 之前
+func pathLess(a, b string) bool {
+	as, bs := splitPath(a), splitPath(b)
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if as[i] == bs[i] {
+			continue
+		}
+		if ai, ok := pathIndex(as[i]); ok {
+			if bi, ok := pathIndex(bs[i]); ok {
+				return ai < bi
+			}
+		}
+		return as[i] < bs[i]
+	}
+	return len(as) < len(bs)
+}
+
+// pathIndex 解析 "[10]" 形式的数组下标段
+func pathIndex(segment string) (int, bool) {
+	if !strings.HasPrefix(segment, "[") || !strings.HasSuffix(segment, "]") {
+		return 0, false
+	}
+	i, err := strconv.Atoi(segment[1 : len(segment)-1])
+	return i, err == nil
+}
+
+// splitPath 将 "$.servers[10].port" 拆分为 "$"、".servers"、"[10]"、".port"
+func splitPath(p string) []string {
+	var segments []string
+	start := 0
+	for i := 1; i < len(p); i++ {
+		if p[i] == '.' || p[i] == '[' {
+			segments = append(segments, p[start:i])
+			start = i
+		}
+	}
+	return append(segments, p[start:])
+}
+
+// diffNode 递归比较两个 JSON 值，对象逐键比较，数组逐元素比较，类型不同时整体替换
+func diffNode(oldValue, newValue interface{}, at string, out *[]FieldChange) {
+	switch o := oldValue.(type) {
+	case map[string]interface{}:
+		n, ok := newValue.(map[string]interface{})
+		if !ok {
+			break
+		}
+		for key, ov := range o {
+			nv, ok := n[key]
+			if !ok {
+				*out = append(*out, FieldChange{Path: at + "." + key, Type: ChangeRemoved, Old: ov})
+				continue
+			}
+			diffNode(ov, nv, at+"."+key, out)
+		}
+		for key, nv := range n {
+			if _, ok := o[key]; !ok {
+				*out = append(*out, FieldChange{Path: at + "." + key, Type: ChangeAdded, New: nv})
+			}
+		}
+		return
+	case []interface{}:
+		n, ok := newValue.([]interface{})
+		if !ok {
+			break
+		}
+		for i := 0; i < len(o) || i < len(n); i++ {
+			child := fmt.Sprintf("%s[%d]", at, i)
+			switch {
+			case i >= len(n):
+				*out = append(*out, FieldChange{Path: child, Type: ChangeRemoved, Old: o[i]})
+			case i >= len(o):
+				*out = append(*out, FieldChange{Path: child, Type: ChangeAdded, New: n[i]})
+			default:
+				diffNode(o[i], n[i], child, out)
+			}
+		}
+		return
+	}
+	if !jsonEqual(oldValue, newValue) {
+		*out = append(*out, FieldChange{Path: at, Type: ChangeModified, Old: oldValue, New: newValue})
+	}
+}
+
+// diffValue 将原始值解析为 JSON，不是 JSON 时返回字符串
+func diffValue(data []byte) interface{} {
+	if v, err := decodeJSON(data); err == nil {
+		return v
+	}
+	return string(data)
+}
@@ -0,0 +1,552 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Violation 是一处不符合 Schema 的位置
+type Violation struct {
+	// Path 出错的位置，如 "$.servers[0].port"，"$" 表示整个值
+	Path string `json:"path"`
+	// Message 出错原因
+	Message string `json:"message"`
+}
+
+// ValidationError 是配置值未通过 Schema 校验时返回的错误，
+// Set、CompareAndSet 和 ImportTree 返回的错误可以通过 errors.As 取出
+type ValidationError struct {
+	// Key 被拒绝写入的配置键
+	Key string `json:"key"`
+	// Prefix 校验失败的 Schema 所注册的前缀
+	Prefix string `json:"prefix"`
+	// Violations 所有不符合 Schema 的位置
+	Violations []Violation `json:"violations"`
+}
+
+// Error 实现 error 接口
+func (e *ValidationError) Error() string {
+	parts := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		parts[i] = v.Path + ": " + v.Message
+	}
+	return fmt.Sprintf("config %s violates schema for prefix %q: %s", e.Key, e.Prefix, strings.Join(parts, "; "))
+}
+
+// Schema 校验写入配置中心的原始值
+type Schema interface {
+	// Validate 返回值中所有不符合 Schema 的位置，通过时返回空
+	Validate(data []byte) []Violation
+}
+
+// SchemaRegistry 管理按键前缀注册的 Schema。
+// 写入键时，所有前缀与键匹配的 Schema 都必须通过，否则写入被拒绝并返回 *ValidationError；
+// 前缀按字符串匹配，应以 "/" 结尾避免 "im-logic" 同时匹配 "im-logic-admin"。
+type SchemaRegistry interface {
+	// RegisterSchema 校验 JSON Schema 后保存到 etcd 的 /schema/config/ 下，
+	// 对所有连接同一集群的实例和 config-cli 生效，同一前缀重复注册会覆盖
+	RegisterSchema(ctx context.Context, prefix string, schema []byte) error
+	// RemoveSchema 删除 etcd 中保存的 JSON Schema
+	RemoveSchema(ctx context.Context, prefix string) error
+	// Schemas 返回 etcd 中保存的所有 JSON Schema，键为前缀
+	Schemas(ctx context.Context) (map[string][]byte, error)
+	// RegisterLocal 只在本进程内为前缀注册 Schema，通常是由 Go 类型生成的 TypeSchema
+	RegisterLocal(prefix string, schema Schema)
+	// Validate 按所有匹配 key 的 Schema 校验 value，不写入配置中心
+	Validate(ctx context.Context, key string, value []byte) error
+}
+
+// TypeSchema 返回以 Go 类型为 Schema 的校验：值必须能严格反序列化为 T（不允许未知字段），
+// 并通过可选的 validator 校验。
+//
+// 示例：
+//
+//	schemas.RegisterLocal("dev/im-logic/", config.TypeSchema[LogicConfig](nil))
+func TypeSchema[T any](validator Validator[T]) Schema {
+	return typeSchema[T]{validator: validator}
+}
+
+type typeSchema[T any] struct {
+	validator Validator[T]
+}
+
+func (s typeSchema[T]) Validate(data []byte) []Violation {
+	var v T
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&v); err != nil {
+		return []Violation{decodeViolation(err)}
+	}
+	if dec.More() {
+		return []Violation{{Path: "$", Message: "unexpected data after top-level value"}}
+	}
+	if s.validator != nil {
+		if err := s.validator.Validate(&v); err != nil {
+			return []Violation{{Path: "$", Message: err.Error()}}
+		}
+	}
+	return nil
+}
+
+// decodeViolation 将 encoding/json 的错误转换为带位置的 Violation
+func decodeViolation(err error) Violation {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		p := "$"
+		if typeErr.Field != "" {
+			p += "." + typeErr.Field
+		}
+		return Violation{Path: p, Message: fmt.Sprintf("expected %s, got %s", typeErr.Type, typeErr.Value)}
+	}
+	msg := err.Error()
+	// 未知字段的错误形如 json: unknown field "xxx"
+	if field, ok := strings.CutPrefix(msg, "json: unknown field "); ok {
+		return Violation{Path: "$." + strings.Trim(field, `"`), Message: "unknown field"}
+	}
+	return Violation{Path: "$", Message: strings.TrimPrefix(msg, "json: ")}
+}
+
+// jsonSchema 是解析后的 JSON Schema 节点
+type jsonSchema struct {
+	never                bool // false Schema，拒绝任何值
+	types                []string
+	enum                 []interface{}
+	constValue           interface{}
+	hasConst             bool
+	properties           map[string]*jsonSchema
+	required             []string
+	additional           *jsonSchema
+	noAdditional         bool
+	items                *jsonSchema
+	minimum, maximum     *float64
+	exclusiveMin         *float64
+	exclusiveMax         *float64
+	minLength, maxLength *int
+	pattern              *regexp.Regexp
+	minItems, maxItems   *int
+	allOf, anyOf, oneOf  []*jsonSchema
+	not                  *jsonSchema
+}
+
+// ignoredKeywords 是不参与校验的注解关键字
+var ignoredKeywords = map[string]bool{
+	"$schema": true, "$id": true, "$comment": true, "title": true, "description": true,
+	"default": true, "examples": true, "deprecated": true, "readOnly": true, "writeOnly": true, "format": true,
+}
+
+// ParseJSONSchema 解析 JSON Schema（draft 2020-12）的常用子集：
+// type、enum、const、properties、required、additionalProperties、items、
+// minimum、maximum、exclusiveMinimum、exclusiveMaximum、minLength、maxLength、pattern、
+// minItems、maxItems、allOf、anyOf、oneOf、not。
+// title、description、default、$schema 等注解关键字被忽略，不支持的校验关键字（如 $ref）在解析时报错，
+// 避免 Schema 看似生效实际没有校验。
+func ParseJSONSchema(data []byte) (Schema, error) {
+	raw, err := decodeJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid json schema: %w", err)
+	}
+	node, err := parseSchemaNode(raw, "$")
+	if err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// decodeJSON 解析 JSON 并保留数字的原始精度
+func decodeJSON(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("unexpected data after top-level value")
+	}
+	return v, nil
+}
+
+func parseSchemaNode(raw interface{}, at string) (*jsonSchema, error) {
+	if b, ok := raw.(bool); ok {
+		// true 接受任何值，false 拒绝任何值
+		if b {
+			return &jsonSchema{}, nil
+		}
+		return &jsonSchema{never: true}, nil
+	}
+	obj, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("schema at %s must be an object or boolean", at)
+	}
+
+	s := &jsonSchema{}
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := obj[k]
+		var err error
+		switch k {
+		case "type":
+			s.types, err = parseTypes(v)
+		case "enum":
+			arr, ok := v.([]interface{})
+			if !ok {
+				err = errors.New("must be an array")
+			}
+			s.enum = arr
+		case "const":
+			s.constValue, s.hasConst = v, true
+		case "properties":
+			props, ok := v.(map[string]interface{})
+			if !ok {
+				err = errors.New("must be an object")
+				break
+			}
+			s.properties = make(map[string]*jsonSchema, len(props))
+			for name, sub := range props {
+				if s.properties[name], err = parseSchemaNode(sub, at+"."+name); err != nil {
+					return nil, err
+				}
+			}
+		case "required":
+			s.required, err = parseStrings(v)
+		case "additionalProperties":
+			if b, ok := v.(bool); ok {
+				s.noAdditional = !b
+				break
+			}
+			s.additional, err = parseSchemaNode(v, at+".additionalProperties")
+		case "items":
+			s.items, err = parseSchemaNode(v, at+"[]")
+		case "minimum":
+			s.minimum, err = parseNumber(v)
+		case "maximum":
+			s.maximum, err = parseNumber(v)
+		case "exclusiveMinimum":
+			s.exclusiveMin, err = parseNumber(v)
+		case "exclusiveMaximum":
+			s.exclusiveMax, err = parseNumber(v)
+		case "minLength":
+			s.minLength, err = parseCount(v)
+		case "maxLength":
+			s.maxLength, err = parseCount(v)
+		case "minItems":
+			s.minItems, err = parseCount(v)
+		case "maxItems":
+			s.maxItems, err = parseCount(v)
+		case "pattern":
+			str, ok := v.(string)
+			if !ok {
+				err = errors.New("must be a string")
+				break
+			}
+			s.pattern, err = regexp.Compile(str)
+		case "allOf", "anyOf", "oneOf":
+			var subs []*jsonSchema
+			if subs, err = parseSchemaList(v, at+"."+k); err != nil {
+				return nil, err
+			}
+			switch k {
+			case "allOf":
+				s.allOf = subs
+			case "anyOf":
+				s.anyOf = subs
+			default:
+				s.oneOf = subs
+			}
+		case "not":
+			s.not, err = parseSchemaNode(v, at+".not")
+		default:
+			if !ignoredKeywords[k] {
+				err = errors.New("unsupported keyword")
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("schema keyword %q at %s: %w", k, at, err)
+		}
+	}
+	return s, nil
+}
+
+func parseTypes(v interface{}) ([]string, error) {
+	var types []string
+	switch t := v.(type) {
+	case string:
+		types = []string{t}
+	case []interface{}:
+		var err error
+		if types, err = parseStrings(t); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("must be a string or an array of strings")
+	}
+	for _, t := range types {
+		switch t {
+		case "object", "array", "string", "number", "integer", "boolean", "null":
+		default:
+			return nil, fmt.Errorf("unknown type %q", t)
+		}
+	}
+	return types, nil
+}
+
+func parseStrings(v interface{}) ([]string, error) {
+	arr, ok := v.([]interface{})
+	if !ok {
+		return nil, errors.New("must be an array of strings")
+	}
+	out := make([]string, len(arr))
+	for i, item := range arr {
+		if out[i], ok = item.(string); !ok {
+			return nil, errors.New("must be an array of strings")
+		}
+	}
+	return out, nil
+}
+
+func parseNumber(v interface{}) (*float64, error) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return nil, errors.New("must be a number")
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+func parseCount(v interface{}) (*int, error) {
+	f, err := parseNumber(v)
+	if err != nil {
+		return nil, err
+	}
+	if *f < 0 || *f != math.Trunc(*f) {
+		return nil, errors.New("must be a non-negative integer")
+	}
+	n := int(*f)
+	return &n, nil
+}
+
+func parseSchemaList(v interface{}, at string) ([]*jsonSchema, error) {
+	arr, ok := v.([]interface{})
+	if !ok || len(arr) == 0 {
+		return nil, fmt.Errorf("schema at %s must be a non-empty array", at)
+	}
+	subs := make([]*jsonSchema, len(arr))
+	for i, item := range arr {
+		var err error
+		if subs[i], err = parseSchemaNode(item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+			return nil, err
+		}
+	}
+	return subs, nil
+}
+
+// Validate 实现 Schema 接口
+func (s *jsonSchema) Validate(data []byte) []Violation {
+	v, err := decodeJSON(data)
+	if err != nil {
+		return []Violation{{Path: "$", Message: "invalid JSON: " + err.Error()}}
+	}
+	var violations []Violation
+	s.validate(v, "$", &violations)
+	return violations
+}
+
+func (s *jsonSchema) validate(v interface{}, at string, out *[]Violation) {
+	add := func(format string, args ...interface{}) {
+		*out = append(*out, Violation{Path: at, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if s.never {
+		add("no value is allowed here")
+		return
+	}
+	if len(s.types) > 0 && !matchesType(v, s.types) {
+		add("expected %s, got %s", strings.Join(s.types, " or "), jsonType(v))
+		return
+	}
+	if len(s.enum) > 0 {
+		found := false
+		for _, candidate := range s.enum {
+			if jsonEqual(v, candidate) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			add("value is not one of the allowed values")
+		}
+	}
+	if s.hasConst && !jsonEqual(v, s.constValue) {
+		add("value must be %s", compactJSON(s.constValue))
+	}
+
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for _, name := range s.required {
+			if _, ok := value[name]; !ok {
+				add("missing required property %q", name)
+			}
+		}
+		names := make([]string, 0, len(value))
+		for name := range value {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			child := at + "." + name
+			if prop, ok := s.properties[name]; ok {
+				prop.validate(value[name], child, out)
+			} else if s.noAdditional {
+				*out = append(*out, Violation{Path: child, Message: "unknown property"})
+			} else if s.additional != nil {
+				s.additional.validate(value[name], child, out)
+			}
+		}
+	case []interface{}:
+		if s.minItems != nil && len(value) < *s.minItems {
+			add("must have at least %d items, got %d", *s.minItems, len(value))
+		}
+		if s.maxItems != nil && len(value) > *s.maxItems {
+			add("must have at most %d items, got %d", *s.maxItems, len(value))
+		}
+		if s.items != nil {
+			for i, item := range value {
+				s.items.validate(item, fmt.Sprintf("%s[%d]", at, i), out)
+			}
+		}
+	case string:
+		n := utf8.RuneCountInString(value)
+		if s.minLength != nil && n < *s.minLength {
+			add("must be at least %d characters, got %d", *s.minLength, n)
+		}
+		if s.maxLength != nil && n > *s.maxLength {
+			add("must be at most %d characters, got %d", *s.maxLength, n)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(value) {
+			add("must match pattern %q", s.pattern.String())
+		}
+	case json.Number:
+		f, _ := value.Float64()
+		if s.minimum != nil && f < *s.minimum {
+			add("must be >= %v, got %s", *s.minimum, value)
+		}
+		if s.maximum != nil && f > *s.maximum {
+			add("must be <= %v, got %s", *s.maximum, value)
+		}
+		if s.exclusiveMin != nil && f <= *s.exclusiveMin {
+			add("must be > %v, got %s", *s.exclusiveMin, value)
+		}
+		if s.exclusiveMax != nil && f >= *s.exclusiveMax {
+			add("must be < %v, got %s", *s.exclusiveMax, value)
+		}
+	}
+
+	for _, sub := range s.allOf {
+		sub.validate(v, at, out)
+	}
+	if len(s.anyOf) > 0 && countMatches(s.anyOf, v, at) == 0 {
+		add("must match at least one schema in anyOf")
+	}
+	if len(s.oneOf) > 0 {
+		if n := countMatches(s.oneOf, v, at); n != 1 {
+			add("must match exactly one schema in oneOf, matched %d", n)
+		}
+	}
+	if s.not != nil && countMatches([]*jsonSchema{s.not}, v, at) == 1 {
+		add("must not match the schema in not")
+	}
+}
+
+// countMatches 返回 v 通过校验的子 Schema 个数
+func countMatches(subs []*jsonSchema, v interface{}, at string) int {
+	n := 0
+	for _, sub := range subs {
+		var violations []Violation
+		sub.validate(v, at, &violations)
+		if len(violations) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func matchesType(v interface{}, types []string) bool {
+	actual := jsonType(v)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonType 返回值的 JSON 类型，没有小数部分的数字为 integer
+func jsonType(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	case json.Number:
+		if f, err := value.Float64(); err == nil && f == math.Trunc(f) && !math.IsInf(f, 0) {
+			return "integer"
+		}
+		return "number"
+	default:
+		return "unknown"
+	}
+}
+
+// jsonEqual 按 JSON 语义比较两个值，数字按数值比较
+func jsonEqual(a, b interface{}) bool {
+	return reflect.DeepEqual(normalizeNumbers(a), normalizeNumbers(b))
+}
+
+func normalizeNumbers(v interface{}) interface{} {
+	switch value := v.(type) {
+	case json.Number:
+		f, _ := value.Float64()
+		return f
+	case []interface{}:
+		out := make([]interface{}, len(value))
+		for i, item := range value {
+			out[i] = normalizeNumbers(item)
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(value))
+		for k, item := range value {
+			out[k] = normalizeNumbers(item)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+func compactJSON(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
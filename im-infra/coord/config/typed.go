@@ -0,0 +1,199 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+)
+
+// ValidatorFunc 是函数形式的 Validator，便于直接传入闭包
+type ValidatorFunc[T any] func(config *T) error
+
+// Validate 实现 Validator 接口
+func (f ValidatorFunc[T]) Validate(config *T) error {
+	return f(config)
+}
+
+// TypedConfig 是一个类型化的只读配置句柄，持有的值会随配置中心的变更原子地替换。
+//
+// 与 Manager 相比，TypedConfig 直接绑定任意配置键，不涉及 env/service/component 的键规则，
+// 也没有两阶段更新器，适合作为各组件内嵌的最小配置原语：
+//   - 读穿：创建时从配置中心读取，读取失败或校验失败时使用默认值
+//   - 热更新：通过 Watch 持续跟踪变更，校验失败的新值会被拒绝，保留当前值
+//   - 删除回退：配置键被删除时回退到默认值
+type TypedConfig[T any] struct {
+	configCenter ConfigCenter
+	key          string
+	defaultValue T
+	validator    Validator[T]
+	logger       clog.Logger
+
+	current atomic.Pointer[T]
+	watcher Watcher[any]
+	cancel  context.CancelFunc
+	once    sync.Once
+}
+
+// TypedOption 类型化配置选项
+type TypedOption[T any] func(*TypedConfig[T])
+
+// WithTypedLogger 设置类型化配置的日志器
+func WithTypedLogger[T any](logger clog.Logger) TypedOption[T] {
+	return func(t *TypedConfig[T]) {
+		t.logger = logger
+	}
+}
+
+// Typed 创建一个绑定到 key 的类型化配置并启动监听。
+// validator 可以为 nil；默认值不经过校验。调用方需在不再使用时调用 Close。
+// configCenter 为 nil 时返回一个始终持有默认值的句柄。
+func Typed[T any](configCenter ConfigCenter, key string, defaultValue T, validator Validator[T], opts ...TypedOption[T]) (*TypedConfig[T], error) {
+	if key == "" {
+		return nil, fmt.Errorf("config key cannot be empty")
+	}
+
+	t := &TypedConfig[T]{
+		configCenter: configCenter,
+		key:          key,
+		defaultValue: defaultValue,
+		validator:    validator,
+		logger:       clog.Namespace("coord.config.typed"),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	t.storeDefault()
+	if configCenter == nil {
+		return t, nil
+	}
+
+	// 先建立监听再读取：读取之后的变更都会产生事件。
+	// 事件在读取完成后才开始处理，避免读到的旧值覆盖监听中已应用的新值
+	ctx, cancel := context.WithCancel(context.Background())
+	var probe T
+	watcher, err := configCenter.Watch(ctx, key, &probe)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to watch config %s: %w", key, err)
+	}
+	t.watcher = watcher
+	t.cancel = cancel
+
+	t.load()
+
+	go t.watchLoop()
+	return t, nil
+}
+
+// Load 返回当前配置。返回值不应被修改，配置更新时会替换为新的指针。
+func (t *TypedConfig[T]) Load() *T {
+	return t.current.Load()
+}
+
+// Key 返回绑定的配置键
+func (t *TypedConfig[T]) Key() string {
+	return t.key
+}
+
+// Close 停止监听，之后 Load 将一直返回最后一次的值。可以安全地多次调用。
+func (t *TypedConfig[T]) Close() {
+	t.once.Do(func() {
+		if t.watcher != nil {
+			t.watcher.Close()
+		}
+		if t.cancel != nil {
+			t.cancel()
+		}
+	})
+}
+
+// storeDefault 存储默认值的副本
+func (t *TypedConfig[T]) storeDefault() {
+	defaultCopy := t.defaultValue
+	t.current.Store(&defaultCopy)
+}
+
+// load 从配置中心读取一次配置
+func (t *TypedConfig[T]) load() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var value T
+	if err := t.configCenter.Get(ctx, t.key, &value); err != nil {
+		t.logger.Warn("failed to load config from center, using default",
+			clog.Err(err),
+			clog.String("key", t.key))
+		return
+	}
+
+	if err := t.apply(&value); err != nil {
+		t.logger.Warn("invalid config in center, using default",
+			clog.Err(err),
+			clog.String("key", t.key))
+	}
+}
+
+// apply 校验并原子地替换当前配置
+func (t *TypedConfig[T]) apply(value *T) error {
+	if t.validator != nil {
+		if err := t.validator.Validate(value); err != nil {
+			return fmt.Errorf("validation failed: %w", err)
+		}
+	}
+	t.current.Store(value)
+	return nil
+}
+
+// watchLoop 处理配置变更事件
+func (t *TypedConfig[T]) watchLoop() {
+	for event := range t.watcher.Chan() {
+		switch event.Type {
+		case EventTypePut:
+			value, err := decodeValue[T](event.Value)
+			if err != nil {
+				t.logger.Error("failed to parse config from event",
+					clog.Err(err),
+					clog.String("key", t.key))
+				continue
+			}
+			if err := t.apply(value); err != nil {
+				t.logger.Warn("invalid config received, update rejected",
+					clog.Err(err),
+					clog.String("key", t.key))
+				continue
+			}
+			t.logger.Info("config updated from watcher", clog.String("key", t.key))
+		case EventTypeDelete:
+			t.storeDefault()
+			t.logger.Info("config deleted, reverted to default", clog.String("key", t.key))
+		}
+	}
+}
+
+// decodeValue 将监听事件中的值转换为目标类型
+func decodeValue[T any](value any) (*T, error) {
+	switch v := value.(type) {
+	case *T:
+		return v, nil
+	case T:
+		return &v, nil
+	}
+
+	// 尝试通过 JSON 序列化/反序列化转换
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal config value: %w", err)
+	}
+
+	var config T
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+	}
+	return &config, nil
+}
@@ -12,8 +12,10 @@ import (
 	"github.com/ceyewan/gochat/im-infra/coord/internal/client"
 	"github.com/ceyewan/gochat/im-infra/coord/internal/configimpl"
 	"github.com/ceyewan/gochat/im-infra/coord/internal/lockimpl"
+	"github.com/ceyewan/gochat/im-infra/coord/internal/queueimpl"
 	"github.com/ceyewan/gochat/im-infra/coord/internal/registryimpl"
 	"github.com/ceyewan/gochat/im-infra/coord/lock"
+	"github.com/ceyewan/gochat/im-infra/coord/queue"
 	"github.com/ceyewan/gochat/im-infra/coord/registry"
 )
 
@@ -23,11 +25,19 @@ type Provider interface {
 	Lock() lock.DistributedLock
 	// Registry 获取服务注册发现服务
 	Registry() registry.ServiceRegistry
-	// Config 获取配置中心服务
+	// Config 获取配置中心服务，配置了 ConfigAccess 时只能访问令牌授权的键前缀
 	Config() config.ConfigCenter
+	// ConfigAccess 获取配置访问令牌管理和审计流，需要 etcd 账号对 /acl/ 和 /audit/ 有相应权限
+	ConfigAccess() config.AccessAdmin
+	// ConfigSchemas 获取配置 Schema 注册表，Config().Set 等写入操作会按匹配键前缀的 Schema 校验值，
+	// 注册 JSON Schema 需要 etcd 账号对 /schema/ 有写权限
+	ConfigSchemas() config.SchemaRegistry
 	// InstanceIDAllocator 获取一个服务实例ID分配器
 	// 此方法是可重入的：为同一个 serviceName 多次调用，将返回同一个共享的分配器实例
 	InstanceIDAllocator(serviceName string, maxID int) (allocator.InstanceIDAllocator, error)
+	// TaskQueue 获取一个基于 etcd 的轻量任务队列，用于低频的控制类任务
+	// 为同一个 name 多次调用返回同一个队列实例，cfg 以第一次调用为准
+	TaskQueue(name string, cfg queue.Config) (queue.TaskQueue, error)
 	// Close 关闭协调器并释放资源
 	Close() error
 }
@@ -35,14 +45,22 @@ type Provider interface {
 // coordinator 主协调器实现
 type coordinator struct {
 	client          *client.EtcdClient
+	mirrorClient    *client.EtcdClient // 灾备集群客户端，未配置 Mirror 时为 nil
+	registryCache   *registryimpl.CachedRegistry // 本地注册表缓存，未配置 RegistryCache 时为 nil
 	lock            lock.DistributedLock
 	registry        registry.ServiceRegistry
 	config          config.ConfigCenter
+	etcdConfig      *configimpl.EtcdConfigCenter
+	scopedConfig    *configimpl.ScopedConfigCenter // 配置访问控制，未配置 ConfigAccess 时为 nil
+	configAccess    config.AccessAdmin
+	configSchemas   config.SchemaRegistry
 	logger          clog.Logger
 	closed          bool
 	mu              sync.RWMutex
 	allocators      map[string]allocator.InstanceIDAllocator // 缓存分配器实例
 	allocatorsMu    sync.RWMutex
+	queues          map[string]queue.TaskQueue // 缓存任务队列实例
+	queuesMu        sync.Mutex
 }
 
 // New 创建一个新的 coord Provider 实例
@@ -79,18 +97,97 @@ func New(ctx context.Context, config *Config, opts ...Option) (Provider, error)
 
 	// 3. 创建内部服务
 	lockService := lockimpl.NewEtcdLockFactory(etcdClient, "/locks", logger.With(clog.String("component", "lock")))
-	registryService := registryimpl.NewEtcdServiceRegistry(etcdClient, "/services", logger.With(clog.String("component", "registry")))
-	configService := configimpl.NewEtcdConfigCenter(etcdClient, "/config", logger.With(clog.String("component", "config")))
+	registryLogger := logger.With(clog.String("component", "registry"))
+	etcdRegistry := registryimpl.NewEtcdServiceRegistry(etcdClient, "/services", registryLogger,
+		registryimpl.WithLocalDC(config.DC), registryimpl.WithRequireEndpoint(config.RequireEndpoint))
+	var registryService registry.ServiceRegistry = etcdRegistry
+
+	// 配置了灾备集群时，服务注册同时镜像到灾备集群
+	var mirrorClient *client.EtcdClient
+	if config.Mirror != nil {
+		dialTimeout := config.Mirror.DialTimeout
+		if dialTimeout == 0 {
+			dialTimeout = config.DialTimeout
+		}
+		mirrorClient, err = client.New(client.Config{
+			Endpoints: config.Mirror.Endpoints,
+			Username:  config.Mirror.Username,
+			Password:  config.Mirror.Password,
+			Timeout:   dialTimeout,
+			Logger:    logger.With(clog.String("component", "etcd-mirror-client")),
+		})
+		if err != nil {
+			logger.Error("failed to create mirror etcd client", clog.Err(err))
+			_ = etcdClient.Close()
+			return nil, err
+		}
+		registryService = registryimpl.NewFederatedRegistry(etcdRegistry, mirrorClient, registryLogger)
+		logger.Info("registry mirroring enabled",
+			clog.String("dc", config.DC),
+			clog.Strings("mirror_endpoints", config.Mirror.Endpoints))
+	}
+
+	// 配置了本地注册表缓存时，Discover 优先从缓存返回，etcd 不可达时使用旧数据
+	var registryCache *registryimpl.CachedRegistry
+	if config.RegistryCache != nil {
+		registryCache, err = registryimpl.NewCachedRegistry(registryService, etcdRegistry, registryimpl.CacheConfig{
+			SnapshotPath:     config.RegistryCache.SnapshotPath,
+			SnapshotInterval: config.RegistryCache.SnapshotInterval,
+			ProbeInterval:    config.RegistryCache.ProbeInterval,
+			QueryTimeout:     config.RegistryCache.QueryTimeout,
+			MaxStaleness:     config.RegistryCache.MaxStaleness,
+		}, registryLogger.With(clog.String("component", "registry-cache")))
+		if err != nil {
+			logger.Error("failed to create registry cache", clog.Err(err))
+			if mirrorClient != nil {
+				_ = mirrorClient.Close()
+			}
+			_ = etcdClient.Close()
+			return nil, err
+		}
+		registryService = registryCache
+		logger.Info("registry cache enabled", clog.String("snapshot_path", config.RegistryCache.SnapshotPath))
+	}
+	configLogger := logger.With(clog.String("component", "config"))
+	etcdConfig := configimpl.NewEtcdConfigCenter(etcdClient, "/config", configLogger)
+
+	// 配置了访问控制时，配置读写限定在令牌授权的前缀内，变更写入审计流
+	var scopedConfig *configimpl.ScopedConfigCenter
+	if config.ConfigAccess != nil {
+		scopedConfig, err = configimpl.NewScopedConfigCenter(ctx, etcdConfig,
+			config.ConfigAccess.Token, config.ConfigAccess.Principal, configLogger)
+		if err != nil {
+			logger.Error("failed to enable config access control", clog.Err(err))
+			if registryCache != nil {
+				_ = registryCache.Close()
+			}
+			if mirrorClient != nil {
+				_ = mirrorClient.Close()
+			}
+			_ = etcdClient.Close()
+			return nil, err
+		}
+	}
 
 	// 4. 组装 coordinator
 	coord := &coordinator{
-		client:       etcdClient,
-		lock:         lockService,
-		registry:     registryService,
-		config:       configService,
-		logger:       logger,
-		closed:       false,
-		allocators:   make(map[string]allocator.InstanceIDAllocator),
+		client:        etcdClient,
+		mirrorClient:  mirrorClient,
+		registryCache: registryCache,
+		lock:          lockService,
+		registry:      registryService,
+		config:        etcdConfig,
+		etcdConfig:    etcdConfig,
+		scopedConfig:  scopedConfig,
+		configAccess:  configimpl.NewAccessAdmin(etcdClient, configLogger),
+		configSchemas: etcdConfig.Schemas(),
+		logger:        logger,
+		closed:        false,
+		allocators:    make(map[string]allocator.InstanceIDAllocator),
+		queues:        make(map[string]queue.TaskQueue),
+	}
+	if scopedConfig != nil {
+		coord.config = scopedConfig
 	}
 
 	logger.Info("coordinator created successfully")
@@ -118,6 +215,20 @@ func (c *coordinator) Config() config.ConfigCenter {
 	return c.config
 }
 
+// ConfigAccess 实现 Provider 接口 - 获取配置访问令牌管理和审计流
+func (c *coordinator) ConfigAccess() config.AccessAdmin {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.configAccess
+}
+
+// ConfigSchemas 实现 Provider 接口 - 获取配置 Schema 注册表
+func (c *coordinator) ConfigSchemas() config.SchemaRegistry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.configSchemas
+}
+
 // InstanceIDAllocator 实现 Provider 接口 - 获取服务实例ID分配器
 // 此方法是可重入的：为同一个 serviceName 多次调用，将返回同一个共享的分配器实例
 func (c *coordinator) InstanceIDAllocator(serviceName string, maxID int) (allocator.InstanceIDAllocator, error) {
@@ -166,6 +277,23 @@ func (c *coordinator) InstanceIDAllocator(serviceName string, maxID int) (alloca
 	return allocator, nil
 }
 
+// TaskQueue 实现 Provider 接口 - 获取任务队列
+// 为同一个 name 多次调用返回同一个队列实例
+func (c *coordinator) TaskQueue(name string, cfg queue.Config) (queue.TaskQueue, error) {
+	c.queuesMu.Lock()
+	defer c.queuesMu.Unlock()
+
+	if q, exists := c.queues[name]; exists {
+		return q, nil
+	}
+	q, err := queueimpl.NewEtcdTaskQueue(c.client.Client(), name, cfg, c.logger.With(clog.String("component", "queue")))
+	if err != nil {
+		return nil, err
+	}
+	c.queues[name] = q
+	return q, nil
+}
+
 // Close 实现 Provider 接口 - 关闭协调器并释放资源
 func (c *coordinator) Close() error {
 	c.mu.Lock()
@@ -189,6 +317,28 @@ func (c *coordinator) Close() error {
 	}
 	c.allocatorsMu.Unlock()
 
+	// 停止注册表缓存的 watch 并写入最后一次快照
+	if c.registryCache != nil {
+		if err := c.registryCache.Close(); err != nil {
+			c.logger.Error("failed to save registry snapshot", clog.Err(err))
+		}
+	}
+
+	// 停止监听配置访问令牌
+	if c.scopedConfig != nil {
+		c.scopedConfig.Close()
+	}
+
+	// 吊销配置监听器登记的租约
+	c.etcdConfig.Close()
+
+	// 关闭灾备集群客户端
+	if c.mirrorClient != nil {
+		if err := c.mirrorClient.Close(); err != nil {
+			c.logger.Error("failed to close mirror etcd client", clog.Err(err))
+		}
+	}
+
 	// 关闭 etcd 客户端
 	if c.client != nil {
 		if err := c.client.Close(); err != nil {
@@ -2,12 +2,22 @@ package coord_test
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/ceyewan/gochat/im-infra/clog"
 	"github.com/ceyewan/gochat/im-infra/coord"
+	"github.com/ceyewan/gochat/im-infra/coord/config"
+	"github.com/ceyewan/gochat/im-infra/coord/flags"
+	"github.com/ceyewan/gochat/im-infra/coord/lock"
+	"github.com/ceyewan/gochat/im-infra/coord/queue"
+	"github.com/ceyewan/gochat/im-infra/coord/registry"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -207,6 +217,154 @@ func TestConfigCenterWatchOperations(t *testing.T) {
 	})
 }
 
+// TestTypedConfig 测试类型化配置的读穿、热更新、校验与删除回退
+func TestTypedConfig(t *testing.T) {
+	clogConfig := clog.GetDefaultConfig("development")
+	require.NoError(t, clog.Init(context.Background(), clogConfig))
+
+	cfg := coord.GetDefaultConfig("development")
+	cfg.Endpoints = []string{"localhost:2379"}
+	provider, err := coord.New(context.Background(), cfg, coord.WithLogger(clog.Namespace("test")))
+	require.NoError(t, err)
+	defer provider.Close()
+
+	configCenter := provider.Config()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	type limits struct {
+		MaxConn int `json:"maxConn"`
+	}
+	testKey := "test/config/typed"
+	_ = configCenter.Delete(ctx, testKey)
+	defer func() { _ = configCenter.Delete(ctx, testKey) }()
+
+	validator := config.ValidatorFunc[limits](func(l *limits) error {
+		if l.MaxConn <= 0 {
+			return fmt.Errorf("maxConn must be positive")
+		}
+		return nil
+	})
+
+	typed, err := config.Typed(configCenter, testKey, limits{MaxConn: 10}, validator)
+	require.NoError(t, err)
+	defer typed.Close()
+
+	// 配置不存在时使用默认值
+	assert.Equal(t, 10, typed.Load().MaxConn)
+
+	// 等待 watcher 准备就绪
+	time.Sleep(100 * time.Millisecond)
+
+	require.NoError(t, configCenter.Set(ctx, testKey, limits{MaxConn: 20}))
+	assert.Eventually(t, func() bool { return typed.Load().MaxConn == 20 }, 5*time.Second, 50*time.Millisecond)
+
+	// 校验失败的值被拒绝
+	require.NoError(t, configCenter.Set(ctx, testKey, limits{MaxConn: -1}))
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, 20, typed.Load().MaxConn)
+
+	// 删除后回退到默认值
+	require.NoError(t, configCenter.Delete(ctx, testKey))
+	assert.Eventually(t, func() bool { return typed.Load().MaxConn == 10 }, 5*time.Second, 50*time.Millisecond)
+}
+
+// TestFeatureFlags 测试功能开关的定向求值、热更新和审计日志
+func TestFeatureFlags(t *testing.T) {
+	clogConfig := clog.GetDefaultConfig("development")
+	require.NoError(t, clog.Init(context.Background(), clogConfig))
+
+	cfg := coord.GetDefaultConfig("development")
+	cfg.Endpoints = []string{"localhost:2379"}
+	provider, err := coord.New(context.Background(), cfg, coord.WithLogger(clog.Namespace("test")))
+	require.NoError(t, err)
+	defer provider.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	prefix := fmt.Sprintf("test/flags/%d", time.Now().UnixNano())
+	ff, err := flags.New(ctx, provider.Config(), flags.WithPrefix(prefix), flags.WithEnvironment("prod"))
+	require.NoError(t, err)
+	defer ff.Close()
+
+	// 不存在的开关使用 fallback
+	assert.True(t, ff.Bool("maintenance", flags.Target{}, true))
+
+	// 非法定义被拒绝
+	assert.Error(t, ff.Set(ctx, flags.Flag{Name: "bad", Type: flags.TypePercent, Percentage: 150}, "alice"))
+	assert.Error(t, ff.Set(ctx, flags.Flag{Name: "bad", Type: flags.TypeString, Variants: []string{"a"}, Default: "b"}, "alice"))
+
+	require.NoError(t, ff.Set(ctx, flags.Flag{
+		Name:    "maintenance",
+		Type:    flags.TypeBool,
+		Enabled: true,
+		Default: "false",
+		Rules:   []flags.Rule{{Environments: []string{"prod"}, Tenants: []string{"acme"}, Value: "true"}},
+	}, "alice"))
+	assert.True(t, ff.Bool("maintenance", flags.Target{Tenant: "acme"}, false))
+	assert.False(t, ff.Bool("maintenance", flags.Target{Tenant: "other"}, true))
+	assert.False(t, ff.Bool("maintenance", flags.Target{Environment: "staging", Tenant: "acme"}, true))
+
+	// 按比例放量：同一个 key 结果稳定，整体比例接近设定值
+	require.NoError(t, ff.Set(ctx, flags.Flag{Name: "new-sync", Type: flags.TypePercent, Enabled: true, Percentage: 30}, "bob"))
+	hits := 0
+	for i := 0; i < 1000; i++ {
+		target := flags.Target{Key: fmt.Sprintf("user-%d", i)}
+		hit := ff.Bool("new-sync", target, false)
+		assert.Equal(t, hit, ff.Bool("new-sync", target, false))
+		if hit {
+			hits++
+		}
+	}
+	assert.InDelta(t, 300, hits, 60)
+
+	require.NoError(t, ff.Set(ctx, flags.Flag{
+		Name:     "push-strategy",
+		Type:     flags.TypeString,
+		Enabled:  true,
+		Default:  "batch",
+		Variants: []string{"batch", "realtime"},
+		Rules:    []flags.Rule{{Tenants: []string{"vip"}, Value: "realtime"}},
+	}, "bob"))
+	assert.Equal(t, "realtime", ff.String("push-strategy", flags.Target{Tenant: "vip"}, "none"))
+	assert.Equal(t, "batch", ff.String("push-strategy", flags.Target{Tenant: "free"}, "none"))
+	assert.Equal(t, "none", ff.String("maintenance", flags.Target{}, "none"))
+
+	// 其他实例通过监听看到变更
+	other, err := flags.New(ctx, provider.Config(), flags.WithPrefix(prefix), flags.WithEnvironment("prod"))
+	require.NoError(t, err)
+	defer other.Close()
+	assert.Len(t, other.List(), 3)
+
+	time.Sleep(100 * time.Millisecond)
+	require.NoError(t, ff.Set(ctx, flags.Flag{Name: "maintenance", Type: flags.TypeBool, Enabled: false}, "carol"))
+	assert.Eventually(t, func() bool {
+		return !other.Bool("maintenance", flags.Target{Tenant: "acme"}, true)
+	}, 5*time.Second, 50*time.Millisecond)
+
+	require.NoError(t, ff.Delete(ctx, "push-strategy", "carol"))
+	assert.Eventually(t, func() bool {
+		_, ok := other.Get("push-strategy")
+		return !ok
+	}, 5*time.Second, 50*time.Millisecond)
+
+	// 审计日志按时间倒序
+	history, err := ff.History(ctx, "maintenance", 0)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, "carol", history[0].Actor)
+	assert.True(t, history[0].Old.Enabled)
+	assert.False(t, history[0].New.Enabled)
+	assert.Nil(t, history[1].Old)
+
+	history, err = ff.History(ctx, "push-strategy", 1)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, flags.ActionDelete, history[0].Action)
+	assert.Nil(t, history[0].New)
+}
+
 // TestConfigCenterCASOperations 测试 Compare-And-Swap 操作
 func TestConfigCenterCASOperations(t *testing.T) {
 	clogConfig := clog.GetDefaultConfig("development")
@@ -256,6 +414,190 @@ func TestConfigCenterCASOperations(t *testing.T) {
 	})
 }
 
+// TestConfigCenterTreeOperations 测试整树导入导出
+func TestConfigCenterTreeOperations(t *testing.T) {
+	clogConfig := clog.GetDefaultConfig("development")
+	require.NoError(t, clog.Init(context.Background(), clogConfig))
+
+	cfg := coord.GetDefaultConfig("development")
+	cfg.Endpoints = []string{"localhost:2379"}
+	provider, err := coord.New(context.Background(), cfg, coord.WithLogger(clog.Namespace("test")))
+	require.NoError(t, err)
+	defer provider.Close()
+
+	configCenter := provider.Config()
+	ctx := context.Background()
+	testPrefix := "test/config/tree"
+
+	// 清理测试数据
+	defer func() {
+		keys, _ := configCenter.List(ctx, testPrefix)
+		for _, key := range keys {
+			_ = configCenter.Delete(ctx, key)
+		}
+	}()
+
+	t.Run("Import and Export", func(t *testing.T) {
+		v1 := map[string][]byte{
+			"db/dsn":     []byte(`"root@tcp(localhost:3306)/gochat"`),
+			"cache/addr": []byte(`"localhost:6379"`),
+		}
+		rev1, err := configCenter.ImportTree(ctx, testPrefix, v1, config.AtomicSwap{Revision: "v1", ExpectedRevision: "-"})
+		require.NoError(t, err)
+		assert.Equal(t, "v1", rev1)
+
+		tree, revision, err := configCenter.ExportTree(ctx, testPrefix)
+		require.NoError(t, err)
+		assert.Equal(t, "v1", revision)
+		assert.Equal(t, v1, tree)
+
+		// 新版本中删除的键不应出现在导出结果中
+		v2 := map[string][]byte{
+			"db/dsn": []byte(`"root@tcp(mysql:3306)/gochat"`),
+		}
+		_, err = configCenter.ImportTree(ctx, testPrefix, v2, config.AtomicSwap{Revision: "v2", ExpectedRevision: "v1"})
+		require.NoError(t, err)
+
+		tree, revision, err = configCenter.ExportTree(ctx, testPrefix)
+		require.NoError(t, err)
+		assert.Equal(t, "v2", revision)
+		assert.Equal(t, v2, tree)
+	})
+
+	t.Run("Expected Revision Mismatch", func(t *testing.T) {
+		_, err := configCenter.ImportTree(ctx, testPrefix, map[string][]byte{"a": []byte("1")},
+			config.AtomicSwap{Revision: "v3", ExpectedRevision: "v1"})
+		assert.Error(t, err, "import should fail when pointer has moved")
+
+		_, revision, err := configCenter.ExportTree(ctx, testPrefix)
+		require.NoError(t, err)
+		assert.Equal(t, "v2", revision, "pointer should be unchanged")
+	})
+
+	t.Run("Invalid Keys", func(t *testing.T) {
+		_, err := configCenter.ImportTree(ctx, testPrefix, map[string][]byte{"../escape": []byte("1")}, config.AtomicSwap{})
+		assert.Error(t, err)
+	})
+}
+
+// TestConfigAccessControl 测试配置中心的令牌授权和审计流
+func TestConfigAccessControl(t *testing.T) {
+	clogConfig := clog.GetDefaultConfig("development")
+	require.NoError(t, clog.Init(context.Background(), clogConfig))
+
+	cfg := coord.GetDefaultConfig("development")
+	cfg.Endpoints = []string{"localhost:2379"}
+	admin, err := coord.New(context.Background(), cfg, coord.WithLogger(clog.Namespace("test")))
+	require.NoError(t, err)
+	defer admin.Close()
+
+	ctx := context.Background()
+	token, err := admin.ConfigAccess().IssueToken(ctx, config.AccessGrant{
+		Principal: "team-a",
+		Read:      []string{"test/acl/shared"}, // 没有结尾 "/" 的授权不应覆盖 "test/acl/shared-b"
+		Write:     []string{"test/acl/team-a/"},
+	})
+	require.NoError(t, err)
+	require.NoError(t, admin.Config().Set(ctx, "test/acl/team-b/key", "b"))
+	require.NoError(t, admin.Config().Set(ctx, "test/acl/shared/key", "shared"))
+	require.NoError(t, admin.Config().Set(ctx, "test/acl/shared-b/key", "b"))
+	require.NoError(t, admin.Config().Set(ctx, "test/acl/team-ab/key", "b"))
+	defer func() {
+		keys, _ := admin.Config().List(ctx, "test/acl")
+		for _, key := range keys {
+			_ = admin.Config().Delete(ctx, key)
+		}
+	}()
+
+	scopedCfg := coord.GetDefaultConfig("development")
+	scopedCfg.Endpoints = []string{"localhost:2379"}
+	scopedCfg.ConfigAccess = &coord.ConfigAccessConfig{Token: token}
+	scoped, err := coord.New(ctx, scopedCfg, coord.WithLogger(clog.Namespace("test")))
+	require.NoError(t, err)
+	defer scoped.Close()
+
+	t.Run("Scoped Read and Write", func(t *testing.T) {
+		require.NoError(t, scoped.Config().Set(ctx, "test/acl/team-a/key", "a1"))
+		require.NoError(t, scoped.Config().Set(ctx, "test/acl/team-a/key", "a2"))
+
+		var value string
+		require.NoError(t, scoped.Config().Get(ctx, "test/acl/shared/key", &value))
+		assert.Equal(t, "shared", value)
+
+		assert.Error(t, scoped.Config().Set(ctx, "test/acl/shared/key", "x"), "read-only prefix")
+		assert.Error(t, scoped.Config().Set(ctx, "test/acl/team-b/key", "x"), "other team's prefix")
+		assert.Error(t, scoped.Config().Get(ctx, "test/acl/team-b/key", &value))
+		assert.Error(t, scoped.Config().Set(ctx, "test/acl/team-a/../team-b/key", "x"), "path traversal")
+		assert.Error(t, scoped.Config().Get(ctx, "test/acl/shared-b/key", &value), "sibling of a grant without trailing slash")
+		assert.Error(t, scoped.Config().Set(ctx, "test/acl/team-ab/key", "x"), "sibling of a grant with trailing slash")
+
+		keys, err := scoped.Config().List(ctx, "test/acl")
+		require.NoError(t, err)
+		assert.NotContains(t, keys, "test/acl/team-b/key")
+		assert.NotContains(t, keys, "test/acl/shared-b/key")
+		assert.NotContains(t, keys, "test/acl/team-ab/key")
+	})
+
+	t.Run("Prefix Operations", func(t *testing.T) {
+		// 前缀写不写结尾的 "/" 都应被授权覆盖
+		for _, prefix := range []string{"test/acl/team-a", "test/acl/team-a/"} {
+			var value string
+			watcher, err := scoped.Config().WatchPrefix(ctx, prefix, &value)
+			require.NoError(t, err, prefix)
+			watcher.Close()
+
+			_, _, err = scoped.Config().ExportTree(ctx, prefix)
+			require.NoError(t, err, prefix)
+		}
+		_, err := scoped.Config().ImportTree(ctx, "test/acl/team-a/tree", map[string][]byte{"k": []byte(`"v"`)}, config.AtomicSwap{})
+		require.NoError(t, err)
+
+		var value string
+		_, err = scoped.Config().WatchPrefix(ctx, "test/acl/shared", &value)
+		assert.NoError(t, err, "read grant covers watching its prefix")
+		_, err = scoped.Config().WatchPrefix(ctx, "test/acl/team", &value)
+		assert.Error(t, err, "prefix wider than the grant")
+		_, err = scoped.Config().ImportTree(ctx, "test/acl/shared", map[string][]byte{"k": []byte(`"v"`)}, config.AtomicSwap{})
+		assert.Error(t, err, "read-only prefix")
+		_, _, err = scoped.Config().ExportTree(ctx, "test/acl/team-b")
+		assert.Error(t, err)
+
+		// etcd 按字符串匹配前缀，"team-ab" 的事件不应转发给监听 "team-a" 的令牌
+		watcher, err := scoped.Config().WatchPrefix(ctx, "test/acl/team-a", &value)
+		require.NoError(t, err)
+		defer watcher.Close()
+		require.NoError(t, admin.Config().Set(ctx, "test/acl/team-ab/key", "leak"))
+		require.NoError(t, admin.Config().Set(ctx, "test/acl/team-a/key", "a3"))
+		select {
+		case event := <-watcher.Chan():
+			assert.Equal(t, "test/acl/team-a/key", event.Key)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for watch event")
+		}
+	})
+
+	t.Run("Audit Stream", func(t *testing.T) {
+		records, err := admin.ConfigAccess().Audit(ctx, "test/acl/team-a/", 2)
+		require.NoError(t, err)
+		require.Len(t, records, 2)
+		assert.Equal(t, "team-a", records[1].Principal)
+		assert.Equal(t, config.AuditOpSet, records[1].Op)
+		assert.Equal(t, records[0].NewHash, records[1].OldHash)
+		assert.Empty(t, records[0].OldHash)
+	})
+
+	t.Run("Revoke", func(t *testing.T) {
+		require.NoError(t, admin.ConfigAccess().RevokeToken(ctx, token))
+		assert.Eventually(t, func() bool {
+			var value string
+			return scoped.Config().Get(ctx, "test/acl/shared/key", &value) != nil
+		}, 2*time.Second, 50*time.Millisecond)
+
+		_, err := coord.New(ctx, scopedCfg, coord.WithLogger(clog.Namespace("test")))
+		assert.Error(t, err, "revoked token should be rejected at startup")
+	})
+}
+
 // TestDistributedLock 测试分布式锁功能
 func TestDistributedLock(t *testing.T) {
 	clogConfig := clog.GetDefaultConfig("development")
@@ -301,6 +643,43 @@ func TestDistributedLock(t *testing.T) {
 		assert.Error(t, err, "TryAcquire should fail when lock is held")
 		assert.Nil(t, lock2, "Second lock should be nil")
 	})
+
+	t.Run("AcquireFair Queue", func(t *testing.T) {
+		fairKey := testLockKey + "_fair"
+		holder, err := lockService.Acquire(ctx, fairKey, 10*time.Second)
+		require.NoError(t, err)
+
+		// 第一个等待者排在持有者之后
+		updates := make(chan lock.QueueStatus, 8)
+		acquired := make(chan error, 1)
+		go func() {
+			waiter, err := lockService.AcquireFair(ctx, fairKey, 10*time.Second,
+				lock.WithQueueUpdates(updates), lock.WithWaitTimeout(5*time.Second))
+			if err == nil {
+				err = waiter.Unlock(ctx)
+			}
+			acquired <- err
+		}()
+
+		status := <-updates
+		assert.Equal(t, 1, status.Position)
+		assert.Equal(t, 2, status.QueueLength)
+
+		// 队列已满时立即失败
+		_, err = lockService.AcquireFair(ctx, fairKey, 10*time.Second, lock.WithMaxQueueDepth(1))
+		assert.Error(t, err, "AcquireFair should fail when queue is full")
+
+		// 排队超时后退出队列
+		_, err = lockService.AcquireFair(ctx, fairKey, 10*time.Second, lock.WithWaitTimeout(200*time.Millisecond))
+		assert.Error(t, err, "AcquireFair should time out while lock is held")
+
+		// 持有者释放后，等待者轮到队首并获得锁，updates 随之关闭
+		require.NoError(t, holder.Unlock(ctx))
+		require.NoError(t, <-acquired)
+		for status = range updates {
+		}
+		assert.Equal(t, 0, status.Position)
+	})
 }
 
 // TestServiceRegistry 测试服务注册发现功能
@@ -313,6 +692,158 @@ func TestServiceRegistry(t *testing.T) {
 	t.Skip("ServiceInfo type not accessible from external test package")
 }
 
+// TestServiceRegistryHealthCheck 测试健康检查器摘除和恢复实例
+func TestServiceRegistryHealthCheck(t *testing.T) {
+	clogConfig := clog.GetDefaultConfig("development")
+	require.NoError(t, clog.Init(context.Background(), clogConfig))
+
+	cfg := coord.GetDefaultConfig("development")
+	cfg.Endpoints = []string{"localhost:2379"}
+	provider, err := coord.New(context.Background(), cfg, coord.WithLogger(clog.Namespace("test")))
+	require.NoError(t, err)
+	defer provider.Close()
+
+	reg := provider.Registry()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// 实例监听一个真实端口，TCP 探测可以成功
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	service := registry.ServiceInfo{
+		ID:          "health-test-1",
+		Name:        "health-test-service",
+		Address:     "127.0.0.1",
+		Port:        port,
+		HealthCheck: &registry.HealthCheck{Type: registry.HealthCheckTCP, FailureThreshold: 2, SuccessThreshold: 1},
+	}
+	require.NoError(t, reg.Register(ctx, service, 10*time.Second))
+	defer reg.Unregister(context.Background(), service.ID)
+
+	events, err := reg.Watch(ctx, service.Name)
+	require.NoError(t, err)
+
+	go reg.RunHealthChecker(ctx, registry.HealthCheckerOptions{Interval: 200 * time.Millisecond, Timeout: 100 * time.Millisecond})
+
+	waitHealth := func(status registry.HealthStatus) {
+		deadline := time.After(10 * time.Second)
+		for {
+			select {
+			case event := <-events:
+				if event.Type == registry.EventTypePut && event.Service.ID == service.ID && event.Service.Health == status {
+					return
+				}
+			case <-deadline:
+				t.Fatalf("timed out waiting for health %s", status)
+			}
+		}
+	}
+
+	waitHealth(registry.HealthPassing)
+	instances, err := reg.Discover(ctx, service.Name)
+	require.NoError(t, err)
+	assert.Len(t, instances, 1)
+
+	// 关闭端口后实例被摘除，但租约仍然存活
+	require.NoError(t, ln.Close())
+	waitHealth(registry.HealthCritical)
+	instances, err = reg.Discover(ctx, service.Name)
+	require.NoError(t, err)
+	assert.Empty(t, instances)
+
+	// 元数据更新不应使已摘除的实例恢复
+	weight := 50
+	require.NoError(t, reg.UpdateMetadata(ctx, service.ID, registry.InstanceUpdate{Weight: &weight}))
+	instances, err = reg.Discover(ctx, service.Name)
+	require.NoError(t, err)
+	assert.Empty(t, instances)
+
+	// 端口恢复后实例重新加入
+	ln, err = net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	require.NoError(t, err)
+	defer ln.Close()
+	waitHealth(registry.HealthPassing)
+	instances, err = reg.Discover(ctx, service.Name)
+	require.NoError(t, err)
+	assert.Len(t, instances, 1)
+}
+
+// TestServiceRegistryPreferLocalDC 测试优先发现本地数据中心实例，本地无健康实例时回退到远程
+func TestServiceRegistryPreferLocalDC(t *testing.T) {
+	clogConfig := clog.GetDefaultConfig("development")
+	require.NoError(t, clog.Init(context.Background(), clogConfig))
+
+	cfg := coord.GetDefaultConfig("development")
+	cfg.Endpoints = []string{"localhost:2379"}
+	cfg.DC = "dc-a"
+	provider, err := coord.New(context.Background(), cfg, coord.WithLogger(clog.Namespace("test")))
+	require.NoError(t, err)
+	defer provider.Close()
+
+	reg := provider.Registry()
+	ctx := context.Background()
+
+	// 未指定 DC 的实例使用本地数据中心
+	local := registry.ServiceInfo{ID: "dc-test-local", Name: "dc-test-service", Address: "127.0.0.1", Port: 9001}
+	remote := registry.ServiceInfo{ID: "dc-test-remote", Name: "dc-test-service", Address: "127.0.0.2", Port: 9001, DC: "dc-b"}
+	require.NoError(t, reg.Register(ctx, local, 10*time.Second))
+	require.NoError(t, reg.Register(ctx, remote, 10*time.Second))
+	defer reg.Unregister(ctx, remote.ID)
+
+	instances, err := reg.Discover(ctx, local.Name)
+	require.NoError(t, err)
+	assert.Len(t, instances, 2)
+
+	instances, err = reg.Discover(ctx, local.Name, registry.PreferLocalDC())
+	require.NoError(t, err)
+	require.Len(t, instances, 1)
+	assert.Equal(t, local.ID, instances[0].ID)
+	assert.Equal(t, "dc-a", instances[0].DC)
+
+	// 本地实例下线后回退到远程数据中心
+	require.NoError(t, reg.Unregister(ctx, local.ID))
+	instances, err = reg.Discover(ctx, local.Name, registry.PreferLocalDC())
+	require.NoError(t, err)
+	require.Len(t, instances, 1)
+	assert.Equal(t, remote.ID, instances[0].ID)
+}
+
+// TestServiceRegistryCache 测试本地注册表缓存和快照持久化
+func TestServiceRegistryCache(t *testing.T) {
+	clogConfig := clog.GetDefaultConfig("development")
+	require.NoError(t, clog.Init(context.Background(), clogConfig))
+
+	snapshotPath := filepath.Join(t.TempDir(), "registry.json")
+	cfg := coord.GetDefaultConfig("development")
+	cfg.Endpoints = []string{"localhost:2379"}
+	cfg.RegistryCache = &coord.RegistryCacheConfig{SnapshotPath: snapshotPath, ProbeInterval: time.Second}
+	provider, err := coord.New(context.Background(), cfg, coord.WithLogger(clog.Namespace("test")))
+	require.NoError(t, err)
+
+	reg := provider.Registry()
+	ctx := context.Background()
+	service := registry.ServiceInfo{ID: "cache-test-1", Name: "cache-test-service", Address: "127.0.0.1", Port: 9002}
+	require.NoError(t, reg.Register(ctx, service, 10*time.Second))
+	defer reg.Unregister(ctx, service.ID)
+
+	// watch 将注册同步到缓存后，Discover 直接从缓存返回
+	var status registry.CacheStatus
+	require.Eventually(t, func() bool {
+		instances, err := reg.Discover(ctx, service.Name, registry.WithCacheStatus(&status))
+		return err == nil && len(instances) == 1 && status.FromCache
+	}, 5*time.Second, 100*time.Millisecond)
+	assert.False(t, status.Stale)
+	assert.Positive(t, status.Revision)
+
+	// 关闭时写入快照
+	require.NoError(t, provider.Close())
+	data, err := os.ReadFile(snapshotPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), service.ID)
+}
+
 // TestInstanceIDAllocator 测试实例 ID 分配器功能
 func TestInstanceIDAllocator(t *testing.T) {
 	clogConfig := clog.GetDefaultConfig("development")
@@ -434,6 +965,89 @@ func TestInstanceIDAllocator(t *testing.T) {
 	provider.Close()
 }
 
+// TestTaskQueue 测试任务队列的去重、认领上限、重试和死信
+func TestTaskQueue(t *testing.T) {
+	clogConfig := clog.GetDefaultConfig("development")
+	require.NoError(t, clog.Init(context.Background(), clogConfig))
+
+	cfg := coord.GetDefaultConfig("development")
+	cfg.Endpoints = []string{"localhost:2379"}
+	provider, err := coord.New(context.Background(), cfg, coord.WithLogger(clog.Namespace("test")))
+	require.NoError(t, err)
+	defer provider.Close()
+
+	ctx := context.Background()
+	q, err := provider.TaskQueue(fmt.Sprintf("test-queue-%d", time.Now().UnixNano()), queue.Config{
+		MaxInFlight:  1,
+		MaxAttempts:  2,
+		RetryBackoff: 100 * time.Millisecond,
+		ClaimTTL:     5 * time.Second,
+	})
+	require.NoError(t, err)
+
+	t.Run("Dedup", func(t *testing.T) {
+		added, err := q.Enqueue(ctx, "reindex:shard-7", []byte("7"))
+		require.NoError(t, err)
+		assert.True(t, added)
+
+		added, err = q.Enqueue(ctx, "reindex:shard-7", []byte("7"))
+		require.NoError(t, err)
+		assert.False(t, added, "Duplicate key should not be enqueued")
+
+		added, err = q.Enqueue(ctx, "recount:group-1", nil)
+		require.NoError(t, err)
+		assert.True(t, added)
+	})
+
+	t.Run("Claim Order And InFlight Limit", func(t *testing.T) {
+		claimed, err := q.Claim(ctx, "worker-1")
+		require.NoError(t, err)
+		assert.Equal(t, "reindex:shard-7", claimed.Task().Key, "Tasks should be claimed in enqueue order")
+		assert.Equal(t, 1, claimed.Task().Attempts)
+
+		_, err = q.Claim(ctx, "worker-2")
+		assert.ErrorIs(t, err, queue.ErrInFlightLimit)
+
+		stats, err := q.Stats(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, stats.Claimed)
+		assert.Equal(t, 1, stats.Pending)
+
+		require.NoError(t, claimed.Ack(ctx))
+		_, err = q.Get(ctx, "reindex:shard-7")
+		assert.Error(t, err, "Acked task should be removed")
+	})
+
+	t.Run("Nack Until Dead", func(t *testing.T) {
+		claimed, err := q.Claim(ctx, "worker-1")
+		require.NoError(t, err)
+		require.NoError(t, claimed.Nack(ctx, fmt.Errorf("downstream busy"), 0))
+
+		_, err = q.Claim(ctx, "worker-1")
+		assert.ErrorIs(t, err, queue.ErrNoTask, "Task should wait for retry backoff")
+
+		time.Sleep(200 * time.Millisecond)
+		claimed, err = q.Claim(ctx, "worker-1")
+		require.NoError(t, err)
+		assert.Equal(t, 2, claimed.Task().Attempts)
+		require.NoError(t, claimed.Nack(ctx, fmt.Errorf("downstream busy"), 0))
+
+		task, err := q.Get(ctx, "recount:group-1")
+		require.NoError(t, err)
+		assert.Equal(t, queue.StateDead, task.State)
+		assert.Equal(t, "downstream busy", task.LastError)
+
+		dead, err := q.List(ctx, queue.StateDead)
+		require.NoError(t, err)
+		assert.Len(t, dead, 1)
+
+		require.NoError(t, q.Delete(ctx, "recount:group-1"))
+		stats, err := q.Stats(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, queue.Stats{}, stats)
+	})
+}
+
 // TestCoordinatorErrorHandling 测试错误处理
 func TestCoordinatorErrorHandling(t *testing.T) {
 	clogConfig := clog.GetDefaultConfig("development")
@@ -505,4 +1119,188 @@ func BenchmarkConfigCenterOperations(b *testing.B) {
 
 	// 清理
 	_ = configCenter.Delete(ctx, testKey)
-}
\ No newline at end of file
+}
+
+// TestConfigSchema 测试配置 Schema 的解析与写入校验
+func TestConfigSchema(t *testing.T) {
+	t.Run("JSON Schema", func(t *testing.T) {
+		schema, err := config.ParseJSONSchema([]byte(`{
+			"type": "object",
+			"required": ["port"],
+			"additionalProperties": false,
+			"properties": {
+				"port": {"type": "integer", "minimum": 1, "maximum": 65535},
+				"mode": {"enum": ["debug", "release"]},
+				"peers": {"type": "array", "items": {"type": "string", "pattern": "^[a-z]+:[0-9]+$"}}
+			}
+		}`))
+		require.NoError(t, err)
+
+		assert.Empty(t, schema.Validate([]byte(`{"port": 8080, "mode": "release", "peers": ["a:1"]}`)))
+
+		violations := schema.Validate([]byte(`{"port": "8080", "mode": "test", "peers": ["a:1", "B"], "extra": 1}`))
+		paths := make([]string, 0, len(violations))
+		for _, v := range violations {
+			paths = append(paths, v.Path)
+		}
+		assert.ElementsMatch(t, []string{"$.port", "$.mode", "$.peers[1]", "$.extra"}, paths)
+
+		assert.NotEmpty(t, schema.Validate([]byte(`{"mode": "debug"}`)), "缺少必填字段应被拒绝")
+
+		_, err = config.ParseJSONSchema([]byte(`{"type": "object", "$ref": "#/definitions/x"}`))
+		assert.Error(t, err, "不支持的关键字应报错")
+	})
+
+	t.Run("Type Schema", func(t *testing.T) {
+		type limits struct {
+			MaxConn int `json:"maxConn"`
+		}
+		schema := config.TypeSchema[limits](config.ValidatorFunc[limits](func(l *limits) error {
+			if l.MaxConn <= 0 {
+				return fmt.Errorf("maxConn must be positive")
+			}
+			return nil
+		}))
+
+		assert.Empty(t, schema.Validate([]byte(`{"maxConn": 10}`)))
+		assert.Equal(t, []config.Violation{{Path: "$.maxConn", Message: "expected int, got string"}},
+			schema.Validate([]byte(`{"maxConn": "10"}`)))
+		assert.Equal(t, "$.timeout", schema.Validate([]byte(`{"maxConn": 10, "timeout": 1}`))[0].Path)
+		assert.Equal(t, "maxConn must be positive", schema.Validate([]byte(`{"maxConn": 0}`))[0].Message)
+	})
+
+	t.Run("Validate On Write", func(t *testing.T) {
+		clogConfig := clog.GetDefaultConfig("development")
+		require.NoError(t, clog.Init(context.Background(), clogConfig))
+
+		cfg := coord.GetDefaultConfig("development")
+		cfg.Endpoints = []string{"localhost:2379"}
+		provider, err := coord.New(context.Background(), cfg, coord.WithLogger(clog.Namespace("test")))
+		require.NoError(t, err)
+		defer provider.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		schemas := provider.ConfigSchemas()
+		prefix := "test/schema/"
+		require.NoError(t, schemas.RegisterSchema(ctx, prefix, []byte(`{"type": "object", "required": ["port"], "properties": {"port": {"type": "integer"}}}`)))
+		defer func() { _ = schemas.RemoveSchema(ctx, prefix) }()
+		defer func() { _ = provider.Config().Delete(ctx, prefix+"server") }()
+
+		all, err := schemas.Schemas(ctx)
+		require.NoError(t, err)
+		assert.Contains(t, all, prefix)
+
+		require.NoError(t, provider.Config().Set(ctx, prefix+"server", map[string]int{"port": 8080}))
+
+		err = provider.Config().Set(ctx, prefix+"server", map[string]string{"port": "8080"})
+		var verr *config.ValidationError
+		require.ErrorAs(t, err, &verr)
+		assert.Equal(t, prefix, verr.Prefix)
+		assert.Equal(t, "$.port", verr.Violations[0].Path)
+
+		_, err = provider.Config().ImportTree(ctx, "test/schema", map[string][]byte{"server": []byte(`{}`)}, config.AtomicSwap{})
+		assert.ErrorAs(t, err, &verr)
+
+		// 不匹配任何前缀的键不受影响
+		require.NoError(t, schemas.Validate(ctx, "test/other/server", []byte(`"anything"`)))
+	})
+}
+
+// TestConfigPreview 测试配置变更预览
+func TestConfigPreview(t *testing.T) {
+	t.Run("Diff", func(t *testing.T) {
+		changes := config.Diff(
+			[]byte(`{"port": 8080, "mode": "debug", "peers": ["a", "b"], "limits": {"maxConn": 100}}`),
+			[]byte(`{"port": 8080.0, "peers": ["a", "c", "d"], "limits": {"maxConn": 200}, "tls": true}`))
+		summary := make(map[string]string, len(changes))
+		for _, c := range changes {
+			summary[c.Path] = c.Type
+		}
+		assert.Equal(t, map[string]string{
+			"$.mode":           config.ChangeRemoved,
+			"$.peers[1]":       config.ChangeModified,
+			"$.peers[2]":       config.ChangeAdded,
+			"$.limits.maxConn": config.ChangeModified,
+			"$.tls":            config.ChangeAdded,
+		}, summary, "数字按数值比较，8080 与 8080.0 相同")
+
+		assert.Empty(t, config.Diff([]byte(`{"a": 1, "b": 2}`), []byte(`{"b": 2, "a": 1}`)))
+
+		paths := make([]string, 0, 3)
+		for _, c := range config.Diff([]byte(`{"ids": [0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10]}`),
+			[]byte(`{"ids": [0, 1, -2, 3, 4, 5, 6, 7, 8, -9, -10], "id": 1}`)) {
+			paths = append(paths, c.Path)
+		}
+		assert.Equal(t, []string{"$.id", "$.ids[2]", "$.ids[9]", "$.ids[10]"}, paths, "数组下标按数值排序")
+		assert.Equal(t, []config.FieldChange{{Path: "$", Type: config.ChangeModified, Old: "plain", New: "text"}},
+			config.Diff([]byte("plain"), []byte("text")), "非 JSON 值整体比较")
+		assert.Equal(t, config.ChangeAdded, config.Diff(nil, []byte(`1`))[0].Type)
+	})
+
+	t.Run("Preview", func(t *testing.T) {
+		clogConfig := clog.GetDefaultConfig("development")
+		require.NoError(t, clog.Init(context.Background(), clogConfig))
+
+		cfg := coord.GetDefaultConfig("development")
+		cfg.Endpoints = []string{"localhost:2379"}
+		provider, err := coord.New(context.Background(), cfg, coord.WithLogger(clog.Namespace("test")))
+		require.NoError(t, err)
+		defer provider.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		cc := provider.Config()
+		key := "test/preview/limits"
+		defer func() { _ = cc.Delete(ctx, key) }()
+
+		p, err := cc.Preview(ctx, key, map[string]int{"maxConn": 100})
+		require.NoError(t, err)
+		assert.False(t, p.Exists)
+		assert.Len(t, p.Changes, 1)
+
+		require.NoError(t, cc.Set(ctx, key, map[string]int{"maxConn": 100}))
+
+		var v interface{}
+		keyWatcher, err := cc.Watch(ctx, key, &v)
+		require.NoError(t, err)
+		defer keyWatcher.Close()
+		prefixWatcher, err := cc.WatchPrefix(ctx, "test/preview", &v)
+		require.NoError(t, err)
+		defer prefixWatcher.Close()
+		otherWatcher, err := cc.Watch(ctx, "test/preview/other", &v)
+		require.NoError(t, err)
+		defer otherWatcher.Close()
+
+		p, err = cc.Preview(ctx, key, map[string]int{"maxConn": 200})
+		require.NoError(t, err)
+		assert.True(t, p.Exists)
+		assert.Equal(t, []config.FieldChange{{Path: "$.maxConn", Type: config.ChangeModified,
+			Old: json.Number("100"), New: json.Number("200")}}, p.Changes)
+		require.Len(t, p.Watchers, 2, "只列出会收到事件的监听者")
+		assert.Equal(t, "/config/test/preview", p.Watchers[0].Key, "登记的是完整的 etcd 键")
+		assert.True(t, p.Watchers[0].Prefix)
+		assert.Equal(t, "/config/"+key, p.Watchers[1].Key)
+
+		// 预览不写入，版本可用于 CAS
+		var current map[string]int
+		version, err := cc.GetWithVersion(ctx, key, &current)
+		require.NoError(t, err)
+		assert.Equal(t, 100, current["maxConn"])
+		assert.Equal(t, version, p.Version)
+
+		unchanged, err := cc.Preview(ctx, key, map[string]int{"maxConn": 100})
+		require.NoError(t, err)
+		assert.True(t, unchanged.Unchanged())
+
+		// 关闭后登记被删除
+		otherWatcher.Close()
+		keyWatcher.Close()
+		assert.Eventually(t, func() bool {
+			p, err := cc.Preview(ctx, key, map[string]int{"maxConn": 200})
+			return err == nil && len(p.Watchers) == 1
+		}, 5*time.Second, 100*time.Millisecond)
+	})
+}
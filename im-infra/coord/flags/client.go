@@ -0,0 +1,418 @@
+package flags
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/ceyewan/gochat/im-infra/coord/config"
+	"github.com/ceyewan/gochat/im-infra/coord/internal/client"
+)
+
+// 审计日志中的操作类型
+const (
+	ActionSet    = "set"
+	ActionDelete = "delete"
+)
+
+// AuditEntry 是一条功能开关变更记录
+type AuditEntry struct {
+	// Flag 开关名称
+	Flag string `json:"flag"`
+	// Action 操作类型：ActionSet 或 ActionDelete
+	Action string `json:"action"`
+	// Actor 操作人
+	Actor string `json:"actor"`
+	// Time 操作时间
+	Time time.Time `json:"time"`
+	// Old 变更前的定义，新建时为 nil
+	Old *Flag `json:"old,omitempty"`
+	// New 变更后的定义，删除时为 nil
+	New *Flag `json:"new,omitempty"`
+}
+
+// Option 功能开关客户端选项
+type Option func(*Client)
+
+// WithPrefix 设置开关在配置中心的存储前缀，默认为 "flags"。
+// 开关定义存储在 "{prefix}/defs/{name}"，审计日志存储在 "{prefix}/audit/{name}/{时间戳}"。
+func WithPrefix(prefix string) Option {
+	return func(c *Client) {
+		c.prefix = strings.Trim(prefix, "/")
+	}
+}
+
+// WithEnvironment 设置默认环境，Target.Environment 为空时使用
+func WithEnvironment(env string) Option {
+	return func(c *Client) {
+		c.environment = env
+	}
+}
+
+// WithLogger 设置日志器
+func WithLogger(logger clog.Logger) Option {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
+// Client 是基于配置中心的功能开关客户端。
+//   - 本地缓存：创建时加载所有开关，求值只读取内存中的快照，不访问配置中心
+//   - 热更新：通过 WatchPrefix 跟踪变更，整个快照原子替换，单次求值不会看到修改了一半的开关
+//   - 审计：通过 Set/Delete 修改开关时记录操作人和变更前后的定义
+//
+// 配置中心不可用时，求值使用调用方传入的 fallback。
+type Client struct {
+	configCenter config.ConfigCenter
+	prefix       string
+	environment  string
+	logger       clog.Logger
+
+	// flags 当前快照，只整体替换，不原地修改
+	flags atomic.Pointer[map[string]*Flag]
+	// mu 串行化快照的写入
+	mu        sync.Mutex
+	listeners []func(name string, flag *Flag)
+
+	watcher config.Watcher[any]
+	cancel  context.CancelFunc
+	once    sync.Once
+}
+
+// New 创建功能开关客户端，加载所有开关并启动监听。调用方需在不再使用时调用 Close。
+//
+// 示例：
+//
+//	ff, err := flags.New(ctx, coordinator.Config(), flags.WithEnvironment("prod"))
+//	if err != nil {
+//	    return err
+//	}
+//	defer ff.Close()
+//
+//	if ff.Bool("maintenance", flags.Target{Tenant: tenantID}, false) {
+//	    return ErrMaintenance
+//	}
+func New(ctx context.Context, configCenter config.ConfigCenter, opts ...Option) (*Client, error) {
+	if configCenter == nil {
+		return nil, client.NewError(client.ErrCodeValidation, "config center cannot be nil", nil)
+	}
+
+	c := &Client{
+		configCenter: configCenter,
+		prefix:       "flags",
+		logger:       clog.Namespace("coord.flags"),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.prefix == "" {
+		return nil, client.NewError(client.ErrCodeValidation, "flags prefix cannot be empty", nil)
+	}
+
+	empty := make(map[string]*Flag)
+	c.flags.Store(&empty)
+	if err := c.load(ctx); err != nil {
+		return nil, err
+	}
+
+	watchCtx, cancel := context.WithCancel(context.Background())
+	watcher, err := configCenter.WatchPrefix(watchCtx, c.defsPrefix(), &Flag{})
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to watch flags under %s: %w", c.defsPrefix(), err)
+	}
+	c.watcher = watcher
+	c.cancel = cancel
+
+	go c.watchLoop()
+	return c, nil
+}
+
+// Bool 对 bool 或 percent 类型的开关求值，开关不存在或类型不符时返回 fallback
+func (c *Client) Bool(name string, target Target, fallback bool) bool {
+	flag := c.lookup(name)
+	if flag == nil || (flag.Type != TypeBool && flag.Type != TypePercent) {
+		return fallback
+	}
+	value, err := strconv.ParseBool(flag.evaluate(c.withDefaults(target)))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// String 对 string 类型的开关求值，开关不存在、类型不符或求值结果为空时返回 fallback
+func (c *Client) String(name string, target Target, fallback string) string {
+	flag := c.lookup(name)
+	if flag == nil || flag.Type != TypeString {
+		return fallback
+	}
+	if value := flag.evaluate(c.withDefaults(target)); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// Get 返回开关定义的副本，开关不存在时返回 false
+func (c *Client) Get(name string) (Flag, bool) {
+	flag := c.lookup(name)
+	if flag == nil {
+		return Flag{}, false
+	}
+	return *flag, true
+}
+
+// List 返回所有开关定义，按名称排序
+func (c *Client) List() []Flag {
+	snapshot := *c.flags.Load()
+	list := make([]Flag, 0, len(snapshot))
+	for _, flag := range snapshot {
+		list = append(list, *flag)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// OnChange 注册开关变更回调，开关被删除时 flag 为 nil。
+// 回调在监听协程中同步执行，不应阻塞。
+func (c *Client) OnChange(fn func(name string, flag *Flag)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.listeners = append(c.listeners, fn)
+}
+
+// Set 创建或更新开关并记录审计日志。
+// 通过版本号比较写入，与其他实例的并发修改冲突时返回 CONFLICT 错误，调用方可重新读取后重试。
+func (c *Client) Set(ctx context.Context, flag Flag, actor string) error {
+	if err := flag.Validate(); err != nil {
+		return client.NewError(client.ErrCodeValidation, err.Error(), nil)
+	}
+
+	key := c.defKey(flag.Name)
+	var old Flag
+	version, err := c.configCenter.GetWithVersion(ctx, key, &old)
+	oldPtr := &old
+	if err != nil {
+		if !isNotFound(err) {
+			return fmt.Errorf("failed to read flag %s: %w", flag.Name, err)
+		}
+		version, oldPtr = 0, nil
+	}
+
+	flag.UpdatedAt = time.Now()
+	flag.UpdatedBy = actor
+	if err := c.configCenter.CompareAndSet(ctx, key, flag, version); err != nil {
+		return fmt.Errorf("failed to write flag %s: %w", flag.Name, err)
+	}
+	c.apply(flag.Name, &flag)
+
+	return c.audit(ctx, AuditEntry{
+		Flag:   flag.Name,
+		Action: ActionSet,
+		Actor:  actor,
+		Time:   flag.UpdatedAt,
+		Old:    oldPtr,
+		New:    &flag,
+	})
+}
+
+// Delete 删除开关并记录审计日志，开关不存在时返回 NOT_FOUND 错误
+func (c *Client) Delete(ctx context.Context, name, actor string) error {
+	key := c.defKey(name)
+	var old Flag
+	if err := c.configCenter.Get(ctx, key, &old); err != nil {
+		return fmt.Errorf("failed to read flag %s: %w", name, err)
+	}
+	if err := c.configCenter.Delete(ctx, key); err != nil {
+		return fmt.Errorf("failed to delete flag %s: %w", name, err)
+	}
+	c.apply(name, nil)
+
+	return c.audit(ctx, AuditEntry{
+		Flag:   name,
+		Action: ActionDelete,
+		Actor:  actor,
+		Time:   time.Now(),
+		Old:    &old,
+	})
+}
+
+// History 返回开关最近的 limit 条变更记录，按时间倒序；limit <= 0 表示全部
+func (c *Client) History(ctx context.Context, name string, limit int) ([]AuditEntry, error) {
+	keys, err := c.configCenter.List(ctx, path.Join(c.prefix, "audit", name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit log of flag %s: %w", name, err)
+	}
+	// 键以定长的纳秒时间戳结尾，字典序即时间顺序
+	sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+	}
+
+	entries := make([]AuditEntry, 0, len(keys))
+	for _, key := range keys {
+		var entry AuditEntry
+		if err := c.configCenter.Get(ctx, key, &entry); err != nil {
+			if isNotFound(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read audit entry %s: %w", key, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// Close 停止监听，之后求值使用最后一次的快照。可以安全地多次调用。
+func (c *Client) Close() {
+	c.once.Do(func() {
+		if c.watcher != nil {
+			c.watcher.Close()
+		}
+		if c.cancel != nil {
+			c.cancel()
+		}
+	})
+}
+
+// load 从配置中心加载所有开关，单个开关解析或校验失败时跳过
+func (c *Client) load(ctx context.Context) error {
+	keys, err := c.configCenter.List(ctx, c.defsPrefix())
+	if err != nil {
+		return fmt.Errorf("failed to list flags under %s: %w", c.defsPrefix(), err)
+	}
+
+	snapshot := make(map[string]*Flag, len(keys))
+	for _, key := range keys {
+		var flag Flag
+		if err := c.configCenter.Get(ctx, key, &flag); err != nil {
+			c.logger.Warn("failed to load flag, skipped", clog.String("key", key), clog.Err(err))
+			continue
+		}
+		if err := flag.Validate(); err != nil {
+			c.logger.Warn("invalid flag in config center, skipped", clog.String("key", key), clog.Err(err))
+			continue
+		}
+		snapshot[flag.Name] = &flag
+	}
+
+	c.mu.Lock()
+	c.flags.Store(&snapshot)
+	c.mu.Unlock()
+
+	c.logger.Info("flags loaded", clog.Int("count", len(snapshot)))
+	return nil
+}
+
+// watchLoop 处理开关变更事件
+func (c *Client) watchLoop() {
+	for event := range c.watcher.Chan() {
+		name := strings.TrimPrefix(event.Key, c.defsPrefix()+"/")
+		switch event.Type {
+		case config.EventTypePut:
+			flag, err := decodeFlag(event.Value)
+			if err != nil {
+				c.logger.Error("failed to parse flag from event", clog.String("key", event.Key), clog.Err(err))
+				continue
+			}
+			if err := flag.Validate(); err != nil {
+				c.logger.Warn("invalid flag received, update rejected", clog.String("key", event.Key), clog.Err(err))
+				continue
+			}
+			c.apply(flag.Name, flag)
+			c.logger.Info("flag updated",
+				clog.String("flag", flag.Name),
+				clog.Bool("enabled", flag.Enabled),
+				clog.String("updated_by", flag.UpdatedBy))
+		case config.EventTypeDelete:
+			c.apply(name, nil)
+			c.logger.Info("flag deleted", clog.String("flag", name))
+		}
+	}
+}
+
+// apply 复制快照并替换其中一个开关，flag 为 nil 表示删除
+func (c *Client) apply(name string, flag *Flag) {
+	c.mu.Lock()
+	current := *c.flags.Load()
+	next := make(map[string]*Flag, len(current)+1)
+	for k, v := range current {
+		next[k] = v
+	}
+	if flag == nil {
+		delete(next, name)
+	} else {
+		copied := *flag
+		next[name] = &copied
+	}
+	c.flags.Store(&next)
+	listeners := c.listeners
+	c.mu.Unlock()
+
+	for _, fn := range listeners {
+		fn(name, next[name])
+	}
+}
+
+// audit 写入审计日志并输出一条日志
+func (c *Client) audit(ctx context.Context, entry AuditEntry) error {
+	c.logger.Info("flag changed",
+		clog.String("flag", entry.Flag),
+		clog.String("action", entry.Action),
+		clog.String("actor", entry.Actor))
+
+	key := path.Join(c.prefix, "audit", entry.Flag, fmt.Sprintf("%020d", entry.Time.UnixNano()))
+	if err := c.configCenter.Set(ctx, key, entry); err != nil {
+		c.logger.Error("failed to write flag audit entry", clog.String("flag", entry.Flag), clog.Err(err))
+		return fmt.Errorf("flag %s changed but audit entry was not written: %w", entry.Flag, err)
+	}
+	return nil
+}
+
+// lookup 从当前快照中查找开关
+func (c *Client) lookup(name string) *Flag {
+	return (*c.flags.Load())[name]
+}
+
+// withDefaults 补全 target 的默认环境
+func (c *Client) withDefaults(target Target) Target {
+	if target.Environment == "" {
+		target.Environment = c.environment
+	}
+	return target
+}
+
+func (c *Client) defsPrefix() string {
+	return path.Join(c.prefix, "defs")
+}
+
+func (c *Client) defKey(name string) string {
+	return path.Join(c.defsPrefix(), name)
+}
+
+// decodeFlag 将监听事件中的值转换为 Flag
+func decodeFlag(value any) (*Flag, error) {
+	switch v := value.(type) {
+	case Flag:
+		return &v, nil
+	case *Flag:
+		return v, nil
+	case string:
+		return nil, fmt.Errorf("flag value is not valid JSON: %q", v)
+	}
+	return nil, fmt.Errorf("unexpected flag value type %T", value)
+}
+
+// isNotFound 判断是否为配置键不存在的错误
+func isNotFound(err error) bool {
+	var coordErr *client.Error
+	return errors.As(err, &coordErr) && coordErr.Code == client.ErrCodeNotFound
+}
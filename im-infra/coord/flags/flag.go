@@ -0,0 +1,206 @@
+package flags
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"time"
+)
+
+// Type 表示功能开关的类型
+type Type string
+
+const (
+	// TypeBool 布尔开关，如维护模式、功能总开关
+	TypeBool Type = "bool"
+	// TypePercent 按比例放量的开关，同一个 Target.Key 的结果是稳定的
+	TypePercent Type = "percent"
+	// TypeString 字符串变体，如 A/B 实验分组、降级策略名
+	TypeString Type = "string"
+)
+
+// Flag 是存储在配置中心的功能开关定义
+type Flag struct {
+	// Name 开关名称，只能包含字母、数字、'-'、'_' 和 '.'
+	Name string `json:"name"`
+	// Type 开关类型
+	Type Type `json:"type"`
+	// Description 开关用途说明
+	Description string `json:"description,omitempty"`
+	// Enabled 总开关，为 false 时忽略所有规则：bool/percent 求值为 false，string 求值为 Default
+	Enabled bool `json:"enabled"`
+	// Default 未命中任何规则时的值：bool 为 "true"/"false"，string 为变体名，percent 忽略
+	Default string `json:"default,omitempty"`
+	// Percentage percent 类型未命中任何规则时的放量比例，取值 [0, 100]
+	Percentage float64 `json:"percentage,omitempty"`
+	// Variants string 类型允许的取值，为空表示不限制
+	Variants []string `json:"variants,omitempty"`
+	// Rules 定向规则，按顺序匹配，第一条命中的规则生效
+	Rules []Rule `json:"rules,omitempty"`
+
+	// UpdatedAt 最后修改时间，由 Client.Set 写入
+	UpdatedAt time.Time `json:"updatedAt"`
+	// UpdatedBy 最后修改人，由 Client.Set 写入
+	UpdatedBy string `json:"updatedBy,omitempty"`
+}
+
+// Rule 是按环境和租户定向的规则，Environments 和 Tenants 同时满足时命中
+type Rule struct {
+	// Environments 匹配的环境，为空表示任意环境
+	Environments []string `json:"environments,omitempty"`
+	// Tenants 匹配的租户，为空表示任意租户
+	Tenants []string `json:"tenants,omitempty"`
+	// Value 命中后的值：bool 为 "true"/"false"，string 为变体名，percent 忽略
+	Value string `json:"value,omitempty"`
+	// Percentage percent 类型命中后的放量比例，取值 [0, 100]
+	Percentage float64 `json:"percentage,omitempty"`
+}
+
+// Target 描述一次求值的对象
+type Target struct {
+	// Environment 环境，为空时使用 WithEnvironment 设置的默认环境
+	Environment string
+	// Tenant 租户
+	Tenant string
+	// Key 放量的分桶键，通常为用户 ID，percent 类型必须提供
+	Key string
+}
+
+// Validate 校验开关定义
+func (f *Flag) Validate() error {
+	if err := validateName(f.Name); err != nil {
+		return err
+	}
+
+	switch f.Type {
+	case TypeBool:
+		if _, err := strconv.ParseBool(f.Default); f.Default != "" && err != nil {
+			return fmt.Errorf("flag %s: default must be true or false, got %q", f.Name, f.Default)
+		}
+	case TypePercent:
+		if err := validatePercentage(f.Percentage); err != nil {
+			return fmt.Errorf("flag %s: %w", f.Name, err)
+		}
+	case TypeString:
+		if f.Default != "" && !f.hasVariant(f.Default) {
+			return fmt.Errorf("flag %s: default %q is not a declared variant", f.Name, f.Default)
+		}
+	default:
+		return fmt.Errorf("flag %s: unknown type %q", f.Name, f.Type)
+	}
+
+	for i, rule := range f.Rules {
+		switch f.Type {
+		case TypeBool:
+			if _, err := strconv.ParseBool(rule.Value); err != nil {
+				return fmt.Errorf("flag %s: rule %d value must be true or false, got %q", f.Name, i, rule.Value)
+			}
+		case TypePercent:
+			if err := validatePercentage(rule.Percentage); err != nil {
+				return fmt.Errorf("flag %s: rule %d: %w", f.Name, i, err)
+			}
+		case TypeString:
+			if !f.hasVariant(rule.Value) {
+				return fmt.Errorf("flag %s: rule %d value %q is not a declared variant", f.Name, i, rule.Value)
+			}
+		}
+	}
+	return nil
+}
+
+// evaluate 对 target 求值，返回字符串形式的结果："true"/"false" 或变体名
+func (f *Flag) evaluate(target Target) string {
+	if !f.Enabled {
+		if f.Type == TypeString {
+			return f.Default
+		}
+		return "false"
+	}
+
+	for _, rule := range f.Rules {
+		if !rule.matches(target) {
+			continue
+		}
+		if f.Type == TypePercent {
+			return strconv.FormatBool(f.inRollout(target.Key, rule.Percentage))
+		}
+		return rule.Value
+	}
+
+	switch f.Type {
+	case TypePercent:
+		return strconv.FormatBool(f.inRollout(target.Key, f.Percentage))
+	case TypeBool:
+		if f.Default == "" {
+			return "false"
+		}
+	}
+	return f.Default
+}
+
+// inRollout 按 Name 和 key 的哈希分桶，桶号小于放量比例时命中。
+// 哈希中加入 Name，避免同一批用户总是最先进入所有开关的放量。
+func (f *Flag) inRollout(key string, percentage float64) bool {
+	if percentage >= 100 {
+		return true
+	}
+	if percentage <= 0 || key == "" {
+		return false
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(f.Name + ":" + key))
+	bucket := float64(h.Sum32()%10000) / 100
+	return bucket < percentage
+}
+
+// hasVariant 判断 value 是否为允许的变体
+func (f *Flag) hasVariant(value string) bool {
+	if len(f.Variants) == 0 {
+		return true
+	}
+	for _, v := range f.Variants {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// matches 判断规则是否命中 target
+func (r *Rule) matches(target Target) bool {
+	return matchAny(r.Environments, target.Environment) && matchAny(r.Tenants, target.Tenant)
+}
+
+// matchAny 列表为空时匹配任意值
+func matchAny(list []string, value string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func validatePercentage(p float64) error {
+	if p < 0 || p > 100 {
+		return fmt.Errorf("percentage must be in [0, 100], got %v", p)
+	}
+	return nil
+}
+
+func validateName(name string) error {
+	if name == "" {
+		return fmt.Errorf("flag name cannot be empty")
+	}
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+		default:
+			return fmt.Errorf("flag name %q contains invalid character %q", name, r)
+		}
+	}
+	return nil
+}
@@ -62,12 +62,13 @@ type RetryConfig struct {
 type ErrorCode string
 
 const (
-	ErrCodeConnection  ErrorCode = "CONNECTION_ERROR"
-	ErrCodeTimeout     ErrorCode = "TIMEOUT_ERROR"
-	ErrCodeNotFound    ErrorCode = "NOT_FOUND"
-	ErrCodeConflict    ErrorCode = "CONFLICT"
-	ErrCodeValidation  ErrorCode = "VALIDATION_ERROR"
-	ErrCodeUnavailable ErrorCode = "SERVICE_UNAVAILABLE"
+	ErrCodeConnection       ErrorCode = "CONNECTION_ERROR"
+	ErrCodeTimeout          ErrorCode = "TIMEOUT_ERROR"
+	ErrCodeNotFound         ErrorCode = "NOT_FOUND"
+	ErrCodeConflict         ErrorCode = "CONFLICT"
+	ErrCodeValidation       ErrorCode = "VALIDATION_ERROR"
+	ErrCodeUnavailable      ErrorCode = "SERVICE_UNAVAILABLE"
+	ErrCodePermissionDenied ErrorCode = "PERMISSION_DENIED"
 )
 
 // Error 协调器错误类型
@@ -0,0 +1,607 @@
+package configimpl
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/ceyewan/gochat/im-infra/coord/config"
+	"github.com/ceyewan/gochat/im-infra/coord/internal/client"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	// aclPrefix 保存令牌授权的前缀，键为令牌的 SHA-256 摘要
+	aclPrefix = "/acl/config"
+	// auditPrefix 保存配置变更审计记录的前缀，键按时间排序
+	auditPrefix = "/audit/config"
+	// grantAll 授予所有键
+	grantAll = "*"
+	// mutateRetries 变更与审计记录的事务因并发修改失败时的最大重试次数
+	mutateRetries = 3
+)
+
+// hashValue 返回值的 SHA-256 摘要，nil 表示键不存在，返回空字符串
+func hashValue(data []byte) string {
+	if data == nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// tokenKey 返回令牌授权在 etcd 中的键
+func tokenKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return path.Join(aclPrefix, hex.EncodeToString(sum[:]))
+}
+
+// newAuditKey 生成按时间排序、不会重复的审计记录键
+func newAuditKey(now time.Time) (string, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/%020d-%s", auditPrefix, now.UnixNano(), hex.EncodeToString(suffix)), nil
+}
+
+// cleanKey 规范化键，消除 ".." 等路径成分，防止通过相对路径越过授权前缀
+func cleanKey(key string) string {
+	return strings.TrimPrefix(path.Clean("/"+key), "/")
+}
+
+// ===== 令牌管理与审计流 =====
+
+// AccessAdmin 实现 config.AccessAdmin 接口
+type AccessAdmin struct {
+	client *client.EtcdClient
+	logger clog.Logger
+}
+
+// NewAccessAdmin 创建配置访问令牌管理
+func NewAccessAdmin(c *client.EtcdClient, logger clog.Logger) *AccessAdmin {
+	if logger == nil {
+		logger = clog.Namespace("coordination.config.access")
+	}
+	return &AccessAdmin{client: c, logger: logger}
+}
+
+// IssueToken 为 grant 签发一个新令牌
+func (a *AccessAdmin) IssueToken(ctx context.Context, grant config.AccessGrant) (string, error) {
+	if grant.Principal == "" {
+		return "", client.NewError(client.ErrCodeValidation, "access grant principal cannot be empty", nil)
+	}
+	if len(grant.Read) == 0 && len(grant.Write) == 0 {
+		return "", client.NewError(client.ErrCodeValidation, "access grant must allow at least one prefix", nil)
+	}
+	data, err := json.Marshal(grant)
+	if err != nil {
+		return "", client.NewError(client.ErrCodeValidation, "failed to serialize access grant", err)
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate access token: %w", err)
+	}
+	token := hex.EncodeToString(raw)
+	key := tokenKey(token)
+
+	resp, err := a.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, string(data))).
+		Commit()
+	if err != nil {
+		return "", err
+	}
+	if !resp.Succeeded {
+		return "", client.NewError(client.ErrCodeConflict, "access token already exists", nil)
+	}
+
+	a.logger.Info("config access token issued",
+		clog.String("principal", grant.Principal),
+		clog.Strings("read", grant.Read),
+		clog.Strings("write", grant.Write))
+	return token, nil
+}
+
+// RevokeToken 吊销令牌
+func (a *AccessAdmin) RevokeToken(ctx context.Context, token string) error {
+	if token == "" {
+		return client.NewError(client.ErrCodeValidation, "access token cannot be empty", nil)
+	}
+	resp, err := a.client.Delete(ctx, tokenKey(token))
+	if err != nil {
+		return err
+	}
+	if resp.Deleted == 0 {
+		return client.NewError(client.ErrCodeNotFound, "access token not found", nil)
+	}
+	a.logger.Info("config access token revoked")
+	return nil
+}
+
+// Audit 按时间顺序返回键以 keyPrefix 开头的最近 limit 条审计记录
+func (a *AccessAdmin) Audit(ctx context.Context, keyPrefix string, limit int) ([]config.AuditRecord, error) {
+	opts := []clientv3.OpOption{clientv3.WithPrefix(), clientv3.WithSort(clientv3.SortByKey, clientv3.SortDescend)}
+	// 按键过滤时无法在 etcd 侧限制条数
+	if keyPrefix == "" && limit > 0 {
+		opts = append(opts, clientv3.WithLimit(int64(limit)))
+	}
+	resp, err := a.client.Get(ctx, auditPrefix+"/", opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []config.AuditRecord
+	for _, kv := range resp.Kvs {
+		var record config.AuditRecord
+		if err := json.Unmarshal(kv.Value, &record); err != nil {
+			a.logger.Warn("skipping malformed audit record", clog.String("key", string(kv.Key)), clog.Err(err))
+			continue
+		}
+		if !strings.HasPrefix(record.Key, keyPrefix) {
+			continue
+		}
+		records = append(records, record)
+		if limit > 0 && len(records) == limit {
+			break
+		}
+	}
+	// 查询为倒序，返回时按时间先后排列
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Time.Before(records[j].Time) })
+	return records, nil
+}
+
+// ===== 按令牌限定范围的配置中心 =====
+
+// ScopedConfigCenter 在 EtcdConfigCenter 之上校验令牌的访问范围，
+// 并在写入的同一个 etcd 事务中追加审计记录，变更和审计要么都成功要么都不生效
+type ScopedConfigCenter struct {
+	base      *EtcdConfigCenter
+	principal string
+	// grant 当前生效的授权，nil 表示令牌已被吊销；不使用令牌时为 nil 且 unrestricted 为 true
+	grant        atomic.Pointer[config.AccessGrant]
+	unrestricted bool
+	cancel       context.CancelFunc
+	logger       clog.Logger
+}
+
+// NewScopedConfigCenter 创建限定范围的配置中心。
+// token 非空时从 etcd 读取令牌的授权并监听其变化，令牌不存在时返回错误；
+// token 为空时不限制访问，只以 principal 的身份记录审计
+func NewScopedConfigCenter(ctx context.Context, base *EtcdConfigCenter, token, principal string, logger clog.Logger) (*ScopedConfigCenter, error) {
+	if logger == nil {
+		logger = clog.Namespace("coordination.config.access")
+	}
+	s := &ScopedConfigCenter{base: base, principal: principal, logger: logger}
+	if token == "" {
+		if principal == "" {
+			return nil, client.NewError(client.ErrCodeValidation, "config access requires a token or principal", nil)
+		}
+		s.unrestricted = true
+		s.cancel = func() {}
+		return s, nil
+	}
+
+	key := tokenKey(token)
+	resp, err := base.client.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, client.NewError(client.ErrCodePermissionDenied, "config access token is invalid or revoked", nil)
+	}
+	grant, err := parseGrant(resp.Kvs[0].Value)
+	if err != nil {
+		return nil, err
+	}
+	s.grant.Store(grant)
+	s.principal = grant.Principal
+
+	watchCtx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	go s.watchGrant(watchCtx, key, resp.Header.Revision+1)
+
+	logger.Info("config access scoped by token",
+		clog.String("principal", grant.Principal),
+		clog.Strings("read", grant.Read),
+		clog.Strings("write", grant.Write))
+	return s, nil
+}
+
+func parseGrant(data []byte) (*config.AccessGrant, error) {
+	var grant config.AccessGrant
+	if err := json.Unmarshal(data, &grant); err != nil {
+		return nil, client.NewError(client.ErrCodeValidation, "malformed config access grant", err)
+	}
+	return &grant, nil
+}
+
+// watchGrant 监听令牌授权的变化，授权更新立即生效，令牌被删除后拒绝所有操作
+func (s *ScopedConfigCenter) watchGrant(ctx context.Context, key string, fromRevision int64) {
+	for resp := range s.base.client.Watch(ctx, key, clientv3.WithRev(fromRevision)) {
+		if err := resp.Err(); err != nil {
+			s.logger.Error("config access grant watch failed", clog.Err(err))
+			return
+		}
+		for _, event := range resp.Events {
+			switch event.Type {
+			case clientv3.EventTypePut:
+				grant, err := parseGrant(event.Kv.Value)
+				if err != nil {
+					s.logger.Error("ignoring malformed config access grant", clog.Err(err))
+					continue
+				}
+				s.grant.Store(grant)
+				s.logger.Info("config access grant updated",
+					clog.Strings("read", grant.Read),
+					clog.Strings("write", grant.Write))
+			case clientv3.EventTypeDelete:
+				s.grant.Store(nil)
+				s.logger.Warn("config access token revoked, all config operations will be denied",
+					clog.String("principal", s.principal))
+			}
+		}
+	}
+}
+
+// Close 停止监听令牌授权
+func (s *ScopedConfigCenter) Close() {
+	s.cancel()
+}
+
+// allowed 判断规范化后的键或前缀是否在授权范围内。
+// 授权前缀按路径成分匹配："team-a" 与 "team-a/" 等价，都覆盖 "team-a" 本身及其下所有键，但不覆盖 "team-ab/..."
+func (s *ScopedConfigCenter) allowed(key string, write bool) bool {
+	if s.unrestricted {
+		return true
+	}
+	grant := s.grant.Load()
+	if grant == nil {
+		return false
+	}
+	prefixes := grant.Write
+	if !write {
+		prefixes = append(append([]string(nil), grant.Read...), grant.Write...)
+	}
+	for _, prefix := range prefixes {
+		if prefix == grantAll {
+			return true
+		}
+		granted := cleanKey(prefix)
+		if granted == "" || strings.HasPrefix(key+"/", granted+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// authorize 规范化键并校验访问权限
+func (s *ScopedConfigCenter) authorize(key string, write bool) (string, error) {
+	if key == "" {
+		return "", client.NewError(client.ErrCodeValidation, "config key cannot be empty", nil)
+	}
+	cleaned := cleanKey(key)
+	if err := s.check(cleaned, write); err != nil {
+		return "", err
+	}
+	return cleaned, nil
+}
+
+// authorizePrefix 规范化前缀并校验整个前缀是否在授权范围内
+func (s *ScopedConfigCenter) authorizePrefix(prefix string, write bool) (string, error) {
+	if prefix == "" {
+		return "", client.NewError(client.ErrCodeValidation, "config prefix cannot be empty", nil)
+	}
+	cleaned := cleanKey(prefix)
+	if err := s.check(cleaned, write); err != nil {
+		return "", err
+	}
+	return cleaned, nil
+}
+
+// check 校验规范化后的键或前缀，拒绝时记录日志
+func (s *ScopedConfigCenter) check(cleaned string, write bool) error {
+	if s.allowed(cleaned, write) {
+		return nil
+	}
+	action := "read"
+	if write {
+		action = "write"
+	}
+	s.logger.Warn("config access denied",
+		clog.String("principal", s.principal),
+		clog.String("key", cleaned),
+		clog.String("action", action))
+	return client.NewError(client.ErrCodePermissionDenied,
+		fmt.Sprintf("principal %q is not allowed to %s config key %q", s.principal, action, cleaned), nil)
+}
+
+// Get 获取配置值
+func (s *ScopedConfigCenter) Get(ctx context.Context, key string, v interface{}) error {
+	key, err := s.authorize(key, false)
+	if err != nil {
+		return err
+	}
+	return s.base.Get(ctx, key, v)
+}
+
+// GetWithVersion 获取配置值和版本信息
+func (s *ScopedConfigCenter) GetWithVersion(ctx context.Context, key string, v interface{}) (int64, error) {
+	key, err := s.authorize(key, false)
+	if err != nil {
+		return 0, err
+	}
+	return s.base.GetWithVersion(ctx, key, v)
+}
+
+// Set 存储配置值并追加审计记录
+func (s *ScopedConfigCenter) Set(ctx context.Context, key string, value interface{}) error {
+	key, err := s.authorize(key, true)
+	if err != nil {
+		return err
+	}
+	valueBytes, err := marshalValue(value)
+	if err != nil {
+		return client.NewError(client.ErrCodeValidation, "failed to serialize config value", err)
+	}
+	if err := s.base.schemas.Validate(ctx, key, valueBytes); err != nil {
+		return err
+	}
+	return s.mutate(ctx, config.AuditOpSet, key, valueBytes, 0)
+}
+
+// Preview 预览 Set 的效果，与 Set 一样要求键可写
+func (s *ScopedConfigCenter) Preview(ctx context.Context, key string, value interface{}) (*config.ChangePreview, error) {
+	key, err := s.authorize(key, true)
+	if err != nil {
+		return nil, err
+	}
+	valueBytes, err := marshalValue(value)
+	if err != nil {
+		return nil, client.NewError(client.ErrCodeValidation, "failed to serialize config value", err)
+	}
+	if err := s.base.schemas.Validate(ctx, key, valueBytes); err != nil {
+		return nil, err
+	}
+	return s.base.preview(ctx, key, valueBytes)
+}
+
+// CompareAndSet 版本匹配时存储配置值并追加审计记录
+func (s *ScopedConfigCenter) CompareAndSet(ctx context.Context, key string, value interface{}, expectedVersion int64) error {
+	key, err := s.authorize(key, true)
+	if err != nil {
+		return err
+	}
+	valueBytes, err := marshalValue(value)
+	if err != nil {
+		return client.NewError(client.ErrCodeValidation, "failed to serialize config value", err)
+	}
+	if expectedVersion <= 0 {
+		return client.NewError(client.ErrCodeConflict, "config version mismatch, update rejected", nil)
+	}
+	if err := s.base.schemas.Validate(ctx, key, valueBytes); err != nil {
+		return err
+	}
+	return s.mutate(ctx, config.AuditOpCompareAndSet, key, valueBytes, expectedVersion)
+}
+
+// Delete 删除配置键并追加审计记录
+func (s *ScopedConfigCenter) Delete(ctx context.Context, key string) error {
+	key, err := s.authorize(key, true)
+	if err != nil {
+		return err
+	}
+	return s.mutate(ctx, config.AuditOpDelete, key, nil, 0)
+}
+
+// mutate 在同一个事务中写入（value 为 nil 时删除）配置键和审计记录。
+// 事务以读取旧值时的 ModRevision 为条件，保证审计中的旧值摘要就是被覆盖的值；
+// expectedVersion 大于 0 时还要求旧值的版本与之相同
+func (s *ScopedConfigCenter) mutate(ctx context.Context, op, key string, value []byte, expectedVersion int64) error {
+	configKey := path.Join(s.base.prefix, key)
+
+	for attempt := 0; attempt < mutateRetries; attempt++ {
+		resp, err := s.base.client.Get(ctx, configKey)
+		if err != nil {
+			return err
+		}
+		var old []byte
+		var modRevision int64
+		if len(resp.Kvs) > 0 {
+			old, modRevision = resp.Kvs[0].Value, resp.Kvs[0].ModRevision
+		}
+		if expectedVersion > 0 && modRevision != expectedVersion {
+			return client.NewError(client.ErrCodeConflict, "config version mismatch, update rejected", nil)
+		}
+		if value == nil && old == nil {
+			return client.NewError(client.ErrCodeNotFound, "config key not found for deletion", nil)
+		}
+
+		now := time.Now()
+		record, err := json.Marshal(config.AuditRecord{
+			Principal: s.principal,
+			Op:        op,
+			Key:       key,
+			OldHash:   hashValue(old),
+			NewHash:   hashValue(value),
+			Time:      now,
+		})
+		if err != nil {
+			return err
+		}
+		auditKey, err := newAuditKey(now)
+		if err != nil {
+			return err
+		}
+
+		write := clientv3.OpPut(configKey, string(value))
+		if value == nil {
+			write = clientv3.OpDelete(configKey)
+		}
+		txnResp, err := s.base.client.Txn(ctx).
+			If(
+				clientv3.Compare(clientv3.ModRevision(configKey), "=", modRevision),
+				clientv3.Compare(clientv3.CreateRevision(auditKey), "=", 0),
+			).
+			Then(write, clientv3.OpPut(auditKey, string(record))).
+			Commit()
+		if err != nil {
+			return err
+		}
+		if txnResp.Succeeded {
+			return nil
+		}
+		if expectedVersion > 0 {
+			return client.NewError(client.ErrCodeConflict, "config version mismatch, update rejected", nil)
+		}
+	}
+	return client.NewError(client.ErrCodeConflict, "config key modified concurrently, update rejected", nil)
+}
+
+// Watch 监听单个配置键的变更
+func (s *ScopedConfigCenter) Watch(ctx context.Context, key string, v interface{}) (config.Watcher[any], error) {
+	key, err := s.authorize(key, false)
+	if err != nil {
+		return nil, err
+	}
+	return s.base.Watch(ctx, key, v)
+}
+
+// WatchPrefix 监听前缀下所有配置键的变更，整个前缀都必须可读
+func (s *ScopedConfigCenter) WatchPrefix(ctx context.Context, prefix string, v interface{}) (config.Watcher[any], error) {
+	prefix, err := s.authorizePrefix(prefix, false)
+	if err != nil {
+		return nil, err
+	}
+	w, err := s.base.WatchPrefix(ctx, prefix, v)
+	if err != nil {
+		return nil, err
+	}
+	return s.filterWatcher(w), nil
+}
+
+// scopedWatcher 丢弃授权范围之外的事件：etcd 的前缀监听按字符串匹配，监听 "team-a" 时也会收到 "team-ab/..." 的事件
+type scopedWatcher struct {
+	base config.Watcher[any]
+	ch   chan config.ConfigEvent[any]
+	done chan struct{}
+	once sync.Once
+}
+
+// filterWatcher 包装前缀监听，只转发可读键的事件
+func (s *ScopedConfigCenter) filterWatcher(base config.Watcher[any]) *scopedWatcher {
+	w := &scopedWatcher{base: base, ch: make(chan config.ConfigEvent[any], 10), done: make(chan struct{})}
+	go func() {
+		defer close(w.ch)
+		for event := range base.Chan() {
+			if !s.allowed(event.Key, false) {
+				continue
+			}
+			select {
+			case w.ch <- event:
+			case <-w.done:
+				return
+			}
+		}
+	}()
+	return w
+}
+
+// Chan 返回过滤后的事件通道
+func (w *scopedWatcher) Chan() <-chan config.ConfigEvent[any] {
+	return w.ch
+}
+
+// Close 停止监听
+func (w *scopedWatcher) Close() {
+	w.once.Do(func() { close(w.done) })
+	w.base.Close()
+}
+
+// List 列出前缀下可读的配置键，不可读的键被过滤
+func (s *ScopedConfigCenter) List(ctx context.Context, prefix string) ([]string, error) {
+	keys, err := s.base.List(ctx, cleanKey(prefix))
+	if err != nil {
+		return nil, err
+	}
+	visible := keys[:0]
+	for _, key := range keys {
+		if s.allowed(key, false) {
+			visible = append(visible, key)
+		}
+	}
+	return visible, nil
+}
+
+// ImportTree 整树导入，整个前缀都必须可写；切换成功后追加审计记录
+func (s *ScopedConfigCenter) ImportTree(ctx context.Context, prefix string, tree map[string][]byte, swap config.AtomicSwap) (string, error) {
+	prefix, err := s.authorizePrefix(prefix, true)
+	if err != nil {
+		return "", err
+	}
+	revision, err := s.base.ImportTree(ctx, prefix, tree, swap)
+	if err != nil {
+		return "", err
+	}
+	s.appendAudit(ctx, config.AuditRecord{
+		Principal: s.principal,
+		Op:        config.AuditOpImportTree,
+		Key:       prefix,
+		NewHash:   hashTree(tree),
+		Revision:  revision,
+		Time:      time.Now(),
+	})
+	return revision, nil
+}
+
+// ExportTree 整树导出，整个前缀都必须可读
+func (s *ScopedConfigCenter) ExportTree(ctx context.Context, prefix string) (map[string][]byte, string, error) {
+	prefix, err := s.authorizePrefix(prefix, false)
+	if err != nil {
+		return nil, "", err
+	}
+	return s.base.ExportTree(ctx, prefix)
+}
+
+// appendAudit 单独追加一条审计记录，用于无法与变更放在同一个事务中的整树导入，失败只记录日志
+func (s *ScopedConfigCenter) appendAudit(ctx context.Context, record config.AuditRecord) {
+	data, err := json.Marshal(record)
+	if err == nil {
+		var key string
+		if key, err = newAuditKey(record.Time); err == nil {
+			_, err = s.base.client.Put(ctx, key, string(data))
+		}
+	}
+	if err != nil {
+		s.logger.Error("failed to append config audit record",
+			clog.String("op", record.Op),
+			clog.String("key", record.Key),
+			clog.Err(err))
+	}
+}
+
+// hashTree 按键排序后计算整棵配置树的摘要
+func hashTree(tree map[string][]byte) string {
+	keys := make([]string, 0, len(tree))
+	for key := range tree {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	h := sha256.New()
+	for _, key := range keys {
+		fmt.Fprintf(h, "%s\x00%d\x00", key, len(tree[key]))
+		h.Write(tree[key])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
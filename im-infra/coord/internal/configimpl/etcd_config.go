@@ -6,6 +6,7 @@ import (
 	"path"
 	"reflect"
 	"strings"
+	"time"
 
 	"github.com/ceyewan/gochat/im-infra/clog"
 	"github.com/ceyewan/gochat/im-infra/coord/config"
@@ -13,11 +14,16 @@ import (
 	clientv3 "go.etcd.io/etcd/client/v3"
 )
 
+// watchCreateTimeout 等待 etcd 确认监听建立的最长时间，超时后不再等待，监听仍在后台继续建立
+const watchCreateTimeout = 5 * time.Second
+
 // EtcdConfigCenter 使用 etcd 实现 config.ConfigCenter 接口
 type EtcdConfigCenter struct {
-	client *client.EtcdClient // etcd 客户端
-	prefix string             // 配置前缀
-	logger clog.Logger        // 日志记录器
+	client   *client.EtcdClient // etcd 客户端
+	prefix   string             // 配置前缀
+	logger   clog.Logger        // 日志记录器
+	schemas  *SchemaRegistry    // 写入前校验的 Schema
+	watchers *watcherRegistry   // 本进程监听器在 etcd 中的登记
 }
 
 // NewEtcdConfigCenter 创建一个基于 etcd 的配置中心
@@ -29,12 +35,24 @@ func NewEtcdConfigCenter(c *client.EtcdClient, prefix string, logger clog.Logger
 		logger = clog.Namespace("coordination.config")
 	}
 	return &EtcdConfigCenter{
-		client: c,
-		prefix: prefix,
-		logger: logger,
+		client:   c,
+		prefix:   prefix,
+		logger:   logger,
+		schemas:  NewSchemaRegistry(c, logger),
+		watchers: newWatcherRegistry(c, logger),
 	}
 }
 
+// Close 吊销监听器登记的租约，需要在关闭 etcd 客户端之前调用
+func (c *EtcdConfigCenter) Close() {
+	c.watchers.close()
+}
+
+// Schemas 返回写入前校验配置值的 Schema 注册表
+func (c *EtcdConfigCenter) Schemas() *SchemaRegistry {
+	return c.schemas
+}
+
 // Get 获取配置值并反序列化到提供的类型 v
 func (c *EtcdConfigCenter) Get(ctx context.Context, key string, v interface{}) error {
 	if key == "" {
@@ -100,6 +118,9 @@ func (c *EtcdConfigCenter) CompareAndSet(ctx context.Context, key string, value
 	if err != nil {
 		return client.NewError(client.ErrCodeValidation, "failed to serialize config value", err)
 	}
+	if err := c.schemas.Validate(ctx, key, valueBytes); err != nil {
+		return err
+	}
 
 	configKey := path.Join(c.prefix, key)
 
@@ -133,12 +154,55 @@ func (c *EtcdConfigCenter) Set(ctx context.Context, key string, value interface{
 	if err != nil {
 		return client.NewError(client.ErrCodeValidation, "failed to serialize config value", err)
 	}
+	if err := c.schemas.Validate(ctx, key, valueBytes); err != nil {
+		return err
+	}
 
 	configKey := path.Join(c.prefix, key)
 	_, err = c.client.Put(ctx, configKey, string(valueBytes))
 	return err // 客户端已包装错误
 }
 
+// Preview 预览 Set 的效果：校验新值，返回与当前值的差异和写入后会收到事件的监听器
+func (c *EtcdConfigCenter) Preview(ctx context.Context, key string, value interface{}) (*config.ChangePreview, error) {
+	if key == "" {
+		return nil, client.NewError(client.ErrCodeValidation, "config key cannot be empty", nil)
+	}
+
+	valueBytes, err := marshalValue(value)
+	if err != nil {
+		return nil, client.NewError(client.ErrCodeValidation, "failed to serialize config value", err)
+	}
+	if err := c.schemas.Validate(ctx, key, valueBytes); err != nil {
+		return nil, err
+	}
+	return c.preview(ctx, key, valueBytes)
+}
+
+// preview 读取当前值并计算差异，key 为相对配置前缀的键
+func (c *EtcdConfigCenter) preview(ctx context.Context, key string, value []byte) (*config.ChangePreview, error) {
+	configKey := path.Join(c.prefix, key)
+	resp, err := c.client.Get(ctx, configKey)
+	if err != nil {
+		return nil, err
+	}
+
+	relativeKey := strings.TrimPrefix(configKey, c.prefix+"/")
+	preview := &config.ChangePreview{Key: relativeKey, NewValue: value}
+	if len(resp.Kvs) > 0 {
+		preview.Exists = true
+		preview.Version = resp.Kvs[0].ModRevision
+		preview.OldValue = resp.Kvs[0].Value
+	}
+	preview.Changes = config.Diff(preview.OldValue, value)
+
+	// 监听器按完整的 etcd 键登记
+	if preview.Watchers, err = c.watchers.list(ctx, configKey); err != nil {
+		return nil, err
+	}
+	return preview, nil
+}
+
 // Delete 删除配置键
 func (c *EtcdConfigCenter) Delete(ctx context.Context, key string) error {
 	if key == "" {
@@ -202,22 +266,45 @@ func (c *EtcdConfigCenter) watch(ctx context.Context, keyOrPrefix string, v inte
 	}
 	valueType := rv.Type().Elem()
 
-	var opts []clientv3.OpOption
+	opts := []clientv3.OpOption{clientv3.WithCreatedNotify()}
 	if isPrefix {
 		opts = append(opts, clientv3.WithPrefix())
 	}
 
 	watchCtx, cancel := context.WithCancel(ctx)
 	etcdWatchCh := c.client.Watch(watchCtx, keyOrPrefix, opts...)
+	// 等待 etcd 确认监听已建立再返回，调用方在 Watch 之后读取的当前值与后续事件之间不会有遗漏
+	timer := time.NewTimer(watchCreateTimeout)
+	select {
+	case resp, ok := <-etcdWatchCh:
+		timer.Stop()
+		if !ok {
+			cancel()
+			return nil, client.NewError(client.ErrCodeConnection, "watch channel closed before created", ctx.Err())
+		}
+		if err := resp.Err(); err != nil {
+			cancel()
+			return nil, err
+		}
+	case <-timer.C:
+		c.logger.Warn("watch not confirmed in time, continuing", clog.String("key", keyOrPrefix))
+	case <-ctx.Done():
+		timer.Stop()
+		cancel()
+		return nil, ctx.Err()
+	}
 	eventCh := make(chan config.ConfigEvent[any], 10)
 
 	w := &etcdWatcher{
 		ch:     eventCh,
 		cancel: cancel,
 	}
+	// 登记共用 /watchers/config 命名空间，使用包含配置前缀的完整键，避免不同前缀的配置中心互相匹配
+	unregister := c.watchers.register(ctx, keyOrPrefix, isPrefix)
 
 	go func() {
 		defer close(eventCh)
+		defer unregister()
 		for resp := range etcdWatchCh {
 			if err := resp.Err(); err != nil {
 				c.logger.Error("Watcher error", clog.String("key", keyOrPrefix), clog.Err(err))
@@ -0,0 +1,237 @@
+package configimpl
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/ceyewan/gochat/im-infra/coord/config"
+	"github.com/ceyewan/gochat/im-infra/coord/internal/client"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	// treePointerKey 指向当前生效修订版本的指针键名
+	treePointerKey = "_current"
+	// treeRevisionsDir 保存各修订版本的目录名
+	treeRevisionsDir = "_revisions"
+	// treeTxnBatchSize 每个写入事务包含的最大操作数，需小于 etcd 默认的 --max-txn-ops (128)
+	treeTxnBatchSize = 100
+	// noRevision 作为 ExpectedRevision 时表示要求前缀下尚无任何版本
+	noRevision = "-"
+)
+
+// ImportTree 将整棵配置树写入新修订版本目录并原子切换指针。
+//
+// 存储布局：
+//
+//	<prefix>/_current                   -> 当前修订版本名
+//	<prefix>/_revisions/<rev>/<key>     -> 配置值
+//
+// 修订版本目录分批写入，任一批失败都会清理已写入的部分，指针保持不变。
+func (c *EtcdConfigCenter) ImportTree(ctx context.Context, prefix string, tree map[string][]byte, swap config.AtomicSwap) (string, error) {
+	if prefix == "" {
+		return "", client.NewError(client.ErrCodeValidation, "config prefix cannot be empty", nil)
+	}
+	if len(tree) == 0 {
+		return "", client.NewError(client.ErrCodeValidation, "config tree cannot be empty", nil)
+	}
+
+	revision := swap.Revision
+	if revision == "" {
+		revision = time.Now().UTC().Format("20060102T150405.000000000Z")
+	}
+	if !isValidRevision(revision) {
+		return "", client.NewError(client.ErrCodeValidation, "invalid config tree revision: "+revision, nil)
+	}
+
+	keys := make([]string, 0, len(tree))
+	for key := range tree {
+		if !isValidTreeKey(key) {
+			return "", client.NewError(client.ErrCodeValidation, "invalid config tree key: "+key, nil)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if err := c.schemas.ValidateTree(ctx, prefix, tree); err != nil {
+		return "", err
+	}
+
+	root := path.Join(c.prefix, prefix)
+	pointerKey := path.Join(root, treePointerKey)
+	revisionDir := path.Join(root, treeRevisionsDir, revision) + "/"
+
+	// 修订版本目录必须是全新的，避免覆盖已有版本
+	existing, err := c.client.Get(ctx, revisionDir, clientv3.WithPrefix(), clientv3.WithCountOnly())
+	if err != nil {
+		return "", err
+	}
+	if existing.Count > 0 {
+		return "", client.NewError(client.ErrCodeConflict, "config tree revision already exists: "+revision, nil)
+	}
+
+	for start := 0; start < len(keys); start += treeTxnBatchSize {
+		end := start + treeTxnBatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		ops := make([]clientv3.Op, 0, end-start)
+		for _, key := range keys[start:end] {
+			ops = append(ops, clientv3.OpPut(revisionDir+key, string(tree[key])))
+		}
+		if _, err := c.client.Txn(ctx).Then(ops...).Commit(); err != nil {
+			c.discardRevision(revisionDir)
+			return "", client.NewError(client.ErrCodeConnection, "failed to write config tree revision", err)
+		}
+	}
+
+	// 所有键写入完成后，再原子地切换指针
+	txn := c.client.Txn(ctx)
+	switch swap.ExpectedRevision {
+	case "":
+	case noRevision:
+		txn = txn.If(clientv3.Compare(clientv3.CreateRevision(pointerKey), "=", 0))
+	default:
+		txn = txn.If(clientv3.Compare(clientv3.Value(pointerKey), "=", swap.ExpectedRevision))
+	}
+	txnResp, err := txn.Then(clientv3.OpPut(pointerKey, revision)).Commit()
+	if err != nil {
+		c.discardRevision(revisionDir)
+		return "", client.NewError(client.ErrCodeConnection, "failed to swap config tree pointer", err)
+	}
+	if !txnResp.Succeeded {
+		c.discardRevision(revisionDir)
+		return "", client.NewError(client.ErrCodeConflict, "config tree revision changed, import rejected", nil)
+	}
+
+	c.logger.Info("配置树导入成功",
+		clog.String("prefix", prefix),
+		clog.String("revision", revision),
+		clog.Int("keys", len(keys)),
+	)
+
+	if swap.KeepRevisions > 0 {
+		c.pruneRevisions(ctx, root, revision, swap.KeepRevisions)
+	}
+	return revision, nil
+}
+
+// ExportTree 导出指针当前指向的整棵配置树。
+// 指针和数据在同一个 etcd revision 上读取，保证导出结果来自同一个版本。
+func (c *EtcdConfigCenter) ExportTree(ctx context.Context, prefix string) (map[string][]byte, string, error) {
+	if prefix == "" {
+		return nil, "", client.NewError(client.ErrCodeValidation, "config prefix cannot be empty", nil)
+	}
+
+	root := path.Join(c.prefix, prefix)
+	pointerResp, err := c.client.Get(ctx, path.Join(root, treePointerKey))
+	if err != nil {
+		return nil, "", err
+	}
+
+	// 尚未通过 ImportTree 导入过，按普通键导出
+	if len(pointerResp.Kvs) == 0 {
+		resp, err := c.client.Get(ctx, root+"/", clientv3.WithPrefix(), clientv3.WithRev(pointerResp.Header.Revision))
+		if err != nil {
+			return nil, "", err
+		}
+		tree := make(map[string][]byte, len(resp.Kvs))
+		for _, kv := range resp.Kvs {
+			key := strings.TrimPrefix(string(kv.Key), root+"/")
+			if strings.HasPrefix(key, treeRevisionsDir+"/") {
+				continue
+			}
+			tree[key] = kv.Value
+		}
+		if len(tree) == 0 {
+			return nil, "", client.NewError(client.ErrCodeNotFound, "config tree not found", nil)
+		}
+		return tree, "", nil
+	}
+
+	revision := string(pointerResp.Kvs[0].Value)
+	revisionDir := path.Join(root, treeRevisionsDir, revision) + "/"
+	resp, err := c.client.Get(ctx, revisionDir, clientv3.WithPrefix(), clientv3.WithRev(pointerResp.Header.Revision))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, "", client.NewError(client.ErrCodeNotFound, "config tree revision is empty: "+revision, nil)
+	}
+
+	tree := make(map[string][]byte, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		tree[strings.TrimPrefix(string(kv.Key), revisionDir)] = kv.Value
+	}
+	return tree, revision, nil
+}
+
+// discardRevision 尽力清理未生效的修订版本目录。
+// 使用独立的 context，保证调用方 ctx 已取消时仍能清理。
+func (c *EtcdConfigCenter) discardRevision(revisionDir string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := c.client.Delete(ctx, revisionDir, clientv3.WithPrefix()); err != nil {
+		c.logger.Warn("清理未生效的配置树版本失败", clog.String("dir", revisionDir), clog.Err(err))
+	}
+}
+
+// pruneRevisions 按创建顺序删除多余的历史版本，保留最近 keep 个（不含当前版本）。
+// 清理失败不影响导入结果，仅记录日志。
+func (c *EtcdConfigCenter) pruneRevisions(ctx context.Context, root, current string, keep int) {
+	revisionsRoot := path.Join(root, treeRevisionsDir) + "/"
+	resp, err := c.client.Get(ctx, revisionsRoot, clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		c.logger.Warn("列出配置树历史版本失败", clog.String("prefix", root), clog.Err(err))
+		return
+	}
+
+	// 以目录下最早的 CreateRevision 作为版本的创建顺序
+	created := make(map[string]int64)
+	for _, kv := range resp.Kvs {
+		rel := strings.TrimPrefix(string(kv.Key), revisionsRoot)
+		revision, _, _ := strings.Cut(rel, "/")
+		if revision == current {
+			continue
+		}
+		if rev, ok := created[revision]; !ok || kv.CreateRevision < rev {
+			created[revision] = kv.CreateRevision
+		}
+	}
+	if len(created) <= keep {
+		return
+	}
+
+	revisions := make([]string, 0, len(created))
+	for revision := range created {
+		revisions = append(revisions, revision)
+	}
+	sort.Slice(revisions, func(i, j int) bool {
+		return created[revisions[i]] > created[revisions[j]]
+	})
+
+	for _, revision := range revisions[keep:] {
+		if _, err := c.client.Delete(ctx, revisionsRoot+revision+"/", clientv3.WithPrefix()); err != nil {
+			c.logger.Warn("删除配置树历史版本失败", clog.String("revision", revision), clog.Err(err))
+			continue
+		}
+		c.logger.Debug("已删除配置树历史版本", clog.String("revision", revision))
+	}
+}
+
+// isValidRevision 检查修订版本名，不能包含路径分隔符
+func isValidRevision(revision string) bool {
+	return revision != noRevision && revision != "." && revision != ".." && !strings.Contains(revision, "/")
+}
+
+// isValidTreeKey 检查配置树中的相对键，不能为空、不能逃逸出修订版本目录
+func isValidTreeKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key {
+		return false
+	}
+	return key != "." && key != ".." && !strings.HasPrefix(key, "../")
+}
@@ -0,0 +1,194 @@
+package configimpl
+
+import (
+	"context"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/ceyewan/gochat/im-infra/coord/config"
+	"github.com/ceyewan/gochat/im-infra/coord/internal/client"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// schemaPrefix 保存 JSON Schema 的前缀，键为转义后的配置键前缀
+const schemaPrefix = "/schema/config"
+
+// storedSchema 是从 etcd 读取并解析过的 JSON Schema，按 ModRevision 缓存
+type storedSchema struct {
+	modRevision int64
+	schema      config.Schema
+}
+
+// SchemaRegistry 实现 config.SchemaRegistry 接口。
+// JSON Schema 保存在 etcd 中，每次写入前读取一次 /schema/config/ 以保证使用最新的 Schema，
+// 解析结果按 ModRevision 缓存；本地注册的 Schema 只对当前进程生效。
+type SchemaRegistry struct {
+	client *client.EtcdClient
+	logger clog.Logger
+
+	mu     sync.RWMutex
+	local  map[string][]config.Schema
+	parsed map[string]storedSchema
+}
+
+// NewSchemaRegistry 创建配置 Schema 注册表
+func NewSchemaRegistry(c *client.EtcdClient, logger clog.Logger) *SchemaRegistry {
+	if logger == nil {
+		logger = clog.Namespace("coordination.config.schema")
+	}
+	return &SchemaRegistry{
+		client: c,
+		logger: logger,
+		local:  make(map[string][]config.Schema),
+		parsed: make(map[string]storedSchema),
+	}
+}
+
+// normalizePrefix 规范化 Schema 前缀，与 cleanKey 处理后的键按字符串前缀匹配
+func normalizePrefix(prefix string) string {
+	return strings.TrimPrefix(prefix, "/")
+}
+
+// schemaKey 返回前缀对应的 etcd 键，前缀中的 "/" 被转义，使每个前缀对应一个键
+func schemaKey(prefix string) string {
+	return schemaPrefix + "/" + url.PathEscape(prefix)
+}
+
+// RegisterSchema 校验并保存 JSON Schema
+func (r *SchemaRegistry) RegisterSchema(ctx context.Context, prefix string, schema []byte) error {
+	prefix = normalizePrefix(prefix)
+	if prefix == "" {
+		return client.NewError(client.ErrCodeValidation, "schema prefix cannot be empty", nil)
+	}
+	if _, err := config.ParseJSONSchema(schema); err != nil {
+		return client.NewError(client.ErrCodeValidation, "invalid json schema", err)
+	}
+	if _, err := r.client.Put(ctx, schemaKey(prefix), string(schema)); err != nil {
+		return err
+	}
+	r.logger.Info("config schema registered", clog.String("prefix", prefix))
+	return nil
+}
+
+// RemoveSchema 删除保存的 JSON Schema
+func (r *SchemaRegistry) RemoveSchema(ctx context.Context, prefix string) error {
+	prefix = normalizePrefix(prefix)
+	resp, err := r.client.Delete(ctx, schemaKey(prefix))
+	if err != nil {
+		return err
+	}
+	if resp.Deleted == 0 {
+		return client.NewError(client.ErrCodeNotFound, "config schema not found", nil)
+	}
+	r.logger.Info("config schema removed", clog.String("prefix", prefix))
+	return nil
+}
+
+// Schemas 返回保存的所有 JSON Schema
+func (r *SchemaRegistry) Schemas(ctx context.Context) (map[string][]byte, error) {
+	resp, err := r.client.Get(ctx, schemaPrefix+"/", clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	schemas := make(map[string][]byte, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		prefix, err := url.PathUnescape(path.Base(string(kv.Key)))
+		if err != nil {
+			continue
+		}
+		schemas[prefix] = kv.Value
+	}
+	return schemas, nil
+}
+
+// RegisterLocal 在本进程内为前缀注册 Schema，同一前缀可以注册多个
+func (r *SchemaRegistry) RegisterLocal(prefix string, schema config.Schema) {
+	if schema == nil {
+		return
+	}
+	prefix = normalizePrefix(prefix)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.local[prefix] = append(r.local[prefix], schema)
+}
+
+// Validate 按所有匹配 key 的 Schema 校验 value
+func (r *SchemaRegistry) Validate(ctx context.Context, key string, value []byte) error {
+	key = cleanKey(key)
+	matched, err := r.match(ctx, key)
+	if err != nil {
+		return err
+	}
+	for _, m := range matched {
+		if violations := m.schema.Validate(value); len(violations) > 0 {
+			return client.NewError(client.ErrCodeValidation, "config value rejected by schema",
+				&config.ValidationError{Key: key, Prefix: m.prefix, Violations: violations})
+		}
+	}
+	return nil
+}
+
+// ValidateTree 校验整树导入的每个键，键为相对 prefix 的路径
+func (r *SchemaRegistry) ValidateTree(ctx context.Context, prefix string, tree map[string][]byte) error {
+	keys := make([]string, 0, len(tree))
+	for k := range tree {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := r.Validate(ctx, path.Join(prefix, k), tree[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matchedSchema 是匹配某个键的 Schema 及其前缀
+type matchedSchema struct {
+	prefix string
+	schema config.Schema
+}
+
+// match 返回匹配 key 的所有 Schema，按前缀从短到长排列，同一前缀先本地后 etcd
+func (r *SchemaRegistry) match(ctx context.Context, key string) ([]matchedSchema, error) {
+	resp, err := r.client.Get(ctx, schemaPrefix+"/", clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []matchedSchema
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for prefix, schemas := range r.local {
+		if strings.HasPrefix(key, prefix) {
+			for _, schema := range schemas {
+				matched = append(matched, matchedSchema{prefix: prefix, schema: schema})
+			}
+		}
+	}
+	for _, kv := range resp.Kvs {
+		etcdKey := string(kv.Key)
+		prefix, err := url.PathUnescape(path.Base(etcdKey))
+		if err != nil || !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		cached, ok := r.parsed[etcdKey]
+		if !ok || cached.modRevision != kv.ModRevision {
+			schema, err := config.ParseJSONSchema(kv.Value)
+			if err != nil {
+				// 只能通过 RegisterSchema 写入的 Schema 不应解析失败，跳过被手工改坏的 Schema 而不是阻塞所有写入
+				r.logger.Warn("skipping malformed config schema", clog.String("prefix", prefix), clog.Err(err))
+				continue
+			}
+			cached = storedSchema{modRevision: kv.ModRevision, schema: schema}
+			r.parsed[etcdKey] = cached
+		}
+		matched = append(matched, matchedSchema{prefix: prefix, schema: cached.schema})
+	}
+	sort.SliceStable(matched, func(i, j int) bool { return len(matched[i].prefix) < len(matched[j].prefix) })
+	return matched, nil
+}
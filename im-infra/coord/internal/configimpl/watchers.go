@@ -0,0 +1,222 @@
+package configimpl
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/ceyewan/gochat/im-infra/coord/config"
+	"github.com/ceyewan/gochat/im-infra/coord/internal/client"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	// watcherPrefix 登记配置监听器的前缀，Preview 据此找出写入会通知到的进程
+	watcherPrefix = "/watchers/config"
+	// watcherLeaseTTL 登记键绑定的租约有效期（秒），进程异常退出后登记在该时间内自动删除
+	watcherLeaseTTL = 30
+)
+
+// watcherRegistry 将本进程的 Watch/WatchPrefix 登记到 etcd，使其他进程和 config-cli 可以看到。
+// 所有登记键共用一个租约；租约丢失（如长时间与 etcd 断连）后重新申请并补写所有登记。
+// 登记只用于展示影响范围，失败时只记录日志，不影响监听本身。
+type watcherRegistry struct {
+	client   *client.EtcdClient
+	logger   clog.Logger
+	instance string
+
+	mu      sync.Mutex
+	leaseID clientv3.LeaseID
+	entries map[string]config.WatcherInfo // 键为登记键
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// newWatcherRegistry 创建监听器登记
+func newWatcherRegistry(c *client.EtcdClient, logger clog.Logger) *watcherRegistry {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &watcherRegistry{
+		client:   c,
+		logger:   logger,
+		instance: fmt.Sprintf("%s/%d", hostname, os.Getpid()),
+		entries:  make(map[string]config.WatcherInfo),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// register 登记一个监听器，返回注销函数
+func (r *watcherRegistry) register(ctx context.Context, key string, prefix bool) func() {
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		r.logger.Warn("failed to register config watcher", clog.String("key", key), clog.Err(err))
+		return func() {}
+	}
+	regKey := watcherPrefix + "/" + hex.EncodeToString(suffix)
+	info := config.WatcherInfo{Key: key, Prefix: prefix, Instance: r.instance, Since: time.Now()}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.ctx.Err() != nil {
+		return func() {}
+	}
+	r.entries[regKey] = info
+	if err := r.putLocked(ctx, regKey, info); err != nil {
+		r.logger.Warn("failed to register config watcher", clog.String("key", key), clog.Err(err))
+	}
+
+	var once sync.Once
+	return func() { once.Do(func() { r.unregister(regKey) }) }
+}
+
+// unregister 注销监听器
+func (r *watcherRegistry) unregister(regKey string) {
+	r.mu.Lock()
+	delete(r.entries, regKey)
+	closed := r.ctx.Err() != nil
+	r.mu.Unlock()
+	// 已关闭时租约已吊销，登记随之删除
+	if closed {
+		return
+	}
+
+	// 监听通常随调用方的 ctx 取消而结束，删除使用独立的超时
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := r.client.Delete(ctx, regKey); err != nil {
+		r.logger.Warn("failed to unregister config watcher, it will expire with the lease",
+			clog.String("registration", regKey), clog.Err(err))
+	}
+}
+
+// putLocked 在租约下写入登记，尚无租约时先申请并启动续约
+func (r *watcherRegistry) putLocked(ctx context.Context, regKey string, info config.WatcherInfo) error {
+	if r.leaseID == 0 {
+		lease, err := r.client.Grant(ctx, watcherLeaseTTL)
+		if err != nil {
+			return err
+		}
+		keepAlive, err := r.client.KeepAlive(r.ctx, lease.ID)
+		if err != nil {
+			return err
+		}
+		r.leaseID = lease.ID
+		r.wg.Add(1)
+		go r.keepAlive(lease.ID, keepAlive)
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	_, err = r.client.Put(ctx, regKey, string(data), clientv3.WithLease(r.leaseID))
+	return err
+}
+
+// keepAlive 消费续约响应，租约丢失后周期性重试补写所有登记，直到成功或登记关闭
+func (r *watcherRegistry) keepAlive(id clientv3.LeaseID, ch <-chan *clientv3.LeaseKeepAliveResponse) {
+	defer r.wg.Done()
+	for range ch {
+	}
+	if r.ctx.Err() != nil {
+		return
+	}
+	r.logger.Warn("config watcher lease lost, re-registering watchers")
+
+	ticker := time.NewTicker(watcherLeaseTTL * time.Second / 3)
+	defer ticker.Stop()
+	for {
+		if r.restore(id) {
+			return
+		}
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// restore 重新申请租约并补写所有登记，成功时返回 true。新的续约由 putLocked 启动
+func (r *watcherRegistry) restore(lost clientv3.LeaseID) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.ctx.Err() != nil {
+		return true
+	}
+	if r.leaseID == lost {
+		r.leaseID = 0
+	}
+	if len(r.entries) == 0 {
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(r.ctx, 5*time.Second)
+	defer cancel()
+	for regKey, info := range r.entries {
+		if err := r.putLocked(ctx, regKey, info); err != nil {
+			r.logger.Warn("failed to re-register config watchers", clog.Err(err))
+			return false
+		}
+	}
+	return true
+}
+
+// list 返回集群中写入 key 时会收到事件的监听器，按键和实例排序
+func (r *watcherRegistry) list(ctx context.Context, key string) ([]config.WatcherInfo, error) {
+	resp, err := r.client.Get(ctx, watcherPrefix+"/", clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	var watchers []config.WatcherInfo
+	for _, kv := range resp.Kvs {
+		var info config.WatcherInfo
+		if err := json.Unmarshal(kv.Value, &info); err != nil {
+			r.logger.Warn("skipping malformed watcher registration", clog.String("key", string(kv.Key)), clog.Err(err))
+			continue
+		}
+		if info.Matches(key) {
+			watchers = append(watchers, info)
+		}
+	}
+	sort.Slice(watchers, func(i, j int) bool {
+		if watchers[i].Key != watchers[j].Key {
+			return watchers[i].Key < watchers[j].Key
+		}
+		if watchers[i].Instance != watchers[j].Instance {
+			return watchers[i].Instance < watchers[j].Instance
+		}
+		return watchers[i].Since.Before(watchers[j].Since)
+	})
+	return watchers, nil
+}
+
+// close 停止续约并吊销租约，本进程的所有登记随之删除
+func (r *watcherRegistry) close() {
+	r.mu.Lock()
+	r.cancel()
+	leaseID := r.leaseID
+	r.leaseID = 0
+	r.mu.Unlock()
+	r.wg.Wait()
+
+	if leaseID == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := r.client.Revoke(ctx, leaseID); err != nil {
+		r.logger.Warn("failed to revoke config watcher lease", clog.Err(err))
+	}
+}
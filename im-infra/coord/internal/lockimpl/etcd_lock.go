@@ -3,6 +3,7 @@ package lockimpl
 import (
 	"context"
 	"path"
+	"sync"
 	"time"
 
 	"github.com/ceyewan/gochat/im-infra/clog"
@@ -17,6 +18,9 @@ type EtcdLockFactory struct {
 	client *client.EtcdClient // etcd 客户端
 	prefix string             // 锁的前缀
 	logger clog.Logger        // 日志记录器
+
+	statsMu sync.Mutex
+	stats   map[string]*holdStats // 每个锁观测到的持锁时长，用于估算公平锁的等待时间，最多保留 maxHoldStats 个锁
 }
 
 // NewEtcdLockFactory 创建一个 etcd 分布式锁工厂
@@ -31,9 +35,16 @@ func NewEtcdLockFactory(c *client.EtcdClient, prefix string, logger clog.Logger)
 		client: c,
 		prefix: prefix,
 		logger: logger,
+		stats:  make(map[string]*holdStats),
 	}
 }
 
+// leaseSeconds 将锁的 TTL 换算为 etcd 租约的秒数，不足一秒的部分向上取整，
+// 避免亚秒级 TTL 被截断为 0 而退化为会话的默认 TTL
+func leaseSeconds(ttl time.Duration) int {
+	return int((ttl + time.Second - 1) / time.Second)
+}
+
 // Acquire 获取一个新锁，阻塞直到锁被获取或 context 被取消
 func (f *EtcdLockFactory) Acquire(ctx context.Context, key string, ttl time.Duration) (lock.Lock, error) {
 	return f.acquire(ctx, key, ttl, true)
@@ -54,7 +65,7 @@ func (f *EtcdLockFactory) acquire(ctx context.Context, key string, ttl time.Dura
 	}
 
 	// 创建会话，包含租约并自动续约。锁释放时关闭会话。
-	session, err := concurrency.NewSession(f.client.Client(), concurrency.WithTTL(int(ttl.Seconds())))
+	session, err := concurrency.NewSession(f.client.Client(), concurrency.WithTTL(leaseSeconds(ttl)))
 	if err != nil {
 		return nil, client.NewError(client.ErrCodeConnection, "failed to create etcd session", err)
 	}
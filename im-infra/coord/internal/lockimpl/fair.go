@@ -0,0 +1,281 @@
+package lockimpl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/ceyewan/gochat/im-infra/coord/internal/client"
+	"github.com/ceyewan/gochat/im-infra/coord/lock"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+// AcquireFair 按先到先得的顺序排队获取锁。
+// 排队 key 与 Acquire 使用的 concurrency.Mutex 格式相同（{lockKey}/{leaseID}），按创建版本号排序，
+// 因此公平锁与普通锁共用同一个队列；排队期间监听队列中 key 的删除事件来报告位置变化。
+func (f *EtcdLockFactory) AcquireFair(ctx context.Context, key string, ttl time.Duration, opts ...lock.FairOption) (lock.Lock, error) {
+	var options lock.FairOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.Updates != nil {
+		defer close(options.Updates)
+	}
+
+	if key == "" {
+		return nil, client.NewError(client.ErrCodeValidation, "lock key cannot be empty", nil)
+	}
+	if ttl <= 0 {
+		return nil, client.NewError(client.ErrCodeValidation, "lock ttl must be positive", nil)
+	}
+	if options.MaxQueueDepth < 0 || options.Timeout < 0 {
+		return nil, client.NewError(client.ErrCodeValidation, "max queue depth and wait timeout cannot be negative", nil)
+	}
+
+	cli := f.client.Client()
+	lockKey := path.Join(f.prefix, key)
+	queuePrefix := lockKey + "/"
+
+	// 队列已满时直接拒绝，不创建会话
+	if options.MaxQueueDepth > 0 {
+		resp, err := cli.Get(ctx, queuePrefix, clientv3.WithPrefix(), clientv3.WithCountOnly())
+		if err != nil {
+			return nil, client.NewError(client.ErrCodeConnection, "failed to inspect lock queue", err)
+		}
+		if waiters := resp.Count - 1; waiters >= int64(options.MaxQueueDepth) {
+			return nil, client.NewError(client.ErrCodeConflict,
+				fmt.Sprintf("lock queue is full: %d waiters, max %d", waiters, options.MaxQueueDepth), nil)
+		}
+	}
+
+	session, err := concurrency.NewSession(cli, concurrency.WithTTL(leaseSeconds(ttl)))
+	if err != nil {
+		return nil, client.NewError(client.ErrCodeConnection, "failed to create etcd session", err)
+	}
+
+	waitCtx := ctx
+	if options.Timeout > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, options.Timeout)
+		defer cancel()
+	}
+
+	// 先写入排队 key 确定排队顺序，mutex.Lock 会沿用同一租约下已存在的 key
+	myKey := fmt.Sprintf("%s%x", queuePrefix, session.Lease())
+	_, err = cli.Txn(waitCtx).
+		If(clientv3.Compare(clientv3.CreateRevision(myKey), "=", 0)).
+		Then(clientv3.OpPut(myKey, "", clientv3.WithLease(session.Lease()))).
+		Commit()
+	if err != nil {
+		_ = session.Close()
+		return nil, client.NewError(client.ErrCodeConnection, "failed to join lock queue", err)
+	}
+
+	start := time.Now()
+	f.logger.Debug("加入锁队列",
+		clog.String("key", lockKey),
+		clog.Int64("lease", int64(session.Lease())))
+
+	// 报告协程必须在关闭 Updates 之前退出
+	var reporter sync.WaitGroup
+	reportCtx, stopReport := context.WithCancel(waitCtx)
+	if options.Updates != nil {
+		reporter.Add(1)
+		go func() {
+			defer reporter.Done()
+			f.reportQueue(reportCtx, lockKey, myKey, start, options.Updates)
+		}()
+	}
+
+	mutex := concurrency.NewMutex(session, lockKey)
+	lockErr := mutex.Lock(waitCtx)
+	stopReport()
+	reporter.Wait()
+
+	if lockErr != nil {
+		// 关闭会话撤销租约，同时将排队 key 移出队列
+		_ = session.Close()
+		if ctx.Err() == nil && errors.Is(waitCtx.Err(), context.DeadlineExceeded) {
+			return nil, client.NewError(client.ErrCodeTimeout,
+				fmt.Sprintf("timed out after %s waiting in lock queue", options.Timeout), lockErr)
+		}
+		return nil, client.NewError(client.ErrCodeConnection, "failed to acquire lock", lockErr)
+	}
+
+	if options.Updates != nil {
+		select {
+		case options.Updates <- lock.QueueStatus{Waited: time.Since(start)}:
+		default:
+		}
+	}
+
+	f.logger.Info("公平锁获取成功",
+		clog.String("key", lockKey),
+		clog.Int64("lease", int64(session.Lease())),
+		clog.Duration("waited", time.Since(start)))
+
+	return &etcdLock{
+		session: session,
+		mutex:   mutex,
+		client:  f.client,
+		logger:  f.logger,
+	}, nil
+}
+
+// reportQueue 每当队列中有 key 被删除时重新计算排队位置并发送给 updates，轮到自己或 ctx 结束时退出
+func (f *EtcdLockFactory) reportQueue(ctx context.Context, lockKey, myKey string, start time.Time, updates chan<- lock.QueueStatus) {
+	cli := f.client.Client()
+	queuePrefix := lockKey + "/"
+	stats := f.holdStats(lockKey)
+	lastPosition := -1
+
+	for {
+		resp, err := cli.Get(ctx, queuePrefix,
+			clientv3.WithPrefix(),
+			clientv3.WithKeysOnly(),
+			clientv3.WithSort(clientv3.SortByCreateRevision, clientv3.SortAscend))
+		if err != nil {
+			// ctx 结束或连接异常，获取锁的结果由 mutex.Lock 返回
+			return
+		}
+
+		position := -1
+		for i, kv := range resp.Kvs {
+			if string(kv.Key) == myKey {
+				position = i
+				break
+			}
+		}
+		if position < 0 {
+			return
+		}
+
+		now := time.Now()
+		stats.observeHead(string(resp.Kvs[0].Key), now)
+		// 轮到自己时由 AcquireFair 在获得锁后发送最终状态
+		if position == 0 {
+			return
+		}
+		if position != lastPosition {
+			lastPosition = position
+			status := lock.QueueStatus{
+				Position:      position,
+				QueueLength:   len(resp.Kvs),
+				EstimatedWait: stats.estimate(position, now),
+				Waited:        now.Sub(start),
+			}
+			select {
+			case updates <- status:
+			default:
+			}
+			f.logger.Debug("锁排队位置更新",
+				clog.String("key", lockKey),
+				clog.Int("position", status.Position),
+				clog.Int("queue_length", status.QueueLength),
+				clog.Duration("estimated_wait", status.EstimatedWait))
+		}
+
+		// 等待队列中有 key 被删除（锁释放或等待者退出）
+		watchCtx, cancel := context.WithCancel(ctx)
+		watch := cli.Watch(watchCtx, queuePrefix,
+			clientv3.WithPrefix(),
+			clientv3.WithRev(resp.Header.Revision+1),
+			clientv3.WithFilterPut())
+		select {
+		case <-ctx.Done():
+			cancel()
+			return
+		case wr, ok := <-watch:
+			cancel()
+			if !ok || wr.Err() != nil {
+				return
+			}
+		}
+	}
+}
+
+// maxHoldStats 最多保留持锁时长统计的锁数量，超过后淘汰最久未使用的统计，避免锁 key 很多时统计无限增长
+const maxHoldStats = 1024
+
+// holdStats 返回锁的持锁时长统计
+func (f *EtcdLockFactory) holdStats(lockKey string) *holdStats {
+	f.statsMu.Lock()
+	defer f.statsMu.Unlock()
+
+	now := time.Now()
+	stats, ok := f.stats[lockKey]
+	if !ok {
+		if len(f.stats) >= maxHoldStats {
+			f.evictHoldStats()
+		}
+		stats = &holdStats{}
+		f.stats[lockKey] = stats
+	}
+	stats.lastUsed = now
+	return stats
+}
+
+// evictHoldStats 淘汰最久未使用的持锁时长统计，调用方需持有 statsMu。
+// 被淘汰的统计若仍有排队者在使用，只是不再被后来者共享，下次使用时重新积累。
+func (f *EtcdLockFactory) evictHoldStats() {
+	var oldestKey string
+	var oldest time.Time
+	for key, stats := range f.stats {
+		if oldestKey == "" || stats.lastUsed.Before(oldest) {
+			oldestKey, oldest = key, stats.lastUsed
+		}
+	}
+	delete(f.stats, oldestKey)
+}
+
+// holdStats 通过观测队首（锁持有者）的变化估算平均持锁时长
+type holdStats struct {
+	lastUsed time.Time // 最近一次被排队者使用的时间，由 EtcdLockFactory.statsMu 保护
+
+	mu        sync.Mutex
+	head      string        // 最近观测到的锁持有者
+	headSince time.Time     // 观测到该持有者的时间
+	headKnown bool          // headSince 是否为持有者真正获得锁的时间，首次观测到的持有者获得锁的时间未知
+	average   time.Duration // 持锁时长的指数移动平均
+}
+
+// observeHead 记录当前的锁持有者，持有者变化时将上一个持有者的持锁时长计入平均值
+func (s *holdStats) observeHead(head string, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if head == s.head {
+		return
+	}
+	if s.headKnown {
+		held := now.Sub(s.headSince)
+		if s.average == 0 {
+			s.average = held
+		} else {
+			s.average += (held - s.average) / 5
+		}
+	}
+	s.headKnown = s.head != ""
+	s.head = head
+	s.headSince = now
+}
+
+// estimate 估算排在第 position 位时的剩余等待时间：当前持有者的剩余时间加上前面每个等待者的平均持锁时长
+func (s *holdStats) estimate(position int, now time.Time) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if position <= 0 || s.average == 0 {
+		return 0
+	}
+	remaining := s.average
+	if s.headKnown {
+		remaining = max(s.average-now.Sub(s.headSince), 0)
+	}
+	return remaining + time.Duration(position-1)*s.average
+}
@@ -0,0 +1,474 @@
+package queueimpl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/ceyewan/gochat/im-infra/coord/internal/client"
+	"github.com/ceyewan/gochat/im-infra/coord/queue"
+)
+
+const (
+	// queueRoot 任务队列的根路径，每个队列下有 tasks/{key} 保存任务、slots/{n} 保存带租约的认领
+	queueRoot = "/queues"
+	// claimRetries 认领时因并发冲突重新读取的最大次数
+	claimRetries = 5
+)
+
+// etcdTaskQueue 基于 etcd 的任务队列。
+// 认领通过事务创建 slots/{n}（n < MaxInFlight）并绑定认领者的租约实现：
+// slot 的数量限制了整个集群同时执行的任务数，租约过期后 slot 被 etcd 删除，任务自动回到队列
+type etcdTaskQueue struct {
+	client *clientv3.Client
+	name   string
+	config queue.Config
+	logger clog.Logger
+
+	tasksPrefix string
+	slotsPrefix string
+}
+
+var _ queue.TaskQueue = (*etcdTaskQueue)(nil)
+
+// NewEtcdTaskQueue 创建任务队列，cfg 中未设置的字段使用默认值
+func NewEtcdTaskQueue(c *clientv3.Client, name string, cfg queue.Config, logger clog.Logger) (queue.TaskQueue, error) {
+	if name == "" || strings.Contains(name, "/") {
+		return nil, client.NewError(client.ErrCodeValidation, "queue name must be non-empty and must not contain '/'", nil)
+	}
+	if cfg.MaxInFlight < 0 || cfg.MaxAttempts < 0 || cfg.RetryBackoff < 0 || cfg.ClaimTTL < 0 {
+		return nil, client.NewError(client.ErrCodeValidation, "queue config values cannot be negative", nil)
+	}
+	if cfg.MaxInFlight == 0 {
+		cfg.MaxInFlight = 1
+	}
+	if cfg.MaxAttempts == 0 {
+		cfg.MaxAttempts = 3
+	}
+	if cfg.RetryBackoff == 0 {
+		cfg.RetryBackoff = 10 * time.Second
+	}
+	if cfg.ClaimTTL == 0 {
+		cfg.ClaimTTL = 30 * time.Second
+	}
+	if cfg.ClaimTTL < time.Second {
+		return nil, client.NewError(client.ErrCodeValidation, "claim ttl must be at least 1s", nil)
+	}
+
+	base := path.Join(queueRoot, name)
+	return &etcdTaskQueue{
+		client:      c,
+		name:        name,
+		config:      cfg,
+		logger:      logger.With(clog.String("queue", name)),
+		tasksPrefix: base + "/tasks/",
+		slotsPrefix: base + "/slots/",
+	}, nil
+}
+
+// Enqueue 入队一个任务，key 已存在时返回 false
+func (q *etcdTaskQueue) Enqueue(ctx context.Context, key string, payload []byte, opts ...queue.EnqueueOption) (bool, error) {
+	if key == "" {
+		return false, client.NewError(client.ErrCodeValidation, "task key cannot be empty", nil)
+	}
+	var o queue.EnqueueOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = q.config.MaxAttempts
+	}
+
+	now := time.Now()
+	task := queue.Task{
+		Key:         key,
+		Payload:     payload,
+		State:       queue.StatePending,
+		MaxAttempts: o.MaxAttempts,
+		EnqueuedAt:  now,
+	}
+	if o.Delay > 0 {
+		task.NotBefore = now.Add(o.Delay)
+	}
+	data, err := json.Marshal(task)
+	if err != nil {
+		return false, client.NewError(client.ErrCodeValidation, "failed to encode task", err)
+	}
+
+	taskKey := q.tasksPrefix + key
+	resp, err := q.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(taskKey), "=", 0)).
+		Then(clientv3.OpPut(taskKey, string(data))).
+		Commit()
+	if err != nil {
+		return false, client.NewError(client.ErrCodeConnection, "failed to enqueue task", err)
+	}
+	if !resp.Succeeded {
+		q.logger.Debug("task already queued", clog.String("key", key))
+		return false, nil
+	}
+	q.logger.Info("task enqueued", clog.String("key", key), clog.Duration("delay", o.Delay))
+	return true, nil
+}
+
+// Claim 认领最早入队的可执行任务
+func (q *etcdTaskQueue) Claim(ctx context.Context, owner string) (queue.ClaimedTask, error) {
+	for i := 0; i < claimRetries; i++ {
+		claimed, err := q.tryClaim(ctx, owner)
+		if err != errRetryClaim {
+			return claimed, err
+		}
+	}
+	// 持续冲突说明有其他实例在同时认领，交给调用方稍后重试
+	return nil, queue.ErrNoTask
+}
+
+// errRetryClaim 表示认领事务因并发修改失败，需要重新读取
+var errRetryClaim = errors.New("claim conflict")
+
+// tryClaim 读取 slot 和任务，尝试认领第一个可执行的任务
+func (q *etcdTaskQueue) tryClaim(ctx context.Context, owner string) (queue.ClaimedTask, error) {
+	slots, err := q.slots(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(slots) >= q.config.MaxInFlight {
+		return nil, queue.ErrInFlightLimit
+	}
+	slot := 0
+	for _, ok := slots[slot]; ok; _, ok = slots[slot] {
+		slot++
+	}
+	claimedKeys := claimedSet(slots)
+
+	resp, err := q.client.Get(ctx, q.tasksPrefix, clientv3.WithPrefix(),
+		clientv3.WithSort(clientv3.SortByCreateRevision, clientv3.SortAscend))
+	if err != nil {
+		return nil, client.NewError(client.ErrCodeConnection, "failed to list tasks", err)
+	}
+
+	now := time.Now()
+	for _, kv := range resp.Kvs {
+		var task queue.Task
+		if err := json.Unmarshal(kv.Value, &task); err != nil {
+			q.logger.Warn("skipping undecodable task", clog.String("key", string(kv.Key)), clog.Err(err))
+			continue
+		}
+		if effectiveState(&task, claimedKeys) != queue.StatePending || now.Before(task.NotBefore) {
+			continue
+		}
+		return q.claim(ctx, owner, slot, task, kv.ModRevision)
+	}
+	return nil, queue.ErrNoTask
+}
+
+// claim 在一个事务中占用 slot 并更新任务，任务或 slot 已被并发修改时返回 errRetryClaim
+func (q *etcdTaskQueue) claim(ctx context.Context, owner string, slot int, task queue.Task, modRevision int64) (queue.ClaimedTask, error) {
+	lease, err := q.client.Grant(ctx, int64(q.config.ClaimTTL/time.Second))
+	if err != nil {
+		return nil, client.NewError(client.ErrCodeConnection, "failed to grant claim lease", err)
+	}
+
+	task.State = queue.StateClaimed
+	task.Attempts++
+	task.Owner = owner
+	task.ClaimedAt = time.Now()
+	data, err := json.Marshal(task)
+	if err != nil {
+		_, _ = q.client.Revoke(context.WithoutCancel(ctx), lease.ID)
+		return nil, client.NewError(client.ErrCodeValidation, "failed to encode task", err)
+	}
+
+	taskKey := q.tasksPrefix + task.Key
+	slotKey := q.slotsPrefix + strconv.Itoa(slot)
+	resp, err := q.client.Txn(ctx).
+		If(
+			clientv3.Compare(clientv3.CreateRevision(slotKey), "=", 0),
+			clientv3.Compare(clientv3.ModRevision(taskKey), "=", modRevision),
+		).
+		Then(
+			clientv3.OpPut(slotKey, task.Key, clientv3.WithLease(lease.ID)),
+			clientv3.OpPut(taskKey, string(data)),
+		).
+		Commit()
+	if err != nil || !resp.Succeeded {
+		_, _ = q.client.Revoke(context.WithoutCancel(ctx), lease.ID)
+		if err != nil {
+			return nil, client.NewError(client.ErrCodeConnection, "failed to claim task", err)
+		}
+		return nil, errRetryClaim
+	}
+
+	// 认领期间自动续约，Ack/Nack 时停止
+	keepCtx, cancel := context.WithCancel(context.Background())
+	keepAlive, err := q.client.KeepAlive(keepCtx, lease.ID)
+	if err != nil {
+		cancel()
+		q.logger.Warn("failed to keep claim lease alive", clog.String("key", task.Key), clog.Err(err))
+	} else {
+		go func() {
+			for range keepAlive {
+			}
+		}()
+	}
+
+	q.logger.Info("task claimed",
+		clog.String("key", task.Key),
+		clog.String("owner", owner),
+		clog.Int("attempt", task.Attempts))
+	return &claimedTask{
+		queue:    q,
+		task:     task,
+		slotKey:  slotKey,
+		lease:    lease.ID,
+		revision: resp.Header.Revision,
+		cancel:   cancel,
+	}, nil
+}
+
+// Get 返回任务的当前状态
+func (q *etcdTaskQueue) Get(ctx context.Context, key string) (*queue.Task, error) {
+	resp, err := q.client.Get(ctx, q.tasksPrefix+key)
+	if err != nil {
+		return nil, client.NewError(client.ErrCodeConnection, "failed to get task", err)
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, client.NewError(client.ErrCodeNotFound, "task not found", nil)
+	}
+	var task queue.Task
+	if err := json.Unmarshal(resp.Kvs[0].Value, &task); err != nil {
+		return nil, client.NewError(client.ErrCodeValidation, "failed to decode task", err)
+	}
+	slots, err := q.slots(ctx)
+	if err != nil {
+		return nil, err
+	}
+	task.State = effectiveState(&task, claimedSet(slots))
+	return &task, nil
+}
+
+// List 返回队列中的任务，按入队顺序排列
+func (q *etcdTaskQueue) List(ctx context.Context, state string) ([]queue.Task, error) {
+	slots, err := q.slots(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := q.client.Get(ctx, q.tasksPrefix, clientv3.WithPrefix(),
+		clientv3.WithSort(clientv3.SortByCreateRevision, clientv3.SortAscend))
+	if err != nil {
+		return nil, client.NewError(client.ErrCodeConnection, "failed to list tasks", err)
+	}
+
+	claimed := claimedSet(slots)
+	tasks := make([]queue.Task, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		var task queue.Task
+		if err := json.Unmarshal(kv.Value, &task); err != nil {
+			q.logger.Warn("skipping undecodable task", clog.String("key", string(kv.Key)), clog.Err(err))
+			continue
+		}
+		task.State = effectiveState(&task, claimed)
+		if state == "" || task.State == state {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks, nil
+}
+
+// Stats 返回各状态的任务数
+func (q *etcdTaskQueue) Stats(ctx context.Context) (queue.Stats, error) {
+	tasks, err := q.List(ctx, "")
+	if err != nil {
+		return queue.Stats{}, err
+	}
+	var stats queue.Stats
+	now := time.Now()
+	for _, task := range tasks {
+		switch task.State {
+		case queue.StatePending:
+			stats.Pending++
+			if now.Before(task.NotBefore) {
+				stats.Delayed++
+			}
+		case queue.StateClaimed:
+			stats.Claimed++
+		case queue.StateDead:
+			stats.Dead++
+		}
+	}
+	return stats, nil
+}
+
+// Delete 删除任务并释放其占用的 slot
+func (q *etcdTaskQueue) Delete(ctx context.Context, key string) error {
+	slots, err := q.slots(ctx)
+	if err != nil {
+		return err
+	}
+	ops := []clientv3.Op{clientv3.OpDelete(q.tasksPrefix + key)}
+	for slot, taskKey := range slots {
+		if taskKey == key {
+			ops = append(ops, clientv3.OpDelete(q.slotsPrefix+strconv.Itoa(slot)))
+		}
+	}
+	if _, err := q.client.Txn(ctx).Then(ops...).Commit(); err != nil {
+		return client.NewError(client.ErrCodeConnection, "failed to delete task", err)
+	}
+	q.logger.Info("task deleted", clog.String("key", key))
+	return nil
+}
+
+// slots 返回当前被占用的 slot 及其对应的任务键
+func (q *etcdTaskQueue) slots(ctx context.Context) (map[int]string, error) {
+	resp, err := q.client.Get(ctx, q.slotsPrefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, client.NewError(client.ErrCodeConnection, "failed to list claim slots", err)
+	}
+	slots := make(map[int]string, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		slot, err := strconv.Atoi(strings.TrimPrefix(string(kv.Key), q.slotsPrefix))
+		if err != nil {
+			continue
+		}
+		slots[slot] = string(kv.Value)
+	}
+	return slots, nil
+}
+
+// claimedSet 返回被认领的任务键集合
+func claimedSet(slots map[int]string) map[string]bool {
+	claimed := make(map[string]bool, len(slots))
+	for _, key := range slots {
+		claimed[key] = true
+	}
+	return claimed
+}
+
+// effectiveState 计算任务的实际状态：存储的 claimed 状态只有在 slot 仍然存在时才有效，
+// 认领者的租约过期后任务回到 pending，认领次数已耗尽时为 dead
+func effectiveState(task *queue.Task, claimed map[string]bool) string {
+	switch {
+	case claimed[task.Key]:
+		return queue.StateClaimed
+	case task.State == queue.StateDead:
+		return queue.StateDead
+	case task.State == queue.StateClaimed && task.Attempts >= task.MaxAttempts:
+		return queue.StateDead
+	default:
+		return queue.StatePending
+	}
+}
+
+// claimedTask 是一个已认领的任务
+type claimedTask struct {
+	queue   *etcdTaskQueue
+	task    queue.Task
+	slotKey string
+	lease   clientv3.LeaseID
+	// revision 认领事务提交后的版本，即任务记录的 ModRevision
+	revision int64
+	cancel   context.CancelFunc
+
+	once sync.Once
+}
+
+var _ queue.ClaimedTask = (*claimedTask)(nil)
+
+// Task 返回认领时的任务快照
+func (t *claimedTask) Task() queue.Task {
+	return t.task
+}
+
+// Ack 确认任务完成并删除任务
+func (t *claimedTask) Ack(ctx context.Context) error {
+	defer t.release(ctx)
+	taskKey := t.queue.tasksPrefix + t.task.Key
+	resp, err := t.queue.client.Txn(ctx).
+		If(t.owned(taskKey)...).
+		Then(clientv3.OpDelete(taskKey), clientv3.OpDelete(t.slotKey)).
+		Commit()
+	if err != nil {
+		return client.NewError(client.ErrCodeConnection, "failed to ack task", err)
+	}
+	if !resp.Succeeded {
+		return queue.ErrClaimLost
+	}
+	t.queue.logger.Info("task acked", clog.String("key", t.task.Key), clog.Int("attempt", t.task.Attempts))
+	return nil
+}
+
+// Nack 放弃任务，等待 retryAfter 后重试，认领次数耗尽时进入 dead 状态
+func (t *claimedTask) Nack(ctx context.Context, reason error, retryAfter time.Duration) error {
+	defer t.release(ctx)
+	if retryAfter <= 0 {
+		retryAfter = t.queue.config.RetryBackoff
+	}
+
+	task := t.task
+	task.State = queue.StatePending
+	task.NotBefore = time.Now().Add(retryAfter)
+	if reason != nil {
+		task.LastError = reason.Error()
+	}
+	if task.Attempts >= task.MaxAttempts {
+		task.State = queue.StateDead
+		task.NotBefore = time.Time{}
+	}
+	data, err := json.Marshal(task)
+	if err != nil {
+		return client.NewError(client.ErrCodeValidation, "failed to encode task", err)
+	}
+
+	taskKey := t.queue.tasksPrefix + task.Key
+	resp, err := t.queue.client.Txn(ctx).
+		If(t.owned(taskKey)...).
+		Then(clientv3.OpPut(taskKey, string(data)), clientv3.OpDelete(t.slotKey)).
+		Commit()
+	if err != nil {
+		return client.NewError(client.ErrCodeConnection, "failed to nack task", err)
+	}
+	if !resp.Succeeded {
+		return queue.ErrClaimLost
+	}
+
+	if task.State == queue.StateDead {
+		t.queue.logger.Warn("task attempts exhausted",
+			clog.String("key", task.Key),
+			clog.Int("attempts", task.Attempts),
+			clog.String("last_error", task.LastError))
+	} else {
+		t.queue.logger.Info("task nacked",
+			clog.String("key", task.Key),
+			clog.Int("attempt", task.Attempts),
+			clog.Duration("retry_after", retryAfter))
+	}
+	return nil
+}
+
+// owned 返回确认认领仍然有效的事务条件：slot 仍绑定本次认领的租约，且任务记录未被修改或删除
+func (t *claimedTask) owned(taskKey string) []clientv3.Cmp {
+	return []clientv3.Cmp{
+		clientv3.Compare(clientv3.LeaseValue(t.slotKey), "=", t.lease),
+		clientv3.Compare(clientv3.ModRevision(taskKey), "=", t.revision),
+	}
+}
+
+// release 停止续约并撤销租约
+func (t *claimedTask) release(ctx context.Context) {
+	t.once.Do(func() {
+		if t.cancel != nil {
+			t.cancel()
+		}
+		if _, err := t.queue.client.Revoke(context.WithoutCancel(ctx), t.lease); err != nil {
+			t.queue.logger.Debug("failed to revoke claim lease", clog.String("key", t.task.Key), clog.Err(err))
+		}
+	})
+}
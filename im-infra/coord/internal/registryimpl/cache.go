@@ -0,0 +1,424 @@
+package registryimpl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/ceyewan/gochat/im-infra/coord/internal/client"
+	"github.com/ceyewan/gochat/im-infra/coord/registry"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// CacheConfig 本地注册表缓存的运行参数
+type CacheConfig struct {
+	// SnapshotPath 快照文件路径，为空表示不持久化
+	SnapshotPath string
+	// SnapshotInterval 缓存有变更时写快照的周期，默认 30 秒
+	SnapshotInterval time.Duration
+	// ProbeInterval 通过 watch 向 etcd 请求进度通知的周期，超过 3 个周期没有收到 watch 响应即认为缓存失去同步，默认 5 秒
+	ProbeInterval time.Duration
+	// QueryTimeout 缓存失去同步时直接查询 etcd 的超时时间，超时后回退到缓存，默认 3 秒
+	QueryTimeout time.Duration
+	// MaxStaleness 失去同步的缓存最多可以使用多久，0 表示不限制
+	MaxStaleness time.Duration
+}
+
+// registrySnapshot 写入磁盘的缓存快照
+type registrySnapshot struct {
+	Revision int64                  `json:"revision"`
+	LastSync time.Time              `json:"lastSync"`
+	Services []registry.ServiceInfo `json:"services"`
+}
+
+// CachedRegistry 通过 watch 在内存中维护全部服务实例，并定期将快照写入磁盘：
+//   - 缓存与 etcd 保持同步时，Discover 直接从内存返回，不访问 etcd
+//   - 失去同步时（etcd 不可达、watch 中断），Discover 先在 QueryTimeout 内查询 etcd，
+//     连接失败则返回缓存中的旧数据，并通过 registry.WithCacheStatus 标记为 stale
+//   - 创建时先从快照恢复，首次同步完成前 etcd 就变得不可达也能发现服务
+//
+// 其余方法直接委托给被包装的注册表。
+type CachedRegistry struct {
+	registry.ServiceRegistry
+	primary *EtcdServiceRegistry
+	cfg     CacheConfig
+	logger  clog.Logger
+
+	mu       sync.RWMutex
+	services map[string]map[string]registry.ServiceInfo // 服务名 -> 实例 ID -> 实例
+	loaded   bool                                       // 已从 etcd 或快照加载过数据
+	synced   bool                                       // watch 正在运行且与 etcd 一致
+	revision int64
+	lastSync time.Time
+	dirty    bool // 上次写快照后有变更
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewCachedRegistry 包装 inner，primary 提供 etcd 连接、键前缀和本地数据中心
+func NewCachedRegistry(inner registry.ServiceRegistry, primary *EtcdServiceRegistry, cfg CacheConfig, logger clog.Logger) (*CachedRegistry, error) {
+	if cfg.SnapshotInterval < 0 || cfg.ProbeInterval < 0 || cfg.QueryTimeout < 0 || cfg.MaxStaleness < 0 {
+		return nil, client.NewError(client.ErrCodeValidation, "registry cache intervals cannot be negative", nil)
+	}
+	if cfg.SnapshotInterval == 0 {
+		cfg.SnapshotInterval = 30 * time.Second
+	}
+	if cfg.ProbeInterval == 0 {
+		cfg.ProbeInterval = 5 * time.Second
+	}
+	if cfg.QueryTimeout == 0 {
+		cfg.QueryTimeout = 3 * time.Second
+	}
+	if logger == nil {
+		logger = clog.Namespace("coordination.registry.cache")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &CachedRegistry{
+		ServiceRegistry: inner,
+		primary:         primary,
+		cfg:             cfg,
+		logger:          logger,
+		services:        make(map[string]map[string]registry.ServiceInfo),
+		cancel:          cancel,
+		done:            make(chan struct{}),
+	}
+	if cfg.SnapshotPath != "" {
+		if err := c.loadSnapshot(); err != nil && !errors.Is(err, os.ErrNotExist) {
+			logger.Warn("加载注册表快照失败", clog.String("path", cfg.SnapshotPath), clog.Err(err))
+		}
+	}
+
+	go c.run(ctx)
+	return c, nil
+}
+
+// Discover 缓存同步时直接从缓存返回；失去同步时查询 etcd，etcd 不可达则回退到缓存
+func (c *CachedRegistry) Discover(ctx context.Context, serviceName string, opts ...registry.DiscoverOption) ([]registry.ServiceInfo, error) {
+	var options registry.DiscoverOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if serviceName == "" {
+		return nil, client.NewError(client.ErrCodeValidation, "服务名不能为空", nil)
+	}
+
+	if services, status, ok := c.lookup(serviceName, options); ok && !status.Stale {
+		reportCacheStatus(options, status)
+		return services, nil
+	}
+
+	queryCtx, cancel := context.WithTimeout(ctx, c.cfg.QueryTimeout)
+	services, err := c.ServiceRegistry.Discover(queryCtx, serviceName, opts...)
+	cancel()
+	if err == nil {
+		reportCacheStatus(options, registry.CacheStatus{})
+		return services, nil
+	}
+	// 调用方自己的 ctx 已结束时不回退
+	if ctx.Err() != nil || (!isConnectionError(err) && !errors.Is(err, context.DeadlineExceeded)) {
+		return nil, err
+	}
+
+	cached, status, ok := c.lookup(serviceName, options)
+	if !ok {
+		return nil, err
+	}
+	if c.cfg.MaxStaleness > 0 && status.Staleness() > c.cfg.MaxStaleness {
+		c.logger.Error("etcd 不可达且注册表缓存已超过最大可用时间",
+			clog.String("service_name", serviceName),
+			clog.Duration("staleness", status.Staleness()),
+			clog.Err(err))
+		return nil, err
+	}
+
+	c.logger.Warn("etcd 不可达，使用本地注册表缓存",
+		clog.String("service_name", serviceName),
+		clog.Duration("staleness", status.Staleness()),
+		clog.Int("instances", len(cached)),
+		clog.Err(err))
+	reportCacheStatus(options, status)
+	return cached, nil
+}
+
+// Close 停止 watch，并在配置了快照路径时写入最后一次快照
+func (c *CachedRegistry) Close() error {
+	c.cancel()
+	<-c.done
+	if c.cfg.SnapshotPath == "" {
+		return nil
+	}
+	return c.saveSnapshot()
+}
+
+// lookup 从缓存读取服务的健康实例，缓存从未加载过数据时 ok 为 false
+func (c *CachedRegistry) lookup(serviceName string, options registry.DiscoverOptions) ([]registry.ServiceInfo, registry.CacheStatus, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.loaded {
+		return nil, registry.CacheStatus{}, false
+	}
+
+	instances := c.services[serviceName]
+	services := make([]registry.ServiceInfo, 0, len(instances))
+	for _, service := range instances {
+		if service.Healthy() {
+			services = append(services, service)
+		}
+	}
+	if options.PreferLocalDC {
+		services = c.primary.preferLocalDC(serviceName, services)
+	}
+
+	status := registry.CacheStatus{
+		FromCache: true,
+		Stale:     !c.synced || time.Since(c.lastSync) > 3*c.cfg.ProbeInterval,
+		LastSync:  c.lastSync,
+		Revision:  c.revision,
+	}
+	return services, status, true
+}
+
+// run 循环执行全量加载和 watch，watch 中断后重新加载；同时按周期写快照
+func (c *CachedRegistry) run(ctx context.Context) {
+	defer close(c.done)
+
+	if c.cfg.SnapshotPath != "" {
+		go c.snapshotLoop(ctx)
+	}
+
+	backoff := time.Second
+	for {
+		err := c.sync(ctx)
+
+		c.mu.Lock()
+		c.synced = false
+		c.mu.Unlock()
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			c.logger.Warn("注册表缓存同步中断，稍后重试", clog.Duration("backoff", backoff), clog.Err(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if err == nil {
+			backoff = time.Second
+		} else {
+			backoff = min(backoff*2, 30*time.Second)
+		}
+	}
+}
+
+// sync 全量加载所有服务，然后从加载时的 revision 开始 watch，直到 watch 中断
+func (c *CachedRegistry) sync(ctx context.Context) error {
+	prefix := c.primary.prefix + "/"
+
+	loadCtx, cancel := context.WithTimeout(ctx, c.cfg.QueryTimeout)
+	resp, err := c.primary.client.Client().Get(loadCtx, prefix, clientv3.WithPrefix())
+	cancel()
+	if err != nil {
+		return err
+	}
+
+	services := make(map[string]map[string]registry.ServiceInfo)
+	for _, kv := range resp.Kvs {
+		var service registry.ServiceInfo
+		if err := json.Unmarshal(kv.Value, &service); err != nil {
+			continue
+		}
+		putService(services, service)
+	}
+	c.mu.Lock()
+	c.services = services
+	c.loaded = true
+	c.synced = true
+	c.revision = resp.Header.Revision
+	c.lastSync = time.Now()
+	c.dirty = true
+	c.mu.Unlock()
+	c.logger.Info("注册表缓存已同步", clog.Int64("revision", resp.Header.Revision), clog.Int("services", len(services)))
+
+	// WithRequireLeader 使 watch 在 etcd 成员失去 leader 时立即中断，而不是静默挂起
+	watchCtx, cancelWatch := context.WithCancel(clientv3.WithRequireLeader(ctx))
+	defer cancelWatch()
+	watchCh := c.primary.client.Watch(watchCtx, prefix,
+		clientv3.WithPrefix(), clientv3.WithRev(resp.Header.Revision+1), clientv3.WithProgressNotify())
+	go c.probeLoop(watchCtx)
+
+	for wresp := range watchCh {
+		if err := wresp.Err(); err != nil {
+			return err
+		}
+		c.mu.Lock()
+		for _, event := range wresp.Events {
+			if serviceEvent := c.primary.convertEvent(event); serviceEvent != nil {
+				c.apply(*serviceEvent)
+			}
+		}
+		if wresp.Header.Revision > c.revision {
+			c.revision = wresp.Header.Revision
+		}
+		c.synced = true
+		c.lastSync = time.Now()
+		c.mu.Unlock()
+	}
+	return ctx.Err()
+}
+
+// probeLoop 定期请求进度通知，etcd 可达时 watch 即使没有变更也会收到响应，用于判断缓存是否仍然同步
+func (c *CachedRegistry) probeLoop(ctx context.Context) {
+	ticker := time.NewTicker(c.cfg.ProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			probeCtx, cancel := context.WithTimeout(ctx, c.cfg.ProbeInterval)
+			_ = c.primary.client.Client().RequestProgress(probeCtx)
+			cancel()
+		}
+	}
+}
+
+// apply 将 watch 事件应用到缓存。调用方需持有写锁
+func (c *CachedRegistry) apply(event registry.ServiceEvent) {
+	switch event.Type {
+	case registry.EventTypePut:
+		putService(c.services, event.Service)
+	case registry.EventTypeDelete:
+		if instances, ok := c.services[event.Service.Name]; ok {
+			delete(instances, event.Service.ID)
+			if len(instances) == 0 {
+				delete(c.services, event.Service.Name)
+			}
+		}
+	}
+	c.dirty = true
+}
+
+// snapshotLoop 周期性地在缓存有变更时写快照
+func (c *CachedRegistry) snapshotLoop(ctx context.Context) {
+	ticker := time.NewTicker(c.cfg.SnapshotInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.saveSnapshot(); err != nil {
+				c.logger.Warn("写入注册表快照失败", clog.String("path", c.cfg.SnapshotPath), clog.Err(err))
+			}
+		}
+	}
+}
+
+// saveSnapshot 将缓存写入临时文件后原子地替换快照文件，缓存没有变更时跳过
+func (c *CachedRegistry) saveSnapshot() error {
+	c.mu.Lock()
+	if !c.dirty || !c.loaded {
+		c.mu.Unlock()
+		return nil
+	}
+	snapshot := registrySnapshot{Revision: c.revision, LastSync: c.lastSync}
+	for _, instances := range c.services {
+		for _, service := range instances {
+			snapshot.Services = append(snapshot.Services, service)
+		}
+	}
+	c.dirty = false
+	c.mu.Unlock()
+
+	data, err := json.Marshal(snapshot)
+	if err == nil {
+		err = writeFileAtomic(c.cfg.SnapshotPath, data)
+	}
+	if err != nil {
+		c.mu.Lock()
+		c.dirty = true
+		c.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// loadSnapshot 从快照恢复缓存，恢复后的缓存在与 etcd 同步前始终视为 stale
+func (c *CachedRegistry) loadSnapshot() error {
+	data, err := os.ReadFile(c.cfg.SnapshotPath)
+	if err != nil {
+		return err
+	}
+	var snapshot registrySnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, service := range snapshot.Services {
+		putService(c.services, service)
+	}
+	c.loaded = true
+	c.revision = snapshot.Revision
+	c.lastSync = snapshot.LastSync
+	c.logger.Info("已从快照恢复注册表缓存",
+		clog.String("path", c.cfg.SnapshotPath),
+		clog.Int64("revision", snapshot.Revision),
+		clog.Int("instances", len(snapshot.Services)))
+	return nil
+}
+
+// putService 将实例写入按服务名分组的映射
+func putService(services map[string]map[string]registry.ServiceInfo, service registry.ServiceInfo) {
+	if service.Name == "" || service.ID == "" {
+		return
+	}
+	instances, ok := services[service.Name]
+	if !ok {
+		instances = make(map[string]registry.ServiceInfo)
+		services[service.Name] = instances
+	}
+	instances[service.ID] = service
+}
+
+// reportCacheStatus 在调用方请求时写入结果的来源
+func reportCacheStatus(options registry.DiscoverOptions, status registry.CacheStatus) {
+	if options.CacheStatus != nil {
+		*options.CacheStatus = status
+	}
+}
+
+// writeFileAtomic 先写临时文件再重命名，避免进程崩溃留下不完整的快照
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -21,21 +21,49 @@ import (
 
 // EtcdServiceRegistry 使用 etcd 实现 registry.ServiceRegistry 接口
 type EtcdServiceRegistry struct {
-	client *client.EtcdClient // etcd 客户端
-	prefix string             // 服务注册前缀
-	logger clog.Logger        // 日志记录器
+	client  *client.EtcdClient // etcd 客户端
+	prefix  string             // 服务注册前缀
+	logger  clog.Logger        // 日志记录器
+	localDC string             // 本地数据中心，用于填充实例的 DC 标签和 PreferLocalDC
 
 	// 跟踪当前实例注册的服务会话
 	sessions   map[string]*concurrency.Session // 服务会话映射，便于注销
+	services   map[string]registry.ServiceInfo // 本实例注册的服务信息，便于更新
 	sessionsMu sync.Mutex                      // 会话互斥锁
 
 	// gRPC resolver builder（只注册一次）
 	resolverBuilder *EtcdResolverBuilder // gRPC 解析器构建器
 	resolverOnce    sync.Once            // 只注册一次
+	skipResolver    bool                 // 不注册 gRPC resolver，用于镜像注册表
+	requireEndpoint bool                 // 注册时要求实例声明完整的端点信息
+}
+
+// RegistryOption 配置 EtcdServiceRegistry
+type RegistryOption func(*EtcdServiceRegistry)
+
+// WithLocalDC 设置本地数据中心
+func WithLocalDC(dc string) RegistryOption {
+	return func(r *EtcdServiceRegistry) {
+		r.localDC = dc
+	}
+}
+
+// WithRequireEndpoint 要求注册的实例声明完整的端点信息（协议、版本、可用区和权重）
+func WithRequireEndpoint(require bool) RegistryOption {
+	return func(r *EtcdServiceRegistry) {
+		r.requireEndpoint = require
+	}
+}
+
+// withoutResolver 不注册 gRPC resolver，避免镜像注册表覆盖主注册表的 resolver
+func withoutResolver() RegistryOption {
+	return func(r *EtcdServiceRegistry) {
+		r.skipResolver = true
+	}
 }
 
 // NewEtcdServiceRegistry 创建一个基于 etcd 的服务注册表
-func NewEtcdServiceRegistry(c *client.EtcdClient, prefix string, logger clog.Logger) *EtcdServiceRegistry {
+func NewEtcdServiceRegistry(c *client.EtcdClient, prefix string, logger clog.Logger, opts ...RegistryOption) *EtcdServiceRegistry {
 	if prefix == "" {
 		prefix = "/services"
 	}
@@ -48,6 +76,13 @@ func NewEtcdServiceRegistry(c *client.EtcdClient, prefix string, logger clog.Log
 		prefix:   prefix,
 		logger:   logger,
 		sessions: make(map[string]*concurrency.Session),
+		services: make(map[string]registry.ServiceInfo),
+	}
+	for _, opt := range opts {
+		opt(registry)
+	}
+	if registry.skipResolver {
+		return registry
 	}
 
 	// 创建 resolver builder
@@ -67,9 +102,16 @@ func (r *EtcdServiceRegistry) Register(ctx context.Context, service registry.Ser
 	if err := validateServiceInfo(service); err != nil {
 		return err
 	}
+	if err := r.validateEndpoint(service); err != nil {
+		return err
+	}
+	service = service.NormalizeEndpoint()
 	if ttl <= 0 {
 		return client.NewError(client.ErrCodeValidation, "service TTL must be positive", nil)
 	}
+	if service.DC == "" {
+		service.DC = r.localDC
+	}
 
 	// 使用会话管理租约并自动续约
 	session, err := concurrency.NewSession(r.client.Client(), concurrency.WithTTL(int(ttl.Seconds())))
@@ -94,11 +136,13 @@ func (r *EtcdServiceRegistry) Register(ctx context.Context, service registry.Ser
 	r.logger.Info("Service registered successfully",
 		clog.String("service_name", service.Name),
 		clog.String("service_id", service.ID),
+		clog.String("dc", service.DC),
 		clog.Int64("lease_id", int64(session.Lease())))
 
 	// 存储会话以便清理注销
 	r.sessionsMu.Lock()
 	r.sessions[service.ID] = session
+	r.services[service.ID] = service
 	r.sessionsMu.Unlock()
 
 	// 会话的 keep-alive 在后台运行，可通过 Done 通道监控会话过期
@@ -107,7 +151,10 @@ func (r *EtcdServiceRegistry) Register(ctx context.Context, service registry.Ser
 		defer func() {
 			// 确保从 sessions map 中删除，防止内存泄漏
 			r.sessionsMu.Lock()
-			delete(r.sessions, service.ID)
+			if r.sessions[service.ID] == session {
+				delete(r.sessions, service.ID)
+				delete(r.services, service.ID)
+			}
 			r.sessionsMu.Unlock()
 		}()
 
@@ -134,6 +181,7 @@ func (r *EtcdServiceRegistry) Unregister(ctx context.Context, serviceID string)
 	session, ok := r.sessions[serviceID]
 	if ok {
 		delete(r.sessions, serviceID) // 先从 map 中删除，避免重复操作
+		delete(r.services, serviceID)
 	}
 	r.sessionsMu.Unlock()
 
@@ -164,8 +212,83 @@ func (r *EtcdServiceRegistry) Unregister(ctx context.Context, serviceID string)
 	return nil
 }
 
-// Discover 查询指定服务的所有实例
-func (r *EtcdServiceRegistry) Discover(ctx context.Context, serviceName string) ([]registry.ServiceInfo, error) {
+// UpdateMetadata 更新本实例注册的服务记录，沿用原有租约重新写入
+func (r *EtcdServiceRegistry) UpdateMetadata(ctx context.Context, serviceID string, update registry.InstanceUpdate) error {
+	if serviceID == "" {
+		return client.NewError(client.ErrCodeValidation, "service ID cannot be empty", nil)
+	}
+	if update.Weight != nil && *update.Weight < 0 {
+		return client.NewError(client.ErrCodeValidation, "service weight cannot be negative", nil)
+	}
+	if update.Capacity != nil && (update.Capacity.CPU < 0 || update.Capacity.CPU > 1) {
+		return client.NewError(client.ErrCodeValidation, "service CPU usage must be between 0 and 1", nil)
+	}
+
+	// 持有锁完成读-改-写，避免并发更新相互覆盖
+	r.sessionsMu.Lock()
+	defer r.sessionsMu.Unlock()
+
+	session, ok := r.sessions[serviceID]
+	if !ok {
+		return client.NewError(client.ErrCodeNotFound, "service not registered by this instance", nil)
+	}
+	service := r.services[serviceID]
+
+	if update.Weight != nil {
+		service.Weight = *update.Weight
+	}
+	if update.Capacity != nil {
+		capacity := *update.Capacity
+		service.Capacity = &capacity
+	}
+	if len(update.Metadata) > 0 {
+		metadata := make(map[string]string, len(service.Metadata)+len(update.Metadata))
+		for k, v := range service.Metadata {
+			metadata[k] = v
+		}
+		for k, v := range update.Metadata {
+			if v == "" {
+				delete(metadata, k)
+			} else {
+				metadata[k] = v
+			}
+		}
+		service.Metadata = metadata
+	}
+
+	serviceKey := r.buildServiceKey(service.Name, service.ID)
+
+	// 保留健康检查器写入的健康状态，避免元数据更新使已摘除的实例重新接收流量
+	if resp, err := r.client.Get(ctx, serviceKey); err == nil && len(resp.Kvs) > 0 {
+		var current registry.ServiceInfo
+		if json.Unmarshal(resp.Kvs[0].Value, &current) == nil {
+			service.Health = current.Health
+		}
+	}
+
+	serviceData, err := json.Marshal(service)
+	if err != nil {
+		return client.NewError(client.ErrCodeValidation, "failed to serialize service info", err)
+	}
+	if _, err := r.client.Put(ctx, serviceKey, string(serviceData), clientv3.WithLease(session.Lease())); err != nil {
+		return client.NewError(client.ErrCodeConnection, "failed to update service", err)
+	}
+	r.services[serviceID] = service
+
+	r.logger.Debug("Service metadata updated",
+		clog.String("service_name", service.Name),
+		clog.String("service_id", service.ID),
+		clog.Int("effective_weight", service.EffectiveWeight()))
+	return nil
+}
+
+// Discover 查询指定服务的所有可用实例，被健康检查器标记为 critical 的实例不会返回
+func (r *EtcdServiceRegistry) Discover(ctx context.Context, serviceName string, opts ...registry.DiscoverOption) ([]registry.ServiceInfo, error) {
+	var options registry.DiscoverOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
 	if serviceName == "" {
 		return nil, client.NewError(client.ErrCodeValidation, "服务名不能为空", nil)
 	}
@@ -185,12 +308,41 @@ func (r *EtcdServiceRegistry) Discover(ctx context.Context, serviceName string)
 				clog.Err(err))
 			continue
 		}
+		if !service.Healthy() {
+			continue
+		}
 		services = append(services, service)
 	}
 
+	if options.PreferLocalDC {
+		return r.preferLocalDC(serviceName, services), nil
+	}
 	return services, nil
 }
 
+// preferLocalDC 从健康实例中选出本地数据中心的实例，本地没有健康实例时返回全部远程实例
+func (r *EtcdServiceRegistry) preferLocalDC(serviceName string, services []registry.ServiceInfo) []registry.ServiceInfo {
+	if r.localDC == "" {
+		return services
+	}
+
+	local := make([]registry.ServiceInfo, 0, len(services))
+	for _, service := range services {
+		if service.DC == "" || service.DC == r.localDC {
+			local = append(local, service)
+		}
+	}
+	if len(local) > 0 || len(services) == 0 {
+		return local
+	}
+
+	r.logger.Warn("本地数据中心没有健康实例，回退到远程数据中心",
+		clog.String("service_name", serviceName),
+		clog.String("local_dc", r.localDC),
+		clog.Int("remote_instances", len(services)))
+	return services
+}
+
 // Watch 监听服务变更事件
 func (r *EtcdServiceRegistry) Watch(ctx context.Context, serviceName string) (<-chan registry.ServiceEvent, error) {
 	if serviceName == "" {
@@ -296,6 +448,35 @@ func validateServiceInfo(service registry.ServiceInfo) error {
 	return nil
 }
 
+// validateEndpoint 校验实例的端点信息：声明了 Endpoint 或要求端点信息时按当前 schema 校验，
+// 未开启要求时，仅通过 v1 Metadata 键描述端点的旧实例不做校验
+func (r *EtcdServiceRegistry) validateEndpoint(service registry.ServiceInfo) error {
+	if service.Endpoint == nil && !r.requireEndpoint {
+		return nil
+	}
+	if err := service.ValidateEndpoint(); err != nil {
+		return client.NewError(client.ErrCodeValidation, "服务端点信息不合法", err)
+	}
+	return nil
+}
+
+// DeprioritizeInstance 在本进程的 gRPC 负载均衡中临时降低实例的优先级，ttl <= 0 表示直到 RestoreInstance 为止
+func (r *EtcdServiceRegistry) DeprioritizeInstance(serviceName, address string, ttl time.Duration) {
+	instanceDemotions.demote(serviceName, address, ttl)
+	r.logger.Info("实例已在本地负载均衡中降级",
+		clog.String("service_name", serviceName),
+		clog.String("address", address),
+		clog.Duration("ttl", ttl))
+}
+
+// RestoreInstance 取消实例的降级
+func (r *EtcdServiceRegistry) RestoreInstance(serviceName, address string) {
+	instanceDemotions.restore(serviceName, address)
+	r.logger.Info("实例已在本地负载均衡中恢复",
+		clog.String("service_name", serviceName),
+		clog.String("address", address))
+}
+
 // GetConnection 获取到指定服务的 gRPC 连接，支持动态服务发现和负载均衡
 func (r *EtcdServiceRegistry) GetConnection(ctx context.Context, serviceName string) (*grpc.ClientConn, error) {
 	if serviceName == "" {
@@ -309,7 +490,10 @@ func (r *EtcdServiceRegistry) GetConnection(ctx context.Context, serviceName str
 	// 创建 gRPC 连接，使用 etcd resolver 进行动态服务发现
 	conn, err := grpc.NewClient(target,
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithDefaultServiceConfig(`{"loadBalancingPolicy":"round_robin"}`), // 使用轮询负载均衡
+		grpc.WithDefaultServiceConfig(fmt.Sprintf(`{"loadBalancingPolicy":"%s"}`, WeightedBalancerName)), // 按实例权重进行负载均衡
+		// 将负载均衡选中的实例写入调用方的 span，请求元数据由 picker 直接写入
+		grpc.WithChainUnaryInterceptor(registry.UnaryClientInterceptor()),
+		grpc.WithChainStreamInterceptor(registry.StreamClientInterceptor()),
 	)
 	if err != nil {
 		return nil, client.NewError(client.ErrCodeConnection, "连接服务失败", err)
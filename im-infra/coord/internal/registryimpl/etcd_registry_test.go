@@ -0,0 +1,33 @@
+package registryimpl
+
+import (
+	"testing"
+
+	"github.com/ceyewan/gochat/im-infra/coord/internal/client"
+	"github.com/ceyewan/gochat/im-infra/coord/registry"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateEndpointOnRegister(t *testing.T) {
+	legacy := registry.ServiceInfo{Metadata: map[string]string{registry.MetadataKeyProtocol: registry.ProtocolGRPC}}
+	typed := registry.ServiceInfo{Endpoint: &registry.Endpoint{Protocol: registry.ProtocolGRPC}}
+	complete := registry.ServiceInfo{
+		Weight:   100,
+		Endpoint: &registry.Endpoint{Protocol: registry.ProtocolGRPC, Version: "1.4.2", Zone: "sh-a"},
+	}
+
+	// 未要求端点信息时，只校验声明了 Endpoint 的实例
+	lenient := &EtcdServiceRegistry{}
+	assert.NoError(t, lenient.validateEndpoint(legacy))
+	assert.NoError(t, lenient.validateEndpoint(complete))
+	err := lenient.validateEndpoint(typed)
+	var coordErr *client.Error
+	if assert.ErrorAs(t, err, &coordErr) {
+		assert.Equal(t, client.ErrCodeValidation, coordErr.Code)
+	}
+
+	strict := &EtcdServiceRegistry{}
+	WithRequireEndpoint(true)(strict)
+	assert.Error(t, strict.validateEndpoint(legacy))
+	assert.NoError(t, strict.validateEndpoint(complete))
+}
@@ -0,0 +1,97 @@
+package registryimpl
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/ceyewan/gochat/im-infra/coord/internal/client"
+	"github.com/ceyewan/gochat/im-infra/coord/registry"
+)
+
+// FederatedRegistry 将注册同时镜像到主集群和灾备集群，用于跨地域容灾：
+//   - Register/Unregister/UpdateMetadata 先写主集群，再写镜像集群，镜像失败只记录日志，不影响主流程
+//   - Discover 读取主集群，主集群不可用时回退到镜像集群
+//   - Watch、GetConnection、RunHealthChecker 只作用于主集群
+type FederatedRegistry struct {
+	*EtcdServiceRegistry
+	mirror *EtcdServiceRegistry
+	logger clog.Logger
+}
+
+// NewFederatedRegistry 创建一个在 primary 和 mirrorClient 所在集群之间镜像注册的注册表
+func NewFederatedRegistry(primary *EtcdServiceRegistry, mirrorClient *client.EtcdClient, logger clog.Logger) *FederatedRegistry {
+	if logger == nil {
+		logger = clog.Namespace("coordination.registry.federation")
+	}
+
+	return &FederatedRegistry{
+		EtcdServiceRegistry: primary,
+		mirror: NewEtcdServiceRegistry(mirrorClient, primary.prefix, logger.With(clog.String("cluster", "mirror")),
+			WithLocalDC(primary.localDC), withoutResolver()),
+		logger: logger,
+	}
+}
+
+// Register 在主集群注册服务，并镜像到灾备集群
+func (f *FederatedRegistry) Register(ctx context.Context, service registry.ServiceInfo, ttl time.Duration) error {
+	if err := f.EtcdServiceRegistry.Register(ctx, service, ttl); err != nil {
+		return err
+	}
+	if err := f.mirror.Register(ctx, service, ttl); err != nil {
+		f.logger.Error("镜像注册服务失败",
+			clog.String("service_name", service.Name),
+			clog.String("service_id", service.ID),
+			clog.Err(err))
+	}
+	return nil
+}
+
+// Unregister 同时从主集群和灾备集群注销服务
+func (f *FederatedRegistry) Unregister(ctx context.Context, serviceID string) error {
+	if err := f.EtcdServiceRegistry.Unregister(ctx, serviceID); err != nil {
+		return err
+	}
+	if err := f.mirror.Unregister(ctx, serviceID); err != nil && !isNotFound(err) {
+		f.logger.Error("镜像注销服务失败", clog.String("service_id", serviceID), clog.Err(err))
+	}
+	return nil
+}
+
+// UpdateMetadata 同时更新主集群和灾备集群中的实例记录
+func (f *FederatedRegistry) UpdateMetadata(ctx context.Context, serviceID string, update registry.InstanceUpdate) error {
+	if err := f.EtcdServiceRegistry.UpdateMetadata(ctx, serviceID, update); err != nil {
+		return err
+	}
+	if err := f.mirror.UpdateMetadata(ctx, serviceID, update); err != nil && !isNotFound(err) {
+		f.logger.Error("镜像更新服务失败", clog.String("service_id", serviceID), clog.Err(err))
+	}
+	return nil
+}
+
+// Discover 从主集群发现服务，主集群不可用时从灾备集群发现。
+// 健康检查器只写主集群，回退时灾备集群的实例不带健康状态，已失效的实例要等租约过期后才会消失。
+func (f *FederatedRegistry) Discover(ctx context.Context, serviceName string, opts ...registry.DiscoverOption) ([]registry.ServiceInfo, error) {
+	services, err := f.EtcdServiceRegistry.Discover(ctx, serviceName, opts...)
+	if err == nil || !isConnectionError(err) {
+		return services, err
+	}
+
+	f.logger.Warn("主集群不可用，从灾备集群发现服务",
+		clog.String("service_name", serviceName),
+		clog.Err(err))
+	return f.mirror.Discover(ctx, serviceName, opts...)
+}
+
+// isNotFound 判断错误是否为记录不存在
+func isNotFound(err error) bool {
+	var coordErr *client.Error
+	return errors.As(err, &coordErr) && coordErr.Code == client.ErrCodeNotFound
+}
+
+// isConnectionError 判断错误是否由集群不可用引起
+func isConnectionError(err error) bool {
+	var coordErr *client.Error
+	return errors.As(err, &coordErr) && coordErr.Code == client.ErrCodeConnection
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ceyewan/gochat/im-infra/clog"
@@ -58,6 +59,8 @@ func (b *EtcdResolverBuilder) Build(target resolver.Target, cc resolver.ClientCo
 		ctx:         context.Background(),
 		cancel:      nil,
 		closed:      make(chan struct{}),
+		weights:     make(map[string]*atomic.Int64),
+		targets:     make(map[string]*atomic.Pointer[registry.Target]),
 	}
 
 	r.ctx, r.cancel = context.WithCancel(r.ctx)
@@ -87,6 +90,8 @@ type EtcdResolver struct {
 
 	mu        sync.RWMutex
 	addresses []resolver.Address
+	weights   map[string]*atomic.Int64                    // 地址 -> 权重，指针在地址的生命周期内保持不变
+	targets   map[string]*atomic.Pointer[registry.Target] // 地址 -> 实例信息，与权重一样复用指针
 }
 
 // start 启动 resolver，开始监听服务变化
@@ -114,7 +119,12 @@ func (r *EtcdResolver) resolveNow() error {
 		return client.NewError(client.ErrCodeConnection, "failed to discover services", err)
 	}
 
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	var addresses []resolver.Address
+	weights := make(map[string]*atomic.Int64, len(resp.Kvs))
+	targets := make(map[string]*atomic.Pointer[registry.Target], len(resp.Kvs))
 	for _, kv := range resp.Kvs {
 		var service registry.ServiceInfo
 		if err := json.Unmarshal(kv.Value, &service); err != nil {
@@ -123,16 +133,37 @@ func (r *EtcdResolver) resolveNow() error {
 				clog.Err(err))
 			continue
 		}
+		// 跳过被健康检查器摘除的实例
+		if !service.Healthy() {
+			continue
+		}
 
-		addr := resolver.Address{
-			Addr: fmt.Sprintf("%s:%d", service.Address, service.Port),
+		hostPort := fmt.Sprintf("%s:%d", service.Address, service.Port)
+		// 复用已有的权重指针，权重变化时 picker 无需重建子连接即可读取到新值
+		weight, ok := r.weights[hostPort]
+		if !ok {
+			weight = &atomic.Int64{}
 		}
-		addresses = append(addresses, addr)
+		weight.Store(int64(service.EffectiveWeight()))
+		weights[hostPort] = weight
+
+		// 实例在同一地址上重新注册（如灰度发布换版本）时 ID 和版本会变化，同样原地更新
+		target, ok := r.targets[hostPort]
+		if !ok {
+			target = &atomic.Pointer[registry.Target]{}
+		}
+		info := registry.NewTarget(service, hostPort)
+		target.Store(&info)
+		targets[hostPort] = target
+
+		addr := setAddressWeight(resolver.Address{Addr: hostPort}, weight)
+		addr = setAddressTarget(addr, target)
+		addresses = append(addresses, setAddressDemotion(addr, instanceDemotions.get(r.serviceName, hostPort)))
 	}
 
-	r.mu.Lock()
 	r.addresses = addresses
-	r.mu.Unlock()
+	r.weights = weights
+	r.targets = targets
 
 	// 更新 gRPC 连接状态
 	state := resolver.State{
@@ -0,0 +1,321 @@
+package registryimpl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/ceyewan/gochat/im-infra/coord/internal/client"
+	"github.com/ceyewan/gochat/im-infra/coord/registry"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// 健康检查器的默认参数
+const (
+	defaultCheckInterval         = 10 * time.Second
+	defaultCheckTimeout          = 3 * time.Second
+	defaultCheckFailureThreshold = 3
+	defaultCheckSuccessThreshold = 2
+	defaultCheckConcurrency      = 16
+	defaultElectionTTL           = 10 * time.Second
+
+	// healthCheckerElection 健康检查器 leader 选举使用的 key（位于服务注册前缀下）
+	healthCheckerElection = "_health_checker"
+)
+
+// probeState 记录单个实例连续探测的结果
+type probeState struct {
+	failures  int
+	successes int
+}
+
+// healthChecker 对声明了 HealthCheck 的实例进行主动探测，只在当选 leader 后运行
+type healthChecker struct {
+	registry *EtcdServiceRegistry
+	opts     registry.HealthCheckerOptions
+	states   map[string]*probeState
+	logger   clog.Logger
+}
+
+// RunHealthChecker 参与 leader 选举，当选后周期性探测实例并更新健康状态，阻塞直到 ctx 取消
+func (r *EtcdServiceRegistry) RunHealthChecker(ctx context.Context, opts registry.HealthCheckerOptions) error {
+	normalizeHealthCheckerOptions(&opts)
+	checker := &healthChecker{
+		registry: r,
+		opts:     opts,
+		states:   make(map[string]*probeState),
+		logger:   r.logger.With(clog.String("component", "health-checker")),
+	}
+
+	for {
+		if err := checker.campaignAndRun(ctx); err != nil && ctx.Err() == nil {
+			checker.logger.Error("健康检查器异常，稍后重新参与选举", clog.Err(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// normalizeHealthCheckerOptions 填充未设置的参数
+func normalizeHealthCheckerOptions(opts *registry.HealthCheckerOptions) {
+	if opts.Interval <= 0 {
+		opts.Interval = defaultCheckInterval
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultCheckTimeout
+	}
+	if opts.FailureThreshold <= 0 {
+		opts.FailureThreshold = defaultCheckFailureThreshold
+	}
+	if opts.SuccessThreshold <= 0 {
+		opts.SuccessThreshold = defaultCheckSuccessThreshold
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = defaultCheckConcurrency
+	}
+	if opts.ElectionTTL <= 0 {
+		opts.ElectionTTL = defaultElectionTTL
+	}
+}
+
+// campaignAndRun 竞选 leader，当选后执行探测，直到失去 leader 身份或 ctx 取消
+func (c *healthChecker) campaignAndRun(ctx context.Context) error {
+	session, err := concurrency.NewSession(c.registry.client.Client(),
+		concurrency.WithTTL(int(c.opts.ElectionTTL.Seconds())),
+		concurrency.WithContext(ctx))
+	if err != nil {
+		return client.NewError(client.ErrCodeConnection, "failed to create election session", err)
+	}
+	defer session.Close()
+
+	election := concurrency.NewElection(session, path.Join(c.registry.prefix, healthCheckerElection))
+	if err := election.Campaign(ctx, fmt.Sprintf("%x", session.Lease())); err != nil {
+		return err
+	}
+	c.logger.Info("当选健康检查器 leader，开始探测实例")
+
+	defer func() {
+		// 使用独立的上下文让出 leader，避免 ctx 已取消时无法释放
+		resignCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = election.Resign(resignCtx)
+	}()
+
+	// 新任 leader 不继承前任的计数，从零开始累计
+	c.states = make(map[string]*probeState)
+
+	ticker := time.NewTicker(c.opts.Interval)
+	defer ticker.Stop()
+	for {
+		c.checkAll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-session.Done():
+			c.logger.Warn("健康检查器选举会话已失效，失去 leader 身份")
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkAll 探测所有声明了 HealthCheck 的实例
+func (c *healthChecker) checkAll(ctx context.Context) {
+	prefix := c.registry.prefix + "/"
+	resp, err := c.registry.client.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		c.logger.Error("获取服务实例失败", clog.Err(err))
+		return
+	}
+
+	electionPrefix := path.Join(c.registry.prefix, healthCheckerElection) + "/"
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, c.opts.Concurrency)
+	seen := make(map[string]bool, len(resp.Kvs))
+
+	for _, kv := range resp.Kvs {
+		key := string(kv.Key)
+		if strings.HasPrefix(key, electionPrefix) {
+			continue
+		}
+
+		var service registry.ServiceInfo
+		if err := json.Unmarshal(kv.Value, &service); err != nil || service.HealthCheck == nil {
+			continue
+		}
+		seen[key] = true
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(key string, modRevision int64) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			probeErr := c.probe(ctx, service)
+
+			mu.Lock()
+			status, changed := c.record(key, service, probeErr)
+			mu.Unlock()
+
+			if changed {
+				c.updateHealth(ctx, key, modRevision, service, status, probeErr)
+			}
+		}(key, kv.ModRevision)
+	}
+	wg.Wait()
+
+	// 清理已下线实例的计数
+	for key := range c.states {
+		if !seen[key] {
+			delete(c.states, key)
+		}
+	}
+}
+
+// record 更新连续探测计数，返回新的健康状态以及是否需要写回
+func (c *healthChecker) record(key string, service registry.ServiceInfo, probeErr error) (registry.HealthStatus, bool) {
+	state, ok := c.states[key]
+	if !ok {
+		state = &probeState{}
+		c.states[key] = state
+	}
+
+	failureThreshold := service.HealthCheck.FailureThreshold
+	if failureThreshold <= 0 {
+		failureThreshold = c.opts.FailureThreshold
+	}
+	successThreshold := service.HealthCheck.SuccessThreshold
+	if successThreshold <= 0 {
+		successThreshold = c.opts.SuccessThreshold
+	}
+
+	if probeErr != nil {
+		state.failures++
+		state.successes = 0
+		if state.failures >= failureThreshold && service.Health != registry.HealthCritical {
+			return registry.HealthCritical, true
+		}
+		return service.Health, false
+	}
+
+	state.successes++
+	state.failures = 0
+	switch service.Health {
+	case registry.HealthCritical:
+		if state.successes >= successThreshold {
+			return registry.HealthPassing, true
+		}
+	case "":
+		// 首次探测成功即标记为 passing，便于观察检查器是否生效
+		return registry.HealthPassing, true
+	}
+	return service.Health, false
+}
+
+// updateHealth 将健康状态写回实例记录
+// 使用 ModRevision 比较避免覆盖实例并发的元数据更新，并保留实例原有的租约
+func (c *healthChecker) updateHealth(ctx context.Context, key string, modRevision int64, service registry.ServiceInfo, status registry.HealthStatus, probeErr error) {
+	service.Health = status
+	data, err := json.Marshal(service)
+	if err != nil {
+		c.logger.Error("序列化服务信息失败", clog.String("key", key), clog.Err(err))
+		return
+	}
+
+	resp, err := c.registry.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(key), "=", modRevision)).
+		Then(clientv3.OpPut(key, string(data), clientv3.WithIgnoreLease())).
+		Commit()
+	if err != nil {
+		c.logger.Error("更新实例健康状态失败", clog.String("key", key), clog.Err(err))
+		return
+	}
+	if !resp.Succeeded {
+		// 实例在探测期间被更新或注销，下一个周期重新判断
+		c.logger.Debug("实例记录已变化，跳过本次健康状态更新", clog.String("key", key))
+		return
+	}
+
+	fields := []clog.Field{
+		clog.String("service_name", service.Name),
+		clog.String("service_id", service.ID),
+		clog.String("health", string(status)),
+	}
+	if status == registry.HealthCritical {
+		c.logger.Warn("实例健康检查连续失败，已从服务发现中摘除", append(fields, clog.Err(probeErr))...)
+	} else {
+		c.logger.Info("实例健康状态已更新", fields...)
+	}
+}
+
+// probe 按实例声明的方式执行一次探测
+func (c *healthChecker) probe(ctx context.Context, service registry.ServiceInfo) error {
+	check := service.HealthCheck
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = c.opts.Timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	addr := net.JoinHostPort(service.Address, fmt.Sprint(service.Port))
+	switch check.Type {
+	case registry.HealthCheckTCP, "":
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+
+	case registry.HealthCheckHTTP:
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+addr+check.Path, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= http.StatusBadRequest {
+			return fmt.Errorf("unexpected http status %d", resp.StatusCode)
+		}
+		return nil
+
+	case registry.HealthCheckGRPC:
+		conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		resp, err := grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: check.GRPCService})
+		if err != nil {
+			return err
+		}
+		if resp.GetStatus() != grpc_health_v1.HealthCheckResponse_SERVING {
+			return fmt.Errorf("grpc health status %s", resp.GetStatus())
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unsupported health check type %q", check.Type)
+	}
+}
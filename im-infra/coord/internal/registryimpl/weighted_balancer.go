@@ -0,0 +1,209 @@
+package registryimpl
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/coord/registry"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/resolver"
+)
+
+// WeightedBalancerName 是按实例权重进行负载均衡的 gRPC balancer 名称
+const WeightedBalancerName = "coord_weighted"
+
+func init() {
+	balancer.Register(base.NewBalancerBuilder(WeightedBalancerName, &weightedPickerBuilder{}, base.Config{HealthCheck: true}))
+}
+
+// weightAttributeKey 是地址 BalancerAttributes 中权重的键
+type weightAttributeKey struct{}
+
+// setAddressWeight 将权重指针附加到地址上。
+// BalancerAttributes 不参与子连接的地址比较，因此权重变化不会导致重建连接。
+func setAddressWeight(addr resolver.Address, weight *atomic.Int64) resolver.Address {
+	addr.BalancerAttributes = addr.BalancerAttributes.WithValue(weightAttributeKey{}, weight)
+	return addr
+}
+
+// addressWeight 读取地址上的权重指针，未设置时返回 nil
+func addressWeight(addr resolver.Address) *atomic.Int64 {
+	weight, _ := addr.BalancerAttributes.Value(weightAttributeKey{}).(*atomic.Int64)
+	return weight
+}
+
+// demotionAttributeKey 是地址 BalancerAttributes 中降级截止时间的键
+type demotionAttributeKey struct{}
+
+// setAddressDemotion 将降级截止时间指针附加到地址上，与权重一样不参与子连接的地址比较
+func setAddressDemotion(addr resolver.Address, until *atomic.Int64) resolver.Address {
+	addr.BalancerAttributes = addr.BalancerAttributes.WithValue(demotionAttributeKey{}, until)
+	return addr
+}
+
+// addressDemotion 读取地址上的降级截止时间指针，未设置时返回 nil
+func addressDemotion(addr resolver.Address) *atomic.Int64 {
+	until, _ := addr.BalancerAttributes.Value(demotionAttributeKey{}).(*atomic.Int64)
+	return until
+}
+
+// targetAttributeKey 是地址 BalancerAttributes 中实例信息的键
+type targetAttributeKey struct{}
+
+// setAddressTarget 将实例信息指针附加到地址上，picker 选中后写入调用的元数据
+func setAddressTarget(addr resolver.Address, target *atomic.Pointer[registry.Target]) resolver.Address {
+	addr.BalancerAttributes = addr.BalancerAttributes.WithValue(targetAttributeKey{}, target)
+	return addr
+}
+
+// addressTarget 读取地址上的实例信息指针，未设置时返回 nil
+func addressTarget(addr resolver.Address) *atomic.Pointer[registry.Target] {
+	target, _ := addr.BalancerAttributes.Value(targetAttributeKey{}).(*atomic.Pointer[registry.Target])
+	return target
+}
+
+// demotionTable 记录本进程内被降级的实例，值为降级截止时间（UnixNano），0 表示未降级，-1 表示不自动恢复。
+// resolver 和 picker 共享同一个指针，因此降级和恢复无需重建 picker 即可立即生效。
+type demotionTable struct {
+	mu      sync.Mutex
+	entries map[string]*atomic.Int64
+}
+
+// instanceDemotions 是进程级的降级表。gRPC resolver 按 scheme 全局注册，降级表同样全局共享。
+var instanceDemotions = &demotionTable{entries: make(map[string]*atomic.Int64)}
+
+// get 返回实例的降级截止时间指针，不存在时创建，指针在进程生命周期内保持不变
+func (t *demotionTable) get(serviceName, address string) *atomic.Int64 {
+	key := serviceName + "/" + address
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	until, ok := t.entries[key]
+	if !ok {
+		until = &atomic.Int64{}
+		t.entries[key] = until
+	}
+	return until
+}
+
+// demote 降级实例，ttl <= 0 表示直到 restore 为止
+func (t *demotionTable) demote(serviceName, address string, ttl time.Duration) {
+	until := int64(-1)
+	if ttl > 0 {
+		until = time.Now().Add(ttl).UnixNano()
+	}
+	t.get(serviceName, address).Store(until)
+}
+
+// restore 取消实例的降级
+func (t *demotionTable) restore(serviceName, address string) {
+	t.get(serviceName, address).Store(0)
+}
+
+// weightedPickerBuilder 构建平滑加权轮询 picker
+type weightedPickerBuilder struct{}
+
+// Build 实现 base.PickerBuilder
+func (b *weightedPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+
+	entries := make([]*weightedEntry, 0, len(info.ReadySCs))
+	for sc, scInfo := range info.ReadySCs {
+		entries = append(entries, &weightedEntry{
+			subConn:      sc,
+			weight:       addressWeight(scInfo.Address),
+			demotedUntil: addressDemotion(scInfo.Address),
+			target:       addressTarget(scInfo.Address),
+		})
+	}
+	return &weightedPicker{entries: entries}
+}
+
+// weightedEntry 是 picker 中的一个后端
+type weightedEntry struct {
+	subConn      balancer.SubConn
+	weight       *atomic.Int64
+	demotedUntil *atomic.Int64
+	target       *atomic.Pointer[registry.Target]
+	current      int64
+}
+
+// effectiveWeight 返回当前权重，未设置或非正数时视为 1
+func (e *weightedEntry) effectiveWeight() int64 {
+	if e.weight == nil {
+		return 1
+	}
+	if w := e.weight.Load(); w > 0 {
+		return w
+	}
+	return 1
+}
+
+// demoted 返回实例在 now 时刻是否处于降级状态
+func (e *weightedEntry) demoted(now int64) bool {
+	if e.demotedUntil == nil {
+		return false
+	}
+	until := e.demotedUntil.Load()
+	return until < 0 || until > now
+}
+
+// weightedPicker 实现平滑加权轮询（smooth weighted round-robin），
+// 每次选择时读取最新的权重和降级状态，因此注册中心的权重更新和熔断器的降级可以立即生效
+type weightedPicker struct {
+	mu      sync.Mutex
+	entries []*weightedEntry
+}
+
+// candidates 返回参与本次选择的后端：排除降级的实例，全部被降级时退化为所有实例
+func (p *weightedPicker) candidates() []*weightedEntry {
+	now := time.Now().UnixNano()
+	var available []*weightedEntry
+	for i, e := range p.entries {
+		if !e.demoted(now) {
+			if available != nil {
+				available = append(available, e)
+			}
+			continue
+		}
+		if available == nil {
+			available = append(make([]*weightedEntry, 0, len(p.entries)), p.entries[:i]...)
+		}
+	}
+	// available 为 nil 表示没有降级的实例，为空表示全部被降级
+	if len(available) == 0 {
+		return p.entries
+	}
+	return available
+}
+
+// Pick 实现 balancer.Picker
+// 选中实例的 ID、可用区和版本写入本次调用的元数据，并记录到调用上下文供 registry 的客户端拦截器写入 span
+func (p *weightedPicker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var total int64
+	var best *weightedEntry
+	for _, e := range p.candidates() {
+		w := e.effectiveWeight()
+		e.current += w
+		total += w
+		if best == nil || e.current > best.current {
+			best = e
+		}
+	}
+	best.current -= total
+
+	result := balancer.PickResult{SubConn: best.subConn}
+	if best.target != nil {
+		if target := best.target.Load(); target != nil {
+			result.Metadata = target.Metadata()
+			registry.RecordTarget(info.Ctx, *target)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,159 @@
+package registryimpl
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/coord/registry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/resolver"
+)
+
+// fakeSubConn 仅用于在 picker 结果中区分后端
+type fakeSubConn struct {
+	balancer.SubConn
+	addr string
+}
+
+// testBackend 描述一个测试后端及其可调整的权重和降级状态
+type testBackend struct {
+	subConn *fakeSubConn
+	weight  *atomic.Int64
+	demoted *atomic.Int64
+	target  *atomic.Pointer[registry.Target]
+}
+
+// buildWeightedPicker 按给定权重构建 picker，返回的后端与 weights 顺序一致
+func buildWeightedPicker(t *testing.T, weights ...int64) (balancer.Picker, []*testBackend) {
+	t.Helper()
+	info := base.PickerBuildInfo{ReadySCs: make(map[balancer.SubConn]base.SubConnInfo)}
+	backends := make([]*testBackend, len(weights))
+	for i, w := range weights {
+		b := &testBackend{
+			subConn: &fakeSubConn{addr: string(rune('a' + i))},
+			weight:  &atomic.Int64{},
+			demoted: &atomic.Int64{},
+			target:  &atomic.Pointer[registry.Target]{},
+		}
+		b.weight.Store(w)
+		addr := setAddressWeight(resolver.Address{Addr: b.subConn.addr}, b.weight)
+		addr = setAddressDemotion(addr, b.demoted)
+		addr = setAddressTarget(addr, b.target)
+		info.ReadySCs[b.subConn] = base.SubConnInfo{Address: addr}
+		backends[i] = b
+	}
+	return (&weightedPickerBuilder{}).Build(info), backends
+}
+
+// pickCounts 选择 n 次并按地址统计
+func pickCounts(t *testing.T, picker balancer.Picker, n int) map[string]int {
+	t.Helper()
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		result, err := picker.Pick(balancer.PickInfo{Ctx: context.Background()})
+		require.NoError(t, err)
+		counts[result.SubConn.(*fakeSubConn).addr]++
+	}
+	return counts
+}
+
+func TestWeightedPicker(t *testing.T) {
+	t.Run("NoReadySubConns", func(t *testing.T) {
+		picker := (&weightedPickerBuilder{}).Build(base.PickerBuildInfo{})
+		_, err := picker.Pick(balancer.PickInfo{Ctx: context.Background()})
+		assert.ErrorIs(t, err, balancer.ErrNoSubConnAvailable)
+	})
+
+	t.Run("Proportional", func(t *testing.T) {
+		picker, _ := buildWeightedPicker(t, 300, 100, 0)
+		// 平滑加权轮询在一个周期 (300+100+1) 内严格按权重分配，权重 0 视为 1
+		assert.Equal(t, map[string]int{"a": 600, "b": 200, "c": 2}, pickCounts(t, picker, 802))
+	})
+
+	t.Run("WeightUpdateWithoutRebuild", func(t *testing.T) {
+		picker, backends := buildWeightedPicker(t, 100, 100)
+		assert.Equal(t, map[string]int{"a": 100, "b": 100}, pickCounts(t, picker, 200))
+
+		backends[1].weight.Store(300)
+		assert.Equal(t, map[string]int{"a": 100, "b": 300}, pickCounts(t, picker, 400))
+	})
+
+	t.Run("Demotion", func(t *testing.T) {
+		picker, backends := buildWeightedPicker(t, 100, 100, 100)
+
+		backends[0].demoted.Store(-1)
+		assert.Equal(t, map[string]int{"b": 50, "c": 50}, pickCounts(t, picker, 100))
+
+		// 降级到期后自动恢复
+		backends[0].demoted.Store(time.Now().Add(-time.Second).UnixNano())
+		assert.Equal(t, map[string]int{"a": 50, "b": 50, "c": 50}, pickCounts(t, picker, 150))
+
+		// 全部被降级时退化为所有实例，避免无实例可用
+		for _, b := range backends {
+			b.demoted.Store(time.Now().Add(time.Hour).UnixNano())
+		}
+		assert.Equal(t, map[string]int{"a": 50, "b": 50, "c": 50}, pickCounts(t, picker, 150))
+	})
+
+	t.Run("TargetMetadata", func(t *testing.T) {
+		picker, backends := buildWeightedPicker(t, 100)
+		result, err := picker.Pick(balancer.PickInfo{Ctx: context.Background()})
+		require.NoError(t, err)
+		assert.Nil(t, result.Metadata, "no metadata before the resolver stores the instance")
+
+		// resolver 原地更新实例信息，picker 无需重建即可读取
+		target := registry.Target{ID: "chat-1", Address: "a", Zone: "sh-a", Version: "1.4.2"}
+		backends[0].target.Store(&target)
+
+		err = registry.UnaryClientInterceptor()(context.Background(), "/chat.Chat/Send", nil, nil, nil,
+			func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+				result, err := picker.Pick(balancer.PickInfo{Ctx: ctx})
+				require.NoError(t, err)
+				assert.Equal(t, target.Metadata(), result.Metadata)
+
+				recorded, ok := registry.TargetFromContext(ctx)
+				assert.True(t, ok)
+				assert.Equal(t, target, recorded)
+				return nil
+			})
+		require.NoError(t, err)
+	})
+}
+
+func TestDemotionTable(t *testing.T) {
+	table := &demotionTable{entries: make(map[string]*atomic.Int64)}
+	until := table.get("chat", "10.0.0.1:9000")
+	assert.Same(t, until, table.get("chat", "10.0.0.1:9000"), "the pointer is stable for the address")
+
+	table.demote("chat", "10.0.0.1:9000", 0)
+	assert.Equal(t, int64(-1), until.Load())
+	table.demote("chat", "10.0.0.1:9000", time.Minute)
+	assert.Greater(t, until.Load(), time.Now().UnixNano())
+	table.restore("chat", "10.0.0.1:9000")
+	assert.Zero(t, until.Load())
+}
+
+func TestEffectiveWeight(t *testing.T) {
+	assert.Equal(t, registry.DefaultWeight, registry.ServiceInfo{}.EffectiveWeight())
+	assert.Equal(t, 50, registry.ServiceInfo{Weight: 50}.EffectiveWeight())
+
+	// 按连接数余量和 CPU 余量中较小的比例缩放
+	assert.Equal(t, 25, registry.ServiceInfo{
+		Capacity: &registry.Capacity{Connections: 750, MaxConnections: 1000, CPU: 0.5},
+	}.EffectiveWeight())
+	assert.Equal(t, 50, registry.ServiceInfo{
+		Weight:   200,
+		Capacity: &registry.Capacity{Connections: 100, MaxConnections: 1000, CPU: 0.75},
+	}.EffectiveWeight())
+
+	// 满载时权重最小为 1，仍可分到少量流量
+	assert.Equal(t, 1, registry.ServiceInfo{
+		Capacity: &registry.Capacity{Connections: 1000, MaxConnections: 1000},
+	}.EffectiveWeight())
+}
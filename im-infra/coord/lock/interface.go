@@ -5,12 +5,63 @@ import (
 	"time"
 )
 
-// DistributedLock 是分布式锁服务的接口
+// DistributedLock 是分布式锁服务的接口。
+// ttl 为锁租约的有效期，租约以秒为单位，不足一秒的部分向上取整。
 type DistributedLock interface {
 	// Acquire 获取互斥锁，如果锁已被占用，会阻塞直到获取成功或 context 取消
 	Acquire(ctx context.Context, key string, ttl time.Duration) (Lock, error)
 	// TryAcquire 尝试获取锁（非阻塞），如果锁已被占用，会立即返回错误
 	TryAcquire(ctx context.Context, key string, ttl time.Duration) (Lock, error)
+	// AcquireFair 按先到先得的顺序排队获取锁，阻塞直到获取成功、排队超时或 context 取消。
+	// 排队期间可通过 WithQueueUpdates 获取排队位置和预计等待时间
+	AcquireFair(ctx context.Context, key string, ttl time.Duration, opts ...FairOption) (Lock, error)
+}
+
+// QueueStatus 公平锁的排队状态
+type QueueStatus struct {
+	// Position 排在前面的锁持有者和等待者数量，0 表示已获得锁
+	Position int
+	// QueueLength 队列总长度，包括当前的锁持有者
+	QueueLength int
+	// EstimatedWait 根据最近观测到的持锁时长估算的剩余等待时间，尚无观测数据时为 0
+	EstimatedWait time.Duration
+	// Waited 已经排队的时长
+	Waited time.Duration
+}
+
+// FairOptions 公平锁的排队选项
+type FairOptions struct {
+	// MaxQueueDepth 允许的最大等待者数量（不含锁持有者），队列已满时立即返回错误，0 表示不限制
+	MaxQueueDepth int
+	// Timeout 最长排队时间，超时后退出队列并返回错误，0 表示只受 context 控制
+	Timeout time.Duration
+	// Updates 接收排队状态的 channel，见 WithQueueUpdates
+	Updates chan<- QueueStatus
+}
+
+// FairOption 用于修改 FairOptions
+type FairOption func(*FairOptions)
+
+// WithMaxQueueDepth 设置允许的最大等待者数量
+func WithMaxQueueDepth(depth int) FairOption {
+	return func(o *FairOptions) {
+		o.MaxQueueDepth = depth
+	}
+}
+
+// WithWaitTimeout 设置最长排队时间
+func WithWaitTimeout(timeout time.Duration) FairOption {
+	return func(o *FairOptions) {
+		o.Timeout = timeout
+	}
+}
+
+// WithQueueUpdates 在排队位置变化时向 ch 发送 QueueStatus，获得锁时发送 Position 为 0 的最终状态，
+// AcquireFair 返回时关闭 ch。发送不会阻塞，接收不及时的状态会被丢弃，建议使用带缓冲的 channel
+func WithQueueUpdates(ch chan<- QueueStatus) FairOption {
+	return func(o *FairOptions) {
+		o.Updates = ch
+	}
 }
 
 // Lock 是一个已获取的锁对象的接口
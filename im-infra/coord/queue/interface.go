@@ -0,0 +1,119 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNoTask 表示当前没有可认领的任务
+	ErrNoTask = errors.New("no task available")
+	// ErrInFlightLimit 表示同时被认领的任务数已达到 Config.MaxInFlight
+	ErrInFlightLimit = errors.New("in-flight task limit reached")
+	// ErrClaimLost 表示认领的租约已过期，任务可能已被其他实例认领，Ack/Nack 不再生效
+	ErrClaimLost = errors.New("task claim lost")
+)
+
+// 任务状态
+const (
+	StatePending = "pending" // 等待认领，包括 Nack 后等待重试的任务
+	StateClaimed = "claimed" // 已被认领，认领者的租约有效
+	StateDead    = "dead"    // 重试次数耗尽，需要人工处理后 Delete
+)
+
+// Config 任务队列的配置
+type Config struct {
+	// MaxInFlight 整个集群同时被认领的任务数上限，用于限制控制类任务对下游的压力，默认 1
+	MaxInFlight int `json:"maxInFlight"`
+	// MaxAttempts 任务的默认最大认领次数，耗尽后进入 dead 状态，默认 3
+	MaxAttempts int `json:"maxAttempts"`
+	// RetryBackoff Nack 未指定延迟时的默认重试延迟，默认 10s
+	RetryBackoff time.Duration `json:"retryBackoff"`
+	// ClaimTTL 认领租约的时长，认领者崩溃后最多经过该时长任务可被重新认领，默认 30s。
+	// 认领期间租约自动续期，处理时间可以超过 ClaimTTL
+	ClaimTTL time.Duration `json:"claimTTL"`
+}
+
+// Task 是队列中的一个任务
+type Task struct {
+	// Key 去重键，同一个键在任务被 Ack 或 Delete 之前只能入队一次，如 "reindex:shard-7"
+	Key     string `json:"key"`
+	Payload []byte `json:"payload,omitempty"`
+	// State 任务状态：pending、claimed、dead
+	State string `json:"state"`
+	// Attempts 已被认领的次数
+	Attempts    int `json:"attempts"`
+	MaxAttempts int `json:"maxAttempts"`
+	// Owner 最近一次认领者的标识
+	Owner string `json:"owner,omitempty"`
+	// LastError 最近一次 Nack 的原因
+	LastError  string    `json:"lastError,omitempty"`
+	EnqueuedAt time.Time `json:"enqueuedAt"`
+	// NotBefore 任务最早可被认领的时间，用于延迟任务和重试退避
+	NotBefore time.Time `json:"notBefore,omitempty"`
+	ClaimedAt time.Time `json:"claimedAt,omitempty"`
+}
+
+// Stats 队列中各状态的任务数
+type Stats struct {
+	Pending int `json:"pending"`
+	// Delayed 处于 pending 状态但尚未到达 NotBefore 的任务数，包含在 Pending 中
+	Delayed int `json:"delayed"`
+	Claimed int `json:"claimed"`
+	Dead    int `json:"dead"`
+}
+
+// EnqueueOptions 入队选项
+type EnqueueOptions struct {
+	// MaxAttempts 覆盖 Config.MaxAttempts
+	MaxAttempts int
+	// Delay 任务入队后延迟多久才能被认领
+	Delay time.Duration
+}
+
+// EnqueueOption 用于修改 EnqueueOptions
+type EnqueueOption func(*EnqueueOptions)
+
+// WithMaxAttempts 设置任务的最大认领次数
+func WithMaxAttempts(n int) EnqueueOption {
+	return func(o *EnqueueOptions) {
+		o.MaxAttempts = n
+	}
+}
+
+// WithDelay 设置任务入队后的延迟
+func WithDelay(d time.Duration) EnqueueOption {
+	return func(o *EnqueueOptions) {
+		o.Delay = d
+	}
+}
+
+// TaskQueue 是基于 etcd 的轻量任务队列，适用于"重建分片 7 的索引"、"重算群统计"等低频控制任务，
+// 无需为此引入 Kafka。任务按入队顺序认领，认领基于 etcd 租约，认领者崩溃后任务自动回到队列
+type TaskQueue interface {
+	// Enqueue 入队一个任务，key 对应的任务已存在时不重复入队，返回 false
+	Enqueue(ctx context.Context, key string, payload []byte, opts ...EnqueueOption) (bool, error)
+	// Claim 认领最早入队的可执行任务。没有任务时返回 ErrNoTask，
+	// 同时被认领的任务数达到 MaxInFlight 时返回 ErrInFlightLimit
+	Claim(ctx context.Context, owner string) (ClaimedTask, error)
+	// Get 返回任务的当前状态，任务不存在时返回 NOT_FOUND 错误
+	Get(ctx context.Context, key string) (*Task, error)
+	// List 返回队列中的所有任务，state 为空时返回全部状态，按入队顺序排列
+	List(ctx context.Context, state string) ([]Task, error)
+	// Stats 返回各状态的任务数
+	Stats(ctx context.Context) (Stats, error)
+	// Delete 删除任务，用于取消待执行的任务或清理 dead 任务。已被认领的任务删除后认领者的 Ack/Nack 返回 ErrClaimLost
+	Delete(ctx context.Context, key string) error
+}
+
+// ClaimedTask 是一个已认领的任务，必须调用 Ack 或 Nack 之一结束认领
+type ClaimedTask interface {
+	// Task 返回认领时的任务快照
+	Task() Task
+	// Ack 确认任务完成并将其从队列中删除
+	Ack(ctx context.Context) error
+	// Nack 放弃任务，retryAfter 后重新认领，retryAfter 为 0 时使用 Config.RetryBackoff。
+	// 认领次数耗尽时任务进入 dead 状态
+	Nack(ctx context.Context, reason error, retryAfter time.Duration) error
+}
@@ -0,0 +1,125 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+)
+
+//go:generate go run gen_accessors.go
+
+// EndpointSchemaVersion 当前的端点 schema 版本：
+//   - 1：协议、版本、可用区以约定的键写在 Metadata 中（MetadataKeyProtocol 等）
+//   - 2：使用类型化的 ServiceInfo.Endpoint，注册时同时回写 v1 的 Metadata 键，兼容旧版本的 watcher
+const EndpointSchemaVersion = 2
+
+// v1 schema 在 Metadata 中使用的键
+const (
+	MetadataKeyProtocol = "protocol"
+	MetadataKeyVersion  = "version"
+	MetadataKeyZone     = "zone"
+)
+
+// 端点支持的通信协议
+const (
+	ProtocolGRPC      = "grpc"
+	ProtocolHTTP      = "http"
+	ProtocolWebSocket = "ws"
+	ProtocolTCP       = "tcp"
+)
+
+// Endpoint 实例端点的类型化描述，替代在 Metadata 中约定键名的做法
+type Endpoint struct {
+	// SchemaVersion 写入方使用的 schema 版本，0 表示当前版本
+	SchemaVersion int `json:"schemaVersion"`
+	// Protocol 通信协议，见 Protocol* 常量
+	Protocol string `json:"protocol"`
+	// Version 服务版本，如 "1.4.2"
+	Version string `json:"version"`
+	// Zone 实例所在的可用区，如 "sh-a"；数据中心仍由 ServiceInfo.DC 表示
+	Zone string `json:"zone"`
+}
+
+// Validate 校验端点的必填字段，更高版本的 schema 会被拒绝，避免旧代码写入无法理解的记录
+func (e Endpoint) Validate() error {
+	if e.SchemaVersion < 0 || e.SchemaVersion > EndpointSchemaVersion {
+		return fmt.Errorf("unsupported endpoint schema version %d, current is %d", e.SchemaVersion, EndpointSchemaVersion)
+	}
+	switch e.Protocol {
+	case ProtocolGRPC, ProtocolHTTP, ProtocolWebSocket, ProtocolTCP:
+	case "":
+		return errors.New("endpoint protocol is required")
+	default:
+		return fmt.Errorf("unsupported endpoint protocol %q", e.Protocol)
+	}
+	if e.Version == "" {
+		return errors.New("endpoint version is required")
+	}
+	if e.Zone == "" {
+		return errors.New("endpoint zone is required")
+	}
+	return nil
+}
+
+// ResolveEndpoint 返回实例的端点描述，统一升级到当前 schema 版本：
+// 设置了 Endpoint 时以其为准，否则从 v1 的 Metadata 键读取。两者都没有时 ok 为 false
+func (s ServiceInfo) ResolveEndpoint() (endpoint Endpoint, ok bool) {
+	if s.Endpoint != nil {
+		endpoint = *s.Endpoint
+	} else {
+		endpoint = Endpoint{
+			SchemaVersion: 1,
+			Protocol:      s.Metadata[MetadataKeyProtocol],
+			Version:       s.Metadata[MetadataKeyVersion],
+			Zone:          s.Metadata[MetadataKeyZone],
+		}
+		if endpoint.Protocol == "" && endpoint.Version == "" && endpoint.Zone == "" {
+			return Endpoint{}, false
+		}
+	}
+	if endpoint.SchemaVersion < EndpointSchemaVersion {
+		endpoint.SchemaVersion = EndpointSchemaVersion
+	}
+	return endpoint, true
+}
+
+// ValidateEndpoint 按当前 schema 校验实例的端点：协议、版本、可用区和权重（ServiceInfo.Weight > 0）均为必填
+func (s ServiceInfo) ValidateEndpoint() error {
+	endpoint, ok := s.ResolveEndpoint()
+	if !ok {
+		return errors.New("endpoint is required")
+	}
+	if err := endpoint.Validate(); err != nil {
+		return err
+	}
+	if s.Weight <= 0 {
+		return errors.New("endpoint weight is required")
+	}
+	return nil
+}
+
+// NormalizeEndpoint 返回升级到当前 schema 的实例副本：Endpoint 被填充为当前版本，
+// 并把协议、版本、可用区回写到 Metadata 的 v1 键中（以 Endpoint 为准覆盖），供旧版本的 watcher 读取。
+// 没有端点信息时原样返回
+func (s ServiceInfo) NormalizeEndpoint() ServiceInfo {
+	endpoint, ok := s.ResolveEndpoint()
+	if !ok {
+		return s
+	}
+	s.Endpoint = &endpoint
+
+	metadata := make(map[string]string, len(s.Metadata)+3)
+	for k, v := range s.Metadata {
+		metadata[k] = v
+	}
+	for k, v := range map[string]string{
+		MetadataKeyProtocol: endpoint.Protocol,
+		MetadataKeyVersion:  endpoint.Version,
+		MetadataKeyZone:     endpoint.Zone,
+	} {
+		if v != "" {
+			metadata[k] = v
+		}
+	}
+	s.Metadata = metadata
+	return s
+}
@@ -0,0 +1,41 @@
+// Code generated by gen_accessors.go; DO NOT EDIT.
+
+package registry
+
+// Protocol 返回实例的通信协议，优先读取 Endpoint，v1 实例回退到 Metadata[MetadataKeyProtocol]
+func (s ServiceInfo) Protocol() string {
+	if s.Endpoint != nil && s.Endpoint.Protocol != "" {
+		return s.Endpoint.Protocol
+	}
+	return s.Metadata[MetadataKeyProtocol]
+}
+
+// Version 返回实例的服务版本，优先读取 Endpoint，v1 实例回退到 Metadata[MetadataKeyVersion]
+func (s ServiceInfo) Version() string {
+	if s.Endpoint != nil && s.Endpoint.Version != "" {
+		return s.Endpoint.Version
+	}
+	return s.Metadata[MetadataKeyVersion]
+}
+
+// Zone 返回实例的可用区，优先读取 Endpoint，v1 实例回退到 Metadata[MetadataKeyZone]
+func (s ServiceInfo) Zone() string {
+	if s.Endpoint != nil && s.Endpoint.Zone != "" {
+		return s.Endpoint.Zone
+	}
+	return s.Metadata[MetadataKeyZone]
+}
+
+// Match 返回实例的端点是否与 want 中的非空字段全部一致，用于 watcher 按协议、版本或可用区过滤实例
+func (s ServiceInfo) Match(want Endpoint) bool {
+	if want.Protocol != "" && s.Protocol() != want.Protocol {
+		return false
+	}
+	if want.Version != "" && s.Version() != want.Version {
+		return false
+	}
+	if want.Zone != "" && s.Zone() != want.Zone {
+		return false
+	}
+	return true
+}
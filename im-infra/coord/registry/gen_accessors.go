@@ -0,0 +1,65 @@
+//go:build ignore
+
+// gen_accessors 为 Endpoint 的每个字段生成 ServiceInfo 上的类型化访问方法，
+// watcher 通过这些方法读取端点信息，无需关心实例使用的是哪个 schema 版本。
+//
+// 在 registry 目录下运行 go generate 重新生成 endpoint_accessors_gen.go。
+package main
+
+import (
+	"bytes"
+	"go/format"
+	"log"
+	"os"
+	"text/template"
+)
+
+// field 描述一个需要生成访问方法的 Endpoint 字段
+type field struct {
+	Name    string // Endpoint 字段名，同时作为方法名
+	MetaKey string // v1 schema 中对应的 Metadata 键常量
+	Doc     string // 方法注释中的字段说明
+}
+
+var fields = []field{
+	{Name: "Protocol", MetaKey: "MetadataKeyProtocol", Doc: "通信协议"},
+	{Name: "Version", MetaKey: "MetadataKeyVersion", Doc: "服务版本"},
+	{Name: "Zone", MetaKey: "MetadataKeyZone", Doc: "可用区"},
+}
+
+var tmpl = template.Must(template.New("accessors").Parse(`// Code generated by gen_accessors.go; DO NOT EDIT.
+
+package registry
+{{range .}}
+// {{.Name}} 返回实例的{{.Doc}}，优先读取 Endpoint，v1 实例回退到 Metadata[{{.MetaKey}}]
+func (s ServiceInfo) {{.Name}}() string {
+	if s.Endpoint != nil && s.Endpoint.{{.Name}} != "" {
+		return s.Endpoint.{{.Name}}
+	}
+	return s.Metadata[{{.MetaKey}}]
+}
+{{end}}
+// Match 返回实例的端点是否与 want 中的非空字段全部一致，用于 watcher 按协议、版本或可用区过滤实例
+func (s ServiceInfo) Match(want Endpoint) bool {
+{{- range .}}
+	if want.{{.Name}} != "" && s.{{.Name}}() != want.{{.Name}} {
+		return false
+	}
+{{- end}}
+	return true
+}
+`))
+
+func main() {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, fields); err != nil {
+		log.Fatal(err)
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile("endpoint_accessors_gen.go", src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -15,6 +15,9 @@ const (
 	EventTypeDelete EventType = "DELETE"
 )
 
+// DefaultWeight 未设置权重时实例的默认权重
+const DefaultWeight = 100
+
 // ServiceInfo 服务信息
 type ServiceInfo struct {
 	ID       string            `json:"id"`
@@ -22,6 +25,160 @@ type ServiceInfo struct {
 	Address  string            `json:"address"`
 	Port     int               `json:"port"`
 	Metadata map[string]string `json:"metadata,omitempty"`
+	// DC 实例所在的数据中心，为空时注册表会填入本地数据中心（coord.Config.DC）
+	DC string `json:"dc,omitempty"`
+	// Weight 实例的静态权重，0 表示使用 DefaultWeight
+	Weight int `json:"weight,omitempty"`
+	// Endpoint 类型化的端点描述（协议、版本、可用区），可通过 Protocol()、Version()、Zone() 读取
+	Endpoint *Endpoint `json:"endpoint,omitempty"`
+	// Capacity 实例上报的实时负载，用于按剩余容量调整权重
+	Capacity *Capacity `json:"capacity,omitempty"`
+	// HealthCheck 实例声明的主动健康检查方式，nil 表示不进行主动检查
+	HealthCheck *HealthCheck `json:"healthCheck,omitempty"`
+	// Health 由健康检查器写入的健康状态，空值表示尚未检查
+	Health HealthStatus `json:"health,omitempty"`
+}
+
+// Healthy 返回实例是否可以接收流量，只有被健康检查器标记为 critical 的实例会被摘除
+func (s ServiceInfo) Healthy() bool {
+	return s.Health != HealthCritical
+}
+
+// HealthStatus 实例的健康状态
+type HealthStatus string
+
+const (
+	// HealthPassing 健康检查通过
+	HealthPassing HealthStatus = "passing"
+	// HealthCritical 连续多次健康检查失败，实例已从服务发现结果中摘除
+	HealthCritical HealthStatus = "critical"
+)
+
+// 健康检查的探测方式
+const (
+	HealthCheckTCP  = "tcp"
+	HealthCheckHTTP = "http"
+	HealthCheckGRPC = "grpc"
+)
+
+// HealthCheck 描述如何主动探测实例的健康状态
+type HealthCheck struct {
+	// Type 探测方式：tcp（建立连接）、http（GET 请求返回 2xx/3xx）、grpc（grpc.health.v1 返回 SERVING）
+	Type string `json:"type"`
+	// Path HTTP 探测的路径，如 "/healthz"
+	Path string `json:"path,omitempty"`
+	// GRPCService gRPC 探测的服务名，空值表示检查整个服务器
+	GRPCService string `json:"grpcService,omitempty"`
+	// Timeout 单次探测的超时时间，0 表示使用检查器的默认值
+	Timeout time.Duration `json:"timeout,omitempty"`
+	// FailureThreshold 连续失败多少次后标记为 critical，0 表示使用检查器的默认值
+	FailureThreshold int `json:"failureThreshold,omitempty"`
+	// SuccessThreshold 被摘除的实例连续成功多少次后恢复，0 表示使用检查器的默认值
+	SuccessThreshold int `json:"successThreshold,omitempty"`
+}
+
+// HealthCheckerOptions 健康检查器的运行参数
+type HealthCheckerOptions struct {
+	// Interval 探测周期，默认 10 秒
+	Interval time.Duration
+	// Timeout 默认的单次探测超时时间，默认 3 秒
+	Timeout time.Duration
+	// FailureThreshold 默认的连续失败阈值，默认 3
+	FailureThreshold int
+	// SuccessThreshold 默认的连续成功阈值，默认 2
+	SuccessThreshold int
+	// Concurrency 同时进行的探测数，默认 16
+	Concurrency int
+	// ElectionTTL leader 选举会话的 TTL，leader 崩溃后其他候选者最迟在该时间后接管，默认 10 秒
+	ElectionTTL time.Duration
+}
+
+// Capacity 实例的实时负载信息
+type Capacity struct {
+	// Connections 当前连接数
+	Connections int64 `json:"connections"`
+	// MaxConnections 最大连接数，0 表示不按连接数调整权重
+	MaxConnections int64 `json:"maxConnections,omitempty"`
+	// CPU 当前 CPU 使用率，取值 [0, 1]
+	CPU float64 `json:"cpu,omitempty"`
+}
+
+// EffectiveWeight 返回负载均衡使用的有效权重：
+// 以 Weight（默认 DefaultWeight）为基础，按连接数余量和 CPU 余量中较小的比例缩放，最小为 1
+func (s ServiceInfo) EffectiveWeight() int {
+	weight := s.Weight
+	if weight <= 0 {
+		weight = DefaultWeight
+	}
+	if s.Capacity == nil {
+		return weight
+	}
+
+	factor := 1.0
+	if s.Capacity.MaxConnections > 0 {
+		factor = min(factor, 1-float64(s.Capacity.Connections)/float64(s.Capacity.MaxConnections))
+	}
+	if s.Capacity.CPU > 0 {
+		factor = min(factor, 1-s.Capacity.CPU)
+	}
+	return max(1, int(float64(weight)*factor))
+}
+
+// InstanceUpdate 描述对已注册实例的更新，nil 字段保持不变
+type InstanceUpdate struct {
+	// Weight 新的静态权重
+	Weight *int
+	// Capacity 新的实时负载
+	Capacity *Capacity
+	// Metadata 合并到现有元数据，值为空字符串表示删除该键
+	Metadata map[string]string
+}
+
+// DiscoverOptions Discover 的可选参数
+type DiscoverOptions struct {
+	// PreferLocalDC 优先返回本地数据中心的实例
+	PreferLocalDC bool
+	// CacheStatus 非 nil 时由注册表填入本次结果的来源和新鲜度
+	CacheStatus *CacheStatus
+}
+
+// CacheStatus 描述 Discover 结果的来源，只有开启了本地注册表缓存（coord.Config.RegistryCache）时才会标记为来自缓存
+type CacheStatus struct {
+	// FromCache 结果来自本地缓存而不是直接查询 etcd
+	FromCache bool
+	// Stale 缓存已与 etcd 失去同步（etcd 不可达或 watch 中断），结果可能缺少最新的变更
+	Stale bool
+	// LastSync 缓存最后一次确认与 etcd 一致的时间，缓存从磁盘快照恢复且尚未同步时为快照记录的时间
+	LastSync time.Time
+	// Revision 缓存对应的 etcd revision
+	Revision int64
+}
+
+// Staleness 返回缓存自最后一次同步以来经过的时间，结果不来自缓存时为 0
+func (s CacheStatus) Staleness() time.Duration {
+	if !s.FromCache || s.LastSync.IsZero() {
+		return 0
+	}
+	return time.Since(s.LastSync)
+}
+
+// DiscoverOption 配置 Discover 的行为
+type DiscoverOption func(*DiscoverOptions)
+
+// PreferLocalDC 优先返回本地数据中心的健康实例，本地没有健康实例时回退到所有远程数据中心的健康实例。
+// 未打 DC 标签的实例视为本地实例；注册表未配置本地数据中心时该选项不生效。
+func PreferLocalDC() DiscoverOption {
+	return func(o *DiscoverOptions) {
+		o.PreferLocalDC = true
+	}
+}
+
+// WithCacheStatus 在 Discover 返回时将结果的来源和新鲜度写入 status，
+// 调用方可据此在 etcd 不可达时继续使用旧的实例列表，同时记录告警或缩短重试间隔
+func WithCacheStatus(status *CacheStatus) DiscoverOption {
+	return func(o *DiscoverOptions) {
+		o.CacheStatus = status
+	}
 }
 
 // ServiceEvent 服务变化事件
@@ -36,10 +193,24 @@ type ServiceRegistry interface {
 	Register(ctx context.Context, service ServiceInfo, ttl time.Duration) error
 	// Unregister 注销服务
 	Unregister(ctx context.Context, serviceID string) error
-	// Discover 发现服务
-	Discover(ctx context.Context, serviceName string) ([]ServiceInfo, error)
-	// Watch 监听服务变化
+	// Discover 发现服务，被健康检查器标记为 critical 的实例不会返回，
+	// 可通过 PreferLocalDC() 优先选择本地数据中心的实例
+	Discover(ctx context.Context, serviceName string, opts ...DiscoverOption) ([]ServiceInfo, error)
+	// Watch 监听服务变化，健康状态的变化以 PUT 事件发布，可通过 ServiceInfo.Healthy 判断
 	Watch(ctx context.Context, serviceName string) (<-chan ServiceEvent, error)
-	// GetConnection 获取到指定服务的 gRPC 连接，支持负载均衡
+	// UpdateMetadata 更新本实例已注册服务的权重、负载和元数据，变更会通过 Watch 传播到 gRPC 负载均衡器
+	UpdateMetadata(ctx context.Context, serviceID string, update InstanceUpdate) error
+	// GetConnection 获取到指定服务的 gRPC 连接，按实例有效权重进行负载均衡
 	GetConnection(ctx context.Context, serviceName string) (*grpc.ClientConn, error)
+	// DeprioritizeInstance 在本进程的 gRPC 负载均衡中临时降低实例（address 为 "host:port"）的优先级：
+	// 只要服务还有其他就绪实例，该实例就不会被选中。ttl 到期后实例自动重新参与选择，
+	// 以便熔断器的半开探测请求能够到达；ttl <= 0 表示直到 RestoreInstance 为止。
+	// 降级只影响本进程的客户端连接，不修改注册中心中的实例信息，可直接作为 breaker.InstanceReporter 使用。
+	DeprioritizeInstance(serviceName, address string, ttl time.Duration)
+	// RestoreInstance 取消实例的降级，使其立即按权重重新参与负载均衡
+	RestoreInstance(serviceName, address string)
+	// RunHealthChecker 参与健康检查器的 leader 选举，当选后定期探测声明了 HealthCheck 的实例，
+	// 连续失败达到阈值的实例被标记为 critical 并从 Discover 和 gRPC 负载均衡中摘除，恢复后重新加入。
+	// 该方法阻塞直到 ctx 取消；多个副本同时运行时只有 leader 执行探测。
+	RunHealthChecker(ctx context.Context, opts HealthCheckerOptions) error
 }
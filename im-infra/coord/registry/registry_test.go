@@ -0,0 +1,166 @@
+package registry
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestEndpointValidate(t *testing.T) {
+	valid := Endpoint{Protocol: ProtocolGRPC, Version: "1.4.2", Zone: "sh-a"}
+	require.NoError(t, valid.Validate())
+
+	for name, mutate := range map[string]func(*Endpoint){
+		"FutureSchema":    func(e *Endpoint) { e.SchemaVersion = EndpointSchemaVersion + 1 },
+		"NegativeSchema":  func(e *Endpoint) { e.SchemaVersion = -1 },
+		"MissingProtocol": func(e *Endpoint) { e.Protocol = "" },
+		"UnknownProtocol": func(e *Endpoint) { e.Protocol = "quic" },
+		"MissingVersion":  func(e *Endpoint) { e.Version = "" },
+		"MissingZone":     func(e *Endpoint) { e.Zone = "" },
+	} {
+		endpoint := valid
+		mutate(&endpoint)
+		assert.Error(t, endpoint.Validate(), name)
+	}
+}
+
+func TestResolveEndpoint(t *testing.T) {
+	_, ok := ServiceInfo{Metadata: map[string]string{"region": "cn"}}.ResolveEndpoint()
+	assert.False(t, ok)
+
+	// v1 实例从 Metadata 键读取，统一升级到当前 schema
+	v1 := ServiceInfo{Metadata: map[string]string{
+		MetadataKeyProtocol: ProtocolHTTP,
+		MetadataKeyVersion:  "1.0.0",
+		MetadataKeyZone:     "sh-b",
+	}}
+	endpoint, ok := v1.ResolveEndpoint()
+	require.True(t, ok)
+	assert.Equal(t, Endpoint{SchemaVersion: EndpointSchemaVersion, Protocol: ProtocolHTTP, Version: "1.0.0", Zone: "sh-b"}, endpoint)
+	assert.Equal(t, ProtocolHTTP, v1.Protocol())
+
+	// Endpoint 优先于 Metadata
+	v2 := ServiceInfo{
+		Endpoint: &Endpoint{Protocol: ProtocolGRPC, Version: "2.0.0", Zone: "sh-a"},
+		Metadata: v1.Metadata,
+	}
+	endpoint, ok = v2.ResolveEndpoint()
+	require.True(t, ok)
+	assert.Equal(t, "2.0.0", endpoint.Version)
+	assert.Equal(t, "sh-a", v2.Zone())
+	assert.True(t, v2.Match(Endpoint{Protocol: ProtocolGRPC, Zone: "sh-a"}))
+	assert.False(t, v2.Match(Endpoint{Version: "1.0.0"}))
+}
+
+func TestValidateEndpoint(t *testing.T) {
+	service := ServiceInfo{Endpoint: &Endpoint{Protocol: ProtocolGRPC, Version: "1.4.2", Zone: "sh-a"}}
+	assert.Error(t, service.ValidateEndpoint(), "weight is required")
+
+	service.Weight = 100
+	assert.NoError(t, service.ValidateEndpoint())
+	assert.Error(t, ServiceInfo{Weight: 100}.ValidateEndpoint(), "endpoint is required")
+}
+
+func TestNormalizeEndpoint(t *testing.T) {
+	meta := map[string]string{MetadataKeyVersion: "0.9.0", "region": "cn"}
+	service := ServiceInfo{
+		Endpoint: &Endpoint{Protocol: ProtocolGRPC, Version: "1.4.2", Zone: "sh-a"},
+		Metadata: meta,
+	}
+
+	normalized := service.NormalizeEndpoint()
+	assert.Equal(t, EndpointSchemaVersion, normalized.Endpoint.SchemaVersion)
+	// v1 键以 Endpoint 为准回写，其余 Metadata 保留
+	assert.Equal(t, map[string]string{
+		MetadataKeyProtocol: ProtocolGRPC,
+		MetadataKeyVersion:  "1.4.2",
+		MetadataKeyZone:     "sh-a",
+		"region":            "cn",
+	}, normalized.Metadata)
+	// 不修改调用方的 Endpoint 和 Metadata
+	assert.Equal(t, "0.9.0", meta[MetadataKeyVersion])
+	assert.Zero(t, service.Endpoint.SchemaVersion)
+
+	plain := ServiceInfo{Metadata: map[string]string{"region": "cn"}}
+	assert.Equal(t, plain, plain.NormalizeEndpoint())
+}
+
+func TestTargetMetadata(t *testing.T) {
+	service := ServiceInfo{
+		ID:       "chat-1",
+		Endpoint: &Endpoint{Protocol: ProtocolGRPC, Version: "1.4.2", Zone: "sh-a"},
+	}
+	target := NewTarget(service, "10.0.0.1:9000")
+	assert.Equal(t, Target{ID: "chat-1", Address: "10.0.0.1:9000", Zone: "sh-a", Version: "1.4.2"}, target)
+
+	// 地址只写入 span，不写入请求元数据
+	md := target.Metadata()
+	assert.Equal(t, metadata.MD{
+		MetadataTargetID:      {"chat-1"},
+		MetadataTargetZone:    {"sh-a"},
+		MetadataTargetVersion: {"1.4.2"},
+	}, md)
+	assert.Equal(t, metadata.MD{MetadataTargetID: {"chat-1"}}, Target{ID: "chat-1"}.Metadata())
+
+	got, ok := TargetFromIncomingContext(metadata.NewIncomingContext(context.Background(), md))
+	require.True(t, ok)
+	assert.Equal(t, Target{ID: "chat-1", Zone: "sh-a", Version: "1.4.2"}, got)
+
+	_, ok = TargetFromIncomingContext(context.Background())
+	assert.False(t, ok)
+	_, ok = TargetFromIncomingContext(metadata.NewIncomingContext(context.Background(), metadata.Pairs(MetadataTargetZone, "sh-a")))
+	assert.False(t, ok, "the instance ID is required")
+}
+
+func TestTargetInterceptors(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("registry-test")
+	target := Target{ID: "chat-1", Address: "10.0.0.1:9000", Zone: "sh-a", Version: "1.4.2"}
+
+	ctx, span := tracer.Start(context.Background(), "client")
+	// 没有拦截器放入的记录位置时 RecordTarget 不做任何事
+	RecordTarget(ctx, target)
+	_, ok := TargetFromContext(ctx)
+	assert.False(t, ok)
+
+	err := UnaryClientInterceptor()(ctx, "/chat.Chat/Send", nil, nil, nil,
+		func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			// 负载均衡器选中实例时写入，重试时以最后一次为准
+			RecordTarget(ctx, Target{ID: "chat-0"})
+			RecordTarget(ctx, target)
+			got, ok := TargetFromContext(ctx)
+			assert.True(t, ok)
+			assert.Equal(t, target, got)
+			return nil
+		})
+	require.NoError(t, err)
+	span.End()
+
+	ctx, span = tracer.Start(metadata.NewIncomingContext(context.Background(), target.Metadata()), "server")
+	_, err = UnaryServerInterceptor()(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/chat.Chat/Send"},
+		func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil })
+	require.NoError(t, err)
+	span.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.ElementsMatch(t, []attribute.KeyValue{
+		attribute.String("coord.target.id", "chat-1"),
+		attribute.String("coord.target.address", "10.0.0.1:9000"),
+		attribute.String("coord.target.zone", "sh-a"),
+		attribute.String("coord.target.version", "1.4.2"),
+	}, spans[0].Attributes())
+	// 服务端只能从元数据中读到 ID、可用区和版本
+	assert.ElementsMatch(t, []attribute.KeyValue{
+		attribute.String("coord.target.id", "chat-1"),
+		attribute.String("coord.target.zone", "sh-a"),
+		attribute.String("coord.target.version", "1.4.2"),
+	}, spans[1].Attributes())
+}
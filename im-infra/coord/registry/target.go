@@ -0,0 +1,194 @@
+package registry
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// 负载均衡器写入请求元数据的键，服务端可通过 TargetFromIncomingContext 读取
+const (
+	MetadataTargetID      = "x-coord-target-id"
+	MetadataTargetZone    = "x-coord-target-zone"
+	MetadataTargetVersion = "x-coord-target-version"
+)
+
+// Target 一次 gRPC 调用由负载均衡选中的实例
+type Target struct {
+	// ID 实例 ID，即 ServiceInfo.ID
+	ID string
+	// Address 实例地址 "host:port"
+	Address string
+	// Zone 实例所在的可用区
+	Zone string
+	// Version 实例的服务版本
+	Version string
+}
+
+// NewTarget 从实例信息构造 Target，可用区和版本按 ResolveEndpoint 的规则读取
+func NewTarget(service ServiceInfo, address string) Target {
+	return Target{
+		ID:      service.ID,
+		Address: address,
+		Zone:    service.Zone(),
+		Version: service.Version(),
+	}
+}
+
+// Metadata 返回写入请求元数据的键值对，空字段不写入
+func (t Target) Metadata() metadata.MD {
+	md := metadata.MD{}
+	if t.ID != "" {
+		md.Set(MetadataTargetID, t.ID)
+	}
+	if t.Zone != "" {
+		md.Set(MetadataTargetZone, t.Zone)
+	}
+	if t.Version != "" {
+		md.Set(MetadataTargetVersion, t.Version)
+	}
+	return md
+}
+
+// attributes 返回写入 span 的属性，空字段不写入
+func (t Target) attributes() []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, 0, 4)
+	if t.ID != "" {
+		attrs = append(attrs, attribute.String("coord.target.id", t.ID))
+	}
+	if t.Address != "" {
+		attrs = append(attrs, attribute.String("coord.target.address", t.Address))
+	}
+	if t.Zone != "" {
+		attrs = append(attrs, attribute.String("coord.target.zone", t.Zone))
+	}
+	if t.Version != "" {
+		attrs = append(attrs, attribute.String("coord.target.version", t.Version))
+	}
+	return attrs
+}
+
+// targetKey 调用上下文中保存选中实例的键
+type targetKey struct{}
+
+// targetHolder 由客户端拦截器放入调用上下文，负载均衡器选中实例后写入。
+// 一次调用可能因重试多次选择实例，保留最后一次的结果
+type targetHolder struct {
+	mu     sync.Mutex
+	target Target
+	set    bool
+}
+
+// RecordTarget 记录本次调用选中的实例，由 coord 的负载均衡器在选中实例后调用。
+// 上下文中没有 UnaryClientInterceptor/StreamClientInterceptor 放入的记录位置时不做任何事
+func RecordTarget(ctx context.Context, target Target) {
+	if h, ok := ctx.Value(targetKey{}).(*targetHolder); ok {
+		h.mu.Lock()
+		h.target, h.set = target, true
+		h.mu.Unlock()
+	}
+}
+
+// TargetFromContext 返回本次调用选中的实例。
+// 只有经过 UnaryClientInterceptor/StreamClientInterceptor 的调用上下文才有记录，且要在实例选中之后读取，
+// 通常用于链在其后的拦截器在 invoker 返回后记录日志
+func TargetFromContext(ctx context.Context) (Target, bool) {
+	h, ok := ctx.Value(targetKey{}).(*targetHolder)
+	if !ok {
+		return Target{}, false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.target, h.set
+}
+
+// TargetFromIncomingContext 在服务端读取调用方负载均衡选中的实例，即调用方眼中的本实例。
+// 请求经过代理或调用方未使用 coord 的连接时返回 false
+func TargetFromIncomingContext(ctx context.Context) (Target, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return Target{}, false
+	}
+	first := func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	target := Target{
+		ID:      first(MetadataTargetID),
+		Zone:    first(MetadataTargetZone),
+		Version: first(MetadataTargetVersion),
+	}
+	if target.ID == "" {
+		return Target{}, false
+	}
+	return target, true
+}
+
+// withTargetHolder 为调用上下文准备记录位置，上下文中已有时直接复用
+func withTargetHolder(ctx context.Context) (context.Context, *targetHolder) {
+	if h, ok := ctx.Value(targetKey{}).(*targetHolder); ok {
+		return ctx, h
+	}
+	h := &targetHolder{}
+	return context.WithValue(ctx, targetKey{}, h), h
+}
+
+// annotate 将选中的实例写入当前 span
+func (h *targetHolder) annotate(ctx context.Context) {
+	h.mu.Lock()
+	target, set := h.target, h.set
+	h.mu.Unlock()
+	if set {
+		trace.SpanFromContext(ctx).SetAttributes(target.attributes()...)
+	}
+}
+
+// UnaryClientInterceptor 返回记录选中实例的客户端拦截器，GetConnection 返回的连接已默认链上。
+// coord 的负载均衡器选中实例后总会把实例的 ID、可用区和版本写入请求元数据（MetadataTarget* 键）；
+// 拦截器额外将其写入当前 span 的 coord.target.* 属性，并让链在其后的拦截器通过 TargetFromContext 读取，
+// 便于灰度分析时把流量归因到具体实例。自行创建连接时应链在 tracing 拦截器之后，以便写入的是本次调用的 span。
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, h := withTargetHolder(ctx)
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		h.annotate(ctx)
+		return err
+	}
+}
+
+// StreamClientInterceptor 是 UnaryClientInterceptor 的流式版本，建立流时选中的实例写入 span
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, h := withTargetHolder(ctx)
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		h.annotate(ctx)
+		return stream, err
+	}
+}
+
+// UnaryServerInterceptor 返回服务端拦截器，将调用方选中的实例写入当前 span 的 coord.target.* 属性，
+// 服务端日志可以通过 TargetFromIncomingContext 读取同样的信息
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if target, ok := TargetFromIncomingContext(ctx); ok {
+			trace.SpanFromContext(ctx).SetAttributes(target.attributes()...)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor 是 UnaryServerInterceptor 的流式版本
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if target, ok := TargetFromIncomingContext(ss.Context()); ok {
+			trace.SpanFromContext(ss.Context()).SetAttributes(target.attributes()...)
+		}
+		return handler(srv, ss)
+	}
+}
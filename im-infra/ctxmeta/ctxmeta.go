@@ -0,0 +1,98 @@
+// Package ctxmeta 在上下文中携带跨组件共享的请求元数据（租户、操作人、请求 ID、会话 ID 等）。
+//
+// 所有元数据存放在同一个上下文键下，db、mq、metrics 都从这里读取：
+// 请求入口注入一次租户，写库时的租户列填充、发送消息时的租户头、指标的租户标签取到的都是同一个值。
+//
+// 示例：
+//
+//	ctx = ctxmeta.WithTenant(ctx, tenantID)
+//	ctx = ctxmeta.WithActor(ctx, userID)
+//	ctx = ctxmeta.WithRequestID(ctx, requestID)
+package ctxmeta
+
+import "context"
+
+// 组件共同使用的元数据字段名，同时也是 metrics 的标签名和请求头名（"x-" 加上把下划线换成连字符的字段名）
+const (
+	// TenantKey 租户 ID
+	TenantKey = "tenant_id"
+	// ActorKey 操作人，如用户 ID、管理员账号
+	ActorKey = "actor"
+	// RequestIDKey 请求 ID
+	RequestIDKey = "request_id"
+	// SessionIDKey 请求/会话 ID，用于写后读主库的会话粘滞
+	SessionIDKey = "session_id"
+)
+
+// metaKey 元数据的上下文键
+type metaKey struct{}
+
+// With 将一个元数据字段写入上下文，返回新的上下文，父上下文中的字段不受影响
+func With(ctx context.Context, key, value string) context.Context {
+	parent, _ := ctx.Value(metaKey{}).(map[string]string)
+	meta := make(map[string]string, len(parent)+1)
+	for k, v := range parent {
+		meta[k] = v
+	}
+	meta[key] = value
+	return context.WithValue(ctx, metaKey{}, meta)
+}
+
+// Get 返回上下文中的元数据字段值
+func Get(ctx context.Context, key string) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	meta, ok := ctx.Value(metaKey{}).(map[string]string)
+	if !ok {
+		return "", false
+	}
+	value, ok := meta[key]
+	return value, ok
+}
+
+// value 返回字段值，不存在时返回空字符串
+func value(ctx context.Context, key string) string {
+	v, _ := Get(ctx, key)
+	return v
+}
+
+// WithTenant 将租户 ID 写入上下文
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return With(ctx, TenantKey, tenant)
+}
+
+// Tenant 返回上下文中的租户 ID，未携带时返回空字符串
+func Tenant(ctx context.Context) string {
+	return value(ctx, TenantKey)
+}
+
+// WithActor 将操作人写入上下文
+func WithActor(ctx context.Context, actor string) context.Context {
+	return With(ctx, ActorKey, actor)
+}
+
+// Actor 返回上下文中的操作人，未携带时返回空字符串
+func Actor(ctx context.Context) string {
+	return value(ctx, ActorKey)
+}
+
+// WithRequestID 将请求 ID 写入上下文
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return With(ctx, RequestIDKey, requestID)
+}
+
+// RequestID 返回上下文中的请求 ID，未携带时返回空字符串
+func RequestID(ctx context.Context) string {
+	return value(ctx, RequestIDKey)
+}
+
+// WithSessionID 将会话 ID 写入上下文
+func WithSessionID(ctx context.Context, sessionID string) context.Context {
+	return With(ctx, SessionIDKey, sessionID)
+}
+
+// SessionID 返回上下文中的会话 ID，未携带时返回空字符串
+func SessionID(ctx context.Context) string {
+	return value(ctx, SessionIDKey)
+}
@@ -0,0 +1,37 @@
+package ctxmeta
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMeta(t *testing.T) {
+	ctx := context.Background()
+	_, ok := Get(ctx, TenantKey)
+	assert.False(t, ok)
+	assert.Empty(t, Tenant(ctx))
+
+	parent := WithTenant(ctx, "acme")
+	child := WithActor(WithRequestID(parent, "req-1"), "alice")
+	child = WithSessionID(child, "sess-1")
+	assert.Equal(t, "acme", Tenant(child))
+	assert.Equal(t, "alice", Actor(child))
+	assert.Equal(t, "req-1", RequestID(child))
+	assert.Equal(t, "sess-1", SessionID(child))
+
+	// 写入子上下文不影响父上下文
+	assert.Empty(t, Actor(parent))
+	assert.Equal(t, "globex", Tenant(WithTenant(child, "globex")))
+	assert.Equal(t, "acme", Tenant(child))
+
+	// 通用字段与专用函数共用同一份数据，空值也视为已设置
+	platform := With(child, "client_platform", "ios")
+	value, ok := Get(platform, "client_platform")
+	assert.True(t, ok)
+	assert.Equal(t, "ios", value)
+	value, ok = Get(With(platform, TenantKey, ""), TenantKey)
+	assert.True(t, ok)
+	assert.Empty(t, value)
+}
@@ -0,0 +1,168 @@
+// reshard 是分片表重分片（水平扩容）的命令行工具，按步骤驱动 db.Resharder。
+//
+// 用法：
+//
+//	reshard -dsn "user:pass@tcp(localhost:3306)/gochat?parseTime=True" \
+//	    -etcd localhost:2379 -key conversation_id -shards 4 -tables messages \
+//	    -to 16 -action start
+//
+// action 可选 start、copy、verify、run（依次执行 start/copy/verify）、cutover、abort、status。
+// 每一步都可以重复执行，copy 中断后再次执行会从配置中心保存的检查点继续。
+// cutover 会短暂阻断所有实例对迁移表的读写，需单独执行。
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/ceyewan/gochat/im-infra/coord"
+	"github.com/ceyewan/gochat/im-infra/db"
+)
+
+func main() {
+	var (
+		dsn         = flag.String("dsn", "", "MySQL DSN")
+		etcd        = flag.String("etcd", "localhost:2379", "etcd 地址，多个以逗号分隔")
+		shardingKey = flag.String("key", "", "分片键")
+		shards      = flag.Int("shards", 0, "当前分片数（与服务配置中的 NumberOfShards 一致）")
+		tables      = flag.String("tables", "", "分片表，多个以逗号分隔")
+		to          = flag.Int("to", 0, "目标分片数（start/run 时必填）")
+		primaryKey  = flag.String("pk", "id", "主键列")
+		stateKey    = flag.String("state-key", "db/reshard", "迁移状态在配置中心中的键")
+		chunkSize   = flag.Int("chunk", 1000, "每批拷贝和校验的行数")
+		grace       = flag.Duration("grace", 5*time.Second, "状态变更后等待所有实例生效的时间")
+		action      = flag.String("action", "status", "start | copy | verify | run | cutover | abort | status")
+	)
+	flag.Parse()
+
+	if *dsn == "" || *shardingKey == "" || *shards <= 0 || *tables == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	logger := clog.Namespace("reshard")
+
+	coordCfg := coord.DefaultConfig()
+	coordCfg.Endpoints = strings.Split(*etcd, ",")
+	coordinator, err := coord.New(ctx, &coordCfg, coord.WithLogger(logger))
+	if err != nil {
+		log.Fatalf("连接 etcd 失败: %v", err)
+	}
+	defer coordinator.Close()
+
+	cfg := db.MySQLConfig(*dsn)
+	cfg.LogLevel = "warn"
+	cfg.Sharding = db.NewShardingConfig(*shardingKey, *shards)
+	cfg.Sharding.Tables = map[string]*db.TableShardingConfig{}
+	for _, table := range strings.Split(*tables, ",") {
+		cfg.Sharding.Tables[strings.TrimSpace(table)] = &db.TableShardingConfig{}
+	}
+	cfg.Reshard = &db.ReshardConfig{
+		StateKey:    *stateKey,
+		GracePeriod: *grace,
+		ChunkSize:   *chunkSize,
+	}
+
+	provider, err := db.New(ctx, cfg, db.WithLogger(logger), db.WithReshardStore(coordinator.Config()))
+	if err != nil {
+		log.Fatalf("连接数据库失败: %v", err)
+	}
+	defer provider.Close()
+
+	resharder, err := provider.Resharder()
+	if err != nil {
+		log.Fatalf("获取重分片管理器失败: %v", err)
+	}
+
+	if err := run(ctx, resharder, *action, db.ReshardPlan{ToShards: *to, PrimaryKey: *primaryKey}); err != nil {
+		log.Fatalf("%s 失败: %v", *action, err)
+	}
+}
+
+// run 执行指定的步骤，完成后打印迁移状态
+func run(ctx context.Context, resharder db.Resharder, action string, plan db.ReshardPlan) error {
+	switch action {
+	case "start":
+		if err := resharder.Start(ctx, plan); err != nil {
+			return err
+		}
+	case "copy":
+		if err := resharder.Copy(ctx); err != nil {
+			return err
+		}
+	case "verify":
+		if err := verify(ctx, resharder); err != nil {
+			return err
+		}
+	case "run":
+		state, err := resharder.State(ctx)
+		if err != nil {
+			return err
+		}
+		if state == nil || state.Phase == db.ReshardPhaseDone {
+			if err := resharder.Start(ctx, plan); err != nil {
+				return err
+			}
+		}
+		if err := resharder.Copy(ctx); err != nil {
+			return err
+		}
+		if err := verify(ctx, resharder); err != nil {
+			return err
+		}
+	case "cutover":
+		if err := resharder.Cutover(ctx); err != nil {
+			return err
+		}
+	case "abort":
+		if err := resharder.Abort(ctx); err != nil {
+			return err
+		}
+	case "status":
+	default:
+		return fmt.Errorf("unknown action %q", action)
+	}
+	return printState(ctx, resharder)
+}
+
+// verify 执行校验，不一致时返回错误
+func verify(ctx context.Context, resharder db.Resharder) error {
+	report, err := resharder.Verify(ctx)
+	if err != nil {
+		return err
+	}
+	if !report.Consistent {
+		return errors.New("new shard layout is inconsistent, see verify report in state")
+	}
+	return nil
+}
+
+// printState 以 JSON 打印当前的迁移状态
+func printState(ctx context.Context, resharder db.Resharder) error {
+	state, err := resharder.State(ctx)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		fmt.Println("no reshard in progress")
+		return nil
+	}
+	out, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+	return nil
+}
@@ -1,10 +1,16 @@
 package db_test
 
 import (
+	"context"
+	"errors"
 	"testing"
 	"time"
 
+	"github.com/ceyewan/gochat/im-infra/clog"
 	"github.com/ceyewan/gochat/im-infra/db"
+	"github.com/ceyewan/gochat/im-infra/db/internal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -25,6 +31,10 @@ func TestGetDefaultConfig(t *testing.T) {
 		assert.False(t, cfg.EnableMetrics)
 		assert.False(t, cfg.EnableTracing)
 		assert.True(t, cfg.AutoCreateDatabase)
+		assert.False(t, cfg.ExplainSlowQueries) // EXPLAIN 需要显式开启
+		require.NotNil(t, cfg.Retry)
+		assert.Equal(t, 3, cfg.Retry.MaxAttempts)
+		assert.False(t, cfg.Retry.RetryWrites) // 默认仅重试查询
 		assert.Nil(t, cfg.Sharding) // 默认不分片
 	})
 
@@ -43,6 +53,9 @@ func TestGetDefaultConfig(t *testing.T) {
 		assert.True(t, cfg.EnableMetrics)
 		assert.True(t, cfg.EnableTracing)
 		assert.False(t, cfg.AutoCreateDatabase)
+		assert.False(t, cfg.ExplainSlowQueries)
+		require.NotNil(t, cfg.Retry)
+		assert.False(t, cfg.Retry.RetryWrites)
 		assert.Nil(t, cfg.Sharding)
 	})
 
@@ -207,4 +220,415 @@ func TestValidateShardingConfig(t *testing.T) {
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "number of shards must be greater than 0")
 	})
-}
\ No newline at end of file
+}
+
+func TestReplicaConfigValidation(t *testing.T) {
+	t.Run("ValidReplicas", func(t *testing.T) {
+		cfg := db.GetDefaultConfig("development")
+		cfg.Replicas = []string{"root:mysql@tcp(replica:3306)/gochat"}
+		cfg.StickyPrimaryWindow = 500 * time.Millisecond
+
+		require.NoError(t, db.ValidateConfig(&cfg))
+	})
+
+	t.Run("EmptyReplicaDSN", func(t *testing.T) {
+		cfg := db.GetDefaultConfig("development")
+		cfg.Replicas = []string{""}
+
+		assert.Error(t, db.ValidateConfig(&cfg))
+	})
+
+	t.Run("NegativeStickyWindow", func(t *testing.T) {
+		cfg := db.GetDefaultConfig("development")
+		cfg.StickyPrimaryWindow = -time.Second
+
+		assert.Error(t, db.ValidateConfig(&cfg))
+	})
+}
+
+func TestRetryConfigValidation(t *testing.T) {
+	t.Run("FillDefaults", func(t *testing.T) {
+		cfg := db.GetDefaultConfig("development")
+		cfg.Retry = &db.RetryConfig{RetryWrites: true}
+
+		require.NoError(t, db.ValidateConfig(&cfg))
+		assert.Equal(t, 3, cfg.Retry.MaxAttempts)
+		assert.Equal(t, 50*time.Millisecond, cfg.Retry.InitialBackoff)
+		assert.Equal(t, time.Second, cfg.Retry.MaxBackoff)
+		assert.True(t, cfg.Retry.RetryWrites)
+	})
+
+	t.Run("MaxBackoffBelowInitial", func(t *testing.T) {
+		cfg := db.GetDefaultConfig("development")
+		cfg.Retry = &db.RetryConfig{InitialBackoff: 2 * time.Second, MaxBackoff: time.Second}
+
+		require.NoError(t, db.ValidateConfig(&cfg))
+		assert.Equal(t, 2*time.Second, cfg.Retry.MaxBackoff)
+	})
+
+	t.Run("NegativeAttempts", func(t *testing.T) {
+		cfg := db.GetDefaultConfig("development")
+		cfg.Retry = &db.RetryConfig{MaxAttempts: -1}
+
+		err := db.ValidateConfig(&cfg)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid retry config")
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		cfg := db.GetDefaultConfig("development")
+		cfg.Retry = nil
+
+		assert.NoError(t, db.ValidateConfig(&cfg))
+	})
+}
+
+func TestAuditConfigValidation(t *testing.T) {
+	t.Run("FillDefaults", func(t *testing.T) {
+		cfg := db.GetDefaultConfig("development")
+		cfg.Audit = &db.AuditConfig{
+			Models: map[string]*db.AuditModelConfig{
+				"messages": {Retention: 24 * time.Hour},
+				"users":    nil,
+			},
+		}
+
+		require.NoError(t, db.ValidateConfig(&cfg))
+		assert.Equal(t, "audit_logs", cfg.Audit.TableName)
+		assert.Equal(t, 1000, cfg.Audit.MaxRowsPerStatement)
+		assert.False(t, cfg.Audit.RequireActor)
+	})
+
+	t.Run("NegativeRetention", func(t *testing.T) {
+		cfg := db.GetDefaultConfig("development")
+		cfg.Audit = db.DefaultAuditConfig()
+		cfg.Audit.Models["messages"] = &db.AuditModelConfig{Retention: -time.Hour}
+
+		err := db.ValidateConfig(&cfg)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid audit config")
+	})
+
+	t.Run("AuditTableItself", func(t *testing.T) {
+		cfg := db.GetDefaultConfig("development")
+		cfg.Audit = db.DefaultAuditConfig()
+		cfg.Audit.Models["audit_logs"] = &db.AuditModelConfig{}
+
+		assert.Error(t, db.ValidateConfig(&cfg))
+	})
+
+	t.Run("DisabledByDefault", func(t *testing.T) {
+		cfg := db.GetDefaultConfig("production")
+		assert.Nil(t, cfg.Audit)
+	})
+}
+
+func TestStampConfigValidation(t *testing.T) {
+	t.Run("FillDefaults", func(t *testing.T) {
+		cfg := db.GetDefaultConfig("development")
+		cfg.Stamp = &db.StampConfig{UpdatedByColumn: "modifier_id", RequireActor: true}
+
+		require.NoError(t, db.ValidateConfig(&cfg))
+		assert.Equal(t, "created_by", cfg.Stamp.CreatedByColumn)
+		assert.Equal(t, "modifier_id", cfg.Stamp.UpdatedByColumn)
+		assert.Equal(t, "tenant_id", cfg.Stamp.TenantColumn)
+	})
+
+	t.Run("TenantColumnConflict", func(t *testing.T) {
+		cfg := db.GetDefaultConfig("development")
+		cfg.Stamp = db.DefaultStampConfig()
+		cfg.Stamp.TenantColumn = "created_by"
+
+		err := db.ValidateConfig(&cfg)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid stamp config")
+	})
+
+	t.Run("DisabledByDefault", func(t *testing.T) {
+		cfg := db.GetDefaultConfig("production")
+		assert.Nil(t, cfg.Stamp)
+	})
+}
+
+func TestQueryCacheConfigValidation(t *testing.T) {
+	t.Run("FillDefaults", func(t *testing.T) {
+		cfg := db.GetDefaultConfig("development")
+		cfg.QueryCache = &db.QueryCacheConfig{MaxTTL: 30 * time.Second}
+
+		require.NoError(t, db.ValidateConfig(&cfg))
+		assert.Equal(t, "dbcache", cfg.QueryCache.KeyPrefix)
+		assert.Equal(t, 1<<20, cfg.QueryCache.MaxResultBytes)
+		// 默认 TTL 不超过 MaxTTL
+		assert.Equal(t, 30*time.Second, cfg.QueryCache.DefaultTTL)
+	})
+
+	t.Run("NegativeTTL", func(t *testing.T) {
+		cfg := db.GetDefaultConfig("development")
+		cfg.QueryCache = db.DefaultQueryCacheConfig()
+		cfg.QueryCache.DefaultTTL = -time.Second
+
+		err := db.ValidateConfig(&cfg)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid query cache config")
+	})
+
+	t.Run("DisabledByDefault", func(t *testing.T) {
+		cfg := db.GetDefaultConfig("production")
+		assert.Nil(t, cfg.QueryCache)
+	})
+}
+
+func TestTableOptionsConfigValidation(t *testing.T) {
+	t.Run("DefaultUTF8MB4", func(t *testing.T) {
+		cfg := db.GetDefaultConfig("production")
+		require.NotNil(t, cfg.TableOptions)
+		assert.Equal(t, "ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci", cfg.TableOptions.Default.SQL())
+		assert.Equal(t, db.TableDriftWarn, cfg.TableOptions.OnDrift)
+	})
+
+	t.Run("TableOverride", func(t *testing.T) {
+		cfg := db.GetDefaultConfig("development")
+		cfg.TableOptions.OnDrift = ""
+		cfg.TableOptions.Tables = map[string]*db.TableOptions{
+			"messages": {RowFormat: "COMPRESSED", Partition: "PARTITION BY HASH(id) PARTITIONS 8"},
+		}
+
+		require.NoError(t, db.ValidateConfig(&cfg))
+		assert.Equal(t, db.TableDriftWarn, cfg.TableOptions.OnDrift)
+	})
+
+	t.Run("CollationMismatch", func(t *testing.T) {
+		cfg := db.GetDefaultConfig("development")
+		cfg.TableOptions.Tables = map[string]*db.TableOptions{
+			"users": {Collation: "utf8_general_ci"},
+		}
+
+		err := db.ValidateConfig(&cfg)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "does not belong to charset")
+	})
+
+	t.Run("InvalidPolicy", func(t *testing.T) {
+		cfg := db.GetDefaultConfig("development")
+		cfg.TableOptions.OnDrift = "ignore"
+
+		err := db.ValidateConfig(&cfg)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid table options config")
+	})
+}
+
+func TestSQLLogger(t *testing.T) {
+	t.Run("ParamsModeDefaults", func(t *testing.T) {
+		assert.Equal(t, db.SQLParamsFull, db.GetDefaultConfig("development").SQLParams)
+		assert.Equal(t, db.SQLParamsElide, db.GetDefaultConfig("production").SQLParams)
+
+		cfg := db.GetDefaultConfig("production")
+		cfg.DSN = "user:pass@tcp(localhost:3306)/test"
+		cfg.SQLParams = ""
+		require.NoError(t, db.ValidateConfig(&cfg))
+		assert.Equal(t, db.SQLParamsElide, cfg.SQLParams)
+
+		cfg.SQLParams = "mask"
+		assert.Error(t, db.ValidateConfig(&cfg))
+	})
+
+	t.Run("ParamsFilter", func(t *testing.T) {
+		cfg := db.GetDefaultConfig("production")
+		at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		params := []interface{}{"13800000000", []byte("hello"), 42, at}
+
+		filter := func(mode string) []interface{} {
+			cfg.SQLParams = mode
+			l := internal.NewClogLogger(clog.Namespace("db"), cfg).(gorm.ParamsFilter)
+			_, filtered := l.ParamsFilter(context.Background(), "SELECT ?", params...)
+			return filtered
+		}
+		assert.Nil(t, filter(db.SQLParamsElide))
+		assert.Equal(t, []interface{}{"***", "***", 42, at}, filter(db.SQLParamsRedact))
+		assert.Equal(t, params, filter(db.SQLParamsFull))
+	})
+
+	t.Run("Trace", func(t *testing.T) {
+		logs := clog.NewTestLogger(t)
+		cfg := db.GetDefaultConfig("development")
+		cfg.SlowThreshold = 50 * time.Millisecond
+		l := internal.NewClogLogger(clog.Namespace("db"), cfg)
+
+		ctx := clog.WithTraceID(context.Background(), "trace-1")
+		fc := func() (string, int64) { return "SELECT * FROM users WHERE id = ?", 1 }
+		l.Trace(ctx, time.Now(), fc, nil)
+		l.Trace(ctx, time.Now().Add(-time.Second), fc, nil)
+		l.Trace(ctx, time.Now(), fc, errors.New("deadlock"))
+		l.Trace(ctx, time.Now(), fc, gorm.ErrRecordNotFound)
+
+		sqlFields := []clog.Field{clog.String("namespace", "db.sql"), clog.String("trace_id", "trace-1")}
+		logs.AssertLogged("debug", "SQL 执行", sqlFields...)
+		logs.AssertLogged("warn", "慢查询", append(sqlFields, clog.Duration("threshold", 50*time.Millisecond))...)
+		logs.AssertLogged("error", "SQL 执行错误", append(sqlFields, clog.Err(errors.New("deadlock")))...)
+		assert.Len(t, logs.Find("error", ""), 1)
+
+		// warn 级别下普通查询不记录，也不拼接 SQL
+		logs.Reset()
+		called := false
+		l.LogMode(logger.Warn).Trace(ctx, time.Now(), func() (string, int64) {
+			called = true
+			return "", 0
+		}, nil)
+		assert.False(t, called)
+		assert.Empty(t, logs.Entries())
+	})
+}
+
+func TestReshardConfigValidation(t *testing.T) {
+	t.Run("FillDefaults", func(t *testing.T) {
+		cfg := db.GetDefaultConfig("development")
+		cfg.Sharding = db.NewShardingConfig("conversation_id", 4)
+		cfg.Reshard = &db.ReshardConfig{ChunkSize: 500}
+
+		require.NoError(t, db.ValidateConfig(&cfg))
+		assert.Equal(t, "db/reshard", cfg.Reshard.StateKey)
+		assert.Equal(t, 5*time.Second, cfg.Reshard.GracePeriod)
+		assert.Equal(t, 500, cfg.Reshard.ChunkSize)
+	})
+
+	t.Run("RequiresSharding", func(t *testing.T) {
+		cfg := db.GetDefaultConfig("development")
+		cfg.Reshard = db.DefaultReshardConfig()
+
+		err := db.ValidateConfig(&cfg)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid reshard config")
+	})
+
+	t.Run("NegativeGracePeriod", func(t *testing.T) {
+		cfg := db.GetDefaultConfig("development")
+		cfg.Sharding = db.NewShardingConfig("conversation_id", 4)
+		cfg.Reshard = db.DefaultReshardConfig()
+		cfg.Reshard.GracePeriod = -time.Second
+
+		assert.Error(t, db.ValidateConfig(&cfg))
+	})
+}
+
+func TestCredentialsConfigValidation(t *testing.T) {
+	t.Run("FillDefaults", func(t *testing.T) {
+		cfg := db.GetDefaultConfig("development")
+		cfg.DSN = ""
+		cfg.Credentials = &db.CredentialsConfig{ConfigKey: "db/credentials"}
+
+		require.NoError(t, db.ValidateConfig(&cfg))
+		assert.Equal(t, time.Minute, cfg.Credentials.RefreshInterval)
+		assert.Equal(t, 5*time.Second, cfg.Credentials.VerifyTimeout)
+	})
+
+	t.Run("NegativeRefreshInterval", func(t *testing.T) {
+		cfg := db.GetDefaultConfig("development")
+		cfg.Credentials = db.DefaultCredentialsConfig()
+		cfg.Credentials.RefreshInterval = -time.Second
+
+		err := db.ValidateConfig(&cfg)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid credentials config")
+	})
+
+	t.Run("RequiresSource", func(t *testing.T) {
+		cfg := db.GetDefaultConfig("development")
+		cfg.Credentials = db.DefaultCredentialsConfig()
+
+		_, err := db.New(context.Background(), cfg)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "credential rotation")
+
+		cfg.Credentials.ConfigKey = "db/credentials"
+		_, err = db.New(context.Background(), cfg)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "no config center")
+	})
+
+	t.Run("SecretProviderError", func(t *testing.T) {
+		cfg := db.GetDefaultConfig("development")
+		cfg.Credentials = db.DefaultCredentialsConfig()
+
+		_, err := db.New(context.Background(), cfg, db.WithSecretProvider(
+			db.SecretProviderFunc(func(ctx context.Context) (db.Credentials, error) {
+				return db.Credentials{}, errors.New("vault sealed")
+			})))
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "vault sealed")
+	})
+}
+
+func TestOnlineDDLConfigValidation(t *testing.T) {
+	t.Run("FillDefaults", func(t *testing.T) {
+		cfg := db.GetDefaultConfig("development")
+		cfg.OnlineDDL = &db.OnlineDDLConfig{Tool: db.OnlineDDLToolPTOSC, ChunkSize: 500}
+
+		require.NoError(t, db.ValidateConfig(&cfg))
+		assert.Equal(t, "pt-online-schema-change", cfg.OnlineDDL.Binary)
+		assert.Equal(t, int64(1000000), cfg.OnlineDDL.MinRows)
+		assert.Equal(t, 500, cfg.OnlineDDL.ChunkSize)
+		assert.Equal(t, "Threads_running=25", cfg.OnlineDDL.MaxLoad)
+		assert.NotEmpty(t, cfg.OnlineDDL.WorkDir)
+	})
+
+	t.Run("UnknownTool", func(t *testing.T) {
+		cfg := db.GetDefaultConfig("development")
+		cfg.OnlineDDL = db.DefaultOnlineDDLConfig()
+		cfg.OnlineDDL.Tool = "lhm"
+
+		err := db.ValidateConfig(&cfg)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid online ddl config")
+	})
+
+	t.Run("NegativeMinRows", func(t *testing.T) {
+		cfg := db.GetDefaultConfig("development")
+		cfg.OnlineDDL = db.DefaultOnlineDDLConfig()
+		cfg.OnlineDDL.MinRows = -1
+
+		assert.Error(t, db.ValidateConfig(&cfg))
+	})
+}
+
+func TestBreakerConfigValidation(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		cfg := db.GetDefaultConfig("development")
+		cfg.Breaker = db.DefaultBreakerConfig()
+
+		require.NoError(t, db.ValidateConfig(&cfg))
+		assert.Equal(t, "db-read", cfg.Breaker.Read)
+		assert.Equal(t, "db-write", cfg.Breaker.Write)
+		assert.Equal(t, "db-migration", cfg.Breaker.Migration)
+	})
+
+	t.Run("ReadOnly", func(t *testing.T) {
+		cfg := db.GetDefaultConfig("development")
+		cfg.Breaker = &db.BreakerConfig{Read: "user-db-read"}
+
+		assert.NoError(t, db.ValidateConfig(&cfg))
+	})
+
+	t.Run("NoGroups", func(t *testing.T) {
+		cfg := db.GetDefaultConfig("development")
+		cfg.Breaker = &db.BreakerConfig{FailureCodes: []uint16{1205}}
+
+		err := db.ValidateConfig(&cfg)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid breaker config")
+	})
+}
+
+func TestExplainResult(t *testing.T) {
+	result := &db.ExplainResult{
+		Rows: []db.ExplainRow{
+			{ID: 1, SelectType: "SIMPLE", Table: "users", Type: "ref", Key: "idx_users_email", Rows: 1},
+			{ID: 1, SelectType: "SIMPLE", Table: "orders", Type: "ALL", Rows: 1000, Extra: "Using where; Using filesort"},
+		},
+	}
+
+	assert.True(t, result.UsesIndex("idx_users_email"))
+	assert.False(t, result.UsesIndex("idx_orders_user_id"))
+	assert.True(t, result.HasFullTableScan())
+	assert.True(t, result.HasFilesort())
+}
@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"time"
 
 	"github.com/ceyewan/gochat/im-infra/clog"
 	"github.com/ceyewan/gochat/im-infra/db/internal"
@@ -21,6 +22,200 @@ type ShardingConfig = internal.ShardingConfig
 // TableShardingConfig 表分片配置
 type TableShardingConfig = internal.TableShardingConfig
 
+// ExplainResult 是一次 EXPLAIN 的结果，包含执行计划和索引建议
+type ExplainResult = internal.ExplainResult
+
+// ExplainRow 是 MySQL EXPLAIN 输出中的一行
+type ExplainRow = internal.ExplainRow
+
+// RetryConfig 语句级重试配置
+type RetryConfig = internal.RetryConfig
+
+// RetryStats 语句级重试统计信息
+type RetryStats = internal.RetryStats
+
+// BreakerConfig 熔断配置
+type BreakerConfig = internal.BreakerConfig
+
+// AuditConfig 审计日志配置
+type AuditConfig = internal.AuditConfig
+
+// AuditModelConfig 单张表的审计策略
+type AuditModelConfig = internal.AuditModelConfig
+
+// StampConfig 写入人填充配置
+type StampConfig = internal.StampConfig
+
+// StampResolver 从上下文中解析写入 created_by/updated_by 的操作人和写入 tenant_id 的租户
+type StampResolver = internal.StampResolver
+
+// RowScopeConfig 行级过滤配置
+type RowScopeConfig = internal.RowScopeConfig
+
+// RowScope 是模型登记的一条强制行级过滤条件
+type RowScope = internal.RowScope
+
+// RowScoped 由需要强制行级过滤的模型实现，查询、更新和删除时自动附加 RowScopes 返回的条件。
+//
+// 示例：
+//
+//	func (Message) RowScopes() []db.RowScope {
+//	    return []db.RowScope{db.TenantScope("tenant_id"), db.NotDeletedScope("deleted_at")}
+//	}
+type RowScoped = internal.RowScoped
+
+// QueryCacheConfig 查询结果缓存配置
+type QueryCacheConfig = internal.QueryCacheConfig
+
+// TableOptionsConfig 表选项配置
+type TableOptionsConfig = internal.TableOptionsConfig
+
+// TableOptions 建表时使用的表选项（引擎、字符集、排序规则、行格式、分区子句）
+type TableOptions = internal.TableOptions
+
+// TableOptioner 由模型实现，声明该模型对应表的表选项
+type TableOptioner = internal.TableOptioner
+
+// TableOptionsReport 表选项校验报告
+type TableOptionsReport = internal.TableOptionsReport
+
+// TableDrift 一项表选项漂移
+type TableDrift = internal.TableDrift
+
+// 表选项漂移的处理策略
+const (
+	TableDriftWarn = internal.TableDriftWarn
+	TableDriftFail = internal.TableDriftFail
+	TableDriftFix  = internal.TableDriftFix
+)
+
+// SQL 日志中绑定参数的输出方式，见 Config.SQLParams
+const (
+	SQLParamsElide  = internal.SQLParamsElide
+	SQLParamsRedact = internal.SQLParamsRedact
+	SQLParamsFull   = internal.SQLParamsFull
+)
+
+// ErrTableOptionsDrift 已存在的表与声明的表选项不一致，且策略为 TableDriftFail
+var ErrTableOptionsDrift = internal.ErrTableOptionsDrift
+
+// Resharder 管理分片表的重分片：双写、分批拷贝、校验和切换
+type Resharder = internal.Resharder
+
+// ReshardConfig 重分片配置
+type ReshardConfig = internal.ReshardConfig
+
+// ReshardPlan 重分片计划
+type ReshardPlan = internal.ReshardPlan
+
+// ReshardState 保存在配置中心的迁移状态
+type ReshardState = internal.ReshardState
+
+// ReshardCheckpoint 一张源分片表的拷贝进度
+type ReshardCheckpoint = internal.ReshardCheckpoint
+
+// ReshardVerifyReport 新旧分片布局的校验报告
+type ReshardVerifyReport = internal.ReshardVerifyReport
+
+// 重分片的阶段
+const (
+	ReshardPhaseDualWrite = internal.ReshardPhaseDualWrite
+	ReshardPhaseCopying   = internal.ReshardPhaseCopying
+	ReshardPhaseCopied    = internal.ReshardPhaseCopied
+	ReshardPhaseVerified  = internal.ReshardPhaseVerified
+	ReshardPhaseCutover   = internal.ReshardPhaseCutover
+	ReshardPhaseDone      = internal.ReshardPhaseDone
+)
+
+// ErrShardingNotConfigured 未配置 Config.Sharding
+var ErrShardingNotConfigured = internal.ErrShardingNotConfigured
+
+// 重分片相关错误
+var (
+	// ErrReshardNotConfigured 未配置 Config.Reshard 或未通过 WithReshardStore 注入配置中心
+	ErrReshardNotConfigured = internal.ErrReshardNotConfigured
+	// ErrReshardNotStarted 尚未开始重分片
+	ErrReshardNotStarted = internal.ErrReshardNotStarted
+	// ErrReshardPhase 当前阶段不允许执行该操作
+	ErrReshardPhase = internal.ErrReshardPhase
+	// ErrReshardCutover 迁移表正在切换到新的分片布局，稍后重试
+	ErrReshardCutover = internal.ErrReshardCutover
+)
+
+// CredentialsConfig 凭据轮换配置
+type CredentialsConfig = internal.CredentialsConfig
+
+// Credentials 数据库凭据（DSN、用户名、密码），空字段表示沿用 Config 中的值
+type Credentials = internal.Credentials
+
+// SecretProvider 提供数据库凭据，通常基于 Vault 等密钥管理服务实现
+type SecretProvider = internal.SecretProvider
+
+// SecretProviderFunc 将普通函数适配为 SecretProvider
+type SecretProviderFunc func(ctx context.Context) (Credentials, error)
+
+// Credentials 实现 SecretProvider 接口
+func (f SecretProviderFunc) Credentials(ctx context.Context) (Credentials, error) {
+	return f(ctx)
+}
+
+// OnlineDDLConfig 在线 DDL 配置
+type OnlineDDLConfig = internal.OnlineDDLConfig
+
+// OnlineDDL 通过 gh-ost 或 pt-online-schema-change 执行大表结构变更
+type OnlineDDL = internal.OnlineDDL
+
+// DDLMigration 是一次正在执行的表结构变更，可查询进度、暂停和恢复切换
+type DDLMigration = internal.DDLMigration
+
+// DDLProgress 在线 DDL 的执行进度
+type DDLProgress = internal.DDLProgress
+
+// 在线 DDL 工具和执行方式
+const (
+	OnlineDDLToolGhost = internal.OnlineDDLToolGhost
+	OnlineDDLToolPTOSC = internal.OnlineDDLToolPTOSC
+	DDLMethodDirect    = internal.DDLMethodDirect
+)
+
+// 在线 DDL 的执行状态
+const (
+	DDLStateRunning   = internal.DDLStateRunning
+	DDLStatePostponed = internal.DDLStatePostponed
+	DDLStateDone      = internal.DDLStateDone
+	DDLStateFailed    = internal.DDLStateFailed
+)
+
+// 在线 DDL 相关错误
+var (
+	// ErrOnlineDDLNotConfigured 未配置 Config.OnlineDDL
+	ErrOnlineDDLNotConfigured = internal.ErrOnlineDDLNotConfigured
+	// ErrCutoverControlUnsupported 当前工具不支持暂停切换，仅 gh-ost 支持
+	ErrCutoverControlUnsupported = internal.ErrCutoverControlUnsupported
+)
+
+// AuditLog 是审计日志表中的一条记录
+type AuditLog = internal.AuditLog
+
+// 审计记录的操作类型
+const (
+	AuditActionCreate = internal.AuditActionCreate
+	AuditActionUpdate = internal.AuditActionUpdate
+	AuditActionDelete = internal.AuditActionDelete
+)
+
+// ErrAuditActorRequired 开启 AuditConfig.RequireActor 时，上下文中缺少操作人
+var ErrAuditActorRequired = internal.ErrAuditActorRequired
+
+// 开启 StampConfig 的强制校验时，上下文中缺少操作人或租户
+var (
+	ErrStampActorRequired  = internal.ErrStampActorRequired
+	ErrStampTenantRequired = internal.ErrStampTenantRequired
+)
+
+// ErrRowScopeViolation 模型登记了行级过滤，但上下文中缺少过滤所需的值（如租户）
+var ErrRowScopeViolation = internal.ErrRowScopeViolation
+
 // New 根据提供的配置创建一个新的 Provider 实例。
 // 这是创建数据库实例的唯一入口，移除了全局方法以推动依赖注入。
 //
@@ -106,7 +301,84 @@ func New(ctx context.Context, cfg Config, opts ...Option) (Provider, error) {
 		clog.Int("maxIdleConns", cfg.MaxIdleConns),
 	)
 
-	return internal.NewDB(cfg, componentLogger)
+	return internal.NewDB(cfg, componentLogger, p.queryCacheStore, p.reshardStore, p.credentialStore, p.secretProvider, p.breakers, p.stampResolver, p.rowScopedModels)
+}
+
+// WithPrimary 返回一个强制在主库执行查询的上下文。
+// 配置了只读副本时，用于需要读到最新写入数据的场景。
+//
+// 示例：
+//
+//	gormDB := database.DB(db.WithPrimary(ctx))
+func WithPrimary(ctx context.Context) context.Context {
+	return internal.WithPrimary(ctx)
+}
+
+// WithSessionID 将请求/会话 ID 注入上下文。
+// 配置了 StickyPrimaryWindow 时，同一会话写入后的时间窗口内查询自动路由到主库，
+// 保证用户能立即看到自己刚发送的消息。通常在请求入口处调用。
+func WithSessionID(ctx context.Context, sessionID string) context.Context {
+	return internal.WithSessionID(ctx, sessionID)
+}
+
+// WithActor 将操作人（如用户 ID、管理员账号）注入上下文。
+// 开启审计后，对登记表的变更会将其记录为审计日志的 Actor。
+// 等价于 ctxmeta.WithActor，已通过 ctxmeta 注入操作人时无需再调用。
+//
+// 示例：
+//
+//	ctx = db.WithActor(ctx, adminID)
+//	err := database.DB(ctx).Delete(&Message{}, msgID).Error
+func WithActor(ctx context.Context, actor string) context.Context {
+	return internal.WithActor(ctx, actor)
+}
+
+// WithTenant 将租户 ID 注入上下文。
+// 开启写入人填充后，插入声明了租户列的模型时将其写入该列；登记了 TenantScope 的模型按其过滤。
+// 等价于 ctxmeta.WithTenant，mq 的租户消息头和 metrics 的租户标签读取的是同一个值。
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return internal.WithTenant(ctx, tenant)
+}
+
+// WithoutRowScopes 返回豁免行级过滤的上下文，names 为空时豁免所有过滤，否则只豁免同名的 RowScope。
+// 用于后台任务、跨租户的运营查询等明确需要越过过滤的场景，每条被豁免的语句都会连同 reason 记录日志。
+//
+// 示例：
+//
+//	ctx := db.WithoutRowScopes(ctx, "nightly usage report", "tenant")
+//	err := database.DB(ctx).Model(&Message{}).Group("tenant_id").Count(&total).Error
+func WithoutRowScopes(ctx context.Context, reason string, names ...string) context.Context {
+	return internal.WithoutRowScopes(ctx, reason, names...)
+}
+
+// TenantScope 返回按租户过滤的 RowScope（名称 "tenant"）：column 等于上下文中的租户。
+// 租户来自 WithTenant 或 WithStampResolver，上下文中没有租户时语句返回 ErrRowScopeViolation。
+func TenantScope(column string) RowScope {
+	return internal.TenantScope(column)
+}
+
+// NotDeletedScope 返回排除软删除行的 RowScope（名称 "not_deleted"）：column IS NULL。
+// gorm 的 Unscoped() 不会绕过它，需要读取已删除的行时使用 WithoutRowScopes。
+func NotDeletedScope(column string) RowScope {
+	return internal.NotDeletedScope(column)
+}
+
+// WithRequestID 将请求 ID 注入上下文，开启审计后记录为审计日志的 RequestID，
+// 便于将数据变更与网关日志、调用链关联。等价于 ctxmeta.WithRequestID。
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return internal.WithRequestID(ctx, requestID)
+}
+
+// WithQueryCache 标记该上下文中的查询使用结果缓存，需开启 Config.QueryCache。
+// ttl 为 0 时使用默认时长，超过 MaxTTL 时截断；tables 为查询额外依赖的表（如 JOIN 的表）。
+// 事务内的查询不使用缓存。
+//
+// 示例：
+//
+//	ctx := db.WithQueryCache(ctx, 30*time.Second)
+//	err := database.DB(ctx).Where("group_id = ?", groupID).Find(&members).Error
+func WithQueryCache(ctx context.Context, ttl time.Duration, tables ...string) context.Context {
+	return internal.WithQueryCache(ctx, ttl, tables...)
 }
 
 // DefaultConfig 返回一个带有合理默认值的 Config。
@@ -136,3 +408,57 @@ func DefaultConfig() Config {
 func GetDefaultConfig(env string) Config {
 	return internal.GetDefaultConfig(env)
 }
+
+// DefaultReshardConfig 返回默认的重分片配置：状态键 "db/reshard"，
+// 状态变更后等待 5 秒使所有实例生效，每批拷贝 1000 行。
+func DefaultReshardConfig() *ReshardConfig {
+	return internal.DefaultReshardConfig()
+}
+
+// DefaultRetryConfig 返回默认的语句级重试配置：最多执行 3 次，
+// 退避从 50 毫秒开始翻倍至 1 秒，仅重试查询。
+func DefaultRetryConfig() *RetryConfig {
+	return internal.DefaultRetryConfig()
+}
+
+// DefaultBreakerConfig 返回默认的熔断配置：读、写、迁移分别使用
+// "db-read"、"db-write"、"db-migration" 熔断器，策略在 breaker 组件中按名称配置。
+func DefaultBreakerConfig() *BreakerConfig {
+	return internal.DefaultBreakerConfig()
+}
+
+// DefaultStampConfig 返回默认的写入人填充配置：填充 created_by、updated_by 和 tenant_id 列，
+// 不强制要求上下文中携带操作人和租户
+func DefaultStampConfig() *StampConfig {
+	return internal.DefaultStampConfig()
+}
+
+// DefaultAuditConfig 返回默认的审计日志配置：记录写入 audit_logs 表、永久保留，
+// 单条语句最多审计 1000 行。需要在 Models 中登记需要审计的表。
+func DefaultAuditConfig() *AuditConfig {
+	return internal.DefaultAuditConfig()
+}
+
+// DefaultQueryCacheConfig 返回默认的查询结果缓存配置：默认缓存 1 分钟，
+// 单个查询最多缓存 10 分钟，结果超过 1MB 时不缓存。
+func DefaultQueryCacheConfig() *QueryCacheConfig {
+	return internal.DefaultQueryCacheConfig()
+}
+
+// DefaultCredentialsConfig 返回默认的凭据轮换配置：每分钟轮询一次 SecretProvider，
+// 切换前用新凭据建立测试连接，超时 5 秒。
+func DefaultCredentialsConfig() *CredentialsConfig {
+	return internal.DefaultCredentialsConfig()
+}
+
+// DefaultTableOptionsConfig 返回默认的表选项配置：ENGINE=InnoDB、utf8mb4、utf8mb4_unicode_ci，
+// 已有表与声明不一致时只记录告警。
+func DefaultTableOptionsConfig() *TableOptionsConfig {
+	return internal.DefaultTableOptionsConfig()
+}
+
+// DefaultOnlineDDLConfig 返回默认的在线 DDL 配置：使用 gh-ost，估算行数不少于 100 万的表走在线 DDL，
+// 每批拷贝 1000 行，主库 Threads_running 超过 25 时暂停拷贝。
+func DefaultOnlineDDLConfig() *OnlineDDLConfig {
+	return internal.DefaultOnlineDDLConfig()
+}
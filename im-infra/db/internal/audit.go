@@ -0,0 +1,547 @@
+package internal
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/ceyewan/gochat/im-infra/ctxmeta"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 审计记录的操作类型
+const (
+	AuditActionCreate = "create"
+	AuditActionUpdate = "update"
+	AuditActionDelete = "delete"
+)
+
+const (
+	// auditBeforeKey 保存变更前快照的 Statement 实例键
+	auditBeforeKey = "db:audit_before"
+	// auditPurgeBatchSize 清理过期审计记录时每批删除的行数，避免长时间锁表
+	auditPurgeBatchSize = 1000
+)
+
+// ErrAuditActorRequired 开启 RequireActor 时，上下文中缺少操作人
+var ErrAuditActorRequired = errors.New("db: audit actor is required")
+
+// AuditLog 是审计日志表中的一条记录，每条记录对应一行数据的一次变更
+type AuditLog struct {
+	ID uint64 `gorm:"primaryKey;autoIncrement"`
+	// Table 被变更的表名
+	Table string `gorm:"column:table_name;size:128;not null;index:idx_audit_record,priority:1"`
+	// RecordID 被变更行的主键，复合主键以逗号连接
+	RecordID string `gorm:"size:128;not null;index:idx_audit_record,priority:2"`
+	// Action 操作类型：create、update、delete
+	Action string `gorm:"size:16;not null"`
+	// Actor 操作人，来自 WithActor
+	Actor string `gorm:"size:128;index"`
+	// RequestID 请求 ID，来自 WithRequestID
+	RequestID string `gorm:"size:128;index"`
+	// ChangedColumns 变更的列，JSON 数组
+	ChangedColumns string `gorm:"type:text"`
+	// Before 变更前的快照，JSON 对象，create 时为空
+	Before string `gorm:"type:longtext"`
+	// After 变更后的快照，JSON 对象，delete 时为空
+	After string `gorm:"type:longtext"`
+	// CreatedAt 变更时间
+	CreatedAt time.Time `gorm:"not null;index"`
+}
+
+// WithActor 将操作人注入上下文，写入审计记录
+func WithActor(ctx context.Context, actor string) context.Context {
+	return ctxmeta.WithActor(ctx, actor)
+}
+
+// WithRequestID 将请求 ID 注入上下文，写入审计记录
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return ctxmeta.WithRequestID(ctx, requestID)
+}
+
+// actorFromContext 从上下文获取操作人
+func actorFromContext(ctx context.Context) string {
+	return ctxmeta.Actor(ctx)
+}
+
+// requestIDFromContext 从上下文获取请求 ID
+func requestIDFromContext(ctx context.Context) string {
+	return ctxmeta.RequestID(ctx)
+}
+
+// auditPlugin 基于 GORM 回调记录登记表的变更。
+// 变更前快照在语句执行前查询，变更后快照在语句执行后查询或从模型中提取，
+// 审计记录与业务语句处于 GORM 默认事务（或调用方事务）中，审计写入失败会回滚业务变更。
+type auditPlugin struct {
+	cfg    AuditConfig
+	logger clog.Logger
+}
+
+// newAuditPlugin 创建审计插件
+func newAuditPlugin(cfg AuditConfig, logger clog.Logger) *auditPlugin {
+	return &auditPlugin{
+		cfg:    cfg,
+		logger: logger,
+	}
+}
+
+// register 创建审计日志表并注册回调，回调均位于事务提交之前
+func (p *auditPlugin) register(db *gorm.DB) error {
+	if err := db.Table(p.cfg.TableName).AutoMigrate(&AuditLog{}); err != nil {
+		return fmt.Errorf("failed to migrate audit table: %w", err)
+	}
+
+	if err := db.Callback().Create().After("gorm:create").Before("gorm:commit_or_rollback_transaction").
+		Register("db:audit_after", p.afterCreate); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().Before("gorm:update").After("gorm:begin_transaction").
+		Register("db:audit_before", p.captureBefore); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().After("gorm:update").Before("gorm:commit_or_rollback_transaction").
+		Register("db:audit_after", p.afterUpdate); err != nil {
+		return err
+	}
+	if err := db.Callback().Delete().Before("gorm:delete").After("gorm:begin_transaction").
+		Register("db:audit_before", p.captureBefore); err != nil {
+		return err
+	}
+	return db.Callback().Delete().After("gorm:delete").Before("gorm:commit_or_rollback_transaction").
+		Register("db:audit_after", p.afterDelete)
+}
+
+// model 返回语句所操作表的审计策略，未登记的表返回 nil
+func (p *auditPlugin) model(db *gorm.DB) *AuditModelConfig {
+	if db.Error != nil || db.Statement.Table == "" {
+		return nil
+	}
+	model, ok := p.cfg.Models[db.Statement.Table]
+	if !ok {
+		return nil
+	}
+	if model == nil {
+		model = &AuditModelConfig{}
+	}
+	return model
+}
+
+// captureBefore 在 Update/Delete 执行前查询受影响行的快照
+func (p *auditPlugin) captureBefore(db *gorm.DB) {
+	if p.model(db) == nil {
+		return
+	}
+	if p.cfg.RequireActor && actorFromContext(db.Statement.Context) == "" {
+		db.AddError(ErrAuditActorRequired)
+		return
+	}
+
+	conds := statementConditions(db.Statement)
+	if len(conds) == 0 {
+		// 无条件的全表更新会被 GORM 拒绝，除非显式允许；此时不做快照，避免扫描整表
+		p.logger.Warn("语句缺少条件，跳过审计快照", clog.String("table", db.Statement.Table))
+		return
+	}
+
+	rows, err := p.query(db, conds, p.cfg.MaxRowsPerStatement+1)
+	if err != nil {
+		db.AddError(fmt.Errorf("audit: failed to capture snapshot: %w", err))
+		return
+	}
+	if len(rows) > p.cfg.MaxRowsPerStatement {
+		db.AddError(fmt.Errorf("audit: statement affects more than %d rows of table %s",
+			p.cfg.MaxRowsPerStatement, db.Statement.Table))
+		return
+	}
+	db.InstanceSet(auditBeforeKey, rows)
+}
+
+// afterCreate 从写入的模型中提取快照并记录
+func (p *auditPlugin) afterCreate(db *gorm.DB) {
+	model := p.model(db)
+	if model == nil {
+		return
+	}
+	if p.cfg.RequireActor && actorFromContext(db.Statement.Context) == "" {
+		db.AddError(ErrAuditActorRequired)
+		return
+	}
+
+	var logs []AuditLog
+	for _, row := range modelSnapshots(db.Statement) {
+		logs = append(logs, p.newLog(db, model, AuditActionCreate, nil, row))
+	}
+	p.write(db, logs)
+}
+
+// afterUpdate 按主键重新查询变更后的行，与变更前快照比对后记录
+func (p *auditPlugin) afterUpdate(db *gorm.DB) {
+	model := p.model(db)
+	if model == nil {
+		return
+	}
+	before := p.before(db)
+	if len(before) == 0 {
+		return
+	}
+
+	pks := primaryKeys(db.Statement)
+	after, err := p.query(db, primaryKeyConditions(pks, before), 0)
+	if err != nil {
+		db.AddError(fmt.Errorf("audit: failed to capture snapshot: %w", err))
+		return
+	}
+	afterByID := make(map[string]map[string]interface{}, len(after))
+	for _, row := range after {
+		afterByID[recordID(pks, row)] = row
+	}
+
+	var logs []AuditLog
+	for _, row := range before {
+		log := p.newLog(db, model, AuditActionUpdate, row, afterByID[recordID(pks, row)])
+		// 未发生实际变化的行不记录
+		if log.ChangedColumns == "[]" {
+			continue
+		}
+		logs = append(logs, log)
+	}
+	p.write(db, logs)
+}
+
+// afterDelete 记录被删除行的快照
+func (p *auditPlugin) afterDelete(db *gorm.DB) {
+	model := p.model(db)
+	if model == nil {
+		return
+	}
+
+	var logs []AuditLog
+	for _, row := range p.before(db) {
+		logs = append(logs, p.newLog(db, model, AuditActionDelete, row, nil))
+	}
+	p.write(db, logs)
+}
+
+// before 取出执行前保存的快照
+func (p *auditPlugin) before(db *gorm.DB) []map[string]interface{} {
+	if db.Error != nil {
+		return nil
+	}
+	v, ok := db.InstanceGet(auditBeforeKey)
+	if !ok {
+		return nil
+	}
+	rows, _ := v.([]map[string]interface{})
+	return rows
+}
+
+// query 在语句所在的连接（事务）上查询快照，limit 为 0 表示不限制
+func (p *auditPlugin) query(db *gorm.DB, conds []clause.Expression, limit int) ([]map[string]interface{}, error) {
+	// 使用 NewDB 会话避免继承当前语句的条件，强制主库避免读写分离将快照查询路由到副本
+	tx := db.Session(&gorm.Session{NewDB: true, SkipHooks: true, Context: WithPrimary(db.Statement.Context)}).
+		Table(db.Statement.Table).
+		Clauses(clause.Where{Exprs: conds})
+	if limit > 0 {
+		tx = tx.Limit(limit)
+	}
+
+	var rows []map[string]interface{}
+	if err := tx.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// newLog 根据前后快照生成审计记录
+func (p *auditPlugin) newLog(db *gorm.DB, model *AuditModelConfig, action string, before, after map[string]interface{}) AuditLog {
+	before = filterColumns(before, model.IgnoreColumns)
+	after = filterColumns(after, model.IgnoreColumns)
+
+	pks := primaryKeys(db.Statement)
+	id := recordID(pks, after)
+	if before != nil {
+		id = recordID(pks, before)
+	}
+
+	changed, _ := json.Marshal(changedColumns(before, after))
+	ctx := db.Statement.Context
+	return AuditLog{
+		Table:          db.Statement.Table,
+		RecordID:       id,
+		Action:         action,
+		Actor:          actorFromContext(ctx),
+		RequestID:      requestIDFromContext(ctx),
+		ChangedColumns: string(changed),
+		Before:         marshalSnapshot(before),
+		After:          marshalSnapshot(after),
+		CreatedAt:      time.Now(),
+	}
+}
+
+// write 在语句所在的连接（事务）上写入审计记录，失败时使业务语句一并失败
+func (p *auditPlugin) write(db *gorm.DB, logs []AuditLog) {
+	if len(logs) == 0 {
+		return
+	}
+	err := db.Session(&gorm.Session{NewDB: true, SkipHooks: true}).
+		Table(p.cfg.TableName).
+		CreateInBatches(&logs, auditPurgeBatchSize).Error
+	if err != nil {
+		p.logger.Error("写入审计日志失败",
+			clog.String("table", db.Statement.Table),
+			clog.Int("records", len(logs)),
+			clog.Err(err),
+		)
+		db.AddError(fmt.Errorf("audit: failed to write audit log: %w", err))
+	}
+}
+
+// purge 按各表的保留时长删除过期的审计记录，返回删除的总行数
+func (p *auditPlugin) purge(ctx context.Context, db *gorm.DB) (int64, error) {
+	var total int64
+	for table, model := range p.cfg.Models {
+		retention := p.cfg.DefaultRetention
+		if model != nil && model.Retention > 0 {
+			retention = model.Retention
+		}
+		if retention <= 0 {
+			continue
+		}
+
+		cutoff := time.Now().Add(-retention)
+		for {
+			result := db.WithContext(ctx).Table(p.cfg.TableName).
+				Where("table_name = ? AND created_at < ?", table, cutoff).
+				Limit(auditPurgeBatchSize).
+				Delete(&AuditLog{})
+			if result.Error != nil {
+				return total, fmt.Errorf("failed to purge audit logs of table %s: %w", table, result.Error)
+			}
+			total += result.RowsAffected
+			if result.RowsAffected < auditPurgeBatchSize {
+				break
+			}
+		}
+	}
+	return total, nil
+}
+
+// PurgeAuditLogs 删除超过保留时长的审计记录，未开启审计时返回 0
+func (c *client) PurgeAuditLogs(ctx context.Context) (int64, error) {
+	if c.audit == nil {
+		return 0, nil
+	}
+
+	start := time.Now()
+	deleted, err := c.audit.purge(ctx, c.db)
+	if err != nil {
+		c.logger.Error("清理过期审计日志失败", clog.Err(err))
+		return deleted, err
+	}
+	c.logger.Info("清理过期审计日志完成",
+		clog.Int64("deleted", deleted),
+		clog.Duration("duration", time.Since(start)),
+	)
+	return deleted, nil
+}
+
+// statementConditions 返回 Update/Delete 语句的 WHERE 条件。
+// 通过 db.Model(&user).Updates(...) 等方式更新时，主键条件在 gorm:update 中才会追加，这里提前补上。
+func statementConditions(stmt *gorm.Statement) []clause.Expression {
+	var conds []clause.Expression
+	if c, ok := stmt.Clauses["WHERE"]; ok {
+		if where, ok := c.Expression.(clause.Where); ok {
+			conds = append(conds, where.Exprs...)
+		}
+	}
+	if stmt.Schema == nil || !stmt.ReflectValue.IsValid() {
+		return conds
+	}
+
+	switch stmt.ReflectValue.Kind() {
+	case reflect.Struct:
+		for _, field := range stmt.Schema.PrimaryFields {
+			if value, isZero := field.ValueOf(stmt.Context, stmt.ReflectValue); !isZero {
+				conds = append(conds, clause.Eq{Column: clause.Column{Name: field.DBName}, Value: value})
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if len(stmt.Schema.PrimaryFields) != 1 {
+			break
+		}
+		field := stmt.Schema.PrimaryFields[0]
+		var values []interface{}
+		for i := 0; i < stmt.ReflectValue.Len(); i++ {
+			if value, isZero := field.ValueOf(stmt.Context, reflect.Indirect(stmt.ReflectValue.Index(i))); !isZero {
+				values = append(values, value)
+			}
+		}
+		if len(values) > 0 {
+			conds = append(conds, clause.IN{Column: clause.Column{Name: field.DBName}, Values: values})
+		}
+	}
+	return conds
+}
+
+// primaryKeys 返回表的主键列，无法解析模型时默认为 id
+func primaryKeys(stmt *gorm.Statement) []string {
+	if stmt.Schema != nil && len(stmt.Schema.PrimaryFieldDBNames) > 0 {
+		return stmt.Schema.PrimaryFieldDBNames
+	}
+	return []string{"id"}
+}
+
+// primaryKeyConditions 生成按主键匹配快照中各行的条件
+func primaryKeyConditions(pks []string, rows []map[string]interface{}) []clause.Expression {
+	if len(pks) == 1 {
+		values := make([]interface{}, 0, len(rows))
+		for _, row := range rows {
+			values = append(values, row[pks[0]])
+		}
+		return []clause.Expression{clause.IN{Column: clause.Column{Name: pks[0]}, Values: values}}
+	}
+
+	ors := make([]clause.Expression, 0, len(rows))
+	for _, row := range rows {
+		eqs := make([]clause.Expression, 0, len(pks))
+		for _, pk := range pks {
+			eqs = append(eqs, clause.Eq{Column: clause.Column{Name: pk}, Value: row[pk]})
+		}
+		ors = append(ors, clause.And(eqs...))
+	}
+	return []clause.Expression{clause.Or(ors...)}
+}
+
+// recordID 拼接行的主键值
+func recordID(pks []string, row map[string]interface{}) string {
+	if row == nil {
+		return ""
+	}
+	id := ""
+	for i, pk := range pks {
+		if i > 0 {
+			id += ","
+		}
+		id += fmt.Sprint(normalizeValue(row[pk]))
+	}
+	return id
+}
+
+// modelSnapshots 从 Create 写入的模型（结构体、结构体切片或 map）中提取快照
+func modelSnapshots(stmt *gorm.Statement) []map[string]interface{} {
+	rv := stmt.ReflectValue
+	if !rv.IsValid() {
+		return nil
+	}
+
+	switch value := stmt.Dest.(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{value}
+	case *map[string]interface{}:
+		return []map[string]interface{}{*value}
+	case []map[string]interface{}:
+		return value
+	case *[]map[string]interface{}:
+		return *value
+	}
+	if stmt.Schema == nil {
+		return nil
+	}
+
+	snapshot := func(v reflect.Value) map[string]interface{} {
+		row := make(map[string]interface{}, len(stmt.Schema.DBNames))
+		for _, name := range stmt.Schema.DBNames {
+			field := stmt.Schema.FieldsByDBName[name]
+			value, _ := field.ValueOf(stmt.Context, v)
+			row[name] = value
+		}
+		return row
+	}
+
+	switch rv.Kind() {
+	case reflect.Struct:
+		return []map[string]interface{}{snapshot(rv)}
+	case reflect.Slice, reflect.Array:
+		rows := make([]map[string]interface{}, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			rows = append(rows, snapshot(reflect.Indirect(rv.Index(i))))
+		}
+		return rows
+	}
+	return nil
+}
+
+// filterColumns 返回去除忽略列后的快照副本
+func filterColumns(row map[string]interface{}, ignore []string) map[string]interface{} {
+	if row == nil {
+		return nil
+	}
+	filtered := make(map[string]interface{}, len(row))
+	for k, v := range row {
+		filtered[k] = normalizeValue(v)
+	}
+	for _, column := range ignore {
+		delete(filtered, column)
+	}
+	return filtered
+}
+
+// changedColumns 比较前后快照，返回发生变化的列（按列名排序）
+func changedColumns(before, after map[string]interface{}) []string {
+	columns := make(map[string]bool, len(before)+len(after))
+	for k := range before {
+		columns[k] = true
+	}
+	for k := range after {
+		columns[k] = true
+	}
+
+	changed := make([]string, 0, len(columns))
+	for column := range columns {
+		b, _ := json.Marshal(before[column])
+		a, _ := json.Marshal(after[column])
+		if string(a) != string(b) {
+			changed = append(changed, column)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// normalizeValue 将驱动类型统一为可比较、可序列化的值
+func normalizeValue(v interface{}) interface{} {
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		v = rv.Elem().Interface()
+	}
+	if valuer, ok := v.(driver.Valuer); ok {
+		if value, err := valuer.Value(); err == nil {
+			v = value
+		}
+	}
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+	return v
+}
+
+// marshalSnapshot 将快照序列化为 JSON，nil 返回空字符串
+func marshalSnapshot(row map[string]interface{}) string {
+	if row == nil {
+		return ""
+	}
+	data, err := json.Marshal(row)
+	if err != nil {
+		return fmt.Sprintf("%v", row)
+	}
+	return string(data)
+}
@@ -0,0 +1,319 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+
+	"github.com/ceyewan/gochat/im-infra/breaker"
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+// defaultBreakerFailureCodes 默认计入熔断失败的 MySQL 错误码，均表示数据库本身不可用或过载
+var defaultBreakerFailureCodes = []uint16{
+	1040, // ER_CON_COUNT_ERROR，Too many connections
+	1047, // ER_UNKNOWN_COM_ERROR，Galera 节点未就绪
+	1053, // ER_SERVER_SHUTDOWN，服务器正在关闭
+	1203, // ER_TOO_MANY_USER_CONNECTIONS，超过 max_user_connections
+	2006, // CR_SERVER_GONE_ERROR，MySQL server has gone away
+	2013, // CR_SERVER_LOST，查询过程中连接丢失
+	3024, // ER_QUERY_TIMEOUT，超过 max_execution_time
+}
+
+// breakerPoolKey 保存原始连接池的 Statement 实例键
+const breakerPoolKey = "db:breaker_pool"
+
+// migrationKey 迁移操作的上下文键，用于选择迁移组的熔断器
+type migrationKey struct{}
+
+// withMigration 返回一个标记为迁移操作的上下文
+func withMigration(ctx context.Context) context.Context {
+	return context.WithValue(ctx, migrationKey{}, true)
+}
+
+// isMigration 检查上下文是否标记为迁移操作
+func isMigration(ctx context.Context) bool {
+	migration, _ := ctx.Value(migrationKey{}).(bool)
+	return migration
+}
+
+// breakerPlugin 基于 GORM 回调为读、写、迁移三组操作接入熔断器。
+// 与 retryPlugin 一样在执行前替换本次语句的连接池、执行后还原；
+// 注册在重试之前，使重试包装在熔断之外，熔断打开时重试不会再次尝试。
+// 只有连接失败、超时、过载等基础设施错误计入熔断失败，业务错误原样返回且不影响熔断器状态。
+type breakerPlugin struct {
+	read      breaker.Breaker
+	write     breaker.Breaker
+	migration breaker.Breaker
+	failures  map[uint16]bool
+	logger    clog.Logger
+}
+
+// newBreakerPlugin 创建熔断插件，名称为空的组不受保护
+func newBreakerPlugin(cfg BreakerConfig, provider breaker.Provider, logger clog.Logger) *breakerPlugin {
+	failures := make(map[uint16]bool, len(defaultBreakerFailureCodes)+len(cfg.FailureCodes))
+	for _, code := range defaultBreakerFailureCodes {
+		failures[code] = true
+	}
+	for _, code := range cfg.FailureCodes {
+		failures[code] = true
+	}
+
+	p := &breakerPlugin{failures: failures, logger: logger}
+	if cfg.Read != "" {
+		p.read = provider.GetBreaker(cfg.Read)
+	}
+	if cfg.Write != "" {
+		p.write = provider.GetBreaker(cfg.Write)
+	}
+	if cfg.Migration != "" {
+		p.migration = provider.GetBreaker(cfg.Migration)
+	}
+	return p
+}
+
+// register 注册执行前后的回调。
+// 查询的包装回调排在读写分离之后；写操作的包装回调排在最前面，使默认事务的 BEGIN 也受熔断保护
+// （SkipDefaultTransaction 时 gorm:begin_transaction 不会注册，不能以它为锚点）。
+func (p *breakerPlugin) register(db *gorm.DB) error {
+	if err := db.Callback().Query().Before("gorm:query").After("db:route_read").Register("db:breaker", p.wrapRead); err != nil {
+		return err
+	}
+	if err := db.Callback().Query().After("gorm:query").After("db:retry_restore").Register("db:breaker_restore", p.restore); err != nil {
+		return err
+	}
+	if err := db.Callback().Row().Before("gorm:row").After("db:route_read").Register("db:breaker", p.wrapRead); err != nil {
+		return err
+	}
+	if err := db.Callback().Row().After("gorm:row").After("db:retry_restore").Register("db:breaker_restore", p.restore); err != nil {
+		return err
+	}
+
+	if err := db.Callback().Create().Before("*").Register("db:breaker", p.wrapWrite); err != nil {
+		return err
+	}
+	if err := db.Callback().Create().After("*").Register("db:breaker_restore", p.restore); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().Before("*").Register("db:breaker", p.wrapWrite); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().After("*").Register("db:breaker_restore", p.restore); err != nil {
+		return err
+	}
+	if err := db.Callback().Delete().Before("*").Register("db:breaker", p.wrapWrite); err != nil {
+		return err
+	}
+	if err := db.Callback().Delete().After("*").Register("db:breaker_restore", p.restore); err != nil {
+		return err
+	}
+	if err := db.Callback().Raw().Before("gorm:raw").Register("db:breaker", p.wrapWrite); err != nil {
+		return err
+	}
+	return db.Callback().Raw().After("gorm:raw").After("db:retry_restore").Register("db:breaker_restore", p.restore)
+}
+
+// wrapRead 为查询包装读组（迁移上下文中为迁移组）的熔断器
+func (p *breakerPlugin) wrapRead(db *gorm.DB) {
+	p.wrap(db, p.read)
+}
+
+// wrapWrite 为写操作包装写组（迁移上下文中为迁移组）的熔断器
+func (p *breakerPlugin) wrapWrite(db *gorm.DB) {
+	p.wrap(db, p.write)
+}
+
+// wrap 替换本次语句的连接池，事务内的连接池包装后仍实现 TxCommitter
+func (p *breakerPlugin) wrap(db *gorm.DB, b breaker.Breaker) {
+	if isMigration(db.Statement.Context) {
+		b = p.migration
+	}
+	pool := db.Statement.ConnPool
+	if b == nil || pool == nil {
+		return
+	}
+	switch pool.(type) {
+	case *breakerConnPool, *breakerTx:
+		return
+	}
+
+	db.InstanceSet(breakerPoolKey, pool)
+	if tx, inTx := pool.(gorm.TxCommitter); inTx {
+		db.Statement.ConnPool = &breakerTx{breakerConnPool: breakerConnPool{ConnPool: pool, breaker: b, plugin: p}, tx: tx}
+		return
+	}
+	db.Statement.ConnPool = &breakerConnPool{ConnPool: pool, breaker: b, plugin: p}
+}
+
+// restore 还原原始连接池
+func (p *breakerPlugin) restore(db *gorm.DB) {
+	v, ok := db.InstanceGet(breakerPoolKey)
+	if !ok {
+		return
+	}
+	switch db.Statement.ConnPool.(type) {
+	case *breakerConnPool, *breakerTx:
+		db.Statement.ConnPool = v.(gorm.ConnPool)
+	}
+}
+
+// isFailure 判断错误是否应计入熔断失败。
+// 调用方主动取消不计入；超时（包括等待连接池超时）计入，这正是数据库过载时的典型表现。
+func (p *breakerPlugin) isFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return p.failures[mysqlErr.Number]
+	}
+	return isConnError(err)
+}
+
+// breakerCall 一次受保护调用的结果交接。
+// 熔断器配置了超时或调用方取消时 DoWithContext 可能在 op 结束前返回，
+// 此时调用被标记为放弃，op 结束后自行释放结果（如关闭 *sql.Rows），避免泄漏连接。
+type breakerCall[T any] struct {
+	mu        sync.Mutex
+	finished  bool
+	abandoned bool
+	value     T
+	err       error
+}
+
+// guard 通过熔断器执行 op，返回 op 的原始结果；熔断器拒绝或超时时返回熔断器的错误
+func guard[T any](ctx context.Context, p *breakerPlugin, b breaker.Breaker, op func(ctx context.Context) (T, error), release func(T)) (T, error) {
+	call := &breakerCall[T]{}
+	err := b.DoWithContext(ctx, func(ctx context.Context) error {
+		value, err := op(ctx)
+		call.mu.Lock()
+		if call.abandoned {
+			call.mu.Unlock()
+			release(value)
+			return err
+		}
+		call.value, call.err, call.finished = value, err, true
+		call.mu.Unlock()
+		if p.isFailure(err) {
+			return err
+		}
+		return nil
+	})
+
+	var zero T
+	call.mu.Lock()
+	defer call.mu.Unlock()
+	if !call.finished {
+		call.abandoned = true
+		return zero, err
+	}
+	if errors.Is(err, breaker.ErrTimeout) {
+		release(call.value)
+		return zero, err
+	}
+	return call.value, call.err
+}
+
+// breakerConnPool 受熔断保护的连接池包装
+type breakerConnPool struct {
+	gorm.ConnPool
+	breaker breaker.Breaker
+	plugin  *breakerPlugin
+}
+
+// ExecContext 执行语句，op 使用熔断器的超时上下文
+func (p *breakerConnPool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return guard(ctx, p.plugin, p.breaker, func(ctx context.Context) (sql.Result, error) {
+		return p.ConnPool.ExecContext(ctx, query, args...)
+	}, func(sql.Result) {})
+}
+
+// QueryContext 执行查询。
+// *sql.Rows 在上下文取消时会被关闭，而结果集要在返回后才读取，因此查询使用调用方的上下文，
+// 熔断器超时只让调用提前返回，迟到的结果集会被关闭。
+func (p *breakerConnPool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return guard(ctx, p.plugin, p.breaker, func(context.Context) (*sql.Rows, error) {
+		return p.ConnPool.QueryContext(ctx, query, args...)
+	}, func(rows *sql.Rows) {
+		if rows != nil {
+			rows.Close()
+		}
+	})
+}
+
+// QueryRowContext 执行单行查询，上下文的处理与 QueryContext 相同。
+// 熔断器拒绝时 Scan 返回 context.Canceled，原因记录在日志中。
+func (p *breakerConnPool) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	row, err := guard(ctx, p.plugin, p.breaker, func(context.Context) (*sql.Row, error) {
+		row := p.ConnPool.QueryRowContext(ctx, query, args...)
+		return row, row.Err()
+	}, func(row *sql.Row) {
+		if row != nil {
+			// 不带参数的 Scan 会关闭底层结果集
+			_ = row.Scan()
+		}
+	})
+	if row == nil {
+		// *sql.Row 无法携带自定义错误，用已取消的上下文执行查询，使 Scan 返回错误而不访问数据库
+		p.plugin.logger.Warn("单行查询被熔断器拒绝", clog.Err(err))
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		return p.ConnPool.QueryRowContext(canceled, query, args...)
+	}
+	return row
+}
+
+// BeginTx 开启事务，返回的事务中的语句同样受熔断保护
+func (p *breakerConnPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	tx, err := guard(ctx, p.plugin, p.breaker, func(context.Context) (gorm.ConnPool, error) {
+		// 事务在上下文取消时回滚，因此使用调用方的上下文
+		switch beginner := p.ConnPool.(type) {
+		case gorm.TxBeginner:
+			return beginner.BeginTx(ctx, opts)
+		case gorm.ConnPoolBeginner:
+			return beginner.BeginTx(ctx, opts)
+		default:
+			return nil, gorm.ErrInvalidTransaction
+		}
+	}, func(tx gorm.ConnPool) {
+		if committer, ok := tx.(gorm.TxCommitter); ok {
+			_ = committer.Rollback()
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	committer, ok := tx.(gorm.TxCommitter)
+	if !ok {
+		return tx, nil
+	}
+	return &breakerTx{breakerConnPool: breakerConnPool{ConnPool: tx, breaker: p.breaker, plugin: p.plugin}, tx: committer}, nil
+}
+
+// breakerTx 受熔断保护的事务包装，提交和回滚不经过熔断器，避免熔断打开后事务无法结束
+type breakerTx struct {
+	breakerConnPool
+	tx gorm.TxCommitter
+}
+
+// BeginTx 事务内不能再开启事务
+func (t *breakerTx) BeginTx(context.Context, *sql.TxOptions) (gorm.ConnPool, error) {
+	return nil, gorm.ErrInvalidTransaction
+}
+
+// Commit 提交事务
+func (t *breakerTx) Commit() error {
+	return t.tx.Commit()
+}
+
+// Rollback 回滚事务
+func (t *breakerTx) Rollback() error {
+	return t.tx.Rollback()
+}
@@ -7,8 +7,10 @@ import (
 	"strings"
 	"time"
 
+	"github.com/ceyewan/gochat/im-infra/breaker"
+	"github.com/ceyewan/gochat/im-infra/cache"
 	"github.com/ceyewan/gochat/im-infra/clog"
-	"gorm.io/driver/mysql"
+	"github.com/ceyewan/gochat/im-infra/coord/config"
 	"gorm.io/gorm"
 	"gorm.io/gorm/schema"
 )
@@ -16,9 +18,17 @@ import (
 // client 是 Provider 接口的内部实现。
 // 它包装了一个 *gorm.DB，并提供接口方法。
 type client struct {
-	db     *gorm.DB
-	config Config
-	logger clog.Logger
+	db       *gorm.DB
+	config   Config
+	logger   clog.Logger
+	resolver *readWriteResolver
+	retry    *retryPlugin
+	audit    *auditPlugin
+	cache    *queryCachePlugin
+	reshard  *resharder
+	rotator  *credentialRotator
+	rowScope *rowScopePlugin
+	sharding *ShardingHelper
 }
 
 // 确保 client 实现了 Provider 接口
@@ -65,6 +75,14 @@ func (c *client) Close() error {
 		return fmt.Errorf("failed to get underlying database connection: %w", err)
 	}
 
+	if c.resolver != nil {
+		c.resolver.close()
+	}
+	if c.reshard != nil {
+		c.reshard.close()
+	}
+	c.rotator.close()
+
 	err = sqlDB.Close()
 	if err != nil {
 		c.logger.Error("关闭数据库连接失败", clog.Err(err))
@@ -99,6 +117,14 @@ func (c *client) Stats() sql.DBStats {
 	return stats
 }
 
+// RetryStats 返回语句级重试统计信息，未开启重试时返回零值
+func (c *client) RetryStats() RetryStats {
+	if c.retry == nil {
+		return RetryStats{}
+	}
+	return c.retry.stats()
+}
+
 // DB 从当前请求的上下文中获取一个 gorm.DB 实例用于执行查询。
 // 返回的 *gorm.DB 实例是轻量级且无状态的，应在需要时调用此方法获取，不要长期持有。
 func (c *client) DB(ctx context.Context) *gorm.DB {
@@ -143,6 +169,12 @@ func (c *client) Transaction(ctx context.Context, fn func(tx *gorm.DB) error) er
 
 	c.logger.Debug("开始数据库事务")
 
+	// 开启查询缓存时记录事务内写入的表，提交后统一失效
+	var touched *touchedTables
+	if c.cache != nil {
+		ctx, touched = withTouchedTables(ctx)
+	}
+
 	// 执行事务，并确保上下文被正确传递
 	err := c.db.WithContext(ctx).Transaction(fn)
 
@@ -160,9 +192,54 @@ func (c *client) Transaction(ctx context.Context, fn func(tx *gorm.DB) error) er
 		clog.Duration("duration", duration),
 	)
 
+	if touched != nil {
+		if tables := touched.list(); len(tables) > 0 {
+			if err := c.cache.invalidate(ctx, tables...); err != nil {
+				c.logger.Warn("事务提交后失效查询缓存失败", clog.Strings("tables", tables), clog.Err(err))
+			}
+		}
+	}
+
 	return nil
 }
 
+// WithSnapshot 在只读的 REPEATABLE READ 事务中执行 fn。
+// InnoDB 在事务的第一次一致性读时建立读视图，之后事务内的所有查询都基于该读视图，
+// 快照读不加锁，不会阻塞主库或副本上的写入。
+func (c *client) WithSnapshot(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	start := time.Now()
+
+	db := c.db.WithContext(ctx)
+	if c.resolver != nil {
+		db.Statement.ConnPool = c.resolver.snapshotPool(ctx)
+	}
+
+	// 事务内的查询不经过读写分离和查询缓存，重试插件也不会在事务内重试
+	err := db.Transaction(fn, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+
+	duration := time.Since(start)
+	if err != nil {
+		c.logger.Error("快照读事务失败",
+			clog.Err(err),
+			clog.Duration("duration", duration),
+		)
+		return err
+	}
+
+	c.logger.Debug("快照读事务完成",
+		clog.Duration("duration", duration),
+	)
+	return nil
+}
+
+// InvalidateQueryCache 使指定表的查询结果缓存失效，未开启查询缓存时直接返回
+func (c *client) InvalidateQueryCache(ctx context.Context, tables ...string) error {
+	if c.cache == nil || len(tables) == 0 {
+		return nil
+	}
+	return c.cache.invalidate(ctx, tables...)
+}
+
 // autoMigrateInternal 自动迁移数据库表结构（内部方法）
 func (c *client) autoMigrateInternal(dst ...interface{}) error {
 	start := time.Now()
@@ -190,13 +267,25 @@ func (c *client) autoMigrateInternal(dst ...interface{}) error {
 }
 
 // AutoMigrate 自动迁移数据库表结构，能正确处理分片表的创建。
+// 配置了 TableOptions 时按声明的表选项建表并校验，见 EnsureTables。
 func (c *client) AutoMigrate(ctx context.Context, dst ...interface{}) error {
+	if c.rowScope != nil {
+		// 迁移的模型同时登记行级过滤，迁移之后按表名访问同样被过滤
+		if err := c.rowScope.registerModels(c.db, dst...); err != nil {
+			return err
+		}
+	}
+	if c.config.TableOptions != nil {
+		_, err := c.EnsureTables(ctx, dst...)
+		return err
+	}
+
 	start := time.Now()
 
 	c.logger.Info("开始数据库自动迁移")
 
 	// 使用上下文执行自动迁移
-	err := c.db.WithContext(ctx).AutoMigrate(dst...)
+	err := c.db.WithContext(withMigration(ctx)).AutoMigrate(dst...)
 
 	duration := time.Since(start)
 
@@ -251,7 +340,15 @@ func (c *client) CreateDatabaseIfNotExists(dbName string) error {
 }
 
 // NewDB 根据提供的配置创建一个新的 Provider 实例（仅支持MySQL）
-func NewDB(cfg Config, logger clog.Logger) (Provider, error) {
+// queryCacheStore 为查询结果缓存提供存储，仅在配置了 QueryCache 时使用；
+// reshardStore 保存重分片状态，仅在配置了 Reshard 时使用；
+// credentialStore 和 secrets 提供数据库凭据，仅在配置了 Credentials 时使用；
+// breakers 提供熔断器，仅在配置了 Breaker 时使用；
+// stampResolver 解析写入人和租户，用于写入人填充和行级过滤，为 nil 时读取 WithActor/WithTenant；
+// rowScopedModels 预先登记行级过滤的模型，使按表名访问这些表的语句从第一条起就被过滤
+func NewDB(cfg Config, logger clog.Logger, queryCacheStore cache.Provider, reshardStore config.ConfigCenter,
+	credentialStore config.ConfigCenter, secrets SecretProvider, breakers breaker.Provider,
+	stampResolver StampResolver, rowScopedModels []RowScoped) (_ Provider, retErr error) {
 	// 验证配置
 	if err := cfg.Validate(); err != nil {
 		return nil, fmt.Errorf("invalid config: %w", err)
@@ -262,6 +359,27 @@ func NewDB(cfg Config, logger clog.Logger) (Provider, error) {
 		return nil, fmt.Errorf("unsupported database driver: %s, only mysql is supported", cfg.Driver)
 	}
 
+	// 配置凭据轮换：读取初始凭据，之后所有连接池都通过可轮换凭据的连接器建立连接
+	var rotator *credentialRotator
+	if cfg.Credentials != nil {
+		var err error
+		rotator, err = newCredentialRotator(cfg, credentialStore, secrets, logger)
+		if err != nil {
+			logger.Error("配置凭据轮换失败", clog.Err(err))
+			return nil, fmt.Errorf("failed to configure credential rotation: %w", err)
+		}
+		defer func() {
+			if retErr != nil {
+				rotator.close()
+			}
+		}()
+		cfg.DSN = rotator.primaryDSN()
+		logger.Info("凭据轮换已开启",
+			clog.String("configKey", cfg.Credentials.ConfigKey),
+			clog.Bool("secretProvider", secrets != nil),
+		)
+	}
+
 	logger.Info("创建MySQL数据库实例",
 		clog.String("driver", cfg.Driver),
 		clog.String("dsn", maskDSN(cfg.DSN)),
@@ -283,7 +401,7 @@ func NewDB(cfg Config, logger clog.Logger) (Provider, error) {
 	}
 
 	// 创建MySQL数据库连接
-	db, err := gorm.Open(mysql.Open(cfg.DSN), gormConfig)
+	db, err := gorm.Open(openDialector(rotator, cfg.DSN, true), gormConfig)
 
 	// 如果连接失败且启用了自动创建数据库，尝试创建数据库
 	if err != nil && cfg.AutoCreateDatabase && isMySQLDatabaseNotExistError(err) {
@@ -307,6 +425,10 @@ func NewDB(cfg Config, logger clog.Logger) (Provider, error) {
 			tempCfg := cfg
 			tempCfg.DSN = systemDSN
 			tempCfg.AutoCreateDatabase = false // 避免递归
+			tempCfg.QueryCache = nil
+			tempCfg.Reshard = nil
+			tempCfg.Credentials = nil
+			tempCfg.Breaker = nil
 
 			logger.Info("连接到MySQL系统数据库以创建目标数据库",
 				clog.String("systemDSN", maskDSN(systemDSN)),
@@ -314,7 +436,7 @@ func NewDB(cfg Config, logger clog.Logger) (Provider, error) {
 			)
 
 			// 创建临时数据库连接
-			tempDB, tempErr := NewDB(tempCfg, logger)
+			tempDB, tempErr := NewDB(tempCfg, logger, nil, nil, nil, nil, nil, nil, nil)
 			if tempErr != nil {
 				logger.Error("连接MySQL系统数据库失败", clog.Err(tempErr))
 				return nil, fmt.Errorf("failed to connect to system database: %w", tempErr)
@@ -342,7 +464,7 @@ func NewDB(cfg Config, logger clog.Logger) (Provider, error) {
 			)
 
 			// 重新尝试连接到目标数据库
-			db, err = gorm.Open(mysql.Open(cfg.DSN), gormConfig)
+			db, err = gorm.Open(openDialector(rotator, cfg.DSN, true), gormConfig)
 		}
 	}
 
@@ -360,18 +482,176 @@ func NewDB(cfg Config, logger clog.Logger) (Provider, error) {
 		return nil, fmt.Errorf("failed to configure connection pool: %w", err)
 	}
 
+	// 配置读写分离（如果配置了只读副本），需在分库分表之前注册以识别主库连接池
+	var resolver *readWriteResolver
+	if len(cfg.Replicas) > 0 {
+		resolver, err = newReadWriteResolver(db, cfg, rotator, logger)
+		if err == nil {
+			err = resolver.register(db)
+		}
+		if err != nil {
+			logger.Error("配置读写分离失败", clog.Err(err))
+			return nil, fmt.Errorf("failed to configure read/write splitting: %w", err)
+		}
+		logger.Info("读写分离配置完成",
+			clog.Int("replicas", len(cfg.Replicas)),
+			clog.Duration("stickyPrimaryWindow", cfg.StickyPrimaryWindow),
+		)
+	}
+
 	// 配置分库分表（如果启用）
+	var layout *shardLayout
 	if cfg.Sharding != nil {
-		if err := configureSharding(db, cfg.Sharding); err != nil {
+		layout, err = configureSharding(db, cfg.Sharding)
+		if err != nil {
 			logger.Error("配置分库分表失败", clog.Err(err))
 			return nil, fmt.Errorf("failed to configure sharding: %w", err)
 		}
 	}
 
+	// 配置慢查询 EXPLAIN（开发模式）
+	if cfg.ExplainSlowQueries {
+		if err := newExplainPlugin(cfg.SlowThreshold, logger).register(db); err != nil {
+			logger.Error("配置慢查询 EXPLAIN 失败", clog.Err(err))
+			return nil, fmt.Errorf("failed to configure slow query explain: %w", err)
+		}
+		logger.Info("慢查询 EXPLAIN 已开启", clog.Duration("slowThreshold", cfg.SlowThreshold))
+	}
+
+	// 配置熔断（需在读写分离之后、重试之前注册，使重试包装在熔断之外）
+	if cfg.Breaker != nil {
+		if breakers == nil {
+			return nil, fmt.Errorf("breaker is configured but no breaker provider is provided")
+		}
+		if err := newBreakerPlugin(*cfg.Breaker, breakers, logger).register(db); err != nil {
+			logger.Error("配置熔断失败", clog.Err(err))
+			return nil, fmt.Errorf("failed to configure breaker: %w", err)
+		}
+		logger.Info("熔断已开启",
+			clog.String("read", cfg.Breaker.Read),
+			clog.String("write", cfg.Breaker.Write),
+			clog.String("migration", cfg.Breaker.Migration),
+		)
+	}
+
+	// 配置语句级重试（需在读写分离之后注册，以包装最终选中的连接池）
+	var retry *retryPlugin
+	if cfg.Retry != nil && cfg.Retry.MaxAttempts > 1 {
+		retry = newRetryPlugin(*cfg.Retry, logger)
+		if err := retry.register(db); err != nil {
+			logger.Error("配置语句级重试失败", clog.Err(err))
+			return nil, fmt.Errorf("failed to configure statement retry: %w", err)
+		}
+		logger.Info("语句级重试已开启",
+			clog.Int("maxAttempts", cfg.Retry.MaxAttempts),
+			clog.Duration("initialBackoff", cfg.Retry.InitialBackoff),
+			clog.Bool("retryWrites", cfg.Retry.RetryWrites),
+		)
+	}
+
+	// 配置写入人填充（在 gorm:create/gorm:update 之前填充列，审计快照中包含填充的值）
+	if cfg.Stamp != nil {
+		if err := newStampPlugin(*cfg.Stamp, stampResolver).register(db); err != nil {
+			logger.Error("配置写入人填充失败", clog.Err(err))
+			return nil, fmt.Errorf("failed to configure stamp: %w", err)
+		}
+		logger.Info("写入人填充已开启",
+			clog.String("createdBy", cfg.Stamp.CreatedByColumn),
+			clog.String("updatedBy", cfg.Stamp.UpdatedByColumn),
+			clog.String("tenant", cfg.Stamp.TenantColumn),
+			clog.Bool("requireActor", cfg.Stamp.RequireActor),
+			clog.Bool("requireTenant", cfg.Stamp.RequireTenant),
+		)
+	}
+
+	// 配置行级过滤（总是注册，只对实现了 RowScoped 的模型生效；需在审计之前注册，使变更前快照同样受过滤约束）
+	var rowScopeCfg RowScopeConfig
+	if cfg.RowScope != nil {
+		rowScopeCfg = *cfg.RowScope
+	}
+	rowScope := newRowScopePlugin(rowScopeCfg, stampResolver, logger)
+	if err := rowScope.register(db); err != nil {
+		logger.Error("配置行级过滤失败", clog.Err(err))
+		return nil, fmt.Errorf("failed to configure row scope: %w", err)
+	}
+	models := make([]interface{}, len(rowScopedModels))
+	for i, model := range rowScopedModels {
+		models[i] = model
+	}
+	if err := rowScope.registerModels(db, models...); err != nil {
+		logger.Error("登记行级过滤模型失败", clog.Err(err))
+		return nil, fmt.Errorf("failed to configure row scope: %w", err)
+	}
+
+	// 配置审计日志（需在事务回调之间注册，保证审计记录与业务变更同时提交）
+	var audit *auditPlugin
+	if cfg.Audit != nil && len(cfg.Audit.Models) > 0 {
+		audit = newAuditPlugin(*cfg.Audit, logger)
+		if err := audit.register(db); err != nil {
+			logger.Error("配置审计日志失败", clog.Err(err))
+			return nil, fmt.Errorf("failed to configure audit log: %w", err)
+		}
+		logger.Info("审计日志已开启",
+			clog.String("table", cfg.Audit.TableName),
+			clog.Int("models", len(cfg.Audit.Models)),
+		)
+	}
+
+	// 配置查询结果缓存（需在其他查询回调之后注册，以包装最终的 gorm:query）
+	var queryCache *queryCachePlugin
+	if cfg.QueryCache != nil {
+		if queryCacheStore == nil {
+			return nil, fmt.Errorf("query cache is configured but no cache store is provided")
+		}
+		queryCache = newQueryCachePlugin(*cfg.QueryCache, queryCacheStore, logger)
+		if err := queryCache.register(db); err != nil {
+			logger.Error("配置查询结果缓存失败", clog.Err(err))
+			return nil, fmt.Errorf("failed to configure query cache: %w", err)
+		}
+		logger.Info("查询结果缓存已开启",
+			clog.Duration("defaultTTL", cfg.QueryCache.DefaultTTL),
+			clog.Duration("maxTTL", cfg.QueryCache.MaxTTL),
+		)
+	}
+
+	// 配置重分片（双写回调与审计一样在事务回调之间注册；最后配置，避免之后的步骤失败时遗留状态监听）
+	var reshard *resharder
+	if cfg.Reshard != nil {
+		if reshardStore == nil {
+			return nil, fmt.Errorf("reshard is configured but no config center is provided")
+		}
+		reshard, err = newResharder(db, cfg, layout, reshardStore, logger)
+		if err == nil {
+			err = reshard.register(db)
+		}
+		if err != nil {
+			if reshard != nil {
+				reshard.close()
+			}
+			logger.Error("配置重分片失败", clog.Err(err))
+			return nil, fmt.Errorf("failed to configure reshard: %w", err)
+		}
+		logger.Info("重分片已开启",
+			clog.String("stateKey", cfg.Reshard.StateKey),
+			clog.Int("shards", layout.shards()),
+		)
+	}
+
 	logger.Info("MySQL数据库实例创建成功")
 
 	// 创建客户端实例
-	return newClient(db, cfg, logger), nil
+	c := newClient(db, cfg, logger)
+	c.resolver = resolver
+	c.retry = retry
+	c.audit = audit
+	c.cache = queryCache
+	c.reshard = reshard
+	c.rotator = rotator
+	c.rowScope = rowScope
+	if layout != nil {
+		c.sharding = newLayoutShardingHelper(cfg.Sharding, layout)
+	}
+	return c, nil
 }
 
 // CreateDatabaseIfNotExistsWithConfig 使用指定配置创建MySQL数据库（如果不存在）
@@ -389,9 +669,13 @@ func CreateDatabaseIfNotExistsWithConfig(cfg Config, dbName string) error {
 	// 修改配置，连接到 mysql 系统数据库而不是目标数据库
 	tempCfg := cfg
 	tempCfg.DSN = createMySQLSystemDSN(cfg.DSN)
+	tempCfg.QueryCache = nil
+	tempCfg.Reshard = nil
+	tempCfg.Credentials = nil
+	tempCfg.Breaker = nil
 
 	// 创建临时数据库连接
-	tempDB, err := NewDB(tempCfg, logger)
+	tempDB, err := NewDB(tempCfg, logger, nil, nil, nil, nil, nil, nil, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create temporary database connection: %w", err)
 	}
@@ -493,7 +777,7 @@ func createMySQLSystemDSN(originalDSN string) string {
 }
 
 // newClient 创建一个新的数据库客户端实例
-func newClient(db *gorm.DB, config Config, logger clog.Logger) Provider {
+func newClient(db *gorm.DB, config Config, logger clog.Logger) *client {
 	return &client{
 		db:     db,
 		config: config,
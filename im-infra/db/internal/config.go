@@ -42,6 +42,12 @@ type Config struct {
 	// 默认: 200毫秒
 	SlowThreshold time.Duration `json:"slowThreshold" yaml:"slowThreshold"`
 
+	// SQLParams SQL 日志中绑定参数的输出方式
+	// 支持: "elide"（保留 ? 占位符，不输出参数值）、"redact"（字符串和字节参数替换为 '***'，保留数值、时间等）、
+	// "full"（输出完整参数值，可能包含手机号、消息内容等敏感数据，仅建议开发环境使用）
+	// 默认: 开发环境 "full"，生产环境 "elide"
+	SQLParams string `json:"sqlParams" yaml:"sqlParams"`
+
 	// EnableMetrics 是否启用指标收集
 	// 默认: false
 	EnableMetrics bool `json:"enableMetrics" yaml:"enableMetrics"`
@@ -65,6 +71,297 @@ type Config struct {
 
 	// Sharding 分库分表配置（可选）
 	Sharding *ShardingConfig `json:"sharding,omitempty" yaml:"sharding,omitempty"`
+
+	// Replicas 只读副本 DSN 列表（可选）
+	// 配置后查询默认轮询路由到副本，写操作和事务始终在主库执行。
+	// 注意：启用分库分表时查询不会路由到副本。
+	Replicas []string `json:"replicas,omitempty" yaml:"replicas,omitempty"`
+
+	// StickyPrimaryWindow 写后读主库的粘滞时间窗口
+	// 同一会话（通过 db.WithSessionID 注入）发生写操作后，该时间窗口内的查询都在主库执行，
+	// 保证用户能立即读到自己刚写入的数据。0 表示禁用。
+	// 默认: 0
+	StickyPrimaryWindow time.Duration `json:"stickyPrimaryWindow" yaml:"stickyPrimaryWindow"`
+
+	// ExplainSlowQueries 是否对慢查询自动执行 EXPLAIN（开发模式）
+	// 开启后超过 SlowThreshold 的查询会被 EXPLAIN，执行计划通过日志输出，
+	// 出现全表扫描或 filesort 时给出索引建议。EXPLAIN 在主库连接池上额外执行一次，不建议在生产环境开启。
+	// 默认: false，需要显式开启
+	ExplainSlowQueries bool `json:"explainSlowQueries" yaml:"explainSlowQueries"`
+
+	// Retry 语句级重试配置（可选）
+	// 配置后，非事务内的语句遇到瞬时错误（连接断开、死锁、IO 超时等）时自动重试，
+	// 避免 MySQL 代理短暂切换时直接向用户暴露错误。nil 表示不重试。
+	Retry *RetryConfig `json:"retry,omitempty" yaml:"retry,omitempty"`
+
+	// Breaker 熔断配置（可选）
+	// 配置并通过 db.WithBreaker 注入熔断器后，读、写、迁移三组操作分别由各自的熔断器保护，
+	// MySQL 异常时快速失败（返回 breaker.ErrBreakerOpen），读路径可以据此降级到缓存，
+	// 而不是在连接池上堆积等待的 goroutine。nil 表示不熔断。
+	Breaker *BreakerConfig `json:"breaker,omitempty" yaml:"breaker,omitempty"`
+
+	// Audit 审计日志配置（可选）
+	// 配置后，对登记的表执行 Create/Update/Delete 时在同一事务内写入审计记录，
+	// 记录变更前后的快照、变更列、操作人和请求 ID。nil 表示不开启审计。
+	Audit *AuditConfig `json:"audit,omitempty" yaml:"audit,omitempty"`
+
+	// Stamp 写入人填充配置（可选）
+	// 配置后，插入和更新声明了 created_by/updated_by/tenant_id 列的模型时，
+	// 自动从上下文（db.WithActor、db.WithTenant 或 db.WithStampResolver）填充这些列。nil 表示不填充。
+	Stamp *StampConfig `json:"stamp,omitempty" yaml:"stamp,omitempty"`
+
+	// RowScope 行级过滤配置（可选）
+	// 实现了 db.RowScoped 的模型总是按其登记的过滤条件（租户、软删除、可见性规则）查询、更新和删除，
+	// 该配置只控制上下文缺少过滤所需的值时的处理方式。nil 表示拒绝这类语句。
+	RowScope *RowScopeConfig `json:"rowScope,omitempty" yaml:"rowScope,omitempty"`
+
+	// QueryCache 查询结果缓存配置（可选）
+	// 配置并通过 db.WithQueryCacheStore 注入缓存后，使用 db.WithQueryCache 标记的查询结果
+	// 会按规范化 SQL + 参数缓存，涉及的表发生写入并提交后自动失效。nil 表示不开启。
+	QueryCache *QueryCacheConfig `json:"queryCache,omitempty" yaml:"queryCache,omitempty"`
+
+	// TableOptions 表选项配置（可选）
+	// 配置后 AutoMigrate/EnsureTables 按声明的引擎、字符集、排序规则、行格式和分区子句建表，
+	// 并校验已有表是否与声明一致。nil 表示沿用 MySQL 服务端默认值，不做校验。
+	// 默认: InnoDB + utf8mb4 + utf8mb4_unicode_ci
+	TableOptions *TableOptionsConfig `json:"tableOptions,omitempty" yaml:"tableOptions,omitempty"`
+
+	// Reshard 重分片配置（可选，需同时配置 Sharding）
+	// 配置并通过 db.WithReshardStore 注入 coord 配置中心后，实例会监听迁移状态：
+	// 迁移期间对分片表的写入同时写入新分片布局，切换完成后按新的分片数路由。nil 表示不参与重分片。
+	Reshard *ReshardConfig `json:"reshard,omitempty" yaml:"reshard,omitempty"`
+
+	// Credentials 凭据轮换配置（可选）
+	// 配置并通过 db.WithSecretProvider 注入密钥服务，或通过 db.WithCredentialStore 注入 coord 配置中心后，
+	// 启动时从中读取 DSN/用户名/密码，之后凭据变化时平滑重建连接：新连接使用新凭据，
+	// 旧连接在当前查询或事务完成后关闭。nil 表示始终使用 DSN 中的凭据。
+	Credentials *CredentialsConfig `json:"credentials,omitempty" yaml:"credentials,omitempty"`
+
+	// OnlineDDL 在线 DDL 配置（可选）
+	// 配置后可通过 Provider.OnlineDDL 使用 gh-ost 或 pt-online-schema-change 变更大表结构，
+	// 行数较少的表仍直接执行 ALTER TABLE。nil 表示不开启。
+	OnlineDDL *OnlineDDLConfig `json:"onlineDDL,omitempty" yaml:"onlineDDL,omitempty"`
+}
+
+// CredentialsConfig 凭据轮换配置
+type CredentialsConfig struct {
+	// ConfigKey 凭据在 coord 配置中心中的键，值为 JSON 格式的 Credentials，变更实时生效。
+	// 注入了 SecretProvider 时忽略该项
+	ConfigKey string `json:"configKey" yaml:"configKey"`
+
+	// RefreshInterval 轮询 SecretProvider 的间隔
+	// 默认: 1分钟
+	RefreshInterval time.Duration `json:"refreshInterval" yaml:"refreshInterval"`
+
+	// VerifyTimeout 切换前用新凭据建立测试连接的超时时间，测试失败时继续使用旧凭据
+	// 默认: 5秒
+	VerifyTimeout time.Duration `json:"verifyTimeout" yaml:"verifyTimeout"`
+}
+
+// DefaultCredentialsConfig 返回默认的凭据轮换配置
+func DefaultCredentialsConfig() *CredentialsConfig {
+	return &CredentialsConfig{
+		RefreshInterval: time.Minute,
+		VerifyTimeout:   5 * time.Second,
+	}
+}
+
+// ReshardConfig 重分片配置
+type ReshardConfig struct {
+	// StateKey 迁移状态在 coord 配置中心中的键，同一数据库的所有实例必须一致
+	// 默认: "db/reshard"
+	StateKey string `json:"stateKey" yaml:"stateKey"`
+
+	// GracePeriod 状态变更后等待所有实例生效的时间：开启双写后等待该时长才开始拷贝，
+	// 切换阶段阻断读写后等待该时长才重命名表
+	// 默认: 5秒
+	GracePeriod time.Duration `json:"gracePeriod" yaml:"gracePeriod"`
+
+	// ChunkSize 拷贝和校验时每批处理的行数，每批完成后保存一次检查点
+	// 默认: 1000
+	ChunkSize int `json:"chunkSize" yaml:"chunkSize"`
+}
+
+// DefaultReshardConfig 返回默认的重分片配置
+func DefaultReshardConfig() *ReshardConfig {
+	return &ReshardConfig{
+		StateKey:    "db/reshard",
+		GracePeriod: 5 * time.Second,
+		ChunkSize:   1000,
+	}
+}
+
+// QueryCacheConfig 查询结果缓存配置
+type QueryCacheConfig struct {
+	// KeyPrefix 缓存键前缀，同一个缓存实例被多个数据库共用时需要区分
+	// 默认: "dbcache"
+	KeyPrefix string `json:"keyPrefix" yaml:"keyPrefix"`
+
+	// DefaultTTL 查询未指定 TTL 时的缓存时长
+	// 默认: 1分钟
+	DefaultTTL time.Duration `json:"defaultTTL" yaml:"defaultTTL"`
+
+	// MaxTTL 单个查询允许的最大缓存时长，超过时截断，防止失效遗漏时长期读到旧数据
+	// 默认: 10分钟
+	MaxTTL time.Duration `json:"maxTTL" yaml:"maxTTL"`
+
+	// MaxResultBytes 单个查询结果序列化后的最大字节数，超过时不缓存
+	// 默认: 1MB
+	MaxResultBytes int `json:"maxResultBytes" yaml:"maxResultBytes"`
+}
+
+// DefaultQueryCacheConfig 返回默认的查询结果缓存配置
+func DefaultQueryCacheConfig() *QueryCacheConfig {
+	return &QueryCacheConfig{
+		KeyPrefix:      "dbcache",
+		DefaultTTL:     time.Minute,
+		MaxTTL:         10 * time.Minute,
+		MaxResultBytes: 1 << 20,
+	}
+}
+
+// AuditConfig 审计日志配置
+type AuditConfig struct {
+	// TableName 审计日志表名，启动时自动创建
+	// 默认: "audit_logs"
+	TableName string `json:"tableName" yaml:"tableName"`
+
+	// Models 需要审计的表及其策略，键为 SQL 中的实际表名（含 TablePrefix）
+	Models map[string]*AuditModelConfig `json:"models" yaml:"models"`
+
+	// DefaultRetention 未单独配置保留时长的表的审计记录保留时长，0 表示永久保留
+	// 默认: 0
+	DefaultRetention time.Duration `json:"defaultRetention" yaml:"defaultRetention"`
+
+	// RequireActor 是否要求上下文中携带操作人（WithActor），缺失时拒绝写入
+	// 默认: false
+	RequireActor bool `json:"requireActor" yaml:"requireActor"`
+
+	// MaxRowsPerStatement 单条 Update/Delete 语句最多审计的行数，超出时拒绝执行该语句
+	// 默认: 1000
+	MaxRowsPerStatement int `json:"maxRowsPerStatement" yaml:"maxRowsPerStatement"`
+}
+
+// AuditModelConfig 单张表的审计策略
+type AuditModelConfig struct {
+	// Retention 审计记录保留时长，0 表示使用 AuditConfig.DefaultRetention
+	Retention time.Duration `json:"retention" yaml:"retention"`
+
+	// IgnoreColumns 不记录到快照中的列，如密码哈希、updated_at
+	IgnoreColumns []string `json:"ignoreColumns,omitempty" yaml:"ignoreColumns,omitempty"`
+}
+
+// DefaultAuditConfig 返回默认的审计日志配置，需自行在 Models 中登记需要审计的表
+func DefaultAuditConfig() *AuditConfig {
+	return &AuditConfig{
+		TableName:           "audit_logs",
+		Models:              map[string]*AuditModelConfig{},
+		MaxRowsPerStatement: 1000,
+	}
+}
+
+// StampConfig 写入人填充配置，列名为空时使用默认值
+type StampConfig struct {
+	// CreatedByColumn 插入时填充操作人的列
+	// 默认: "created_by"
+	CreatedByColumn string `json:"createdByColumn" yaml:"createdByColumn"`
+
+	// UpdatedByColumn 插入和更新时填充操作人的列
+	// 默认: "updated_by"
+	UpdatedByColumn string `json:"updatedByColumn" yaml:"updatedByColumn"`
+
+	// TenantColumn 插入时填充租户 ID 的列
+	// 默认: "tenant_id"
+	TenantColumn string `json:"tenantColumn" yaml:"tenantColumn"`
+
+	// RequireActor 是否拒绝上下文中缺少操作人的写入（仅限声明了操作人列的模型）
+	// 默认: false
+	RequireActor bool `json:"requireActor" yaml:"requireActor"`
+
+	// RequireTenant 是否拒绝上下文中缺少租户的插入（仅限声明了租户列的模型）
+	// 默认: false
+	RequireTenant bool `json:"requireTenant" yaml:"requireTenant"`
+}
+
+// DefaultStampConfig 返回默认的写入人填充配置，不强制要求操作人和租户
+func DefaultStampConfig() *StampConfig {
+	return &StampConfig{
+		CreatedByColumn: "created_by",
+		UpdatedByColumn: "updated_by",
+		TenantColumn:    "tenant_id",
+	}
+}
+
+// RowScopeConfig 行级过滤配置
+type RowScopeConfig struct {
+	// ReportOnly 上下文缺少过滤所需的值时只记录违规日志，语句不附加该条件照常执行。
+	// 用于给存量模型补充过滤条件时先观察哪些调用方没有携带租户，确认后再关闭
+	// 默认: false（返回 ErrRowScopeViolation）
+	ReportOnly bool `json:"reportOnly" yaml:"reportOnly"`
+}
+
+// RetryConfig 语句级重试配置
+type RetryConfig struct {
+	// MaxAttempts 最大执行次数（含首次执行）
+	// 默认: 3
+	MaxAttempts int `json:"maxAttempts" yaml:"maxAttempts"`
+
+	// InitialBackoff 首次重试前的等待时间，之后每次翻倍
+	// 默认: 50毫秒
+	InitialBackoff time.Duration `json:"initialBackoff" yaml:"initialBackoff"`
+
+	// MaxBackoff 重试等待时间上限
+	// 默认: 1秒
+	MaxBackoff time.Duration `json:"maxBackoff" yaml:"maxBackoff"`
+
+	// RetryWrites 是否重试写操作（Create/Update/Delete/Exec）
+	// 连接在写入后断开时无法确认语句是否已生效，只有确认写操作幂等时才应开启。
+	// 默认事务中的写操作在事务回滚后整体重放，调用方 Transaction 内的语句不重试。
+	// 默认: false，仅重试查询
+	RetryWrites bool `json:"retryWrites" yaml:"retryWrites"`
+
+	// RetryableErrorCodes 额外视为瞬时错误的 MySQL 错误码
+	// 默认已包含 1047、1213、2006、2013
+	RetryableErrorCodes []uint16 `json:"retryableErrorCodes,omitempty" yaml:"retryableErrorCodes,omitempty"`
+}
+
+// DefaultRetryConfig 返回默认的语句级重试配置
+func DefaultRetryConfig() *RetryConfig {
+	return &RetryConfig{
+		MaxAttempts:    3,
+		InitialBackoff: 50 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		RetryWrites:    false,
+	}
+}
+
+// BreakerConfig 熔断配置，每组操作使用一个熔断器，策略由 breaker 组件按名称配置。
+// 名称为空的组不受熔断保护。
+type BreakerConfig struct {
+	// Read 查询（Find/First/Scan/Row 等）使用的熔断器名称
+	// 默认: "db-read"
+	Read string `json:"read" yaml:"read"`
+
+	// Write 写操作（Create/Update/Delete/Exec）及其默认事务使用的熔断器名称
+	// 默认: "db-write"
+	Write string `json:"write" yaml:"write"`
+
+	// Migration AutoMigrate、EnsureTables 和在线 DDL 直接 ALTER 使用的熔断器名称
+	// 默认: "db-migration"
+	Migration string `json:"migration" yaml:"migration"`
+
+	// FailureCodes 额外计入熔断失败的 MySQL 错误码
+	// 默认已包含 1040、1047、1053、1203、2006、2013、3024；其余业务错误（如唯一键冲突）不计入失败
+	FailureCodes []uint16 `json:"failureCodes,omitempty" yaml:"failureCodes,omitempty"`
+}
+
+// DefaultBreakerConfig 返回默认的熔断配置，三组操作都受保护
+func DefaultBreakerConfig() *BreakerConfig {
+	return &BreakerConfig{
+		Read:      "db-read",
+		Write:     "db-write",
+		Migration: "db-migration",
+	}
 }
 
 // ShardingConfig 分库分表配置
@@ -109,11 +406,15 @@ func GetDefaultConfig(env string) Config {
 			ConnMaxIdleTime:                          30 * time.Minute,
 			LogLevel:                                 "info",
 			SlowThreshold:                            100 * time.Millisecond,
+			SQLParams:                                SQLParamsFull,
 			EnableMetrics:                            false,
 			EnableTracing:                            false,
 			TablePrefix:                              "",
 			DisableForeignKeyConstraintWhenMigrating: false,
 			AutoCreateDatabase:                       true,
+			ExplainSlowQueries:                       false,
+			Retry:                                    DefaultRetryConfig(),
+			TableOptions:                             DefaultTableOptionsConfig(),
 		}
 	case "production":
 		return Config{
@@ -125,11 +426,15 @@ func GetDefaultConfig(env string) Config {
 			ConnMaxIdleTime:                          30 * time.Minute,
 			LogLevel:                                 "warn",
 			SlowThreshold:                            500 * time.Millisecond,
+			SQLParams:                                SQLParamsElide,
 			EnableMetrics:                            true,
 			EnableTracing:                            true,
 			TablePrefix:                              "",
 			DisableForeignKeyConstraintWhenMigrating: false,
 			AutoCreateDatabase:                       false,
+			ExplainSlowQueries:                       false,
+			Retry:                                    DefaultRetryConfig(),
+			TableOptions:                             DefaultTableOptionsConfig(),
 		}
 	default:
 		return DefaultConfig()
@@ -138,7 +443,8 @@ func GetDefaultConfig(env string) Config {
 
 // Validate 验证配置的有效性
 func (c *Config) Validate() error {
-	if c.DSN == "" {
+	// 配置了凭据轮换时 DSN 可以由凭据来源提供
+	if c.DSN == "" && c.Credentials == nil {
 		return fmt.Errorf("DSN cannot be empty")
 	}
 
@@ -178,6 +484,66 @@ func (c *Config) Validate() error {
 		c.SlowThreshold = 200 * time.Millisecond
 	}
 
+	switch c.SQLParams {
+	case "":
+		c.SQLParams = SQLParamsElide
+	case SQLParamsElide, SQLParamsRedact, SQLParamsFull:
+	default:
+		return fmt.Errorf("unsupported sql params mode: %s, must be one of elide, redact, full", c.SQLParams)
+	}
+
+	if c.StickyPrimaryWindow < 0 {
+		return fmt.Errorf("sticky primary window cannot be negative")
+	}
+
+	for i, dsn := range c.Replicas {
+		if dsn == "" {
+			return fmt.Errorf("replica %d DSN cannot be empty", i)
+		}
+	}
+
+	// 验证重试配置
+	if c.Retry != nil {
+		if err := c.validateRetryConfig(); err != nil {
+			return fmt.Errorf("invalid retry config: %w", err)
+		}
+	}
+
+	// 验证熔断配置
+	if c.Breaker != nil {
+		if err := c.validateBreakerConfig(); err != nil {
+			return fmt.Errorf("invalid breaker config: %w", err)
+		}
+	}
+
+	// 验证审计日志配置
+	if c.Audit != nil {
+		if err := c.validateAuditConfig(); err != nil {
+			return fmt.Errorf("invalid audit config: %w", err)
+		}
+	}
+
+	// 验证写入人填充配置
+	if c.Stamp != nil {
+		if err := c.validateStampConfig(); err != nil {
+			return fmt.Errorf("invalid stamp config: %w", err)
+		}
+	}
+
+	// 验证查询结果缓存配置
+	if c.QueryCache != nil {
+		if err := c.validateQueryCacheConfig(); err != nil {
+			return fmt.Errorf("invalid query cache config: %w", err)
+		}
+	}
+
+	// 验证表选项配置
+	if c.TableOptions != nil {
+		if err := c.validateTableOptionsConfig(); err != nil {
+			return fmt.Errorf("invalid table options config: %w", err)
+		}
+	}
+
 	// 验证分库分表配置
 	if c.Sharding != nil {
 		if err := c.validateShardingConfig(); err != nil {
@@ -185,6 +551,46 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	// 验证重分片配置
+	if c.Reshard != nil {
+		if err := c.validateReshardConfig(); err != nil {
+			return fmt.Errorf("invalid reshard config: %w", err)
+		}
+	}
+
+	// 验证凭据轮换配置
+	if c.Credentials != nil {
+		if err := c.validateCredentialsConfig(); err != nil {
+			return fmt.Errorf("invalid credentials config: %w", err)
+		}
+	}
+
+	// 验证在线 DDL 配置
+	if c.OnlineDDL != nil {
+		if err := c.validateOnlineDDLConfig(); err != nil {
+			return fmt.Errorf("invalid online ddl config: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// validateCredentialsConfig 验证凭据轮换配置，未设置的字段使用默认值
+func (c *Config) validateCredentialsConfig() error {
+	if c.Credentials.RefreshInterval < 0 {
+		return fmt.Errorf("refresh interval cannot be negative")
+	}
+	if c.Credentials.VerifyTimeout < 0 {
+		return fmt.Errorf("verify timeout cannot be negative")
+	}
+
+	defaults := DefaultCredentialsConfig()
+	if c.Credentials.RefreshInterval == 0 {
+		c.Credentials.RefreshInterval = defaults.RefreshInterval
+	}
+	if c.Credentials.VerifyTimeout == 0 {
+		c.Credentials.VerifyTimeout = defaults.VerifyTimeout
+	}
 	return nil
 }
 
@@ -201,6 +607,167 @@ func (c *Config) validateShardingConfig() error {
 	return nil
 }
 
+// validateReshardConfig 验证重分片配置，未设置的字段使用默认值
+func (c *Config) validateReshardConfig() error {
+	if c.Sharding == nil {
+		return fmt.Errorf("reshard requires sharding to be configured")
+	}
+	if c.Reshard.GracePeriod < 0 {
+		return fmt.Errorf("grace period cannot be negative")
+	}
+	if c.Reshard.ChunkSize < 0 {
+		return fmt.Errorf("chunk size cannot be negative")
+	}
+
+	defaults := DefaultReshardConfig()
+	if c.Reshard.StateKey == "" {
+		c.Reshard.StateKey = defaults.StateKey
+	}
+	if c.Reshard.GracePeriod == 0 {
+		c.Reshard.GracePeriod = defaults.GracePeriod
+	}
+	if c.Reshard.ChunkSize == 0 {
+		c.Reshard.ChunkSize = defaults.ChunkSize
+	}
+	return nil
+}
+
+// validateRetryConfig 验证重试配置，未设置的字段使用默认值
+func (c *Config) validateRetryConfig() error {
+	if c.Retry.MaxAttempts < 0 {
+		return fmt.Errorf("max attempts cannot be negative")
+	}
+	if c.Retry.InitialBackoff < 0 || c.Retry.MaxBackoff < 0 {
+		return fmt.Errorf("backoff cannot be negative")
+	}
+
+	defaults := DefaultRetryConfig()
+	if c.Retry.MaxAttempts == 0 {
+		c.Retry.MaxAttempts = defaults.MaxAttempts
+	}
+	if c.Retry.InitialBackoff == 0 {
+		c.Retry.InitialBackoff = defaults.InitialBackoff
+	}
+	if c.Retry.MaxBackoff == 0 {
+		c.Retry.MaxBackoff = defaults.MaxBackoff
+	}
+	if c.Retry.MaxBackoff < c.Retry.InitialBackoff {
+		c.Retry.MaxBackoff = c.Retry.InitialBackoff
+	}
+	return nil
+}
+
+// validateBreakerConfig 验证熔断配置
+func (c *Config) validateBreakerConfig() error {
+	if c.Breaker.Read == "" && c.Breaker.Write == "" && c.Breaker.Migration == "" {
+		return fmt.Errorf("at least one of read, write and migration breaker must be named")
+	}
+	return nil
+}
+
+// validateAuditConfig 验证审计日志配置，未设置的字段使用默认值
+func (c *Config) validateAuditConfig() error {
+	if c.Audit.DefaultRetention < 0 {
+		return fmt.Errorf("default retention cannot be negative")
+	}
+	if c.Audit.MaxRowsPerStatement < 0 {
+		return fmt.Errorf("max rows per statement cannot be negative")
+	}
+	for table, model := range c.Audit.Models {
+		if table == "" {
+			return fmt.Errorf("audited table name cannot be empty")
+		}
+		if model != nil && model.Retention < 0 {
+			return fmt.Errorf("retention of table %s cannot be negative", table)
+		}
+	}
+
+	defaults := DefaultAuditConfig()
+	if c.Audit.TableName == "" {
+		c.Audit.TableName = defaults.TableName
+	}
+	if c.Audit.MaxRowsPerStatement == 0 {
+		c.Audit.MaxRowsPerStatement = defaults.MaxRowsPerStatement
+	}
+	if _, ok := c.Audit.Models[c.Audit.TableName]; ok {
+		return fmt.Errorf("audit table %s cannot audit itself", c.Audit.TableName)
+	}
+	return nil
+}
+
+// validateStampConfig 验证写入人填充配置，未设置的列名使用默认值
+func (c *Config) validateStampConfig() error {
+	defaults := DefaultStampConfig()
+	if c.Stamp.CreatedByColumn == "" {
+		c.Stamp.CreatedByColumn = defaults.CreatedByColumn
+	}
+	if c.Stamp.UpdatedByColumn == "" {
+		c.Stamp.UpdatedByColumn = defaults.UpdatedByColumn
+	}
+	if c.Stamp.TenantColumn == "" {
+		c.Stamp.TenantColumn = defaults.TenantColumn
+	}
+	if c.Stamp.CreatedByColumn == c.Stamp.TenantColumn || c.Stamp.UpdatedByColumn == c.Stamp.TenantColumn {
+		return fmt.Errorf("tenant column %s cannot also be an actor column", c.Stamp.TenantColumn)
+	}
+	return nil
+}
+
+// validateQueryCacheConfig 验证查询结果缓存配置，未设置的字段使用默认值
+func (c *Config) validateQueryCacheConfig() error {
+	if c.QueryCache.DefaultTTL < 0 || c.QueryCache.MaxTTL < 0 {
+		return fmt.Errorf("ttl cannot be negative")
+	}
+	if c.QueryCache.MaxResultBytes < 0 {
+		return fmt.Errorf("max result bytes cannot be negative")
+	}
+
+	defaults := DefaultQueryCacheConfig()
+	if c.QueryCache.KeyPrefix == "" {
+		c.QueryCache.KeyPrefix = defaults.KeyPrefix
+	}
+	if c.QueryCache.DefaultTTL == 0 {
+		c.QueryCache.DefaultTTL = defaults.DefaultTTL
+	}
+	if c.QueryCache.MaxTTL == 0 {
+		c.QueryCache.MaxTTL = defaults.MaxTTL
+	}
+	if c.QueryCache.MaxResultBytes == 0 {
+		c.QueryCache.MaxResultBytes = defaults.MaxResultBytes
+	}
+	if c.QueryCache.DefaultTTL > c.QueryCache.MaxTTL {
+		c.QueryCache.DefaultTTL = c.QueryCache.MaxTTL
+	}
+	return nil
+}
+
+// validateTableOptionsConfig 验证表选项配置，未设置的策略使用默认值
+func (c *Config) validateTableOptionsConfig() error {
+	switch c.TableOptions.OnDrift {
+	case "":
+		c.TableOptions.OnDrift = TableDriftWarn
+	case TableDriftWarn, TableDriftFail, TableDriftFix:
+	default:
+		return fmt.Errorf("unsupported drift policy: %s", c.TableOptions.OnDrift)
+	}
+
+	if err := c.TableOptions.Default.validate(); err != nil {
+		return fmt.Errorf("default: %w", err)
+	}
+	for table, options := range c.TableOptions.Tables {
+		if table == "" {
+			return fmt.Errorf("table name cannot be empty")
+		}
+		if options == nil {
+			continue
+		}
+		if err := c.TableOptions.Default.merge(*options).validate(); err != nil {
+			return fmt.Errorf("table %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
 // ValidateConfig 验证配置的完整性和合理性（导出函数）
 func ValidateConfig(cfg *Config) error {
 	return cfg.Validate()
@@ -0,0 +1,431 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/ceyewan/gochat/im-infra/coord/config"
+	"github.com/go-sql-driver/mysql"
+	gormmysql "gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// Credentials 数据库凭据，空字段表示沿用 Config 中的值
+type Credentials struct {
+	// DSN 完整的主库连接字符串，非空时替换 Config.DSN
+	DSN string `json:"dsn,omitempty" yaml:"dsn,omitempty"`
+	// User 覆盖主库和只读副本 DSN 中的用户名
+	User string `json:"user,omitempty" yaml:"user,omitempty"`
+	// Password 覆盖主库和只读副本 DSN 中的密码
+	Password string `json:"password,omitempty" yaml:"password,omitempty"`
+}
+
+// SecretProvider 提供数据库凭据，通常基于 Vault 等密钥管理服务实现。
+// 组件按 CredentialsConfig.RefreshInterval 周期性调用，返回的凭据变化时轮换连接池
+type SecretProvider interface {
+	Credentials(ctx context.Context) (Credentials, error)
+}
+
+// credentialState 当前生效的凭据及其代际，代际在每次轮换后加一
+type credentialState struct {
+	creds      Credentials
+	generation uint64
+}
+
+// credentialRotator 管理凭据的获取和轮换。
+// 所有连接池都通过 rotatingConnector 建立连接，每个连接记录建立时的凭据代际；
+// 轮换后旧代际的连接在归还连接池或被再次取出时丢弃，正在执行的查询和事务不受影响
+type credentialRotator struct {
+	cfg     CredentialsConfig
+	baseDSN string
+	maxIdle int
+	store   config.ConfigCenter
+	secrets SecretProvider
+	logger  clog.Logger
+
+	state atomic.Pointer[credentialState]
+
+	// mu 串行化轮换，并保护 connectors
+	mu         sync.Mutex
+	connectors []*rotatingConnector
+	cancel     context.CancelFunc
+}
+
+// newCredentialRotator 读取初始凭据并开始监听凭据变更，启动时读不到凭据直接返回错误
+func newCredentialRotator(cfg Config, store config.ConfigCenter, secrets SecretProvider, logger clog.Logger) (*credentialRotator, error) {
+	r := &credentialRotator{
+		cfg:     *cfg.Credentials,
+		baseDSN: cfg.DSN,
+		maxIdle: cfg.MaxIdleConns,
+		store:   store,
+		secrets: secrets,
+		logger:  logger,
+	}
+	switch {
+	case secrets != nil:
+	case r.cfg.ConfigKey != "" && store != nil:
+	case r.cfg.ConfigKey != "":
+		return nil, fmt.Errorf("credentials config key is set but no config center is provided")
+	default:
+		return nil, fmt.Errorf("credentials is configured but neither a secret provider nor a config key is provided")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	creds, err := r.fetch(ctx)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to load credentials: %w", err)
+	}
+	if _, err := r.dsnFor(r.baseDSN, true, creds); err != nil {
+		cancel()
+		return nil, err
+	}
+	r.state.Store(&credentialState{creds: creds, generation: 1})
+
+	r.cancel = cancel
+	if secrets != nil {
+		go r.poll(ctx)
+	} else {
+		go r.watch(ctx)
+	}
+	return r, nil
+}
+
+// close 停止监听凭据变更
+func (r *credentialRotator) close() {
+	if r != nil {
+		r.cancel()
+	}
+}
+
+// primaryDSN 返回使用当前凭据的主库 DSN
+func (r *credentialRotator) primaryDSN() string {
+	dsn, _ := r.dsnFor(r.baseDSN, true, r.state.Load().creds)
+	return dsn
+}
+
+// dsnFor 将凭据应用到 DSN 上：主库使用 Credentials.DSN 替换，再覆盖用户名和密码
+func (r *credentialRotator) dsnFor(base string, primary bool, creds Credentials) (string, error) {
+	if primary && creds.DSN != "" {
+		base = creds.DSN
+	}
+	if base == "" {
+		return "", fmt.Errorf("DSN cannot be empty")
+	}
+	mysqlCfg, err := mysql.ParseDSN(base)
+	if err != nil {
+		return "", fmt.Errorf("invalid DSN: %w", err)
+	}
+	if creds.User != "" {
+		mysqlCfg.User = creds.User
+	}
+	if creds.Password != "" {
+		mysqlCfg.Passwd = creds.Password
+	}
+	return mysqlCfg.FormatDSN(), nil
+}
+
+// openDialector 返回连接 dsn 的 GORM 方言；r 为 nil 时直接使用 dsn，否则通过可轮换凭据的连接器建立连接。
+// primary 为 true 时 dsn 被忽略，使用主库 DSN
+func openDialector(r *credentialRotator, dsn string, primary bool) gorm.Dialector {
+	if r == nil {
+		return gormmysql.Open(dsn)
+	}
+	if primary {
+		dsn = r.baseDSN
+	}
+	connector := &rotatingConnector{rotator: r, baseDSN: dsn, primary: primary}
+	connector.db = sql.OpenDB(connector)
+
+	r.mu.Lock()
+	r.connectors = append(r.connectors, connector)
+	r.mu.Unlock()
+
+	current, _ := r.dsnFor(dsn, primary, r.state.Load().creds)
+	return gormmysql.New(gormmysql.Config{Conn: connector.db, DSN: current})
+}
+
+// rotate 校验新凭据后切换，校验失败时继续使用旧凭据
+func (r *credentialRotator) rotate(ctx context.Context, creds Credentials) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current := r.state.Load()
+	if current.creds == creds {
+		return nil
+	}
+
+	// 用新凭据为每个连接池建立一次测试连接，避免错误的凭据使整个连接池不可用
+	verifyCtx, cancel := context.WithTimeout(ctx, r.cfg.VerifyTimeout)
+	defer cancel()
+	for _, c := range r.connectors {
+		if err := c.verify(verifyCtx, creds); err != nil {
+			r.logger.Error("新数据库凭据校验失败，继续使用旧凭据",
+				clog.Int64("generation", int64(current.generation)),
+				clog.Err(err))
+			return err
+		}
+	}
+
+	next := &credentialState{creds: creds, generation: current.generation + 1}
+	r.state.Store(next)
+
+	// 立即关闭旧代际的空闲连接，使用中的连接在归还时关闭
+	for _, c := range r.connectors {
+		c.db.SetMaxIdleConns(0)
+		c.db.SetMaxIdleConns(r.maxIdle)
+	}
+
+	r.logger.Info("数据库凭据已轮换，旧连接将在当前查询完成后关闭",
+		clog.Int64("generation", int64(next.generation)),
+		clog.Int("pools", len(r.connectors)))
+	return nil
+}
+
+// fetch 从凭据来源读取当前凭据
+func (r *credentialRotator) fetch(ctx context.Context) (Credentials, error) {
+	if r.secrets != nil {
+		return r.secrets.Credentials(ctx)
+	}
+	var creds Credentials
+	if err := r.store.Get(ctx, r.cfg.ConfigKey, &creds); err != nil {
+		return Credentials{}, err
+	}
+	return creds, nil
+}
+
+// refresh 读取凭据并在变化时轮换
+func (r *credentialRotator) refresh(ctx context.Context) error {
+	creds, err := r.fetch(ctx)
+	if err != nil {
+		return err
+	}
+	return r.rotate(ctx, creds)
+}
+
+// poll 周期性地从 SecretProvider 读取凭据
+func (r *credentialRotator) poll(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.refresh(ctx); err != nil && ctx.Err() == nil {
+				r.logger.Warn("刷新数据库凭据失败", clog.Err(err))
+			}
+		}
+	}
+}
+
+// watch 监听配置中心中的凭据变更，监听中断后重新建立
+func (r *credentialRotator) watch(ctx context.Context) {
+	for {
+		err := r.watchOnce(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		r.logger.Warn("数据库凭据监听中断，稍后重试", clog.Err(err))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// watchOnce 建立一次监听，直到监听通道关闭
+func (r *credentialRotator) watchOnce(ctx context.Context) error {
+	watcher, err := r.store.Watch(ctx, r.cfg.ConfigKey, &Credentials{})
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	// 建立监听后重新读取一次，避免遗漏监听建立之前的变更
+	if err := r.refresh(ctx); err != nil {
+		r.logger.Warn("刷新数据库凭据失败", clog.Err(err))
+	}
+	for event := range watcher.Chan() {
+		if event.Type != config.EventTypePut {
+			// 凭据被删除时保持当前连接池不变
+			continue
+		}
+		creds, ok := event.Value.(Credentials)
+		if !ok {
+			r.logger.Warn("无法解析数据库凭据", clog.String("key", event.Key))
+			continue
+		}
+		r.rotate(ctx, creds)
+	}
+	return errors.New("watch channel closed")
+}
+
+// rotatingConnector 使用当前凭据建立连接，按代际缓存底层的 MySQL 连接器
+type rotatingConnector struct {
+	rotator *credentialRotator
+	baseDSN string
+	primary bool
+	db      *sql.DB
+
+	mu         sync.Mutex
+	generation uint64
+	connector  driver.Connector
+}
+
+// Connect 实现 driver.Connector
+func (c *rotatingConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	state := c.rotator.state.Load()
+	connector, err := c.connectorFor(state)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &rotatingConn{Conn: conn, generation: state.generation, rotator: c.rotator}, nil
+}
+
+// Driver 实现 driver.Connector
+func (c *rotatingConnector) Driver() driver.Driver {
+	return &mysql.MySQLDriver{}
+}
+
+// connectorFor 返回指定代际凭据的 MySQL 连接器
+func (c *rotatingConnector) connectorFor(state *credentialState) (driver.Connector, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.connector != nil && c.generation == state.generation {
+		return c.connector, nil
+	}
+	connector, err := c.newConnector(state.creds)
+	if err != nil {
+		return nil, err
+	}
+	c.connector, c.generation = connector, state.generation
+	return connector, nil
+}
+
+// newConnector 创建使用 creds 的 MySQL 连接器
+func (c *rotatingConnector) newConnector(creds Credentials) (driver.Connector, error) {
+	dsn, err := c.rotator.dsnFor(c.baseDSN, c.primary, creds)
+	if err != nil {
+		return nil, err
+	}
+	mysqlCfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DSN: %w", err)
+	}
+	return mysql.NewConnector(mysqlCfg)
+}
+
+// verify 使用 creds 建立一次测试连接
+func (c *rotatingConnector) verify(ctx context.Context, creds Credentials) error {
+	connector, err := c.newConnector(creds)
+	if err != nil {
+		return err
+	}
+	conn, err := connector.Connect(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect with new credentials: %w", err)
+	}
+	defer conn.Close()
+	if pinger, ok := conn.(driver.Pinger); ok {
+		if err := pinger.Ping(ctx); err != nil {
+			return fmt.Errorf("failed to ping with new credentials: %w", err)
+		}
+	}
+	return nil
+}
+
+// rotatingConn 包装 MySQL 连接并记录建立时的凭据代际。
+// database/sql 在连接归还时调用 IsValid、再次取出时调用 ResetSession，旧代际的连接在这两处被丢弃
+type rotatingConn struct {
+	driver.Conn
+	generation uint64
+	rotator    *credentialRotator
+}
+
+// stale 连接是否使用已轮换掉的凭据建立
+func (c *rotatingConn) stale() bool {
+	return c.generation != c.rotator.state.Load().generation
+}
+
+// IsValid 实现 driver.Validator
+func (c *rotatingConn) IsValid() bool {
+	if c.stale() {
+		return false
+	}
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+// ResetSession 实现 driver.SessionResetter，返回 driver.ErrBadConn 时 database/sql 换用其他连接
+func (c *rotatingConn) ResetSession(ctx context.Context) error {
+	if c.stale() {
+		return driver.ErrBadConn
+	}
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+// BeginTx 实现 driver.ConnBeginTx
+func (c *rotatingConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+// PrepareContext 实现 driver.ConnPrepareContext
+func (c *rotatingConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+// ExecContext 实现 driver.ExecerContext
+func (c *rotatingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if e, ok := c.Conn.(driver.ExecerContext); ok {
+		return e.ExecContext(ctx, query, args)
+	}
+	return nil, driver.ErrSkip
+}
+
+// QueryContext 实现 driver.QueryerContext
+func (c *rotatingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if q, ok := c.Conn.(driver.QueryerContext); ok {
+		return q.QueryContext(ctx, query, args)
+	}
+	return nil, driver.ErrSkip
+}
+
+// Ping 实现 driver.Pinger
+func (c *rotatingConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+// CheckNamedValue 实现 driver.NamedValueChecker
+func (c *rotatingConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
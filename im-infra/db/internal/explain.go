@@ -0,0 +1,347 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"gorm.io/gorm"
+)
+
+// ExplainRow 是 MySQL EXPLAIN 输出中的一行
+type ExplainRow struct {
+	ID           int64
+	SelectType   string
+	Table        string
+	Partitions   string
+	Type         string
+	PossibleKeys string
+	Key          string
+	KeyLen       string
+	Ref          string
+	Rows         int64
+	Filtered     float64
+	Extra        string
+}
+
+// ExplainResult 是一次 EXPLAIN 的结果
+type ExplainResult struct {
+	// SQL 被分析的语句
+	SQL string
+	// Rows EXPLAIN 输出的执行计划
+	Rows []ExplainRow
+	// Advices 针对全表扫描、filesort 等问题给出的索引建议
+	Advices []string
+}
+
+// UsesIndex 检查执行计划中是否有表使用了指定索引
+func (r *ExplainResult) UsesIndex(index string) bool {
+	for _, row := range r.Rows {
+		if row.Key == index {
+			return true
+		}
+	}
+	return false
+}
+
+// HasFullTableScan 检查执行计划中是否存在全表扫描（type=ALL）
+func (r *ExplainResult) HasFullTableScan() bool {
+	for _, row := range r.Rows {
+		if row.Type == "ALL" {
+			return true
+		}
+	}
+	return false
+}
+
+// HasFilesort 检查执行计划中是否存在 filesort
+func (r *ExplainResult) HasFilesort() bool {
+	for _, row := range r.Rows {
+		if strings.Contains(row.Extra, "Using filesort") {
+			return true
+		}
+	}
+	return false
+}
+
+// Explain 对查询语句执行 EXPLAIN 并返回执行计划和索引建议
+func (c *client) Explain(ctx context.Context, query string, args ...interface{}) (*ExplainResult, error) {
+	sqlDB, err := c.db.DB()
+	if err != nil {
+		c.logger.Error("获取底层数据库连接失败", clog.Err(err))
+		return nil, fmt.Errorf("failed to get underlying database connection: %w", err)
+	}
+
+	result, err := runExplain(ctx, sqlDB, query, args...)
+	if err != nil {
+		c.logger.Error("执行 EXPLAIN 失败", clog.Err(err), clog.String("sql", query))
+		return nil, err
+	}
+	return result, nil
+}
+
+// explainStartKey 记录查询开始时间的 Statement 实例键
+const explainStartKey = "db:explain_start"
+
+// explainPlugin 开发模式下对慢查询执行 EXPLAIN 的 GORM 回调插件。
+// 超过慢查询阈值的 SELECT 语句会被 EXPLAIN，完整执行计划通过 clog 输出，
+// 出现全表扫描或 filesort 时额外记录索引建议。
+type explainPlugin struct {
+	threshold time.Duration
+	logger    clog.Logger
+}
+
+// newExplainPlugin 创建慢查询 EXPLAIN 插件
+func newExplainPlugin(threshold time.Duration, logger clog.Logger) *explainPlugin {
+	return &explainPlugin{
+		threshold: threshold,
+		logger:    logger,
+	}
+}
+
+// register 注册查询前后的回调
+func (p *explainPlugin) register(db *gorm.DB) error {
+	if err := db.Callback().Query().Before("gorm:query").Register("db:explain_start", p.start); err != nil {
+		return err
+	}
+	if err := db.Callback().Query().After("gorm:query").Register("db:explain", p.explain); err != nil {
+		return err
+	}
+	if err := db.Callback().Row().Before("gorm:row").Register("db:explain_start", p.start); err != nil {
+		return err
+	}
+	return db.Callback().Row().After("gorm:row").Register("db:explain", p.explain)
+}
+
+// start 记录查询开始时间
+func (p *explainPlugin) start(db *gorm.DB) {
+	db.InstanceSet(explainStartKey, time.Now())
+}
+
+// explain 查询结束后检查耗时，超过阈值时执行 EXPLAIN。
+// EXPLAIN 在基础连接池（主库）上执行，而不是本次查询的连接：查询在事务中时不占用事务连接，
+// 也不会影响事务；直接调用连接池、不经过 GORM 回调，因此不会递归触发。
+func (p *explainPlugin) explain(db *gorm.DB) {
+	if db.Error != nil || db.ConnPool == nil {
+		return
+	}
+	v, ok := db.InstanceGet(explainStartKey)
+	if !ok {
+		return
+	}
+	start, _ := v.(time.Time)
+	elapsed := time.Since(start)
+	if elapsed <= p.threshold {
+		return
+	}
+
+	query := db.Statement.SQL.String()
+	if !isExplainable(query) {
+		return
+	}
+
+	ctx := db.Statement.Context
+	result, err := runExplain(ctx, db.ConnPool, query, db.Statement.Vars...)
+	if err != nil {
+		p.logger.Warn("慢查询 EXPLAIN 失败", clog.Err(err), clog.String("sql", query))
+		return
+	}
+
+	p.logger.Warn("慢查询执行计划",
+		clog.String("sql", query),
+		clog.Duration("elapsed", elapsed),
+		clog.Duration("threshold", p.threshold),
+		clog.String("plan", formatPlan(result.Rows)),
+	)
+	for _, advice := range result.Advices {
+		p.logger.Warn("慢查询索引建议",
+			clog.String("sql", query),
+			clog.String("advice", advice),
+		)
+	}
+}
+
+// queryer 是执行 EXPLAIN 所需的最小连接池接口，*sql.DB 和 gorm.ConnPool 均满足
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// runExplain 执行 EXPLAIN 并解析结果
+func runExplain(ctx context.Context, pool queryer, query string, args ...interface{}) (*ExplainResult, error) {
+	if !isExplainable(query) {
+		return nil, fmt.Errorf("statement cannot be explained: %s", query)
+	}
+
+	rows, err := pool.QueryContext(ctx, "EXPLAIN "+query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("explain failed: %w", err)
+	}
+	defer rows.Close()
+
+	plan, err := scanExplainRows(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan explain result: %w", err)
+	}
+
+	return &ExplainResult{
+		SQL:     query,
+		Rows:    plan,
+		Advices: adviseIndexes(query, plan),
+	}, nil
+}
+
+// scanExplainRows 按列名解析 EXPLAIN 输出，兼容不同 MySQL 版本的列差异
+func scanExplainRows(rows *sql.Rows) ([]ExplainRow, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var plan []ExplainRow
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		var row ExplainRow
+		for i, column := range columns {
+			value := values[i].String
+			switch strings.ToLower(column) {
+			case "id":
+				fmt.Sscan(value, &row.ID)
+			case "select_type":
+				row.SelectType = value
+			case "table":
+				row.Table = value
+			case "partitions":
+				row.Partitions = value
+			case "type":
+				row.Type = value
+			case "possible_keys":
+				row.PossibleKeys = value
+			case "key":
+				row.Key = value
+			case "key_len":
+				row.KeyLen = value
+			case "ref":
+				row.Ref = value
+			case "rows":
+				fmt.Sscan(value, &row.Rows)
+			case "filtered":
+				fmt.Sscan(value, &row.Filtered)
+			case "extra":
+				row.Extra = value
+			}
+		}
+		plan = append(plan, row)
+	}
+	return plan, rows.Err()
+}
+
+// isExplainable 检查语句是否为可以 EXPLAIN 的查询
+func isExplainable(query string) bool {
+	q := strings.ToUpper(strings.TrimSpace(query))
+	return strings.HasPrefix(q, "SELECT") || strings.HasPrefix(q, "WITH")
+}
+
+var (
+	// whereColumnPattern 匹配 WHERE 子句中参与比较的列
+	whereColumnPattern = regexp.MustCompile("(?i)[`\"]?(\\w+)[`\"]?\\s*(?:=|<=|>=|<>|!=|<|>|\\bIN\\b|\\bLIKE\\b|\\bBETWEEN\\b|\\bIS\\b)")
+	// orderByPattern 匹配 ORDER BY 子句
+	orderByPattern = regexp.MustCompile(`(?is)\bORDER\s+BY\s+(.+?)(?:\bLIMIT\b|\bOFFSET\b|\bFOR\b|$)`)
+	// wherePattern 匹配 WHERE 子句
+	wherePattern = regexp.MustCompile(`(?is)\bWHERE\s+(.+?)(?:\bGROUP\s+BY\b|\bORDER\s+BY\b|\bLIMIT\b|\bFOR\b|$)`)
+)
+
+// sqlKeywords 不应被识别为列名的关键字
+var sqlKeywords = map[string]bool{
+	"AND": true, "OR": true, "NOT": true, "NULL": true, "IS": true, "IN": true,
+	"LIKE": true, "BETWEEN": true, "ASC": true, "DESC": true,
+}
+
+// adviseIndexes 根据执行计划生成索引建议。
+// 建议基于语句中的 WHERE 等值/范围条件和 ORDER BY 列推导，仅用于开发阶段参考。
+func adviseIndexes(query string, plan []ExplainRow) []string {
+	var advices []string
+	for _, row := range plan {
+		if row.Table == "" {
+			continue
+		}
+
+		fullScan := row.Type == "ALL"
+		filesort := strings.Contains(row.Extra, "Using filesort")
+		if !fullScan && !filesort {
+			continue
+		}
+
+		var problems []string
+		if fullScan {
+			problems = append(problems, fmt.Sprintf("全表扫描（约 %d 行）", row.Rows))
+		}
+		if filesort {
+			problems = append(problems, "filesort")
+		}
+
+		advice := fmt.Sprintf("表 %s 出现%s", row.Table, strings.Join(problems, "和"))
+		if columns := suggestIndexColumns(query); len(columns) > 0 {
+			advice += fmt.Sprintf("，建议添加索引: CREATE INDEX idx_%s_%s ON %s (%s)",
+				row.Table, strings.Join(columns, "_"), row.Table, strings.Join(columns, ", "))
+		}
+		advices = append(advices, advice)
+	}
+	return advices
+}
+
+// suggestIndexColumns 推导建议的索引列：先 WHERE 条件列，后 ORDER BY 列，去重保序
+func suggestIndexColumns(query string) []string {
+	var columns []string
+	seen := make(map[string]bool)
+	add := func(column string) {
+		column = strings.Trim(column, "`\" ")
+		if idx := strings.LastIndex(column, "."); idx >= 0 {
+			column = column[idx+1:]
+		}
+		if column == "" || sqlKeywords[strings.ToUpper(column)] || seen[column] {
+			return
+		}
+		seen[column] = true
+		columns = append(columns, column)
+	}
+
+	if m := wherePattern.FindStringSubmatch(query); m != nil {
+		for _, cm := range whereColumnPattern.FindAllStringSubmatch(m[1], -1) {
+			add(cm[1])
+		}
+	}
+	if m := orderByPattern.FindStringSubmatch(query); m != nil {
+		for _, part := range strings.Split(m[1], ",") {
+			fields := strings.Fields(part)
+			if len(fields) > 0 {
+				add(fields[0])
+			}
+		}
+	}
+	return columns
+}
+
+// formatPlan 将执行计划格式化为便于在日志中阅读的文本
+func formatPlan(plan []ExplainRow) string {
+	var b strings.Builder
+	for i, row := range plan {
+		if i > 0 {
+			b.WriteString("; ")
+		}
+		fmt.Fprintf(&b, "id=%d select_type=%s table=%s type=%s possible_keys=%s key=%s rows=%d filtered=%.2f extra=%s",
+			row.ID, row.SelectType, row.Table, row.Type, row.PossibleKeys, row.Key, row.Rows, row.Filtered, row.Extra)
+	}
+	return b.String()
+}
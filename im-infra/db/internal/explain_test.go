@@ -0,0 +1,54 @@
+package internal
+
+import (
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type explainNote struct {
+	ID     int64
+	UserID int64
+}
+
+func TestExplainSlowQueries(t *testing.T) {
+	db, fake := openFakeDB(t, func(query string, _ []driver.Value) (*fakeResult, error) {
+		if strings.HasPrefix(query, "EXPLAIN") {
+			return &fakeResult{
+				columns: []string{"id", "select_type", "table", "type", "rows", "Extra"},
+				rows:    [][]driver.Value{{int64(1), "SIMPLE", "explain_notes", "ALL", int64(1000), "Using where"}},
+			}, nil
+		}
+		return nil, nil
+	})
+	// 阈值为 0，所有查询都视为慢查询
+	require.NoError(t, newExplainPlugin(0, clog.Namespace("explain-test")).register(db))
+
+	var notes []explainNote
+	require.NoError(t, db.Where("user_id = ?", 7).Find(&notes).Error)
+	stmt, ok := fake.find("EXPLAIN SELECT * FROM `explain_notes`")
+	require.True(t, ok)
+	assert.Equal(t, []driver.Value{int64(7)}, stmt.args)
+
+	// 事务中的慢查询在基础连接池上 EXPLAIN，不占用事务连接
+	fake.reset()
+	require.NoError(t, db.Transaction(func(tx *gorm.DB) error {
+		return tx.Where("user_id = ?", 7).Find(&notes).Error
+	}))
+	query, ok := fake.find("SELECT * FROM `explain_notes`")
+	require.True(t, ok)
+	assert.True(t, query.inTx)
+	stmt, ok = fake.find("EXPLAIN SELECT")
+	require.True(t, ok)
+	assert.False(t, stmt.inTx, "EXPLAIN must not run on the transaction connection")
+
+	// 原生 SQL 查询同样会被 EXPLAIN
+	fake.reset()
+	db.Raw("SELECT * FROM `explain_notes` WHERE user_id = ?", 7).Scan(&notes)
+	assert.Equal(t, 1, fake.count("EXPLAIN"), "raw queries are explained as well")
+}
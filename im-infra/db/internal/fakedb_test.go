@@ -0,0 +1,343 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ceyewan/gochat/im-infra/coord/config"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// fakeResult 是 fakeHandler 为一条查询返回的结果集
+type fakeResult struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+// fakeHandler 根据 SQL 和参数返回查询结果或错误；执行语句时忽略返回的结果集
+type fakeHandler func(query string, args []driver.Value) (*fakeResult, error)
+
+// fakeStatement 是一条已执行的语句
+type fakeStatement struct {
+	query string
+	args  []driver.Value
+	// inTx 语句是否在事务连接上执行
+	inTx bool
+}
+
+// fakeDB 是记录所有语句的 database/sql 驱动，用于在没有 MySQL 的环境下测试 GORM 回调
+type fakeDB struct {
+	mu         sync.Mutex
+	handler    fakeHandler
+	statements []fakeStatement
+}
+
+// openFakeDB 创建基于 fakeDB 的 GORM 连接，handler 为 nil 时所有查询返回空结果
+func openFakeDB(t *testing.T, handler fakeHandler) (*gorm.DB, *fakeDB) {
+	t.Helper()
+	fake := &fakeDB{handler: handler}
+	sqlDB := sql.OpenDB(fake)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: sqlDB, SkipInitializeWithVersion: true}),
+		&gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("failed to open fake db: %v", err)
+	}
+	return db, fake
+}
+
+// queries 返回已执行的语句
+func (f *fakeDB) queries() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	queries := make([]string, len(f.statements))
+	for i, stmt := range f.statements {
+		queries[i] = stmt.query
+	}
+	return queries
+}
+
+// find 返回第一条包含 substr 的语句
+func (f *fakeDB) find(substr string) (fakeStatement, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, stmt := range f.statements {
+		if strings.Contains(stmt.query, substr) {
+			return stmt, true
+		}
+	}
+	return fakeStatement{}, false
+}
+
+// count 返回包含 substr 的语句数
+func (f *fakeDB) count(substr string) int {
+	n := 0
+	for _, query := range f.queries() {
+		if strings.Contains(query, substr) {
+			n++
+		}
+	}
+	return n
+}
+
+// reset 清空已记录的语句
+func (f *fakeDB) reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.statements = nil
+}
+
+// run 记录语句并调用 handler
+func (f *fakeDB) run(query string, named []driver.NamedValue, inTx bool) (*fakeResult, error) {
+	args := make([]driver.Value, len(named))
+	for i, arg := range named {
+		args[i] = arg.Value
+	}
+	f.mu.Lock()
+	f.statements = append(f.statements, fakeStatement{query: query, args: args, inTx: inTx})
+	handler := f.handler
+	f.mu.Unlock()
+
+	if handler == nil {
+		return &fakeResult{}, nil
+	}
+	result, err := handler(query, args)
+	if result == nil {
+		result = &fakeResult{}
+	}
+	return result, err
+}
+
+// Connect 实现 driver.Connector
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) {
+	return &fakeConn{db: f}, nil
+}
+
+// Driver 实现 driver.Connector
+func (f *fakeDB) Driver() driver.Driver {
+	return fakeDriver{}
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("fake driver must be opened through a connector")
+}
+
+type fakeConn struct {
+	db   *fakeDB
+	inTx bool
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("fake driver does not support prepared statements")
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *fakeConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	if _, err := c.db.run("BEGIN", nil, false); err != nil {
+		return nil, err
+	}
+	c.inTx = true
+	return &fakeTx{conn: c}, nil
+}
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if _, err := c.db.run(query, args, c.inTx); err != nil {
+		return nil, err
+	}
+	return fakeExecResult{}, nil
+}
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	result, err := c.db.run(query, args, c.inTx)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{result: result}, nil
+}
+
+// fakeExecResult 每条语句影响一行，不返回自增主键
+type fakeExecResult struct{}
+
+func (fakeExecResult) LastInsertId() (int64, error) {
+	return 0, nil
+}
+
+func (fakeExecResult) RowsAffected() (int64, error) {
+	return 1, nil
+}
+
+type fakeTx struct {
+	conn *fakeConn
+}
+
+func (tx *fakeTx) Commit() error {
+	tx.conn.inTx = false
+	_, err := tx.conn.db.run("COMMIT", nil, true)
+	return err
+}
+
+func (tx *fakeTx) Rollback() error {
+	tx.conn.inTx = false
+	_, err := tx.conn.db.run("ROLLBACK", nil, true)
+	return err
+}
+
+type fakeRows struct {
+	result *fakeResult
+	next   int
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.result.columns
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.result.rows) {
+		return io.EOF
+	}
+	copy(dest, r.result.rows[r.next])
+	r.next++
+	return nil
+}
+
+// memoryConfigCenter 是只支持键值读写和 CAS 的内存配置中心，监听不产生事件
+type memoryConfigCenter struct {
+	mu       sync.Mutex
+	values   map[string][]byte
+	versions map[string]int64
+	revision int64
+}
+
+func newMemoryConfigCenter() *memoryConfigCenter {
+	return &memoryConfigCenter{values: map[string][]byte{}, versions: map[string]int64{}}
+}
+
+func (m *memoryConfigCenter) Get(ctx context.Context, key string, v interface{}) error {
+	_, err := m.GetWithVersion(ctx, key, v)
+	return err
+}
+
+func (m *memoryConfigCenter) GetWithVersion(_ context.Context, key string, v interface{}) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.values[key]
+	if !ok {
+		return 0, fmt.Errorf("key %s not found", key)
+	}
+	return m.versions[key], json.Unmarshal(data, v)
+}
+
+func (m *memoryConfigCenter) Set(_ context.Context, key string, value interface{}) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.putLocked(key, value)
+}
+
+func (m *memoryConfigCenter) CompareAndSet(_ context.Context, key string, value interface{}, expectedVersion int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.versions[key] != expectedVersion {
+		return fmt.Errorf("version mismatch: expected %d, got %d", expectedVersion, m.versions[key])
+	}
+	return m.putLocked(key, value)
+}
+
+func (m *memoryConfigCenter) putLocked(key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	m.revision++
+	m.values[key] = data
+	m.versions[key] = m.revision
+	return nil
+}
+
+func (m *memoryConfigCenter) Delete(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.values, key)
+	delete(m.versions, key)
+	return nil
+}
+
+func (m *memoryConfigCenter) List(_ context.Context, prefix string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var keys []string
+	for key := range m.values {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (m *memoryConfigCenter) Watch(ctx context.Context, _ string, _ interface{}) (config.Watcher[any], error) {
+	return newIdleWatcher(ctx), nil
+}
+
+func (m *memoryConfigCenter) WatchPrefix(ctx context.Context, _ string, _ interface{}) (config.Watcher[any], error) {
+	return newIdleWatcher(ctx), nil
+}
+
+func (m *memoryConfigCenter) Preview(context.Context, string, interface{}) (*config.ChangePreview, error) {
+	return nil, errors.New("not supported")
+}
+
+func (m *memoryConfigCenter) ImportTree(context.Context, string, map[string][]byte, config.AtomicSwap) (string, error) {
+	return "", errors.New("not supported")
+}
+
+func (m *memoryConfigCenter) ExportTree(context.Context, string) (map[string][]byte, string, error) {
+	return nil, "", errors.New("not supported")
+}
+
+// idleWatcher 不产生事件，ctx 结束或 Close 后关闭通道
+type idleWatcher struct {
+	ch   chan config.ConfigEvent[any]
+	once sync.Once
+}
+
+func newIdleWatcher(ctx context.Context) *idleWatcher {
+	w := &idleWatcher{ch: make(chan config.ConfigEvent[any])}
+	go func() {
+		<-ctx.Done()
+		w.Close()
+	}()
+	return w
+}
+
+func (w *idleWatcher) Chan() <-chan config.ConfigEvent[any] {
+	return w.ch
+}
+
+func (w *idleWatcher) Close() {
+	w.once.Do(func() { close(w.ch) })
+}
@@ -48,12 +48,73 @@ type Provider interface {
 	// 回调函数中的任何 error 都会导致事务回滚。
 	Transaction(ctx context.Context, fn func(tx *gorm.DB) error) error
 
+	// WithSnapshot 在只读的 REPEATABLE READ 事务中执行 fn，fn 中的所有查询看到同一个时间点的数据。
+	// 配置了只读副本时事务在副本上执行（WithPrimary 或写后粘滞窗口内仍使用主库），不阻塞主库写入。
+	// fn 中的写操作会失败，fn 返回 error 时该 error 原样返回。
+	WithSnapshot(ctx context.Context, fn func(tx *gorm.DB) error) error
+
 	// AutoMigrate 自动迁移数据库表结构，能正确处理分片表的创建。
 	AutoMigrate(ctx context.Context, dst ...interface{}) error
 
+	// EnsureTables 与 AutoMigrate 相同，并返回表选项（引擎、字符集、排序规则、行格式、分区）的校验报告。
+	// 本次新建的表与声明不一致时直接修正，已存在的表按 TableOptionsConfig.OnDrift 处理。
+	EnsureTables(ctx context.Context, dst ...interface{}) (*TableOptionsReport, error)
+
 	// Ping 检查数据库连接。
 	Ping(ctx context.Context) error
 
+	// Explain 对查询语句执行 EXPLAIN，返回执行计划和索引建议。
+	// 主要用于测试中断言查询是否命中了预期的索引。
+	Explain(ctx context.Context, query string, args ...interface{}) (*ExplainResult, error)
+
+	// RetryStats 返回语句级重试统计信息（重试次数、重试后成功数、重试耗尽数）。
+	RetryStats() RetryStats
+
+	// PurgeAuditLogs 按各表的保留时长删除过期的审计记录，返回删除的行数。
+	// 未开启审计时直接返回 0，通常由定时任务周期性调用。
+	PurgeAuditLogs(ctx context.Context) (int64, error)
+
+	// InvalidateQueryCache 使指定表的查询结果缓存失效。
+	// 本实例的写入会自动失效，该方法用于 CDC 等外部变更来源。未开启查询缓存时直接返回 nil。
+	InvalidateQueryCache(ctx context.Context, tables ...string) error
+
+	// ShardSuffix 返回分片键值当前所在分片表的后缀（如 "_03"），与分片插件的路由一致。
+	// 重分片切换完成后按新的分片数计算。未配置 Config.Sharding 时返回 ErrShardingNotConfigured。
+	ShardSuffix(value interface{}) (string, error)
+
+	// Resharder 返回重分片管理器，用于将分片表迁移到更多的分片。
+	// 未配置 Config.Reshard 或未通过 db.WithReshardStore 注入配置中心时返回 ErrReshardNotConfigured。
+	Resharder() (Resharder, error)
+
+	// OnlineDDL 返回在线 DDL 执行器，用于不锁表地变更大表结构。
+	// 未配置 Config.OnlineDDL 时返回 ErrOnlineDDLNotConfigured。
+	OnlineDDL() (OnlineDDL, error)
+
 	// Close 关闭数据库连接池。
 	Close() error
 }
+
+// Resharder 管理分片表的重分片（水平扩容）。
+// 迁移分为四步：Start 开启双写 → Copy 分批拷贝存量数据 → Verify 校验 → Cutover 切换，
+// 迁移状态保存在 coord 配置中心，所有实例监听状态执行双写、切换阻断和路由切换。
+// 每一步都可以在任意实例（或 cmd/reshard 命令）上执行，中断后重新调用即可从检查点继续。
+type Resharder interface {
+	// Start 按计划为新的分片布局建表并开启双写，此后对迁移表的写入同时写入新旧两套布局。
+	Start(ctx context.Context, plan ReshardPlan) error
+
+	// Copy 在双写生效后分批拷贝存量数据，每批完成后将检查点保存到配置中心。
+	Copy(ctx context.Context) error
+
+	// Verify 逐行比对新旧布局并统计总行数，完全一致时进入 verified 阶段。
+	Verify(ctx context.Context) (*ReshardVerifyReport, error)
+
+	// Cutover 切换到新的分片布局，仅在 verified 阶段可执行。
+	// 切换期间（约 GracePeriod）所有实例对迁移表的读写返回 ErrReshardCutover。
+	Cutover(ctx context.Context) error
+
+	// Abort 放弃尚未切换的重分片，删除新布局的表并停止双写。
+	Abort(ctx context.Context) error
+
+	// State 返回当前的迁移状态，未开始时返回 nil。
+	State(ctx context.Context) (*ReshardState, error)
+}
@@ -2,6 +2,7 @@ package internal
 
 import (
 	"context"
+	"database/sql/driver"
 	"errors"
 	"fmt"
 	"runtime/debug"
@@ -13,11 +14,29 @@ import (
 	"gorm.io/gorm/utils"
 )
 
+// SQL 日志中绑定参数的输出方式
+const (
+	// SQLParamsElide 保留 ? 占位符，不输出参数值
+	SQLParamsElide = "elide"
+	// SQLParamsRedact 字符串和字节参数替换为 '***'，保留数值、时间等
+	SQLParamsRedact = "redact"
+	// SQLParamsFull 输出完整的参数值
+	SQLParamsFull = "full"
+)
+
+// redactedParam 脱敏后的参数占位值
+const redactedParam = "***"
+
 // clogLogger 是集成 clog 的 GORM 日志器实现
+//   - 使用注入的 logger 的 "sql" 子命名空间，可以通过 clog 的命名空间路由单独设置 SQL 日志的输出和级别
+//   - 从 ctx 中附加 trace_id 和请求日志缓冲
+//   - 普通 SQL 以 Debug 级别记录，慢查询提升为 Warn，执行错误提升为 Error
+//   - 按 SQLParams 省略或脱敏绑定参数，避免敏感数据写入日志
 type clogLogger struct {
 	logger        clog.Logger
 	logLevel      logger.LogLevel
 	slowThreshold time.Duration
+	sqlParams     string
 }
 
 // NewClogLogger 创建一个新的 clog 集成日志器
@@ -37,10 +56,16 @@ func NewClogLogger(clogInstance clog.Logger, config Config) logger.Interface {
 		logLevel = logger.Warn
 	}
 
+	sqlParams := config.SQLParams
+	if sqlParams == "" {
+		sqlParams = SQLParamsElide
+	}
+
 	return &clogLogger{
-		logger:        clogInstance,
+		logger:        clogInstance.Namespace("sql"),
 		logLevel:      logLevel,
 		slowThreshold: config.SlowThreshold,
+		sqlParams:     sqlParams,
 	}
 }
 
@@ -54,21 +79,38 @@ func (l *clogLogger) LogMode(level logger.LogLevel) logger.Interface {
 // Info 记录信息级别日志
 func (l *clogLogger) Info(ctx context.Context, msg string, data ...interface{}) {
 	if l.logLevel >= logger.Info {
-		clog.WithContext(ctx).Info(fmt.Sprintf(msg, data...))
+		clog.WithContextFrom(ctx, l.logger).Info(fmt.Sprintf(msg, data...))
 	}
 }
 
 // Warn 记录警告级别日志
 func (l *clogLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
 	if l.logLevel >= logger.Warn {
-		clog.WithContext(ctx).Warn(fmt.Sprintf(msg, data...))
+		clog.WithContextFrom(ctx, l.logger).Warn(fmt.Sprintf(msg, data...))
 	}
 }
 
 // Error 记录错误级别日志
 func (l *clogLogger) Error(ctx context.Context, msg string, data ...interface{}) {
 	if l.logLevel >= logger.Error {
-		clog.WithContext(ctx).Error(fmt.Sprintf(msg, data...))
+		clog.WithContextFrom(ctx, l.logger).Error(fmt.Sprintf(msg, data...))
+	}
+}
+
+// ParamsFilter 实现 gorm.ParamsFilter，在 SQL 写入日志前省略或脱敏绑定参数。
+// 返回 nil 参数时 GORM 保留 ? 占位符。
+func (l *clogLogger) ParamsFilter(_ context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	switch l.sqlParams {
+	case SQLParamsFull:
+		return sql, params
+	case SQLParamsRedact:
+		redacted := make([]interface{}, len(params))
+		for i, p := range params {
+			redacted[i] = redactParam(p)
+		}
+		return sql, redacted
+	default:
+		return sql, nil
 	}
 }
 
@@ -79,10 +121,18 @@ func (l *clogLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql
 	}
 
 	elapsed := time.Since(begin)
+	isError := err != nil && l.logLevel >= logger.Error && (!errors.Is(err, gorm.ErrRecordNotFound) || !l.isIgnoreRecordNotFoundError())
+	isSlow := elapsed > l.slowThreshold && l.slowThreshold != 0 && l.logLevel >= logger.Warn
+	if !isError && !isSlow && l.logLevel < logger.Info {
+		// 不会输出时不调用 fc，避免拼接 SQL 的开销
+		return
+	}
+
+	log := clog.WithContextFrom(ctx, l.logger)
 
 	// 更强的防护性检查
 	if fc == nil {
-		clog.WithContext(ctx).Error("SQL执行函数为nil - 可能是分片库兼容性问题")
+		log.Error("SQL执行函数为nil - 可能是分片库兼容性问题")
 		return
 	}
 
@@ -92,7 +142,7 @@ func (l *clogLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql
 	func() {
 		defer func() {
 			if r := recover(); r != nil {
-				clog.WithContext(ctx).Error("SQL执行函数调用时发生panic",
+				log.Error("SQL执行函数调用时发生panic",
 					clog.String("panic", fmt.Sprintf("%v", r)),
 					clog.String("stack", string(debug.Stack())))
 				sql = "PANIC_IN_SQL_EXECUTION"
@@ -102,35 +152,20 @@ func (l *clogLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql
 		sql, rows = fc()
 	}()
 
-	// 获取调用位置信息
-	fileWithLineNum := utils.FileWithLineNum()
-
 	fields := []clog.Field{
 		clog.Duration("elapsed", elapsed),
 		clog.String("sql", sql),
 		clog.Int64("rows", rows),
-		clog.String("source", fileWithLineNum),
+		clog.String("source", utils.FileWithLineNum()),
 	}
 
 	switch {
-	case err != nil && l.logLevel >= logger.Error && (!errors.Is(err, gorm.ErrRecordNotFound) || !l.isIgnoreRecordNotFoundError()):
-		// 记录错误
-		clog.WithContext(ctx).Error("SQL 执行错误",
-			append(fields, clog.Err(err))...,
-		)
-	case elapsed > l.slowThreshold && l.slowThreshold != 0 && l.logLevel >= logger.Warn:
-		// 记录慢查询
-		clog.WithContext(ctx).Warn("检测到慢查询",
-			append(fields,
-				clog.Duration("threshold", l.slowThreshold),
-				clog.String("level", "slow"),
-			)...,
-		)
-	case l.logLevel == logger.Info:
-		// 记录普通查询
-		clog.WithContext(ctx).Info("SQL 执行",
-			fields...,
-		)
+	case isError:
+		log.Error("SQL 执行错误", append(fields, clog.Err(err))...)
+	case isSlow:
+		log.Warn("检测到慢查询", append(fields, clog.Duration("threshold", l.slowThreshold))...)
+	default:
+		log.Debug("SQL 执行", fields...)
 	}
 }
 
@@ -140,6 +175,26 @@ func (l *clogLogger) isIgnoreRecordNotFoundError() bool {
 	return true
 }
 
+// redactParam 脱敏单个绑定参数：字符串和字节替换为 '***'，其他类型原样保留
+func redactParam(p interface{}) interface{} {
+	switch v := p.(type) {
+	case string, []byte, *string:
+		return redactedParam
+	case time.Time, *time.Time:
+		return p
+	case driver.Valuer:
+		value, err := v.Value()
+		if err != nil {
+			return redactedParam
+		}
+		return redactParam(value)
+	case fmt.Stringer:
+		return redactedParam
+	default:
+		return p
+	}
+}
+
 // QueryLogger 查询日志记录器
 type QueryLogger struct {
 	logger clog.Logger
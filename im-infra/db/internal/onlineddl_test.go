@@ -0,0 +1,33 @@
+package internal
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOnlineDDLOptionFile(t *testing.T) {
+	target := &ddlTarget{host: "10.0.0.1", port: "3306", user: "ddl", password: `p,a"ss\word`, database: "im"}
+	path, err := writeOptionFile(t.TempDir(), target)
+	require.NoError(t, err)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "[client]\nuser = \"ddl\"\npassword = \"p,a\\\"ss\\\\word\"\n", string(data))
+
+	// 密码不出现在任何命令行参数中
+	cfg := DefaultOnlineDDLConfig()
+	ghost := ghostArgs(cfg, target, "users", "ADD COLUMN age INT", "/tmp/flag", path)
+	assert.Contains(t, ghost, "--conf="+path)
+	ptosc := ptoscArgs(cfg, target, "users", "ADD COLUMN age INT", path)
+	assert.Equal(t, "F="+path+",h=10.0.0.1,P=3306,D=im,t=users", ptosc[len(ptosc)-1])
+	for _, arg := range append(ghost, ptosc...) {
+		assert.False(t, strings.Contains(arg, "word"), arg)
+	}
+}
@@ -0,0 +1,315 @@
+package internal
+
+import (
+	"crypto/sha1"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 分页大小
+const (
+	// DefaultPageLimit 未指定 Limit 时每页的条数
+	DefaultPageLimit = 20
+	// MaxPageLimit 每页条数上限，超过时按上限处理
+	MaxPageLimit = 1000
+)
+
+// ErrInvalidCursor 游标无法解码，或与本次查询的排序键不一致
+var ErrInvalidCursor = errors.New("db: invalid pagination cursor")
+
+// sortColumnPattern 排序列名，允许 "table.column" 形式，避免拼接进 SQL 的列名被注入
+var sortColumnPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// SortKey 游标分页的一个排序键
+type SortKey struct {
+	// Column 列名，可以带表名前缀，如 "users.created_at"；列不能为 NULL
+	Column string `json:"column"`
+	// Desc 是否降序
+	Desc bool `json:"desc"`
+}
+
+// CursorOptions 游标分页选项
+type CursorOptions struct {
+	// SortKeys 排序键，按顺序组成复合排序。最后一个键必须能唯一确定一行（通常是主键），
+	// 否则排序值相同的行可能跨页重复或遗漏。默认为 id 升序
+	SortKeys []SortKey `json:"sortKeys"`
+	// Limit 每页条数，<= 0 时为 DefaultPageLimit，最大 MaxPageLimit
+	Limit int `json:"limit"`
+	// Cursor 上一页返回的 NextCursor，为空表示第一页
+	Cursor string `json:"cursor"`
+}
+
+// cursorToken 游标的内容，编码为 base64 后对调用方不透明
+type cursorToken struct {
+	// Order 排序键的摘要，防止游标被用于排序不同的查询
+	Order string `json:"o"`
+	// Values 上一页最后一行的排序键取值
+	Values []cursorField `json:"v"`
+}
+
+// cursorField 带类型的排序键取值，解码后恢复原来的 Go 类型，使比较按列类型进行
+type cursorField struct {
+	Type  string          `json:"t"`
+	Value json.RawMessage `json:"v"`
+}
+
+// normalize 校验选项并填充默认值
+func (o CursorOptions) normalize() (CursorOptions, error) {
+	if len(o.SortKeys) == 0 {
+		o.SortKeys = []SortKey{{Column: "id"}}
+	}
+	for _, key := range o.SortKeys {
+		if !sortColumnPattern.MatchString(key.Column) {
+			return o, fmt.Errorf("invalid sort column: %q", key.Column)
+		}
+	}
+	if o.Limit <= 0 {
+		o.Limit = DefaultPageLimit
+	}
+	if o.Limit > MaxPageLimit {
+		o.Limit = MaxPageLimit
+	}
+	return o, nil
+}
+
+// orderDigest 返回排序键的摘要
+func orderDigest(keys []SortKey) string {
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		dir := "asc"
+		if key.Desc {
+			dir = "desc"
+		}
+		parts[i] = key.Column + " " + dir
+	}
+	sum := sha1.Sum([]byte(strings.Join(parts, ",")))
+	return hex.EncodeToString(sum[:4])
+}
+
+// sortColumn 将列名转换为 clause.Column，由 GORM 负责加引号
+func sortColumn(column string) clause.Column {
+	if table, name, ok := strings.Cut(column, "."); ok {
+		return clause.Column{Table: table, Name: name}
+	}
+	return clause.Column{Name: column}
+}
+
+// CursorQuery 为查询加上排序、游标条件和 Limit，返回的查询多取一行用于判断是否还有下一页。
+// 不修改传入的 query；query 本身不应再设置 Order、Offset 和 Limit。
+func CursorQuery(query *gorm.DB, opts CursorOptions) (*gorm.DB, CursorOptions, error) {
+	opts, err := opts.normalize()
+	if err != nil {
+		return nil, opts, err
+	}
+
+	tx := query.Session(&gorm.Session{})
+	if opts.Cursor != "" {
+		values, err := decodeCursor(opts.Cursor, opts.SortKeys)
+		if err != nil {
+			return nil, opts, err
+		}
+		tx = tx.Where(afterCursor(opts.SortKeys, values))
+	}
+	for _, key := range opts.SortKeys {
+		tx = tx.Order(clause.OrderByColumn{Column: sortColumn(key.Column), Desc: key.Desc})
+	}
+	return tx.Limit(opts.Limit + 1), opts, nil
+}
+
+// afterCursor 构造排在游标之后的行的条件：
+// (k1 > v1) OR (k1 = v1 AND k2 > v2) OR ...，降序的键使用 <，因此支持升降序混合
+func afterCursor(keys []SortKey, values []interface{}) clause.Expression {
+	ors := make([]clause.Expression, 0, len(keys))
+	for i, key := range keys {
+		ands := make([]clause.Expression, 0, i+1)
+		for j := 0; j < i; j++ {
+			ands = append(ands, clause.Eq{Column: sortColumn(keys[j].Column), Value: values[j]})
+		}
+		if key.Desc {
+			ands = append(ands, clause.Lt{Column: sortColumn(key.Column), Value: values[i]})
+		} else {
+			ands = append(ands, clause.Gt{Column: sortColumn(key.Column), Value: values[i]})
+		}
+		ors = append(ors, clause.And(ands...))
+	}
+	return clause.Or(ors...)
+}
+
+// EncodeCursor 从一行结果中取出排序键的值并编码为游标。
+// result 是执行查询后的 *gorm.DB，用于查找行类型的字段；row 是指向该行的指针。
+func EncodeCursor(result *gorm.DB, keys []SortKey, row interface{}) (string, error) {
+	rv := reflect.ValueOf(row)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return "", errors.New("cannot encode cursor from nil row")
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return "", fmt.Errorf("cursor pagination requires struct rows, got %s", rv.Type())
+	}
+
+	stmt := result.Statement
+	if stmt.Schema == nil || stmt.Schema.ModelType != rv.Type() {
+		stmt = &gorm.Statement{DB: result}
+		if err := stmt.Parse(rv.Addr().Interface()); err != nil {
+			return "", fmt.Errorf("failed to parse row schema: %w", err)
+		}
+	}
+
+	token := cursorToken{Order: orderDigest(keys), Values: make([]cursorField, len(keys))}
+	for i, key := range keys {
+		name := key.Column
+		if _, col, ok := strings.Cut(name, "."); ok {
+			name = col
+		}
+		field := stmt.Schema.LookUpField(name)
+		if field == nil {
+			return "", fmt.Errorf("sort column %s not found in %s", key.Column, stmt.Schema.Name)
+		}
+		value, _ := field.ValueOf(result.Statement.Context, rv)
+		cv, err := encodeCursorValue(value)
+		if err != nil {
+			return "", fmt.Errorf("sort column %s: %w", key.Column, err)
+		}
+		token.Values[i] = cv
+	}
+
+	data, err := json.Marshal(token)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// encodeCursorValue 编码一个排序键取值
+func encodeCursorValue(value interface{}) (cursorField, error) {
+	rv := reflect.ValueOf(value)
+	for rv.IsValid() && rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() || (rv.Kind() == reflect.Ptr && rv.IsNil()) {
+		return cursorField{}, errors.New("sort column value is NULL")
+	}
+	if valuer, ok := rv.Interface().(driver.Valuer); ok {
+		v, err := valuer.Value()
+		if err != nil {
+			return cursorField{}, err
+		}
+		if v == nil {
+			return cursorField{}, errors.New("sort column value is NULL")
+		}
+		rv = reflect.ValueOf(v)
+	}
+
+	var (
+		typ string
+		raw interface{}
+	)
+	switch v := rv.Interface().(type) {
+	case time.Time:
+		typ, raw = "time", v.Format(time.RFC3339Nano)
+	case []byte:
+		typ, raw = "bytes", v
+	default:
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			typ, raw = "int", strconv.FormatInt(rv.Int(), 10)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			typ, raw = "uint", strconv.FormatUint(rv.Uint(), 10)
+		case reflect.Float32, reflect.Float64:
+			typ, raw = "float", rv.Float()
+		case reflect.String:
+			typ, raw = "string", rv.String()
+		case reflect.Bool:
+			typ, raw = "bool", rv.Bool()
+		default:
+			return cursorField{}, fmt.Errorf("unsupported sort column type %s", rv.Type())
+		}
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return cursorField{}, err
+	}
+	return cursorField{Type: typ, Value: data}, nil
+}
+
+// decodeCursor 解码游标，返回与排序键一一对应的取值
+func decodeCursor(cursor string, keys []SortKey) ([]interface{}, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var token cursorToken
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if token.Order != orderDigest(keys) || len(token.Values) != len(keys) {
+		return nil, fmt.Errorf("%w: sort keys do not match", ErrInvalidCursor)
+	}
+
+	values := make([]interface{}, len(keys))
+	for i, cv := range token.Values {
+		v, err := decodeCursorValue(cv)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// decodeCursorValue 按类型还原排序键取值
+func decodeCursorValue(cv cursorField) (interface{}, error) {
+	switch cv.Type {
+	case "time":
+		var s string
+		if err := json.Unmarshal(cv.Value, &s); err != nil {
+			return nil, err
+		}
+		return time.Parse(time.RFC3339Nano, s)
+	case "bytes":
+		var b []byte
+		err := json.Unmarshal(cv.Value, &b)
+		return b, err
+	case "int":
+		var s string
+		if err := json.Unmarshal(cv.Value, &s); err != nil {
+			return nil, err
+		}
+		return strconv.ParseInt(s, 10, 64)
+	case "uint":
+		var s string
+		if err := json.Unmarshal(cv.Value, &s); err != nil {
+			return nil, err
+		}
+		return strconv.ParseUint(s, 10, 64)
+	case "float":
+		var f float64
+		err := json.Unmarshal(cv.Value, &f)
+		return f, err
+	case "string":
+		var s string
+		err := json.Unmarshal(cv.Value, &s)
+		return s, err
+	case "bool":
+		var b bool
+		err := json.Unmarshal(cv.Value, &b)
+		return b, err
+	default:
+		return nil, fmt.Errorf("unknown value type %q", cv.Type)
+	}
+}
@@ -0,0 +1,486 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/cache"
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+)
+
+// queryCacheKey 查询缓存选项的上下文键
+type queryCacheKey struct{}
+
+// touchedTablesKey 事务内被写入的表集合的上下文键
+type touchedTablesKey struct{}
+
+// queryCacheOptions 单个查询的缓存选项
+type queryCacheOptions struct {
+	ttl    time.Duration
+	tables []string
+}
+
+// cachedResult 缓存中保存的查询结果：驱动返回的列名和原始行，以 gob 编码保存。
+// 命中时把原始行重放给 gorm.Scan，与直接查询经过相同的扫描过程，
+// 不依赖 Dest 自身能否序列化（json:"-"、未导出字段、自定义 Scanner 都能还原）
+type cachedResult struct {
+	Columns []string
+	Rows    [][]driver.Value
+}
+
+func init() {
+	// MySQL 驱动开启 parseTime 时返回 time.Time，其余驱动值均为 gob 内置类型
+	gob.Register(time.Time{})
+}
+
+// touchedTables 记录事务内被写入的表，事务提交后统一失效
+type touchedTables struct {
+	mu     sync.Mutex
+	tables map[string]struct{}
+}
+
+// add 记录一张被写入的表
+func (t *touchedTables) add(table string) {
+	t.mu.Lock()
+	t.tables[table] = struct{}{}
+	t.mu.Unlock()
+}
+
+// list 返回所有被写入的表
+func (t *touchedTables) list() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tables := make([]string, 0, len(t.tables))
+	for table := range t.tables {
+		tables = append(tables, table)
+	}
+	return tables
+}
+
+// WithQueryCache 标记该上下文中的查询使用结果缓存。
+// ttl 为 0 时使用 QueryCacheConfig.DefaultTTL，超过 MaxTTL 时截断；
+// tables 为查询额外依赖的表（如 JOIN 的表），其中任意一张表被写入都会使缓存失效
+func WithQueryCache(ctx context.Context, ttl time.Duration, tables ...string) context.Context {
+	return context.WithValue(ctx, queryCacheKey{}, queryCacheOptions{ttl: ttl, tables: tables})
+}
+
+// queryCacheFromContext 从上下文获取查询缓存选项
+func queryCacheFromContext(ctx context.Context) (queryCacheOptions, bool) {
+	if ctx == nil {
+		return queryCacheOptions{}, false
+	}
+	opts, ok := ctx.Value(queryCacheKey{}).(queryCacheOptions)
+	return opts, ok
+}
+
+// withTouchedTables 为事务上下文附加被写入表的记录
+func withTouchedTables(ctx context.Context) (context.Context, *touchedTables) {
+	t := &touchedTables{tables: make(map[string]struct{})}
+	return context.WithValue(ctx, touchedTablesKey{}, t), t
+}
+
+// queryCachePlugin 基于 GORM 回调实现查询结果缓存。
+// 每张表在缓存中维护一个版本号，缓存键包含查询涉及的所有表的当前版本，
+// 写入某张表时递增其版本号，旧版本的缓存不再被命中并随 TTL 过期，无需逐个删除。
+// 写入在语句执行后以及事务提交后各失效一次，避免提交前其他请求把旧数据重新写入缓存。
+type queryCachePlugin struct {
+	cfg    QueryCacheConfig
+	store  cache.Provider
+	logger clog.Logger
+	query  func(*gorm.DB)
+}
+
+// newQueryCachePlugin 创建查询结果缓存插件
+func newQueryCachePlugin(cfg QueryCacheConfig, store cache.Provider, logger clog.Logger) *queryCachePlugin {
+	return &queryCachePlugin{
+		cfg:    cfg,
+		store:  store,
+		logger: logger,
+	}
+}
+
+// register 包装 gorm:query 回调，并在写操作提交后注册失效回调。
+// db.Exec 等原生 SQL 写入走 Raw 回调，按语句解析出写入的表后同样失效
+func (p *queryCachePlugin) register(db *gorm.DB) error {
+	p.query = db.Callback().Query().Get("gorm:query")
+	if p.query == nil {
+		return errors.New("gorm:query callback not found")
+	}
+	if err := db.Callback().Query().Replace("gorm:query", p.cachedQuery); err != nil {
+		return err
+	}
+
+	if err := db.Callback().Create().After("gorm:commit_or_rollback_transaction").
+		Register("db:query_cache_invalidate", p.afterWrite); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().After("gorm:commit_or_rollback_transaction").
+		Register("db:query_cache_invalidate", p.afterWrite); err != nil {
+		return err
+	}
+	if err := db.Callback().Delete().After("gorm:commit_or_rollback_transaction").
+		Register("db:query_cache_invalidate", p.afterWrite); err != nil {
+		return err
+	}
+	return db.Callback().Raw().After("gorm:raw").
+		Register("db:query_cache_invalidate", p.afterRaw)
+}
+
+// cachedQuery 命中缓存时直接填充结果，否则执行查询并写入缓存。
+// 事务内的查询不使用缓存，保证能读到事务自身的写入。
+func (p *queryCachePlugin) cachedQuery(db *gorm.DB) {
+	opts, ok := queryCacheFromContext(db.Statement.Context)
+	// 没有模型的查询（如扫描到 map）依赖驱动的列类型推断结果类型，重放时无法还原，不缓存
+	if !ok || db.Error != nil || db.DryRun || db.Statement.Table == "" || db.Statement.Schema == nil {
+		p.query(db)
+		return
+	}
+	if _, inTx := db.Statement.ConnPool.(gorm.TxCommitter); inTx {
+		p.query(db)
+		return
+	}
+
+	ctx := db.Statement.Context
+	tables := append([]string{db.Statement.Table}, opts.tables...)
+	key, err := p.buildKey(ctx, db, tables)
+	if err != nil {
+		// 缓存不可用时降级为直接查询
+		p.logger.Warn("构建查询缓存键失败，直接查询", clog.Err(err))
+		p.query(db)
+		return
+	}
+	if db.Error != nil {
+		return
+	}
+
+	result, ok := p.load(ctx, key)
+	if !ok {
+		if result, ok = p.fetch(db); !ok {
+			return
+		}
+		p.save(ctx, db, key, result, opts.ttl)
+	}
+	p.scan(db, result)
+}
+
+// buildKey 生成查询的缓存键：前缀 + 各表版本 + 规范化 SQL 与参数的摘要
+func (p *queryCachePlugin) buildKey(ctx context.Context, db *gorm.DB, tables []string) (string, error) {
+	callbacks.BuildQuerySQL(db)
+	if db.Error != nil {
+		return "", nil
+	}
+
+	sort.Strings(tables)
+	var b strings.Builder
+	b.WriteString(p.cfg.KeyPrefix)
+	for _, table := range tables {
+		version, err := p.version(ctx, table)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(":")
+		b.WriteString(table)
+		b.WriteString("@")
+		b.WriteString(version)
+	}
+
+	sum := sha1.Sum([]byte(normalizeSQL(db.Statement.SQL.String()) + " -- " + fmt.Sprint(db.Statement.Vars)))
+	b.WriteString(":")
+	b.WriteString(hex.EncodeToString(sum[:]))
+	return b.String(), nil
+}
+
+// version 返回表的当前版本号，从未写入过的表版本为 "0"
+func (p *queryCachePlugin) version(ctx context.Context, table string) (string, error) {
+	v, err := p.store.String().Get(ctx, p.versionKey(table))
+	if errors.Is(err, cache.ErrCacheMiss) {
+		return "0", nil
+	}
+	return v, err
+}
+
+// versionKey 返回表版本号的缓存键
+func (p *queryCachePlugin) versionKey(table string) string {
+	return p.cfg.KeyPrefix + ":version:" + table
+}
+
+// load 从缓存读取查询结果，命中时返回 true
+func (p *queryCachePlugin) load(ctx context.Context, key string) (*cachedResult, bool) {
+	data, err := p.store.String().Get(ctx, key)
+	if err != nil {
+		if !errors.Is(err, cache.ErrCacheMiss) {
+			p.logger.Warn("读取查询缓存失败", clog.String("key", key), clog.Err(err))
+		}
+		return nil, false
+	}
+
+	var result cachedResult
+	if err := gob.NewDecoder(strings.NewReader(data)).Decode(&result); err != nil {
+		p.logger.Warn("解析查询缓存失败", clog.String("key", key), clog.Err(err))
+		return nil, false
+	}
+	return &result, true
+}
+
+// fetch 执行查询并读出驱动返回的原始行，查询失败时错误记录到 db
+func (p *queryCachePlugin) fetch(db *gorm.DB) (*cachedResult, bool) {
+	rows, err := db.Statement.ConnPool.QueryContext(db.Statement.Context, db.Statement.SQL.String(), db.Statement.Vars...)
+	if err != nil {
+		db.AddError(err)
+		return nil, false
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		db.AddError(err)
+		return nil, false
+	}
+	result := &cachedResult{Columns: columns}
+	for rows.Next() {
+		raw := make([]interface{}, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range raw {
+			dest[i] = &raw[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			db.AddError(err)
+			return nil, false
+		}
+		values := make([]driver.Value, len(raw))
+		for i, v := range raw {
+			values[i] = v
+		}
+		result.Rows = append(result.Rows, values)
+	}
+	if err := rows.Err(); err != nil {
+		db.AddError(err)
+		return nil, false
+	}
+	return result, true
+}
+
+// scan 把原始行重放为 *sql.Rows 交给 gorm.Scan 填充 Dest
+func (p *queryCachePlugin) scan(db *gorm.DB, result *cachedResult) {
+	rows, err := replayDB.QueryContext(db.Statement.Context, "", result)
+	if err != nil {
+		db.AddError(err)
+		return
+	}
+	defer func() {
+		db.AddError(rows.Close())
+	}()
+	gorm.Scan(rows, db, 0)
+
+	if db.Statement.Result != nil {
+		db.Statement.Result.RowsAffected = db.RowsAffected
+	}
+}
+
+// save 将查询结果写入缓存，结果为空集或超过大小上限时不缓存
+func (p *queryCachePlugin) save(ctx context.Context, db *gorm.DB, key string, result *cachedResult, ttl time.Duration) {
+	if len(result.Rows) == 0 {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(result); err != nil {
+		p.logger.Warn("序列化查询结果失败", clog.String("table", db.Statement.Table), clog.Err(err))
+		return
+	}
+	if buf.Len() > p.cfg.MaxResultBytes {
+		p.logger.Debug("查询结果超过缓存大小上限，跳过缓存",
+			clog.String("table", db.Statement.Table),
+			clog.Int("bytes", buf.Len()))
+		return
+	}
+
+	if err := p.store.String().Set(ctx, key, buf.Bytes(), p.ttlFor(ttl)); err != nil {
+		p.logger.Warn("写入查询缓存失败", clog.String("key", key), clog.Err(err))
+	}
+}
+
+// ttlFor 计算查询的缓存时长：未指定时使用 DefaultTTL，超过 MaxTTL 时截断
+func (p *queryCachePlugin) ttlFor(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		ttl = p.cfg.DefaultTTL
+	}
+	if ttl > p.cfg.MaxTTL {
+		ttl = p.cfg.MaxTTL
+	}
+	return ttl
+}
+
+// afterWrite 写操作执行后失效表的缓存；处于 Provider.Transaction 中时记录该表，提交后再次失效
+func (p *queryCachePlugin) afterWrite(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Table == "" {
+		return
+	}
+	p.touch(db.Statement.Context, db.Statement.Table)
+}
+
+// afterRaw 原生 SQL 执行后失效其写入的表。多表 UPDATE/DELETE 只能识别第一张表，
+// 其余表需通过 db.Table 指定，或在写入后由调用方自行失效
+func (p *queryCachePlugin) afterRaw(db *gorm.DB) {
+	if db.Error != nil {
+		return
+	}
+	tables := make([]string, 0, 2)
+	if table := writtenTable(db.Statement.SQL.String()); table != "" {
+		tables = append(tables, table)
+	}
+	if db.Statement.Table != "" && (len(tables) == 0 || tables[0] != db.Statement.Table) {
+		tables = append(tables, db.Statement.Table)
+	}
+	if len(tables) > 0 {
+		p.touch(db.Statement.Context, tables...)
+	}
+}
+
+// touch 失效被写入的表；处于 Provider.Transaction 中时同时记录这些表，提交后再次失效
+func (p *queryCachePlugin) touch(ctx context.Context, tables ...string) {
+	if t, ok := ctx.Value(touchedTablesKey{}).(*touchedTables); ok {
+		for _, table := range tables {
+			t.add(table)
+		}
+	}
+	if err := p.invalidate(ctx, tables...); err != nil {
+		p.logger.Warn("失效查询缓存失败", clog.Strings("tables", tables), clog.Err(err))
+	}
+}
+
+// invalidate 递增各表的版本号，使已缓存的查询结果不再被命中
+func (p *queryCachePlugin) invalidate(ctx context.Context, tables ...string) error {
+	var errs []error
+	for _, table := range tables {
+		if _, err := p.store.String().Incr(ctx, p.versionKey(table)); err != nil {
+			errs = append(errs, fmt.Errorf("table %s: %w", table, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// normalizeSQL 合并 SQL 中连续的空白字符，使格式不同的相同语句共用缓存
+func normalizeSQL(sql string) string {
+	return strings.Join(strings.Fields(sql), " ")
+}
+
+// writeModifiers 写语句中表名之前可能出现的修饰关键字
+var writeModifiers = map[string]bool{
+	"low_priority": true, "high_priority": true, "delayed": true, "quick": true, "ignore": true,
+	"into": true, "from": true, "table": true, "online": true, "if": true, "exists": true,
+}
+
+// writtenTable 返回写语句（INSERT/REPLACE/UPDATE/DELETE/TRUNCATE/ALTER/DROP）写入的表名，
+// 非写语句返回空字符串。库名前缀和反引号会被去掉，与 Statement.Table 保持一致
+func writtenTable(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return ""
+	}
+	switch strings.ToLower(fields[0]) {
+	case "insert", "replace", "update", "delete", "truncate", "alter", "drop":
+	default:
+		return ""
+	}
+	for _, field := range fields[1:] {
+		if writeModifiers[strings.ToLower(field)] {
+			continue
+		}
+		if i := strings.IndexByte(field, '('); i >= 0 {
+			field = field[:i]
+		}
+		if i := strings.LastIndexByte(field, '.'); i >= 0 {
+			field = field[i+1:]
+		}
+		return strings.Trim(field, "`\"")
+	}
+	return ""
+}
+
+// replayDB 把缓存的原始行重放为 *sql.Rows。查询参数即 *cachedResult，
+// 由 database/sql 完成与真实查询相同的类型转换
+var replayDB = sql.OpenDB(replayConnector{})
+
+type replayConnector struct{}
+
+func (replayConnector) Connect(context.Context) (driver.Conn, error) {
+	return replayConn{}, nil
+}
+
+func (replayConnector) Driver() driver.Driver {
+	return replayDriver{}
+}
+
+type replayDriver struct{}
+
+func (replayDriver) Open(string) (driver.Conn, error) {
+	return replayConn{}, nil
+}
+
+type replayConn struct{}
+
+func (replayConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("replay driver does not support prepared statements")
+}
+
+func (replayConn) Close() error {
+	return nil
+}
+
+func (replayConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("replay driver does not support transactions")
+}
+
+// CheckNamedValue 原样接受 *cachedResult 参数
+func (replayConn) CheckNamedValue(*driver.NamedValue) error {
+	return nil
+}
+
+func (replayConn) QueryContext(_ context.Context, _ string, args []driver.NamedValue) (driver.Rows, error) {
+	if len(args) != 1 {
+		return nil, errors.New("replay query expects one cached result")
+	}
+	result, ok := args[0].Value.(*cachedResult)
+	if !ok {
+		return nil, fmt.Errorf("unexpected replay argument %T", args[0].Value)
+	}
+	return &replayRows{result: result}, nil
+}
+
+type replayRows struct {
+	result *cachedResult
+	next   int
+}
+
+func (r *replayRows) Columns() []string {
+	return r.result.Columns
+}
+
+func (r *replayRows) Close() error {
+	return nil
+}
+
+func (r *replayRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.result.Rows) {
+		return io.EOF
+	}
+	copy(dest, r.result.Rows[r.next])
+	r.next++
+	return nil
+}
@@ -0,0 +1,180 @@
+package internal
+
+import (
+	"context"
+	"database/sql/driver"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/cache"
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// memoryStore 是只实现字符串读写和自增的内存缓存
+type memoryStore struct {
+	cache.Provider
+	strings *memoryStrings
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{strings: &memoryStrings{values: map[string]string{}}}
+}
+
+func (m *memoryStore) String() cache.StringOperations {
+	return m.strings
+}
+
+type memoryStrings struct {
+	cache.StringOperations
+
+	mu     sync.Mutex
+	values map[string]string
+}
+
+func (m *memoryStrings) Get(_ context.Context, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.values[key]
+	if !ok {
+		return "", cache.ErrCacheMiss
+	}
+	return v, nil
+}
+
+func (m *memoryStrings) Set(_ context.Context, key string, value interface{}, _ time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch v := value.(type) {
+	case []byte:
+		m.values[key] = string(v)
+	case string:
+		m.values[key] = v
+	}
+	return nil
+}
+
+func (m *memoryStrings) Incr(_ context.Context, key string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, _ := strconv.ParseInt(m.values[key], 10, 64)
+	n++
+	m.values[key] = strconv.FormatInt(n, 10)
+	return n, nil
+}
+
+// openQueryCacheDB 创建注册了查询缓存插件的 fake 连接
+func openQueryCacheDB(t *testing.T, handler fakeHandler) (*gorm.DB, *fakeDB, *queryCachePlugin) {
+	t.Helper()
+	db, fake := openFakeDB(t, handler)
+	plugin := newQueryCachePlugin(*DefaultQueryCacheConfig(), newMemoryStore(), clog.Namespace("querycache-test"))
+	require.NoError(t, plugin.register(db))
+	return db, fake, plugin
+}
+
+func TestQueryCacheExecInvalidates(t *testing.T) {
+	db, _, plugin := openQueryCacheDB(t, nil)
+	ctx := context.Background()
+	version := func(table string) string {
+		v, err := plugin.version(ctx, table)
+		require.NoError(t, err)
+		return v
+	}
+
+	for _, sql := range []string{
+		"UPDATE `users` SET name = ? WHERE id = ?",
+		"insert ignore into im.users(id, name) values (?, ?)",
+		"DELETE FROM users WHERE id = ?",
+	} {
+		before := version("users")
+		require.NoError(t, db.WithContext(ctx).Exec(sql, 1, "alice").Error)
+		assert.NotEqual(t, before, version("users"), sql)
+	}
+
+	// 读语句不失效
+	before := version("users")
+	require.NoError(t, db.WithContext(ctx).Exec("SELECT 1 FROM users").Error)
+	assert.Equal(t, before, version("users"))
+
+	// 事务内的写入记录到上下文，提交后再次失效
+	txCtx, touched := withTouchedTables(ctx)
+	require.NoError(t, db.WithContext(txCtx).Exec("TRUNCATE TABLE orders").Error)
+	assert.Equal(t, []string{"orders"}, touched.list())
+}
+
+func TestWrittenTable(t *testing.T) {
+	tests := map[string]string{
+		"INSERT INTO users (id) VALUES (1)":           "users",
+		"insert low_priority ignore into `im`.`msgs`": "msgs",
+		"REPLACE users SET id = 1":                    "users",
+		"UPDATE IGNORE users SET name = 'a'":          "users",
+		"DELETE QUICK FROM `users` WHERE id = 1":      "users",
+		"TRUNCATE users":                              "users",
+		"ALTER TABLE users ADD COLUMN age INT":        "users",
+		"DROP TABLE IF EXISTS users":                  "users",
+		"SELECT * FROM users":                         "",
+		"   ":                                         "",
+	}
+	for sql, want := range tests {
+		assert.Equal(t, want, writtenTable(sql), sql)
+	}
+}
+
+// cachedMember 包含无法经 JSON 往返的字段
+type cachedMember struct {
+	ID       int64
+	Name     string
+	Password string `json:"-"`
+	JoinedAt time.Time
+	Avatar   []byte
+	Nickname *string
+}
+
+func TestQueryCacheReplaysRawRows(t *testing.T) {
+	joinedAt := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	db, fake, _ := openQueryCacheDB(t, func(query string, _ []driver.Value) (*fakeResult, error) {
+		if !strings.HasPrefix(query, "SELECT") {
+			return nil, nil
+		}
+		return &fakeResult{
+			columns: []string{"id", "name", "password", "joined_at", "avatar", "nickname"},
+			rows: [][]driver.Value{
+				{int64(1), []byte("alice"), []byte("secret"), joinedAt, []byte{0xff, 0x00}, nil},
+				{int64(2), []byte("bob"), []byte("hunter2"), joinedAt, nil, []byte("bobby")},
+			},
+		}, nil
+	})
+	ctx := WithQueryCache(context.Background(), time.Minute)
+
+	var miss []cachedMember
+	require.NoError(t, db.WithContext(ctx).Table("members").Find(&miss).Error)
+	require.Len(t, miss, 2)
+	assert.Equal(t, "secret", miss[0].Password)
+	assert.Equal(t, 1, fake.count("SELECT"))
+
+	// 命中缓存时不查询数据库，结果与直接查询完全一致
+	var hit []cachedMember
+	result := db.WithContext(ctx).Table("members").Find(&hit)
+	require.NoError(t, result.Error)
+	assert.Equal(t, int64(2), result.RowsAffected)
+	assert.Equal(t, miss, hit)
+	assert.Equal(t, 1, fake.count("SELECT"))
+
+	// 单条记录同样从缓存还原
+	var first cachedMember
+	require.NoError(t, db.WithContext(ctx).Table("members").Where("id = ?", 1).Take(&first).Error)
+	var cached cachedMember
+	require.NoError(t, db.WithContext(ctx).Table("members").Where("id = ?", 1).Take(&cached).Error)
+	assert.Equal(t, first, cached)
+	assert.Equal(t, 2, fake.count("SELECT"))
+
+	// 写入后重新查询
+	require.NoError(t, db.WithContext(ctx).Exec("UPDATE members SET name = ?", "carol").Error)
+	require.NoError(t, db.WithContext(ctx).Table("members").Find(&hit).Error)
+	assert.Equal(t, 3, fake.count("SELECT"))
+}
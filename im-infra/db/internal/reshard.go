@@ -0,0 +1,1037 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/ceyewan/gochat/im-infra/coord/config"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 重分片的阶段
+const (
+	// ReshardPhaseDualWrite 已创建新布局的表并开启双写，等待所有实例生效后开始拷贝
+	ReshardPhaseDualWrite = "dual_write"
+	// ReshardPhaseCopying 正在按检查点分批拷贝存量数据
+	ReshardPhaseCopying = "copying"
+	// ReshardPhaseCopied 存量数据拷贝完成，等待校验
+	ReshardPhaseCopied = "copied"
+	// ReshardPhaseVerified 校验通过，可以切换
+	ReshardPhaseVerified = "verified"
+	// ReshardPhaseCutover 正在切换，所有实例暂停对迁移表的读写
+	ReshardPhaseCutover = "cutover"
+	// ReshardPhaseDone 切换完成，所有实例按新的分片数路由
+	ReshardPhaseDone = "done"
+)
+
+// reshardRowsKey 保存 Update/Delete 受影响行的 Statement 实例键
+const reshardRowsKey = "db:reshard_rows"
+
+var (
+	// ErrReshardNotConfigured 未配置 Config.Reshard 或未注入配置中心
+	ErrReshardNotConfigured = errors.New("db: reshard is not configured")
+	// ErrReshardNotStarted 尚未开始重分片
+	ErrReshardNotStarted = errors.New("db: reshard has not been started")
+	// ErrReshardPhase 当前阶段不允许执行该操作
+	ErrReshardPhase = errors.New("db: operation is not allowed in current reshard phase")
+	// ErrReshardCutover 迁移表正在切换到新的分片布局，稍后重试
+	ErrReshardCutover = errors.New("db: table is being cut over to a new shard layout")
+)
+
+// ReshardPlan 重分片计划
+type ReshardPlan struct {
+	// Tables 需要迁移的逻辑表，为空时使用 ShardingConfig.Tables 中的所有表。
+	// 分片数对所有分片表全局生效，因此配置了 ShardingConfig.Tables 时必须包含其中的所有表
+	Tables []string `json:"tables"`
+
+	// ToShards 目标分片数，必须大于当前分片数
+	ToShards int `json:"toShards"`
+
+	// PrimaryKey 主键列，用于分批拷贝和双写同步，必须是单列且可排序
+	// 默认: "id"
+	PrimaryKey string `json:"primaryKey"`
+
+	// ShardingKey 分片键，由 Start 根据 ShardingConfig 填充
+	ShardingKey string `json:"shardingKey"`
+
+	// FromShards 迁移前的分片数，由 Start 根据当前分片数填充
+	FromShards int `json:"fromShards"`
+}
+
+// ReshardCheckpoint 一张源分片表的拷贝进度
+type ReshardCheckpoint struct {
+	// LastID 已拷贝的最大主键，下一批从它之后开始
+	LastID string `json:"lastId"`
+	// Copied 已拷贝（扫描）的行数
+	Copied int64 `json:"copied"`
+	// Done 是否已拷贝完成
+	Done bool `json:"done"`
+}
+
+// ReshardVerifyReport 新旧分片布局的校验报告
+type ReshardVerifyReport struct {
+	// SourceRows 旧布局中的总行数
+	SourceRows int64 `json:"sourceRows"`
+	// TargetRows 新布局中的总行数
+	TargetRows int64 `json:"targetRows"`
+	// Checked 逐行比对的行数
+	Checked int64 `json:"checked"`
+	// Missing 新布局中缺失的行数
+	Missing int64 `json:"missing"`
+	// Mismatched 新旧布局内容不一致的行数
+	Mismatched int64 `json:"mismatched"`
+	// Samples 部分不一致的记录，格式为 "表名:主键"
+	Samples []string `json:"samples,omitempty"`
+	// Consistent 新旧布局是否完全一致
+	Consistent bool `json:"consistent"`
+	// VerifiedAt 校验完成时间
+	VerifiedAt time.Time `json:"verifiedAt"`
+}
+
+// ReshardState 保存在配置中心的迁移状态，所有实例监听它切换双写、阻断和路由
+type ReshardState struct {
+	Phase string      `json:"phase"`
+	Plan  ReshardPlan `json:"plan"`
+	// Checkpoints 各源分片表的拷贝进度，键为源物理表名
+	Checkpoints map[string]*ReshardCheckpoint `json:"checkpoints"`
+	// Verify 最近一次校验报告
+	Verify    *ReshardVerifyReport `json:"verify,omitempty"`
+	StartedAt time.Time            `json:"startedAt"`
+	UpdatedAt time.Time            `json:"updatedAt"`
+}
+
+// dualWriting 判断该阶段是否需要双写
+func (s *ReshardState) dualWriting() bool {
+	switch s.Phase {
+	case ReshardPhaseDualWrite, ReshardPhaseCopying, ReshardPhaseCopied, ReshardPhaseVerified:
+		return true
+	default:
+		return false
+	}
+}
+
+// physicalTable 返回旧布局中的物理表名
+func physicalTable(table string, index int) string {
+	return table + shardSuffix(index)
+}
+
+// stagingTable 返回新布局在切换前使用的物理表名，如 messages_r16_03
+func stagingTable(table string, shards, index int) string {
+	return fmt.Sprintf("%s_r%d%s", table, shards, shardSuffix(index))
+}
+
+// archiveTable 返回切换后旧布局物理表的归档名，如 messages_f4_03
+func archiveTable(table string, shards, index int) string {
+	return fmt.Sprintf("%s_f%d%s", table, shards, shardSuffix(index))
+}
+
+// quoteName 为表名或列名加上反引号
+func quoteName(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// cursorValue 将检查点中的主键转换为查询参数，整数主键按整数比较，避免大整数被转换为浮点数后丢失精度
+func cursorValue(id string) interface{} {
+	if v, err := strconv.ParseInt(id, 10, 64); err == nil {
+		return v
+	}
+	return id
+}
+
+// resharder 实现 Resharder，同时作为插件在各实例上执行双写和切换阻断
+type resharder struct {
+	db       *gorm.DB
+	cfg      ReshardConfig
+	sharding *ShardingConfig
+	layout   *shardLayout
+	store    config.ConfigCenter
+	logger   clog.Logger
+
+	// state 本实例观察到的迁移状态，nil 表示没有进行中的迁移
+	state  atomic.Pointer[ReshardState]
+	cancel context.CancelFunc
+}
+
+// newResharder 读取当前迁移状态并开始监听状态变更
+func newResharder(db *gorm.DB, cfg Config, layout *shardLayout, store config.ConfigCenter, logger clog.Logger) (*resharder, error) {
+	r := &resharder{
+		db:       db,
+		cfg:      *cfg.Reshard,
+		sharding: cfg.Sharding,
+		layout:   layout,
+		store:    store,
+		logger:   logger,
+	}
+
+	// 启动时必须读到状态，否则迁移期间重启的实例会漏掉双写
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := r.refresh(ctx); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to load reshard state: %w", err)
+	}
+	r.cancel = cancel
+	go r.watch(ctx)
+	return r, nil
+}
+
+// close 停止监听迁移状态
+func (r *resharder) close() {
+	r.cancel()
+}
+
+// register 注册切换阻断和双写回调，双写在业务语句所在的事务内执行，与业务变更同时提交
+func (r *resharder) register(db *gorm.DB) error {
+	if err := db.Callback().Query().Before("gorm:query").
+		Register("db:reshard_guard", r.guard); err != nil {
+		return err
+	}
+
+	if err := db.Callback().Create().Before("gorm:create").After("gorm:begin_transaction").
+		Register("db:reshard_guard", r.beforeCreate); err != nil {
+		return err
+	}
+	if err := db.Callback().Create().After("gorm:create").Before("gorm:commit_or_rollback_transaction").
+		Register("db:reshard_dual_write", r.afterCreate); err != nil {
+		return err
+	}
+
+	if err := db.Callback().Update().Before("gorm:update").After("gorm:begin_transaction").
+		Register("db:reshard_capture", r.capture); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().After("gorm:update").Before("gorm:commit_or_rollback_transaction").
+		Register("db:reshard_dual_write", r.afterWrite); err != nil {
+		return err
+	}
+
+	if err := db.Callback().Delete().Before("gorm:delete").After("gorm:begin_transaction").
+		Register("db:reshard_capture", r.capture); err != nil {
+		return err
+	}
+	return db.Callback().Delete().After("gorm:delete").Before("gorm:commit_or_rollback_transaction").
+		Register("db:reshard_dual_write", r.afterWrite)
+}
+
+// planFor 返回语句所操作表的迁移状态，表不在迁移计划中时返回 nil
+func (r *resharder) planFor(db *gorm.DB) *ReshardState {
+	if db.Error != nil || db.Statement.Table == "" {
+		return nil
+	}
+	state := r.state.Load()
+	if state == nil || !slices.Contains(state.Plan.Tables, db.Statement.Table) {
+		return nil
+	}
+	return state
+}
+
+// guard 切换期间拒绝对迁移表的读写
+func (r *resharder) guard(db *gorm.DB) {
+	if state := r.planFor(db); state != nil && state.Phase == ReshardPhaseCutover {
+		db.AddError(fmt.Errorf("%w: %s", ErrReshardCutover, db.Statement.Table))
+	}
+}
+
+// beforeCreate 切换期间拒绝写入；双写期间为主键为零值的模型预先生成主键。
+// 分片插件生成的主键只写入改写后的 SQL 而不回填模型，不预先生成时双写无法定位新写入的行
+func (r *resharder) beforeCreate(db *gorm.DB) {
+	r.guard(db)
+	state := r.planFor(db)
+	if state == nil || !state.dualWriting() || db.Statement.Schema == nil {
+		return
+	}
+	pk := db.Statement.Schema.LookUpField(state.Plan.PrimaryKey)
+	if pk == nil {
+		return
+	}
+	shardingKey := db.Statement.Schema.LookUpField(state.Plan.ShardingKey)
+
+	assign := func(rv reflect.Value) {
+		if _, zero := pk.ValueOf(db.Statement.Context, rv); !zero {
+			return
+		}
+		// 与分片插件一样使用源分片表的索引作为 snowflake 节点
+		var index int
+		if shardingKey != nil {
+			value, _ := shardingKey.ValueOf(db.Statement.Context, rv)
+			index, _ = shardIndex(normalizeValue(value), state.Plan.FromShards)
+		}
+		if err := pk.Set(db.Statement.Context, rv, r.layout.generateID(int64(index))); err != nil {
+			db.AddError(fmt.Errorf("reshard: failed to generate primary key %s: %w", state.Plan.PrimaryKey, err))
+		}
+	}
+	switch rv := db.Statement.ReflectValue; rv.Kind() {
+	case reflect.Struct:
+		assign(rv)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			assign(reflect.Indirect(rv.Index(i)))
+		}
+	}
+}
+
+// capture 在 Update/Delete 执行前查询受影响行的主键和分片键
+func (r *resharder) capture(db *gorm.DB) {
+	r.guard(db)
+	state := r.planFor(db)
+	if state == nil || !state.dualWriting() {
+		return
+	}
+
+	conds := statementConditions(db.Statement)
+	if len(conds) == 0 {
+		// 分片表的语句必须带分片键条件，缺少条件的语句会被分片插件拒绝
+		return
+	}
+
+	var rows []map[string]interface{}
+	err := db.Session(&gorm.Session{NewDB: true, SkipHooks: true, Context: WithPrimary(db.Statement.Context)}).
+		Table(db.Statement.Table).
+		Select(state.Plan.PrimaryKey, state.Plan.ShardingKey).
+		Clauses(clause.Where{Exprs: conds}).
+		Find(&rows).Error
+	if err != nil {
+		db.AddError(fmt.Errorf("reshard: failed to capture affected rows: %w", err))
+		return
+	}
+	db.InstanceSet(reshardRowsKey, rows)
+}
+
+// afterCreate 将新写入的行同步到新布局
+func (r *resharder) afterCreate(db *gorm.DB) {
+	state := r.planFor(db)
+	if state == nil || !state.dualWriting() {
+		return
+	}
+
+	rows := modelSnapshots(db.Statement)
+	for _, row := range rows {
+		if v := normalizeValue(row[state.Plan.PrimaryKey]); v == nil || isZeroID(v) {
+			db.AddError(fmt.Errorf("reshard: dual write requires primary key %s of created rows of table %s",
+				state.Plan.PrimaryKey, db.Statement.Table))
+			return
+		}
+	}
+	r.sync(db, state, rows)
+}
+
+// afterWrite 将 Update/Delete 受影响的行同步到新布局
+func (r *resharder) afterWrite(db *gorm.DB) {
+	state := r.planFor(db)
+	if state == nil || !state.dualWriting() {
+		return
+	}
+	v, ok := db.InstanceGet(reshardRowsKey)
+	if !ok {
+		return
+	}
+	rows, _ := v.([]map[string]interface{})
+	r.sync(db, state, rows)
+}
+
+// sync 在语句所在的连接（事务）上按主键将旧布局中的行覆盖到新布局：
+// 先删除新布局中的行，再从旧布局重新拷贝，Create/Update/Delete 都归结为同一操作
+func (r *resharder) sync(db *gorm.DB, state *ReshardState, rows []map[string]interface{}) {
+	if len(rows) == 0 {
+		return
+	}
+	groups, err := groupByShard(db.Statement.Table, state.Plan, rows)
+	if err != nil {
+		db.AddError(fmt.Errorf("reshard: %w", err))
+		return
+	}
+
+	tx := db.Session(&gorm.Session{NewDB: true, SkipHooks: true})
+	pk := quoteName(state.Plan.PrimaryKey)
+	for _, group := range groups {
+		if err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s IN ?", quoteName(group.target), pk), group.ids).Error; err != nil {
+			db.AddError(fmt.Errorf("reshard: failed to dual write %s: %w", group.target, err))
+			return
+		}
+		err := tx.Exec(fmt.Sprintf("INSERT INTO %s SELECT * FROM %s WHERE %s IN ?",
+			quoteName(group.target), quoteName(group.source), pk), group.ids).Error
+		if err != nil {
+			db.AddError(fmt.Errorf("reshard: failed to dual write %s: %w", group.target, err))
+			return
+		}
+	}
+}
+
+// shardGroup 源分片表和目标分片表相同的一组行
+type shardGroup struct {
+	source string
+	target string
+	ids    []interface{}
+}
+
+// groupByShard 按源分片表和目标分片表对行分组，按表名排序以固定加锁顺序
+func groupByShard(table string, plan ReshardPlan, rows []map[string]interface{}) ([]*shardGroup, error) {
+	index := make(map[[2]string]*shardGroup)
+	for _, row := range rows {
+		key := normalizeValue(row[plan.ShardingKey])
+		from, err := shardIndex(key, plan.FromShards)
+		if err != nil {
+			return nil, err
+		}
+		to, err := shardIndex(key, plan.ToShards)
+		if err != nil {
+			return nil, err
+		}
+
+		pair := [2]string{physicalTable(table, from), stagingTable(table, plan.ToShards, to)}
+		group, ok := index[pair]
+		if !ok {
+			group = &shardGroup{source: pair[0], target: pair[1]}
+			index[pair] = group
+		}
+		group.ids = append(group.ids, normalizeValue(row[plan.PrimaryKey]))
+	}
+
+	groups := make([]*shardGroup, 0, len(index))
+	for _, group := range index {
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].source != groups[j].source {
+			return groups[i].source < groups[j].source
+		}
+		return groups[i].target < groups[j].target
+	})
+	return groups, nil
+}
+
+// isZeroID 判断主键是否为零值
+func isZeroID(v interface{}) bool {
+	switch id := v.(type) {
+	case string:
+		return id == ""
+	default:
+		return fmt.Sprint(id) == "0"
+	}
+}
+
+// ===== 状态读写与监听 =====
+
+// load 读取迁移状态和版本号，不存在时返回 nil
+func (r *resharder) load(ctx context.Context) (*ReshardState, int64, error) {
+	key := strings.Trim(r.cfg.StateKey, "/")
+	keys, err := r.store.List(ctx, path.Dir(key))
+	if err != nil {
+		return nil, 0, err
+	}
+	if !slices.ContainsFunc(keys, func(k string) bool { return strings.Trim(k, "/") == key }) {
+		return nil, 0, nil
+	}
+
+	var state ReshardState
+	version, err := r.store.GetWithVersion(ctx, r.cfg.StateKey, &state)
+	if err != nil {
+		return nil, 0, err
+	}
+	if state.Checkpoints == nil {
+		state.Checkpoints = map[string]*ReshardCheckpoint{}
+	}
+	return &state, version, nil
+}
+
+// save 以 CAS 方式保存迁移状态，version 为 0 表示状态尚不存在
+func (r *resharder) save(ctx context.Context, state *ReshardState, version int64) error {
+	state.UpdatedAt = time.Now()
+	if err := r.store.CompareAndSet(ctx, r.cfg.StateKey, state, version); err != nil {
+		return fmt.Errorf("failed to save reshard state (modified concurrently?): %w", err)
+	}
+	r.apply(state)
+	return nil
+}
+
+// update 读取迁移状态，经 fn 修改后保存
+func (r *resharder) update(ctx context.Context, fn func(state *ReshardState) error) (*ReshardState, error) {
+	state, version, err := r.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if state == nil {
+		return nil, ErrReshardNotStarted
+	}
+	if err := fn(state); err != nil {
+		return nil, err
+	}
+	if err := r.save(ctx, state, version); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// refresh 重新读取迁移状态并应用到本实例
+func (r *resharder) refresh(ctx context.Context) error {
+	state, _, err := r.load(ctx)
+	if err != nil {
+		return err
+	}
+	r.apply(state)
+	return nil
+}
+
+// apply 应用迁移状态：切换完成且本实例仍按旧分片数路由时切换到新的分片数
+func (r *resharder) apply(state *ReshardState) {
+	old := r.state.Swap(state)
+	if state != nil && (old == nil || old.Phase != state.Phase) {
+		r.logger.Info("重分片阶段变更",
+			clog.String("phase", state.Phase),
+			clog.Strings("tables", state.Plan.Tables),
+			clog.Int("fromShards", state.Plan.FromShards),
+			clog.Int("toShards", state.Plan.ToShards),
+		)
+	}
+	if state != nil && state.Phase == ReshardPhaseDone && r.layout.shards() == state.Plan.FromShards {
+		r.layout.setShards(state.Plan.ToShards)
+		r.logger.Info("已切换到新的分片布局", clog.Int("shards", state.Plan.ToShards))
+	}
+}
+
+// watch 监听迁移状态变更，监听中断后重新建立
+func (r *resharder) watch(ctx context.Context) {
+	for {
+		err := r.watchOnce(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		r.logger.Warn("重分片状态监听中断，稍后重试", clog.Err(err))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// watchOnce 建立一次监听，直到监听通道关闭
+func (r *resharder) watchOnce(ctx context.Context) error {
+	watcher, err := r.store.Watch(ctx, r.cfg.StateKey, &ReshardState{})
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	// 建立监听后重新读取一次，避免遗漏监听建立之前的变更
+	if err := r.refresh(ctx); err != nil {
+		return err
+	}
+	for event := range watcher.Chan() {
+		switch event.Type {
+		case config.EventTypeDelete:
+			r.apply(nil)
+		case config.EventTypePut:
+			state, ok := event.Value.(ReshardState)
+			if !ok {
+				r.logger.Warn("无法解析重分片状态", clog.String("key", event.Key))
+				continue
+			}
+			r.apply(&state)
+		}
+	}
+	return errors.New("watch channel closed")
+}
+
+// ===== Resharder 实现 =====
+
+// State 返回配置中心中的迁移状态，未开始时返回 nil
+func (r *resharder) State(ctx context.Context) (*ReshardState, error) {
+	state, _, err := r.load(ctx)
+	return state, err
+}
+
+// Start 创建新布局的表并开启双写
+func (r *resharder) Start(ctx context.Context, plan ReshardPlan) error {
+	current, version, err := r.load(ctx)
+	if err != nil {
+		return err
+	}
+	if current != nil && current.Phase != ReshardPhaseDone {
+		return fmt.Errorf("%w: reshard is already in phase %s", ErrReshardPhase, current.Phase)
+	}
+
+	plan.ShardingKey = r.sharding.ShardingKey
+	plan.FromShards = r.layout.shards()
+	if plan.PrimaryKey == "" {
+		plan.PrimaryKey = "id"
+	}
+	if len(plan.Tables) == 0 {
+		for table := range r.sharding.Tables {
+			plan.Tables = append(plan.Tables, table)
+		}
+	}
+	sort.Strings(plan.Tables)
+	if err := r.validatePlan(plan); err != nil {
+		return err
+	}
+
+	// 新布局的表结构与旧布局第一张分片表相同
+	for _, table := range plan.Tables {
+		for i := 0; i < plan.ToShards; i++ {
+			sql := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s LIKE %s",
+				quoteName(stagingTable(table, plan.ToShards, i)), quoteName(physicalTable(table, 0)))
+			if err := r.db.WithContext(ctx).Exec(sql).Error; err != nil {
+				return fmt.Errorf("failed to create table of new shard layout: %w", err)
+			}
+		}
+	}
+
+	now := time.Now()
+	state := &ReshardState{
+		Phase:       ReshardPhaseDualWrite,
+		Plan:        plan,
+		Checkpoints: map[string]*ReshardCheckpoint{},
+		StartedAt:   now,
+	}
+	if err := r.save(ctx, state, version); err != nil {
+		return err
+	}
+	r.logger.Info("重分片已开始，开启双写",
+		clog.Strings("tables", plan.Tables),
+		clog.Int("fromShards", plan.FromShards),
+		clog.Int("toShards", plan.ToShards),
+	)
+	return nil
+}
+
+// validatePlan 验证重分片计划
+func (r *resharder) validatePlan(plan ReshardPlan) error {
+	if plan.ToShards <= plan.FromShards {
+		return fmt.Errorf("target shards %d must be greater than current shards %d", plan.ToShards, plan.FromShards)
+	}
+	if len(plan.Tables) == 0 {
+		return fmt.Errorf("reshard plan has no tables")
+	}
+	if len(r.sharding.Tables) == 0 {
+		return nil
+	}
+	for _, table := range plan.Tables {
+		if _, ok := r.sharding.Tables[table]; !ok {
+			return fmt.Errorf("table %s is not a sharded table", table)
+		}
+	}
+	if len(plan.Tables) != len(r.sharding.Tables) {
+		return fmt.Errorf("reshard plan must include all %d sharded tables, shard count applies to all of them", len(r.sharding.Tables))
+	}
+	return nil
+}
+
+// Copy 分批拷贝存量数据，每批完成后保存检查点，中断后再次调用从检查点继续
+func (r *resharder) Copy(ctx context.Context) error {
+	state, version, err := r.load(ctx)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		return ErrReshardNotStarted
+	}
+	switch state.Phase {
+	case ReshardPhaseDualWrite:
+		// 开启双写后等待所有实例生效，否则拷贝之后的写入可能只写入旧布局
+		if wait := time.Until(state.StartedAt.Add(r.cfg.GracePeriod)); wait > 0 {
+			if err := sleepContext(ctx, wait); err != nil {
+				return err
+			}
+		}
+		state.Phase = ReshardPhaseCopying
+		if err := r.save(ctx, state, version); err != nil {
+			return err
+		}
+	case ReshardPhaseCopying:
+	case ReshardPhaseCopied, ReshardPhaseVerified:
+		return nil
+	default:
+		return fmt.Errorf("%w: cannot copy in phase %s", ErrReshardPhase, state.Phase)
+	}
+
+	plan := state.Plan
+	for _, table := range plan.Tables {
+		for i := 0; i < plan.FromShards; i++ {
+			source := physicalTable(table, i)
+			checkpoint := state.Checkpoints[source]
+			if checkpoint == nil {
+				checkpoint = &ReshardCheckpoint{}
+			}
+			for !checkpoint.Done {
+				copied, last, err := r.copyChunk(ctx, plan, table, i, checkpoint.LastID)
+				if err != nil {
+					return fmt.Errorf("failed to copy %s after %q: %w", source, checkpoint.LastID, err)
+				}
+				if copied > 0 {
+					checkpoint.LastID = last
+					checkpoint.Copied += copied
+				}
+				checkpoint.Done = copied < int64(r.cfg.ChunkSize)
+
+				saved := *checkpoint
+				state, err = r.update(ctx, func(s *ReshardState) error {
+					if s.Phase != ReshardPhaseCopying {
+						return fmt.Errorf("%w: phase changed to %s during copy", ErrReshardPhase, s.Phase)
+					}
+					s.Checkpoints[source] = &saved
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+			}
+			r.logger.Info("源分片表拷贝完成",
+				clog.String("table", source),
+				clog.Int64("copied", checkpoint.Copied),
+			)
+		}
+	}
+
+	_, err = r.update(ctx, func(s *ReshardState) error {
+		s.Phase = ReshardPhaseCopied
+		return nil
+	})
+	return err
+}
+
+// copyChunk 在一个事务内拷贝源分片表中主键大于 after 的一批行。
+// 读取主键时加共享锁，拷贝完成前并发的 Update/Delete 会等待，双写与拷贝不会互相覆盖；
+// 拷贝使用 INSERT IGNORE，已由双写写入的行保持不变
+func (r *resharder) copyChunk(ctx context.Context, plan ReshardPlan, table string, index int, after string) (int64, string, error) {
+	var copied int64
+	var last string
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		rows, err := r.scan(tx, physicalTable(table, index), plan, []string{plan.PrimaryKey, plan.ShardingKey}, after, true)
+		if err != nil || len(rows) == 0 {
+			return err
+		}
+		groups, err := groupByShard(table, plan, rows)
+		if err != nil {
+			return err
+		}
+		for _, group := range groups {
+			err := tx.Exec(fmt.Sprintf("INSERT IGNORE INTO %s SELECT * FROM %s WHERE %s IN ?",
+				quoteName(group.target), quoteName(group.source), quoteName(plan.PrimaryKey)), group.ids).Error
+			if err != nil {
+				return err
+			}
+		}
+		copied = int64(len(rows))
+		last = fmt.Sprint(normalizeValue(rows[len(rows)-1][plan.PrimaryKey]))
+		return nil
+	})
+	return copied, last, err
+}
+
+// scan 按主键顺序读取源分片表中主键大于 after 的一批行，columns 为空时读取所有列
+func (r *resharder) scan(tx *gorm.DB, source string, plan ReshardPlan, columns []string, after string, lock bool) ([]map[string]interface{}, error) {
+	selected := "*"
+	if len(columns) > 0 {
+		quoted := make([]string, len(columns))
+		for i, column := range columns {
+			quoted[i] = quoteName(column)
+		}
+		selected = strings.Join(quoted, ", ")
+	}
+
+	pk := quoteName(plan.PrimaryKey)
+	sql := fmt.Sprintf("SELECT %s FROM %s", selected, quoteName(source))
+	var args []interface{}
+	if after != "" {
+		sql += fmt.Sprintf(" WHERE %s > ?", pk)
+		args = append(args, cursorValue(after))
+	}
+	sql += fmt.Sprintf(" ORDER BY %s LIMIT %d", pk, r.cfg.ChunkSize)
+	if lock {
+		sql += " LOCK IN SHARE MODE"
+	}
+
+	var rows []map[string]interface{}
+	if err := tx.Raw(sql, args...).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// Verify 逐行比对新旧布局，一致时进入 verified 阶段。
+// 每批源数据与对应的新布局数据在同一个事务（同一快照）中读取，双写进行中也不会误报
+func (r *resharder) Verify(ctx context.Context) (*ReshardVerifyReport, error) {
+	state, _, err := r.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if state == nil {
+		return nil, ErrReshardNotStarted
+	}
+	if state.Phase != ReshardPhaseCopied && state.Phase != ReshardPhaseVerified {
+		return nil, fmt.Errorf("%w: cannot verify in phase %s", ErrReshardPhase, state.Phase)
+	}
+
+	plan := state.Plan
+	report := &ReshardVerifyReport{}
+	for _, table := range plan.Tables {
+		for i := 0; i < plan.FromShards; i++ {
+			last := ""
+			for {
+				n, next, err := r.verifyChunk(ctx, plan, table, i, last, report)
+				if err != nil {
+					return nil, fmt.Errorf("failed to verify %s: %w", physicalTable(table, i), err)
+				}
+				if n < r.cfg.ChunkSize {
+					break
+				}
+				last = next
+			}
+		}
+	}
+	if err := r.countRows(ctx, plan, report); err != nil {
+		return nil, err
+	}
+	report.Consistent = report.Missing == 0 && report.Mismatched == 0 && report.SourceRows == report.TargetRows
+	report.VerifiedAt = time.Now()
+
+	_, err = r.update(ctx, func(s *ReshardState) error {
+		if s.Phase != ReshardPhaseCopied && s.Phase != ReshardPhaseVerified {
+			return fmt.Errorf("%w: phase changed to %s during verify", ErrReshardPhase, s.Phase)
+		}
+		s.Verify = report
+		s.Phase = ReshardPhaseCopied
+		if report.Consistent {
+			s.Phase = ReshardPhaseVerified
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	r.logger.Info("重分片校验完成",
+		clog.Bool("consistent", report.Consistent),
+		clog.Int64("checked", report.Checked),
+		clog.Int64("missing", report.Missing),
+		clog.Int64("mismatched", report.Mismatched),
+		clog.Int64("sourceRows", report.SourceRows),
+		clog.Int64("targetRows", report.TargetRows),
+	)
+	return report, nil
+}
+
+// verifyChunk 比对一批源数据，返回本批行数和最大主键
+func (r *resharder) verifyChunk(ctx context.Context, plan ReshardPlan, table string, index int, after string, report *ReshardVerifyReport) (int, string, error) {
+	var n int
+	var last string
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		rows, err := r.scan(tx, physicalTable(table, index), plan, nil, after, false)
+		if err != nil || len(rows) == 0 {
+			return err
+		}
+		n = len(rows)
+		last = fmt.Sprint(normalizeValue(rows[n-1][plan.PrimaryKey]))
+
+		groups, err := groupByShard(table, plan, rows)
+		if err != nil {
+			return err
+		}
+		pks := []string{plan.PrimaryKey}
+		source := make(map[string]map[string]interface{}, len(rows))
+		for _, row := range rows {
+			source[recordID(pks, row)] = row
+		}
+
+		for _, group := range groups {
+			var targets []map[string]interface{}
+			err := tx.Raw(fmt.Sprintf("SELECT * FROM %s WHERE %s IN ?", quoteName(group.target), quoteName(plan.PrimaryKey)), group.ids).
+				Scan(&targets).Error
+			if err != nil {
+				return err
+			}
+			found := make(map[string]map[string]interface{}, len(targets))
+			for _, row := range targets {
+				found[recordID(pks, row)] = row
+			}
+			for _, id := range group.ids {
+				key := fmt.Sprint(normalizeValue(id))
+				report.Checked++
+				target, ok := found[key]
+				switch {
+				case !ok:
+					report.Missing++
+					report.sample(table + ":" + key)
+				case len(changedColumns(source[key], target)) > 0:
+					report.Mismatched++
+					report.sample(table + ":" + key)
+				}
+			}
+		}
+		return nil
+	})
+	return n, last, err
+}
+
+// countRows 在同一个事务中统计新旧布局的总行数
+func (r *resharder) countRows(ctx context.Context, plan ReshardPlan, report *ReshardVerifyReport) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		count := func(table string) (int64, error) {
+			var n int64
+			err := tx.Raw(fmt.Sprintf("SELECT COUNT(*) FROM %s", quoteName(table))).Scan(&n).Error
+			return n, err
+		}
+		for _, table := range plan.Tables {
+			for i := 0; i < plan.FromShards; i++ {
+				n, err := count(physicalTable(table, i))
+				if err != nil {
+					return err
+				}
+				report.SourceRows += n
+			}
+			for i := 0; i < plan.ToShards; i++ {
+				n, err := count(stagingTable(table, plan.ToShards, i))
+				if err != nil {
+					return err
+				}
+				report.TargetRows += n
+			}
+		}
+		return nil
+	})
+}
+
+// sample 记录一条不一致的记录，最多保留 20 条
+func (rep *ReshardVerifyReport) sample(record string) {
+	if len(rep.Samples) < 20 {
+		rep.Samples = append(rep.Samples, record)
+	}
+}
+
+// Cutover 切换到新的分片布局：所有实例暂停对迁移表的读写，等待 GracePeriod 后
+// 用一条 RENAME TABLE 原子地将旧布局归档、新布局改为正式表名，最后通知所有实例按新的分片数路由
+func (r *resharder) Cutover(ctx context.Context) error {
+	state, err := r.update(ctx, func(s *ReshardState) error {
+		if s.Phase != ReshardPhaseVerified {
+			return fmt.Errorf("%w: cutover requires a verified reshard, current phase %s", ErrReshardPhase, s.Phase)
+		}
+		s.Phase = ReshardPhaseCutover
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	plan := state.Plan
+
+	if err := sleepContext(ctx, r.cfg.GracePeriod); err != nil {
+		r.rollbackCutover(plan)
+		return err
+	}
+
+	var renames []string
+	for _, table := range plan.Tables {
+		for i := 0; i < plan.FromShards; i++ {
+			renames = append(renames, fmt.Sprintf("%s TO %s",
+				quoteName(physicalTable(table, i)), quoteName(archiveTable(table, plan.FromShards, i))))
+		}
+		for i := 0; i < plan.ToShards; i++ {
+			renames = append(renames, fmt.Sprintf("%s TO %s",
+				quoteName(stagingTable(table, plan.ToShards, i)), quoteName(physicalTable(table, i))))
+		}
+	}
+	if err := r.db.WithContext(ctx).Exec("RENAME TABLE " + strings.Join(renames, ", ")).Error; err != nil {
+		r.logger.Error("重分片切换失败，恢复读写", clog.Err(err))
+		r.rollbackCutover(plan)
+		return fmt.Errorf("failed to rename tables: %w", err)
+	}
+
+	r.layout.setShards(plan.ToShards)
+	_, err = r.update(context.WithoutCancel(ctx), func(s *ReshardState) error {
+		s.Phase = ReshardPhaseDone
+		return nil
+	})
+	if err != nil {
+		// 表已重命名，状态未能更新时其他实例仍在阻断读写，需要人工重试
+		r.logger.Error("表已切换但更新重分片状态失败，请重试 Cutover 或手动将状态置为 done", clog.Err(err))
+		return err
+	}
+
+	r.logger.Info("重分片切换完成",
+		clog.Strings("tables", plan.Tables),
+		clog.Int("shards", plan.ToShards),
+	)
+	return nil
+}
+
+// rollbackCutover 切换失败时恢复到 verified 阶段，解除读写阻断
+func (r *resharder) rollbackCutover(plan ReshardPlan) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := r.update(ctx, func(s *ReshardState) error {
+		s.Phase = ReshardPhaseVerified
+		return nil
+	})
+	if err != nil {
+		r.logger.Error("恢复重分片状态失败，迁移表的读写仍被阻断",
+			clog.Strings("tables", plan.Tables), clog.Err(err))
+	}
+}
+
+// Abort 放弃尚未切换的重分片：删除新布局的表并清除迁移状态，所有实例停止双写
+func (r *resharder) Abort(ctx context.Context) error {
+	state, _, err := r.load(ctx)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		return nil
+	}
+	if state.Phase == ReshardPhaseCutover || state.Phase == ReshardPhaseDone {
+		return fmt.Errorf("%w: cannot abort in phase %s", ErrReshardPhase, state.Phase)
+	}
+
+	// 先清除状态停止双写，再删除表，避免双写写入已删除的表
+	if err := r.store.Delete(ctx, r.cfg.StateKey); err != nil {
+		return fmt.Errorf("failed to delete reshard state: %w", err)
+	}
+	r.apply(nil)
+	if err := sleepContext(ctx, r.cfg.GracePeriod); err != nil {
+		return err
+	}
+
+	plan := state.Plan
+	for _, table := range plan.Tables {
+		for i := 0; i < plan.ToShards; i++ {
+			sql := "DROP TABLE IF EXISTS " + quoteName(stagingTable(table, plan.ToShards, i))
+			if err := r.db.WithContext(ctx).Exec(sql).Error; err != nil {
+				return fmt.Errorf("failed to drop table of new shard layout: %w", err)
+			}
+		}
+	}
+	r.logger.Info("重分片已放弃", clog.Strings("tables", plan.Tables))
+	return nil
+}
+
+// sleepContext 等待 d，ctx 结束时提前返回
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Resharder 返回重分片管理器，未配置 Config.Reshard 时返回 ErrReshardNotConfigured
+func (c *client) Resharder() (Resharder, error) {
+	if c.reshard == nil {
+		return nil, ErrReshardNotConfigured
+	}
+	return c.reshard, nil
+}
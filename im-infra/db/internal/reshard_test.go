@@ -0,0 +1,304 @@
+package internal
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// reshardMessage 重分片测试使用的模型，分片键为 user_id
+type reshardMessage struct {
+	ID      uint64 `gorm:"primaryKey"`
+	UserID  int64
+	Content string
+}
+
+func (reshardMessage) TableName() string {
+	return "messages"
+}
+
+// newTestResharder 在 fakeDB 上创建 2 分片的 resharder，state 非空时预先写入迁移状态
+func newTestResharder(t *testing.T, handler fakeHandler, state *ReshardState) (*resharder, *gorm.DB, *fakeDB, *memoryConfigCenter) {
+	t.Helper()
+	db, fake := openFakeDB(t, handler)
+	store := newMemoryConfigCenter()
+	cfg := Config{
+		Sharding: &ShardingConfig{
+			ShardingKey:    "user_id",
+			NumberOfShards: 2,
+			Tables:         map[string]*TableShardingConfig{"messages": {}},
+		},
+		Reshard: &ReshardConfig{StateKey: "db/reshard", ChunkSize: 2},
+	}
+	if state != nil {
+		require.NoError(t, store.Set(context.Background(), cfg.Reshard.StateKey, state))
+	}
+	layout, err := newShardLayout(cfg.Sharding.NumberOfShards)
+	require.NoError(t, err)
+
+	r, err := newResharder(db, cfg, layout, store, clog.Namespace("reshard-test"))
+	require.NoError(t, err)
+	t.Cleanup(r.close)
+	require.NoError(t, r.register(db))
+	fake.reset()
+	return r, db, fake, store
+}
+
+// testReshardPlan 从 2 分片扩容到 4 分片的计划
+func testReshardPlan() ReshardPlan {
+	return ReshardPlan{Tables: []string{"messages"}, ToShards: 4, FromShards: 2, PrimaryKey: "id", ShardingKey: "user_id"}
+}
+
+func TestGroupByShard(t *testing.T) {
+	plan := testReshardPlan()
+	rows := []map[string]interface{}{
+		{"id": int64(1), "user_id": int64(7)},    // 7%2=1, 7%4=3
+		{"id": int64(2), "user_id": int64(4)},    // 4%2=0, 4%4=0
+		{"id": int64(3), "user_id": int64(3)},    // 3%2=1, 3%4=3
+		{"id": int64(4), "user_id": int64(2)},    // 2%2=0, 2%4=2
+		{"id": int64(5), "user_id": []byte("5")}, // 驱动返回的字节按整数解析：5%2=1, 5%4=1
+	}
+
+	groups, err := groupByShard("messages", plan, rows)
+	require.NoError(t, err)
+
+	var got []string
+	for _, group := range groups {
+		got = append(got, group.source+"->"+group.target)
+	}
+	assert.Equal(t, []string{
+		"messages_00->messages_r4_00",
+		"messages_00->messages_r4_02",
+		"messages_01->messages_r4_01",
+		"messages_01->messages_r4_03",
+	}, got, "groups are sorted by source and target table")
+	assert.Equal(t, []interface{}{int64(1), int64(3)}, groups[3].ids)
+	assert.Equal(t, []interface{}{int64(5)}, groups[2].ids)
+
+	_, err = groupByShard("messages", plan, []map[string]interface{}{{"id": int64(1), "user_id": 1.5}})
+	assert.Error(t, err, "unsupported sharding key type")
+}
+
+func TestReshardPhases(t *testing.T) {
+	// 源表 messages_01 中有一行 (id=3, user_id=7)，扩容后属于 messages_r4_03
+	row := []driver.Value{int64(3), int64(7), "hello"}
+	handler := func(query string, args []driver.Value) (*fakeResult, error) {
+		switch {
+		case strings.HasPrefix(query, "SELECT COUNT(*) FROM `messages_01`"),
+			strings.HasPrefix(query, "SELECT COUNT(*) FROM `messages_r4_03`"):
+			return &fakeResult{columns: []string{"COUNT(*)"}, rows: [][]driver.Value{{int64(1)}}}, nil
+		case strings.HasPrefix(query, "SELECT COUNT(*)"):
+			return &fakeResult{columns: []string{"COUNT(*)"}, rows: [][]driver.Value{{int64(0)}}}, nil
+		case strings.HasPrefix(query, "SELECT `id`, `user_id` FROM `messages_01`") && len(args) == 0:
+			return &fakeResult{columns: []string{"id", "user_id"}, rows: [][]driver.Value{row[:2]}}, nil
+		case strings.HasPrefix(query, "SELECT * FROM `messages_01`") && len(args) == 0,
+			strings.HasPrefix(query, "SELECT * FROM `messages_r4_03`"):
+			return &fakeResult{columns: []string{"id", "user_id", "content"}, rows: [][]driver.Value{row}}, nil
+		}
+		return nil, nil
+	}
+	r, _, fake, _ := newTestResharder(t, handler, nil)
+	ctx := context.Background()
+	helper := newLayoutShardingHelper(&ShardingConfig{ShardingKey: "user_id", NumberOfShards: 2}, r.layout)
+	suffix, err := helper.GetShardSuffix(int64(7))
+	require.NoError(t, err)
+	assert.Equal(t, "_01", suffix)
+
+	// 未开始时只能 Start
+	assert.ErrorIs(t, r.Copy(ctx), ErrReshardNotStarted)
+	_, err = r.Verify(ctx)
+	assert.ErrorIs(t, err, ErrReshardNotStarted)
+	assert.ErrorIs(t, r.Cutover(ctx), ErrReshardNotStarted)
+	assert.Error(t, r.Start(ctx, ReshardPlan{ToShards: 2}), "target shards must be greater than current shards")
+
+	require.NoError(t, r.Start(ctx, ReshardPlan{ToShards: 4}))
+	state, err := r.State(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, ReshardPhaseDualWrite, state.Phase)
+	assert.Equal(t, testReshardPlan(), state.Plan, "plan is completed from the sharding config")
+	assert.Equal(t, 4, fake.count("CREATE TABLE IF NOT EXISTS"))
+	_, ok := fake.find("CREATE TABLE IF NOT EXISTS `messages_r4_03` LIKE `messages_00`")
+	assert.True(t, ok)
+
+	assert.ErrorIs(t, r.Start(ctx, ReshardPlan{ToShards: 8}), ErrReshardPhase)
+	_, err = r.Verify(ctx)
+	assert.ErrorIs(t, err, ErrReshardPhase)
+	assert.ErrorIs(t, r.Cutover(ctx), ErrReshardPhase)
+
+	require.NoError(t, r.Copy(ctx))
+	state, err = r.State(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, ReshardPhaseCopied, state.Phase)
+	assert.Equal(t, &ReshardCheckpoint{LastID: "3", Copied: 1, Done: true}, state.Checkpoints["messages_01"])
+	assert.Equal(t, &ReshardCheckpoint{Done: true}, state.Checkpoints["messages_00"])
+	copyStmt, ok := fake.find("INSERT IGNORE INTO `messages_r4_03` SELECT * FROM `messages_01`")
+	require.True(t, ok)
+	assert.Equal(t, []driver.Value{int64(3)}, copyStmt.args)
+	assert.NoError(t, r.Copy(ctx), "copy is a no-op once copied")
+	assert.ErrorIs(t, r.Cutover(ctx), ErrReshardPhase, "cutover requires verify")
+
+	report, err := r.Verify(ctx)
+	require.NoError(t, err)
+	assert.True(t, report.Consistent)
+	assert.Equal(t, int64(1), report.Checked)
+	assert.Equal(t, int64(1), report.SourceRows)
+	assert.Equal(t, int64(1), report.TargetRows)
+	state, err = r.State(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, ReshardPhaseVerified, state.Phase)
+
+	require.NoError(t, r.Cutover(ctx))
+	rename, ok := fake.find("RENAME TABLE")
+	require.True(t, ok)
+	assert.Contains(t, rename.query, "`messages_01` TO `messages_f2_01`")
+	assert.Contains(t, rename.query, "`messages_r4_03` TO `messages_03`")
+	assert.Equal(t, 4, r.layout.shards())
+	suffix, err = helper.GetShardSuffix(int64(7))
+	require.NoError(t, err)
+	assert.Equal(t, "_03", suffix, "suffix follows the active shard count after cutover")
+	state, err = r.State(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, ReshardPhaseDone, state.Phase)
+	assert.ErrorIs(t, r.Abort(ctx), ErrReshardPhase)
+}
+
+func TestReshardVerifyMismatch(t *testing.T) {
+	handler := func(query string, args []driver.Value) (*fakeResult, error) {
+		switch {
+		case strings.HasPrefix(query, "SELECT COUNT(*) FROM `messages_01`"):
+			return &fakeResult{columns: []string{"COUNT(*)"}, rows: [][]driver.Value{{int64(1)}}}, nil
+		case strings.HasPrefix(query, "SELECT COUNT(*)"):
+			return &fakeResult{columns: []string{"COUNT(*)"}, rows: [][]driver.Value{{int64(0)}}}, nil
+		case strings.HasPrefix(query, "SELECT * FROM `messages_01`") && len(args) == 0:
+			return &fakeResult{columns: []string{"id", "user_id"}, rows: [][]driver.Value{{int64(3), int64(7)}}}, nil
+		}
+		return nil, nil
+	}
+	plan := testReshardPlan()
+	r, _, _, _ := newTestResharder(t, handler, &ReshardState{Phase: ReshardPhaseCopied, Plan: plan})
+
+	report, err := r.Verify(context.Background())
+	require.NoError(t, err)
+	assert.False(t, report.Consistent)
+	assert.Equal(t, int64(1), report.Missing)
+	assert.Equal(t, []string{"messages:3"}, report.Samples)
+
+	state, err := r.State(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, ReshardPhaseCopied, state.Phase, "inconsistent verify stays in copied")
+}
+
+func TestReshardDualWrite(t *testing.T) {
+	handler := func(query string, args []driver.Value) (*fakeResult, error) {
+		// Update/Delete 执行前捕获受影响的行
+		if strings.HasPrefix(query, "SELECT id,user_id FROM `messages`") {
+			return &fakeResult{columns: []string{"id", "user_id"}, rows: [][]driver.Value{{int64(3), int64(7)}}}, nil
+		}
+		return nil, nil
+	}
+
+	for _, phase := range []string{ReshardPhaseDualWrite, ReshardPhaseCopying, ReshardPhaseCopied, ReshardPhaseVerified} {
+		t.Run(phase, func(t *testing.T) {
+			_, db, fake, _ := newTestResharder(t, handler, &ReshardState{Phase: phase, Plan: testReshardPlan()})
+			ctx := context.Background()
+
+			// 主键由分片插件生成时模型中为零值，双写前预先生成
+			msg := reshardMessage{UserID: 7, Content: "hello"}
+			require.NoError(t, db.WithContext(ctx).Create(&msg).Error)
+			assert.NotZero(t, msg.ID)
+			del, ok := fake.find("DELETE FROM `messages_r4_03`")
+			require.True(t, ok, "queries: %v", fake.queries())
+			assert.Equal(t, []driver.Value{int64(msg.ID)}, del.args)
+			_, ok = fake.find("INSERT INTO `messages_r4_03` SELECT * FROM `messages_01`")
+			assert.True(t, ok)
+			assert.Equal(t, []string{"BEGIN"}, fake.queries()[:1], "dual write runs in the statement's transaction")
+			assert.Equal(t, "COMMIT", fake.queries()[len(fake.queries())-1])
+
+			fake.reset()
+			err := db.WithContext(ctx).Model(&reshardMessage{}).Where("user_id = ?", 7).Update("content", "bye").Error
+			require.NoError(t, err)
+			del, ok = fake.find("DELETE FROM `messages_r4_03`")
+			require.True(t, ok, "queries: %v", fake.queries())
+			assert.Equal(t, []driver.Value{int64(3)}, del.args)
+
+			fake.reset()
+			require.NoError(t, db.WithContext(ctx).Where("user_id = ?", 7).Delete(&reshardMessage{}).Error)
+			assert.Equal(t, 1, fake.count("DELETE FROM `messages_r4_03`"))
+			assert.Equal(t, 1, fake.count("INSERT INTO `messages_r4_03` SELECT"))
+		})
+	}
+
+	t.Run("NotDualWriting", func(t *testing.T) {
+		_, db, fake, _ := newTestResharder(t, handler, nil)
+		msg := reshardMessage{UserID: 7}
+		require.NoError(t, db.Create(&msg).Error)
+		assert.Zero(t, msg.ID, "primary key is left to the sharding plugin")
+		assert.Zero(t, fake.count("messages_r4_"))
+	})
+
+	t.Run("FailedDualWriteRollsBack", func(t *testing.T) {
+		failing := func(query string, args []driver.Value) (*fakeResult, error) {
+			if strings.HasPrefix(query, "INSERT INTO `messages_r4_03` SELECT") {
+				return nil, errors.New("table is missing")
+			}
+			return nil, nil
+		}
+		_, db, fake, _ := newTestResharder(t, failing, &ReshardState{Phase: ReshardPhaseCopying, Plan: testReshardPlan()})
+		err := db.Create(&reshardMessage{UserID: 7}).Error
+		assert.ErrorContains(t, err, "reshard: failed to dual write messages_r4_03")
+		assert.Equal(t, "ROLLBACK", fake.queries()[len(fake.queries())-1])
+	})
+}
+
+func TestReshardCutoverRollback(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("RenameFails", func(t *testing.T) {
+		handler := func(query string, args []driver.Value) (*fakeResult, error) {
+			if strings.HasPrefix(query, "RENAME TABLE") {
+				return nil, errors.New("lock wait timeout")
+			}
+			return nil, nil
+		}
+		r, db, _, _ := newTestResharder(t, handler, &ReshardState{Phase: ReshardPhaseVerified, Plan: testReshardPlan()})
+
+		err := r.Cutover(ctx)
+		assert.ErrorContains(t, err, "failed to rename tables")
+		state, err := r.State(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, ReshardPhaseVerified, state.Phase)
+		assert.Equal(t, 2, r.layout.shards(), "layout is unchanged")
+		assert.NoError(t, db.Create(&reshardMessage{UserID: 7}).Error, "reads and writes are unblocked")
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		r, db, fake, _ := newTestResharder(t, nil, &ReshardState{Phase: ReshardPhaseVerified, Plan: testReshardPlan()})
+		r.cfg.GracePeriod = time.Minute
+
+		cancelCtx, cancel := context.WithCancel(ctx)
+		go func() {
+			// 等到切换阶段生效后取消
+			for r.state.Load().Phase != ReshardPhaseCutover {
+				time.Sleep(time.Millisecond)
+			}
+			assert.ErrorIs(t, db.Create(&reshardMessage{UserID: 7}).Error, ErrReshardCutover)
+			var msgs []reshardMessage
+			assert.ErrorIs(t, db.Find(&msgs).Error, ErrReshardCutover)
+			cancel()
+		}()
+
+		assert.ErrorIs(t, r.Cutover(cancelCtx), context.Canceled)
+		state, err := r.State(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, ReshardPhaseVerified, state.Phase)
+		assert.Zero(t, fake.count("RENAME TABLE"))
+	})
+}
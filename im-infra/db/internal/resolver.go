@@ -0,0 +1,189 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/ceyewan/gochat/im-infra/ctxmeta"
+	"gorm.io/gorm"
+)
+
+// primaryKey 强制读主库的上下文键
+type primaryKey struct{}
+
+// WithPrimary 返回一个强制在主库执行查询的上下文
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// WithSessionID 将请求/会话 ID 注入上下文，用于写后一段时间内粘滞读主库
+func WithSessionID(ctx context.Context, sessionID string) context.Context {
+	return ctxmeta.WithSessionID(ctx, sessionID)
+}
+
+// isPrimaryForced 检查上下文是否要求读主库
+func isPrimaryForced(ctx context.Context) bool {
+	forced, _ := ctx.Value(primaryKey{}).(bool)
+	return forced
+}
+
+// sessionIDFromContext 从上下文获取会话 ID
+func sessionIDFromContext(ctx context.Context) string {
+	return ctxmeta.SessionID(ctx)
+}
+
+// sweepInterval 每写入多少次清理一次过期的粘滞会话
+const sweepInterval = 1024
+
+// readWriteResolver 基于 GORM 回调实现读写分离。
+// 查询默认路由到只读副本，以下情况仍在主库执行：
+//   - 事务内的查询
+//   - 上下文通过 WithPrimary 强制读主库
+//   - 同一会话在 StickyPrimaryWindow 时间窗口内发生过写操作
+type readWriteResolver struct {
+	primary  gorm.ConnPool
+	replicas []*sql.DB
+	next     atomic.Uint64
+
+	stickyWindow time.Duration
+	lastWrites   sync.Map // sessionID -> time.Time（粘滞截止时间）
+	writeCount   atomic.Uint64
+
+	logger clog.Logger
+}
+
+// newReadWriteResolver 打开只读副本连接并创建解析器，配置了凭据轮换时副本同样使用轮换后的用户名和密码
+func newReadWriteResolver(db *gorm.DB, cfg Config, rotator *credentialRotator, logger clog.Logger) (*readWriteResolver, error) {
+	r := &readWriteResolver{
+		primary:      db.ConnPool,
+		stickyWindow: cfg.StickyPrimaryWindow,
+		logger:       logger,
+	}
+
+	for i, dsn := range cfg.Replicas {
+		replica, err := gorm.Open(openDialector(rotator, dsn, false), &gorm.Config{Logger: db.Logger})
+		if err != nil {
+			r.close()
+			return nil, fmt.Errorf("failed to connect to replica %d: %w", i, err)
+		}
+		sqlDB, err := replica.DB()
+		if err != nil {
+			r.close()
+			return nil, fmt.Errorf("failed to get replica %d connection: %w", i, err)
+		}
+		sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+		sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+		sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+		sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+		r.replicas = append(r.replicas, sqlDB)
+	}
+
+	return r, nil
+}
+
+// register 注册读写分离相关的 GORM 回调
+func (r *readWriteResolver) register(db *gorm.DB) error {
+	if err := db.Callback().Query().Before("gorm:query").Register("db:route_read", r.routeRead); err != nil {
+		return err
+	}
+	if err := db.Callback().Row().Before("gorm:row").Register("db:route_read", r.routeRead); err != nil {
+		return err
+	}
+	if err := db.Callback().Create().After("gorm:create").Register("db:mark_write", r.markWrite); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().After("gorm:update").Register("db:mark_write", r.markWrite); err != nil {
+		return err
+	}
+	if err := db.Callback().Delete().After("gorm:delete").Register("db:mark_write", r.markWrite); err != nil {
+		return err
+	}
+	return db.Callback().Raw().After("gorm:raw").Register("db:mark_write", r.markWrite)
+}
+
+// routeRead 为查询选择连接池
+func (r *readWriteResolver) routeRead(db *gorm.DB) {
+	if len(r.replicas) == 0 || db.Statement.ConnPool != r.primary {
+		// 无副本，或处于事务/分片等自定义连接池中，保持原连接
+		return
+	}
+
+	ctx := db.Statement.Context
+	if isPrimaryForced(ctx) || r.isSticky(ctx) {
+		return
+	}
+
+	idx := r.next.Add(1) % uint64(len(r.replicas))
+	db.Statement.ConnPool = r.replicas[idx]
+}
+
+// snapshotPool 为快照事务选择连接池，规则与 routeRead 相同
+func (r *readWriteResolver) snapshotPool(ctx context.Context) gorm.ConnPool {
+	if len(r.replicas) == 0 || isPrimaryForced(ctx) || r.isSticky(ctx) {
+		return r.primary
+	}
+	idx := r.next.Add(1) % uint64(len(r.replicas))
+	return r.replicas[idx]
+}
+
+// markWrite 记录会话的写操作，开启粘滞读主库窗口
+func (r *readWriteResolver) markWrite(db *gorm.DB) {
+	if r.stickyWindow <= 0 || db.Error != nil {
+		return
+	}
+	sessionID := sessionIDFromContext(db.Statement.Context)
+	if sessionID == "" {
+		return
+	}
+
+	r.lastWrites.Store(sessionID, time.Now().Add(r.stickyWindow))
+	if r.writeCount.Add(1)%sweepInterval == 0 {
+		r.sweep()
+	}
+}
+
+// isSticky 检查会话是否仍处于写后读主库窗口内
+func (r *readWriteResolver) isSticky(ctx context.Context) bool {
+	if r.stickyWindow <= 0 {
+		return false
+	}
+	sessionID := sessionIDFromContext(ctx)
+	if sessionID == "" {
+		return false
+	}
+
+	deadline, ok := r.lastWrites.Load(sessionID)
+	if !ok {
+		return false
+	}
+	if time.Now().Before(deadline.(time.Time)) {
+		return true
+	}
+	r.lastWrites.Delete(sessionID)
+	return false
+}
+
+// sweep 清理过期的粘滞会话
+func (r *readWriteResolver) sweep() {
+	now := time.Now()
+	r.lastWrites.Range(func(key, value any) bool {
+		if now.After(value.(time.Time)) {
+			r.lastWrites.Delete(key)
+		}
+		return true
+	})
+}
+
+// close 关闭所有只读副本连接
+func (r *readWriteResolver) close() {
+	for _, replica := range r.replicas {
+		if err := replica.Close(); err != nil {
+			r.logger.Error("关闭只读副本连接失败", clog.Err(err))
+		}
+	}
+}
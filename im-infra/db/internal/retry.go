@@ -0,0 +1,330 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+// defaultRetryableCodes 默认视为瞬时错误的 MySQL 错误码
+var defaultRetryableCodes = []uint16{
+	1047, // ER_UNKNOWN_COM_ERROR，Galera 节点未就绪
+	1213, // ER_LOCK_DEADLOCK，死锁，单条语句已被回滚
+	2006, // CR_SERVER_GONE_ERROR，MySQL server has gone away
+	2013, // CR_SERVER_LOST，查询过程中连接丢失
+}
+
+// RetryStats 语句级重试统计信息
+type RetryStats struct {
+	// Retries 重试总次数
+	Retries int64
+	// Recovered 经重试后成功的语句数
+	Recovered int64
+	// Exhausted 重试次数耗尽仍失败的语句数
+	Exhausted int64
+}
+
+const (
+	// retryPoolKey 保存原始连接池的 Statement 实例键
+	retryPoolKey = "db:retry_pool"
+	// retryOutsideTxKey 标记写操作不在调用方事务中的 Statement 实例键
+	retryOutsideTxKey = "db:retry_outside_tx"
+	// retryReplayingKey 标记写操作正在重放的 Statement 实例键
+	retryReplayingKey = "db:retry_replaying"
+)
+
+// retryPlugin 基于 GORM 回调实现语句级重试。
+// 执行前将本次语句的连接池替换为带重试的包装，执行后还原，
+// 因此与读写分离选择的副本连接池兼容，且不会影响后续语句。
+// 事务内的语句不单独重试：死锁和连接断开都会使整个事务失效。
+// GORM 默认事务中的写操作由 replay 在事务回滚后整体重放，调用方的事务需由调用方重试。
+type retryPlugin struct {
+	cfg       RetryConfig
+	retryable map[uint16]bool
+	logger    clog.Logger
+
+	retries   atomic.Int64
+	recovered atomic.Int64
+	exhausted atomic.Int64
+}
+
+// newRetryPlugin 创建语句级重试插件
+func newRetryPlugin(cfg RetryConfig, logger clog.Logger) *retryPlugin {
+	retryable := make(map[uint16]bool, len(defaultRetryableCodes)+len(cfg.RetryableErrorCodes))
+	for _, code := range defaultRetryableCodes {
+		retryable[code] = true
+	}
+	for _, code := range cfg.RetryableErrorCodes {
+		retryable[code] = true
+	}
+
+	return &retryPlugin{
+		cfg:       cfg,
+		retryable: retryable,
+		logger:    logger,
+	}
+}
+
+// register 注册执行前后的回调。
+// 查询的包装回调排在读写分离之后，以便包装最终选中的连接池。
+func (p *retryPlugin) register(db *gorm.DB) error {
+	if err := db.Callback().Query().Before("gorm:query").After("db:route_read").Register("db:retry", p.wrap); err != nil {
+		return err
+	}
+	if err := db.Callback().Query().After("gorm:query").Register("db:retry_restore", p.restore); err != nil {
+		return err
+	}
+	if err := db.Callback().Row().Before("gorm:row").After("db:route_read").Register("db:retry", p.wrap); err != nil {
+		return err
+	}
+	if err := db.Callback().Row().After("gorm:row").Register("db:retry_restore", p.restore); err != nil {
+		return err
+	}
+	if !p.cfg.RetryWrites {
+		return nil
+	}
+
+	// 关闭 SkipDefaultTransaction 时写操作在默认事务中执行，wrap 不会包装事务连接，
+	// 由 replay 在默认事务回滚后重放整条回调链
+	create := db.Callback().Create()
+	if err := create.Before("*").Register("db:retry_mark", p.mark); err != nil {
+		return err
+	}
+	if err := create.Before("gorm:create").Register("db:retry", p.wrap); err != nil {
+		return err
+	}
+	if err := create.After("gorm:create").Register("db:retry_restore", p.restore); err != nil {
+		return err
+	}
+	if err := create.After("*").Register("db:retry_replay", p.replay(create.Execute)); err != nil {
+		return err
+	}
+	update := db.Callback().Update()
+	if err := update.Before("*").Register("db:retry_mark", p.mark); err != nil {
+		return err
+	}
+	if err := update.Before("gorm:update").Register("db:retry", p.wrap); err != nil {
+		return err
+	}
+	if err := update.After("gorm:update").Register("db:retry_restore", p.restore); err != nil {
+		return err
+	}
+	if err := update.After("*").Register("db:retry_replay", p.replay(update.Execute)); err != nil {
+		return err
+	}
+	del := db.Callback().Delete()
+	if err := del.Before("*").Register("db:retry_mark", p.mark); err != nil {
+		return err
+	}
+	if err := del.Before("gorm:delete").Register("db:retry", p.wrap); err != nil {
+		return err
+	}
+	if err := del.After("gorm:delete").Register("db:retry_restore", p.restore); err != nil {
+		return err
+	}
+	if err := del.After("*").Register("db:retry_replay", p.replay(del.Execute)); err != nil {
+		return err
+	}
+	if err := db.Callback().Raw().Before("gorm:raw").Register("db:retry", p.wrap); err != nil {
+		return err
+	}
+	return db.Callback().Raw().After("gorm:raw").Register("db:retry_restore", p.restore)
+}
+
+// wrap 为非事务语句包装带重试的连接池
+func (p *retryPlugin) wrap(db *gorm.DB) {
+	pool := db.Statement.ConnPool
+	if pool == nil {
+		return
+	}
+	if _, inTx := pool.(gorm.TxCommitter); inTx {
+		return
+	}
+	if _, wrapped := pool.(*retryConnPool); wrapped {
+		return
+	}
+
+	db.InstanceSet(retryPoolKey, pool)
+	db.Statement.ConnPool = &retryConnPool{ConnPool: pool, plugin: p}
+}
+
+// restore 还原原始连接池
+func (p *retryPlugin) restore(db *gorm.DB) {
+	v, ok := db.InstanceGet(retryPoolKey)
+	if !ok {
+		return
+	}
+	if _, wrapped := db.Statement.ConnPool.(*retryConnPool); wrapped {
+		db.Statement.ConnPool = v.(gorm.ConnPool)
+	}
+}
+
+// mark 记录写操作是否在调用方的事务之外，只有这类写操作的默认事务可以整体重放
+func (p *retryPlugin) mark(db *gorm.DB) {
+	if _, inTx := db.Statement.ConnPool.(gorm.TxCommitter); !inTx {
+		db.InstanceSet(retryOutsideTxKey, true)
+	}
+}
+
+// replay 返回重放默认事务的回调。
+// 默认事务中的语句不能单独重试：死锁或断连后事务已整体回滚，再执行的语句会落在事务之外。
+// 因此写操作遇到瞬时错误时，在 gorm:commit_or_rollback_transaction 回滚之后，
+// 按退避重新执行整条回调链（BEGIN、语句、审计和双写等钩子、COMMIT）。
+// 开启 SkipDefaultTransaction 时语句已由 wrap 重试，不再重放。
+func (p *retryPlugin) replay(execute func(db *gorm.DB) *gorm.DB) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		if db.Error == nil || db.Config.SkipDefaultTransaction || !p.isRetryable(db.Error) {
+			return
+		}
+		if _, outside := db.InstanceGet(retryOutsideTxKey); !outside {
+			return
+		}
+		if replaying, _ := db.InstanceGet(retryReplayingKey); replaying == true {
+			return
+		}
+		db.InstanceSet(retryReplayingKey, true)
+		defer db.InstanceSet(retryReplayingKey, false)
+
+		// 首次执行的错误作为第一次尝试的结果，之后每次尝试都重新执行回调链
+		first := db.Error
+		db.Error = p.do(db.Statement.Context, db.Statement.SQL.String(), func() error {
+			if first != nil {
+				err := first
+				first = nil
+				return err
+			}
+			db.Error = nil
+			db.RowsAffected = 0
+			execute(db)
+			return db.Error
+		})
+	}
+}
+
+// stats 返回重试统计信息
+func (p *retryPlugin) stats() RetryStats {
+	return RetryStats{
+		Retries:   p.retries.Load(),
+		Recovered: p.recovered.Load(),
+		Exhausted: p.exhausted.Load(),
+	}
+}
+
+// do 执行 op，遇到瞬时错误时按指数退避重试
+func (p *retryPlugin) do(ctx context.Context, query string, op func() error) error {
+	backoff := p.cfg.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil {
+			if attempt > 1 {
+				p.recovered.Add(1)
+				p.logger.Info("语句重试成功",
+					clog.String("sql", query),
+					clog.Int("attempts", attempt),
+				)
+			}
+			return nil
+		}
+		if !p.isRetryable(err) {
+			return err
+		}
+		if attempt >= p.cfg.MaxAttempts {
+			p.exhausted.Add(1)
+			p.logger.Error("语句重试次数耗尽",
+				clog.Err(err),
+				clog.String("sql", query),
+				clog.Int("attempts", attempt),
+			)
+			return err
+		}
+
+		// 在 [backoff/2, backoff] 之间随机等待，避免故障恢复时集中重试
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		p.logger.Warn("语句遇到瞬时错误，准备重试",
+			clog.Err(err),
+			clog.String("sql", query),
+			clog.Int("attempt", attempt),
+			clog.Duration("backoff", wait),
+		)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+
+		p.retries.Add(1)
+		backoff *= 2
+		if backoff > p.cfg.MaxBackoff {
+			backoff = p.cfg.MaxBackoff
+		}
+	}
+}
+
+// isRetryable 判断错误是否为瞬时错误
+func (p *retryPlugin) isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return p.retryable[mysqlErr.Number]
+	}
+	return isConnError(err)
+}
+
+// isConnError 判断错误是否为连接断开、拒绝或网络超时
+func isConnError(err error) bool {
+	if errors.Is(err, mysql.ErrInvalidConn) || errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// retryConnPool 带重试的连接池包装
+// QueryRowContext 的错误延迟到 Scan 时才返回，无法在此重试，直接透传。
+type retryConnPool struct {
+	gorm.ConnPool
+	plugin *retryPlugin
+}
+
+// ExecContext 执行语句，遇到瞬时错误时重试
+func (p *retryConnPool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	var result sql.Result
+	err := p.plugin.do(ctx, query, func() error {
+		var err error
+		result, err = p.ConnPool.ExecContext(ctx, query, args...)
+		return err
+	})
+	return result, err
+}
+
+// QueryContext 执行查询，遇到瞬时错误时重试
+func (p *retryConnPool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	var rows *sql.Rows
+	err := p.plugin.do(ctx, query, func() error {
+		var err error
+		rows, err = p.ConnPool.QueryContext(ctx, query, args...)
+		return err
+	})
+	return rows, err
+}
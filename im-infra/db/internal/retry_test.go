@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"database/sql/driver"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type retryNote struct {
+	ID   int64
+	Body string
+}
+
+// openRetryDB 创建前 failures 次 INSERT 返回 err 的测试连接
+func openRetryDB(t *testing.T, cfg RetryConfig, failures int64, err error) (*gorm.DB, *fakeDB, *retryPlugin) {
+	t.Helper()
+	var remaining atomic.Int64
+	remaining.Store(failures)
+	db, fake := openFakeDB(t, func(query string, _ []driver.Value) (*fakeResult, error) {
+		if strings.HasPrefix(query, "INSERT") && remaining.Add(-1) >= 0 {
+			return nil, err
+		}
+		return nil, nil
+	})
+	plugin := newRetryPlugin(cfg, clog.Namespace("retry-test"))
+	require.NoError(t, plugin.register(db))
+	return db, fake, plugin
+}
+
+func TestRetryWrites(t *testing.T) {
+	cfg := RetryConfig{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+		RetryWrites:    true,
+	}
+	deadlock := &mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"}
+
+	t.Run("DefaultTransactionReplayed", func(t *testing.T) {
+		db, fake, plugin := openRetryDB(t, cfg, 1, deadlock)
+
+		require.NoError(t, db.Create(&retryNote{ID: 1, Body: "hello"}).Error)
+		queries := fake.queries()
+		require.Len(t, queries, 6)
+		assert.Equal(t, []string{"BEGIN", "ROLLBACK", "BEGIN", "COMMIT"},
+			[]string{queries[0], queries[2], queries[3], queries[5]}, "the whole transaction is replayed")
+		assert.Contains(t, queries[4], "INSERT INTO `retry_notes`")
+		assert.Equal(t, RetryStats{Retries: 1, Recovered: 1}, plugin.stats())
+	})
+
+	t.Run("SkipDefaultTransaction", func(t *testing.T) {
+		db, fake, plugin := openRetryDB(t, cfg, 2, deadlock)
+
+		tx := db.Session(&gorm.Session{SkipDefaultTransaction: true})
+		require.NoError(t, tx.Create(&retryNote{ID: 1, Body: "hello"}).Error)
+		assert.Equal(t, 3, fake.count("INSERT INTO `retry_notes`"))
+		assert.Zero(t, fake.count("BEGIN"))
+		assert.Equal(t, RetryStats{Retries: 2, Recovered: 1}, plugin.stats())
+	})
+
+	t.Run("Exhausted", func(t *testing.T) {
+		db, fake, plugin := openRetryDB(t, cfg, 5, deadlock)
+
+		err := db.Create(&retryNote{ID: 1, Body: "hello"}).Error
+		assert.ErrorIs(t, err, deadlock)
+		assert.Equal(t, 3, fake.count("INSERT INTO `retry_notes`"))
+		assert.Equal(t, 3, fake.count("ROLLBACK"))
+		assert.Equal(t, RetryStats{Retries: 2, Exhausted: 1}, plugin.stats())
+	})
+
+	t.Run("CallerTransactionNotRetried", func(t *testing.T) {
+		db, fake, plugin := openRetryDB(t, cfg, 1, deadlock)
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			return tx.Create(&retryNote{ID: 1, Body: "hello"}).Error
+		})
+		assert.ErrorIs(t, err, deadlock)
+		assert.Equal(t, 1, fake.count("INSERT INTO `retry_notes`"))
+		assert.Equal(t, RetryStats{}, plugin.stats())
+	})
+
+	t.Run("NotRetryable", func(t *testing.T) {
+		duplicate := &mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}
+		db, fake, plugin := openRetryDB(t, cfg, 1, duplicate)
+
+		assert.ErrorIs(t, db.Create(&retryNote{ID: 1, Body: "hello"}).Error, duplicate)
+		assert.Equal(t, 1, fake.count("INSERT INTO `retry_notes`"))
+		assert.Equal(t, RetryStats{}, plugin.stats())
+	})
+
+	t.Run("WritesDisabled", func(t *testing.T) {
+		readOnly := cfg
+		readOnly.RetryWrites = false
+		db, fake, _ := openRetryDB(t, readOnly, 1, deadlock)
+
+		assert.ErrorIs(t, db.Create(&retryNote{ID: 1, Body: "hello"}).Error, deadlock)
+		assert.Equal(t, 1, fake.count("INSERT INTO `retry_notes`"))
+	})
+}
@@ -0,0 +1,220 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/utils"
+)
+
+const (
+	// rowScopeAppliedKey 标记语句已附加过滤条件的 Statement 实例键，复用同一个语句执行多次时不重复附加
+	rowScopeAppliedKey = "db:row_scope_applied"
+)
+
+// ErrRowScopeViolation 模型登记了行级过滤，但上下文中缺少过滤所需的值（如租户），语句被拒绝
+var ErrRowScopeViolation = errors.New("db: row scope cannot be applied")
+
+// RowScope 是模型登记的一条强制行级过滤条件
+type RowScope struct {
+	// Name 过滤的名称，用于 WithoutRowScopes 按名称豁免和违规日志
+	Name string
+	// Filter 根据上下文返回附加到 WHERE 中的条件，上下文缺少所需的值时返回错误
+	Filter func(ctx context.Context) (clause.Expression, error)
+}
+
+// RowScoped 由需要强制行级过滤的模型实现。
+// 查询、更新和删除该模型时，RowScopes 返回的所有条件自动附加到 WHERE 中，
+// 方法在模型的零值上调用，返回值应只取决于模型类型。
+type RowScoped interface {
+	RowScopes() []RowScope
+}
+
+// TenantScope 返回按租户过滤的 RowScope：column = 上下文中的租户，上下文中没有租户时拒绝语句
+func TenantScope(column string) RowScope {
+	return RowScope{
+		Name: "tenant",
+		Filter: func(ctx context.Context) (clause.Expression, error) {
+			tenant := tenantFromContext(ctx)
+			if tenant == "" {
+				return nil, errors.New("tenant is missing from context")
+			}
+			return clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: column}, Value: tenant}, nil
+		},
+	}
+}
+
+// NotDeletedScope 返回排除软删除行的 RowScope：column IS NULL。
+// 与 gorm.DeletedAt 不同，gorm 的 Unscoped() 不会绕过它，需要使用 WithoutRowScopes
+func NotDeletedScope(column string) RowScope {
+	return RowScope{
+		Name: "not_deleted",
+		Filter: func(context.Context) (clause.Expression, error) {
+			return clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: column}, Value: nil}, nil
+		},
+	}
+}
+
+// unscopedKey 豁免行级过滤的上下文键
+type unscopedKey struct{}
+
+// unscoped 记录豁免的原因和过滤名称，names 为空表示豁免所有过滤
+type unscoped struct {
+	reason string
+	names  []string
+}
+
+// WithoutRowScopes 返回豁免行级过滤的上下文，names 为空时豁免所有过滤。
+// 每条被豁免的语句都会连同 reason 记录日志，用于后台任务、跨租户运营查询等明确需要越过过滤的场景
+func WithoutRowScopes(ctx context.Context, reason string, names ...string) context.Context {
+	return context.WithValue(ctx, unscopedKey{}, &unscoped{reason: reason, names: names})
+}
+
+// skips 判断该过滤是否被豁免
+func (u *unscoped) skips(name string) bool {
+	return u != nil && (len(u.names) == 0 || slices.Contains(u.names, name))
+}
+
+// rowScopePlugin 基于 GORM 回调，在查询、更新和删除实现了 RowScoped 的模型时附加过滤条件。
+// 模型的过滤按表名缓存，通过 Table("...") 访问同一张表且没有模型的语句同样会被过滤；
+// 没有模型的语句无法自行解析过滤，需要通过 registerModels 预先登记（WithRowScopedModels、AutoMigrate）
+type rowScopePlugin struct {
+	cfg     RowScopeConfig
+	resolve StampResolver
+	logger  clog.Logger
+
+	// tables 表名到过滤条件的缓存，未实现 RowScoped 的表缓存为 nil
+	tables sync.Map
+}
+
+// newRowScopePlugin 创建行级过滤插件，resolve 非空时用其解析的租户和操作人补充上下文
+func newRowScopePlugin(cfg RowScopeConfig, resolve StampResolver, logger clog.Logger) *rowScopePlugin {
+	return &rowScopePlugin{
+		cfg:     cfg,
+		resolve: resolve,
+		logger:  logger,
+	}
+}
+
+// register 注册回调，在生成 SQL 之前附加条件；先于审计注册，审计的变更前快照同样受过滤约束
+func (p *rowScopePlugin) register(db *gorm.DB) error {
+	if err := db.Callback().Query().Before("gorm:query").Register("db:row_scope", p.apply); err != nil {
+		return err
+	}
+	if err := db.Callback().Row().Before("gorm:row").Register("db:row_scope", p.apply); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().Before("gorm:update").Register("db:row_scope", p.apply); err != nil {
+		return err
+	}
+	return db.Callback().Delete().Before("gorm:delete").Register("db:row_scope", p.apply)
+}
+
+// apply 附加语句所操作表的过滤条件
+func (p *rowScopePlugin) apply(db *gorm.DB) {
+	// Raw 语句的 SQL 已经生成，无法附加条件；迁移（AutoMigrate、在线 DDL 等）读取表结构时不受过滤约束
+	if db.Error != nil || db.Statement.SQL.Len() > 0 || isMigration(db.Statement.Context) {
+		return
+	}
+	scopes, table := p.scopes(db)
+	if len(scopes) == 0 {
+		return
+	}
+	if _, ok := db.InstanceGet(rowScopeAppliedKey); ok {
+		return
+	}
+
+	ctx := p.context(db.Statement.Context)
+	skip, _ := ctx.Value(unscopedKey{}).(*unscoped)
+	var exprs []clause.Expression
+	for _, scope := range scopes {
+		if skip.skips(scope.Name) {
+			p.logger.Info("行级过滤已豁免",
+				clog.String("table", table),
+				clog.String("scope", scope.Name),
+				clog.String("reason", skip.reason),
+				clog.String("caller", utils.FileWithLineNum()),
+			)
+			continue
+		}
+		expr, err := scope.Filter(ctx)
+		if err != nil {
+			p.logger.Warn("行级过滤无法生效",
+				clog.String("table", table),
+				clog.String("scope", scope.Name),
+				clog.Bool("reportOnly", p.cfg.ReportOnly),
+				clog.String("caller", utils.FileWithLineNum()),
+				clog.Err(err),
+			)
+			if p.cfg.ReportOnly {
+				continue
+			}
+			db.AddError(fmt.Errorf("%w: table %s, scope %s: %v", ErrRowScopeViolation, table, scope.Name, err))
+			return
+		}
+		exprs = append(exprs, expr)
+	}
+
+	if len(exprs) > 0 {
+		db.Statement.AddClause(clause.Where{Exprs: exprs})
+	}
+	db.InstanceSet(rowScopeAppliedKey, true)
+}
+
+// registerModels 预先解析实现了 RowScoped 的模型的表名并缓存其过滤条件，其他模型被忽略
+func (p *rowScopePlugin) registerModels(db *gorm.DB, models ...interface{}) error {
+	for _, model := range models {
+		scoped, ok := model.(RowScoped)
+		if !ok {
+			continue
+		}
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return fmt.Errorf("failed to parse row scoped model %T: %w", model, err)
+		}
+		p.tables.Store(stmt.Schema.Table, scoped.RowScopes())
+	}
+	return nil
+}
+
+// scopes 返回语句所操作表登记的过滤条件和表名。
+// 有模型时从模型解析并按表名缓存，没有模型时按 Statement.Table 查找缓存
+func (p *rowScopePlugin) scopes(db *gorm.DB) ([]RowScope, string) {
+	if s := db.Statement.Schema; s != nil {
+		if cached, ok := p.tables.Load(s.Table); ok {
+			return cached.([]RowScope), s.Table
+		}
+		var scopes []RowScope
+		if scoped, ok := reflect.New(s.ModelType).Interface().(RowScoped); ok {
+			scopes = scoped.RowScopes()
+		}
+		p.tables.Store(s.Table, scopes)
+		return scopes, s.Table
+	}
+	if cached, ok := p.tables.Load(db.Statement.Table); ok {
+		return cached.([]RowScope), db.Statement.Table
+	}
+	return nil, db.Statement.Table
+}
+
+// context 用 StampResolver 解析的操作人和租户补充上下文中缺少的值，使 TenantScope 等过滤与写入人填充使用同一来源
+func (p *rowScopePlugin) context(ctx context.Context) context.Context {
+	if p.resolve == nil {
+		return ctx
+	}
+	actor, tenant := p.resolve(ctx)
+	if actor != "" && actorFromContext(ctx) == "" {
+		ctx = WithActor(ctx, actor)
+	}
+	if tenant != "" && tenantFromContext(ctx) == "" {
+		ctx = WithTenant(ctx, tenant)
+	}
+	return ctx
+}
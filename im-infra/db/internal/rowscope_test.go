@@ -0,0 +1,61 @@
+package internal
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scopedNote 登记了租户和软删除过滤的测试模型
+type scopedNote struct {
+	ID        int64
+	TenantID  string
+	DeletedAt *string
+}
+
+func (scopedNote) RowScopes() []RowScope {
+	return []RowScope{TenantScope("tenant_id"), NotDeletedScope("deleted_at")}
+}
+
+func TestRowScopeRegisteredModels(t *testing.T) {
+	db, fake := openFakeDB(t, func(query string, args []driver.Value) (*fakeResult, error) {
+		if strings.HasPrefix(query, "SELECT count(*)") {
+			return &fakeResult{columns: []string{"count(*)"}, rows: [][]driver.Value{{int64(0)}}}, nil
+		}
+		return nil, nil
+	})
+	plugin := newRowScopePlugin(RowScopeConfig{}, nil, clog.Namespace("rowscope-test"))
+	require.NoError(t, plugin.register(db))
+	require.NoError(t, plugin.registerModels(db, &scopedNote{}, &struct{ ID int64 }{}))
+
+	ctx := WithTenant(context.Background(), "t1")
+	var count int64
+
+	// 登记后，没有模型的语句在模型第一次使用之前就被过滤
+	require.NoError(t, db.WithContext(ctx).Table("scoped_notes").Count(&count).Error)
+	stmt, ok := fake.find("FROM `scoped_notes`")
+	require.True(t, ok)
+	assert.Contains(t, stmt.query, "`scoped_notes`.`tenant_id` = ? AND `scoped_notes`.`deleted_at` IS NULL")
+	assert.Equal(t, []driver.Value{"t1"}, stmt.args)
+
+	err := db.WithContext(context.Background()).Table("scoped_notes").Count(&count).Error
+	assert.ErrorIs(t, err, ErrRowScopeViolation, "missing tenant is rejected")
+
+	fake.reset()
+	exempt := WithoutRowScopes(context.Background(), "report")
+	require.NoError(t, db.WithContext(exempt).Table("scoped_notes").Count(&count).Error)
+	stmt, ok = fake.find("FROM `scoped_notes`")
+	require.True(t, ok)
+	assert.NotContains(t, stmt.query, "WHERE")
+
+	fake.reset()
+	require.NoError(t, db.WithContext(context.Background()).Table("other_notes").Count(&count).Error)
+	stmt, ok = fake.find("FROM `other_notes`")
+	require.True(t, ok)
+	assert.NotContains(t, stmt.query, "WHERE", "tables without registered scopes are not filtered")
+}
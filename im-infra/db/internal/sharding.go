@@ -1,17 +1,115 @@
 package internal
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
+	"sync/atomic"
 
+	"github.com/bwmarrin/snowflake"
 	"github.com/ceyewan/gochat/im-infra/clog"
 	"gorm.io/gorm"
 	"gorm.io/sharding"
 )
 
-// configureSharding 配置分库分表
-func configureSharding(db *gorm.DB, cfg *ShardingConfig) error {
+// ErrShardingNotConfigured 未配置 Config.Sharding
+var ErrShardingNotConfigured = errors.New("db: sharding is not configured")
+
+// snowflakeNodes snowflake 节点 ID 的取值数量，超出的分片索引取模后复用节点
+const snowflakeNodes = 1024
+
+// shardLayout 保存当前生效的分片数和主键生成器。
+// 分片算法每次调用时读取，重分片切换完成后无需重新注册插件即可按新的分片数路由
+type shardLayout struct {
+	count atomic.Int64
+	// nodes 每个分片索引一个 snowflake 节点，与 gorm.io/sharding 的 PKSnowflake 生成方式相同
+	nodes []*snowflake.Node
+}
+
+// newShardLayout 创建分片布局
+func newShardLayout(shards int) (*shardLayout, error) {
+	l := &shardLayout{nodes: make([]*snowflake.Node, snowflakeNodes)}
+	for i := range l.nodes {
+		node, err := snowflake.NewNode(int64(i))
+		if err != nil {
+			return nil, err
+		}
+		l.nodes[i] = node
+	}
+	l.count.Store(int64(shards))
+	return l, nil
+}
+
+// shards 返回当前的分片数
+func (l *shardLayout) shards() int {
+	return int(l.count.Load())
+}
+
+// setShards 切换分片数
+func (l *shardLayout) setShards(shards int) {
+	l.count.Store(int64(shards))
+}
+
+// generateID 为第 index 张分片表生成主键。
+// 分片插件只把生成的主键写入改写后的 SQL，不回填模型；需要在写入前知道主键时（如重分片双写）直接调用
+func (l *shardLayout) generateID(index int64) int64 {
+	return l.nodes[index%snowflakeNodes].Generate().Int64()
+}
+
+// shardIndex 根据分片键值计算分片索引：整数取绝对值后取模，
+// 字符串优先解析为整数，无法解析时使用哈希
+func shardIndex(value any, shards int) (int, error) {
+	var intValue int64
+	switch v := value.(type) {
+	case int:
+		intValue = int64(v)
+	case int32:
+		intValue = int64(v)
+	case int64:
+		intValue = v
+	case uint:
+		intValue = int64(v)
+	case uint32:
+		intValue = int64(v)
+	case uint64:
+		intValue = int64(v)
+	case []byte:
+		return shardIndex(string(v), shards)
+	case string:
+		// 对于字符串，优先解析为数字
+		if parsed, err := strconv.ParseInt(v, 10, 64); err == nil {
+			intValue = parsed
+		} else {
+			// 如果不能解析为数字，使用哈希
+			hash := int64(0)
+			for _, c := range v {
+				hash = hash*31 + int64(c)
+			}
+			intValue = hash
+		}
+	default:
+		return 0, fmt.Errorf("unsupported sharding key type: %T", value)
+	}
+
+	// 取绝对值
+	if intValue < 0 {
+		intValue = -intValue
+	}
+	return int(intValue % int64(shards)), nil
+}
+
+// shardSuffix 返回分片索引对应的物理表后缀
+func shardSuffix(index int) string {
+	return fmt.Sprintf("_%02d", index)
+}
+
+// configureSharding 配置分库分表，返回的分片布局供重分片切换分片数
+func configureSharding(db *gorm.DB, cfg *ShardingConfig) (*shardLayout, error) {
 	logger := clog.Namespace("db.sharding")
+	layout, err := newShardLayout(cfg.NumberOfShards)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create primary key generator: %w", err)
+	}
 
 	logger.Info("开始配置分库分表",
 		clog.String("shardingKey", cfg.ShardingKey),
@@ -20,54 +118,22 @@ func configureSharding(db *gorm.DB, cfg *ShardingConfig) error {
 
 	// 创建gorm sharding库的配置
 	gormShardingConfig := sharding.Config{
-		ShardingKey:         cfg.ShardingKey,
-		NumberOfShards:      uint(cfg.NumberOfShards),
-		PrimaryKeyGenerator: sharding.PKSnowflake,
+		ShardingKey:    cfg.ShardingKey,
+		NumberOfShards: uint(cfg.NumberOfShards),
+		// 主键由分片布局生成，重分片双写可以在写入前为模型生成同样的主键
+		PrimaryKeyGenerator:   sharding.PKCustom,
+		PrimaryKeyGeneratorFn: layout.generateID,
 		// 添加自定义分片算法，确保支持所有数据类型
 		ShardingAlgorithm: func(columnValue any) (suffix string, err error) {
-			var intValue int64
-			switch v := columnValue.(type) {
-			case int:
-				intValue = int64(v)
-			case int32:
-				intValue = int64(v)
-			case int64:
-				intValue = v
-			case uint:
-				intValue = int64(v)
-			case uint32:
-				intValue = int64(v)
-			case uint64:
-				intValue = int64(v)
-			case string:
-				// 对于字符串，优先解析为数字
-				if parsed, parseErr := strconv.ParseInt(v, 10, 64); parseErr == nil {
-					intValue = parsed
-				} else {
-					// 如果不能解析为数字，使用哈希
-					hash := int64(0)
-					for _, c := range v {
-						hash = hash*31 + int64(c)
-					}
-					intValue = hash
-				}
-			default:
-				return "", fmt.Errorf("unsupported sharding key type: %T", columnValue)
+			index, err := shardIndex(columnValue, layout.shards())
+			if err != nil {
+				return "", err
 			}
-
-			// 取绝对值
-			if intValue < 0 {
-				intValue = -intValue
-			}
-
-			// 对分片总数进行取模，得到分片索引
-			shardIndex := intValue % int64(cfg.NumberOfShards)
-			return fmt.Sprintf("_%02d", shardIndex), nil
+			return shardSuffix(index), nil
 		},
 	}
 
 	// 根据 gorm.io/sharding 的实际 API，Register 函数接受配置和表名列表
-	var err error
 	if len(cfg.Tables) > 0 {
 		// 收集需要分片的表名
 		tables := make([]string, 0, len(cfg.Tables))
@@ -92,20 +158,22 @@ func configureSharding(db *gorm.DB, cfg *ShardingConfig) error {
 
 	if err != nil {
 		logger.Error("注册分片插件失败", clog.Err(err))
-		return fmt.Errorf("failed to register sharding plugin: %w", err)
+		return nil, fmt.Errorf("failed to register sharding plugin: %w", err)
 	}
 
 	logger.Info("分库分表配置完成")
-	return nil
+	return layout, nil
 }
 
 // ShardingHelper 分片辅助工具
 type ShardingHelper struct {
 	config *ShardingConfig
+	layout *shardLayout // 数据库实例当前生效的分片布局，为 nil 时使用配置中的分片数
 	logger clog.Logger
 }
 
-// NewShardingHelper 创建分片辅助工具
+// NewShardingHelper 创建分片辅助工具，按配置中的分片数计算后缀。
+// 需要跟随重分片切换的分片数时使用 Provider.ShardSuffix。
 func NewShardingHelper(config *ShardingConfig) *ShardingHelper {
 	return &ShardingHelper{
 		config: config,
@@ -113,43 +181,31 @@ func NewShardingHelper(config *ShardingConfig) *ShardingHelper {
 	}
 }
 
-// GetShardSuffix 根据分片键值获取分片后缀
-// 这是一个简化的实现，实际的分片逻辑由 gorm.io/sharding 库处理
-func (h *ShardingHelper) GetShardSuffix(value interface{}) (string, error) {
-	var intValue int64
-	var err error
+// newLayoutShardingHelper 创建按分片布局当前分片数计算后缀的分片辅助工具
+func newLayoutShardingHelper(config *ShardingConfig, layout *shardLayout) *ShardingHelper {
+	h := NewShardingHelper(config)
+	h.layout = layout
+	return h
+}
 
-	switch v := value.(type) {
-	case int:
-		intValue = int64(v)
-	case int32:
-		intValue = int64(v)
-	case int64:
-		intValue = v
-	case uint:
-		intValue = int64(v)
-	case uint32:
-		intValue = int64(v)
-	case uint64:
-		intValue = int64(v)
-	case string:
-		intValue, err = strconv.ParseInt(v, 10, 64)
-		if err != nil {
-			// 对于字符串，使用简单的哈希
-			hash := int64(0)
-			for _, c := range v {
-				hash = hash*31 + int64(c)
-			}
-			intValue = hash
-		}
-	default:
-		return "", fmt.Errorf("unsupported sharding key type: %T", value)
+// GetShardSuffix 根据分片键值获取分片后缀，与分片插件的路由算法一致，
+// 重分片切换完成后按新的分片数计算
+func (h *ShardingHelper) GetShardSuffix(value interface{}) (string, error) {
+	shards := h.config.NumberOfShards
+	if h.layout != nil {
+		shards = h.layout.shards()
 	}
-
-	if intValue < 0 {
-		intValue = -intValue
+	index, err := shardIndex(value, shards)
+	if err != nil {
+		return "", err
 	}
+	return shardSuffix(index), nil
+}
 
-	shardIndex := intValue % int64(h.config.NumberOfShards)
-	return fmt.Sprintf("_%02d", shardIndex), nil
+// ShardSuffix 返回分片键值当前所在分片表的后缀
+func (c *client) ShardSuffix(value interface{}) (string, error) {
+	if c.sharding == nil {
+		return "", ErrShardingNotConfigured
+	}
+	return c.sharding.GetShardSuffix(value)
 }
@@ -0,0 +1,122 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/ceyewan/gochat/im-infra/ctxmeta"
+	"gorm.io/gorm"
+)
+
+// 开启 StampConfig 的强制校验时，上下文中缺少操作人或租户
+var (
+	ErrStampActorRequired  = errors.New("db: actor is required to write stamped model")
+	ErrStampTenantRequired = errors.New("db: tenant is required to create stamped model")
+)
+
+// StampResolver 从上下文中解析写入 created_by/updated_by 的操作人和写入 tenant_id 的租户，
+// 未携带时返回空字符串
+type StampResolver func(ctx context.Context) (actor, tenant string)
+
+// WithTenant 将租户 ID 注入上下文
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return ctxmeta.WithTenant(ctx, tenant)
+}
+
+// tenantFromContext 从上下文获取租户 ID
+func tenantFromContext(ctx context.Context) string {
+	return ctxmeta.Tenant(ctx)
+}
+
+// defaultStampResolver 从 WithActor 和 WithTenant 注入的值中解析
+func defaultStampResolver(ctx context.Context) (string, string) {
+	return actorFromContext(ctx), tenantFromContext(ctx)
+}
+
+// stampPlugin 基于 GORM 回调，在写入声明了操作人、租户列的模型时自动填充这些列。
+// 只处理带模型的语句（Statement.Schema 非空），上下文中的值覆盖模型中手动赋的值。
+type stampPlugin struct {
+	cfg     StampConfig
+	resolve StampResolver
+}
+
+// newStampPlugin 创建写入人填充插件，resolve 为 nil 时使用 WithActor/WithTenant
+func newStampPlugin(cfg StampConfig, resolve StampResolver) *stampPlugin {
+	if resolve == nil {
+		resolve = defaultStampResolver
+	}
+	return &stampPlugin{
+		cfg:     cfg,
+		resolve: resolve,
+	}
+}
+
+// register 注册回调，在 gorm:create/gorm:update 之前填充列，审计插件记录的快照中也包含这些列
+func (p *stampPlugin) register(db *gorm.DB) error {
+	if err := db.Callback().Create().Before("gorm:create").Register("db:stamp", p.stampCreate); err != nil {
+		return err
+	}
+	return db.Callback().Update().Before("gorm:update").Register("db:stamp", p.stampUpdate)
+}
+
+// stampCreate 插入时填充 created_by、updated_by 和 tenant_id
+func (p *stampPlugin) stampCreate(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return
+	}
+	actor, tenant := p.resolve(db.Statement.Context)
+
+	hasActor := p.hasColumn(db, p.cfg.CreatedByColumn) || p.hasColumn(db, p.cfg.UpdatedByColumn)
+	if hasActor && actor == "" && p.cfg.RequireActor {
+		db.AddError(ErrStampActorRequired)
+		return
+	}
+	hasTenant := p.hasColumn(db, p.cfg.TenantColumn)
+	if hasTenant && tenant == "" && p.cfg.RequireTenant {
+		db.AddError(ErrStampTenantRequired)
+		return
+	}
+
+	if actor != "" {
+		p.set(db, p.cfg.CreatedByColumn, actor)
+		p.set(db, p.cfg.UpdatedByColumn, actor)
+	}
+	if tenant != "" {
+		p.set(db, p.cfg.TenantColumn, tenant)
+	}
+}
+
+// stampUpdate 更新时填充 updated_by。tenant_id 在插入后不再改变，更新时不填充
+func (p *stampPlugin) stampUpdate(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil || !p.hasColumn(db, p.cfg.UpdatedByColumn) {
+		return
+	}
+	actor, _ := p.resolve(db.Statement.Context)
+	if actor == "" {
+		if p.cfg.RequireActor {
+			db.AddError(ErrStampActorRequired)
+		}
+		return
+	}
+
+	p.set(db, p.cfg.UpdatedByColumn, actor)
+	// Select 限定了更新列时，追加 updated_by，否则填充的值不会写入
+	if selects := db.Statement.Selects; len(selects) > 0 && !slices.Contains(selects, "*") &&
+		!slices.Contains(selects, p.cfg.UpdatedByColumn) {
+		db.Statement.Selects = append(selects, p.cfg.UpdatedByColumn)
+	}
+}
+
+// hasColumn 判断语句的模型是否声明了该列
+func (p *stampPlugin) hasColumn(db *gorm.DB, column string) bool {
+	return column != "" && db.Statement.Schema.LookUpField(column) != nil
+}
+
+// set 模型声明了该列时写入值，批量插入时写入每一行
+func (p *stampPlugin) set(db *gorm.DB, column, value string) {
+	if !p.hasColumn(db, column) {
+		return
+	}
+	db.Statement.SetColumn(column, value, true)
+}
@@ -0,0 +1,543 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"gorm.io/gorm"
+)
+
+// 表选项漂移的处理策略
+const (
+	// TableDriftWarn 只记录告警日志
+	TableDriftWarn = "warn"
+	// TableDriftFail 让 AutoMigrate/EnsureTables 返回 ErrTableOptionsDrift
+	TableDriftFail = "fail"
+	// TableDriftFix 执行 ALTER TABLE 修正引擎、字符集、排序规则和行格式
+	TableDriftFix = "fix"
+)
+
+// ErrTableOptionsDrift 已存在的表与声明的表选项不一致，且策略为 TableDriftFail
+var ErrTableOptionsDrift = errors.New("db: table options drift detected")
+
+// TableOptions 建表时使用的表选项，空字段表示不指定（沿用 MySQL 服务端默认值）
+type TableOptions struct {
+	// Engine 存储引擎，如 "InnoDB"
+	Engine string `json:"engine,omitempty" yaml:"engine,omitempty"`
+
+	// Charset 默认字符集，如 "utf8mb4"
+	Charset string `json:"charset,omitempty" yaml:"charset,omitempty"`
+
+	// Collation 默认排序规则，如 "utf8mb4_unicode_ci"，必须属于 Charset
+	Collation string `json:"collation,omitempty" yaml:"collation,omitempty"`
+
+	// RowFormat 行格式，如 "DYNAMIC"、"COMPRESSED"
+	RowFormat string `json:"rowFormat,omitempty" yaml:"rowFormat,omitempty"`
+
+	// Partition 分区子句，如 "PARTITION BY HASH(id) PARTITIONS 8"。
+	// 只在建表时应用，已存在的表只校验是否已分区，不会自动修正
+	Partition string `json:"partition,omitempty" yaml:"partition,omitempty"`
+}
+
+// SQL 返回建表语句末尾的表选项子句
+func (o TableOptions) SQL() string {
+	var parts []string
+	if o.Engine != "" {
+		parts = append(parts, "ENGINE="+o.Engine)
+	}
+	if o.Charset != "" {
+		parts = append(parts, "DEFAULT CHARSET="+o.Charset)
+	}
+	if o.Collation != "" {
+		parts = append(parts, "COLLATE="+o.Collation)
+	}
+	if o.RowFormat != "" {
+		parts = append(parts, "ROW_FORMAT="+o.RowFormat)
+	}
+	if o.Partition != "" {
+		parts = append(parts, o.Partition)
+	}
+	return strings.Join(parts, " ")
+}
+
+// merge 用 override 中的非空字段覆盖 o
+func (o TableOptions) merge(override TableOptions) TableOptions {
+	if override.Engine != "" {
+		o.Engine = override.Engine
+	}
+	if override.Charset != "" {
+		o.Charset = override.Charset
+		// 只覆盖字符集时，默认排序规则不再适用
+		if override.Collation == "" && !collationOf(o.Collation, o.Charset) {
+			o.Collation = ""
+		}
+	}
+	if override.Collation != "" {
+		o.Collation = override.Collation
+	}
+	if override.RowFormat != "" {
+		o.RowFormat = override.RowFormat
+	}
+	if override.Partition != "" {
+		o.Partition = override.Partition
+	}
+	return o
+}
+
+// validate 校验表选项
+func (o TableOptions) validate() error {
+	if o.Collation != "" && o.Charset != "" && !collationOf(o.Collation, o.Charset) {
+		return fmt.Errorf("collation %s does not belong to charset %s", o.Collation, o.Charset)
+	}
+	for _, v := range []string{o.Engine, o.Charset, o.Collation, o.RowFormat} {
+		if strings.ContainsAny(v, " ;'`\"") {
+			return fmt.Errorf("invalid table option value %q", v)
+		}
+	}
+	if strings.Contains(o.Partition, ";") {
+		return fmt.Errorf("partition clause cannot contain ';'")
+	}
+	return nil
+}
+
+// TableOptioner 由模型实现，声明该模型对应表的表选项，优先级高于 TableOptionsConfig.Tables。
+// 只需声明与 TableOptionsConfig.Default 不同的字段
+type TableOptioner interface {
+	TableOptions() TableOptions
+}
+
+// TableOptionsConfig 表选项配置
+type TableOptionsConfig struct {
+	// Default 所有表的默认表选项
+	// 默认: ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci
+	Default TableOptions `json:"default" yaml:"default"`
+
+	// Tables 单张表的表选项，键为 SQL 中的实际表名（含 TablePrefix），非空字段覆盖 Default
+	Tables map[string]*TableOptions `json:"tables,omitempty" yaml:"tables,omitempty"`
+
+	// OnDrift 已存在的表与声明不一致时的处理策略：warn、fail、fix
+	// 本次迁移新建的表总是被修正，不受该策略影响
+	// 默认: warn
+	OnDrift string `json:"onDrift" yaml:"onDrift"`
+}
+
+// DefaultTableOptionsConfig 返回默认的表选项配置
+func DefaultTableOptionsConfig() *TableOptionsConfig {
+	return &TableOptionsConfig{
+		Default: TableOptions{
+			Engine:    "InnoDB",
+			Charset:   "utf8mb4",
+			Collation: "utf8mb4_unicode_ci",
+		},
+		OnDrift: TableDriftWarn,
+	}
+}
+
+// TableDrift 一项表选项漂移
+type TableDrift struct {
+	// Table 实际的物理表名，分片表为带后缀的分片名
+	Table string `json:"table"`
+	// Option 漂移的选项：engine、charset、collation、row_format、partition、column_charset
+	Option string `json:"option"`
+	// Column 字符集不一致的列，仅 column_charset 有值
+	Column string `json:"column,omitempty"`
+	// Expected 声明的值
+	Expected string `json:"expected"`
+	// Actual 数据库中的实际值
+	Actual string `json:"actual"`
+	// Fixed 是否已通过 ALTER TABLE 修正
+	Fixed bool `json:"fixed"`
+}
+
+// String 返回漂移的可读描述
+func (d TableDrift) String() string {
+	target := d.Table
+	if d.Column != "" {
+		target += "." + d.Column
+	}
+	s := fmt.Sprintf("%s %s: expected %s, actual %s", target, d.Option, d.Expected, d.Actual)
+	if d.Fixed {
+		s += " (fixed)"
+	}
+	return s
+}
+
+// TableOptionsReport 表选项校验报告
+type TableOptionsReport struct {
+	// Tables 被校验的物理表
+	Tables []string `json:"tables"`
+	// Created 本次迁移新建的物理表
+	Created []string `json:"created,omitempty"`
+	// Drifts 发现的漂移，包括已修正的
+	Drifts []TableDrift `json:"drifts,omitempty"`
+	// CheckedAt 校验时间
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// HasDrift 返回是否存在未修正的漂移
+func (r *TableOptionsReport) HasDrift() bool {
+	for _, d := range r.Drifts {
+		if !d.Fixed {
+			return true
+		}
+	}
+	return false
+}
+
+// String 返回报告的可读描述，每项漂移一行
+func (r *TableOptionsReport) String() string {
+	if len(r.Drifts) == 0 {
+		return fmt.Sprintf("%d tables checked, no drift", len(r.Tables))
+	}
+	lines := make([]string, 0, len(r.Drifts)+1)
+	lines = append(lines, fmt.Sprintf("%d tables checked, %d drifts:", len(r.Tables), len(r.Drifts)))
+	for _, d := range r.Drifts {
+		lines = append(lines, "  "+d.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// tableTarget 一个模型对应的表及其声明的表选项
+type tableTarget struct {
+	model    interface{}
+	table    string
+	physical []string
+	options  TableOptions
+}
+
+// tableState information_schema 中一张表的实际选项
+type tableState struct {
+	engine      string
+	collation   string
+	rowFormat   string
+	partitioned bool
+}
+
+// EnsureTables 按声明的表选项创建或迁移表，并校验所有物理表（含分片表）的表选项，返回漂移报告。
+// 本次新建的表与声明不一致时（例如分片插件建表时忽略了表选项）总是直接修正；
+// 已存在的表按 TableOptionsConfig.OnDrift 处理。未配置 TableOptions 时等同于 AutoMigrate，返回空报告
+func (c *client) EnsureTables(ctx context.Context, dst ...interface{}) (*TableOptionsReport, error) {
+	report := &TableOptionsReport{CheckedAt: time.Now()}
+	if c.config.TableOptions == nil {
+		return report, c.AutoMigrate(ctx, dst...)
+	}
+	if c.rowScope != nil {
+		if err := c.rowScope.registerModels(c.db, dst...); err != nil {
+			return nil, err
+		}
+	}
+
+	targets, err := c.resolveTableTargets(dst)
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := c.db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get underlying database connection: %w", err)
+	}
+
+	var physical []string
+	for _, t := range targets {
+		physical = append(physical, t.physical...)
+	}
+	existing, err := loadTableStates(ctx, sqlDB, physical)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	c.logger.Info("开始数据库自动迁移", clog.Int("models", len(targets)))
+	for _, t := range targets {
+		tx := c.db.WithContext(withMigration(ctx))
+		if clause := t.options.SQL(); clause != "" {
+			tx = tx.Set("gorm:table_options", clause)
+		}
+		if err := tx.AutoMigrate(t.model); err != nil {
+			c.logger.Error("数据库自动迁移失败", clog.String("table", t.table), clog.Err(err))
+			return nil, fmt.Errorf("auto migrate table %s failed: %w", t.table, err)
+		}
+	}
+
+	states, err := loadTableStates(ctx, sqlDB, physical)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := loadColumnCharsets(ctx, sqlDB, physical)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := c.config.TableOptions.OnDrift
+	for _, t := range targets {
+		for _, table := range t.physical {
+			state, ok := states[table]
+			if !ok {
+				// 分片插件未创建的分片或迁移失败，按漂移报告
+				report.Drifts = append(report.Drifts, TableDrift{Table: table, Option: "table", Expected: "exists", Actual: "missing"})
+				continue
+			}
+			report.Tables = append(report.Tables, table)
+			_, existed := existing[table]
+			if !existed {
+				report.Created = append(report.Created, table)
+			}
+
+			drifts := diffTableOptions(table, t.options, state, columns[table])
+			if len(drifts) == 0 {
+				continue
+			}
+			if !existed || policy == TableDriftFix {
+				if err := fixTableOptions(ctx, sqlDB, table, t.options, drifts); err != nil {
+					c.logger.Error("修正表选项失败", clog.String("table", table), clog.Err(err))
+					return nil, err
+				}
+			}
+			report.Drifts = append(report.Drifts, drifts...)
+		}
+	}
+
+	sort.Strings(report.Tables)
+	for _, d := range report.Drifts {
+		if d.Fixed {
+			c.logger.Warn("表选项已修正", clog.String("drift", d.String()))
+		} else {
+			c.logger.Warn("表选项与声明不一致", clog.String("drift", d.String()))
+		}
+	}
+
+	c.logger.Info("数据库自动迁移成功完成",
+		clog.Duration("duration", time.Since(start)),
+		clog.Int("tables", len(report.Tables)),
+		clog.Int("drifts", len(report.Drifts)),
+	)
+
+	if policy == TableDriftFail && report.HasDrift() {
+		return report, fmt.Errorf("%w:\n%s", ErrTableOptionsDrift, report.String())
+	}
+	return report, nil
+}
+
+// resolveTableTargets 解析模型对应的表名、物理表名和表选项
+func (c *client) resolveTableTargets(dst []interface{}) ([]tableTarget, error) {
+	cfg := c.config.TableOptions
+	targets := make([]tableTarget, 0, len(dst))
+	for _, model := range dst {
+		stmt := &gorm.Statement{DB: c.db}
+		if err := stmt.Parse(model); err != nil {
+			return nil, fmt.Errorf("failed to parse model %T: %w", model, err)
+		}
+		table := stmt.Schema.Table
+
+		options := cfg.Default
+		if override := cfg.Tables[table]; override != nil {
+			options = options.merge(*override)
+		}
+		if m, ok := model.(TableOptioner); ok {
+			options = options.merge(m.TableOptions())
+		}
+		if err := options.validate(); err != nil {
+			return nil, fmt.Errorf("invalid table options of %s: %w", table, err)
+		}
+
+		targets = append(targets, tableTarget{
+			model:    model,
+			table:    table,
+			physical: c.physicalTables(table),
+			options:  options,
+		})
+	}
+	return targets, nil
+}
+
+// physicalTables 返回逻辑表对应的物理表，分片表返回所有分片名
+func (c *client) physicalTables(table string) []string {
+	sharding := c.config.Sharding
+	if sharding == nil {
+		return []string{table}
+	}
+	tableCfg, ok := sharding.Tables[table]
+	if !ok {
+		return []string{table}
+	}
+
+	shards := sharding.NumberOfShards
+	if tableCfg != nil && tableCfg.NumberOfShards > 0 {
+		shards = tableCfg.NumberOfShards
+	}
+	names := make([]string, shards)
+	for i := range names {
+		names[i] = fmt.Sprintf("%s_%02d", table, i)
+	}
+	return names
+}
+
+// loadTableStates 从 information_schema 读取表的实际选项，不存在的表不在结果中
+func loadTableStates(ctx context.Context, sqlDB *sql.DB, tables []string) (map[string]tableState, error) {
+	states := make(map[string]tableState, len(tables))
+	if len(tables) == 0 {
+		return states, nil
+	}
+
+	query := "SELECT TABLE_NAME, COALESCE(ENGINE, ''), COALESCE(TABLE_COLLATION, ''), COALESCE(ROW_FORMAT, ''), COALESCE(CREATE_OPTIONS, '') " +
+		"FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME IN (" + placeholders(len(tables)) + ")"
+	rows, err := sqlDB.QueryContext(ctx, query, stringArgs(tables)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load table options: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name, createOptions string
+		var state tableState
+		if err := rows.Scan(&name, &state.engine, &state.collation, &state.rowFormat, &createOptions); err != nil {
+			return nil, fmt.Errorf("failed to scan table options: %w", err)
+		}
+		state.partitioned = strings.Contains(strings.ToLower(createOptions), "partitioned")
+		states[name] = state
+	}
+	return states, rows.Err()
+}
+
+// loadColumnCharsets 读取字符类型列的字符集，返回 表名 -> 列名 -> 字符集
+func loadColumnCharsets(ctx context.Context, sqlDB *sql.DB, tables []string) (map[string]map[string]string, error) {
+	result := make(map[string]map[string]string, len(tables))
+	if len(tables) == 0 {
+		return result, nil
+	}
+
+	query := "SELECT TABLE_NAME, COLUMN_NAME, CHARACTER_SET_NAME FROM information_schema.COLUMNS " +
+		"WHERE TABLE_SCHEMA = DATABASE() AND CHARACTER_SET_NAME IS NOT NULL AND TABLE_NAME IN (" + placeholders(len(tables)) + ")"
+	rows, err := sqlDB.QueryContext(ctx, query, stringArgs(tables)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load column charsets: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var table, column, charset string
+		if err := rows.Scan(&table, &column, &charset); err != nil {
+			return nil, fmt.Errorf("failed to scan column charset: %w", err)
+		}
+		if result[table] == nil {
+			result[table] = make(map[string]string)
+		}
+		result[table][column] = charset
+	}
+	return result, rows.Err()
+}
+
+// diffTableOptions 对比声明的表选项和实际状态，未声明的选项不校验
+func diffTableOptions(table string, want TableOptions, state tableState, columns map[string]string) []TableDrift {
+	var drifts []TableDrift
+	add := func(option, expected, actual string) {
+		drifts = append(drifts, TableDrift{Table: table, Option: option, Expected: expected, Actual: actual})
+	}
+
+	if want.Engine != "" && !strings.EqualFold(want.Engine, state.engine) {
+		add("engine", want.Engine, state.engine)
+	}
+	if want.Charset != "" {
+		if actual := charsetOf(state.collation); !strings.EqualFold(want.Charset, actual) {
+			add("charset", want.Charset, actual)
+		}
+	}
+	if want.Collation != "" && !strings.EqualFold(want.Collation, state.collation) {
+		add("collation", want.Collation, state.collation)
+	}
+	if want.RowFormat != "" && !strings.EqualFold(want.RowFormat, state.rowFormat) {
+		add("row_format", want.RowFormat, state.rowFormat)
+	}
+	if want.Partition != "" && !state.partitioned {
+		add("partition", want.Partition, "none")
+	}
+
+	// 表默认字符集正确但个别列仍是旧字符集时，写入 emoji 等字符同样会失败
+	if want.Charset != "" {
+		names := make([]string, 0, len(columns))
+		for name := range columns {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if charset := columns[name]; !strings.EqualFold(charset, want.Charset) {
+				drifts = append(drifts, TableDrift{Table: table, Option: "column_charset", Column: name, Expected: want.Charset, Actual: charset})
+			}
+		}
+	}
+	return drifts
+}
+
+// fixTableOptions 通过 ALTER TABLE 修正引擎、字符集、排序规则和行格式，修正成功的漂移标记为 Fixed。
+// 字符集使用 CONVERT TO 同时转换已有的列；分区不会自动修正
+func fixTableOptions(ctx context.Context, sqlDB *sql.DB, table string, want TableOptions, drifts []TableDrift) error {
+	var clauses []string
+	seen := make(map[string]bool)
+	for _, d := range drifts {
+		switch d.Option {
+		case "engine":
+			clauses = append(clauses, "ENGINE="+want.Engine)
+		case "row_format":
+			clauses = append(clauses, "ROW_FORMAT="+want.RowFormat)
+		case "charset", "collation", "column_charset":
+			if seen["convert"] {
+				continue
+			}
+			seen["convert"] = true
+			convert := "CONVERT TO CHARACTER SET " + want.Charset
+			if want.Charset == "" {
+				convert = "CONVERT TO CHARACTER SET " + charsetOf(want.Collation)
+			}
+			if want.Collation != "" {
+				convert += " COLLATE " + want.Collation
+			}
+			clauses = append(clauses, convert)
+		}
+	}
+	if len(clauses) == 0 {
+		return nil
+	}
+
+	stmt := fmt.Sprintf("ALTER TABLE `%s` %s", table, strings.Join(clauses, ", "))
+	if _, err := sqlDB.ExecContext(ctx, stmt); err != nil {
+		return fmt.Errorf("failed to fix table options of %s: %w", table, err)
+	}
+	for i := range drifts {
+		if drifts[i].Option != "partition" {
+			drifts[i].Fixed = true
+		}
+	}
+	return nil
+}
+
+// charsetOf 从排序规则推出字符集，如 utf8mb4_unicode_ci -> utf8mb4
+func charsetOf(collation string) string {
+	if i := strings.IndexByte(collation, '_'); i > 0 {
+		return collation[:i]
+	}
+	return collation
+}
+
+// collationOf 判断排序规则是否属于字符集
+func collationOf(collation, charset string) bool {
+	return strings.EqualFold(charsetOf(collation), charset)
+}
+
+// placeholders 返回 n 个以逗号分隔的 ? 占位符
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
+// stringArgs 将字符串切片转换为查询参数
+func stringArgs(values []string) []interface{} {
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	return args
+}
@@ -1,7 +1,10 @@
 package db
 
 import (
+	"github.com/ceyewan/gochat/im-infra/breaker"
+	"github.com/ceyewan/gochat/im-infra/cache"
 	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/ceyewan/gochat/im-infra/coord/config"
 )
 
 // Option 定义了用于定制 db Provider 的函数。
@@ -11,6 +14,13 @@ type Option func(*provider)
 type provider struct {
 	logger       clog.Logger
 	componentName string
+	queryCacheStore cache.Provider
+	reshardStore config.ConfigCenter
+	credentialStore config.ConfigCenter
+	secretProvider SecretProvider
+	breakers breaker.Provider
+	stampResolver StampResolver
+	rowScopedModels []RowScoped
 }
 
 // WithLogger 将一个 clog.Logger 实例注入 GORM，用于结构化记录 SQL 日志。
@@ -27,3 +37,72 @@ func WithComponentName(name string) Option {
 		p.componentName = name
 	}
 }
+
+// WithQueryCacheStore 设置查询结果缓存的存储，配合 Config.QueryCache 使用。
+func WithQueryCacheStore(store cache.Provider) Option {
+	return func(p *provider) {
+		p.queryCacheStore = store
+	}
+}
+
+// WithReshardStore 设置保存重分片状态的配置中心，配合 Config.Reshard 使用。
+// 通常传入 coord.Provider.Config()，同一数据库的所有实例必须使用同一个配置中心。
+func WithReshardStore(store config.ConfigCenter) Option {
+	return func(p *provider) {
+		p.reshardStore = store
+	}
+}
+
+// WithCredentialStore 设置保存数据库凭据的配置中心，配合 Config.Credentials.ConfigKey 使用。
+// 通常传入 coord.Provider.Config()，凭据变更后所有实例实时轮换连接。
+func WithCredentialStore(store config.ConfigCenter) Option {
+	return func(p *provider) {
+		p.credentialStore = store
+	}
+}
+
+// WithSecretProvider 设置提供数据库凭据的密钥服务（如 Vault），配合 Config.Credentials 使用，
+// 按 Config.Credentials.RefreshInterval 周期性读取。同时设置了 WithCredentialStore 时优先使用该项。
+func WithSecretProvider(secrets SecretProvider) Option {
+	return func(p *provider) {
+		p.secretProvider = secrets
+	}
+}
+
+// WithBreaker 设置熔断器组件，配合 Config.Breaker 使用。
+// 熔断打开时语句直接返回 breaker.ErrBreakerOpen，调用方可以用 errors.Is 判断并降级到缓存。
+func WithBreaker(breakers breaker.Provider) Option {
+	return func(p *provider) {
+		p.breakers = breakers
+	}
+}
+
+// WithStampResolver 设置写入人填充和行级过滤从上下文中解析操作人和租户的方式。
+// 默认读取 ctxmeta 中的操作人和租户（WithActor、WithTenant、ctxmeta.WithTenant、metrics.WithMeta 写入的是同一份数据）；
+// 业务用其他字段携带用户和租户时，可以直接从中读取，不必在每个请求入口重复注入。
+//
+// 示例：
+//
+//	db.WithStampResolver(func(ctx context.Context) (string, string) {
+//	    actor, _ := ctxmeta.Get(ctx, "user_id")
+//	    return actor, ctxmeta.Tenant(ctx)
+//	})
+func WithStampResolver(resolver StampResolver) Option {
+	return func(p *provider) {
+		p.stampResolver = resolver
+	}
+}
+
+// WithRowScopedModels 预先登记实现了 RowScoped 的模型。
+// 没有模型的语句（如 DB(ctx).Table("notes").Count(&n)）只能按表名查找过滤条件，
+// 未登记的表在第一次通过模型访问之前不会被过滤；登记后从第一条语句起就强制过滤。
+// AutoMigrate/EnsureTables 迁移的模型会自动登记。
+//
+// 示例：
+//
+//	db.New(ctx, cfg, db.WithRowScopedModels(&Note{}, &Group{}))
+func WithRowScopedModels(models ...RowScoped) Option {
+	return func(p *provider) {
+		p.rowScopedModels = append(p.rowScopedModels, models...)
+	}
+}
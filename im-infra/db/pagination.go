@@ -0,0 +1,75 @@
+package db
+
+import (
+	"github.com/ceyewan/gochat/im-infra/db/internal"
+	"gorm.io/gorm"
+)
+
+// SortKey 游标分页的一个排序键
+type SortKey = internal.SortKey
+
+// CursorOptions 游标分页选项
+type CursorOptions = internal.CursorOptions
+
+// 分页大小
+const (
+	DefaultPageLimit = internal.DefaultPageLimit
+	MaxPageLimit     = internal.MaxPageLimit
+)
+
+// ErrInvalidCursor 游标无法解码，或与本次查询的排序键不一致，通常应作为参数错误返回给调用方
+var ErrInvalidCursor = internal.ErrInvalidCursor
+
+// Page 一页查询结果
+type Page[T any] struct {
+	// Items 本页的行
+	Items []T `json:"items"`
+	// NextCursor 下一页的游标，没有下一页时为空
+	NextCursor string `json:"nextCursor,omitempty"`
+	// HasMore 是否还有下一页
+	HasMore bool `json:"hasMore"`
+}
+
+// Paginate 按排序键做游标（keyset）分页。
+// 与 OFFSET/LIMIT 不同，每一页都从上一页最后一行的排序键之后开始读取，
+// 可以利用 (排序键...) 上的索引直接定位，翻到多深都是同样的开销，翻页期间插入或删除行也不会导致重复或遗漏。
+//
+// 游标中编码了上一页最后一行的排序键取值，对调用方不透明，可以直接返回给客户端；
+// 游标只能用于排序键相同的查询，否则返回 ErrInvalidCursor。
+// query 设置过滤条件即可，不要再设置 Order、Offset 和 Limit；T 必须是结构体，排序列不能为 NULL。
+//
+// 示例：
+//
+//	// 按注册时间倒序列出用户，id 作为最后一个排序键保证顺序唯一
+//	page, err := db.Paginate[User](database.DB(ctx).Where("status = ?", 1), db.CursorOptions{
+//		SortKeys: []db.SortKey{{Column: "created_at", Desc: true}, {Column: "id", Desc: true}},
+//		Limit:    50,
+//		Cursor:   req.PageToken,
+//	})
+//	if errors.Is(err, db.ErrInvalidCursor) {
+//		return status.Error(codes.InvalidArgument, "invalid page token")
+//	}
+//	resp.Users, resp.NextPageToken = page.Items, page.NextCursor
+func Paginate[T any](query *gorm.DB, opts CursorOptions) (*Page[T], error) {
+	tx, opts, err := internal.CursorQuery(query, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []T
+	result := tx.Find(&items)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	page := &Page[T]{Items: items}
+	if len(items) > opts.Limit {
+		page.Items = items[:opts.Limit]
+		page.HasMore = true
+		page.NextCursor, err = internal.EncodeCursor(result, opts.SortKeys, &page.Items[opts.Limit-1])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return page, nil
+}
@@ -2,6 +2,7 @@ package db_test
 
 import (
 	"context"
+	"fmt"
 	"testing"
 	"time"
 
@@ -180,6 +181,51 @@ func TestContextPropagation(t *testing.T) {
 	})
 }
 
+// TestWithSnapshot 测试快照读事务
+func TestWithSnapshot(t *testing.T) {
+	if testing.Short() {
+		t.Skip("跳过需要数据库的测试")
+	}
+
+	cfg := db.GetDefaultConfig("development")
+	cfg.DSN = "root:mysql@tcp(localhost:3306)/gochat_test?charset=utf8mb4&parseTime=True&loc=Local"
+
+	provider, err := db.New(context.Background(), cfg, db.WithLogger(clog.Namespace("snapshot-test")))
+	if err != nil {
+		t.Skipf("无法连接到数据库: %v", err)
+	}
+	defer provider.Close()
+
+	t.Run("MultiQuery", func(t *testing.T) {
+		var first, second int
+		err := provider.WithSnapshot(context.Background(), func(tx *gorm.DB) error {
+			if err := tx.Raw("SELECT 1").Scan(&first).Error; err != nil {
+				return err
+			}
+			return tx.Raw("SELECT 2").Scan(&second).Error
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, first)
+		assert.Equal(t, 2, second)
+	})
+
+	t.Run("RejectsWrites", func(t *testing.T) {
+		// 只读事务中对普通表的写入会被 MySQL 拒绝
+		err := provider.WithSnapshot(context.Background(), func(tx *gorm.DB) error {
+			return tx.Exec("UPDATE mysql.user SET host = host WHERE 1 = 0").Error
+		})
+		assert.Error(t, err)
+	})
+
+	t.Run("ReturnsCallbackError", func(t *testing.T) {
+		err := provider.WithSnapshot(context.Background(), func(tx *gorm.DB) error {
+			return assert.AnError
+		})
+		assert.Equal(t, assert.AnError, err)
+	})
+}
+
 // TestAutoMigrate 测试自动迁移功能
 func TestAutoMigrate(t *testing.T) {
 	if testing.Short() {
@@ -239,6 +285,100 @@ func TestAutoMigrate(t *testing.T) {
 	})
 }
 
+// TestPaginate 测试游标分页的复合排序键、降序和非法游标
+func TestPaginate(t *testing.T) {
+	if testing.Short() {
+		t.Skip("跳过需要数据库的测试")
+	}
+
+	cfg := db.GetDefaultConfig("development")
+	cfg.DSN = "root:mysql@tcp(localhost:3306)/gochat_test?charset=utf8mb4&parseTime=True&loc=Local"
+
+	provider, err := db.New(context.Background(), cfg, db.WithLogger(clog.Namespace("paginate-test")))
+	if err != nil {
+		t.Skipf("无法连接到数据库: %v", err)
+	}
+	defer provider.Close()
+
+	type PageItem struct {
+		ID       int64  `gorm:"primaryKey"`
+		Score    int    `gorm:"index"`
+		Name     string `gorm:"size:50"`
+		CreateAt time.Time
+	}
+
+	ctx := context.Background()
+	require.NoError(t, provider.AutoMigrate(ctx, &PageItem{}))
+	gormDB := provider.DB(ctx)
+	require.NoError(t, gormDB.Exec("DELETE FROM page_items").Error)
+	defer gormDB.Exec("DROP TABLE IF EXISTS page_items")
+
+	// 分数只有 3 种取值，大量重复，需要 id 作为第二个排序键
+	base := time.Now().Truncate(time.Second)
+	var items []PageItem
+	for i := 1; i <= 25; i++ {
+		items = append(items, PageItem{ID: int64(i), Score: i % 3, Name: fmt.Sprintf("item-%d", i), CreateAt: base.Add(time.Duration(i) * time.Second)})
+	}
+	require.NoError(t, gormDB.Create(&items).Error)
+
+	t.Run("CompoundDescending", func(t *testing.T) {
+		opts := db.CursorOptions{
+			SortKeys: []db.SortKey{{Column: "score", Desc: true}, {Column: "id"}},
+			Limit:    7,
+		}
+		var got []int64
+		pages := 0
+		for {
+			page, err := db.Paginate[PageItem](gormDB.Where("id <= ?", 25), opts)
+			require.NoError(t, err)
+			pages++
+			for _, item := range page.Items {
+				got = append(got, item.ID)
+			}
+			if !page.HasMore {
+				assert.Empty(t, page.NextCursor)
+				break
+			}
+			opts.Cursor = page.NextCursor
+		}
+
+		var want []int64
+		require.NoError(t, gormDB.Model(&PageItem{}).Order("score DESC, id ASC").Pluck("id", &want).Error)
+		assert.Equal(t, want, got)
+		assert.Equal(t, 4, pages)
+	})
+
+	t.Run("TimeSortKey", func(t *testing.T) {
+		opts := db.CursorOptions{SortKeys: []db.SortKey{{Column: "create_at", Desc: true}, {Column: "id", Desc: true}}, Limit: 10}
+		first, err := db.Paginate[PageItem](gormDB, opts)
+		require.NoError(t, err)
+		require.True(t, first.HasMore)
+		assert.Equal(t, int64(25), first.Items[0].ID)
+
+		opts.Cursor = first.NextCursor
+		second, err := db.Paginate[PageItem](gormDB, opts)
+		require.NoError(t, err)
+		assert.Equal(t, int64(15), second.Items[0].ID)
+	})
+
+	t.Run("InvalidCursor", func(t *testing.T) {
+		_, err := db.Paginate[PageItem](gormDB, db.CursorOptions{Cursor: "not-a-cursor"})
+		assert.ErrorIs(t, err, db.ErrInvalidCursor)
+
+		// 游标不能用于排序键不同的查询
+		page, err := db.Paginate[PageItem](gormDB, db.CursorOptions{Limit: 5})
+		require.NoError(t, err)
+		_, err = db.Paginate[PageItem](gormDB, db.CursorOptions{
+			SortKeys: []db.SortKey{{Column: "score"}, {Column: "id"}},
+			Cursor:   page.NextCursor,
+		})
+		assert.ErrorIs(t, err, db.ErrInvalidCursor)
+
+		_, err = db.Paginate[PageItem](gormDB, db.CursorOptions{SortKeys: []db.SortKey{{Column: "id; DROP TABLE page_items"}}})
+		assert.Error(t, err)
+	})
+}
+
 // BenchmarkProvider 性能基准测试
 func BenchmarkProvider_DB(b *testing.B) {
 	if testing.Short() {
@@ -296,4 +436,83 @@ func BenchmarkProvider_Transaction(b *testing.B) {
 			b.Fatal(err)
 		}
 	}
-}
\ No newline at end of file
+}
+
+// scopedNote 登记了租户和软删除过滤的测试模型
+type scopedNote struct {
+	ID        int64  `gorm:"primaryKey"`
+	TenantID  string `gorm:"size:64;index"`
+	Body      string `gorm:"size:200"`
+	DeletedAt *time.Time
+}
+
+func (scopedNote) RowScopes() []db.RowScope {
+	return []db.RowScope{db.TenantScope("tenant_id"), db.NotDeletedScope("deleted_at")}
+}
+
+// TestRowScope 测试行级过滤、豁免和缺少租户时的拒绝
+func TestRowScope(t *testing.T) {
+	if testing.Short() {
+		t.Skip("跳过需要数据库的测试")
+	}
+
+	cfg := db.GetDefaultConfig("development")
+	cfg.DSN = "root:mysql@tcp(localhost:3306)/gochat_test?charset=utf8mb4&parseTime=True&loc=Local"
+
+	provider, err := db.New(context.Background(), cfg,
+		db.WithLogger(clog.Namespace("rowscope-test")),
+		db.WithRowScopedModels(&scopedNote{}))
+	if err != nil {
+		t.Skipf("无法连接到数据库: %v", err)
+	}
+	defer provider.Close()
+
+	ctx := context.Background()
+	require.NoError(t, provider.AutoMigrate(ctx, &scopedNote{}))
+	all := db.WithoutRowScopes(ctx, "test cleanup")
+	require.NoError(t, provider.DB(all).Where("1 = 1").Delete(&scopedNote{}).Error)
+
+	deleted := time.Now()
+	require.NoError(t, provider.DB(ctx).Create([]scopedNote{
+		{TenantID: "t1", Body: "a"},
+		{TenantID: "t1", Body: "b", DeletedAt: &deleted},
+		{TenantID: "t2", Body: "c"},
+	}).Error)
+
+	t1 := db.WithTenant(ctx, "t1")
+
+	t.Run("FilterByTenant", func(t *testing.T) {
+		var count int64
+		require.NoError(t, provider.DB(t1).Table("scoped_notes").Count(&count).Error)
+		assert.Equal(t, int64(1), count, "按表名访问已登记的表同样过滤")
+
+		var notes []scopedNote
+		require.NoError(t, provider.DB(t1).Find(&notes).Error)
+		require.Len(t, notes, 1)
+		assert.Equal(t, "a", notes[0].Body)
+	})
+
+	t.Run("RejectWithoutTenant", func(t *testing.T) {
+		var notes []scopedNote
+		err := provider.DB(ctx).Find(&notes).Error
+		assert.ErrorIs(t, err, db.ErrRowScopeViolation)
+
+		err = provider.DB(ctx).Model(&scopedNote{}).Where("body = ?", "c").Update("body", "x").Error
+		assert.ErrorIs(t, err, db.ErrRowScopeViolation)
+	})
+
+	t.Run("UpdateOtherTenant", func(t *testing.T) {
+		result := provider.DB(t1).Model(&scopedNote{}).Where("body = ?", "c").Update("body", "x")
+		require.NoError(t, result.Error)
+		assert.Equal(t, int64(0), result.RowsAffected, "不能修改其他租户的行")
+	})
+
+	t.Run("WithoutRowScopes", func(t *testing.T) {
+		var notes []scopedNote
+		require.NoError(t, provider.DB(db.WithoutRowScopes(t1, "include deleted", "not_deleted")).Find(&notes).Error)
+		assert.Len(t, notes, 2)
+
+		require.NoError(t, provider.DB(db.WithoutRowScopes(ctx, "report")).Find(&notes).Error)
+		assert.Len(t, notes, 3)
+	})
+}
@@ -0,0 +1,268 @@
+package es
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+// 单次读取同义词集合的最大规则数，与 Elasticsearch 的上限一致
+const maxSynonymRules = 10000
+
+// SynonymRule 一条同义词规则
+type SynonymRule struct {
+	// ID 规则 ID，为空时由 Elasticsearch 生成；指定 ID 便于后续单独修改或删除该规则
+	ID string `json:"id,omitempty"`
+	// Synonyms Solr 格式的规则，如 "yyds, 永远的神" 或 "u => you"
+	Synonyms string `json:"synonyms"`
+}
+
+// AnalyzerConfig 描述一个挂载了同义词和停用词的自定义分析器
+type AnalyzerConfig struct {
+	// Name 分析器名称，mapping 中通过 search_analyzer 引用，必填
+	Name string
+	// Tokenizer 分词器，默认 "standard"，中文场景可使用 "ik_smart" 等插件分词器
+	Tokenizer string
+	// Filters 在停用词和同义词之前执行的过滤器，如 "lowercase"
+	Filters []string
+	// SynonymSet 同义词集合 ID（通过 PutSynonymSet 维护），为空时不挂载同义词
+	// 同义词过滤器以 updateable 方式创建，更新集合后无需重建索引即可生效，
+	// 因此该分析器只能作为 search_analyzer 使用
+	SynonymSet string
+	// Stopwords 停用词列表，为空时不挂载停用词过滤器
+	Stopwords []string
+}
+
+// PutSynonymSet 创建或整体替换同义词集合。
+// 已有索引中引用该集合的搜索分析器会由 Elasticsearch 自动重新加载。
+func (p *provider[T]) PutSynonymSet(ctx context.Context, setID string, rules []SynonymRule) error {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(map[string]interface{}{"synonyms_set": rules}); err != nil {
+		return err
+	}
+
+	res, err := p.client.SynonymsPutSynonym(setID, &buf, p.client.SynonymsPutSynonym.WithContext(ctx))
+	if err != nil {
+		p.logger.Error("更新同义词集合失败", clog.Err(err), clog.String("set_id", setID))
+		return err
+	}
+	if err := p.checkAnalysisResponse(res, "更新同义词集合", setID); err != nil {
+		return err
+	}
+
+	p.logger.Info("同义词集合已更新", clog.String("set_id", setID), clog.Int("rules", len(rules)))
+	return nil
+}
+
+// PutSynonymRule 在同义词集合中创建或替换一条规则，rule.ID 必填
+func (p *provider[T]) PutSynonymRule(ctx context.Context, setID string, rule SynonymRule) error {
+	if rule.ID == "" {
+		return errors.New("同义词规则 ID 不能为空")
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(map[string]string{"synonyms": rule.Synonyms}); err != nil {
+		return err
+	}
+
+	res, err := p.client.SynonymsPutSynonymRule(&buf, rule.ID, setID, p.client.SynonymsPutSynonymRule.WithContext(ctx))
+	if err != nil {
+		p.logger.Error("更新同义词规则失败", clog.Err(err),
+			clog.String("set_id", setID), clog.String("rule_id", rule.ID))
+		return err
+	}
+	if err := p.checkAnalysisResponse(res, "更新同义词规则", setID); err != nil {
+		return err
+	}
+
+	p.logger.Info("同义词规则已更新", clog.String("set_id", setID), clog.String("rule_id", rule.ID))
+	return nil
+}
+
+// GetSynonymSet 读取同义词集合中的全部规则
+func (p *provider[T]) GetSynonymSet(ctx context.Context, setID string) ([]SynonymRule, error) {
+	res, err := p.client.SynonymsGetSynonym(setID,
+		p.client.SynonymsGetSynonym.WithContext(ctx),
+		p.client.SynonymsGetSynonym.WithSize(maxSynonymRules),
+	)
+	if err != nil {
+		p.logger.Error("读取同义词集合失败", clog.Err(err), clog.String("set_id", setID))
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		p.logger.Error("读取同义词集合响应错误",
+			clog.String("set_id", setID),
+			clog.String("status", res.Status()))
+		return nil, errors.New(res.Status())
+	}
+
+	var r struct {
+		SynonymsSet []SynonymRule `json:"synonyms_set"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		p.logger.Error("解码同义词集合失败", clog.Err(err), clog.String("set_id", setID))
+		return nil, err
+	}
+	return r.SynonymsSet, nil
+}
+
+// DeleteSynonymSet 删除同义词集合，仍被分析器引用的集合会被 Elasticsearch 拒绝删除
+func (p *provider[T]) DeleteSynonymSet(ctx context.Context, setID string) error {
+	res, err := p.client.SynonymsDeleteSynonym(setID, p.client.SynonymsDeleteSynonym.WithContext(ctx))
+	if err != nil {
+		p.logger.Error("删除同义词集合失败", clog.Err(err), clog.String("set_id", setID))
+		return err
+	}
+	if err := p.checkAnalysisResponse(res, "删除同义词集合", setID); err != nil {
+		return err
+	}
+
+	p.logger.Info("同义词集合已删除", clog.String("set_id", setID))
+	return nil
+}
+
+// UpdateAnalyzer 在已有索引上创建或替换自定义分析器。
+// Elasticsearch 只允许在关闭的索引上修改 analysis 设置，因此该操作会短暂关闭索引，
+// 期间读写请求都会失败；仅调整同义词时应使用 PutSynonymSet，无需关闭索引。
+func (p *provider[T]) UpdateAnalyzer(ctx context.Context, index string, cfg *AnalyzerConfig) error {
+	settings, err := BuildAnalysisSettings(cfg)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(settings); err != nil {
+		return err
+	}
+
+	p.queryCache.advance(ctx, index, p.queryCache.settleWindow())
+	res, err := p.client.Indices.Close([]string{index}, p.client.Indices.Close.WithContext(ctx))
+	if err != nil {
+		p.logger.Error("关闭索引失败", clog.Err(err), clog.String("index", index))
+		return err
+	}
+	if err := p.checkAnalysisResponse(res, "关闭索引", index); err != nil {
+		return err
+	}
+
+	// 无论设置是否更新成功都要重新打开索引
+	updateErr := p.putIndexSettings(ctx, index, &buf)
+
+	res, err = p.client.Indices.Open([]string{index}, p.client.Indices.Open.WithContext(context.WithoutCancel(ctx)))
+	if err != nil {
+		p.logger.Error("重新打开索引失败", clog.Err(err), clog.String("index", index))
+		return errors.Join(updateErr, err)
+	}
+	if err := p.checkAnalysisResponse(res, "重新打开索引", index); err != nil {
+		return errors.Join(updateErr, err)
+	}
+	if updateErr != nil {
+		return updateErr
+	}
+
+	p.logger.Info("分析器已更新",
+		clog.String("index", index),
+		clog.String("analyzer", cfg.Name),
+		clog.String("synonym_set", cfg.SynonymSet),
+		clog.Int("stopwords", len(cfg.Stopwords)))
+	return nil
+}
+
+// ReloadSearchAnalyzers 重新加载索引的搜索分析器，使基于文件的 updateable 同义词变更生效。
+// 通过 PutSynonymSet 维护的集合会自动重新加载，通常无需调用。
+func (p *provider[T]) ReloadSearchAnalyzers(ctx context.Context, index string) error {
+	p.queryCache.advance(ctx, index, p.queryCache.settleWindow())
+	res, err := p.client.Indices.ReloadSearchAnalyzers([]string{index},
+		p.client.Indices.ReloadSearchAnalyzers.WithContext(ctx))
+	if err != nil {
+		p.logger.Error("重新加载搜索分析器失败", clog.Err(err), clog.String("index", index))
+		return err
+	}
+	if err := p.checkAnalysisResponse(res, "重新加载搜索分析器", index); err != nil {
+		return err
+	}
+
+	p.logger.Info("搜索分析器已重新加载", clog.String("index", index))
+	return nil
+}
+
+// putIndexSettings 更新索引设置
+func (p *provider[T]) putIndexSettings(ctx context.Context, index string, body io.Reader) error {
+	res, err := p.client.Indices.PutSettings(body,
+		p.client.Indices.PutSettings.WithContext(ctx),
+		p.client.Indices.PutSettings.WithIndex(index),
+	)
+	if err != nil {
+		p.logger.Error("更新索引设置失败", clog.Err(err), clog.String("index", index))
+		return err
+	}
+	return p.checkAnalysisResponse(res, "更新索引设置", index)
+}
+
+// checkAnalysisResponse 关闭响应体并将错误响应转换为 error
+func (p *provider[T]) checkAnalysisResponse(res *esapi.Response, action, target string) error {
+	defer res.Body.Close()
+
+	if res.IsError() {
+		p.logger.Error(action+"响应错误",
+			clog.String("target", target),
+			clog.String("status", res.Status()))
+		return errors.New(res.Status())
+	}
+	return nil
+}
+
+// BuildAnalysisSettings 根据分析器配置生成索引 settings，
+// 可直接用于 IndexOptions.Settings 在创建索引时挂载分析器。
+// 过滤器依次为 Filters、停用词、同义词，分别命名为 "{Name}_stop" 和 "{Name}_synonyms"。
+func BuildAnalysisSettings(cfg *AnalyzerConfig) (map[string]interface{}, error) {
+	if cfg == nil || cfg.Name == "" {
+		return nil, errors.New("分析器名称不能为空")
+	}
+
+	tokenizer := cfg.Tokenizer
+	if tokenizer == "" {
+		tokenizer = "standard"
+	}
+
+	filterChain := append([]string{}, cfg.Filters...)
+	filters := map[string]interface{}{}
+	if len(cfg.Stopwords) > 0 {
+		name := fmt.Sprintf("%s_stop", cfg.Name)
+		filters[name] = map[string]interface{}{
+			"type":      "stop",
+			"stopwords": cfg.Stopwords,
+		}
+		filterChain = append(filterChain, name)
+	}
+	if cfg.SynonymSet != "" {
+		name := fmt.Sprintf("%s_synonyms", cfg.Name)
+		filters[name] = map[string]interface{}{
+			"type":         "synonym_graph",
+			"synonyms_set": cfg.SynonymSet,
+			"updateable":   true,
+		}
+		filterChain = append(filterChain, name)
+	}
+
+	analysis := map[string]interface{}{
+		"analyzer": map[string]interface{}{
+			cfg.Name: map[string]interface{}{
+				"type":      "custom",
+				"tokenizer": tokenizer,
+				"filter":    filterChain,
+			},
+		},
+	}
+	if len(filters) > 0 {
+		analysis["filter"] = filters
+	}
+	return map[string]interface{}{"analysis": analysis}, nil
+}
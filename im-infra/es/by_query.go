@@ -0,0 +1,347 @@
+package es
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+// 版本冲突处理策略
+const (
+	// ConflictsAbort 遇到版本冲突时中止任务
+	ConflictsAbort = "abort"
+	// ConflictsProceed 遇到版本冲突时跳过该文档继续执行
+	ConflictsProceed = "proceed"
+)
+
+// ByQueryOptions 控制 DeleteByQuery 和 UpdateByQuery 的执行方式
+type ByQueryOptions struct {
+	// RequestsPerSecond 每秒子请求数限流，<= 0 表示不限流
+	RequestsPerSecond int
+	// Slices 并行切片数，0 表示不切片，< 0 表示由 Elasticsearch 自动决定（auto）
+	Slices int
+	// Conflicts 版本冲突处理策略，ConflictsAbort 或 ConflictsProceed，默认 ConflictsProceed
+	Conflicts string
+	// ScrollSize 每批次处理的文档数，0 表示使用 Elasticsearch 默认值（1000）
+	ScrollSize int
+	// Refresh 任务完成后是否刷新受影响的索引
+	Refresh bool
+}
+
+// UpdateScript 定义 UpdateByQuery 对每个匹配文档执行的 painless 脚本
+type UpdateScript struct {
+	// Source 脚本内容，如 "ctx._source.content = params.placeholder"
+	Source string `json:"source"`
+	// Params 脚本参数
+	Params map[string]interface{} `json:"params,omitempty"`
+}
+
+// ByQueryStatus 描述 by-query 任务的进度和结果
+type ByQueryStatus struct {
+	Total            int64 `json:"total"`
+	Deleted          int64 `json:"deleted"`
+	Updated          int64 `json:"updated"`
+	VersionConflicts int64 `json:"version_conflicts"`
+	Batches          int64 `json:"batches"`
+	Noops            int64 `json:"noops"`
+	// RequestsPerSecond 当前生效的限流值，-1 表示不限流
+	RequestsPerSecond float64 `json:"requests_per_second"`
+}
+
+// TaskStatus 描述一个 Elasticsearch 后台任务的状态
+type TaskStatus struct {
+	// TaskID 任务 ID，格式为 "node_id:task_number"
+	TaskID string
+	// Completed 任务是否已结束
+	Completed bool
+	// Status 任务进度
+	Status ByQueryStatus
+	// Failures 任务结束时记录的失败信息
+	Failures []string
+	// Error 任务本身失败时的错误信息
+	Error string
+	// RunningTime 任务已运行的时长
+	RunningTime time.Duration
+}
+
+// failureSummary 汇总任务的错误信息和逐条失败记录，用于构造错误
+func (s *TaskStatus) failureSummary() string {
+	parts := make([]string, 0, len(s.Failures)+1)
+	if s.Error != "" {
+		parts = append(parts, s.Error)
+	}
+	parts = append(parts, s.Failures...)
+	return strings.Join(parts, "; ")
+}
+
+// DeleteByQuery 以后台任务的方式删除匹配 query 的所有文档，返回任务 ID。
+// query 为 Elasticsearch 查询 DSL 中 "query" 字段的内容。
+// 可通过 GetTask/WaitForTask 跟踪进度，CancelTask 取消任务。
+func (p *provider[T]) DeleteByQuery(ctx context.Context, index string, query map[string]interface{}, opts *ByQueryOptions) (string, error) {
+	body, err := encodeByQueryBody(query, nil)
+	if err != nil {
+		p.logger.Error("编码 delete_by_query 请求失败", clog.Err(err))
+		return "", err
+	}
+	opts = normalizeByQueryOptions(opts)
+
+	api := p.client.DeleteByQuery
+	reqOpts := []func(*esapi.DeleteByQueryRequest){
+		api.WithContext(ctx),
+		api.WithWaitForCompletion(false),
+		api.WithConflicts(opts.Conflicts),
+		api.WithRefresh(opts.Refresh),
+	}
+	if opts.RequestsPerSecond > 0 {
+		reqOpts = append(reqOpts, api.WithRequestsPerSecond(opts.RequestsPerSecond))
+	}
+	if slices := slicesParam(opts.Slices); slices != nil {
+		reqOpts = append(reqOpts, api.WithSlices(slices))
+	}
+	if opts.ScrollSize > 0 {
+		reqOpts = append(reqOpts, api.WithScrollSize(opts.ScrollSize))
+	}
+
+	p.queryCache.advance(ctx, index, p.queryCache.taskWindow())
+	res, err := api([]string{index}, body, reqOpts...)
+	if err != nil {
+		p.logger.Error("delete_by_query 请求失败", clog.Err(err), clog.String("index", index))
+		return "", err
+	}
+	return p.decodeTaskID(res, "delete_by_query", index)
+}
+
+// UpdateByQuery 以后台任务的方式对匹配 query 的所有文档执行 script，返回任务 ID。
+// script 为 nil 时仅重新索引匹配的文档（用于拾取 mapping 变更）。
+func (p *provider[T]) UpdateByQuery(ctx context.Context, index string, query map[string]interface{}, script *UpdateScript, opts *ByQueryOptions) (string, error) {
+	body, err := encodeByQueryBody(query, script)
+	if err != nil {
+		p.logger.Error("编码 update_by_query 请求失败", clog.Err(err))
+		return "", err
+	}
+	opts = normalizeByQueryOptions(opts)
+
+	api := p.client.UpdateByQuery
+	reqOpts := []func(*esapi.UpdateByQueryRequest){
+		api.WithContext(ctx),
+		api.WithBody(body),
+		api.WithWaitForCompletion(false),
+		api.WithConflicts(opts.Conflicts),
+		api.WithRefresh(opts.Refresh),
+	}
+	if opts.RequestsPerSecond > 0 {
+		reqOpts = append(reqOpts, api.WithRequestsPerSecond(opts.RequestsPerSecond))
+	}
+	if slices := slicesParam(opts.Slices); slices != nil {
+		reqOpts = append(reqOpts, api.WithSlices(slices))
+	}
+	if opts.ScrollSize > 0 {
+		reqOpts = append(reqOpts, api.WithScrollSize(opts.ScrollSize))
+	}
+
+	p.queryCache.advance(ctx, index, p.queryCache.taskWindow())
+	res, err := api([]string{index}, reqOpts...)
+	if err != nil {
+		p.logger.Error("update_by_query 请求失败", clog.Err(err), clog.String("index", index))
+		return "", err
+	}
+	return p.decodeTaskID(res, "update_by_query", index)
+}
+
+// GetTask 查询后台任务的状态
+func (p *provider[T]) GetTask(ctx context.Context, taskID string) (*TaskStatus, error) {
+	res, err := p.client.Tasks.Get(taskID, p.client.Tasks.Get.WithContext(ctx))
+	if err != nil {
+		p.logger.Error("查询任务状态失败", clog.Err(err), clog.String("task_id", taskID))
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		p.logger.Error("查询任务状态响应错误",
+			clog.String("task_id", taskID),
+			clog.String("status", res.Status()))
+		return nil, errors.New(res.Status())
+	}
+
+	var r struct {
+		Completed bool `json:"completed"`
+		Task      struct {
+			Status             ByQueryStatus `json:"status"`
+			RunningTimeInNanos int64         `json:"running_time_in_nanos"`
+		} `json:"task"`
+		Response struct {
+			Failures []json.RawMessage `json:"failures"`
+		} `json:"response"`
+		Error *struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		p.logger.Error("解码任务状态失败", clog.Err(err), clog.String("task_id", taskID))
+		return nil, err
+	}
+
+	status := &TaskStatus{
+		TaskID:      taskID,
+		Completed:   r.Completed,
+		Status:      r.Task.Status,
+		RunningTime: time.Duration(r.Task.RunningTimeInNanos),
+	}
+	for _, failure := range r.Response.Failures {
+		status.Failures = append(status.Failures, string(failure))
+	}
+	if r.Error != nil {
+		status.Error = fmt.Sprintf("%s: %s", r.Error.Type, r.Error.Reason)
+	}
+	return status, nil
+}
+
+// WaitForTask 每隔 interval 轮询一次任务状态，直到任务结束或 ctx 被取消。
+// 任务以失败结束时返回最终状态和错误。
+func (p *provider[T]) WaitForTask(ctx context.Context, taskID string, interval time.Duration) (*TaskStatus, error) {
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		status, err := p.GetTask(ctx, taskID)
+		if err != nil {
+			return nil, err
+		}
+
+		if status.Completed {
+			p.logger.Info("后台任务已完成",
+				clog.String("task_id", taskID),
+				clog.Int64("total", status.Status.Total),
+				clog.Int64("deleted", status.Status.Deleted),
+				clog.Int64("updated", status.Status.Updated),
+				clog.Int64("version_conflicts", status.Status.VersionConflicts),
+				clog.Duration("running_time", status.RunningTime))
+			if status.Error != "" || len(status.Failures) > 0 {
+				return status, fmt.Errorf("task %s finished with failures: %s", taskID, status.failureSummary())
+			}
+			return status, nil
+		}
+
+		p.logger.Debug("后台任务执行中",
+			clog.String("task_id", taskID),
+			clog.Int64("total", status.Status.Total),
+			clog.Int64("batches", status.Status.Batches))
+
+		select {
+		case <-ctx.Done():
+			return status, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// CancelTask 取消一个正在执行的后台任务，已处理的文档不会回滚
+func (p *provider[T]) CancelTask(ctx context.Context, taskID string) error {
+	res, err := p.client.Tasks.Cancel(
+		p.client.Tasks.Cancel.WithContext(ctx),
+		p.client.Tasks.Cancel.WithTaskID(taskID),
+	)
+	if err != nil {
+		p.logger.Error("取消任务失败", clog.Err(err), clog.String("task_id", taskID))
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		p.logger.Error("取消任务响应错误",
+			clog.String("task_id", taskID),
+			clog.String("status", res.Status()))
+		return errors.New(res.Status())
+	}
+
+	p.logger.Info("后台任务已取消", clog.String("task_id", taskID))
+	return nil
+}
+
+// decodeTaskID 从异步 by-query 响应中解析任务 ID
+func (p *provider[T]) decodeTaskID(res *esapi.Response, action, index string) (string, error) {
+	defer res.Body.Close()
+
+	if res.IsError() {
+		p.logger.Error(action+" 响应错误",
+			clog.String("index", index),
+			clog.String("status", res.Status()))
+		return "", errors.New(res.Status())
+	}
+
+	var r struct {
+		Task string `json:"task"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		p.logger.Error("解码 "+action+" 响应失败", clog.Err(err))
+		return "", err
+	}
+
+	p.logger.Info("后台任务已提交",
+		clog.String("action", action),
+		clog.String("index", index),
+		clog.String("task_id", r.Task))
+	return r.Task, nil
+}
+
+// encodeByQueryBody 构建 by-query 请求体
+func encodeByQueryBody(query map[string]interface{}, script *UpdateScript) (io.Reader, error) {
+	if len(query) == 0 {
+		return nil, errors.New("by-query 请求的 query 不能为空")
+	}
+
+	payload := map[string]interface{}{
+		"query": query,
+	}
+	if script != nil {
+		payload["script"] = map[string]interface{}{
+			"source": script.Source,
+			"params": script.Params,
+			"lang":   "painless",
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(payload); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
+
+// normalizeByQueryOptions 填充默认值
+func normalizeByQueryOptions(opts *ByQueryOptions) *ByQueryOptions {
+	normalized := ByQueryOptions{}
+	if opts != nil {
+		normalized = *opts
+	}
+	if normalized.Conflicts == "" {
+		normalized.Conflicts = ConflictsProceed
+	}
+	return &normalized
+}
+
+// slicesParam 将切片数转换为请求参数，nil 表示不设置
+func slicesParam(slices int) interface{} {
+	switch {
+	case slices < 0:
+		return "auto"
+	case slices > 1:
+		return slices
+	default:
+		return nil
+	}
+}
@@ -6,9 +6,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sync"
 
 	"github.com/ceyewan/gochat/im-infra/clog"
 	"github.com/ceyewan/gochat/im-infra/es/internal"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
 	"github.com/elastic/go-elasticsearch/v8/esutil"
 )
 
@@ -17,6 +19,11 @@ type provider[T Indexable] struct {
 	client      *internal.Client
 	bulkIndexer esutil.BulkIndexer
 	logger      clog.Logger
+	// queryCache 搜索结果缓存，未通过 WithQueryCache 启用时为 nil
+	queryCache *queryCache
+
+	// ensuredIndexes 记录已确认存在的索引，避免每次写入都检查
+	ensuredIndexes sync.Map
 }
 
 // New 创建一个新的 es.Provider 实例
@@ -54,41 +61,20 @@ func New[T Indexable](ctx context.Context, cfg *Config, opts ...Option) (Provide
 		return nil, err
 	}
 
-	return &provider[T]{
+	p := &provider[T]{
 		client:      client,
 		bulkIndexer: bi,
 		logger:      logger,
-	}, nil
+	}
+	if options.queryCache != nil {
+		p.queryCache = newQueryCache(options.queryCache, options.queryCacheConfig, cfg.BulkIndexer.FlushInterval, logger)
+	}
+	return p, nil
 }
 
-// BulkIndex 批量索引文档
+// BulkIndex 批量索引文档，实现了 Routable 的文档按其路由值写入
 func (p *provider[T]) BulkIndex(ctx context.Context, index string, items []T) error {
-	for _, item := range items {
-		payload, err := json.Marshal(item)
-		if err != nil {
-			p.logger.Error("批量索引时序列化文档失败",
-				clog.Err(err),
-				clog.String("item_id", item.GetID()))
-			continue
-		}
-
-		err = p.bulkIndexer.Add(
-			ctx,
-			esutil.BulkIndexerItem{
-				Index:      index,
-				Action:     "index",
-				DocumentID: item.GetID(),
-				Body:       bytes.NewReader(payload),
-			},
-		)
-		if err != nil {
-			p.logger.Error("添加文档到批量索引器失败",
-				clog.Err(err),
-				clog.String("item_id", item.GetID()))
-			return err
-		}
-	}
-	return nil
+	return p.BulkIndexWithOptions(ctx, index, items, nil)
 }
 
 // Close 关闭 es provider
@@ -104,21 +90,35 @@ func (p *provider[T]) Close() error {
 
 // SearchGlobal 在所有文档中进行全局搜索
 func (p *provider[T]) SearchGlobal(ctx context.Context, index, keyword string, page, size int) (*SearchResult[T], error) {
-	return p.search(ctx, index, keyword, page, size, nil)
+	return p.search(ctx, index, keyword, page, size, &SearchOptions{})
 }
 
 // SearchInSession 在特定会话中进行搜索
 func (p *provider[T]) SearchInSession(ctx context.Context, index, sessionID, keyword string, page, size int) (*SearchResult[T], error) {
-	filter := map[string]interface{}{
-		"term": map[string]interface{}{
-			"session_id.keyword": sessionID, // 使用 .keyword 子字段进行精确匹配
-		},
+	return p.search(ctx, index, keyword, page, size, &SearchOptions{SessionID: sessionID})
+}
+
+// search 执行搜索，设置了 CacheClass 且启用了搜索结果缓存时优先读取缓存
+func (p *provider[T]) search(ctx context.Context, index, keyword string, page, size int, opts *SearchOptions) (*SearchResult[T], error) {
+	if p.queryCache == nil || opts.CacheClass == "" {
+		return p.doSearch(ctx, index, keyword, page, size, opts)
 	}
-	return p.search(ctx, index, keyword, page, size, filter)
+	return cachedSearch(ctx, p.queryCache, index, keyword, page, size, opts, func() (*SearchResult[T], error) {
+		return p.doSearch(ctx, index, keyword, page, size, opts)
+	})
 }
 
-// search 执行实际的搜索操作
-func (p *provider[T]) search(ctx context.Context, index, keyword string, page, size int, filter map[string]interface{}) (*SearchResult[T], error) {
+// doSearch 执行实际的搜索操作
+func (p *provider[T]) doSearch(ctx context.Context, index, keyword string, page, size int, opts *SearchOptions) (*SearchResult[T], error) {
+	var filter map[string]interface{}
+	if opts.SessionID != "" {
+		filter = map[string]interface{}{
+			"term": map[string]interface{}{
+				"session_id.keyword": opts.SessionID, // 使用 .keyword 子字段进行精确匹配
+			},
+		}
+	}
+
 	var buf bytes.Buffer
 	query := map[string]interface{}{
 		"query": map[string]interface{}{
@@ -158,14 +158,23 @@ func (p *provider[T]) search(ctx context.Context, index, keyword string, page, s
 		clog.String("index", index),
 		clog.String("keyword", keyword),
 		clog.String("has_filter", fmt.Sprintf("%v", filter != nil)),
+		clog.String("routing", opts.Routing),
 	)
 
-	res, err := p.client.Search(
+	searchOpts := []func(*esapi.SearchRequest){
 		p.client.Search.WithContext(ctx),
 		p.client.Search.WithIndex(index),
 		p.client.Search.WithBody(&buf),
 		p.client.Search.WithTrackTotalHits(true),
-	)
+	}
+	if opts.Routing != "" {
+		searchOpts = append(searchOpts, p.client.Search.WithRouting(opts.Routing))
+	}
+	if opts.Preference != "" {
+		searchOpts = append(searchOpts, p.client.Search.WithPreference(opts.Preference))
+	}
+
+	res, err := p.client.Search(searchOpts...)
 	if err != nil {
 		p.logger.Error("搜索请求失败", clog.Err(err))
 		return nil, err
@@ -178,6 +187,9 @@ func (p *provider[T]) search(ctx context.Context, index, keyword string, page, s
 	}
 
 	var r struct {
+		Shards struct {
+			Total int `json:"total"`
+		} `json:"_shards"`
 		Hits struct {
 			Total struct {
 				Value int64 `json:"value"`
@@ -194,8 +206,9 @@ func (p *provider[T]) search(ctx context.Context, index, keyword string, page, s
 	}
 
 	result := &SearchResult[T]{
-		Total: r.Hits.Total.Value,
-		Items: make([]*T, len(r.Hits.Hits)),
+		Total:  r.Hits.Total.Value,
+		Items:  make([]*T, len(r.Hits.Hits)),
+		Shards: r.Shards.Total,
 	}
 	for i, hit := range r.Hits.Hits {
 		item := hit.Source
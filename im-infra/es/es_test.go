@@ -2,10 +2,13 @@ package es
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"strconv"
 	"testing"
 	"time"
 
+	"github.com/ceyewan/gochat/im-infra/cache"
 	"github.com/ceyewan/gochat/im-infra/clog"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -119,6 +122,257 @@ func TestConfigDefaults(t *testing.T) {
 	assert.Greater(t, devConfig.BulkIndexer.FlushInterval, time.Duration(0))
 }
 
+// memoryCache 是只实现字符串和脚本操作的内存缓存，脚本按代际推进脚本的语义执行
+type memoryCache struct {
+	cache.Provider
+	values map[string]string
+}
+
+type memoryStrings struct {
+	cache.StringOperations
+	c *memoryCache
+}
+
+type memoryScripts struct {
+	cache.ScriptingOperations
+	c *memoryCache
+}
+
+func (m *memoryCache) String() cache.StringOperations    { return &memoryStrings{c: m} }
+func (m *memoryCache) Script() cache.ScriptingOperations { return &memoryScripts{c: m} }
+
+func (s *memoryStrings) Get(ctx context.Context, key string) (string, error) {
+	if v, ok := s.c.values[key]; ok {
+		return v, nil
+	}
+	return "", cache.ErrCacheMiss
+}
+
+func (s *memoryStrings) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	s.c.values[key] = string(value.([]byte))
+	return nil
+}
+
+func (s *memoryScripts) ScriptLoad(ctx context.Context, script string) (string, error) {
+	return "sha", nil
+}
+
+func (s *memoryScripts) EvalSha(ctx context.Context, sha1 string, keys []string, args ...interface{}) (interface{}, error) {
+	current, _ := strconv.ParseInt(s.c.values[keys[0]], 10, 64)
+	if next := args[0].(int64); next > current {
+		s.c.values[keys[0]] = strconv.FormatInt(next, 10)
+		return next, nil
+	}
+	return current, nil
+}
+
+func TestQueryCache(t *testing.T) {
+	ctx := context.Background()
+	mc := &memoryCache{values: make(map[string]string)}
+	qc := newQueryCache(mc, &QueryCacheConfig{
+		Classes: map[string]time.Duration{"hot_keyword": 0, "admin_dashboard": 5 * time.Minute},
+		Indexes: []string{"messages"},
+	}, 5*time.Second, clog.Namespace("test-es"))
+	assert.Equal(t, 6*time.Second, qc.settleWindow())
+	assert.Equal(t, 10*time.Minute, qc.taskWindow())
+
+	// 按索引和查询类别启用
+	ttl, ok := qc.ttlFor("messages", "hot_keyword")
+	assert.True(t, ok)
+	assert.Equal(t, time.Minute, ttl)
+	ttl, _ = qc.ttlFor("messages", "admin_dashboard")
+	assert.Equal(t, 5*time.Minute, ttl)
+	_, ok = qc.ttlFor("messages", "other")
+	assert.False(t, ok)
+	_, ok = qc.ttlFor("audit", "hot_keyword")
+	assert.False(t, ok)
+
+	searches := 0
+	search := func() (*SearchResult[TestMessage], error) {
+		searches++
+		return &SearchResult[TestMessage]{Total: int64(searches), Items: []*TestMessage{{ID: fmt.Sprint(searches)}}}, nil
+	}
+	opts := &SearchOptions{CacheClass: "hot_keyword"}
+	run := func() int64 {
+		result, err := cachedSearch(ctx, qc, "messages", "hello", 1, 10, opts, search)
+		require.NoError(t, err)
+		return result.Total
+	}
+
+	// 第二次命中缓存
+	assert.Equal(t, int64(1), run())
+	assert.Equal(t, int64(1), run())
+	assert.Equal(t, 1, searches)
+
+	// 写入后可见窗口内绕过缓存
+	qc.advance(ctx, "messages", time.Hour)
+	assert.Equal(t, int64(2), run())
+	assert.Equal(t, int64(3), run())
+
+	// 代际只增不减，失效不会缩短写入的可见窗口
+	require.NoError(t, qc.advanceGeneration(ctx, "messages", time.Now().UnixMilli()))
+	assert.Equal(t, int64(4), run())
+
+	// 窗口结束后以新代际缓存，写入前的旧结果不再命中
+	mc.values[qc.generationKey("messages")] = "1"
+	assert.Equal(t, int64(5), run())
+	assert.Equal(t, int64(5), run())
+}
+
+func TestByQueryRequest(t *testing.T) {
+	// 空查询会被拒绝，避免误删整个索引
+	_, err := encodeByQueryBody(nil, nil)
+	assert.Error(t, err)
+
+	query := map[string]interface{}{
+		"term": map[string]interface{}{"sender_id": "user-1"},
+	}
+	body, err := encodeByQueryBody(query, &UpdateScript{
+		Source: "ctx._source.content = params.placeholder",
+		Params: map[string]interface{}{"placeholder": ""},
+	})
+	require.NoError(t, err)
+
+	var payload map[string]interface{}
+	require.NoError(t, json.NewDecoder(body).Decode(&payload))
+	assert.Contains(t, payload, "query")
+	assert.Contains(t, payload, "script")
+
+	// 默认冲突策略为 proceed，且不修改调用方传入的选项
+	opts := &ByQueryOptions{RequestsPerSecond: 500}
+	normalized := normalizeByQueryOptions(opts)
+	assert.Equal(t, ConflictsProceed, normalized.Conflicts)
+	assert.Equal(t, 500, normalized.RequestsPerSecond)
+	assert.Empty(t, opts.Conflicts)
+	assert.Equal(t, ConflictsProceed, normalizeByQueryOptions(nil).Conflicts)
+
+	assert.Equal(t, "auto", slicesParam(-1))
+	assert.Nil(t, slicesParam(0))
+	assert.Nil(t, slicesParam(1))
+	assert.Equal(t, 4, slicesParam(4))
+
+	// 任务失败时错误信息包含 Elasticsearch 返回的逐条失败记录
+	status := &TaskStatus{
+		Error:    "search_phase_execution_exception: all shards failed",
+		Failures: []string{`{"index":"messages","cause":{"type":"mapper_parsing_exception"}}`},
+	}
+	assert.Equal(t, `search_phase_execution_exception: all shards failed; {"index":"messages","cause":{"type":"mapper_parsing_exception"}}`,
+		status.failureSummary())
+	assert.Equal(t, "a; b", (&TaskStatus{Failures: []string{"a", "b"}}).failureSummary())
+}
+
+// RoutedMessage 按会话路由的测试消息，实现 Routable 接口
+type RoutedMessage struct {
+	TestMessage
+}
+
+// GetRouting 实现 Routable 接口
+func (m RoutedMessage) GetRouting() string {
+	return m.SessionID
+}
+
+func TestBulkBodyRouting(t *testing.T) {
+	items := []RoutedMessage{
+		{TestMessage{ID: "msg-1", SessionID: "session-1", Content: "hello"}},
+		{TestMessage{ID: "msg-2", SessionID: "session-2", Content: "world"}},
+	}
+
+	body, err := encodeBulkBody("messages", items, nil)
+	require.NoError(t, err)
+
+	dec := json.NewDecoder(body)
+	var meta map[string]map[string]interface{}
+	var doc map[string]interface{}
+	require.NoError(t, dec.Decode(&meta))
+	assert.Equal(t, "messages", meta["index"]["_index"])
+	assert.Equal(t, "msg-1", meta["index"]["_id"])
+	assert.Equal(t, "session-1", meta["index"]["routing"])
+	require.NoError(t, dec.Decode(&doc))
+	assert.Equal(t, "hello", doc["content"])
+
+	// IndexOptions.Routing 优先于 Routable
+	override := func(doc Indexable) string { return "fixed" }
+	assert.Equal(t, "fixed", routingFor(items[1], override))
+	assert.Equal(t, "session-2", routingFor(items[1], nil))
+
+	// 未实现 Routable 的文档不带路由
+	body, err = encodeBulkBody("messages", []TestMessage{{ID: "msg-3"}}, nil)
+	require.NoError(t, err)
+	meta = nil
+	require.NoError(t, json.NewDecoder(body).Decode(&meta))
+	assert.NotContains(t, meta["index"], "routing")
+}
+
+func TestBuildAnalysisSettings(t *testing.T) {
+	_, err := BuildAnalysisSettings(&AnalyzerConfig{})
+	assert.Error(t, err)
+
+	settings, err := BuildAnalysisSettings(&AnalyzerConfig{
+		Name:       "im_search",
+		Filters:    []string{"lowercase"},
+		SynonymSet: "im-slang",
+		Stopwords:  []string{"的", "了"},
+	})
+	require.NoError(t, err)
+
+	analysis := settings["analysis"].(map[string]interface{})
+	analyzer := analysis["analyzer"].(map[string]interface{})["im_search"].(map[string]interface{})
+	assert.Equal(t, "standard", analyzer["tokenizer"])
+	// 停用词在同义词之前，避免同义词展开结果被停用词过滤
+	assert.Equal(t, []string{"lowercase", "im_search_stop", "im_search_synonyms"}, analyzer["filter"])
+
+	filters := analysis["filter"].(map[string]interface{})
+	synonyms := filters["im_search_synonyms"].(map[string]interface{})
+	assert.Equal(t, "im-slang", synonyms["synonyms_set"])
+	assert.Equal(t, true, synonyms["updateable"])
+
+	// 未配置同义词和停用词时不生成 filter
+	settings, err = BuildAnalysisSettings(&AnalyzerConfig{Name: "plain", Tokenizer: "ik_smart"})
+	require.NoError(t, err)
+	assert.NotContains(t, settings["analysis"], "filter")
+}
+
+func TestPercolatorRequest(t *testing.T) {
+	body, err := encodeSavedQuery(&SavedQuery{
+		ID:        "spam",
+		Keywords:  "加微信 返利",
+		MatchAll:  true,
+		SessionID: "session-1",
+		Metadata:  map[string]string{"level": "high"},
+	})
+	require.NoError(t, err)
+
+	var payload map[string]map[string]interface{}
+	require.NoError(t, json.NewDecoder(body).Decode(&payload))
+	boolQuery := payload["query"]["bool"].(map[string]interface{})
+	match := boolQuery["must"].([]interface{})[0].(map[string]interface{})["multi_match"].(map[string]interface{})
+	assert.Equal(t, "and", match["operator"])
+	assert.Equal(t, []interface{}{"content"}, match["fields"])
+	assert.Equal(t, "session-1", boolQuery["filter"].(map[string]interface{})["term"].(map[string]interface{})["session_id"])
+	assert.Equal(t, "high", payload["saved_query"]["metadata"].(map[string]interface{})["level"])
+
+	// 未限定会话时不带过滤条件
+	body, err = encodeSavedQuery(&SavedQuery{ID: "ad", Keywords: "广告"})
+	require.NoError(t, err)
+	payload = nil
+	require.NoError(t, json.NewDecoder(body).Decode(&payload))
+	assert.NotContains(t, payload["query"]["bool"], "filter")
+
+	body, err = encodePercolateBody(TestMessage{ID: "msg-1", Content: "加微信领返利"})
+	require.NoError(t, err)
+	var search map[string]interface{}
+	require.NoError(t, json.NewDecoder(body).Decode(&search))
+	percolate := search["query"].(map[string]interface{})["percolate"].(map[string]interface{})
+	assert.Equal(t, "query", percolate["field"])
+	assert.Equal(t, "加微信领返利", percolate["document"].(map[string]interface{})["content"])
+
+	mappings := buildPercolatorMappings([]string{"content", "title"})
+	properties := mappings["properties"].(map[string]interface{})
+	assert.Equal(t, "percolator", properties["query"].(map[string]interface{})["type"])
+	assert.Equal(t, "text", properties["title"].(map[string]interface{})["type"])
+	assert.Equal(t, "keyword", properties["session_id"].(map[string]interface{})["type"])
+}
+
 // 集成测试 - 需要运行 Elasticsearch 实例
 func TestProviderIntegration(t *testing.T) {
 	// 跳过集成测试，除非设置了环境变量
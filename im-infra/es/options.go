@@ -1,6 +1,7 @@
 package es
 
 import (
+	"github.com/ceyewan/gochat/im-infra/cache"
 	"github.com/ceyewan/gochat/im-infra/clog"
 	"github.com/ceyewan/gochat/im-infra/coord"
 )
@@ -9,8 +10,10 @@ import (
 type Option func(*providerOptions)
 
 type providerOptions struct {
-	logger clog.Logger
-	coord  coord.Provider
+	logger           clog.Logger
+	coord            coord.Provider
+	queryCache       cache.Provider
+	queryCacheConfig *QueryCacheConfig
 }
 
 // WithLogger 为 es provider 设置日志记录器
@@ -26,3 +29,12 @@ func WithCoordinator(coord coord.Provider) Option {
 		o.coord = coord
 	}
 }
+
+// WithQueryCache 为 es provider 启用搜索结果缓存，cfg 为 nil 时使用默认配置。
+// 只有设置了 SearchOptions.CacheClass 的搜索会使用缓存
+func WithQueryCache(c cache.Provider, cfg *QueryCacheConfig) Option {
+	return func(o *providerOptions) {
+		o.queryCache = c
+		o.queryCacheConfig = cfg
+	}
+}
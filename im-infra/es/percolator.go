@@ -0,0 +1,259 @@
+package es
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+)
+
+// 单次 MatchDocument 返回的最大命中数
+const maxSavedQueryMatches = 1000
+
+// SavedQuery 是一条保存在 percolator 索引中的监控查询，
+// 例如审核员希望在包含某些关键词的消息写入时立即收到告警。
+type SavedQuery struct {
+	// ID 查询 ID，必填，重复注册相同 ID 会覆盖原查询
+	ID string `json:"id"`
+	// Keywords 监控的关键词，按 Fields 的分析器分词后匹配
+	Keywords string `json:"keywords"`
+	// Fields 匹配的文档字段，默认 ["content"]
+	Fields []string `json:"fields,omitempty"`
+	// MatchAll 为 true 时要求所有关键词都出现，默认任意一个关键词出现即命中
+	MatchAll bool `json:"match_all,omitempty"`
+	// SessionID 只监控指定会话的消息，为空表示监控所有会话
+	SessionID string `json:"session_id,omitempty"`
+	// Metadata 随命中结果原样返回的附加信息，如告警级别、负责的审核员
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// SavedQueryMatch 是 MatchDocument 返回的一条命中
+type SavedQueryMatch struct {
+	// ID 命中的查询 ID
+	ID string
+	// Keywords 命中查询的关键词
+	Keywords string
+	// Metadata 注册查询时设置的附加信息
+	Metadata map[string]string
+}
+
+// RegisterSavedQuery 在 percolator 索引中注册或替换一条监控查询，返回时查询已可用于匹配。
+// 索引不存在时自动创建，文档字段按 q.Fields 映射为 text、session_id 映射为 keyword；
+// 同一索引中的查询应使用相同的字段集合，引用未映射字段的查询会被 Elasticsearch 拒绝。
+func (p *provider[T]) RegisterSavedQuery(ctx context.Context, index string, q *SavedQuery) error {
+	if q == nil || q.ID == "" {
+		return errors.New("已保存查询的 ID 不能为空")
+	}
+	if q.Keywords == "" {
+		return errors.New("已保存查询的关键词不能为空")
+	}
+
+	if err := p.ensureIndex(ctx, index, nil, buildPercolatorMappings(savedQueryFields(q))); err != nil {
+		return err
+	}
+
+	body, err := encodeSavedQuery(q)
+	if err != nil {
+		return err
+	}
+
+	res, err := p.client.Index(index, body,
+		p.client.Index.WithContext(ctx),
+		p.client.Index.WithDocumentID(q.ID),
+		p.client.Index.WithRefresh(RefreshWaitFor),
+	)
+	if err != nil {
+		p.logger.Error("注册已保存查询失败", clog.Err(err),
+			clog.String("index", index), clog.String("query_id", q.ID))
+		return err
+	}
+	if err := p.checkAnalysisResponse(res, "注册已保存查询", q.ID); err != nil {
+		return err
+	}
+
+	p.logger.Info("已保存查询已注册",
+		clog.String("index", index),
+		clog.String("query_id", q.ID),
+		clog.String("session_id", q.SessionID))
+	return nil
+}
+
+// DeleteSavedQuery 删除一条监控查询，查询不存在时不返回错误
+func (p *provider[T]) DeleteSavedQuery(ctx context.Context, index, id string) error {
+	res, err := p.client.Delete(index, id,
+		p.client.Delete.WithContext(ctx),
+		p.client.Delete.WithRefresh(RefreshWaitFor),
+	)
+	if err != nil {
+		p.logger.Error("删除已保存查询失败", clog.Err(err),
+			clog.String("index", index), clog.String("query_id", id))
+		return err
+	}
+	if res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		return nil
+	}
+	if err := p.checkAnalysisResponse(res, "删除已保存查询", id); err != nil {
+		return err
+	}
+
+	p.logger.Info("已保存查询已删除", clog.String("index", index), clog.String("query_id", id))
+	return nil
+}
+
+// MatchDocument 返回 doc 命中的监控查询，doc 不会被写入索引。
+// 在写入新消息时调用，可以在索引时刻触发审核告警，而不必周期性地重新搜索。
+func (p *provider[T]) MatchDocument(ctx context.Context, index string, doc T) ([]SavedQueryMatch, error) {
+	body, err := encodePercolateBody(doc)
+	if err != nil {
+		p.logger.Error("编码 percolate 查询失败", clog.Err(err))
+		return nil, err
+	}
+
+	res, err := p.client.Search(
+		p.client.Search.WithContext(ctx),
+		p.client.Search.WithIndex(index),
+		p.client.Search.WithBody(body),
+	)
+	if err != nil {
+		p.logger.Error("percolate 请求失败", clog.Err(err), clog.String("index", index))
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		p.logger.Error("percolate 响应错误",
+			clog.String("index", index),
+			clog.String("status", res.Status()))
+		return nil, errors.New(res.Status())
+	}
+
+	var r struct {
+		Hits struct {
+			Hits []struct {
+				ID     string `json:"_id"`
+				Source struct {
+					SavedQuery SavedQuery `json:"saved_query"`
+				} `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		p.logger.Error("解码 percolate 响应失败", clog.Err(err))
+		return nil, err
+	}
+
+	matches := make([]SavedQueryMatch, 0, len(r.Hits.Hits))
+	for _, hit := range r.Hits.Hits {
+		matches = append(matches, SavedQueryMatch{
+			ID:       hit.ID,
+			Keywords: hit.Source.SavedQuery.Keywords,
+			Metadata: hit.Source.SavedQuery.Metadata,
+		})
+	}
+
+	if len(matches) > 0 {
+		p.logger.Debug("文档命中已保存查询",
+			clog.String("index", index),
+			clog.String("doc_id", doc.GetID()),
+			clog.Int("matches", len(matches)))
+	}
+	return matches, nil
+}
+
+// savedQueryFields 返回查询匹配的字段，未设置时默认 content
+func savedQueryFields(q *SavedQuery) []string {
+	if len(q.Fields) == 0 {
+		return []string{"content"}
+	}
+	return q.Fields
+}
+
+// buildPercolatorMappings 构建 percolator 索引的 mappings。
+// saved_query 只用于原样返回，不建立索引。
+func buildPercolatorMappings(fields []string) map[string]interface{} {
+	properties := map[string]interface{}{
+		"query": map[string]interface{}{
+			"type": "percolator",
+		},
+		"saved_query": map[string]interface{}{
+			"type":    "object",
+			"enabled": false,
+		},
+		"session_id": map[string]interface{}{
+			"type": "keyword",
+		},
+	}
+	for _, field := range fields {
+		properties[field] = map[string]interface{}{
+			"type": "text",
+		}
+	}
+	return map[string]interface{}{
+		"properties": properties,
+	}
+}
+
+// encodeSavedQuery 构建 percolator 索引中已保存查询的文档
+func encodeSavedQuery(q *SavedQuery) (io.Reader, error) {
+	operator := "or"
+	if q.MatchAll {
+		operator = "and"
+	}
+
+	boolQuery := map[string]interface{}{
+		"must": []map[string]interface{}{
+			{
+				"multi_match": map[string]interface{}{
+					"query":    q.Keywords,
+					"fields":   savedQueryFields(q),
+					"operator": operator,
+				},
+			},
+		},
+	}
+	if q.SessionID != "" {
+		boolQuery["filter"] = map[string]interface{}{
+			"term": map[string]interface{}{
+				"session_id": q.SessionID,
+			},
+		}
+	}
+
+	payload := map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": boolQuery,
+		},
+		"saved_query": q,
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(payload); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
+
+// encodePercolateBody 构建匹配单个文档的 percolate 查询请求体
+func encodePercolateBody(doc Indexable) (io.Reader, error) {
+	payload := map[string]interface{}{
+		"query": map[string]interface{}{
+			"percolate": map[string]interface{}{
+				"field":    "query",
+				"document": doc,
+			},
+		},
+		"_source": []string{"saved_query"},
+		"size":    maxSavedQueryMatches,
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(payload); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
@@ -1,6 +1,9 @@
 package es
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 // Indexable 定义了可被索引对象必须满足的契约
 type Indexable interface {
@@ -10,8 +13,9 @@ type Indexable interface {
 
 // SearchResult 代表搜索返回的泛型结果
 type SearchResult[T Indexable] struct {
-	Total int64 // 搜索结果总数
-	Items []*T  // 搜索结果项
+	Total  int64 // 搜索结果总数
+	Items  []*T  // 搜索结果项
+	Shards int   // 本次搜索查询的分片数，按路由搜索时通常为 1
 }
 
 // Provider 是 es 组件暴露的核心接口
@@ -22,6 +26,10 @@ type Provider[T Indexable] interface {
 	// items: 要索引的文档列表
 	BulkIndex(ctx context.Context, index string, items []T) error
 
+	// BulkIndexWithOptions 按选项批量索引文档，支持逐文档路由、同步刷新和按需创建索引
+	// opts: 为 nil 时等同于 BulkIndex
+	BulkIndexWithOptions(ctx context.Context, index string, items []T, opts *IndexOptions) error
+
 	// SearchGlobal 在所有文档中进行全局文本搜索
 	// index: 要搜索的索引名称
 	// keyword: 搜索关键词
@@ -37,6 +45,63 @@ type Provider[T Indexable] interface {
 	// size: 每页大小
 	SearchInSession(ctx context.Context, index, sessionID, keyword string, page, size int) (*SearchResult[T], error)
 
+	// SearchWithOptions 按选项进行文本搜索，支持会话过滤、分片路由和副本偏好
+	// 文档按 session_id 路由写入时，设置 Routing 为会话 ID 可以只查询一个分片
+	SearchWithOptions(ctx context.Context, index, keyword string, page, size int, opts *SearchOptions) (*SearchResult[T], error)
+
+	// DeleteByQuery 以限流的后台任务删除匹配 query 的文档，返回任务 ID
+	// 适用于 GDPR 删除用户历史消息等大批量删除场景
+	// query: Elasticsearch 查询 DSL 中 "query" 字段的内容
+	// opts: 限流、切片和冲突处理选项，可以为 nil
+	DeleteByQuery(ctx context.Context, index string, query map[string]interface{}, opts *ByQueryOptions) (string, error)
+
+	// UpdateByQuery 以限流的后台任务对匹配 query 的文档执行脚本，返回任务 ID
+	// script: 更新脚本，为 nil 时仅重新索引匹配的文档
+	UpdateByQuery(ctx context.Context, index string, query map[string]interface{}, script *UpdateScript, opts *ByQueryOptions) (string, error)
+
+	// GetTask 查询后台任务的进度
+	GetTask(ctx context.Context, taskID string) (*TaskStatus, error)
+
+	// WaitForTask 轮询直到后台任务结束或 ctx 被取消
+	WaitForTask(ctx context.Context, taskID string, interval time.Duration) (*TaskStatus, error)
+
+	// CancelTask 取消正在执行的后台任务
+	CancelTask(ctx context.Context, taskID string) error
+
+	// PutSynonymSet 创建或整体替换同义词集合，引用该集合的搜索分析器会自动重新加载
+	// 用于运行时调整网络用语、缩写等同义词，无需重建索引
+	PutSynonymSet(ctx context.Context, setID string, rules []SynonymRule) error
+
+	// PutSynonymRule 创建或替换同义词集合中的单条规则
+	PutSynonymRule(ctx context.Context, setID string, rule SynonymRule) error
+
+	// GetSynonymSet 读取同义词集合中的全部规则
+	GetSynonymSet(ctx context.Context, setID string) ([]SynonymRule, error)
+
+	// DeleteSynonymSet 删除同义词集合
+	DeleteSynonymSet(ctx context.Context, setID string) error
+
+	// UpdateAnalyzer 在已有索引上创建或替换挂载同义词集合和停用词的自定义分析器
+	// 修改 analysis 设置需要短暂关闭索引，期间读写请求会失败
+	UpdateAnalyzer(ctx context.Context, index string, cfg *AnalyzerConfig) error
+
+	// ReloadSearchAnalyzers 重新加载索引的搜索分析器，无需重建索引
+	ReloadSearchAnalyzers(ctx context.Context, index string) error
+
+	// InvalidateSearchCache 立即使索引的搜索结果缓存失效，未启用 WithQueryCache 时不做任何事
+	// 本 provider 的写入会自动使缓存失效，只有通过其他途径修改索引时才需要调用
+	InvalidateSearchCache(ctx context.Context, index string) error
+
+	// RegisterSavedQuery 在 percolator 索引中注册或替换一条监控查询，索引不存在时自动创建
+	// index: percolator 索引名称，应与消息索引分开
+	RegisterSavedQuery(ctx context.Context, index string, q *SavedQuery) error
+
+	// DeleteSavedQuery 删除一条监控查询
+	DeleteSavedQuery(ctx context.Context, index, id string) error
+
+	// MatchDocument 返回文档命中的监控查询，用于在消息写入时触发内容审核告警
+	MatchDocument(ctx context.Context, index string, doc T) ([]SavedQueryMatch, error)
+
 	// Close 关闭客户端连接，释放资源
 	Close() error
 }
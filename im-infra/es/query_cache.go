@@ -0,0 +1,270 @@
+package es
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/cache"
+	"github.com/ceyewan/gochat/im-infra/clog"
+)
+
+// QueryCacheConfig 是搜索结果缓存的配置。
+//
+// 每个索引在缓存中维护一个代际（generation），即“该时刻之后的写入都已对搜索可见”的时间戳。
+// 写入前代际被推进到 写入时间 + 可见窗口，窗口未过期时该索引的搜索绕过缓存；
+// 缓存键包含代际，因此写入后旧结果不会再被命中，结果不会跨越一次可见的索引刷新。
+type QueryCacheConfig struct {
+	// TTL 缓存结果的默认保留时间，默认 1 分钟
+	TTL time.Duration
+	// Classes 启用缓存的查询类别及其 TTL（0 表示使用 TTL），为空表示所有类别都启用。
+	// 类别通过 SearchOptions.CacheClass 指定，如 "hot_keyword"、"admin_dashboard"
+	Classes map[string]time.Duration
+	// Indexes 启用缓存的索引，为空表示所有索引都启用
+	Indexes []string
+	// SettleWindow 写入请求发出后到文档对搜索可见的最长时间，窗口内该索引的搜索绕过缓存。
+	// 默认为批量索引器的 FlushInterval 加 1 秒（Elasticsearch 默认的 refresh_interval）
+	SettleWindow time.Duration
+	// TaskWindow DeleteByQuery/UpdateByQuery 提交后绕过缓存的时长，应覆盖任务的执行时间，默认 10 分钟
+	TaskWindow time.Duration
+	// KeyPrefix 缓存键前缀，默认 "es:qc:"
+	KeyPrefix string
+}
+
+// normalizeQueryCacheConfig 为未设置的字段填充默认值
+func normalizeQueryCacheConfig(cfg *QueryCacheConfig, flushInterval time.Duration) *QueryCacheConfig {
+	normalized := QueryCacheConfig{}
+	if cfg != nil {
+		normalized = *cfg
+	}
+	if normalized.TTL <= 0 {
+		normalized.TTL = time.Minute
+	}
+	if normalized.SettleWindow <= 0 {
+		normalized.SettleWindow = flushInterval + time.Second
+	}
+	if normalized.TaskWindow <= 0 {
+		normalized.TaskWindow = 10 * time.Minute
+	}
+	if normalized.KeyPrefix == "" {
+		normalized.KeyPrefix = "es:qc:"
+	}
+	return &normalized
+}
+
+// generationScript 将索引代际推进到 ARGV[1] 并返回推进后的代际，只增不减，避免并发写入缩短可见窗口。
+// ARGV[1] 为 0 时只读取代际。读写都经过脚本，脚本操作不叠加 cache.Config.KeyPrefix，
+// 与 String() 混用会使读写落在不同的键上
+const generationScript = `
+local current = tonumber(redis.call('GET', KEYS[1]) or '0')
+local target = tonumber(ARGV[1])
+if target > current then
+	redis.call('SET', KEYS[1], ARGV[1])
+	return target
+end
+return current
+`
+
+// queryCache 基于 cache.Provider 的搜索结果缓存
+type queryCache struct {
+	cache   cache.Provider
+	config  *QueryCacheConfig
+	indexes map[string]bool
+	logger  clog.Logger
+
+	mu        sync.Mutex
+	scriptSHA string
+}
+
+// newQueryCache 创建搜索结果缓存
+func newQueryCache(c cache.Provider, cfg *QueryCacheConfig, flushInterval time.Duration, logger clog.Logger) *queryCache {
+	cfg = normalizeQueryCacheConfig(cfg, flushInterval)
+	qc := &queryCache{
+		cache:  c,
+		config: cfg,
+		logger: logger,
+	}
+	if len(cfg.Indexes) > 0 {
+		qc.indexes = make(map[string]bool, len(cfg.Indexes))
+		for _, index := range cfg.Indexes {
+			qc.indexes[index] = true
+		}
+	}
+	return qc
+}
+
+// ttlFor 返回索引和查询类别的缓存时间，未启用缓存时返回 false
+func (c *queryCache) ttlFor(index, class string) (time.Duration, bool) {
+	if c == nil || class == "" {
+		return 0, false
+	}
+	if c.indexes != nil && !c.indexes[index] {
+		return 0, false
+	}
+	if len(c.config.Classes) == 0 {
+		return c.config.TTL, true
+	}
+	ttl, ok := c.config.Classes[class]
+	if !ok {
+		return 0, false
+	}
+	if ttl <= 0 {
+		ttl = c.config.TTL
+	}
+	return ttl, true
+}
+
+// generationKey 返回索引代际的缓存键
+func (c *queryCache) generationKey(index string) string {
+	return c.config.KeyPrefix + "gen:" + index
+}
+
+// resultKey 返回搜索结果的缓存键，代际和查询参数都是键的一部分
+func (c *queryCache) resultKey(index string, generation int64, class, keyword string, page, size int, opts *SearchOptions) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%d\x00%d", keyword, opts.SessionID, opts.Routing, page, size)
+	return fmt.Sprintf("%sr:%s:%d:%s:%s", c.config.KeyPrefix, index, generation, class, hex.EncodeToString(h.Sum(nil)))
+}
+
+// generation 读取索引代际，从未写入过的索引代际为 0
+func (c *queryCache) generation(ctx context.Context, index string) (int64, error) {
+	return c.evalGeneration(ctx, index, 0)
+}
+
+// advance 在写入前把索引代际推进到 now + window，失败只记录日志，不影响写入。
+// 推进失败时旧结果最多在 TTL 内继续被命中。
+func (c *queryCache) advance(ctx context.Context, index string, window time.Duration) {
+	if c == nil {
+		return
+	}
+	if err := c.advanceGeneration(ctx, index, time.Now().Add(window).UnixMilli()); err != nil {
+		c.logger.Warn("推进搜索缓存代际失败，旧结果可能在 TTL 内继续命中",
+			clog.String("index", index),
+			clog.Err(err))
+	}
+}
+
+// advanceGeneration 原子地将索引代际推进到 generation
+func (c *queryCache) advanceGeneration(ctx context.Context, index string, generation int64) error {
+	_, err := c.evalGeneration(ctx, index, generation)
+	return err
+}
+
+// evalGeneration 执行代际脚本，返回推进后的代际
+func (c *queryCache) evalGeneration(ctx context.Context, index string, generation int64) (int64, error) {
+	sha, err := c.loadScript(ctx)
+	if err != nil {
+		return 0, err
+	}
+	keys := []string{c.generationKey(index)}
+	result, err := c.cache.Script().EvalSha(ctx, sha, keys, generation)
+	if err != nil && strings.Contains(err.Error(), "NOSCRIPT") {
+		// Redis 重启或执行了 SCRIPT FLUSH，重新加载后重试
+		c.mu.Lock()
+		c.scriptSHA = ""
+		c.mu.Unlock()
+		if sha, err = c.loadScript(ctx); err != nil {
+			return 0, err
+		}
+		result, err = c.cache.Script().EvalSha(ctx, sha, keys, generation)
+	}
+	if err != nil {
+		return 0, err
+	}
+	value, ok := result.(int64)
+	if !ok {
+		return 0, fmt.Errorf("unexpected generation script result: %v", result)
+	}
+	return value, nil
+}
+
+// loadScript 加载代际推进脚本并缓存其 SHA
+func (c *queryCache) loadScript(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.scriptSHA != "" {
+		return c.scriptSHA, nil
+	}
+	sha, err := c.cache.Script().ScriptLoad(ctx, generationScript)
+	if err != nil {
+		return "", fmt.Errorf("加载搜索缓存代际脚本失败: %w", err)
+	}
+	c.scriptSHA = sha
+	return sha, nil
+}
+
+// cachedSearch 按查询类别使用缓存执行搜索：
+// 索引仍处于写入后的可见窗口内时直接查询且不写缓存，否则以当前代际查找缓存，未命中时查询并写入缓存。
+// 缓存出错时退化为直接查询。
+func cachedSearch[T Indexable](ctx context.Context, c *queryCache, index, keyword string, page, size int, opts *SearchOptions,
+	search func() (*SearchResult[T], error)) (*SearchResult[T], error) {
+	ttl, ok := c.ttlFor(index, opts.CacheClass)
+	if !ok {
+		return search()
+	}
+
+	generation, err := c.generation(ctx, index)
+	if err != nil {
+		c.logger.Warn("读取搜索缓存代际失败，直接查询", clog.String("index", index), clog.Err(err))
+		return search()
+	}
+	if generation > time.Now().UnixMilli() {
+		c.logger.Debug("索引写入尚未稳定，绕过搜索缓存",
+			clog.String("index", index),
+			clog.String("class", opts.CacheClass))
+		return search()
+	}
+
+	key := c.resultKey(index, generation, opts.CacheClass, keyword, page, size, opts)
+	if data, err := c.cache.String().Get(ctx, key); err == nil {
+		var result SearchResult[T]
+		if err := json.Unmarshal([]byte(data), &result); err == nil {
+			return &result, nil
+		}
+		c.logger.Warn("解码缓存的搜索结果失败", clog.String("key", key), clog.Err(err))
+	} else if !errors.Is(err, cache.ErrCacheMiss) {
+		c.logger.Warn("读取搜索缓存失败", clog.String("key", key), clog.Err(err))
+	}
+
+	result, err := search()
+	if err != nil {
+		return nil, err
+	}
+	if data, err := json.Marshal(result); err != nil {
+		c.logger.Warn("编码搜索结果失败", clog.Err(err))
+	} else if err := c.cache.String().Set(ctx, key, data, ttl); err != nil {
+		c.logger.Warn("写入搜索缓存失败", clog.String("key", key), clog.Err(err))
+	}
+	return result, nil
+}
+
+// InvalidateSearchCache 立即使索引的全部缓存结果失效。
+// 通过其他途径（如别名、其他服务或直接调用 Elasticsearch API）修改索引后应调用该方法
+func (p *provider[T]) InvalidateSearchCache(ctx context.Context, index string) error {
+	if p.queryCache == nil {
+		return nil
+	}
+	return p.queryCache.advanceGeneration(ctx, index, time.Now().UnixMilli())
+}
+
+// settleWindow 返回普通写入的可见窗口，对 nil 安全
+func (c *queryCache) settleWindow() time.Duration {
+	if c == nil {
+		return 0
+	}
+	return c.config.SettleWindow
+}
+
+// taskWindow 返回 by-query 任务的可见窗口，对 nil 安全
+func (c *queryCache) taskWindow() time.Duration {
+	if c == nil {
+		return 0
+	}
+	return c.config.TaskWindow
+}
@@ -0,0 +1,277 @@
+package es
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"github.com/elastic/go-elasticsearch/v8/esutil"
+)
+
+// 索引刷新策略
+const (
+	// RefreshFalse 不主动刷新，文档在下一次周期刷新后可见（默认）
+	RefreshFalse = "false"
+	// RefreshTrue 写入后立即刷新相关分片，开销较大
+	RefreshTrue = "true"
+	// RefreshWaitFor 等待下一次周期刷新后再返回，适合测试中写入后立即搜索
+	RefreshWaitFor = "wait_for"
+)
+
+// Routable 是可选接口，文档实现后 BulkIndex 会按 GetRouting 的返回值路由到分片。
+// 例如按 session_id 路由，同一会话的消息落在同一分片，会话内搜索只需查询一个分片。
+// 注意：按路由写入的文档，读取和按 ID 删除时也必须携带相同的路由值。
+type Routable interface {
+	GetRouting() string
+}
+
+// IndexOptions 控制单次 BulkIndexWithOptions 的行为
+type IndexOptions struct {
+	// Routing 返回文档的路由值，优先级高于 Routable，返回空字符串表示不路由
+	Routing func(doc Indexable) string
+	// Refresh 刷新策略：RefreshFalse、RefreshTrue 或 RefreshWaitFor。
+	// 非空时直接同步发送 _bulk 请求（不经过后台批量索引器），返回时文档已按策略可见，且返回逐条写入错误
+	Refresh string
+	// Settings 索引不存在时用于创建索引的 settings，如分片数、副本数、refresh_interval
+	Settings map[string]interface{}
+	// Mappings 索引不存在时用于创建索引的 mappings
+	Mappings map[string]interface{}
+}
+
+// SearchOptions 控制 SearchWithOptions 的行为
+type SearchOptions struct {
+	// SessionID 只搜索指定会话的消息，为空表示全局搜索
+	SessionID string
+	// Routing 只查询路由值对应的分片，必须与写入时使用的路由值一致
+	Routing string
+	// Preference 分片副本选择偏好，如 "_local" 或固定的用户 ID，使同一用户的分页结果稳定
+	Preference string
+	// CacheClass 查询类别，非空时按类别使用搜索结果缓存（需通过 WithQueryCache 启用），
+	// 如热门关键词 "hot_keyword"、管理后台 "admin_dashboard"
+	CacheClass string
+}
+
+// BulkIndexWithOptions 按 opts 批量索引文档，opts 为 nil 时等同于 BulkIndex
+func (p *provider[T]) BulkIndexWithOptions(ctx context.Context, index string, items []T, opts *IndexOptions) error {
+	if opts == nil {
+		opts = &IndexOptions{}
+	}
+
+	if opts.Settings != nil || opts.Mappings != nil {
+		if err := p.ensureIndex(ctx, index, opts.Settings, opts.Mappings); err != nil {
+			return err
+		}
+	}
+
+	// 写入前推进缓存代际，文档可见前该索引的搜索绕过缓存
+	p.queryCache.advance(ctx, index, p.queryCache.settleWindow())
+
+	if opts.Refresh != "" {
+		return p.bulkIndexSync(ctx, index, items, opts)
+	}
+
+	for _, item := range items {
+		payload, err := json.Marshal(item)
+		if err != nil {
+			p.logger.Error("批量索引时序列化文档失败",
+				clog.Err(err),
+				clog.String("item_id", item.GetID()))
+			continue
+		}
+
+		err = p.bulkIndexer.Add(
+			ctx,
+			esutil.BulkIndexerItem{
+				Index:      index,
+				Action:     "index",
+				DocumentID: item.GetID(),
+				Routing:    routingFor(item, opts.Routing),
+				Body:       bytes.NewReader(payload),
+			},
+		)
+		if err != nil {
+			p.logger.Error("添加文档到批量索引器失败",
+				clog.Err(err),
+				clog.String("item_id", item.GetID()))
+			return err
+		}
+	}
+	return nil
+}
+
+// SearchWithOptions 按 opts 进行文本搜索，支持会话过滤、分片路由和副本偏好
+func (p *provider[T]) SearchWithOptions(ctx context.Context, index, keyword string, page, size int, opts *SearchOptions) (*SearchResult[T], error) {
+	if opts == nil {
+		opts = &SearchOptions{}
+	}
+	return p.search(ctx, index, keyword, page, size, opts)
+}
+
+// bulkIndexSync 同步发送一次 _bulk 请求，并检查每条文档的写入结果
+func (p *provider[T]) bulkIndexSync(ctx context.Context, index string, items []T, opts *IndexOptions) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	body, err := encodeBulkBody(index, items, opts.Routing)
+	if err != nil {
+		p.logger.Error("编码 bulk 请求失败", clog.Err(err), clog.String("index", index))
+		return err
+	}
+
+	res, err := p.client.Bulk(body,
+		p.client.Bulk.WithContext(ctx),
+		p.client.Bulk.WithRefresh(opts.Refresh),
+	)
+	if err != nil {
+		p.logger.Error("bulk 请求失败", clog.Err(err), clog.String("index", index))
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		p.logger.Error("bulk 响应错误", clog.String("index", index), clog.String("status", res.Status()))
+		return errors.New(res.Status())
+	}
+
+	var r struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			ID     string `json:"_id"`
+			Status int    `json:"status"`
+			Error  *struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		p.logger.Error("解码 bulk 响应失败", clog.Err(err))
+		return err
+	}
+	if !r.Errors {
+		return nil
+	}
+
+	failed := 0
+	var first string
+	for _, item := range r.Items {
+		for _, result := range item {
+			if result.Error == nil {
+				continue
+			}
+			failed++
+			if first == "" {
+				first = fmt.Sprintf("%s: %s: %s", result.ID, result.Error.Type, result.Error.Reason)
+			}
+		}
+	}
+	p.logger.Error("bulk 部分文档写入失败",
+		clog.String("index", index),
+		clog.Int("failed", failed),
+		clog.Int("total", len(items)),
+		clog.String("first_error", first))
+	return fmt.Errorf("bulk index %s: %d of %d documents failed, first error: %s", index, failed, len(items), first)
+}
+
+// ensureIndex 在索引不存在时使用给定的 settings 和 mappings 创建索引，已存在的索引不做修改
+func (p *provider[T]) ensureIndex(ctx context.Context, index string, settings, mappings map[string]interface{}) error {
+	if _, ok := p.ensuredIndexes.Load(index); ok {
+		return nil
+	}
+
+	res, err := p.client.Indices.Exists([]string{index}, p.client.Indices.Exists.WithContext(ctx))
+	if err != nil {
+		p.logger.Error("检查索引是否存在失败", clog.Err(err), clog.String("index", index))
+		return err
+	}
+	res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		body := map[string]interface{}{}
+		if settings != nil {
+			body["settings"] = settings
+		}
+		if mappings != nil {
+			body["mappings"] = mappings
+		}
+		var buf bytes.Buffer
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return err
+		}
+
+		res, err := p.client.Indices.Create(index,
+			p.client.Indices.Create.WithContext(ctx),
+			p.client.Indices.Create.WithBody(&buf),
+		)
+		if err != nil {
+			p.logger.Error("创建索引失败", clog.Err(err), clog.String("index", index))
+			return err
+		}
+		defer res.Body.Close()
+
+		// 并发创建时其他实例可能已创建成功
+		if res.IsError() && !isResourceAlreadyExists(res) {
+			p.logger.Error("创建索引响应错误", clog.String("index", index), clog.String("status", res.Status()))
+			return errors.New(res.Status())
+		}
+		p.logger.Info("索引已创建", clog.String("index", index))
+	} else if res.IsError() {
+		p.logger.Error("检查索引响应错误", clog.String("index", index), clog.String("status", res.Status()))
+		return errors.New(res.Status())
+	}
+
+	p.ensuredIndexes.Store(index, struct{}{})
+	return nil
+}
+
+// isResourceAlreadyExists 判断创建索引失败是否因为索引已存在
+func isResourceAlreadyExists(res *esapi.Response) bool {
+	var r struct {
+		Error struct {
+			Type string `json:"type"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return false
+	}
+	return r.Error.Type == "resource_already_exists_exception"
+}
+
+// routingFor 返回文档的路由值：IndexOptions.Routing > Routable > 不路由
+func routingFor(doc Indexable, routing func(Indexable) string) string {
+	if routing != nil {
+		return routing(doc)
+	}
+	if r, ok := doc.(Routable); ok {
+		return r.GetRouting()
+	}
+	return ""
+}
+
+// encodeBulkBody 构建 _bulk 请求的 NDJSON 请求体
+func encodeBulkBody[T Indexable](index string, items []T, routing func(Indexable) string) (*bytes.Buffer, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, item := range items {
+		meta := map[string]interface{}{
+			"_index": index,
+			"_id":    item.GetID(),
+		}
+		if r := routingFor(item, routing); r != "" {
+			meta["routing"] = r
+		}
+		if err := enc.Encode(map[string]interface{}{"index": meta}); err != nil {
+			return nil, err
+		}
+		if err := enc.Encode(item); err != nil {
+			return nil, fmt.Errorf("encode document %s: %w", item.GetID(), err)
+		}
+	}
+	return &buf, nil
+}
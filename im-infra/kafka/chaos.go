@@ -0,0 +1,204 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+)
+
+// faultInjector 按 ChaosConfig 中的概率注入故障，未开启时为 nil，所有方法对 nil 安全
+type faultInjector struct {
+	config *ChaosConfig
+	topics map[string]bool
+	logger clog.Logger
+
+	mu   sync.Mutex
+	rand *rand.Rand
+
+	// 注入次数统计
+	latencies  atomic.Int64
+	errors     atomic.Int64
+	duplicates atomic.Int64
+	rebalances atomic.Int64
+}
+
+// chaosAllowedEnvs 允许开启故障注入的环境（APP_ENV），未设置或不在列表中的环境一律视为生产环境
+var chaosAllowedEnvs = map[string]bool{
+	"dev":         true,
+	"development": true,
+	"test":        true,
+	"staging":     true,
+}
+
+// isChaosAllowedEnv 判断当前环境是否显式声明为非生产环境，与其他组件一致使用 APP_ENV
+func isChaosAllowedEnv() bool {
+	return chaosAllowedEnvs[os.Getenv("APP_ENV")]
+}
+
+// validateChaosConfig 验证故障注入配置，仅允许在显式声明的非生产环境中开启
+func validateChaosConfig(cfg *ChaosConfig) error {
+	if cfg == nil || !cfg.Enabled {
+		return nil
+	}
+	if !isChaosAllowedEnv() {
+		return ErrInvalidConfig(fmt.Sprintf("故障注入只能在 APP_ENV 为 dev、development、test 或 staging 时开启，当前为 %q", os.Getenv("APP_ENV")))
+	}
+
+	probabilities := map[string]float64{
+		"sendLatencyProbability": cfg.SendLatencyProbability,
+		"sendErrorProbability":   cfg.SendErrorProbability,
+		"duplicateProbability":   cfg.DuplicateProbability,
+		"rebalanceProbability":   cfg.RebalanceProbability,
+	}
+	for name, p := range probabilities {
+		if p < 0 || p > 1 {
+			return ErrInvalidConfig(fmt.Sprintf("故障注入概率 %s 必须在 [0, 1] 范围内", name))
+		}
+	}
+	if cfg.SendLatencyMs < 0 {
+		return ErrInvalidConfig("注入的发送延迟不能为负数")
+	}
+	if cfg.SendLatencyProbability > 0 && cfg.SendLatencyMs == 0 {
+		return ErrInvalidConfig("开启延迟注入时必须设置 sendLatencyMs")
+	}
+	return nil
+}
+
+// newFaultInjector 创建故障注入器，未开启时返回 nil
+func newFaultInjector(cfg *ChaosConfig, logger clog.Logger) (*faultInjector, error) {
+	if cfg == nil || !cfg.Enabled {
+		return nil, nil
+	}
+	if err := validateChaosConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	f := &faultInjector{
+		config: cfg,
+		logger: logger,
+		rand:   rand.New(rand.NewSource(seed)),
+	}
+	if len(cfg.Topics) > 0 {
+		f.topics = make(map[string]bool, len(cfg.Topics))
+		for _, topic := range cfg.Topics {
+			f.topics[topic] = true
+		}
+	}
+
+	logger.Warn("故障注入已开启，仅用于测试环境",
+		clog.Float64("send_latency_probability", cfg.SendLatencyProbability),
+		clog.Int("send_latency_ms", cfg.SendLatencyMs),
+		clog.Float64("send_error_probability", cfg.SendErrorProbability),
+		clog.Float64("duplicate_probability", cfg.DuplicateProbability),
+		clog.Float64("rebalance_probability", cfg.RebalanceProbability),
+		clog.Strings("topics", cfg.Topics),
+	)
+	return f, nil
+}
+
+// roll 以概率 p 返回 true
+func (f *faultInjector) roll(p float64) bool {
+	if p <= 0 {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rand.Float64() < p
+}
+
+// targets 判断主题是否在注入范围内
+func (f *faultInjector) targets(topic string) bool {
+	return f.topics == nil || f.topics[topic]
+}
+
+// sendLatency 返回本次发送需要注入的延迟，不注入时返回 0
+func (f *faultInjector) sendLatency(topic string) time.Duration {
+	if f == nil || !f.targets(topic) || !f.roll(f.config.SendLatencyProbability) {
+		return 0
+	}
+	f.latencies.Add(1)
+	delay := time.Duration(f.config.SendLatencyMs) * time.Millisecond
+	f.logger.Debug("注入发送延迟", clog.String("topic", topic), clog.Duration("delay", delay))
+	return delay
+}
+
+// sendError 返回本次发送需要注入的错误，不注入时返回 nil
+func (f *faultInjector) sendError(topic string) error {
+	if f == nil || !f.targets(topic) || !f.roll(f.config.SendErrorProbability) {
+		return nil
+	}
+	f.errors.Add(1)
+	f.logger.Debug("注入发送错误", clog.String("topic", topic))
+	return ErrChaos(fmt.Sprintf("注入的发送失败: %s", topic))
+}
+
+// beforeSend 在同步发送前注入延迟和错误，等待期间 ctx 结束时返回 ctx 的错误
+func (f *faultInjector) beforeSend(ctx context.Context, topic string) error {
+	if delay := f.sendLatency(topic); delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return f.sendError(topic)
+}
+
+// delayCallback 按概率推迟异步发送的结果回调，模拟 broker 响应缓慢
+func (f *faultInjector) delayCallback(topic string, callback func(error)) func(error) {
+	if callback == nil {
+		return nil
+	}
+	delay := f.sendLatency(topic)
+	if delay <= 0 {
+		return callback
+	}
+	return func(err error) {
+		time.Sleep(delay)
+		callback(err)
+	}
+}
+
+// duplicate 判断是否将刚处理过的消息再次投递给回调
+func (f *faultInjector) duplicate(topic string) bool {
+	if f == nil || !f.targets(topic) || !f.roll(f.config.DuplicateProbability) {
+		return false
+	}
+	f.duplicates.Add(1)
+	f.logger.Debug("注入重复投递", clog.String("topic", topic))
+	return true
+}
+
+// rebalance 判断处理完一批消息后是否主动触发重平衡
+func (f *faultInjector) rebalance() bool {
+	if f == nil || !f.roll(f.config.RebalanceProbability) {
+		return false
+	}
+	f.rebalances.Add(1)
+	f.logger.Debug("注入消费者组重平衡")
+	return true
+}
+
+// addMetrics 将注入次数写入指标，未开启时不写入
+func (f *faultInjector) addMetrics(metrics map[string]interface{}) {
+	if f == nil {
+		return
+	}
+	metrics["chaos_send_latencies"] = f.latencies.Load()
+	metrics["chaos_send_errors"] = f.errors.Load()
+	metrics["chaos_duplicates"] = f.duplicates.Load()
+	metrics["chaos_rebalances"] = f.rebalances.Load()
+}
@@ -0,0 +1,317 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/google/uuid"
+)
+
+// claim-check 使用的消息头
+const (
+	// HeaderClaimCheck 载荷已卸载到 BlobStore 时写入，值为对象的键，此时消息体为空
+	HeaderClaimCheck = "X-Claim-Check"
+	// HeaderClaimCheckSize 卸载前载荷的字节数，消费者取回后据此校验
+	HeaderClaimCheckSize = "X-Claim-Check-Size"
+)
+
+// claim-check 的默认配置
+const (
+	defaultClaimCheckKeyPrefix       = "kafka-claim-check/"
+	defaultClaimCheckCleanupInterval = 10 * time.Minute
+)
+
+// BlobStore 存放被卸载的大消息载荷，通常由 S3、MinIO 等对象存储实现。
+// 生产者和所有消费者必须访问同一个存储。
+type BlobStore interface {
+	// Put 写入对象，键已存在时覆盖
+	Put(ctx context.Context, key string, data []byte) error
+	// Get 读取对象
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Delete 删除对象，对象不存在时不返回错误
+	Delete(ctx context.Context, key string) error
+	// List 返回 prefix 下创建时间早于 before 的对象键，用于清理过期的载荷
+	List(ctx context.Context, prefix string, before time.Time) ([]string, error)
+}
+
+// claimCheck 在生产者侧卸载超过阈值的载荷，在消费者侧取回并内联。
+// 未开启时为 nil，所有方法对 nil 安全。
+type claimCheck struct {
+	// config 生产者侧配置，消费者侧为 nil
+	config *ClaimCheckConfig
+	store  BlobStore
+	logger clog.Logger
+
+	offloaded      atomic.Int64
+	offloadedBytes atomic.Int64
+	inlined        atomic.Int64
+	cleaned        atomic.Int64
+	errors         atomic.Int64
+
+	cleanupCancel context.CancelFunc
+	cleanupWG     sync.WaitGroup
+}
+
+// newProducerClaimCheck 创建生产者侧的 claim-check，未配置时返回 nil
+func newProducerClaimCheck(cfg *ClaimCheckConfig, store BlobStore, logger clog.Logger) (*claimCheck, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	if store == nil {
+		return nil, ErrInvalidConfig("开启 ClaimCheck 时必须通过 WithBlobStore 设置 BlobStore")
+	}
+	return &claimCheck{config: cfg, store: store, logger: logger}, nil
+}
+
+// newConsumerClaimCheck 创建消费者侧的 claim-check，未设置 BlobStore 时返回 nil
+func newConsumerClaimCheck(store BlobStore, logger clog.Logger) *claimCheck {
+	if store == nil {
+		return nil
+	}
+	return &claimCheck{store: store, logger: logger}
+}
+
+// offload 载荷超过阈值时上传到 BlobStore，返回实际发送的消息体和对象键；未卸载时返回原载荷和空键。
+// 对象键和原始大小写入 msg.Headers，调用方需在转换消息头之前调用。
+func (c *claimCheck) offload(ctx context.Context, msg *Message) ([]byte, string, error) {
+	if c == nil || c.config == nil || len(msg.Value) <= c.config.ThresholdBytes {
+		return msg.Value, "", nil
+	}
+
+	key := c.keyPrefix() + msg.Topic + "/" + uuid.NewString()
+	if err := c.store.Put(ctx, key, msg.Value); err != nil {
+		c.errors.Add(1)
+		return nil, "", ErrProducer("上传消息载荷失败", err)
+	}
+
+	msg.Headers[HeaderClaimCheck] = []byte(key)
+	msg.Headers[HeaderClaimCheckSize] = []byte(strconv.Itoa(len(msg.Value)))
+	c.offloaded.Add(1)
+	c.offloadedBytes.Add(int64(len(msg.Value)))
+	return []byte{}, key, nil
+}
+
+// release 发送失败后删除已上传的对象，删除失败时留给后台清理
+func (c *claimCheck) release(topic, key string) {
+	if c == nil || key == "" {
+		return
+	}
+	// 发送失败时调用方的 ctx 可能已取消，删除仍需完成
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.store.Delete(ctx, key); err != nil {
+		c.errors.Add(1)
+		c.logger.Warn("删除未发送消息的载荷失败，将由后台清理",
+			clog.String("topic", topic),
+			clog.String("blob_key", key),
+			clog.Err(err))
+	}
+}
+
+// releaseOnError 包装异步发送的回调，发送失败时先删除已上传的对象
+func (c *claimCheck) releaseOnError(topic, key string, callback func(error)) func(error) {
+	if c == nil || key == "" {
+		return callback
+	}
+	return func(err error) {
+		if err != nil {
+			c.release(topic, key)
+		}
+		if callback != nil {
+			callback(err)
+		}
+	}
+}
+
+// inline 消息带有 X-Claim-Check 头时从 BlobStore 取回载荷并替换消息体，同时移除 claim-check 头。
+// 消费者未设置 BlobStore 时返回错误，消息按处理失败对待。
+func (c *claimCheck) inline(ctx context.Context, msg *Message) error {
+	ref, ok := msg.Headers[HeaderClaimCheck]
+	if !ok {
+		return nil
+	}
+	key := string(ref)
+	if c == nil {
+		return ErrConsumer(fmt.Sprintf("消息载荷已卸载到 %s，但消费者未设置 BlobStore", key), nil)
+	}
+
+	data, err := c.store.Get(ctx, key)
+	if err != nil {
+		c.errors.Add(1)
+		return ErrConsumer(fmt.Sprintf("取回消息载荷 %s 失败", key), err)
+	}
+	if size, ok := msg.Headers[HeaderClaimCheckSize]; ok {
+		if expected, err := strconv.Atoi(string(size)); err == nil && expected != len(data) {
+			c.errors.Add(1)
+			return ErrConsumer(fmt.Sprintf("消息载荷 %s 大小不一致: 期望 %d，实际 %d", key, expected, len(data)), nil)
+		}
+	}
+
+	msg.Value = data
+	delete(msg.Headers, HeaderClaimCheck)
+	delete(msg.Headers, HeaderClaimCheckSize)
+	c.inlined.Add(1)
+	return nil
+}
+
+// startCleanup 配置了 RetentionMs 时启动后台任务，周期性删除超过保留时间的对象
+func (c *claimCheck) startCleanup() {
+	if c == nil || c.config == nil || c.config.RetentionMs <= 0 {
+		return
+	}
+
+	interval := time.Duration(c.config.CleanupIntervalMs) * time.Millisecond
+	if interval <= 0 {
+		interval = defaultClaimCheckCleanupInterval
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cleanupCancel = cancel
+	c.cleanupWG.Add(1)
+	go func() {
+		defer c.cleanupWG.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.cleanup(ctx, time.Now())
+			}
+		}
+	}()
+}
+
+// stopCleanup 停止后台清理
+func (c *claimCheck) stopCleanup() {
+	if c == nil || c.cleanupCancel == nil {
+		return
+	}
+	c.cleanupCancel()
+	c.cleanupWG.Wait()
+}
+
+// cleanup 删除创建时间早于 now - RetentionMs 的对象，返回删除的数量。
+// 多个生产者实例可以同时清理同一个前缀，删除是幂等的。
+func (c *claimCheck) cleanup(ctx context.Context, now time.Time) int {
+	before := now.Add(-time.Duration(c.config.RetentionMs) * time.Millisecond)
+	keys, err := c.store.List(ctx, c.keyPrefix(), before)
+	if err != nil {
+		if ctx.Err() == nil {
+			c.errors.Add(1)
+			c.logger.Warn("列出过期消息载荷失败", clog.Err(err))
+		}
+		return 0
+	}
+
+	deleted := 0
+	for _, key := range keys {
+		if err := c.store.Delete(ctx, key); err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			c.errors.Add(1)
+			c.logger.Warn("删除过期消息载荷失败", clog.String("blob_key", key), clog.Err(err))
+			continue
+		}
+		deleted++
+	}
+	c.cleaned.Add(int64(deleted))
+	if deleted > 0 {
+		c.logger.Info("已清理过期消息载荷", clog.Int("deleted", deleted))
+	}
+	return deleted
+}
+
+// keyPrefix 返回对象键前缀
+func (c *claimCheck) keyPrefix() string {
+	if c.config == nil || c.config.KeyPrefix == "" {
+		return defaultClaimCheckKeyPrefix
+	}
+	return c.config.KeyPrefix
+}
+
+// addMetrics 将 claim-check 统计写入 GetMetrics 的结果
+func (c *claimCheck) addMetrics(metrics map[string]interface{}) {
+	if c == nil {
+		return
+	}
+	if c.config != nil {
+		metrics["claim_check_offloaded"] = c.offloaded.Load()
+		metrics["claim_check_offloaded_bytes"] = c.offloadedBytes.Load()
+		metrics["claim_check_cleaned"] = c.cleaned.Load()
+	} else {
+		metrics["claim_check_inlined"] = c.inlined.Load()
+	}
+	metrics["claim_check_errors"] = c.errors.Load()
+}
+
+// memoryBlobStore 进程内的 BlobStore
+type memoryBlobStore struct {
+	mu      sync.Mutex
+	objects map[string]memoryBlob
+	// now 返回当前时间，测试中可替换
+	now func() time.Time
+}
+
+type memoryBlob struct {
+	data    []byte
+	created time.Time
+}
+
+// NewMemoryBlobStore 创建进程内的 BlobStore，生产者和消费者必须在同一进程中，仅用于测试和单实例开发环境
+func NewMemoryBlobStore() BlobStore {
+	return &memoryBlobStore{
+		objects: make(map[string]memoryBlob),
+		now:     time.Now,
+	}
+}
+
+// Put 实现 BlobStore
+func (s *memoryBlobStore) Put(_ context.Context, key string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = memoryBlob{data: append([]byte(nil), data...), created: s.now()}
+	return nil
+}
+
+// Get 实现 BlobStore
+func (s *memoryBlobStore) Get(_ context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	blob, ok := s.objects[key]
+	if !ok {
+		return nil, fmt.Errorf("对象不存在: %s", key)
+	}
+	return append([]byte(nil), blob.data...), nil
+}
+
+// Delete 实现 BlobStore
+func (s *memoryBlobStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, key)
+	return nil
+}
+
+// List 实现 BlobStore
+func (s *memoryBlobStore) List(_ context.Context, prefix string, before time.Time) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []string
+	for key, blob := range s.objects {
+		if strings.HasPrefix(key, prefix) && blob.created.Before(before) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
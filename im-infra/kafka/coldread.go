@@ -0,0 +1,318 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// coldAlertResolveRatio 积压时长降到告警阈值的该比例以下时解除告警，避免在阈值附近反复告警
+const coldAlertResolveRatio = 0.8
+
+// ColdReadConfig 定义积压感知的消费控制。
+// 消费者远远落后于分区最新位置时，读取会落到 Kafka 分层存储（冷存储）上，延迟飙升并挤占 broker 的 I/O，
+// 影响读取最新数据的其他消费者。开启后按分区判断是否处于冷读，对冷读的消息限速，并计算积压时长用于告警。
+type ColdReadConfig struct {
+	// LagThreshold 分区落后高水位超过该消息数时判定为冷读，0 表示不按消息数判断
+	LagThreshold int64 `json:"lagThreshold,omitempty"`
+	// AgeThresholdMs 正在处理的消息的时间戳早于当前时间超过该值(毫秒)时判定为冷读，0 表示不按时间判断。
+	// 通常设置为 broker 本地存储的保留时长（local.retention.ms），超过后的数据只存在于分层存储中
+	AgeThresholdMs int `json:"ageThresholdMs,omitempty"`
+	// MaxRecordsPerSecond 冷读消息的处理速率上限，由消费者的所有订阅共享，0 表示只检测不限速。
+	// 限速会同时推迟下一次拉取，从而降低对 broker 冷存储的读取压力
+	MaxRecordsPerSecond int `json:"maxRecordsPerSecond,omitempty"`
+	// AlertBacklogAgeMs 积压时长超过该值(毫秒)时触发 BacklogAlert，0 表示不告警。
+	// 积压时长为仍有积压的分区中最近处理的消息距今的时间
+	AlertBacklogAgeMs int `json:"alertBacklogAgeMs,omitempty"`
+}
+
+// BacklogAlert 描述一次积压时长告警或告警解除
+type BacklogAlert struct {
+	GroupID string
+	// Topic 和 Partition 积压时长最大的分区，Topic 为逻辑主题名
+	Topic     string
+	Partition int32
+	// BacklogAge 当前的积压时长
+	BacklogAge time.Duration
+	// Lag 该分区落后高水位的消息数
+	Lag int64
+	// Resolved 为 true 表示积压时长已降到阈值的 80% 以下，告警解除
+	Resolved bool
+	Time     time.Time
+}
+
+// BacklogAlertHandler 积压告警回调，在消费 goroutine 中同步执行，不应阻塞
+type BacklogAlertHandler func(BacklogAlert)
+
+// WithBacklogAlertHandler 注册积压告警回调，仅在配置了 ConsumerConfig.ColdRead.AlertBacklogAgeMs 时生效，可注册多个。
+func WithBacklogAlertHandler(handler BacklogAlertHandler) Option {
+	return func(o *options) {
+		o.backlogAlertHandlers = append(o.backlogAlertHandlers, handler)
+	}
+}
+
+// validateColdReadConfig 校验冷读配置，nil 表示不开启
+func validateColdReadConfig(cfg *ColdReadConfig) error {
+	if cfg == nil {
+		return nil
+	}
+	if cfg.LagThreshold < 0 || cfg.AgeThresholdMs < 0 || cfg.MaxRecordsPerSecond < 0 || cfg.AlertBacklogAgeMs < 0 {
+		return ErrInvalidConfig("coldRead 参数不能为负数")
+	}
+	if cfg.LagThreshold == 0 && cfg.AgeThresholdMs == 0 && cfg.AlertBacklogAgeMs == 0 {
+		return ErrInvalidConfig("coldRead 至少需要设置 lagThreshold、ageThresholdMs 或 alertBacklogAgeMs 之一")
+	}
+	return nil
+}
+
+// partitionBacklog 单个分区的积压状态
+type partitionBacklog struct {
+	topic     string
+	partition int32
+	lag       int64
+	age       time.Duration
+	cold      bool
+}
+
+// coldReadTracker 跟踪各分区的积压，判断冷读并限速
+type coldReadTracker struct {
+	groupID      string
+	lagThreshold int64
+	ageThreshold time.Duration
+	alertAge     time.Duration
+	// interval 冷读消息之间的最小间隔，0 表示不限速
+	interval time.Duration
+	handlers []BacklogAlertHandler
+	logger   clog.Logger
+	logical  func(string) string
+
+	mu         sync.Mutex
+	partitions map[string]*partitionBacklog
+	// nextSlot 下一条冷读消息最早可以处理的时间
+	nextSlot time.Time
+	alerting bool
+
+	coldRecords atomic.Int64
+	throttled   atomic.Int64
+	alerts      atomic.Int64
+}
+
+// newColdReadTracker 创建冷读跟踪器，未配置时返回 nil
+func newColdReadTracker(groupID string, cfg *ColdReadConfig, handlers []BacklogAlertHandler, logger clog.Logger, logical func(string) string) *coldReadTracker {
+	if cfg == nil {
+		return nil
+	}
+	t := &coldReadTracker{
+		groupID:      groupID,
+		lagThreshold: cfg.LagThreshold,
+		ageThreshold: time.Duration(cfg.AgeThresholdMs) * time.Millisecond,
+		alertAge:     time.Duration(cfg.AlertBacklogAgeMs) * time.Millisecond,
+		handlers:     handlers,
+		logger:       logger,
+		logical:      logical,
+		partitions:   make(map[string]*partitionBacklog),
+	}
+	if cfg.MaxRecordsPerSecond > 0 {
+		t.interval = time.Second / time.Duration(cfg.MaxRecordsPerSecond)
+	}
+	return t
+}
+
+// highWatermarks 返回本次拉取中各分区的高水位，未开启时返回 nil
+func (t *coldReadTracker) highWatermarks(fetches kgo.Fetches) map[string]int64 {
+	if t == nil {
+		return nil
+	}
+	hw := make(map[string]int64)
+	fetches.EachPartition(func(p kgo.FetchTopicPartition) {
+		hw[fmt.Sprintf("%s/%d", p.Topic, p.Partition)] = p.HighWatermark
+	})
+	return hw
+}
+
+// observe 在处理消息前更新分区的积压状态，消息处于冷读时按限速等待，返回 ctx 结束时的错误
+func (t *coldReadTracker) observe(ctx context.Context, record *kgo.Record, hw map[string]int64) error {
+	if t == nil {
+		return nil
+	}
+
+	key := fmt.Sprintf("%s/%d", record.Topic, record.Partition)
+	now := time.Now()
+	lag := hw[key] - record.Offset - 1
+	if lag < 0 {
+		lag = 0
+	}
+	var age time.Duration
+	if lag > 0 && !record.Timestamp.IsZero() {
+		age = max(now.Sub(record.Timestamp), 0)
+	}
+	cold := (t.lagThreshold > 0 && lag >= t.lagThreshold) || (t.ageThreshold > 0 && age >= t.ageThreshold)
+
+	t.mu.Lock()
+	p, ok := t.partitions[key]
+	if !ok {
+		p = &partitionBacklog{topic: record.Topic, partition: record.Partition}
+		t.partitions[key] = p
+	}
+	changed := p.cold != cold
+	p.lag, p.age, p.cold = lag, age, cold
+	alert := t.evaluateAlert(now)
+
+	var wait time.Duration
+	if cold && t.interval > 0 {
+		if t.nextSlot.Before(now) {
+			t.nextSlot = now
+		}
+		wait = t.nextSlot.Sub(now)
+		t.nextSlot = t.nextSlot.Add(t.interval)
+	}
+	t.mu.Unlock()
+
+	if changed {
+		if cold {
+			t.logger.Warn("分区进入冷读，开始限速",
+				clog.String("group_id", t.groupID),
+				clog.String("topic", record.Topic),
+				clog.Int32("partition", record.Partition),
+				clog.Int64("lag", lag),
+				clog.Duration("age", age))
+		} else {
+			t.logger.Info("分区退出冷读",
+				clog.String("group_id", t.groupID),
+				clog.String("topic", record.Topic),
+				clog.Int32("partition", record.Partition))
+		}
+	}
+	if alert != nil {
+		t.emit(*alert)
+	}
+
+	if !cold {
+		return nil
+	}
+	t.coldRecords.Add(1)
+	if wait <= 0 {
+		return nil
+	}
+	t.throttled.Add(int64(wait))
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// evaluateAlert 根据最大积压时长判断是否触发或解除告警，调用方持有 t.mu
+func (t *coldReadTracker) evaluateAlert(now time.Time) *BacklogAlert {
+	if t.alertAge <= 0 {
+		return nil
+	}
+	worst := t.worstLocked()
+	var age time.Duration
+	if worst != nil {
+		age = worst.age
+	}
+
+	switch {
+	case !t.alerting && age >= t.alertAge:
+		t.alerting = true
+		t.alerts.Add(1)
+	case t.alerting && float64(age) < float64(t.alertAge)*coldAlertResolveRatio:
+		t.alerting = false
+	default:
+		return nil
+	}
+
+	alert := &BacklogAlert{
+		GroupID:    t.groupID,
+		BacklogAge: age,
+		Resolved:   !t.alerting,
+		Time:       now,
+	}
+	if worst != nil {
+		alert.Topic = t.logical(worst.topic)
+		alert.Partition = worst.partition
+		alert.Lag = worst.lag
+	}
+	return alert
+}
+
+// worstLocked 返回积压时长最大的分区，调用方持有 t.mu
+func (t *coldReadTracker) worstLocked() *partitionBacklog {
+	var worst *partitionBacklog
+	for _, p := range t.partitions {
+		if worst == nil || p.age > worst.age {
+			worst = p
+		}
+	}
+	return worst
+}
+
+// revoke 移除不再由本成员负责的分区，避免其过期的积压时长持续触发告警
+func (t *coldReadTracker) revoke(revoked map[string][]int32) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for topic, partitions := range revoked {
+		for _, partition := range partitions {
+			delete(t.partitions, fmt.Sprintf("%s/%d", topic, partition))
+		}
+	}
+}
+
+// emit 执行告警回调，回调 panic 不影响消费
+func (t *coldReadTracker) emit(alert BacklogAlert) {
+	if alert.Resolved {
+		t.logger.Info("积压告警解除", clog.String("group_id", t.groupID), clog.Duration("backlog_age", alert.BacklogAge))
+	} else {
+		t.logger.Warn("积压时长超过告警阈值",
+			clog.String("group_id", t.groupID),
+			clog.String("topic", alert.Topic),
+			clog.Int32("partition", alert.Partition),
+			clog.Int64("lag", alert.Lag),
+			clog.Duration("backlog_age", alert.BacklogAge))
+	}
+	for _, handler := range t.handlers {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.logger.Error("积压告警回调 panic", clog.Any("panic", r))
+				}
+			}()
+			handler(alert)
+		}()
+	}
+}
+
+// addMetrics 将积压和冷读计数加入消费者指标，未开启时为空操作
+func (t *coldReadTracker) addMetrics(metrics map[string]interface{}) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	var coldPartitions int
+	var backlogAge time.Duration
+	for _, p := range t.partitions {
+		if p.cold {
+			coldPartitions++
+		}
+		backlogAge = max(backlogAge, p.age)
+	}
+	t.mu.Unlock()
+
+	metrics["backlog_age_ms"] = float64(backlogAge) / float64(time.Millisecond)
+	metrics["cold_partitions"] = coldPartitions
+	metrics["cold_records"] = t.coldRecords.Load()
+	metrics["cold_throttled_ms_total"] = float64(t.throttled.Load()) / float64(time.Millisecond)
+	metrics["backlog_alerts"] = t.alerts.Load()
+}
@@ -16,6 +16,73 @@ type Config struct {
 	ProducerConfig *ProducerConfig `json:"producerConfig,omitempty"`
 	// ConsumerConfig 消费者专用配置
 	ConsumerConfig *ConsumerConfig `json:"consumerConfig,omitempty"`
+	// ValidateTopicsOnStart 启动时检查的主题列表，NewProvider 会检查 broker 连通性以及这些主题是否存在，
+	// 避免主题名拼写错误到了线上高峰期才以发送失败的形式暴露
+	ValidateTopicsOnStart []string `json:"validateTopicsOnStart,omitempty"`
+	// TopicValidation 启动主题检查的策略，为 nil 时使用 fail-fast 策略
+	TopicValidation *TopicValidationConfig `json:"topicValidation,omitempty"`
+	// TopicNaming 主题命名规范，为 nil 时主题名原样使用
+	TopicNaming *TopicNamingConfig `json:"topicNaming,omitempty"`
+	// Chaos 故障注入配置，仅用于非生产环境的韧性测试，为 nil 时不注入
+	Chaos *ChaosConfig `json:"chaos,omitempty"`
+}
+
+// ChaosConfig 定义故障注入，用于在集成测试中验证回调的幂等性以及熔断、重试逻辑。
+// 所有概率的取值范围为 [0, 1]；只有 APP_ENV 为 dev、development、test 或 staging 时才允许开启，
+// 未设置 APP_ENV 时视为生产环境并拒绝。
+type ChaosConfig struct {
+	// Enabled 是否开启故障注入
+	Enabled bool `json:"enabled"`
+	// Topics 只对这些主题注入发送和重复投递故障，为空表示所有主题；不影响重平衡注入
+	Topics []string `json:"topics,omitempty"`
+	// SendLatencyProbability 发送时注入延迟的概率
+	SendLatencyProbability float64 `json:"sendLatencyProbability,omitempty"`
+	// SendLatencyMs 注入的发送延迟(毫秒)。SendSync 在发送前等待，Send 推迟发送结果回调
+	SendLatencyMs int `json:"sendLatencyMs,omitempty"`
+	// SendErrorProbability 发送直接失败的概率，注入的错误可通过 IsChaosError 识别
+	SendErrorProbability float64 `json:"sendErrorProbability,omitempty"`
+	// DuplicateProbability 消息处理后再次投递给回调的概率，模拟重平衡或提交失败导致的重复消费
+	DuplicateProbability float64 `json:"duplicateProbability,omitempty"`
+	// RebalanceProbability 每批消息处理完后主动触发一次消费者组重平衡的概率
+	RebalanceProbability float64 `json:"rebalanceProbability,omitempty"`
+	// Seed 随机数种子，相同的种子产生相同的注入序列，0 表示使用当前时间
+	Seed int64 `json:"seed,omitempty"`
+}
+
+// TopicNamingConfig 定义主题命名规范，使开发、测试和生产环境可以安全地共用一个集群。
+// 发送、订阅和管理操作中的主题名会自动加上 "{env}.{namespace}." 前缀，消费到的消息主题名会去掉该前缀，
+// 业务代码始终使用不带前缀的逻辑主题名。
+type TopicNamingConfig struct {
+	// Env 环境名，如 "dev"、"prod"，为空时使用环境变量 APP_ENV
+	Env string `json:"env,omitempty"`
+	// Namespace 命名空间，如 "gochat"，为空时使用 WithNamespace 设置的命名空间；两者都为空时前缀为 "{env}."
+	Namespace string `json:"namespace,omitempty"`
+	// Pattern 加前缀后的完整主题名必须匹配的正则，为空时不校验，如 `^(dev|prod)\.gochat\.[a-z]+(\.[a-z]+)*$`
+	Pattern string `json:"pattern,omitempty"`
+	// ExemptTopics 不加前缀、原样使用的主题，代码中也可以用 RawTopic 临时绕过
+	ExemptTopics []string `json:"exemptTopics,omitempty"`
+}
+
+// 启动主题检查策略
+const (
+	// TopicValidationFailFast 主题不存在或分区数不足时 NewProvider 直接返回错误
+	TopicValidationFailFast = "fail-fast"
+	// TopicValidationCreateMissing 自动创建不存在的主题，分区数不足时仍然返回错误
+	TopicValidationCreateMissing = "create-missing"
+)
+
+// TopicValidationConfig 定义启动主题检查的策略
+type TopicValidationConfig struct {
+	// Policy 检查策略: "fail-fast", "create-missing"，为空时使用 "fail-fast"
+	Policy string `json:"policy"`
+	// MinPartitions 按主题要求的最小分区数，分区数不足时检查失败
+	MinPartitions map[string]int32 `json:"minPartitions,omitempty"`
+	// CreatePartitions create-missing 策略创建主题的分区数，<= 0 时优先使用 MinPartitions，否则使用 broker 默认值
+	CreatePartitions int32 `json:"createPartitions,omitempty"`
+	// CreateReplicationFactor create-missing 策略创建主题的副本因子，<= 0 时使用 broker 默认值
+	CreateReplicationFactor int16 `json:"createReplicationFactor,omitempty"`
+	// TimeoutMs 启动检查的超时时间(毫秒)，默认 10000
+	TimeoutMs int `json:"timeoutMs,omitempty"`
 }
 
 // ProducerConfig 定义生产者的专用配置
@@ -44,6 +111,59 @@ type ProducerConfig struct {
 	MaxBufferedBytes int `json:"maxBufferedBytes"`
 	// UnknownTopicRetries 未知主题重试次数
 	UnknownTopicRetries int `json:"unknownTopicRetries"`
+	// Partitioner 默认分区策略: "hash", "sticky", "round-robin", "manual"，为空时使用 "hash"
+	Partitioner string `json:"partitioner,omitempty"`
+	// TopicPartitioners 按主题覆盖分区策略，键为主题名。
+	// 自定义分区函数无法通过配置表达，需使用 WithPartitionFunc 注册，其优先级高于此处的配置。
+	TopicPartitioners map[string]string `json:"topicPartitioners,omitempty"`
+	// Spill 本地磁盘缓冲配置，为 nil 时 broker 不可用的错误直接返回给调用方
+	Spill *SpillConfig `json:"spill,omitempty"`
+	// Dedup 生产者侧的重复发送抑制配置，为 nil 时不检查
+	Dedup *DedupConfig `json:"dedup,omitempty"`
+	// ClaimCheck 大消息卸载配置，为 nil 时所有载荷直接写入 Kafka
+	ClaimCheck *ClaimCheckConfig `json:"claimCheck,omitempty"`
+}
+
+// ClaimCheckConfig 定义生产者侧的大消息卸载（claim-check）。
+// 载荷超过阈值的消息先上传到 WithBlobStore 设置的对象存储，Kafka 中只保留带 X-Claim-Check 头的空消息；
+// 设置了同一个 BlobStore 的消费者会自动取回载荷，回调看到的仍是完整的消息。
+type ClaimCheckConfig struct {
+	// ThresholdBytes 载荷超过该字节数时卸载
+	ThresholdBytes int `json:"thresholdBytes"`
+	// KeyPrefix 对象键前缀，对象键为 "{KeyPrefix}{topic}/{uuid}"，为空时使用 "kafka-claim-check/"
+	KeyPrefix string `json:"keyPrefix,omitempty"`
+	// RetentionMs 对象的保留时间(毫秒)，超过后由后台任务删除，应不小于主题的消息保留时间；
+	// 0 表示不清理，由对象存储的生命周期规则负责
+	RetentionMs int64 `json:"retentionMs,omitempty"`
+	// CleanupIntervalMs 后台清理的间隔(毫秒)，为 0 时使用 10 分钟
+	CleanupIntervalMs int `json:"cleanupIntervalMs,omitempty"`
+}
+
+// DedupConfig 定义生产者侧的重复发送抑制。
+// 应用层重试（如 RPC 超时后重新调用）可能使同一条业务消息被发送多次，
+// 生产者记住窗口内发送过的 Message.IdempotencyKey，对重复的发送进行抑制或标记，与消费者侧去重互为补充。
+type DedupConfig struct {
+	// WindowMs 记住已发送幂等键的时间窗口(毫秒)
+	WindowMs int `json:"windowMs"`
+	// Mode 命中重复时的处理方式: "suppress"（丢弃并返回成功）, "flag"（发送并带上 X-Duplicate 头），为空时使用 "suppress"
+	Mode string `json:"mode,omitempty"`
+	// MaxKeys 内存存储最多记住的幂等键数，默认 100000；通过 WithDedupStore 使用其他存储时忽略
+	MaxKeys int `json:"maxKeys,omitempty"`
+}
+
+// SpillConfig 定义生产者本地磁盘缓冲（WAL）的配置。
+// 开启后，broker 短暂不可用期间发送的消息会先写入本地队列，由后台任务在 broker 恢复后按顺序回放。
+type SpillConfig struct {
+	// Dir 本地队列目录，每个生产者实例必须使用独立的目录
+	Dir string `json:"dir"`
+	// MaxBytes 本地队列最大字节数，超过后 Send 返回 ErrCodeSpillFull 错误
+	MaxBytes int64 `json:"maxBytes"`
+	// SegmentBytes 单个段文件的最大字节数
+	SegmentBytes int64 `json:"segmentBytes"`
+	// MaxAgeMs 消息在本地队列中的最长保留时间(毫秒)，超时的消息回放时会被丢弃，0 表示不限制
+	MaxAgeMs int `json:"maxAgeMs"`
+	// FlushIntervalMs 后台检查 broker 恢复并回放的间隔(毫秒)
+	FlushIntervalMs int `json:"flushIntervalMs"`
 }
 
 // ConsumerConfig 定义消费者的专用配置
@@ -72,10 +192,16 @@ type ConsumerConfig struct {
 	MaxPartitionFetchBytes int `json:"maxPartitionFetchBytes"`
 	// EnableAutoCommitOnClose 关闭时是否自动提交
 	EnableAutoCommitOnClose bool `json:"enableAutoCommitOnClose"`
+	// ShutdownTimeoutMs 关闭时等待正在处理的消息完成的最长时间(毫秒)
+	ShutdownTimeoutMs int `json:"shutdownTimeoutMs"`
 	// CheckCRCs 是否检查CRC校验
 	CheckCRCs bool `json:"checkCRCs"`
 	// ClientID 客户端ID
 	ClientID string `json:"clientId"`
+	// Watchdog 订阅健康看门狗，检测到订阅停滞时自动重启消费者组会话，为 nil 时不开启
+	Watchdog *WatchdogConfig `json:"watchdog,omitempty"`
+	// ColdRead 积压感知的消费控制：检测远远落后于最新位置的冷读并限速，计算积压时长并告警，为 nil 时不开启
+	ColdRead *ColdReadConfig `json:"coldRead,omitempty"`
 }
 
 // GetDefaultConfig 返回默认的 kafka 配置。
@@ -113,6 +239,7 @@ func GetDefaultConfig(env string) *Config {
 				MaxPollRecords:            500,
 				MaxPartitionFetchBytes:    1048576, // 1MB
 				EnableAutoCommitOnClose:   true,
+				ShutdownTimeoutMs:         30000,
 				CheckCRCs:                 true,
 				ClientID:                  "kafka-consumer",
 			},
@@ -150,6 +277,7 @@ func GetDefaultConfig(env string) *Config {
 			MaxPollRecords:            100,
 			MaxPartitionFetchBytes:    524288, // 512KB
 			EnableAutoCommitOnClose:   true,
+			ShutdownTimeoutMs:         10000,
 			CheckCRCs:                 false,
 			ClientID:                  "kafka-consumer-dev",
 		},
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ceyewan/gochat/im-infra/clog"
@@ -21,6 +22,43 @@ type consumerImpl struct {
 	cancelContext context.CancelFunc
 	wg            sync.WaitGroup
 	ctx           context.Context
+
+	// closing 标记消费者进入关闭流程，之后不再拉取和分发新消息
+	closing atomic.Bool
+	// inflight 当前正在回调中处理的消息数
+	inflight atomic.Int64
+	// abandoned 关闭过程中已拉取但未处理的消息数
+	abandoned atomic.Int64
+
+	// chaos 故障注入，未开启时为 nil
+	chaos *faultInjector
+
+	// topics 主题命名转换，未配置 TopicNaming 时为 nil
+	topics *topicNamer
+
+	// watchdog 订阅健康看门狗，未配置 ConsumerConfig.Watchdog 时为 nil
+	watchdog *watchdog
+	// coldRead 积压感知的冷读限速和告警，未配置 ConsumerConfig.ColdRead 时为 nil
+	coldRead *coldReadTracker
+	// claimCheck 取回被卸载的大消息载荷，未设置 BlobStore 时为 nil
+	claimCheck *claimCheck
+	// subscriptions 当前活跃的订阅
+	subsMu        sync.Mutex
+	subscriptions map[*subscription]struct{}
+}
+
+// finalCommitTimeout 关闭时提交最终偏移量的超时时间。
+// 即使关闭的 ctx 已超时，仍会尝试在该时间内完成最后一次提交。
+const finalCommitTimeout = 5 * time.Second
+
+// ShutdownReport 描述了消费者优雅关闭的结果
+type ShutdownReport struct {
+	// Abandoned 已拉取但未完成处理的消息数，这些消息的偏移量不会被提交，重启后将被重新投递
+	Abandoned int64
+	// OffsetsCommitted 最终偏移量是否提交成功
+	OffsetsCommitted bool
+	// Duration 关闭耗时
+	Duration time.Duration
 }
 
 // consumerMetrics 消费者性能指标
@@ -29,7 +67,15 @@ type consumerMetrics struct {
 	totalBytes       int64
 	processedMessage int64
 	failedMessages   int64
-	mu               sync.RWMutex
+	// filteredMessages 被订阅过滤器丢弃的消息数，不计入 totalMessages
+	filteredMessages int64
+	// filteredBy 按过滤器名称统计的丢弃数
+	filteredBy map[string]int64
+	// handlerDuration 回调处理的累计耗时
+	handlerDuration time.Duration
+	// lag 每个分区最近一次拉取时的消费延迟（高水位 - 下一条待处理消息的偏移量）
+	lag map[string]int64
+	mu  sync.RWMutex
 }
 
 // newConsumerImpl 创建一个新的消息消费者实例。
@@ -49,6 +95,25 @@ func newConsumerImpl(ctx context.Context, config *Config, groupID string, opts *
 		return nil, fmt.Errorf("消费者组ID不能为空")
 	}
 
+	chaos, err := newFaultInjector(config.Chaos, opts.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	topics, err := newTopicNamer(config.TopicNaming, opts.namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateWatchdogConfig(config.ConsumerConfig.Watchdog); err != nil {
+		return nil, err
+	}
+
+	if err := validateColdReadConfig(config.ConsumerConfig.ColdRead); err != nil {
+		return nil, err
+	}
+	coldRead := newColdReadTracker(groupID, config.ConsumerConfig.ColdRead, opts.backlogAlertHandlers, opts.logger, topics.logical)
+
 	// 构建上下文
 	consumerCtx, cancel := context.WithCancel(ctx)
 
@@ -58,6 +123,14 @@ func newConsumerImpl(ctx context.Context, config *Config, groupID string, opts *
 	// 设置 brokers
 	kgoOpts = append(kgoOpts, kgo.SeedBrokers(config.Brokers...))
 
+	// 分区被撤销或丢失后不再统计其积压
+	if coldRead != nil {
+		onRevoked := func(_ context.Context, _ *kgo.Client, revoked map[string][]int32) {
+			coldRead.revoke(revoked)
+		}
+		kgoOpts = append(kgoOpts, kgo.OnPartitionsRevoked(onRevoked), kgo.OnPartitionsLost(onRevoked))
+	}
+
 	// 设置安全协议（暂时只支持 PLAINTEXT）
 	if config.SecurityProtocol != "PLAINTEXT" {
 		// TODO: 后续可以扩展支持 SSL/SASL 配置
@@ -84,6 +157,20 @@ func newConsumerImpl(ctx context.Context, config *Config, groupID string, opts *
 		metrics:       consumerMetrics{},
 		cancelContext: cancel,
 		ctx:           consumerCtx,
+		chaos:         chaos,
+		topics:        topics,
+		coldRead:      coldRead,
+		claimCheck:    newConsumerClaimCheck(opts.blobStore, opts.logger),
+		subscriptions: make(map[*subscription]struct{}),
+	}
+
+	consumer.watchdog = newWatchdog(consumer, config.ConsumerConfig.Watchdog, opts.watchdogHandlers)
+	if consumer.watchdog != nil {
+		consumer.wg.Add(1)
+		go func() {
+			defer consumer.wg.Done()
+			consumer.watchdog.run(consumerCtx)
+		}()
 	}
 
 	consumer.logger.Info("Kafka 消费者初始化成功",
@@ -146,7 +233,7 @@ func buildConsumerOpts(cfg *ConsumerConfig, groupID string) []kgo.Opt {
 }
 
 // Subscribe 订阅消息并根据处理结果决定是否提交偏移量。
-func (c *consumerImpl) Subscribe(ctx context.Context, topics []string, callback ConsumeCallback) error {
+func (c *consumerImpl) Subscribe(ctx context.Context, topics []string, callback ConsumeCallback, opts ...SubscribeOption) error {
 	if len(topics) == 0 {
 		return fmt.Errorf("订阅主题列表不能为空")
 	}
@@ -155,18 +242,39 @@ func (c *consumerImpl) Subscribe(ctx context.Context, topics []string, callback
 		return fmt.Errorf("回调函数不能为空")
 	}
 
+	subOpts := &subscribeOptions{}
+	for _, opt := range opts {
+		opt(subOpts)
+	}
+
+	physical, err := c.topics.physicalAll(topics)
+	if err != nil {
+		return err
+	}
+
 	// 添加主题到消费列表
-	c.client.AddConsumeTopics(topics...)
+	c.client.AddConsumeTopics(physical...)
 
 	c.logger.Info("开始订阅主题",
 		clog.Strings("topics", topics),
 		clog.String("group_id", c.groupID),
+		clog.Int("filters", len(subOpts.filters)),
 	)
 
+	// 拉取使用独立的上下文，消费者关闭时只中断拉取，不影响正在处理的消息
+	pollCtx, cancelPoll := context.WithCancel(ctx)
+	stopPoll := context.AfterFunc(c.ctx, cancelPoll)
+
+	sub := newSubscription(topics, physical)
+	c.addSubscription(sub)
+
 	// 启动消费 goroutine
 	c.wg.Add(1)
 	go func() {
 		defer c.wg.Done()
+		defer c.removeSubscription(sub)
+		defer stopPoll()
+		defer cancelPoll()
 
 		for {
 			select {
@@ -177,7 +285,10 @@ func (c *consumerImpl) Subscribe(ctx context.Context, topics []string, callback
 				c.logger.Info("消费者被取消")
 				return
 			default:
-				if err := c.consumeBatch(ctx, callback); err != nil {
+				if err := c.consumeBatch(ctx, pollCtx, sub, callback, subOpts.filters); err != nil {
+					if c.closing.Load() {
+						return
+					}
 					c.logger.Error("消费批次失败", clog.Err(err))
 					// 短暂休眠后继续
 					time.Sleep(1 * time.Second)
@@ -190,26 +301,105 @@ func (c *consumerImpl) Subscribe(ctx context.Context, topics []string, callback
 }
 
 // consumeBatch 消费一批消息
-func (c *consumerImpl) consumeBatch(ctx context.Context, callback ConsumeCallback) error {
-	// 拉取消息
-	fetches := c.client.PollFetches(ctx)
+func (c *consumerImpl) consumeBatch(ctx, pollCtx context.Context, sub *subscription, callback ConsumeCallback, filters []Filter) error {
+	// 每次拉取使用单独的上下文，看门狗可以打断卡住的拉取而不结束订阅
+	fetchCtx, cancelFetch := context.WithCancel(pollCtx)
+	sub.setPollCancel(cancelFetch)
+	fetches := c.client.PollFetches(fetchCtx)
+	sub.setPollCancel(nil)
+	interrupted := fetchCtx.Err() != nil && pollCtx.Err() == nil
+	cancelFetch()
 	if fetches.IsClientClosed() {
 		return fmt.Errorf("客户端已关闭")
 	}
+	sub.progress()
+
+	// 被看门狗打断的拉取直接开始下一次
+	if interrupted {
+		return nil
+	}
 
 	if fetches.Err() != nil {
+		if c.closing.Load() {
+			return fetches.Err()
+		}
 		c.logger.Error("拉取消息失败", clog.Err(fetches.Err()))
 		return fetches.Err()
 	}
 
-	// 处理每条消息
-	fetches.EachRecord(func(record *kgo.Record) {
+	c.updateLag(fetches)
+	hw := c.coldRead.highWatermarks(fetches)
+
+	// 处理每条消息，进入关闭流程后剩余的消息直接放弃，等待重新投递
+	records := fetches.Records()
+	for i, record := range records {
+		if c.closing.Load() {
+			c.abandoned.Add(int64(len(records) - i))
+			return nil
+		}
+		if name, rejected := rejectedBy(filters, record); rejected {
+			c.skipRecord(record, name)
+			sub.handled(record.Topic, record.Partition, record.Offset)
+			continue
+		}
+		// 冷读限速期间订阅仍视为有进展，避免被看门狗误判为停滞
+		if err := c.coldRead.observe(ctx, record, hw); err != nil {
+			c.abandoned.Add(int64(len(records) - i))
+			return nil
+		}
+		sub.progress()
+		sub.beginHandling()
 		c.processRecord(ctx, record, callback)
-	})
+		// 故障注入：重复投递刚处理过的消息，验证回调的幂等性
+		if c.chaos.duplicate(c.topics.logical(record.Topic)) {
+			c.processRecord(ctx, record, callback)
+		}
+		sub.endHandling()
+		sub.handled(record.Topic, record.Partition, record.Offset)
+	}
+
+	// 故障注入：主动触发重平衡，验证分区撤销和重新分配时的行为
+	if len(records) > 0 && c.chaos.rebalance() {
+		c.client.ForceRebalance()
+	}
 
 	return nil
 }
 
+// updateLag 根据拉取结果中的分区高水位更新消费延迟
+func (c *consumerImpl) updateLag(fetches kgo.Fetches) {
+	c.metrics.mu.Lock()
+	defer c.metrics.mu.Unlock()
+
+	fetches.EachPartition(func(p kgo.FetchTopicPartition) {
+		if len(p.Records) == 0 {
+			return
+		}
+		if c.metrics.lag == nil {
+			c.metrics.lag = make(map[string]int64)
+		}
+		next := p.Records[len(p.Records)-1].Offset + 1
+		lag := p.HighWatermark - next
+		if lag < 0 {
+			lag = 0
+		}
+		c.metrics.lag[fmt.Sprintf("%s/%d", p.Topic, p.Partition)] = lag
+	})
+}
+
+// skipRecord 记录被过滤的消息并标记其偏移量，避免重启后重复拉取
+func (c *consumerImpl) skipRecord(record *kgo.Record, filter string) {
+	c.metrics.mu.Lock()
+	c.metrics.filteredMessages++
+	if c.metrics.filteredBy == nil {
+		c.metrics.filteredBy = make(map[string]int64)
+	}
+	c.metrics.filteredBy[filter]++
+	c.metrics.mu.Unlock()
+
+	c.client.MarkCommitRecords(record)
+}
+
 // processRecord 处理单条消息
 func (c *consumerImpl) processRecord(ctx context.Context, record *kgo.Record, callback ConsumeCallback) {
 	// 更新指标
@@ -220,18 +410,33 @@ func (c *consumerImpl) processRecord(ctx context.Context, record *kgo.Record, ca
 
 	// 转换为标准消息格式
 	msg := &Message{
-		Topic:   record.Topic,
+		Topic:   c.topics.logical(record.Topic),
 		Key:     record.Key,
 		Value:   record.Value,
 		Headers: convertHeadersFromKgo(record.Headers),
 	}
+	if key, ok := msg.Headers[HeaderIdempotencyKey]; ok {
+		msg.IdempotencyKey = string(key)
+	}
 
 	// 从消息头中提取 trace_id 并注入到上下文中
 	traceID := extractTraceIDFromHeaders(record.Headers)
 	msgCtx := injectTraceID(ctx, traceID)
 
-	// 处理消息
-	err := callback(msgCtx, msg)
+	// 处理消息，载荷被卸载时先从对象存储取回，取回失败按处理失败对待
+	c.inflight.Add(1)
+	start := time.Now()
+	err := c.claimCheck.inline(msgCtx, msg)
+	if err == nil {
+		err = callback(msgCtx, msg)
+	}
+	elapsed := time.Since(start)
+	c.inflight.Add(-1)
+
+	c.metrics.mu.Lock()
+	c.metrics.handlerDuration += elapsed
+	c.metrics.mu.Unlock()
+
 	if err != nil {
 		c.metrics.mu.Lock()
 		c.metrics.failedMessages++
@@ -252,6 +457,9 @@ func (c *consumerImpl) processRecord(ctx context.Context, record *kgo.Record, ca
 	c.metrics.processedMessage++
 	c.metrics.mu.Unlock()
 
+	// 标记偏移量，由自动提交或关闭时的最终提交写回 Kafka
+	c.client.MarkCommitRecords(record)
+
 	c.logger.Debug("成功处理消息",
 		clog.String("topic", record.Topic),
 		clog.Int32("partition", record.Partition),
@@ -260,20 +468,84 @@ func (c *consumerImpl) processRecord(ctx context.Context, record *kgo.Record, ca
 	)
 }
 
-// Close 优雅地关闭消费者。
+// Close 优雅地关闭消费者，最长等待 ConsumerConfig.ShutdownTimeoutMs。
 func (c *consumerImpl) Close() error {
-	c.logger.Info("关闭 Kafka 消费者", clog.String("group_id", c.groupID))
+	ctx, cancel := context.WithTimeout(context.Background(), c.shutdownTimeout())
+	defer cancel()
+
+	_, err := c.Shutdown(ctx)
+	return err
+}
+
+// Shutdown 优雅地关闭消费者：停止拉取新消息，在 ctx 截止前等待正在处理的消息完成，
+// 提交最终偏移量后关闭客户端。重复调用将直接返回空报告。
+func (c *consumerImpl) Shutdown(ctx context.Context) (*ShutdownReport, error) {
+	if !c.closing.CompareAndSwap(false, true) {
+		return &ShutdownReport{}, nil
+	}
 
-	// 取消上下文
+	start := time.Now()
+	c.logger.Info("开始关闭 Kafka 消费者", clog.String("group_id", c.groupID))
+
+	// 取消上下文，停止拉取新消息
 	c.cancelContext()
 
-	// 等待所有 goroutine 完成
-	c.wg.Wait()
+	// 等待正在处理的消息完成
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		c.logger.Warn("等待消息处理完成超时，放弃剩余消息",
+			clog.String("group_id", c.groupID),
+			clog.Int64("inflight", c.inflight.Load()),
+		)
+	}
+
+	report := &ShutdownReport{
+		Abandoned: c.abandoned.Load() + c.inflight.Load(),
+	}
+
+	// 提交最终偏移量
+	var commitErr error
+	if c.config.ConsumerConfig.EnableAutoCommitOnClose {
+		commitCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), finalCommitTimeout)
+		commitErr = c.client.CommitMarkedOffsets(commitCtx)
+		cancel()
+		if commitErr != nil {
+			c.logger.Error("提交最终偏移量失败", clog.Err(commitErr), clog.String("group_id", c.groupID))
+		} else {
+			report.OffsetsCommitted = true
+		}
+	}
 
 	// 关闭客户端
 	c.client.Close()
 
-	return nil
+	report.Duration = time.Since(start)
+	c.logger.Info("Kafka 消费者已关闭",
+		clog.String("group_id", c.groupID),
+		clog.Int64("abandoned", report.Abandoned),
+		clog.Bool("offsets_committed", report.OffsetsCommitted),
+		clog.Duration("duration", report.Duration),
+	)
+
+	if commitErr != nil {
+		return report, ErrConsumer("提交最终偏移量失败", commitErr)
+	}
+	return report, nil
+}
+
+// shutdownTimeout 返回 Close 使用的默认关闭超时时间
+func (c *consumerImpl) shutdownTimeout() time.Duration {
+	if c.config.ConsumerConfig.ShutdownTimeoutMs > 0 {
+		return time.Duration(c.config.ConsumerConfig.ShutdownTimeoutMs) * time.Millisecond
+	}
+	return 10 * time.Second
 }
 
 // GetMetrics 获取消费者性能指标
@@ -287,13 +559,60 @@ func (c *consumerImpl) GetMetrics() map[string]interface{} {
 		successRate = float64(c.metrics.processedMessage) / float64(totalProcessed) * 100
 	}
 
-	return map[string]interface{}{
+	filteredBy := make(map[string]int64, len(c.metrics.filteredBy))
+	for name, count := range c.metrics.filteredBy {
+		filteredBy[name] = count
+	}
+
+	var lag int64
+	for _, partitionLag := range c.metrics.lag {
+		lag += partitionLag
+	}
+
+	metrics := map[string]interface{}{
 		"total_messages":     c.metrics.totalMessages,
 		"processed_messages": c.metrics.processedMessage,
 		"failed_messages":    c.metrics.failedMessages,
+		"filtered_messages":  c.metrics.filteredMessages,
+		"filtered_by":        filteredBy,
 		"total_bytes":        c.metrics.totalBytes,
+		"abandoned_messages": c.abandoned.Load(),
 		"success_rate":       successRate,
+		// 累计处理耗时，除以 processed_messages + failed_messages 得到平均耗时
+		"handler_duration_ms_total": float64(c.metrics.handlerDuration) / float64(time.Millisecond),
+		// 所有分区消费延迟之和
+		"consume_lag": lag,
+	}
+	c.chaos.addMetrics(metrics)
+	c.watchdog.addMetrics(metrics)
+	c.coldRead.addMetrics(metrics)
+	c.claimCheck.addMetrics(metrics)
+
+	return metrics
+}
+
+// addSubscription 和 removeSubscription 维护活跃订阅，供看门狗检查
+func (c *consumerImpl) addSubscription(sub *subscription) {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+	c.subscriptions[sub] = struct{}{}
+}
+
+func (c *consumerImpl) removeSubscription(sub *subscription) {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+	delete(c.subscriptions, sub)
+}
+
+// subscriptionList 返回当前活跃订阅的快照
+func (c *consumerImpl) subscriptionList() []*subscription {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+	subs := make([]*subscription, 0, len(c.subscriptions))
+	for sub := range c.subscriptions {
+		subs = append(subs, sub)
 	}
+	return subs
 }
 
 // Ping 检查消费者健康状态
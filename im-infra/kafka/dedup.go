@@ -0,0 +1,238 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/cache"
+	"github.com/ceyewan/gochat/im-infra/clog"
+)
+
+// 幂等发送使用的消息头
+const (
+	// HeaderIdempotencyKey 消息的幂等键，设置 Message.IdempotencyKey 时写入，供消费者去重
+	HeaderIdempotencyKey = "X-Idempotency-Key"
+	// HeaderDuplicate "flag" 模式下，窗口内重复发送的消息会带上该头，值为 "true"
+	HeaderDuplicate = "X-Duplicate"
+)
+
+// 重复发送的处理方式
+const (
+	// DedupModeSuppress 丢弃重复的消息，发送直接返回成功
+	DedupModeSuppress = "suppress"
+	// DedupModeFlag 仍然发送重复的消息，但带上 X-Duplicate 头，由消费者决定如何处理
+	DedupModeFlag = "flag"
+)
+
+// defaultDedupMaxKeys 内存存储默认最多记住的幂等键数
+const defaultDedupMaxKeys = 100000
+
+// DedupStore 记录最近发送过的幂等键。
+// 多实例部署时应使用共享存储（如 NewCacheDedupStore），否则只能抑制同一实例内的重复发送。
+type DedupStore interface {
+	// Claim 记录 key，窗口内首次出现时返回 true，已存在时返回 false
+	Claim(ctx context.Context, key string, window time.Duration) (bool, error)
+	// Release 删除 key，发送失败时调用，使应用层的重试可以重新发送
+	Release(ctx context.Context, key string) error
+}
+
+// producerDedup 生产者侧的重复发送抑制，未开启时为 nil，所有方法对 nil 安全
+type producerDedup struct {
+	config *DedupConfig
+	window time.Duration
+	store  DedupStore
+	logger clog.Logger
+
+	suppressed atomic.Int64
+	flagged    atomic.Int64
+	errors     atomic.Int64
+}
+
+// newProducerDedup 创建重复发送抑制，未配置时返回 nil。store 为 nil 时使用内存存储。
+func newProducerDedup(cfg *DedupConfig, store DedupStore, logger clog.Logger) *producerDedup {
+	if cfg == nil {
+		return nil
+	}
+	if store == nil {
+		store = newMemoryDedupStore(cfg.MaxKeys)
+	}
+	return &producerDedup{
+		config: cfg,
+		window: time.Duration(cfg.WindowMs) * time.Millisecond,
+		store:  store,
+		logger: logger,
+	}
+}
+
+// check 在发送前检查消息是否为窗口内的重复发送。
+// 返回 send 表示是否继续发送，claimed 表示本次发送占用了幂等键，发送失败时需要 release。
+// 存储不可用时放行消息，宁可重复也不丢消息。
+func (d *producerDedup) check(ctx context.Context, msg *Message) (send, claimed bool) {
+	if d == nil || msg.IdempotencyKey == "" {
+		return true, false
+	}
+
+	first, err := d.store.Claim(ctx, dedupKey(msg), d.window)
+	if err != nil {
+		d.errors.Add(1)
+		d.logger.Warn("幂等键存储不可用，跳过重复检查",
+			clog.String("topic", msg.Topic),
+			clog.String("idempotency_key", msg.IdempotencyKey),
+			clog.Err(err))
+		return true, false
+	}
+	if first {
+		return true, true
+	}
+
+	if d.config.Mode == DedupModeFlag {
+		d.flagged.Add(1)
+		msg.Headers[HeaderDuplicate] = []byte("true")
+		return true, false
+	}
+	d.suppressed.Add(1)
+	d.logger.Debug("抑制重复发送",
+		clog.String("topic", msg.Topic),
+		clog.String("idempotency_key", msg.IdempotencyKey))
+	return false, false
+}
+
+// release 发送失败后释放幂等键
+func (d *producerDedup) release(msg *Message) {
+	if d == nil {
+		return
+	}
+	// 发送失败时调用方的 ctx 可能已取消，释放仍需完成
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := d.store.Release(ctx, dedupKey(msg)); err != nil {
+		d.errors.Add(1)
+		d.logger.Warn("释放幂等键失败，窗口内的重试将被视为重复",
+			clog.String("topic", msg.Topic),
+			clog.String("idempotency_key", msg.IdempotencyKey),
+			clog.Err(err))
+	}
+}
+
+// releaseOnError 包装异步发送的回调，发送失败时先释放幂等键
+func (d *producerDedup) releaseOnError(msg *Message, callback func(error)) func(error) {
+	return func(err error) {
+		if err != nil {
+			d.release(msg)
+		}
+		if callback != nil {
+			callback(err)
+		}
+	}
+}
+
+// addMetrics 将重复发送统计写入 GetMetrics 的结果
+func (d *producerDedup) addMetrics(metrics map[string]interface{}) {
+	if d == nil {
+		return
+	}
+	metrics["dedup_suppressed"] = d.suppressed.Load()
+	metrics["dedup_flagged"] = d.flagged.Load()
+	metrics["dedup_errors"] = d.errors.Load()
+}
+
+// dedupKey 幂等键按主题隔离
+func dedupKey(msg *Message) string {
+	return msg.Topic + ":" + msg.IdempotencyKey
+}
+
+// memoryDedupStore 进程内的幂等键存储，超过 maxKeys 时淘汰最早写入的键
+type memoryDedupStore struct {
+	mu      sync.Mutex
+	maxKeys int
+	expires map[string]time.Time
+	// order 按写入顺序排列，窗口固定，因此也是过期顺序
+	order []memoryDedupEntry
+}
+
+type memoryDedupEntry struct {
+	key     string
+	expires time.Time
+}
+
+func newMemoryDedupStore(maxKeys int) *memoryDedupStore {
+	if maxKeys <= 0 {
+		maxKeys = defaultDedupMaxKeys
+	}
+	return &memoryDedupStore{
+		maxKeys: maxKeys,
+		expires: make(map[string]time.Time),
+	}
+}
+
+// Claim 实现 DedupStore
+func (s *memoryDedupStore) Claim(_ context.Context, key string, window time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.evict(now)
+	if expires, ok := s.expires[key]; ok && now.Before(expires) {
+		return false, nil
+	}
+
+	expires := now.Add(window)
+	s.expires[key] = expires
+	s.order = append(s.order, memoryDedupEntry{key: key, expires: expires})
+	return true, nil
+}
+
+// Release 实现 DedupStore
+func (s *memoryDedupStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.expires, key)
+	return nil
+}
+
+// evict 从队首移除已过期或超出容量的键。
+// 队列中的记录可能已被 Release 或被同一个键更晚的记录取代，此时只出队不删除。
+func (s *memoryDedupStore) evict(now time.Time) {
+	n := 0
+	for n < len(s.order) {
+		entry := s.order[n]
+		if now.Before(entry.expires) && len(s.expires) < s.maxKeys {
+			break
+		}
+		if expires, ok := s.expires[entry.key]; ok && expires.Equal(entry.expires) {
+			delete(s.expires, entry.key)
+		}
+		n++
+	}
+	if n > 0 {
+		s.order = append(s.order[:0], s.order[n:]...)
+	}
+}
+
+// cacheDedupStore 基于 cache 组件（Redis）的幂等键存储，多个生产者实例共享
+type cacheDedupStore struct {
+	provider cache.Provider
+	prefix   string
+}
+
+// NewCacheDedupStore 创建基于 cache 组件的幂等键存储，键为 "{prefix}{topic}:{idempotencyKey}"。
+//
+// 示例：
+//
+//	provider, err := kafka.NewProvider(ctx, config,
+//	    kafka.WithDedupStore(kafka.NewCacheDedupStore(cacheProvider, "kafka:dedup:")))
+func NewCacheDedupStore(provider cache.Provider, prefix string) DedupStore {
+	return &cacheDedupStore{provider: provider, prefix: prefix}
+}
+
+// Claim 实现 DedupStore，通过 SETNX 保证多个实例并发发送同一个键时只有一个成功
+func (s *cacheDedupStore) Claim(ctx context.Context, key string, window time.Duration) (bool, error) {
+	return s.provider.String().SetNX(ctx, s.prefix+key, "1", window)
+}
+
+// Release 实现 DedupStore
+func (s *cacheDedupStore) Release(ctx context.Context, key string) error {
+	return s.provider.String().Del(ctx, s.prefix+key)
+}
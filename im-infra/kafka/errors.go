@@ -32,6 +32,8 @@ const (
 	ErrCodeAdmin       = "ADMIN_ERROR"
 	ErrCodeTimeout     = "TIMEOUT_ERROR"
 	ErrCodeInvalidArg  = "INVALID_ARGUMENT"
+	ErrCodeSpillFull   = "SPILL_FULL"
+	ErrCodeChaos       = "CHAOS_INJECTED"
 )
 
 // ErrInvalidConfig 创建配置错误
@@ -95,6 +97,22 @@ func ErrInvalidArg(msg string) error {
 	}
 }
 
+// ErrSpillFull 创建本地队列已满错误
+func ErrSpillFull(msg string) error {
+	return &KafkaError{
+		Code:    ErrCodeSpillFull,
+		Message: msg,
+	}
+}
+
+// ErrChaos 创建故障注入产生的错误
+func ErrChaos(msg string) error {
+	return &KafkaError{
+		Code:    ErrCodeChaos,
+		Message: msg,
+	}
+}
+
 // IsConfigError 检查是否为配置错误
 func IsConfigError(err error) bool {
 	var kErr *KafkaError
@@ -135,4 +153,16 @@ func IsTimeoutError(err error) bool {
 func IsInvalidArgError(err error) bool {
 	var kErr *KafkaError
 	return err != nil && (errors.As(err, &kErr) && kErr.Code == ErrCodeInvalidArg)
-}
\ No newline at end of file
+}
+
+// IsSpillFullError 检查是否为本地队列已满错误
+func IsSpillFullError(err error) bool {
+	var kErr *KafkaError
+	return err != nil && (errors.As(err, &kErr) && kErr.Code == ErrCodeSpillFull)
+}
+
+// IsChaosError 检查是否为故障注入产生的错误
+func IsChaosError(err error) bool {
+	var kErr *KafkaError
+	return err != nil && (errors.As(err, &kErr) && kErr.Code == ErrCodeChaos)
+}
@@ -0,0 +1,130 @@
+package kafka
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// Filter 是订阅级的消息过滤器，在消息转换、指标统计和回调之前执行。
+// 被过滤的消息不会进入回调，其偏移量照常标记提交，并计入 filtered_messages 指标。
+// 多个过滤器之间是“与”的关系，按注册顺序短路执行，建议将开销小的 HeaderEquals、KeyPrefix 放在前面。
+type Filter struct {
+	name  string
+	match func(record *kgo.Record) bool
+}
+
+// Name 返回过滤器名称，用于 filtered_by 指标
+func (f Filter) Name() string {
+	return f.name
+}
+
+// HeaderEquals 只保留消息头 key 的值等于 value 的消息，缺少该消息头的消息会被过滤
+func HeaderEquals(key, value string) Filter {
+	return Filter{
+		name: fmt.Sprintf("header:%s=%s", key, value),
+		match: func(record *kgo.Record) bool {
+			for _, header := range record.Headers {
+				if header.Key == key {
+					return string(header.Value) == value
+				}
+			}
+			return false
+		},
+	}
+}
+
+// KeyPrefix 只保留消息 Key 以 prefix 开头的消息
+func KeyPrefix(prefix string) Filter {
+	p := []byte(prefix)
+	return Filter{
+		name: "key_prefix:" + prefix,
+		match: func(record *kgo.Record) bool {
+			return bytes.HasPrefix(record.Key, p)
+		},
+	}
+}
+
+// JSONPath 将消息体按 JSON 解析，取出 path 指向的值并交给 predicate 判断。
+// path 使用点号分隔，数组元素用下标表示，如 "payload.items.0.type"。
+// 数字按 json.Number 传入 predicate。消息体不是合法 JSON 或路径不存在时消息会被过滤。
+func JSONPath(path string, predicate func(value interface{}) bool) Filter {
+	segments := strings.Split(path, ".")
+	return Filter{
+		name: "json:" + path,
+		match: func(record *kgo.Record) bool {
+			value, ok := lookupJSONPath(record.Value, segments)
+			return ok && predicate(value)
+		},
+	}
+}
+
+// JSONPathEquals 只保留 JSON 消息体中 path 指向的值等于 expected 的消息。
+// 比较基于字符串形式，因此 JSONPathEquals("type", "image") 与 JSONPathEquals("level", 3) 均可使用。
+func JSONPathEquals(path string, expected interface{}) Filter {
+	want := fmt.Sprint(expected)
+	f := JSONPath(path, func(value interface{}) bool {
+		return fmt.Sprint(value) == want
+	})
+	f.name = fmt.Sprintf("json:%s=%s", path, want)
+	return f
+}
+
+// lookupJSONPath 解析 JSON 并按路径逐层查找
+func lookupJSONPath(data []byte, segments []string) (interface{}, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var current interface{}
+	if err := decoder.Decode(&current); err != nil {
+		return nil, false
+	}
+
+	for _, segment := range segments {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			value, ok := node[segment]
+			if !ok {
+				return nil, false
+			}
+			current = value
+		case []interface{}:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, false
+			}
+			current = node[index]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// SubscribeOption 定义了 Subscribe 的可选配置
+type SubscribeOption func(*subscribeOptions)
+
+type subscribeOptions struct {
+	filters []Filter
+}
+
+// WithFilters 为本次订阅添加消息过滤器，只有通过全部过滤器的消息才会进入回调
+func WithFilters(filters ...Filter) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.filters = append(o.filters, filters...)
+	}
+}
+
+// rejectedBy 返回第一个拒绝该消息的过滤器，全部通过时返回 false
+func rejectedBy(filters []Filter, record *kgo.Record) (string, bool) {
+	for _, f := range filters {
+		if !f.match(record) {
+			return f.name, true
+		}
+	}
+	return "", false
+}
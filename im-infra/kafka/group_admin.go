@@ -0,0 +1,294 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/twmb/franz-go/pkg/kadm"
+)
+
+// 偏移量重置策略
+const (
+	// OffsetResetEarliest 重置到分区最早的偏移量，重新消费所有保留的消息
+	OffsetResetEarliest = "earliest"
+	// OffsetResetLatest 重置到分区最新的偏移量，跳过所有积压的消息
+	OffsetResetLatest = "latest"
+	// OffsetResetTimestamp 重置到指定时间点之后的第一条消息，时间点之后没有消息时重置到最新
+	OffsetResetTimestamp = "timestamp"
+)
+
+// 消费者组状态
+const (
+	GroupStateEmpty = "Empty"
+	GroupStateDead  = "Dead"
+)
+
+// ConsumerGroup 描述一个消费者组的概要信息
+type ConsumerGroup struct {
+	Name string
+	// State 组状态，如 Empty、Stable、PreparingRebalance、Dead
+	State string
+	// ProtocolType 协议类型，普通消费者为 "consumer"
+	ProtocolType string
+}
+
+// ConsumerGroupDetail 描述消费者组的成员、分区分配和消费延迟
+type ConsumerGroupDetail struct {
+	Name     string
+	State    string
+	Protocol string
+	Members  []ConsumerGroupMember
+	// Lags 按 Topic、分区排序的每个分区的消费延迟
+	Lags []PartitionLag
+	// TotalLag 所有分区延迟之和，计算失败的分区不计入
+	TotalLag int64
+}
+
+// ConsumerGroupMember 描述消费者组中的一个成员及其分配到的分区
+type ConsumerGroupMember struct {
+	MemberID   string
+	ClientID   string
+	ClientHost string
+	// Assignments 分配给该成员的分区，Topic -> 分区列表
+	Assignments map[string][]int32
+}
+
+// PartitionLag 描述消费者组在单个分区上的消费进度
+type PartitionLag struct {
+	Topic     string
+	Partition int32
+	// MemberID 当前消费该分区的成员，组内无活跃成员时为空
+	MemberID string
+	// CommittedOffset 已提交的偏移量，-1 表示尚未提交
+	CommittedOffset int64
+	// EndOffset 分区的最新偏移量
+	EndOffset int64
+	// Lag 未消费的消息数，-1 表示无法计算（此时 Err 非空）
+	Lag int64
+	Err error
+}
+
+// OffsetReset 描述偏移量重置的目标位置
+type OffsetReset struct {
+	// Strategy 重置策略：OffsetResetEarliest、OffsetResetLatest 或 OffsetResetTimestamp
+	Strategy string
+	// Timestamp 策略为 OffsetResetTimestamp 时的目标时间点
+	Timestamp time.Time
+}
+
+// ResetToEarliest 返回重置到最早偏移量的 OffsetReset
+func ResetToEarliest() OffsetReset {
+	return OffsetReset{Strategy: OffsetResetEarliest}
+}
+
+// ResetToLatest 返回重置到最新偏移量的 OffsetReset
+func ResetToLatest() OffsetReset {
+	return OffsetReset{Strategy: OffsetResetLatest}
+}
+
+// ResetToTimestamp 返回重置到指定时间点的 OffsetReset
+func ResetToTimestamp(t time.Time) OffsetReset {
+	return OffsetReset{Strategy: OffsetResetTimestamp, Timestamp: t}
+}
+
+// validate 检查重置参数是否合法
+func (r OffsetReset) validate() error {
+	switch r.Strategy {
+	case OffsetResetEarliest, OffsetResetLatest:
+		return nil
+	case OffsetResetTimestamp:
+		if r.Timestamp.IsZero() {
+			return ErrInvalidArg("重置到时间点时必须指定 Timestamp")
+		}
+		return nil
+	default:
+		return ErrInvalidArg(fmt.Sprintf("未知的偏移量重置策略: %q", r.Strategy))
+	}
+}
+
+// ListConsumerGroups 列出集群中的所有消费者组，按名称排序
+func (a *adminImpl) ListConsumerGroups(ctx context.Context) ([]ConsumerGroup, error) {
+	listed, err := a.tm.kadmClient.ListGroups(ctx)
+	if err != nil {
+		a.logger.Error("列出消费者组失败", clog.Err(err))
+		return nil, ErrAdmin("列出消费者组失败", err)
+	}
+
+	groups := make([]ConsumerGroup, 0, len(listed))
+	for _, g := range listed.Sorted() {
+		groups = append(groups, ConsumerGroup{
+			Name:         g.Group,
+			State:        g.State,
+			ProtocolType: g.ProtocolType,
+		})
+	}
+	return groups, nil
+}
+
+// DescribeConsumerGroup 获取消费者组的成员、分区分配和每个分区的消费延迟
+func (a *adminImpl) DescribeConsumerGroup(ctx context.Context, group string) (*ConsumerGroupDetail, error) {
+	if group == "" {
+		return nil, ErrInvalidArg("消费者组名不能为空")
+	}
+
+	lags, err := a.tm.kadmClient.Lag(ctx, group)
+	if err != nil {
+		a.logger.Error("获取消费者组延迟失败", clog.String("group", group), clog.Err(err))
+		return nil, ErrAdmin("获取消费者组延迟失败", err)
+	}
+	lag, ok := lags[group]
+	if !ok {
+		return nil, ErrAdmin(fmt.Sprintf("消费者组不存在: %s", group), nil)
+	}
+	if err := lag.Error(); err != nil {
+		return nil, ErrAdmin("获取消费者组延迟失败", err)
+	}
+
+	return newConsumerGroupDetail(lag), nil
+}
+
+// newConsumerGroupDetail 将 kadm 的组延迟信息转换为 ConsumerGroupDetail
+func newConsumerGroupDetail(lag kadm.DescribedGroupLag) *ConsumerGroupDetail {
+	detail := &ConsumerGroupDetail{
+		Name:     lag.Group,
+		State:    lag.State,
+		Protocol: lag.Protocol,
+		Members:  make([]ConsumerGroupMember, 0, len(lag.Members)),
+	}
+
+	for _, m := range lag.Members {
+		member := ConsumerGroupMember{
+			MemberID:    m.MemberID,
+			ClientID:    m.ClientID,
+			ClientHost:  m.ClientHost,
+			Assignments: make(map[string][]int32),
+		}
+		if assigned, ok := m.Assigned.AsConsumer(); ok {
+			for _, t := range assigned.Topics {
+				partitions := append([]int32(nil), t.Partitions...)
+				sort.Slice(partitions, func(i, j int) bool { return partitions[i] < partitions[j] })
+				member.Assignments[t.Topic] = partitions
+			}
+		}
+		detail.Members = append(detail.Members, member)
+	}
+
+	for _, l := range lag.Lag.Sorted() {
+		partitionLag := PartitionLag{
+			Topic:           l.Topic,
+			Partition:       l.Partition,
+			CommittedOffset: l.Commit.At,
+			EndOffset:       l.End.Offset,
+			Lag:             l.Lag,
+			Err:             l.Err,
+		}
+		if l.Member != nil {
+			partitionLag.MemberID = l.Member.MemberID
+		}
+		if l.Lag > 0 {
+			detail.TotalLag += l.Lag
+		}
+		detail.Lags = append(detail.Lags, partitionLag)
+	}
+	return detail
+}
+
+// DeleteConsumerGroup 删除消费者组及其已提交的偏移量
+func (a *adminImpl) DeleteConsumerGroup(ctx context.Context, group string) error {
+	if group == "" {
+		return ErrInvalidArg("消费者组名不能为空")
+	}
+
+	resp, err := a.tm.kadmClient.DeleteGroup(ctx, group)
+	if err == nil {
+		err = resp.Err
+	}
+	if err != nil {
+		a.logger.Error("删除消费者组失败", clog.String("group", group), clog.Err(err))
+		return ErrAdmin("删除消费者组失败", err)
+	}
+
+	a.logger.Info("消费者组删除成功", clog.String("group", group))
+	return nil
+}
+
+// ResetOffsets 将消费者组在 topic 所有分区上的偏移量重置到目标位置。
+// Kafka 只允许在组内没有活跃成员时修改偏移量，因此需要先停止该组的所有消费者。
+func (a *adminImpl) ResetOffsets(ctx context.Context, group, topic string, to OffsetReset) (map[int32]int64, error) {
+	if group == "" || topic == "" {
+		return nil, ErrInvalidArg("消费者组名和 Topic 不能为空")
+	}
+	if err := to.validate(); err != nil {
+		return nil, err
+	}
+	topic, err := a.topics.physical(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.ensureGroupInactive(ctx, group); err != nil {
+		return nil, err
+	}
+
+	var listed kadm.ListedOffsets
+	switch to.Strategy {
+	case OffsetResetEarliest:
+		listed, err = a.tm.kadmClient.ListStartOffsets(ctx, topic)
+	case OffsetResetLatest:
+		listed, err = a.tm.kadmClient.ListEndOffsets(ctx, topic)
+	case OffsetResetTimestamp:
+		listed, err = a.tm.kadmClient.ListOffsetsAfterMilli(ctx, to.Timestamp.UnixMilli(), topic)
+	}
+	if err == nil {
+		err = listed.Error()
+	}
+	if err != nil {
+		a.logger.Error("查询目标偏移量失败", clog.String("topic", topic), clog.Err(err))
+		return nil, ErrAdmin("查询目标偏移量失败", err)
+	}
+
+	offsets := listed.Offsets()
+	committed, err := a.tm.kadmClient.CommitOffsets(ctx, group, offsets)
+	if err == nil {
+		err = committed.Error()
+	}
+	if err != nil {
+		a.logger.Error("提交重置偏移量失败",
+			clog.String("group", group),
+			clog.String("topic", topic),
+			clog.Err(err))
+		return nil, ErrAdmin("提交重置偏移量失败", err)
+	}
+
+	result := make(map[int32]int64)
+	offsets.Each(func(o kadm.Offset) {
+		result[o.Partition] = o.At
+	})
+
+	a.logger.Info("消费者组偏移量已重置",
+		clog.String("group", group),
+		clog.String("topic", topic),
+		clog.String("strategy", to.Strategy),
+		clog.Int("partitions", len(result)))
+	return result, nil
+}
+
+// ensureGroupInactive 检查消费者组内没有活跃成员，Kafka 只允许此时修改组的偏移量
+func (a *adminImpl) ensureGroupInactive(ctx context.Context, group string) error {
+	described, err := a.tm.kadmClient.DescribeGroups(ctx, group)
+	if err != nil {
+		return ErrAdmin("获取消费者组状态失败", err)
+	}
+	if g, ok := described[group]; ok {
+		if g.Err != nil {
+			return ErrAdmin("获取消费者组状态失败", g.Err)
+		}
+		if g.State != GroupStateEmpty && g.State != GroupStateDead {
+			return ErrAdmin(fmt.Sprintf("消费者组 %s 仍有活跃成员（状态 %s），请先停止消费者", group, g.State), nil)
+		}
+	}
+	return nil
+}
@@ -13,6 +13,11 @@ type Message struct {
 	Key     []byte
 	Value   []byte
 	Headers map[string][]byte
+	// Partition 目标分区，仅在主题使用 "manual" 分区策略时生效
+	Partition int32
+	// IdempotencyKey 可选的幂等键，发送时写入 X-Idempotency-Key 头，消费时从该头读取。
+	// 开启 ProducerConfig.Dedup 后，窗口内使用相同幂等键的重复发送会被抑制或标记。
+	IdempotencyKey string
 }
 
 // ConsumeCallback 定义了消息处理回调函数
@@ -23,12 +28,16 @@ type ConsumeCallback func(ctx context.Context, msg *Message) error
 type Provider interface {
 	Producer() ProducerOperations
 	Consumer(groupID string) ConsumerOperations
+	// Consumers 返回已创建的消费者，键为消费者组 ID
+	Consumers() map[string]ConsumerOperations
 	Admin() AdminOperations
 
 	// Ping 检查与 Kafka 集群的连接
 	Ping(ctx context.Context) error
 	// Close 关闭所有与 Kafka 的连接
 	Close() error
+	// Shutdown 在 ctx 截止前优雅关闭所有消费者，随后关闭生产者
+	Shutdown(ctx context.Context) error
 }
 
 // ProducerOperations 定义了生产者的操作接口
@@ -52,11 +61,16 @@ type ProducerOperations interface {
 // ConsumerOperations 定义了消费者的操作接口
 type ConsumerOperations interface {
 	// Subscribe 订阅消息并根据处理结果决定是否提交偏移量。
-	Subscribe(ctx context.Context, topics []string, callback ConsumeCallback) error
+	// 可通过 WithFilters 添加订阅级过滤器，被过滤的消息不会进入回调。
+	Subscribe(ctx context.Context, topics []string, callback ConsumeCallback, opts ...SubscribeOption) error
 
 	// Close 优雅地关闭消费者，完成当前正在处理的消息并提交最后一次偏移量。
 	Close() error
 
+	// Shutdown 优雅地关闭消费者：停止拉取，在 ctx 截止前等待正在处理的消息完成，
+	// 提交最终偏移量，并报告被放弃（将被重新投递）的消息数。
+	Shutdown(ctx context.Context) (*ShutdownReport, error)
+
 	// GetMetrics 获取性能指标
 	GetMetrics() map[string]interface{}
 
@@ -80,6 +94,26 @@ type AdminOperations interface {
 
 	// CreatePartitions 增加主题分区数
 	CreatePartitions(ctx context.Context, topic string, newPartitionCount int32) error
+
+	// ListConsumerGroups 列出集群中的所有消费者组
+	ListConsumerGroups(ctx context.Context) ([]ConsumerGroup, error)
+
+	// DescribeConsumerGroup 获取消费者组的成员、分区分配和每个分区的消费延迟
+	DescribeConsumerGroup(ctx context.Context, group string) (*ConsumerGroupDetail, error)
+
+	// DeleteConsumerGroup 删除消费者组及其已提交的偏移量，组内不能有活跃成员
+	DeleteConsumerGroup(ctx context.Context, group string) error
+
+	// ResetOffsets 将消费者组在 topic 所有分区上的偏移量重置到最早、最新或指定时间点，
+	// 组内不能有活跃成员。返回每个分区重置后的偏移量。
+	ResetOffsets(ctx context.Context, group, topic string, to OffsetReset) (map[int32]int64, error)
+
+	// ExportOffsets 导出消费者组已提交的偏移量快照，topics 为空时导出全部主题，快照可序列化为 JSON
+	ExportOffsets(ctx context.Context, group string, topics ...string) (*OffsetSnapshot, error)
+
+	// ImportOffsets 将偏移量快照提交到目标消费者组，支持改名和主题映射，可用于跨集群复制消费位置。
+	// 目标组内不能有活跃成员。
+	ImportOffsets(ctx context.Context, snapshot *OffsetSnapshot, opts OffsetImportOptions) (*OffsetImportResult, error)
 }
 
 // TopicDetail 包含主题的详细信息
@@ -112,11 +146,16 @@ type Producer interface {
 // 新代码建议使用 Provider.Consumer() 获取 ConsumerOperations
 type Consumer interface {
 	// Subscribe 订阅消息并根据处理结果决定是否提交偏移量。
-	Subscribe(ctx context.Context, topics []string, callback ConsumeCallback) error
+	// 可通过 WithFilters 添加订阅级过滤器，被过滤的消息不会进入回调。
+	Subscribe(ctx context.Context, topics []string, callback ConsumeCallback, opts ...SubscribeOption) error
 
 	// Close 优雅地关闭消费者，完成当前正在处理的消息并提交最后一次偏移量。
 	Close() error
 
+	// Shutdown 优雅地关闭消费者：停止拉取，在 ctx 截止前等待正在处理的消息完成，
+	// 提交最终偏移量，并报告被放弃（将被重新投递）的消息数。
+	Shutdown(ctx context.Context) (*ShutdownReport, error)
+
 	// GetMetrics 获取性能指标
 	GetMetrics() map[string]interface{}
 
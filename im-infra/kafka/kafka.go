@@ -2,6 +2,8 @@ package kafka
 
 import (
 	"context"
+	"fmt"
+	"sync"
 
 	"github.com/ceyewan/gochat/im-infra/clog"
 )
@@ -26,6 +28,13 @@ func NewProvider(ctx context.Context, config *Config, opts ...Option) (Provider,
 		return nil, err
 	}
 
+	if len(config.ValidateTopicsOnStart) > 0 {
+		if err := validateTopicsOnStart(ctx, producer.client, config, producer.topics, options.logger); err != nil {
+			producer.Close()
+			return nil, err
+		}
+	}
+
 	return &kafkaProvider{
 		config:   config,
 		options:  options,
@@ -66,6 +75,7 @@ type kafkaProvider struct {
 	config   *Config
 	options  *options
 	producer *producerImpl
+	mu       sync.Mutex
 	clients  map[string]*consumerImpl
 	logger   clog.Logger
 }
@@ -79,6 +89,9 @@ func (p *kafkaProvider) Consumer(groupID string) ConsumerOperations {
 		return nil
 	}
 
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
 	// 检查是否已存在该 groupID 的消费者
 	if cons, exists := p.clients[groupID]; exists {
 		return cons
@@ -95,8 +108,19 @@ func (p *kafkaProvider) Consumer(groupID string) ConsumerOperations {
 	return cons
 }
 
+func (p *kafkaProvider) Consumers() map[string]ConsumerOperations {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	consumers := make(map[string]ConsumerOperations, len(p.clients))
+	for groupID, cons := range p.clients {
+		consumers[groupID] = cons
+	}
+	return consumers
+}
+
 func (p *kafkaProvider) Admin() AdminOperations {
-	return newAdminImpl(p.config, p.logger)
+	return newAdminImpl(p.config, p.producer.topics, p.logger)
 }
 
 func (p *kafkaProvider) Ping(ctx context.Context) error {
@@ -107,6 +131,9 @@ func (p *kafkaProvider) Ping(ctx context.Context) error {
 func (p *kafkaProvider) Close() error {
 	p.logger.Info("正在关闭 Kafka Provider")
 
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
 	// 关闭所有消费者
 	for groupID, cons := range p.clients {
 		p.logger.Info("关闭消费者", clog.String("group_id", groupID))
@@ -123,6 +150,38 @@ func (p *kafkaProvider) Close() error {
 	return nil
 }
 
+func (p *kafkaProvider) Shutdown(ctx context.Context) error {
+	p.logger.Info("正在优雅关闭 Kafka Provider")
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// 先排空所有消费者，再关闭生产者，保证处理过程中产生的消息能够发出
+	var firstErr error
+	for groupID, cons := range p.clients {
+		report, err := cons.Shutdown(ctx)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if report != nil && report.Abandoned > 0 {
+			p.logger.Warn("消费者关闭时放弃了部分消息",
+				clog.String("group_id", groupID),
+				clog.Int64("abandoned", report.Abandoned),
+			)
+		}
+		delete(p.clients, groupID)
+	}
+
+	if p.producer != nil {
+		if err := p.producer.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	p.logger.Info("Kafka Provider 已关闭")
+	return firstErr
+}
+
 // validateConfig 验证配置
 func validateConfig(config *Config) error {
 	if config == nil {
@@ -154,6 +213,48 @@ func validateConfig(config *Config) error {
 		return ErrInvalidConfig("批处理大小必须大于 0")
 	}
 
+	if !isValidPartitioner(config.ProducerConfig.Partitioner) {
+		return ErrInvalidConfig("无效的分区策略，必须是 hash、sticky、round-robin 或 manual")
+	}
+	for topic, strategy := range config.ProducerConfig.TopicPartitioners {
+		if !isValidPartitioner(strategy) {
+			return ErrInvalidConfig(fmt.Sprintf("主题 %s 的分区策略无效: %s", topic, strategy))
+		}
+	}
+
+	if spill := config.ProducerConfig.Spill; spill != nil {
+		if spill.Dir == "" {
+			return ErrInvalidConfig("本地队列目录不能为空")
+		}
+		if spill.MaxBytes <= 0 {
+			return ErrInvalidConfig("本地队列最大字节数必须大于 0")
+		}
+		if spill.SegmentBytes < 0 || spill.MaxAgeMs < 0 || spill.FlushIntervalMs < 0 {
+			return ErrInvalidConfig("本地队列配置不能为负数")
+		}
+	}
+
+	if dedup := config.ProducerConfig.Dedup; dedup != nil {
+		if dedup.WindowMs <= 0 {
+			return ErrInvalidConfig("重复发送检查窗口必须大于 0")
+		}
+		if dedup.Mode != "" && dedup.Mode != DedupModeSuppress && dedup.Mode != DedupModeFlag {
+			return ErrInvalidConfig("无效的重复发送处理方式，必须是 suppress 或 flag")
+		}
+		if dedup.MaxKeys < 0 {
+			return ErrInvalidConfig("幂等键数量上限不能为负数")
+		}
+	}
+
+	if cc := config.ProducerConfig.ClaimCheck; cc != nil {
+		if cc.ThresholdBytes <= 0 {
+			return ErrInvalidConfig("大消息卸载阈值必须大于 0")
+		}
+		if cc.RetentionMs < 0 || cc.CleanupIntervalMs < 0 {
+			return ErrInvalidConfig("大消息卸载配置不能为负数")
+		}
+	}
+
 	// 验证消费者配置
 	validAutoOffsetReset := map[string]bool{
 		"earliest": true,
@@ -172,5 +273,24 @@ func validateConfig(config *Config) error {
 		return ErrInvalidConfig("会话超时必须大于 0")
 	}
 
-	return nil
+	// 验证启动主题检查配置
+	if tv := config.TopicValidation; tv != nil {
+		if tv.Policy != "" && tv.Policy != TopicValidationFailFast && tv.Policy != TopicValidationCreateMissing {
+			return ErrInvalidConfig("无效的主题检查策略，必须是 fail-fast 或 create-missing")
+		}
+		if tv.TimeoutMs < 0 {
+			return ErrInvalidConfig("主题检查超时不能为负数")
+		}
+	}
+	for _, topic := range config.ValidateTopicsOnStart {
+		if topic == "" {
+			return ErrInvalidConfig("启动检查的主题名不能为空")
+		}
+	}
+
+	if err := validateTopicNaming(config.TopicNaming); err != nil {
+		return err
+	}
+
+	return validateChaosConfig(config.Chaos)
 }
\ No newline at end of file
@@ -3,12 +3,17 @@ package kafka
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/ceyewan/gochat/im-infra/clog"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
 )
 
 func TestKafkaProducerConsumer(t *testing.T) {
@@ -218,4 +223,621 @@ func TestMessageStructure(t *testing.T) {
 	assert.Equal(t, "test-value", string(msg.Value))
 	assert.Equal(t, "trace-123", string(msg.Headers["X-Trace-ID"]))
 	assert.Equal(t, "application/json", string(msg.Headers["Content-Type"]))
-}
\ No newline at end of file
+}
+
+func TestSpillQueue(t *testing.T) {
+	dir := t.TempDir()
+
+	// 段文件很小，确保消息跨多个段
+	queue, err := openSpillQueue(dir, 1<<20, 256)
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		err := queue.append(&spillRecord{
+			Topic:      "chat-messages",
+			Key:        []byte(fmt.Sprintf("key-%d", i)),
+			Value:      []byte(fmt.Sprintf("value-%d", i)),
+			Headers:    []spillHeader{{Key: "X-Trace-ID", Value: []byte("trace-123")}},
+			EnqueuedAt: time.Now(),
+		})
+		require.NoError(t, err)
+	}
+	count, _ := queue.pending()
+	assert.Equal(t, int64(10), count)
+
+	// 回放前 4 条并提交
+	records, cursor, err := queue.peek(4)
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+	assert.Equal(t, "value-0", string(records[0].Value))
+	assert.Equal(t, []spillHeader{{Key: "X-Trace-ID", Value: []byte("trace-123")}}, records[0].Headers)
+	require.NoError(t, queue.commit(cursor, records))
+	require.NoError(t, queue.close())
+
+	// 重新打开后从游标位置继续
+	queue, err = openSpillQueue(dir, 1<<20, 256)
+	require.NoError(t, err)
+	count, _ = queue.pending()
+	assert.Equal(t, int64(6), count)
+
+	records, cursor, err = queue.peek(spillBatchSize)
+	require.NoError(t, err)
+	require.Len(t, records, 6)
+	assert.Equal(t, "value-4", string(records[0].Value))
+	assert.Equal(t, "value-9", string(records[5].Value))
+	require.NoError(t, queue.commit(cursor, records))
+
+	count, bytes := queue.pending()
+	assert.Equal(t, int64(0), count)
+	assert.Equal(t, int64(0), bytes)
+	require.NoError(t, queue.close())
+}
+
+func TestSpillQueueFull(t *testing.T) {
+	queue, err := openSpillQueue(t.TempDir(), 200, 0)
+	require.NoError(t, err)
+	defer queue.close()
+
+	rec := &spillRecord{Topic: "chat-messages", Value: make([]byte, 64), EnqueuedAt: time.Now()}
+	require.NoError(t, queue.append(rec))
+
+	err = queue.append(rec)
+	assert.True(t, IsSpillFullError(err))
+}
+
+func TestSpillRecordHeaders(t *testing.T) {
+	// 重复的键和原始顺序在写入本地队列并回放后保持不变
+	headers := []kgo.RecordHeader{
+		{Key: "X-Hop", Value: []byte("gateway")},
+		{Key: "X-Trace-ID", Value: []byte("trace-123")},
+		{Key: "X-Hop", Value: []byte("logic")},
+	}
+	queue, err := openSpillQueue(t.TempDir(), 1<<20, 0)
+	require.NoError(t, err)
+	defer queue.close()
+
+	require.NoError(t, queue.append(newSpillRecord(&kgo.Record{Topic: "chat-messages", Value: []byte("v"), Headers: headers})))
+	records, _, err := queue.peek(1)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, headers, records[0].toKgoRecord().Headers)
+}
+
+func TestPartitioner(t *testing.T) {
+	cfg := GetDefaultConfig("development").ProducerConfig
+	cfg.TopicPartitioners = map[string]string{"manual-topic": PartitionerManual}
+
+	partitioner := newPartitioner(cfg, map[string]PartitionFunc{
+		"legacy-topic": func(key []byte, n int) int { return len(key) - 10 },
+	}, nil)
+
+	// 自定义分区函数的负数返回值按取模处理：(4-10) mod 5 = 4
+	legacy := partitioner.ForTopic("legacy-topic")
+	assert.Equal(t, 4, legacy.Partition(&kgo.Record{Key: []byte("abcd")}, 5))
+
+	// manual 策略使用消息指定的分区
+	manual := partitioner.ForTopic("manual-topic")
+	assert.Equal(t, 2, manual.Partition(&kgo.Record{Key: []byte("abcd"), Partition: 2}, 5))
+
+	// 默认 hash 策略对相同 Key 选择相同分区
+	hash := partitioner.ForTopic("other-topic")
+	first := hash.Partition(&kgo.Record{Key: []byte("conversation-1")}, 8)
+	assert.Equal(t, first, hash.Partition(&kgo.Record{Key: []byte("conversation-1")}, 8))
+}
+
+func TestPartitionerValidation(t *testing.T) {
+	config := GetDefaultConfig("development")
+	config.ProducerConfig.TopicPartitioners = map[string]string{"chat-messages": "random"}
+	assert.Error(t, validateConfig(config))
+
+	config.ProducerConfig.TopicPartitioners = map[string]string{"chat-messages": PartitionerRoundRobin}
+	config.ProducerConfig.Partitioner = PartitionerSticky
+	assert.NoError(t, validateConfig(config))
+}
+
+func TestTopicValidation(t *testing.T) {
+	config := GetDefaultConfig("development")
+	config.TopicValidation = &TopicValidationConfig{Policy: "ignore"}
+	assert.True(t, IsConfigError(validateConfig(config)))
+
+	config.TopicValidation = &TopicValidationConfig{Policy: TopicValidationCreateMissing}
+	config.ValidateTopicsOnStart = []string{"gochat.messages.upstream", ""}
+	assert.True(t, IsConfigError(validateConfig(config)))
+
+	config.ValidateTopicsOnStart = []string{"gochat.messages.upstream"}
+	assert.NoError(t, validateConfig(config))
+	assert.Equal(t, TopicValidationFailFast, normalizeTopicValidation(nil).Policy)
+
+	details := kadm.TopicDetails{
+		"gochat.messages.upstream": {Topic: "gochat.messages.upstream", Partitions: kadm.PartitionDetails{0: {}, 1: {}}},
+		"gochat.mesages.persist":   {Topic: "gochat.mesages.persist", Err: kerr.UnknownTopicOrPartition},
+	}
+	missing, problems := checkTopicDetails(
+		[]string{"gochat.messages.upstream", "gochat.mesages.persist", "gochat.notifications"},
+		details,
+		map[string]int32{"gochat.messages.upstream": 3},
+	)
+	assert.Equal(t, []string{"gochat.mesages.persist", "gochat.notifications"}, missing)
+	require.Len(t, problems, 1)
+	assert.Contains(t, problems[0], "gochat.messages.upstream")
+}
+
+func TestFilter(t *testing.T) {
+	record := &kgo.Record{
+		Key:     []byte("group:42"),
+		Value:   []byte(`{"type":"image","payload":{"items":[{"size":3}]}}`),
+		Headers: []kgo.RecordHeader{{Key: "X-Event", Value: []byte("created")}},
+	}
+
+	assert.True(t, HeaderEquals("X-Event", "created").match(record))
+	assert.False(t, HeaderEquals("X-Event", "deleted").match(record))
+	assert.False(t, HeaderEquals("X-Missing", "").match(record))
+
+	assert.True(t, KeyPrefix("group:").match(record))
+	assert.False(t, KeyPrefix("user:").match(record))
+
+	assert.True(t, JSONPathEquals("type", "image").match(record))
+	assert.True(t, JSONPathEquals("payload.items.0.size", 3).match(record))
+	assert.False(t, JSONPathEquals("payload.items.1.size", 3).match(record))
+	assert.False(t, JSONPathEquals("type", "image").match(&kgo.Record{Value: []byte("not json")}))
+
+	// 按顺序短路，返回第一个拒绝的过滤器
+	name, rejected := rejectedBy([]Filter{KeyPrefix("group:"), JSONPathEquals("type", "text")}, record)
+	assert.True(t, rejected)
+	assert.Equal(t, "json:type=text", name)
+
+	_, rejected = rejectedBy(nil, record)
+	assert.False(t, rejected)
+}
+
+func TestConsumerGroupDetail(t *testing.T) {
+	assert.NoError(t, ResetToEarliest().validate())
+	assert.NoError(t, ResetToTimestamp(time.Now().Add(-time.Hour)).validate())
+	assert.True(t, IsInvalidArgError(OffsetReset{Strategy: OffsetResetTimestamp}.validate()))
+	assert.True(t, IsInvalidArgError(OffsetReset{Strategy: "middle"}.validate()))
+
+	member := kadm.DescribedGroupMember{MemberID: "member-1", ClientID: "im-task", ClientHost: "/10.0.0.3"}
+	detail := newConsumerGroupDetail(kadm.DescribedGroupLag{
+		Group:   "im-task-group",
+		State:   "Stable",
+		Members: []kadm.DescribedGroupMember{member},
+		Lag: kadm.GroupLag{
+			"chat-messages": {
+				1: {Member: &member, Topic: "chat-messages", Partition: 1, Commit: kadm.Offset{At: 80}, End: kadm.ListedOffset{Offset: 100}, Lag: 20},
+				0: {Member: &member, Topic: "chat-messages", Partition: 0, Commit: kadm.Offset{At: 50}, End: kadm.ListedOffset{Offset: 55}, Lag: 5},
+				2: {Topic: "chat-messages", Partition: 2, Commit: kadm.Offset{At: -1}, Lag: -1, Err: fmt.Errorf("list offsets failed")},
+			},
+		},
+	})
+
+	assert.Equal(t, "im-task-group", detail.Name)
+	require.Len(t, detail.Members, 1)
+	assert.Equal(t, "member-1", detail.Members[0].MemberID)
+	require.Len(t, detail.Lags, 3)
+	assert.Equal(t, int32(0), detail.Lags[0].Partition)
+	assert.Equal(t, "member-1", detail.Lags[0].MemberID)
+	assert.Empty(t, detail.Lags[2].MemberID)
+	assert.Error(t, detail.Lags[2].Err)
+	// 计算失败的分区不计入总延迟
+	assert.Equal(t, int64(25), detail.TotalLag)
+}
+
+func TestOffsetSnapshotImport(t *testing.T) {
+	prodNamer, err := newTopicNamer(&TopicNamingConfig{Env: "prod"}, "gochat")
+	require.NoError(t, err)
+	stagingNamer, err := newTopicNamer(&TopicNamingConfig{Env: "staging"}, "gochat")
+	require.NoError(t, err)
+
+	// 导出时记录逻辑主题名，不属于本命名空间的主题记录为 RawTopic
+	prod := &adminImpl{topics: prodNamer}
+	assert.Equal(t, "messages", prod.snapshotTopic("prod.gochat.messages"))
+	assert.Equal(t, RawTopic("legacy.events"), prod.snapshotTopic("legacy.events"))
+
+	snapshot := &OffsetSnapshot{Group: "im-task-group", Offsets: []PartitionOffset{
+		{Topic: "messages", Partition: 0, Offset: 120},
+		{Topic: "messages", Partition: 1, Offset: 5},
+		{Topic: "messages", Partition: 2, Offset: 900},
+		{Topic: "messages", Partition: 3, Offset: 10},
+		{Topic: "receipts", Partition: 0, Offset: 7},
+	}}
+
+	// 导入时按目标环境转换主题名，并应用主题映射和过滤
+	staging := &adminImpl{topics: stagingNamer}
+	wanted, err := staging.resolveSnapshotTopics(snapshot, OffsetImportOptions{
+		TopicMapping: map[string]string{"messages": "messages-replay"},
+		Topics:       []string{"messages"},
+	})
+	require.NoError(t, err)
+	require.Len(t, wanted, 1)
+	require.Len(t, wanted["staging.gochat.messages-replay"], 4)
+
+	_, err = staging.resolveSnapshotTopics(snapshot, OffsetImportOptions{Topics: []string{"unknown"}})
+	assert.True(t, IsInvalidArgError(err))
+
+	// 超出目标分区范围的偏移量被修正，目标不存在的分区被跳过
+	topic := "staging.gochat.messages-replay"
+	starts := kadm.ListedOffsets{topic: {
+		0: {Topic: topic, Partition: 0, Offset: 0},
+		1: {Topic: topic, Partition: 1, Offset: 50},
+		2: {Topic: topic, Partition: 2, Offset: 0},
+	}}
+	ends := kadm.ListedOffsets{topic: {
+		0: {Topic: topic, Partition: 0, Offset: 500},
+		1: {Topic: topic, Partition: 1, Offset: 500},
+		2: {Topic: topic, Partition: 2, Offset: 500},
+	}}
+	offsets, result := planOffsetImport(wanted, starts, ends)
+
+	require.Len(t, result.Applied, 3)
+	assert.Equal(t, int64(120), result.Applied[0].Offset)
+	assert.Equal(t, int64(50), result.Applied[1].Offset)
+	assert.Equal(t, int64(500), result.Applied[2].Offset)
+	assert.Equal(t, 2, result.Clamped)
+	require.Len(t, result.Skipped, 1)
+	assert.Equal(t, int32(3), result.Skipped[0].Partition)
+
+	o, ok := offsets.Lookup(topic, 1)
+	require.True(t, ok)
+	assert.Equal(t, int64(50), o.At)
+	assert.Equal(t, int32(-1), o.LeaderEpoch)
+}
+
+func TestWatchdogBacklog(t *testing.T) {
+	assert.NoError(t, validateWatchdogConfig(nil))
+	assert.NoError(t, validateWatchdogConfig(&WatchdogConfig{StallTimeoutMs: 60000}))
+	assert.True(t, IsConfigError(validateWatchdogConfig(&WatchdogConfig{})))
+	assert.True(t, IsConfigError(validateWatchdogConfig(&WatchdogConfig{StallTimeoutMs: 1000, CheckIntervalMs: -1})))
+
+	self := kadm.DescribedGroupMember{MemberID: "member-1"}
+	other := kadm.DescribedGroupMember{MemberID: "member-2"}
+	lag := kadm.GroupLag{
+		"chat-messages": {
+			0: {Member: &self, Commit: kadm.Offset{At: 50}, End: kadm.ListedOffset{Offset: 60}},
+			1: {Member: &other, Commit: kadm.Offset{At: 0}, End: kadm.ListedOffset{Offset: 100}},
+			2: {Commit: kadm.Offset{At: -1}, End: kadm.ListedOffset{Offset: 5}},
+			3: {Member: &self, Err: fmt.Errorf("list offsets failed")},
+		},
+		"other-topic": {
+			0: {Member: &self, Commit: kadm.Offset{At: 0}, End: kadm.ListedOffset{Offset: 1000}},
+		},
+	}
+
+	sub := newSubscription([]string{"chat-messages"}, []string{"chat-messages"})
+	// 只统计本成员负责和暂未分配的分区：10 + 5
+	assert.Equal(t, int64(15), sub.backlog(lag, "member-1"))
+
+	// 已处理但未提交的消息按本地进度扣除
+	sub.handled("chat-messages", 0, 59)
+	assert.Equal(t, int64(5), sub.backlog(lag, "member-1"))
+
+	sub.attempts.Store(3)
+	sub.handled("chat-messages", 2, 4)
+	assert.Equal(t, int64(0), sub.backlog(lag, "member-1"))
+	assert.Equal(t, int32(0), sub.attempts.Load())
+}
+
+func TestColdReadTracker(t *testing.T) {
+	assert.NoError(t, validateColdReadConfig(nil))
+	assert.True(t, IsConfigError(validateColdReadConfig(&ColdReadConfig{})))
+	assert.True(t, IsConfigError(validateColdReadConfig(&ColdReadConfig{LagThreshold: -1})))
+
+	var alerts []BacklogAlert
+	tracker := newColdReadTracker("group-1", &ColdReadConfig{
+		LagThreshold:        1000,
+		AgeThresholdMs:      60000,
+		MaxRecordsPerSecond: 50,
+		AlertBacklogAgeMs:   30000,
+	}, []BacklogAlertHandler{func(a BacklogAlert) { alerts = append(alerts, a) }},
+		clog.Namespace("kafka-test"), (*topicNamer)(nil).logical)
+
+	ctx := context.Background()
+	hw := map[string]int64{"chat-messages/0": 5000, "chat-messages/1": 10}
+
+	// 落后 4999 条超过消息数阈值，积压 40 秒超过告警阈值
+	old := &kgo.Record{Topic: "chat-messages", Partition: 0, Offset: 0, Timestamp: time.Now().Add(-40 * time.Second)}
+	require.NoError(t, tracker.observe(ctx, old, hw))
+	require.Len(t, alerts, 1)
+	assert.False(t, alerts[0].Resolved)
+	assert.Equal(t, "chat-messages", alerts[0].Topic)
+	assert.Equal(t, int64(4999), alerts[0].Lag)
+
+	// 冷读消息按 50 条/秒限速，第二条需要等待约 20ms
+	start := time.Now()
+	old.Offset = 1
+	require.NoError(t, tracker.observe(ctx, old, hw))
+	assert.GreaterOrEqual(t, time.Since(start), 15*time.Millisecond)
+
+	// 热分区不限速、不计入冷读
+	hot := &kgo.Record{Topic: "chat-messages", Partition: 1, Offset: 9, Timestamp: time.Now()}
+	require.NoError(t, tracker.observe(ctx, hot, hw))
+
+	metrics := map[string]interface{}{}
+	tracker.addMetrics(metrics)
+	assert.Equal(t, 1, metrics["cold_partitions"])
+	assert.Equal(t, int64(2), metrics["cold_records"])
+	assert.GreaterOrEqual(t, metrics["backlog_age_ms"].(float64), float64(40000))
+
+	// 追上最新位置后积压时长归零，告警解除
+	caughtUp := &kgo.Record{Topic: "chat-messages", Partition: 0, Offset: 4999, Timestamp: time.Now()}
+	require.NoError(t, tracker.observe(ctx, caughtUp, hw))
+	require.Len(t, alerts, 2)
+	assert.True(t, alerts[1].Resolved)
+
+	// 撤销的分区不再统计
+	tracker.revoke(map[string][]int32{"chat-messages": {0, 1}})
+	metrics = map[string]interface{}{}
+	tracker.addMetrics(metrics)
+	assert.Equal(t, 0, metrics["cold_partitions"])
+
+	// 未开启时为空操作
+	var disabled *coldReadTracker
+	assert.NoError(t, disabled.observe(ctx, old, nil))
+	disabled.addMetrics(metrics)
+}
+
+func TestChaosInjection(t *testing.T) {
+	t.Setenv("APP_ENV", "test")
+
+	config := GetDefaultConfig("development")
+	config.Chaos = &ChaosConfig{Enabled: true, SendErrorProbability: 1.5}
+	assert.True(t, IsConfigError(validateConfig(config)))
+
+	config.Chaos = &ChaosConfig{Enabled: true, SendLatencyProbability: 0.5}
+	assert.True(t, IsConfigError(validateConfig(config)))
+
+	config.Chaos = &ChaosConfig{
+		Enabled:                true,
+		Topics:                 []string{"gochat.messages.upstream"},
+		SendLatencyProbability: 1,
+		SendLatencyMs:          20,
+		SendErrorProbability:   1,
+		DuplicateProbability:   1,
+		Seed:                   42,
+	}
+	require.NoError(t, validateConfig(config))
+
+	// 生产环境以及未声明环境时拒绝开启
+	for _, env := range []string{"production", "", "qa"} {
+		t.Setenv("APP_ENV", env)
+		assert.True(t, IsConfigError(validateConfig(config)), env)
+	}
+	t.Setenv("APP_ENV", "staging")
+	require.NoError(t, validateConfig(config))
+	t.Setenv("APP_ENV", "test")
+
+	// 未开启时注入器为 nil，所有方法都不注入
+	var disabled *faultInjector
+	assert.NoError(t, disabled.beforeSend(context.Background(), "any"))
+	assert.False(t, disabled.duplicate("any"))
+	assert.False(t, disabled.rebalance())
+
+	producer, err := newProducerImpl(context.Background(), config, &options{logger: clog.Namespace("test")})
+	require.NoError(t, err)
+	defer producer.Close()
+
+	// 同步发送先等待注入的延迟，再返回注入的错误
+	start := time.Now()
+	err = producer.SendSync(context.Background(), &Message{Topic: "gochat.messages.upstream", Value: []byte("hi")})
+	assert.True(t, IsChaosError(err))
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+
+	// 异步发送直接通过回调返回注入的错误
+	errCh := make(chan error, 1)
+	producer.Send(context.Background(), &Message{Topic: "gochat.messages.upstream"}, func(err error) { errCh <- err })
+	assert.True(t, IsChaosError(<-errCh))
+
+	// 不在注入范围内的主题不受影响
+	assert.Equal(t, time.Duration(0), producer.chaos.sendLatency("gochat.notifications"))
+	assert.NoError(t, producer.chaos.sendError("gochat.notifications"))
+	assert.True(t, producer.chaos.duplicate("gochat.messages.upstream"))
+	assert.False(t, producer.chaos.duplicate("gochat.notifications"))
+
+	metrics := producer.GetMetrics()
+	assert.Equal(t, int64(2), metrics["chaos_send_errors"])
+	assert.Equal(t, int64(2), metrics["failed_messages"])
+}
+
+func TestProducerDedup(t *testing.T) {
+	t.Setenv("APP_ENV", "test")
+	ctx := context.Background()
+
+	config := GetDefaultConfig("development")
+	config.ProducerConfig.Dedup = &DedupConfig{WindowMs: 0}
+	assert.True(t, IsConfigError(validateConfig(config)))
+
+	config.ProducerConfig.Dedup = &DedupConfig{WindowMs: 1000, Mode: "drop"}
+	assert.True(t, IsConfigError(validateConfig(config)))
+
+	// 内存存储：窗口内重复、释放后可重新占用、过期后可重新占用
+	store := newMemoryDedupStore(2)
+	first, _ := store.Claim(ctx, "a", 50*time.Millisecond)
+	assert.True(t, first)
+	first, _ = store.Claim(ctx, "a", 50*time.Millisecond)
+	assert.False(t, first)
+	require.NoError(t, store.Release(ctx, "a"))
+	first, _ = store.Claim(ctx, "a", 50*time.Millisecond)
+	assert.True(t, first)
+	time.Sleep(60 * time.Millisecond)
+	first, _ = store.Claim(ctx, "a", time.Minute)
+	assert.True(t, first)
+
+	// 超过容量时淘汰最早写入的键
+	store.Claim(ctx, "b", time.Minute)
+	store.Claim(ctx, "c", time.Minute)
+	first, _ = store.Claim(ctx, "a", time.Minute)
+	assert.True(t, first)
+
+	// 发送失败时释放幂等键，应用层重试不会被误判为重复
+	config.ProducerConfig.Dedup = &DedupConfig{WindowMs: 60000}
+	config.Chaos = &ChaosConfig{Enabled: true, SendErrorProbability: 1}
+	require.NoError(t, validateConfig(config))
+
+	producer, err := newProducerImpl(ctx, config, &options{logger: clog.Namespace("test")})
+	require.NoError(t, err)
+	defer producer.Close()
+
+	msg := &Message{Topic: "gochat.messages.upstream", IdempotencyKey: "msg-1"}
+	assert.True(t, IsChaosError(producer.SendSync(ctx, msg)))
+	assert.Equal(t, []byte("msg-1"), msg.Headers[HeaderIdempotencyKey])
+	assert.True(t, IsChaosError(producer.SendSync(ctx, &Message{Topic: "gochat.messages.upstream", IdempotencyKey: "msg-1"})))
+
+	errCh := make(chan error, 1)
+	producer.Send(ctx, &Message{Topic: "gochat.messages.upstream", IdempotencyKey: "msg-1"}, func(err error) { errCh <- err })
+	assert.True(t, IsChaosError(<-errCh))
+
+	// 窗口内已发送过的键被抑制，直接返回成功
+	claimed, err := producer.dedup.store.Claim(ctx, "gochat.messages.upstream:msg-2", time.Minute)
+	require.NoError(t, err)
+	require.True(t, claimed)
+	assert.NoError(t, producer.SendSync(ctx, &Message{Topic: "gochat.messages.upstream", IdempotencyKey: "msg-2"}))
+	producer.Send(ctx, &Message{Topic: "gochat.messages.upstream", IdempotencyKey: "msg-2"}, func(err error) { errCh <- err })
+	assert.NoError(t, <-errCh)
+
+	// 其他主题的同名键不受影响
+	assert.True(t, IsChaosError(producer.SendSync(ctx, &Message{Topic: "gochat.notifications", IdempotencyKey: "msg-2"})))
+
+	metrics := producer.GetMetrics()
+	assert.Equal(t, int64(2), metrics["dedup_suppressed"])
+	assert.Equal(t, int64(4), metrics["total_messages"])
+
+	// flag 模式下重复的消息仍然发送，并带上 X-Duplicate 头
+	flagging := newProducerDedup(&DedupConfig{WindowMs: 60000, Mode: DedupModeFlag}, nil, clog.Namespace("test"))
+	dup := &Message{Topic: "t", IdempotencyKey: "k", Headers: map[string][]byte{}}
+	send, claimedKey := flagging.check(ctx, dup)
+	assert.True(t, send)
+	assert.True(t, claimedKey)
+	send, claimedKey = flagging.check(ctx, dup)
+	assert.True(t, send)
+	assert.False(t, claimedKey)
+	assert.Equal(t, []byte("true"), dup.Headers[HeaderDuplicate])
+}
+
+func TestTopicNaming(t *testing.T) {
+	t.Setenv("APP_ENV", "")
+	ctx := context.Background()
+
+	config := GetDefaultConfig("development")
+	config.TopicNaming = &TopicNamingConfig{}
+	assert.True(t, IsConfigError(validateConfig(config)))
+
+	config.TopicNaming = &TopicNamingConfig{Env: "dev", Namespace: "gochat.im"}
+	assert.True(t, IsConfigError(validateConfig(config)))
+
+	config.TopicNaming = &TopicNamingConfig{Env: "dev", Pattern: "("}
+	assert.True(t, IsConfigError(validateConfig(config)))
+
+	// WithNamespace 的命名空间作为主题前缀，已带前缀的主题不会重复添加
+	t.Setenv("APP_ENV", "dev")
+	cfg := &TopicNamingConfig{
+		Pattern:      `^[a-z]+(\.[a-z-]+)+$`,
+		ExemptTopics: []string{"shared.audit"},
+	}
+	namer, err := newTopicNamer(cfg, "gochat")
+	require.NoError(t, err)
+
+	name, err := namer.physical("messages")
+	require.NoError(t, err)
+	assert.Equal(t, "dev.gochat.messages", name)
+	name, _ = namer.physical("dev.gochat.messages")
+	assert.Equal(t, "dev.gochat.messages", name)
+	assert.Equal(t, "messages", namer.logical("dev.gochat.messages"))
+
+	name, _ = namer.physical(RawTopic("legacy.events"))
+	assert.Equal(t, "legacy.events", name)
+	name, _ = namer.physical("shared.audit")
+	assert.Equal(t, "shared.audit", name)
+	assert.True(t, namer.owns("shared.audit"))
+	assert.False(t, namer.owns("prod.gochat.messages"))
+
+	// 逻辑主题名转换回实际主题名后不变，其他命名空间的主题保留 RawTopic 标记
+	for _, topic := range []string{"dev.gochat.messages", "shared.audit", "legacy.events", "prod.gochat.messages"} {
+		name, err := namer.physical(namer.logical(topic))
+		require.NoError(t, err)
+		assert.Equal(t, topic, name)
+	}
+	assert.Equal(t, RawTopic("legacy.events"), namer.logical("legacy.events"))
+
+	_, err = namer.physical("Messages_V2")
+	assert.True(t, IsInvalidArgError(err))
+
+	// 不合法的主题名在发送前返回错误，不会访问 broker
+	config = GetDefaultConfig("development")
+	config.TopicNaming = cfg
+	require.NoError(t, validateConfig(config))
+
+	producer, err := newProducerImpl(ctx, config, &options{logger: clog.Namespace("test"), namespace: "gochat"})
+	require.NoError(t, err)
+	defer producer.Close()
+	assert.True(t, IsInvalidArgError(producer.SendSync(ctx, &Message{Topic: "Messages_V2"})))
+}
+
+func TestClaimCheck(t *testing.T) {
+	t.Setenv("APP_ENV", "test")
+	ctx := context.Background()
+
+	config := GetDefaultConfig("development")
+	config.ProducerConfig.ClaimCheck = &ClaimCheckConfig{ThresholdBytes: 0}
+	assert.True(t, IsConfigError(validateConfig(config)))
+
+	// 开启卸载时必须设置 BlobStore
+	config.ProducerConfig.ClaimCheck = &ClaimCheckConfig{ThresholdBytes: 16, KeyPrefix: "cc/", RetentionMs: 60000}
+	require.NoError(t, validateConfig(config))
+	_, err := newProducerImpl(ctx, config, &options{logger: clog.Namespace("test")})
+	assert.True(t, IsConfigError(err))
+
+	// 发送失败时删除已上传的载荷
+	store := NewMemoryBlobStore().(*memoryBlobStore)
+	config.Chaos = &ChaosConfig{Enabled: true, SendErrorProbability: 1}
+	producer, err := newProducerImpl(ctx, config, &options{logger: clog.Namespace("test"), blobStore: store})
+	require.NoError(t, err)
+	defer producer.Close()
+
+	large := []byte(strings.Repeat("x", 64))
+	msg := &Message{Topic: "gochat.media", Value: large}
+	assert.True(t, IsChaosError(producer.SendSync(ctx, msg)))
+	assert.Contains(t, string(msg.Headers[HeaderClaimCheck]), "cc/gochat.media/")
+	assert.Equal(t, large, msg.Value)
+
+	errCh := make(chan error, 1)
+	producer.Send(ctx, &Message{Topic: "gochat.media", Value: large}, func(err error) { errCh <- err })
+	assert.True(t, IsChaosError(<-errCh))
+
+	keys, _ := store.List(ctx, "cc/", time.Now().Add(time.Hour))
+	assert.Empty(t, keys)
+	metrics := producer.GetMetrics()
+	assert.Equal(t, int64(2), metrics["claim_check_offloaded"])
+
+	// 未超过阈值的载荷不卸载
+	small := &Message{Topic: "gochat.media", Value: []byte("hi"), Headers: map[string][]byte{}}
+	value, key, err := producer.claimCheck.offload(ctx, small)
+	require.NoError(t, err)
+	assert.Empty(t, key)
+	assert.Equal(t, []byte("hi"), value)
+
+	// 消费者取回载荷并移除 claim-check 头
+	sent := &Message{Topic: "gochat.media", Value: large, Headers: map[string][]byte{}}
+	value, key, err = producer.claimCheck.offload(ctx, sent)
+	require.NoError(t, err)
+	assert.Empty(t, value)
+	received := &Message{Topic: "gochat.media", Headers: sent.Headers}
+	reader := newConsumerClaimCheck(store, clog.Namespace("test"))
+	require.NoError(t, reader.inline(ctx, received))
+	assert.Equal(t, large, received.Value)
+	assert.NotContains(t, received.Headers, HeaderClaimCheck)
+	assert.NotContains(t, received.Headers, HeaderClaimCheckSize)
+
+	// 未设置 BlobStore 的消费者和取回失败都按处理失败对待
+	var missing *claimCheck
+	assert.True(t, IsConsumerError(missing.inline(ctx, &Message{Headers: map[string][]byte{HeaderClaimCheck: []byte(key)}})))
+	require.NoError(t, store.Delete(ctx, key))
+	assert.True(t, IsConsumerError(reader.inline(ctx, &Message{Headers: map[string][]byte{HeaderClaimCheck: []byte(key)}})))
+
+	// 超过保留时间的载荷被清理
+	store.now = func() time.Time { return time.Now().Add(-2 * time.Minute) }
+	require.NoError(t, store.Put(ctx, "cc/gochat.media/old", large))
+	store.now = time.Now
+	require.NoError(t, store.Put(ctx, "cc/gochat.media/new", large))
+	assert.Equal(t, 1, producer.claimCheck.cleanup(ctx, time.Now()))
+	keys, _ = store.List(ctx, "cc/", time.Now().Add(time.Hour))
+	assert.Equal(t, []string{"cc/gochat.media/new"}, keys)
+}
@@ -0,0 +1,147 @@
+package kafka
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// rawTopicMarker 标记不加命名空间前缀的主题，Kafka 主题名不允许包含该字符，因此不会与真实主题冲突
+const rawTopicMarker = "!"
+
+// RawTopic 返回不加命名空间前缀、原样使用的主题名，用于访问其他团队或遗留系统的共享主题。
+// 仍会按 TopicNamingConfig.Pattern 校验。
+//
+// 示例：
+//
+//	producer.SendSync(ctx, &kafka.Message{Topic: kafka.RawTopic("legacy.audit"), Value: data})
+func RawTopic(topic string) string {
+	return rawTopicMarker + topic
+}
+
+// topicNamer 在逻辑主题名与集群中的实际主题名之间转换，未配置 TopicNaming 时为 nil，所有方法对 nil 安全
+type topicNamer struct {
+	prefix  string
+	pattern *regexp.Regexp
+	exempt  map[string]bool
+}
+
+// newTopicNamer 创建主题命名转换器，未配置时返回 nil。
+// namespace 为 WithNamespace 设置的命名空间，仅在配置中未指定 Namespace 时使用。
+func newTopicNamer(cfg *TopicNamingConfig, namespace string) (*topicNamer, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	if err := validateTopicNaming(cfg); err != nil {
+		return nil, err
+	}
+
+	env := cfg.Env
+	if env == "" {
+		env = os.Getenv("APP_ENV")
+	}
+	if cfg.Namespace != "" {
+		namespace = cfg.Namespace
+	}
+
+	prefix := env + "."
+	if namespace != "" {
+		prefix += namespace + "."
+	}
+
+	n := &topicNamer{prefix: prefix}
+	if cfg.Pattern != "" {
+		n.pattern = regexp.MustCompile(cfg.Pattern)
+	}
+	if len(cfg.ExemptTopics) > 0 {
+		n.exempt = make(map[string]bool, len(cfg.ExemptTopics))
+		for _, topic := range cfg.ExemptTopics {
+			n.exempt[topic] = true
+		}
+	}
+	return n, nil
+}
+
+// validateTopicNaming 验证主题命名配置
+func validateTopicNaming(cfg *TopicNamingConfig) error {
+	if cfg == nil {
+		return nil
+	}
+	if cfg.Env == "" && os.Getenv("APP_ENV") == "" {
+		return ErrInvalidConfig("主题命名规范需要设置 env 或环境变量 APP_ENV")
+	}
+	for _, part := range []string{cfg.Env, cfg.Namespace} {
+		if strings.Contains(part, rawTopicMarker) || strings.Contains(part, ".") {
+			return ErrInvalidConfig(fmt.Sprintf("主题前缀中的环境和命名空间不能包含 '.' 或 '!': %s", part))
+		}
+	}
+	if cfg.Pattern != "" {
+		if _, err := regexp.Compile(cfg.Pattern); err != nil {
+			return ErrInvalidConfig(fmt.Sprintf("无效的主题名正则: %v", err))
+		}
+	}
+	return nil
+}
+
+// physical 将逻辑主题名转换为集群中的实际主题名并校验。
+// 已带前缀、RawTopic 标记或在豁免列表中的主题不再加前缀。
+func (n *topicNamer) physical(topic string) (string, error) {
+	if n == nil {
+		return topic, nil
+	}
+
+	name := topic
+	switch {
+	case strings.HasPrefix(topic, rawTopicMarker):
+		name = strings.TrimPrefix(topic, rawTopicMarker)
+	case n.exempt[topic], strings.HasPrefix(topic, n.prefix):
+	default:
+		name = n.prefix + topic
+	}
+
+	if name == "" {
+		return "", ErrInvalidArg("主题名不能为空")
+	}
+	if n.pattern != nil && !n.pattern.MatchString(name) {
+		return "", ErrInvalidArg(fmt.Sprintf("主题名 %s 不符合命名规范 %s", name, n.pattern.String()))
+	}
+	return name, nil
+}
+
+// physicalAll 批量转换主题名，任一主题不合法时返回错误
+func (n *topicNamer) physicalAll(topics []string) ([]string, error) {
+	if n == nil {
+		return topics, nil
+	}
+	names := make([]string, len(topics))
+	for i, topic := range topics {
+		name, err := n.physical(topic)
+		if err != nil {
+			return nil, err
+		}
+		names[i] = name
+	}
+	return names, nil
+}
+
+// logical 将集群中的实际主题名还原为逻辑主题名，保证 physical(logical(x)) == x：
+// 本命名空间的主题去掉前缀，豁免主题原样返回，其他主题以 RawTopic 形式返回
+func (n *topicNamer) logical(topic string) string {
+	switch {
+	case n == nil, n.exempt[topic]:
+		return topic
+	case strings.HasPrefix(topic, n.prefix):
+		return strings.TrimPrefix(topic, n.prefix)
+	default:
+		return RawTopic(topic)
+	}
+}
+
+// owns 判断实际主题是否属于本命名空间或在豁免列表中
+func (n *topicNamer) owns(topic string) bool {
+	if n == nil {
+		return true
+	}
+	return strings.HasPrefix(topic, n.prefix) || n.exempt[topic]
+}
@@ -0,0 +1,246 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/twmb/franz-go/pkg/kadm"
+)
+
+// OffsetSnapshot 是消费者组已提交偏移量的快照，可序列化为 JSON 保存，
+// 再通过 ImportOffsets 应用到另一个消费者组或另一个集群，用于将生产环境的消费位置复制到预发环境做回放测试。
+type OffsetSnapshot struct {
+	// Group 导出的消费者组
+	Group string `json:"group"`
+	// ExportedAt 导出时间
+	ExportedAt time.Time `json:"exportedAt"`
+	// Offsets 按 Topic、分区排序的偏移量。Topic 为逻辑主题名，
+	// 不属于本命名空间的主题以 RawTopic 形式记录，导入时按目标环境的 TopicNaming 重新转换
+	Offsets []PartitionOffset `json:"offsets"`
+}
+
+// PartitionOffset 是单个分区上的偏移量
+type PartitionOffset struct {
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	Offset    int64  `json:"offset"`
+	// Metadata 提交偏移量时附带的元数据
+	Metadata string `json:"metadata,omitempty"`
+}
+
+// OffsetImportOptions 控制偏移量快照的导入方式
+type OffsetImportOptions struct {
+	// Group 目标消费者组，为空时使用快照中的组名
+	Group string
+	// TopicMapping 逻辑主题名映射，快照中的主题 -> 目标主题，未列出的主题保持原名
+	TopicMapping map[string]string
+	// Topics 只导入这些主题（映射前的名称），为空时导入全部
+	Topics []string
+}
+
+// OffsetImportResult 描述偏移量快照的导入结果
+type OffsetImportResult struct {
+	// Group 实际写入的消费者组
+	Group string
+	// Applied 实际提交的偏移量，Topic 为目标集群中的实际主题名
+	Applied []PartitionOffset
+	// Clamped 超出目标分区偏移量范围、被修正到最早或最新位置的分区数。
+	// 两个集群的数据不一致时偏移量只能近似对应，该值较大说明回放位置与生产环境偏差较大
+	Clamped int
+	// Skipped 目标集群中不存在对应主题或分区而被跳过的偏移量，Topic 为快照中的名称
+	Skipped []PartitionOffset
+}
+
+// ExportOffsets 导出消费者组已提交的偏移量，topics 为空时导出全部主题
+func (a *adminImpl) ExportOffsets(ctx context.Context, group string, topics ...string) (*OffsetSnapshot, error) {
+	if group == "" {
+		return nil, ErrInvalidArg("消费者组名不能为空")
+	}
+	physical, err := a.topics.physicalAll(topics)
+	if err != nil {
+		return nil, err
+	}
+
+	var fetched kadm.OffsetResponses
+	if len(physical) > 0 {
+		fetched, err = a.tm.kadmClient.FetchOffsetsForTopics(ctx, group, physical...)
+	} else {
+		fetched, err = a.tm.kadmClient.FetchOffsets(ctx, group)
+	}
+	if err == nil {
+		err = fetched.Error()
+	}
+	if err != nil {
+		a.logger.Error("获取消费者组偏移量失败", clog.String("group", group), clog.Err(err))
+		return nil, ErrAdmin("获取消费者组偏移量失败", err)
+	}
+
+	snapshot := &OffsetSnapshot{Group: group, ExportedAt: time.Now()}
+	fetched.Each(func(r kadm.OffsetResponse) {
+		// FetchOffsetsForTopics 对未提交的分区返回 -1
+		if r.At < 0 {
+			return
+		}
+		snapshot.Offsets = append(snapshot.Offsets, PartitionOffset{
+			Topic:     a.snapshotTopic(r.Topic),
+			Partition: r.Partition,
+			Offset:    r.At,
+			Metadata:  r.Metadata,
+		})
+	})
+	if len(snapshot.Offsets) == 0 {
+		return nil, ErrAdmin(fmt.Sprintf("消费者组 %s 没有已提交的偏移量", group), nil)
+	}
+	sortPartitionOffsets(snapshot.Offsets)
+
+	a.logger.Info("消费者组偏移量已导出",
+		clog.String("group", group),
+		clog.Int("partitions", len(snapshot.Offsets)))
+	return snapshot, nil
+}
+
+// ImportOffsets 将偏移量快照提交到目标消费者组。
+// 快照通常来自另一个集群，偏移量超出目标分区范围时修正到最早或最新位置，目标集群不存在的分区被跳过。
+// 与 ResetOffsets 一样，目标组内不能有活跃成员。
+func (a *adminImpl) ImportOffsets(ctx context.Context, snapshot *OffsetSnapshot, opts OffsetImportOptions) (*OffsetImportResult, error) {
+	if snapshot == nil || len(snapshot.Offsets) == 0 {
+		return nil, ErrInvalidArg("偏移量快照不能为空")
+	}
+	group := opts.Group
+	if group == "" {
+		group = snapshot.Group
+	}
+	if group == "" {
+		return nil, ErrInvalidArg("消费者组名不能为空")
+	}
+	if err := a.ensureGroupInactive(ctx, group); err != nil {
+		return nil, err
+	}
+
+	wanted, err := a.resolveSnapshotTopics(snapshot, opts)
+	if err != nil {
+		return nil, err
+	}
+	topics := make([]string, 0, len(wanted))
+	for topic := range wanted {
+		topics = append(topics, topic)
+	}
+
+	starts, err := a.tm.kadmClient.ListStartOffsets(ctx, topics...)
+	if err != nil {
+		return nil, ErrAdmin("查询目标分区偏移量范围失败", err)
+	}
+	ends, err := a.tm.kadmClient.ListEndOffsets(ctx, topics...)
+	if err != nil {
+		return nil, ErrAdmin("查询目标分区偏移量范围失败", err)
+	}
+
+	offsets, result := planOffsetImport(wanted, starts, ends)
+	result.Group = group
+	if len(offsets) == 0 {
+		return nil, ErrAdmin("目标集群中没有快照对应的分区", nil)
+	}
+
+	committed, err := a.tm.kadmClient.CommitOffsets(ctx, group, offsets)
+	if err == nil {
+		err = committed.Error()
+	}
+	if err != nil {
+		a.logger.Error("提交导入的偏移量失败", clog.String("group", group), clog.Err(err))
+		return nil, ErrAdmin("提交导入的偏移量失败", err)
+	}
+
+	a.logger.Info("消费者组偏移量已导入",
+		clog.String("source_group", snapshot.Group),
+		clog.String("group", group),
+		clog.Int("applied", len(result.Applied)),
+		clog.Int("clamped", result.Clamped),
+		clog.Int("skipped", len(result.Skipped)))
+	return result, nil
+}
+
+// snapshotTopic 返回实际主题名在快照中的记录形式
+func (a *adminImpl) snapshotTopic(topic string) string {
+	return a.topics.logical(topic)
+}
+
+// resolveSnapshotTopics 按 TopicMapping 和 TopicNaming 将快照中的偏移量归类到目标集群的实际主题下
+func (a *adminImpl) resolveSnapshotTopics(snapshot *OffsetSnapshot, opts OffsetImportOptions) (map[string][]PartitionOffset, error) {
+	var only map[string]bool
+	if len(opts.Topics) > 0 {
+		only = make(map[string]bool, len(opts.Topics))
+		for _, topic := range opts.Topics {
+			only[topic] = true
+		}
+	}
+
+	wanted := make(map[string][]PartitionOffset)
+	for _, o := range snapshot.Offsets {
+		if only != nil && !only[o.Topic] {
+			continue
+		}
+		if o.Offset < 0 {
+			return nil, ErrInvalidArg(fmt.Sprintf("快照中 %s[%d] 的偏移量无效: %d", o.Topic, o.Partition, o.Offset))
+		}
+		target := o.Topic
+		if mapped, ok := opts.TopicMapping[o.Topic]; ok {
+			target = mapped
+		}
+		physical, err := a.topics.physical(target)
+		if err != nil {
+			return nil, err
+		}
+		wanted[physical] = append(wanted[physical], o)
+	}
+	if len(wanted) == 0 {
+		return nil, ErrInvalidArg("快照中没有需要导入的主题")
+	}
+	return wanted, nil
+}
+
+// planOffsetImport 将快照偏移量限制在目标分区的 [start, end] 范围内，返回待提交的偏移量和导入结果。
+// wanted 的键为目标集群中的实际主题名
+func planOffsetImport(wanted map[string][]PartitionOffset, starts, ends kadm.ListedOffsets) (kadm.Offsets, *OffsetImportResult) {
+	offsets := make(kadm.Offsets)
+	result := &OffsetImportResult{}
+	for topic, partitions := range wanted {
+		for _, o := range partitions {
+			start, okStart := starts.Lookup(topic, o.Partition)
+			end, okEnd := ends.Lookup(topic, o.Partition)
+			if !okStart || !okEnd || start.Err != nil || end.Err != nil {
+				result.Skipped = append(result.Skipped, o)
+				continue
+			}
+
+			at := o.Offset
+			switch {
+			case at < start.Offset:
+				at = start.Offset
+			case at > end.Offset:
+				at = end.Offset
+			}
+			if at != o.Offset {
+				result.Clamped++
+			}
+			// 目标集群的 leader epoch 与快照来源无关，不做校验
+			offsets.Add(kadm.Offset{Topic: topic, Partition: o.Partition, At: at, LeaderEpoch: -1, Metadata: o.Metadata})
+			result.Applied = append(result.Applied, PartitionOffset{Topic: topic, Partition: o.Partition, Offset: at, Metadata: o.Metadata})
+		}
+	}
+	sortPartitionOffsets(result.Applied)
+	sortPartitionOffsets(result.Skipped)
+	return offsets, result
+}
+
+// sortPartitionOffsets 按 Topic、分区排序
+func sortPartitionOffsets(offsets []PartitionOffset) {
+	sort.Slice(offsets, func(i, j int) bool {
+		if offsets[i].Topic != offsets[j].Topic {
+			return offsets[i].Topic < offsets[j].Topic
+		}
+		return offsets[i].Partition < offsets[j].Partition
+	})
+}
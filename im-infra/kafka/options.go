@@ -6,7 +6,15 @@ import (
 
 // options 定义了用于定制 kafka Producer/Consumer 的选项
 type options struct {
-	logger clog.Logger
+	logger         clog.Logger
+	partitionFuncs map[string]PartitionFunc
+	dedupStore     DedupStore
+	blobStore      BlobStore
+	namespace      string
+	// watchdogHandlers 看门狗事件回调
+	watchdogHandlers []WatchdogHandler
+	// backlogAlertHandlers 积压告警回调
+	backlogAlertHandlers []BacklogAlertHandler
 }
 
 // Option 定义了用于定制 kafka Producer/Consumer 的函数。
@@ -19,9 +27,39 @@ func WithLogger(logger clog.Logger) Option {
 	}
 }
 
-// WithNamespace 使用指定的命名空间创建 logger
+// WithNamespace 使用指定的命名空间创建 logger。
+// 配置了 TopicNaming 且未指定 TopicNaming.Namespace 时，该命名空间同时作为主题名前缀的一部分。
 func WithNamespace(namespace string) Option {
 	return func(o *options) {
 		o.logger = clog.Namespace(namespace)
+		o.namespace = namespace
 	}
-}
\ No newline at end of file
+}
+
+// WithPartitionFunc 为指定主题注册自定义分区函数，优先级高于配置中的分区策略。
+// 适用于需要与遗留系统保持一致分区规则的场景，例如按会话 ID 使用固定的哈希算法。
+func WithPartitionFunc(topic string, fn PartitionFunc) Option {
+	return func(o *options) {
+		if o.partitionFuncs == nil {
+			o.partitionFuncs = make(map[string]PartitionFunc)
+		}
+		o.partitionFuncs[topic] = fn
+	}
+}
+
+// WithDedupStore 设置生产者记录幂等键的存储，仅在配置了 ProducerConfig.Dedup 时生效。
+// 默认使用进程内存储，多实例部署时应使用共享存储，如 NewCacheDedupStore。
+func WithDedupStore(store DedupStore) Option {
+	return func(o *options) {
+		o.dedupStore = store
+	}
+}
+
+// WithBlobStore 设置存放大消息载荷的对象存储。
+// 生产者配置了 ProducerConfig.ClaimCheck 时必须设置；消费者设置后会自动取回被卸载的载荷，
+// 未设置时收到带 X-Claim-Check 头的消息按处理失败对待。
+func WithBlobStore(store BlobStore) Option {
+	return func(o *options) {
+		o.blobStore = store
+	}
+}
@@ -0,0 +1,88 @@
+package kafka
+
+import (
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// 分区策略，用于 ProducerConfig.Partitioner 和 ProducerConfig.TopicPartitioners
+const (
+	// PartitionerHash 按消息 Key 的 murmur2 哈希选择分区，与 Java 客户端默认行为一致；
+	// 没有 Key 的消息使用粘滞分区。这是默认策略。
+	PartitionerHash = "hash"
+	// PartitionerSticky 忽略 Key，批次写满后才切换分区，吞吐最高但不保证同 Key 有序
+	PartitionerSticky = "sticky"
+	// PartitionerRoundRobin 忽略 Key，逐条轮询所有分区，分布最均匀
+	PartitionerRoundRobin = "round-robin"
+	// PartitionerManual 使用 Message.Partition 指定的分区，分区号无效时发送失败
+	PartitionerManual = "manual"
+)
+
+// PartitionFunc 是自定义分区函数，根据消息 Key 和分区数返回目标分区。
+// 返回值超出 [0, numPartitions) 时按取模处理。没有 Key 的消息不会调用该函数，而是使用粘滞分区。
+type PartitionFunc func(key []byte, numPartitions int) int
+
+// isValidPartitioner 检查分区策略名称是否合法，空字符串表示使用默认策略
+func isValidPartitioner(strategy string) bool {
+	switch strategy {
+	case "", PartitionerHash, PartitionerSticky, PartitionerRoundRobin, PartitionerManual:
+		return true
+	}
+	return false
+}
+
+// topicPartitioner 按主题选择分区器：自定义函数 > 主题策略 > 默认策略
+type topicPartitioner struct {
+	fallback kgo.Partitioner
+	topics   map[string]kgo.Partitioner
+	// namer 将实际主题名还原为逻辑主题名，配置中的主题均为逻辑主题名
+	namer *topicNamer
+}
+
+// ForTopic 实现 kgo.Partitioner，franz-go 对每个主题只调用一次
+func (p *topicPartitioner) ForTopic(topic string) kgo.TopicPartitioner {
+	if partitioner, ok := p.topics[p.namer.logical(topic)]; ok {
+		return partitioner.ForTopic(topic)
+	}
+	return p.fallback.ForTopic(topic)
+}
+
+// newPartitioner 根据生产者配置和自定义分区函数构建分区器
+func newPartitioner(cfg *ProducerConfig, funcs map[string]PartitionFunc, namer *topicNamer) kgo.Partitioner {
+	p := &topicPartitioner{
+		fallback: partitionerFor(cfg.Partitioner),
+		topics:   make(map[string]kgo.Partitioner, len(cfg.TopicPartitioners)+len(funcs)),
+		namer:    namer,
+	}
+	for topic, strategy := range cfg.TopicPartitioners {
+		p.topics[topic] = partitionerFor(strategy)
+	}
+	for topic, fn := range funcs {
+		p.topics[topic] = kgo.StickyKeyPartitioner(kgo.PartitionerHasher(boundedPartitionFunc(fn)))
+	}
+	return p
+}
+
+// partitionerFor 返回分区策略对应的 franz-go 分区器
+func partitionerFor(strategy string) kgo.Partitioner {
+	switch strategy {
+	case PartitionerSticky:
+		return kgo.StickyPartitioner()
+	case PartitionerRoundRobin:
+		return kgo.RoundRobinPartitioner()
+	case PartitionerManual:
+		return kgo.ManualPartitioner()
+	default:
+		return kgo.StickyKeyPartitioner(nil)
+	}
+}
+
+// boundedPartitionFunc 将自定义分区函数的返回值约束在合法范围内
+func boundedPartitionFunc(fn PartitionFunc) PartitionFunc {
+	return func(key []byte, numPartitions int) int {
+		partition := fn(key, numPartitions) % numPartitions
+		if partition < 0 {
+			partition += numPartitions
+		}
+		return partition
+	}
+}
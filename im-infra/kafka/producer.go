@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ceyewan/gochat/im-infra/clog"
@@ -16,6 +17,27 @@ type producerImpl struct {
 	config *Config
 	logger clog.Logger
 	metrics producerMetrics
+
+	// 本地磁盘缓冲，未开启时为 nil
+	spill       *spillQueue
+	outage      atomic.Bool // broker 是否处于不可用状态
+	spillCancel context.CancelFunc
+	spillWG     sync.WaitGroup
+
+	// batches 统计写入 broker 的批次
+	batches *batchHook
+
+	// chaos 故障注入，未开启时为 nil
+	chaos *faultInjector
+
+	// dedup 重复发送抑制，未开启时为 nil
+	dedup *producerDedup
+
+	// claimCheck 大消息卸载，未开启时为 nil
+	claimCheck *claimCheck
+
+	// topics 主题命名转换，未配置 TopicNaming 时为 nil
+	topics *topicNamer
 }
 
 // producerMetrics 生产者性能指标
@@ -24,7 +46,36 @@ type producerMetrics struct {
 	totalBytes      int64
 	successMessages int64
 	failedMessages  int64
-	mu              sync.RWMutex
+	// 本地缓冲指标
+	spilledMessages  int64 // 写入本地队列的消息数
+	replayedMessages int64 // 从本地队列回放成功的消息数
+	expiredMessages  int64 // 在本地队列中超时被丢弃的消息数
+	rejectedMessages int64 // 本地队列已满被拒绝的消息数
+	// 发送延迟指标，仅统计直接发送到 broker 成功的消息
+	sendLatencyTotal time.Duration
+	sendLatencyCount int64
+	mu               sync.RWMutex
+}
+
+// batchHook 通过 franz-go 钩子统计成功写入的批次数和批次内的消息数
+type batchHook struct {
+	batches atomic.Int64
+	records atomic.Int64
+}
+
+// OnProduceBatchWritten 实现 kgo.HookProduceBatchWritten
+func (h *batchHook) OnProduceBatchWritten(_ kgo.BrokerMetadata, _ string, _ int32, m kgo.ProduceBatchMetrics) {
+	h.batches.Add(1)
+	h.records.Add(int64(m.NumRecords))
+}
+
+// recordSendLatency 记录一次成功发送的延迟
+func (m *producerMetrics) recordSendLatency(latency time.Duration) {
+	m.mu.Lock()
+	m.successMessages++
+	m.sendLatencyTotal += latency
+	m.sendLatencyCount++
+	m.mu.Unlock()
 }
 
 // newProducerImpl 创建一个新的消息生产者实例。
@@ -39,18 +90,37 @@ func newProducerImpl(ctx context.Context, config *Config, opts *options) (*produ
 		return nil, fmt.Errorf("生产者配置不能为空")
 	}
 
+	topics, err := newTopicNamer(config.TopicNaming, opts.namespace)
+	if err != nil {
+		return nil, err
+	}
+
 	// 构建 franz-go 客户端配置
 	kgoOpts := buildProducerOpts(config.ProducerConfig)
+	kgoOpts = append(kgoOpts, kgo.RecordPartitioner(newPartitioner(config.ProducerConfig, opts.partitionFuncs, topics)))
 
 	// 设置 brokers
 	kgoOpts = append(kgoOpts, kgo.SeedBrokers(config.Brokers...))
 
+	batches := &batchHook{}
+	kgoOpts = append(kgoOpts, kgo.WithHooks(batches))
+
 	// 设置安全协议（暂时只支持 PLAINTEXT）
 	if config.SecurityProtocol != "PLAINTEXT" {
 		// TODO: 后续可以扩展支持 SSL/SASL 配置
 		// 当前只支持 PLAINTEXT 协议
 	}
 
+	chaos, err := newFaultInjector(config.Chaos, opts.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	claimCheck, err := newProducerClaimCheck(config.ProducerConfig.ClaimCheck, opts.blobStore, opts.logger)
+	if err != nil {
+		return nil, err
+	}
+
 	client, err := kgo.NewClient(kgoOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("创建 Kafka 客户端失败: %w", err)
@@ -61,8 +131,23 @@ func newProducerImpl(ctx context.Context, config *Config, opts *options) (*produ
 		config:  config,
 		logger:  opts.logger,
 		metrics: producerMetrics{},
+		batches: batches,
+		chaos:   chaos,
+		dedup:   newProducerDedup(config.ProducerConfig.Dedup, opts.dedupStore, opts.logger),
+		topics:  topics,
+
+		claimCheck: claimCheck,
+	}
+
+	if spillCfg := config.ProducerConfig.Spill; spillCfg != nil {
+		if err := producer.startSpill(spillCfg); err != nil {
+			client.Close()
+			return nil, err
+		}
 	}
 
+	producer.claimCheck.startCleanup()
+
 	producer.logger.Info("Kafka 生产者初始化成功",
 		clog.Strings("brokers", config.Brokers),
 		clog.Int("batch_size", config.ProducerConfig.BatchSize),
@@ -159,6 +244,30 @@ func (p *producerImpl) Send(ctx context.Context, msg *Message, callback func(err
 		return
 	}
 
+	topic, err := p.topics.physical(msg.Topic)
+	if err != nil {
+		if callback != nil {
+			callback(err)
+		}
+		return
+	}
+
+	if msg.Headers == nil {
+		msg.Headers = make(map[string][]byte)
+	}
+
+	// 窗口内重复的幂等键：抑制时直接返回成功，标记时继续发送；发送失败时释放幂等键以便重试
+	send, claimed := p.dedup.check(ctx, msg)
+	if !send {
+		if callback != nil {
+			callback(nil)
+		}
+		return
+	}
+	if claimed {
+		callback = p.dedup.releaseOnError(msg, callback)
+	}
+
 	// 更新指标
 	p.metrics.mu.Lock()
 	p.metrics.totalMessages++
@@ -166,27 +275,68 @@ func (p *producerImpl) Send(ctx context.Context, msg *Message, callback func(err
 	p.metrics.mu.Unlock()
 
 	// 自动注入 trace_id 到消息头
-	if msg.Headers == nil {
-		msg.Headers = make(map[string][]byte)
-	}
-
 	if traceID := extractTraceID(ctx); traceID != "" {
 		msg.Headers["X-Trace-ID"] = []byte(traceID)
 	}
+	if msg.IdempotencyKey != "" {
+		msg.Headers[HeaderIdempotencyKey] = []byte(msg.IdempotencyKey)
+	}
 
 	// 添加时间戳头
 	msg.Headers["X-Timestamp"] = []byte(time.Now().Format(time.RFC3339))
 
+	// 超过阈值的载荷先上传到对象存储，发送失败时删除
+	value, blobKey, err := p.claimCheck.offload(ctx, msg)
+	if err != nil {
+		p.metrics.mu.Lock()
+		p.metrics.failedMessages++
+		p.metrics.mu.Unlock()
+		if callback != nil {
+			callback(err)
+		}
+		return
+	}
+	callback = p.claimCheck.releaseOnError(msg.Topic, blobKey, callback)
+
 	// 转换为 franz-go 消息格式
 	record := &kgo.Record{
-		Topic:   msg.Topic,
-		Key:     msg.Key,
-		Value:   msg.Value,
-		Headers: convertHeaders(msg.Headers),
+		Topic:     topic,
+		Key:       msg.Key,
+		Value:     value,
+		Headers:   convertHeaders(msg.Headers),
+		Partition: msg.Partition,
+	}
+
+	// 故障注入：直接返回错误，或推迟发送结果回调
+	if err := p.chaos.sendError(msg.Topic); err != nil {
+		p.metrics.mu.Lock()
+		p.metrics.failedMessages++
+		p.metrics.mu.Unlock()
+		if callback != nil {
+			callback(err)
+		}
+		return
+	}
+	callback = p.chaos.delayCallback(msg.Topic, callback)
+
+	// broker 不可用或本地队列尚未回放完时，直接写入本地队列以保持顺序
+	if p.shouldSpill() {
+		err := p.spillRecord(record)
+		if callback != nil {
+			callback(err)
+		}
+		return
 	}
 
 	// 异步发送
+	start := time.Now()
 	p.client.Produce(ctx, record, func(r *kgo.Record, err error) {
+		spilled := false
+		if err != nil && p.spill != nil && isBrokerUnavailable(err) {
+			err = p.spillRecord(r)
+			spilled = err == nil
+		}
+
 		if err != nil {
 			p.metrics.mu.Lock()
 			p.metrics.failedMessages++
@@ -199,9 +349,13 @@ func (p *producerImpl) Send(ctx context.Context, msg *Message, callback func(err
 				clog.Int("value_size", len(msg.Value)),
 			)
 		} else {
-			p.metrics.mu.Lock()
-			p.metrics.successMessages++
-			p.metrics.mu.Unlock()
+			if spilled {
+				p.metrics.mu.Lock()
+				p.metrics.successMessages++
+				p.metrics.mu.Unlock()
+			} else {
+				p.metrics.recordSendLatency(time.Since(start))
+			}
 
 			p.logger.Debug("发送消息成功",
 				clog.String("topic", msg.Topic),
@@ -218,7 +372,7 @@ func (p *producerImpl) Send(ctx context.Context, msg *Message, callback func(err
 }
 
 // SendSync 同步发送消息。
-func (p *producerImpl) SendSync(ctx context.Context, msg *Message) error {
+func (p *producerImpl) SendSync(ctx context.Context, msg *Message) (err error) {
 	// 参数校验
 	if msg == nil {
 		return fmt.Errorf("消息不能为空")
@@ -228,6 +382,28 @@ func (p *producerImpl) SendSync(ctx context.Context, msg *Message) error {
 		return fmt.Errorf("消息主题不能为空")
 	}
 
+	topic, err := p.topics.physical(msg.Topic)
+	if err != nil {
+		return err
+	}
+
+	if msg.Headers == nil {
+		msg.Headers = make(map[string][]byte)
+	}
+
+	// 窗口内重复的幂等键：抑制时直接返回成功，标记时继续发送；发送失败时释放幂等键以便重试
+	send, claimed := p.dedup.check(ctx, msg)
+	if !send {
+		return nil
+	}
+	if claimed {
+		defer func() {
+			if err != nil {
+				p.dedup.release(msg)
+			}
+		}()
+	}
+
 	// 更新指标
 	p.metrics.mu.Lock()
 	p.metrics.totalMessages++
@@ -240,27 +416,61 @@ func (p *producerImpl) SendSync(ctx context.Context, msg *Message) error {
 	}
 
 	// 自动注入 trace_id 到消息头
-	if msg.Headers == nil {
-		msg.Headers = make(map[string][]byte)
-	}
-
 	if traceID := extractTraceID(ctx); traceID != "" {
 		msg.Headers["X-Trace-ID"] = []byte(traceID)
 	}
+	if msg.IdempotencyKey != "" {
+		msg.Headers[HeaderIdempotencyKey] = []byte(msg.IdempotencyKey)
+	}
 
 	// 添加时间戳头
 	msg.Headers["X-Timestamp"] = []byte(time.Now().Format(time.RFC3339))
 
+	// 超过阈值的载荷先上传到对象存储，发送失败时删除
+	value, blobKey, err := p.claimCheck.offload(ctx, msg)
+	if err != nil {
+		p.metrics.mu.Lock()
+		p.metrics.failedMessages++
+		p.metrics.mu.Unlock()
+		return err
+	}
+	if blobKey != "" {
+		defer func() {
+			if err != nil {
+				p.claimCheck.release(msg.Topic, blobKey)
+			}
+		}()
+	}
+
 	// 转换为 franz-go 消息格式
 	record := &kgo.Record{
-		Topic:   msg.Topic,
-		Key:     msg.Key,
-		Value:   msg.Value,
-		Headers: convertHeaders(msg.Headers),
+		Topic:     topic,
+		Key:       msg.Key,
+		Value:     value,
+		Headers:   convertHeaders(msg.Headers),
+		Partition: msg.Partition,
+	}
+
+	// 故障注入：发送前等待，或直接返回错误
+	if err := p.chaos.beforeSend(ctx, msg.Topic); err != nil {
+		p.metrics.mu.Lock()
+		p.metrics.failedMessages++
+		p.metrics.mu.Unlock()
+		return err
+	}
+
+	if p.shouldSpill() {
+		return p.spillRecord(record)
 	}
 
 	// 同步发送
+	start := time.Now()
 	results := p.client.ProduceSync(ctx, record)
+	if err := results.FirstErr(); err != nil && p.spill != nil && isBrokerUnavailable(err) {
+		if spillErr := p.spillRecord(record); spillErr == nil {
+			return nil
+		}
+	}
 	if results.FirstErr() != nil {
 		p.metrics.mu.Lock()
 		p.metrics.failedMessages++
@@ -275,9 +485,7 @@ func (p *producerImpl) SendSync(ctx context.Context, msg *Message) error {
 		return results.FirstErr()
 	}
 
-	p.metrics.mu.Lock()
-	p.metrics.successMessages++
-	p.metrics.mu.Unlock()
+	p.metrics.recordSendLatency(time.Since(start))
 
 	p.logger.Debug("同步发送消息成功",
 		clog.String("topic", msg.Topic),
@@ -296,6 +504,10 @@ func (p *producerImpl) Close() error {
 		clog.Int64("total_bytes", p.metrics.totalBytes),
 	)
 
+	// 停止后台回放，未回放的消息保留在本地队列中
+	p.stopSpill()
+	p.claimCheck.stopCleanup()
+
 	// 刷新所有待发送的消息
 	p.client.Flush(context.Background())
 
@@ -315,13 +527,34 @@ func (p *producerImpl) GetMetrics() map[string]interface{} {
 		successRate = float64(p.metrics.successMessages) / float64(p.metrics.totalMessages) * 100
 	}
 
-	return map[string]interface{}{
+	metrics := map[string]interface{}{
 		"total_messages":   p.metrics.totalMessages,
 		"success_messages": p.metrics.successMessages,
 		"failed_messages":  p.metrics.failedMessages,
 		"total_bytes":      p.metrics.totalBytes,
 		"success_rate":     successRate,
+		// 累计值，用于计算平均发送延迟和平均批次大小
+		"send_latency_ms_total": float64(p.metrics.sendLatencyTotal) / float64(time.Millisecond),
+		"send_latency_count":    p.metrics.sendLatencyCount,
+		"batches_total":         p.batches.batches.Load(),
+		"batch_records_total":   p.batches.records.Load(),
 	}
+
+	if p.spill != nil {
+		pendingCount, pendingBytes := p.spill.pending()
+		metrics["spilled_messages"] = p.metrics.spilledMessages
+		metrics["replayed_messages"] = p.metrics.replayedMessages
+		metrics["expired_messages"] = p.metrics.expiredMessages
+		metrics["rejected_messages"] = p.metrics.rejectedMessages
+		metrics["spill_pending_messages"] = pendingCount
+		metrics["spill_pending_bytes"] = pendingBytes
+		metrics["broker_outage"] = p.outage.Load()
+	}
+	p.chaos.addMetrics(metrics)
+	p.dedup.addMetrics(metrics)
+	p.claimCheck.addMetrics(metrics)
+
+	return metrics
 }
 
 // Flush 刷新所有待发送的消息
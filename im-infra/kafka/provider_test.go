@@ -268,4 +268,28 @@ func TestMessageOperations(t *testing.T) {
 func TestTraceIDKeyConstant(t *testing.T) {
 	// 测试 TraceIDKey 常量
 	assert.Equal(t, "trace-id", TraceIDKey)
-}
\ No newline at end of file
+}
+
+func TestConsumerShutdown(t *testing.T) {
+	// kgo 客户端创建时不会主动连接 broker，无需 Kafka 即可验证关闭流程
+	config := GetDefaultConfig("development")
+	config.Brokers = []string{"127.0.0.1:1"}
+	config.ConsumerConfig.EnableAutoCommitOnClose = false
+
+	consumer, err := newConsumerImpl(context.Background(), config, "shutdown-test-group", nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	report, err := consumer.Shutdown(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), report.Abandoned)
+	assert.False(t, report.OffsetsCommitted)
+
+	// 重复关闭应当是安全的
+	report, err = consumer.Shutdown(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), report.Abandoned)
+	assert.NoError(t, consumer.Close())
+}
@@ -0,0 +1,614 @@
+package kafka
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+const (
+	// spillSegmentExt 本地队列段文件扩展名
+	spillSegmentExt = ".wal"
+	// spillCursorFile 记录已回放位置的游标文件
+	spillCursorFile = "cursor"
+	// spillEntryHeaderSize 每条记录的头部：4 字节长度 + 4 字节 CRC32
+	spillEntryHeaderSize = 8
+	// spillBatchSize 后台回放时每批发送的消息数
+	spillBatchSize = 256
+)
+
+// spillRecord 是写入本地队列的消息
+type spillRecord struct {
+	Topic      string        `json:"topic"`
+	Key        []byte        `json:"key,omitempty"`
+	Value      []byte        `json:"value"`
+	Headers    []spillHeader `json:"headers,omitempty"`
+	Partition  int32         `json:"partition,omitempty"`
+	EnqueuedAt time.Time     `json:"enqueuedAt"`
+	size       int64
+}
+
+// spillHeader 是本地队列消息的一个消息头。
+// 使用有序列表而非 map 保存，以保留重复的键和原始顺序。
+type spillHeader struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value,omitempty"`
+}
+
+// spillCursor 指向本地队列中的读取位置
+type spillCursor struct {
+	seq    uint64
+	offset int64
+}
+
+// spillQueue 是基于磁盘的有界预写日志（WAL），在 broker 不可用时暂存待发送的消息。
+//
+// 消息按顺序追加到段文件 <seq>.wal 中，每条记录带有长度和 CRC 校验；
+// 回放进度持久化到 cursor 文件，完全回放的段文件会被删除。
+// 进程崩溃后重启时从 cursor 位置继续回放，因此投递语义为至少一次。
+type spillQueue struct {
+	dir          string
+	maxBytes     int64
+	segmentBytes int64
+
+	mu        sync.Mutex
+	segments  []uint64 // 现存的段文件序号，升序
+	writer    *os.File
+	writeSeq  uint64
+	writeSize int64
+	read      spillCursor
+
+	pendingBytes int64
+	pendingCount int64
+}
+
+// openSpillQueue 打开（或创建）本地队列，并统计上次遗留的待回放消息
+func openSpillQueue(dir string, maxBytes, segmentBytes int64) (*spillQueue, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建本地队列目录失败: %w", err)
+	}
+
+	q := &spillQueue{
+		dir:          dir,
+		maxBytes:     maxBytes,
+		segmentBytes: segmentBytes,
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("读取本地队列目录失败: %w", err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, spillSegmentExt) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, spillSegmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		q.segments = append(q.segments, seq)
+	}
+	sort.Slice(q.segments, func(i, j int) bool { return q.segments[i] < q.segments[j] })
+
+	q.read = q.loadCursor()
+	q.removeSegmentsBefore(q.read.seq)
+	if len(q.segments) > 0 && q.read.seq < q.segments[0] {
+		q.read = spillCursor{seq: q.segments[0]}
+	}
+
+	if err := q.recover(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// recover 扫描待回放的记录，截断崩溃时写了一半的尾部记录
+func (q *spillQueue) recover() error {
+	for _, seq := range q.segments {
+		offset := int64(0)
+		if seq == q.read.seq {
+			offset = q.read.offset
+		}
+
+		valid, count, err := scanSegment(q.segmentPath(seq), offset)
+		if err != nil {
+			return err
+		}
+		q.pendingCount += count
+		q.pendingBytes += valid - offset
+
+		info, err := os.Stat(q.segmentPath(seq))
+		if err != nil {
+			return fmt.Errorf("读取本地队列段文件失败: %w", err)
+		}
+		if info.Size() > valid {
+			if err := os.Truncate(q.segmentPath(seq), valid); err != nil {
+				return fmt.Errorf("截断本地队列段文件失败: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// scanSegment 从 offset 开始扫描段文件，返回最后一条完整记录的结束位置和记录数
+func scanSegment(path string, offset int64) (int64, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, fmt.Errorf("打开本地队列段文件失败: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return 0, 0, err
+	}
+
+	r := bufio.NewReader(f)
+	var count int64
+	for {
+		_, n, err := readSpillEntry(r)
+		if err != nil {
+			// 文件结束或记录损坏，之后的数据视为无效
+			return offset, count, nil
+		}
+		offset += n
+		count++
+	}
+}
+
+// append 追加一条消息，超过容量上限时返回错误。每次追加都会 fsync 以保证落盘。
+func (q *spillQueue) append(rec *spillRecord) error {
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("序列化本地队列消息失败: %w", err)
+	}
+	size := int64(spillEntryHeaderSize + len(payload))
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.maxBytes > 0 && q.pendingBytes+size > q.maxBytes {
+		return ErrSpillFull(fmt.Sprintf("本地队列已满 (%d/%d 字节)", q.pendingBytes, q.maxBytes))
+	}
+
+	if q.writer == nil || (q.segmentBytes > 0 && q.writeSize > 0 && q.writeSize+size > q.segmentBytes) {
+		if err := q.rotate(); err != nil {
+			return err
+		}
+	}
+
+	buf := make([]byte, size)
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(payload))
+	copy(buf[spillEntryHeaderSize:], payload)
+
+	if _, err := q.writer.Write(buf); err != nil {
+		return fmt.Errorf("写入本地队列失败: %w", err)
+	}
+	if err := q.writer.Sync(); err != nil {
+		return fmt.Errorf("同步本地队列失败: %w", err)
+	}
+
+	q.writeSize += size
+	q.pendingBytes += size
+	q.pendingCount++
+	return nil
+}
+
+// rotate 关闭当前段文件并创建新的段文件
+func (q *spillQueue) rotate() error {
+	if q.writer != nil {
+		if err := q.writer.Close(); err != nil {
+			return fmt.Errorf("关闭本地队列段文件失败: %w", err)
+		}
+		q.writer = nil
+	}
+
+	seq := uint64(1)
+	if len(q.segments) > 0 {
+		seq = q.segments[len(q.segments)-1] + 1
+	}
+	f, err := os.OpenFile(q.segmentPath(seq), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("创建本地队列段文件失败: %w", err)
+	}
+
+	q.writer = f
+	q.writeSeq = seq
+	q.writeSize = 0
+	q.segments = append(q.segments, seq)
+	if len(q.segments) == 1 {
+		q.read = spillCursor{seq: seq}
+	}
+	return nil
+}
+
+// peek 从读取位置开始读取最多 n 条消息，不移动读取位置。
+// 返回读取到的消息以及读取结束后的位置，回放成功后应使用该位置调用 commit。
+func (q *spillQueue) peek(n int) ([]*spillRecord, spillCursor, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	cursor := q.read
+	var records []*spillRecord
+	for len(records) < n {
+		idx := sort.Search(len(q.segments), func(i int) bool { return q.segments[i] >= cursor.seq })
+		if idx == len(q.segments) {
+			break
+		}
+		if q.segments[idx] != cursor.seq {
+			cursor = spillCursor{seq: q.segments[idx]}
+		}
+
+		batch, next, err := q.readSegment(cursor, n-len(records))
+		if err != nil {
+			return nil, q.read, err
+		}
+		records = append(records, batch...)
+		cursor = next
+
+		// 当前段已读完，若存在更新的段则继续
+		if len(records) < n {
+			if idx+1 >= len(q.segments) {
+				break
+			}
+			cursor = spillCursor{seq: q.segments[idx+1]}
+		}
+	}
+	return records, cursor, nil
+}
+
+// readSegment 从段文件的指定位置读取最多 n 条记录
+func (q *spillQueue) readSegment(cursor spillCursor, n int) ([]*spillRecord, spillCursor, error) {
+	f, err := os.Open(q.segmentPath(cursor.seq))
+	if err != nil {
+		return nil, cursor, fmt.Errorf("打开本地队列段文件失败: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(cursor.offset, io.SeekStart); err != nil {
+		return nil, cursor, err
+	}
+
+	r := bufio.NewReader(f)
+	var records []*spillRecord
+	for len(records) < n {
+		rec, size, err := readSpillEntry(r)
+		if err != nil {
+			break
+		}
+		rec.size = size
+		cursor.offset += size
+		records = append(records, rec)
+	}
+	return records, cursor, nil
+}
+
+// commit 将读取位置移动到 cursor，持久化游标并删除已完全回放的段文件
+func (q *spillQueue) commit(cursor spillCursor, records []*spillRecord) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, rec := range records {
+		q.pendingBytes -= rec.size
+		q.pendingCount--
+	}
+	q.read = cursor
+	q.removeSegmentsBefore(cursor.seq)
+
+	return q.saveCursor()
+}
+
+// pending 返回待回放的消息数和字节数
+func (q *spillQueue) pending() (int64, int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.pendingCount, q.pendingBytes
+}
+
+// close 关闭当前段文件，未回放的消息保留在磁盘上供下次启动回放
+func (q *spillQueue) close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.writer == nil {
+		return nil
+	}
+	err := q.writer.Close()
+	q.writer = nil
+	return err
+}
+
+// removeSegmentsBefore 删除序号小于 seq 的段文件，当前写入的段不会被删除
+func (q *spillQueue) removeSegmentsBefore(seq uint64) {
+	kept := q.segments[:0]
+	for _, s := range q.segments {
+		if s < seq && !(q.writer != nil && s == q.writeSeq) {
+			os.Remove(q.segmentPath(s))
+			continue
+		}
+		kept = append(kept, s)
+	}
+	q.segments = kept
+}
+
+func (q *spillQueue) segmentPath(seq uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", seq, spillSegmentExt))
+}
+
+// loadCursor 读取持久化的游标，不存在或损坏时从头开始
+func (q *spillQueue) loadCursor() spillCursor {
+	data, err := os.ReadFile(filepath.Join(q.dir, spillCursorFile))
+	if err != nil {
+		return spillCursor{}
+	}
+	var seq uint64
+	var offset int64
+	if _, err := fmt.Sscanf(string(data), "%d %d", &seq, &offset); err != nil {
+		return spillCursor{}
+	}
+	return spillCursor{seq: seq, offset: offset}
+}
+
+// saveCursor 通过写临时文件再重命名的方式原子地持久化游标
+func (q *spillQueue) saveCursor() error {
+	path := filepath.Join(q.dir, spillCursorFile)
+	tmp := path + ".tmp"
+	data := fmt.Sprintf("%d %d", q.read.seq, q.read.offset)
+	if err := os.WriteFile(tmp, []byte(data), 0644); err != nil {
+		return fmt.Errorf("写入本地队列游标失败: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// readSpillEntry 读取一条记录，返回记录及其在文件中占用的字节数
+func readSpillEntry(r *bufio.Reader) (*spillRecord, int64, error) {
+	var header [spillEntryHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, 0, err
+	}
+	length := binary.BigEndian.Uint32(header[0:4])
+	checksum := binary.BigEndian.Uint32(header[4:8])
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, 0, err
+	}
+	if crc32.ChecksumIEEE(payload) != checksum {
+		return nil, 0, errors.New("本地队列记录校验失败")
+	}
+
+	var rec spillRecord
+	if err := json.Unmarshal(payload, &rec); err != nil {
+		return nil, 0, err
+	}
+	return &rec, int64(spillEntryHeaderSize) + int64(length), nil
+}
+
+// newSpillRecord 将 kgo.Record 转换为本地队列消息
+func newSpillRecord(r *kgo.Record) *spillRecord {
+	rec := &spillRecord{
+		Topic:      r.Topic,
+		Key:        r.Key,
+		Value:      r.Value,
+		Partition:  r.Partition,
+		EnqueuedAt: time.Now(),
+	}
+	if len(r.Headers) > 0 {
+		rec.Headers = make([]spillHeader, len(r.Headers))
+		for i, h := range r.Headers {
+			rec.Headers[i] = spillHeader{Key: h.Key, Value: h.Value}
+		}
+	}
+	return rec
+}
+
+// toKgoRecord 将本地队列消息转换回 kgo.Record
+func (r *spillRecord) toKgoRecord() *kgo.Record {
+	record := &kgo.Record{
+		Topic:     r.Topic,
+		Key:       r.Key,
+		Value:     r.Value,
+		Partition: r.Partition,
+	}
+	if len(r.Headers) > 0 {
+		record.Headers = make([]kgo.RecordHeader, len(r.Headers))
+		for i, h := range r.Headers {
+			record.Headers[i] = kgo.RecordHeader{Key: h.Key, Value: h.Value}
+		}
+	}
+	return record
+}
+
+// isBrokerUnavailable 判断发送失败是否由 broker 不可用导致，此类消息可以暂存到本地队列稍后重发。
+// 消息过大、主题不合法、调用方取消等错误不会触发暂存。
+func isBrokerUnavailable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, kgo.ErrRecordTimeout) || errors.Is(err, kgo.ErrRecordRetries) || errors.Is(err, kgo.ErrMaxBuffered) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return kerr.IsRetriable(err)
+}
+
+// startSpill 打开本地队列并启动后台回放
+func (p *producerImpl) startSpill(cfg *SpillConfig) error {
+	segmentBytes := cfg.SegmentBytes
+	if segmentBytes <= 0 {
+		segmentBytes = 64 * 1024 * 1024
+	}
+	queue, err := openSpillQueue(cfg.Dir, cfg.MaxBytes, segmentBytes)
+	if err != nil {
+		return ErrProducer("打开本地队列失败", err)
+	}
+	p.spill = queue
+
+	interval := time.Duration(cfg.FlushIntervalMs) * time.Millisecond
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p.spillCancel = cancel
+	p.spillWG.Add(1)
+	go p.runSpillFlusher(ctx, interval)
+
+	pendingCount, pendingBytes := queue.pending()
+	p.logger.Info("Kafka 生产者本地队列已开启",
+		clog.String("dir", cfg.Dir),
+		clog.Int64("max_bytes", cfg.MaxBytes),
+		clog.Int64("pending_messages", pendingCount),
+		clog.Int64("pending_bytes", pendingBytes),
+	)
+	return nil
+}
+
+// stopSpill 停止后台回放并关闭本地队列
+func (p *producerImpl) stopSpill() {
+	if p.spill == nil {
+		return
+	}
+	p.spillCancel()
+	p.spillWG.Wait()
+
+	if err := p.spill.close(); err != nil {
+		p.logger.Error("关闭本地队列失败", clog.Err(err))
+	}
+	if pendingCount, _ := p.spill.pending(); pendingCount > 0 {
+		p.logger.Warn("本地队列中仍有未回放的消息，将在下次启动时回放",
+			clog.Int64("pending_messages", pendingCount))
+	}
+}
+
+// shouldSpill 判断新消息是否应直接写入本地队列：broker 不可用，或队列中还有未回放的消息
+func (p *producerImpl) shouldSpill() bool {
+	if p.spill == nil {
+		return false
+	}
+	if p.outage.Load() {
+		return true
+	}
+	pendingCount, _ := p.spill.pending()
+	return pendingCount > 0
+}
+
+// spillRecord 将消息写入本地队列
+func (p *producerImpl) spillRecord(r *kgo.Record) error {
+	if !p.outage.Swap(true) {
+		p.logger.Warn("Kafka broker 不可用，消息将暂存到本地队列")
+	}
+
+	if err := p.spill.append(newSpillRecord(r)); err != nil {
+		p.metrics.mu.Lock()
+		p.metrics.rejectedMessages++
+		p.metrics.mu.Unlock()
+		return err
+	}
+
+	p.metrics.mu.Lock()
+	p.metrics.spilledMessages++
+	p.metrics.mu.Unlock()
+	return nil
+}
+
+// runSpillFlusher 定期检查 broker 是否恢复并回放本地队列
+func (p *producerImpl) runSpillFlusher(ctx context.Context, interval time.Duration) {
+	defer p.spillWG.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.drainSpill(ctx)
+		}
+	}
+}
+
+// drainSpill 在 broker 可用时按顺序回放本地队列，回放失败时保留剩余消息等待下次重试
+func (p *producerImpl) drainSpill(ctx context.Context) {
+	pendingCount, _ := p.spill.pending()
+	if pendingCount == 0 && !p.outage.Load() {
+		return
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	err := p.client.Ping(pingCtx)
+	cancel()
+	if err != nil {
+		p.logger.Debug("Kafka broker 仍不可用，稍后重试回放", clog.Err(err))
+		return
+	}
+
+	maxAge := time.Duration(p.config.ProducerConfig.Spill.MaxAgeMs) * time.Millisecond
+	for {
+		records, cursor, err := p.spill.peek(spillBatchSize)
+		if err != nil {
+			p.logger.Error("读取本地队列失败", clog.Err(err))
+			return
+		}
+		if len(records) == 0 {
+			break
+		}
+
+		live := make([]*kgo.Record, 0, len(records))
+		var expired int64
+		for _, rec := range records {
+			if maxAge > 0 && time.Since(rec.EnqueuedAt) > maxAge {
+				expired++
+				continue
+			}
+			live = append(live, rec.toKgoRecord())
+		}
+
+		if len(live) > 0 {
+			if err := p.client.ProduceSync(ctx, live...).FirstErr(); err != nil {
+				// 部分消息可能已发送成功，下次会重新回放（至少一次语义）
+				p.logger.Warn("回放本地队列失败，稍后重试", clog.Err(err))
+				return
+			}
+		}
+
+		if err := p.spill.commit(cursor, records); err != nil {
+			p.logger.Error("提交本地队列游标失败", clog.Err(err))
+		}
+
+		p.metrics.mu.Lock()
+		p.metrics.replayedMessages += int64(len(live))
+		p.metrics.expiredMessages += expired
+		p.metrics.mu.Unlock()
+
+		if expired > 0 {
+			p.logger.Warn("丢弃本地队列中超时的消息", clog.Int64("count", expired))
+		}
+	}
+
+	if p.outage.Swap(false) {
+		p.logger.Info("Kafka broker 已恢复，本地队列回放完成")
+	}
+}
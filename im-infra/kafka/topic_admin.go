@@ -46,6 +46,8 @@ type adminImpl struct {
 	client *kgo.Client
 	tm     *TopicManager
 	logger clog.Logger
+	// topics 主题命名转换，参数中的主题均为逻辑主题名
+	topics *topicNamer
 }
 
 // TopicManager Topic管理器
@@ -331,7 +333,7 @@ func (tm *TopicManager) Close() {
 }
 
 // newAdminImpl 创建一个新的admin实例
-func newAdminImpl(config *Config, logger clog.Logger) *adminImpl {
+func newAdminImpl(config *Config, topics *topicNamer, logger clog.Logger) *adminImpl {
 	// 创建一个临时的kafka客户端用于admin操作
 	client, err := kgo.NewClient(
 		kgo.SeedBrokers(config.Brokers...),
@@ -346,11 +348,17 @@ func newAdminImpl(config *Config, logger clog.Logger) *adminImpl {
 		client: client,
 		tm:     NewTopicManager(client, logger),
 		logger: logger,
+		topics: topics,
 	}
 }
 
 // CreateTopic 创建主题
 func (a *adminImpl) CreateTopic(ctx context.Context, topic string, partitions int32, replicationFactor int16, config map[string]string) error {
+	topic, err := a.topics.physical(topic)
+	if err != nil {
+		return err
+	}
+
 	topicConfig := &TopicConfig{
 		Partitions:        partitions,
 		ReplicationFactor: replicationFactor,
@@ -367,10 +375,14 @@ func (a *adminImpl) CreateTopic(ctx context.Context, topic string, partitions in
 
 // DeleteTopic 删除主题
 func (a *adminImpl) DeleteTopic(ctx context.Context, topic string) error {
+	topic, err := a.topics.physical(topic)
+	if err != nil {
+		return err
+	}
 	return a.tm.DeleteTopic(ctx, topic)
 }
 
-// ListTopics 列出所有主题
+// ListTopics 列出所有主题，配置了 TopicNaming 时只返回本环境和命名空间的主题，键为逻辑主题名
 func (a *adminImpl) ListTopics(ctx context.Context) (map[string]TopicDetail, error) {
 	topics, err := a.tm.ListTopics(ctx)
 	if err != nil {
@@ -379,6 +391,9 @@ func (a *adminImpl) ListTopics(ctx context.Context) (map[string]TopicDetail, err
 
 	result := make(map[string]TopicDetail)
 	for name, detail := range topics {
+		if !a.topics.owns(name) {
+			continue
+		}
 		numPartitions := int32(len(detail.Partitions))
 		replicationFactor := int16(1) // default value
 
@@ -390,7 +405,7 @@ func (a *adminImpl) ListTopics(ctx context.Context) (map[string]TopicDetail, err
 			}
 		}
 
-		result[name] = TopicDetail{
+		result[a.topics.logical(name)] = TopicDetail{
 			NumPartitions:     numPartitions,
 			ReplicationFactor: replicationFactor,
 			Config:            make(map[string]string), // TODO: 从detail中提取配置
@@ -402,6 +417,11 @@ func (a *adminImpl) ListTopics(ctx context.Context) (map[string]TopicDetail, err
 
 // GetTopicMetadata 获取主题元数据
 func (a *adminImpl) GetTopicMetadata(ctx context.Context, topic string) (*TopicDetail, error) {
+	topic, err := a.topics.physical(topic)
+	if err != nil {
+		return nil, err
+	}
+
 	detail, err := a.tm.GetTopicDetail(ctx, topic)
 	if err != nil {
 		return nil, err
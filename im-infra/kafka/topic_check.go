@@ -0,0 +1,148 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// validateTopicsOnStart 检查 broker 连通性以及 ValidateTopicsOnStart 中的主题是否存在、分区数是否满足要求。
+// create-missing 策略下会先创建不存在的主题，再检查分区数。
+func validateTopicsOnStart(ctx context.Context, client *kgo.Client, config *Config, namer *topicNamer, logger clog.Logger) error {
+	tv := normalizeTopicValidation(config.TopicValidation)
+
+	// 按集群中的实际主题名检查，MinPartitions 的键同样转换为实际主题名
+	topics, err := namer.physicalAll(config.ValidateTopicsOnStart)
+	if err != nil {
+		return err
+	}
+	if namer != nil {
+		minPartitions := make(map[string]int32, len(tv.MinPartitions))
+		for topic, n := range tv.MinPartitions {
+			if name, err := namer.physical(topic); err == nil {
+				minPartitions[name] = n
+			}
+		}
+		tv.MinPartitions = minPartitions
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(tv.TimeoutMs)*time.Millisecond)
+	defer cancel()
+
+	adm := kadm.NewClient(client)
+	brokers, err := adm.ListBrokers(ctx)
+	if err != nil {
+		logger.Error("启动检查时无法连接 Kafka 集群", clog.Strings("brokers", config.Brokers), clog.Err(err))
+		return ErrConnection("启动检查时无法连接 Kafka 集群", err)
+	}
+
+	details, err := adm.ListTopics(ctx, topics...)
+	if err != nil {
+		logger.Error("启动检查时获取主题元数据失败", clog.Err(err))
+		return ErrAdmin("启动检查时获取主题元数据失败", err)
+	}
+
+	missing, problems := checkTopicDetails(topics, details, tv.MinPartitions)
+	if len(missing) > 0 && tv.Policy == TopicValidationCreateMissing {
+		if err := createMissingTopics(ctx, adm, missing, tv, logger); err != nil {
+			return err
+		}
+		missing = nil
+	}
+	for _, topic := range missing {
+		problems = append(problems, fmt.Sprintf("主题 %s 不存在", topic))
+	}
+
+	if len(problems) > 0 {
+		logger.Error("启动主题检查失败",
+			clog.String("policy", tv.Policy),
+			clog.Strings("problems", problems))
+		return ErrAdmin("启动主题检查失败", errors.New(strings.Join(problems, "; ")))
+	}
+
+	logger.Info("启动主题检查通过",
+		clog.Int("brokers", len(brokers)),
+		clog.Strings("topics", topics))
+	return nil
+}
+
+// checkTopicDetails 对比主题元数据，返回不存在的主题以及其他问题（元数据错误、分区数不足）
+func checkTopicDetails(topics []string, details kadm.TopicDetails, minPartitions map[string]int32) (missing, problems []string) {
+	for _, topic := range topics {
+		detail, ok := details[topic]
+		if !ok || errors.Is(detail.Err, kerr.UnknownTopicOrPartition) {
+			missing = append(missing, topic)
+			continue
+		}
+		if detail.Err != nil {
+			problems = append(problems, fmt.Sprintf("主题 %s 元数据错误: %v", topic, detail.Err))
+			continue
+		}
+		if want := minPartitions[topic]; want > 0 && int32(len(detail.Partitions)) < want {
+			problems = append(problems, fmt.Sprintf("主题 %s 分区数为 %d，要求至少 %d", topic, len(detail.Partitions), want))
+		}
+	}
+	sort.Strings(missing)
+	return missing, problems
+}
+
+// createMissingTopics 按 create-missing 策略创建不存在的主题，并发启动的实例重复创建时忽略已存在错误
+func createMissingTopics(ctx context.Context, adm *kadm.Client, topics []string, tv *TopicValidationConfig, logger clog.Logger) error {
+	replicationFactor := tv.CreateReplicationFactor
+	if replicationFactor <= 0 {
+		replicationFactor = -1
+	}
+
+	var errs []error
+	for _, topic := range topics {
+		partitions := tv.CreatePartitions
+		if partitions <= 0 {
+			partitions = tv.MinPartitions[topic]
+		}
+		if partitions <= 0 {
+			partitions = -1
+		}
+
+		resp, err := adm.CreateTopic(ctx, partitions, replicationFactor, nil, topic)
+		if err == nil {
+			err = resp.Err
+		}
+		if err != nil && !errors.Is(err, kerr.TopicAlreadyExists) {
+			logger.Error("启动检查时创建主题失败", clog.String("topic", topic), clog.Err(err))
+			errs = append(errs, fmt.Errorf("主题 %s: %w", topic, err))
+			continue
+		}
+		logger.Warn("启动检查时创建了不存在的主题",
+			clog.String("topic", topic),
+			clog.Int32("partitions", partitions),
+			clog.Int16("replication_factor", replicationFactor))
+	}
+
+	if len(errs) > 0 {
+		return ErrAdmin("启动检查时创建主题失败", errors.Join(errs...))
+	}
+	return nil
+}
+
+// normalizeTopicValidation 填充启动主题检查的默认值
+func normalizeTopicValidation(tv *TopicValidationConfig) *TopicValidationConfig {
+	normalized := TopicValidationConfig{}
+	if tv != nil {
+		normalized = *tv
+	}
+	if normalized.Policy == "" {
+		normalized.Policy = TopicValidationFailFast
+	}
+	if normalized.TimeoutMs <= 0 {
+		normalized.TimeoutMs = 10000
+	}
+	return &normalized
+}
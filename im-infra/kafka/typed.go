@@ -0,0 +1,224 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// 类型化消息使用的消息头
+const (
+	// HeaderMessageType 消息的 protobuf 全名，如 "gochat.order.v1.OrderEvent"
+	HeaderMessageType = "X-Message-Type"
+	// HeaderSchemaVersion 消息的 schema 版本
+	HeaderSchemaVersion = "X-Schema-Version"
+	// HeaderContentType 消息体的编码格式
+	HeaderContentType = "Content-Type"
+
+	// ContentTypeProtobuf protobuf 二进制编码
+	ContentTypeProtobuf = "application/x-protobuf"
+)
+
+var (
+	// topicRegistry 记录已注册的 topic 与消息类型，防止同一 topic 绑定不同类型
+	topicRegistry   = make(map[string]string)
+	topicRegistryMu sync.Mutex
+)
+
+// TopicBinding 将一个 topic 与一种 protobuf 消息类型绑定。
+// 通常由代码生成器在包级变量中创建：
+//
+//	var OrderEvents = kafka.RegisterTopic[*orderv1.OrderEvent]("order.events", kafka.WithSchemaVersion(2))
+type TopicBinding[T proto.Message] struct {
+	topic         string
+	messageType   string
+	schemaVersion int
+	strictType    bool
+}
+
+// TopicOption 定义了 RegisterTopic 的可选配置
+type TopicOption func(*topicOptions)
+
+type topicOptions struct {
+	schemaVersion int
+	strictType    bool
+}
+
+// WithSchemaVersion 设置写入消息头的 schema 版本，默认为 1
+func WithSchemaVersion(version int) TopicOption {
+	return func(o *topicOptions) {
+		o.schemaVersion = version
+	}
+}
+
+// WithStrictMessageType 要求消费的消息必须带有匹配的消息类型头。
+// 默认情况下缺少类型头的消息（如旧版本生产者写入的）仍会尝试解码。
+func WithStrictMessageType() TopicOption {
+	return func(o *topicOptions) {
+		o.strictType = true
+	}
+}
+
+// RegisterTopic 注册 topic 与 protobuf 消息类型的绑定。
+// 同一 topic 重复注册为不同消息类型时会 panic，与 protobuf 注册表的行为一致，
+// 以便在程序启动时就暴露绑定冲突。
+func RegisterTopic[T proto.Message](topic string, opts ...TopicOption) *TopicBinding[T] {
+	if topic == "" {
+		panic("kafka: topic cannot be empty")
+	}
+
+	o := &topicOptions{schemaVersion: 1}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	var zero T
+	messageType := string(zero.ProtoReflect().Descriptor().FullName())
+
+	topicRegistryMu.Lock()
+	defer topicRegistryMu.Unlock()
+	if existing, ok := topicRegistry[topic]; ok && existing != messageType {
+		panic(fmt.Sprintf("kafka: topic %q already registered with message type %s", topic, existing))
+	}
+	topicRegistry[topic] = messageType
+
+	return &TopicBinding[T]{
+		topic:         topic,
+		messageType:   messageType,
+		schemaVersion: o.schemaVersion,
+		strictType:    o.strictType,
+	}
+}
+
+// Topic 返回绑定的 topic 名称
+func (b *TopicBinding[T]) Topic() string {
+	return b.topic
+}
+
+// MessageType 返回绑定的 protobuf 消息全名
+func (b *TopicBinding[T]) MessageType() string {
+	return b.messageType
+}
+
+// SchemaVersion 返回写入消息头的 schema 版本
+func (b *TopicBinding[T]) SchemaVersion() int {
+	return b.schemaVersion
+}
+
+// Encode 将 protobuf 消息编码为带类型头和版本头的 Message
+func (b *TopicBinding[T]) Encode(key []byte, value T) (*Message, error) {
+	data, err := proto.Marshal(value)
+	if err != nil {
+		return nil, ErrProducer("序列化 protobuf 消息失败", err)
+	}
+
+	return &Message{
+		Topic: b.topic,
+		Key:   key,
+		Value: data,
+		Headers: map[string][]byte{
+			HeaderMessageType:   []byte(b.messageType),
+			HeaderSchemaVersion: []byte(strconv.Itoa(b.schemaVersion)),
+			HeaderContentType:   []byte(ContentTypeProtobuf),
+		},
+	}, nil
+}
+
+// Decode 校验消息类型头并解码为 protobuf 消息
+func (b *TopicBinding[T]) Decode(msg *Message) (*TypedMessage[T], error) {
+	messageType := string(msg.Headers[HeaderMessageType])
+	if messageType == "" && b.strictType {
+		return nil, ErrConsumer("消息缺少类型头", fmt.Errorf("expected %s", b.messageType))
+	}
+	if messageType != "" && messageType != b.messageType {
+		return nil, ErrConsumer("消息类型不匹配", fmt.Errorf("expected %s, got %s", b.messageType, messageType))
+	}
+
+	var zero T
+	value := zero.ProtoReflect().Type().New().Interface().(T)
+	if err := proto.Unmarshal(msg.Value, value); err != nil {
+		return nil, ErrConsumer("反序列化 protobuf 消息失败", err)
+	}
+
+	// 缺少版本头的消息视为版本 0
+	version, _ := strconv.Atoi(string(msg.Headers[HeaderSchemaVersion]))
+
+	return &TypedMessage[T]{
+		Topic:         msg.Topic,
+		Key:           msg.Key,
+		Value:         value,
+		Headers:       msg.Headers,
+		SchemaVersion: version,
+	}, nil
+}
+
+// Producer 基于已有的生产者创建类型化生产者
+func (b *TopicBinding[T]) Producer(producer ProducerOperations) *TypedProducer[T] {
+	return &TypedProducer[T]{binding: b, producer: producer}
+}
+
+// Consumer 基于已有的消费者创建类型化消费者
+func (b *TopicBinding[T]) Consumer(consumer ConsumerOperations) *TypedConsumer[T] {
+	return &TypedConsumer[T]{binding: b, consumer: consumer}
+}
+
+// TypedMessage 是解码后的类型化消息
+type TypedMessage[T proto.Message] struct {
+	Topic   string
+	Key     []byte
+	Value   T
+	Headers map[string][]byte
+	// SchemaVersion 生产者写入的 schema 版本，缺少版本头时为 0
+	SchemaVersion int
+}
+
+// TypedConsumeCallback 定义了类型化消息的处理回调
+type TypedConsumeCallback[T proto.Message] func(ctx context.Context, msg *TypedMessage[T]) error
+
+// TypedProducer 发送绑定类型的 protobuf 消息
+type TypedProducer[T proto.Message] struct {
+	binding  *TopicBinding[T]
+	producer ProducerOperations
+}
+
+// Send 异步发送消息
+func (p *TypedProducer[T]) Send(ctx context.Context, key []byte, value T, callback func(error)) {
+	msg, err := p.binding.Encode(key, value)
+	if err != nil {
+		if callback != nil {
+			callback(err)
+		}
+		return
+	}
+	p.producer.Send(ctx, msg, callback)
+}
+
+// SendSync 同步发送消息
+func (p *TypedProducer[T]) SendSync(ctx context.Context, key []byte, value T) error {
+	msg, err := p.binding.Encode(key, value)
+	if err != nil {
+		return err
+	}
+	return p.producer.SendSync(ctx, msg)
+}
+
+// TypedConsumer 订阅绑定的 topic 并解码 protobuf 消息
+type TypedConsumer[T proto.Message] struct {
+	binding  *TopicBinding[T]
+	consumer ConsumerOperations
+}
+
+// Subscribe 订阅绑定的 topic，过滤器在 protobuf 解码之前执行。
+// 解码失败的消息会作为处理失败返回给底层消费者，不会调用 callback。
+func (c *TypedConsumer[T]) Subscribe(ctx context.Context, callback TypedConsumeCallback[T], opts ...SubscribeOption) error {
+	return c.consumer.Subscribe(ctx, []string{c.binding.topic}, func(ctx context.Context, msg *Message) error {
+		typed, err := c.binding.Decode(msg)
+		if err != nil {
+			return err
+		}
+		return callback(ctx, typed)
+	}, opts...)
+}
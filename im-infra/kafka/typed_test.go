@@ -0,0 +1,79 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// captureProducer 记录发送的消息，用于测试类型化生产者
+type captureProducer struct {
+	ProducerOperations
+	sent []*Message
+}
+
+func (p *captureProducer) SendSync(ctx context.Context, msg *Message) error {
+	p.sent = append(p.sent, msg)
+	return nil
+}
+
+func TestTopicBinding(t *testing.T) {
+	binding := RegisterTopic[*wrapperspb.StringValue]("test.typed.events", WithSchemaVersion(2))
+	assert.Equal(t, "test.typed.events", binding.Topic())
+	assert.Equal(t, "google.protobuf.StringValue", binding.MessageType())
+
+	t.Run("Encode and Decode", func(t *testing.T) {
+		producer := &captureProducer{}
+		err := binding.Producer(producer).SendSync(context.Background(), []byte("k1"), wrapperspb.String("hello"))
+		require.NoError(t, err)
+		require.Len(t, producer.sent, 1)
+
+		msg := producer.sent[0]
+		assert.Equal(t, "test.typed.events", msg.Topic)
+		assert.Equal(t, "google.protobuf.StringValue", string(msg.Headers[HeaderMessageType]))
+		assert.Equal(t, "2", string(msg.Headers[HeaderSchemaVersion]))
+		assert.Equal(t, ContentTypeProtobuf, string(msg.Headers[HeaderContentType]))
+
+		typed, err := binding.Decode(msg)
+		require.NoError(t, err)
+		assert.Equal(t, "hello", typed.Value.GetValue())
+		assert.Equal(t, []byte("k1"), typed.Key)
+		assert.Equal(t, 2, typed.SchemaVersion)
+	})
+
+	t.Run("Message Type Mismatch", func(t *testing.T) {
+		msg := &Message{
+			Topic:   "test.typed.events",
+			Headers: map[string][]byte{HeaderMessageType: []byte("google.protobuf.Int64Value")},
+		}
+		_, err := binding.Decode(msg)
+		assert.True(t, IsConsumerError(err))
+	})
+
+	t.Run("Missing Headers", func(t *testing.T) {
+		msg, err := binding.Encode(nil, wrapperspb.String("legacy"))
+		require.NoError(t, err)
+		msg.Headers = nil
+
+		typed, err := binding.Decode(msg)
+		require.NoError(t, err)
+		assert.Equal(t, "legacy", typed.Value.GetValue())
+		assert.Equal(t, 0, typed.SchemaVersion)
+
+		strict := RegisterTopic[*wrapperspb.StringValue]("test.typed.strict", WithStrictMessageType())
+		_, err = strict.Decode(msg)
+		assert.Error(t, err)
+	})
+
+	t.Run("Conflicting Registration", func(t *testing.T) {
+		assert.NotPanics(t, func() {
+			RegisterTopic[*wrapperspb.StringValue]("test.typed.events")
+		})
+		assert.Panics(t, func() {
+			RegisterTopic[*wrapperspb.Int64Value]("test.typed.events")
+		})
+	})
+}
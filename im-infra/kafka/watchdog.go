@@ -0,0 +1,336 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/twmb/franz-go/pkg/kadm"
+)
+
+// WatchdogConfig 定义订阅健康看门狗。
+// 看门狗为每个订阅记录心跳（最近一次拉取返回和处理消息的时间），订阅在仍有积压的情况下
+// 超过 StallTimeoutMs 没有进展时判定为停滞，自动重启该订阅的消费者组会话。
+type WatchdogConfig struct {
+	// StallTimeoutMs 有积压但没有进展的最长时间(毫秒)，超过后判定为停滞，必须大于 0
+	StallTimeoutMs int `json:"stallTimeoutMs"`
+	// CheckIntervalMs 检查间隔(毫秒)，默认为 StallTimeoutMs 的 1/4
+	CheckIntervalMs int `json:"checkIntervalMs,omitempty"`
+	// LagTimeoutMs 每次检查查询消费延迟的超时时间(毫秒)，默认 5000
+	LagTimeoutMs int `json:"lagTimeoutMs,omitempty"`
+}
+
+// 看门狗事件原因
+const (
+	// WatchdogStalled 订阅有积压但超过 StallTimeoutMs 没有进展，已尝试重启消费者组会话
+	WatchdogStalled = "stalled"
+	// WatchdogHandlerBlocked 回调处理单条消息超过 StallTimeoutMs，重启会话无法解除，只上报不恢复
+	WatchdogHandlerBlocked = "handler_blocked"
+)
+
+// WatchdogEvent 描述看门狗检测到的一次停滞及恢复结果
+type WatchdogEvent struct {
+	GroupID string
+	// Topics 订阅的逻辑主题
+	Topics []string
+	// Reason 停滞原因：WatchdogStalled 或 WatchdogHandlerBlocked
+	Reason string
+	// Backlog 检测时该订阅在本成员负责的分区上的积压消息数
+	Backlog int64
+	// StalledFor 距离最近一次进展的时间
+	StalledFor time.Duration
+	// Attempt 连续第几次恢复，订阅恢复进展后重新从 1 开始
+	Attempt int
+	// Err 重启会话前提交已处理偏移量失败的原因，会话仍会重启，未提交的消息会被重新投递
+	Err  error
+	Time time.Time
+}
+
+// WatchdogHandler 看门狗事件回调，在看门狗 goroutine 中同步执行，不应阻塞
+type WatchdogHandler func(WatchdogEvent)
+
+// WithWatchdogHandler 注册看门狗事件回调，仅在配置了 ConsumerConfig.Watchdog 时生效，可注册多个。
+func WithWatchdogHandler(handler WatchdogHandler) Option {
+	return func(o *options) {
+		o.watchdogHandlers = append(o.watchdogHandlers, handler)
+	}
+}
+
+// validateWatchdogConfig 校验看门狗配置，nil 表示不开启
+func validateWatchdogConfig(cfg *WatchdogConfig) error {
+	if cfg == nil {
+		return nil
+	}
+	if cfg.StallTimeoutMs <= 0 {
+		return ErrInvalidConfig("watchdog stallTimeoutMs 必须大于 0")
+	}
+	if cfg.CheckIntervalMs < 0 || cfg.LagTimeoutMs < 0 {
+		return ErrInvalidConfig("watchdog 时间参数不能为负数")
+	}
+	return nil
+}
+
+// subscription 一次 Subscribe 的拉取循环状态
+type subscription struct {
+	topics   []string
+	physical []string
+
+	// lastProgress 最近一次拉取返回或处理消息的时间（UnixNano）
+	lastProgress atomic.Int64
+	// handlingSince 当前消息开始处理的时间（UnixNano），0 表示没有正在处理的消息
+	handlingSince atomic.Int64
+	// blockedReported 当前阻塞的回调是否已上报
+	blockedReported atomic.Bool
+	// attempts 连续恢复次数
+	attempts atomic.Int32
+
+	mu sync.Mutex
+	// next 每个分区下一条待处理消息的偏移量，"topic/partition" -> offset
+	next map[string]int64
+	// cancelPoll 取消当前这一次拉取，用于打断卡住的 PollFetches
+	cancelPoll context.CancelFunc
+}
+
+func newSubscription(topics, physical []string) *subscription {
+	s := &subscription{
+		topics:   topics,
+		physical: physical,
+		next:     make(map[string]int64),
+	}
+	s.progress()
+	return s
+}
+
+// progress 记录一次心跳
+func (s *subscription) progress() {
+	s.lastProgress.Store(time.Now().UnixNano())
+}
+
+// handled 记录一条消息处理完成，更新分区进度，订阅恢复进展后连续恢复次数清零
+func (s *subscription) handled(topic string, partition int32, offset int64) {
+	s.mu.Lock()
+	s.next[fmt.Sprintf("%s/%d", topic, partition)] = offset + 1
+	s.mu.Unlock()
+	s.attempts.Store(0)
+	s.progress()
+}
+
+// beginHandling 和 endHandling 标记回调的执行区间
+func (s *subscription) beginHandling() {
+	s.handlingSince.Store(time.Now().UnixNano())
+}
+
+func (s *subscription) endHandling() {
+	s.handlingSince.Store(0)
+	s.blockedReported.Store(false)
+}
+
+// setPollCancel 记录当前拉取的取消函数
+func (s *subscription) setPollCancel(cancel context.CancelFunc) {
+	s.mu.Lock()
+	s.cancelPoll = cancel
+	s.mu.Unlock()
+}
+
+// interruptPoll 打断当前的拉取，拉取循环会立即开始下一次拉取
+func (s *subscription) interruptPoll() {
+	s.mu.Lock()
+	cancel := s.cancelPoll
+	s.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// backlog 计算订阅在本成员负责（或暂未分配）的分区上的积压，
+// 已处理但尚未提交的消息按本地进度扣除，避免关闭自动提交时空闲订阅被误判为停滞
+func (s *subscription) backlog(lag kadm.GroupLag, memberID string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var total int64
+	for _, topic := range s.physical {
+		for partition, l := range lag[topic] {
+			if l.Err != nil || (l.Member != nil && l.Member.MemberID != memberID) {
+				continue
+			}
+			done := max(l.Commit.At, s.next[fmt.Sprintf("%s/%d", topic, partition)])
+			if l.End.Offset > done {
+				total += l.End.Offset - done
+			}
+		}
+	}
+	return total
+}
+
+// watchdog 周期性检查消费者的所有订阅
+type watchdog struct {
+	consumer   *consumerImpl
+	stall      time.Duration
+	interval   time.Duration
+	lagTimeout time.Duration
+	handlers   []WatchdogHandler
+
+	stalls       atomic.Int64
+	commitErrors atomic.Int64
+	blocked      atomic.Int64
+}
+
+// newWatchdog 创建看门狗，未配置时返回 nil
+func newWatchdog(consumer *consumerImpl, cfg *WatchdogConfig, handlers []WatchdogHandler) *watchdog {
+	if cfg == nil {
+		return nil
+	}
+	w := &watchdog{
+		consumer:   consumer,
+		stall:      time.Duration(cfg.StallTimeoutMs) * time.Millisecond,
+		interval:   time.Duration(cfg.CheckIntervalMs) * time.Millisecond,
+		lagTimeout: time.Duration(cfg.LagTimeoutMs) * time.Millisecond,
+		handlers:   handlers,
+	}
+	if w.interval <= 0 {
+		w.interval = w.stall / 4
+	}
+	if w.lagTimeout <= 0 {
+		w.lagTimeout = 5 * time.Second
+	}
+	return w
+}
+
+// run 按检查间隔检查订阅，直到 ctx 结束
+func (w *watchdog) run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.check(ctx)
+		}
+	}
+}
+
+// check 检查一次所有订阅，查询消费延迟失败时跳过本轮：broker 不可达不是重启会话能解决的
+func (w *watchdog) check(ctx context.Context) {
+	c := w.consumer
+	subs := c.subscriptionList()
+	if len(subs) == 0 || c.closing.Load() {
+		return
+	}
+
+	now := time.Now()
+	for _, sub := range subs {
+		if since := sub.handlingSince.Load(); since > 0 && now.Sub(time.Unix(0, since)) >= w.stall &&
+			sub.blockedReported.CompareAndSwap(false, true) {
+			w.blocked.Add(1)
+			w.emit(WatchdogEvent{
+				GroupID:    c.groupID,
+				Topics:     sub.topics,
+				Reason:     WatchdogHandlerBlocked,
+				StalledFor: now.Sub(time.Unix(0, since)),
+				Time:       now,
+			})
+		}
+	}
+
+	lagCtx, cancel := context.WithTimeout(ctx, w.lagTimeout)
+	lags, err := kadm.NewClient(c.client).Lag(lagCtx, c.groupID)
+	cancel()
+	if err != nil {
+		c.logger.Warn("看门狗查询消费延迟失败", clog.String("group_id", c.groupID), clog.Err(err))
+		return
+	}
+	groupLag, ok := lags[c.groupID]
+	if !ok || groupLag.Error() != nil {
+		c.logger.Warn("看门狗查询消费延迟失败", clog.String("group_id", c.groupID), clog.Err(groupLag.Error()))
+		return
+	}
+	memberID, _ := c.client.GroupMetadata()
+
+	for _, sub := range subs {
+		if sub.handlingSince.Load() > 0 {
+			continue
+		}
+		idle := now.Sub(time.Unix(0, sub.lastProgress.Load()))
+		if idle < w.stall {
+			continue
+		}
+		backlog := sub.backlog(groupLag.Lag, memberID)
+		if backlog == 0 {
+			continue
+		}
+		w.restart(ctx, sub, backlog, idle)
+	}
+}
+
+// restart 重启订阅的消费者组会话：提交已处理的偏移量，打断卡住的拉取，
+// 将订阅的主题移出消费列表后重新加入，触发重新加入消费者组和分区重新分配
+func (w *watchdog) restart(ctx context.Context, sub *subscription, backlog int64, idle time.Duration) {
+	c := w.consumer
+	w.stalls.Add(1)
+	attempt := int(sub.attempts.Add(1))
+
+	c.logger.Warn("订阅停滞，重启消费者组会话",
+		clog.String("group_id", c.groupID),
+		clog.Strings("topics", sub.topics),
+		clog.Int64("backlog", backlog),
+		clog.Duration("stalled_for", idle),
+		clog.Int("attempt", attempt),
+	)
+
+	commitCtx, cancel := context.WithTimeout(ctx, w.lagTimeout)
+	err := c.client.CommitMarkedOffsets(commitCtx)
+	cancel()
+	if err != nil {
+		// 未提交的偏移量在重新分配后会被重复投递，由回调的幂等性保证正确
+		w.commitErrors.Add(1)
+		c.logger.Warn("重启会话前提交偏移量失败", clog.String("group_id", c.groupID), clog.Err(err))
+	}
+
+	sub.interruptPoll()
+	c.client.PurgeTopicsFromConsuming(sub.physical...)
+	c.client.AddConsumeTopics(sub.physical...)
+	// 重新计时，给重新加入消费者组留出一个完整的 StallTimeoutMs
+	sub.progress()
+
+	w.emit(WatchdogEvent{
+		GroupID:    c.groupID,
+		Topics:     sub.topics,
+		Reason:     WatchdogStalled,
+		Backlog:    backlog,
+		StalledFor: idle,
+		Attempt:    attempt,
+		Err:        err,
+		Time:       time.Now(),
+	})
+}
+
+// emit 执行事件回调，回调 panic 不影响看门狗
+func (w *watchdog) emit(event WatchdogEvent) {
+	for _, handler := range w.handlers {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					w.consumer.logger.Error("看门狗事件回调 panic", clog.Any("panic", r))
+				}
+			}()
+			handler(event)
+		}()
+	}
+}
+
+// addMetrics 将看门狗计数加入消费者指标，未开启时为空操作
+func (w *watchdog) addMetrics(metrics map[string]interface{}) {
+	if w == nil {
+		return
+	}
+	// 每次检测到停滞都会重启一次会话
+	metrics["watchdog_recoveries"] = w.stalls.Load()
+	metrics["watchdog_commit_errors"] = w.commitErrors.Load()
+	metrics["watchdog_blocked_handlers"] = w.blocked.Load()
+}
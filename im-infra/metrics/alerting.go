@@ -0,0 +1,584 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/metrics/internal"
+	"github.com/prometheus/otlptranslator"
+	"gopkg.in/yaml.v3"
+)
+
+// InstrumentKind 仪表类型
+type InstrumentKind = internal.InstrumentKind
+
+// 仪表类型
+const (
+	InstrumentCounter   = internal.InstrumentCounter
+	InstrumentHistogram = internal.InstrumentHistogram
+	InstrumentGauge     = internal.InstrumentGauge
+)
+
+// InstrumentInfo 描述一个已声明的指标仪表
+type InstrumentInfo = internal.Instrument
+
+// Instruments 返回当前进程中已声明的所有仪表，按名称排序。
+//
+// 包括 NewCounter/NewHistogram 创建的自定义指标、Operation 的 RED 指标、
+// 已使用的拦截器/中间件的请求指标，以及 kafkametrics.Instrument/InstrumentCache 导出的指标。
+func Instruments() []InstrumentInfo {
+	return internal.Instruments()
+}
+
+// registerInstrument 记录一个已声明的仪表，供告警规则生成使用
+func registerInstrument(name string, kind InstrumentKind, unit, description string) {
+	internal.RegisterInstrument(internal.Instrument{
+		Name:        name,
+		Kind:        kind,
+		Unit:        unit,
+		Description: description,
+	})
+}
+
+// SLO 的指标来源
+const (
+	// SLOSourceOperation 基于 Operation 的 RED 指标，需要设置 SLO.Operation
+	SLOSourceOperation = "operation"
+	// SLOSourceGRPCServer 基于 gRPC 服务端拦截器的请求指标
+	SLOSourceGRPCServer = "grpc_server"
+	// SLOSourceHTTPServer 基于 HTTP 中间件的请求指标
+	SLOSourceHTTPServer = "http_server"
+)
+
+// ErrSLONotFound 表示 SLO 引用的指标在当前进程中没有被声明
+var ErrSLONotFound = errors.New("metrics: slo source instruments are not registered")
+
+// SLO 定义一个服务等级目标，GenerateAlertRules 会为其生成多窗口错误预算消耗率（burn rate）告警。
+//
+// LatencyThreshold 为 0 时是可用性 SLO：非错误请求的占比需达到 Objective；
+// 否则是延迟 SLO：耗时不超过 LatencyThreshold 的请求占比需达到 Objective。
+// LatencyThreshold 必须是耗时直方图的分桶边界（即导出的 le 标签值），否则规则查询不到数据。
+type SLO struct {
+	// Name SLO 名称，写入 slo 标签，同名 SLO 后注册的覆盖先注册的
+	Name string
+	// Source 指标来源：SLOSourceOperation、SLOSourceGRPCServer 或 SLOSourceHTTPServer
+	Source string
+	// Operation Source 为 SLOSourceOperation 时的操作名称
+	Operation string
+	// Filter 附加的 PromQL 标签匹配器，如 `rpc_service="/im.logic.v1.MessageService/Send"`
+	Filter string
+	// Objective 目标达成率，取值 (0, 1)，如 0.999
+	Objective float64
+	// LatencyThreshold 延迟阈值，为 0 表示可用性 SLO
+	LatencyThreshold time.Duration
+}
+
+// Validate 验证 SLO 定义的有效性
+func (s *SLO) Validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("slo name cannot be empty")
+	}
+	switch s.Source {
+	case SLOSourceOperation:
+		if s.Operation == "" {
+			return fmt.Errorf("slo %s: operation cannot be empty for source %s", s.Name, s.Source)
+		}
+	case SLOSourceGRPCServer, SLOSourceHTTPServer:
+	default:
+		return fmt.Errorf("slo %s: unknown source %q", s.Name, s.Source)
+	}
+	if s.Objective <= 0 || s.Objective >= 1 {
+		return fmt.Errorf("slo %s: objective must be in (0, 1), got: %v", s.Name, s.Objective)
+	}
+	if s.LatencyThreshold < 0 {
+		return fmt.Errorf("slo %s: latency threshold cannot be negative, got: %v", s.Name, s.LatencyThreshold)
+	}
+	return nil
+}
+
+var (
+	slosMu sync.RWMutex
+	slos   = make(map[string]SLO)
+)
+
+// RegisterSLO 注册一个 SLO，通常在服务初始化、创建对应的 Operation 或拦截器时一并声明。
+//
+// 示例：
+//
+//	err := metrics.RegisterSLO(metrics.SLO{
+//	    Name:      "send_message_availability",
+//	    Source:    metrics.SLOSourceOperation,
+//	    Operation: "send_message",
+//	    Objective: 0.999,
+//	})
+func RegisterSLO(slo SLO) error {
+	if err := slo.Validate(); err != nil {
+		return err
+	}
+	slosMu.Lock()
+	defer slosMu.Unlock()
+	slos[slo.Name] = slo
+	return nil
+}
+
+// SLOs 返回所有已注册的 SLO，按名称排序
+func SLOs() []SLO {
+	slosMu.RLock()
+	defer slosMu.RUnlock()
+
+	list := make([]SLO, 0, len(slos))
+	for _, slo := range slos {
+		list = append(list, slo)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// AlertRulesConfig 定义了告警规则生成的参数
+type AlertRulesConfig struct {
+	// ServiceName 服务名称，用作规则组名并写入所有规则的 service 标签
+	ServiceName string
+
+	// Selector 附加到所有原始指标查询上的标签匹配器，用于只选中本服务的时间序列。
+	// 默认值：job="{ServiceName}"
+	Selector string
+
+	// ErrorRatioThreshold 错误率告警的阈值，默认 0.05（5%）
+	ErrorRatioThreshold float64
+
+	// ErrorRatioFor 错误率持续超过阈值多久后触发告警，默认 5 分钟
+	ErrorRatioFor time.Duration
+
+	// ConsumerLagThreshold Kafka 消费延迟告警的阈值（消息数），默认 10000
+	ConsumerLagThreshold int64
+
+	// ConsumerLagFor 消费延迟持续超过阈值多久后触发告警，默认 10 分钟
+	ConsumerLagFor time.Duration
+}
+
+// DefaultAlertRulesConfig 返回指定服务的默认告警规则配置
+func DefaultAlertRulesConfig(serviceName string) *AlertRulesConfig {
+	return &AlertRulesConfig{
+		ServiceName:          serviceName,
+		Selector:             fmt.Sprintf("job=%q", serviceName),
+		ErrorRatioThreshold:  0.05,
+		ErrorRatioFor:        5 * time.Minute,
+		ConsumerLagThreshold: 10000,
+		ConsumerLagFor:       10 * time.Minute,
+	}
+}
+
+// Validate 验证告警规则配置的有效性
+func (c *AlertRulesConfig) Validate() error {
+	if c.ServiceName == "" {
+		return fmt.Errorf("alert rules service name cannot be empty")
+	}
+	if c.ErrorRatioThreshold <= 0 || c.ErrorRatioThreshold >= 1 {
+		return fmt.Errorf("error ratio threshold must be in (0, 1), got: %v", c.ErrorRatioThreshold)
+	}
+	if c.ErrorRatioFor < 0 || c.ConsumerLagFor < 0 {
+		return fmt.Errorf("alert for durations cannot be negative")
+	}
+	if c.ConsumerLagThreshold <= 0 {
+		return fmt.Errorf("consumer lag threshold must be positive, got: %d", c.ConsumerLagThreshold)
+	}
+	return nil
+}
+
+// GenerateAlertRules 遍历当前进程中已声明的仪表和已注册的 SLO，生成 Prometheus 规则文件（YAML）。
+//
+// 生成两个规则组：
+//   - {service}.recording：请求错误率、耗时直方图 p99 和 SLO 各窗口错误率的 recording rules
+//   - {service}.alerts：错误率、Kafka 消费延迟、Redis 健康状态和 SLO burn rate 告警
+//
+// 只有实际声明过的仪表才会生成规则，因此应在服务完成初始化（创建拦截器、Operation、
+// kafkametrics.Instrument 等）之后调用。SLO 引用的指标未声明时返回 ErrSLONotFound。
+//
+// 示例：
+//
+//	rules, err := metrics.GenerateAlertRules(metrics.DefaultAlertRulesConfig("im-logic"))
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	os.WriteFile("im-logic.rules.yml", rules, 0o644)
+func GenerateAlertRules(cfg *AlertRulesConfig) ([]byte, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	g := &ruleGenerator{
+		cfg:         cfg,
+		instruments: make(map[string]InstrumentInfo),
+	}
+	if g.cfg.Selector == "" {
+		selectorCfg := *cfg
+		selectorCfg.Selector = fmt.Sprintf("job=%q", cfg.ServiceName)
+		g.cfg = &selectorCfg
+	}
+	for _, inst := range Instruments() {
+		g.instruments[inst.Name] = inst
+	}
+
+	recording := ruleGroup{Name: cfg.ServiceName + ".recording"}
+	alerts := ruleGroup{Name: cfg.ServiceName + ".alerts"}
+
+	for _, source := range errorRatioSources {
+		if inst, ok := g.instruments[source.requests]; ok {
+			recording.Rules = append(recording.Rules, g.errorRatioRecord(source, inst))
+			alerts.Rules = append(alerts.Rules, g.errorRatioAlert(source))
+		}
+	}
+	for _, inst := range Instruments() {
+		if inst.Kind == InstrumentHistogram && inst.Unit == "s" {
+			recording.Rules = append(recording.Rules, g.latencyRecord(inst))
+		}
+	}
+	if inst, ok := g.instruments["kafka_consumer_lag"]; ok {
+		alerts.Rules = append(alerts.Rules, g.consumerLagAlert(inst))
+	}
+	if inst, ok := g.instruments["redis_healthy"]; ok {
+		alerts.Rules = append(alerts.Rules, g.redisHealthAlert(inst))
+	}
+
+	for _, slo := range SLOs() {
+		records, err := g.sloRecords(slo)
+		if err != nil {
+			return nil, err
+		}
+		recording.Rules = append(recording.Rules, records...)
+		alerts.Rules = append(alerts.Rules, g.sloAlerts(slo)...)
+	}
+
+	file := ruleFile{}
+	for _, group := range []ruleGroup{recording, alerts} {
+		if len(group.Rules) > 0 {
+			file.Groups = append(file.Groups, group)
+		}
+	}
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(file); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteAlertRules 生成告警规则并写入文件，便于在 CI 或启动参数中导出
+func WriteAlertRules(path string, cfg *AlertRulesConfig) error {
+	data, err := GenerateAlertRules(cfg)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// ruleFile 是 Prometheus 规则文件的结构
+type ruleFile struct {
+	Groups []ruleGroup `yaml:"groups"`
+}
+
+type ruleGroup struct {
+	Name  string `yaml:"name"`
+	Rules []rule `yaml:"rules"`
+}
+
+type rule struct {
+	Record      string            `yaml:"record,omitempty"`
+	Alert       string            `yaml:"alert,omitempty"`
+	Expr        string            `yaml:"expr"`
+	For         string            `yaml:"for,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+// errorRatioSource 描述一组请求计数指标中如何区分错误请求
+type errorRatioSource struct {
+	requests string // 请求计数仪表名称
+	record   string // recording rule 名称前缀
+	alert    string // 告警名称前缀
+	by       string // 分组标签，为空表示不分组
+	errors   string // 错误请求的标签匹配器
+}
+
+// errorRatioSources 已知的请求计数指标。
+// gRPC 只把服务端故障（Unknown、DeadlineExceeded、Unimplemented、Internal、Unavailable、DataLoss）计为错误，
+// 参数错误、未找到、鉴权失败等客户端错误不计入。
+var errorRatioSources = []errorRatioSource{
+	{requests: "rpc.server.requests.count", record: "grpc_server", alert: "GRPCServer", by: "rpc_service", errors: `rpc_grpc_status_code=~"2|4|12|13|14|15"`},
+	{requests: "rpc.client.requests.count", record: "grpc_client", alert: "GRPCClient", by: "rpc_service", errors: `rpc_grpc_status_code=~"2|4|12|13|14|15"`},
+	{requests: "http.server.requests.count", record: "http_server", alert: "HTTPServer", by: "http_route", errors: `http_status_code=~"5.."`},
+	{requests: operationRequestsMetric, record: "operation", alert: "Operation", by: operationLabel, errors: statusLabel + `="` + statusError + `"`},
+	{requests: "kafka_producer_messages_total", record: "kafka_producer", alert: "KafkaProducer", errors: `result="failed"`},
+	{requests: "kafka_consumer_messages_total", record: "kafka_consumer", alert: "KafkaConsumer", by: "group", errors: `result="failed"`},
+}
+
+// latencyGrouping 已知耗时直方图的分组标签，其他直方图只计算整体 p99
+var latencyGrouping = map[string]string{
+	"rpc.server.duration":   "rpc_service",
+	"rpc.client.duration":   "rpc_service",
+	"http.server.duration":  "http_route",
+	operationDurationMetric: operationLabel,
+}
+
+// sloWindows 多窗口 burn rate 告警使用的错误率窗口
+var sloWindows = []time.Duration{
+	5 * time.Minute, 30 * time.Minute, time.Hour, 2 * time.Hour, 6 * time.Hour, 24 * time.Hour, 72 * time.Hour,
+}
+
+// burnRateAlert 一条多窗口 burn rate 告警：长窗口和短窗口的错误率同时超过 factor 倍错误预算时触发。
+// 因子取自 Google SRE Workbook，以 30 天周期计：14.4 倍 1 小时消耗 2% 预算，6 倍 6 小时消耗 5%，
+// 3 倍 1 天消耗 10%，1 倍 3 天消耗 10%。
+type burnRateAlert struct {
+	long, short time.Duration
+	factor      float64
+}
+
+var (
+	pageBurnRates   = []burnRateAlert{{time.Hour, 5 * time.Minute, 14.4}, {6 * time.Hour, 30 * time.Minute, 6}}
+	ticketBurnRates = []burnRateAlert{{24 * time.Hour, 2 * time.Hour, 3}, {72 * time.Hour, 6 * time.Hour, 1}}
+)
+
+// prometheusNamer 与 Prometheus exporter 使用相同的命名规则
+var prometheusNamer = otlptranslator.NewMetricNamer("", otlptranslator.UnderscoreEscapingWithSuffixes)
+
+// ruleGenerator 持有一次生成过程的配置和仪表快照
+type ruleGenerator struct {
+	cfg         *AlertRulesConfig
+	instruments map[string]InstrumentInfo
+}
+
+// metricName 返回仪表在 Prometheus 中的名称，如 rpc.server.duration -> rpc_server_duration_seconds
+func (g *ruleGenerator) metricName(inst InstrumentInfo) string {
+	var metricType otlptranslator.MetricType = otlptranslator.MetricTypeGauge
+	switch inst.Kind {
+	case InstrumentCounter:
+		metricType = otlptranslator.MetricTypeMonotonicCounter
+	case InstrumentHistogram:
+		metricType = otlptranslator.MetricTypeHistogram
+	}
+	name, err := prometheusNamer.Build(otlptranslator.Metric{Name: inst.Name, Unit: inst.Unit, Type: metricType})
+	if err != nil {
+		// 仪表名称不含非法 UTF-8 字符时不会出错，回退为原始名称
+		return inst.Name
+	}
+	return name
+}
+
+// selector 拼接指标名和标签匹配器，空的匹配器会被忽略
+func (g *ruleGenerator) selector(metric string, matchers ...string) string {
+	all := []string{}
+	for _, m := range append([]string{g.cfg.Selector}, matchers...) {
+		if m != "" {
+			all = append(all, m)
+		}
+	}
+	return metric + "{" + strings.Join(all, ",") + "}"
+}
+
+// labels 返回规则的公共标签
+func (g *ruleGenerator) labels(extra ...string) map[string]string {
+	labels := map[string]string{"service": g.cfg.ServiceName}
+	for i := 0; i+1 < len(extra); i += 2 {
+		labels[extra[i]] = extra[i+1]
+	}
+	return labels
+}
+
+// errorRatioRecord 生成 5 分钟错误率的 recording rule
+func (g *ruleGenerator) errorRatioRecord(source errorRatioSource, inst InstrumentInfo) rule {
+	metric := g.metricName(inst)
+	sum := "sum"
+	if source.by != "" {
+		sum = "sum by (" + source.by + ")"
+	}
+	return rule{
+		Record: source.record + ":error_ratio:rate5m",
+		Expr: fmt.Sprintf("%s (rate(%s[5m]))\n/\n%s (rate(%s[5m]))",
+			sum, g.selector(metric, source.errors), sum, g.selector(metric)),
+		Labels: g.labels(),
+	}
+}
+
+// errorRatioAlert 生成错误率超过阈值的告警
+func (g *ruleGenerator) errorRatioAlert(source errorRatioSource) rule {
+	target := g.cfg.ServiceName + " " + source.record
+	if source.by != "" {
+		target += " {{ $labels." + source.by + " }}"
+	}
+	return rule{
+		Alert:  source.alert + "HighErrorRatio",
+		Expr:   fmt.Sprintf("%s:error_ratio:rate5m{service=%q} > %s", source.record, g.cfg.ServiceName, formatFloat(g.cfg.ErrorRatioThreshold)),
+		For:    formatDuration(g.cfg.ErrorRatioFor),
+		Labels: g.labels("severity", "warning"),
+		Annotations: map[string]string{
+			"summary":     target + " error ratio is above " + formatFloat(g.cfg.ErrorRatioThreshold*100) + "%",
+			"description": "Error ratio over the last 5 minutes is {{ $value | humanizePercentage }}.",
+		},
+	}
+}
+
+// latencyRecord 生成耗时直方图 p99 的 recording rule
+func (g *ruleGenerator) latencyRecord(inst InstrumentInfo) rule {
+	metric := g.metricName(inst)
+	by := "le"
+	if label, ok := latencyGrouping[inst.Name]; ok {
+		by = label + ", le"
+	}
+	return rule{
+		Record: metric + ":p99:rate5m",
+		Expr:   fmt.Sprintf("histogram_quantile(0.99, sum by (%s) (rate(%s[5m])))", by, g.selector(metric+"_bucket")),
+		Labels: g.labels(),
+	}
+}
+
+// consumerLagAlert 生成 Kafka 消费延迟告警
+func (g *ruleGenerator) consumerLagAlert(inst InstrumentInfo) rule {
+	threshold := strconv.FormatInt(g.cfg.ConsumerLagThreshold, 10)
+	return rule{
+		Alert:  "KafkaConsumerLagHigh",
+		Expr:   fmt.Sprintf("max by (group) (%s) > %s", g.selector(g.metricName(inst)), threshold),
+		For:    formatDuration(g.cfg.ConsumerLagFor),
+		Labels: g.labels("severity", "warning"),
+		Annotations: map[string]string{
+			"summary":     g.cfg.ServiceName + " consumer group {{ $labels.group }} lag is above " + threshold,
+			"description": "Consumer lag is {{ $value }} messages.",
+		},
+	}
+}
+
+// redisHealthAlert 生成 Redis 看门狗判定连接异常的告警
+func (g *ruleGenerator) redisHealthAlert(inst InstrumentInfo) rule {
+	return rule{
+		Alert:  "RedisUnhealthy",
+		Expr:   fmt.Sprintf("min by (cache) (%s) == 0", g.selector(g.metricName(inst))),
+		For:    "1m",
+		Labels: g.labels("severity", "critical"),
+		Annotations: map[string]string{
+			"summary":     g.cfg.ServiceName + " redis {{ $labels.cache }} is unhealthy",
+			"description": "The Redis watchdog has reported the connection as unhealthy for more than 1 minute.",
+		},
+	}
+}
+
+// sloRecords 生成 SLO 在各窗口下错误率的 recording rules
+func (g *ruleGenerator) sloRecords(slo SLO) ([]rule, error) {
+	var requestsName, durationName, errorMatcher, scope string
+	switch slo.Source {
+	case SLOSourceOperation:
+		requestsName, durationName = operationRequestsMetric, operationDurationMetric
+		errorMatcher = statusLabel + `="` + statusError + `"`
+		scope = fmt.Sprintf("%s=%q", operationLabel, slo.Operation)
+	case SLOSourceGRPCServer:
+		requestsName, durationName = "rpc.server.requests.count", "rpc.server.duration"
+		errorMatcher = `rpc_grpc_status_code=~"2|4|12|13|14|15"`
+	case SLOSourceHTTPServer:
+		requestsName, durationName = "http.server.requests.count", "http.server.duration"
+		errorMatcher = `http_status_code=~"5.."`
+	}
+
+	requests, ok := g.instruments[requestsName]
+	if !ok {
+		return nil, fmt.Errorf("slo %s: %w: %s", slo.Name, ErrSLONotFound, requestsName)
+	}
+	duration, ok := g.instruments[durationName]
+	if slo.LatencyThreshold > 0 && !ok {
+		return nil, fmt.Errorf("slo %s: %w: %s", slo.Name, ErrSLONotFound, durationName)
+	}
+
+	rules := make([]rule, 0, len(sloWindows))
+	for _, window := range sloWindows {
+		w := formatDuration(window)
+		var expr string
+		if slo.LatencyThreshold > 0 {
+			histogram := g.metricName(duration)
+			le := fmt.Sprintf("le=%q", formatFloat(slo.LatencyThreshold.Seconds()))
+			expr = fmt.Sprintf("1 - (\n  sum(rate(%s[%s]))\n  /\n  sum(rate(%s[%s]))\n)",
+				g.selector(histogram+"_bucket", scope, slo.Filter, le), w,
+				g.selector(histogram+"_count", scope, slo.Filter), w)
+		} else {
+			metric := g.metricName(requests)
+			expr = fmt.Sprintf("sum(rate(%s[%s]))\n/\nsum(rate(%s[%s]))",
+				g.selector(metric, scope, slo.Filter, errorMatcher), w,
+				g.selector(metric, scope, slo.Filter), w)
+		}
+		rules = append(rules, rule{
+			Record: "slo:sli_error:ratio_rate" + w,
+			Expr:   expr,
+			Labels: g.labels("slo", slo.Name),
+		})
+	}
+	return rules, nil
+}
+
+// sloAlerts 生成 SLO 的 page（快速消耗）和 ticket（缓慢消耗）两级 burn rate 告警
+func (g *ruleGenerator) sloAlerts(slo SLO) []rule {
+	budget := 1 - slo.Objective
+	ratio := func(window time.Duration) string {
+		return fmt.Sprintf("slo:sli_error:ratio_rate%s{service=%q,slo=%q}", formatDuration(window), g.cfg.ServiceName, slo.Name)
+	}
+	expr := func(burnRates []burnRateAlert) string {
+		parts := make([]string, 0, len(burnRates))
+		for _, b := range burnRates {
+			threshold := strconv.FormatFloat(b.factor*budget, 'g', 10, 64)
+			parts = append(parts, fmt.Sprintf("(%s > %s and %s > %s)", ratio(b.long), threshold, ratio(b.short), threshold))
+		}
+		return strings.Join(parts, "\nor\n")
+	}
+	objective := formatFloat(slo.Objective * 100)
+
+	return []rule{
+		{
+			Alert:  "SLOErrorBudgetBurn",
+			Expr:   expr(pageBurnRates),
+			For:    "2m",
+			Labels: g.labels("slo", slo.Name, "severity", "page"),
+			Annotations: map[string]string{
+				"summary":     g.cfg.ServiceName + " is burning the error budget of " + slo.Name + " (" + objective + "%) fast",
+				"description": "At the current rate the 30-day error budget will be exhausted within days.",
+			},
+		},
+		{
+			Alert:  "SLOErrorBudgetBurn",
+			Expr:   expr(ticketBurnRates),
+			For:    "15m",
+			Labels: g.labels("slo", slo.Name, "severity", "ticket"),
+			Annotations: map[string]string{
+				"summary":     g.cfg.ServiceName + " is steadily burning the error budget of " + slo.Name + " (" + objective + "%)",
+				"description": "At the current rate the 30-day error budget will be exhausted before the period ends.",
+			},
+		},
+	}
+}
+
+// formatDuration 将时长格式化为 Prometheus 的时长字符串，如 5m、1h、3d
+func formatDuration(d time.Duration) string {
+	switch {
+	case d == 0:
+		return ""
+	case d%(24*time.Hour) == 0:
+		return strconv.FormatInt(int64(d/(24*time.Hour)), 10) + "d"
+	case d%time.Hour == 0:
+		return strconv.FormatInt(int64(d/time.Hour), 10) + "h"
+	case d%time.Minute == 0:
+		return strconv.FormatInt(int64(d/time.Minute), 10) + "m"
+	case d%time.Second == 0:
+		return strconv.FormatInt(int64(d/time.Second), 10) + "s"
+	default:
+		return strconv.FormatInt(d.Milliseconds(), 10) + "ms"
+	}
+}
+
+// formatFloat 以最短形式格式化浮点数
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,226 @@
+package metrics
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+// registerTestSLO 注册一个 SLO 并在测试结束后移除，避免影响其他测试生成的规则
+func registerTestSLO(t *testing.T, slo SLO) {
+	t.Helper()
+	require.NoError(t, RegisterSLO(slo))
+	t.Cleanup(func() {
+		slosMu.Lock()
+		defer slosMu.Unlock()
+		delete(slos, slo.Name)
+	})
+}
+
+// generateRules 生成告警规则并解析为规则文件结构
+func generateRules(t *testing.T, cfg *AlertRulesConfig) ruleFile {
+	t.Helper()
+	data, err := GenerateAlertRules(cfg)
+	require.NoError(t, err)
+	var file ruleFile
+	require.NoError(t, yaml.Unmarshal(data, &file))
+	return file
+}
+
+// findRules 返回规则组中 record 或 alert 名称等于 name 的所有规则
+func findRules(group ruleGroup, name string) []rule {
+	var found []rule
+	for _, r := range group.Rules {
+		if r.Record == name || r.Alert == name {
+			found = append(found, r)
+		}
+	}
+	return found
+}
+
+func TestSLOValidate(t *testing.T) {
+	valid := SLO{Name: "send", Source: SLOSourceOperation, Operation: "send_message", Objective: 0.999}
+	assert.NoError(t, valid.Validate())
+	assert.NoError(t, (&SLO{Name: "rpc", Source: SLOSourceGRPCServer, Objective: 0.99, LatencyThreshold: 250 * time.Millisecond}).Validate())
+
+	for name, slo := range map[string]SLO{
+		"EmptyName":         {Source: SLOSourceHTTPServer, Objective: 0.99},
+		"UnknownSource":     {Name: "x", Source: "kafka", Objective: 0.99},
+		"MissingOperation":  {Name: "x", Source: SLOSourceOperation, Objective: 0.99},
+		"ObjectiveTooLow":   {Name: "x", Source: SLOSourceHTTPServer},
+		"ObjectiveTooHigh":  {Name: "x", Source: SLOSourceHTTPServer, Objective: 1},
+		"NegativeThreshold": {Name: "x", Source: SLOSourceHTTPServer, Objective: 0.99, LatencyThreshold: -time.Second},
+	} {
+		assert.Error(t, slo.Validate(), name)
+		assert.Error(t, RegisterSLO(slo), name)
+	}
+}
+
+func TestAlertRulesConfigValidate(t *testing.T) {
+	assert.NoError(t, DefaultAlertRulesConfig("im-logic").Validate())
+
+	for name, mutate := range map[string]func(*AlertRulesConfig){
+		"EmptyServiceName": func(c *AlertRulesConfig) { c.ServiceName = "" },
+		"ZeroErrorRatio":   func(c *AlertRulesConfig) { c.ErrorRatioThreshold = 0 },
+		"FullErrorRatio":   func(c *AlertRulesConfig) { c.ErrorRatioThreshold = 1 },
+		"NegativeFor":      func(c *AlertRulesConfig) { c.ErrorRatioFor = -time.Minute },
+		"NegativeLagFor":   func(c *AlertRulesConfig) { c.ConsumerLagFor = -time.Minute },
+		"ZeroLagThreshold": func(c *AlertRulesConfig) { c.ConsumerLagThreshold = 0 },
+	} {
+		cfg := DefaultAlertRulesConfig("im-logic")
+		mutate(cfg)
+		assert.Error(t, cfg.Validate(), name)
+		_, err := GenerateAlertRules(cfg)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestGenerateAlertRules(t *testing.T) {
+	// 创建 Operation 会声明共享的 RED 仪表
+	NewOperation(uniqueLabel("alerting_test"))
+
+	cfg := DefaultAlertRulesConfig("im-logic")
+	cfg.Selector = ""
+	file := generateRules(t, cfg)
+	require.Len(t, file.Groups, 2)
+	recording, alerts := file.Groups[0], file.Groups[1]
+	assert.Equal(t, "im-logic.recording", recording.Name)
+	assert.Equal(t, "im-logic.alerts", alerts.Name)
+
+	// 未设置 Selector 时默认按 job 过滤
+	records := findRules(recording, "operation:error_ratio:rate5m")
+	require.Len(t, records, 1)
+	assert.Equal(t, "sum by (operation) (rate(operation_requests_count_total{job=\"im-logic\",status=\"error\"}[5m]))\n"+
+		"/\nsum by (operation) (rate(operation_requests_count_total{job=\"im-logic\"}[5m]))", records[0].Expr)
+	assert.Equal(t, map[string]string{"service": "im-logic"}, records[0].Labels)
+
+	latency := findRules(recording, "operation_duration_seconds:p99:rate5m")
+	require.Len(t, latency, 1)
+	assert.Equal(t, "histogram_quantile(0.99, sum by (operation, le) (rate(operation_duration_seconds_bucket{job=\"im-logic\"}[5m])))", latency[0].Expr)
+
+	alert := findRules(alerts, "OperationHighErrorRatio")
+	require.Len(t, alert, 1)
+	assert.Equal(t, `operation:error_ratio:rate5m{service="im-logic"} > 0.05`, alert[0].Expr)
+	assert.Equal(t, "5m", alert[0].For)
+	assert.Equal(t, "warning", alert[0].Labels["severity"])
+	assert.Contains(t, alert[0].Annotations["summary"], "{{ $labels.operation }}")
+
+	// 未声明的仪表不生成规则
+	assert.Empty(t, findRules(alerts, "GRPCServerHighErrorRatio"))
+	assert.Empty(t, findRules(recording, "slo:sli_error:ratio_rate5m"))
+}
+
+func TestGenerateAlertRulesSLO(t *testing.T) {
+	NewOperation(uniqueLabel("alerting_slo_test"))
+	registerTestSLO(t, SLO{Name: "send_availability", Source: SLOSourceOperation, Operation: "send_message", Objective: 0.999})
+	registerTestSLO(t, SLO{
+		Name:             "send_latency",
+		Source:           SLOSourceOperation,
+		Operation:        "send_message",
+		Filter:           `module="chat"`,
+		Objective:        0.99,
+		LatencyThreshold: 250 * time.Millisecond,
+	})
+
+	file := generateRules(t, DefaultAlertRulesConfig("im-logic"))
+	require.Len(t, file.Groups, 2)
+	recording, alerts := file.Groups[0], file.Groups[1]
+
+	// 每个 SLO 为每个窗口生成一条错误率 recording rule
+	var availability, latency []rule
+	for _, r := range recording.Rules {
+		switch r.Labels["slo"] {
+		case "send_availability":
+			availability = append(availability, r)
+		case "send_latency":
+			latency = append(latency, r)
+		}
+	}
+	require.Len(t, availability, len(sloWindows))
+	require.Len(t, latency, len(sloWindows))
+	assert.Equal(t, "slo:sli_error:ratio_rate5m", availability[0].Record)
+	assert.Equal(t, "slo:sli_error:ratio_rate3d", availability[len(availability)-1].Record)
+	assert.Equal(t, "sum(rate(operation_requests_count_total{job=\"im-logic\",operation=\"send_message\",status=\"error\"}[5m]))\n"+
+		"/\nsum(rate(operation_requests_count_total{job=\"im-logic\",operation=\"send_message\"}[5m]))", availability[0].Expr)
+	assert.Equal(t, "1 - (\n  sum(rate(operation_duration_seconds_bucket{job=\"im-logic\",operation=\"send_message\",module=\"chat\",le=\"0.25\"}[5m]))\n"+
+		"  /\n  sum(rate(operation_duration_seconds_count{job=\"im-logic\",operation=\"send_message\",module=\"chat\"}[5m]))\n)", latency[0].Expr)
+
+	// page 和 ticket 两级告警，阈值为 burn rate 因子乘以错误预算
+	burn := findRules(alerts, "SLOErrorBudgetBurn")
+	severities := make(map[string]rule)
+	for _, r := range burn {
+		if r.Labels["slo"] == "send_availability" {
+			severities[r.Labels["severity"]] = r
+		}
+	}
+	require.Len(t, severities, 2)
+	page := severities["page"]
+	assert.Equal(t, "2m", page.For)
+	assert.Contains(t, page.Expr, `slo:sli_error:ratio_rate1h{service="im-logic",slo="send_availability"} > 0.0144`)
+	assert.Contains(t, page.Expr, `slo:sli_error:ratio_rate5m{service="im-logic",slo="send_availability"} > 0.0144`)
+	assert.Contains(t, page.Expr, "\nor\n")
+	assert.Contains(t, page.Annotations["summary"], "99.9%")
+	ticket := severities["ticket"]
+	assert.Equal(t, "15m", ticket.For)
+	assert.Contains(t, ticket.Expr, `slo:sli_error:ratio_rate3d{service="im-logic",slo="send_availability"} > 0.001`)
+}
+
+func TestGenerateAlertRulesSLONotFound(t *testing.T) {
+	// 本包测试不使用拦截器，gRPC 服务端请求指标不会被声明
+	registerTestSLO(t, SLO{Name: uniqueLabel("grpc_availability"), Source: SLOSourceGRPCServer, Objective: 0.999})
+
+	_, err := GenerateAlertRules(DefaultAlertRulesConfig("im-logic"))
+	assert.True(t, errors.Is(err, ErrSLONotFound))
+	assert.ErrorContains(t, err, "rpc.server.requests.count")
+
+	err = WriteAlertRules(filepath.Join(t.TempDir(), "rules.yml"), DefaultAlertRulesConfig("im-logic"))
+	assert.True(t, errors.Is(err, ErrSLONotFound))
+}
+
+func TestWriteAlertRules(t *testing.T) {
+	NewOperation(uniqueLabel("alerting_write_test"))
+	path := filepath.Join(t.TempDir(), "im-logic.rules.yml")
+	require.NoError(t, WriteAlertRules(path, DefaultAlertRulesConfig("im-logic")))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "name: im-logic.recording")
+}
+
+func TestSLOsSorted(t *testing.T) {
+	registerTestSLO(t, SLO{Name: "zz_sorted", Source: SLOSourceHTTPServer, Objective: 0.99})
+	registerTestSLO(t, SLO{Name: "aa_sorted", Source: SLOSourceHTTPServer, Objective: 0.99})
+	// 同名 SLO 后注册的覆盖先注册的
+	registerTestSLO(t, SLO{Name: "aa_sorted", Source: SLOSourceHTTPServer, Objective: 0.95})
+
+	var names []string
+	for _, slo := range SLOs() {
+		names = append(names, slo.Name)
+		if slo.Name == "aa_sorted" {
+			assert.Equal(t, 0.95, slo.Objective)
+		}
+	}
+	assert.IsIncreasing(t, names)
+}
+
+func TestFormatDuration(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		0:                      "",
+		500 * time.Millisecond: "500ms",
+		30 * time.Second:       "30s",
+		5 * time.Minute:        "5m",
+		90 * time.Minute:       "90m",
+		time.Hour:              "1h",
+		72 * time.Hour:         "3d",
+	} {
+		assert.Equal(t, want, formatDuration(d), d.String())
+	}
+	assert.Equal(t, "0.25", formatFloat(0.25))
+	assert.Equal(t, "99.9", formatFloat(99.9))
+}
@@ -0,0 +1,146 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/ceyewan/gochat/im-infra/cache"
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/ceyewan/gochat/im-infra/metrics/internal"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+var cacheLogger = clog.Namespace("metrics.cache")
+
+// InstrumentCache 将 cache Provider 的 Stats() 输出注册为 OpenTelemetry 异步指标。
+//
+// 指标在每次采集时读取连接池统计和健康状态，无需后台轮询协程。
+// name 用于区分同一进程中的多个 cache 实例，写入 cache 标签。
+//
+// 导出的指标：
+//   - redis_pool_connections{cache,state}：连接池中的连接数，state 为 total/idle
+//   - redis_pool_requests_total{cache,result}：从连接池取连接的次数，result 为 hit/miss/timeout
+//   - redis_pool_stale_connections_total{cache}：被移除的失效连接数
+//   - redis_dials_total{cache,result}：拨号次数，result 为 success/failed
+//   - redis_command_timeouts_total{cache}：命令网络超时次数
+//   - redis_reconnects_total{cache}：连接中断后恢复的次数
+//   - redis_failovers_total{cache}：检测到主从切换或实例重启的次数
+//   - redis_healthy{cache}：看门狗判定的连接状态，1 为正常
+//   - redis_ping_latency_seconds{cache}：看门狗最近一次 Ping 的耗时
+//
+// 返回的 stop 函数用于注销指标回调，应在关闭 cache Provider 之前调用。
+//
+// 示例：
+//
+//	stop, err := metrics.InstrumentCache("session", cacheClient)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	defer stop()
+func InstrumentCache(name string, provider cache.Provider) (stop func(), err error) {
+	if provider == nil {
+		return nil, errors.New("cache provider cannot be nil")
+	}
+
+	meter := otel.Meter(internal.InstrumentationName)
+	connections, err := meter.Int64ObservableGauge("redis_pool_connections",
+		metric.WithDescription("Number of connections in the Redis connection pool"))
+	if err != nil {
+		return nil, err
+	}
+	requests, err := meter.Int64ObservableCounter("redis_pool_requests_total",
+		metric.WithDescription("Total number of connection pool requests by result"))
+	if err != nil {
+		return nil, err
+	}
+	stale, err := meter.Int64ObservableCounter("redis_pool_stale_connections_total",
+		metric.WithDescription("Total number of stale connections removed from the pool"))
+	if err != nil {
+		return nil, err
+	}
+	dials, err := meter.Int64ObservableCounter("redis_dials_total",
+		metric.WithDescription("Total number of Redis dials by result"))
+	if err != nil {
+		return nil, err
+	}
+	timeouts, err := meter.Int64ObservableCounter("redis_command_timeouts_total",
+		metric.WithDescription("Total number of Redis commands failed with network timeouts"))
+	if err != nil {
+		return nil, err
+	}
+	reconnects, err := meter.Int64ObservableCounter("redis_reconnects_total",
+		metric.WithDescription("Total number of recoveries after the Redis connection was lost"))
+	if err != nil {
+		return nil, err
+	}
+	failovers, err := meter.Int64ObservableCounter("redis_failovers_total",
+		metric.WithDescription("Total number of detected Redis failovers or restarts"))
+	if err != nil {
+		return nil, err
+	}
+	healthy, err := meter.Int64ObservableGauge("redis_healthy",
+		metric.WithDescription("Whether the Redis watchdog considers the connection healthy"))
+	if err != nil {
+		return nil, err
+	}
+	pingLatency, err := meter.Float64ObservableGauge("redis_ping_latency_seconds",
+		metric.WithDescription("Latency of the last successful Redis watchdog ping"),
+		metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+
+	cacheAttr := attribute.String("cache", name)
+	registration, err := meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		s := provider.Stats()
+		with := func(kv ...attribute.KeyValue) metric.ObserveOption {
+			return metric.WithAttributes(append([]attribute.KeyValue{cacheAttr}, kv...)...)
+		}
+
+		o.ObserveInt64(connections, int64(s.TotalConns), with(attribute.String("state", "total")))
+		o.ObserveInt64(connections, int64(s.IdleConns), with(attribute.String("state", "idle")))
+		o.ObserveInt64(requests, int64(s.Hits), with(attribute.String("result", "hit")))
+		o.ObserveInt64(requests, int64(s.Misses), with(attribute.String("result", "miss")))
+		o.ObserveInt64(requests, int64(s.Timeouts), with(attribute.String("result", "timeout")))
+		o.ObserveInt64(stale, int64(s.StaleConns), with())
+		o.ObserveInt64(dials, int64(s.Dials-s.DialErrors), with(attribute.String("result", "success")))
+		o.ObserveInt64(dials, int64(s.DialErrors), with(attribute.String("result", "failed")))
+		o.ObserveInt64(timeouts, int64(s.CommandTimeouts), with())
+		o.ObserveInt64(reconnects, int64(s.Reconnects), with())
+		o.ObserveInt64(failovers, int64(s.Failovers), with())
+		healthyValue := int64(0)
+		if s.Healthy {
+			healthyValue = 1
+		}
+		o.ObserveInt64(healthy, healthyValue, with())
+		o.ObserveFloat64(pingLatency, s.LastPingLatency.Seconds(), with())
+		return nil
+	}, connections, requests, stale, dials, timeouts, reconnects, failovers, healthy, pingLatency)
+	if err != nil {
+		cacheLogger.Error("failed to register cache instruments", clog.Err(err))
+		return nil, err
+	}
+
+	registerInstrument("redis_pool_connections", internal.InstrumentGauge, "", "Number of connections in the Redis connection pool")
+	registerInstrument("redis_pool_requests_total", internal.InstrumentCounter, "", "Total number of connection pool requests by result")
+	registerInstrument("redis_pool_stale_connections_total", internal.InstrumentCounter, "", "Total number of stale connections removed from the pool")
+	registerInstrument("redis_dials_total", internal.InstrumentCounter, "", "Total number of Redis dials by result")
+	registerInstrument("redis_command_timeouts_total", internal.InstrumentCounter, "", "Total number of Redis commands failed with network timeouts")
+	registerInstrument("redis_reconnects_total", internal.InstrumentCounter, "", "Total number of recoveries after the Redis connection was lost")
+	registerInstrument("redis_failovers_total", internal.InstrumentCounter, "", "Total number of detected Redis failovers or restarts")
+	registerInstrument("redis_healthy", internal.InstrumentGauge, "", "Whether the Redis watchdog considers the connection healthy")
+	registerInstrument("redis_ping_latency_seconds", internal.InstrumentGauge, "s", "Latency of the last successful Redis watchdog ping")
+	cacheLogger.Info("cache 指标已注册", clog.String("cache", name))
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			if err := registration.Unregister(); err != nil {
+				cacheLogger.Warn("注销 cache 指标失败", clog.String("cache", name), clog.Err(err))
+			}
+		})
+	}, nil
+}
@@ -1,6 +1,10 @@
 package metrics
 
-import "time"
+import (
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/metrics/internal"
+)
 
 // Config 定义了 metrics 和 tracing 系统的公共配置结构。
 //
@@ -58,6 +62,34 @@ type Config struct {
 	// 默认值：""（禁用）
 	PrometheusListenAddr string
 
+	// PrometheusHandlerOnly 为 true 时只创建 Prometheus exporter，不启动独立的 HTTP 服务器。
+	//
+	// 适用于服务已有带鉴权的 HTTP 服务器（如管理端口）的场景，
+	// 通过 Provider.MetricsHandler() 将 /metrics 挂载到该服务器的 mux 上，不再额外暴露一个明文端口：
+	//
+	//	cfg.PrometheusHandlerOnly = true
+	//	provider, _ := metrics.New(cfg)
+	//	adminMux.Handle("/metrics", provider.MetricsHandler())
+	//
+	// 默认值：false
+	PrometheusHandlerOnly bool
+
+	// PrometheusAuth 定义抓取 /metrics 所需的凭据，支持 Bearer Token 和 Basic Auth。
+	//
+	// 同时作用于独立服务器和 MetricsHandler() 返回的 handler，凭据错误时返回 401。
+	// Prometheus 侧在 scrape_config 中配置对应的 authorization 或 basic_auth。
+	//
+	// 默认值：nil（不鉴权）
+	PrometheusAuth *ScrapeAuthConfig
+
+	// PrometheusTLS 定义独立服务器的 TLS 证书，配置后 /metrics 通过 HTTPS 提供。
+	//
+	// 设置 ClientCAFile 时开启双向 TLS，只接受该 CA 签发的客户端证书。
+	// 仅在配置了 PrometheusListenAddr 且未开启 PrometheusHandlerOnly 时可用。
+	//
+	// 默认值：nil（明文 HTTP）
+	PrometheusTLS *ScrapeTLSConfig
+
 	// SamplerType 指定 trace 采样策略类型。
 	//
 	// 采样策略决定了哪些请求会被记录为 trace：
@@ -102,8 +134,44 @@ type Config struct {
 	//
 	// 默认值：500ms
 	SlowRequestThreshold time.Duration
+
+	// ContextAttributes 定义从请求上下文元数据（ctxmeta）中自动附加的 span 属性和指标标签。
+	//
+	// 拦截器会从 WithMeta 写入的上下文、入站 gRPC metadata 和 HTTP 头（如 "x-client-platform"）
+	// 中读取白名单字段，无需修改每个 handler 即可按客户端平台拆分延迟仪表盘。
+	//
+	// 示例：
+	//
+	//	cfg.ContextAttributes = &metrics.ContextAttributesConfig{
+	//	    SpanKeys:  []string{"tenant_id", "client_platform", "api_version"},
+	//	    LabelKeys: []string{"client_platform", "api_version"},
+	//	}
+	//
+	// 默认值：nil（禁用）
+	ContextAttributes *ContextAttributesConfig
+
+	// Annotations 定义 RecordEvent 记录的事件如何同步到 Grafana 注解。
+	//
+	// 配置后部署、配置变更等事件会在仪表盘上显示为竖线，便于将延迟或错误率的变化与发布关联。
+	// 未配置时事件仍会导出为 span 事件和 service_events_total 等指标。
+	//
+	// 默认值：nil（禁用）
+	Annotations *AnnotationConfig
 }
 
+// ContextAttributesConfig 定义上下文元数据的 span 属性和指标标签白名单。
+//
+// LabelKeys 中的字段会成为指标标签，必须是低基数字段；
+// 每个字段的不同取值超过 MaxLabelValues（默认 20）后统一记为 "other"。
+type ContextAttributesConfig = internal.ContextAttributesConfig
+
+// ScrapeAuthConfig 定义 Prometheus 抓取端点的 Bearer Token 和 Basic Auth 凭据，
+// 同时配置时请求满足任意一种即可。
+type ScrapeAuthConfig = internal.ScrapeAuthConfig
+
+// ScrapeTLSConfig 定义 Prometheus 抓取端点的服务端证书和可选的客户端 CA。
+type ScrapeTLSConfig = internal.ScrapeTLSConfig
+
 // DefaultConfig 返回一个包含合理默认值的新 Config 实例。
 //
 // 默认配置适用于开发环境和快速原型验证，具有以下特点：
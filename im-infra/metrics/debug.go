@@ -0,0 +1,165 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/ceyewan/gochat/im-infra/coord/config"
+	"github.com/ceyewan/gochat/im-infra/metrics/internal"
+)
+
+var debugLogger = clog.Namespace("metrics.debug")
+
+// DebugConfig 定义了诊断服务器的配置。
+type DebugConfig = internal.DebugConfig
+
+// CaptureRequest 描述一次 profile 采集请求。
+type CaptureRequest = internal.CaptureRequest
+
+// DebugServer 是挂载 pprof、wall-clock 分析和 runtime trace 的诊断 HTTP 服务器。
+type DebugServer = internal.DebugServer
+
+// ErrCaptureInProgress 表示已有 CPU profile、trace 或 wall-clock 采集正在进行。
+var ErrCaptureInProgress = internal.ErrCaptureInProgress
+
+// DefaultDebugConfig 返回默认的诊断服务器配置。
+//
+// 默认只监听回环地址，此时可以不设置 AuthToken；
+// 需要从集群内访问时，应改为非回环地址并设置 AuthToken。
+func DefaultDebugConfig() DebugConfig {
+	return DebugConfig{
+		ListenAddr:         "127.0.0.1:6060",
+		OutputDir:          "/tmp/gochat-profiles",
+		MaxCaptureDuration: 5 * time.Minute,
+	}
+}
+
+// StartDebugServer 创建并启动诊断服务器。
+//
+// 提供的接口（设置了 AuthToken 时均需携带 "Authorization: Bearer <token>"）：
+//   - /debug/pprof/*：标准 net/http/pprof 接口
+//   - /debug/fgprof?seconds=N：wall-clock 分析，同时统计 on-CPU 和阻塞中的 goroutine，输出 folded 格式
+//   - /debug/capture?profile=cpu&seconds=N：在服务端采集 profile 并保存到 OutputDir
+//
+// CPU profile、trace 和 wall-clock 采集互斥，并发请求会返回 409；
+// seconds 超过 MaxCaptureDuration 时按上限采集，包括 /debug/pprof/profile 和 /debug/pprof/trace。
+//
+// 示例：
+//
+//	server, err := metrics.StartDebugServer(metrics.DefaultDebugConfig())
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	defer server.Shutdown(context.Background())
+func StartDebugServer(cfg DebugConfig) (*DebugServer, error) {
+	server, err := internal.NewDebugServer(cfg, debugLogger)
+	if err != nil {
+		debugLogger.Error("failed to create debug server", clog.Err(err))
+		return nil, err
+	}
+	if err := server.Start(); err != nil {
+		debugLogger.Error("failed to start debug server", clog.Err(err))
+		return nil, err
+	}
+	return server, nil
+}
+
+// WatchCaptureFlag 监听配置中心中的采集开关，无需重新部署即可在线上实例采集 profile。
+//
+// key 对应的值为 CaptureRequest 的 JSON，例如：
+//
+//	{"id": "incident-0412", "profile": "cpu", "seconds": 30}
+//
+// 每当 id 变化时，所有监听该 key 的实例都会执行一次采集，结果保存在各自的 OutputDir 中。
+// 启动时已存在的值不会触发采集，避免实例重启后重复采集。
+// 返回的 stop 函数用于停止监听。
+//
+// 示例：
+//
+//	stop, err := metrics.WatchCaptureFlag(server, configCenter, "/config/prod/im-logic/debug/capture")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	defer stop()
+func WatchCaptureFlag(server *DebugServer, cc config.ConfigCenter, key string) (stop func(), err error) {
+	if server == nil {
+		return nil, errors.New("debug server cannot be nil")
+	}
+	if cc == nil {
+		return nil, errors.New("config center cannot be nil")
+	}
+	if key == "" {
+		return nil, errors.New("capture flag key cannot be empty")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// 记录当前已有的请求 ID，只响应之后的变更
+	var current CaptureRequest
+	if err := cc.Get(ctx, key, &current); err != nil {
+		debugLogger.Debug("采集开关尚未设置", clog.String("key", key), clog.Err(err))
+	}
+
+	watcher, err := cc.Watch(ctx, key, &CaptureRequest{})
+	if err != nil {
+		cancel()
+		debugLogger.Error("failed to watch capture flag", clog.String("key", key), clog.Err(err))
+		return nil, err
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		lastID := current.ID
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Chan():
+				if !ok {
+					return
+				}
+				if event.Type != config.EventTypePut {
+					continue
+				}
+				req, ok := event.Value.(CaptureRequest)
+				if !ok {
+					debugLogger.Warn("采集开关的值无法解析", clog.String("key", key))
+					continue
+				}
+				if req.ID == "" || req.ID == lastID {
+					continue
+				}
+				lastID = req.ID
+
+				path, err := server.Capture(ctx, req)
+				if err != nil {
+					debugLogger.Error("配置中心触发的采集失败",
+						clog.String("id", req.ID),
+						clog.String("profile", req.Profile),
+						clog.Err(err))
+					continue
+				}
+				debugLogger.Info("配置中心触发的采集已完成",
+					clog.String("id", req.ID),
+					clog.String("path", path))
+			}
+		}
+	}()
+
+	debugLogger.Info("采集开关监听已启动", clog.String("key", key))
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			cancel()
+			watcher.Close()
+			wg.Wait()
+			debugLogger.Info("采集开关监听已停止")
+		})
+	}, nil
+}
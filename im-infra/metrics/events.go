@@ -0,0 +1,178 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/ceyewan/gochat/im-infra/metrics/internal"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 常用的事件名称，RecordEvent 也接受其他名称，但名称会作为指标标签，必须是低基数的
+const (
+	EventDeployment   = "deployment"
+	EventConfigChange = "config_change"
+	EventIncident     = "incident"
+)
+
+// 事件的指标名称
+const (
+	eventTotalMetric     = "service_events_total"
+	eventTimestampMetric = "service_event_timestamp_seconds"
+)
+
+// 注解 webhook 的默认超时
+const defaultAnnotationTimeout = 5 * time.Second
+
+var eventLogger = clog.Namespace("metrics.event")
+
+// AnnotationConfig 定义了事件同步到 Grafana 注解的方式。
+//
+// 配置后 RecordEvent 会调用 Grafana 的 POST /api/annotations 接口，
+// 仪表盘上对应时间点会出现一条竖线，便于将指标变化与部署、配置变更关联起来。
+type AnnotationConfig struct {
+	// URL Grafana 地址，如 "http://grafana:3000"
+	URL string
+	// APIKey Grafana 服务账号令牌，以 Bearer 方式发送
+	APIKey string
+	// DashboardUID 注解所属的仪表盘，为空时创建组织级注解，所有按标签过滤的仪表盘都能显示
+	DashboardUID string
+	// Tags 附加到每条注解的标签，服务名和事件名总会作为标签写入
+	Tags []string
+	// Timeout 单次请求的超时时间，默认 5s
+	Timeout time.Duration
+}
+
+// eventRecorder 将事件记录为 span 事件、指标，并可选地同步到 Grafana 注解
+type eventRecorder struct {
+	serviceName string
+	annotations *AnnotationConfig
+	client      *http.Client
+
+	total     metric.Int64Counter
+	timestamp metric.Float64Gauge
+}
+
+// newEventRecorder 创建事件记录器，annotations 为 nil 时不调用 webhook
+func newEventRecorder(serviceName string, annotations *AnnotationConfig) (*eventRecorder, error) {
+	if annotations != nil && annotations.URL == "" {
+		return nil, fmt.Errorf("annotation url cannot be empty")
+	}
+
+	meter := otel.Meter(internal.InstrumentationName)
+	r := &eventRecorder{serviceName: serviceName, annotations: annotations}
+	var err error
+	if r.total, err = meter.Int64Counter(eventTotalMetric,
+		metric.WithDescription("Total number of recorded service events such as deployments and incidents")); err != nil {
+		return nil, err
+	}
+	if r.timestamp, err = meter.Float64Gauge(eventTimestampMetric,
+		metric.WithDescription("Unix timestamp of the last recorded service event"),
+		metric.WithUnit("s")); err != nil {
+		return nil, err
+	}
+	registerInstrument(eventTotalMetric, internal.InstrumentCounter, "", "Total number of recorded service events such as deployments and incidents")
+	registerInstrument(eventTimestampMetric, internal.InstrumentGauge, "s", "Unix timestamp of the last recorded service event")
+
+	if annotations != nil {
+		timeout := annotations.Timeout
+		if timeout <= 0 {
+			timeout = defaultAnnotationTimeout
+		}
+		r.client = &http.Client{Timeout: timeout}
+	}
+	return r, nil
+}
+
+// record 记录一个事件，只有 Grafana 注解失败时返回错误
+func (r *eventRecorder) record(ctx context.Context, name string, attrs ...attribute.KeyValue) error {
+	if name == "" {
+		return fmt.Errorf("event name cannot be empty")
+	}
+	now := time.Now()
+
+	// span 事件：ctx 中有活跃 span 时作为其子 span，便于在调用链中看到变更发生的位置
+	_, span := otel.Tracer(internal.InstrumentationName).Start(ctx, "event "+name,
+		trace.WithTimestamp(now), trace.WithAttributes(attrs...))
+	span.AddEvent(name, trace.WithTimestamp(now), trace.WithAttributes(attrs...))
+	span.End()
+
+	// 指标只带事件名标签，属性可能是版本号等高基数值，不写入标签
+	labels := metric.WithAttributes(attribute.String("event", name))
+	r.total.Add(ctx, 1, labels)
+	r.timestamp.Record(ctx, float64(now.UnixMilli())/1000, labels)
+
+	eventLogger.Info("记录服务事件",
+		clog.String("event", name),
+		clog.String("service_name", r.serviceName),
+		clog.String("attributes", formatEventAttrs(attrs)))
+
+	if r.annotations == nil {
+		return nil
+	}
+	if err := r.annotate(ctx, now, name, attrs); err != nil {
+		eventLogger.Warn("同步 Grafana 注解失败", clog.String("event", name), clog.Err(err))
+		return err
+	}
+	return nil
+}
+
+// annotate 调用 Grafana 的注解接口
+func (r *eventRecorder) annotate(ctx context.Context, at time.Time, name string, attrs []attribute.KeyValue) error {
+	tags := append([]string{r.serviceName, name}, r.annotations.Tags...)
+	text := name
+	if len(attrs) > 0 {
+		text += ": " + formatEventAttrs(attrs)
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"time":         at.UnixMilli(),
+		"tags":         tags,
+		"text":         text,
+		"dashboardUID": r.annotations.DashboardUID,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		strings.TrimRight(r.annotations.URL, "/")+"/api/annotations", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.annotations.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+r.annotations.APIKey)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("grafana returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// formatEventAttrs 将属性格式化为按键排序的 "k=v, k=v"
+func formatEventAttrs(attrs []attribute.KeyValue) string {
+	parts := make([]string, 0, len(attrs))
+	for _, kv := range attrs {
+		parts = append(parts, string(kv.Key)+"="+kv.Value.Emit())
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,122 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestEventRecorder(t *testing.T) {
+	_, err := newEventRecorder("im-logic", &AnnotationConfig{})
+	assert.Error(t, err, "annotation url is required")
+
+	r, err := newEventRecorder("im-logic", nil)
+	require.NoError(t, err)
+	assert.Error(t, r.record(context.Background(), ""))
+
+	name := uniqueLabel(EventDeployment)
+	version := attribute.String("version", "v1.2.3")
+	before := time.Now()
+	require.NoError(t, r.record(context.Background(), name, version))
+	require.NoError(t, r.record(context.Background(), name, attribute.String("version", "v1.2.4")))
+
+	// 指标只按事件名区分，属性不作为标签
+	event := attribute.String("event", name)
+	assert.Equal(t, int64(2), counterValue(t, eventTotalMetric, event))
+	assert.Zero(t, counterValue(t, eventTotalMetric, event, version))
+	ts, ok := gaugeValue[float64](t, eventTimestampMetric, event)
+	require.True(t, ok)
+	assert.InDelta(t, float64(before.UnixMilli())/1000, ts, 5)
+
+	var spans []sdktrace.ReadOnlySpan
+	for _, span := range testSpans.Ended() {
+		if span.Name() == "event "+name {
+			spans = append(spans, span)
+		}
+	}
+	require.Len(t, spans, 2)
+	assert.Contains(t, spans[0].Attributes(), version)
+	require.Len(t, spans[0].Events(), 1)
+	assert.Equal(t, name, spans[0].Events()[0].Name)
+	assert.Contains(t, spans[0].Events()[0].Attributes, version)
+}
+
+func TestEventAnnotations(t *testing.T) {
+	var (
+		auth string
+		body struct {
+			Time         int64    `json:"time"`
+			Tags         []string `json:"tags"`
+			Text         string   `json:"text"`
+			DashboardUID string   `json:"dashboardUID"`
+		}
+		status = http.StatusOK
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/api/annotations", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		auth = r.Header.Get("Authorization")
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"message":"annotation response"}`))
+	}))
+	defer server.Close()
+
+	r, err := newEventRecorder("im-logic", &AnnotationConfig{
+		URL:          server.URL + "/",
+		APIKey:       "glsa_token",
+		DashboardUID: "im-overview",
+		Tags:         []string{"prod"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, defaultAnnotationTimeout, r.client.Timeout)
+
+	before := time.Now().UnixMilli()
+	require.NoError(t, r.record(context.Background(), EventConfigChange,
+		attribute.String("key", "logic.rate_limit"), attribute.Int("value", 100)))
+	assert.Equal(t, "Bearer glsa_token", auth)
+	assert.GreaterOrEqual(t, body.Time, before)
+	assert.Equal(t, []string{"im-logic", EventConfigChange, "prod"}, body.Tags)
+	assert.Equal(t, "config_change: key=logic.rate_limit, value=100", body.Text)
+	assert.Equal(t, "im-overview", body.DashboardUID)
+
+	// 没有属性时注解文本只有事件名
+	require.NoError(t, r.record(context.Background(), EventIncident))
+	assert.Equal(t, EventIncident, body.Text)
+
+	// Grafana 返回非 2xx 时返回错误，事件仍然记录到指标
+	status = http.StatusUnauthorized
+	incident := attribute.String("event", EventIncident)
+	countBefore := counterValue(t, eventTotalMetric, incident)
+	err = r.record(context.Background(), EventIncident)
+	assert.ErrorContains(t, err, "401")
+	assert.ErrorContains(t, err, "annotation response")
+	assert.Equal(t, int64(1), counterValue(t, eventTotalMetric, incident)-countBefore)
+
+	// 未配置 APIKey 时不发送 Authorization 头
+	status = http.StatusOK
+	r, err = newEventRecorder("im-logic", &AnnotationConfig{URL: server.URL, Timeout: time.Second})
+	require.NoError(t, err)
+	assert.Equal(t, time.Second, r.client.Timeout)
+	require.NoError(t, r.record(context.Background(), EventDeployment))
+	assert.Empty(t, auth)
+	assert.Equal(t, []string{"im-logic", EventDeployment}, body.Tags)
+}
+
+func TestFormatEventAttrs(t *testing.T) {
+	assert.Equal(t, "", formatEventAttrs(nil))
+	assert.Equal(t, "commit=abc123, replicas=3, version=v1.2.3", formatEventAttrs([]attribute.KeyValue{
+		attribute.String("version", "v1.2.3"),
+		attribute.Int("replicas", 3),
+		attribute.String("commit", "abc123"),
+	}))
+}
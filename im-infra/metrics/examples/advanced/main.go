@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net"
@@ -36,9 +37,30 @@ var (
 	connectionCounter *metrics.Counter
 )
 
+// errInvalidCredentials 登录凭证错误
+var errInvalidCredentials = errors.New("invalid credentials")
+
 // UserService 模拟用户服务
 type UserService struct {
 	users sync.Map // 模拟用户存储
+
+	// 业务操作的 RED 指标，由 provider.Operation 统一维护请求数、错误数和耗时
+	login         *metrics.Operation
+	getProfile    *metrics.Operation
+	updateProfile *metrics.Operation
+	sendMessage   *metrics.Operation
+	getHistory    *metrics.Operation
+}
+
+// newUserService 创建用户服务并注册业务操作指标
+func newUserService(provider metrics.Provider) *UserService {
+	return &UserService{
+		login:         provider.Operation("login"),
+		getProfile:    provider.Operation("get_profile"),
+		updateProfile: provider.Operation("update_profile"),
+		sendMessage:   provider.Operation("send_message"),
+		getHistory:    provider.Operation("get_history"),
+	}
 }
 
 // LoginRequest 登录请求
@@ -280,7 +302,7 @@ func startHTTPServer(ctx context.Context, provider metrics.Provider) error {
 	)
 
 	// 注册路由
-	setupRoutes(engine)
+	setupRoutes(engine, provider)
 
 	server := &http.Server{
 		Addr:           ":8080",
@@ -320,8 +342,8 @@ func startHTTPServer(ctx context.Context, provider metrics.Provider) error {
 }
 
 // setupRoutes 设置 HTTP 路由
-func setupRoutes(engine *gin.Engine) {
-	userService := &UserService{}
+func setupRoutes(engine *gin.Engine, provider metrics.Provider) {
+	userService := newUserService(provider)
 
 	// API v1 路由组
 	v1 := engine.Group("/api/v1")
@@ -361,13 +383,12 @@ func setupRoutes(engine *gin.Engine) {
 
 // 用户服务处理函数
 func (s *UserService) handleLogin(c *gin.Context) {
-	start := time.Now()
+	var err error
+	timer := s.login.Start(c.Request.Context())
+	defer func() { timer.Finish(err) }()
 
 	var req LoginRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		businessCounter.Inc(c.Request.Context(),
-			attribute.String("operation", "login"),
-			attribute.String("status", "invalid_request"))
+	if err = c.ShouldBindJSON(&req); err != nil {
 		c.JSON(400, gin.H{"error": "Invalid request"})
 		return
 	}
@@ -379,38 +400,23 @@ func (s *UserService) handleLogin(c *gin.Context) {
 	time.Sleep(50 * time.Millisecond)
 
 	// 简单的模拟验证
-	success := req.Username != "" && req.Password == "password123"
+	if req.Username == "" || req.Password != "password123" {
+		err = errInvalidCredentials
+		c.JSON(401, gin.H{"error": "Invalid credentials"})
+		return
+	}
 
-	response := LoginResponse{
-		Success: success,
+	c.JSON(200, LoginResponse{
+		Success: true,
 		Token:   fmt.Sprintf("token_%s_%d", req.Username, time.Now().Unix()),
 		UserID:  12345,
-	}
-
-	// 记录业务指标
-	status := "success"
-	if !success {
-		status = "failed"
-	}
-
-	businessCounter.Inc(c.Request.Context(),
-		attribute.String("operation", "login"),
-		attribute.String("status", status))
-
-	responseTimeHist.Record(c.Request.Context(),
-		time.Since(start).Seconds(),
-		attribute.String("operation", "login"),
-		attribute.String("status", status))
-
-	if success {
-		c.JSON(200, response)
-	} else {
-		c.JSON(401, gin.H{"error": "Invalid credentials"})
-	}
+	})
 }
 
 func (s *UserService) handleGetProfile(c *gin.Context) {
-	start := time.Now()
+	timer := s.getProfile.Start(c.Request.Context())
+	defer timer.Finish(nil)
+
 	userID := c.Param("id")
 
 	serviceLogger.Debug("获取用户资料", clog.String("user_id", userID))
@@ -425,26 +431,18 @@ func (s *UserService) handleGetProfile(c *gin.Context) {
 		"created_at": time.Now().Add(-30 * 24 * time.Hour).Unix(),
 	}
 
-	businessCounter.Inc(c.Request.Context(),
-		attribute.String("operation", "get_profile"),
-		attribute.String("status", "success"))
-
-	responseTimeHist.Record(c.Request.Context(),
-		time.Since(start).Seconds(),
-		attribute.String("operation", "get_profile"))
-
 	c.JSON(200, profile)
 }
 
 func (s *UserService) handleUpdateProfile(c *gin.Context) {
-	start := time.Now()
+	var err error
+	timer := s.updateProfile.Start(c.Request.Context())
+	defer func() { timer.Finish(err) }()
+
 	userID := c.Param("id")
 
 	var updateData map[string]interface{}
-	if err := c.ShouldBindJSON(&updateData); err != nil {
-		businessCounter.Inc(c.Request.Context(),
-			attribute.String("operation", "update_profile"),
-			attribute.String("status", "invalid_request"))
+	if err = c.ShouldBindJSON(&updateData); err != nil {
 		c.JSON(400, gin.H{"error": "Invalid request"})
 		return
 	}
@@ -456,25 +454,16 @@ func (s *UserService) handleUpdateProfile(c *gin.Context) {
 	// 模拟数据库更新
 	time.Sleep(80 * time.Millisecond)
 
-	businessCounter.Inc(c.Request.Context(),
-		attribute.String("operation", "update_profile"),
-		attribute.String("status", "success"))
-
-	responseTimeHist.Record(c.Request.Context(),
-		time.Since(start).Seconds(),
-		attribute.String("operation", "update_profile"))
-
 	c.JSON(200, gin.H{"message": "Profile updated successfully"})
 }
 
 func (s *UserService) handleSendMessage(c *gin.Context) {
-	start := time.Now()
+	var err error
+	timer := s.sendMessage.Start(c.Request.Context())
+	defer func() { timer.Finish(err) }()
 
 	var req MessageRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		businessCounter.Inc(c.Request.Context(),
-			attribute.String("operation", "send_message"),
-			attribute.String("status", "invalid_request"))
+	if err = c.ShouldBindJSON(&req); err != nil {
 		c.JSON(400, gin.H{"error": "Invalid request"})
 		return
 	}
@@ -497,19 +486,13 @@ func (s *UserService) handleSendMessage(c *gin.Context) {
 		Timestamp: time.Now().Unix(),
 	}
 
-	businessCounter.Inc(c.Request.Context(),
-		attribute.String("operation", "send_message"),
-		attribute.String("status", "success"))
-
-	responseTimeHist.Record(c.Request.Context(),
-		time.Since(start).Seconds(),
-		attribute.String("operation", "send_message"))
-
 	c.JSON(200, response)
 }
 
 func (s *UserService) handleGetHistory(c *gin.Context) {
-	start := time.Now()
+	timer := s.getHistory.Start(c.Request.Context())
+	defer timer.Finish(nil)
+
 	userID := c.Param("userID")
 
 	serviceLogger.Debug("获取消息历史", clog.String("user_id", userID))
@@ -535,14 +518,6 @@ func (s *UserService) handleGetHistory(c *gin.Context) {
 		},
 	}
 
-	businessCounter.Inc(c.Request.Context(),
-		attribute.String("operation", "get_history"),
-		attribute.String("status", "success"))
-
-	responseTimeHist.Record(c.Request.Context(),
-		time.Since(start).Seconds(),
-		attribute.String("operation", "get_history"))
-
 	c.JSON(200, gin.H{
 		"messages": messages,
 		"total":    len(messages),
@@ -0,0 +1,126 @@
+package internal
+
+import (
+	"context"
+	"runtime"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// unknownValue 是无法获取构建信息时使用的占位值
+const unknownValue = "unknown"
+
+// BuildInfo 描述了服务的构建信息，用于在 service_info 指标中关联部署版本。
+type BuildInfo struct {
+	// Version 服务版本号，如 "v1.4.2"
+	Version string
+	// GitCommit 构建时的 git commit
+	GitCommit string
+	// BuildTime 构建时间
+	BuildTime string
+}
+
+var (
+	// processStartTime 进程启动时间，用于计算 uptime
+	processStartTime = time.Now()
+
+	// explicitBuildInfo 通过 SetBuildInfo 显式设置的构建信息，优先级最高
+	explicitBuildInfo atomic.Pointer[BuildInfo]
+)
+
+// SetBuildInfo 显式设置构建信息，未设置的字段会回退到构建参数或 Go 模块信息。
+// 可以在 NewProvider 之前或之后调用，指标会在下一次采集时反映最新值。
+func SetBuildInfo(info BuildInfo) {
+	explicitBuildInfo.Store(&info)
+}
+
+// resolveBuildInfo 按 显式设置 > 构建参数(fallback) > Go 模块信息 的优先级合并构建信息
+func resolveBuildInfo(fallback BuildInfo) BuildInfo {
+	var info BuildInfo
+	if explicit := explicitBuildInfo.Load(); explicit != nil {
+		info = *explicit
+	}
+
+	if info.Version == "" {
+		info.Version = fallback.Version
+	}
+	if info.GitCommit == "" {
+		info.GitCommit = fallback.GitCommit
+	}
+	if info.BuildTime == "" {
+		info.BuildTime = fallback.BuildTime
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			info.Version = bi.Main.Version
+		}
+		for _, setting := range bi.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.GitCommit == "" {
+					info.GitCommit = setting.Value
+				}
+			case "vcs.time":
+				if info.BuildTime == "" {
+					info.BuildTime = setting.Value
+				}
+			}
+		}
+	}
+
+	if info.Version == "" {
+		info.Version = unknownValue
+	}
+	if info.GitCommit == "" {
+		info.GitCommit = unknownValue
+	}
+	if info.BuildTime == "" {
+		info.BuildTime = unknownValue
+	}
+	return info
+}
+
+// registerServiceMetrics 注册 service_info 和 uptime 指标。
+//
+//   - service_info: 恒为 1 的 gauge，通过标签携带版本、commit、Go 版本和启动时间
+//   - service_uptime_seconds: 进程启动至今的秒数
+func registerServiceMetrics(m metric.Meter, serviceName string, fallback BuildInfo) error {
+	serviceInfo, err := m.Int64ObservableGauge(
+		"service_info",
+		metric.WithDescription("Service build and runtime information, value is always 1"),
+	)
+	if err != nil {
+		return err
+	}
+
+	uptime, err := m.Float64ObservableGauge(
+		"service_uptime_seconds",
+		metric.WithDescription("Time since the service process started"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return err
+	}
+
+	startTime := processStartTime.UTC().Format(time.RFC3339)
+	_, err = m.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		info := resolveBuildInfo(fallback)
+		o.ObserveInt64(serviceInfo, 1, metric.WithAttributes(
+			attribute.String("service", serviceName),
+			attribute.String("version", info.Version),
+			attribute.String("git_commit", info.GitCommit),
+			attribute.String("build_time", info.BuildTime),
+			attribute.String("go_version", runtime.Version()),
+			attribute.String("start_time", startTime),
+		))
+		o.ObserveFloat64(uptime, time.Since(processStartTime).Seconds(),
+			metric.WithAttributes(attribute.String("service", serviceName)))
+		return nil
+	}, serviceInfo, uptime)
+	return err
+}
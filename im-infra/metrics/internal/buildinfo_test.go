@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"context"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// collectMetrics 采集一次 reader 中的指标，按指标名返回
+func collectMetrics(t *testing.T, reader sdkmetric.Reader) map[string]metricdata.Metrics {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	metrics := make(map[string]metricdata.Metrics)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			metrics[m.Name] = m
+		}
+	}
+	return metrics
+}
+
+func TestResolveBuildInfo(t *testing.T) {
+	t.Cleanup(func() { explicitBuildInfo.Store(nil) })
+
+	fallback := BuildInfo{Version: "v1.0.0", GitCommit: "abc123", BuildTime: "2024-01-01T00:00:00Z"}
+	assert.Equal(t, fallback, resolveBuildInfo(fallback))
+
+	// 显式设置的字段优先，未设置的字段回退到构建参数
+	SetBuildInfo(BuildInfo{Version: "v1.4.2"})
+	assert.Equal(t, BuildInfo{Version: "v1.4.2", GitCommit: "abc123", BuildTime: "2024-01-01T00:00:00Z"}, resolveBuildInfo(fallback))
+
+	// 所有来源都缺失时不会留空标签
+	explicitBuildInfo.Store(nil)
+	info := resolveBuildInfo(BuildInfo{})
+	assert.NotEmpty(t, info.Version)
+	assert.NotEmpty(t, info.GitCommit)
+	assert.NotEmpty(t, info.BuildTime)
+}
+
+func TestServiceMetrics(t *testing.T) {
+	t.Cleanup(func() { explicitBuildInfo.Store(nil) })
+
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	defer mp.Shutdown(context.Background())
+	require.NoError(t, registerServiceMetrics(mp.Meter("buildinfo-test"), "im-logic", BuildInfo{Version: "v1.0.0", GitCommit: "abc123", BuildTime: "now"}))
+
+	metrics := collectMetrics(t, reader)
+	info := metrics["service_info"].Data.(metricdata.Gauge[int64]).DataPoints
+	require.Len(t, info, 1)
+	assert.Equal(t, int64(1), info[0].Value)
+	version, _ := info[0].Attributes.Value("version")
+	assert.Equal(t, "v1.0.0", version.AsString())
+	goVersion, _ := info[0].Attributes.Value("go_version")
+	assert.Equal(t, runtime.Version(), goVersion.AsString())
+	assert.True(t, info[0].Attributes.HasValue("start_time"))
+
+	uptime := metrics["service_uptime_seconds"].Data.(metricdata.Gauge[float64]).DataPoints
+	require.Len(t, uptime, 1)
+	assert.Greater(t, uptime[0].Value, 0.0)
+	assert.Equal(t, attribute.NewSet(attribute.String("service", "im-logic")), uptime[0].Attributes)
+
+	// SetBuildInfo 在下一次采集时生效，无需重建 provider
+	SetBuildInfo(BuildInfo{Version: "v2.0.0"})
+	info = collectMetrics(t, reader)["service_info"].Data.(metricdata.Gauge[int64]).DataPoints
+	require.Len(t, info, 1)
+	version, _ = info[0].Attributes.Value("version")
+	assert.Equal(t, "v2.0.0", version.AsString())
+}
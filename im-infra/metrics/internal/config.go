@@ -46,6 +46,20 @@ type Config struct {
 	//   - "": 禁用 Prometheus 服务器
 	PrometheusListenAddr string `mapstructure:"prometheus_listen_addr"`
 
+	// PrometheusHandlerOnly 为 true 时创建 Prometheus exporter 但不启动独立的 HTTP 服务器，
+	// 由调用方通过 Provider.MetricsHandler 将 /metrics 挂载到已有的（已鉴权的）mux 上。
+	PrometheusHandlerOnly bool `mapstructure:"prometheus_handler_only"`
+
+	// PrometheusAuth 抓取 /metrics 所需的 Bearer Token 或 Basic Auth 凭据，为 nil 时不鉴权。
+	//
+	// 同时作用于独立服务器和 MetricsHandler 返回的 handler。
+	PrometheusAuth *ScrapeAuthConfig `mapstructure:"prometheus_auth"`
+
+	// PrometheusTLS 独立服务器的 TLS 配置，为 nil 时使用明文 HTTP。
+	//
+	// 仅在配置了 PrometheusListenAddr 时有效；挂载到已有 mux 时由该 mux 所在的服务器负责 TLS。
+	PrometheusTLS *ScrapeTLSConfig `mapstructure:"prometheus_tls"`
+
 	// SamplerType 指定 OpenTelemetry trace 采样器的类型。
 	//
 	// 采样器决定哪些 trace 会被记录和导出：
@@ -72,4 +86,14 @@ type Config struct {
 	//
 	// 该配置有助于识别性能问题和优化热点。
 	SlowRequestThreshold time.Duration `mapstructure:"slow_request_threshold"`
+
+	// BuildInfo 通过构建参数注入的构建信息，作为 service_info 指标的回退值。
+	//
+	// 优先级低于 SetBuildInfo 显式设置的值，高于 Go 模块中自动读取的 vcs 信息。
+	BuildInfo BuildInfo `mapstructure:"-"`
+
+	// ContextAttributes 从请求上下文元数据中提取 span 属性和指标标签的白名单配置。
+	//
+	// 为 nil 时不做任何提取。
+	ContextAttributes *ContextAttributesConfig `mapstructure:"context_attributes"`
 }
@@ -0,0 +1,193 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ceyewan/gochat/im-infra/ctxmeta"
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/grpc/metadata"
+)
+
+// otherLabelValue 标签取值超过基数上限后统一使用的值
+const otherLabelValue = "other"
+
+// ContextAttributesConfig 定义从请求上下文元数据（ctxmeta）中提取哪些字段作为 span 属性和指标标签。
+//
+// 元数据来源：
+//   - 业务代码通过 WithMeta 写入上下文
+//   - 服务端拦截器从 gRPC metadata / HTTP 头中读取，键名为 "x-" 加上把下划线换成连字符的字段名，
+//     如 client_platform 对应 "x-client-platform"
+//
+// 客户端拦截器会把上下文中的元数据写入出站 gRPC metadata，保证在服务间传递。
+type ContextAttributesConfig struct {
+	// SpanKeys 作为 span 属性附加的字段白名单，如 tenant_id、client_platform、api_version。
+	SpanKeys []string
+
+	// LabelKeys 作为指标标签附加的字段白名单，必须是低基数字段（如 client_platform），
+	// 不要加入 tenant_id、user_id 等高基数字段。
+	LabelKeys []string
+
+	// MaxLabelValues 每个标签字段允许的不同取值数量，超出后新取值统一记为 "other"，默认 20。
+	MaxLabelValues int
+}
+
+// contextAttributes 当前生效的上下文属性配置，未配置时为 nil
+var contextAttributes atomic.Pointer[contextAttributesState]
+
+// contextAttributesState 上下文属性配置及标签基数统计
+type contextAttributesState struct {
+	cfg ContextAttributesConfig
+
+	// keys 需要从传输层读取和向下游传递的字段（SpanKeys 与 LabelKeys 的并集）
+	keys []string
+
+	mu     sync.Mutex
+	values map[string]map[string]struct{}
+}
+
+// SetContextAttributes 设置上下文属性配置，cfg 为 nil 或白名单为空时关闭该功能。
+func SetContextAttributes(cfg *ContextAttributesConfig) {
+	if cfg == nil || (len(cfg.SpanKeys) == 0 && len(cfg.LabelKeys) == 0) {
+		contextAttributes.Store(nil)
+		return
+	}
+
+	state := &contextAttributesState{
+		cfg:    *cfg,
+		values: make(map[string]map[string]struct{}),
+	}
+	if state.cfg.MaxLabelValues <= 0 {
+		state.cfg.MaxLabelValues = 20
+	}
+	seen := make(map[string]struct{})
+	for _, key := range append(append([]string{}, cfg.SpanKeys...), cfg.LabelKeys...) {
+		if _, ok := seen[key]; !ok {
+			seen[key] = struct{}{}
+			state.keys = append(state.keys, key)
+		}
+	}
+	contextAttributes.Store(state)
+}
+
+// WithMeta 将一个元数据字段写入上下文，返回新的上下文。
+// 元数据保存在 ctxmeta 中，与 db、mq 读取的租户、操作人等字段是同一份
+func WithMeta(ctx context.Context, key, value string) context.Context {
+	return ctxmeta.With(ctx, key, value)
+}
+
+// MetaFromContext 返回上下文中的元数据字段值
+func MetaFromContext(ctx context.Context, key string) (string, bool) {
+	return ctxmeta.Get(ctx, key)
+}
+
+// metaHeader 返回元数据字段在 gRPC metadata / HTTP 头中的键名
+func metaHeader(key string) string {
+	return "x-" + strings.ReplaceAll(strings.ToLower(key), "_", "-")
+}
+
+// extractMetaFromGRPC 将入站 gRPC metadata 中白名单字段写入上下文，上下文中已有的值优先
+func extractMetaFromGRPC(ctx context.Context, md metadata.MD) context.Context {
+	state := contextAttributes.Load()
+	if state == nil {
+		return ctx
+	}
+	for _, key := range state.keys {
+		if _, ok := MetaFromContext(ctx, key); ok {
+			continue
+		}
+		if vals := md.Get(metaHeader(key)); len(vals) > 0 && vals[0] != "" {
+			ctx = WithMeta(ctx, key, vals[0])
+		}
+	}
+	return ctx
+}
+
+// extractMetaFromHTTP 将 HTTP 请求头中白名单字段写入上下文，上下文中已有的值优先
+func extractMetaFromHTTP(ctx context.Context, header http.Header) context.Context {
+	state := contextAttributes.Load()
+	if state == nil {
+		return ctx
+	}
+	for _, key := range state.keys {
+		if _, ok := MetaFromContext(ctx, key); ok {
+			continue
+		}
+		if value := header.Get(metaHeader(key)); value != "" {
+			ctx = WithMeta(ctx, key, value)
+		}
+	}
+	return ctx
+}
+
+// injectMetaToGRPC 将上下文中白名单字段写入出站 gRPC metadata，已存在的键不覆盖
+func injectMetaToGRPC(ctx context.Context, md metadata.MD) {
+	state := contextAttributes.Load()
+	if state == nil {
+		return
+	}
+	for _, key := range state.keys {
+		value, ok := MetaFromContext(ctx, key)
+		if !ok || len(md.Get(metaHeader(key))) > 0 {
+			continue
+		}
+		md.Set(metaHeader(key), value)
+	}
+}
+
+// MetaSpanAttributes 返回上下文中白名单字段对应的 span 属性
+func MetaSpanAttributes(ctx context.Context) []attribute.KeyValue {
+	state := contextAttributes.Load()
+	if state == nil {
+		return nil
+	}
+	var attrs []attribute.KeyValue
+	for _, key := range state.cfg.SpanKeys {
+		if value, ok := MetaFromContext(ctx, key); ok {
+			attrs = append(attrs, attribute.String(key, value))
+		}
+	}
+	return attrs
+}
+
+// MetaLabelAttributes 返回上下文中白名单字段对应的指标标签。
+// 缺失的字段记为空字符串，保证同一指标的标签集合固定；超过基数上限的取值记为 "other"。
+func MetaLabelAttributes(ctx context.Context) []attribute.KeyValue {
+	state := contextAttributes.Load()
+	if state == nil || len(state.cfg.LabelKeys) == 0 {
+		return nil
+	}
+	attrs := make([]attribute.KeyValue, 0, len(state.cfg.LabelKeys))
+	for _, key := range state.cfg.LabelKeys {
+		value, _ := MetaFromContext(ctx, key)
+		attrs = append(attrs, attribute.String(key, state.boundedValue(key, value)))
+	}
+	return attrs
+}
+
+// boundedValue 记录标签取值，超过基数上限的新取值返回 "other"
+func (s *contextAttributesState) boundedValue(key, value string) string {
+	if value == "" {
+		return value
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seen, ok := s.values[key]
+	if !ok {
+		seen = make(map[string]struct{})
+		s.values[key] = seen
+	}
+	if _, ok := seen[value]; ok {
+		return value
+	}
+	if len(seen) >= s.cfg.MaxLabelValues {
+		return otherLabelValue
+	}
+	seen[value] = struct{}{}
+	return value
+}
@@ -0,0 +1,151 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+var (
+	globalOnce     sync.Once
+	globalReader   *sdkmetric.ManualReader
+	globalRecorder *tracetest.SpanRecorder
+)
+
+// useGlobalProviders 将全局 MeterProvider 和 TracerProvider 设置为可检查的测试实现。
+// 拦截器使用的全局 meter/tracer 只会委托给第一次设置的 provider，因此整个测试进程只设置一次。
+func useGlobalProviders() (*sdkmetric.ManualReader, *tracetest.SpanRecorder) {
+	globalOnce.Do(func() {
+		globalReader = sdkmetric.NewManualReader()
+		globalRecorder = tracetest.NewSpanRecorder()
+		otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(globalReader)))
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(globalRecorder)))
+	})
+	return globalReader, globalRecorder
+}
+
+func TestContextAttributes(t *testing.T) {
+	t.Cleanup(func() { SetContextAttributes(nil) })
+
+	// 未配置时不读取、不传递任何字段
+	ctx := WithMeta(context.Background(), "client_platform", "ios")
+	assert.Nil(t, MetaSpanAttributes(ctx))
+	assert.Nil(t, MetaLabelAttributes(ctx))
+	md := metadata.MD{}
+	injectMetaToGRPC(ctx, md)
+	assert.Empty(t, md)
+
+	SetContextAttributes(&ContextAttributesConfig{
+		SpanKeys:       []string{"tenant_id", "client_platform"},
+		LabelKeys:      []string{"client_platform"},
+		MaxLabelValues: 2,
+	})
+
+	// WithMeta 不修改父上下文
+	child := WithMeta(ctx, "tenant_id", "t-1")
+	_, ok := MetaFromContext(ctx, "tenant_id")
+	assert.False(t, ok)
+	assert.ElementsMatch(t, []attribute.KeyValue{
+		attribute.String("tenant_id", "t-1"),
+		attribute.String("client_platform", "ios"),
+	}, MetaSpanAttributes(child))
+
+	// 入站元数据只读取白名单字段，上下文中已有的值优先
+	in := extractMetaFromGRPC(ctx, metadata.Pairs("x-client-platform", "android", "x-tenant-id", "t-2", "x-user-id", "u-1"))
+	platform, _ := MetaFromContext(in, "client_platform")
+	assert.Equal(t, "ios", platform)
+	tenant, _ := MetaFromContext(in, "tenant_id")
+	assert.Equal(t, "t-2", tenant)
+	_, ok = MetaFromContext(in, "user_id")
+	assert.False(t, ok)
+
+	header := http.Header{}
+	header.Set("X-Client-Platform", "web")
+	platform, _ = MetaFromContext(extractMetaFromHTTP(context.Background(), header), "client_platform")
+	assert.Equal(t, "web", platform)
+
+	// 出站元数据不覆盖调用方已设置的键
+	md = metadata.Pairs("x-tenant-id", "explicit")
+	injectMetaToGRPC(child, md)
+	assert.Equal(t, []string{"explicit"}, md.Get("x-tenant-id"))
+	assert.Equal(t, []string{"ios"}, md.Get("x-client-platform"))
+
+	// 缺失的字段记为空字符串，超过基数上限的新取值记为 "other"
+	assert.Equal(t, []attribute.KeyValue{attribute.String("client_platform", "")}, MetaLabelAttributes(context.Background()))
+	assert.Equal(t, []attribute.KeyValue{attribute.String("client_platform", "ios")}, MetaLabelAttributes(ctx))
+	assert.Equal(t, []attribute.KeyValue{attribute.String("client_platform", "web")},
+		MetaLabelAttributes(WithMeta(context.Background(), "client_platform", "web")))
+	assert.Equal(t, []attribute.KeyValue{attribute.String("client_platform", otherLabelValue)},
+		MetaLabelAttributes(WithMeta(context.Background(), "client_platform", "android")))
+	assert.Equal(t, []attribute.KeyValue{attribute.String("client_platform", "ios")}, MetaLabelAttributes(ctx), "known values are kept")
+}
+
+func TestGRPCInterceptorsContextAttributes(t *testing.T) {
+	reader, recorder := useGlobalProviders()
+	t.Cleanup(func() { SetContextAttributes(nil) })
+	SetContextAttributes(&ContextAttributesConfig{
+		SpanKeys:  []string{"tenant_id"},
+		LabelKeys: []string{"client_platform"},
+	})
+
+	cc, err := grpc.NewClient("passthrough:///metrics-test", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer cc.Close()
+
+	// 客户端拦截器把上下文中的白名单字段写入出站 metadata
+	ctx := WithMeta(WithMeta(context.Background(), "tenant_id", "t-1"), "client_platform", "ios")
+	var outgoing metadata.MD
+	err = GRPCClientInterceptor()(ctx, "/chat.Chat/Send", nil, nil, cc,
+		func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			outgoing, _ = metadata.FromOutgoingContext(ctx)
+			return nil
+		})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"t-1"}, outgoing.Get("x-tenant-id"))
+	assert.Equal(t, []string{"ios"}, outgoing.Get("x-client-platform"))
+
+	// 服务端拦截器从入站 metadata 还原，handler 可直接读取
+	_, err = GRPCServerInterceptor()(metadata.NewIncomingContext(context.Background(), outgoing), nil,
+		&grpc.UnaryServerInfo{FullMethod: "/chat.Chat/Send"},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			tenant, ok := MetaFromContext(ctx, "tenant_id")
+			assert.True(t, ok)
+			assert.Equal(t, "t-1", tenant)
+			return nil, nil
+		})
+	require.NoError(t, err)
+
+	var server sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.SpanKind() == trace.SpanKindServer && span.Name() == "/chat.Chat/Send" {
+			server = span
+		}
+	}
+	require.NotNil(t, server)
+	assert.Contains(t, server.Attributes(), attribute.String("tenant_id", "t-1"))
+
+	requests := collectMetrics(t, reader)["rpc.server.requests.count"].Data.(metricdata.Sum[int64]).DataPoints
+	require.NotEmpty(t, requests)
+	found := false
+	for _, dp := range requests {
+		if v, ok := dp.Attributes.Value("client_platform"); ok && v.AsString() == "ios" {
+			found = true
+			assert.False(t, dp.Attributes.HasValue("tenant_id"), "span-only keys are not metric labels")
+		}
+	}
+	assert.True(t, found)
+}
@@ -0,0 +1,353 @@
+package internal
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"path/filepath"
+	"runtime/trace"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	rpprof "runtime/pprof"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+)
+
+// ErrCaptureInProgress 表示已有采集正在进行。
+// CPU profile 和 runtime trace 在进程内只能同时运行一个。
+var ErrCaptureInProgress = errors.New("metrics: profile capture already in progress")
+
+// DebugConfig 定义了诊断服务器的配置。
+type DebugConfig struct {
+	// ListenAddr 诊断服务器的监听地址，如 "127.0.0.1:6060"。
+	ListenAddr string `mapstructure:"listen_addr"`
+
+	// AuthToken 访问诊断接口所需的 Bearer Token。
+	// 监听非回环地址时必须设置，请求需携带 "Authorization: Bearer <token>"。
+	AuthToken string `mapstructure:"auth_token"`
+
+	// OutputDir 通过配置中心触发的采集结果保存目录。
+	OutputDir string `mapstructure:"output_dir"`
+
+	// MaxCaptureDuration 单次 CPU/trace/wall-clock 采集的最长时间，防止误操作长时间采集。
+	// 请求的时长超过上限时按上限采集，按秒取整，最少 1 秒。
+	MaxCaptureDuration time.Duration `mapstructure:"max_capture_duration"`
+}
+
+// CaptureRequest 描述一次 profile 采集请求。
+type CaptureRequest struct {
+	// ID 请求标识。通过配置中心触发时，只有 ID 变化才会重新采集。
+	ID string `json:"id"`
+	// Profile 采集类型：cpu、trace、fgprof、heap、allocs、goroutine、block、mutex、threadcreate。
+	Profile string `json:"profile"`
+	// Seconds 采集时长（仅对 cpu、trace、fgprof 有效），默认 30 秒。
+	Seconds int `json:"seconds"`
+}
+
+// defaultCaptureSeconds 是采集时长的默认值
+const defaultCaptureSeconds = 30
+
+// DebugServer 是挂载 pprof、wall-clock 分析和 runtime trace 的诊断 HTTP 服务器。
+type DebugServer struct {
+	cfg       DebugConfig
+	logger    clog.Logger
+	server    *http.Server
+	listener  net.Listener
+	captureMu sync.Mutex
+}
+
+// NewDebugServer 校验配置并创建诊断服务器，不会立即监听。
+func NewDebugServer(cfg DebugConfig, logger clog.Logger) (*DebugServer, error) {
+	if cfg.ListenAddr == "" {
+		return nil, errors.New("debug server listen address cannot be empty")
+	}
+	if cfg.AuthToken == "" && !isLoopbackAddr(cfg.ListenAddr) {
+		return nil, fmt.Errorf("debug server listening on %s requires an auth token", cfg.ListenAddr)
+	}
+	if cfg.OutputDir == "" {
+		cfg.OutputDir = filepath.Join(os.TempDir(), "gochat-profiles")
+	}
+	if cfg.MaxCaptureDuration <= 0 {
+		cfg.MaxCaptureDuration = 5 * time.Minute
+	}
+
+	s := &DebugServer{
+		cfg:    cfg,
+		logger: logger,
+	}
+	s.server = &http.Server{
+		Addr:              cfg.ListenAddr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return s, nil
+}
+
+// Start 开始监听并在后台处理请求。监听失败时直接返回错误。
+func (s *DebugServer) Start() error {
+	ln, err := net.Listen("tcp", s.cfg.ListenAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.cfg.ListenAddr, err)
+	}
+	s.listener = ln
+
+	go func() {
+		if err := s.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			s.logger.Error("诊断服务器异常退出", clog.Err(err))
+		}
+	}()
+
+	s.logger.Info("诊断服务器已启动",
+		clog.String("address", ln.Addr().String()),
+		clog.Bool("auth", s.cfg.AuthToken != ""))
+	return nil
+}
+
+// Addr 返回实际监听的地址，未启动时返回配置的地址。
+func (s *DebugServer) Addr() string {
+	if s.listener != nil {
+		return s.listener.Addr().String()
+	}
+	return s.cfg.ListenAddr
+}
+
+// Shutdown 优雅关闭诊断服务器。
+func (s *DebugServer) Shutdown(ctx context.Context) error {
+	if err := s.server.Shutdown(ctx); err != nil {
+		return fmt.Errorf("failed to shutdown debug server: %w", err)
+	}
+	s.logger.Info("诊断服务器已关闭")
+	return nil
+}
+
+// Handler 返回带鉴权的诊断路由，便于挂载到已有的 HTTP 服务器上。
+func (s *DebugServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", s.exclusive(pprof.Profile))
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", s.exclusive(pprof.Trace))
+	mux.HandleFunc("/debug/fgprof", s.exclusive(s.handleWallClock))
+	mux.HandleFunc("/debug/capture", s.handleCapture)
+	return s.authenticate(mux)
+}
+
+// authenticate 校验 Bearer Token
+func (s *DebugServer) authenticate(next http.Handler) http.Handler {
+	if s.cfg.AuthToken == "" {
+		return next
+	}
+	expected := []byte("Bearer " + s.cfg.AuthToken)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			s.logger.Warn("诊断接口鉴权失败",
+				clog.String("path", r.URL.Path),
+				clog.String("remote", r.RemoteAddr))
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// exclusive 保证 CPU profile、trace 等独占型采集不会并发执行。
+// seconds 参数按 captureDuration 规范化后改写到请求中，pprof 的处理函数直接读取该参数，
+// 因此不会绕过 MaxCaptureDuration。
+func (s *DebugServer) exclusive(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		d, err := s.captureDuration(query.Get("seconds"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		query.Set("seconds", strconv.Itoa(int(d/time.Second)))
+		r.URL.RawQuery = query.Encode()
+
+		if !s.captureMu.TryLock() {
+			http.Error(w, ErrCaptureInProgress.Error(), http.StatusConflict)
+			return
+		}
+		defer s.captureMu.Unlock()
+
+		s.logger.Info("开始在线采集",
+			clog.String("path", r.URL.Path),
+			clog.Duration("duration", d),
+			clog.String("remote", r.RemoteAddr))
+		h(w, r)
+	}
+}
+
+// handleWallClock 采集 wall-clock profile 并以 folded 格式返回，由 exclusive 规范化时长并加锁
+func (s *DebugServer) handleWallClock(w http.ResponseWriter, r *http.Request) {
+	d, err := s.captureDuration(r.URL.Query().Get("seconds"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	p := newWallClockProfiler(0)
+	p.run(r.Context(), d)
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err := p.writeFolded(w); err != nil {
+		s.logger.Warn("输出 wall-clock profile 失败", clog.Err(err))
+	}
+}
+
+// handleCapture 采集 profile 并保存到 OutputDir，返回文件路径
+func (s *DebugServer) handleCapture(w http.ResponseWriter, r *http.Request) {
+	seconds, _ := strconv.Atoi(r.URL.Query().Get("seconds"))
+	req := CaptureRequest{
+		Profile: r.URL.Query().Get("profile"),
+		Seconds: seconds,
+	}
+
+	path, err := s.Capture(r.Context(), req)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrCaptureInProgress) {
+			status = http.StatusConflict
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"path": path})
+}
+
+// Capture 按请求采集 profile 并写入 OutputDir，返回文件路径。
+func (s *DebugServer) Capture(ctx context.Context, req CaptureRequest) (string, error) {
+	d, err := s.captureDuration(strconv.Itoa(req.Seconds))
+	if err != nil {
+		return "", err
+	}
+
+	profile := strings.ToLower(req.Profile)
+	if profile == "" {
+		profile = "cpu"
+	}
+	timed := profile == "cpu" || profile == "trace" || profile == "fgprof"
+	if !timed && rpprof.Lookup(profile) == nil {
+		return "", fmt.Errorf("unknown profile type: %s", req.Profile)
+	}
+
+	if timed {
+		if !s.captureMu.TryLock() {
+			return "", ErrCaptureInProgress
+		}
+		defer s.captureMu.Unlock()
+	}
+
+	if err := os.MkdirAll(s.cfg.OutputDir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create output dir: %w", err)
+	}
+	path := filepath.Join(s.cfg.OutputDir, captureFileName(profile))
+	f, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to create profile file: %w", err)
+	}
+	defer f.Close()
+
+	s.logger.Info("开始采集 profile",
+		clog.String("profile", profile),
+		clog.String("id", req.ID),
+		clog.Duration("duration", d),
+		clog.String("path", path))
+
+	switch profile {
+	case "cpu":
+		if err := rpprof.StartCPUProfile(f); err != nil {
+			return "", fmt.Errorf("failed to start cpu profile: %w", err)
+		}
+		sleepContext(ctx, d)
+		rpprof.StopCPUProfile()
+	case "trace":
+		if err := trace.Start(f); err != nil {
+			return "", fmt.Errorf("failed to start trace: %w", err)
+		}
+		sleepContext(ctx, d)
+		trace.Stop()
+	case "fgprof":
+		p := newWallClockProfiler(0)
+		p.run(ctx, d)
+		err = p.writeFolded(f)
+	default:
+		err = rpprof.Lookup(profile).WriteTo(f, 0)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to write %s profile: %w", profile, err)
+	}
+
+	s.logger.Info("profile 采集完成", clog.String("profile", profile), clog.String("path", path))
+	return path, nil
+}
+
+// captureDuration 解析采集时长，默认 30 秒，超过 MaxCaptureDuration 时截断到上限
+func (s *DebugServer) captureDuration(seconds string) (time.Duration, error) {
+	n, err := strconv.Atoi(seconds)
+	if seconds == "" || (err == nil && n == 0) {
+		n = defaultCaptureSeconds
+	} else if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid seconds: %s", seconds)
+	}
+
+	limit := s.cfg.MaxCaptureDuration.Truncate(time.Second)
+	if limit < time.Second {
+		limit = time.Second
+	}
+	if int64(n) > int64(limit/time.Second) {
+		return limit, nil
+	}
+	return time.Duration(n) * time.Second, nil
+}
+
+// captureFileName 生成带主机名和时间戳的文件名，便于区分多实例的采集结果
+func captureFileName(profile string) string {
+	host, _ := os.Hostname()
+	if host == "" {
+		host = "unknown"
+	}
+	ext := "pprof"
+	switch profile {
+	case "trace":
+		ext = "trace"
+	case "fgprof":
+		ext = "folded"
+	}
+	return fmt.Sprintf("%s-%s-%s.%s", host, profile, time.Now().Format("20060102-150405"), ext)
+}
+
+// sleepContext 等待 d 时长或 ctx 取消
+func sleepContext(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// isLoopbackAddr 检查监听地址是否只绑定在回环接口
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDebugServer(t *testing.T, maxCapture time.Duration) *DebugServer {
+	t.Helper()
+	s, err := NewDebugServer(DebugConfig{
+		ListenAddr:         "127.0.0.1:0",
+		OutputDir:          t.TempDir(),
+		MaxCaptureDuration: maxCapture,
+	}, clog.Namespace("debug-test"))
+	require.NoError(t, err)
+	return s
+}
+
+func TestCaptureDuration(t *testing.T) {
+	s := newTestDebugServer(t, time.Minute)
+
+	for seconds, want := range map[string]time.Duration{
+		"":              30 * time.Second,
+		"0":             30 * time.Second,
+		"5":             5 * time.Second,
+		"600":           time.Minute,
+		"9999999999999": time.Minute,
+	} {
+		d, err := s.captureDuration(seconds)
+		require.NoError(t, err, seconds)
+		assert.Equal(t, want, d, seconds)
+	}
+
+	for _, seconds := range []string{"-1", "abc", "1.5", "99999999999999999999"} {
+		_, err := s.captureDuration(seconds)
+		assert.Error(t, err, seconds)
+	}
+
+	// 默认时长同样受上限约束，上限不足 1 秒时按 1 秒采集
+	d, err := newTestDebugServer(t, 10*time.Second).captureDuration("")
+	require.NoError(t, err)
+	assert.Equal(t, 10*time.Second, d)
+	d, err = newTestDebugServer(t, 100*time.Millisecond).captureDuration("5")
+	require.NoError(t, err)
+	assert.Equal(t, time.Second, d)
+}
+
+func TestDebugServerExclusive(t *testing.T) {
+	s := newTestDebugServer(t, time.Second)
+	handler := s.Handler()
+
+	serve := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	// 采集进行中时，三个定时采集接口都返回 409
+	s.captureMu.Lock()
+	for _, target := range []string{
+		"/debug/pprof/profile?seconds=1",
+		"/debug/pprof/trace?seconds=1",
+		"/debug/fgprof?seconds=1",
+	} {
+		assert.Equal(t, http.StatusConflict, serve(target).Code, target)
+	}
+	s.captureMu.Unlock()
+
+	assert.Equal(t, http.StatusBadRequest, serve("/debug/pprof/profile?seconds=-1").Code)
+	assert.Equal(t, http.StatusBadRequest, serve("/debug/fgprof?seconds=abc").Code)
+
+	// 超过上限的时长被截断到 MaxCaptureDuration
+	for _, target := range []string{
+		"/debug/pprof/profile?seconds=3600",
+		"/debug/pprof/trace?seconds=3600",
+		"/debug/fgprof?seconds=3600",
+	} {
+		start := time.Now()
+		rec := serve(target)
+		assert.Equal(t, http.StatusOK, rec.Code, target)
+		assert.Less(t, time.Since(start), 10*time.Second, target)
+	}
+}
@@ -122,6 +122,7 @@ func init() {
 //   - 记录请求状态和错误信息
 //   - 在请求完成时记录详细的处理日志
 func GRPCServerInterceptor() grpc.UnaryServerInterceptor {
+	registerInterceptorInstruments("rpc.server", "Number of gRPC requests received.", "Duration of gRPC requests in seconds.")
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
 		// 提取客户端传递的 trace context
 		md, ok := metadata.FromIncomingContext(ctx)
@@ -129,13 +130,15 @@ func GRPCServerInterceptor() grpc.UnaryServerInterceptor {
 			md = metadata.New(nil)
 		}
 		ctx = otel.GetTextMapPropagator().Extract(ctx, &grpcMetadataCarrier{MD: md})
+		ctx = extractMetaFromGRPC(ctx, md)
 
 		// 创建 span
 		spanCtx, span := tracer.Start(ctx, info.FullMethod,
 			trace.WithSpanKind(trace.SpanKindServer),
 			trace.WithAttributes(
 				semconv.RPCSystemGRPC,
-				semconv.RPCServiceKey.String(info.FullMethod)))
+				semconv.RPCServiceKey.String(info.FullMethod)),
+			trace.WithAttributes(MetaSpanAttributes(ctx)...))
 		defer span.End()
 
 		grpcServerLogger.Debug("开始处理 gRPC 请求",
@@ -152,11 +155,11 @@ func GRPCServerInterceptor() grpc.UnaryServerInterceptor {
 		statusCode := status.Code(err)
 
 		// 记录指标
-		attrs := attribute.NewSet(
+		attrs := attribute.NewSet(append([]attribute.KeyValue{
 			semconv.RPCSystemGRPC,
 			semconv.RPCServiceKey.String(info.FullMethod),
 			semconv.RPCGRPCStatusCodeKey.Int(int(statusCode)),
-		)
+		}, MetaLabelAttributes(ctx)...)...)
 		grpcServerRequests.Add(spanCtx, 1, metric.WithAttributeSet(attrs))
 		grpcServerDuration.Record(spanCtx, duration.Seconds(), metric.WithAttributeSet(attrs))
 
@@ -199,13 +202,15 @@ func GRPCServerInterceptor() grpc.UnaryServerInterceptor {
 //   - 记录请求状态和错误信息
 //   - 在请求完成时记录详细的调用日志
 func GRPCClientInterceptor() grpc.UnaryClientInterceptor {
+	registerInterceptorInstruments("rpc.client", "Number of gRPC requests sent.", "Duration of gRPC client requests in seconds.")
 	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
 		// 创建 span
 		spanCtx, span := tracer.Start(ctx, method,
 			trace.WithSpanKind(trace.SpanKindClient),
 			trace.WithAttributes(
 				semconv.RPCSystemGRPC,
-				semconv.RPCServiceKey.String(method)))
+				semconv.RPCServiceKey.String(method)),
+			trace.WithAttributes(MetaSpanAttributes(ctx)...))
 		defer span.End()
 
 		// 注入 trace context 到 metadata
@@ -216,6 +221,7 @@ func GRPCClientInterceptor() grpc.UnaryClientInterceptor {
 			md = md.Copy()
 		}
 		otel.GetTextMapPropagator().Inject(spanCtx, &grpcMetadataCarrier{MD: md})
+		injectMetaToGRPC(spanCtx, md)
 		spanCtx = metadata.NewOutgoingContext(spanCtx, md)
 
 		grpcClientLogger.Debug("开始发送 gRPC 请求",
@@ -233,11 +239,11 @@ func GRPCClientInterceptor() grpc.UnaryClientInterceptor {
 		statusCode := status.Code(err)
 
 		// 记录指标
-		attrs := attribute.NewSet(
+		attrs := attribute.NewSet(append([]attribute.KeyValue{
 			semconv.RPCSystemGRPC,
 			semconv.RPCServiceKey.String(method),
 			semconv.RPCGRPCStatusCodeKey.Int(int(statusCode)),
-		)
+		}, MetaLabelAttributes(ctx)...)...)
 		grpcClientRequests.Add(spanCtx, 1, metric.WithAttributeSet(attrs))
 		grpcClientDuration.Record(spanCtx, duration.Seconds(), metric.WithAttributeSet(attrs))
 
@@ -281,10 +287,12 @@ func GRPCClientInterceptor() grpc.UnaryClientInterceptor {
 //   - 记录请求状态和错误信息
 //   - 在请求完成时记录详细的处理日志
 func HTTPMiddleware() gin.HandlerFunc {
+	registerInterceptorInstruments("http.server", "Number of HTTP requests received.", "Duration of HTTP requests in seconds.")
 	return func(c *gin.Context) {
 		// 提取客户端传递的 trace context
 		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(),
 			propagation.HeaderCarrier(c.Request.Header))
+		ctx = extractMetaFromHTTP(ctx, c.Request.Header)
 
 		// 创建 span
 		spanCtx, span := tracer.Start(ctx, c.FullPath(),
@@ -293,7 +301,8 @@ func HTTPMiddleware() gin.HandlerFunc {
 				semconv.HTTPMethodKey.String(c.Request.Method),
 				semconv.HTTPURLKey.String(c.Request.URL.String()),
 				semconv.NetHostNameKey.String(c.Request.Host),
-			))
+			),
+			trace.WithAttributes(MetaSpanAttributes(ctx)...))
 		defer span.End()
 
 		// 将 span context 注入到请求中
@@ -316,11 +325,11 @@ func HTTPMiddleware() gin.HandlerFunc {
 		statusCode := c.Writer.Status()
 
 		// 记录指标
-		attrs := attribute.NewSet(
+		attrs := attribute.NewSet(append([]attribute.KeyValue{
 			semconv.HTTPMethodKey.String(c.Request.Method),
 			semconv.HTTPRouteKey.String(c.FullPath()),
 			semconv.HTTPStatusCodeKey.Int(statusCode),
-		)
+		}, MetaLabelAttributes(ctx)...)...)
 		httpServerRequests.Add(spanCtx, 1, metric.WithAttributeSet(attrs))
 		httpServerDuration.Record(spanCtx, duration.Seconds(), metric.WithAttributeSet(attrs))
 
@@ -4,11 +4,10 @@ import (
 	"context"
 	"fmt"
 	"net/http"
-	"time"
 
 	"github.com/ceyewan/gochat/im-infra/clog"
 	"github.com/gin-gonic/gin"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/otlptranslator"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/exporters/jaeger"
 	"go.opentelemetry.io/otel/exporters/prometheus"
@@ -37,6 +36,8 @@ type ShutdownFunc func(ctx context.Context) error
 // 它封装了 OpenTelemetry 的复杂性，为上层提供简洁的接口。
 type Provider struct {
 	shutdownFunc ShutdownFunc
+	// metricsHandler /metrics 的 handler，未启用 Prometheus 时为 nil
+	metricsHandler http.Handler
 }
 
 // NewProvider 创建一个新的内部 provider 实例。
@@ -62,6 +63,10 @@ func NewProvider(cfg *Config) (*Provider, error) {
 		providerLogger.Error("service name cannot be empty")
 		return nil, fmt.Errorf("service name must be configured")
 	}
+	if err := validateScrapeConfig(cfg); err != nil {
+		providerLogger.Error("invalid prometheus scrape config", clog.Err(err))
+		return nil, fmt.Errorf("invalid prometheus scrape config: %w", err)
+	}
 
 	// 创建 OpenTelemetry Resource
 	providerLogger.Debug("创建 OpenTelemetry resource")
@@ -99,7 +104,7 @@ func NewProvider(cfg *Config) (*Provider, error) {
 
 	// 初始化 MeterProvider
 	providerLogger.Debug("初始化 meter provider")
-	mp, err := newMeterProvider(cfg, res)
+	mp, metricsHandler, scrapeServer, err := newMeterProvider(cfg, res)
 	if err != nil {
 		providerLogger.Error("failed to create meter provider",
 			clog.Err(err))
@@ -109,12 +114,31 @@ func NewProvider(cfg *Config) (*Provider, error) {
 	providerLogger.Info("meter provider initialized successfully",
 		clog.String("prometheus_addr", cfg.PrometheusListenAddr))
 
+	// 注册服务信息和 uptime 指标
+	if err := registerServiceMetrics(mp.Meter(InstrumentationName), cfg.ServiceName, cfg.BuildInfo); err != nil {
+		providerLogger.Error("failed to register service info metrics",
+			clog.Err(err))
+		return nil, fmt.Errorf("failed to register service info metrics: %w", err)
+	}
+
+	// 设置上下文元数据提取白名单
+	SetContextAttributes(cfg.ContextAttributes)
+
 	// 创建优雅关闭函数
 	shutdown := func(ctx context.Context) error {
 		shutdownLogger.Info("开始关闭 metrics provider")
 
 		var errs []error
 
+		// 关闭独立的 Prometheus 服务器
+		if scrapeServer != nil {
+			shutdownLogger.Debug("关闭 prometheus server")
+			if err := scrapeServer.Shutdown(ctx); err != nil {
+				shutdownLogger.Error("failed to shutdown prometheus server", clog.Err(err))
+				errs = append(errs, fmt.Errorf("failed to shutdown prometheus server: %w", err))
+			}
+		}
+
 		// 关闭 TracerProvider
 		shutdownLogger.Debug("关闭 tracer provider")
 		if err := tp.Shutdown(ctx); err != nil {
@@ -144,7 +168,7 @@ func NewProvider(cfg *Config) (*Provider, error) {
 	}
 
 	providerLogger.Info("metrics provider 初始化完成")
-	return &Provider{shutdownFunc: shutdown}, nil
+	return &Provider{shutdownFunc: shutdown, metricsHandler: metricsHandler}, nil
 }
 
 // Shutdown 调用内部的关闭函数，优雅地停止所有 metrics 相关服务。
@@ -152,6 +176,12 @@ func (p *Provider) Shutdown(ctx context.Context) error {
 	return p.shutdownFunc(ctx)
 }
 
+// MetricsHandler 返回 /metrics 的 handler，配置了 PrometheusAuth 时带鉴权。
+// 未启用 Prometheus 时返回 nil。
+func (p *Provider) MetricsHandler() http.Handler {
+	return p.metricsHandler
+}
+
 // GRPCServerInterceptor 返回一个新的 gRPC 服务端拦截器。
 func (p *Provider) GRPCServerInterceptor() grpc.UnaryServerInterceptor {
 	return GRPCServerInterceptor()
@@ -246,19 +276,21 @@ func newTracerProvider(cfg *Config, res *resource.Resource) (*sdktrace.TracerPro
 
 // newMeterProvider 创建并配置 MeterProvider。
 //
-// 如果配置了 Prometheus 监听地址，会创建 Prometheus exporter 并启动 HTTP 服务器。
-// 否则创建一个基本的 MeterProvider。
-func newMeterProvider(cfg *Config, res *resource.Resource) (*sdkmetric.MeterProvider, error) {
-	if cfg.PrometheusListenAddr == "" {
+// 如果配置了 Prometheus 监听地址或 PrometheusHandlerOnly，会创建 Prometheus exporter，
+// 并返回 /metrics 的 handler；配置了监听地址且不是 PrometheusHandlerOnly 时还会启动独立的 HTTP 服务器。
+// 否则创建一个基本的 MeterProvider，handler 和服务器均为 nil。
+func newMeterProvider(cfg *Config, res *resource.Resource) (*sdkmetric.MeterProvider, http.Handler, *http.Server, error) {
+	if cfg.PrometheusListenAddr == "" && !cfg.PrometheusHandlerOnly {
 		exporterLogger.Info("prometheus 未启用，创建基本的 meter provider")
-		return sdkmetric.NewMeterProvider(sdkmetric.WithResource(res)), nil
+		return sdkmetric.NewMeterProvider(sdkmetric.WithResource(res)), nil, nil, nil
 	}
 
 	exporterLogger.Debug("创建 prometheus exporter")
-	promExporter, err := prometheus.New()
+	// 固定使用下划线转义和单位/类型后缀的命名规则，保证 GenerateAlertRules 生成的指标名与实际导出的一致
+	promExporter, err := prometheus.New(prometheus.WithTranslationStrategy(otlptranslator.UnderscoreEscapingWithSuffixes))
 	if err != nil {
 		exporterLogger.Error("failed to create prometheus exporter", clog.Err(err))
-		return nil, fmt.Errorf("failed to create prometheus exporter: %w", err)
+		return nil, nil, nil, fmt.Errorf("failed to create prometheus exporter: %w", err)
 	}
 	exporterLogger.Debug("prometheus exporter created successfully")
 
@@ -266,29 +298,22 @@ func newMeterProvider(cfg *Config, res *resource.Resource) (*sdkmetric.MeterProv
 		sdkmetric.WithReader(promExporter),
 		sdkmetric.WithResource(res),
 	)
+	handler := newScrapeHandler(cfg.PrometheusAuth)
 
-	// 启动 Prometheus HTTP 服务器
-	go func() {
-		prometheusLogger.Info("启动 prometheus metrics 服务器",
-			clog.String("address", cfg.PrometheusListenAddr))
-
-		mux := http.NewServeMux()
-		mux.Handle("/metrics", promhttp.Handler())
-		server := &http.Server{
-			Addr:              cfg.PrometheusListenAddr,
-			Handler:           mux,
-			ReadHeaderTimeout: 10 * time.Second,
-		}
+	if cfg.PrometheusHandlerOnly {
+		exporterLogger.Info("meter provider with prometheus exporter created successfully, /metrics is served by MetricsHandler",
+			clog.Bool("auth", cfg.PrometheusAuth != nil))
+		return mp, handler, nil, nil
+	}
 
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			prometheusLogger.Error("prometheus server failed", clog.Err(err))
-			// 使用 otel.Handle 确保错误被正确处理，但不会导致程序崩溃
-			otel.Handle(fmt.Errorf("prometheus server failed: %w", err))
-		} else {
-			prometheusLogger.Info("prometheus server stopped")
-		}
-	}()
+	// 启动 Prometheus HTTP 服务器
+	server, err := startScrapeServer(cfg, handler)
+	if err != nil {
+		exporterLogger.Error("failed to start prometheus server", clog.Err(err))
+		_ = mp.Shutdown(context.Background())
+		return nil, nil, nil, err
+	}
 
 	exporterLogger.Info("meter provider with prometheus exporter created successfully")
-	return mp, nil
+	return mp, handler, server, nil
 }
@@ -0,0 +1,68 @@
+package internal
+
+import (
+	"sort"
+	"sync"
+)
+
+// InstrumentKind 仪表类型
+type InstrumentKind string
+
+const (
+	InstrumentCounter   InstrumentKind = "counter"
+	InstrumentHistogram InstrumentKind = "histogram"
+	InstrumentGauge     InstrumentKind = "gauge"
+)
+
+// Instrument 描述一个已声明的指标仪表，用于生成与实际导出指标一致的告警规则
+type Instrument struct {
+	// Name OpenTelemetry 仪表名称，如 "rpc.server.duration"
+	Name string
+	// Kind 仪表类型
+	Kind InstrumentKind
+	// Unit 单位，如 "s"、"By"，可以为空
+	Unit string
+	// Description 仪表描述
+	Description string
+}
+
+var (
+	instrumentsMu sync.RWMutex
+	instruments   = make(map[string]Instrument)
+)
+
+// RegisterInstrument 记录一个已声明的仪表，同名仪表重复注册时保留最后一次的描述
+func RegisterInstrument(inst Instrument) {
+	instrumentsMu.Lock()
+	defer instrumentsMu.Unlock()
+	instruments[inst.Name] = inst
+}
+
+// Instruments 返回所有已注册的仪表，按名称排序
+func Instruments() []Instrument {
+	instrumentsMu.RLock()
+	defer instrumentsMu.RUnlock()
+
+	list := make([]Instrument, 0, len(instruments))
+	for _, inst := range instruments {
+		list = append(list, inst)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// registerInterceptorInstruments 在拦截器或中间件被实际使用时注册对应的请求计数和耗时仪表，
+// 未使用的拦截器不会生成告警规则
+func registerInterceptorInstruments(prefix, requestsDescription, durationDescription string) {
+	RegisterInstrument(Instrument{
+		Name:        prefix + ".requests.count",
+		Kind:        InstrumentCounter,
+		Description: requestsDescription,
+	})
+	RegisterInstrument(Instrument{
+		Name:        prefix + ".duration",
+		Kind:        InstrumentHistogram,
+		Unit:        "s",
+		Description: durationDescription,
+	})
+}
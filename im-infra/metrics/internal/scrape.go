@@ -0,0 +1,192 @@
+package internal
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel"
+)
+
+// ScrapeAuthConfig 定义了 Prometheus 抓取端点的鉴权方式。
+//
+// 可以同时配置 Bearer Token 和 Basic Auth，请求满足其中任意一种即可通过，
+// 便于在轮换凭据或迁移抓取配置期间同时支持新旧两种方式。
+type ScrapeAuthConfig struct {
+	// BearerToken 请求需携带 "Authorization: Bearer <token>"，
+	// 对应 Prometheus scrape_config 中的 authorization.credentials。
+	BearerToken string `mapstructure:"bearer_token"`
+
+	// Username 和 Password 为 HTTP Basic Auth 凭据，对应 scrape_config 中的 basic_auth。
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+}
+
+// ScrapeTLSConfig 定义了 Prometheus 抓取端点的 TLS 配置。
+type ScrapeTLSConfig struct {
+	// CertFile 和 KeyFile 为服务端证书和私钥的 PEM 文件路径。
+	CertFile string `mapstructure:"cert_file"`
+	KeyFile  string `mapstructure:"key_file"`
+
+	// ClientCAFile 校验客户端证书的 CA 证书 PEM 文件路径。
+	// 设置后开启双向 TLS，只有持有该 CA 签发证书的 Prometheus 才能抓取。
+	ClientCAFile string `mapstructure:"client_ca_file"`
+}
+
+// validate 校验鉴权配置
+func (c *ScrapeAuthConfig) validate() error {
+	if c.BearerToken == "" && c.Username == "" && c.Password == "" {
+		return errors.New("scrape auth requires a bearer token or basic auth credentials")
+	}
+	if (c.Username == "") != (c.Password == "") {
+		return errors.New("scrape basic auth requires both username and password")
+	}
+	return nil
+}
+
+// validate 校验 TLS 配置
+func (c *ScrapeTLSConfig) validate() error {
+	if c.CertFile == "" || c.KeyFile == "" {
+		return errors.New("scrape TLS requires both cert file and key file")
+	}
+	return nil
+}
+
+// load 读取证书并生成 tls.Config
+func (c *ScrapeTLSConfig) load() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load scrape TLS certificate: %w", err)
+	}
+	tlsCfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if c.ClientCAFile != "" {
+		pem, err := os.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read scrape client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no valid certificate found in scrape client CA %s", c.ClientCAFile)
+		}
+		tlsCfg.ClientCAs = pool
+		tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsCfg, nil
+}
+
+// validateScrapeConfig 校验 Prometheus 抓取端点的鉴权和 TLS 配置
+func validateScrapeConfig(cfg *Config) error {
+	if cfg.PrometheusAuth != nil {
+		if err := cfg.PrometheusAuth.validate(); err != nil {
+			return err
+		}
+	}
+	if cfg.PrometheusTLS != nil {
+		if cfg.PrometheusListenAddr == "" || cfg.PrometheusHandlerOnly {
+			return errors.New("scrape TLS requires a standalone prometheus listener")
+		}
+		if err := cfg.PrometheusTLS.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newScrapeHandler 返回 /metrics 的 handler，配置了鉴权时校验请求凭据
+func newScrapeHandler(auth *ScrapeAuthConfig) http.Handler {
+	handler := promhttp.Handler()
+	if auth == nil {
+		return handler
+	}
+
+	var bearer []byte
+	if auth.BearerToken != "" {
+		bearer = []byte("Bearer " + auth.BearerToken)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !authorizeScrape(r, auth, bearer) {
+			prometheusLogger.Warn("prometheus 抓取鉴权失败",
+				clog.String("path", r.URL.Path),
+				clog.String("remote", r.RemoteAddr))
+			if auth.Username != "" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="metrics"`)
+			}
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// authorizeScrape 校验请求是否携带了有效的 Bearer Token 或 Basic Auth 凭据
+func authorizeScrape(r *http.Request, auth *ScrapeAuthConfig, bearer []byte) bool {
+	if bearer != nil && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), bearer) == 1 {
+		return true
+	}
+	if auth.Username != "" {
+		user, pass, ok := r.BasicAuth()
+		if !ok {
+			return false
+		}
+		// 两次比较都要执行，避免通过耗时判断用户名是否正确
+		userOK := subtle.ConstantTimeCompare([]byte(user), []byte(auth.Username)) == 1
+		passOK := subtle.ConstantTimeCompare([]byte(pass), []byte(auth.Password)) == 1
+		return userOK && passOK
+	}
+	return false
+}
+
+// startScrapeServer 在 PrometheusListenAddr 上启动独立的 /metrics 服务器，配置了 TLS 时使用 HTTPS
+func startScrapeServer(cfg *Config, handler http.Handler) (*http.Server, error) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", handler)
+	server := &http.Server{
+		Addr:              cfg.PrometheusListenAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	if cfg.PrometheusTLS != nil {
+		tlsCfg, err := cfg.PrometheusTLS.load()
+		if err != nil {
+			return nil, err
+		}
+		server.TLSConfig = tlsCfg
+	}
+	if cfg.PrometheusAuth == nil && !isLoopbackAddr(cfg.PrometheusListenAddr) {
+		prometheusLogger.Warn("prometheus metrics 端点未配置鉴权，任何能访问该地址的客户端都可以抓取",
+			clog.String("address", cfg.PrometheusListenAddr))
+	}
+
+	go func() {
+		prometheusLogger.Info("启动 prometheus metrics 服务器",
+			clog.String("address", cfg.PrometheusListenAddr),
+			clog.Bool("tls", server.TLSConfig != nil),
+			clog.Bool("auth", cfg.PrometheusAuth != nil))
+
+		var err error
+		if server.TLSConfig != nil {
+			// 证书已加载到 TLSConfig 中，文件参数留空
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			prometheusLogger.Error("prometheus server failed", clog.Err(err))
+			// 使用 otel.Handle 确保错误被正确处理，但不会导致程序崩溃
+			otel.Handle(fmt.Errorf("prometheus server failed: %w", err))
+		} else {
+			prometheusLogger.Info("prometheus server stopped")
+		}
+	}()
+	return server, nil
+}
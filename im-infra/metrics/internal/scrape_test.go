@@ -0,0 +1,216 @@
+package internal
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testPKI 是测试用的 CA 及其签发的服务端、客户端证书
+type testPKI struct {
+	caFile, certFile, keyFile string
+	caPool                    *x509.CertPool
+	client                    tls.Certificate
+}
+
+// newTestPKI 在临时目录中生成 CA、127.0.0.1 的服务端证书和客户端证书
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+	dir := t.TempDir()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "metrics-test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	caCert, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	issue := func(serial int64, usage x509.ExtKeyUsage) ([]byte, []byte) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: "metrics-test"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		}, caCert, &key.PublicKey, caKey)
+		require.NoError(t, err)
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		require.NoError(t, err)
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+			pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	}
+
+	pki := &testPKI{
+		caFile:   filepath.Join(dir, "ca.pem"),
+		certFile: filepath.Join(dir, "server.pem"),
+		keyFile:  filepath.Join(dir, "server-key.pem"),
+		caPool:   x509.NewCertPool(),
+	}
+	pki.caPool.AddCert(caCert)
+	require.NoError(t, os.WriteFile(pki.caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0600))
+	serverCert, serverKey := issue(2, x509.ExtKeyUsageServerAuth)
+	require.NoError(t, os.WriteFile(pki.certFile, serverCert, 0600))
+	require.NoError(t, os.WriteFile(pki.keyFile, serverKey, 0600))
+	clientCert, clientKey := issue(3, x509.ExtKeyUsageClientAuth)
+	pki.client, err = tls.X509KeyPair(clientCert, clientKey)
+	require.NoError(t, err)
+	return pki
+}
+
+func TestValidateScrapeConfig(t *testing.T) {
+	assert.NoError(t, validateScrapeConfig(&Config{}))
+	assert.NoError(t, validateScrapeConfig(&Config{PrometheusAuth: &ScrapeAuthConfig{BearerToken: "token"}}))
+	assert.NoError(t, validateScrapeConfig(&Config{
+		PrometheusListenAddr: ":9090",
+		PrometheusTLS:        &ScrapeTLSConfig{CertFile: "cert.pem", KeyFile: "key.pem"},
+	}))
+
+	for name, cfg := range map[string]*Config{
+		"EmptyAuth":       {PrometheusAuth: &ScrapeAuthConfig{}},
+		"MissingPassword": {PrometheusAuth: &ScrapeAuthConfig{Username: "prometheus"}},
+		"MissingKeyFile": {
+			PrometheusListenAddr: ":9090",
+			PrometheusTLS:        &ScrapeTLSConfig{CertFile: "cert.pem"},
+		},
+		"TLSWithoutListener": {
+			PrometheusTLS: &ScrapeTLSConfig{CertFile: "cert.pem", KeyFile: "key.pem"},
+		},
+		"TLSWithHandlerOnly": {
+			PrometheusListenAddr:  ":9090",
+			PrometheusHandlerOnly: true,
+			PrometheusTLS:         &ScrapeTLSConfig{CertFile: "cert.pem", KeyFile: "key.pem"},
+		},
+	} {
+		assert.Error(t, validateScrapeConfig(cfg), name)
+	}
+}
+
+func TestScrapeHandlerAuth(t *testing.T) {
+	scrape := func(handler http.Handler, setup func(*http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if setup != nil {
+			setup(req)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	bearer := func(token string) func(*http.Request) {
+		return func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) }
+	}
+	basic := func(user, pass string) func(*http.Request) {
+		return func(r *http.Request) { r.SetBasicAuth(user, pass) }
+	}
+
+	assert.Equal(t, http.StatusOK, scrape(newScrapeHandler(nil), nil).Code)
+
+	handler := newScrapeHandler(&ScrapeAuthConfig{BearerToken: "s3cret"})
+	assert.Equal(t, http.StatusOK, scrape(handler, bearer("s3cret")).Code)
+	assert.Equal(t, http.StatusUnauthorized, scrape(handler, bearer("wrong")).Code)
+	rec := scrape(handler, nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Empty(t, rec.Header().Get("WWW-Authenticate"))
+
+	handler = newScrapeHandler(&ScrapeAuthConfig{Username: "prometheus", Password: "pa55"})
+	assert.Equal(t, http.StatusOK, scrape(handler, basic("prometheus", "pa55")).Code)
+	assert.Equal(t, http.StatusUnauthorized, scrape(handler, basic("prometheus", "wrong")).Code)
+	assert.Equal(t, http.StatusUnauthorized, scrape(handler, basic("admin", "pa55")).Code)
+	rec = scrape(handler, nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, `Basic realm="metrics"`, rec.Header().Get("WWW-Authenticate"))
+
+	// 同时配置时任意一种凭据即可通过，便于轮换
+	handler = newScrapeHandler(&ScrapeAuthConfig{BearerToken: "s3cret", Username: "prometheus", Password: "pa55"})
+	assert.Equal(t, http.StatusOK, scrape(handler, bearer("s3cret")).Code)
+	assert.Equal(t, http.StatusOK, scrape(handler, basic("prometheus", "pa55")).Code)
+	assert.Equal(t, http.StatusUnauthorized, scrape(handler, bearer("pa55")).Code)
+}
+
+func TestScrapeServerTLS(t *testing.T) {
+	pki := newTestPKI(t)
+
+	_, err := (&ScrapeTLSConfig{CertFile: pki.certFile, KeyFile: filepath.Join(t.TempDir(), "missing.pem")}).load()
+	assert.Error(t, err)
+	_, err = (&ScrapeTLSConfig{CertFile: pki.certFile, KeyFile: pki.keyFile, ClientCAFile: pki.keyFile}).load()
+	assert.Error(t, err, "a key file is not a CA bundle")
+
+	// 找一个空闲端口启动独立的 HTTPS 抓取服务器
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+
+	cfg := &Config{
+		PrometheusListenAddr: addr,
+		PrometheusAuth:       &ScrapeAuthConfig{BearerToken: "s3cret"},
+		PrometheusTLS:        &ScrapeTLSConfig{CertFile: pki.certFile, KeyFile: pki.keyFile, ClientCAFile: pki.caFile},
+	}
+	require.NoError(t, validateScrapeConfig(cfg))
+	server, err := startScrapeServer(cfg, newScrapeHandler(cfg.PrometheusAuth))
+	require.NoError(t, err)
+	defer server.Close()
+
+	get := func(certs []tls.Certificate, token string) (*http.Response, error) {
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: pki.caPool, Certificates: certs},
+		}}
+		req, err := http.NewRequest(http.MethodGet, "https://"+addr+"/metrics", nil)
+		require.NoError(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return resp, err
+	}
+
+	var resp *http.Response
+	require.Eventually(t, func() bool {
+		resp, err = get([]tls.Certificate{pki.client}, "s3cret")
+		return err == nil
+	}, 5*time.Second, 20*time.Millisecond)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// 双向 TLS 下先校验客户端证书，再校验抓取凭据
+	resp, err = get([]tls.Certificate{pki.client}, "")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	_, err = get(nil, "s3cret")
+	assert.Error(t, err, "client certificate is required")
+
+	// 明文 HTTP 请求无法抓取
+	plain, err := http.Get("http://" + addr + "/metrics")
+	if err == nil {
+		plain.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, plain.StatusCode)
+	}
+}
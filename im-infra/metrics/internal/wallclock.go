@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultWallClockHz 是 wall-clock 采样频率，与 fgprof 的默认值一致
+const defaultWallClockHz = 99
+
+// wallClockProfiler 通过周期性采集所有 goroutine 的调用栈实现 wall-clock 分析。
+//
+// 与 CPU profile 只统计 on-CPU 时间不同，wall-clock 分析同时统计阻塞在
+// IO、锁、channel 上的 goroutine，适合排查“CPU 不高但请求很慢”的问题。
+// 输出为 folded 格式（每行 "root;...;leaf count"），可直接交给 flamegraph.pl 或 speedscope。
+type wallClockProfiler struct {
+	hz      int
+	stacks  map[string]int
+	records []runtime.StackRecord
+}
+
+// newWallClockProfiler 创建 wall-clock 采样器
+func newWallClockProfiler(hz int) *wallClockProfiler {
+	if hz <= 0 {
+		hz = defaultWallClockHz
+	}
+	return &wallClockProfiler{
+		hz:     hz,
+		stacks: make(map[string]int),
+	}
+}
+
+// run 持续采样 d 时长，ctx 取消时提前结束
+func (p *wallClockProfiler) run(ctx context.Context, d time.Duration) {
+	ticker := time.NewTicker(time.Second / time.Duration(p.hz))
+	defer ticker.Stop()
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			return
+		case <-ticker.C:
+			p.sample()
+		}
+	}
+}
+
+// sample 采集一次所有 goroutine 的调用栈
+func (p *wallClockProfiler) sample() {
+	n, ok := runtime.GoroutineProfile(p.records)
+	for !ok {
+		// 预留余量，避免 goroutine 数量增长时反复扩容
+		p.records = make([]runtime.StackRecord, int(float64(n)*1.1)+10)
+		n, ok = runtime.GoroutineProfile(p.records)
+	}
+
+	for _, record := range p.records[:n] {
+		p.stacks[foldStack(record.Stack())]++
+	}
+}
+
+// writeFolded 按样本数从多到少输出 folded 格式
+func (p *wallClockProfiler) writeFolded(w io.Writer) error {
+	stacks := make([]string, 0, len(p.stacks))
+	for stack := range p.stacks {
+		stacks = append(stacks, stack)
+	}
+	sort.Slice(stacks, func(i, j int) bool {
+		return p.stacks[stacks[i]] > p.stacks[stacks[j]]
+	})
+
+	for _, stack := range stacks {
+		if _, err := fmt.Fprintf(w, "%s %d\n", stack, p.stacks[stack]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// foldStack 将调用栈转为 "root;...;leaf" 形式
+func foldStack(pcs []uintptr) string {
+	frames := runtime.CallersFrames(pcs)
+	var names []string
+	for {
+		frame, more := frames.Next()
+		if frame.Function != "" && frame.Function != "runtime.goexit" {
+			names = append(names, frame.Function)
+		}
+		if !more {
+			break
+		}
+	}
+
+	// CallersFrames 从叶子到根，folded 格式要求从根到叶子
+	for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+		names[i], names[j] = names[j], names[i]
+	}
+	return strings.Join(names, ";")
+}
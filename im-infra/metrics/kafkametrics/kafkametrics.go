@@ -0,0 +1,315 @@
+// Package kafkametrics 把 Kafka Provider 的运行指标桥接为 OpenTelemetry 指标。
+// 独立为子包，使只使用 metrics 的服务不必引入 Kafka 客户端依赖。
+package kafkametrics
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/ceyewan/gochat/im-infra/kafka"
+	"github.com/ceyewan/gochat/im-infra/metrics"
+	"github.com/ceyewan/gochat/im-infra/metrics/internal"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// defaultPollInterval 是 Kafka 指标的默认采集间隔
+const defaultPollInterval = 15 * time.Second
+
+var logger = clog.Namespace("metrics.kafka")
+
+// Option 定义了 Instrument 的可选配置。
+type Option func(*options)
+
+type options struct {
+	interval time.Duration
+}
+
+// WithPollInterval 设置 Kafka 指标的采集间隔，默认 15 秒。
+//
+// 平均值类 gauge 反映的是最近一个采集周期内的平均值，间隔越短，越接近实时情况。
+func WithPollInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.interval = interval
+	}
+}
+
+// Instrument 将 Kafka Provider 的 GetMetrics() 输出桥接为 OpenTelemetry 指标。
+//
+// 后台协程按固定间隔轮询生产者和所有已创建消费者的 GetMetrics()，
+// 把累计计数转换为 Counter 增量，把延迟类累计值转换为周期平均值记录到 gauge，
+// 使 Kafka 的健康状况与其他指标一起出现在同一个 Prometheus 中。
+// GetMetrics() 只提供累计值，拿不到单次发送或处理的原始耗时，因此平均值不以直方图导出，
+// 避免每个周期一个样本的直方图被误用来计算分位数。
+//
+// 导出的指标：
+//   - kafka_producer_messages_total{result}：生产消息数（success/failed）
+//   - kafka_producer_bytes_total：生产消息字节数
+//   - kafka_producer_send_latency_avg_seconds：最近一个周期的平均发送延迟
+//   - kafka_producer_batch_size_avg：最近一个周期的平均每批次消息数
+//   - kafka_producer_spill_pending：本地缓冲中待回放的消息数（开启 Spill 时）
+//   - kafka_consumer_messages_total{group,result}：消费消息数（processed/failed）
+//   - kafka_consumer_handler_duration_avg_seconds{group}：最近一个周期的平均回调处理耗时
+//   - kafka_consumer_lag{group}：所有分区的消费延迟之和
+//   - kafka_consumer_backlog_age_seconds{group}：积压时长（开启 ColdRead 时）
+//   - kafka_errors_total{role,group}：生产/消费失败次数
+//
+// 返回的 stop 函数用于停止轮询，应在关闭 Kafka Provider 之前调用。
+//
+// 示例：
+//
+//	stop, err := kafkametrics.Instrument(kafkaProvider)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	defer stop()
+func Instrument(provider kafka.Provider, opts ...Option) (stop func(), err error) {
+	if provider == nil {
+		return nil, errors.New("kafka provider cannot be nil")
+	}
+
+	o := &options{interval: defaultPollInterval}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.interval <= 0 {
+		o.interval = defaultPollInterval
+	}
+
+	b, err := newKafkaBridge(provider)
+	if err != nil {
+		logger.Error("failed to create kafka instruments", clog.Err(err))
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		b.run(ctx, o.interval)
+	}()
+
+	logger.Info("Kafka 指标桥接已启动", clog.Duration("interval", o.interval))
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			cancel()
+			wg.Wait()
+			logger.Info("Kafka 指标桥接已停止")
+		})
+	}, nil
+}
+
+// kafkaBridge 负责轮询 GetMetrics() 并写入 OTel 指标
+type kafkaBridge struct {
+	provider kafka.Provider
+
+	producerMessages metric.Int64Counter
+	producerBytes    metric.Int64Counter
+	sendLatency      metric.Float64Gauge
+	batchSize        metric.Float64Gauge
+	spillPending     metric.Int64Gauge
+	consumerMessages metric.Int64Counter
+	handlerDuration  metric.Float64Gauge
+	consumerLag      metric.Int64Gauge
+	backlogAge       metric.Float64Gauge
+	errors           metric.Int64Counter
+
+	// last 记录上一次采集的累计值，键为 "<来源>/<指标名>"
+	last map[string]float64
+}
+
+// newKafkaBridge 创建所有 Kafka 指标
+func newKafkaBridge(provider kafka.Provider) (*kafkaBridge, error) {
+	meter := otel.Meter(internal.InstrumentationName)
+	b := &kafkaBridge{
+		provider: provider,
+		last:     make(map[string]float64),
+	}
+
+	var err error
+	if b.producerMessages, err = meter.Int64Counter("kafka_producer_messages_total",
+		metric.WithDescription("Total number of messages produced to Kafka")); err != nil {
+		return nil, err
+	}
+	if b.producerBytes, err = meter.Int64Counter("kafka_producer_bytes_total",
+		metric.WithDescription("Total number of message bytes produced to Kafka"),
+		metric.WithUnit("By")); err != nil {
+		return nil, err
+	}
+	if b.sendLatency, err = meter.Float64Gauge("kafka_producer_send_latency_avg_seconds",
+		metric.WithDescription("Average Kafka send latency over the last collection interval"),
+		metric.WithUnit("s")); err != nil {
+		return nil, err
+	}
+	if b.batchSize, err = meter.Float64Gauge("kafka_producer_batch_size_avg",
+		metric.WithDescription("Average number of records per produced batch over the last collection interval")); err != nil {
+		return nil, err
+	}
+	if b.spillPending, err = meter.Int64Gauge("kafka_producer_spill_pending",
+		metric.WithDescription("Number of messages waiting in the local spill queue")); err != nil {
+		return nil, err
+	}
+	if b.consumerMessages, err = meter.Int64Counter("kafka_consumer_messages_total",
+		metric.WithDescription("Total number of messages handled by Kafka consumers")); err != nil {
+		return nil, err
+	}
+	if b.handlerDuration, err = meter.Float64Gauge("kafka_consumer_handler_duration_avg_seconds",
+		metric.WithDescription("Average consumer handler duration over the last collection interval"),
+		metric.WithUnit("s")); err != nil {
+		return nil, err
+	}
+	if b.consumerLag, err = meter.Int64Gauge("kafka_consumer_lag",
+		metric.WithDescription("Sum of consumer lag across all assigned partitions")); err != nil {
+		return nil, err
+	}
+	if b.backlogAge, err = meter.Float64Gauge("kafka_consumer_backlog_age_seconds",
+		metric.WithDescription("Age of the oldest unprocessed backlog across assigned partitions"),
+		metric.WithUnit("s")); err != nil {
+		return nil, err
+	}
+	if b.errors, err = meter.Int64Counter("kafka_errors_total",
+		metric.WithDescription("Total number of Kafka produce and consume errors")); err != nil {
+		return nil, err
+	}
+
+	registerInstrument("kafka_producer_messages_total", internal.InstrumentCounter, "", "Total number of messages produced to Kafka")
+	registerInstrument("kafka_producer_bytes_total", internal.InstrumentCounter, "By", "Total number of message bytes produced to Kafka")
+	registerInstrument("kafka_producer_send_latency_avg_seconds", internal.InstrumentGauge, "s", "Average Kafka send latency over the last collection interval")
+	registerInstrument("kafka_producer_batch_size_avg", internal.InstrumentGauge, "", "Average number of records per produced batch over the last collection interval")
+	registerInstrument("kafka_producer_spill_pending", internal.InstrumentGauge, "", "Number of messages waiting in the local spill queue")
+	registerInstrument("kafka_consumer_messages_total", internal.InstrumentCounter, "", "Total number of messages handled by Kafka consumers")
+	registerInstrument("kafka_consumer_handler_duration_avg_seconds", internal.InstrumentGauge, "s", "Average consumer handler duration over the last collection interval")
+	registerInstrument("kafka_consumer_lag", internal.InstrumentGauge, "", "Sum of consumer lag across all assigned partitions")
+	registerInstrument("kafka_consumer_backlog_age_seconds", internal.InstrumentGauge, "s", "Age of the oldest unprocessed backlog across assigned partitions")
+	registerInstrument("kafka_errors_total", internal.InstrumentCounter, "", "Total number of Kafka produce and consume errors")
+	return b, nil
+}
+
+// registerInstrument 登记仪表，使 metrics.GenerateAlertRules 能为其生成规则
+func registerInstrument(name string, kind internal.InstrumentKind, unit, description string) {
+	internal.RegisterInstrument(internal.Instrument{Name: name, Kind: kind, Unit: unit, Description: description})
+}
+
+// run 按间隔轮询，直到 ctx 被取消
+func (b *kafkaBridge) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		b.collect(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// collect 采集一次生产者和所有消费者的指标
+func (b *kafkaBridge) collect(ctx context.Context) {
+	if producer := b.provider.Producer(); producer != nil {
+		b.collectProducer(ctx, producer.GetMetrics())
+	}
+	for groupID, consumer := range b.provider.Consumers() {
+		if consumer != nil {
+			b.collectConsumer(ctx, groupID, consumer.GetMetrics())
+		}
+	}
+}
+
+// collectProducer 将生产者指标写入 OTel
+func (b *kafkaBridge) collectProducer(ctx context.Context, m map[string]interface{}) {
+	success := b.delta("producer/success_messages", m["success_messages"])
+	failed := b.delta("producer/failed_messages", m["failed_messages"])
+	bytes := b.delta("producer/total_bytes", m["total_bytes"])
+
+	b.producerMessages.Add(ctx, int64(success), metric.WithAttributes(attribute.String("result", "success")))
+	b.producerMessages.Add(ctx, int64(failed), metric.WithAttributes(attribute.String("result", "failed")))
+	b.producerBytes.Add(ctx, int64(bytes))
+	b.errors.Add(ctx, int64(failed), metric.WithAttributes(attribute.String("role", "producer")))
+
+	latencyMs := b.delta("producer/send_latency_ms_total", m["send_latency_ms_total"])
+	if count := b.delta("producer/send_latency_count", m["send_latency_count"]); count > 0 {
+		b.sendLatency.Record(ctx, latencyMs/count/1000)
+	}
+
+	records := b.delta("producer/batch_records_total", m["batch_records_total"])
+	if batches := b.delta("producer/batches_total", m["batches_total"]); batches > 0 {
+		b.batchSize.Record(ctx, records/batches)
+	}
+
+	if pending, ok := toFloat64(m["spill_pending_messages"]); ok {
+		b.spillPending.Record(ctx, int64(pending))
+	}
+}
+
+// collectConsumer 将消费者指标写入 OTel
+func (b *kafkaBridge) collectConsumer(ctx context.Context, groupID string, m map[string]interface{}) {
+	prefix := "consumer/" + groupID + "/"
+	group := attribute.String("group", groupID)
+
+	processed := b.delta(prefix+"processed_messages", m["processed_messages"])
+	failed := b.delta(prefix+"failed_messages", m["failed_messages"])
+
+	b.consumerMessages.Add(ctx, int64(processed), metric.WithAttributes(group, attribute.String("result", "processed")))
+	b.consumerMessages.Add(ctx, int64(failed), metric.WithAttributes(group, attribute.String("result", "failed")))
+	b.errors.Add(ctx, int64(failed), metric.WithAttributes(attribute.String("role", "consumer"), group))
+
+	durationMs := b.delta(prefix+"handler_duration_ms_total", m["handler_duration_ms_total"])
+	if handled := processed + failed; handled > 0 {
+		b.handlerDuration.Record(ctx, durationMs/handled/1000, metric.WithAttributes(group))
+	}
+
+	if lag, ok := toFloat64(m["consume_lag"]); ok {
+		b.consumerLag.Record(ctx, int64(lag), metric.WithAttributes(group))
+	}
+	if ageMs, ok := toFloat64(m["backlog_age_ms"]); ok {
+		b.backlogAge.Record(ctx, ageMs/1000, metric.WithAttributes(group))
+	}
+}
+
+// delta 返回累计值相对上一次采集的增量。
+// 累计值变小（如消费者被重建）时视为重新计数，直接返回当前值。
+func (b *kafkaBridge) delta(key string, value interface{}) float64 {
+	current, ok := toFloat64(value)
+	if !ok {
+		return 0
+	}
+
+	last, seen := b.last[key]
+	b.last[key] = current
+	if !seen || current < last {
+		return current
+	}
+	return current - last
+}
+
+// Probe 通过拉取集群元数据探测 Kafka，用于 metrics.Prober
+func Probe(name string, provider kafka.Provider) metrics.Probe {
+	return metrics.Probe{Name: name, Kind: "kafka", Check: provider.Ping}
+}
+
+// toFloat64 将 GetMetrics() 中的数值转换为 float64
+func toFloat64(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float64:
+		return v, true
+	default:
+		return 0, false
+	}
+}
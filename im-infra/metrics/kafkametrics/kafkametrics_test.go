@@ -0,0 +1,176 @@
+package kafkametrics
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+var (
+	// testReader 采集所有测试写入全局 MeterProvider 的指标
+	testReader *sdkmetric.ManualReader
+
+	testSeq atomic.Int64
+)
+
+// TestMain 在任何仪表创建之前安装可检查的全局 MeterProvider
+func TestMain(m *testing.M) {
+	testReader = sdkmetric.NewManualReader()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(testReader)))
+	os.Exit(m.Run())
+}
+
+// uniqueLabel 返回进程内唯一的标签值，使 -count 多次运行的测试互不影响
+func uniqueLabel(prefix string) string {
+	return fmt.Sprintf("%s_%d", prefix, testSeq.Add(1))
+}
+
+// collectMetric 采集一次并返回指定名称的指标数据，不存在时返回 nil
+func collectMetric(t *testing.T, name string) metricdata.Aggregation {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, testReader.Collect(context.Background(), &rm))
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name == name {
+				return m.Data
+			}
+		}
+	}
+	return nil
+}
+
+// hasAttributes 判断标签集合是否包含 attrs 中的所有键值
+func hasAttributes(set attribute.Set, attrs []attribute.KeyValue) bool {
+	for _, kv := range attrs {
+		if v, ok := set.Value(kv.Key); !ok || v != kv.Value {
+			return false
+		}
+	}
+	return true
+}
+
+// counterValue 返回计数器中标签包含 attrs 的所有数据点之和
+func counterValue(t *testing.T, name string, attrs ...attribute.KeyValue) int64 {
+	t.Helper()
+	sum, _ := collectMetric(t, name).(metricdata.Sum[int64])
+	var total int64
+	for _, dp := range sum.DataPoints {
+		if hasAttributes(dp.Attributes, attrs) {
+			total += dp.Value
+		}
+	}
+	return total
+}
+
+// gaugeValue 返回 gauge 中标签包含 attrs 的第一个数据点
+func gaugeValue[N int64 | float64](t *testing.T, name string, attrs ...attribute.KeyValue) (N, bool) {
+	t.Helper()
+	gauge, _ := collectMetric(t, name).(metricdata.Gauge[N])
+	for _, dp := range gauge.DataPoints {
+		if hasAttributes(dp.Attributes, attrs) {
+			return dp.Value, true
+		}
+	}
+	return 0, false
+}
+
+func TestInstrument(t *testing.T) {
+	_, err := Instrument(nil)
+	assert.Error(t, err)
+}
+
+func TestKafkaBridge(t *testing.T) {
+	ctx := context.Background()
+	b, err := newKafkaBridge(nil)
+	require.NoError(t, err)
+
+	success := attribute.String("result", "success")
+	failed := attribute.String("result", "failed")
+	producedBefore := counterValue(t, "kafka_producer_messages_total", success)
+	failedBefore := counterValue(t, "kafka_producer_messages_total", failed)
+	bytesBefore := counterValue(t, "kafka_producer_bytes_total")
+
+	// 累计值按增量写入计数器，延迟按周期平均值写入 gauge
+	b.collectProducer(ctx, map[string]interface{}{
+		"success_messages":       int64(10),
+		"failed_messages":        int64(2),
+		"total_bytes":            int64(1024),
+		"send_latency_ms_total":  int64(50),
+		"send_latency_count":     int64(10),
+		"batch_records_total":    int64(12),
+		"batches_total":          int64(3),
+		"spill_pending_messages": int64(7),
+	})
+	b.collectProducer(ctx, map[string]interface{}{
+		"success_messages":      int64(15),
+		"failed_messages":       int64(2),
+		"total_bytes":           int64(1536),
+		"send_latency_ms_total": int64(50),
+		"send_latency_count":    int64(10),
+	})
+	assert.Equal(t, int64(15), counterValue(t, "kafka_producer_messages_total", success)-producedBefore)
+	assert.Equal(t, int64(2), counterValue(t, "kafka_producer_messages_total", failed)-failedBefore)
+	assert.Equal(t, int64(1536), counterValue(t, "kafka_producer_bytes_total")-bytesBefore)
+	pending, ok := gaugeValue[int64](t, "kafka_producer_spill_pending")
+	assert.True(t, ok)
+	assert.Equal(t, int64(7), pending)
+
+	// 同一周期内没有新的发送时保留上一周期的平均值
+	latency, ok := gaugeValue[float64](t, "kafka_producer_send_latency_avg_seconds")
+	assert.True(t, ok)
+	assert.InDelta(t, 0.005, latency, 1e-9)
+	batch, ok := gaugeValue[float64](t, "kafka_producer_batch_size_avg")
+	assert.True(t, ok)
+	assert.InDelta(t, 4.0, batch, 1e-9)
+
+	groupID := uniqueLabel("bridge_test")
+	group := attribute.String("group", groupID)
+	b.collectConsumer(ctx, groupID, map[string]interface{}{
+		"processed_messages":        int64(8),
+		"failed_messages":           int64(2),
+		"handler_duration_ms_total": int64(200),
+		"consume_lag":               int64(42),
+		"backlog_age_ms":            int64(1500),
+	})
+	// 消费者重建后累计值变小，视为重新计数
+	b.collectConsumer(ctx, groupID, map[string]interface{}{
+		"processed_messages": int64(3),
+		"failed_messages":    int64(2),
+	})
+	assert.Equal(t, int64(11), counterValue(t, "kafka_consumer_messages_total", group, attribute.String("result", "processed")))
+	assert.Equal(t, int64(2), counterValue(t, "kafka_consumer_messages_total", group, failed))
+	assert.Equal(t, int64(2), counterValue(t, "kafka_errors_total", group, attribute.String("role", "consumer")))
+
+	// 第二个周期没有处理耗时增量，平均值为 0
+	duration, ok := gaugeValue[float64](t, "kafka_consumer_handler_duration_avg_seconds", group)
+	assert.True(t, ok)
+	assert.Zero(t, duration)
+	lag, ok := gaugeValue[int64](t, "kafka_consumer_lag", group)
+	assert.True(t, ok)
+	assert.Equal(t, int64(42), lag)
+	age, ok := gaugeValue[float64](t, "kafka_consumer_backlog_age_seconds", group)
+	assert.True(t, ok)
+	assert.Equal(t, 1.5, age)
+}
+
+func TestToFloat64(t *testing.T) {
+	for _, v := range []interface{}{int(3), int32(3), int64(3), uint64(3), float64(3)} {
+		f, ok := toFloat64(v)
+		assert.True(t, ok)
+		assert.Equal(t, 3.0, f)
+	}
+	_, ok := toFloat64("3")
+	assert.False(t, ok)
+	_, ok = toFloat64(nil)
+	assert.False(t, ok)
+}
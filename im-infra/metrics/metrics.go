@@ -39,6 +39,7 @@
 // # 可观测性数据
 //
 // 本包会自动收集以下数据：
+//   - 服务构建信息（service_info）和运行时长（service_uptime_seconds）
 //   - 请求计数和延迟分布
 //   - 错误率和状态码分布
 //   - 分布式链路追踪信息
@@ -49,6 +50,7 @@ package metrics
 
 import (
 	"context"
+	"net/http"
 
 	"github.com/ceyewan/gochat/im-infra/clog"
 	"github.com/ceyewan/gochat/im-infra/metrics/internal"
@@ -65,6 +67,52 @@ var (
 	helperLogger  = clog.Namespace("metrics.helper")
 )
 
+// 构建信息，可在编译时通过 -ldflags 注入，用于 service_info 指标：
+//
+//	go build -ldflags "\
+//	    -X github.com/ceyewan/gochat/im-infra/metrics.Version=v1.4.2 \
+//	    -X github.com/ceyewan/gochat/im-infra/metrics.GitCommit=$(git rev-parse HEAD) \
+//	    -X github.com/ceyewan/gochat/im-infra/metrics.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// 未注入时会尝试从 Go 模块的 vcs 信息中读取。
+var (
+	Version   string
+	GitCommit string
+	BuildTime string
+)
+
+// BuildInfo 描述了服务的构建信息。
+type BuildInfo = internal.BuildInfo
+
+// SetBuildInfo 显式设置服务的构建信息，优先级高于 -ldflags 注入的值。
+//
+// 设置后 service_info 指标会在下一次采集时反映新的值，
+// 便于在仪表盘中将延迟变化与具体的部署版本关联起来。
+//
+// 示例：
+//
+//	metrics.SetBuildInfo(metrics.BuildInfo{
+//	    Version:   "v1.4.2",
+//	    GitCommit: "9f3c2ab",
+//	})
+func SetBuildInfo(info BuildInfo) {
+	internal.SetBuildInfo(info)
+}
+
+// WithMeta 将一个请求元数据字段（如 tenant_id、client_platform）写入上下文。
+// 等价于 ctxmeta.With，通过 ctxmeta.WithTenant 等写入的字段同样可以在这里读取。
+//
+// 字段在 Config.ContextAttributes 白名单中时，拦截器和 Operation 会自动将其附加为
+// span 属性或指标标签，gRPC 客户端拦截器还会通过 metadata 传递给下游服务。
+func WithMeta(ctx context.Context, key, value string) context.Context {
+	return internal.WithMeta(ctx, key, value)
+}
+
+// MetaFromContext 返回上下文中的请求元数据字段。
+func MetaFromContext(ctx context.Context, key string) (string, bool) {
+	return internal.MetaFromContext(ctx, key)
+}
+
 // Provider 定义了 metrics 和 tracing 系统的核心接口。
 //
 // 它是与本库交互的唯一入口，提供了：
@@ -87,6 +135,20 @@ type Provider interface {
 	// 自动为所有 HTTP 请求添加 tracing 和 metrics 收集。
 	HTTPMiddleware() gin.HandlerFunc
 
+	// Operation 返回命名业务操作的 RED 指标辅助对象。
+	// 通过 Start()/Finish(err) 统一记录请求数、错误数和耗时，例如 provider.Operation("send_message")。
+	Operation(name string, attrs ...attribute.KeyValue) *Operation
+
+	// RecordEvent 记录一个部署、配置变更或故障等服务事件，如 provider.RecordEvent(ctx, metrics.EventDeployment, ...)。
+	// 事件会作为 span 事件导出，并计入 service_events_total 和 service_event_timestamp_seconds 指标；
+	// 配置了 Config.Annotations 时同时写入 Grafana 注解，仅在注解写入失败时返回错误。
+	RecordEvent(ctx context.Context, name string, attrs ...attribute.KeyValue) error
+
+	// MetricsHandler 返回提供 Prometheus 格式指标的 handler，配置了 PrometheusAuth 时带鉴权。
+	// 用于将 /metrics 挂载到已有的 HTTP 服务器上（配合 PrometheusHandlerOnly）；
+	// 未配置 PrometheusListenAddr 且未开启 PrometheusHandlerOnly 时返回 nil。
+	MetricsHandler() http.Handler
+
 	// Shutdown 优雅关闭所有 metrics 相关服务。
 	// 应在应用程序退出时调用，确保所有数据都被正确导出。
 	Shutdown(ctx context.Context) error
@@ -97,6 +159,7 @@ type Provider interface {
 type provider struct {
 	internalProvider *internal.Provider
 	serviceName      string // 缓存服务名称，用于日志记录
+	events           *eventRecorder
 }
 
 // New 创建一个新的 metrics 和 tracing provider 实例。
@@ -123,13 +186,22 @@ func New(cfg *Config) (Provider, error) {
 
 	// 将公共配置转换为内部配置
 	internalCfg := &internal.Config{
-		ServiceName:          cfg.ServiceName,
-		ExporterType:         cfg.ExporterType,
-		ExporterEndpoint:     cfg.ExporterEndpoint,
-		PrometheusListenAddr: cfg.PrometheusListenAddr,
-		SamplerType:          cfg.SamplerType,
-		SamplerRatio:         cfg.SamplerRatio,
-		SlowRequestThreshold: cfg.SlowRequestThreshold,
+		ServiceName:           cfg.ServiceName,
+		ExporterType:          cfg.ExporterType,
+		ExporterEndpoint:      cfg.ExporterEndpoint,
+		PrometheusListenAddr:  cfg.PrometheusListenAddr,
+		PrometheusHandlerOnly: cfg.PrometheusHandlerOnly,
+		PrometheusAuth:        cfg.PrometheusAuth,
+		PrometheusTLS:         cfg.PrometheusTLS,
+		SamplerType:           cfg.SamplerType,
+		SamplerRatio:          cfg.SamplerRatio,
+		SlowRequestThreshold:  cfg.SlowRequestThreshold,
+		ContextAttributes:     cfg.ContextAttributes,
+		BuildInfo: internal.BuildInfo{
+			Version:   Version,
+			GitCommit: GitCommit,
+			BuildTime: BuildTime,
+		},
 	}
 
 	// 创建内部 provider
@@ -141,12 +213,22 @@ func New(cfg *Config) (Provider, error) {
 		return nil, err
 	}
 
+	events, err := newEventRecorder(cfg.ServiceName, cfg.Annotations)
+	if err != nil {
+		metricsLogger.Error("failed to create event recorder",
+			clog.String("service_name", cfg.ServiceName),
+			clog.Err(err))
+		_ = p.Shutdown(context.Background())
+		return nil, err
+	}
+
 	metricsLogger.Info("metrics provider 创建成功",
 		clog.String("service_name", cfg.ServiceName))
 
 	return &provider{
 		internalProvider: p,
 		serviceName:      cfg.ServiceName,
+		events:           events,
 	}, nil
 }
 
@@ -164,6 +246,11 @@ func (p *provider) GRPCClientInterceptor() grpc.UnaryClientInterceptor {
 	return p.internalProvider.GRPCClientInterceptor()
 }
 
+// MetricsHandler 返回 /metrics 的 handler。
+func (p *provider) MetricsHandler() http.Handler {
+	return p.internalProvider.MetricsHandler()
+}
+
 // HTTPMiddleware 返回 Gin HTTP 中间件。
 func (p *provider) HTTPMiddleware() gin.HandlerFunc {
 	metricsLogger.Debug("获取 HTTP 中间件",
@@ -171,6 +258,23 @@ func (p *provider) HTTPMiddleware() gin.HandlerFunc {
 	return p.internalProvider.HTTPMiddleware()
 }
 
+// Operation 返回命名业务操作的 RED 指标辅助对象。
+func (p *provider) Operation(name string, attrs ...attribute.KeyValue) *Operation {
+	return NewOperation(name, attrs...)
+}
+
+// RecordEvent 记录一个服务事件。
+//
+// 示例：
+//
+//	// 服务启动时标记一次部署
+//	_ = provider.RecordEvent(ctx, metrics.EventDeployment,
+//	    attribute.String("version", metrics.Version),
+//	    attribute.String("commit", metrics.GitCommit))
+func (p *provider) RecordEvent(ctx context.Context, name string, attrs ...attribute.KeyValue) error {
+	return p.events.record(ctx, name, attrs...)
+}
+
 // Shutdown 优雅关闭 metrics provider。
 //
 // 该方法会依次关闭：
@@ -244,6 +348,7 @@ func NewCounter(name, description string) (*Counter, error) {
 		return nil, err
 	}
 
+	registerInstrument(name, internal.InstrumentCounter, "", description)
 	helperLogger.Info("计数器指标创建成功",
 		clog.String("name", name))
 
@@ -341,6 +446,7 @@ func NewHistogram(name, description, unit string) (*Histogram, error) {
 		return nil, err
 	}
 
+	registerInstrument(name, internal.InstrumentHistogram, unit, description)
 	helperLogger.Info("直方图指标创建成功",
 		clog.String("name", name))
 
@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var (
+	// testReader 采集所有测试写入全局 MeterProvider 的指标
+	testReader *sdkmetric.ManualReader
+	// testSpans 记录所有测试写入全局 TracerProvider 的 span
+	testSpans *tracetest.SpanRecorder
+
+	testSeq atomic.Int64
+)
+
+// TestMain 在任何仪表创建之前安装可检查的全局 provider。
+// 指标按累计值导出且在测试之间共享，各测试使用不同的标签值互相隔离。
+func TestMain(m *testing.M) {
+	testReader = sdkmetric.NewManualReader()
+	testSpans = tracetest.NewSpanRecorder()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(testReader)))
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(testSpans)))
+	os.Exit(m.Run())
+}
+
+// uniqueLabel 返回进程内唯一的标签值，使 -count 多次运行的测试互不影响
+func uniqueLabel(prefix string) string {
+	return fmt.Sprintf("%s_%d", prefix, testSeq.Add(1))
+}
+
+// collectMetric 采集一次并返回指定名称的指标数据，不存在时返回 nil
+func collectMetric(t *testing.T, name string) metricdata.Aggregation {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, testReader.Collect(context.Background(), &rm))
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name == name {
+				return m.Data
+			}
+		}
+	}
+	return nil
+}
+
+// hasAttributes 判断标签集合是否包含 attrs 中的所有键值
+func hasAttributes(set attribute.Set, attrs []attribute.KeyValue) bool {
+	for _, kv := range attrs {
+		if v, ok := set.Value(kv.Key); !ok || v != kv.Value {
+			return false
+		}
+	}
+	return true
+}
+
+// counterValue 返回计数器中标签包含 attrs 的所有数据点之和
+func counterValue(t *testing.T, name string, attrs ...attribute.KeyValue) int64 {
+	t.Helper()
+	sum, _ := collectMetric(t, name).(metricdata.Sum[int64])
+	var total int64
+	for _, dp := range sum.DataPoints {
+		if hasAttributes(dp.Attributes, attrs) {
+			total += dp.Value
+		}
+	}
+	return total
+}
+
+// histogramPoints 返回直方图中标签包含 attrs 的数据点
+func histogramPoints(t *testing.T, name string, attrs ...attribute.KeyValue) []metricdata.HistogramDataPoint[float64] {
+	t.Helper()
+	histogram, _ := collectMetric(t, name).(metricdata.Histogram[float64])
+	var points []metricdata.HistogramDataPoint[float64]
+	for _, dp := range histogram.DataPoints {
+		if hasAttributes(dp.Attributes, attrs) {
+			points = append(points, dp)
+		}
+	}
+	return points
+}
+
+// histogramTotal 返回直方图中标签包含 attrs 的所有数据点的观测次数和总和
+func histogramTotal(t *testing.T, name string, attrs ...attribute.KeyValue) (uint64, float64) {
+	t.Helper()
+	var count uint64
+	var sum float64
+	for _, dp := range histogramPoints(t, name, attrs...) {
+		count += dp.Count
+		sum += dp.Sum
+	}
+	return count, sum
+}
+
+// gaugeValue 返回 gauge 中标签包含 attrs 的第一个数据点
+func gaugeValue[N int64 | float64](t *testing.T, name string, attrs ...attribute.KeyValue) (N, bool) {
+	t.Helper()
+	gauge, _ := collectMetric(t, name).(metricdata.Gauge[N])
+	for _, dp := range gauge.DataPoints {
+		if hasAttributes(dp.Attributes, attrs) {
+			return dp.Value, true
+		}
+	}
+	return 0, false
+}
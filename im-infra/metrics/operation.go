@@ -0,0 +1,169 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/ceyewan/gochat/im-infra/metrics/internal"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// 业务操作 RED 指标的名称，所有操作共享同一组仪表，通过 operation 标签区分
+const (
+	operationRequestsMetric = "operation.requests.count"
+	operationErrorsMetric   = "operation.errors.count"
+	operationDurationMetric = "operation.duration"
+)
+
+// 业务操作指标的标签
+const (
+	operationLabel = "operation"
+	statusLabel    = "status"
+
+	statusOK    = "ok"
+	statusError = "error"
+)
+
+var (
+	operationInstrumentsOnce sync.Once
+	operationRequests        metric.Int64Counter
+	operationErrors          metric.Int64Counter
+	operationDuration        metric.Float64Histogram
+)
+
+// initOperationInstruments 延迟创建业务操作共享的仪表，创建失败时对应仪表保持 nil 并跳过记录
+func initOperationInstruments() {
+	operationInstrumentsOnce.Do(func() {
+		meter := otel.Meter(internal.InstrumentationName)
+
+		var err error
+		operationRequests, err = meter.Int64Counter(
+			operationRequestsMetric,
+			metric.WithDescription("Number of business operations completed."))
+		if err != nil {
+			helperLogger.Error("failed to create operation requests counter", clog.Err(err))
+		} else {
+			registerInstrument(operationRequestsMetric, internal.InstrumentCounter, "", "Number of business operations completed.")
+		}
+
+		operationErrors, err = meter.Int64Counter(
+			operationErrorsMetric,
+			metric.WithDescription("Number of business operations that returned an error."))
+		if err != nil {
+			helperLogger.Error("failed to create operation errors counter", clog.Err(err))
+		} else {
+			registerInstrument(operationErrorsMetric, internal.InstrumentCounter, "", "Number of business operations that returned an error.")
+		}
+
+		operationDuration, err = meter.Float64Histogram(
+			operationDurationMetric,
+			metric.WithDescription("Duration of business operations in seconds."),
+			metric.WithUnit("s"))
+		if err != nil {
+			helperLogger.Error("failed to create operation duration histogram", clog.Err(err))
+		} else {
+			registerInstrument(operationDurationMetric, internal.InstrumentHistogram, "s", "Duration of business operations in seconds.")
+		}
+	})
+}
+
+// Operation 是一个命名业务操作的 RED（Rate、Errors、Duration）指标辅助对象。
+//
+// 它替代了在每个业务处理函数中手动维护“计数器 + 直方图”的重复代码，
+// 保证所有操作使用一致的指标名称和标签：
+//   - operation.requests.count{operation, status}：完成的操作数，status 为 ok 或 error
+//   - operation.errors.count{operation}：返回错误的操作数
+//   - operation.duration{operation, status}：操作耗时（秒）
+//
+// Operation 是线程安全的，应在初始化时创建并复用。
+type Operation struct {
+	name  string
+	attrs []attribute.KeyValue
+}
+
+// NewOperation 创建一个命名业务操作的 RED 指标辅助对象。
+//
+// attrs 是该操作所有观测值共享的固定标签，例如服务模块名。
+// 通常通过 Provider.Operation 获取，在 Provider 之外使用时指标会写入全局 MeterProvider。
+func NewOperation(name string, attrs ...attribute.KeyValue) *Operation {
+	initOperationInstruments()
+	return &Operation{
+		name:  name,
+		attrs: append([]attribute.KeyValue{attribute.String(operationLabel, name)}, attrs...),
+	}
+}
+
+// Name 返回操作名称
+func (o *Operation) Name() string {
+	return o.name
+}
+
+// Start 开始一次操作并返回计时器，操作结束时必须调用 Finish。
+//
+// attrs 是本次观测额外附加的标签，应保持低基数（不要使用用户 ID 等）。
+// Config.ContextAttributes.LabelKeys 中的上下文元数据会自动附加为标签。
+//
+// 示例：
+//
+//	sendMessage := provider.Operation("send_message")
+//
+//	func handle(ctx context.Context) (err error) {
+//	    timer := sendMessage.Start(ctx)
+//	    defer func() { timer.Finish(err) }()
+//	    ...
+//	}
+func (o *Operation) Start(ctx context.Context, attrs ...attribute.KeyValue) *OperationTimer {
+	meta := internal.MetaLabelAttributes(ctx)
+	all := o.attrs
+	if len(attrs)+len(meta) > 0 {
+		all = make([]attribute.KeyValue, 0, len(o.attrs)+len(attrs)+len(meta))
+		all = append(append(append(all, o.attrs...), attrs...), meta...)
+	}
+	return &OperationTimer{
+		ctx:   ctx,
+		start: time.Now(),
+		attrs: all,
+	}
+}
+
+// OperationTimer 记录一次进行中的操作，由 Operation.Start 创建。
+type OperationTimer struct {
+	ctx      context.Context
+	start    time.Time
+	attrs    []attribute.KeyValue
+	finished atomic.Bool
+}
+
+// Finish 结束操作并记录请求数、错误数和耗时，err 非 nil 时操作被计为失败。
+// 重复调用只有第一次生效，返回本次操作的耗时。
+func (t *OperationTimer) Finish(err error) time.Duration {
+	elapsed := time.Since(t.start)
+	if !t.finished.CompareAndSwap(false, true) {
+		return elapsed
+	}
+
+	status := statusOK
+	if err != nil {
+		status = statusError
+	}
+	// 复制一份标签，避免与 Operation 共享的底层数组在并发 append 时被覆盖
+	statusAttrs := make([]attribute.KeyValue, 0, len(t.attrs)+1)
+	statusAttrs = append(append(statusAttrs, t.attrs...), attribute.String(statusLabel, status))
+	withStatus := metric.WithAttributes(statusAttrs...)
+
+	if operationRequests != nil {
+		operationRequests.Add(t.ctx, 1, withStatus)
+	}
+	if err != nil && operationErrors != nil {
+		operationErrors.Add(t.ctx, 1, metric.WithAttributes(t.attrs...))
+	}
+	if operationDuration != nil {
+		operationDuration.Record(t.ctx, elapsed.Seconds(), withStatus)
+	}
+	return elapsed
+}
@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestOperation(t *testing.T) {
+	opName := uniqueLabel("operation_test")
+	op := NewOperation(opName, attribute.String("module", "chat"))
+	assert.Equal(t, opName, op.Name())
+	name := attribute.String(operationLabel, opName)
+
+	ctx := context.Background()
+	op.Start(ctx).Finish(nil)
+	op.Start(ctx, attribute.String("type", "text")).Finish(nil)
+
+	// 重复调用 Finish 只有第一次生效
+	timer := op.Start(ctx)
+	timer.Finish(errors.New("boom"))
+	timer.Finish(nil)
+
+	assert.Equal(t, int64(2), counterValue(t, operationRequestsMetric, name, attribute.String(statusLabel, statusOK)))
+	assert.Equal(t, int64(1), counterValue(t, operationRequestsMetric, name, attribute.String(statusLabel, statusError)))
+	assert.Equal(t, int64(1), counterValue(t, operationRequestsMetric, name, attribute.String("type", "text")))
+	assert.Equal(t, int64(1), counterValue(t, operationErrorsMetric, name, attribute.String("module", "chat")))
+
+	var observations uint64
+	for _, dp := range histogramPoints(t, operationDurationMetric, name) {
+		observations += dp.Count
+		assert.True(t, dp.Attributes.HasValue(statusLabel))
+	}
+	assert.Equal(t, uint64(3), observations)
+
+	// 操作声明的仪表会生成对应的告警规则
+	declared := make(map[string]bool)
+	for _, inst := range Instruments() {
+		declared[inst.Name] = true
+	}
+	assert.True(t, declared[operationRequestsMetric])
+	assert.True(t, declared[operationDurationMetric])
+}
+
+func TestOperationConcurrent(t *testing.T) {
+	opName := uniqueLabel("operation_concurrent_test")
+	op := NewOperation(opName, attribute.String("module", "chat"))
+	name := attribute.String(operationLabel, opName)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// 每次观测附加不同的标签，共享的固定标签不能被覆盖
+			op.Start(context.Background(), attribute.Int("shard", i%5)).Finish(nil)
+		}(i)
+	}
+	wg.Wait()
+
+	require.Equal(t, int64(50), counterValue(t, operationRequestsMetric, name, attribute.String("module", "chat")))
+	assert.Equal(t, int64(10), counterValue(t, operationRequestsMetric, name, attribute.Int("shard", 3)))
+}
@@ -0,0 +1,337 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/ceyewan/gochat/im-infra/metrics/internal"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// 消息投递链路的标准阶段
+const (
+	StageGatewayReceived = "gateway_received" // 网关收到客户端消息
+	StageProduced        = "produced"         // 写入 Kafka 成功
+	StageConsumed        = "consumed"         // 从 Kafka 消费到消息
+	StagePersisted       = "persisted"        // 落库完成
+	StagePushed          = "pushed"           // 推送给接收方
+)
+
+// PipelineHeader 是携带阶段时间戳的 Kafka 消息头或 gRPC metadata 键
+const PipelineHeader = "X-Pipeline-Stamps"
+
+// DefaultPipelineStages 是消息投递链路的默认阶段顺序
+var DefaultPipelineStages = []string{
+	StageGatewayReceived,
+	StageProduced,
+	StageConsumed,
+	StagePersisted,
+	StagePushed,
+}
+
+// 阶段耗时指标的名称和标签
+const (
+	pipelineLatencyMetric   = "pipeline.stage.latency"
+	pipelineClockSkewMetric = "pipeline.clock_skew.count"
+
+	pipelineLabel  = "pipeline"
+	fromStageLabel = "from"
+	toStageLabel   = "to"
+)
+
+// pipelineLatencyBuckets 阶段耗时的分桶边界（秒），从 1ms 到 60s 近似指数分布，
+// 既能区分进程内的毫秒级阶段，也能覆盖消费积压时的秒级延迟，适合绘制热力图
+var pipelineLatencyBuckets = []float64{
+	0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60,
+}
+
+var (
+	pipelineInstrumentsOnce sync.Once
+	pipelineLatency         metric.Float64Histogram
+	pipelineClockSkew       metric.Int64Counter
+)
+
+// initPipelineInstruments 延迟创建所有 Pipeline 共享的仪表，创建失败时对应仪表保持 nil 并跳过记录
+func initPipelineInstruments() {
+	pipelineInstrumentsOnce.Do(func() {
+		meter := otel.Meter(internal.InstrumentationName)
+
+		var err error
+		pipelineLatency, err = meter.Float64Histogram(
+			pipelineLatencyMetric,
+			metric.WithDescription("Latency between two stages of a message pipeline in seconds."),
+			metric.WithUnit("s"),
+			metric.WithExplicitBucketBoundaries(pipelineLatencyBuckets...))
+		if err != nil {
+			helperLogger.Error("failed to create pipeline latency histogram", clog.Err(err))
+		} else {
+			registerInstrument(pipelineLatencyMetric, internal.InstrumentHistogram, "s", "Latency between two stages of a message pipeline in seconds.")
+		}
+
+		pipelineClockSkew, err = meter.Int64Counter(
+			pipelineClockSkewMetric,
+			metric.WithDescription("Number of stage pairs skipped because the later stage was stamped before the earlier one."))
+		if err != nil {
+			helperLogger.Error("failed to create pipeline clock skew counter", clog.Err(err))
+		} else {
+			registerInstrument(pipelineClockSkewMetric, internal.InstrumentCounter, "", "Number of stage pairs skipped because the later stage was stamped before the earlier one.")
+		}
+	})
+}
+
+// PipelineStamps 记录一条消息到达各阶段的时间。
+//
+// 消息跨服务传递时，通过 Encode 写入消息头（PipelineHeader），
+// 下游服务用 DecodePipelineStamps 取出后继续调用 Pipeline.Mark。
+type PipelineStamps map[string]time.Time
+
+// Encode 将时间戳编码为 "stage=unix微秒" 以逗号分隔的字符串，按时间先后排列
+func (s PipelineStamps) Encode() string {
+	stages := make([]string, 0, len(s))
+	for stage := range s {
+		stages = append(stages, stage)
+	}
+	sort.Slice(stages, func(i, j int) bool { return s[stages[i]].Before(s[stages[j]]) })
+
+	var b strings.Builder
+	for i, stage := range stages {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(stage)
+		b.WriteByte('=')
+		b.WriteString(strconv.FormatInt(s[stage].UnixMicro(), 10))
+	}
+	return b.String()
+}
+
+// DecodePipelineStamps 解析 Encode 的结果，空字符串返回空的 PipelineStamps
+func DecodePipelineStamps(value string) (PipelineStamps, error) {
+	stamps := make(PipelineStamps)
+	if value == "" {
+		return stamps, nil
+	}
+	for _, part := range strings.Split(value, ",") {
+		stage, ts, ok := strings.Cut(part, "=")
+		if !ok || stage == "" {
+			return nil, fmt.Errorf("invalid pipeline stamp: %q", part)
+		}
+		micros, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pipeline stamp %q: %w", part, err)
+		}
+		stamps[stage] = time.UnixMicro(micros)
+	}
+	return stamps, nil
+}
+
+// Pipeline 记录消息在多个有序阶段之间的耗时，用于定位端到端投递延迟消耗在哪一段。
+//
+// 每次 Mark 会记录两类阶段对的耗时，写入 pipeline.stage.latency{pipeline, from, to} 直方图：
+//   - 相邻阶段：本阶段与之前最近一个已记录阶段之间的耗时，如 produced → consumed
+//   - 端到端：本阶段与第一个已记录阶段之间的耗时，如 gateway_received → pushed
+//
+// 跨主机的阶段依赖各主机的时钟同步，后一阶段早于前一阶段时不记录耗时，
+// 而是计入 pipeline.clock_skew.count。
+//
+// 除了 OpenTelemetry 指标，Pipeline 还在进程内按相同分桶累计计数，
+// 通过 Snapshot 或作为 http.Handler 导出，便于在没有 Prometheus 的环境中绘制热力图。
+//
+// Pipeline 是线程安全的，应在初始化时创建并复用。
+type Pipeline struct {
+	name   string
+	stages []string
+	order  map[string]int
+
+	mu    sync.Mutex
+	pairs map[stagePair]*stageLatency
+}
+
+type stagePair struct {
+	from, to string
+}
+
+// stageLatency 是一个阶段对在进程内的累计分布
+type stageLatency struct {
+	counts []uint64 // 与 pipelineLatencyBuckets 对应，最后一个为 +Inf
+	count  uint64
+	sum    float64
+}
+
+// NewPipeline 创建一个按 stages 顺序排列的消息链路，stages 为空时使用 DefaultPipelineStages。
+//
+// 示例：
+//
+//	delivery := metrics.NewPipeline("message_delivery")
+//
+//	// im-gateway：收到客户端消息
+//	stamps := delivery.Mark(ctx, nil, metrics.StageGatewayReceived)
+//	msg.Headers[metrics.PipelineHeader] = []byte(stamps.Encode())
+//
+//	// im-logic：消费到消息
+//	stamps, _ := metrics.DecodePipelineStamps(string(msg.Headers[metrics.PipelineHeader]))
+//	delivery.Mark(ctx, stamps, metrics.StageConsumed)
+func NewPipeline(name string, stages ...string) *Pipeline {
+	initPipelineInstruments()
+	if len(stages) == 0 {
+		stages = DefaultPipelineStages
+	}
+	order := make(map[string]int, len(stages))
+	for i, stage := range stages {
+		order[stage] = i
+	}
+	return &Pipeline{
+		name:   name,
+		stages: append([]string(nil), stages...),
+		order:  order,
+		pairs:  make(map[stagePair]*stageLatency),
+	}
+}
+
+// Name 返回链路名称
+func (p *Pipeline) Name() string {
+	return p.name
+}
+
+// Mark 记录消息在当前时间到达 stage，返回更新后的时间戳（stamps 为 nil 时新建）。
+func (p *Pipeline) Mark(ctx context.Context, stamps PipelineStamps, stage string) PipelineStamps {
+	return p.MarkAt(ctx, stamps, stage, time.Now())
+}
+
+// MarkAt 记录消息在 at 时刻到达 stage，适用于阶段时间来自外部（如 Kafka 记录的时间戳）的场景。
+// 未在 NewPipeline 中声明的阶段会被忽略，避免错误的阶段名产生新的时间序列。
+func (p *Pipeline) MarkAt(ctx context.Context, stamps PipelineStamps, stage string, at time.Time) PipelineStamps {
+	if stamps == nil {
+		stamps = make(PipelineStamps)
+	}
+	idx, ok := p.order[stage]
+	if !ok {
+		helperLogger.Warn("忽略未声明的链路阶段",
+			clog.String("pipeline", p.name),
+			clog.String("stage", stage))
+		return stamps
+	}
+	stamps[stage] = at
+
+	// 顺序上最近的前一阶段和第一个已记录的阶段
+	prev, first := "", ""
+	for i := idx - 1; i >= 0; i-- {
+		if _, ok := stamps[p.stages[i]]; ok {
+			if prev == "" {
+				prev = p.stages[i]
+			}
+			first = p.stages[i]
+		}
+	}
+	if prev != "" {
+		p.observe(ctx, prev, stage, at.Sub(stamps[prev]))
+	}
+	if first != "" && first != prev {
+		p.observe(ctx, first, stage, at.Sub(stamps[first]))
+	}
+	return stamps
+}
+
+// observe 记录一个阶段对的耗时
+func (p *Pipeline) observe(ctx context.Context, from, to string, latency time.Duration) {
+	attrs := metric.WithAttributes(
+		attribute.String(pipelineLabel, p.name),
+		attribute.String(fromStageLabel, from),
+		attribute.String(toStageLabel, to))
+
+	if latency < 0 {
+		if pipelineClockSkew != nil {
+			pipelineClockSkew.Add(ctx, 1, attrs)
+		}
+		helperLogger.Debug("阶段时间早于前一阶段，可能存在时钟偏差",
+			clog.String("pipeline", p.name),
+			clog.String("from", from),
+			clog.String("to", to),
+			clog.Duration("latency", latency))
+		return
+	}
+
+	seconds := latency.Seconds()
+	if pipelineLatency != nil {
+		pipelineLatency.Record(ctx, seconds, attrs)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pair := stagePair{from: from, to: to}
+	l, ok := p.pairs[pair]
+	if !ok {
+		l = &stageLatency{counts: make([]uint64, len(pipelineLatencyBuckets)+1)}
+		p.pairs[pair] = l
+	}
+	l.counts[sort.SearchFloat64s(pipelineLatencyBuckets, seconds)]++
+	l.count++
+	l.sum += seconds
+}
+
+// StageLatency 是一个阶段对自进程启动以来的耗时分布，Counts[i] 为落在 (Buckets[i-1], Buckets[i]] 中的次数，
+// 最后一个元素为超过最大边界的次数。按阶段对排列即为热力图的一行。
+type StageLatency struct {
+	From    string    `json:"from"`
+	To      string    `json:"to"`
+	Buckets []float64 `json:"buckets"`
+	Counts  []uint64  `json:"counts"`
+	Count   uint64    `json:"count"`
+	Sum     float64   `json:"sum"`
+}
+
+// Snapshot 返回所有阶段对的耗时分布，按起始阶段、结束阶段的顺序排列
+func (p *Pipeline) Snapshot() []StageLatency {
+	p.mu.Lock()
+	result := make([]StageLatency, 0, len(p.pairs))
+	for pair, l := range p.pairs {
+		result = append(result, StageLatency{
+			From:    pair.from,
+			To:      pair.to,
+			Buckets: pipelineLatencyBuckets,
+			Counts:  append([]uint64(nil), l.counts...),
+			Count:   l.count,
+			Sum:     l.sum,
+		})
+	}
+	p.mu.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if p.order[a.From] != p.order[b.From] {
+			return p.order[a.From] < p.order[b.From]
+		}
+		return p.order[a.To] < p.order[b.To]
+	})
+	return result
+}
+
+// ServeHTTP 以 JSON 导出 Snapshot，可挂载到诊断服务器或管理接口上。
+//
+// 示例：
+//
+//	mux.Handle("/debug/pipeline/delivery", delivery)
+func (p *Pipeline) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(struct {
+		Pipeline string         `json:"pipeline"`
+		Stages   []string       `json:"stages"`
+		Pairs    []StageLatency `json:"pairs"`
+	}{
+		Pipeline: p.name,
+		Stages:   p.stages,
+		Pairs:    p.Snapshot(),
+	}); err != nil {
+		helperLogger.Warn("导出链路耗时失败", clog.String("pipeline", p.name), clog.Err(err))
+	}
+}
@@ -0,0 +1,152 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestPipelineStampsEncoding(t *testing.T) {
+	base := time.UnixMicro(1700000000000000)
+	stamps := PipelineStamps{
+		StagePushed:          base.Add(30 * time.Millisecond),
+		StageGatewayReceived: base,
+		StageProduced:        base.Add(2 * time.Millisecond),
+	}
+
+	// 按时间先后排列，与 map 的遍历顺序无关
+	encoded := stamps.Encode()
+	assert.Equal(t, "gateway_received=1700000000000000,produced=1700000000002000,pushed=1700000000030000", encoded)
+
+	decoded, err := DecodePipelineStamps(encoded)
+	require.NoError(t, err)
+	require.Len(t, decoded, 3)
+	for stage, at := range stamps {
+		assert.True(t, at.Equal(decoded[stage]), stage)
+	}
+
+	empty, err := DecodePipelineStamps("")
+	require.NoError(t, err)
+	assert.NotNil(t, empty)
+	assert.Empty(t, empty)
+	assert.Equal(t, "", PipelineStamps{}.Encode())
+
+	for _, value := range []string{"produced", "=1700000000000000", "produced=abc", "produced=1,"} {
+		_, err := DecodePipelineStamps(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestPipelineMark(t *testing.T) {
+	ctx := context.Background()
+	p := NewPipeline(uniqueLabel("pipeline_test"))
+	assert.Equal(t, DefaultPipelineStages, p.stages)
+	name := attribute.String(pipelineLabel, p.Name())
+	pair := func(from, to string) []attribute.KeyValue {
+		return []attribute.KeyValue{name, attribute.String(fromStageLabel, from), attribute.String(toStageLabel, to)}
+	}
+
+	// 编码只保留微秒精度
+	base := time.Now().Truncate(time.Microsecond)
+	stamps := p.MarkAt(ctx, nil, StageGatewayReceived, base)
+	require.Len(t, stamps, 1)
+
+	// 跨服务传递后继续记录，跳过未记录的 consumed 阶段
+	stamps, err := DecodePipelineStamps(stamps.Encode())
+	require.NoError(t, err)
+	stamps = p.MarkAt(ctx, stamps, StageProduced, base.Add(2*time.Millisecond))
+	stamps = p.MarkAt(ctx, stamps, StagePersisted, base.Add(12*time.Millisecond))
+
+	// 相邻阶段和端到端各记录一次，produced 的前一阶段就是第一个阶段，只记录一次
+	count, sum := histogramTotal(t, pipelineLatencyMetric, pair(StageGatewayReceived, StageProduced)...)
+	assert.Equal(t, uint64(1), count)
+	assert.InDelta(t, 0.002, sum, 1e-9)
+	count, sum = histogramTotal(t, pipelineLatencyMetric, pair(StageProduced, StagePersisted)...)
+	assert.Equal(t, uint64(1), count)
+	assert.InDelta(t, 0.01, sum, 1e-9)
+	count, sum = histogramTotal(t, pipelineLatencyMetric, pair(StageGatewayReceived, StagePersisted)...)
+	assert.Equal(t, uint64(1), count)
+	assert.InDelta(t, 0.012, sum, 1e-9)
+	count, _ = histogramTotal(t, pipelineLatencyMetric, name)
+	assert.Equal(t, uint64(3), count)
+
+	// 未声明的阶段被忽略，不修改时间戳也不产生新的时间序列
+	stamps = p.MarkAt(ctx, stamps, "archived", base.Add(time.Second))
+	assert.NotContains(t, stamps, "archived")
+	count, _ = histogramTotal(t, pipelineLatencyMetric, name, attribute.String(toStageLabel, "archived"))
+	assert.Zero(t, count)
+
+	// 后一阶段早于前一阶段时只计入时钟偏差
+	p.MarkAt(ctx, stamps, StagePushed, base.Add(-time.Millisecond))
+	assert.Equal(t, int64(1), counterValue(t, pipelineClockSkewMetric, pair(StagePersisted, StagePushed)...))
+	assert.Equal(t, int64(1), counterValue(t, pipelineClockSkewMetric, pair(StageGatewayReceived, StagePushed)...))
+	count, _ = histogramTotal(t, pipelineLatencyMetric, name, attribute.String(toStageLabel, StagePushed))
+	assert.Zero(t, count)
+
+	// Mark 使用当前时间
+	stamps = p.Mark(ctx, nil, StageConsumed)
+	assert.WithinDuration(t, time.Now(), stamps[StageConsumed], time.Second)
+}
+
+func TestPipelineSnapshot(t *testing.T) {
+	ctx := context.Background()
+	p := NewPipeline(uniqueLabel("pipeline_snapshot_test"), "a", "b", "c")
+	assert.Empty(t, p.Snapshot())
+
+	base := time.Now()
+	for _, latency := range []time.Duration{time.Millisecond, 40 * time.Millisecond, 2 * time.Minute} {
+		stamps := p.MarkAt(ctx, nil, "b", base)
+		p.MarkAt(ctx, stamps, "c", base.Add(latency))
+	}
+	stamps := p.MarkAt(ctx, nil, "a", base)
+	p.MarkAt(ctx, stamps, "b", base.Add(3*time.Millisecond))
+
+	snapshot := p.Snapshot()
+	require.Len(t, snapshot, 2)
+	assert.Equal(t, "a", snapshot[0].From)
+	assert.Equal(t, "b", snapshot[0].To)
+	assert.Equal(t, "b", snapshot[1].From)
+	assert.Equal(t, "c", snapshot[1].To)
+
+	// 边界值落入以该边界为上限的分桶，超过最大边界的计入最后一个分桶
+	bc := snapshot[1]
+	assert.Equal(t, pipelineLatencyBuckets, bc.Buckets)
+	require.Len(t, bc.Counts, len(pipelineLatencyBuckets)+1)
+	assert.Equal(t, uint64(3), bc.Count)
+	assert.InDelta(t, 120.041, bc.Sum, 1e-9)
+	assert.Equal(t, uint64(1), bc.Counts[0])
+	assert.Equal(t, uint64(1), bc.Counts[5])
+	assert.Equal(t, uint64(1), bc.Counts[len(bc.Counts)-1])
+
+	// 快照是副本，修改不影响累计值
+	bc.Counts[0] = 100
+	assert.Equal(t, uint64(1), p.Snapshot()[1].Counts[0])
+}
+
+func TestPipelineServeHTTP(t *testing.T) {
+	p := NewPipeline(uniqueLabel("pipeline_http_test"), "a", "b")
+	stamps := p.MarkAt(context.Background(), nil, "a", time.Now())
+	p.MarkAt(context.Background(), stamps, "b", stamps["a"].Add(time.Millisecond))
+
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/pipeline", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var body struct {
+		Pipeline string         `json:"pipeline"`
+		Stages   []string       `json:"stages"`
+		Pairs    []StageLatency `json:"pairs"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, p.Name(), body.Pipeline)
+	assert.Equal(t, []string{"a", "b"}, body.Stages)
+	assert.Equal(t, p.Snapshot(), body.Pairs)
+}
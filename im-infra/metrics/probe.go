@@ -0,0 +1,334 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/cache"
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/ceyewan/gochat/im-infra/db"
+	"github.com/ceyewan/gochat/im-infra/es"
+	"github.com/ceyewan/gochat/im-infra/metrics/internal"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// 合成探测的默认参数
+const (
+	defaultProbeInterval = 15 * time.Second
+	defaultProbeTimeout  = 5 * time.Second
+)
+
+// 合成探测的指标名称
+const (
+	probeUpMetric       = "dependency_probe_up"
+	probeDurationMetric = "dependency_probe_duration_seconds"
+	probeTotalMetric    = "dependency_probe_total"
+)
+
+var probeLogger = clog.Namespace("metrics.probe")
+
+// Probe 是一个针对外部依赖的合成检查
+type Probe struct {
+	// Name 依赖实例名称，写入 dependency 标签，如 "redis-session"
+	Name string
+	// Kind 依赖类型，写入 kind 标签，如 "redis"、"mysql"
+	Kind string
+	// Check 执行一次检查，返回 nil 表示依赖可用。ctx 带有 ProberConfig.Timeout 超时
+	Check func(ctx context.Context) error
+}
+
+// ProbeStatus 一个探测最近一次执行的结果
+type ProbeStatus struct {
+	Name      string
+	Kind      string
+	Up        bool
+	Latency   time.Duration
+	Err       error
+	CheckedAt time.Time
+	// Since 当前可用状态的开始时间
+	Since time.Time
+}
+
+// ProberConfig 定义了合成探测的执行周期
+type ProberConfig struct {
+	// Interval 每个探测的执行间隔，默认 15s
+	Interval time.Duration `json:"interval"`
+	// Timeout 单次探测的超时时间，默认 5s，不能超过 Interval
+	Timeout time.Duration `json:"timeout"`
+}
+
+// Prober 周期性地执行已注册的合成探测，并导出依赖的可用性和延迟指标。
+// 探测不依赖业务流量，流量低谷或依赖尚未被调用时也能发现依赖故障。
+//
+// 导出的指标：
+//   - dependency_probe_up{dependency,kind}：最近一次探测是否成功，1 为可用
+//   - dependency_probe_duration_seconds{dependency,kind,result}：探测耗时，result 为 success/failure
+//   - dependency_probe_total{dependency,kind,result}：探测次数
+type Prober struct {
+	config ProberConfig
+
+	up       metric.Int64Gauge
+	duration metric.Float64Histogram
+	total    metric.Int64Counter
+
+	mu       sync.Mutex
+	probes   map[string]Probe
+	statuses map[string]*ProbeStatus
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// NewProber 创建合成探测器，调用 Start 后开始执行。
+//
+// 示例：
+//
+//	prober, err := metrics.NewProber(metrics.ProberConfig{Interval: 10 * time.Second})
+//	_ = prober.Register(metrics.RedisProbe("redis-session", cacheClient))
+//	_ = prober.Register(metrics.MySQLProbe("mysql-main", dbProvider))
+//	_ = prober.Register(kafkametrics.Probe("kafka", kafkaProvider))
+//	_ = prober.Register(metrics.ElasticsearchProbe("es-message", esConfig))
+//	prober.Start()
+//	defer prober.Stop()
+func NewProber(cfg ProberConfig) (*Prober, error) {
+	if cfg.Interval < 0 || cfg.Timeout < 0 {
+		return nil, errors.New("prober interval and timeout cannot be negative")
+	}
+	if cfg.Interval == 0 {
+		cfg.Interval = defaultProbeInterval
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = min(defaultProbeTimeout, cfg.Interval)
+	}
+	if cfg.Timeout > cfg.Interval {
+		return nil, fmt.Errorf("prober timeout %v cannot exceed interval %v", cfg.Timeout, cfg.Interval)
+	}
+
+	meter := otel.Meter(internal.InstrumentationName)
+	p := &Prober{
+		config:   cfg,
+		probes:   make(map[string]Probe),
+		statuses: make(map[string]*ProbeStatus),
+	}
+
+	var err error
+	if p.up, err = meter.Int64Gauge(probeUpMetric,
+		metric.WithDescription("Whether the last synthetic probe of the dependency succeeded")); err != nil {
+		return nil, err
+	}
+	if p.duration, err = meter.Float64Histogram(probeDurationMetric,
+		metric.WithDescription("Duration of synthetic dependency probes"),
+		metric.WithUnit("s")); err != nil {
+		return nil, err
+	}
+	if p.total, err = meter.Int64Counter(probeTotalMetric,
+		metric.WithDescription("Total number of synthetic dependency probes by result")); err != nil {
+		return nil, err
+	}
+
+	registerInstrument(probeUpMetric, internal.InstrumentGauge, "", "Whether the last synthetic probe of the dependency succeeded")
+	registerInstrument(probeDurationMetric, internal.InstrumentHistogram, "s", "Duration of synthetic dependency probes")
+	registerInstrument(probeTotalMetric, internal.InstrumentCounter, "", "Total number of synthetic dependency probes by result")
+	return p, nil
+}
+
+// Register 注册一个探测，名称不能重复。Start 之后注册的探测立即开始执行
+func (p *Prober) Register(probe Probe) error {
+	if probe.Name == "" || probe.Kind == "" {
+		return errors.New("probe name and kind cannot be empty")
+	}
+	if probe.Check == nil {
+		return fmt.Errorf("probe %s has no check", probe.Name)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.probes[probe.Name]; ok {
+		return fmt.Errorf("probe %s already registered", probe.Name)
+	}
+	p.probes[probe.Name] = probe
+	if p.ctx != nil {
+		p.launch(probe)
+	}
+	return nil
+}
+
+// Start 开始执行所有已注册的探测，重复调用无效
+func (p *Prober) Start() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.ctx != nil {
+		return
+	}
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	for _, probe := range p.probes {
+		p.launch(probe)
+	}
+	probeLogger.Info("合成探测已启动", clog.Int("probes", len(p.probes)), clog.Duration("interval", p.config.Interval))
+}
+
+// Stop 停止所有探测并等待正在执行的探测返回，应在关闭被探测的依赖之前调用
+func (p *Prober) Stop() {
+	p.mu.Lock()
+	cancel := p.cancel
+	p.mu.Unlock()
+	if cancel == nil {
+		return
+	}
+	cancel()
+	p.wg.Wait()
+}
+
+// Status 返回每个探测最近一次执行的结果，可用于就绪检查或诊断页面
+func (p *Prober) Status() []ProbeStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	statuses := make([]ProbeStatus, 0, len(p.statuses))
+	for _, s := range p.statuses {
+		statuses = append(statuses, *s)
+	}
+	return statuses
+}
+
+// launch 启动一个探测的执行协程，调用方持有 p.mu
+func (p *Prober) launch(probe Probe) {
+	ctx := p.ctx
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(p.config.Interval)
+		defer ticker.Stop()
+		for {
+			p.run(ctx, probe)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// run 执行一次探测并记录结果
+func (p *Prober) run(ctx context.Context, probe Probe) {
+	checkCtx, cancel := context.WithTimeout(ctx, p.config.Timeout)
+	start := time.Now()
+	err := probe.Check(checkCtx)
+	latency := time.Since(start)
+	cancel()
+	if ctx.Err() != nil {
+		// 停止期间被取消的探测不代表依赖不可用
+		return
+	}
+
+	result, up := "success", int64(1)
+	if err != nil {
+		result, up = "failure", 0
+	}
+	labels := []attribute.KeyValue{attribute.String("dependency", probe.Name), attribute.String("kind", probe.Kind)}
+	p.up.Record(ctx, up, metric.WithAttributes(labels...))
+	withResult := metric.WithAttributes(append(labels, attribute.String("result", result))...)
+	p.duration.Record(ctx, latency.Seconds(), withResult)
+	p.total.Add(ctx, 1, withResult)
+
+	p.mu.Lock()
+	status, seen := p.statuses[probe.Name]
+	if !seen {
+		status = &ProbeStatus{Name: probe.Name, Kind: probe.Kind, Since: start}
+		p.statuses[probe.Name] = status
+	}
+	changed := seen && status.Up != (err == nil)
+	if changed {
+		status.Since = start
+	}
+	status.Up, status.Latency, status.Err, status.CheckedAt = err == nil, latency, err, start
+	p.mu.Unlock()
+
+	switch {
+	case err != nil && (changed || !seen):
+		probeLogger.Warn("依赖探测失败",
+			clog.String("dependency", probe.Name),
+			clog.String("kind", probe.Kind),
+			clog.Duration("latency", latency),
+			clog.Err(err))
+	case err == nil && changed:
+		probeLogger.Info("依赖探测恢复",
+			clog.String("dependency", probe.Name),
+			clog.String("kind", probe.Kind),
+			clog.Duration("latency", latency))
+	}
+}
+
+// RedisProbe 通过 PING 探测 Redis
+func RedisProbe(name string, provider cache.Provider) Probe {
+	return Probe{Name: name, Kind: "redis", Check: provider.Ping}
+}
+
+// MySQLProbe 在主库上执行 SELECT 1 探测 MySQL，覆盖连接池取连接和查询执行的完整路径
+func MySQLProbe(name string, provider db.Provider) Probe {
+	return Probe{Name: name, Kind: "mysql", Check: func(ctx context.Context) error {
+		var one int
+		return provider.DB(db.WithPrimary(ctx)).Raw("SELECT 1").Scan(&one).Error
+	}}
+}
+
+// ElasticsearchProbe 通过 _cluster/health 探测 Elasticsearch，集群状态为 red 时视为不可用。
+// 依次尝试 cfg.Addresses 中的节点，任一节点返回健康状态即可
+func ElasticsearchProbe(name string, cfg *es.Config) Probe {
+	client := &http.Client{}
+	return Probe{Name: name, Kind: "elasticsearch", Check: func(ctx context.Context) error {
+		if cfg == nil || len(cfg.Addresses) == 0 {
+			return errors.New("elasticsearch addresses are empty")
+		}
+		var lastErr error
+		for _, addr := range cfg.Addresses {
+			status, err := clusterHealth(ctx, client, addr, cfg.Username, cfg.Password)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			if status == "red" {
+				return errors.New("elasticsearch cluster status is red")
+			}
+			return nil
+		}
+		return lastErr
+	}}
+}
+
+// clusterHealth 请求一个节点的 _cluster/health，返回集群状态
+func clusterHealth(ctx context.Context, client *http.Client, addr, username, password string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(addr, "/")+"/_cluster/health", nil)
+	if err != nil {
+		return "", err
+	}
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return "", fmt.Errorf("elasticsearch %s returned %s", addr, resp.Status)
+	}
+
+	var health struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		return "", fmt.Errorf("decode cluster health from %s: %w", addr, err)
+	}
+	return health.Status, nil
+}
@@ -0,0 +1,166 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/es"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestNewProber(t *testing.T) {
+	p, err := NewProber(ProberConfig{})
+	require.NoError(t, err)
+	assert.Equal(t, defaultProbeInterval, p.config.Interval)
+	assert.Equal(t, defaultProbeTimeout, p.config.Timeout)
+
+	// 间隔小于默认超时时，超时时间不超过间隔
+	p, err = NewProber(ProberConfig{Interval: time.Second})
+	require.NoError(t, err)
+	assert.Equal(t, time.Second, p.config.Timeout)
+
+	for name, cfg := range map[string]ProberConfig{
+		"NegativeInterval":     {Interval: -time.Second},
+		"NegativeTimeout":      {Timeout: -time.Second},
+		"TimeoutAboveInterval": {Interval: time.Second, Timeout: 2 * time.Second},
+	} {
+		_, err := NewProber(cfg)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestProberRegister(t *testing.T) {
+	p, err := NewProber(ProberConfig{})
+	require.NoError(t, err)
+	check := func(context.Context) error { return nil }
+
+	require.NoError(t, p.Register(Probe{Name: "redis-session", Kind: "redis", Check: check}))
+	assert.Error(t, p.Register(Probe{Name: "redis-session", Kind: "redis", Check: check}), "duplicate name")
+	assert.Error(t, p.Register(Probe{Kind: "redis", Check: check}))
+	assert.Error(t, p.Register(Probe{Name: "redis-cache", Check: check}))
+	assert.Error(t, p.Register(Probe{Name: "redis-cache", Kind: "redis"}))
+
+	// 未启动时不执行探测
+	assert.Empty(t, p.Status())
+}
+
+func TestProberRun(t *testing.T) {
+	p, err := NewProber(ProberConfig{Interval: 10 * time.Millisecond, Timeout: 5 * time.Millisecond})
+	require.NoError(t, err)
+
+	var healthy atomic.Bool
+	healthy.Store(true)
+	name := uniqueLabel("mysql-main")
+	require.NoError(t, p.Register(Probe{Name: name, Kind: "mysql", Check: func(ctx context.Context) error {
+		if healthy.Load() {
+			return nil
+		}
+		return errors.New("connection refused")
+	}}))
+	p.Start()
+	p.Start()
+	defer p.Stop()
+
+	dependency := attribute.String("dependency", name)
+	status := func() ProbeStatus {
+		statuses := p.Status()
+		require.Len(t, statuses, 1)
+		return statuses[0]
+	}
+	require.Eventually(t, func() bool { return len(p.Status()) == 1 }, time.Second, 5*time.Millisecond)
+	up := status()
+	assert.Equal(t, name, up.Name)
+	assert.Equal(t, "mysql", up.Kind)
+	assert.True(t, up.Up)
+	assert.NoError(t, up.Err)
+	gauge, ok := gaugeValue[int64](t, probeUpMetric, dependency, attribute.String("kind", "mysql"))
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), gauge)
+
+	// 状态翻转时更新 Since
+	healthy.Store(false)
+	require.Eventually(t, func() bool { return !status().Up }, time.Second, 5*time.Millisecond)
+	down := status()
+	assert.EqualError(t, down.Err, "connection refused")
+	assert.True(t, down.Since.After(up.Since))
+	gauge, _ = gaugeValue[int64](t, probeUpMetric, dependency)
+	assert.Equal(t, int64(0), gauge)
+
+	// 持续失败时 Since 保持不变
+	require.Eventually(t, func() bool { return status().CheckedAt.After(down.CheckedAt) }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, down.Since, status().Since)
+
+	// Start 之后注册的探测立即开始执行
+	require.NoError(t, p.Register(Probe{Name: uniqueLabel("kafka"), Kind: "kafka", Check: func(context.Context) error { return nil }}))
+	require.Eventually(t, func() bool { return len(p.Status()) == 2 }, time.Second, 5*time.Millisecond)
+
+	p.Stop()
+	success := counterValue(t, probeTotalMetric, dependency, attribute.String("result", "success"))
+	failure := counterValue(t, probeTotalMetric, dependency, attribute.String("result", "failure"))
+	assert.Positive(t, success)
+	assert.GreaterOrEqual(t, failure, int64(2))
+	count, _ := histogramTotal(t, probeDurationMetric, dependency)
+	assert.Equal(t, uint64(success+failure), count)
+
+	// 停止后不再执行
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, success+failure, counterValue(t, probeTotalMetric, dependency))
+}
+
+func TestElasticsearchProbe(t *testing.T) {
+	var status atomic.Value
+	status.Store("green")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_cluster/health" {
+			http.NotFound(w, r)
+			return
+		}
+		if user, pass, ok := r.BasicAuth(); !ok || user != "elastic" || pass != "changeme" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"cluster_name":"gochat","status":"` + status.Load().(string) + `"}`))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	probe := ElasticsearchProbe("es-message", &es.Config{
+		Addresses: []string{server.URL + "/"},
+		Username:  "elastic",
+		Password:  "changeme",
+	})
+	assert.Equal(t, "elasticsearch", probe.Kind)
+	assert.NoError(t, probe.Check(ctx))
+	status.Store("yellow")
+	assert.NoError(t, probe.Check(ctx))
+	status.Store("red")
+	assert.ErrorContains(t, probe.Check(ctx), "red")
+
+	// 依次尝试各节点，任一节点返回健康状态即可
+	status.Store("green")
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	probe = ElasticsearchProbe("es-message", &es.Config{
+		Addresses: []string{down.URL, server.URL},
+		Username:  "elastic",
+		Password:  "changeme",
+	})
+	assert.NoError(t, probe.Check(ctx))
+
+	probe = ElasticsearchProbe("es-message", &es.Config{Addresses: []string{down.URL}})
+	assert.ErrorContains(t, probe.Check(ctx), "503")
+	probe = ElasticsearchProbe("es-message", &es.Config{Addresses: []string{server.URL}})
+	assert.ErrorContains(t, probe.Check(ctx), "401")
+
+	assert.Error(t, ElasticsearchProbe("es-message", nil).Check(ctx))
+	assert.Error(t, ElasticsearchProbe("es-message", &es.Config{}).Check(ctx))
+}
@@ -0,0 +1,227 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/ceyewan/gochat/im-infra/ctxmeta"
+	"github.com/ceyewan/gochat/im-infra/metrics/internal"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// 租户标签
+const (
+	// TenantLabel 是租户维度的指标标签名，与 ctxmeta 中的租户字段同名
+	TenantLabel = ctxmeta.TenantKey
+
+	// TenantOther 是未在白名单中或超出序列配额的租户统一使用的标签值
+	TenantOther = "other"
+)
+
+// tenantQuotaExceededMetric 超出序列配额、被并入 other 的观测次数
+const tenantQuotaExceededMetric = "tenant.series_quota_exceeded.count"
+
+var (
+	tenantLogger = clog.Namespace("metrics.tenant")
+
+	tenantInstrumentsOnce sync.Once
+	tenantQuotaExceeded   metric.Int64Counter
+)
+
+// initTenantInstruments 延迟创建租户配额计数器，创建失败时跳过记录
+func initTenantInstruments() {
+	tenantInstrumentsOnce.Do(func() {
+		var err error
+		tenantQuotaExceeded, err = otel.Meter(internal.InstrumentationName).Int64Counter(
+			tenantQuotaExceededMetric,
+			metric.WithDescription("Number of observations folded into the other tenant because the tenant exceeded its series quota."))
+		if err != nil {
+			helperLogger.Error("failed to create tenant quota counter", clog.Err(err))
+			return
+		}
+		registerInstrument(tenantQuotaExceededMetric, internal.InstrumentCounter, "",
+			"Number of observations folded into the other tenant because the tenant exceeded its series quota.")
+	})
+}
+
+// TenantConfig 定义租户维度的指标隔离规则。
+type TenantConfig struct {
+	// MetaKey 读取租户 ID 的上下文元数据字段，默认 "tenant_id"。
+	// 租户 ID 通过 ctxmeta.WithTenant 或 WithMeta 写入，或由拦截器从 "x-tenant-id" 请求头读取（需加入 ContextAttributes 白名单）。
+	MetaKey string
+
+	// Tenants 单独打标签的租户白名单，通常是需要独立仪表盘的大客户；
+	// 其余租户（包括没有租户 ID 的请求）统一记为 "other"。
+	Tenants []string
+
+	// MaxSeriesPerTenant 每个白名单租户在该 TenantScope 所有仪表上最多产生的时间序列数，
+	// 超出后新的标签组合并入 "other"，已有的序列不受影响。默认 1000。
+	MaxSeriesPerTenant int
+}
+
+// tenantSeries 标识一条带租户标签的时间序列
+type tenantSeries struct {
+	instrument string
+	tenant     string
+	attrs      attribute.Distinct
+}
+
+// TenantScope 为指标附加租户标签，并限制每个租户的时间序列数。
+//
+// 只有白名单中的租户会以自己的 tenant_id 出现在指标中，其余租户聚合为 "other"，
+// 使按大客户拆分仪表盘成为可能，同时避免租户数量导致的基数爆炸。
+// TenantScope 是线程安全的，应在初始化时创建并复用。
+type TenantScope struct {
+	metaKey   string
+	maxSeries int
+	tenants   atomic.Pointer[map[string]struct{}]
+
+	mu       sync.Mutex
+	series   map[tenantSeries]struct{}
+	counts   map[string]int
+	exceeded map[string]bool
+}
+
+// NewTenantScope 创建租户维度的指标隔离范围。
+//
+// 示例：
+//
+//	tenants := metrics.NewTenantScope(metrics.TenantConfig{
+//	    Tenants:            []string{"acme", "globex"},
+//	    MaxSeriesPerTenant: 500,
+//	})
+//	messages := tenants.Counter(messageCounter)
+//	messages.Inc(ctx, attribute.String("type", "text"))
+func NewTenantScope(cfg TenantConfig) *TenantScope {
+	initTenantInstruments()
+	s := &TenantScope{
+		metaKey:   cfg.MetaKey,
+		maxSeries: cfg.MaxSeriesPerTenant,
+		series:    make(map[tenantSeries]struct{}),
+		counts:    make(map[string]int),
+		exceeded:  make(map[string]bool),
+	}
+	if s.metaKey == "" {
+		s.metaKey = TenantLabel
+	}
+	if s.maxSeries <= 0 {
+		s.maxSeries = 1000
+	}
+	s.SetTenants(cfg.Tenants)
+	return s
+}
+
+// SetTenants 替换租户白名单，可在运行时根据配置中心的变更调用。
+// 移出白名单的租户之后记为 "other"，其已导出的序列在 exporter 中自然过期。
+func (s *TenantScope) SetTenants(tenants []string) {
+	set := make(map[string]struct{}, len(tenants))
+	for _, tenant := range tenants {
+		if tenant != "" && tenant != TenantOther {
+			set[tenant] = struct{}{}
+		}
+	}
+	s.tenants.Store(&set)
+}
+
+// Tenant 返回上下文中的租户在指标中使用的标签值，不在白名单中时返回 "other"。
+func (s *TenantScope) Tenant(ctx context.Context) string {
+	tenant, _ := internal.MetaFromContext(ctx, s.metaKey)
+	if _, ok := (*s.tenants.Load())[tenant]; ok {
+		return tenant
+	}
+	return TenantOther
+}
+
+// SeriesUsage 返回每个白名单租户已使用的序列数，用于观察配额余量。
+func (s *TenantScope) SeriesUsage() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	usage := make(map[string]int, len(s.counts))
+	for tenant, n := range s.counts {
+		usage[tenant] = n
+	}
+	return usage
+}
+
+// attributes 返回附加了租户标签的完整标签，租户超出序列配额时新序列并入 "other"
+func (s *TenantScope) attributes(ctx context.Context, instrument string, attrs []attribute.KeyValue) []attribute.KeyValue {
+	tenant := s.Tenant(ctx)
+	if tenant != TenantOther && !s.admit(ctx, instrument, tenant, attrs) {
+		tenant = TenantOther
+	}
+	all := make([]attribute.KeyValue, 0, len(attrs)+1)
+	return append(append(all, attrs...), attribute.String(TenantLabel, tenant))
+}
+
+// admit 判断租户的这条序列是否在配额内，已存在的序列总是放行
+func (s *TenantScope) admit(ctx context.Context, instrument, tenant string, attrs []attribute.KeyValue) bool {
+	set := attribute.NewSet(attrs...)
+	key := tenantSeries{instrument: instrument, tenant: tenant, attrs: set.Equivalent()}
+
+	s.mu.Lock()
+	if _, ok := s.series[key]; ok {
+		s.mu.Unlock()
+		return true
+	}
+	if s.counts[tenant] < s.maxSeries {
+		s.series[key] = struct{}{}
+		s.counts[tenant]++
+		s.mu.Unlock()
+		return true
+	}
+	firstExceeded := !s.exceeded[tenant]
+	s.exceeded[tenant] = true
+	s.mu.Unlock()
+
+	if firstExceeded {
+		tenantLogger.Warn("租户指标序列数超出配额，新序列并入 other",
+			clog.String("tenant", tenant),
+			clog.String("instrument", instrument),
+			clog.Int("max_series", s.maxSeries))
+	}
+	if tenantQuotaExceeded != nil {
+		tenantQuotaExceeded.Add(ctx, 1, metric.WithAttributes(attribute.String(TenantLabel, tenant)))
+	}
+	return false
+}
+
+// Counter 返回按租户打标签的计数器包装。
+func (s *TenantScope) Counter(c *Counter) *TenantCounter {
+	return &TenantCounter{scope: s, counter: c}
+}
+
+// Histogram 返回按租户打标签的直方图包装。
+func (s *TenantScope) Histogram(h *Histogram) *TenantHistogram {
+	return &TenantHistogram{scope: s, histogram: h}
+}
+
+// TenantCounter 是附加租户标签的计数器，由 TenantScope.Counter 创建。
+type TenantCounter struct {
+	scope   *TenantScope
+	counter *Counter
+}
+
+// Inc 将上下文中租户对应的计数器增加 1。
+func (c *TenantCounter) Inc(ctx context.Context, attrs ...attribute.KeyValue) {
+	c.counter.Inc(ctx, c.scope.attributes(ctx, c.counter.name, attrs)...)
+}
+
+// Add 将上下文中租户对应的计数器增加 value，负数会被忽略。
+func (c *TenantCounter) Add(ctx context.Context, value int64, attrs ...attribute.KeyValue) {
+	c.counter.Add(ctx, value, c.scope.attributes(ctx, c.counter.name, attrs)...)
+}
+
+// TenantHistogram 是附加租户标签的直方图，由 TenantScope.Histogram 创建。
+type TenantHistogram struct {
+	scope     *TenantScope
+	histogram *Histogram
+}
+
+// Record 记录上下文中租户的一个观测值。
+func (h *TenantHistogram) Record(ctx context.Context, value float64, attrs ...attribute.KeyValue) {
+	h.histogram.Record(ctx, value, h.scope.attributes(ctx, h.histogram.name, attrs)...)
+}
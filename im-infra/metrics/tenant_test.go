@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestTenantScopeTenant(t *testing.T) {
+	scope := NewTenantScope(TenantConfig{Tenants: []string{"acme", "", TenantOther}})
+	assert.Equal(t, 1000, scope.maxSeries)
+
+	assert.Equal(t, "acme", scope.Tenant(WithMeta(context.Background(), TenantLabel, "acme")))
+	assert.Equal(t, TenantOther, scope.Tenant(WithMeta(context.Background(), TenantLabel, "globex")))
+	assert.Equal(t, TenantOther, scope.Tenant(context.Background()))
+	// 空字符串和 other 不能作为白名单租户
+	assert.Equal(t, TenantOther, scope.Tenant(WithMeta(context.Background(), TenantLabel, "")))
+
+	// 运行时替换白名单
+	scope.SetTenants([]string{"globex"})
+	assert.Equal(t, TenantOther, scope.Tenant(WithMeta(context.Background(), TenantLabel, "acme")))
+	assert.Equal(t, "globex", scope.Tenant(WithMeta(context.Background(), TenantLabel, "globex")))
+
+	// 自定义读取租户 ID 的元数据字段
+	scope = NewTenantScope(TenantConfig{MetaKey: "org_id", Tenants: []string{"acme"}})
+	assert.Equal(t, "acme", scope.Tenant(WithMeta(context.Background(), "org_id", "acme")))
+	assert.Equal(t, TenantOther, scope.Tenant(WithMeta(context.Background(), TenantLabel, "acme")))
+}
+
+func TestTenantScopeQuota(t *testing.T) {
+	counter, err := NewCounter(uniqueLabel("tenant_test_messages_total"), "Messages sent by tenant.")
+	require.NoError(t, err)
+	histogram, err := NewHistogram(uniqueLabel("tenant_test_message_size"), "Message size by tenant.", "By")
+	require.NoError(t, err)
+
+	acme, globex := uniqueLabel("acme"), uniqueLabel("globex")
+	scope := NewTenantScope(TenantConfig{Tenants: []string{acme, globex}, MaxSeriesPerTenant: 2})
+	messages := scope.Counter(counter)
+	sizes := scope.Histogram(histogram)
+	acmeCtx := WithMeta(context.Background(), TenantLabel, acme)
+	text, image, video := attribute.String("type", "text"), attribute.String("type", "image"), attribute.String("type", "video")
+
+	// 配额按序列计算，同一序列重复观测不占用新配额
+	messages.Inc(acmeCtx, text)
+	messages.Add(acmeCtx, 2, text)
+	sizes.Record(acmeCtx, 128, text)
+	assert.Equal(t, map[string]int{acme: 2}, scope.SeriesUsage())
+
+	// 超出配额后新序列并入 other，已有序列不受影响
+	messages.Inc(acmeCtx, image)
+	messages.Inc(acmeCtx, video)
+	messages.Inc(acmeCtx, text)
+	assert.Equal(t, int64(4), counterValue(t, counter.name, attribute.String(TenantLabel, acme), text))
+	assert.Equal(t, int64(2), counterValue(t, counter.name, attribute.String(TenantLabel, TenantOther)))
+	assert.Equal(t, int64(1), counterValue(t, counter.name, attribute.String(TenantLabel, TenantOther), image))
+	assert.Equal(t, int64(2), counterValue(t, tenantQuotaExceededMetric, attribute.String(TenantLabel, acme)))
+	count, sum := histogramTotal(t, histogram.name, attribute.String(TenantLabel, acme), text)
+	assert.Equal(t, uint64(1), count)
+	assert.Equal(t, 128.0, sum)
+
+	// 配额按租户独立计算，不在白名单中的租户不占用配额
+	messages.Inc(WithMeta(context.Background(), TenantLabel, globex), image)
+	messages.Inc(WithMeta(context.Background(), TenantLabel, "initech"), image)
+	assert.Equal(t, int64(1), counterValue(t, counter.name, attribute.String(TenantLabel, globex), image))
+	assert.Equal(t, int64(2), counterValue(t, counter.name, attribute.String(TenantLabel, TenantOther), image))
+	assert.Equal(t, map[string]int{acme: 2, globex: 1}, scope.SeriesUsage())
+
+	// SeriesUsage 返回副本
+	scope.SeriesUsage()[acme] = 0
+	assert.Equal(t, 2, scope.SeriesUsage()[acme])
+}
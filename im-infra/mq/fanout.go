@@ -0,0 +1,52 @@
+package mq
+
+import "github.com/ceyewan/gochat/im-infra/mq/internal"
+
+// FanOut 消费一个源主题并投递到多个目标主题，各目标的队列和投递协程相互隔离
+type FanOut = internal.FanOut
+
+// FanOutConfig 扇出组件的配置
+type FanOutConfig = internal.FanOutConfig
+
+// FanOutDestination 是扇出的一个目标主题，包含可选的过滤和转换函数
+type FanOutDestination = internal.FanOutDestination
+
+// FanOutFilter 决定消息是否投递到某个目标
+type FanOutFilter = internal.FanOutFilter
+
+// FanOutTransform 将源消息转换为发往目标主题的消息，返回 nil 表示跳过
+type FanOutTransform = internal.FanOutTransform
+
+// FanOutStats 是单个目标的投递统计
+type FanOutStats = internal.FanOutStats
+
+// 写入死信主题的消息额外携带的消息头
+const (
+	HeaderFanOutDestination = internal.HeaderFanOutDestination
+	HeaderFanOutReason      = internal.HeaderFanOutReason
+)
+
+// DefaultFanOutConfig 返回默认的扇出配置
+func DefaultFanOutConfig() FanOutConfig {
+	return internal.DefaultFanOutConfig()
+}
+
+// NewFanOut 创建扇出组件，每个目标可以单独设置过滤、转换和队列长度。
+//
+// 示例：
+//
+//	cfg := mq.DefaultFanOutConfig()
+//	cfg.SourceTopic = "im.message.created"
+//	cfg.DeadLetterTopic = "im.message.fanout.dlq"
+//	fanout, err := mq.NewFanOut(cfg, m.Producer(), m.Consumer(),
+//	    mq.FanOutDestination{Topic: "im.search.index"},
+//	    mq.FanOutDestination{
+//	        Topic:  "im.push.offline",
+//	        Filter: func(msg *mq.Message) bool { return msg.Envelope.Type == "message.private" },
+//	    },
+//	    mq.FanOutDestination{Topic: "im.audit.log", Transform: redactContent},
+//	)
+//	go fanout.Run(ctx)
+func NewFanOut(cfg FanOutConfig, producer Producer, consumer Consumer, destinations ...FanOutDestination) (*FanOut, error) {
+	return internal.NewFanOut(cfg, producer, consumer, destinations...)
+}
@@ -0,0 +1,183 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/db"
+	"github.com/ceyewan/gochat/im-infra/mq/internal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Idempotency 按业务键保证处理函数只成功执行一次，键保存在 IdempotencyStore 中
+type Idempotency = internal.Idempotency
+
+// IdempotencyConfig 幂等处理器的配置
+type IdempotencyConfig = internal.IdempotencyConfig
+
+// IdempotencyRecord 是幂等键的处理记录
+type IdempotencyRecord = internal.IdempotencyRecord
+
+// IdempotencyStore 持久化幂等键
+type IdempotencyStore = internal.IdempotencyStore
+
+// 幂等键的状态
+const (
+	IdempotencyStatusProcessing = internal.IdempotencyStatusProcessing
+	IdempotencyStatusDone       = internal.IdempotencyStatusDone
+)
+
+// ErrIdempotencyInProgress 相同的键正被另一个消费者处理，消息应稍后重试
+var ErrIdempotencyInProgress = internal.ErrIdempotencyInProgress
+
+// DefaultIdempotencyConfig 返回默认的幂等处理器配置
+func DefaultIdempotencyConfig() IdempotencyConfig {
+	return internal.DefaultIdempotencyConfig()
+}
+
+// NewIdempotency 创建幂等处理器。
+//
+// 示例：
+//
+//	store, err := mq.NewDBIdempotencyStore(ctx, dbProvider)
+//	idem, err := mq.NewIdempotency(mq.DefaultIdempotencyConfig(), store)
+//	go idem.Run(ctx) // 清理过期的键
+//
+//	err = idem.Execute(ctx, payment.ID, func(ctx context.Context) error {
+//	    return settle(ctx, payment)
+//	})
+func NewIdempotency(cfg IdempotencyConfig, store IdempotencyStore) (*Idempotency, error) {
+	return internal.NewIdempotency(cfg, store)
+}
+
+// NewMemoryIdempotencyStore 创建基于内存的 IdempotencyStore，仅用于测试和单实例开发环境
+func NewMemoryIdempotencyStore() IdempotencyStore {
+	return internal.NewMemoryIdempotencyStore()
+}
+
+// idempotencyRecord 是幂等键在数据库中的行，主键保证同一个键只能被一个处理者认领
+type idempotencyRecord struct {
+	Key       string    `gorm:"column:idempotency_key;primaryKey;size:191"`
+	Owner     string    `gorm:"size:64;not null"`
+	Status    string    `gorm:"size:16;not null"`
+	ExpiresAt time.Time `gorm:"not null;index:idx_mq_idempotency_keys_expires"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// TableName 指定幂等键表名
+func (idempotencyRecord) TableName() string {
+	return "mq_idempotency_keys"
+}
+
+// dbIdempotencyStore 是基于 db 组件的 IdempotencyStore
+type dbIdempotencyStore struct {
+	db db.Provider
+}
+
+// NewDBIdempotencyStore 创建基于 db 组件的 IdempotencyStore，并自动创建 mq_idempotency_keys 表。
+// 读取总是走主库，避免从副本读不到刚完成的键而误判为处理中。
+func NewDBIdempotencyStore(ctx context.Context, provider db.Provider) (IdempotencyStore, error) {
+	if provider == nil {
+		return nil, errors.New("db provider cannot be nil")
+	}
+	if err := provider.AutoMigrate(ctx, &idempotencyRecord{}); err != nil {
+		return nil, err
+	}
+	return &dbIdempotencyStore{db: provider}, nil
+}
+
+func (s *dbIdempotencyStore) Claim(ctx context.Context, record *IdempotencyRecord, now time.Time) (bool, *IdempotencyRecord, error) {
+	res := s.db.DB(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(toIdempotencyRecord(record))
+	if res.Error != nil {
+		return false, nil, res.Error
+	}
+	if res.RowsAffected == 1 {
+		return true, nil, nil
+	}
+
+	// 键已存在，记录过期（处理者崩溃或保留期已过）时接管
+	res = s.db.DB(ctx).Model(&idempotencyRecord{}).
+		Where("idempotency_key = ? AND expires_at < ?", record.Key, now).
+		Updates(map[string]interface{}{
+			"owner":      record.Owner,
+			"status":     record.Status,
+			"expires_at": record.ExpiresAt,
+			"created_at": record.CreatedAt,
+			"updated_at": record.UpdatedAt,
+		})
+	if res.Error != nil {
+		return false, nil, res.Error
+	}
+	if res.RowsAffected == 1 {
+		return true, nil, nil
+	}
+
+	existing, err := s.Get(ctx, record.Key)
+	return false, existing, err
+}
+
+func (s *dbIdempotencyStore) Complete(ctx context.Context, key, owner string, expiresAt, now time.Time) (bool, error) {
+	res := s.db.DB(ctx).Model(&idempotencyRecord{}).
+		Where("idempotency_key = ? AND owner = ?", key, owner).
+		Updates(map[string]interface{}{
+			"status":     IdempotencyStatusDone,
+			"expires_at": expiresAt,
+			"updated_at": now,
+		})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
+func (s *dbIdempotencyStore) Release(ctx context.Context, key, owner string) error {
+	return s.db.DB(ctx).
+		Where("idempotency_key = ? AND owner = ? AND status = ?", key, owner, IdempotencyStatusProcessing).
+		Delete(&idempotencyRecord{}).Error
+}
+
+func (s *dbIdempotencyStore) Get(ctx context.Context, key string) (*IdempotencyRecord, error) {
+	var record idempotencyRecord
+	err := s.db.DB(db.WithPrimary(ctx)).Where("idempotency_key = ?", key).Take(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return record.toRecord(), nil
+}
+
+func (s *dbIdempotencyStore) DeleteExpired(ctx context.Context, before time.Time, limit int) (int64, error) {
+	tx := s.db.DB(ctx).Where("expires_at < ?", before)
+	if limit > 0 {
+		tx = tx.Limit(limit)
+	}
+	res := tx.Delete(&idempotencyRecord{})
+	return res.RowsAffected, res.Error
+}
+
+func toIdempotencyRecord(record *IdempotencyRecord) *idempotencyRecord {
+	return &idempotencyRecord{
+		Key:       record.Key,
+		Owner:     record.Owner,
+		Status:    record.Status,
+		ExpiresAt: record.ExpiresAt,
+		CreatedAt: record.CreatedAt,
+		UpdatedAt: record.UpdatedAt,
+	}
+}
+
+func (r *idempotencyRecord) toRecord() *IdempotencyRecord {
+	return &IdempotencyRecord{
+		Key:       r.Key,
+		Owner:     r.Owner,
+		Status:    r.Status,
+		ExpiresAt: r.ExpiresAt,
+		CreatedAt: r.CreatedAt,
+		UpdatedAt: r.UpdatedAt,
+	}
+}
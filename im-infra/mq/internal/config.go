@@ -158,6 +158,15 @@ type ProducerConfig struct {
 	// MaxRetries 最大重试次数
 	// 默认：3
 	MaxRetries int `json:"maxRetries" yaml:"maxRetries"`
+
+	// ServiceName 写入消息信封的生产者服务名
+	// 默认：空，使用 ClientID
+	ServiceName string `json:"serviceName" yaml:"serviceName"`
+
+	// DisableEnvelope 是否关闭消息信封
+	// 关闭后不再自动写入消息 ID、生产时间、调用链等标准消息头
+	// 默认：false
+	DisableEnvelope bool `json:"disableEnvelope" yaml:"disableEnvelope"`
 }
 
 // ConsumerConfig 消费者配置
@@ -217,6 +226,20 @@ type ConsumerConfig struct {
 	// 支持："read_uncommitted", "read_committed"
 	// 默认："read_uncommitted"
 	IsolationLevel string `json:"isolationLevel" yaml:"isolationLevel"`
+
+	// Profile 调优档位
+	// 支持："latency", "throughput"
+	// 设置后覆盖 FetchMinBytes、FetchMaxWait、MaxPollRecords，并作为各主题调优参数的基础
+	// 默认：""（每个主题单协程顺序处理）
+	Profile string `json:"profile" yaml:"profile"`
+
+	// Topics 单个主题的调优参数，零值字段沿用档位，可通过 SetTopicTuning 在运行时覆盖
+	// 默认：nil
+	Topics map[string]TopicTuning `json:"topics,omitempty" yaml:"topics,omitempty"`
+
+	// Overload 过载时的分级降级策略，积压或处理耗时超过阈值时丢弃或延后低优先级消息
+	// 默认：nil（不降级）
+	Overload *OverloadPolicy `json:"overload,omitempty" yaml:"overload,omitempty"`
 }
 
 // PoolConfig 连接池配置
@@ -559,6 +582,12 @@ func mergeProducerConfig(defaultCfg, userCfg ProducerConfig, mainBrokers []strin
 	if userCfg.MaxRetries != 0 {
 		result.MaxRetries = userCfg.MaxRetries
 	}
+	if userCfg.ServiceName != "" {
+		result.ServiceName = userCfg.ServiceName
+	}
+	if userCfg.DisableEnvelope {
+		result.DisableEnvelope = true
+	}
 
 	return result
 }
@@ -618,6 +647,15 @@ func mergeConsumerConfig(defaultCfg, userCfg ConsumerConfig, mainBrokers []strin
 	if userCfg.IsolationLevel != "" {
 		result.IsolationLevel = userCfg.IsolationLevel
 	}
+	if userCfg.Profile != "" {
+		result.Profile = userCfg.Profile
+	}
+	if len(userCfg.Topics) > 0 {
+		result.Topics = userCfg.Topics
+	}
+	if userCfg.Overload != nil {
+		result.Overload = userCfg.Overload
+	}
 
 	return result
 }
@@ -2,6 +2,7 @@ package internal
 
 import (
 	"context"
+	"fmt"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -54,6 +55,14 @@ type consumer struct {
 
 	// 压缩器
 	compressor CompressionCodec
+
+	// 按主题调度消息处理
+	dispatchers map[string]*topicDispatcher
+	overrides   map[string]TopicTuning
+	dispatchMu  sync.Mutex
+
+	// 过载降级，未配置时为 nil
+	overload *overloadController
 }
 
 // consumerMetrics 消费者性能指标的内部实现
@@ -101,6 +110,7 @@ func NewConsumer(cfg ConsumerConfig) (Consumer, error) {
 	if err := validateConsumerConfig(cfg); err != nil {
 		return nil, NewConfigError("消费者配置无效", err)
 	}
+	applyConsumerProfile(&cfg)
 
 	// 构建Kafka客户端选项
 	opts := []kgo.Opt{
@@ -140,6 +150,8 @@ func NewConsumer(cfg ConsumerConfig) (Consumer, error) {
 		config:           cfg,
 		logger:           clog.Namespace("mq.consumer"),
 		pausedPartitions: make(map[TopicPartition]bool),
+		dispatchers:      make(map[string]*topicDispatcher),
+		overrides:        make(map[string]TopicTuning),
 		metrics: consumerMetrics{
 			lastResetTime:       time.Now(),
 			lastCommittedOffset: make(map[TopicPartition]int64),
@@ -154,11 +166,15 @@ func NewConsumer(cfg ConsumerConfig) (Consumer, error) {
 	// 初始化偏移量管理器
 	c.offsetManager = newOffsetManager(cfg, c.logger, client)
 
+	// 初始化过载降级
+	c.overload = newOverloadController(cfg.Overload, c.backlog, c.replayDeferred, c.logger)
+
 	c.logger.Info("消费者创建成功",
 		clog.String("client_id", cfg.ClientID),
 		clog.String("group_id", cfg.GroupID),
 		clog.String("auto_offset_reset", cfg.AutoOffsetReset),
-		clog.Bool("auto_commit", cfg.EnableAutoCommit))
+		clog.Bool("auto_commit", cfg.EnableAutoCommit),
+		clog.String("profile", cfg.Profile))
 
 	return c, nil
 }
@@ -474,9 +490,147 @@ func (c *consumer) GetMetrics() ConsumerMetrics {
 	}
 }
 
+// SetTopicTuning 在运行时覆盖主题的调优参数
+func (c *consumer) SetTopicTuning(topic string, tuning TopicTuning) error {
+	if topic == "" {
+		return NewConfigError("调优主题名不能为空", nil)
+	}
+	if err := tuning.validate(); err != nil {
+		return NewConfigError(fmt.Sprintf("主题 %s 的调优参数无效", topic), err)
+	}
+
+	c.dispatchMu.Lock()
+	defer c.dispatchMu.Unlock()
+
+	if tuning == (TopicTuning{}) {
+		delete(c.overrides, topic)
+	} else {
+		c.overrides[topic] = tuning
+	}
+	resolved := resolveTopicTuning(c.config, topic, c.overrides[topic])
+	if d, ok := c.dispatchers[topic]; ok {
+		d.setTuning(resolved)
+	}
+
+	c.logger.Info("主题调优参数已更新",
+		clog.String("topic", topic),
+		clog.String("profile", resolved.Profile),
+		clog.Int("parallelism", resolved.Parallelism),
+		clog.Int("max_in_flight", resolved.MaxInFlight),
+		clog.Int("resume_threshold", resolved.ResumeThreshold))
+	return nil
+}
+
+// GetTopicTuning 返回主题当前生效的调优参数
+func (c *consumer) GetTopicTuning(topic string) TopicTuning {
+	c.dispatchMu.Lock()
+	defer c.dispatchMu.Unlock()
+	return resolveTopicTuning(c.config, topic, c.overrides[topic])
+}
+
+// dispatcher 返回主题的调度器，首次收到该主题的消息时创建
+func (c *consumer) dispatcher(topic string) *topicDispatcher {
+	c.dispatchMu.Lock()
+	defer c.dispatchMu.Unlock()
+
+	d, ok := c.dispatchers[topic]
+	if !ok {
+		tuning := resolveTopicTuning(c.config, topic, c.overrides[topic])
+		d = newTopicDispatcher(topic, tuning, c.handleRecord, c.handleDeferred, c.pauseTopic, c.logger)
+		c.dispatchers[topic] = d
+	}
+	return d
+}
+
+// stopDispatchers 停止所有主题调度器，等待处理中的消息完成
+func (c *consumer) stopDispatchers() {
+	c.dispatchMu.Lock()
+	dispatchers := c.dispatchers
+	c.dispatchers = make(map[string]*topicDispatcher)
+	c.dispatchMu.Unlock()
+
+	for _, d := range dispatchers {
+		d.stop()
+	}
+}
+
+// pauseTopic 暂停或恢复拉取主题，用于在途消息的背压
+func (c *consumer) pauseTopic(topic string, paused bool) {
+	if paused {
+		c.client.PauseFetchTopics(topic)
+	} else {
+		c.client.ResumeFetchTopics(topic)
+	}
+}
+
+// backlog 返回所有主题已拉取但未处理完的消息总数
+func (c *consumer) backlog() int {
+	c.dispatchMu.Lock()
+	defer c.dispatchMu.Unlock()
+
+	total := 0
+	for _, d := range c.dispatchers {
+		total += d.backlog()
+	}
+	return total
+}
+
+// replayDeferred 将过载期间暂存的消息放回所属主题调度器的分区队首补处理，
+// 与同分区的新消息串行且保持偏移量顺序；偏移量在暂存时已经标记，补处理不再提交
+func (c *consumer) replayDeferred(messages []*Message) {
+	if c.consumeCtx == nil || c.consumeCtx.Err() != nil {
+		return
+	}
+
+	var order []TopicPartition
+	groups := make(map[TopicPartition][]*Message)
+	for _, message := range messages {
+		tp := TopicPartition{Topic: message.Topic, Partition: message.Partition}
+		if _, ok := groups[tp]; !ok {
+			order = append(order, tp)
+		}
+		groups[tp] = append(groups[tp], message)
+	}
+
+	c.dispatchMu.Lock()
+	defer c.dispatchMu.Unlock()
+	for _, tp := range order {
+		// 调度器已随消费循环停止时不再补处理，避免在停止后重新创建调度器
+		d, ok := c.dispatchers[tp.Topic]
+		if !ok {
+			c.logger.Warn("主题调度器已停止，丢弃暂存消息",
+				clog.String("topic", tp.Topic),
+				clog.Int32("partition", tp.Partition),
+				clog.Int("count", len(groups[tp])))
+			continue
+		}
+		d.requeue(tp.Partition, groups[tp])
+	}
+}
+
+// OverloadStats 返回过载降级的状态和丢弃计数
+func (c *consumer) OverloadStats() OverloadStats {
+	return c.overload.snapshot()
+}
+
+// handleRecord 调度器回调，处理单条记录
+func (c *consumer) handleRecord(record *kgo.Record) {
+	c.processRecord(record, TopicPartition{Topic: record.Topic, Partition: record.Partition})
+}
+
+// handleDeferred 调度器回调，补处理一条过载期间暂存的消息
+func (c *consumer) handleDeferred(message *Message) {
+	c.deliver(message, TopicPartition{Topic: message.Topic, Partition: message.Partition})
+}
+
 // consumeLoop 消费循环
 func (c *consumer) consumeLoop() {
 	defer c.consumeWG.Done()
+	defer c.stopDispatchers()
+
+	// 没有新消息到达时也定期评估过载状态，先于调度器停止
+	stopOverload := c.overload.start()
+	defer stopOverload()
 
 	c.logger.Info("开始消费循环")
 
@@ -494,8 +648,8 @@ func (c *consumer) consumeLoop() {
 			continue
 		}
 
-		// 拉取消息
-		fetches := c.client.PollFetches(c.consumeCtx)
+		// 拉取消息，单次最多 MaxPollRecords 条
+		fetches := c.client.PollRecords(c.consumeCtx, c.config.MaxPollRecords)
 		if errs := fetches.Errors(); len(errs) > 0 {
 			for _, err := range errs {
 				c.logger.Error("拉取消息错误", clog.Err(err.Err))
@@ -525,10 +679,8 @@ func (c *consumer) processFetches(fetches kgo.Fetches) {
 			return
 		}
 
-		// 处理分区中的消息
-		for _, record := range partition.Records {
-			c.processRecord(record, tp)
-		}
+		// 交给主题调度器处理，分区内保持顺序
+		c.dispatcher(tp.Topic).enqueue(tp.Partition, partition.Records)
 	})
 }
 
@@ -549,6 +701,7 @@ func (c *consumer) processRecord(record *kgo.Record, tp TopicPartition) {
 	for _, header := range record.Headers {
 		message.Headers[header.Key] = header.Value
 	}
+	message.Envelope = ParseEnvelope(message.Headers)
 
 	// 更新当前偏移量
 	c.metrics.offsetMu.Lock()
@@ -559,16 +712,9 @@ func (c *consumer) processRecord(record *kgo.Record, tp TopicPartition) {
 	atomic.AddInt64(&c.metrics.totalMessages, 1)
 	atomic.AddInt64(&c.metrics.totalBytes, int64(len(record.Value)))
 
-	// 调用回调函数
-	if c.callback != nil {
-		shouldContinue := c.callback(message, tp, nil)
-		if !shouldContinue {
-			c.logger.Info("回调函数要求停止消费")
-			if c.consumeCancel != nil {
-				c.consumeCancel()
-			}
-			return
-		}
+	// 过载时低优先级消息被丢弃或暂存，偏移量照常提交
+	if c.overload.admit(message) && !c.deliver(message, tp) {
+		return
 	}
 
 	// 自动提交偏移量
@@ -583,6 +729,25 @@ func (c *consumer) processRecord(record *kgo.Record, tp TopicPartition) {
 		clog.Int("message_size", len(record.Value)))
 }
 
+// deliver 调用回调函数并记录处理耗时，回调要求停止消费时返回 false
+func (c *consumer) deliver(message *Message, tp TopicPartition) bool {
+	if c.callback == nil {
+		return true
+	}
+
+	start := time.Now()
+	shouldContinue := c.callback(message, tp, nil)
+	c.overload.observe(time.Since(start))
+	if !shouldContinue {
+		c.logger.Info("回调函数要求停止消费")
+		if c.consumeCancel != nil {
+			c.consumeCancel()
+		}
+		return false
+	}
+	return true
+}
+
 // newOffsetManager 创建偏移量管理器
 func newOffsetManager(cfg ConsumerConfig, logger clog.Logger, client *kgo.Client) *offsetManager {
 	om := &offsetManager{
@@ -740,6 +905,16 @@ func validateConsumerConfig(cfg ConsumerConfig) error {
 		return NewConfigError("Broker地址列表不能为空", nil)
 	}
 
+	if err := validateTuningConfig(cfg); err != nil {
+		return err
+	}
+
+	if cfg.Overload != nil {
+		if err := cfg.Overload.validate(); err != nil {
+			return NewConfigError("过载降级策略无效", err)
+		}
+	}
+
 	if cfg.ClientID == "" {
 		return NewConfigError("客户端ID不能为空", nil)
 	}
@@ -0,0 +1,203 @@
+package internal
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/ctxmeta"
+	"github.com/google/uuid"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"go.opentelemetry.io/otel"
+)
+
+// 消息信封使用的标准消息头
+const (
+	// HeaderMessageID 消息唯一标识，默认为 UUIDv7，消费端可据此去重
+	HeaderMessageID = "X-Message-Id"
+	// HeaderMessageType 业务消息类型，如 "message.created"
+	HeaderMessageType = "X-Message-Type"
+	// HeaderMessageVersion 消息类型的版本号
+	HeaderMessageVersion = "X-Message-Version"
+	// HeaderProducedAt 生产时间，RFC3339Nano 格式
+	HeaderProducedAt = "X-Produced-At"
+	// HeaderProducer 生产者服务名
+	HeaderProducer = "X-Producer"
+	// HeaderTenant 租户标识
+	HeaderTenant = "X-Tenant-Id"
+	// HeaderTraceParent W3C Trace Context 的 traceparent
+	HeaderTraceParent = "traceparent"
+	// HeaderTraceState W3C Trace Context 的 tracestate
+	HeaderTraceState = "tracestate"
+)
+
+// Envelope 是所有消息共享的标准元数据。
+//
+// 生产时由 Producer 自动写入消息头，调用方显式设置的同名消息头优先；
+// 消费时由 Consumer 从消息头解析并填充到 Message.Envelope。
+type Envelope struct {
+	// MessageID 消息唯一标识
+	MessageID string
+	// Type 业务消息类型
+	Type string
+	// Version 消息类型的版本号，缺少版本头时为 0
+	Version int
+	// ProducedAt 生产时间
+	ProducedAt time.Time
+	// Producer 生产者服务名
+	Producer string
+	// Tenant 租户标识
+	Tenant string
+	// TraceParent W3C traceparent，用于在消费端延续调用链
+	TraceParent string
+	// TraceState W3C tracestate
+	TraceState string
+}
+
+// envelopeContextKey 是上下文中存放信封元数据的键
+type envelopeContextKey struct{}
+
+// WithMessageType 在上下文中设置本次发送的消息类型和版本
+func WithMessageType(ctx context.Context, messageType string, version int) context.Context {
+	env := EnvelopeFromContext(ctx)
+	env.Type = messageType
+	env.Version = version
+	return context.WithValue(ctx, envelopeContextKey{}, env)
+}
+
+// WithTenant 在上下文中设置租户标识，等价于 ctxmeta.WithTenant。
+// 消费端通过 Envelope.Context 恢复的上下文同样携带租户，便于继续向下游传递
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return ctxmeta.WithTenant(ctx, tenant)
+}
+
+// EnvelopeFromContext 返回上下文中通过 WithMessageType 设置的元数据，租户取自 ctxmeta
+func EnvelopeFromContext(ctx context.Context) Envelope {
+	env, _ := ctx.Value(envelopeContextKey{}).(Envelope)
+	env.Tenant = ctxmeta.Tenant(ctx)
+	return env
+}
+
+// ParseEnvelope 从消息头解析信封，缺失的字段保持零值
+func ParseEnvelope(headers map[string][]byte) Envelope {
+	env := Envelope{
+		MessageID:   string(headers[HeaderMessageID]),
+		Type:        string(headers[HeaderMessageType]),
+		Producer:    string(headers[HeaderProducer]),
+		Tenant:      string(headers[HeaderTenant]),
+		TraceParent: string(headers[HeaderTraceParent]),
+		TraceState:  string(headers[HeaderTraceState]),
+	}
+	env.Version, _ = strconv.Atoi(string(headers[HeaderMessageVersion]))
+	if producedAt, err := time.Parse(time.RFC3339Nano, string(headers[HeaderProducedAt])); err == nil {
+		env.ProducedAt = producedAt
+	}
+	return env
+}
+
+// Headers 将信封转换为消息头，零值字段不会写入
+func (e Envelope) Headers() map[string][]byte {
+	headers := make(map[string][]byte, 8)
+	set := func(key, value string) {
+		if value != "" {
+			headers[key] = []byte(value)
+		}
+	}
+	set(HeaderMessageID, e.MessageID)
+	set(HeaderMessageType, e.Type)
+	if e.Version != 0 {
+		set(HeaderMessageVersion, strconv.Itoa(e.Version))
+	}
+	if !e.ProducedAt.IsZero() {
+		set(HeaderProducedAt, e.ProducedAt.UTC().Format(time.RFC3339Nano))
+	}
+	set(HeaderProducer, e.Producer)
+	set(HeaderTenant, e.Tenant)
+	set(HeaderTraceParent, e.TraceParent)
+	set(HeaderTraceState, e.TraceState)
+	return headers
+}
+
+// Context 返回携带信封元数据和远端调用链的上下文，用于在消费回调中继续调用下游服务
+func (e Envelope) Context(parent context.Context) context.Context {
+	ctx := otel.GetTextMapPropagator().Extract(parent, headerCarrier(e.Headers()))
+	if e.Tenant != "" {
+		ctx = ctxmeta.WithTenant(ctx, e.Tenant)
+	}
+	return context.WithValue(ctx, envelopeContextKey{}, e)
+}
+
+// newEnvelope 根据上下文生成本次发送的信封
+func newEnvelope(ctx context.Context, producer string) Envelope {
+	env := EnvelopeFromContext(ctx)
+	env.MessageID = newMessageID()
+	env.ProducedAt = time.Now()
+	env.Producer = producer
+
+	carrier := headerCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	env.TraceParent = string(carrier[HeaderTraceParent])
+	env.TraceState = string(carrier[HeaderTraceState])
+	return env
+}
+
+// newMessageID 生成按时间有序的消息 ID，便于排查时按 ID 定位大致生产时间
+func newMessageID() string {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return uuid.NewString()
+	}
+	return id.String()
+}
+
+// buildRecordHeaders 合并信封和调用方提供的消息头，调用方显式设置的消息头优先
+func buildRecordHeaders(env *Envelope, headers map[string][]byte) []kgo.RecordHeader {
+	var merged map[string][]byte
+	if env != nil {
+		merged = env.Headers()
+	} else {
+		merged = make(map[string][]byte, len(headers))
+	}
+	for k, v := range headers {
+		merged[k] = v
+	}
+	if len(merged) == 0 {
+		return nil
+	}
+
+	recordHeaders := make([]kgo.RecordHeader, 0, len(merged))
+	for k, v := range merged {
+		recordHeaders = append(recordHeaders, kgo.RecordHeader{Key: k, Value: v})
+	}
+	return recordHeaders
+}
+
+// headerCarrier 适配 OpenTelemetry 的 TextMapCarrier
+type headerCarrier map[string][]byte
+
+func (c headerCarrier) Get(key string) string {
+	return string(c[key])
+}
+
+func (c headerCarrier) Set(key, value string) {
+	c[key] = []byte(value)
+}
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// ConsumeMiddleware 包装消费回调，可在回调前后读取 Message.Envelope 实现去重、租户校验、日志等通用逻辑
+type ConsumeMiddleware func(next ConsumeCallback) ConsumeCallback
+
+// ChainConsumeCallback 按顺序组合中间件，第一个中间件最先执行
+func ChainConsumeCallback(callback ConsumeCallback, middlewares ...ConsumeMiddleware) ConsumeCallback {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		callback = middlewares[i](callback)
+	}
+	return callback
+}
@@ -0,0 +1,358 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+)
+
+// 写入死信主题的消息额外携带的消息头
+const (
+	// HeaderFanOutDestination 投递失败的目标名
+	HeaderFanOutDestination = "X-FanOut-Destination"
+	// HeaderFanOutReason 进入死信的原因："queue_full"、"transform_failed" 或 "send_failed"
+	HeaderFanOutReason = "X-FanOut-Reason"
+)
+
+// FanOutFilter 决定消息是否投递到某个目标，返回 false 表示跳过
+type FanOutFilter func(msg *Message) bool
+
+// FanOutTransform 将源消息转换为发往目标主题的消息。
+// 传入的是该目标独享的副本，可以直接修改后返回；返回 nil 表示跳过该消息。
+// 返回的 Message 只使用 Key、Value 和 Headers 字段。
+type FanOutTransform func(ctx context.Context, msg *Message) (*Message, error)
+
+// FanOutDestination 是扇出的一个目标主题
+type FanOutDestination struct {
+	// Name 目标名，用于日志和统计，在同一个 FanOut 中唯一
+	// 默认：Topic
+	Name string
+	// Topic 目标主题，必填
+	Topic string
+	// Filter 为 nil 时投递所有消息
+	Filter FanOutFilter
+	// Transform 为 nil 时原样转发键、值和消息头
+	Transform FanOutTransform
+	// QueueSize 该目标的待投递队列长度，0 表示使用 FanOutConfig.QueueSize
+	QueueSize int
+}
+
+// FanOutConfig 扇出组件的配置
+type FanOutConfig struct {
+	// SourceTopic 源主题，必填
+	SourceTopic string `json:"sourceTopic" yaml:"sourceTopic"`
+
+	// QueueSize 每个目标的待投递队列长度。
+	// 队列满说明该目标持续跟不上源主题，此时消息直接丢弃（或写入死信主题），不会阻塞其他目标
+	// 默认：1024
+	QueueSize int `json:"queueSize" yaml:"queueSize"`
+
+	// MaxRetries 单条消息发送失败后的最大重试次数
+	// 默认：3
+	MaxRetries int `json:"maxRetries" yaml:"maxRetries"`
+
+	// RetryBackoff 首次重试前的等待时间，之后每次翻倍
+	// 默认：200毫秒
+	RetryBackoff time.Duration `json:"retryBackoff" yaml:"retryBackoff"`
+
+	// DeadLetterTopic 队列满、转换失败或重试耗尽的消息写入的主题，消息头中带有目标名和原因
+	// 默认：""（直接丢弃并计数）
+	DeadLetterTopic string `json:"deadLetterTopic" yaml:"deadLetterTopic"`
+}
+
+// DefaultFanOutConfig 返回默认的扇出配置
+func DefaultFanOutConfig() FanOutConfig {
+	return FanOutConfig{
+		QueueSize:    1024,
+		MaxRetries:   3,
+		RetryBackoff: 200 * time.Millisecond,
+	}
+}
+
+// FanOutStats 是单个目标的投递统计
+type FanOutStats struct {
+	// Name 目标名
+	Name string
+	// Topic 目标主题
+	Topic string
+	// Queued 当前队列中待投递的消息数
+	Queued int
+	// Sent 成功投递的消息数
+	Sent int64
+	// Filtered 被 Filter 或 Transform 跳过的消息数
+	Filtered int64
+	// Failed 转换失败或重试耗尽的消息数
+	Failed int64
+	// Dropped 因队列满被丢弃的消息数
+	Dropped int64
+}
+
+// fanOutTarget 是运行时的目标，每个目标有独立的队列和投递协程
+type fanOutTarget struct {
+	FanOutDestination
+	queue chan *fanOutItem
+
+	sent     atomic.Int64
+	filtered atomic.Int64
+	failed   atomic.Int64
+	dropped  atomic.Int64
+}
+
+// fanOutItem 是队列中待投递的消息
+type fanOutItem struct {
+	ctx context.Context
+	msg *Message
+}
+
+// FanOut 消费一个源主题，并按目标各自的过滤和转换规则投递到多个目标主题。
+//
+// 每个目标有独立的有界队列和投递协程，某个目标变慢或不可用时只会占满自己的队列，
+// 其他目标照常投递；队列满的消息丢弃或写入死信主题，并计入 FanOutStats.Dropped。
+// 源消息入队后即视为已消费，进程崩溃时队列中尚未投递的消息会丢失。
+type FanOut struct {
+	config   FanOutConfig
+	producer Producer
+	consumer Consumer
+	targets  []*fanOutTarget
+	logger   clog.Logger
+}
+
+// NewFanOut 创建扇出组件，consumer 只用于 Run 中订阅源主题，仅调用 HandleMessage 时可以传入 nil
+func NewFanOut(cfg FanOutConfig, producer Producer, consumer Consumer, destinations ...FanOutDestination) (*FanOut, error) {
+	if producer == nil {
+		return nil, NewConfigError("扇出组件需要 producer", ErrInvalidConfig)
+	}
+	if cfg.SourceTopic == "" {
+		return nil, NewConfigError("扇出源主题不能为空", ErrInvalidConfig)
+	}
+	if len(destinations) == 0 {
+		return nil, NewConfigError("扇出至少需要一个目标", ErrInvalidConfig)
+	}
+
+	defaults := DefaultFanOutConfig()
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaults.QueueSize
+	}
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = defaults.MaxRetries
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = defaults.RetryBackoff
+	}
+
+	names := make(map[string]struct{}, len(destinations))
+	targets := make([]*fanOutTarget, 0, len(destinations))
+	for i, dest := range destinations {
+		if dest.Topic == "" {
+			return nil, NewConfigError(fmt.Sprintf("第 %d 个扇出目标缺少主题", i), ErrInvalidConfig)
+		}
+		if dest.Topic == cfg.SourceTopic {
+			return nil, NewConfigError(fmt.Sprintf("扇出目标 %s 不能是源主题", dest.Topic), ErrInvalidConfig)
+		}
+		if dest.Name == "" {
+			dest.Name = dest.Topic
+		}
+		if _, ok := names[dest.Name]; ok {
+			return nil, NewConfigError(fmt.Sprintf("扇出目标 %s 重复", dest.Name), ErrInvalidConfig)
+		}
+		names[dest.Name] = struct{}{}
+		if dest.QueueSize <= 0 {
+			dest.QueueSize = cfg.QueueSize
+		}
+		targets = append(targets, &fanOutTarget{
+			FanOutDestination: dest,
+			queue:             make(chan *fanOutItem, dest.QueueSize),
+		})
+	}
+
+	return &FanOut{
+		config:   cfg,
+		producer: producer,
+		consumer: consumer,
+		targets:  targets,
+		logger:   clog.Namespace("mq.fanout"),
+	}, nil
+}
+
+// Run 启动各目标的投递协程并订阅源主题，直到 ctx 被取消。
+// 返回前会等待投递协程退出，队列中剩余的消息不再投递。
+func (f *FanOut) Run(ctx context.Context) error {
+	if f.consumer == nil {
+		return NewConfigError("运行扇出需要 consumer", ErrInvalidConfig)
+	}
+
+	var wg sync.WaitGroup
+	for _, target := range f.targets {
+		wg.Add(1)
+		go func(t *fanOutTarget) {
+			defer wg.Done()
+			f.deliverLoop(ctx, t)
+		}(target)
+	}
+	defer wg.Wait()
+
+	err := f.consumer.Subscribe(ctx, []string{f.config.SourceTopic}, func(msg *Message, _ TopicPartition, err error) bool {
+		if err != nil {
+			f.logger.Warn("接收扇出源消息失败", clog.Err(err))
+			return true
+		}
+		f.Dispatch(msg.Envelope.Context(ctx), msg)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	f.logger.Info("扇出已启动",
+		clog.String("source", f.config.SourceTopic),
+		clog.Int("destinations", len(f.targets)))
+	<-ctx.Done()
+	return nil
+}
+
+// Dispatch 将源消息放入各目标的队列，不等待投递完成。
+// 某个目标的队列已满时，该目标的这条消息被丢弃或写入死信主题。
+func (f *FanOut) Dispatch(ctx context.Context, msg *Message) {
+	for _, target := range f.targets {
+		item := &fanOutItem{ctx: ctx, msg: msg}
+		select {
+		case target.queue <- item:
+		default:
+			target.dropped.Add(1)
+			f.logger.Warn("扇出目标队列已满，丢弃消息",
+				clog.String("destination", target.Name),
+				clog.String("topic", target.Topic),
+				clog.Int64("offset", msg.Offset))
+			f.deadLetter(ctx, target, msg, "queue_full")
+		}
+	}
+}
+
+// HandleMessage 同步地将源消息依次投递到所有目标，返回第一个失败目标的错误。
+// 不经过队列，适用于测试和手动补投。
+func (f *FanOut) HandleMessage(ctx context.Context, msg *Message) error {
+	var firstErr error
+	for _, target := range f.targets {
+		if err := f.deliver(ctx, target, msg); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Stats 返回各目标的投递统计，顺序与创建时的目标顺序一致
+func (f *FanOut) Stats() []FanOutStats {
+	stats := make([]FanOutStats, len(f.targets))
+	for i, target := range f.targets {
+		stats[i] = FanOutStats{
+			Name:     target.Name,
+			Topic:    target.Topic,
+			Queued:   len(target.queue),
+			Sent:     target.sent.Load(),
+			Filtered: target.filtered.Load(),
+			Failed:   target.failed.Load(),
+			Dropped:  target.dropped.Load(),
+		}
+	}
+	return stats
+}
+
+// deliverLoop 依次投递目标队列中的消息
+func (f *FanOut) deliverLoop(ctx context.Context, target *fanOutTarget) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case item := <-target.queue:
+			_ = f.deliver(item.ctx, target, item.msg)
+		}
+	}
+}
+
+// deliver 对一条消息执行过滤、转换并发送到目标主题，失败时按退避重试
+func (f *FanOut) deliver(ctx context.Context, target *fanOutTarget, msg *Message) error {
+	if target.Filter != nil && !target.Filter(msg) {
+		target.filtered.Add(1)
+		return nil
+	}
+
+	out := cloneMessage(msg)
+	if target.Transform != nil {
+		var err error
+		out, err = target.Transform(ctx, out)
+		if err != nil {
+			target.failed.Add(1)
+			f.logger.Warn("扇出消息转换失败",
+				clog.String("destination", target.Name),
+				clog.Int64("offset", msg.Offset),
+				clog.Err(err))
+			f.deadLetter(ctx, target, msg, "transform_failed")
+			return err
+		}
+		if out == nil {
+			target.filtered.Add(1)
+			return nil
+		}
+	}
+
+	backoff := f.config.RetryBackoff
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = f.producer.SendSyncWithHeaders(ctx, target.Topic, out.Key, out.Value, out.Headers); err == nil {
+			target.sent.Add(1)
+			return nil
+		}
+		if attempt >= f.config.MaxRetries || ctx.Err() != nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+
+	target.failed.Add(1)
+	f.logger.Error("扇出消息投递失败",
+		clog.String("destination", target.Name),
+		clog.String("topic", target.Topic),
+		clog.Int64("offset", msg.Offset),
+		clog.Err(err))
+	f.deadLetter(ctx, target, msg, "send_failed")
+	return err
+}
+
+// deadLetter 将源消息原样写入死信主题，未配置死信主题时什么也不做
+func (f *FanOut) deadLetter(ctx context.Context, target *fanOutTarget, msg *Message, reason string) {
+	if f.config.DeadLetterTopic == "" {
+		return
+	}
+	headers := make(map[string][]byte, len(msg.Headers)+2)
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	headers[HeaderFanOutDestination] = []byte(target.Name)
+	headers[HeaderFanOutReason] = []byte(reason)
+	if err := f.producer.SendSyncWithHeaders(ctx, f.config.DeadLetterTopic, msg.Key, msg.Value, headers); err != nil {
+		f.logger.Error("写入扇出死信主题失败",
+			clog.String("destination", target.Name),
+			clog.String("topic", f.config.DeadLetterTopic),
+			clog.Err(err))
+	}
+}
+
+// cloneMessage 复制消息和消息头，使各目标的转换互不影响
+func cloneMessage(msg *Message) *Message {
+	out := *msg
+	if msg.Headers != nil {
+		out.Headers = make(map[string][]byte, len(msg.Headers))
+		for k, v := range msg.Headers {
+			out.Headers[k] = v
+		}
+	}
+	return &out
+}
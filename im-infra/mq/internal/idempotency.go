@@ -0,0 +1,308 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/google/uuid"
+)
+
+// 幂等键的状态
+const (
+	// IdempotencyStatusProcessing 某个消费者正在处理，租约到期前其他消费者不会重复处理
+	IdempotencyStatusProcessing = "processing"
+	// IdempotencyStatusDone 已处理成功，保留期内重复的键被跳过
+	IdempotencyStatusDone = "done"
+)
+
+// ErrIdempotencyInProgress 相同的键正被另一个消费者处理，消息应稍后重试
+var ErrIdempotencyInProgress = errors.New("幂等键正在被其他消费者处理")
+
+// IdempotencyRecord 是幂等键的处理记录
+type IdempotencyRecord struct {
+	// Key 业务键，如支付单号、消息 ID
+	Key string
+	// Owner 认领该键的处理者，用于保证只有认领者能完成或释放它
+	Owner string
+	// Status 状态，见 IdempotencyStatus*
+	Status string
+	// ExpiresAt 处理中时为租约到期时间，处理成功后为保留到期时间，过期的记录可以被重新认领和清理
+	ExpiresAt time.Time
+	// CreatedAt 首次认领时间
+	CreatedAt time.Time
+	// UpdatedAt 最后更新时间
+	UpdatedAt time.Time
+}
+
+// IdempotencyStore 持久化幂等键。实现必须保证同一个键同时只能被一个处理者认领（如数据库唯一约束）
+type IdempotencyStore interface {
+	// Claim 认领一个键：键不存在或记录已过期时写入 record 并返回 true；
+	// 否则返回 false 和现有记录
+	Claim(ctx context.Context, record *IdempotencyRecord, now time.Time) (bool, *IdempotencyRecord, error)
+
+	// Complete 将 owner 认领的键标记为处理成功并设置保留到期时间，键已被其他处理者接管时返回 false
+	Complete(ctx context.Context, key, owner string, expiresAt, now time.Time) (bool, error)
+
+	// Release 删除 owner 认领但处理失败的键，使其可以被重新处理
+	Release(ctx context.Context, key, owner string) error
+
+	// Get 返回键的记录，不存在时返回 nil
+	Get(ctx context.Context, key string) (*IdempotencyRecord, error)
+
+	// DeleteExpired 删除 before 之前过期的记录，每次最多 limit 条，返回删除的条数
+	DeleteExpired(ctx context.Context, before time.Time, limit int) (int64, error)
+}
+
+// IdempotencyConfig 幂等处理器的配置
+type IdempotencyConfig struct {
+	// TTL 处理成功的键的保留时间，期间重复的键被跳过。应大于消息可能被重复投递的最长间隔
+	// 默认：7天
+	TTL time.Duration `json:"ttl" yaml:"ttl"`
+
+	// Lease 处理中的键的租约。处理者崩溃后，租约到期其他消费者才能接管该键，
+	// 应大于处理函数的最长耗时，否则慢的处理可能被重复执行
+	// 默认：5分钟
+	Lease time.Duration `json:"lease" yaml:"lease"`
+
+	// CleanupInterval Run 清理过期记录的间隔
+	// 默认：10分钟
+	CleanupInterval time.Duration `json:"cleanupInterval" yaml:"cleanupInterval"`
+
+	// CleanupBatch 每次删除过期记录的最大条数，一轮清理会分批删除直到没有过期记录
+	// 默认：1000
+	CleanupBatch int `json:"cleanupBatch" yaml:"cleanupBatch"`
+}
+
+// DefaultIdempotencyConfig 返回默认的幂等处理器配置
+func DefaultIdempotencyConfig() IdempotencyConfig {
+	return IdempotencyConfig{
+		TTL:             7 * 24 * time.Hour,
+		Lease:           5 * time.Minute,
+		CleanupInterval: 10 * time.Minute,
+		CleanupBatch:    1000,
+	}
+}
+
+// Idempotency 按业务键保证处理函数只成功执行一次。
+//
+// 与按消息 ID 去重不同，业务键由调用方决定（如支付单号），同一业务操作经不同消息重复到达时同样只处理一次；
+// 键保存在 IdempotencyStore 中，不依赖 Redis，缓存被清空后仍然有效。
+// 处理函数成功后键被标记为已处理，失败时键被释放，消息重投时会再次执行。
+// 处理成功但标记写入前进程崩溃时，租约到期后键会被重新处理，因此处理函数本身仍应尽量可重入。
+type Idempotency struct {
+	config IdempotencyConfig
+	store  IdempotencyStore
+	logger clog.Logger
+
+	// now 返回当前时间，测试中可替换
+	now func() time.Time
+}
+
+// NewIdempotency 创建幂等处理器
+func NewIdempotency(cfg IdempotencyConfig, store IdempotencyStore) (*Idempotency, error) {
+	if store == nil {
+		return nil, NewConfigError("幂等处理器需要 store", ErrInvalidConfig)
+	}
+
+	defaults := DefaultIdempotencyConfig()
+	if cfg.TTL <= 0 {
+		cfg.TTL = defaults.TTL
+	}
+	if cfg.Lease <= 0 {
+		cfg.Lease = defaults.Lease
+	}
+	if cfg.CleanupInterval <= 0 {
+		cfg.CleanupInterval = defaults.CleanupInterval
+	}
+	if cfg.CleanupBatch <= 0 {
+		cfg.CleanupBatch = defaults.CleanupBatch
+	}
+
+	return &Idempotency{
+		config: cfg,
+		store:  store,
+		logger: clog.Namespace("mq.idempotency"),
+		now:    time.Now,
+	}, nil
+}
+
+// Execute 以 key 为幂等键执行 fn：键已处理成功时直接返回 nil 且不执行 fn；
+// 键正被其他消费者处理时返回 ErrIdempotencyInProgress，调用方应让消息稍后重试；
+// 否则执行 fn，成功后记录该键，失败时释放该键并返回 fn 的错误。
+func (i *Idempotency) Execute(ctx context.Context, key string, fn func(ctx context.Context) error) error {
+	if key == "" {
+		return errors.New("幂等键不能为空")
+	}
+
+	now := i.now()
+	record := &IdempotencyRecord{
+		Key:       key,
+		Owner:     uuid.NewString(),
+		Status:    IdempotencyStatusProcessing,
+		ExpiresAt: now.Add(i.config.Lease),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	claimed, existing, err := i.store.Claim(ctx, record, now)
+	if err != nil {
+		return fmt.Errorf("认领幂等键失败: %w", err)
+	}
+	if !claimed {
+		if existing != nil && existing.Status == IdempotencyStatusDone {
+			i.logger.Debug("跳过已处理的幂等键", clog.String("key", key))
+			return nil
+		}
+		return ErrIdempotencyInProgress
+	}
+
+	if err := i.invoke(ctx, fn); err != nil {
+		// 释放失败时键在租约到期后仍可被重新处理，不掩盖 fn 的错误
+		if releaseErr := i.store.Release(context.WithoutCancel(ctx), key, record.Owner); releaseErr != nil {
+			i.logger.Warn("释放幂等键失败", clog.String("key", key), clog.Err(releaseErr))
+		}
+		return err
+	}
+
+	now = i.now()
+	ok, err := i.store.Complete(context.WithoutCancel(ctx), key, record.Owner, now.Add(i.config.TTL), now)
+	if err != nil {
+		// fn 已经成功，返回错误会导致消息重投；租约到期前重投的消息会得到 ErrIdempotencyInProgress
+		return fmt.Errorf("记录幂等键失败: %w", err)
+	}
+	if !ok {
+		i.logger.Warn("幂等键的租约已过期并被其他消费者接管，处理可能被重复执行，请调大 Lease",
+			clog.String("key", key),
+			clog.Duration("lease", i.config.Lease))
+	}
+	return nil
+}
+
+// Processed 返回键是否已处理成功且仍在保留期内
+func (i *Idempotency) Processed(ctx context.Context, key string) (bool, error) {
+	record, err := i.store.Get(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	return record != nil && record.Status == IdempotencyStatusDone && record.ExpiresAt.After(i.now()), nil
+}
+
+// Cleanup 分批删除所有已过期的记录，返回删除的条数
+func (i *Idempotency) Cleanup(ctx context.Context) (int64, error) {
+	now := i.now()
+	var total int64
+	for {
+		n, err := i.store.DeleteExpired(ctx, now, i.config.CleanupBatch)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if n < int64(i.config.CleanupBatch) {
+			return total, nil
+		}
+	}
+}
+
+// Run 周期性地清理过期记录，直到 ctx 被取消。可以在多个实例上同时运行
+func (i *Idempotency) Run(ctx context.Context) error {
+	ticker := time.NewTicker(i.config.CleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			n, err := i.Cleanup(ctx)
+			if err != nil && ctx.Err() == nil {
+				i.logger.Warn("清理过期幂等键失败", clog.Int64("deleted", n), clog.Err(err))
+				continue
+			}
+			if n > 0 {
+				i.logger.Info("已清理过期幂等键", clog.Int64("deleted", n))
+			}
+		}
+	}
+}
+
+// invoke 执行处理函数，panic 视为失败
+func (i *Idempotency) invoke(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("处理函数 panic: %v", r)
+		}
+	}()
+	return fn(ctx)
+}
+
+// memoryIdempotencyStore 是基于内存的 IdempotencyStore，仅用于测试和单实例开发环境
+type memoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]IdempotencyRecord
+}
+
+// NewMemoryIdempotencyStore 创建基于内存的 IdempotencyStore，进程重启后记录丢失，仅用于测试和单实例开发环境
+func NewMemoryIdempotencyStore() IdempotencyStore {
+	return &memoryIdempotencyStore{records: make(map[string]IdempotencyRecord)}
+}
+
+func (s *memoryIdempotencyStore) Claim(_ context.Context, record *IdempotencyRecord, now time.Time) (bool, *IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if current, ok := s.records[record.Key]; ok && current.ExpiresAt.After(now) {
+		return false, &current, nil
+	}
+	s.records[record.Key] = *record
+	return true, nil, nil
+}
+
+func (s *memoryIdempotencyStore) Complete(_ context.Context, key, owner string, expiresAt, now time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, ok := s.records[key]
+	if !ok || current.Owner != owner {
+		return false, nil
+	}
+	current.Status = IdempotencyStatusDone
+	current.ExpiresAt = expiresAt
+	current.UpdatedAt = now
+	s.records[key] = current
+	return true, nil
+}
+
+func (s *memoryIdempotencyStore) Release(_ context.Context, key, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if current, ok := s.records[key]; ok && current.Owner == owner && current.Status == IdempotencyStatusProcessing {
+		delete(s.records, key)
+	}
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Get(_ context.Context, key string) (*IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, ok := s.records[key]
+	if !ok {
+		return nil, nil
+	}
+	return &current, nil
+}
+
+func (s *memoryIdempotencyStore) DeleteExpired(_ context.Context, before time.Time, limit int) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var deleted int64
+	for key, record := range s.records {
+		if limit > 0 && deleted >= int64(limit) {
+			break
+		}
+		if record.ExpiresAt.Before(before) {
+			delete(s.records, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
@@ -95,6 +95,15 @@ type Consumer interface {
 
 	// GetMetrics 获取消费者性能指标
 	GetMetrics() ConsumerMetrics
+
+	// SetTopicTuning 在运行时覆盖主题的调优参数，非零字段覆盖配置中的值，传入零值恢复为配置
+	SetTopicTuning(topic string, tuning TopicTuning) error
+
+	// GetTopicTuning 返回主题当前生效的调优参数
+	GetTopicTuning(topic string) TopicTuning
+
+	// OverloadStats 返回过载降级的状态和丢弃计数，未配置 ConsumerConfig.Overload 时返回零值
+	OverloadStats() OverloadStats
 }
 
 // ConnectionPool 定义连接池管理器的接口。
@@ -189,6 +198,9 @@ type Message struct {
 
 	// Timestamp 消息时间戳
 	Timestamp time.Time
+
+	// Envelope 从消息头解析出的标准元数据，仅在消费时填充，发送时忽略
+	Envelope Envelope
 }
 
 // MessageBatch 消息批次结构体
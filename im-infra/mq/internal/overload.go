@@ -0,0 +1,377 @@
+package internal
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+)
+
+// MessagePriority 消息优先级，决定消费者过载时是否降级处理
+type MessagePriority int
+
+const (
+	// PriorityHigh 高优先级（默认），过载时照常处理，如聊天消息
+	PriorityHigh MessagePriority = iota
+	// PriorityLow 低优先级，过载时按 OverloadPolicy.Action 丢弃或延后，如输入状态、已读回执
+	PriorityLow
+)
+
+// 过载时低优先级消息的处理方式
+const (
+	// OverloadActionShed 直接丢弃并照常提交偏移量
+	OverloadActionShed = "shed"
+	// OverloadActionDefer 暂存在内存中，解除过载后补处理；暂存已满或超过 DeferTTL 的消息被丢弃
+	OverloadActionDefer = "defer"
+)
+
+// overloadEvaluateInterval 过载状态的最短评估间隔，避免每条消息都汇总积压
+const overloadEvaluateInterval = 100 * time.Millisecond
+
+// overloadLatencyAlpha 处理耗时指数加权平均的平滑系数
+const overloadLatencyAlpha = 0.2
+
+// OverloadPolicy 消费者过载时的分级降级策略：
+// 处理耗时或积压超过阈值时进入过载，丢弃或延后低优先级消息，高优先级消息照常处理；
+// 两项指标都降到阈值的 RecoveryRatio 以下并持续 RecoveryDelay 后解除过载（迟滞，避免状态抖动）。
+type OverloadPolicy struct {
+	// Types 消息类型（Envelope.Type）到优先级的映射，优先于 Topics
+	Types map[string]MessagePriority `json:"types,omitempty" yaml:"types,omitempty"`
+
+	// Topics 主题到优先级的映射，未列出的消息为 PriorityHigh
+	Topics map[string]MessagePriority `json:"topics,omitempty" yaml:"topics,omitempty"`
+
+	// LatencyThreshold 回调处理耗时的指数加权平均超过该值时进入过载，0 表示不按耗时判断
+	LatencyThreshold time.Duration `json:"latencyThreshold,omitempty" yaml:"latencyThreshold,omitempty"`
+
+	// BacklogThreshold 所有主题已拉取但未处理完的消息总数超过该值时进入过载，0 表示不按积压判断
+	BacklogThreshold int `json:"backlogThreshold,omitempty" yaml:"backlogThreshold,omitempty"`
+
+	// RecoveryRatio 恢复线相对阈值的比例，取值 (0, 1]
+	// 默认：0.7
+	RecoveryRatio float64 `json:"recoveryRatio,omitempty" yaml:"recoveryRatio,omitempty"`
+
+	// RecoveryDelay 指标持续低于恢复线多久后解除过载
+	// 默认：5秒
+	RecoveryDelay time.Duration `json:"recoveryDelay,omitempty" yaml:"recoveryDelay,omitempty"`
+
+	// Action 过载时低优先级消息的处理方式："shed"、"defer"
+	// 默认："shed"
+	Action string `json:"action,omitempty" yaml:"action,omitempty"`
+
+	// MaxDeferred defer 模式下最多暂存的消息数，超过后丢弃
+	// 默认：10000
+	MaxDeferred int `json:"maxDeferred,omitempty" yaml:"maxDeferred,omitempty"`
+
+	// DeferTTL defer 模式下暂存消息的有效期，补处理时超过有效期的消息被丢弃
+	// 默认：30秒
+	DeferTTL time.Duration `json:"deferTTL,omitempty" yaml:"deferTTL,omitempty"`
+}
+
+// PriorityOf 返回消息的优先级：先按消息类型，再按主题，都未配置时为 PriorityHigh
+func (p *OverloadPolicy) PriorityOf(msg *Message) MessagePriority {
+	if priority, ok := p.Types[msg.Envelope.Type]; ok && msg.Envelope.Type != "" {
+		return priority
+	}
+	if priority, ok := p.Topics[msg.Topic]; ok {
+		return priority
+	}
+	return PriorityHigh
+}
+
+// validate 校验降级策略
+func (p *OverloadPolicy) validate() error {
+	if p.LatencyThreshold < 0 || p.BacklogThreshold < 0 {
+		return fmt.Errorf("过载阈值不能为负数")
+	}
+	if p.LatencyThreshold == 0 && p.BacklogThreshold == 0 {
+		return fmt.Errorf("至少需要设置 latencyThreshold 或 backlogThreshold")
+	}
+	if p.RecoveryRatio < 0 || p.RecoveryRatio > 1 {
+		return fmt.Errorf("恢复比例必须在 (0, 1] 之间: %v", p.RecoveryRatio)
+	}
+	if p.RecoveryDelay < 0 || p.MaxDeferred < 0 || p.DeferTTL < 0 {
+		return fmt.Errorf("恢复延迟、暂存上限和暂存有效期不能为负数")
+	}
+	switch p.Action {
+	case "", OverloadActionShed, OverloadActionDefer:
+	default:
+		return fmt.Errorf("未知的过载处理方式: %s", p.Action)
+	}
+	return nil
+}
+
+// withDefaults 返回填充了默认值的策略副本
+func (p OverloadPolicy) withDefaults() OverloadPolicy {
+	if p.RecoveryRatio == 0 {
+		p.RecoveryRatio = 0.7
+	}
+	if p.RecoveryDelay == 0 {
+		p.RecoveryDelay = 5 * time.Second
+	}
+	if p.Action == "" {
+		p.Action = OverloadActionShed
+	}
+	if p.MaxDeferred == 0 {
+		p.MaxDeferred = 10000
+	}
+	if p.DeferTTL == 0 {
+		p.DeferTTL = 30 * time.Second
+	}
+	return p
+}
+
+// OverloadStats 过载降级的运行状态和计数
+type OverloadStats struct {
+	// Overloaded 当前是否处于过载状态
+	Overloaded bool
+
+	// Since 最近一次进入或解除过载的时间
+	Since time.Time
+
+	// Latency 回调处理耗时的指数加权平均
+	Latency time.Duration
+
+	// Backlog 最近一次评估时已拉取但未处理完的消息总数
+	Backlog int
+
+	// Shed 被丢弃的低优先级消息数（含暂存已满和过期的消息）
+	Shed int64
+
+	// Deferred 被暂存的低优先级消息数
+	Deferred int64
+
+	// Replayed 解除过载后补处理的消息数
+	Replayed int64
+
+	// ShedByClass 按消息类型统计的丢弃数，没有消息类型时按主题统计
+	ShedByClass map[string]int64
+}
+
+// deferredMessage 暂存的低优先级消息
+type deferredMessage struct {
+	message    *Message
+	deferredAt time.Time
+}
+
+// overloadController 跟踪消费者的负载并决定低优先级消息是否降级处理，未配置策略时为 nil，所有方法对 nil 安全
+type overloadController struct {
+	policy  OverloadPolicy
+	backlog func() int
+	replay  func([]*Message)
+	logger  clog.Logger
+
+	mu          sync.Mutex
+	overloaded  bool
+	since       time.Time
+	belowSince  time.Time // 首次低于恢复线的时间，零值表示尚未低于
+	latency     float64   // 处理耗时的指数加权平均（纳秒）
+	lastSample  time.Time
+	lastEval    time.Time
+	lastBacklog int
+	deferred    []deferredMessage
+	stats       OverloadStats
+}
+
+// newOverloadController 创建过载控制器，policy 为 nil 时返回 nil。
+// backlog 返回当前积压，replay 用于解除过载后将暂存的消息交回调度器补处理。
+func newOverloadController(policy *OverloadPolicy, backlog func() int, replay func([]*Message), logger clog.Logger) *overloadController {
+	if policy == nil {
+		return nil
+	}
+	return &overloadController{
+		policy:  policy.withDefaults(),
+		backlog: backlog,
+		replay:  replay,
+		logger:  logger,
+		since:   time.Now(),
+		stats:   OverloadStats{ShedByClass: make(map[string]int64)},
+	}
+}
+
+// start 启动后台协程按 overloadEvaluateInterval 定期评估过载状态，
+// 没有新消息到达时也能按时解除过载并补处理暂存的消息，返回的函数停止协程并等待其退出
+func (o *overloadController) start() (stop func()) {
+	if o == nil {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(overloadEvaluateInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				o.maybeEvaluate()
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		wg.Wait()
+	}
+}
+
+// admit 判断消息是否应该立即处理，过载时低优先级消息被丢弃或暂存并返回 false
+func (o *overloadController) admit(msg *Message) bool {
+	if o == nil {
+		return true
+	}
+	o.maybeEvaluate()
+	if o.policy.PriorityOf(msg) != PriorityLow {
+		return true
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.overloaded {
+		return true
+	}
+	if o.policy.Action == OverloadActionDefer && len(o.deferred) < o.policy.MaxDeferred {
+		o.deferred = append(o.deferred, deferredMessage{message: msg, deferredAt: time.Now()})
+		o.stats.Deferred++
+		return false
+	}
+	o.shed(msg)
+	return false
+}
+
+// shed 记录一条被丢弃的消息，调用方需持有锁
+func (o *overloadController) shed(msg *Message) {
+	class := msg.Envelope.Type
+	if class == "" {
+		class = msg.Topic
+	}
+	o.stats.Shed++
+	o.stats.ShedByClass[class]++
+}
+
+// observe 记录一次回调处理耗时
+func (o *overloadController) observe(d time.Duration) {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	if o.lastSample.IsZero() {
+		o.latency = float64(d)
+	} else {
+		o.latency += overloadLatencyAlpha * (float64(d) - o.latency)
+	}
+	o.lastSample = time.Now()
+	o.mu.Unlock()
+
+	o.maybeEvaluate()
+}
+
+// maybeEvaluate 距上次评估超过 overloadEvaluateInterval 时重新评估过载状态，解除过载时补处理暂存的消息
+func (o *overloadController) maybeEvaluate() {
+	now := time.Now()
+	o.mu.Lock()
+	if now.Sub(o.lastEval) < overloadEvaluateInterval {
+		o.mu.Unlock()
+		return
+	}
+	o.lastEval = now
+	o.mu.Unlock()
+
+	// 汇总积压需要获取调度器的锁，在持有控制器锁之外进行
+	backlog := o.backlog()
+
+	o.mu.Lock()
+	replay := o.evaluate(now, backlog)
+	o.mu.Unlock()
+
+	if len(replay) > 0 {
+		o.replay(replay)
+	}
+}
+
+// evaluate 按当前指标切换过载状态，解除过载时返回仍在有效期内的暂存消息，调用方需持有锁
+func (o *overloadController) evaluate(now time.Time, backlog int) []*Message {
+	o.lastBacklog = backlog
+
+	// 长时间没有完成的回调时不再沿用旧的耗时，避免只收到被丢弃的低优先级消息时无法恢复；
+	// 回调卡住的情况由积压阈值兜底
+	if !o.lastSample.IsZero() && now.Sub(o.lastSample) > o.policy.RecoveryDelay {
+		o.latency = 0
+	}
+
+	latencyThreshold := float64(o.policy.LatencyThreshold)
+	backlogThreshold := float64(o.policy.BacklogThreshold)
+	over := (latencyThreshold > 0 && o.latency > latencyThreshold) ||
+		(backlogThreshold > 0 && float64(backlog) > backlogThreshold)
+
+	if !o.overloaded {
+		if over {
+			o.overloaded = true
+			o.since = now
+			o.belowSince = time.Time{}
+			o.logger.Warn("消费者过载，开始降级低优先级消息",
+				clog.Duration("latency", time.Duration(o.latency)),
+				clog.Int("backlog", backlog),
+				clog.String("action", o.policy.Action))
+		}
+		return nil
+	}
+
+	recovered := (latencyThreshold == 0 || o.latency <= latencyThreshold*o.policy.RecoveryRatio) &&
+		(backlogThreshold == 0 || float64(backlog) <= backlogThreshold*o.policy.RecoveryRatio)
+	if !recovered {
+		o.belowSince = time.Time{}
+		return nil
+	}
+	if o.belowSince.IsZero() {
+		o.belowSince = now
+	}
+	if now.Sub(o.belowSince) < o.policy.RecoveryDelay {
+		return nil
+	}
+
+	o.overloaded = false
+	o.since = now
+	var replay []*Message
+	for _, d := range o.deferred {
+		if now.Sub(d.deferredAt) > o.policy.DeferTTL {
+			o.shed(d.message)
+			continue
+		}
+		replay = append(replay, d.message)
+	}
+	o.deferred = nil
+	o.stats.Replayed += int64(len(replay))
+	o.logger.Info("消费者负载恢复，停止降级",
+		clog.Duration("latency", time.Duration(o.latency)),
+		clog.Int("backlog", backlog),
+		clog.Int("replay", len(replay)),
+		clog.Int64("shed_total", o.stats.Shed))
+	return replay
+}
+
+// snapshot 返回过载降级的运行状态
+func (o *overloadController) snapshot() OverloadStats {
+	if o == nil {
+		return OverloadStats{}
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	stats := o.stats
+	stats.Overloaded = o.overloaded
+	stats.Since = o.since
+	stats.Latency = time.Duration(o.latency)
+	stats.Backlog = o.lastBacklog
+	stats.ShedByClass = make(map[string]int64, len(o.stats.ShedByClass))
+	for class, count := range o.stats.ShedByClass {
+		stats.ShedByClass[class] = count
+	}
+	return stats
+}
@@ -192,15 +192,8 @@ func (p *producer) SendSyncWithHeaders(ctx context.Context, topic string, key []
 		Value: message,
 	}
 
-	// 添加头部信息
-	if headers != nil {
-		for k, v := range headers {
-			record.Headers = append(record.Headers, kgo.RecordHeader{
-				Key:   k,
-				Value: v,
-			})
-		}
-	}
+	// 添加信封和头部信息
+	record.Headers = buildRecordHeaders(p.envelope(ctx), headers)
 
 	// 同步发送
 	results := p.client.ProduceSync(ctx, record)
@@ -225,6 +218,19 @@ func (p *producer) SendSyncWithHeaders(ctx context.Context, topic string, key []
 	return nil
 }
 
+// envelope 生成本次发送的信封，关闭信封时返回 nil
+func (p *producer) envelope(ctx context.Context) *Envelope {
+	if p.config.DisableEnvelope {
+		return nil
+	}
+	service := p.config.ServiceName
+	if service == "" {
+		service = p.config.ClientID
+	}
+	env := newEnvelope(ctx, service)
+	return &env
+}
+
 // SendAsync 异步发送单条消息
 func (p *producer) SendAsync(ctx context.Context, topic string, message []byte, callback func(error)) {
 	p.SendAsyncWithHeaders(ctx, topic, nil, message, nil, callback)
@@ -262,15 +268,8 @@ func (p *producer) SendAsyncWithHeaders(ctx context.Context, topic string, key [
 		Value: message,
 	}
 
-	// 添加头部信息
-	if headers != nil {
-		for k, v := range headers {
-			record.Headers = append(record.Headers, kgo.RecordHeader{
-				Key:   k,
-				Value: v,
-			})
-		}
-	}
+	// 添加信封和头部信息
+	record.Headers = buildRecordHeaders(p.envelope(ctx), headers)
 
 	// 异步发送
 	p.client.Produce(ctx, record, func(r *kgo.Record, err error) {
@@ -338,15 +337,8 @@ func (p *producer) SendBatchSync(ctx context.Context, batch MessageBatch) ([]Pro
 			Value: msg.Value,
 		}
 
-		// 添加头部信息
-		if msg.Headers != nil {
-			for k, v := range msg.Headers {
-				record.Headers = append(record.Headers, kgo.RecordHeader{
-					Key:   k,
-					Value: v,
-				})
-			}
-		}
+		// 添加信封和头部信息，每条消息使用独立的消息 ID
+		record.Headers = buildRecordHeaders(p.envelope(ctx), msg.Headers)
 
 		records[i] = record
 	}
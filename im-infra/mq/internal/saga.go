@@ -0,0 +1,693 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+)
+
+// Saga 的状态
+const (
+	// SagaStatusRunning 正在依次执行各步骤的动作
+	SagaStatusRunning = "running"
+	// SagaStatusCompensating 某一步失败或超时，正在逆序执行已完成步骤的补偿
+	SagaStatusCompensating = "compensating"
+	// SagaStatusCompleted 所有步骤执行成功
+	SagaStatusCompleted = "completed"
+	// SagaStatusCompensated 补偿全部完成
+	SagaStatusCompensated = "compensated"
+	// SagaStatusFailed 补偿重试耗尽，需要人工介入
+	SagaStatusFailed = "failed"
+)
+
+// sagaMessageType 步骤消息的 Envelope.Type
+const sagaMessageType = "saga.step"
+
+var (
+	// ErrSagaNotFound Saga 不存在
+	ErrSagaNotFound = errors.New("saga 不存在")
+
+	// ErrSagaExists 相同 ID 的 Saga 已存在
+	ErrSagaExists = errors.New("saga 已存在")
+)
+
+// SagaExecution 是传给步骤动作和补偿的执行信息
+type SagaExecution struct {
+	// SagaID Saga 实例 ID
+	SagaID string
+	// Saga Saga 定义名
+	Saga string
+	// Step 步骤名
+	Step string
+	// Compensating 为 true 时表示正在执行补偿
+	Compensating bool
+	// Payload 启动 Saga 时传入的业务数据
+	Payload []byte
+	// IdempotencyKey 本次动作或补偿的幂等键，消息重投或超时重试时保持不变，
+	// 下游服务应据此去重，使步骤的副作用只生效一次
+	IdempotencyKey string
+}
+
+// SagaStepFunc 步骤的动作或补偿，返回 error 表示失败
+type SagaStepFunc func(ctx context.Context, exec *SagaExecution) error
+
+// SagaStep 是 Saga 中的一个步骤
+type SagaStep struct {
+	// Name 步骤名，在同一个 Saga 中唯一
+	Name string
+	// Action 正向动作，必填
+	Action SagaStepFunc
+	// Compensate 补偿动作，为 nil 表示该步骤无需补偿（如只读校验、通知）
+	// 超时的步骤可能已经执行也可能没有执行，补偿需要能处理两种情况
+	Compensate SagaStepFunc
+	// Timeout 步骤的超时时间，0 表示使用 SagaConfig.StepTimeout
+	Timeout time.Duration
+}
+
+// SagaDefinition 定义一个多步骤的分布式流程，如 预留库存 → 扣款 → 通知
+type SagaDefinition struct {
+	// Name Saga 定义名，全局唯一
+	Name string
+	// Steps 按顺序执行的步骤
+	Steps []SagaStep
+}
+
+// SagaState 是持久化的 Saga 实例状态
+type SagaState struct {
+	// ID Saga 实例 ID
+	ID string
+	// Name Saga 定义名
+	Name string
+	// Status 当前状态
+	Status string
+	// Step 正在执行动作或补偿的步骤序号
+	Step int
+	// Payload 启动时传入的业务数据
+	Payload []byte
+	// Error 触发补偿的错误，以及补偿失败时最后一次的错误
+	Error string
+	// Attempts 当前步骤的补偿已投递的次数
+	Attempts int
+	// Version 乐观锁版本号，每次状态变更加一，步骤消息携带发送时的版本号
+	Version int64
+	// Deadline 当前步骤的截止时间，超过后动作按超时处理、补偿重新投递
+	Deadline time.Time
+	// CreatedAt 创建时间
+	CreatedAt time.Time
+	// UpdatedAt 最后一次状态变更的时间
+	UpdatedAt time.Time
+}
+
+// Terminal 判断 Saga 是否已结束
+func (s *SagaState) Terminal() bool {
+	switch s.Status {
+	case SagaStatusCompleted, SagaStatusCompensated, SagaStatusFailed:
+		return true
+	default:
+		return false
+	}
+}
+
+// SagaQuery 是 SagaStore.List 的查询条件，零值字段不参与过滤
+type SagaQuery struct {
+	// Statuses 只返回这些状态的 Saga
+	Statuses []string
+	// UpdatedBefore 只返回最后一次状态变更早于该时间的 Saga
+	UpdatedBefore time.Time
+	// DeadlineBefore 只返回截止时间早于该时间的 Saga
+	DeadlineBefore time.Time
+	// Limit 最多返回的数量，0 表示不限制
+	Limit int
+}
+
+// SagaStore 持久化 Saga 状态。实现必须保证 Update 的比较并交换语义，
+// 这是步骤消息重复投递时只推进一次状态的基础。
+type SagaStore interface {
+	// Create 保存新的 Saga，ID 已存在时返回 ErrSagaExists
+	Create(ctx context.Context, state *SagaState) error
+
+	// Get 读取 Saga 的最新状态，不存在时返回 ErrSagaNotFound
+	Get(ctx context.Context, id string) (*SagaState, error)
+
+	// Update 仅当存储中的版本号等于 expectedVersion 时写入 state，返回是否写入
+	Update(ctx context.Context, state *SagaState, expectedVersion int64) (bool, error)
+
+	// List 按条件查询 Saga，结果按 UpdatedAt 升序
+	List(ctx context.Context, query SagaQuery) ([]*SagaState, error)
+}
+
+// SagaConfig Saga 编排器的配置
+type SagaConfig struct {
+	// Topic 步骤消息的主题，消息键为 Saga ID，同一 Saga 的消息落在同一分区
+	// 默认："gochat.saga.steps"
+	Topic string `json:"topic" yaml:"topic"`
+
+	// StepTimeout 步骤的默认超时时间
+	// 默认：30秒
+	StepTimeout time.Duration `json:"stepTimeout" yaml:"stepTimeout"`
+
+	// MaxCompensationAttempts 单个步骤补偿的最大尝试次数，耗尽后 Saga 进入 failed 状态。
+	// 补偿失败或超时后，在下一次扫描超时 Saga 时重新投递
+	// 默认：5
+	MaxCompensationAttempts int `json:"maxCompensationAttempts" yaml:"maxCompensationAttempts"`
+
+	// CheckInterval 扫描超时 Saga 的间隔
+	// 默认：5秒
+	CheckInterval time.Duration `json:"checkInterval" yaml:"checkInterval"`
+}
+
+// DefaultSagaConfig 返回默认的 Saga 编排器配置
+func DefaultSagaConfig() SagaConfig {
+	return SagaConfig{
+		Topic:                   "gochat.saga.steps",
+		StepTimeout:             30 * time.Second,
+		MaxCompensationAttempts: 5,
+		CheckInterval:           5 * time.Second,
+	}
+}
+
+// sagaMessage 是步骤消息的内容
+type sagaMessage struct {
+	SagaID       string `json:"saga_id"`
+	Saga         string `json:"saga"`
+	Step         int    `json:"step"`
+	Compensating bool   `json:"compensating,omitempty"`
+	Version      int64  `json:"version"`
+}
+
+// SagaOrchestrator 编排 Saga 的执行。
+//
+// 每个步骤的动作和补偿通过 mq 投递，由订阅了 SagaConfig.Topic 的实例执行；
+// 状态保存在 SagaStore 中，步骤消息携带发送时的状态版本号，
+// 版本号不匹配的消息（重复投递、超时后迟到的消息）直接丢弃，因此状态只会推进一次。
+// 步骤执行成功但状态写入前进程崩溃时，消息会重新投递并再次执行该步骤，
+// 下游服务应使用 SagaExecution.IdempotencyKey 去重，使副作用恰好生效一次。
+type SagaOrchestrator struct {
+	config   SagaConfig
+	producer Producer
+	consumer Consumer
+	store    SagaStore
+	logger   clog.Logger
+
+	mu          sync.RWMutex
+	definitions map[string]*SagaDefinition
+
+	// now 返回当前时间，测试中可替换
+	now func() time.Time
+}
+
+// NewSagaOrchestrator 创建 Saga 编排器，producer 用于投递步骤消息，consumer 用于在 Run 中执行步骤；
+// 只启动 Saga 和查询状态的实例可以传入 nil consumer。
+func NewSagaOrchestrator(cfg SagaConfig, producer Producer, consumer Consumer, store SagaStore) (*SagaOrchestrator, error) {
+	if producer == nil {
+		return nil, NewConfigError("saga 编排器需要 producer", ErrInvalidConfig)
+	}
+	if store == nil {
+		return nil, NewConfigError("saga 编排器需要 store", ErrInvalidConfig)
+	}
+
+	defaults := DefaultSagaConfig()
+	if cfg.Topic == "" {
+		cfg.Topic = defaults.Topic
+	}
+	if cfg.StepTimeout <= 0 {
+		cfg.StepTimeout = defaults.StepTimeout
+	}
+	if cfg.MaxCompensationAttempts <= 0 {
+		cfg.MaxCompensationAttempts = defaults.MaxCompensationAttempts
+	}
+	if cfg.CheckInterval <= 0 {
+		cfg.CheckInterval = defaults.CheckInterval
+	}
+
+	return &SagaOrchestrator{
+		config:      cfg,
+		producer:    producer,
+		consumer:    consumer,
+		store:       store,
+		logger:      clog.Namespace("mq.saga"),
+		definitions: make(map[string]*SagaDefinition),
+		now:         time.Now,
+	}, nil
+}
+
+// Register 注册 Saga 定义，执行步骤的实例必须注册所有会收到的 Saga
+func (o *SagaOrchestrator) Register(def SagaDefinition) error {
+	if def.Name == "" {
+		return NewConfigError("saga 名称不能为空", ErrInvalidConfig)
+	}
+	if len(def.Steps) == 0 {
+		return NewConfigError(fmt.Sprintf("saga %s 没有步骤", def.Name), ErrInvalidConfig)
+	}
+	names := make(map[string]struct{}, len(def.Steps))
+	for i, step := range def.Steps {
+		if step.Name == "" || step.Action == nil {
+			return NewConfigError(fmt.Sprintf("saga %s 的第 %d 个步骤缺少名称或动作", def.Name, i), ErrInvalidConfig)
+		}
+		if _, ok := names[step.Name]; ok {
+			return NewConfigError(fmt.Sprintf("saga %s 的步骤 %s 重复", def.Name, step.Name), ErrInvalidConfig)
+		}
+		names[step.Name] = struct{}{}
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if _, ok := o.definitions[def.Name]; ok {
+		return NewConfigError(fmt.Sprintf("saga %s 已注册", def.Name), ErrInvalidConfig)
+	}
+	o.definitions[def.Name] = &def
+	return nil
+}
+
+// Start 创建并启动一个 Saga 实例，返回时状态已持久化、第一个步骤的消息已投递。
+// id 由调用方生成（如订单号），重复启动同一 ID 返回 ErrSagaExists。
+func (o *SagaOrchestrator) Start(ctx context.Context, name, id string, payload []byte) error {
+	def, ok := o.definition(name)
+	if !ok {
+		return fmt.Errorf("saga %s 未注册", name)
+	}
+	if id == "" {
+		return errors.New("saga ID 不能为空")
+	}
+
+	now := o.now()
+	state := &SagaState{
+		ID:        id,
+		Name:      name,
+		Status:    SagaStatusRunning,
+		Step:      0,
+		Payload:   payload,
+		Version:   1,
+		Deadline:  now.Add(o.stepTimeout(def, 0)),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := o.store.Create(ctx, state); err != nil {
+		return err
+	}
+
+	o.logger.Info("saga 已启动", clog.String("saga", name), clog.String("saga_id", id))
+	return o.dispatch(ctx, state)
+}
+
+// Get 返回 Saga 的当前状态
+func (o *SagaOrchestrator) Get(ctx context.Context, id string) (*SagaState, error) {
+	return o.store.Get(ctx, id)
+}
+
+// ListStuck 返回超过 olderThan 没有状态变化的未结束 Saga，以及补偿失败需要人工介入的 Saga
+func (o *SagaOrchestrator) ListStuck(ctx context.Context, olderThan time.Duration, limit int) ([]*SagaState, error) {
+	return o.store.List(ctx, SagaQuery{
+		Statuses:      []string{SagaStatusRunning, SagaStatusCompensating, SagaStatusFailed},
+		UpdatedBefore: o.now().Add(-olderThan),
+		Limit:         limit,
+	})
+}
+
+// Run 订阅步骤主题并周期性地处理超时的 Saga，直到 ctx 被取消。
+// 可以在多个实例上同时运行，状态的版本号保证同一步骤只被推进一次。
+func (o *SagaOrchestrator) Run(ctx context.Context) error {
+	if o.consumer == nil {
+		return NewConfigError("执行 saga 步骤需要 consumer", ErrInvalidConfig)
+	}
+
+	err := o.consumer.Subscribe(ctx, []string{o.config.Topic}, func(msg *Message, _ TopicPartition, err error) bool {
+		if err != nil {
+			o.logger.Warn("接收 saga 步骤消息失败", clog.Err(err))
+			return true
+		}
+		o.HandleMessage(msg.Envelope.Context(ctx), msg)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(o.config.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			o.CheckTimeouts(ctx)
+		}
+	}
+}
+
+// HandleMessage 执行一条步骤消息并推进状态。Run 内部使用，也可以在自定义的消费回调中调用
+func (o *SagaOrchestrator) HandleMessage(ctx context.Context, msg *Message) {
+	var m sagaMessage
+	if err := json.Unmarshal(msg.Value, &m); err != nil {
+		o.logger.Error("解析 saga 步骤消息失败", clog.Err(err), clog.Int64("offset", msg.Offset))
+		return
+	}
+
+	def, ok := o.definition(m.Saga)
+	if !ok {
+		o.logger.Error("收到未注册 saga 的步骤消息", clog.String("saga", m.Saga), clog.String("saga_id", m.SagaID))
+		return
+	}
+
+	state, err := o.store.Get(ctx, m.SagaID)
+	if err != nil {
+		o.logger.Error("读取 saga 状态失败", clog.Err(err), clog.String("saga_id", m.SagaID))
+		return
+	}
+	if !o.expects(state, &m) {
+		o.logger.Debug("丢弃过期的 saga 步骤消息",
+			clog.String("saga_id", m.SagaID),
+			clog.Int("step", m.Step),
+			clog.Int64("version", m.Version),
+			clog.Int64("current_version", state.Version))
+		return
+	}
+
+	step := def.Steps[state.Step]
+	exec := &SagaExecution{
+		SagaID:         state.ID,
+		Saga:           state.Name,
+		Step:           step.Name,
+		Compensating:   m.Compensating,
+		Payload:        state.Payload,
+		IdempotencyKey: sagaIdempotencyKey(state.ID, step.Name, m.Compensating),
+	}
+
+	stepCtx, cancel := context.WithDeadline(ctx, state.Deadline)
+	var stepErr error
+	if m.Compensating {
+		stepErr = o.invoke(stepCtx, step.Compensate, exec)
+	} else {
+		stepErr = o.invoke(stepCtx, step.Action, exec)
+	}
+	cancel()
+
+	next := o.advance(def, state, m.Compensating, stepErr)
+	// 补偿失败时不立即重试，等待下一次 CheckTimeouts 重新投递，避免下游故障时密集重试
+	o.commit(ctx, state, next, !(m.Compensating && stepErr != nil))
+}
+
+// CheckTimeouts 处理超过截止时间的 Saga：执行中的步骤按超时失败开始补偿，补偿中的步骤重新投递。Run 内部周期性调用
+func (o *SagaOrchestrator) CheckTimeouts(ctx context.Context) {
+	states, err := o.store.List(ctx, SagaQuery{
+		Statuses:       []string{SagaStatusRunning, SagaStatusCompensating},
+		DeadlineBefore: o.now(),
+		Limit:          100,
+	})
+	if err != nil {
+		o.logger.Error("查询超时的 saga 失败", clog.Err(err))
+		return
+	}
+
+	for _, state := range states {
+		def, ok := o.definition(state.Name)
+		if !ok {
+			continue
+		}
+
+		var next *SagaState
+		if state.Status == SagaStatusRunning {
+			// 超时的步骤可能已经执行，从它自己开始补偿
+			next = o.compensateFrom(def, state, state.Step,
+				fmt.Sprintf("步骤 %s 超时", def.Steps[state.Step].Name))
+		} else {
+			next = o.retryCompensation(def, state)
+		}
+		o.logger.Warn("saga 步骤超时",
+			clog.String("saga_id", state.ID),
+			clog.String("step", def.Steps[state.Step].Name),
+			clog.String("status", state.Status))
+		o.commit(ctx, state, next, true)
+	}
+}
+
+// expects 判断消息是否对应 Saga 当前等待执行的步骤
+func (o *SagaOrchestrator) expects(state *SagaState, m *sagaMessage) bool {
+	if state.Terminal() || state.Version != m.Version || state.Step != m.Step {
+		return false
+	}
+	if m.Compensating {
+		return state.Status == SagaStatusCompensating
+	}
+	return state.Status == SagaStatusRunning
+}
+
+// invoke 执行步骤函数，panic 视为失败
+func (o *SagaOrchestrator) invoke(ctx context.Context, fn SagaStepFunc, exec *SagaExecution) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("saga 步骤 panic: %v", r)
+		}
+	}()
+	return fn(ctx, exec)
+}
+
+// advance 根据步骤执行结果计算下一个状态
+func (o *SagaOrchestrator) advance(def *SagaDefinition, state *SagaState, compensating bool, stepErr error) *SagaState {
+	if compensating {
+		if stepErr != nil {
+			return o.failCompensation(def, state, stepErr)
+		}
+		return o.compensateFrom(def, state, state.Step-1, state.Error)
+	}
+
+	if stepErr != nil {
+		// 失败的步骤视为未生效，从上一个步骤开始补偿
+		return o.compensateFrom(def, state, state.Step-1,
+			fmt.Sprintf("步骤 %s 失败: %v", def.Steps[state.Step].Name, stepErr))
+	}
+
+	next := o.nextState(state)
+	if state.Step+1 >= len(def.Steps) {
+		next.Status = SagaStatusCompleted
+		return next
+	}
+	next.Step = state.Step + 1
+	next.Deadline = next.UpdatedAt.Add(o.stepTimeout(def, next.Step))
+	return next
+}
+
+// compensateFrom 从 from 开始向前找到第一个有补偿的步骤，没有需要补偿的步骤时 Saga 结束为 compensated
+func (o *SagaOrchestrator) compensateFrom(def *SagaDefinition, state *SagaState, from int, reason string) *SagaState {
+	next := o.nextState(state)
+	next.Error = reason
+	next.Attempts = 0
+
+	step := from
+	for step >= 0 && def.Steps[step].Compensate == nil {
+		step--
+	}
+	if step < 0 {
+		next.Status = SagaStatusCompensated
+		return next
+	}
+	next.Status = SagaStatusCompensating
+	next.Step = step
+	next.Attempts = 1
+	next.Deadline = next.UpdatedAt.Add(o.stepTimeout(def, step))
+	return next
+}
+
+// failCompensation 记录一次补偿失败，尝试次数耗尽时 Saga 结束为 failed，
+// 否则将截止时间设为当前时间，由下一次 CheckTimeouts 重新投递
+func (o *SagaOrchestrator) failCompensation(def *SagaDefinition, state *SagaState, stepErr error) *SagaState {
+	next := o.nextState(state)
+	next.Error = fmt.Sprintf("%s; 补偿 %s 失败: %v", state.Error, def.Steps[state.Step].Name, stepErr)
+	if next.Attempts >= o.config.MaxCompensationAttempts {
+		next.Status = SagaStatusFailed
+		return next
+	}
+	next.Deadline = next.UpdatedAt
+	return next
+}
+
+// retryCompensation 重新投递超时或失败的补偿，尝试次数耗尽时 Saga 结束为 failed
+func (o *SagaOrchestrator) retryCompensation(def *SagaDefinition, state *SagaState) *SagaState {
+	next := o.nextState(state)
+	if state.Attempts >= o.config.MaxCompensationAttempts {
+		next.Status = SagaStatusFailed
+		next.Error = fmt.Sprintf("%s; 补偿 %s 重试耗尽", state.Error, def.Steps[state.Step].Name)
+		return next
+	}
+	next.Attempts = state.Attempts + 1
+	next.Deadline = next.UpdatedAt.Add(o.stepTimeout(def, state.Step))
+	return next
+}
+
+// nextState 复制当前状态并推进版本号
+func (o *SagaOrchestrator) nextState(state *SagaState) *SagaState {
+	next := *state
+	next.Version = state.Version + 1
+	next.UpdatedAt = o.now()
+	return &next
+}
+
+// commit 以比较并交换写入新状态，写入成功、Saga 未结束且 dispatch 为 true 时投递下一条步骤消息
+func (o *SagaOrchestrator) commit(ctx context.Context, prev, next *SagaState, dispatch bool) {
+	ok, err := o.store.Update(ctx, next, prev.Version)
+	if err != nil {
+		// 状态未推进，超过截止时间后由 CheckTimeouts 处理
+		o.logger.Error("写入 saga 状态失败", clog.Err(err), clog.String("saga_id", prev.ID))
+		return
+	}
+	if !ok {
+		o.logger.Debug("saga 状态已被其他实例推进", clog.String("saga_id", prev.ID), clog.Int64("version", prev.Version))
+		return
+	}
+
+	if next.Terminal() {
+		fields := []clog.Field{
+			clog.String("saga", next.Name),
+			clog.String("saga_id", next.ID),
+			clog.String("status", next.Status),
+		}
+		if next.Status == SagaStatusCompleted {
+			o.logger.Info("saga 已结束", fields...)
+		} else {
+			o.logger.Warn("saga 已结束", append(fields, clog.String("error", next.Error))...)
+		}
+		return
+	}
+	if !dispatch {
+		return
+	}
+
+	if err := o.dispatch(ctx, next); err != nil {
+		o.logger.Error("投递 saga 步骤消息失败", clog.Err(err), clog.String("saga_id", next.ID))
+	}
+}
+
+// dispatch 投递 Saga 当前步骤的消息，投递失败时超过截止时间后由 CheckTimeouts 处理
+func (o *SagaOrchestrator) dispatch(ctx context.Context, state *SagaState) error {
+	body, err := json.Marshal(sagaMessage{
+		SagaID:       state.ID,
+		Saga:         state.Name,
+		Step:         state.Step,
+		Compensating: state.Status == SagaStatusCompensating,
+		Version:      state.Version,
+	})
+	if err != nil {
+		return NewSerializationError("编码 saga 步骤消息失败", err)
+	}
+	ctx = WithMessageType(ctx, sagaMessageType, 1)
+	return o.producer.SendSyncWithKey(ctx, o.config.Topic, []byte(state.ID), body)
+}
+
+// definition 返回已注册的 Saga 定义
+func (o *SagaOrchestrator) definition(name string) (*SagaDefinition, bool) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	def, ok := o.definitions[name]
+	return def, ok
+}
+
+// stepTimeout 返回步骤的超时时间
+func (o *SagaOrchestrator) stepTimeout(def *SagaDefinition, step int) time.Duration {
+	if timeout := def.Steps[step].Timeout; timeout > 0 {
+		return timeout
+	}
+	return o.config.StepTimeout
+}
+
+// sagaIdempotencyKey 生成步骤动作或补偿的幂等键
+func sagaIdempotencyKey(sagaID, step string, compensating bool) string {
+	if compensating {
+		return sagaID + "/" + step + "/compensate"
+	}
+	return sagaID + "/" + step + "/action"
+}
+
+// memorySagaStore 是基于内存的 SagaStore，仅用于测试和单实例开发环境
+type memorySagaStore struct {
+	mu     sync.Mutex
+	states map[string]SagaState
+}
+
+// NewMemorySagaStore 创建基于内存的 SagaStore，进程重启后状态丢失，仅用于测试和单实例开发环境
+func NewMemorySagaStore() SagaStore {
+	return &memorySagaStore{states: make(map[string]SagaState)}
+}
+
+func (s *memorySagaStore) Create(_ context.Context, state *SagaState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.states[state.ID]; ok {
+		return ErrSagaExists
+	}
+	s.states[state.ID] = *state
+	return nil
+}
+
+func (s *memorySagaStore) Get(_ context.Context, id string) (*SagaState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.states[id]
+	if !ok {
+		return nil, ErrSagaNotFound
+	}
+	return &state, nil
+}
+
+func (s *memorySagaStore) Update(_ context.Context, state *SagaState, expectedVersion int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, ok := s.states[state.ID]
+	if !ok {
+		return false, ErrSagaNotFound
+	}
+	if current.Version != expectedVersion {
+		return false, nil
+	}
+	s.states[state.ID] = *state
+	return true, nil
+}
+
+func (s *memorySagaStore) List(_ context.Context, query SagaQuery) ([]*SagaState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var result []*SagaState
+	for _, state := range s.states {
+		if !matchSagaQuery(&state, query) {
+			continue
+		}
+		st := state
+		result = append(result, &st)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].UpdatedAt.Before(result[j].UpdatedAt)
+	})
+	if query.Limit > 0 && len(result) > query.Limit {
+		result = result[:query.Limit]
+	}
+	return result, nil
+}
+
+// matchSagaQuery 判断 Saga 是否满足查询条件
+func matchSagaQuery(state *SagaState, query SagaQuery) bool {
+	if len(query.Statuses) > 0 {
+		matched := false
+		for _, status := range query.Statuses {
+			if state.Status == status {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if !query.UpdatedBefore.IsZero() && !state.UpdatedAt.Before(query.UpdatedBefore) {
+		return false
+	}
+	if !query.DeadlineBefore.IsZero() && !state.Deadline.Before(query.DeadlineBefore) {
+		return false
+	}
+	return true
+}
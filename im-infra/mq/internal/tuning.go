@@ -0,0 +1,377 @@
+package internal
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// 预设的调优档位
+const (
+	// TuningProfileLatency 低延迟：少量并发、较小的预取量，拉取请求不等待攒批
+	TuningProfileLatency = "latency"
+	// TuningProfileThroughput 高吞吐：更多并发、更大的预取量，拉取请求等待攒批
+	TuningProfileThroughput = "throughput"
+)
+
+// TopicTuning 单个主题的消费调优参数，零值字段沿用上一级（档位或默认值）
+type TopicTuning struct {
+	// Profile 基础档位：latency、throughput，为空时使用 ConsumerConfig.Profile
+	Profile string `json:"profile,omitempty" yaml:"profile,omitempty"`
+
+	// Parallelism 处理该主题消息的并发数，同一分区的消息始终按顺序处理
+	Parallelism int `json:"parallelism,omitempty" yaml:"parallelism,omitempty"`
+
+	// MaxInFlight 已拉取但未处理完的最大消息数（预取量），达到后暂停拉取该主题
+	MaxInFlight int `json:"maxInFlight,omitempty" yaml:"maxInFlight,omitempty"`
+
+	// ResumeThreshold 暂停后未处理完的消息数降到该值时恢复拉取，默认 MaxInFlight 的一半
+	ResumeThreshold int `json:"resumeThreshold,omitempty" yaml:"resumeThreshold,omitempty"`
+}
+
+// consumerProfile 档位对应的消费者级拉取参数
+type consumerProfile struct {
+	fetchMinBytes  int
+	fetchMaxWait   time.Duration
+	maxPollRecords int
+	topic          TopicTuning
+}
+
+// tuningProfiles 预设档位
+var tuningProfiles = map[string]consumerProfile{
+	TuningProfileLatency: {
+		fetchMinBytes:  1,
+		fetchMaxWait:   10 * time.Millisecond,
+		maxPollRecords: 100,
+		topic:          TopicTuning{Parallelism: 4, MaxInFlight: 200, ResumeThreshold: 100},
+	},
+	TuningProfileThroughput: {
+		fetchMinBytes:  64 * 1024,
+		fetchMaxWait:   500 * time.Millisecond,
+		maxPollRecords: 1000,
+		topic:          TopicTuning{Parallelism: 16, MaxInFlight: 5000, ResumeThreshold: 2500},
+	},
+}
+
+// defaultTopicTuning 未指定档位时的调优参数：单协程顺序处理，与不做调优时的行为一致
+var defaultTopicTuning = TopicTuning{Parallelism: 1, MaxInFlight: 1000, ResumeThreshold: 500}
+
+// TuningProfile 返回档位对应的主题调优参数
+func TuningProfile(name string) (TopicTuning, bool) {
+	p, ok := tuningProfiles[name]
+	if !ok {
+		return TopicTuning{}, false
+	}
+	tuning := p.topic
+	tuning.Profile = name
+	return tuning, true
+}
+
+// merge 用 override 中的非零字段覆盖 t
+func (t TopicTuning) merge(override TopicTuning) TopicTuning {
+	if override.Profile != "" {
+		t.Profile = override.Profile
+	}
+	if override.Parallelism > 0 {
+		t.Parallelism = override.Parallelism
+	}
+	if override.MaxInFlight > 0 {
+		t.MaxInFlight = override.MaxInFlight
+	}
+	if override.ResumeThreshold > 0 {
+		t.ResumeThreshold = override.ResumeThreshold
+	}
+	return t
+}
+
+// validate 校验调优参数
+func (t TopicTuning) validate() error {
+	if t.Profile != "" {
+		if _, ok := tuningProfiles[t.Profile]; !ok {
+			return fmt.Errorf("未知的调优档位: %s", t.Profile)
+		}
+	}
+	if t.Parallelism < 0 || t.MaxInFlight < 0 || t.ResumeThreshold < 0 {
+		return fmt.Errorf("调优参数不能为负数")
+	}
+	if t.MaxInFlight > 0 && t.ResumeThreshold >= t.MaxInFlight {
+		return fmt.Errorf("恢复阈值 %d 必须小于最大在途消息数 %d", t.ResumeThreshold, t.MaxInFlight)
+	}
+	return nil
+}
+
+// resolveTopicTuning 按 档位 -> ConsumerConfig.Topics -> 运行时覆盖 的顺序计算主题的最终调优参数
+func resolveTopicTuning(cfg ConsumerConfig, topic string, override TopicTuning) TopicTuning {
+	configured := cfg.Topics[topic].merge(override)
+
+	profile := configured.Profile
+	if profile == "" {
+		profile = cfg.Profile
+	}
+	tuning := defaultTopicTuning
+	if p, ok := TuningProfile(profile); ok {
+		tuning = p
+	}
+	tuning = tuning.merge(configured)
+
+	if tuning.ResumeThreshold <= 0 || tuning.ResumeThreshold >= tuning.MaxInFlight {
+		tuning.ResumeThreshold = tuning.MaxInFlight / 2
+	}
+	return tuning
+}
+
+// applyConsumerProfile 按 ConsumerConfig.Profile 设置消费者级的拉取参数
+func applyConsumerProfile(cfg *ConsumerConfig) {
+	p, ok := tuningProfiles[cfg.Profile]
+	if !ok {
+		return
+	}
+	cfg.FetchMinBytes = p.fetchMinBytes
+	cfg.FetchMaxWait = p.fetchMaxWait
+	cfg.MaxPollRecords = p.maxPollRecords
+}
+
+// validateTuningConfig 校验消费者的调优配置
+func validateTuningConfig(cfg ConsumerConfig) error {
+	if cfg.Profile != "" {
+		if _, ok := tuningProfiles[cfg.Profile]; !ok {
+			return NewConfigError(fmt.Sprintf("未知的调优档位: %s", cfg.Profile), nil)
+		}
+	}
+	for topic, tuning := range cfg.Topics {
+		if topic == "" {
+			return NewConfigError("调优主题名不能为空", nil)
+		}
+		if err := tuning.validate(); err != nil {
+			return NewConfigError(fmt.Sprintf("主题 %s 的调优参数无效", topic), err)
+		}
+	}
+	return nil
+}
+
+// dispatchItem 分区队列中的一项：新拉取的记录，或过载解除后补处理的暂存消息
+type dispatchItem struct {
+	record   *kgo.Record
+	deferred *Message
+}
+
+// topicDispatcher 按主题调度消息处理：
+// 每个分区维护一个队列，同一分区同一时刻只有一条消息在处理，保证分区内有序；
+// 未处理完的消息达到 MaxInFlight 时暂停拉取该主题，降到 ResumeThreshold 时恢复。
+type topicDispatcher struct {
+	topic  string
+	handle func(*kgo.Record)
+	replay func(*Message)
+	pause  func(topic string, paused bool)
+	logger clog.Logger
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	tuning   TopicTuning
+	queues   map[int32][]dispatchItem
+	busy     map[int32]bool
+	pending  int   // 已入队但未处理完的消息数（含处理中）
+	cursor   int32 // 上一次调度的分区
+	workers  int
+	paused   bool
+	stopped  bool
+	workerWG sync.WaitGroup
+}
+
+// newTopicDispatcher 创建主题调度器并按 Parallelism 启动处理协程。
+// handle 处理新拉取的记录，replay 补处理过载期间暂存的消息。
+func newTopicDispatcher(topic string, tuning TopicTuning, handle func(*kgo.Record), replay func(*Message), pause func(string, bool), logger clog.Logger) *topicDispatcher {
+	d := &topicDispatcher{
+		topic:  topic,
+		handle: handle,
+		replay: replay,
+		pause:  pause,
+		logger: logger,
+		queues: make(map[int32][]dispatchItem),
+		busy:   make(map[int32]bool),
+	}
+	d.cond = sync.NewCond(&d.mu)
+	d.setTuning(tuning)
+	return d
+}
+
+// enqueue 将一批同分区的记录加入队列，不阻塞拉取循环
+func (d *topicDispatcher) enqueue(partition int32, records []*kgo.Record) {
+	if len(records) == 0 {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stopped {
+		return
+	}
+
+	for _, record := range records {
+		d.queues[partition] = append(d.queues[partition], dispatchItem{record: record})
+	}
+	d.added(len(records))
+}
+
+// requeue 将过载期间暂存的同分区消息放回分区队首，
+// 它们的偏移量早于队列中尚未处理的记录，补处理完成后才继续处理新记录
+func (d *topicDispatcher) requeue(partition int32, messages []*Message) {
+	if len(messages) == 0 {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stopped {
+		return
+	}
+
+	items := make([]dispatchItem, 0, len(messages)+len(d.queues[partition]))
+	for _, message := range messages {
+		items = append(items, dispatchItem{deferred: message})
+	}
+	d.queues[partition] = append(items, d.queues[partition]...)
+	d.added(len(messages))
+}
+
+// added 记录新入队的消息数，达到上限时暂停拉取并唤醒处理协程，调用方需持有锁
+func (d *topicDispatcher) added(n int) {
+	d.pending += n
+	if !d.paused && d.pending >= d.tuning.MaxInFlight {
+		d.paused = true
+		d.pause(d.topic, true)
+		d.logger.Debug("在途消息达到上限，暂停拉取主题",
+			clog.String("topic", d.topic),
+			clog.Int("pending", d.pending),
+			clog.Int("max_in_flight", d.tuning.MaxInFlight))
+	}
+	d.cond.Broadcast()
+}
+
+// setTuning 更新调优参数，按需增减处理协程
+func (d *topicDispatcher) setTuning(tuning TopicTuning) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.tuning = tuning
+	for d.workers < tuning.Parallelism && !d.stopped {
+		d.workers++
+		d.workerWG.Add(1)
+		go d.work()
+	}
+	d.maybeResume()
+	d.cond.Broadcast()
+}
+
+// currentTuning 返回当前生效的调优参数
+func (d *topicDispatcher) currentTuning() TopicTuning {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.tuning
+}
+
+// stop 停止调度，丢弃未处理的消息（未提交偏移量，重新分配后会再次投递），等待处理中的消息完成
+func (d *topicDispatcher) stop() {
+	d.mu.Lock()
+	d.stopped = true
+	d.queues = make(map[int32][]dispatchItem)
+	if d.paused {
+		d.paused = false
+		d.pause(d.topic, false)
+	}
+	d.cond.Broadcast()
+	d.mu.Unlock()
+
+	d.workerWG.Wait()
+}
+
+// work 处理协程：取出一个空闲分区的队首消息进行处理
+func (d *topicDispatcher) work() {
+	defer d.workerWG.Done()
+
+	d.mu.Lock()
+	for {
+		// 调小并发时，多余的协程处理完当前消息后退出
+		if d.stopped || d.workers > d.tuning.Parallelism {
+			d.workers--
+			d.mu.Unlock()
+			return
+		}
+		partition, ok := d.nextPartition()
+		if !ok {
+			d.cond.Wait()
+			continue
+		}
+
+		item := d.queues[partition][0]
+		d.queues[partition] = d.queues[partition][1:]
+		if len(d.queues[partition]) == 0 {
+			delete(d.queues, partition)
+		}
+		d.busy[partition] = true
+		d.mu.Unlock()
+
+		if item.deferred != nil {
+			d.replay(item.deferred)
+		} else {
+			d.handle(item.record)
+		}
+
+		d.mu.Lock()
+		delete(d.busy, partition)
+		d.pending--
+		d.maybeResume()
+		d.cond.Broadcast()
+	}
+}
+
+// nextPartition 按分区号轮转选出有待处理消息且没有消息在处理中的分区，避免低编号分区饿死其他分区，调用方需持有锁
+func (d *topicDispatcher) nextPartition() (int32, bool) {
+	if d.stopped {
+		return 0, false
+	}
+
+	var first, next int32
+	var hasFirst, hasNext bool
+	for p := range d.queues {
+		if d.busy[p] {
+			continue
+		}
+		if !hasFirst || p < first {
+			first, hasFirst = p, true
+		}
+		if p > d.cursor && (!hasNext || p < next) {
+			next, hasNext = p, true
+		}
+	}
+	if hasNext {
+		d.cursor = next
+		return next, true
+	}
+	if hasFirst {
+		d.cursor = first
+		return first, true
+	}
+	return 0, false
+}
+
+// backlog 返回已入队但未处理完的消息数
+func (d *topicDispatcher) backlog() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.pending
+}
+
+// maybeResume 未处理完的消息降到恢复阈值时恢复拉取，调用方需持有锁
+func (d *topicDispatcher) maybeResume() {
+	if d.paused && !d.stopped && d.pending <= d.tuning.ResumeThreshold {
+		d.paused = false
+		d.pause(d.topic, false)
+		d.logger.Debug("在途消息降到恢复阈值，恢复拉取主题",
+			clog.String("topic", d.topic),
+			clog.Int("pending", d.pending))
+	}
+}
@@ -238,3 +238,49 @@ func NewMessageUtils(serializerType, compressionType string) *internal.MessageUt
 func NewCompressionCodec(compressionType string) internal.CompressionCodec {
 	return internal.NewCompressionCodec(compressionType)
 }
+
+// ===== 消息信封 =====
+
+// 消息信封使用的标准消息头
+const (
+	HeaderMessageID      = internal.HeaderMessageID
+	HeaderMessageType    = internal.HeaderMessageType
+	HeaderMessageVersion = internal.HeaderMessageVersion
+	HeaderProducedAt     = internal.HeaderProducedAt
+	HeaderProducer       = internal.HeaderProducer
+	HeaderTenant         = internal.HeaderTenant
+	HeaderTraceParent    = internal.HeaderTraceParent
+	HeaderTraceState     = internal.HeaderTraceState
+)
+
+// Envelope 是所有消息共享的标准元数据（消息 ID、类型、版本、生产时间、生产者、租户、调用链）。
+// 生产时自动写入消息头，消费时解析到 Message.Envelope。
+type Envelope = internal.Envelope
+
+// ConsumeMiddleware 包装消费回调，用于实现去重、租户校验等通用逻辑
+type ConsumeMiddleware = internal.ConsumeMiddleware
+
+// WithMessageType 在上下文中设置本次发送的消息类型和版本
+func WithMessageType(ctx context.Context, messageType string, version int) context.Context {
+	return internal.WithMessageType(ctx, messageType, version)
+}
+
+// WithTenant 在上下文中设置租户标识，等价于 ctxmeta.WithTenant，db 和 metrics 读取的是同一个值
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return internal.WithTenant(ctx, tenant)
+}
+
+// EnvelopeFromContext 返回上下文中的信封元数据
+func EnvelopeFromContext(ctx context.Context) Envelope {
+	return internal.EnvelopeFromContext(ctx)
+}
+
+// ParseEnvelope 从消息头解析信封
+func ParseEnvelope(headers map[string][]byte) Envelope {
+	return internal.ParseEnvelope(headers)
+}
+
+// ChainConsumeCallback 按顺序组合消费中间件，第一个中间件最先执行
+func ChainConsumeCallback(callback ConsumeCallback, middlewares ...ConsumeMiddleware) ConsumeCallback {
+	return internal.ChainConsumeCallback(callback, middlewares...)
+}
@@ -2,11 +2,15 @@ package mq
 
 import (
 	"context"
+	"errors"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/ceyewan/gochat/im-infra/mq/internal"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // TestDefaultConfig 测试默认配置
@@ -436,3 +440,507 @@ func TestHealthCheck(t *testing.T) {
 		t.Error("failing检查应该是不健康的")
 	}
 }
+
+// TestEnvelope 测试消息信封的编码、解析和上下文传递
+func TestEnvelope(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	ctx := WithMessageType(context.Background(), "message.created", 2)
+	ctx = WithTenant(ctx, "tenant-a")
+	fromCtx := EnvelopeFromContext(ctx)
+	if fromCtx.Type != "message.created" || fromCtx.Version != 2 || fromCtx.Tenant != "tenant-a" {
+		t.Errorf("上下文中的信封不正确: %+v", fromCtx)
+	}
+
+	producedAt := time.Date(2024, 5, 1, 8, 0, 0, 123, time.UTC)
+	env := Envelope{
+		MessageID:   "0190a8b4-7c2e-7def-8000-000000000001",
+		Type:        "message.created",
+		Version:     2,
+		ProducedAt:  producedAt,
+		Producer:    "im-logic",
+		Tenant:      "tenant-a",
+		TraceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	}
+
+	parsed := ParseEnvelope(env.Headers())
+	if parsed.MessageID != env.MessageID || parsed.Type != env.Type || parsed.Version != env.Version ||
+		parsed.Producer != env.Producer || parsed.Tenant != env.Tenant || !parsed.ProducedAt.Equal(producedAt) {
+		t.Errorf("信封解析结果不一致: %+v", parsed)
+	}
+
+	// 缺少信封消息头的旧消息解析为零值
+	if legacy := ParseEnvelope(map[string][]byte{"other": []byte("x")}); legacy != (Envelope{}) {
+		t.Errorf("缺少信封头时应返回零值，实际为 %+v", legacy)
+	}
+
+	// 消费端恢复的上下文应携带远端调用链和租户
+	consumeCtx := parsed.Context(context.Background())
+	sc := trace.SpanContextFromContext(consumeCtx)
+	if !sc.IsRemote() || sc.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("未能恢复调用链: %v", sc)
+	}
+	if EnvelopeFromContext(consumeCtx).Tenant != "tenant-a" {
+		t.Error("恢复的上下文应携带租户")
+	}
+}
+
+// TestChainConsumeCallback 测试消费中间件的执行顺序
+func TestChainConsumeCallback(t *testing.T) {
+	var order []string
+	mw := func(name string) ConsumeMiddleware {
+		return func(next ConsumeCallback) ConsumeCallback {
+			return func(message *Message, partition TopicPartition, err error) bool {
+				order = append(order, name)
+				return next(message, partition, err)
+			}
+		}
+	}
+
+	// 基于 MessageID 去重的中间件
+	seen := map[string]bool{}
+	dedup := func(next ConsumeCallback) ConsumeCallback {
+		return func(message *Message, partition TopicPartition, err error) bool {
+			if seen[message.Envelope.MessageID] {
+				return true
+			}
+			seen[message.Envelope.MessageID] = true
+			return next(message, partition, err)
+		}
+	}
+
+	handled := 0
+	callback := ChainConsumeCallback(func(*Message, TopicPartition, error) bool {
+		order = append(order, "handler")
+		handled++
+		return true
+	}, mw("first"), mw("second"), dedup)
+
+	msg := &Message{Envelope: Envelope{MessageID: "id-1"}}
+	callback(msg, TopicPartition{}, nil)
+	callback(msg, TopicPartition{}, nil)
+
+	if handled != 1 {
+		t.Errorf("重复消息应被去重，实际处理 %d 次", handled)
+	}
+	if len(order) < 3 || order[0] != "first" || order[1] != "second" || order[2] != "handler" {
+		t.Errorf("中间件执行顺序不正确: %v", order)
+	}
+}
+
+// TestTopicTuning 测试调优档位和运行时覆盖
+func TestTopicTuning(t *testing.T) {
+	throughput, ok := TuningProfile(TuningProfileThroughput)
+	if !ok {
+		t.Fatal("应该存在 throughput 档位")
+	}
+	latency, _ := TuningProfile(TuningProfileLatency)
+	if throughput.Parallelism <= latency.Parallelism || throughput.MaxInFlight <= latency.MaxInFlight {
+		t.Errorf("throughput 档位的并发和预取量应大于 latency 档位: %+v %+v", throughput, latency)
+	}
+
+	cfg := DefaultConsumerConfig()
+	cfg.GroupID = "tuning-test"
+	cfg.Profile = "unknown"
+	if _, err := NewConsumer(cfg); err == nil {
+		t.Error("未知档位应该返回错误")
+	}
+
+	cfg.Profile = TuningProfileLatency
+	cfg.Topics = map[string]TopicTuning{"im-message": {Profile: TuningProfileThroughput, Parallelism: 32}}
+	consumer, err := NewConsumer(cfg)
+	if err != nil {
+		t.Fatalf("创建消费者失败: %v", err)
+	}
+	defer consumer.Close()
+
+	got := consumer.GetTopicTuning("im-message")
+	if got.Parallelism != 32 || got.MaxInFlight != throughput.MaxInFlight {
+		t.Errorf("主题配置应覆盖档位: %+v", got)
+	}
+	if got := consumer.GetTopicTuning("im-notify"); got != latency {
+		t.Errorf("未配置的主题应使用消费者档位: %+v", got)
+	}
+
+	if err := consumer.SetTopicTuning("im-message", TopicTuning{MaxInFlight: 100, ResumeThreshold: 200}); err == nil {
+		t.Error("恢复阈值不小于最大在途消息数时应该返回错误")
+	}
+	if err := consumer.SetTopicTuning("im-message", TopicTuning{MaxInFlight: 100}); err != nil {
+		t.Fatalf("运行时覆盖失败: %v", err)
+	}
+	if got := consumer.GetTopicTuning("im-message"); got.MaxInFlight != 100 || got.ResumeThreshold != 50 || got.Parallelism != 32 {
+		t.Errorf("运行时覆盖未生效: %+v", got)
+	}
+	if err := consumer.SetTopicTuning("im-message", TopicTuning{}); err != nil {
+		t.Fatalf("恢复配置失败: %v", err)
+	}
+	if got := consumer.GetTopicTuning("im-message"); got.MaxInFlight != throughput.MaxInFlight {
+		t.Errorf("零值应恢复为配置中的参数: %+v", got)
+	}
+}
+
+// TestOverloadPolicy 测试过载降级策略的校验和优先级分类
+func TestOverloadPolicy(t *testing.T) {
+	policy := &OverloadPolicy{
+		Types:            map[string]MessagePriority{"typing.indicator": PriorityLow, "message.created": PriorityHigh},
+		Topics:           map[string]MessagePriority{"im-receipt": PriorityLow},
+		BacklogThreshold: 1000,
+	}
+
+	cases := []struct {
+		msg  Message
+		want MessagePriority
+	}{
+		{Message{Topic: "im-presence", Envelope: Envelope{Type: "typing.indicator"}}, PriorityLow},
+		{Message{Topic: "im-receipt", Envelope: Envelope{Type: "message.created"}}, PriorityHigh},
+		{Message{Topic: "im-receipt"}, PriorityLow},
+		{Message{Topic: "im-message"}, PriorityHigh},
+	}
+	for _, c := range cases {
+		if got := policy.PriorityOf(&c.msg); got != c.want {
+			t.Errorf("消息 %s/%s 的优先级应为 %d，实际为 %d", c.msg.Topic, c.msg.Envelope.Type, c.want, got)
+		}
+	}
+
+	cfg := DefaultConsumerConfig()
+	cfg.GroupID = "overload-test"
+	cfg.Overload = &OverloadPolicy{}
+	if _, err := NewConsumer(cfg); err == nil {
+		t.Error("未设置任何阈值时应该返回错误")
+	}
+	cfg.Overload = &OverloadPolicy{BacklogThreshold: 100, Action: "drop"}
+	if _, err := NewConsumer(cfg); err == nil {
+		t.Error("未知的处理方式应该返回错误")
+	}
+	cfg.Overload = &OverloadPolicy{LatencyThreshold: 50 * time.Millisecond, RecoveryRatio: 1.5}
+	if _, err := NewConsumer(cfg); err == nil {
+		t.Error("恢复比例大于 1 时应该返回错误")
+	}
+
+	cfg.Overload = policy
+	consumer, err := NewConsumer(cfg)
+	if err != nil {
+		t.Fatalf("创建消费者失败: %v", err)
+	}
+	defer consumer.Close()
+	if stats := consumer.OverloadStats(); stats.Overloaded || stats.Shed != 0 {
+		t.Errorf("新建的消费者不应处于过载状态: %+v", stats)
+	}
+}
+
+// sagaTestProducer 记录 Saga 投递的步骤消息
+type sagaTestProducer struct {
+	Producer
+	mu       sync.Mutex
+	messages []*Message
+}
+
+func (p *sagaTestProducer) SendSyncWithKey(ctx context.Context, topic string, key []byte, message []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.messages = append(p.messages, &Message{Topic: topic, Key: key, Value: message})
+	return nil
+}
+
+// drain 依次处理已投递的步骤消息，返回处理的消息
+func (p *sagaTestProducer) drain(saga *SagaOrchestrator) []*Message {
+	var handled []*Message
+	for {
+		p.mu.Lock()
+		if len(p.messages) == 0 {
+			p.mu.Unlock()
+			return handled
+		}
+		msg := p.messages[0]
+		p.messages = p.messages[1:]
+		p.mu.Unlock()
+
+		saga.HandleMessage(context.Background(), msg)
+		handled = append(handled, msg)
+	}
+}
+
+// TestSagaOrchestrator 测试 Saga 的正向执行、失败补偿、重复消息和超时
+func TestSagaOrchestrator(t *testing.T) {
+	ctx := context.Background()
+	producer := &sagaTestProducer{}
+	saga, err := NewSagaOrchestrator(SagaConfig{MaxCompensationAttempts: 2}, producer, nil, NewMemorySagaStore())
+	if err != nil {
+		t.Fatalf("创建 saga 编排器失败: %v", err)
+	}
+
+	var mu sync.Mutex
+	calls := map[string]int{}
+	record := func(name string, err error) SagaStepFunc {
+		return func(ctx context.Context, exec *SagaExecution) error {
+			mu.Lock()
+			defer mu.Unlock()
+			calls[name]++
+			return err
+		}
+	}
+	failCharge := false
+	charge := func(ctx context.Context, exec *SagaExecution) error {
+		mu.Lock()
+		defer mu.Unlock()
+		calls["charge"]++
+		if failCharge {
+			return errors.New("余额不足")
+		}
+		return nil
+	}
+
+	if err := saga.Register(SagaDefinition{Name: "checkout"}); err == nil {
+		t.Error("没有步骤的 saga 应该注册失败")
+	}
+	err = saga.Register(SagaDefinition{
+		Name: "checkout",
+		Steps: []SagaStep{
+			{Name: "reserve", Action: record("reserve", nil), Compensate: record("release", nil)},
+			{Name: "charge", Action: charge, Compensate: record("refund", nil)},
+			{Name: "notify", Action: record("notify", nil)},
+		},
+	})
+	if err != nil {
+		t.Fatalf("注册 saga 失败: %v", err)
+	}
+
+	// 正向执行完成，重复投递的消息不会再次执行步骤
+	if err := saga.Start(ctx, "checkout", "order-1", []byte(`{"amount":100}`)); err != nil {
+		t.Fatalf("启动 saga 失败: %v", err)
+	}
+	if err := saga.Start(ctx, "checkout", "order-1", nil); !errors.Is(err, ErrSagaExists) {
+		t.Errorf("重复启动应返回 ErrSagaExists，实际为 %v", err)
+	}
+	handled := producer.drain(saga)
+	for _, msg := range handled {
+		saga.HandleMessage(ctx, msg)
+	}
+	state, err := saga.Get(ctx, "order-1")
+	if err != nil {
+		t.Fatalf("读取 saga 状态失败: %v", err)
+	}
+	if state.Status != SagaStatusCompleted {
+		t.Errorf("saga 应该已完成，实际为 %s", state.Status)
+	}
+	if calls["reserve"] != 1 || calls["charge"] != 1 || calls["notify"] != 1 {
+		t.Errorf("每个步骤应该只执行一次: %v", calls)
+	}
+
+	// 扣款失败后逆序补偿已完成的步骤，失败的步骤本身不补偿
+	failCharge = true
+	if err := saga.Start(ctx, "checkout", "order-2", nil); err != nil {
+		t.Fatalf("启动 saga 失败: %v", err)
+	}
+	producer.drain(saga)
+	state, _ = saga.Get(ctx, "order-2")
+	if state.Status != SagaStatusCompensated {
+		t.Errorf("saga 应该已补偿，实际为 %s: %s", state.Status, state.Error)
+	}
+	if calls["release"] != 1 || calls["refund"] != 0 {
+		t.Errorf("只应补偿预留库存: %v", calls)
+	}
+
+	// 超时的步骤从它自己开始补偿
+	failCharge = false
+	err = saga.Register(SagaDefinition{
+		Name: "slow",
+		Steps: []SagaStep{
+			{Name: "hold", Action: record("hold", nil), Compensate: record("unhold", nil), Timeout: time.Millisecond},
+		},
+	})
+	if err != nil {
+		t.Fatalf("注册 saga 失败: %v", err)
+	}
+	if err := saga.Start(ctx, "slow", "order-3", nil); err != nil {
+		t.Fatalf("启动 saga 失败: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	saga.CheckTimeouts(ctx)
+	producer.drain(saga)
+	state, _ = saga.Get(ctx, "order-3")
+	if state.Status != SagaStatusCompensated || calls["hold"] != 0 || calls["unhold"] != 1 {
+		t.Errorf("超时的 saga 应补偿超时步骤: status=%s calls=%v", state.Status, calls)
+	}
+
+	stuck, err := saga.ListStuck(ctx, 0, 10)
+	if err != nil {
+		t.Fatalf("查询卡住的 saga 失败: %v", err)
+	}
+	if len(stuck) != 0 {
+		t.Errorf("不应有卡住的 saga: %d", len(stuck))
+	}
+}
+
+// fanOutTestProducer 记录扇出投递的消息，发往 failTopic 的消息总是失败
+type fanOutTestProducer struct {
+	Producer
+	failTopic string
+	mu        sync.Mutex
+	messages  map[string][]*Message
+}
+
+func (p *fanOutTestProducer) SendSyncWithHeaders(ctx context.Context, topic string, key []byte, message []byte, headers map[string][]byte) error {
+	if topic == p.failTopic {
+		return errors.New("broker 不可用")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.messages == nil {
+		p.messages = make(map[string][]*Message)
+	}
+	p.messages[topic] = append(p.messages[topic], &Message{Topic: topic, Key: key, Value: message, Headers: headers})
+	return nil
+}
+
+// TestFanOut 测试扇出的过滤、转换、失败隔离和队列满丢弃
+func TestFanOut(t *testing.T) {
+	ctx := context.Background()
+	producer := &fanOutTestProducer{failTopic: "broken"}
+
+	if _, err := NewFanOut(FanOutConfig{SourceTopic: "source"}, producer, nil); err == nil {
+		t.Error("没有目标的扇出应该创建失败")
+	}
+	if _, err := NewFanOut(FanOutConfig{SourceTopic: "source"}, producer, nil, FanOutDestination{Topic: "source"}); err == nil {
+		t.Error("目标不能是源主题")
+	}
+
+	cfg := FanOutConfig{SourceTopic: "source", MaxRetries: 1, RetryBackoff: time.Millisecond, DeadLetterTopic: "dlq"}
+	fanout, err := NewFanOut(cfg, producer, nil,
+		FanOutDestination{Topic: "mirror"},
+		FanOutDestination{
+			Topic:  "private",
+			Filter: func(msg *Message) bool { return string(msg.Key) == "private" },
+		},
+		FanOutDestination{
+			Topic: "upper",
+			Transform: func(ctx context.Context, msg *Message) (*Message, error) {
+				msg.Value = append([]byte("UPPER:"), msg.Value...)
+				msg.Headers["X-Transformed"] = []byte("1")
+				return msg, nil
+			},
+		},
+		FanOutDestination{Name: "broken", Topic: "broken"},
+	)
+	if err != nil {
+		t.Fatalf("创建扇出失败: %v", err)
+	}
+
+	msg := &Message{Topic: "source", Key: []byte("public"), Value: []byte("hello"), Headers: map[string][]byte{"X-Source": []byte("1")}}
+	if err := fanout.HandleMessage(ctx, msg); err == nil {
+		t.Error("有目标投递失败时应返回错误")
+	}
+	if _, ok := msg.Headers["X-Transformed"]; ok || string(msg.Value) != "hello" {
+		t.Error("转换不应修改源消息")
+	}
+
+	producer.mu.Lock()
+	if got := producer.messages["mirror"]; len(got) != 1 || string(got[0].Value) != "hello" || string(got[0].Headers["X-Source"]) != "1" {
+		t.Errorf("镜像目标应原样收到消息: %+v", got)
+	}
+	if got := producer.messages["private"]; len(got) != 0 {
+		t.Errorf("被过滤的消息不应投递: %d", len(got))
+	}
+	if got := producer.messages["upper"]; len(got) != 1 || string(got[0].Value) != "UPPER:hello" {
+		t.Errorf("转换目标应收到转换后的消息: %+v", got)
+	}
+	if got := producer.messages["dlq"]; len(got) != 1 ||
+		string(got[0].Headers[HeaderFanOutDestination]) != "broken" || string(got[0].Headers[HeaderFanOutReason]) != "send_failed" {
+		t.Errorf("投递失败的消息应写入死信主题: %+v", got)
+	}
+	producer.mu.Unlock()
+
+	stats := fanout.Stats()
+	if stats[0].Sent != 1 || stats[1].Filtered != 1 || stats[2].Sent != 1 || stats[3].Failed != 1 {
+		t.Errorf("投递统计不正确: %+v", stats)
+	}
+
+	// 没有投递协程时队列很快被占满，满了的目标丢弃消息
+	small, err := NewFanOut(FanOutConfig{SourceTopic: "source", QueueSize: 1}, producer, nil,
+		FanOutDestination{Topic: "slow"},
+		FanOutDestination{Topic: "large", QueueSize: 10},
+	)
+	if err != nil {
+		t.Fatalf("创建扇出失败: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		small.Dispatch(ctx, msg)
+	}
+	stats = small.Stats()
+	if stats[0].Queued != 1 || stats[0].Dropped != 2 {
+		t.Errorf("队列满的目标应丢弃消息: %+v", stats[0])
+	}
+	if stats[1].Queued != 3 || stats[1].Dropped != 0 {
+		t.Errorf("其他目标不应受影响: %+v", stats[1])
+	}
+}
+
+// TestIdempotency 测试按业务键的幂等处理：重复跳过、失败释放、处理中冲突和过期接管
+func TestIdempotency(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryIdempotencyStore()
+	idem, err := NewIdempotency(IdempotencyConfig{TTL: time.Hour, Lease: 20 * time.Millisecond}, store)
+	if err != nil {
+		t.Fatalf("创建幂等处理器失败: %v", err)
+	}
+
+	calls := 0
+	count := func(ctx context.Context) error {
+		calls++
+		return nil
+	}
+	for i := 0; i < 3; i++ {
+		if err := idem.Execute(ctx, "pay-1", count); err != nil {
+			t.Fatalf("执行失败: %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("重复的键应被跳过，实际执行 %d 次", calls)
+	}
+	if ok, _ := idem.Processed(ctx, "pay-1"); !ok {
+		t.Error("处理成功的键应被记录")
+	}
+
+	// 失败时释放键，重试可以再次执行
+	failure := errors.New("settle failed")
+	if err := idem.Execute(ctx, "pay-2", func(ctx context.Context) error { return failure }); !errors.Is(err, failure) {
+		t.Errorf("应返回处理函数的错误，实际: %v", err)
+	}
+	if err := idem.Execute(ctx, "pay-2", func(ctx context.Context) error { panic("boom") }); err == nil {
+		t.Error("panic 应视为失败")
+	}
+	if err := idem.Execute(ctx, "pay-2", count); err != nil || calls != 2 {
+		t.Errorf("失败后重试应再次执行: err=%v calls=%d", err, calls)
+	}
+
+	// 处理中的键：其他消费者得到 ErrIdempotencyInProgress，租约过期后可以接管
+	err = idem.Execute(ctx, "pay-3", func(ctx context.Context) error {
+		if err := idem.Execute(ctx, "pay-3", count); !errors.Is(err, ErrIdempotencyInProgress) {
+			t.Errorf("处理中的键应返回 ErrIdempotencyInProgress，实际: %v", err)
+		}
+		time.Sleep(30 * time.Millisecond)
+		if err := idem.Execute(ctx, "pay-3", count); err != nil {
+			t.Errorf("租约过期后应可以接管: %v", err)
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("被接管的处理不应报错: err=%v calls=%d", err, calls)
+	}
+
+	// 清理只删除过期的记录
+	expiring, err := NewIdempotency(IdempotencyConfig{TTL: time.Millisecond}, store)
+	if err != nil {
+		t.Fatalf("创建幂等处理器失败: %v", err)
+	}
+	if err := expiring.Execute(ctx, "pay-4", count); err != nil {
+		t.Fatalf("执行失败: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if n, err := idem.Cleanup(ctx); err != nil || n != 1 {
+		t.Errorf("应清理 1 条过期记录: n=%d err=%v", n, err)
+	}
+	if ok, _ := idem.Processed(ctx, "pay-1"); !ok {
+		t.Error("未过期的记录不应被清理")
+	}
+}
@@ -0,0 +1,26 @@
+package mq
+
+import "github.com/ceyewan/gochat/im-infra/mq/internal"
+
+// OverloadPolicy 消费者过载时的分级降级策略，通过 ConsumerConfig.Overload 配置
+type OverloadPolicy = internal.OverloadPolicy
+
+// OverloadStats 过载降级的状态和丢弃计数，通过 Consumer.OverloadStats 获取
+type OverloadStats = internal.OverloadStats
+
+// MessagePriority 消息优先级
+type MessagePriority = internal.MessagePriority
+
+// 消息优先级
+const (
+	// PriorityHigh 高优先级（默认），过载时照常处理
+	PriorityHigh = internal.PriorityHigh
+	// PriorityLow 低优先级，过载时丢弃或延后
+	PriorityLow = internal.PriorityLow
+)
+
+// 过载时低优先级消息的处理方式
+const (
+	OverloadActionShed  = internal.OverloadActionShed
+	OverloadActionDefer = internal.OverloadActionDefer
+)
@@ -0,0 +1,223 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/db"
+	"github.com/ceyewan/gochat/im-infra/mq/internal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SagaOrchestrator 编排多步骤的分布式流程，步骤通过 mq 投递、状态保存在 SagaStore 中
+type SagaOrchestrator = internal.SagaOrchestrator
+
+// SagaConfig Saga 编排器的配置
+type SagaConfig = internal.SagaConfig
+
+// SagaDefinition 定义一个 Saga 的步骤
+type SagaDefinition = internal.SagaDefinition
+
+// SagaStep 是 Saga 中的一个步骤，包含动作和可选的补偿
+type SagaStep = internal.SagaStep
+
+// SagaStepFunc 步骤的动作或补偿
+type SagaStepFunc = internal.SagaStepFunc
+
+// SagaExecution 是传给步骤动作和补偿的执行信息
+type SagaExecution = internal.SagaExecution
+
+// SagaState 是持久化的 Saga 实例状态
+type SagaState = internal.SagaState
+
+// SagaQuery 是 SagaStore.List 的查询条件
+type SagaQuery = internal.SagaQuery
+
+// SagaStore 持久化 Saga 状态
+type SagaStore = internal.SagaStore
+
+// Saga 的状态
+const (
+	SagaStatusRunning      = internal.SagaStatusRunning
+	SagaStatusCompensating = internal.SagaStatusCompensating
+	SagaStatusCompleted    = internal.SagaStatusCompleted
+	SagaStatusCompensated  = internal.SagaStatusCompensated
+	SagaStatusFailed       = internal.SagaStatusFailed
+)
+
+var (
+	// ErrSagaNotFound Saga 不存在
+	ErrSagaNotFound = internal.ErrSagaNotFound
+
+	// ErrSagaExists 相同 ID 的 Saga 已存在
+	ErrSagaExists = internal.ErrSagaExists
+)
+
+// DefaultSagaConfig 返回默认的 Saga 编排器配置
+func DefaultSagaConfig() SagaConfig {
+	return internal.DefaultSagaConfig()
+}
+
+// NewSagaOrchestrator 创建 Saga 编排器。
+// 只启动 Saga 和查询状态的实例可以传入 nil consumer，执行步骤的实例需要调用 Run。
+//
+// 示例：
+//
+//	store, err := mq.NewDBSagaStore(ctx, dbProvider)
+//	saga, err := mq.NewSagaOrchestrator(mq.DefaultSagaConfig(), m.Producer(), m.Consumer(), store)
+//	err = saga.Register(mq.SagaDefinition{
+//	    Name: "order.checkout",
+//	    Steps: []mq.SagaStep{
+//	        {Name: "reserve", Action: reserveStock, Compensate: releaseStock},
+//	        {Name: "charge", Action: charge, Compensate: refund},
+//	        {Name: "notify", Action: notify},
+//	    },
+//	})
+//	go saga.Run(ctx)
+//	err = saga.Start(ctx, "order.checkout", orderID, payload)
+func NewSagaOrchestrator(cfg SagaConfig, producer Producer, consumer Consumer, store SagaStore) (*SagaOrchestrator, error) {
+	return internal.NewSagaOrchestrator(cfg, producer, consumer, store)
+}
+
+// NewMemorySagaStore 创建基于内存的 SagaStore，仅用于测试和单实例开发环境
+func NewMemorySagaStore() SagaStore {
+	return internal.NewMemorySagaStore()
+}
+
+// sagaRecord 是 Saga 状态在数据库中的行
+type sagaRecord struct {
+	ID        string    `gorm:"primaryKey;size:128"`
+	Name      string    `gorm:"size:128;not null"`
+	Status    string    `gorm:"size:16;not null;index:idx_mq_sagas_status_updated,priority:1;index:idx_mq_sagas_status_deadline,priority:1"`
+	Step      int       `gorm:"not null"`
+	Payload   []byte    `gorm:"type:blob"`
+	Error     string    `gorm:"type:text"`
+	Attempts  int       `gorm:"not null"`
+	Version   int64     `gorm:"not null"`
+	Deadline  time.Time `gorm:"index:idx_mq_sagas_status_deadline,priority:2"`
+	CreatedAt time.Time
+	UpdatedAt time.Time `gorm:"index:idx_mq_sagas_status_updated,priority:2"`
+}
+
+// TableName 指定 Saga 状态表名
+func (sagaRecord) TableName() string {
+	return "mq_sagas"
+}
+
+// dbSagaStore 是基于 db 组件的 SagaStore
+type dbSagaStore struct {
+	db db.Provider
+}
+
+// NewDBSagaStore 创建基于 db 组件的 SagaStore，并自动创建 mq_sagas 表。
+// 读取总是走主库，避免从副本读到旧版本导致步骤消息被误判为过期。
+func NewDBSagaStore(ctx context.Context, provider db.Provider) (SagaStore, error) {
+	if provider == nil {
+		return nil, errors.New("db provider cannot be nil")
+	}
+	if err := provider.AutoMigrate(ctx, &sagaRecord{}); err != nil {
+		return nil, err
+	}
+	return &dbSagaStore{db: provider}, nil
+}
+
+func (s *dbSagaStore) Create(ctx context.Context, state *SagaState) error {
+	res := s.db.DB(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(toSagaRecord(state))
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrSagaExists
+	}
+	return nil
+}
+
+func (s *dbSagaStore) Get(ctx context.Context, id string) (*SagaState, error) {
+	var record sagaRecord
+	err := s.db.DB(db.WithPrimary(ctx)).Where("id = ?", id).Take(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrSagaNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return record.toState(), nil
+}
+
+func (s *dbSagaStore) Update(ctx context.Context, state *SagaState, expectedVersion int64) (bool, error) {
+	res := s.db.DB(ctx).Model(&sagaRecord{}).
+		Where("id = ? AND version = ?", state.ID, expectedVersion).
+		Updates(map[string]interface{}{
+			"status":     state.Status,
+			"step":       state.Step,
+			"error":      state.Error,
+			"attempts":   state.Attempts,
+			"version":    state.Version,
+			"deadline":   state.Deadline,
+			"updated_at": state.UpdatedAt,
+		})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
+func (s *dbSagaStore) List(ctx context.Context, query SagaQuery) ([]*SagaState, error) {
+	tx := s.db.DB(db.WithPrimary(ctx)).Model(&sagaRecord{})
+	if len(query.Statuses) > 0 {
+		tx = tx.Where("status IN ?", query.Statuses)
+	}
+	if !query.UpdatedBefore.IsZero() {
+		tx = tx.Where("updated_at < ?", query.UpdatedBefore)
+	}
+	if !query.DeadlineBefore.IsZero() {
+		tx = tx.Where("deadline < ?", query.DeadlineBefore)
+	}
+	if query.Limit > 0 {
+		tx = tx.Limit(query.Limit)
+	}
+
+	var records []sagaRecord
+	if err := tx.Order("updated_at ASC").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	states := make([]*SagaState, len(records))
+	for i := range records {
+		states[i] = records[i].toState()
+	}
+	return states, nil
+}
+
+func toSagaRecord(state *SagaState) *sagaRecord {
+	return &sagaRecord{
+		ID:        state.ID,
+		Name:      state.Name,
+		Status:    state.Status,
+		Step:      state.Step,
+		Payload:   state.Payload,
+		Error:     state.Error,
+		Attempts:  state.Attempts,
+		Version:   state.Version,
+		Deadline:  state.Deadline,
+		CreatedAt: state.CreatedAt,
+		UpdatedAt: state.UpdatedAt,
+	}
+}
+
+func (r *sagaRecord) toState() *SagaState {
+	return &SagaState{
+		ID:        r.ID,
+		Name:      r.Name,
+		Status:    r.Status,
+		Step:      r.Step,
+		Payload:   r.Payload,
+		Error:     r.Error,
+		Attempts:  r.Attempts,
+		Version:   r.Version,
+		Deadline:  r.Deadline,
+		CreatedAt: r.CreatedAt,
+		UpdatedAt: r.UpdatedAt,
+	}
+}
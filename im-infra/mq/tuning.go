@@ -0,0 +1,126 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/ceyewan/gochat/im-infra/coord/config"
+	"github.com/ceyewan/gochat/im-infra/mq/internal"
+)
+
+// TopicTuning 单个主题的消费调优参数（并发数、最大在途消息数、恢复拉取阈值），零值字段沿用档位
+type TopicTuning = internal.TopicTuning
+
+// 预设的调优档位
+const (
+	TuningProfileLatency    = internal.TuningProfileLatency
+	TuningProfileThroughput = internal.TuningProfileThroughput
+)
+
+// TuningProfile 返回档位对应的主题调优参数，未知档位返回 false
+func TuningProfile(name string) (TopicTuning, bool) {
+	return internal.TuningProfile(name)
+}
+
+// WatchTopicTuning 监听配置中心中的主题调优参数，变更后立即应用到 consumer，无需重启。
+//
+// key 对应的值为 主题 -> TopicTuning 的 JSON，例如：
+//
+//	{"im-message": {"profile": "throughput", "parallelism": 32}, "im-notify": {"profile": "latency"}}
+//
+// 启动时已存在的值会立即应用。某个主题从配置中移除或 key 被删除时，该主题恢复为 ConsumerConfig 中的调优参数。
+// 无效的参数只记录日志，不影响其他主题。返回的 stop 函数用于停止监听。
+//
+// 示例：
+//
+//	stop, err := mq.WatchTopicTuning(consumer, configCenter, "/config/prod/im-task/mq/tuning")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	defer stop()
+func WatchTopicTuning(consumer Consumer, cc config.ConfigCenter, key string) (stop func(), err error) {
+	if consumer == nil {
+		return nil, errors.New("consumer cannot be nil")
+	}
+	if cc == nil {
+		return nil, errors.New("config center cannot be nil")
+	}
+	if key == "" {
+		return nil, errors.New("tuning key cannot be empty")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	applied := make(map[string]bool)
+	apply := func(tunings map[string]TopicTuning) {
+		for topic, tuning := range tunings {
+			if err := consumer.SetTopicTuning(topic, tuning); err != nil {
+				logger.Warn("应用主题调优参数失败", clog.String("topic", topic), clog.Err(err))
+				continue
+			}
+			applied[topic] = true
+		}
+		// 从配置中移除的主题恢复为 ConsumerConfig 中的参数
+		for topic := range applied {
+			if _, ok := tunings[topic]; ok {
+				continue
+			}
+			if err := consumer.SetTopicTuning(topic, TopicTuning{}); err == nil {
+				delete(applied, topic)
+			}
+		}
+	}
+
+	var current map[string]TopicTuning
+	if err := cc.Get(ctx, key, &current); err != nil {
+		logger.Debug("主题调优参数尚未设置", clog.String("key", key), clog.Err(err))
+	} else {
+		apply(current)
+	}
+
+	watcher, err := cc.Watch(ctx, key, &map[string]TopicTuning{})
+	if err != nil {
+		cancel()
+		logger.Error("监听主题调优参数失败", clog.String("key", key), clog.Err(err))
+		return nil, err
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Chan():
+				if !ok {
+					return
+				}
+				if event.Type == config.EventTypeDelete {
+					apply(nil)
+					continue
+				}
+				tunings, ok := event.Value.(map[string]TopicTuning)
+				if !ok {
+					logger.Warn("主题调优参数无法解析", clog.String("key", key))
+					continue
+				}
+				apply(tunings)
+			}
+		}
+	}()
+
+	logger.Info("主题调优参数监听已启动", clog.String("key", key))
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			cancel()
+			watcher.Close()
+			wg.Wait()
+		})
+	}, nil
+}
@@ -0,0 +1,22 @@
+package ratelimit
+
+import "github.com/ceyewan/gochat/im-infra/ratelimit/internal"
+
+// ConnRules 单个连接的流式限流规则，同时限制每秒帧数和字节数 (类型别名)。
+type ConnRules = internal.ConnRules
+
+// ConnStats 连接的限流统计 (类型别名)。
+type ConnStats = internal.ConnStats
+
+// ConnLimiter 单个 WebSocket 连接的流式限流器 (类型别名)。
+// 与基于 Redis 的 RateLimiter 不同，它完全在本地内存中计算，适合网关对每个连接的上行帧做防刷保护。
+type ConnLimiter = internal.ConnLimiter
+
+// ConnLimiterPool 按连接 ID 管理 ConnLimiter，支持连接关闭时释放和空闲清理 (类型别名)。
+type ConnLimiterPool = internal.ConnLimiterPool
+
+// NewConnLimiter 为连接创建流式限流器，通过 AllowFrame(size) 同时按帧数和字节数限流。
+var NewConnLimiter = internal.NewConnLimiter
+
+// NewConnLimiterPool 创建连接限流器池，所有连接共用同一组规则，idleTimeout 为 0 时不做空闲清理。
+var NewConnLimiterPool = internal.NewConnLimiterPool
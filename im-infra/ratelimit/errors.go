@@ -1,6 +1,10 @@
 package ratelimit
 
-import "errors"
+import (
+	"errors"
+
+	"github.com/ceyewan/gochat/im-infra/ratelimit/internal"
+)
 
 // 预定义错误
 var (
@@ -10,6 +14,9 @@ var (
 	// ErrInvalidCapacity 无效的容量配置
 	ErrInvalidCapacity = errors.New("capacity must be positive")
 
+	// ErrInvalidAlgorithm 无效的限流算法
+	ErrInvalidAlgorithm = errors.New("unknown rate limit algorithm")
+
 	// ErrInvalidRuleName 无效的规则名称
 	ErrInvalidRuleName = errors.New("rule name cannot be empty")
 
@@ -60,6 +67,21 @@ var (
 
 	// ErrRateLimited 请求被限流
 	ErrRateLimited = errors.New("request rate limited")
+
+	// ErrInvalidCost 无效的操作权重或最大消耗配置
+	ErrInvalidCost = errors.New("invalid request cost")
+
+	// ErrInvalidWarmUp 无效的预热时长或预热速率占比
+	ErrInvalidWarmUp = errors.New("invalid rule warm up")
+
+	// ErrCostExceeded 单次调用消耗的令牌数超过规则的 MaxCost
+	ErrCostExceeded = internal.ErrCostExceeded
+
+	// ErrAnomalyDisabled 未通过 WithAnomalyDetection 启用异常检测
+	ErrAnomalyDisabled = internal.ErrAnomalyDisabled
+
+	// ErrInvalidConnRules 连接限流规则无效
+	ErrInvalidConnRules = internal.ErrInvalidConnRules
 )
 
 // RateLimitError 限流错误类型
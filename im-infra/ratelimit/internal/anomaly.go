@@ -0,0 +1,269 @@
+package internal
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+)
+
+// 单个资源类在一个窗口内最多记录的资源数，防止攻击流量撑爆内存
+const maxTrackedKeys = 1024
+
+// AnomalyConfig 异常拒绝检测配置
+// 按资源类（如 IP 前缀、User-Agent 哈希）统计窗口内的拒绝次数，
+// 超过基线时触发回调，并可自动对该资源类插入临时封禁
+type AnomalyConfig struct {
+	// Classify 将资源映射为资源类，返回空字符串表示不参与检测，必填
+	Classify func(resource string) string
+
+	// Window 统计窗口，默认 10 秒
+	Window time.Duration
+
+	// Baseline 单个资源类在一个窗口内允许的拒绝次数，超过即视为异常，默认 100
+	Baseline int64
+
+	// Baselines 按资源类覆盖 Baseline，用于给已知的大流量出口（如公司 NAT）更高的基线
+	Baselines map[string]int64
+
+	// BlockDuration 大于 0 时自动封禁异常的资源类，封禁期间该类资源的请求直接被拒绝
+	BlockDuration time.Duration
+
+	// TopKeys 事件中携带的拒绝次数最多的资源数，默认 10
+	TopKeys int
+}
+
+// AnomalyEvent 异常拒绝事件
+type AnomalyEvent struct {
+	// Class 触发异常的资源类
+	Class string
+	// RuleName 本窗口内最后一次拒绝所属的规则
+	RuleName string
+	// Denied 窗口内的拒绝次数
+	Denied int64
+	// Baseline 该资源类的基线
+	Baseline int64
+	// WindowStart 统计窗口的开始时间
+	WindowStart time.Time
+	// Keys 按拒绝次数降序排列的资源
+	Keys []string
+	// BlockedUntil 自动封禁的截止时间，未封禁时为零值
+	BlockedUntil time.Time
+}
+
+// AnomalyHandler 异常拒绝回调，在独立的 goroutine 中执行
+type AnomalyHandler func(ctx context.Context, event AnomalyEvent)
+
+// BlockedClass 被临时封禁的资源类
+type BlockedClass struct {
+	Class  string    `json:"class"`
+	Until  time.Time `json:"until"`
+	Reason string    `json:"reason"`
+}
+
+// classWindow 单个资源类在当前窗口内的拒绝统计
+type classWindow struct {
+	denied int64
+	keys   map[string]int64
+	fired  bool
+}
+
+// anomalyDetector 按资源类统计拒绝次数并维护临时封禁列表
+type anomalyDetector struct {
+	cfg      AnomalyConfig
+	handlers []AnomalyHandler
+	logger   clog.Logger
+
+	mu          sync.Mutex
+	windowStart time.Time
+	classes     map[string]*classWindow
+	blocked     map[string]BlockedClass
+}
+
+// newAnomalyDetector 创建异常检测器，未配置 Classify 时返回 nil
+func newAnomalyDetector(cfg AnomalyConfig, handlers []AnomalyHandler, logger clog.Logger) *anomalyDetector {
+	if cfg.Classify == nil {
+		return nil
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = 10 * time.Second
+	}
+	if cfg.Baseline <= 0 {
+		cfg.Baseline = 100
+	}
+	if cfg.TopKeys <= 0 {
+		cfg.TopKeys = 10
+	}
+	return &anomalyDetector{
+		cfg:         cfg,
+		handlers:    handlers,
+		logger:      logger,
+		windowStart: time.Now(),
+		classes:     make(map[string]*classWindow),
+		blocked:     make(map[string]BlockedClass),
+	}
+}
+
+// isBlocked 检查资源所属的类是否处于封禁中，过期的封禁会被顺带清理
+func (d *anomalyDetector) isBlocked(resource string) (string, bool) {
+	class := d.cfg.Classify(resource)
+	if class == "" {
+		return "", false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	b, ok := d.blocked[class]
+	if !ok {
+		return class, false
+	}
+	if time.Now().After(b.Until) {
+		delete(d.blocked, class)
+		return class, false
+	}
+	return class, true
+}
+
+// recordDenied 记录一次拒绝，资源类首次超过基线时触发回调
+func (d *anomalyDetector) recordDenied(ctx context.Context, resource, ruleName string) {
+	class := d.cfg.Classify(resource)
+	if class == "" {
+		return
+	}
+
+	now := time.Now()
+	d.mu.Lock()
+	if now.Sub(d.windowStart) >= d.cfg.Window {
+		d.windowStart = now
+		d.classes = make(map[string]*classWindow)
+	}
+
+	w, ok := d.classes[class]
+	if !ok {
+		w = &classWindow{keys: make(map[string]int64)}
+		d.classes[class] = w
+	}
+	w.denied++
+	if _, tracked := w.keys[resource]; tracked || len(w.keys) < maxTrackedKeys {
+		w.keys[resource]++
+	}
+
+	baseline := d.baselineFor(class)
+	if w.fired || w.denied <= baseline {
+		d.mu.Unlock()
+		return
+	}
+	w.fired = true
+
+	event := AnomalyEvent{
+		Class:       class,
+		RuleName:    ruleName,
+		Denied:      w.denied,
+		Baseline:    baseline,
+		WindowStart: d.windowStart,
+		Keys:        topKeys(w.keys, d.cfg.TopKeys),
+	}
+	if d.cfg.BlockDuration > 0 {
+		event.BlockedUntil = now.Add(d.cfg.BlockDuration)
+		d.blocked[class] = BlockedClass{Class: class, Until: event.BlockedUntil, Reason: "anomaly"}
+	}
+	d.mu.Unlock()
+
+	d.logger.Warn("检测到异常拒绝率",
+		clog.String("class", class),
+		clog.String("ruleName", ruleName),
+		clog.Int64("denied", event.Denied),
+		clog.Int64("baseline", baseline),
+		clog.Strings("keys", event.Keys),
+		clog.Bool("blocked", !event.BlockedUntil.IsZero()))
+
+	for _, h := range d.handlers {
+		go func(h AnomalyHandler) {
+			defer func() {
+				if r := recover(); r != nil {
+					d.logger.Error("异常拒绝回调发生panic", clog.Any("recover", r))
+				}
+			}()
+			h(context.WithoutCancel(ctx), event)
+		}(h)
+	}
+}
+
+// baselineFor 返回资源类的拒绝基线，调用方需持有锁
+func (d *anomalyDetector) baselineFor(class string) int64 {
+	if b, ok := d.cfg.Baselines[class]; ok && b > 0 {
+		return b
+	}
+	return d.cfg.Baseline
+}
+
+// block 手动封禁资源类
+func (d *anomalyDetector) block(class string, duration time.Duration, reason string) {
+	d.mu.Lock()
+	d.blocked[class] = BlockedClass{Class: class, Until: time.Now().Add(duration), Reason: reason}
+	d.mu.Unlock()
+}
+
+// unblock 解除资源类的封禁
+func (d *anomalyDetector) unblock(class string) {
+	d.mu.Lock()
+	delete(d.blocked, class)
+	d.mu.Unlock()
+}
+
+// listBlocked 返回当前未过期的封禁，按截止时间升序排列
+func (d *anomalyDetector) listBlocked() []BlockedClass {
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	result := make([]BlockedClass, 0, len(d.blocked))
+	for class, b := range d.blocked {
+		if now.After(b.Until) {
+			delete(d.blocked, class)
+			continue
+		}
+		result = append(result, b)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Until.Before(result[j].Until) })
+	return result
+}
+
+// topKeys 返回拒绝次数最多的 n 个资源
+func topKeys(keys map[string]int64, n int) []string {
+	result := make([]string, 0, len(keys))
+	for k := range keys {
+		result = append(result, k)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if keys[result[i]] != keys[result[j]] {
+			return keys[result[i]] > keys[result[j]]
+		}
+		return result[i] < result[j]
+	})
+	if len(result) > n {
+		result = result[:n]
+	}
+	return result
+}
+
+// IPPrefixClassifier 返回按 IP 前缀归类的 Classify 函数
+// 资源可以是裸 IP 或 BuildIPResourceKey 构建的 "ip:1.2.3.4"，
+// IPv4 按 v4Bits、IPv6 按 v6Bits 截取网段，如 "ip:1.2.3.0/24"；非 IP 资源不参与检测
+func IPPrefixClassifier(v4Bits, v6Bits int) func(resource string) string {
+	return func(resource string) string {
+		ip := net.ParseIP(strings.TrimPrefix(resource, "ip:"))
+		if ip == nil {
+			return ""
+		}
+		if v4 := ip.To4(); v4 != nil {
+			return "ip:" + (&net.IPNet{IP: v4.Mask(net.CIDRMask(v4Bits, 32)), Mask: net.CIDRMask(v4Bits, 32)}).String()
+		}
+		return "ip:" + (&net.IPNet{IP: ip.Mask(net.CIDRMask(v6Bits, 128)), Mask: net.CIDRMask(v6Bits, 128)}).String()
+	}
+}
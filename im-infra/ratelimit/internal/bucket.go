@@ -11,7 +11,9 @@ import (
 	"github.com/ceyewan/gochat/im-infra/clog"
 )
 
-// tokenBucketScript 令牌桶算法的 Lua 脚本
+// tokenBucketScript 令牌桶算法的 Lua 脚本。
+// 桶在补满所需的时间后与新建的桶等价，因此以补满时间（至少 1 分钟，保留短时间内的统计）作为过期时间，
+// 不活跃的资源不会在 Redis 中永久残留。
 // Keys:
 // 1. KEYS[1] - 令牌桶的 key
 // Args:
@@ -78,46 +80,50 @@ end
 
 -- 更新状态
 redis.call('hset', key, 'tokens', tokens, 'last_refill_ts', last_refill_ts, 'total_requests', total_requests, 'allowed_requests', allowed_requests)
+redis.call('pexpire', key, math.max(math.ceil(capacity / rate * 1000), 60000))
 
 return {allowed, math.floor(tokens), total_requests, allowed_requests}
 `
 
 // tokenBucket 令牌桶实现
 type tokenBucket struct {
-	cache     cache.Cache
+	cache     cache.Provider
 	logger    clog.Logger
+	mu        sync.Mutex
 	scriptSHA string
-	loadOnce  sync.Once
 }
 
 // newTokenBucket 创建一个新的令牌桶实例
-func newTokenBucket(cache cache.Cache) *tokenBucket {
+func newTokenBucket(cache cache.Provider) *tokenBucket {
 	return &tokenBucket{
 		cache:  cache,
 		logger: clog.Namespace("ratelimit.bucket"),
 	}
 }
 
-// ensureScript 确保 Lua 脚本已加载
-func (tb *tokenBucket) ensureScript(ctx context.Context) error {
-	var err error
-	tb.loadOnce.Do(func() {
-		var sha string
-		sha, err = tb.cache.ScriptLoad(ctx, tokenBucketScript)
-		if err != nil {
-			err = fmt.Errorf("failed to load token bucket script: %w", err)
-			return
-		}
-		tb.scriptSHA = sha
-		tb.logger.Info("令牌桶脚本加载成功", clog.String("sha", sha))
-	})
-	return err
+// loadScript 返回 Lua 脚本的 SHA。
+// 尚未加载，或当前 SHA 等于调用方发现已失效的 stale 时执行 SCRIPT LOAD；加载失败时下次调用重试。
+func (tb *tokenBucket) loadScript(ctx context.Context, stale string) (string, error) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	if tb.scriptSHA != "" && tb.scriptSHA != stale {
+		return tb.scriptSHA, nil
+	}
+
+	sha, err := tb.cache.Script().ScriptLoad(ctx, tokenBucketScript)
+	if err != nil {
+		return "", fmt.Errorf("failed to load token bucket script: %w", err)
+	}
+	tb.scriptSHA = sha
+	tb.logger.Info("令牌桶脚本加载成功", clog.String("sha", sha))
+	return sha, nil
 }
 
 // take 尝试从令牌桶获取指定数量的令牌
 func (tb *tokenBucket) take(ctx context.Context, key string, rule Rule, count int64) (bool, int64, int64, int64, error) {
 	// 确保脚本已加载
-	if err := tb.ensureScript(ctx); err != nil {
+	sha, err := tb.loadScript(ctx, "")
+	if err != nil {
 		return false, 0, 0, 0, err
 	}
 
@@ -129,18 +135,15 @@ func (tb *tokenBucket) take(ctx context.Context, key string, rule Rule, count in
 		count,
 	}
 
-	res, err := tb.cache.EvalSha(ctx, tb.scriptSHA, []string{key}, args...)
+	res, err := tb.cache.Script().EvalSha(ctx, sha, []string{key}, args...)
 	if err != nil {
 		// 如果脚本未找到，尝试重新加载
 		if isScriptNotFoundError(err) {
-			tb.scriptSHA = "" // 清除 SHA
-			tb.loadOnce = sync.Once{}
-
-			if err := tb.ensureScript(ctx); err != nil {
+			if sha, err = tb.loadScript(ctx, sha); err != nil {
 				return false, 0, 0, 0, err
 			}
 
-			res, err = tb.cache.EvalSha(ctx, tb.scriptSHA, []string{key}, args...)
+			res, err = tb.cache.Script().EvalSha(ctx, sha, []string{key}, args...)
 		}
 
 		if err != nil {
@@ -167,7 +170,7 @@ func (tb *tokenBucket) take(ctx context.Context, key string, rule Rule, count in
 
 // getStatistics 获取令牌桶的统计信息
 func (tb *tokenBucket) getStatistics(ctx context.Context, key string) (*BucketStatistics, error) {
-	data, err := tb.cache.HGetAll(ctx, key)
+	data, err := tb.cache.Hash().HGetAll(ctx, key)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get bucket statistics: %w", err)
 	}
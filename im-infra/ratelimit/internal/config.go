@@ -12,9 +12,51 @@ import (
 
 // RuleConfig 限流规则配置
 type RuleConfig struct {
-	Rate        float64 `json:"rate"`        // 令牌产生速率 (tokens/second)
-	Capacity    int64   `json:"capacity"`    // 桶容量
-	Description string  `json:"description"` // 规则描述
+	Rate           float64          `json:"rate"`                     // 令牌产生速率 (tokens/second)
+	Capacity       int64            `json:"capacity"`                 // 桶容量
+	Algorithm      string           `json:"algorithm"`                // 限流算法，为空时使用令牌桶
+	Costs          map[string]int64 `json:"costs,omitempty"`          // 按操作定义的令牌消耗
+	MaxCost        int64            `json:"maxCost,omitempty"`        // 单次调用的最大令牌消耗
+	WarmUp         string           `json:"warmUp,omitempty"`         // 预热时长，如 "30s"
+	WarmUpFraction float64          `json:"warmUpFraction,omitempty"` // 预热开始时的速率占比
+	Description    string           `json:"description"`              // 规则描述
+}
+
+// newRuleConfig 将规则转换为配置中心中保存的格式
+func newRuleConfig(rule Rule, description string) RuleConfig {
+	ruleConfig := RuleConfig{
+		Rate:           rule.Rate,
+		Capacity:       rule.Capacity,
+		Algorithm:      rule.Algorithm,
+		Costs:          rule.Costs,
+		MaxCost:        rule.MaxCost,
+		WarmUpFraction: rule.WarmUpFraction,
+		Description:    description,
+	}
+	if rule.WarmUp > 0 {
+		ruleConfig.WarmUp = rule.WarmUp.String()
+	}
+	return ruleConfig
+}
+
+// toRule 将配置中心中的规则转换为内部规则格式
+func (c RuleConfig) toRule() (Rule, error) {
+	rule := Rule{
+		Rate:           c.Rate,
+		Capacity:       c.Capacity,
+		Algorithm:      c.Algorithm,
+		Costs:          c.Costs,
+		MaxCost:        c.MaxCost,
+		WarmUpFraction: c.WarmUpFraction,
+	}
+	if c.WarmUp != "" {
+		warmUp, err := time.ParseDuration(c.WarmUp)
+		if err != nil {
+			return Rule{}, fmt.Errorf("invalid warm up duration %q: %w", c.WarmUp, err)
+		}
+		rule.WarmUp = warmUp
+	}
+	return rule, nil
 }
 
 // loadRules 从配置中心加载所有规则
@@ -45,9 +87,13 @@ func (l *limiter) loadRules() error {
 		}
 
 		// 转换为内部规则格式
-		rule := Rule{
-			Rate:     ruleConfig.Rate,
-			Capacity: ruleConfig.Capacity,
+		rule, err := ruleConfig.toRule()
+		if err == nil {
+			err = validateRule(rule)
+		}
+		if err != nil {
+			l.logger.Warn("规则无效，已跳过", clog.String("key", key), clog.Err(err))
+			continue
 		}
 
 		newRules[ruleName] = rule
@@ -58,6 +104,15 @@ func (l *limiter) loadRules() error {
 	}
 
 	l.mu.Lock()
+	now := time.Now()
+	for name, rule := range newRules {
+		l.trackRuleChange(name, rule, now)
+	}
+	for name := range l.changedAt {
+		if _, ok := newRules[name]; !ok {
+			delete(l.changedAt, name)
+		}
+	}
 	l.rules = newRules
 	l.mu.Unlock()
 
@@ -194,6 +249,32 @@ func validateRule(rule Rule) error {
 	if rule.Capacity > 1000000 {
 		return fmt.Errorf("capacity too high, maximum is 1000000, got: %d", rule.Capacity)
 	}
+	switch rule.Algorithm {
+	case "", AlgorithmTokenBucket, AlgorithmGCRA:
+	default:
+		return fmt.Errorf("unknown algorithm: %s", rule.Algorithm)
+	}
+	// 超过容量的消耗永远无法被满足
+	if rule.MaxCost < 0 || rule.MaxCost > rule.Capacity {
+		return fmt.Errorf("max cost must be between 0 and capacity %d, got: %d", rule.Capacity, rule.MaxCost)
+	}
+	if rule.WarmUp < 0 {
+		return fmt.Errorf("warm up must not be negative, got: %s", rule.WarmUp)
+	}
+	if rule.WarmUpFraction < 0 || rule.WarmUpFraction > 1 {
+		return fmt.Errorf("warm up fraction must be between 0 and 1, got: %f", rule.WarmUpFraction)
+	}
+	for operation, cost := range rule.Costs {
+		if cost <= 0 {
+			return fmt.Errorf("cost of operation %s must be positive, got: %d", operation, cost)
+		}
+		if cost > rule.Capacity {
+			return fmt.Errorf("cost of operation %s exceeds capacity %d, got: %d", operation, rule.Capacity, cost)
+		}
+		if rule.MaxCost > 0 && cost > rule.MaxCost {
+			return fmt.Errorf("cost of operation %s exceeds max cost %d, got: %d", operation, rule.MaxCost, cost)
+		}
+	}
 	return nil
 }
 
@@ -211,6 +292,7 @@ func (l *limiter) setRule(ctx context.Context, ruleName string, rule Rule) error
 	if l.rules == nil {
 		l.rules = make(map[string]Rule)
 	}
+	l.trackRuleChange(ruleName, rule, time.Now())
 	l.rules[ruleName] = rule
 	l.mu.Unlock()
 
@@ -219,11 +301,7 @@ func (l *limiter) setRule(ctx context.Context, ruleName string, rule Rule) error
 		configPath := l.buildConfigPath()
 		ruleKey := fmt.Sprintf("%s/%s", configPath, ruleName)
 
-		ruleConfig := RuleConfig{
-			Rate:        rule.Rate,
-			Capacity:    rule.Capacity,
-			Description: fmt.Sprintf("动态设置的规则：%s", ruleName),
-		}
+		ruleConfig := newRuleConfig(rule, fmt.Sprintf("动态设置的规则：%s", ruleName))
 
 		if err := l.opts.CoordinationClient.Config().Set(ctx, ruleKey, ruleConfig); err != nil {
 			l.logger.Warn("无法将规则保存到配置中心",
@@ -236,7 +314,8 @@ func (l *limiter) setRule(ctx context.Context, ruleName string, rule Rule) error
 	l.logger.Info("限流规则已设置",
 		clog.String("ruleName", ruleName),
 		clog.Float64("rate", rule.Rate),
-		clog.Int64("capacity", rule.Capacity))
+		clog.Int64("capacity", rule.Capacity),
+		clog.String("algorithm", rule.Algorithm))
 
 	return nil
 }
@@ -307,11 +386,7 @@ func (l *limiter) exportRules(ctx context.Context) error {
 	exportCount := 0
 	for ruleName, rule := range rules {
 		ruleKey := fmt.Sprintf("%s/%s", configPath, ruleName)
-		ruleConfig := RuleConfig{
-			Rate:        rule.Rate,
-			Capacity:    rule.Capacity,
-			Description: fmt.Sprintf("导出的规则：%s", ruleName),
-		}
+		ruleConfig := newRuleConfig(rule, fmt.Sprintf("导出的规则：%s", ruleName))
 
 		if err := l.opts.CoordinationClient.Config().Set(ctx, ruleKey, ruleConfig); err != nil {
 			l.logger.Error("导出规则失败",
@@ -0,0 +1,278 @@
+package internal
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+)
+
+// ErrInvalidConnRules 连接限流规则无效
+var ErrInvalidConnRules = errors.New("invalid connection rate limit rules")
+
+// ConnRules 单个连接的流式限流规则，消息数和字节数分别用本地令牌桶限制，
+// 两者都为 0 时不限流
+type ConnRules struct {
+	// MessagesPerSecond 每秒允许的帧数，0 表示不限制帧数
+	MessagesPerSecond float64
+
+	// MessageBurst 帧数突发容量，默认为 MessagesPerSecond 向上取整
+	MessageBurst int64
+
+	// BytesPerSecond 每秒允许的字节数，0 表示不限制字节数
+	BytesPerSecond float64
+
+	// ByteBurst 字节数突发容量，默认为 BytesPerSecond 向上取整，单帧超过该值时总是被拒绝
+	ByteBurst int64
+}
+
+// validate 校验规则并补全突发容量的默认值
+func (r ConnRules) validate() (ConnRules, error) {
+	if r.MessagesPerSecond < 0 || r.BytesPerSecond < 0 || r.MessageBurst < 0 || r.ByteBurst < 0 {
+		return r, ErrInvalidConnRules
+	}
+	if r.MessagesPerSecond > 0 && r.MessageBurst == 0 {
+		r.MessageBurst = int64(math.Ceil(r.MessagesPerSecond))
+	}
+	if r.BytesPerSecond > 0 && r.ByteBurst == 0 {
+		r.ByteBurst = int64(math.Ceil(r.BytesPerSecond))
+	}
+	return r, nil
+}
+
+// ConnStats 连接的限流统计
+type ConnStats struct {
+	ConnID       string    `json:"conn_id"`
+	Frames       int64     `json:"frames"`        // 放行的帧数
+	Bytes        int64     `json:"bytes"`         // 放行的字节数
+	DeniedFrames int64     `json:"denied_frames"` // 被拒绝的帧数
+	DeniedBytes  int64     `json:"denied_bytes"`  // 被拒绝的字节数
+	LastActive   time.Time `json:"last_active"`   // 最近一次 AllowFrame 的时间
+}
+
+// localBucket 进程内令牌桶，rate 为 0 时不限流
+type localBucket struct {
+	rate     float64
+	capacity float64
+	tokens   float64
+}
+
+// refill 按经过的时间补充令牌
+func (b *localBucket) refill(elapsed time.Duration) {
+	if b.rate == 0 || elapsed <= 0 {
+		return
+	}
+	b.tokens = math.Min(b.capacity, b.tokens+elapsed.Seconds()*b.rate)
+}
+
+// has 判断桶内是否有 n 个令牌
+func (b *localBucket) has(n float64) bool {
+	return b.rate == 0 || b.tokens >= n
+}
+
+func (b *localBucket) take(n float64) {
+	if b.rate != 0 {
+		b.tokens -= n
+	}
+}
+
+// ConnLimiter 单个 WebSocket 连接的流式限流器，完全在本地内存中计算，不访问 Redis，
+// 适合对每个连接的上行帧做防刷保护。可以被多个 goroutine 并发使用
+type ConnLimiter struct {
+	connID string
+	rules  ConnRules
+
+	mu       sync.Mutex
+	messages localBucket
+	bytes    localBucket
+	last     time.Time
+	stats    ConnStats
+}
+
+// NewConnLimiter 为连接创建流式限流器，两个桶初始都是满的
+func NewConnLimiter(connID string, rules ConnRules) (*ConnLimiter, error) {
+	rules, err := rules.validate()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return &ConnLimiter{
+		connID:   connID,
+		rules:    rules,
+		messages: localBucket{rate: rules.MessagesPerSecond, capacity: float64(rules.MessageBurst), tokens: float64(rules.MessageBurst)},
+		bytes:    localBucket{rate: rules.BytesPerSecond, capacity: float64(rules.ByteBurst), tokens: float64(rules.ByteBurst)},
+		last:     now,
+		stats:    ConnStats{ConnID: connID, LastActive: now},
+	}, nil
+}
+
+// AllowFrame 判断一个 size 字节的帧是否被允许，帧数和字节数都有余量时才放行并同时扣减，
+// 被拒绝的帧不消耗令牌
+func (c *ConnLimiter) AllowFrame(size int) bool {
+	if size < 0 {
+		size = 0
+	}
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elapsed := now.Sub(c.last)
+	c.last = now
+	c.messages.refill(elapsed)
+	c.bytes.refill(elapsed)
+	c.stats.LastActive = now
+
+	if !c.messages.has(1) || !c.bytes.has(float64(size)) {
+		c.stats.DeniedFrames++
+		c.stats.DeniedBytes += int64(size)
+		return false
+	}
+	c.messages.take(1)
+	c.bytes.take(float64(size))
+	c.stats.Frames++
+	c.stats.Bytes += int64(size)
+	return true
+}
+
+// ConnID 返回连接 ID
+func (c *ConnLimiter) ConnID() string {
+	return c.connID
+}
+
+// Stats 返回连接的限流统计
+func (c *ConnLimiter) Stats() ConnStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// lastActive 返回最近一次 AllowFrame 的时间
+func (c *ConnLimiter) lastActive() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats.LastActive
+}
+
+// ConnLimiterPool 按连接 ID 管理 ConnLimiter，所有连接共用同一组规则。
+// 连接关闭时调用 Release 释放限流器；未 Release 且超过 idleTimeout 没有帧的限流器会被后台清理，
+// 避免连接异常断开时泄漏
+type ConnLimiterPool struct {
+	rules       ConnRules
+	idleTimeout time.Duration
+	logger      clog.Logger
+
+	mu    sync.Mutex
+	conns map[string]*ConnLimiter
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewConnLimiterPool 创建连接限流器池，idleTimeout 为 0 时不做空闲清理
+func NewConnLimiterPool(rules ConnRules, idleTimeout time.Duration) (*ConnLimiterPool, error) {
+	rules, err := rules.validate()
+	if err != nil {
+		return nil, err
+	}
+	if idleTimeout < 0 {
+		return nil, ErrInvalidConnRules
+	}
+
+	p := &ConnLimiterPool{
+		rules:       rules,
+		idleTimeout: idleTimeout,
+		logger:      clog.Namespace("ratelimit").Namespace("conn"),
+		conns:       make(map[string]*ConnLimiter),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	if idleTimeout > 0 {
+		go p.sweepLoop()
+	} else {
+		close(p.done)
+	}
+	return p, nil
+}
+
+// Get 返回连接的限流器，不存在时创建
+func (p *ConnLimiterPool) Get(connID string) *ConnLimiter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if c, ok := p.conns[connID]; ok {
+		return c
+	}
+	// 规则已在创建池时校验，这里不会出错
+	c, _ := NewConnLimiter(connID, p.rules)
+	p.conns[connID] = c
+	return c
+}
+
+// AllowFrame 是 Get(connID).AllowFrame(size) 的简写
+func (p *ConnLimiterPool) AllowFrame(connID string, size int) bool {
+	return p.Get(connID).AllowFrame(size)
+}
+
+// Release 在连接关闭时释放其限流器
+func (p *ConnLimiterPool) Release(connID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.conns, connID)
+}
+
+// Len 返回当前管理的连接数
+func (p *ConnLimiterPool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.conns)
+}
+
+// Close 停止空闲清理并释放所有限流器
+func (p *ConnLimiterPool) Close() error {
+	p.closeOnce.Do(func() {
+		close(p.stop)
+		<-p.done
+		p.mu.Lock()
+		p.conns = make(map[string]*ConnLimiter)
+		p.mu.Unlock()
+	})
+	return nil
+}
+
+// sweepLoop 每半个 idleTimeout 清理一次空闲的限流器
+func (p *ConnLimiterPool) sweepLoop() {
+	defer close(p.done)
+	ticker := time.NewTicker(p.idleTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case now := <-ticker.C:
+			p.sweep(now)
+		}
+	}
+}
+
+// sweep 移除在 now 之前 idleTimeout 内没有帧的限流器
+func (p *ConnLimiterPool) sweep(now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	removed := 0
+	for id, c := range p.conns {
+		if now.Sub(c.lastActive()) >= p.idleTimeout {
+			delete(p.conns, id)
+			removed++
+		}
+	}
+	if removed > 0 {
+		p.logger.Debug("已清理空闲的连接限流器",
+			clog.Int("removed", removed),
+			clog.Int("remaining", len(p.conns)))
+	}
+}
@@ -0,0 +1,169 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/cache"
+	"github.com/ceyewan/gochat/im-infra/clog"
+)
+
+// gcraScript GCRA（generic cell rate algorithm）的 Lua 脚本。
+// 每个资源只保存一个理论到达时间（TAT），相比令牌桶的哈希结构占用更少内存，
+// 并且请求被均匀地放行，不会在补充令牌的瞬间出现集中放行。
+// 时间单位均为微秒，避免纳秒时间戳超出 Lua 双精度浮点数的整数精度。
+// Keys:
+// 1. KEYS[1] - 保存 TAT 的 key
+// Args:
+// 1. ARGV[1] - 发射间隔 (microseconds per request)
+// 2. ARGV[2] - 突发容忍度 (microseconds，等于 发射间隔 * 容量)
+// 3. ARGV[3] - 当前时间戳 (microseconds)
+// 4. ARGV[4] - 请求数量
+// Returns:
+// 1. 是否允许 (1=允许, 0=拒绝)
+// 2. 剩余可突发的请求数
+// 3. 被拒绝时需要等待的时间 (microseconds)
+const gcraScript = `
+local key = KEYS[1]
+local interval = tonumber(ARGV[1])
+local tolerance = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local requested = tonumber(ARGV[4])
+
+local tat = tonumber(redis.call('get', key))
+if not tat or tat < now then
+    tat = now
+end
+
+local new_tat = tat + interval * requested
+local allow_at = new_tat - tolerance
+
+if allow_at > now then
+    local remaining = math.floor((tolerance - (tat - now)) / interval)
+    if remaining < 0 then
+        remaining = 0
+    end
+    return {0, remaining, math.ceil(allow_at - now)}
+end
+
+-- 以整数字符串保存，避免 Lua 默认的 %.14g 格式丢失精度
+redis.call('set', key, string.format('%.0f', new_tat), 'px', math.ceil((new_tat - now) / 1000))
+return {1, math.floor((tolerance - (new_tat - now)) / interval), 0}
+`
+
+// gcra 基于 Redis 单 key 的分布式 GCRA 限流实现
+type gcra struct {
+	cache     cache.Provider
+	logger    clog.Logger
+	mu        sync.Mutex
+	scriptSHA string
+}
+
+// newGCRA 创建一个新的 GCRA 限流实例
+func newGCRA(cache cache.Provider) *gcra {
+	return &gcra{
+		cache:  cache,
+		logger: clog.Namespace("ratelimit.gcra"),
+	}
+}
+
+// loadScript 返回 Lua 脚本的 SHA。
+// 尚未加载，或当前 SHA 等于调用方发现已失效的 stale 时执行 SCRIPT LOAD；加载失败时下次调用重试。
+func (g *gcra) loadScript(ctx context.Context, stale string) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.scriptSHA != "" && g.scriptSHA != stale {
+		return g.scriptSHA, nil
+	}
+
+	sha, err := g.cache.Script().ScriptLoad(ctx, gcraScript)
+	if err != nil {
+		return "", fmt.Errorf("failed to load gcra script: %w", err)
+	}
+	g.scriptSHA = sha
+	g.logger.Info("GCRA 脚本加载成功", clog.String("sha", sha))
+	return sha, nil
+}
+
+// gcraParams 将规则换算为脚本参数：发射间隔和突发容忍度（微秒）
+func gcraParams(rule Rule) (interval, tolerance int64) {
+	interval = int64(math.Ceil(1e6 / rule.Rate))
+	return interval, interval * rule.Capacity
+}
+
+// take 尝试放行 count 个请求，返回是否允许、剩余可突发数和被拒绝时的建议等待时间
+func (g *gcra) take(ctx context.Context, key string, rule Rule, count int64) (bool, int64, time.Duration, error) {
+	sha, err := g.loadScript(ctx, "")
+	if err != nil {
+		return false, 0, 0, err
+	}
+
+	interval, tolerance := gcraParams(rule)
+	args := []interface{}{
+		interval,
+		tolerance,
+		time.Now().UnixMicro(),
+		count,
+	}
+
+	res, err := g.cache.Script().EvalSha(ctx, sha, []string{key}, args...)
+	if err != nil {
+		// 如果脚本未找到（如 Redis 重启或执行了 SCRIPT FLUSH），重新加载
+		if isScriptNotFoundError(err) {
+			if sha, err = g.loadScript(ctx, sha); err != nil {
+				return false, 0, 0, err
+			}
+
+			res, err = g.cache.Script().EvalSha(ctx, sha, []string{key}, args...)
+		}
+
+		if err != nil {
+			return false, 0, 0, fmt.Errorf("failed to execute gcra script: %w", err)
+		}
+	}
+
+	result, ok := res.([]interface{})
+	if !ok || len(result) < 3 {
+		return false, 0, 0, fmt.Errorf("invalid response from gcra script: %v", res)
+	}
+
+	allowed, ok := result[0].(int64)
+	if !ok {
+		return false, 0, 0, fmt.Errorf("invalid allowed value: %v", result[0])
+	}
+	remaining, _ := result[1].(int64)
+	retryAfter, _ := result[2].(int64)
+
+	return allowed == 1, remaining, time.Duration(retryAfter) * time.Microsecond, nil
+}
+
+// getStatistics 根据 TAT 计算当前剩余可突发的请求数。
+// GCRA 不保存请求计数，因此只返回 CurrentTokens。
+func (g *gcra) getStatistics(ctx context.Context, key string, rule Rule) (*BucketStatistics, error) {
+	interval, tolerance := gcraParams(rule)
+	stats := &BucketStatistics{CurrentTokens: rule.Capacity}
+
+	value, err := g.cache.String().Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, cache.ErrCacheMiss) {
+			return stats, nil
+		}
+		return nil, fmt.Errorf("failed to get gcra state: %w", err)
+	}
+
+	tat, ok := toInt64(value)
+	if !ok {
+		return stats, nil
+	}
+	if backlog := tat - time.Now().UnixMicro(); backlog > 0 {
+		stats.CurrentTokens = (tolerance - backlog) / interval
+		if stats.CurrentTokens < 0 {
+			stats.CurrentTokens = 0
+		}
+	}
+	return stats, nil
+}
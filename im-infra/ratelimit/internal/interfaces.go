@@ -8,11 +8,11 @@ import (
 // RateLimiter 是限流器的主接口
 // 它定义了检查请求是否被允许的核心方法
 type RateLimiter interface {
-	// Allow 检查给定资源的单个请求是否被允许
-	Allow(ctx context.Context, resource string, ruleName string) (bool, error)
+	// Allow 检查给定资源的单个请求是否被允许，可通过 WithOperation/WithCost 指定请求的权重
+	Allow(ctx context.Context, resource string, ruleName string, opts ...AllowOption) (bool, error)
 
-	// AllowN 检查给定资源的N个请求是否被允许
-	AllowN(ctx context.Context, resource string, ruleName string, n int64) (bool, error)
+	// AllowN 检查给定资源的N个请求是否被允许，共消耗 n * cost 个令牌
+	AllowN(ctx context.Context, resource string, ruleName string, n int64, opts ...AllowOption) (bool, error)
 
 	// BatchAllow 批量处理限流请求
 	BatchAllow(ctx context.Context, requests []RateLimitRequest) ([]bool, error)
@@ -43,6 +43,15 @@ type RateLimiterManager interface {
 	// ReloadRules 重新加载配置中心的规则
 	ReloadRules() error
 
+	// BlockClass 临时封禁资源类，封禁期间该类资源的请求直接被拒绝，需启用异常检测
+	BlockClass(class string, duration time.Duration) error
+
+	// UnblockClass 解除资源类的封禁
+	UnblockClass(class string) error
+
+	// ListBlockedClasses 获取当前被封禁的资源类
+	ListBlockedClasses() []BlockedClass
+
 	// GetServiceName 获取服务名称
 	GetServiceName() string
 }
@@ -128,6 +137,10 @@ type RateLimitRequest struct {
 	Resource string
 	RuleName string
 	Count    int64
+	// Operation 操作名称，按 Rule.Costs 计算权重
+	Operation string
+	// Cost 单次请求消耗的令牌数，优先级高于 Operation
+	Cost int64
 }
 
 // RateLimitStatistics 限流统计信息
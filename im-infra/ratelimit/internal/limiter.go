@@ -2,6 +2,7 @@ package internal
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -21,6 +22,11 @@ type limiter struct {
 	ctx         context.Context
 	cancel      context.CancelFunc
 	bucket      *tokenBucket
+	gcra        *gcra
+	anomaly     *anomalyDetector
+	adaptive    *adaptiveRefill
+	started     time.Time            // 实例启动时间，冷启动预热的起点
+	changedAt   map[string]time.Time // 规则最近一次变更的时间，变更后重新预热
 }
 
 var (
@@ -28,6 +34,12 @@ var (
 	defaultLimiterOnce sync.Once
 )
 
+// ErrCostExceeded 单次调用消耗的令牌数超过规则的 MaxCost
+var ErrCostExceeded = errors.New("request cost exceeds rule max cost")
+
+// ErrAnomalyDisabled 未通过 WithAnomalyDetection 启用异常检测
+var ErrAnomalyDisabled = errors.New("anomaly detection is disabled")
+
 // New 创建一个新的限流器实例
 func New(ctx context.Context, serviceName string, opts ...Option) (RateLimiter, error) {
 	// 应用默认选项
@@ -39,16 +51,20 @@ func New(ctx context.Context, serviceName string, opts ...Option) (RateLimiter,
 	// 应用默认配置
 	options.applyDefaults()
 
+	if options.Adaptive.Signal != nil && options.Adaptive.TargetLatency <= 0 {
+		return nil, fmt.Errorf("adaptive refill target latency must be positive, got: %s", options.Adaptive.TargetLatency)
+	}
+
 	// 如果没有提供客户端，则使用默认的
 	if options.CacheClient == nil {
-		defaultCacheClient, err := cache.New(ctx, cache.DefaultConfig())
+		defaultCacheClient, err := cache.New(ctx, cache.GetDefaultConfig("development"))
 		if err != nil {
 			return nil, fmt.Errorf("failed to create default cache client: %w", err)
 		}
 		options.CacheClient = defaultCacheClient
 	}
 	if options.CoordinationClient == nil {
-		defaultCoordClient, err := coordination.New(ctx, coordination.DefaultConfig())
+		defaultCoordClient, err := coordination.New(ctx, coordination.GetDefaultConfig("development"))
 		if err != nil {
 			return nil, fmt.Errorf("failed to create default coordination client: %w", err)
 		}
@@ -65,7 +81,12 @@ func New(ctx context.Context, serviceName string, opts ...Option) (RateLimiter,
 		ctx:         limiterCtx,
 		cancel:      cancel,
 		bucket:      newTokenBucket(options.CacheClient),
+		gcra:        newGCRA(options.CacheClient),
+		started:     time.Now(),
+		changedAt:   make(map[string]time.Time),
 	}
+	l.anomaly = newAnomalyDetector(options.Anomaly, options.AnomalyHandlers, l.logger)
+	l.adaptive = newAdaptiveRefill(options.Adaptive, l.logger)
 
 	// 初始加载规则
 	if err := l.loadRules(); err != nil {
@@ -78,6 +99,10 @@ func New(ctx context.Context, serviceName string, opts ...Option) (RateLimiter,
 	// 启动后台规则刷新
 	l.startRuleRefresher()
 
+	if l.adaptive != nil {
+		go l.adaptive.run(limiterCtx)
+	}
+
 	return l, nil
 }
 
@@ -94,12 +119,12 @@ func Default() RateLimiter {
 }
 
 // Allow 检查给定资源的单个请求是否被允许
-func (l *limiter) Allow(ctx context.Context, resource string, ruleName string) (bool, error) {
-	return l.AllowN(ctx, resource, ruleName, 1)
+func (l *limiter) Allow(ctx context.Context, resource string, ruleName string, opts ...AllowOption) (bool, error) {
+	return l.AllowN(ctx, resource, ruleName, 1, opts...)
 }
 
-// AllowN 检查给定资源的N个请求是否被允许
-func (l *limiter) AllowN(ctx context.Context, resource string, ruleName string, n int64) (bool, error) {
+// AllowN 检查给定资源的N个请求是否被允许，共消耗 n * cost 个令牌
+func (l *limiter) AllowN(ctx context.Context, resource string, ruleName string, n int64, opts ...AllowOption) (bool, error) {
 	if n <= 0 {
 		return true, nil
 	}
@@ -113,24 +138,61 @@ func (l *limiter) AllowN(ctx context.Context, resource string, ruleName string,
 		return true, nil
 	}
 
-	// 构建 Redis Key
-	key := fmt.Sprintf("ratelimit:%s:%s:%s", l.serviceName, ruleName, resource)
+	// 按操作权重换算需要消耗的令牌数
+	var allowOpts AllowOptions
+	for _, o := range opts {
+		o(&allowOpts)
+	}
+	cost := rule.costFor(allowOpts)
+	tokens := n * cost
+	if rule.MaxCost > 0 && tokens > rule.MaxCost {
+		l.logger.Warn("请求消耗超过规则上限",
+			clog.String("ruleName", ruleName),
+			clog.String("operation", allowOpts.Operation),
+			clog.Int64("tokens", tokens),
+			clog.Int64("maxCost", rule.MaxCost))
+		return false, fmt.Errorf("%w: %d > %d", ErrCostExceeded, tokens, rule.MaxCost)
+	}
+
+	// 被临时封禁的资源类直接拒绝，不再访问 Redis
+	if l.anomaly != nil {
+		if class, blocked := l.anomaly.isBlocked(resource); blocked {
+			l.logger.Debug("资源类已被封禁，拒绝请求",
+				clog.String("class", class),
+				clog.String("resource", resource))
+			return false, nil
+		}
+	}
 
-	// 执行令牌桶算法
-	allowed, _, _, _, err := l.bucket.take(ctx, key, rule, n)
+	// 预热期间或下游变慢时以降低后的速率补充令牌
+	rule = l.effectiveRule(ruleName, rule)
+	key := l.key(rule, ruleName, resource)
+
+	// 按规则选择的算法执行限流脚本
+	var allowed bool
+	var err error
+	if rule.Algorithm == AlgorithmGCRA {
+		allowed, _, _, err = l.gcra.take(ctx, key, rule, tokens)
+	} else {
+		allowed, _, _, _, err = l.bucket.take(ctx, key, rule, tokens)
+	}
 	if err != nil {
 		l.logger.Error("执行限流脚本失败，默认允许",
 			clog.String("key", key),
-			clog.Int64("requested", n),
+			clog.Int64("requested", tokens),
 			clog.Err(err))
 		// 出错时默认允许，保证系统可用性
 		return true, err
 	}
 
+	if !allowed && l.anomaly != nil {
+		l.anomaly.recordDenied(ctx, resource, ruleName)
+	}
+
 	l.logger.Debug("限流检查完成",
 		clog.String("key", key),
 		clog.Bool("allowed", allowed),
-		clog.Int64("requested", n))
+		clog.Int64("requested", tokens))
 
 	return allowed, nil
 }
@@ -148,7 +210,8 @@ func (l *limiter) BatchAllow(ctx context.Context, requests []RateLimitRequest) (
 			count = 1
 		}
 
-		allowed, err := l.AllowN(ctx, req.Resource, req.RuleName, count)
+		allowed, err := l.AllowN(ctx, req.Resource, req.RuleName, count,
+			WithOperation(req.Operation), WithCost(req.Cost))
 		if err != nil {
 			return nil, fmt.Errorf("批量请求第%d个失败: %w", i, err)
 		}
@@ -158,11 +221,28 @@ func (l *limiter) BatchAllow(ctx context.Context, requests []RateLimitRequest) (
 	return results, nil
 }
 
+// key 返回资源在 Redis 中的状态键。
+// 令牌桶保存哈希、GCRA 保存字符串，两种算法使用不同的键，规则运行时切换算法后
+// 从新的空状态开始计算，不会因键类型不匹配（WRONGTYPE）而持续失败
+func (l *limiter) key(rule Rule, ruleName, resource string) string {
+	if rule.Algorithm == AlgorithmGCRA {
+		return fmt.Sprintf("ratelimit:gcra:%s:%s:%s", l.serviceName, ruleName, resource)
+	}
+	return fmt.Sprintf("ratelimit:%s:%s:%s", l.serviceName, ruleName, resource)
+}
+
 // GetStatistics 获取限流统计信息
 func (l *limiter) GetStatistics(ctx context.Context, resource string, ruleName string) (*RateLimitStatistics, error) {
-	key := fmt.Sprintf("ratelimit:%s:%s:%s", l.serviceName, ruleName, resource)
-
-	bucketStats, err := l.bucket.getStatistics(ctx, key)
+	rule, _ := l.getRule(ruleName)
+	key := l.key(rule, ruleName, resource)
+
+	var bucketStats *BucketStatistics
+	var err error
+	if rule.Algorithm == AlgorithmGCRA {
+		bucketStats, err = l.gcra.getStatistics(ctx, key, l.effectiveRule(ruleName, rule))
+	} else {
+		bucketStats, err = l.bucket.getStatistics(ctx, key)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("获取统计信息失败: %w", err)
 	}
@@ -226,6 +306,34 @@ func (l *limiter) ReloadRules() error {
 	return l.loadRules()
 }
 
+// BlockClass 临时封禁资源类（公开方法）
+func (l *limiter) BlockClass(class string, duration time.Duration) error {
+	if l.anomaly == nil {
+		return ErrAnomalyDisabled
+	}
+	l.anomaly.block(class, duration, "manual")
+	l.logger.Info("资源类已封禁", clog.String("class", class), clog.Duration("duration", duration))
+	return nil
+}
+
+// UnblockClass 解除资源类的封禁（公开方法）
+func (l *limiter) UnblockClass(class string) error {
+	if l.anomaly == nil {
+		return ErrAnomalyDisabled
+	}
+	l.anomaly.unblock(class)
+	l.logger.Info("资源类已解除封禁", clog.String("class", class))
+	return nil
+}
+
+// ListBlockedClasses 获取当前被封禁的资源类（公开方法）
+func (l *limiter) ListBlockedClasses() []BlockedClass {
+	if l.anomaly == nil {
+		return nil
+	}
+	return l.anomaly.listBlocked()
+}
+
 // GetServiceName 获取服务名称
 func (l *limiter) GetServiceName() string {
 	return l.serviceName
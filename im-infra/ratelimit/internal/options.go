@@ -10,7 +10,7 @@ import (
 // Options 用于配置 RateLimiter 的行为
 type Options struct {
 	// CacheClient 缓存客户端，用于存储令牌桶数据
-	CacheClient cache.Cache
+	CacheClient cache.Provider
 
 	// CoordinationClient 协调客户端，用于配置管理
 	CoordinationClient coordination.Provider
@@ -47,6 +47,15 @@ type Options struct {
 
 	// RetryDelay 重试延迟，默认为100ms
 	RetryDelay time.Duration
+
+	// Anomaly 异常拒绝检测配置，未设置 Classify 时不启用
+	Anomaly AnomalyConfig
+
+	// AnomalyHandlers 检测到异常拒绝时的回调
+	AnomalyHandlers []AnomalyHandler
+
+	// Adaptive 自适应补充速率配置，未设置 Signal 时不启用
+	Adaptive AdaptiveConfig
 }
 
 // Rule 定义了单个限流规则
@@ -56,6 +65,70 @@ type Rule struct {
 
 	// Capacity 令牌桶的最大容量，即允许的突发请求峰值
 	Capacity int64 `json:"capacity"`
+
+	// Algorithm 限流算法，AlgorithmTokenBucket（默认）或 AlgorithmGCRA
+	Algorithm string `json:"algorithm,omitempty"`
+
+	// Costs 按操作定义单次请求消耗的令牌数，如发送图片比发送文本消耗更多令牌。
+	// 通过 WithOperation 指定操作，未定义的操作消耗 1 个令牌
+	Costs map[string]int64 `json:"costs,omitempty"`
+
+	// MaxCost 单次调用允许消耗的最大令牌数（n * cost），超过时返回 ErrCostExceeded，
+	// 0 表示不限制（仍受 Capacity 约束）
+	MaxCost int64 `json:"maxCost,omitempty"`
+
+	// WarmUp 预热时长，大于 0 时在冷启动或规则变更后，有效速率在该时长内
+	// 从 Rate * WarmUpFraction 线性升至 Rate，避免实例重启时的惊群
+	WarmUp time.Duration `json:"warmUp,omitempty"`
+
+	// WarmUpFraction 预热开始时的速率占比，取值 (0, 1]，默认 0.1
+	WarmUpFraction float64 `json:"warmUpFraction,omitempty"`
+}
+
+// 限流算法
+const (
+	// AlgorithmTokenBucket 令牌桶算法，每个资源保存令牌数和请求统计
+	AlgorithmTokenBucket = "token_bucket"
+	// AlgorithmGCRA 通用信元速率算法，每个资源只保存一个时间戳，
+	// 放行更平滑、内存占用更小，适合海量的按用户限流 key，但不记录请求统计
+	AlgorithmGCRA = "gcra"
+)
+
+// AllowOptions 控制单次 Allow/AllowN 调用的令牌消耗
+type AllowOptions struct {
+	// Operation 操作名称，用于从 Rule.Costs 中查找单次请求的消耗
+	Operation string
+
+	// Cost 显式指定单次请求消耗的令牌数，优先级高于 Operation
+	Cost int64
+}
+
+// AllowOption 是一个函数，用于修改 AllowOptions 结构体
+type AllowOption func(*AllowOptions)
+
+// WithOperation 按规则中定义的操作权重消耗令牌
+func WithOperation(operation string) AllowOption {
+	return func(o *AllowOptions) {
+		o.Operation = operation
+	}
+}
+
+// WithCost 显式指定单次请求消耗的令牌数
+func WithCost(cost int64) AllowOption {
+	return func(o *AllowOptions) {
+		o.Cost = cost
+	}
+}
+
+// costFor 计算单次请求消耗的令牌数：显式 Cost > Rule.Costs[Operation] > 1
+func (r Rule) costFor(o AllowOptions) int64 {
+	if o.Cost > 0 {
+		return o.Cost
+	}
+	if cost, ok := r.Costs[o.Operation]; ok && o.Operation != "" {
+		return cost
+	}
+	return 1
 }
 
 // FailurePolicy 定义失败时的策略
@@ -72,7 +145,7 @@ const (
 type Option func(*Options)
 
 // WithCacheClient 设置自定义的缓存客户端
-func WithCacheClient(client cache.Cache) Option {
+func WithCacheClient(client cache.Provider) Option {
 	return func(o *Options) {
 		o.CacheClient = client
 	}
@@ -162,6 +235,21 @@ func WithRetryDelay(delay time.Duration) Option {
 	}
 }
 
+// WithAnomalyDetection 启用异常拒绝检测，资源类的拒绝次数超过基线时调用 handlers
+func WithAnomalyDetection(cfg AnomalyConfig, handlers ...AnomalyHandler) Option {
+	return func(o *Options) {
+		o.Anomaly = cfg
+		o.AnomalyHandlers = append(o.AnomalyHandlers, handlers...)
+	}
+}
+
+// WithAdaptiveRefill 启用自适应补充速率，下游延迟超过目标时按比例降低规则的补充速率
+func WithAdaptiveRefill(cfg AdaptiveConfig) Option {
+	return func(o *Options) {
+		o.Adaptive = cfg
+	}
+}
+
 // applyDefaults 应用默认配置
 func (o *Options) applyDefaults() {
 	if o.RuleRefreshInterval == 0 {
@@ -0,0 +1,229 @@
+package internal
+
+import (
+	"context"
+	"math"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/breaker"
+	"github.com/ceyewan/gochat/im-infra/clog"
+)
+
+// defaultWarmUpFraction 未设置 Rule.WarmUpFraction 时预热开始的速率占比
+const defaultWarmUpFraction = 0.1
+
+// warmUpFactor 返回规则在 now 时刻的预热速率占比，预热从 since 开始，结束后为 1
+func warmUpFactor(rule Rule, since, now time.Time) float64 {
+	if rule.WarmUp <= 0 {
+		return 1
+	}
+	elapsed := now.Sub(since)
+	if elapsed >= rule.WarmUp {
+		return 1
+	}
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	fraction := rule.WarmUpFraction
+	if fraction <= 0 {
+		fraction = defaultWarmUpFraction
+	}
+	return fraction + (1-fraction)*float64(elapsed)/float64(rule.WarmUp)
+}
+
+// trackRuleChange 规则的速率或容量变化时重新开始预热，调用方需持有写锁
+func (l *limiter) trackRuleChange(name string, rule Rule, now time.Time) {
+	old, ok := l.rules[name]
+	if !ok {
+		old, ok = l.opts.DefaultRules[name]
+	}
+	if rule.WarmUp <= 0 {
+		delete(l.changedAt, name)
+		return
+	}
+	if ok && old.Rate == rule.Rate && old.Capacity == rule.Capacity {
+		return
+	}
+	l.changedAt[name] = now
+	l.logger.Info("限流规则已变更，重新开始预热",
+		clog.String("ruleName", name),
+		clog.Float64("rate", rule.Rate),
+		clog.Duration("warmUp", rule.WarmUp))
+}
+
+// effectiveRule 返回叠加预热和自适应降速后的规则，只调整 Rate，容量保持不变
+func (l *limiter) effectiveRule(name string, rule Rule) Rule {
+	factor := 1.0
+	if rule.WarmUp > 0 {
+		l.mu.RLock()
+		since := l.started
+		if changed, ok := l.changedAt[name]; ok && changed.After(since) {
+			since = changed
+		}
+		l.mu.RUnlock()
+		factor = warmUpFactor(rule, since, time.Now())
+	}
+	factor *= l.adaptive.factorFor(name)
+	if factor < 1 {
+		rule.Rate *= factor
+	}
+	return rule
+}
+
+// AdaptiveConfig 自适应补充速率配置。
+// 按下游延迟信号调整规则的有效速率：延迟超过 TargetLatency 时，速率按 TargetLatency / 延迟 的比例降低，
+// 下游恢复后每个采样间隔最多回升 Step，避免下游变慢时上游仍按满速放行
+type AdaptiveConfig struct {
+	// Signal 返回下游当前的延迟，第二个返回值为 false 表示暂无数据（此时保持当前速率），必填。
+	// 可使用 BreakerSignal 从熔断器获取
+	Signal func() (time.Duration, bool)
+
+	// TargetLatency 下游的目标延迟，必须大于 0
+	TargetLatency time.Duration
+
+	// MinFraction 降速后的最低速率占比，默认 0.1
+	MinFraction float64
+
+	// Step 下游恢复后每个采样间隔速率占比最多回升的幅度，默认 0.1
+	Step float64
+
+	// Interval 采样间隔，默认 1 秒
+	Interval time.Duration
+
+	// Rules 参与自适应的规则名，为空表示所有规则
+	Rules []string
+}
+
+// adaptiveRefill 周期性采样下游延迟并维护速率占比，为 nil 时所有方法都返回满速
+type adaptiveRefill struct {
+	cfg    AdaptiveConfig
+	rules  map[string]bool
+	logger clog.Logger
+	factor atomic.Uint64 // math.Float64bits 编码的速率占比
+}
+
+// newAdaptiveRefill 创建自适应补充速率控制器，未配置 Signal 时返回 nil
+func newAdaptiveRefill(cfg AdaptiveConfig, logger clog.Logger) *adaptiveRefill {
+	if cfg.Signal == nil {
+		return nil
+	}
+	if cfg.MinFraction <= 0 || cfg.MinFraction > 1 {
+		cfg.MinFraction = 0.1
+	}
+	if cfg.Step <= 0 {
+		cfg.Step = 0.1
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Second
+	}
+
+	a := &adaptiveRefill{cfg: cfg, logger: logger}
+	if len(cfg.Rules) > 0 {
+		a.rules = make(map[string]bool, len(cfg.Rules))
+		for _, name := range cfg.Rules {
+			a.rules[name] = true
+		}
+	}
+	a.factor.Store(math.Float64bits(1))
+	return a
+}
+
+// factorFor 返回规则当前的自适应速率占比
+func (a *adaptiveRefill) factorFor(name string) float64 {
+	if a == nil || (a.rules != nil && !a.rules[name]) {
+		return 1
+	}
+	return math.Float64frombits(a.factor.Load())
+}
+
+// target 按延迟计算目标速率占比
+func (a *adaptiveRefill) target(latency time.Duration) float64 {
+	if latency <= a.cfg.TargetLatency {
+		return 1
+	}
+	return math.Max(a.cfg.MinFraction, float64(a.cfg.TargetLatency)/float64(latency))
+}
+
+// update 采样一次下游延迟并更新速率占比：降速立即生效，回升按 Step 逐步进行
+func (a *adaptiveRefill) update() {
+	latency, ok := a.cfg.Signal()
+	if !ok {
+		return
+	}
+
+	current := math.Float64frombits(a.factor.Load())
+	next := a.target(latency)
+	if next > current {
+		next = math.Min(next, current+a.cfg.Step)
+	}
+	if next == current {
+		return
+	}
+	a.factor.Store(math.Float64bits(next))
+
+	if next < current {
+		a.logger.Warn("下游延迟升高，降低补充速率",
+			clog.Duration("latency", latency),
+			clog.Duration("target", a.cfg.TargetLatency),
+			clog.Float64("fraction", next))
+	} else {
+		a.logger.Info("下游延迟恢复，提高补充速率",
+			clog.Duration("latency", latency),
+			clog.Float64("fraction", next))
+	}
+}
+
+// run 按采样间隔更新速率占比，直到 ctx 结束
+func (a *adaptiveRefill) run(ctx context.Context) {
+	ticker := time.NewTicker(a.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.update()
+		}
+	}
+}
+
+// BreakerSignal 返回基于熔断器快照的延迟信号，用作 AdaptiveConfig.Signal。
+// 取名称匹配 patterns（精确匹配或以 "*" 结尾的前缀匹配，为空表示全部）的熔断器中最大的 P95 延迟；
+// 任一匹配的熔断器处于打开或半开状态时视为延迟无穷大，速率降到 MinFraction；没有匹配的熔断器时视为暂无数据
+func BreakerSignal(provider breaker.Provider, patterns ...string) func() (time.Duration, bool) {
+	return func() (time.Duration, bool) {
+		var latency time.Duration
+		found := false
+		for _, status := range provider.Snapshot().Breakers {
+			if !matchesAny(patterns, status.Name) {
+				continue
+			}
+			if !status.Healthy() {
+				return time.Duration(math.MaxInt64), true
+			}
+			found = true
+			latency = max(latency, status.LatencyP95)
+		}
+		return latency, found
+	}
+}
+
+// matchesAny 判断熔断器名称是否匹配任一模式，patterns 为空时全部匹配
+func matchesAny(patterns []string, name string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if pattern == name {
+			return true
+		}
+	}
+	return false
+}
@@ -8,6 +8,23 @@ type Options = internal.Options
 // Rule 定义了单个限流规则 (类型别名)。
 type Rule = internal.Rule
 
+// 限流算法，通过 Rule.Algorithm 按规则选择。
+const (
+	// AlgorithmTokenBucket 令牌桶算法（默认）。
+	AlgorithmTokenBucket = internal.AlgorithmTokenBucket
+	// AlgorithmGCRA 通用信元速率算法，放行更平滑、每个资源只占用一个 key。
+	AlgorithmGCRA = internal.AlgorithmGCRA
+)
+
+// AllowOption 用于指定单次 Allow/AllowN 调用的令牌消耗 (类型别名)。
+type AllowOption = internal.AllowOption
+
+// WithOperation 按 Rule.Costs 中定义的操作权重消耗令牌。
+var WithOperation = internal.WithOperation
+
+// WithCost 显式指定单次请求消耗的令牌数，优先级高于 WithOperation。
+var WithCost = internal.WithCost
+
 // Option 是一个用于修改 Options 的函数 (类型别名)。
 type Option = internal.Option
 
@@ -22,3 +39,30 @@ var WithRuleRefreshInterval = internal.WithRuleRefreshInterval
 
 // WithDefaultRules 设置备用规则。
 var WithDefaultRules = internal.WithDefaultRules
+
+// AnomalyConfig 异常拒绝检测配置 (类型别名)。
+type AnomalyConfig = internal.AnomalyConfig
+
+// AnomalyEvent 异常拒绝事件 (类型别名)。
+type AnomalyEvent = internal.AnomalyEvent
+
+// AnomalyHandler 异常拒绝回调 (类型别名)。
+type AnomalyHandler = internal.AnomalyHandler
+
+// BlockedClass 被临时封禁的资源类 (类型别名)。
+type BlockedClass = internal.BlockedClass
+
+// WithAnomalyDetection 启用异常拒绝检测，资源类的拒绝次数超过基线时触发回调，可选自动封禁。
+var WithAnomalyDetection = internal.WithAnomalyDetection
+
+// IPPrefixClassifier 按 IP 前缀归类资源，用作 AnomalyConfig.Classify。
+var IPPrefixClassifier = internal.IPPrefixClassifier
+
+// AdaptiveConfig 自适应补充速率配置 (类型别名)。
+type AdaptiveConfig = internal.AdaptiveConfig
+
+// WithAdaptiveRefill 启用自适应补充速率，下游延迟超过目标时按比例降低规则的补充速率，恢复后逐步回升。
+var WithAdaptiveRefill = internal.WithAdaptiveRefill
+
+// BreakerSignal 以熔断器快照中的 P95 延迟和状态作为 AdaptiveConfig.Signal。
+var BreakerSignal = internal.BreakerSignal
@@ -4,6 +4,7 @@
 //   - 基于令牌桶算法，支持平滑和突发流量。
 //   - 通过 Redis 实现分布式限流，适用于微服务集群。
 //   - 依赖 coord 组件实现动态配置，可实时调整限流规则。
+//   - 支持冷启动和规则变更后的速率预热，以及按下游延迟自适应降低补充速率。
 //   - 与 cache 组件集成，提供抽象的缓存接口。
 //   - 采用与项目内其他 infra 组件一致的设计模式，通过 internal 封装实现细节。
 package ratelimit
@@ -72,6 +73,22 @@ func ValidateRule(rule Rule) error {
 	if rule.Capacity <= 0 {
 		return ErrInvalidCapacity
 	}
+	switch rule.Algorithm {
+	case "", AlgorithmTokenBucket, AlgorithmGCRA:
+	default:
+		return ErrInvalidAlgorithm
+	}
+	if rule.MaxCost < 0 || rule.MaxCost > rule.Capacity {
+		return ErrInvalidCost
+	}
+	for _, cost := range rule.Costs {
+		if cost <= 0 || cost > rule.Capacity || (rule.MaxCost > 0 && cost > rule.MaxCost) {
+			return ErrInvalidCost
+		}
+	}
+	if rule.WarmUp < 0 || rule.WarmUpFraction < 0 || rule.WarmUpFraction > 1 {
+		return ErrInvalidWarmUp
+	}
 	return nil
 }
 
@@ -6,16 +6,36 @@ import (
 	"time"
 
 	"github.com/ceyewan/gochat/im-infra/cache"
+	"github.com/ceyewan/gochat/im-infra/coord"
 	"github.com/ceyewan/gochat/im-infra/ratelimit"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+// newTestClients 创建限流器依赖的 Redis 和 etcd 客户端，任一不可用时跳过测试
+func newTestClients(tb testing.TB) (cache.Provider, coord.Provider) {
+	tb.Helper()
+	if testing.Short() {
+		tb.Skip("跳过集成测试")
+	}
+
+	cacheClient, err := cache.New(context.Background(), cache.GetDefaultConfig("development"))
+	if err != nil {
+		tb.Skipf("Redis 不可用，跳过集成测试: %v", err)
+	}
+	tb.Cleanup(func() { cacheClient.Close() })
+
+	coordClient, err := coord.New(context.Background(), coord.GetDefaultConfig("development"))
+	if err != nil {
+		tb.Skipf("etcd 不可用，跳过集成测试: %v", err)
+	}
+	tb.Cleanup(func() { coordClient.Close() })
+	return cacheClient, coordClient
+}
+
 func TestRateLimiter_BasicFunctionality(t *testing.T) {
 	// 使用测试配置初始化缓存
-	cacheClient, err := cache.New(context.Background(), cache.DefaultConfig())
-	require.NoError(t, err)
-	defer cacheClient.Close()
+	cacheClient, coordClient := newTestClients(t)
 
 	// 定义默认规则用于测试
 	defaultRules := map[string]ratelimit.Rule{
@@ -30,6 +50,7 @@ func TestRateLimiter_BasicFunctionality(t *testing.T) {
 		context.Background(),
 		"test_service",
 		ratelimit.WithCacheClient(cacheClient),
+		ratelimit.WithCoordinationClient(coordClient),
 		ratelimit.WithDefaultRules(defaultRules),
 	)
 	require.NoError(t, err)
@@ -63,9 +84,7 @@ func TestRateLimiter_BasicFunctionality(t *testing.T) {
 }
 
 func TestRateLimiter_AllowN(t *testing.T) {
-	cacheClient, err := cache.New(context.Background(), cache.DefaultConfig())
-	require.NoError(t, err)
-	defer cacheClient.Close()
+	cacheClient, coordClient := newTestClients(t)
 
 	defaultRules := map[string]ratelimit.Rule{
 		"batch_rule": {
@@ -78,6 +97,7 @@ func TestRateLimiter_AllowN(t *testing.T) {
 		context.Background(),
 		"test_service",
 		ratelimit.WithCacheClient(cacheClient),
+		ratelimit.WithCoordinationClient(coordClient),
 		ratelimit.WithDefaultRules(defaultRules),
 	)
 	require.NoError(t, err)
@@ -103,10 +123,221 @@ func TestRateLimiter_AllowN(t *testing.T) {
 	assert.True(t, allowed)
 }
 
-func TestRateLimiter_BatchAllow(t *testing.T) {
-	cacheClient, err := cache.New(context.Background(), cache.DefaultConfig())
+func TestRateLimiter_WeightedCost(t *testing.T) {
+	cacheClient, coordClient := newTestClients(t)
+
+	defaultRules := map[string]ratelimit.Rule{
+		"send_message": {
+			Rate:     1,
+			Capacity: 10,
+			Costs:    map[string]int64{"text": 1, "image": 4},
+			MaxCost:  8,
+		},
+	}
+
+	limiter, err := ratelimit.New(
+		context.Background(),
+		"test_service",
+		ratelimit.WithCacheClient(cacheClient),
+		ratelimit.WithCoordinationClient(coordClient),
+		ratelimit.WithDefaultRules(defaultRules),
+	)
+	require.NoError(t, err)
+	defer limiter.Close()
+
+	ctx := context.Background()
+	resource := "user:weighted"
+	ruleName := "send_message"
+
+	// 两张图片消耗 8 个令牌，剩余 2 个
+	for i := 0; i < 2; i++ {
+		allowed, err := limiter.Allow(ctx, resource, ruleName, ratelimit.WithOperation("image"))
+		require.NoError(t, err)
+		assert.True(t, allowed, "第 %d 张图片应该被允许", i+1)
+	}
+
+	// 第三张图片令牌不足
+	allowed, err := limiter.Allow(ctx, resource, ruleName, ratelimit.WithOperation("image"))
+	require.NoError(t, err)
+	assert.False(t, allowed)
+
+	// 文本消息仍然可以发送
+	allowed, err = limiter.Allow(ctx, resource, ruleName, ratelimit.WithOperation("text"))
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	// 3 张图片共 12 个令牌，超过 MaxCost
+	allowed, err = limiter.AllowN(ctx, resource, ruleName, 3, ratelimit.WithOperation("image"))
+	assert.ErrorIs(t, err, ratelimit.ErrCostExceeded)
+	assert.False(t, allowed)
+}
+
+func TestRateLimiter_AnomalyDetection(t *testing.T) {
+	cacheClient, coordClient := newTestClients(t)
+
+	events := make(chan ratelimit.AnomalyEvent, 1)
+	manager, err := ratelimit.NewManager(
+		context.Background(),
+		"test_service",
+		ratelimit.WithCacheClient(cacheClient),
+		ratelimit.WithCoordinationClient(coordClient),
+		ratelimit.WithDefaultRules(map[string]ratelimit.Rule{
+			"login": {Rate: 0.1, Capacity: 1},
+		}),
+		ratelimit.WithAnomalyDetection(ratelimit.AnomalyConfig{
+			Classify:      ratelimit.IPPrefixClassifier(24, 64),
+			Window:        time.Minute,
+			Baseline:      3,
+			BlockDuration: time.Minute,
+		}, func(ctx context.Context, e ratelimit.AnomalyEvent) {
+			events <- e
+		}),
+	)
+	require.NoError(t, err)
+	defer manager.Close()
+
+	ctx := context.Background()
+	// 同一网段的两个 IP 各请求 3 次，除首次外全部被拒绝，共 4 次拒绝超过基线 3
+	for _, ip := range []string{"203.0.113.7", "203.0.113.8"} {
+		for i := 0; i < 3; i++ {
+			_, err := manager.Allow(ctx, ratelimit.BuildIPResourceKey(ip), "login")
+			require.NoError(t, err)
+		}
+	}
+
+	select {
+	case e := <-events:
+		assert.Equal(t, "ip:203.0.113.0/24", e.Class)
+		assert.Equal(t, int64(4), e.Denied)
+		assert.ElementsMatch(t, []string{"ip:203.0.113.7", "ip:203.0.113.8"}, e.Keys)
+		assert.False(t, e.BlockedUntil.IsZero())
+	case <-time.After(time.Second):
+		t.Fatal("未触发异常拒绝回调")
+	}
+
+	// 网段被封禁后，新 IP 的首次请求也会被拒绝
+	allowed, err := manager.Allow(ctx, ratelimit.BuildIPResourceKey("203.0.113.9"), "login")
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	require.Len(t, manager.ListBlockedClasses(), 1)
+
+	require.NoError(t, manager.UnblockClass("ip:203.0.113.0/24"))
+	allowed, err = manager.Allow(ctx, ratelimit.BuildIPResourceKey("203.0.113.10"), "login")
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	// 非 IP 资源不参与检测
+	assert.Empty(t, ratelimit.IPPrefixClassifier(24, 64)("user:123"))
+	assert.Equal(t, "ip:2001:db8::/64", ratelimit.IPPrefixClassifier(24, 64)("2001:db8::1"))
+}
+
+func TestRateLimiter_GCRA(t *testing.T) {
+	cacheClient, coordClient := newTestClients(t)
+
+	defaultRules := map[string]ratelimit.Rule{
+		"gcra_rule": {
+			Rate:      10, // 每 100ms 放行一个请求
+			Capacity:  5,  // 允许 5 个突发请求
+			Algorithm: ratelimit.AlgorithmGCRA,
+		},
+	}
+
+	limiter, err := ratelimit.New(
+		context.Background(),
+		"test_service",
+		ratelimit.WithCacheClient(cacheClient),
+		ratelimit.WithCoordinationClient(coordClient),
+		ratelimit.WithDefaultRules(defaultRules),
+	)
+	require.NoError(t, err)
+	defer limiter.Close()
+
+	ctx := context.Background()
+	resource := "gcra:789"
+	ruleName := "gcra_rule"
+
+	// 突发容量内的请求都应该被允许
+	for i := 0; i < 5; i++ {
+		allowed, err := limiter.Allow(ctx, resource, ruleName)
+		require.NoError(t, err)
+		assert.True(t, allowed, "请求 %d 应该被允许", i+1)
+	}
+
+	// 超出突发容量的请求应该被拒绝
+	allowed, err := limiter.Allow(ctx, resource, ruleName)
 	require.NoError(t, err)
-	defer cacheClient.Close()
+	assert.False(t, allowed, "第 6 次请求应该被拒绝")
+
+	// 一个发射间隔后只放行一个请求，而不是一次性补满
+	time.Sleep(150 * time.Millisecond)
+	allowed, err = limiter.Allow(ctx, resource, ruleName)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	allowed, err = limiter.Allow(ctx, resource, ruleName)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+}
+
+func TestRateLimiter_WarmUp(t *testing.T) {
+	cacheClient, coordClient := newTestClients(t)
+
+	defaultRules := map[string]ratelimit.Rule{
+		"warm_rule": {
+			Rate:           100, // 满速时每 10ms 补充一个令牌
+			Capacity:       1,
+			WarmUp:         time.Minute,
+			WarmUpFraction: 0.1, // 预热开始时每 100ms 补充一个令牌
+		},
+		"adaptive_rule": {Rate: 100, Capacity: 1},
+	}
+
+	manager, err := ratelimit.NewManager(
+		context.Background(),
+		"test_service",
+		ratelimit.WithCacheClient(cacheClient),
+		ratelimit.WithCoordinationClient(coordClient),
+		ratelimit.WithDefaultRules(defaultRules),
+		ratelimit.WithAdaptiveRefill(ratelimit.AdaptiveConfig{
+			// 下游延迟是目标的 10 倍，速率降到 10%
+			Signal:        func() (time.Duration, bool) { return time.Second, true },
+			TargetLatency: 100 * time.Millisecond,
+			Interval:      10 * time.Millisecond,
+			Rules:         []string{"adaptive_rule"},
+		}),
+	)
+	require.NoError(t, err)
+	defer manager.Close()
+
+	ctx := context.Background()
+	time.Sleep(50 * time.Millisecond) // 等待自适应控制器完成首次采样
+
+	for _, ruleName := range []string{"warm_rule", "adaptive_rule"} {
+		resource := "warmup:" + ruleName
+		allowed, err := manager.Allow(ctx, resource, ruleName)
+		require.NoError(t, err)
+		assert.True(t, allowed)
+
+		// 满速时 30ms 足以补满令牌，降速后还不够补充一个
+		time.Sleep(30 * time.Millisecond)
+		allowed, err = manager.Allow(ctx, resource, ruleName)
+		require.NoError(t, err)
+		assert.False(t, allowed, "规则 %s 应该以降低后的速率补充令牌", ruleName)
+	}
+
+	// 无效的自适应配置
+	_, err = ratelimit.New(context.Background(), "test_service",
+		ratelimit.WithCacheClient(cacheClient),
+		ratelimit.WithCoordinationClient(coordClient),
+		ratelimit.WithAdaptiveRefill(ratelimit.AdaptiveConfig{
+			Signal: func() (time.Duration, bool) { return 0, false },
+		}),
+	)
+	assert.Error(t, err)
+}
+
+func TestRateLimiter_BatchAllow(t *testing.T) {
+	cacheClient, coordClient := newTestClients(t)
 
 	defaultRules := map[string]ratelimit.Rule{
 		"api_rule": {Rate: 5, Capacity: 10},
@@ -117,6 +348,7 @@ func TestRateLimiter_BatchAllow(t *testing.T) {
 		context.Background(),
 		"test_service",
 		ratelimit.WithCacheClient(cacheClient),
+		ratelimit.WithCoordinationClient(coordClient),
 		ratelimit.WithDefaultRules(defaultRules),
 	)
 	require.NoError(t, err)
@@ -143,9 +375,7 @@ func TestRateLimiter_BatchAllow(t *testing.T) {
 }
 
 func TestRateLimiter_Statistics(t *testing.T) {
-	cacheClient, err := cache.New(context.Background(), cache.DefaultConfig())
-	require.NoError(t, err)
-	defer cacheClient.Close()
+	cacheClient, coordClient := newTestClients(t)
 
 	defaultRules := map[string]ratelimit.Rule{
 		"stats_rule": {Rate: 1, Capacity: 1},
@@ -155,6 +385,7 @@ func TestRateLimiter_Statistics(t *testing.T) {
 		context.Background(),
 		"test_service",
 		ratelimit.WithCacheClient(cacheClient),
+		ratelimit.WithCoordinationClient(coordClient),
 		ratelimit.WithDefaultRules(defaultRules),
 	)
 	require.NoError(t, err)
@@ -183,14 +414,13 @@ func TestRateLimiter_Statistics(t *testing.T) {
 }
 
 func TestRateLimiter_UnknownRule(t *testing.T) {
-	cacheClient, err := cache.New(context.Background(), cache.DefaultConfig())
-	require.NoError(t, err)
-	defer cacheClient.Close()
+	cacheClient, coordClient := newTestClients(t)
 
 	limiter, err := ratelimit.New(
 		context.Background(),
 		"test_service",
 		ratelimit.WithCacheClient(cacheClient),
+		ratelimit.WithCoordinationClient(coordClient),
 		ratelimit.WithDefaultRules(map[string]ratelimit.Rule{}),
 	)
 	require.NoError(t, err)
@@ -205,14 +435,13 @@ func TestRateLimiter_UnknownRule(t *testing.T) {
 }
 
 func TestRateLimiter_ErrorHandling(t *testing.T) {
-	cacheClient, err := cache.New(context.Background(), cache.DefaultConfig())
-	require.NoError(t, err)
-	defer cacheClient.Close()
+	cacheClient, coordClient := newTestClients(t)
 
 	limiter, err := ratelimit.New(
 		context.Background(),
 		"test_service",
 		ratelimit.WithCacheClient(cacheClient),
+		ratelimit.WithCoordinationClient(coordClient),
 		ratelimit.WithDefaultRules(map[string]ratelimit.Rule{
 			"error_rule": {Rate: 1, Capacity: 1},
 		}),
@@ -234,9 +463,7 @@ func TestRateLimiter_ErrorHandling(t *testing.T) {
 }
 
 func TestRateLimiter_Concurrent(t *testing.T) {
-	cacheClient, err := cache.New(context.Background(), cache.DefaultConfig())
-	require.NoError(t, err)
-	defer cacheClient.Close()
+	cacheClient, coordClient := newTestClients(t)
 
 	defaultRules := map[string]ratelimit.Rule{
 		"concurrent_rule": {Rate: 10, Capacity: 10},
@@ -246,6 +473,7 @@ func TestRateLimiter_Concurrent(t *testing.T) {
 		context.Background(),
 		"test_service",
 		ratelimit.WithCacheClient(cacheClient),
+		ratelimit.WithCoordinationClient(coordClient),
 		ratelimit.WithDefaultRules(defaultRules),
 	)
 	require.NoError(t, err)
@@ -288,10 +516,13 @@ func TestSimpleRateLimiter(t *testing.T) {
 		"simple": {Rate: 2, Capacity: 5},
 	}
 
+	cacheClient, coordClient := newTestClients(t)
 	limiter, err := ratelimit.SimpleRateLimiter(
 		context.Background(),
 		"simple_service",
 		rules,
+		ratelimit.WithCacheClient(cacheClient),
+		ratelimit.WithCoordinationClient(coordClient),
 	)
 	require.NoError(t, err)
 	defer limiter.Close()
@@ -328,6 +559,73 @@ func TestValidateRule(t *testing.T) {
 	err = ratelimit.ValidateRule(invalidCapacityRule)
 	assert.Error(t, err)
 	assert.Equal(t, ratelimit.ErrInvalidCapacity, err)
+
+	// 测试算法
+	gcraRule := ratelimit.Rule{Rate: 10, Capacity: 20, Algorithm: ratelimit.AlgorithmGCRA}
+	assert.NoError(t, ratelimit.ValidateRule(gcraRule))
+
+	invalidAlgorithmRule := ratelimit.Rule{Rate: 10, Capacity: 20, Algorithm: "leaky"}
+	assert.Equal(t, ratelimit.ErrInvalidAlgorithm, ratelimit.ValidateRule(invalidAlgorithmRule))
+
+	// 测试操作权重
+	costRule := ratelimit.Rule{Rate: 10, Capacity: 20, Costs: map[string]int64{"image": 5}, MaxCost: 10}
+	assert.NoError(t, ratelimit.ValidateRule(costRule))
+
+	zeroCostRule := ratelimit.Rule{Rate: 10, Capacity: 20, Costs: map[string]int64{"image": 0}}
+	assert.Equal(t, ratelimit.ErrInvalidCost, ratelimit.ValidateRule(zeroCostRule))
+
+	overMaxCostRule := ratelimit.Rule{Rate: 10, Capacity: 20, Costs: map[string]int64{"image": 12}, MaxCost: 10}
+	assert.Equal(t, ratelimit.ErrInvalidCost, ratelimit.ValidateRule(overMaxCostRule))
+
+	overCapacityRule := ratelimit.Rule{Rate: 10, Capacity: 20, MaxCost: 30}
+	assert.Equal(t, ratelimit.ErrInvalidCost, ratelimit.ValidateRule(overCapacityRule))
+
+	// 测试预热
+	warmUpRule := ratelimit.Rule{Rate: 10, Capacity: 20, WarmUp: time.Minute, WarmUpFraction: 0.2}
+	assert.NoError(t, ratelimit.ValidateRule(warmUpRule))
+
+	invalidFractionRule := ratelimit.Rule{Rate: 10, Capacity: 20, WarmUp: time.Minute, WarmUpFraction: 1.5}
+	assert.Equal(t, ratelimit.ErrInvalidWarmUp, ratelimit.ValidateRule(invalidFractionRule))
+}
+
+func TestConnLimiter(t *testing.T) {
+	// 帧数限制：突发 3 帧后被拒绝
+	limiter, err := ratelimit.NewConnLimiter("conn-1", ratelimit.ConnRules{MessagesPerSecond: 1, MessageBurst: 3})
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		assert.True(t, limiter.AllowFrame(10))
+	}
+	assert.False(t, limiter.AllowFrame(10))
+
+	stats := limiter.Stats()
+	assert.Equal(t, "conn-1", stats.ConnID)
+	assert.Equal(t, int64(3), stats.Frames)
+	assert.Equal(t, int64(30), stats.Bytes)
+	assert.Equal(t, int64(1), stats.DeniedFrames)
+
+	// 字节限制：大帧被拒绝且不消耗令牌，小帧仍可通过
+	limiter, err = ratelimit.NewConnLimiter("conn-2", ratelimit.ConnRules{BytesPerSecond: 100, ByteBurst: 100})
+	require.NoError(t, err)
+	assert.False(t, limiter.AllowFrame(101))
+	assert.True(t, limiter.AllowFrame(60))
+	assert.False(t, limiter.AllowFrame(60))
+	assert.True(t, limiter.AllowFrame(40))
+
+	_, err = ratelimit.NewConnLimiter("conn-3", ratelimit.ConnRules{MessagesPerSecond: -1})
+	assert.Equal(t, ratelimit.ErrInvalidConnRules, err)
+
+	// 连接池：Release 释放，空闲的连接被清理
+	pool, err := ratelimit.NewConnLimiterPool(ratelimit.ConnRules{MessagesPerSecond: 10}, 100*time.Millisecond)
+	require.NoError(t, err)
+	defer pool.Close()
+
+	assert.True(t, pool.AllowFrame("a", 1))
+	assert.True(t, pool.AllowFrame("b", 1))
+	assert.Equal(t, 2, pool.Len())
+	pool.Release("a")
+	assert.Equal(t, 1, pool.Len())
+
+	assert.Eventually(t, func() bool { return pool.Len() == 0 }, time.Second, 20*time.Millisecond)
 }
 
 func TestCreateDefaultRules(t *testing.T) {
@@ -381,14 +679,13 @@ func TestBuildResourceKeys(t *testing.T) {
 }
 
 func TestRateLimiter_Close(t *testing.T) {
-	cacheClient, err := cache.New(context.Background(), cache.DefaultConfig())
-	require.NoError(t, err)
-	defer cacheClient.Close()
+	cacheClient, coordClient := newTestClients(t)
 
 	limiter, err := ratelimit.New(
 		context.Background(),
 		"close_test_service",
 		ratelimit.WithCacheClient(cacheClient),
+		ratelimit.WithCoordinationClient(coordClient),
 	)
 	require.NoError(t, err)
 
@@ -402,9 +699,7 @@ func TestRateLimiter_Close(t *testing.T) {
 }
 
 func BenchmarkRateLimiter_Allow(b *testing.B) {
-	cacheClient, err := cache.New(context.Background(), cache.DefaultConfig())
-	require.NoError(b, err)
-	defer cacheClient.Close()
+	cacheClient, coordClient := newTestClients(b)
 
 	defaultRules := map[string]ratelimit.Rule{
 		"benchmark_rule": {Rate: 1000, Capacity: 2000},
@@ -414,6 +709,7 @@ func BenchmarkRateLimiter_Allow(b *testing.B) {
 		context.Background(),
 		"benchmark_service",
 		ratelimit.WithCacheClient(cacheClient),
+		ratelimit.WithCoordinationClient(coordClient),
 		ratelimit.WithDefaultRules(defaultRules),
 	)
 	require.NoError(b, err)
@@ -432,9 +728,7 @@ func BenchmarkRateLimiter_Allow(b *testing.B) {
 }
 
 func BenchmarkRateLimiter_BatchAllow(b *testing.B) {
-	cacheClient, err := cache.New(context.Background(), cache.DefaultConfig())
-	require.NoError(b, err)
-	defer cacheClient.Close()
+	cacheClient, coordClient := newTestClients(b)
 
 	defaultRules := map[string]ratelimit.Rule{
 		"batch_benchmark": {Rate: 1000, Capacity: 2000},
@@ -444,6 +738,7 @@ func BenchmarkRateLimiter_BatchAllow(b *testing.B) {
 		context.Background(),
 		"batch_benchmark_service",
 		ratelimit.WithCacheClient(cacheClient),
+		ratelimit.WithCoordinationClient(coordClient),
 		ratelimit.WithDefaultRules(defaultRules),
 	)
 	require.NoError(b, err)
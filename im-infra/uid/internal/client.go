@@ -67,15 +67,13 @@ func (c *Client) GenerateInt64() int64 {
 
 	if timestamp < c.lastTimestamp {
 		// Instead of sleeping, wait for the next millisecond
-		timestamp = c.waitNextMillis(c.lastTimestamp)
-		timestamp = timestamp - twepoch
+		timestamp = c.waitNextMillis(c.lastTimestamp+twepoch) - twepoch
 	}
 
 	if c.lastTimestamp == timestamp {
 		c.sequence = (c.sequence + 1) & maxSequence
 		if c.sequence == 0 {
-			timestamp = c.waitNextMillis(timestamp)
-			timestamp = timestamp - twepoch
+			timestamp = c.waitNextMillis(timestamp+twepoch) - twepoch
 		}
 	} else {
 		c.sequence = 0
@@ -83,10 +81,51 @@ func (c *Client) GenerateInt64() int64 {
 
 	c.lastTimestamp = timestamp
 
-	return ((timestamp) << timestampShift) |
-		((c.datacenterID) << datacenterIDShift) |
-		((c.workerID) << workerIDShift) |
-		c.sequence
+	return c.compose(timestamp, c.sequence)
+}
+
+// GenerateBatch 在一次加锁内生成 n 个 ID
+func (c *Client) GenerateBatch(n int) []int64 {
+	ids := make([]int64, 0, n)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for len(ids) < n {
+		timestamp := c.currentTimestamp() - twepoch
+		if timestamp <= c.lastTimestamp {
+			if c.sequence < maxSequence {
+				// 时钟回拨时继续使用上一毫秒剩余的序列号
+				c.sequence++
+				ids = append(ids, c.compose(c.lastTimestamp, c.sequence))
+				continue
+			}
+			timestamp = c.waitNextMillis(c.lastTimestamp+twepoch) - twepoch
+		}
+		c.lastTimestamp = timestamp
+		c.sequence = 0
+		ids = append(ids, c.compose(timestamp, 0))
+	}
+	return ids
+}
+
+// ReserveSegment 预留一个此前未使用过的毫秒内的全部序列号，返回号段起点和长度。
+// 号段内的 ID 是连续整数 [start, start+count)，之后本实例在该毫秒内不会再生成 ID。
+func (c *Client) ReserveSegment() (start, count int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	timestamp := c.waitNextMillis(c.lastTimestamp+twepoch) - twepoch
+	c.lastTimestamp = timestamp
+	c.sequence = maxSequence
+	return c.compose(timestamp, 0), maxSequence + 1
+}
+
+// compose 按雪花算法的位分布组装 ID
+func (c *Client) compose(timestamp, sequence int64) int64 {
+	return (timestamp << timestampShift) |
+		(c.datacenterID << datacenterIDShift) |
+		(c.workerID << workerIDShift) |
+		sequence
 }
 
 func (c *Client) GenerateString() string {
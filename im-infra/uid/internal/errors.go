@@ -6,4 +6,5 @@ var (
 	ErrInvalidWorkerID     = errors.New("invalid worker ID")
 	ErrInvalidDatacenterID = errors.New("invalid datacenter ID")
 	ErrClockBackwards      = errors.New("clock moved backwards")
+	ErrShortCodeExhausted  = errors.New("short code attempts exhausted")
 )
@@ -0,0 +1,154 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"google.golang.org/grpc"
+)
+
+// ErrRemoteClosed 在远程分配器关闭后调用时返回
+var ErrRemoteClosed = errors.New("remote id allocator closed")
+
+// RemoteConfig 是远程分配器的运行参数
+type RemoteConfig struct {
+	Target       string
+	Timeout      time.Duration
+	LowWatermark int64
+}
+
+// RemoteAllocator 从 ID 服务获取号段并在本地发放，
+// 当前号段剩余数量低于水位线时在后台预取下一个号段，避免发放 ID 时等待网络请求
+type RemoteAllocator struct {
+	conn   *grpc.ClientConn
+	cfg    RemoteConfig
+	logger clog.Logger
+
+	mu sync.Mutex
+	// current 正在发放的号段，next 为下一个待发放的 ID
+	current Segment
+	next    int64
+	// spare 预取到的备用号段
+	spare       *Segment
+	prefetching bool
+	closed      bool
+}
+
+// NewRemoteAllocator 连接 ID 服务，dialOpts 用于指定传输凭证、服务发现等
+func NewRemoteAllocator(cfg RemoteConfig, logger clog.Logger, dialOpts ...grpc.DialOption) (*RemoteAllocator, error) {
+	dialOpts = append([]grpc.DialOption{
+		grpc.WithDefaultCallOptions(grpc.CallContentSubtype(JSONCodecName)),
+	}, dialOpts...)
+	conn, err := grpc.NewClient(cfg.Target, dialOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to id service %s: %w", cfg.Target, err)
+	}
+	return &RemoteAllocator{
+		conn:   conn,
+		cfg:    cfg,
+		logger: logger,
+	}, nil
+}
+
+// NextID 返回下一个 ID，本地号段耗尽且没有预取号段时同步向服务申请
+func (a *RemoteAllocator) NextID(ctx context.Context) (int64, error) {
+	for {
+		a.mu.Lock()
+		if a.closed {
+			a.mu.Unlock()
+			return 0, ErrRemoteClosed
+		}
+		if remaining := a.current.Start + a.current.Count - a.next; remaining > 0 {
+			id := a.next
+			a.next++
+			if remaining-1 <= a.cfg.LowWatermark && a.spare == nil && !a.prefetching {
+				a.prefetching = true
+				go a.prefetch()
+			}
+			a.mu.Unlock()
+			return id, nil
+		}
+		if a.spare != nil {
+			a.use(*a.spare)
+			a.spare = nil
+			a.mu.Unlock()
+			continue
+		}
+		a.mu.Unlock()
+
+		segment, err := a.allocateSegment(ctx)
+		if err != nil {
+			return 0, err
+		}
+		a.mu.Lock()
+		a.store(segment)
+		a.mu.Unlock()
+	}
+}
+
+// Close 关闭与 ID 服务的连接，未发放的 ID 被丢弃
+func (a *RemoteAllocator) Close() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
+	a.closed = true
+	a.mu.Unlock()
+	return a.conn.Close()
+}
+
+// prefetch 在后台申请备用号段，失败时只记录日志，等到号段耗尽时再同步重试
+func (a *RemoteAllocator) prefetch() {
+	ctx, cancel := context.WithTimeout(context.Background(), a.cfg.Timeout)
+	defer cancel()
+	segment, err := a.allocateSegment(ctx)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.prefetching = false
+	if err != nil {
+		if !a.closed {
+			a.logger.Warn("预取号段失败", clog.String("target", a.cfg.Target), clog.Err(err))
+		}
+		return
+	}
+	a.store(segment)
+}
+
+// store 保存新申请到的号段：当前号段已耗尽时直接使用，否则作为备用号段，备用号段已存在时丢弃。调用方需持有锁
+func (a *RemoteAllocator) store(segment Segment) {
+	switch {
+	case a.next >= a.current.Start+a.current.Count:
+		a.use(segment)
+	case a.spare == nil:
+		a.spare = &segment
+	}
+}
+
+// use 切换到新的号段。调用方需持有锁
+func (a *RemoteAllocator) use(segment Segment) {
+	a.current = segment
+	a.next = segment.Start
+}
+
+// allocateSegment 调用 ID 服务的 AllocateSegment 方法
+func (a *RemoteAllocator) allocateSegment(ctx context.Context) (Segment, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.cfg.Timeout)
+		defer cancel()
+	}
+	var segment Segment
+	if err := a.conn.Invoke(ctx, "/"+ServiceName+"/AllocateSegment", &AllocateSegmentRequest{}, &segment); err != nil {
+		return Segment{}, fmt.Errorf("failed to allocate segment: %w", err)
+	}
+	if segment.Count <= 0 {
+		return Segment{}, fmt.Errorf("id service returned empty segment")
+	}
+	return segment, nil
+}
@@ -0,0 +1,319 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// ServiceName 是 ID 服务的 gRPC 服务名
+const ServiceName = "uid.v1.IDService"
+
+// JSONCodecName 是 ID 服务使用的 gRPC content-subtype，请求和响应都以 JSON 编码，
+// 非 Go 客户端无需 .proto 文件，使用通用客户端加 JSON 序列化即可调用
+const JSONCodecName = "json"
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+// jsonCodec 以 JSON 编解码 gRPC 消息
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+func (jsonCodec) Name() string                       { return JSONCodecName }
+
+// AllocateIDsRequest 批量分配 ID 的请求
+type AllocateIDsRequest struct {
+	Count int `json:"count"`
+}
+
+// AllocateIDsResponse 批量分配 ID 的响应。
+// ID 以十进制字符串返回，JavaScript 的 Number 无法精确表示 64 位整数
+type AllocateIDsResponse struct {
+	IDs []string `json:"ids"`
+}
+
+// AllocateSegmentRequest 分配号段的请求
+type AllocateSegmentRequest struct{}
+
+// Segment 是一段连续的 ID [Start, Start+Count)，由调用方在本地依次发放
+type Segment struct {
+	Start int64 `json:"start,string"`
+	Count int64 `json:"count"`
+}
+
+// idService 是 ID 服务的处理接口，供 gRPC 服务描述分发请求
+type idService interface {
+	AllocateIDs(ctx context.Context, req *AllocateIDsRequest) (*AllocateIDsResponse, error)
+	AllocateSegment(ctx context.Context, req *AllocateSegmentRequest) (*Segment, error)
+}
+
+// serviceDesc 是手写的 gRPC 服务描述，对应的方法路径为 /uid.v1.IDService/<Method>
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*idService)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "AllocateIDs",
+			Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+				req := new(AllocateIDsRequest)
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+				handler := func(ctx context.Context, req any) (any, error) {
+					return srv.(idService).AllocateIDs(ctx, req.(*AllocateIDsRequest))
+				}
+				if interceptor == nil {
+					return handler(ctx, req)
+				}
+				info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + ServiceName + "/AllocateIDs"}
+				return interceptor(ctx, req, info, handler)
+			},
+		},
+		{
+			MethodName: "AllocateSegment",
+			Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+				req := new(AllocateSegmentRequest)
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+				handler := func(ctx context.Context, req any) (any, error) {
+					return srv.(idService).AllocateSegment(ctx, req.(*AllocateSegmentRequest))
+				}
+				if interceptor == nil {
+					return handler(ctx, req)
+				}
+				info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + ServiceName + "/AllocateSegment"}
+				return interceptor(ctx, req, info, handler)
+			},
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+// ServerConfig 是 ID 服务的运行参数
+type ServerConfig struct {
+	GRPCAddr     string
+	HTTPAddr     string
+	MaxBatchSize int
+}
+
+// Server 以 gRPC 和 HTTP 两种协议对外提供 ID 分配
+type Server struct {
+	client *Client
+	cfg    ServerConfig
+	logger clog.Logger
+
+	grpcServer   *grpc.Server
+	health       *health.Server
+	httpServer   *http.Server
+	grpcListener net.Listener
+	httpListener net.Listener
+}
+
+// NewServer 创建 ID 服务，不会立即监听
+func NewServer(client *Client, cfg ServerConfig, logger clog.Logger) *Server {
+	s := &Server{
+		client: client,
+		cfg:    cfg,
+		logger: logger,
+		health: health.NewServer(),
+	}
+	s.grpcServer = grpc.NewServer()
+	s.RegisterGRPC(s.grpcServer)
+	s.httpServer = &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return s
+}
+
+// RegisterGRPC 将 ID 服务和健康检查服务注册到已有的 gRPC 服务器上
+func (s *Server) RegisterGRPC(registrar grpc.ServiceRegistrar) {
+	registrar.RegisterService(&serviceDesc, s)
+	healthpb.RegisterHealthServer(registrar, s.health)
+}
+
+// Start 开始监听配置的地址并在后台处理请求，监听失败时关闭已打开的监听器并返回错误
+func (s *Server) Start() error {
+	if s.cfg.GRPCAddr != "" {
+		ln, err := net.Listen("tcp", s.cfg.GRPCAddr)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", s.cfg.GRPCAddr, err)
+		}
+		s.grpcListener = ln
+	}
+	if s.cfg.HTTPAddr != "" {
+		ln, err := net.Listen("tcp", s.cfg.HTTPAddr)
+		if err != nil {
+			if s.grpcListener != nil {
+				s.grpcListener.Close()
+				s.grpcListener = nil
+			}
+			return fmt.Errorf("failed to listen on %s: %w", s.cfg.HTTPAddr, err)
+		}
+		s.httpListener = ln
+	}
+
+	if s.grpcListener != nil {
+		go func() {
+			if err := s.grpcServer.Serve(s.grpcListener); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+				s.logger.Error("ID 服务 gRPC 监听异常退出", clog.Err(err))
+			}
+		}()
+	}
+	if s.httpListener != nil {
+		go func() {
+			if err := s.httpServer.Serve(s.httpListener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				s.logger.Error("ID 服务 HTTP 监听异常退出", clog.Err(err))
+			}
+		}()
+	}
+	s.health.SetServingStatus(ServiceName, healthpb.HealthCheckResponse_SERVING)
+
+	s.logger.Info("ID 服务已启动",
+		clog.String("grpcAddr", s.GRPCAddr()),
+		clog.String("httpAddr", s.HTTPAddr()))
+	return nil
+}
+
+// GRPCAddr 返回 gRPC 实际监听的地址，未启动时返回配置的地址
+func (s *Server) GRPCAddr() string {
+	if s.grpcListener != nil {
+		return s.grpcListener.Addr().String()
+	}
+	return s.cfg.GRPCAddr
+}
+
+// HTTPAddr 返回 HTTP 实际监听的地址，未启动时返回配置的地址
+func (s *Server) HTTPAddr() string {
+	if s.httpListener != nil {
+		return s.httpListener.Addr().String()
+	}
+	return s.cfg.HTTPAddr
+}
+
+// Shutdown 将健康状态置为 NOT_SERVING 后优雅关闭两个监听，ctx 到期时强制关闭 gRPC 连接
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.health.Shutdown()
+
+	stopped := make(chan struct{})
+	go func() {
+		s.grpcServer.GracefulStop()
+		close(stopped)
+	}()
+
+	var err error
+	if s.httpListener != nil {
+		if shutdownErr := s.httpServer.Shutdown(ctx); shutdownErr != nil {
+			err = fmt.Errorf("failed to shutdown http server: %w", shutdownErr)
+		}
+	}
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		s.grpcServer.Stop()
+		<-stopped
+	}
+
+	s.logger.Info("ID 服务已关闭")
+	return err
+}
+
+// AllocateIDs 批量分配 ID，数量必须在 1 到 MaxBatchSize 之间
+func (s *Server) AllocateIDs(_ context.Context, req *AllocateIDsRequest) (*AllocateIDsResponse, error) {
+	if req.Count <= 0 || req.Count > s.cfg.MaxBatchSize {
+		return nil, status.Errorf(codes.InvalidArgument, "count must be between 1 and %d, got: %d", s.cfg.MaxBatchSize, req.Count)
+	}
+	ids := s.client.GenerateBatch(req.Count)
+	resp := &AllocateIDsResponse{IDs: make([]string, len(ids))}
+	for i, id := range ids {
+		resp.IDs[i] = strconv.FormatInt(id, 10)
+	}
+	return resp, nil
+}
+
+// AllocateSegment 分配一个号段
+func (s *Server) AllocateSegment(_ context.Context, _ *AllocateSegmentRequest) (*Segment, error) {
+	start, count := s.client.ReserveSegment()
+	return &Segment{Start: start, Count: count}, nil
+}
+
+// Handler 返回 ID 服务的 HTTP 路由，便于挂载到已有的 HTTP 服务器上：
+//
+//	GET /v1/ids?count=N  批量分配 ID
+//	GET /v1/segment      分配号段
+//	GET /healthz         健康检查
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/ids", s.handleAllocateIDs)
+	mux.HandleFunc("/v1/segment", s.handleAllocateSegment)
+	mux.HandleFunc("/healthz", s.handleHealth)
+	return mux
+}
+
+func (s *Server) handleAllocateIDs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	count := 1
+	if raw := r.URL.Query().Get("count"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid count: %q", raw))
+			return
+		}
+		count = n
+	}
+	resp, err := s.AllocateIDs(r.Context(), &AllocateIDsRequest{Count: count})
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, status.Convert(err).Message())
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleAllocateSegment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	resp, _ := s.AllocateSegment(r.Context(), &AllocateSegmentRequest{})
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	resp, err := s.health.Check(r.Context(), &healthpb.HealthCheckRequest{Service: ServiceName})
+	if err != nil || resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "not_serving"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "serving"})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
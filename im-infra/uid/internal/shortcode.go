@@ -0,0 +1,176 @@
+package internal
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+)
+
+const (
+	// Base32Alphabet 是 Crockford Base32 字母表，去掉了易混淆的 I、L、O、U
+	Base32Alphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+	// Base58Alphabet 是 Bitcoin Base58 字母表，去掉了易混淆的 0、O、I、l
+	Base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+)
+
+// Reserver 检查并占用一个短码，返回 false 表示该短码已被占用
+type Reserver interface {
+	Reserve(ctx context.Context, code string) (bool, error)
+}
+
+// ShortCodeGenerator 生成带校验位的短码
+type ShortCodeGenerator struct {
+	logger      clog.Logger
+	alphabet    string
+	index       map[rune]int
+	length      int
+	banned      []string
+	maxAttempts int
+	reserver    Reserver
+	caseFold    bool
+}
+
+// NewShortCodeGenerator 创建短码生成器。
+// length 为包含校验位在内的总长度；caseFold 为 true 时校验和过滤均不区分大小写。
+func NewShortCodeGenerator(alphabet string, length int, banned []string, maxAttempts int, reserver Reserver, caseFold bool, logger clog.Logger) *ShortCodeGenerator {
+	index := make(map[rune]int, len(alphabet))
+	for i, r := range alphabet {
+		index[r] = i
+	}
+
+	normalized := make([]string, 0, len(banned))
+	for _, word := range banned {
+		if word = strings.TrimSpace(word); word != "" {
+			normalized = append(normalized, strings.ToUpper(word))
+		}
+	}
+
+	return &ShortCodeGenerator{
+		logger:      logger,
+		alphabet:    alphabet,
+		index:       index,
+		length:      length,
+		banned:      normalized,
+		maxAttempts: maxAttempts,
+		reserver:    reserver,
+		caseFold:    caseFold,
+	}
+}
+
+// Generate 生成一个通过过滤并成功占用的短码。
+// 超过 maxAttempts 次仍未得到可用短码时返回 ErrShortCodeExhausted。
+func (g *ShortCodeGenerator) Generate(ctx context.Context) (string, error) {
+	for attempt := 1; attempt <= g.maxAttempts; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+
+		code, err := g.random()
+		if err != nil {
+			return "", fmt.Errorf("failed to generate random code: %w", err)
+		}
+		if g.isBanned(code) {
+			continue
+		}
+
+		if g.reserver != nil {
+			ok, err := g.reserver.Reserve(ctx, code)
+			if err != nil {
+				g.logger.Error("short code reservation failed", clog.String("code", code), clog.Err(err))
+				return "", fmt.Errorf("failed to reserve short code: %w", err)
+			}
+			if !ok {
+				g.logger.Debug("short code collision", clog.String("code", code), clog.Int("attempt", attempt))
+				continue
+			}
+		}
+		return code, nil
+	}
+
+	g.logger.Warn("short code generation exhausted", clog.Int("maxAttempts", g.maxAttempts))
+	return "", ErrShortCodeExhausted
+}
+
+// Validate 检查短码的长度、字符集和校验位
+func (g *ShortCodeGenerator) Validate(code string) bool {
+	code = g.Normalize(code)
+	if len([]rune(code)) != g.length {
+		return false
+	}
+	runes := []rune(code)
+	for _, r := range runes {
+		if _, ok := g.index[r]; !ok {
+			return false
+		}
+	}
+	check, ok := g.checkChar(string(runes[:len(runes)-1]))
+	return ok && check == runes[len(runes)-1]
+}
+
+// Normalize 规范化用户输入的短码：去掉空白和连字符；
+// 不区分大小写的字母表会转为大写，并按 Crockford 规则将 O 视为 0、I/L 视为 1
+func (g *ShortCodeGenerator) Normalize(code string) string {
+	code = strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(code))
+	if !g.caseFold {
+		return code
+	}
+	code = strings.ToUpper(code)
+	return strings.NewReplacer("O", "0", "I", "1", "L", "1").Replace(code)
+}
+
+// random 生成随机主体并追加校验位
+func (g *ShortCodeGenerator) random() (string, error) {
+	n := big.NewInt(int64(len(g.alphabet)))
+	var b strings.Builder
+	for i := 0; i < g.length-1; i++ {
+		v, err := rand.Int(rand.Reader, n)
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(g.alphabet[v.Int64()])
+	}
+
+	body := b.String()
+	check, _ := g.checkChar(body)
+	return body + string(check), nil
+}
+
+// checkChar 使用 Luhn mod N 算法计算校验字符，能检出任意单字符错误和绝大多数相邻字符交换
+func (g *ShortCodeGenerator) checkChar(body string) (rune, bool) {
+	n := len(g.alphabet)
+	factor := 2
+	sum := 0
+
+	runes := []rune(body)
+	for i := len(runes) - 1; i >= 0; i-- {
+		codePoint, ok := g.index[runes[i]]
+		if !ok {
+			return 0, false
+		}
+		addend := factor * codePoint
+		if factor == 2 {
+			factor = 1
+		} else {
+			factor = 2
+		}
+		sum += addend/n + addend%n
+	}
+
+	remainder := sum % n
+	return rune(g.alphabet[(n-remainder)%n]), true
+}
+
+// isBanned 检查短码是否包含禁用的子串（不区分大小写）
+func (g *ShortCodeGenerator) isBanned(code string) bool {
+	upper := strings.ToUpper(code)
+	for _, word := range g.banned {
+		if strings.Contains(upper, word) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,170 @@
+package uid
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/ceyewan/gochat/im-infra/uid/internal"
+)
+
+// ServiceName 是 ID 服务的 gRPC 服务名，方法为 AllocateIDs 和 AllocateSegment
+const ServiceName = internal.ServiceName
+
+// ErrRemoteClosed 在远程分配器关闭后调用时返回
+var ErrRemoteClosed = internal.ErrRemoteClosed
+
+// Segment 是一段连续的 ID [Start, Start+Count)
+type Segment = internal.Segment
+
+// Server 以 gRPC 和 HTTP 两种协议对外提供 ID 分配，使非 Go 服务与 Go 服务共享同一个 ID 空间。
+// gRPC 消息以 JSON 编码（content-subtype 为 "json"），同时注册了标准的 grpc.health.v1 健康检查服务。
+type Server = internal.Server
+
+type ServerConfig struct {
+	// Generator 服务内部使用的雪花算法配置，WorkerID 和 DatacenterID 不能与其他生成器重复
+	Generator Config `json:"generator" yaml:"generator"`
+	// GRPCAddr gRPC 监听地址，为空表示不监听
+	GRPCAddr string `json:"grpcAddr" yaml:"grpcAddr"`
+	// HTTPAddr HTTP 监听地址，为空表示不监听
+	HTTPAddr string `json:"httpAddr" yaml:"httpAddr"`
+	// MaxBatchSize 单次批量分配的最大数量
+	MaxBatchSize int `json:"maxBatchSize" yaml:"maxBatchSize"`
+}
+
+func DefaultServerConfig() ServerConfig {
+	return ServerConfig{
+		Generator:    DefaultConfig(),
+		GRPCAddr:     ":9090",
+		HTTPAddr:     ":8090",
+		MaxBatchSize: 1000,
+	}
+}
+
+func (c *ServerConfig) Validate() error {
+	if err := c.Generator.Validate(); err != nil {
+		return fmt.Errorf("invalid generator config: %w", err)
+	}
+	if c.GRPCAddr == "" && c.HTTPAddr == "" {
+		return fmt.Errorf("at least one of grpcAddr and httpAddr must be set")
+	}
+	if c.MaxBatchSize <= 0 {
+		return fmt.Errorf("maxBatchSize must be positive, got: %d", c.MaxBatchSize)
+	}
+	return nil
+}
+
+// NewServer 创建 ID 服务，调用 Start 后开始监听。
+// 也可以不配置监听地址，通过 RegisterGRPC 和 Handler 挂载到已有的服务器上。
+//
+// 示例：
+//
+//	server, err := uid.NewServer(uid.DefaultServerConfig())
+//	if err := server.Start(); err != nil { ... }
+//	defer server.Shutdown(ctx)
+func NewServer(cfg ServerConfig, opts ...Option) (*Server, error) {
+	options := &Options{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid server config: %w", err)
+	}
+
+	logger := options.Logger
+	if logger == nil {
+		logger = clog.Namespace("uid.server")
+	}
+	if options.ComponentName != "" {
+		logger = logger.With(clog.String("name", options.ComponentName))
+	}
+
+	client, err := internal.NewClient(cfg.Generator, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create uid client: %w", err)
+	}
+
+	return internal.NewServer(client, internal.ServerConfig{
+		GRPCAddr:     cfg.GRPCAddr,
+		HTTPAddr:     cfg.HTTPAddr,
+		MaxBatchSize: cfg.MaxBatchSize,
+	}, logger), nil
+}
+
+// Allocator 从 ID 服务获取 ID
+type Allocator interface {
+	// NextID 返回下一个 ID，优先从本地缓存的号段中发放
+	NextID(ctx context.Context) (int64, error)
+	// Close 关闭与 ID 服务的连接，未发放的 ID 被丢弃
+	Close() error
+}
+
+type RemoteConfig struct {
+	// Target ID 服务的 gRPC 地址，支持 grpc.NewClient 的所有 target 格式，如 "etcd:///uid-service"
+	Target string `json:"target" yaml:"target"`
+	// Timeout 单次号段申请的超时时间
+	Timeout time.Duration `json:"timeout" yaml:"timeout"`
+	// LowWatermark 当前号段剩余 ID 数量不高于该值时在后台预取下一个号段
+	LowWatermark int64 `json:"lowWatermark" yaml:"lowWatermark"`
+}
+
+func DefaultRemoteConfig() RemoteConfig {
+	return RemoteConfig{
+		Timeout:      3 * time.Second,
+		LowWatermark: 1024,
+	}
+}
+
+func (c *RemoteConfig) Validate() error {
+	if c.Target == "" {
+		return fmt.Errorf("target cannot be empty")
+	}
+	if c.Timeout <= 0 {
+		return fmt.Errorf("timeout must be positive, got: %v", c.Timeout)
+	}
+	if c.LowWatermark < 0 {
+		return fmt.Errorf("lowWatermark cannot be negative, got: %d", c.LowWatermark)
+	}
+	return nil
+}
+
+// NewRemote 创建连接 ID 服务的分配器，每次申请一个号段（一毫秒内的 4096 个序列号）并在本地发放。
+// 通过 WithDialOptions 指定传输凭证、负载均衡和服务发现，未指定凭证时需要传入 insecure 凭证。
+//
+// 示例：
+//
+//	cfg := uid.DefaultRemoteConfig()
+//	cfg.Target = "uid-service:9090"
+//	allocator, err := uid.NewRemote(cfg,
+//	    uid.WithDialOptions(grpc.WithTransportCredentials(insecure.NewCredentials())))
+//	id, err := allocator.NextID(ctx)
+func NewRemote(cfg RemoteConfig, opts ...Option) (Allocator, error) {
+	options := &Options{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid remote config: %w", err)
+	}
+
+	logger := options.Logger
+	if logger == nil {
+		logger = clog.Namespace("uid.remote")
+	}
+	if options.ComponentName != "" {
+		logger = logger.With(clog.String("name", options.ComponentName))
+	}
+
+	allocator, err := internal.NewRemoteAllocator(internal.RemoteConfig{
+		Target:       cfg.Target,
+		Timeout:      cfg.Timeout,
+		LowWatermark: cfg.LowWatermark,
+	}, logger, options.DialOptions...)
+	if err != nil {
+		return nil, err
+	}
+	return allocator, nil
+}
@@ -0,0 +1,110 @@
+package uid
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ceyewan/gochat/im-infra/clog"
+	"github.com/ceyewan/gochat/im-infra/uid/internal"
+)
+
+// 短码字母表
+const (
+	// AlphabetBase32 Crockford Base32，不区分大小写，适合需要口头或手动输入的场景
+	AlphabetBase32 = "base32"
+	// AlphabetBase58 Bitcoin Base58，区分大小写，同样长度下组合更多
+	AlphabetBase58 = "base58"
+)
+
+// ErrShortCodeExhausted 在达到最大尝试次数仍未得到可用短码时返回
+var ErrShortCodeExhausted = internal.ErrShortCodeExhausted
+
+// ShortCodeGenerator 生成群邀请码、好友码等面向用户的短码。
+// 短码最后一位是 Luhn mod N 校验位，可以在查库之前拦截大部分输入错误。
+type ShortCodeGenerator interface {
+	// Generate 生成一个未被占用的短码
+	Generate(ctx context.Context) (string, error)
+	// Validate 检查短码格式和校验位，不检查是否已被占用
+	Validate(code string) bool
+	// Normalize 规范化用户输入，应在查库前调用
+	Normalize(code string) string
+}
+
+// Reserver 负责短码的占用检查，返回 false 表示短码已存在。
+// 可以基于 cache 的 SetNX 或 db 的唯一索引实现。
+type Reserver = internal.Reserver
+
+// ReserverFunc 将普通函数适配为 Reserver
+type ReserverFunc func(ctx context.Context, code string) (bool, error)
+
+// Reserve 实现 Reserver 接口
+func (f ReserverFunc) Reserve(ctx context.Context, code string) (bool, error) {
+	return f(ctx, code)
+}
+
+type ShortCodeConfig struct {
+	// Length 短码总长度（含 1 位校验位），取值 6-8
+	Length int `json:"length" yaml:"length"`
+	// Alphabet 字母表，base32 或 base58
+	Alphabet string `json:"alphabet" yaml:"alphabet"`
+	// BannedSubstrings 禁止出现在短码中的子串，不区分大小写
+	BannedSubstrings []string `json:"bannedSubstrings" yaml:"bannedSubstrings"`
+	// MaxAttempts 碰撞或命中禁用词时的最大重试次数
+	MaxAttempts int `json:"maxAttempts" yaml:"maxAttempts"`
+}
+
+func DefaultShortCodeConfig() ShortCodeConfig {
+	return ShortCodeConfig{
+		Length:      8,
+		Alphabet:    AlphabetBase32,
+		MaxAttempts: 10,
+	}
+}
+
+func (c *ShortCodeConfig) Validate() error {
+	if c.Length < 6 || c.Length > 8 {
+		return fmt.Errorf("length must be between 6 and 8, got: %d", c.Length)
+	}
+	if c.Alphabet != AlphabetBase32 && c.Alphabet != AlphabetBase58 {
+		return fmt.Errorf("alphabet must be %q or %q, got: %q", AlphabetBase32, AlphabetBase58, c.Alphabet)
+	}
+	if c.MaxAttempts <= 0 {
+		return fmt.Errorf("maxAttempts must be positive, got: %d", c.MaxAttempts)
+	}
+	return nil
+}
+
+// NewShortCodeGenerator 创建短码生成器。
+// reserver 为 nil 时不做占用检查，调用方需要自行处理唯一性。
+//
+// 示例（基于 cache 占用）：
+//
+//	gen, err := uid.NewShortCodeGenerator(uid.DefaultShortCodeConfig(),
+//	    uid.ReserverFunc(func(ctx context.Context, code string) (bool, error) {
+//	        return cacheProvider.String().SetNX(ctx, "invite:"+code, groupID, 7*24*time.Hour)
+//	    }))
+func NewShortCodeGenerator(cfg ShortCodeConfig, reserver Reserver, opts ...Option) (ShortCodeGenerator, error) {
+	options := &Options{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid short code config: %w", err)
+	}
+
+	logger := options.Logger
+	if logger == nil {
+		logger = clog.Namespace("uid.shortcode")
+	}
+	if options.ComponentName != "" {
+		logger = logger.With(clog.String("name", options.ComponentName))
+	}
+
+	alphabet, caseFold := internal.Base32Alphabet, true
+	if cfg.Alphabet == AlphabetBase58 {
+		alphabet, caseFold = internal.Base58Alphabet, false
+	}
+
+	return internal.NewShortCodeGenerator(alphabet, cfg.Length, cfg.BannedSubstrings, cfg.MaxAttempts, reserver, caseFold, logger), nil
+}
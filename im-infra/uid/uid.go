@@ -6,6 +6,7 @@ import (
 
 	"github.com/ceyewan/gochat/im-infra/clog"
 	"github.com/ceyewan/gochat/im-infra/uid/internal"
+	"google.golang.org/grpc"
 )
 
 type UID interface {
@@ -45,6 +46,8 @@ func (c *Config) Validate() error {
 type Options struct {
 	Logger        clog.Logger
 	ComponentName string
+	// DialOptions 仅用于 NewRemote
+	DialOptions []grpc.DialOption
 }
 
 type Option func(*Options)
@@ -61,6 +64,13 @@ func WithComponentName(name string) Option {
 	}
 }
 
+// WithDialOptions 设置 NewRemote 连接 ID 服务时的 gRPC 拨号选项
+func WithDialOptions(dialOpts ...grpc.DialOption) Option {
+	return func(o *Options) {
+		o.DialOptions = append(o.DialOptions, dialOpts...)
+	}
+}
+
 func (c Config) GetWorkerID() int64 {
 	return c.WorkerID
 }
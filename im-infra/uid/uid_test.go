@@ -2,12 +2,19 @@ package uid
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 )
 
 func TestConfig_Validate(t *testing.T) {
@@ -322,3 +329,208 @@ func BenchmarkGenerateString(b *testing.B) {
 		}
 	})
 }
+
+func TestShortCodeConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*ShortCodeConfig)
+		wantErr bool
+	}{
+		{"默认配置", func(c *ShortCodeConfig) {}, false},
+		{"base58", func(c *ShortCodeConfig) { c.Alphabet = AlphabetBase58 }, false},
+		{"长度过短", func(c *ShortCodeConfig) { c.Length = 5 }, true},
+		{"长度过长", func(c *ShortCodeConfig) { c.Length = 9 }, true},
+		{"未知字母表", func(c *ShortCodeConfig) { c.Alphabet = "hex" }, true},
+		{"重试次数无效", func(c *ShortCodeConfig) { c.MaxAttempts = 0 }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultShortCodeConfig()
+			tt.modify(&cfg)
+			err := cfg.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestShortCodeGenerator(t *testing.T) {
+	ctx := context.Background()
+
+	for _, alphabet := range []string{AlphabetBase32, AlphabetBase58} {
+		t.Run(alphabet, func(t *testing.T) {
+			cfg := DefaultShortCodeConfig()
+			cfg.Alphabet = alphabet
+			cfg.Length = 6
+			gen, err := NewShortCodeGenerator(cfg, nil)
+			require.NoError(t, err)
+
+			for i := 0; i < 100; i++ {
+				code, err := gen.Generate(ctx)
+				require.NoError(t, err)
+				assert.Len(t, code, 6)
+				assert.True(t, gen.Validate(code), code)
+
+				// 修改任意一位都应被校验位拦截
+				for pos := 0; pos < len(code); pos++ {
+					for _, r := range []byte("23456789") {
+						if code[pos] == r {
+							continue
+						}
+						typo := code[:pos] + string(r) + code[pos+1:]
+						assert.False(t, gen.Validate(typo), "typo %s of %s", typo, code)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestShortCodeGenerator_Normalize(t *testing.T) {
+	gen, err := NewShortCodeGenerator(DefaultShortCodeConfig(), nil)
+	require.NoError(t, err)
+
+	code, err := gen.Generate(context.Background())
+	require.NoError(t, err)
+
+	input := strings.ToLower(code[:4]) + "-" + code[4:]
+	assert.Equal(t, code, gen.Normalize(input))
+	assert.True(t, gen.Validate(input))
+	assert.Equal(t, "0111", gen.Normalize("oIl1"))
+}
+
+func TestShortCodeGenerator_Reserver(t *testing.T) {
+	ctx := context.Background()
+	cfg := DefaultShortCodeConfig()
+	cfg.MaxAttempts = 3
+
+	t.Run("碰撞后重试", func(t *testing.T) {
+		calls := 0
+		gen, err := NewShortCodeGenerator(cfg, ReserverFunc(func(ctx context.Context, code string) (bool, error) {
+			calls++
+			return calls == 2, nil
+		}))
+		require.NoError(t, err)
+
+		_, err = gen.Generate(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("重试耗尽", func(t *testing.T) {
+		gen, err := NewShortCodeGenerator(cfg, ReserverFunc(func(ctx context.Context, code string) (bool, error) {
+			return false, nil
+		}))
+		require.NoError(t, err)
+
+		_, err = gen.Generate(ctx)
+		assert.ErrorIs(t, err, ErrShortCodeExhausted)
+	})
+
+	t.Run("占用失败", func(t *testing.T) {
+		gen, err := NewShortCodeGenerator(cfg, ReserverFunc(func(ctx context.Context, code string) (bool, error) {
+			return false, errors.New("redis down")
+		}))
+		require.NoError(t, err)
+
+		_, err = gen.Generate(ctx)
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, ErrShortCodeExhausted)
+	})
+}
+
+func TestShortCodeGenerator_BannedSubstrings(t *testing.T) {
+	cfg := DefaultShortCodeConfig()
+	cfg.Length = 6
+	cfg.MaxAttempts = 1000
+	// 禁用所有数字，生成结果中应只包含字母
+	cfg.BannedSubstrings = []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9"}
+
+	gen, err := NewShortCodeGenerator(cfg, nil)
+	require.NoError(t, err)
+
+	for i := 0; i < 20; i++ {
+		code, err := gen.Generate(context.Background())
+		require.NoError(t, err)
+		assert.False(t, strings.ContainsAny(code, "0123456789"), code)
+	}
+}
+
+func TestServer(t *testing.T) {
+	cfg := DefaultServerConfig()
+	cfg.GRPCAddr = "127.0.0.1:0"
+	cfg.HTTPAddr = "127.0.0.1:0"
+	cfg.MaxBatchSize = 100
+
+	server, err := NewServer(cfg)
+	require.NoError(t, err)
+	require.NoError(t, server.Start())
+	defer server.Shutdown(context.Background())
+
+	t.Run("http batch", func(t *testing.T) {
+		resp, err := http.Get("http://" + server.HTTPAddr() + "/v1/ids?count=10")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var body struct {
+			IDs []string `json:"ids"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Len(t, body.IDs, 10)
+
+		resp, err = http.Get("http://" + server.HTTPAddr() + "/v1/ids?count=101")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("http health", func(t *testing.T) {
+		resp, err := http.Get("http://" + server.HTTPAddr() + "/healthz")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("remote allocator", func(t *testing.T) {
+		remoteCfg := DefaultRemoteConfig()
+		remoteCfg.Target = server.GRPCAddr()
+		allocator, err := NewRemote(remoteCfg,
+			WithDialOptions(grpc.WithTransportCredentials(insecure.NewCredentials())))
+		require.NoError(t, err)
+		defer allocator.Close()
+
+		// 跨越多个号段，并与服务端直接分配的 ID 交错，检查没有重复
+		seen := make(map[int64]bool)
+		for i := 0; i < 10000; i++ {
+			id, err := allocator.NextID(context.Background())
+			require.NoError(t, err)
+			require.False(t, seen[id], "duplicate id %d", id)
+			seen[id] = true
+
+			if i%1000 == 0 {
+				resp, err := http.Get("http://" + server.HTTPAddr() + "/v1/ids?count=100")
+				require.NoError(t, err)
+				var body struct {
+					IDs []string `json:"ids"`
+				}
+				require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+				resp.Body.Close()
+				for _, raw := range body.IDs {
+					id, err := strconv.ParseInt(raw, 10, 64)
+					require.NoError(t, err)
+					require.False(t, seen[id], "duplicate id %d", id)
+					seen[id] = true
+				}
+			}
+		}
+
+		require.NoError(t, allocator.Close())
+		_, err = allocator.NextID(context.Background())
+		assert.ErrorIs(t, err, ErrRemoteClosed)
+	})
+}